@@ -0,0 +1,137 @@
+import os
+import importlib
+import importlib.util
+import checker
+import diagnostics
+import fileset
+import syntree
+
+from dataclasses import dataclass, field
+from diagnostics import Diagnostic, Fix
+from typing import Any, Callable, Dict, List, Optional
+
+
+# The analysis passes run on the packages of a program once they are type
+# checked, like the analyzers of golang.org/x/tools/go/analysis: an Analyzer
+# registered (see register, or the -plugin flag of go_parser.py loading the
+# modules registering them) is run on each package of the program (not the
+# ones of std) with a Pass, which has the AST of the package and the
+# checker.Info of its expressions, and reports its diagnostics like the
+# warnings of the type checker. The analyzers an Analyzer requires are run
+# before it on the same package, their results are in Pass.result_of. The
+# passes only run if the program has no errors
+
+@dataclass
+class Analyzer:
+    """An analysis, run is called with the Pass of each package and returns
+    its result (for the analyzers requiring it). name is the code of the
+    diagnostics it reports (so --suppress can suppress them)"""
+
+    name: str
+    doc: str
+    run: Callable[["Pass"], Any]
+    requires: List["Analyzer"] = field(default_factory=list)
+
+
+class Pass:
+    """What an Analyzer gets to analyze a package"""
+
+    def __init__(self, analyzer: Analyzer, package, info: checker.Info, results: Dict[str, Any]):
+        self.analyzer = analyzer
+        # the loader.Package, its files are the File nodes of its AST
+        self.package = package
+        self.files: List[syntree.File] = [
+            f for f in package.ast.children if isinstance(f, syntree.File)
+        ]
+        self.info = info
+        # the results of the analyzers it requires, by name
+        self.result_of = {a.name: results[a.name] for a in analyzer.requires}
+
+    def type_of(self, node) -> Optional[syntree.Type]:
+        """The type of an expression, None if it isn't known"""
+        operand = self.info.operands.get(node)
+        return None if operand is None else operand.type_
+
+    def report(self, message: str, node, notes: Optional[List[Diagnostic]] = None,
+               fix: Optional[Fix] = None, file: Optional[str] = None) -> Diagnostic:
+        """Reports a warning at the node, in the file it is in (unless file)"""
+        lineno, col_num, width = checker.position(node)
+        if file is None:
+            file = fileset.fset.position(node.pos).filename if node.pos else None
+        if file is None:
+            file = self.info.files.get(node)
+        return diagnostics.report(Diagnostic(
+            message, lineno, col_num, width, kind="ANALYSIS", severity="warning",
+            code=self.analyzer.name, notes=notes or [], file=file, fix=fix
+        ))
+
+
+# the analyzers registered, run in order (each one after the ones it requires)
+analyzers: List[Analyzer] = []
+
+
+def register(*new: Analyzer):
+    """Adds the analyzers to the ones run on the programs checked, an
+    analyzer with the name of one registered replaces it"""
+    for analyzer in new:
+        for i, other in enumerate(analyzers):
+            if other.name == analyzer.name:
+                analyzers[i] = analyzer
+                break
+        else:
+            analyzers.append(analyzer)
+
+
+def load_plugin(name: str):
+    """Imports the module name (or the python file named name), which
+    registers its analyzers, or has them in a list named analyzers.
+    Returns the module (it may have backends too, see backend.py)"""
+    if name.endswith(".py"):
+        module_name = os.path.splitext(os.path.basename(name))[0]
+        spec = importlib.util.spec_from_file_location(module_name, name)
+        if spec is None or spec.loader is None:
+            raise ImportError(f"cannot load plugin {name}")
+        module = importlib.util.module_from_spec(spec)
+        spec.loader.exec_module(module)
+    else:
+        module = importlib.import_module(name)
+    register(*getattr(module, "analyzers", []))
+    return module
+
+
+def ordered(selected: List[Analyzer]) -> List[Analyzer]:
+    """The analyzers, each one after the ones it requires, once"""
+    order: List[Analyzer] = []
+
+    def add(analyzer: Analyzer):
+        if any(a is analyzer for a in order):
+            return
+        for required in analyzer.requires:
+            add(required)
+        order.append(analyzer)
+
+    for analyzer in selected:
+        add(analyzer)
+    return order
+
+
+def run(packages: list, info: checker.Info, selected: Optional[List[Analyzer]] = None):
+    """Runs the analyzers (the ones registered by default) on the packages
+    of a program checked with info, but the ones of std. An analyzer raising
+    an exception is reported as an error"""
+    order = ordered(analyzers if selected is None else selected)
+    if not order:
+        return
+    for package in packages:
+        if package.std or package.ast is None:
+            continue
+        results: Dict[str, Any] = {}
+        for analyzer in order:
+            try:
+                results[analyzer.name] = analyzer.run(Pass(analyzer, package, info, results))
+            except Exception as e:
+                results[analyzer.name] = None
+                diagnostics.report(Diagnostic(
+                    f"analyzer {analyzer.name} failed on package {package.path}: {e!r}",
+                    kind="ANALYSIS", code="AnalyzerFailed", file=package.files[0]
+                ))
@@ -0,0 +1,565 @@
+import sys
+import struct
+import argparse
+
+from dataclasses import dataclass, field
+from fractions import Fraction
+from typing import Any, Dict, Iterator, List, Optional
+
+
+# A binary format for the ASTs of the packages of a program checked, with
+# what the type checker found about them: the type of each expression, its
+# mode and its constant value, and the object each identifier declares or
+# refers to. encode writes the packages returned by go_parser.check_program
+# (with their checker.Info), decode reads them back as the Nodes and the
+# Types of this module, which only need the standard library, so the tools
+# reading them don't import the front end (this module only imports it to
+# encode, see encode).
+#
+# The format is versioned by the byte after the magic, a program encoded
+# with a version decode doesn't know is an error. After it comes a value,
+# tagged by its first byte:
+#  - None, false and true are the tags NONE, FALSE and TRUE alone
+#  - INT is followed by the integer, zigzag encoded in a varint (of any
+#    size), FLOAT by a big endian float64
+#  - STRING is followed by the length of the UTF-8 bytes of the string and
+#    the bytes, STRINGREF by the index of a string before (the strings are
+#    numbered in order), BYTES by the length of the bytes and the bytes
+#  - LIST is followed by the number of values and the values, MAP by the
+#    number of entries, each one a string value (the key) and a value
+#  - NODE and TYPE are followed by the entries of a map (without its tag),
+#    the fields of a node or of a type, REF by the index of a node or a type
+#    before (they are numbered in order): the types refer to each other,
+#    like a named type to itself through a method
+# The program is a map, its packages have their files, nodes with their
+# class ("node"), their position and their end ([file, line, column]), the
+# fields of the class (the ones astdump shows), their children if they
+# aren't fields and, for the expressions, "checked": their "mode", "type"
+# and "value" (a constant, a map of its kind and its value), and "object"
+# for the identifiers. The types are maps of their kind and their fields, with
+# their Go syntax in "string"
+
+magic = b"GOPYAST"
+version = 1
+
+NONE, FALSE, TRUE, INT, FLOAT, STRING, STRINGREF, BYTES, LIST, MAP, NODE, TYPE, REF = range(13)
+
+
+@dataclass(eq=False)
+class Node:
+    """A node of the AST, kind is its class in syntree, like IfStmt. pos
+    and end are (file, line, column), None if it has no position"""
+
+    kind: str = ""
+    pos: Optional[tuple] = None
+    end: Optional[tuple] = None
+    fields: Dict[str, Any] = field(default_factory=dict)
+    children: list = field(default_factory=list)
+    # for the expressions, like mode constant, type untyped int and value 3
+    # (types are the ones of the results of a call, for mode tuple)
+    type: Optional["Type"] = None
+    mode: Optional[str] = None
+    types: List["Type"] = field(default_factory=list)
+    value: Any = None
+    # the object an identifier declares or refers to: its kind, its name,
+    # its type and the (file, line, column) of its declaration
+    object: Optional[dict] = None
+
+
+@dataclass(eq=False)
+class Type:
+    """A type, kind is basic, named, pointer, slice, array, map, chan,
+    func, struct, interface, union or typeparam. string is the type in
+    Go syntax (qualified by its package, like main.Point)"""
+
+    kind: str = ""
+    string: str = ""
+    fields: Dict[str, Any] = field(default_factory=dict)
+
+    def __str__(self):
+        return self.string
+
+
+@dataclass
+class Package:
+    path: str
+    name: Optional[str]
+    std: bool
+    # the File nodes
+    files: List[Node]
+
+
+def walk(node: Node) -> Iterator[Node]:
+    """The node and the nodes under it (in its fields and its children),
+    depth first, each one once"""
+    seen = set()
+    stack = [node]
+    while stack:
+        n = stack.pop()
+        if id(n) in seen:
+            continue
+        seen.add(id(n))
+        yield n
+        nested = list(_nodes(list(n.fields.values()) + n.children))
+        stack.extend(reversed(nested))
+
+
+def _nodes(value: Any) -> Iterator[Node]:
+    if isinstance(value, Node):
+        yield value
+    elif isinstance(value, list):
+        for v in value:
+            yield from _nodes(v)
+    elif isinstance(value, dict):
+        for v in value.values():
+            yield from _nodes(v)
+
+
+# encoding
+
+class Encoder:
+    def __init__(self, info):
+        import checker
+        import fileset
+        import syntree
+        self.checker, self.fset, self.syntree = checker, fileset.fset, syntree
+        self.info = info
+        self.out = bytearray()
+        self.strings: Dict[str, int] = {}
+        # the index of each node and type encoded, by id
+        self.objects: Dict[int, int] = {}
+        # the nodes and the types encoded, kept so their ids aren't reused
+        self.kept: list = []
+        self.filename: Optional[str] = None
+
+    def varint(self, n: int):
+        while n >= 0x80:
+            self.out.append(n & 0x7f | 0x80)
+            n >>= 7
+        self.out.append(n)
+
+    def value(self, v: Any):
+        """Encodes a value made of None, bools, ints, floats, strings,
+        bytes, lists, tuples and dicts (with string keys)"""
+        if v is None:
+            self.out.append(NONE)
+        elif isinstance(v, bool):
+            self.out.append(TRUE if v else FALSE)
+        elif isinstance(v, int):
+            self.out.append(INT)
+            self.varint(v << 1 if v >= 0 else (-v << 1) - 1)
+        elif isinstance(v, float):
+            self.out.append(FLOAT)
+            self.out += struct.pack(">d", v)
+        elif isinstance(v, str):
+            self.string(v)
+        elif isinstance(v, bytes):
+            self.out.append(BYTES)
+            self.varint(len(v))
+            self.out += v
+        elif isinstance(v, (list, tuple)):
+            self.out.append(LIST)
+            self.varint(len(v))
+            for item in v:
+                self.value(item)
+        elif isinstance(v, dict):
+            self.out.append(MAP)
+            self.entries(v)
+        else:
+            raise TypeError(f"can't encode {type(v).__name__}")
+
+    def string(self, s: str):
+        if s in self.strings:
+            self.out.append(STRINGREF)
+            self.varint(self.strings[s])
+            return
+        self.strings[s] = len(self.strings)
+        data = s.encode("utf-8", "surrogateescape")
+        self.out.append(STRING)
+        self.varint(len(data))
+        self.out += data
+
+    def entries(self, d: dict):
+        self.varint(len(d))
+        for k, v in d.items():
+            self.string(k)
+            self.value(v)
+
+    def ref(self, obj: Any) -> bool:
+        """Encodes a reference to obj if it was encoded before, else numbers it"""
+        if id(obj) in self.objects:
+            self.out.append(REF)
+            self.varint(self.objects[id(obj)])
+            return True
+        self.objects[id(obj)] = len(self.objects)
+        self.kept.append(obj)
+        return False
+
+    # the values of the fields, the nodes and the types are encoded as
+    # they come (see Deferred)
+
+    def field_value(self, v: Any) -> Any:
+        syntree = self.syntree
+        if isinstance(v, syntree.Type):
+            return Deferred(self.type_, v)
+        elif isinstance(v, syntree.Node):
+            return Deferred(self.node, v)
+        elif isinstance(v, syntree.SymbolInfo):
+            return v.name
+        elif isinstance(v, syntree.CommentGroup):
+            return v.text()
+        elif isinstance(v, tuple) and len(v) == 3 and v[0] == "identifier":
+            return v[1]
+        elif isinstance(v, (list, tuple)):
+            return [self.field_value(item) for item in v]
+        elif isinstance(v, dict):
+            return {str(k): self.field_value(item) for k, item in v.items()}
+        elif v is None or isinstance(v, (bool, int, float, str, bytes)):
+            return v
+        return self.constant_value(v)
+
+    def constant_value(self, v: Any) -> Any:
+        import constant
+        if isinstance(v, constant.Constant):
+            return {"kind": v.kind, "value": self.constant_value(v.value)}
+        elif isinstance(v, Fraction):
+            return {"num": v.numerator, "den": v.denominator}
+        elif isinstance(v, complex):
+            return {"real": v.real, "imag": v.imag}
+        elif isinstance(v, tuple):
+            return [self.constant_value(item) for item in v]
+        elif v is None or isinstance(v, (bool, int, float, str, bytes)):
+            return v
+        return str(v)
+
+    def emit(self, v: Any):
+        """Encodes a value whose nodes and types are Deferred"""
+        if isinstance(v, Deferred):
+            v.encode()
+        elif isinstance(v, list):
+            self.out.append(LIST)
+            self.varint(len(v))
+            for item in v:
+                self.emit(item)
+        elif isinstance(v, dict):
+            self.out.append(MAP)
+            self.emit_entries(v)
+        else:
+            self.value(v)
+
+    def emit_entries(self, d: dict):
+        self.varint(len(d))
+        for k, v in d.items():
+            self.string(k)
+            self.emit(v)
+
+    def position(self, pos: int) -> Optional[list]:
+        if pos == 0:
+            return None
+        p = self.fset.position(pos)
+        return [p.filename or self.filename, p.line, p.column]
+
+    def node(self, node: Any):
+        import astdump
+        if self.ref(node):
+            return
+        if isinstance(node, self.syntree.File):
+            self.filename = node.filename
+        fields: Dict[str, Any] = {"node": type(node).__name__}
+        pos = self.position(node.pos)
+        if pos is None:
+            lineno, col_num, _ = self.checker.position(node)
+            if isinstance(lineno, int):
+                pos = [self.filename, lineno, col_num if isinstance(col_num, int) else 0]
+        fields["pos"] = pos
+        fields["end"] = self.position(node.end)
+
+        shown: set = set()
+        for name, value in vars(node).items():
+            if name in astdump.hidden or name.startswith("_") or name in fields:
+                continue
+            astdump._collect(value, shown)
+            fields[name] = self.field_value(value)
+        if node.data is not None and not astdump._in_fields(node):
+            fields["data"] = self.field_value(node.data)
+        children = node.children
+        if isinstance(node, self.syntree.List):
+            children = list(reversed(children))
+        children = [child for child in children if id(child) not in shown]
+        if children:
+            fields["children"] = [self.field_value(child) for child in children]
+        self.annotate(node, fields)
+
+        self.out.append(NODE)
+        self.emit_entries(fields)
+
+    def annotate(self, node: Any, fields: dict):
+        """Adds what the type checker found about the node to its fields"""
+        info = self.info
+        if info is None:
+            return
+        operand = info.operands.get(node)
+        if operand is not None:
+            fields["checked"] = {
+                "mode": operand.mode,
+                "type": None if operand.type_ is None else Deferred(self.type_, operand.type_),
+                "types": [Deferred(self.type_, t) for t in operand.tuple_types],
+                "value": None if operand.constant is None else self.constant_value(operand.constant),
+            }
+        obj = info.defs.get(node) or info.uses.get(node) or info.redeclared.get(node)
+        if obj is not None:
+            fields["object"] = {
+                "kind": obj.kind,
+                "name": obj.name,
+                "type": None if obj.type_ is None else Deferred(self.type_, obj.type_),
+                "pos": None if obj.lineno is None else [obj.file, obj.lineno, obj.col_num or 0],
+            }
+
+    def type_(self, t: Any):
+        if self.ref(t):
+            return
+        syntree, checker = self.syntree, self.checker
+        if isinstance(t, syntree.Signature):
+            # the type of a function object
+            fields: Dict[str, Any] = {"kind": "func",
+                                      "string": "func" + checker.signature_string(t, True)}
+            fields.update(self.signature(t))
+            self.out.append(TYPE)
+            self.emit_entries(fields)
+            return
+        fields = {"kind": "basic", "string": checker.type_string(t, qualified=True)}
+        if isinstance(t, syntree.NamedType):
+            fields["kind"] = "named"
+            fields["name"] = t.typename
+            fields["package"] = t.package
+            fields["underlying"] = None if not t.children else Deferred(self.type_, t.children[0])
+            fields["methods"] = [
+                {"name": name, "pointer": bool(m.pointer_receiver),
+                 "signature": self.signature(m.signature)}
+                for name, m in t.methods.items()
+            ]
+            fields["type_params"] = [Deferred(self.type_, p) for p in t.type_params]
+            fields["origin"] = None if t.origin is None else Deferred(self.type_, t.origin)
+            fields["type_args"] = [Deferred(self.type_, a) for a in t.type_args]
+        elif isinstance(t, syntree.Pointer):
+            fields.update(kind="pointer", base=Deferred(self.type_, t.base))
+        elif isinstance(t, syntree.Slice):
+            fields.update(kind="slice", elem=Deferred(self.type_, t.eltype))
+        elif isinstance(t, syntree.Array):
+            length = t.length if isinstance(t.length, int) else None
+            fields.update(kind="array", length=length, elem=Deferred(self.type_, t.eltype))
+        elif isinstance(t, syntree.Map):
+            fields.update(kind="map", key=Deferred(self.type_, t.key),
+                          elem=Deferred(self.type_, t.eltype))
+        elif isinstance(t, syntree.Chan):
+            fields.update(kind="chan", dir=t.dir, elem=Deferred(self.type_, t.eltype))
+        elif isinstance(t, syntree.FunctionType):
+            fields.update(kind="func", **self.signature(t.signature))
+        elif isinstance(t, syntree.Struct):
+            fields.update(kind="struct", fields=[
+                {"name": f.f_name, "type": self.maybe_type(f.type_), "embedded": f.embedded,
+                 "tag": None if f.tag is None else f.tag[1]}
+                for f in t.fields
+            ])
+        elif isinstance(t, syntree.Interface):
+            fields.update(kind="interface", alias=t.alias, comparable=t.comparable, methods=[
+                {"name": m.m_name, "signature": self.signature(m.signature)} for m in t.methods
+            ], terms=None if t.terms is None else [
+                {"tilde": tilde, "type": self.maybe_type(term)} for tilde, term in t.terms
+            ])
+        elif isinstance(t, syntree.TypeUnion):
+            fields.update(kind="union", terms=[
+                {"tilde": tilde, "type": self.maybe_type(term)} for tilde, term in t.terms
+            ])
+        elif isinstance(t, syntree.TypeParam):
+            fields.update(kind="typeparam", name=t.typename,
+                          constraint=self.maybe_type(t.constraint))
+        self.out.append(TYPE)
+        self.emit_entries(fields)
+
+    def maybe_type(self, t: Any) -> Any:
+        return Deferred(self.type_, t) if isinstance(t, self.syntree.Type) else None
+
+    def signature(self, signature: Any) -> dict:
+        return {
+            "params": [self.maybe_type(t) for t in signature.parameter_types],
+            "results": [self.maybe_type(t) for t in signature.result_types],
+            "variadic": signature.variadic,
+        }
+
+
+@dataclass
+class Deferred:
+    """A node or a type in the fields of another one, encoded with them"""
+
+    encode_: Any
+    obj: Any
+
+    def encode(self):
+        self.encode_(self.obj)
+
+
+def encode(packages: list, info=None, std: bool = False) -> bytes:
+    """The packages of a program (see go_parser.check_program) encoded, with
+    the types, the modes, the constant values and the objects of info, if
+    given. The packages of std have no files unless std"""
+    encoder = Encoder(info)
+    encoder.out += magic + bytes([version])
+    program = {"packages": [
+        {"path": package.path, "name": package.name, "std": package.std,
+         "files": [] if package.std and not std or package.ast is None else
+         [Deferred(encoder.node, f) for f in package.ast.children]}
+        for package in packages
+    ]}
+    encoder.out.append(MAP)
+    encoder.emit_entries(program)
+    return bytes(encoder.out)
+
+
+# decoding
+
+class Decoder:
+    def __init__(self, data: bytes):
+        self.data = data
+        self.i = 0
+        self.strings: List[str] = []
+        self.objects: list = []
+
+    def byte(self) -> int:
+        if self.i >= len(self.data):
+            raise ValueError("astcodec: unexpected end of data")
+        self.i += 1
+        return self.data[self.i - 1]
+
+    def varint(self) -> int:
+        n, shift = 0, 0
+        while True:
+            b = self.byte()
+            n |= (b & 0x7f) << shift
+            shift += 7
+            if b < 0x80:
+                return n
+
+    def raw(self, n: int) -> bytes:
+        if self.i + n > len(self.data):
+            raise ValueError("astcodec: unexpected end of data")
+        self.i += n
+        return self.data[self.i - n:self.i]
+
+    def value(self) -> Any:
+        tag = self.byte()
+        if tag == NONE:
+            return None
+        elif tag in (FALSE, TRUE):
+            return tag == TRUE
+        elif tag == INT:
+            n = self.varint()
+            return n >> 1 if n & 1 == 0 else -((n + 1) >> 1)
+        elif tag == FLOAT:
+            return struct.unpack(">d", self.raw(8))[0]
+        elif tag == STRING:
+            s = self.raw(self.varint()).decode("utf-8", "surrogateescape")
+            self.strings.append(s)
+            return s
+        elif tag == STRINGREF:
+            return self.strings[self.varint()]
+        elif tag == BYTES:
+            return self.raw(self.varint())
+        elif tag == LIST:
+            return [self.value() for _ in range(self.varint())]
+        elif tag == MAP:
+            return self.entries()
+        elif tag == NODE:
+            node = Node()
+            self.objects.append(node)
+            fields = self.entries()
+            node.kind = fields.pop("node")
+            node.pos = _tuple(fields.pop("pos", None))
+            node.end = _tuple(fields.pop("end", None))
+            node.children = fields.pop("children", [])
+            checked = fields.pop("checked", None)
+            if checked is not None:
+                node.mode, node.type = checked["mode"], checked["type"]
+                node.types, node.value = checked["types"], checked["value"]
+            node.object = fields.pop("object", None)
+            if node.object is not None:
+                node.object["pos"] = _tuple(node.object["pos"])
+            node.fields = fields
+            return node
+        elif tag == TYPE:
+            t = Type()
+            self.objects.append(t)
+            fields = self.entries()
+            t.kind, t.string = fields.pop("kind"), fields.pop("string")
+            t.fields = fields
+            return t
+        elif tag == REF:
+            return self.objects[self.varint()]
+        raise ValueError(f"astcodec: invalid tag {tag} at offset {self.i - 1}")
+
+    def entries(self) -> dict:
+        d = {}
+        for _ in range(self.varint()):
+            key = self.value()
+            d[key] = self.value()
+        return d
+
+
+def _tuple(v: Optional[list]) -> Optional[tuple]:
+    return None if v is None else tuple(v)
+
+
+def decode(data: bytes) -> List[Package]:
+    """The packages encoded by encode"""
+    if data[:len(magic)] != magic:
+        raise ValueError("astcodec: not an encoded program")
+    if len(data) <= len(magic) or data[len(magic)] != version:
+        raise ValueError(f"astcodec: unknown version {data[len(magic):len(magic) + 1]!r} "
+                         f"(decodes version {version})")
+    # the nodes nest like the ones of the AST
+    sys.setrecursionlimit(max(sys.getrecursionlimit(), 20000))
+    decoder = Decoder(data)
+    decoder.i = len(magic) + 1
+    program = decoder.value()
+    return [Package(p["path"], p["name"], p["std"], p["files"]) for p in program["packages"]]
+
+
+if __name__ == "__main__":
+    arg_parser = argparse.ArgumentParser(
+        description="Encodes the AST of a Go program checked, or prints one encoded")
+    arg_parser.add_argument("path", help="a .go file or the directory of a program, or with "
+                                         "-d a file encoded")
+    arg_parser.add_argument("-o", "--output", help="the file the program is encoded to")
+    arg_parser.add_argument("--std", action="store_true",
+                            help="also encodes the files of the packages of std")
+    arg_parser.add_argument("-d", "--decode", action="store_true",
+                            help="prints the nodes of the files encoded in path, with "
+                                 "the types of the expressions")
+    args = arg_parser.parse_args()
+    if args.decode:
+        with open(args.path, "rb") as f:
+            packages = decode(f.read())
+        for package in packages:
+            for file in package.files:
+                for node in walk(file):
+                    position = "" if node.pos is None else ":".join(map(str, node.pos)) + " "
+                    typed = "" if node.type is None else f" {node.mode} {node.type}"
+                    print(f"{position}{node.kind}{typed}")
+        sys.exit(0)
+
+    import io
+    import contextlib
+    import checker
+    import diagnostics
+    import go_parser
+    info = checker.Info()
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = go_parser.check_program(args.path, verbose=False, info=info)
+    if not packages or diagnostics.errors() or go_parser.parse_errors:
+        sys.exit(1)
+    data = encode(packages, info, args.std)
+    if args.output is None:
+        sys.stdout.buffer.write(data)
+    else:
+        with open(args.output, "wb") as f:
+            f.write(data)
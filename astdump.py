@@ -0,0 +1,204 @@
+import sys
+import json
+import checker
+import constant
+import syntree
+
+from fractions import Fraction
+from typing import Any, Dict, List, TextIO
+from symbol_table import SymbolInfo
+
+
+# Dumps an AST as indented text, JSON or S-expressions. Each node is shown
+# with its class, its position (line:column) when it has one, and its fields:
+# the attributes set by its constructor, then the children which are not
+# fields. Types are shown in Go syntax and symbols by name, so a dump is
+# a tree (types refer to each other, like the methods of a named type).
+
+formats = ("text", "json", "sexp")
+
+# attributes shown in another way (the position) or with nothing to show
+hidden = {"name", "children", "data", "append", "lineno", "col_num", "col_no", "pos", "end", "scope"}
+
+
+def to_dict(node: syntree.Node) -> Dict[str, Any]:
+    """The node as a dict of JSON values, with the ones of its fields"""
+    return _node_dict(node, set())
+
+
+def _node_dict(node: syntree.Node, path: set) -> Dict[str, Any]:
+    if id(node) in path:
+        # a node which is (indirectly) a field of itself
+        return {"node": type(node).__name__, "cycle": True}
+    path = path | {id(node)}
+
+    d: Dict[str, Any] = {"node": type(node).__name__}
+    lineno, col_num, _ = checker.position(node)
+    if isinstance(lineno, int):
+        d["line"] = lineno
+    if isinstance(col_num, int):
+        d["column"] = col_num
+
+    shown: set = set()
+    for name, value in vars(node).items():
+        if name in hidden or name.startswith("_"):
+            continue
+        _collect(value, shown)
+        d[name] = _value(value, path)
+
+    if node.data is not None and not _in_fields(node):
+        d["data"] = _value(node.data, path)
+
+    children = node.children
+    if isinstance(node, syntree.List):
+        # lists are built in reverse by the parser
+        children = list(reversed(children))
+    children = [child for child in children if id(child) not in shown]
+    if children:
+        d["children"] = [_value(child, path) for child in children]
+    return d
+
+
+def _collect(value: Any, shown: set):
+    """Adds the ids of the nodes in a field to shown, they are not shown
+    again as children (like the parameters of a signature)"""
+    if isinstance(value, syntree.Node):
+        if id(value) in shown:
+            return
+        shown.add(id(value))
+        if isinstance(value, syntree.Type):
+            return
+        for child in value.children:
+            _collect(child, shown)
+        for name, field in vars(value).items():
+            if name not in hidden and not name.startswith("_"):
+                _collect(field, shown)
+    elif isinstance(value, (list, tuple)):
+        for v in value:
+            _collect(v, shown)
+
+
+def _in_fields(node: syntree.Node) -> bool:
+    """If the data of the node has nothing more than its fields and its
+    position, like the (name, lineno, col_num) of an Identifier"""
+    fields = [
+        v for k, v in vars(node).items()
+        if k not in ("name", "children", "data", "pos", "end") and not k.startswith("_")
+    ]
+    fields += [_name(v) for v in fields]
+    parts = node.data if isinstance(node.data, tuple) else (node.data,)
+    if _is_identifier(node.data):
+        parts = (node.data[1],)
+    return all(any(part is v or _name(part) == v for v in fields) for part in parts)
+
+
+def _is_identifier(value: Any) -> bool:
+    """If the value is an identifier from the lexer, with its column"""
+    return isinstance(value, tuple) and len(value) == 3 and value[0] == "identifier"
+
+
+def _name(value: Any) -> Any:
+    if isinstance(value, SymbolInfo):
+        return value.name
+    elif _is_identifier(value):
+        return value[1]
+    return value
+
+
+def _value(value: Any, path: set) -> Any:
+    if isinstance(value, syntree.Type):
+        return checker.type_string(value)
+    elif isinstance(value, syntree.Node):
+        return _node_dict(value, path)
+    elif isinstance(value, SymbolInfo):
+        return value.name
+    elif isinstance(value, syntree.CommentGroup):
+        return value.text()
+    elif _is_identifier(value):
+        return value[1]
+    elif isinstance(value, (list, tuple)):
+        return [_value(v, path) for v in value]
+    elif isinstance(value, dict):
+        return {str(k): _value(v, path) for k, v in value.items()}
+    elif value is None or isinstance(value, (bool, int, float, str)):
+        return value
+    elif isinstance(value, bytes):
+        return constant.quote(value)
+    elif isinstance(value, (Fraction, complex, constant.Constant)):
+        return str(value)
+    return str(value)
+
+
+def dump(node: syntree.Node, format: str = "text") -> str:
+    """The node and the nodes under it, in one of the formats"""
+    d = to_dict(node)
+    if format == "json":
+        return json.dumps(d, indent=2)
+    elif format == "sexp":
+        return _sexp(d)
+    return "\n".join(_text(d))
+
+
+def fprint(node: syntree.Node, file: TextIO = sys.stdout, format: str = "text"):
+    """Prints the dump of the node to file, like go/ast.Fprint"""
+    print(dump(node, format), file=file)
+
+
+def _position(d: dict) -> str:
+    if "line" not in d:
+        return ""
+    if "column" not in d:
+        return f" ({d['line']})"
+    return f" ({d['line']}:{d['column']})"
+
+
+def _text(value: Any, indent: str = "") -> List[str]:
+    """Lines of the dump of a value as indented text, the first
+    one is not indented (it comes after the name of a field)"""
+    if isinstance(value, dict) and "node" in value:
+        fields = [(k, v) for k, v in value.items() if k not in ("node", "line", "column")]
+        head = value["node"] + _position(value)
+        if not fields:
+            return [head]
+        lines = [head + " {"]
+        for name, field in fields:
+            field_lines = _text(field, indent + "  ")
+            lines.append(f"{indent}  {name}: {field_lines[0]}")
+            lines.extend(field_lines[1:])
+        lines.append(indent + "}")
+        return lines
+    elif isinstance(value, (list, dict)):
+        items = list(value.items()) if isinstance(value, dict) else list(enumerate(value))
+        if not items:
+            return ["[]" if isinstance(value, list) else "{}"]
+        lines = [f"[{len(items)}] {{" if isinstance(value, list) else "{"]
+        for key, item in items:
+            item_lines = _text(item, indent + "  ")
+            lines.append(f"{indent}  {key}: {item_lines[0]}")
+            lines.extend(item_lines[1:])
+        lines.append(indent + "}")
+        return lines
+    return [json.dumps(value)]
+
+
+def _sexp(value: Any) -> str:
+    if isinstance(value, dict) and "node" in value:
+        parts = [value["node"]]
+        if "line" in value:
+            position = str(value["line"])
+            if "column" in value:
+                position += f":{value['column']}"
+            parts.append(f":pos {json.dumps(position)}")
+        for name, field in value.items():
+            if name not in ("node", "line", "column"):
+                parts.append(f":{name} {_sexp(field)}")
+        return "(" + " ".join(parts) + ")"
+    elif isinstance(value, dict):
+        return "(" + " ".join(f"({json.dumps(k)} {_sexp(v)})" for k, v in value.items()) + ")"
+    elif isinstance(value, list):
+        return "(" + " ".join(_sexp(v) for v in value) + ")"
+    elif value is None:
+        return "nil"
+    elif isinstance(value, bool):
+        return "#t" if value else "#f"
+    return json.dumps(value)
@@ -0,0 +1,154 @@
+import os
+import sys
+import contextlib
+import tempfile
+import subprocess
+import checker
+
+from dataclasses import dataclass
+from typing import Any, List, Optional
+
+
+# The backends of gopy, compiling the packages of a type checked program
+# (go_parser.py build --target=NAME) or running them (go_parser.py run
+# --exec=NAME): the tree walking interpreter (interp.py), the bytecode VM
+# (vm.py) and the modules of the python backend (pygen.py) are registered
+# here, the other ones (like one writing JavaScript) by the modules the
+# -plugin flag imports, calling register or having a list named backends.
+# A backend may only compile or only run, --target lists the ones
+# registered with what they do:
+#
+#   python go_parser.py build --target -plugin jsbackend.py
+
+
+@dataclass
+class Options:
+    """How a program is run: argv is os.Args, clock the one of the time
+    package, profiler the pprof.Profiler profiling the run, which is aborted
+    once ctx is done, past max_steps steps or past the limits of its sandbox
+    (see interp.run_program), the data races of its goroutines are reported
+    if detect_races (see race.py)"""
+
+    argv: List[str]
+    clock: Any = None
+    profiler: Any = None
+    ctx: Any = None
+    max_steps: Optional[int] = None
+    limits: Any = None
+    detect_races: bool = False
+
+
+class Backend:
+    """A backend, its name is the one given to --target and --exec. compile
+    writes the program to the output directory, run runs it and returns its
+    exit code, the ones a backend doesn't have raise NotImplementedError"""
+
+    name = ""
+    doc = ""
+
+    def compile(self, packages: list, info: checker.Info, output: str) -> bool:
+        """Writes the program of the packages (its own package is the last
+        one) in output, returns False if it can't be, with errors reported"""
+        raise NotImplementedError
+
+    def run(self, packages: list, info: checker.Info, options: Options) -> int:
+        """Runs the program of the packages, raises interp.Unsupported for
+        what it can't run (or the options it doesn't have)"""
+        raise NotImplementedError
+
+    def output(self, packages: list, output: str) -> str:
+        """The file compile wrote the program in, printed by build"""
+        return output
+
+    def compiles(self) -> bool:
+        return type(self).compile is not Backend.compile
+
+    def runs(self) -> bool:
+        return type(self).run is not Backend.run
+
+
+class Interpreter(Backend):
+    name = "interp"
+    doc = "runs the program with the tree walking interpreter"
+
+    def run(self, packages: list, info: checker.Info, options: Options) -> int:
+        import interp
+        if options.detect_races:
+            raise interp.Unsupported("-race runs the program with the VM, not --exec=interp")
+        return interp.run_program(packages, info, argv=options.argv, clock=options.clock,
+                                  profiler=options.profiler, ctx=options.ctx,
+                                  max_steps=options.max_steps, limits=options.limits)
+
+
+class VM(Backend):
+    name = "vm"
+    doc = "runs the program with the bytecode VM"
+
+    def run(self, packages: list, info: checker.Info, options: Options) -> int:
+        import vm
+        return vm.run_program(packages, info, argv=options.argv, clock=options.clock,
+                              profiler=options.profiler, ctx=options.ctx,
+                              max_steps=options.max_steps, limits=options.limits,
+                              detect_races=options.detect_races)
+
+
+class Python(Backend):
+    name = "python"
+    doc = "writes a python 3 module for each package, run with python"
+
+    def compile(self, packages: list, info: checker.Info, output: str) -> bool:
+        import pygen
+        return pygen.build(packages, info, output)
+
+    def output(self, packages: list, output: str) -> str:
+        import pygen
+        return os.path.join(output, pygen.mangle(packages[-1].name) + ".py")
+
+    def run(self, packages: list, info: checker.Info, options: Options) -> int:
+        import diagnostics
+        import interp
+        for flag, value in (("-fake-clock", options.clock), ("a profile", options.profiler),
+                            ("-timeout", options.ctx), ("-max-steps", options.max_steps),
+                            ("the sandbox", options.limits), ("-race", options.detect_races)):
+            if value:
+                raise interp.Unsupported(f"the python backend doesn't run with {flag}")
+        with tempfile.TemporaryDirectory(prefix="gopy-run-") as outdir:
+            count = len(diagnostics.reported)
+            if not self.compile(packages, info, outdir):
+                with contextlib.redirect_stdout(sys.stderr):
+                    diagnostics.print_diagnostics(diagnostics.reported[count:])
+                return 1
+            sys.stdout.flush()
+            return subprocess.run([sys.executable, self.output(packages, outdir)]
+                                  + options.argv[1:]).returncode
+
+
+# the backends registered, in the order --target lists them
+backends: List[Backend] = [Interpreter(), VM(), Python()]
+
+
+def register(*new: Backend):
+    """Adds the backends to the ones of --target and --exec, a backend with
+    the name of one registered replaces it"""
+    for backend in new:
+        for i, other in enumerate(backends):
+            if other.name == backend.name:
+                backends[i] = backend
+                break
+        else:
+            backends.append(backend)
+
+
+def lookup(name: str) -> Optional[Backend]:
+    """The backend registered with the name, None if there is none"""
+    return next((backend for backend in backends if backend.name == name), None)
+
+
+def listing() -> str:
+    """The backends registered with what they do, for --target"""
+    lines = []
+    for backend in backends:
+        does = "/".join(what for what, has in (("build", backend.compiles()),
+                                               ("run", backend.runs())) if has)
+        lines.append(f"{backend.name:<10}{does:<11}{backend.doc}")
+    return "\n".join(lines)
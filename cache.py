@@ -0,0 +1,155 @@
+import os
+import sys
+import time
+import pickle
+import hashlib
+import tempfile
+import checker
+import diagnostics
+import fileset
+import syntree
+import utils
+
+from dataclasses import dataclass
+from typing import Any, List, Optional
+
+
+# The build cache of go_parser.py run, test, build and debug, like the one of
+# go build: the packages of a program parsed and type checked (their ASTs,
+# symbols and scopes, with the checker.Info of their expressions) are
+# pickled to a file of directory, named by the hash of the contents of the
+# files of the program (std included), of the flags changing what is
+# checked and of the version of gopy. The next runs of the program, as long
+# as none of its files changed, load them instead of parsing and checking
+# them again. The programs with errors are not cached, their errors are
+# reported each time. The version of gopy is the hash of its own sources,
+# so a new version (or a change to one of its modules) doesn't load the
+# entries of another one, they are removed once they are max_age old.
+# -cache=off (or GOPYCACHE=off) turns the cache off
+
+# the directory of the entries, GOPYCACHE (like GOCACHE) or the gopy
+# directory of the user cache directory
+directory = os.environ.get("GOPYCACHE") or os.path.join(
+    os.environ.get("XDG_CACHE_HOME") or os.path.join(os.path.expanduser("~"), ".cache"), "gopy")
+enabled = directory != "off"
+
+# the entries not used for max_age seconds are removed (5 days, like go)
+max_age = 5 * 24 * 3600
+
+_version: Optional[str] = None
+
+
+def version() -> str:
+    """The version of gopy, the hash of its modules and of the version of
+    python pickling the entries"""
+    global _version
+    if _version is None:
+        h = hashlib.sha256(sys.version.encode())
+        root = os.path.dirname(os.path.abspath(__file__))
+        for name in sorted(os.listdir(root)):
+            if name.endswith(".py"):
+                with open(os.path.join(root, name), "rb") as f:
+                    h.update(name.encode() + b"\0" + f.read())
+        _version = h.hexdigest()
+    return _version
+
+
+def key(packages: list, *flags: Any) -> str:
+    """The key of the entry of the packages loaded (see loader.load), the
+    hash of the contents of their files, checked with the flags given"""
+    h = hashlib.sha256(version().encode())
+    h.update(repr(flags).encode())
+    for package in packages:
+        h.update(f"\0package {package.path} {package.dir}\0".encode())
+        for filename in package.files:
+            source = utils.read_source(filename).encode("utf-8", "surrogateescape")
+            h.update(f"{filename}\0".encode() + hashlib.sha256(source).digest())
+    return h.hexdigest()
+
+
+@dataclass
+class Entry:
+    """The packages of a program checked, with the state of the modules
+    they refer to: the positions of their files, their lines and the
+    predeclared error type (the interpreter compares types to it)"""
+
+    packages: list
+    info: Optional[checker.Info]
+    # the warnings reported when they were checked
+    warnings: List[diagnostics.Diagnostic]
+    fset: fileset.FileSet
+    sources: dict
+    std_files: set
+    error_type: Any
+    type_refs: dict
+
+
+def path(k: str) -> str:
+    return os.path.join(directory, k[:2], k + ".pickle")
+
+
+def load(k: str, info: Optional[checker.Info] = None) -> Optional[list]:
+    """The packages of the entry k, None if it isn't cached (or can't be
+    read). The state of the modules is the one of the entry afterwards,
+    info has the one of the entry and its warnings are reported again"""
+    try:
+        with open(path(k), "rb") as f:
+            entry: Entry = pickle.load(f)
+        # it is used, it isn't removed with the old ones
+        os.utime(path(k))
+    except Exception:
+        return None
+    fileset.fset.__dict__.update(entry.fset.__dict__)
+    utils.sources.update(entry.sources)
+    utils.std_files.update(entry.std_files)
+    syntree._error_type = entry.error_type
+    syntree.type_refs.update(entry.type_refs)
+    if info is not None and entry.info is not None:
+        info.__dict__.update(entry.info.__dict__)
+    for warning in entry.warnings:
+        diagnostics.report(warning)
+    return entry.packages
+
+
+def store(k: str, packages: list, info: Optional[checker.Info],
+          warnings: List[diagnostics.Diagnostic]):
+    """Stores the packages checked as the entry k. The cache is only an
+    optimization: the entries which can't be written (like the ones with
+    ASTs too deep to pickle) are not cached"""
+    entry = Entry(packages, info, warnings, fileset.fset, utils.sources, utils.std_files,
+                  syntree._error_type, syntree.type_refs)
+    try:
+        os.makedirs(os.path.dirname(path(k)), exist_ok=True)
+        data = pickle.dumps(entry, protocol=pickle.HIGHEST_PROTOCOL)
+        # written to a temporary file first, so the entry is either complete
+        # or not there for the runs reading it at the same time
+        fd, temp = tempfile.mkstemp(dir=os.path.dirname(path(k)))
+        with os.fdopen(fd, "wb") as f:
+            f.write(data)
+        os.replace(temp, path(k))
+    except (OSError, RecursionError, pickle.PicklingError):
+        return
+    trim()
+
+
+def trim():
+    """Removes the entries not used for max_age, at most once a day"""
+    marker = os.path.join(directory, "trim.txt")
+    now = time.time()
+    try:
+        if now - os.path.getmtime(marker) < 24 * 3600:
+            return
+    except OSError:
+        pass
+    try:
+        with open(marker, "w") as f:
+            f.write(f"{int(now)}\n")
+        for subdir in os.listdir(directory):
+            dir = os.path.join(directory, subdir)
+            if not os.path.isdir(dir):
+                continue
+            for name in os.listdir(dir):
+                if now - os.path.getmtime(os.path.join(dir, name)) > max_age:
+                    os.remove(os.path.join(dir, name))
+    except OSError:
+        return
@@ -0,0 +1,123 @@
+import re
+import time
+import threading
+
+from typing import Optional
+
+
+# The cancellation of the long operations, like the context package of Go:
+# a Context is canceled by its cancel method, or once its deadline passes,
+# and so are the contexts derived from it. The parser, the type checker and
+# the backends take one (check_program(path, ctx=ctx), run_program(...,
+# ctx=ctx)) and check it as they go, so the language server and the
+# playground stop what an edit (or the user) makes useless: check raises
+# Canceled or DeadlineExceeded, which end the operation where it is.
+# Contexts are canceled from another thread than the one checking them
+#
+#   ctx = cancel.with_timeout(cancel.background(), 2.5)
+#   interp.run_program(packages, info, ctx=ctx)  # raises DeadlineExceeded after 2.5s
+
+
+class ContextError(Exception):
+    """The error of a context done, the operation checking it stops"""
+
+
+class Canceled(ContextError):
+    def __init__(self):
+        super().__init__("context canceled")
+
+
+class DeadlineExceeded(ContextError):
+    def __init__(self):
+        super().__init__("context deadline exceeded")
+
+
+class Context:
+    """A context, done once canceled or past its deadline (a time of
+    time.monotonic), or once its parent is"""
+
+    def __init__(self, parent: Optional["Context"] = None, deadline: Optional[float] = None):
+        self.parent = parent
+        if parent is not None and parent.deadline is not None:
+            deadline = parent.deadline if deadline is None else min(deadline, parent.deadline)
+        self.deadline = deadline
+        self._err: Optional[ContextError] = None
+        # set once canceled, for the sleeps to wake up
+        self._canceled = threading.Event()
+
+    def cancel(self):
+        """Cancels the context, and so the ones derived from it"""
+        if self._err is None:
+            self._err = Canceled()
+        self._canceled.set()
+
+    def err(self) -> Optional[ContextError]:
+        """Why the context is done, None if it isn't"""
+        if self._err is None:
+            if self.deadline is not None and time.monotonic() >= self.deadline:
+                self._err = DeadlineExceeded()
+            elif self.parent is not None:
+                self._err = self.parent.err()
+        return self._err
+
+    def done(self) -> bool:
+        return self.err() is not None
+
+    def check(self):
+        """Raises the error of the context if it is done"""
+        err = self.err()
+        if err is not None:
+            raise err
+
+    def sleep(self, seconds: float):
+        """Waits for seconds, unless the context is done before, then
+        raises its error (its parents are checked every poll seconds)"""
+        end = time.monotonic() + seconds
+        while True:
+            self.check()
+            left = end - time.monotonic()
+            if left <= 0:
+                return
+            self._canceled.wait(min(left, poll))
+
+
+# how often a sleep checks the parents of its context, in seconds
+poll = 0.05
+
+
+def background() -> Context:
+    """A context which is never done, the parent of the other ones"""
+    return Context()
+
+
+def with_cancel(parent: Context) -> Context:
+    """A context canceled by its cancel method, or when parent is done"""
+    return Context(parent)
+
+
+def with_timeout(parent: Context, seconds: float) -> Context:
+    """A context done after seconds, or when canceled (or parent is)"""
+    return Context(parent, time.monotonic() + seconds)
+
+
+def check(ctx: Optional[Context]):
+    """Raises the error of ctx if it is done, for the functions whose
+    context is optional"""
+    if ctx is not None:
+        ctx.check()
+
+
+# the units of the durations, in seconds
+units = {"ns": 1e-9, "us": 1e-6, "µs": 1e-6, "ms": 1e-3, "s": 1.0, "m": 60.0, "h": 3600.0}
+
+
+def parse_duration(s: str) -> float:
+    """The seconds of a duration written like Go does (time.ParseDuration),
+    like 1.5s, 300ms or 1h30m. Raises ValueError if it isn't one"""
+    text = s[1:] if s.startswith("+") else s
+    if text == "0":
+        return 0.0
+    parts = re.findall(r"(\d+(?:\.\d*)?|\.\d+)(ns|us|µs|ms|s|m|h)", text)
+    if not parts or "".join(n + u for n, u in parts) != text:
+        raise ValueError(f"invalid duration {s!r}")
+    return sum(float(n) * units[u] for n, u in parts)
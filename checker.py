@@ -0,0 +1,4109 @@
+import difflib
+import cancel
+import constant
+import diagnostics
+import fileset
+import lang
+import untyped
+import syntree
+import utils
+
+from dataclasses import dataclass, field
+from typing import Any, Dict, List, Optional, Set, Tuple
+from diagnostics import Diagnostic, Fix
+from symbol_table import predefined_identifiers
+
+
+# The type checker walks the AST once parsing is done. It has scopes of
+# its own (the parser's symbol table is filled while parsing, so it can't
+# tell a redeclaration from a use before declaration), and reports
+# redeclarations, undefined identifiers and type mismatches.
+# Ref: https://golang.org/ref/spec#Declarations_and_scope
+
+
+@dataclass
+class Object:
+    """A declared constant, variable, type, function, package or builtin"""
+
+    name: str
+    kind: str
+    type_: Any = None
+    lineno: Optional[int] = None
+    col_num: Optional[int] = None
+    # value of constants (constant.Constant)
+    constant: Optional[Any] = None
+    # the package scope of an imported package, if its members are known
+    members: Optional["Scope"] = None
+    # the file it is declared in
+    file: Optional[str] = None
+    # the node declaring it: the Function, Method, TypeDef, VarDecl or Import
+    # of a declaration, the identifier of the others (like a parameter)
+    decl: Any = None
+
+
+class Scope:
+    """Maps names to objects, nested in the enclosing scope"""
+
+    def __init__(self, parent: Optional["Scope"] = None, kind: str = "block", node=None):
+        # kind could be universe, package, file, function, block, if,
+        # for, switch or case (or struct and interface, of their members)
+        self.parent = parent
+        self.kind = kind
+        # the node of the scope, see Info.scopes
+        self.node = node
+        # the objects declared in the scope, by name
+        self.objects: Dict[str, Object] = {}
+        # the scopes nested in it, in the order they are in the source
+        self.children: List[Scope] = []
+        if parent is not None:
+            parent.children.append(self)
+
+    def names(self) -> List[str]:
+        """The names declared in the scope, sorted"""
+        return sorted(self.objects)
+
+    def lookup(self, name: str) -> Optional[Object]:
+        """The object of the name in the scope, or in the ones it is
+        nested in (the innermost one), None if it isn't declared"""
+        scope = self
+        while scope is not None:
+            if name in scope.objects:
+                return scope.objects[name]
+            scope = scope.parent
+        return None
+
+    def insert(self, obj: Object) -> Optional[Object]:
+        """Adds obj to the scope
+
+        Returns the object already declared with the same name, if any.
+        The blank identifier _ is never declared. A file scope has only
+        the imports of the file, the other declarations are of the package"""
+        if obj.name == "_":
+            return None
+        if self.kind == "file" and obj.kind != "package":
+            return self.parent.insert(obj)
+        if obj.name in self.objects:
+            return self.objects[obj.name]
+        self.objects[obj.name] = obj
+        return None
+
+
+class Operand:
+    """Result of checking an expression
+
+    mode could be invalid (an error was already reported), novalue,
+    value, variable, mapindex (assignable, but not addressable),
+    constant, nil (untyped, without a type), type, builtin, package
+    or tuple (for calls with multiple results, types are in tuple_types)"""
+
+    def __init__(self, mode: str, expr=None, type_=None, const=None):
+        self.mode = mode
+        self.expr = expr
+        # None for values of unknown type (like members of packages)
+        self.type_ = type_
+        self.constant: Optional[constant.Constant] = const
+        self.tuple_types: List[syntree.Type] = []
+        # if it can give a second, boolean value, like v, ok := x.(T)
+        self.comma_ok = False
+
+    @property
+    def is_untyped(self) -> bool:
+        return self.mode == "constant" and self.constant.is_untyped
+
+
+@dataclass
+class Selection:
+    """The field or the method selected by a selector, like the .x of p.x
+
+    kind is field, method or methodexpr (like Point.area), recv is the
+    type of the operand, pointer tells if it is a pointer to the struct
+    or to the type with the method (which is implicitly dereferenced).
+    path is the embedded fields a promoted field or method is selected
+    through, like [B] for the x of a.x when it is a.B.x"""
+
+    kind: str
+    recv: Any
+    obj: Any
+    pointer: bool = False
+    path: list = field(default_factory=list)
+
+
+class Info:
+    """What the checker found about the expressions of a package, for the
+    tools walking the AST once it is checked (like go/types.Info)"""
+
+    def __init__(self):
+        # the operand of each expression checked. Untyped constants
+        # have the type they are converted to, if they are converted
+        self.operands: Dict[Any, Operand] = {}
+        # the field or method of each Selector node
+        self.selections: Dict[Any, Selection] = {}
+        # the object declared by each identifier, like the value of a
+        # constant for the Identifier of its declaration
+        self.defs: Dict[Any, Object] = {}
+        # the variable assigned by each identifier of a short variable
+        # declaration which redeclares it, like err in b, err := g() after
+        # a, err := f(). It isn't in defs, the identifier declares nothing
+        self.redeclared: Dict[Any, Object] = {}
+        # the object each identifier used refers to, by its node (like the
+        # PrimaryExpr of a variable, or the QualifiedIdent of geometry.Area)
+        self.uses: Dict[Any, Object] = {}
+        # the object of each method declared, by its Method node (the
+        # selections of a method have the node)
+        self.methods: Dict[Any, Object] = {}
+        # the field each key of a struct literal names, by the key (like
+        # the X of Point{X: 1}), its object is the one of its identifier
+        self.keys: Dict[Any, syntree.StructField] = {}
+        # the file of each node of operands, defs and uses, for the tools
+        # finding them by their position (like an editor)
+        self.files: Dict[Any, str] = {}
+        # the declarations of the package level variables of each package
+        # (by its AST), in the order they are initialized
+        self.init_order: Dict[Any, List[syntree.VarDecl]] = {}
+        # the scope of each node having one: the AST of a package (see
+        # loader.Package.ast), the File of a file scope, the
+        # Signature of a function (its parameters and its body), a Block, an
+        # IfStmt, a ForStmt, a SwitchStmt (or TypeSwitchStmt) and its clauses
+        # (CaseClause), and the clauses of a select
+        self.scopes: Dict[Any, Scope] = {}
+
+
+def in_order(node) -> list:
+    """Items of a List in source order, nested Lists are flattened
+
+    Lists are built in reverse by the parser. Blocks nested in
+    the List are kept as they are, since they have their own scope"""
+    if node is None:
+        return []
+    if not isinstance(node, syntree.List):
+        return [node]
+    items = []
+    for child in reversed(node.children):
+        if isinstance(child, syntree.List) and not isinstance(child, syntree.Block):
+            items.extend(in_order(child))
+        else:
+            items.append(child)
+    return items
+
+
+def labeled_statements(stmt: syntree.LabeledStmt) -> list:
+    """The statements labeled: none for an empty statement, one, or the
+    declarations of a short variable declaration, like L: x := 1"""
+    if stmt.stmt is None:
+        return []
+    return in_order(syntree.List([stmt.stmt]))
+
+
+def no_condition(cond) -> bool:
+    """If the condition of a for loop is missing, the parser gives the
+    loops without one the condition true, which isn't in the source"""
+    return cond is None or (isinstance(cond, syntree.Literal) and cond.pos == fileset.NoPos)
+
+
+def has_break(stmts: list, label: Optional[str], implicit: bool) -> bool:
+    """If a break in the statements leaves the statement labeled label
+    they are the body of: a break with the label, or without one if
+    implicit (one not in a nested for, switch or select)"""
+    for stmt in stmts:
+        if isinstance(stmt, syntree.Keyword) and stmt.kw == "BREAK":
+            if stmt.label is None and implicit:
+                return True
+            if stmt.label is not None and stmt.label.ident_name == label:
+                return True
+        elif isinstance(stmt, syntree.Block):
+            if has_break(in_order(stmt), label, implicit):
+                return True
+        elif isinstance(stmt, syntree.IfStmt):
+            if has_break(in_order(stmt.body), label, implicit):
+                return True
+            if stmt.next_ is not None and has_break([stmt.next_], label, implicit):
+                return True
+        elif isinstance(stmt, syntree.LabeledStmt):
+            if has_break(labeled_statements(stmt), label, implicit):
+                return True
+        elif isinstance(stmt, syntree.ForStmt):
+            if has_break(in_order(stmt.body), label, False):
+                return True
+        elif isinstance(stmt, (syntree.SwitchStmt, syntree.SelectStmt)):
+            for clause in in_order(stmt.clauses):
+                if has_break(in_order(clause.body), label, False):
+                    return True
+    return False
+
+
+def underlying(t: syntree.Type) -> syntree.Type:
+    """The underlying type of t. For a type parameter, the underlying
+    type of all the types in its type set if they have the same one"""
+    if isinstance(t, syntree.TypeParam):
+        terms = type_terms(t)
+        if terms:
+            core = underlying(terms[0][1])
+            if all(identical(underlying(type_), core) for _, type_ in terms):
+                return core
+        return t
+    return t.underlying()
+
+
+def basic_typename(t: Optional[syntree.Type]) -> Optional[str]:
+    if t is None:
+        return None
+    t = underlying(t)
+    if t.name == "BasicType":
+        return t.typename
+    return None
+
+
+def constant_kind(t: Optional[syntree.Type]) -> Optional[str]:
+    """Kind of constants representable by type t"""
+    typename = basic_typename(t)
+    return None if typename is None else untyped.kind_of_typename(typename)
+
+
+def is_numeric(t: syntree.Type) -> bool:
+    return untyped.is_numeric(constant_kind(t))
+
+
+def is_integer(t: syntree.Type) -> bool:
+    return constant_kind(t) == "int"
+
+
+def is_named(t: syntree.Type) -> bool:
+    """If t has a name: a declared or a predeclared type, or a type
+    parameter. The others are type literals, like []int"""
+    return t.name in ("TypeDecl", "BasicType") or isinstance(t, syntree.TypeParam)
+
+
+def is_bytes_or_runes(t: syntree.Type) -> bool:
+    """If t is a slice of bytes or of runes, which convert to and from strings"""
+    t = underlying(t)
+    return isinstance(t, syntree.Slice) and basic_aliases.get(
+        basic_typename(t.eltype), basic_typename(t.eltype)) in ("uint8", "int32")
+
+
+
+# the predeclared aliases, byte is the same type as uint8
+basic_aliases = {"byte": "uint8", "rune": "int32"}
+
+
+def identical(x: syntree.Type, y: syntree.Type) -> bool:
+    if isinstance(x, syntree.TypeParam) or isinstance(y, syntree.TypeParam):
+        # type parameters can have the same name in different declarations
+        return x is y
+    if x.name == "TypeDecl" or y.name == "TypeDecl":
+        # every named type is a different type, even with the same name in
+        # another scope. The parser resolves all uses to the same Type node
+        # (an alias is the type it is declared with)
+        return x is y
+    if x.name == "BasicType" and y.name == "BasicType":
+        return basic_aliases.get(x.typename, x.typename) == basic_aliases.get(y.typename, y.typename)
+    if isinstance(x, syntree.Pointer) and isinstance(y, syntree.Pointer):
+        return identical(x.base, y.base)
+    if isinstance(x, syntree.Slice) and isinstance(y, syntree.Slice):
+        return identical(x.eltype, y.eltype)
+    if isinstance(x, syntree.Array) and isinstance(y, syntree.Array):
+        return x.length == y.length and identical(x.eltype, y.eltype)
+    if isinstance(x, syntree.Map) and isinstance(y, syntree.Map):
+        return identical(x.key, y.key) and identical(x.eltype, y.eltype)
+    if isinstance(x, syntree.Chan) and isinstance(y, syntree.Chan):
+        return x.dir == y.dir and identical(x.eltype, y.eltype)
+    if isinstance(x, syntree.Interface) and isinstance(y, syntree.Interface):
+        if len(x.methods) != len(y.methods) or x.comparable != y.comparable:
+            return False
+        if (x.terms is None) != (y.terms is None) or (
+                x.terms is not None and terms_string(x.terms) != terms_string(y.terms)):
+            return False
+        # the order of the methods doesn't matter
+        for m in x.methods:
+            other = y.method(m.m_name)
+            if other is None or not identical_signatures(m.signature, other.signature):
+                return False
+        return True
+    return x.typename == y.typename
+
+
+def identical_signatures(x: syntree.Signature, y: syntree.Signature) -> bool:
+    x_params, y_params = parameters(x.parameters), parameters(y.parameters)
+    if len(x_params) != len(y_params) or len(results(x)) != len(results(y)):
+        return False
+    for (_, x_type, x_vararg), (_, y_type, y_vararg) in zip(x_params, y_params):
+        if x_vararg != y_vararg or not identical_types(x_type, y_type):
+            return False
+    return all(identical_types(a, b) for a, b in zip(results(x), results(y)))
+
+
+def identical_types(x: Optional[syntree.Type], y: Optional[syntree.Type]) -> bool:
+    """Like identical, undefined types (None) are identical to any type"""
+    return x is None or y is None or identical(x, y)
+
+
+def parameters(parameter_list) -> list:
+    """(ident, type, is_vararg) of each parameter, in declared order"""
+    params = []
+    for para in in_order_params(parameter_list):
+        if para.ident_list is None:
+            params.append((None, para.type_, para.vararg))
+        else:
+            for decl in in_order(para.var_decl):
+                params.append((decl.ident, para.type_, para.vararg))
+    return params
+
+
+def in_order_params(parameter_list) -> list:
+    # ParameterList is left recursive, so it's already in order
+    if parameter_list is None:
+        return []
+    if isinstance(parameter_list, syntree.List):
+        return list(parameter_list)
+    return [parameter_list]
+
+
+def results(signature: syntree.Signature) -> list:
+    """Types of the results of a function"""
+    if signature.result is None:
+        return []
+    if isinstance(signature.result, syntree.Type):
+        return [signature.result]
+    return [type_ for _, type_, _ in parameters(signature.result)]
+
+
+def type_string(t: Optional[syntree.Type], qualified: bool = False) -> str:
+    """Go syntax for the type t. If qualified, the types declared in a package
+    have its name even in the package main, like main.Point (the way fmt
+    prints them for %T)"""
+    if t is None:
+        return "invalid type"
+    if isinstance(t, syntree.Array):
+        return f"[{t.length}]{type_string(t.eltype, qualified)}"
+    if isinstance(t, syntree.Slice):
+        return f"[]{type_string(t.eltype, qualified)}"
+    if isinstance(t, syntree.Map):
+        return f"map[{type_string(t.key, qualified)}]{type_string(t.eltype, qualified)}"
+    if isinstance(t, syntree.Pointer):
+        return f"*{type_string(t.base, qualified)}"
+    if isinstance(t, syntree.Chan):
+        prefix = {"both": "chan ", "send": "chan<- ", "recv": "<-chan "}[t.dir]
+        eltype = type_string(t.eltype, qualified)
+        if t.dir != "recv" and isinstance(t.eltype, syntree.Chan) and t.eltype.dir == "recv":
+            eltype = f"({eltype})"
+        return prefix + eltype
+    if isinstance(t, syntree.Interface):
+        if t.alias is not None:
+            return t.alias
+        methods = [f"{m.m_name}{signature_string(m.signature, qualified)}" for m in t.methods]
+        if t.terms is not None:
+            methods.append(terms_string(t.terms, qualified))
+        if t.comparable:
+            methods.append("comparable")
+        return f"interface{{{'; '.join(methods)}}}"
+    if isinstance(t, syntree.FunctionType):
+        return "func" + signature_string(t.signature, qualified)
+    if isinstance(t, syntree.Struct):
+        fields = []
+        for field in t.fields:
+            tag = "" if field.tag is None else f" {field.tag[1]}"
+            fields.append(f"{field.f_name} {type_string(field.type_, qualified)}{tag}")
+        return f"struct{{{'; '.join(fields)}}}"
+    if isinstance(t, syntree.NamedType) and t.origin is not None:
+        type_args = ", ".join(type_string(arg, qualified) for arg in t.type_args)
+        return f"{type_string(t.origin, qualified)}[{type_args}]"
+    if getattr(t, "package", None) not in (None, utils.package_name):
+        # a type of an imported package, like geometry.Point
+        return f"{t.package}.{t.typename}"
+    if qualified and isinstance(t, syntree.NamedType) and t.package is None:
+        return f"main.{t.typename}"
+    return t.typename
+
+
+def runtime_type_string(t: Optional[syntree.Type]) -> str:
+    """The type t the way reflect's Type.String and fmt's %T print it: the
+    types declared in a package have its name, like main.Point, byte and
+    rune are uint8 and int32, and struct, interface and function types are
+    spaced like struct { X int32 "tag" }"""
+    if t is None:
+        return "<nil>"
+    if isinstance(t, syntree.Array):
+        return f"[{t.length}]{runtime_type_string(t.eltype)}"
+    if isinstance(t, syntree.Slice):
+        return f"[]{runtime_type_string(t.eltype)}"
+    if isinstance(t, syntree.Map):
+        return f"map[{runtime_type_string(t.key)}]{runtime_type_string(t.eltype)}"
+    if isinstance(t, syntree.Pointer):
+        return f"*{runtime_type_string(t.base)}"
+    if isinstance(t, syntree.Chan):
+        prefix = {"both": "chan ", "send": "chan<- ", "recv": "<-chan "}[t.dir]
+        eltype = runtime_type_string(t.eltype)
+        if t.dir != "recv" and isinstance(t.eltype, syntree.Chan) and t.eltype.dir == "recv":
+            eltype = f"({eltype})"
+        return prefix + eltype
+    if isinstance(t, syntree.Interface):
+        methods = [f"{m.m_name}{runtime_signature_string(m.signature)}" for m in t.methods]
+        return f"interface {{ {'; '.join(methods)} }}" if methods else "interface {}"
+    if isinstance(t, syntree.FunctionType):
+        return "func" + runtime_signature_string(t.signature)
+    if isinstance(t, syntree.Struct):
+        fields = []
+        for field in t.fields:
+            text = runtime_type_string(field.type_)
+            if not field.embedded:
+                text = f"{field.f_name} {text}"
+            if field.tag is not None:
+                text += " " + constant.quote(field.tag_value.encode("utf-8", "surrogateescape"))
+            fields.append(text)
+        return f"struct {{ {'; '.join(fields)} }}" if fields else "struct {}"
+    if isinstance(t, syntree.NamedType):
+        if t.origin is not None:
+            type_args = ",".join(runtime_type_string(arg) for arg in t.type_args)
+            return f"{runtime_type_string(t.origin)}[{type_args}]"
+        if identical(t, syntree.error_type()):
+            return "error"
+        return f"{t.package or 'main'}.{t.typename}"
+    typename = basic_typename(t)
+    if typename is not None:
+        return basic_aliases.get(typename, typename)
+    return type_string(t, qualified=True)
+
+
+def runtime_signature_string(signature: syntree.Signature) -> str:
+    params = ", ".join(
+        ("..." if vararg else "") + runtime_type_string(type_)
+        for _, type_, vararg in parameters(signature.parameters)
+    )
+    res = [runtime_type_string(type_) for type_ in results(signature)]
+    if len(res) == 0:
+        return f"({params})"
+    elif len(res) == 1:
+        return f"({params}) {res[0]}"
+    return f"({params}) ({', '.join(res)})"
+
+
+def terms_string(terms: list, qualified: bool = False) -> str:
+    """Go syntax for the terms of a type set, like ~int | float64"""
+    return " | ".join(("~" if tilde else "") + type_string(t, qualified) for tilde, t in terms)
+
+
+def type_terms(t: syntree.TypeParam) -> Optional[list]:
+    """The (tilde, type) terms of the type set of the
+    type parameter t, None if it has any type in it"""
+    if t.constraint is None or not syntree.is_interface(t.constraint):
+        return None
+    return underlying(t.constraint).terms
+
+
+def in_type_set(t: syntree.Type, terms: list) -> bool:
+    """If the type t is in the type set of the terms, ~T is
+    any type whose underlying type is T"""
+    for tilde, other in terms:
+        if identical(underlying(t) if tilde else t, other):
+            return True
+    return False
+
+
+def comparable(t: syntree.Type) -> bool:
+    """If values of type t can be compared with == and !="""
+    if isinstance(t, syntree.TypeParam):
+        # all the types in its type set have to be comparable
+        terms = type_terms(t)
+        if terms is None:
+            return t.constraint is not None and underlying(t.constraint).comparable
+        return all(comparable(type_) for _, type_ in terms)
+    t = underlying(t)
+    if isinstance(t, (syntree.Slice, syntree.Map, syntree.FunctionType)):
+        return False
+    if isinstance(t, syntree.Array):
+        return comparable(t.eltype)
+    if isinstance(t, syntree.Struct):
+        return all(comparable(f.type_) for f in t.fields)
+    return True
+
+
+def nillable(t: syntree.Type) -> bool:
+    """If nil can be assigned to (and compared with) values of type t"""
+    return isinstance(underlying(t), (
+        syntree.Pointer, syntree.Slice, syntree.Map, syntree.Chan, syntree.Interface,
+        syntree.FunctionType
+    ))
+
+
+def is_receive(expr) -> bool:
+    """If expr is a receive operation, like <-ch"""
+    exprs = in_order(expr)
+    return (len(exprs) == 1 and isinstance(exprs[0], syntree.UnaryOp)
+            and exprs[0].operator == "<-")
+
+
+def signature_string(signature: syntree.Signature, qualified: bool = False) -> str:
+    params = ", ".join(
+        ("..." if vararg else "") + type_string(type_, qualified)
+        for _, type_, vararg in parameters(signature.parameters)
+    )
+    res = [type_string(type_, qualified) for type_ in results(signature)]
+    if len(res) == 0:
+        return f"({params})"
+    elif len(res) == 1:
+        return f"({params}) {res[0]}"
+    return f"({params}) ({', '.join(res)})"
+
+
+def object_string(obj: Object) -> str:
+    """The declaration of obj in Go syntax, like const c untyped int = 1"""
+    if obj.kind == "const":
+        c = obj.constant
+        if c is None:
+            return f"const {obj.name} {type_string(obj.type_)}"
+        type_ = f"untyped {c.kind}" if c.is_untyped else type_string(obj.type_)
+        return f"const {obj.name} {type_} = {c}"
+    elif obj.kind in ("var", "field"):
+        return f"{obj.kind} {obj.name} {type_string(obj.type_)}"
+    elif obj.kind == "func":
+        if isinstance(obj.decl, syntree.Method):
+            return method_string(obj.decl)
+        if isinstance(obj.type_, syntree.FunctionType):
+            return f"func {obj.name}{signature_string(obj.type_.signature)}"
+        return f"func {obj.name}"
+    elif obj.kind == "type":
+        t = obj.type_
+        if obj.lineno is None or t is None:
+            return f"type {obj.name}"
+        if isinstance(t, syntree.NamedType) and (t.lineno, t.col_num) == (obj.lineno, obj.col_num):
+            return f"type {obj.name} {type_string(t.definition)}"
+        return f"type {obj.name} = {type_string(t)}"
+    elif obj.kind == "package":
+        return f"package {obj.name}"
+    elif obj.kind == "builtin":
+        return f"func {obj.name} (builtin)"
+    return obj.name
+
+
+def method_string(method) -> str:
+    """The declaration of a method (or of a method of an interface)"""
+    if isinstance(method, syntree.InterfaceMethod):
+        return f"func {method.m_name}{signature_string(method.signature)}"
+    receiver = type_string(method.receiver_type)
+    return f"func ({receiver}) {method.fn_name[1]}{signature_string(method.signature)}"
+
+
+binary_precedence = {
+    "||": 1,
+    "&&": 2,
+    "==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+    "+": 4, "-": 4, "|": 4, "^": 4,
+    "*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5, "&^": 5,
+}
+
+
+def expr_string(node) -> str:
+    """Go syntax for the expression node, used in error messages"""
+    if isinstance(node, syntree.List):
+        return ", ".join(expr_string(e) for e in in_order(node))
+
+    elif isinstance(node, syntree.Literal):
+        if isinstance(node.value, syntree.Node) or isinstance(node.type_, syntree.Node):
+            return f"{type_string(node.type_)}{{…}}"
+        if node.exact is not None:
+            return node.exact
+        return str(node.value)
+
+    elif isinstance(node, syntree.PrimaryExpr):
+        if isinstance(node.data, tuple):
+            base = node.data[1]
+            children = node.children
+        else:
+            base = expr_string(node.children[0])
+            if isinstance(node.children[0], (syntree.UnaryOp, syntree.BinOp)):
+                base = f"({base})"
+            children = node.children[1:]
+        for child in children:
+            if isinstance(child, syntree.Index):
+                base = f"{base}[{expr_string(child.expr)}]"
+            elif isinstance(child, syntree.SliceExpr):
+                base = f"{base}{slice_string(child)}"
+            elif isinstance(child, syntree.Selector):
+                base = f"{base}.{child.field_name}"
+            elif isinstance(child, syntree.TypeAssertion):
+                base = f"{base}.({type_string(child.type_)})"
+        return base
+
+    elif isinstance(node, syntree.QualifiedIdent):
+        return f"{node.data[0][1]}.{node.data[1][1]}"
+
+    elif isinstance(node, syntree.FunctionCall):
+        if isinstance(node.fn_name, str):
+            name = node.fn_name
+        else:
+            name = expr_string(node.fn_name)
+        args = expr_string(node.arguments.expression_list)
+        if node.arguments.type_ is not None:
+            args = ", ".join(a for a in (type_string(node.arguments.type_), args) if a)
+        if node.arguments.ellipsis:
+            args += "..."
+        return f"{name}({args})"
+
+    elif isinstance(node, syntree.BinOp):
+        # parenthesize operands with lower precedence
+        prec = binary_precedence.get(node.operator, 0)
+        left, right = expr_string(node.left), expr_string(node.right)
+        left_expr, right_expr = in_order(node.left), in_order(node.right)
+        if len(left_expr) == 1 and isinstance(left_expr[0], syntree.BinOp):
+            if binary_precedence.get(left_expr[0].operator, 0) < prec:
+                left = f"({left})"
+        if len(right_expr) == 1 and isinstance(right_expr[0], syntree.BinOp):
+            if binary_precedence.get(right_expr[0].operator, 0) <= prec:
+                right = f"({right})"
+        return f"{left} {node.operator} {right}"
+
+    elif isinstance(node, syntree.UnaryOp):
+        operand = expr_string(node.operand)
+        if isinstance(node.operand, syntree.BinOp):
+            operand = f"({operand})"
+        if node.operator in ("++", "--"):
+            return f"{operand}{node.operator}"
+        return f"{node.operator}{operand}"
+
+    elif isinstance(node, syntree.Function):
+        return "func literal"
+
+    elif isinstance(node, syntree.Type):
+        return type_string(node)
+
+    elif node is None:
+        return ""
+
+    return str(node)
+
+
+def slice_string(node: syntree.SliceExpr) -> str:
+    """Go syntax for a slice expression, like [1:n]"""
+    indices = node.indices if node.max is not None else node.indices[:2]
+    return f"[{':'.join(expr_string(i) for i in indices)}]"
+
+
+def describe(x: Operand, expr: Optional[str] = None) -> str:
+    """Describes an operand the way go/types does,
+    like x (variable of type int)"""
+    if expr is None:
+        expr = expr_string(x.expr)
+    type_ = type_string(x.type_)
+    if isinstance(x.type_, syntree.TypeParam) and x.type_.constraint is not None:
+        type_ += f" constrained by {type_string(x.type_.constraint)}"
+    if x.mode == "constant":
+        value = str(x.constant)
+        if x.constant.is_untyped:
+            kind = f"untyped {x.constant.kind} constant"
+            return f"{expr} ({kind})" if expr == value else f"{expr} ({kind} {value})"
+        return f"{expr} (constant {value} of type {type_string(x.type_)})"
+    elif x.mode == "variable":
+        return f"{expr} (variable of type {type_})"
+    elif x.mode == "mapindex":
+        return f"{expr} (map index expression of type {type_})"
+    elif x.mode == "novalue":
+        return f"{expr} (no value)"
+    elif x.mode == "nil":
+        return "nil"
+    elif x.mode == "tuple":
+        types = ", ".join(type_string(t) for t in x.tuple_types)
+        return f"{expr} (value of type ({types}))"
+    elif x.mode in ("type", "builtin", "package"):
+        return f"{expr} ({x.mode})"
+    return f"{expr} (value of type {type_})"
+
+
+def span(node) -> Optional[tuple]:
+    """(lineno, col_num, width) of the span of a node, up to the end of the
+    line it starts at if it ends on another one. None if it has no span"""
+    if not getattr(node, "pos", fileset.NoPos):
+        return None
+    file = fileset.fset.file(node.pos)
+    if file is None:
+        return None
+    start = file.position(node.pos)
+    end = file.position(min(node.end, file.line_end(start.line)))
+    return start.line, start.column, max(end.column - start.column, 1)
+
+
+def position(node) -> tuple:
+    """(lineno, col_num, width) of an expression, col_num may be None"""
+    if isinstance(node, syntree.List):
+        exprs = in_order(node)
+        return position(exprs[0]) if exprs else (None, None, 1)
+
+    elif isinstance(node, syntree.PrimaryExpr):
+        if isinstance(node.data, tuple):
+            return node.lineno, node.data[2], len(node.data[1])
+        return span(node) or position(node.children[0])
+
+    elif isinstance(node, syntree.Literal) and node.col_num is not None:
+        return node.lineno, node.col_num, len(expr_string(node))
+
+    elif isinstance(node, syntree.Identifier):
+        return node.lineno, node.col_num, len(node.ident_name)
+
+    elif isinstance(node, syntree.TypeParam):
+        return node.lineno, node.col_num, len(node.typename)
+
+    elif isinstance(node, syntree.QualifiedIdent):
+        return node.lineno, node.col_no, len(expr_string(node))
+
+    elif isinstance(node, syntree.Selector):
+        return node.lineno, node.col_num, len(node.field_name)
+
+    elif isinstance(node, syntree.KeyedElement):
+        return position(node.key)
+
+    elif isinstance(node, syntree.FunctionCall):
+        width = len(node.fn_name) if isinstance(node.fn_name, str) else 1
+        return node.lineno, node.col_no, width
+
+    elif span(node) is not None:
+        # like the operations, the literals and the statements
+        return span(node)
+
+    elif isinstance(node, syntree.BinOp):
+        lineno, col_num, width = position(node.left)
+        if col_num is None:
+            return node.lineno, None, 1
+        return lineno, col_num, width
+
+    elif isinstance(node, syntree.UnaryOp):
+        lineno, col_num, width = position(node.operand)
+        if col_num is not None and node.operator not in ("++", "--"):
+            # the operator comes right before its operand
+            return lineno, col_num - 1, width + 1
+        return lineno if lineno is not None else node.lineno, col_num, width
+
+    return getattr(node, "lineno", None), None, 1
+
+
+def statement_line(stmt) -> Optional[int]:
+    """The line of a statement, the one of its name for a declaration"""
+    if isinstance(stmt, syntree.VarDecl):
+        return stmt.ident.lineno
+    return position(stmt)[0]
+
+
+class Branches:
+    """A block of a function for the labels, see Checker.block_branches.
+    labeled is the statement labeled the block is the body of, if any"""
+
+    def __init__(self, parent: Optional["Branches"], labeled: Optional[syntree.LabeledStmt]):
+        self.parent = parent
+        self.labeled = labeled
+        # the labels declared in the block so far
+        self.labels: Dict[str, syntree.LabeledStmt] = {}
+
+    def enclosing(self, name: str) -> Optional[syntree.LabeledStmt]:
+        """The labeled statement named name the block is in, the target
+        of a break or continue"""
+        block: Optional[Branches] = self
+        while block is not None:
+            if block.labeled is not None and block.labeled.label.ident_name == name:
+                return block.labeled
+            block = block.parent
+        return None
+
+    def goto_target(self, name: str) -> Optional[syntree.LabeledStmt]:
+        """The label named name declared before in the block or in the
+        blocks around it, the target of a backward goto"""
+        block: Optional[Branches] = self
+        while block is not None:
+            if name in block.labels:
+                return block.labels[name]
+            block = block.parent
+        return None
+
+
+class Checker:
+    """Type checks a package, see check_package"""
+
+    def __init__(self, imports: Optional[Dict[str, Tuple[str, Scope]]] = None,
+                 info: Optional[Info] = None, warnings: bool = False,
+                 ctx: Optional[cancel.Context] = None):
+        self.diagnostics: List[Diagnostic] = []
+        # checked before each statement, the check stops once it is done
+        self.ctx = ctx
+        # if the shadowed and the unused declarations are reported, as warnings
+        self.warnings = warnings
+        self.info = info if info is not None else Info()
+        self.universe = universe()
+        self.scope = Scope(self.universe, "package")
+        # the names and package scopes of the packages checked
+        # before, which can be imported, by import path
+        self.imports = imports or {}
+        # the file being checked
+        self.file: Optional[str] = None
+        # signatures of the functions being checked, innermost last
+        self.signatures: List[syntree.Signature] = []
+        self.loop_depth = 0
+        self.switch_depth = 0
+        # if a (non-constant) function call or a channel receive was checked,
+        # len and cap of an array are constants only for operands without them
+        self.call_or_receive = False
+        # index of the ConstSpec being checked, if any
+        self.iota: Optional[int] = None
+        # the package level constants and variables declared but not checked
+        # yet (by id), with their file, file scope and declaration, see
+        # package_object. The ones being checked, innermost last
+        self.pending: Dict[int, Tuple[str, Scope, syntree.VarDecl]] = {}
+        self.initializing: List[Tuple[Object, syntree.VarDecl]] = []
+        # the package level variables, functions and methods the value or
+        # the body of each one refers to, by the id of its object (methods
+        # have one, by the id of their declaration), see init_order. The
+        # list of the declaration being checked, if it is one of them
+        self.refs: Dict[int, List[Object]] = {}
+        self.method_objects: Dict[int, Object] = {}
+        self.referring: Optional[List[Object]] = None
+        # values of the VarSpecs unpacked so far, see unpacked_value
+        self.unpacked: Dict[int, Optional[List[Operand]]] = {}
+        # the short variable declarations checked so far (by their Spec),
+        # with the variables they redeclare, see redeclared_var
+        self.short_vars: Dict[int, Dict[int, Optional[Object]]] = {}
+        # struct and interface types checked so far, see type_
+        self.types: List[syntree.Type] = []
+        # the named types and the variables in the cycles reported, see
+        # cycle and init_order
+        self.cycles: set = set()
+        # methods declared so far for each type (by id), see method
+        self.methods: Dict[int, Dict[str, syntree.Method]] = {}
+        # the objects whose value is used (by id), and the declarations
+        # which are reported if they are not, see unused
+        self.used: set = set()
+        self.declared: List[Tuple[Object, Any]] = []
+        # the calls of the builtin panic checked (by id), which are
+        # terminating statements, see terminating
+        self.panics: set = set()
+
+    def error(self, message: str, node=None, notes=None, fix: Optional[Fix] = None):
+        lineno, col_num, width = position(node)
+        self.diagnostics.append(Diagnostic(
+            message, lineno, col_num, width, notes=notes or [], file=self.file, fix=fix
+        ))
+
+    def warning(self, message: str, code: str, node, file: Optional[str] = None,
+                notes=None, fix: Optional[Fix] = None):
+        """Reports what is likely a mistake but is valid Go, like an unused
+        constant. Each kind has its own code, so it can be suppressed"""
+        lineno, col_num, width = position(node)
+        self.diagnostics.append(Diagnostic(
+            message, lineno, col_num, width, kind="ANALYSIS", severity="warning", code=code,
+            notes=notes or [], file=file or self.file, fix=fix
+        ))
+
+    def unsupported(self, message: str, node):
+        """Reports a construct gopy doesn't support yet, an error in strict
+        mode (see diagnostics.strict), else a warning and it is skipped"""
+        lineno, col_num, width = position(node)
+        self.diagnostics.append(diagnostics.unsupported(message, lineno, col_num, width,
+                                                        file=self.file))
+
+    def allows(self, feature: str, version: Tuple[int, int], node) -> bool:
+        """If the feature of the Go version can be used in the file (see
+        lang.version), else it is reported like cmd/compile does"""
+        if lang.allows(version, self.file):
+            return True
+        self.error(lang.requires(feature, version), node)
+        return False
+
+    def spelling_fix(self, name: str, node) -> Optional[Fix]:
+        """Suggests the name declared in scope closest to the undefined name"""
+        names = []
+        scope = self.scope
+        while scope is not None:
+            names.extend(scope.objects)
+            scope = scope.parent
+        matches = difflib.get_close_matches(name, names, n=1)
+        if not matches:
+            return None
+        lineno, col_num, width = position(node)
+        return Fix(f"did you mean {matches[0]}?", matches[0], lineno, col_num, width, self.file)
+
+    # declarations
+
+    def new_scope(self, kind: str, node, parent: Optional[Scope] = None) -> Scope:
+        """A scope of the node nested in parent (by default the current
+        one), kept in Info.scopes"""
+        scope = Scope(self.scope if parent is None else parent, kind, node)
+        self.info.scopes[node] = scope
+        return scope
+
+    def declare(self, scope: Scope, obj: Object, ident):
+        obj.file = self.file
+        if obj.decl is None:
+            obj.decl = ident
+        self.info.defs[ident] = obj
+        self.info.files[ident] = self.file
+        other = scope.insert(obj)
+        if other is not None:
+            notes = []
+            if other.lineno:
+                notes.append(Diagnostic(
+                    f"other declaration of {obj.name}",
+                    other.lineno, other.col_num, len(obj.name), file=other.file
+                ))
+            # the fields of a struct are not in a block
+            where = "" if scope.kind == "struct" else " in this block"
+            self.error(f"{obj.name} redeclared{where}", ident, notes)
+
+    def check_package(self, ast: syntree.Node):
+        """Checks the files of the package, the children of ast"""
+        package = self.scope
+        package.node = ast
+        self.info.scopes[ast] = package
+        # each declaration with the scope of its file, files are in
+        # reverse order, like Lists
+        decls = []
+        for file in reversed(ast.children):
+            scope = self.new_scope("file", file, package)
+            for child in file.children:
+                decls.extend((file.filename, scope, decl) for decl in in_order(child))
+        # the objects of the functions, by the id of their declaration
+        functions: Dict[int, Object] = {}
+        variables: List[Tuple[Object, syntree.VarDecl]] = []
+
+        # package level declarations are visible in the whole package,
+        # so collect them before checking any of them
+        for decl in self.in_files(decls):
+            if isinstance(decl, syntree.Import):
+                self.import_(decl)
+            elif isinstance(decl, syntree.Method):
+                # methods are declared once all the types are
+                continue
+            elif isinstance(decl, syntree.Function):
+                name = decl.fn_name
+                obj = Object(name[1], "func", syntree.FunctionType(decl.signature),
+                             decl.lineno, name[2], decl=decl)
+                functions[id(decl)] = obj
+                if name[1] == "init":
+                    # init functions can't be referred to
+                    self.init_function(decl)
+                    continue
+                if name[1] == "main" and ast.data == "main":
+                    self.init_function(decl)
+                self.declare(self.scope, obj, syntree.Identifier(name, decl.lineno))
+                self.refs[id(obj)] = []
+            elif isinstance(decl, syntree.TypeDef):
+                self.declare_type(decl)
+            elif isinstance(decl, syntree.VarDecl):
+                ident = decl.ident
+                kind = "const" if decl.const else "var"
+                obj = Object(ident.ident_name, kind, None, ident.lineno, ident.col_num, decl=decl)
+                self.declare(self.scope, obj, ident)
+                self.pending[id(obj)] = (self.file, self.scope, decl)
+                if not decl.const:
+                    self.refs[id(obj)] = []
+                    variables.append((obj, decl))
+
+        # constants come first, the lengths of array types can refer to them.
+        # A constant or a variable is checked the first time it is used, so
+        # one can refer to the ones declared after it, and the rest in the
+        # order declared
+        for decl in self.in_files(decls):
+            if isinstance(decl, syntree.VarDecl) and decl.const:
+                obj = self.info.defs[decl.ident]
+                if id(obj) in self.pending:
+                    self.package_object(obj)
+
+        for decl in self.in_files(decls):
+            if isinstance(decl, syntree.TypeDef):
+                self.type_decl(decl)
+
+        for decl in self.in_files(decls):
+            if isinstance(decl, syntree.Method):
+                name = decl.fn_name
+                obj = Object(name[1], "func", syntree.FunctionType(decl.signature),
+                             decl.lineno, name[2], file=self.file, decl=decl)
+                self.method_objects[id(decl)] = obj
+                self.info.methods[decl] = obj
+                self.refs[id(obj)] = []
+                self.method(decl)
+
+        for obj, decl in variables:
+            if id(obj) in self.pending:
+                self.package_object(obj)
+
+        for decl in self.in_files(decls):
+            if isinstance(decl, syntree.Method):
+                self.referring = self.refs[id(self.method_objects[id(decl)])]
+                self.function(decl.signature, decl.body, decl.receiver, decl.type_params)
+            elif isinstance(decl, syntree.Function):
+                self.referring = self.refs.get(id(functions[id(decl)]))
+                self.function(decl.signature, decl.body)
+        self.referring = None
+        self.scope = package
+        self.info.init_order[ast] = self.init_order(variables)
+        if self.warnings:
+            self.unused()
+
+    def unused(self):
+        """Warns about the local variables, the constants (but the exported
+        ones of the package) and the imports whose value is never used.
+        Assigning a variable is not a use of it"""
+        # the packages of the types written like geometry.Point, the
+        # parser resolves them (see go_parser.p_TypeName)
+        qualified = set()
+        for ref in syntree.type_refs.values():
+            file = fileset.fset.file(ref.pos)
+            if "." in ref.name and file is not None:
+                qualified.add((file.name, ref.name.split(".")[0]))
+
+        for obj, node in self.declared:
+            if id(obj) in self.used:
+                continue
+            if obj.kind == "package":
+                if (obj.file, obj.name) in qualified:
+                    continue
+                path = node.data[1][1]
+                message = f"{path} imported and not used"
+                if isinstance(node.data[0], tuple):
+                    message = f"{path} imported as {obj.name} and not used"
+                lineno, col_num, width = position(node)
+                fix = Fix("remove the import", "", lineno, col_num, width, obj.file)
+                self.warning(message, "UnusedImport", node, obj.file, fix=fix)
+            elif obj.kind == "const":
+                self.warning(f"constant declared and not used: {obj.name}", "UnusedConst",
+                             node, obj.file)
+            else:
+                self.warning(f"declared and not used: {obj.name}", "UnusedLocalVar",
+                             node, obj.file)
+
+    def local_var(self, obj: Object, ident, value=None):
+        """Keeps a variable declared in a function, to warn if it is unused
+        (see unused), and warns if it shadows a variable of an enclosing
+        block, unless its value is the variable, like x := x"""
+        # a redeclaration is reported already
+        if not self.warnings or self.scope.lookup(obj.name) is not obj:
+            return
+        self.declared.append((obj, ident))
+        if (isinstance(value, syntree.PrimaryExpr) and not value.children
+                and isinstance(value.data, tuple) and value.data[1] == obj.name):
+            return
+        scope = self.scope.parent
+        while scope is not None and scope.kind not in ("package", "file", "universe"):
+            other = scope.objects.get(obj.name)
+            if other is not None:
+                if other.kind == "var" and other.lineno:
+                    note = Diagnostic(f"shadowed declaration of {obj.name}", other.lineno,
+                                      other.col_num, len(obj.name), file=other.file)
+                    self.warning(f"declaration of {obj.name} shadows declaration "
+                                 f"at line {other.lineno}", "ShadowedVar", ident, notes=[note])
+                return
+            scope = scope.parent
+
+    def in_files(self, decls: list):
+        """The declarations of (file, file scope, declaration) in
+        decls, each one is checked in its file and scope"""
+        for file, scope, decl in decls:
+            cancel.check(self.ctx)
+            self.file, self.scope = file, scope
+            yield decl
+
+    def import_(self, node: syntree.Import):
+        name, path = node.data
+        if getattr(node, "_name", None) == ".":
+            # the exported members of the package would be in the file scope
+            self.unsupported("dot imports are not yet supported", node)
+            return
+        path = path[1].strip('"')
+        package, members = self.imports.get(path, (None, None))
+        if isinstance(name, tuple):
+            name = name[1]
+        elif package is not None:
+            name = package
+        else:
+            # the package name is the last element of the import path
+            name = path.split("/")[-1]
+        lineno, col_num, _ = position(node)
+        obj = Object(name, "package", lineno=lineno, col_num=col_num, members=members,
+                     file=self.file, decl=node)
+        self.scope.insert(obj)
+        if self.warnings and name != "_":
+            self.declared.append((obj, node))
+
+    def method(self, decl: syntree.Method):
+        """Checks the receiver of a method declaration, and that
+        the method is declared only once for the type"""
+        ident = syntree.Identifier(decl.fn_name, decl.lineno)
+        name = ident.ident_name
+        receiver = parameters(decl.receiver)
+        if len(receiver) != 1:
+            problem = "no receiver" if not receiver else "multiple receivers"
+            self.error(f"method has {problem}", ident)
+            return
+
+        type_ = receiver[0][1]
+        if type_ is None:
+            # undefined, reported by the parser
+            return
+        base = decl.base_type
+        if base is None:
+            return
+        if base.name == "BasicType":
+            self.error(f"cannot define new methods on non-local type {type_string(base)}", ident)
+            return
+        if not isinstance(base, syntree.NamedType):
+            self.error(f"invalid receiver type {type_string(type_)}", ident)
+            return
+        if isinstance(underlying(base), (syntree.Pointer, syntree.Interface)):
+            self.error(
+                f"invalid receiver type {type_string(type_)} (pointer or interface type)", ident
+            )
+            return
+
+        t = underlying(base)
+        field = t.field(name) if isinstance(t, syntree.Struct) else None
+        if field is not None:
+            self.error(f"field and method with the same name {name}", ident, [
+                Diagnostic(f"other declaration of {name}", field.ident.lineno,
+                           field.ident.col_num, len(name))
+            ])
+            return
+
+        methods = self.methods.setdefault(id(base), {})
+        other = methods.get(name)
+        if other is not None:
+            self.error(f"method {type_string(base)}.{name} already declared", ident, [
+                Diagnostic(f"other declaration of {name}", other.lineno,
+                           other.fn_name[2], len(name))
+            ])
+            return
+        methods[name] = decl
+
+    def init_function(self, decl: syntree.Function):
+        """Reports an init function (or the main function of package main)
+        with parameters, results or type parameters"""
+        ident = syntree.Identifier(decl.fn_name, decl.lineno)
+        name = decl.fn_name[1]
+        signature = decl.signature
+        if signature.type_params:
+            self.error(f"func {name} must have no type parameters", ident)
+        elif parameters(signature.parameters) or results(signature):
+            self.error(f"func {name} must have no arguments and no return values", ident)
+
+    def type_def(self, node: syntree.TypeDef):
+        self.declare_type(node)
+        self.type_decl(node)
+
+    def declare_type(self, node: syntree.TypeDef):
+        ident = syntree.Identifier(node.typename, node.lineno)
+        obj = Object(ident.ident_name, "type", node.type_, ident.lineno, ident.col_num,
+                     decl=node)
+        self.declare(self.scope, obj, ident)
+
+    def type_decl(self, node: syntree.TypeDef):
+        """Checks the type of a declaration, declared by declare_type"""
+        ident = syntree.Identifier(node.typename, node.lineno)
+        if (isinstance(node.type_, syntree.NamedType)
+                and (node.type_.lineno, node.type_.col_num) == (ident.lineno, ident.col_num)):
+            # not an alias of a named type
+            for type_param in node.type_.type_params:
+                self.type_(type_param.constraint)
+            self.cycle(node.type_, ident)
+        self.type_(node.type_)
+
+    def cycle(self, t: syntree.NamedType, ident: syntree.Identifier):
+        """Reports a type made of itself, see cycle_path. A cycle of
+        several types is reported once"""
+        path = syntree.cycle_path(t)
+        if path is None or any(id(u) in self.cycles for u in path):
+            return
+        self.cycles.update(id(u) for u in path)
+        name = ident.ident_name
+        if len(path) == 1:
+            self.error(f"invalid recursive type: {name} refers to itself", ident)
+            return
+        notes = [
+            Diagnostic(f"{u.typename} refers to {v.typename}", u.lineno, u.col_num,
+                       len(u.typename))
+            for u, v in zip(path, path[1:] + path[:1])
+        ]
+        self.error(f"invalid recursive type {name}", ident, notes)
+
+    def type_(self, t: Optional[syntree.Type]):
+        """Checks the fields of the struct types in t, the methods
+        of the interface types and the type arguments of instances"""
+        if t is None:
+            return
+        if isinstance(t, syntree.NamedType) and t.origin is not None:
+            self.satisfies_all(t.origin.type_params, t.type_args, t)
+        t = underlying(t)
+        if isinstance(t, syntree.Array) and t.length_expr is not None and t not in self.types:
+            self.types.append(t)
+            self.array_length(t)
+        if isinstance(t, (syntree.Array, syntree.Slice, syntree.Chan)):
+            self.type_(t.eltype)
+        elif isinstance(t, syntree.Pointer):
+            self.type_(t.base)
+        elif isinstance(t, syntree.Map) and t not in self.types:
+            self.types.append(t)
+            self.type_(t.key)
+            self.type_(t.eltype)
+            if t.key is not None and not comparable(t.key):
+                self.error(f"invalid map key type {type_string(t.key)}", t)
+        elif isinstance(t, syntree.Interface) and t not in self.types:
+            self.types.append(t)
+            self.interface(t)
+        elif isinstance(t, syntree.Struct) and t not in self.types:
+            # a named struct type is checked only once
+            self.types.append(t)
+            # field names are in a block of their own
+            fields = Scope(kind="struct")
+            for field in t.fields:
+                ident = field.ident
+                obj = Object(ident.ident_name, "field", field.type_, ident.lineno, ident.col_num)
+                self.declare(fields, obj, ident)
+                self.type_(field.type_)
+                if field.embedded and field.type_ is not None:
+                    self.embedded_field(field)
+                if self.warnings and field.tag is not None:
+                    self.struct_tag(field)
+
+    def struct_tag(self, field: syntree.StructField):
+        """Reports the tags reflect.StructTag.Get can't read to the end (see
+        syntree.tag_pairs), and the keys repeated, like go vet does"""
+        pairs, problem = syntree.tag_pairs(field.tag_value)
+        if problem is None:
+            keys = [key for key, _ in pairs]
+            repeated = next((key for i, key in enumerate(keys) if key in keys[:i]), None)
+            if repeated is not None:
+                problem = f"key {repeated} repeated"
+        if problem is not None:
+            self.warning(f"struct field tag {field.tag[1]} not compatible with "
+                         f"reflect.StructTag.Get: {problem}", "StructTag", field.ident)
+
+    def embedded_field(self, field: syntree.StructField):
+        """Reports the types which can't be embedded, only a type name T or a
+        pointer *T to a type which is neither a pointer nor an interface can"""
+        t, pointer = field.type_, isinstance(field.type_, syntree.Pointer)
+        # the * of a pointer, the name of the type otherwise
+        node = t if pointer else field.ident
+        if pointer:
+            t = t.base
+        if isinstance(t, syntree.TypeParam):
+            self.error("embedded field type cannot be a (pointer to a) type parameter", node)
+        elif isinstance(underlying(t), syntree.Pointer):
+            self.error("embedded field type cannot be a pointer", node)
+        elif pointer and syntree.is_interface(t):
+            self.error("embedded field type cannot be a pointer to an interface", node)
+
+    def array_length(self, t: syntree.Array):
+        """Reports the length of an array type if it isn't a constant
+        which can be an int and isn't negative, like [n]int for a variable n"""
+        expr = t.length_expr
+        x = self.single_value(self.expr(expr))
+        if x.mode == "invalid" or t.length is not None:
+            return
+        if x.mode == "constant" and syntree.constant_length(x.constant) is not None:
+            # a constant declared after the type, see package_object
+            t.resize(syntree.constant_length(x.constant))
+            return
+        if x.mode != "constant":
+            if isinstance(expr, syntree.PrimaryExpr) and not expr.children:
+                self.error(f"invalid array length {expr_string(expr)}", expr)
+            else:
+                self.error(f"array length {describe(x)} must be constant", expr)
+        elif is_integer(x.type_) or x.is_untyped and untyped.to_integer(
+                x.constant.kind, x.constant.value) is not None:
+            self.error(f"invalid array length {describe(x)}", expr)
+        else:
+            self.error(f"array length {describe(x)} must be integer", expr)
+
+    def interface(self, t: syntree.Interface):
+        methods = Scope(kind="interface")
+        for method in t.own_methods:
+            ident = method.ident
+            obj = Object(ident.ident_name, "func", method.signature, ident.lineno, ident.col_num,
+                         file=self.file)
+            self.info.defs[ident] = obj
+            self.info.files[ident] = self.file
+            if methods.insert(obj) is not None:
+                self.error(f"duplicate method {ident.ident_name}", ident)
+
+        # embedded types other than interfaces are in its type set
+        for ident, embedded in t.embedded:
+            for method in underlying(embedded).methods:
+                # the same method can be embedded more than once
+                other = methods.lookup(method.m_name)
+                if other is not None and not identical_signatures(other.type_, method.signature):
+                    self.error(f"duplicate method {method.m_name}", ident)
+                elif other is None:
+                    methods.insert(Object(method.m_name, "func", method.signature))
+
+    def constraint_type(self, t: Optional[syntree.Type], node):
+        """Reports the use of an interface with a type set (like
+        interface{ ~int }) as the type of a value"""
+        if syntree.is_interface(t) and underlying(t).is_constraint:
+            self.error(
+                f"cannot use type {type_string(t)} outside a type constraint: "
+                f"interface contains type constraints", node
+            )
+
+    def satisfies(self, t: syntree.Type, type_param: syntree.TypeParam,
+                  mapping: dict) -> Optional[str]:
+        """Why the type argument t doesn't satisfy the constraint of the
+        type parameter, None if it does. The type parameters in the
+        constraint, like the E of ~[]E, are substituted by mapping"""
+        constraint = type_param.constraint
+        if constraint is None or not syntree.is_interface(constraint):
+            return None
+        iface = underlying(constraint)
+        want = type_string(constraint)
+        if iface.terms is not None:
+            terms = [(tilde, syntree.substitute(type_, mapping)) for tilde, type_ in iface.terms]
+            if isinstance(t, syntree.TypeParam):
+                # every type in the type set of t has to be in the one of the constraint
+                own = type_terms(t)
+                missing = own is None or len(syntree.intersect_terms(own, terms)) != len(own)
+            else:
+                missing = not in_type_set(t, terms)
+            if missing:
+                return (f"{type_string(t)} does not satisfy {want} "
+                        f"({type_string(t)} missing in {terms_string(terms)})")
+        if iface.comparable and not comparable(t):
+            return f"{type_string(t)} does not satisfy comparable"
+        reason = self.missing_method(t, constraint)
+        if reason is not None:
+            return f"{type_string(t)} does not satisfy {want} {reason}"
+        return None
+
+    def satisfies_all(self, type_params: list, type_args: list, node) -> bool:
+        mapping = dict(zip(type_params, type_args))
+        for type_param, type_arg in zip(type_params, type_args):
+            reason = self.satisfies(type_arg, type_param, mapping)
+            if reason is not None:
+                self.error(reason, node)
+                return False
+        return True
+
+    def var_decl(self, decl: syntree.VarDecl):
+        type_ = None if decl.type_inferred else decl.type_
+        if not isinstance(type_, syntree.Type):
+            type_ = None
+        self.type_(type_)
+        self.constraint_type(type_, decl.ident)
+        context = "constant declaration" if decl.const else "variable declaration"
+        assigned, redeclared = self.redeclared_var(decl)
+        if assigned:
+            # the value is assigned to the variable, it declares nothing
+            type_ = redeclared.type_ if redeclared is not None else None
+            context = "multiple assignment" if len(decl._spec.names) > 1 else "assignment"
+
+        x = None
+        if decl.unpack is not None:
+            x = self.unpacked_value(decl)
+            if x is not None:
+                if type_ is not None:
+                    x = self.assign(x, type_, context)
+                else:
+                    x = self.default(x)
+                type_ = type_ or x.type_
+        elif decl.value is not None:
+            if decl.const:
+                self.iota = decl.iota
+            x = self.expr(decl.value)
+            self.iota = None
+            if x.mode == "tuple":
+                self.assignment_mismatch(1, len(x.tuple_types), [decl.value], decl.ident)
+                x = Operand("invalid", x.expr)
+            x = self.single_value(x)
+
+            if decl.const and x.mode not in ("constant", "invalid"):
+                self.error(f"{describe(x)} is not constant", decl.value)
+                x.mode = "invalid"
+
+            if type_ is not None:
+                x = self.assign(x, type_, context)
+            elif not decl.const:
+                # untyped constants stay untyped in const declarations
+                x = self.default(x)
+            type_ = type_ or x.type_
+
+        if decl.type_inferred and type_ is not None and decl.symbol is not None:
+            # the parser can't infer the type arguments of generic calls
+            if syntree.has_type_params(decl.symbol.type_):
+                decl.symbol.type_ = type_
+            if syntree.has_type_params(decl.type_):
+                decl.type_ = type_
+
+        ident = decl.ident
+        if assigned:
+            if redeclared is not None:
+                self.info.redeclared[ident] = redeclared
+                # the intermediate code converts the value to it
+                decl.type_ = redeclared.type_
+            return
+        if decl.const:
+            const = x.constant if x is not None and x.mode == "constant" else None
+            if self.initializing and self.initializing[-1][1] is decl:
+                # a package level one, declared by check_package
+                obj = self.initializing[-1][0]
+                obj.type_, obj.constant = type_, const
+            else:
+                obj = Object(ident.ident_name, "const", type_, ident.lineno, ident.col_num, const,
+                             decl=decl)
+                self.declare(self.scope, obj, ident)
+            if const is not None and decl.symbol is not None and decl.symbol.constant is None:
+                # the parser evaluates only the constants referring to ones declared
+                # before, the intermediate code needs the value of the others
+                decl.symbol.constant = const
+                if decl.type_inferred:
+                    decl.symbol.type_ = decl.type_ = type_ or self.default_type(const)
+        elif self.initializing and self.initializing[-1][1] is decl:
+            obj = self.initializing[-1][0]
+            obj.type_ = type_
+        else:
+            obj = Object(ident.ident_name, "var", type_, ident.lineno, ident.col_num, decl=decl)
+            self.declare(self.scope, obj, ident)
+        # a constant that failed to check is still declared, but as
+        # a variable to not report its uses as non constant again
+        if decl.const and obj.constant is None:
+            obj.kind = "var"
+        local = self.scope.kind not in ("package", "file")
+        if local and obj.kind == "var":
+            self.local_var(obj, ident, decl.value)
+        elif (obj.kind == "const" and self.warnings and self.scope.lookup(obj.name) is obj
+                and (local or not obj.name[0].isupper())):
+            self.declared.append((obj, ident))
+
+    def redeclared_var(self, decl: syntree.VarDecl) -> Tuple[bool, Optional[Object]]:
+        """If the VarDecl of a short variable declaration is an assignment
+        instead, of the variable of the block it redeclares (like err in
+        b, err := g() after a, err := f()), which is None if the identifier
+        can't be assigned. Reports (once for the declaration) the identifiers
+        which can't be, and a declaration which declares no new variables"""
+        group = getattr(decl, "_group", None)
+        if group is None or group.keyword != ":=":
+            return False, None
+        spec = decl._spec
+        if id(spec) not in self.short_vars:
+            assigned: Dict[int, Optional[Object]] = {}
+            names: Set[str] = set()
+            new = False
+            for ident in spec.names:
+                name = ident.ident_name
+                if name == "_":
+                    continue
+                other = self.scope.objects.get(name)
+                if name in names:
+                    self.error(f"{name} repeated on left side of :=", ident)
+                    assigned[id(ident)] = None
+                elif other is None:
+                    new = True
+                elif other.kind == "var":
+                    assigned[id(ident)] = other
+                else:
+                    self.error(f"cannot assign to {name}", ident)
+                    assigned[id(ident)] = None
+                names.add(name)
+            if not new and None not in assigned.values():
+                self.error("no new variables on left side of :=", spec.define or decl.ident)
+            self.short_vars[id(spec)] = assigned
+        assigned = self.short_vars[id(spec)]
+        return id(decl.ident) in assigned, assigned.get(id(decl.ident))
+
+    def package_object(self, obj: Object) -> bool:
+        """Checks the declaration of a package level constant or variable,
+        declared by check_package but not checked yet. Its type (and value)
+        is kept in obj, so it is checked only once, even if it is used
+        before it is declared. Reports one whose value refers to itself
+
+        Returns False if its type or the value of the constant is invalid"""
+        for i, (other, decl) in enumerate(self.initializing):
+            if other is obj:
+                self.cycles.update(id(u) for u, _ in self.initializing[i:])
+                self.init_cycle([u for u, _ in self.initializing[i:]], decl.ident)
+                return False
+
+        file, scope, decl = self.pending[id(obj)]
+        # it can be used in another declaration, or in an other file
+        outer = self.file, self.scope, self.iota, self.call_or_receive, self.referring
+        self.file, self.scope = file, scope
+        self.referring = self.refs.get(id(obj))
+        self.initializing.append((obj, decl))
+        self.var_decl(decl)
+        self.initializing.pop()
+        del self.pending[id(obj)]
+        self.file, self.scope, self.iota, self.call_or_receive, self.referring = outer
+        return obj.kind == "const" or obj.type_ is not None
+
+    def init_cycle(self, path: List[Object], ident):
+        """Reports the declarations of path (the one of ident first),
+        each one referring to the next one and the last one to the first one"""
+        obj = path[0]
+        outer, self.file = self.file, obj.file
+        if len(path) == 1:
+            self.error(f"initialization cycle: {obj.name} refers to itself", ident)
+        else:
+            notes = [
+                Diagnostic(f"{u.name} refers to {v.name}", u.lineno, u.col_num, len(u.name),
+                           file=u.file)
+                for u, v in zip(path, path[1:] + path[:1])
+            ]
+            self.error(f"initialization cycle for {obj.name}", ident, notes)
+        self.file = outer
+
+    def refer(self, x):
+        """Keeps the reference to x (an object, or a method declaration) of
+        the declaration being checked, if x is a package level variable,
+        function or method"""
+        obj = self.method_objects.get(id(x), x)
+        if (self.referring is not None and id(obj) in self.refs
+                and not any(other is obj for other in self.referring)):
+            self.referring.append(obj)
+
+    def init_order(self, variables: List[Tuple[Object, syntree.VarDecl]]
+                   ) -> List[syntree.VarDecl]:
+        """The declarations of the package level variables in the order
+        they are initialized: the first one declared whose value doesn't
+        refer to a variable not initialized yet, directly or through the
+        functions and the methods it refers to, comes next. The variables
+        of a VarSpec like var a, b = f() are initialized together.
+        Reports the variables which refer to themselves this way"""
+        for obj, decl in variables:
+            if id(obj) in self.cycles:
+                continue
+            path = self.ref_path(obj)
+            if path is not None:
+                self.cycles.update(id(u) for u in path if u.kind == "var")
+                self.init_cycle(path, decl.ident)
+
+        # the specs, each one with its declarations and the (ids of the)
+        # variables they refer to
+        specs: Dict[int, Tuple[List[syntree.VarDecl], set]] = {}
+        for obj, decl in variables:
+            key = id(decl.unpack[1]) if decl.unpack is not None else id(decl)
+            decls, refs = specs.setdefault(key, ([], set()))
+            decls.append(decl)
+            refs.update(id(v) for v in self.referred_variables(obj))
+        for decls, refs in specs.values():
+            refs.difference_update(id(self.info.defs[decl.ident]) for decl in decls)
+
+        order: List[syntree.VarDecl] = []
+        initialized: set = set()
+        remaining = list(specs.values())
+        while remaining:
+            # the first one, if the others are in cycles
+            ready = next((spec for spec in remaining if spec[1] <= initialized), remaining[0])
+            remaining.remove(ready)
+            order.extend(ready[0])
+            initialized.update(id(self.info.defs[decl.ident]) for decl in ready[0])
+        return order
+
+    def referred_variables(self, obj: Object) -> List[Object]:
+        """The variables the value of a variable refers to, directly or
+        through functions and methods"""
+        found: List[Object] = []
+        seen = {id(obj)}
+        stack = list(reversed(self.refs[id(obj)]))
+        while stack:
+            other = stack.pop()
+            if id(other) in seen:
+                continue
+            seen.add(id(other))
+            if other.kind == "var":
+                found.append(other)
+            else:
+                stack.extend(reversed(self.refs[id(other)]))
+        return found
+
+    def ref_path(self, obj: Object) -> Optional[List[Object]]:
+        """The variables, functions and methods from obj (a variable) each
+        one referring to the next one, the last one referring to obj, if any"""
+        path = [obj]
+        seen = {id(obj)}
+
+        def search(current: Object) -> bool:
+            for other in self.refs[id(current)]:
+                if other is obj:
+                    return True
+                if id(other) in seen:
+                    continue
+                seen.add(id(other))
+                path.append(other)
+                if search(other):
+                    return True
+                path.pop()
+            return False
+
+        return path if search(obj) else None
+
+    def unpacked_value(self, decl: syntree.VarDecl) -> Optional[Operand]:
+        """The value of one variable of a VarSpec whose values
+        are not paired with the identifiers, like var a, b = f()
+
+        The values are checked (and a mismatch reported) only once
+        for the whole spec"""
+        ident_list, expression_list = decl.unpack
+        idents = in_order(ident_list)
+        key = id(expression_list)
+        if key not in self.unpacked:
+            exprs = in_order(expression_list)
+            values = self.values(exprs, len(idents))
+            if values is not None and len(values) != len(idents):
+                self.assignment_mismatch(len(idents), len(values), exprs, idents[0])
+                values = None
+            self.unpacked[key] = values
+
+        values = self.unpacked[key]
+        if values is None:
+            return None
+        return values[idents.index(decl.ident)]
+
+    def function(self, signature: syntree.Signature, body: Optional[syntree.Block],
+                 receiver=None, type_params: Optional[list] = None):
+        self.scope = self.new_scope("function", signature)
+        # the type parameters of a method are the ones of its receiver, like
+        # the T of (s *Stack[T]), they are declared with the parameters
+        for type_param in signature.type_params + (type_params or []):
+            obj = Object(type_param.typename, "type", type_param,
+                         type_param.lineno, type_param.col_num)
+            self.declare(self.scope, obj, type_param)
+            self.type_(type_param.constraint)
+        # only the last parameter can be variadic, like args in f(format string, args ...any)
+        own_params = parameters(signature.parameters)
+        for ident, type_, vararg in own_params[:-1]:
+            if vararg:
+                self.error("can only use ... with final parameter in list", ident or type_)
+        # the receiver of a method is declared like a parameter
+        params = parameters(receiver) + own_params
+        for ident, type_, vararg in params:
+            # the type is None if it isn't a type, it is reported already
+            if vararg and type_ is not None:
+                type_ = syntree.Slice(type_)
+            if ident is not None:
+                self.constraint_type(type_, ident)
+                obj = Object(ident.ident_name, "var", type_, ident.lineno, ident.col_num)
+                self.declare(self.scope, obj, ident)
+        if signature.has_named_results:
+            for ident, type_, _ in parameters(signature.result):
+                if ident is not None:
+                    obj = Object(ident.ident_name, "var", type_, ident.lineno, ident.col_num)
+                    self.declare(self.scope, obj, ident)
+
+        self.signatures.append(signature)
+        loop_depth, self.loop_depth = self.loop_depth, 0
+        switch_depth, self.switch_depth = self.switch_depth, 0
+        # parameters and the function body are in the same block
+        self.statements(body)
+        self.labels(body)
+        if (body is not None and results(signature) and not self.terminating_list(in_order(body))
+                # the statement with a syntax error may be the return
+                and not any(isinstance(n, syntree.BadStmt) for n in syntree.walk(body, False))):
+            self.missing_return(body)
+        if body is not None and self.warnings:
+            self.unreachable(in_order(body))
+        self.loop_depth = loop_depth
+        self.switch_depth = switch_depth
+        self.signatures.pop()
+
+        self.scope = self.scope.parent
+
+    # statements
+
+    def block(self, node, kind: str = "block"):
+        self.scope = self.new_scope(kind, node)
+        self.statements(node)
+        self.scope = self.scope.parent
+
+    def statements(self, node):
+        for stmt in in_order(node):
+            self.statement(stmt)
+
+    def statement(self, stmt):
+        cancel.check(self.ctx)
+        if isinstance(stmt, syntree.Block):
+            self.block(stmt)
+
+        elif isinstance(stmt, syntree.BadStmt):
+            # the syntax error was reported by the parser
+            pass
+
+        elif isinstance(stmt, syntree.VarDecl):
+            self.var_decl(stmt)
+
+        elif isinstance(stmt, syntree.TypeDef):
+            self.type_def(stmt)
+
+        elif isinstance(stmt, syntree.IfStmt):
+            self.if_stmt(stmt)
+
+        elif isinstance(stmt, syntree.TypeSwitchStmt):
+            self.type_switch_stmt(stmt)
+
+        elif isinstance(stmt, syntree.SwitchStmt):
+            self.switch_stmt(stmt)
+
+        elif isinstance(stmt, syntree.SelectStmt):
+            self.select_stmt(stmt)
+
+        elif isinstance(stmt, syntree.ForStmt):
+            self.for_stmt(stmt)
+
+        elif isinstance(stmt, syntree.Keyword):
+            self.keyword(stmt)
+
+        elif isinstance(stmt, syntree.LabeledStmt):
+            # the labels are checked with the whole function, see labels
+            for labeled in labeled_statements(stmt):
+                self.statement(labeled)
+
+        elif isinstance(stmt, syntree.Assignment):
+            self.assignment(stmt)
+
+        elif isinstance(stmt, syntree.SendStmt):
+            self.send(stmt)
+
+        elif isinstance(stmt, syntree.GoStmt):
+            self.suspended_call("go", stmt)
+
+        elif isinstance(stmt, syntree.DeferStmt):
+            self.suspended_call("defer", stmt)
+
+        elif isinstance(stmt, syntree.UnaryOp) and stmt.operator in ("++", "--"):
+            x = self.expr(stmt.operand)
+            if x.mode == "invalid":
+                return
+            if x.type_ is not None and not is_numeric(x.type_):
+                self.error(
+                    f"invalid operation: {expr_string(stmt)} "
+                    f"(non-numeric type {type_string(x.type_)})", stmt
+                )
+            else:
+                self.assignable_operand(x)
+
+        elif isinstance(stmt, syntree.FunctionCall) or is_receive(stmt):
+            self.expr(stmt)
+
+        else:
+            x = self.expr(stmt)
+            if x.mode != "invalid":
+                self.error(f"{describe(x)} is not used", stmt)
+
+    def condition(self, expr, context: str):
+        x = self.single_value(self.expr(expr))
+        if x.mode == "invalid" or x.type_ is None:
+            return
+        if basic_typename(x.type_) != "bool":
+            self.error(f"non-boolean condition in {context}", expr)
+
+    def if_stmt(self, stmt: syntree.IfStmt):
+        self.scope = self.new_scope("if", stmt)
+        if stmt.statement is not None:
+            self.statements(stmt.statement)
+        self.condition(stmt.expr, "if statement")
+        self.block(stmt.body)
+        if isinstance(stmt.next_, syntree.IfStmt):
+            self.if_stmt(stmt.next_)
+        elif stmt.next_ is not None:
+            self.block(stmt.next_)
+        self.scope = self.scope.parent
+
+    def for_stmt(self, stmt: syntree.ForStmt):
+        self.scope = self.new_scope("for", stmt)
+        clause = stmt.clause
+        if isinstance(clause, syntree.ForClause):
+            self.statements(clause.init)
+            self.condition(clause.cond, "for loop")
+            self.statements(clause.post)
+        elif isinstance(clause, syntree.RangeClause):
+            self.range_clause(clause)
+        else:
+            self.condition(clause, "for loop")
+
+        self.loop_depth += 1
+        self.block(stmt.body)
+        self.loop_depth -= 1
+        self.scope = self.scope.parent
+
+    def range_clause(self, clause: syntree.RangeClause):
+        x = self.single_value(self.expr(clause.expr))
+        if clause.ident_list is not None:
+            variables = in_order(clause.ident_list)
+        else:
+            variables = in_order(clause.expr_list)
+
+        # types of the key and the element, the element is None
+        # if the range gives one iteration variable only
+        types = [None, None]
+        over_int = False
+        if x.mode != "invalid" and isinstance(underlying(x.type_), syntree.FunctionType):
+            # the iteration variables have no type, the body is checked
+            self.unsupported(f"range over {describe(x)} is not yet supported", clause.expr)
+            x = Operand("invalid", clause.expr)
+        if x.mode != "invalid" and x.type_ is not None:
+            key_element, cause = self.range_types(x)
+            if key_element is None:
+                message = f"cannot range over {describe(x)}"
+                self.error(f"{message}: {cause}" if cause else message, clause.expr)
+                x = Operand("invalid", clause.expr)
+            else:
+                types = key_element
+                if len(variables) > 1 and types[1] is None:
+                    self.error(
+                        f"range over {describe(x)} permits only one iteration variable",
+                        variables[1]
+                    )
+                elif len(variables) > 2:
+                    self.error("range clause permits at most two iteration variables",
+                               variables[2])
+                over_int = types[1] is None and not isinstance(underlying(x.type_), syntree.Chan)
+                if over_int:
+                    self.allows(f"range over {describe(x)}", lang.range_int, clause.expr)
+        types += [None] * (len(variables) - 2)
+
+        if over_int and not variables:
+            # the integer has to have a type, the default one if it is untyped
+            self.range_count(x)
+        for i, (target, type_) in enumerate(zip(variables, types)):
+            if clause.ident_list is not None:
+                if over_int and i == 0:
+                    # the variable counts up to the integer, of its type
+                    type_ = self.range_count(x).type_
+                obj = Object(target.ident_name, "var", type_, target.lineno, target.col_num)
+                self.declare(self.scope, obj, target)
+                self.local_var(obj, target)
+            elif not self.is_blank(target) and type_ is not None:
+                y = self.assigned(target)
+                if not self.assignable_operand(y) or y.type_ is None:
+                    continue
+                if over_int and i == 0:
+                    z = self.assign(x, y.type_, "range clause")
+                    if z.mode != "invalid" and not is_integer(z.type_):
+                        self.error(
+                            f"cannot use iteration variable of type {type_string(z.type_)}",
+                            target
+                        )
+                else:
+                    self.assign(Operand("value", target, type_), y.type_, "assignment")
+
+    def range_types(self, x: Operand) -> Tuple[Optional[list], Optional[str]]:
+        """The types of the key and the element of a range over x, with
+        None for the element of a range over a channel or an integer.
+        None and the cause, if any, if x can't be ranged over"""
+        t = underlying(x.type_)
+        if isinstance(t, syntree.Pointer) and isinstance(underlying(t.base), syntree.Array):
+            t = underlying(t.base)
+        int_type = self.universe.lookup("int").type_
+        if x.is_untyped and x.constant is not None and x.constant.kind != "string":
+            if x.constant.kind in ("int", "rune"):
+                return [x.type_, None], None
+            return None, None
+        if isinstance(t, (syntree.Array, syntree.Slice)):
+            return [int_type, t.eltype], None
+        if isinstance(t, syntree.Map):
+            return [t.key, t.eltype], None
+        if isinstance(t, syntree.Chan):
+            if t.dir == "send":
+                return None, f"receive from send-only channel {type_string(x.type_)}"
+            return [t.eltype, None], None
+        if basic_typename(t) == "string" or x.is_untyped:
+            # x is a string, it is the only untyped constant left
+            return [int_type, self.universe.lookup("rune").type_], None
+        if is_integer(t):
+            return [x.type_, None], None
+        return None, None
+
+    def range_count(self, x: Operand) -> Operand:
+        """The integer counted to by a range, an untyped constant
+        gets its default type"""
+        if x.is_untyped:
+            return self.convert_untyped(x, self.default_type(x.constant), "range clause")
+        return x
+
+    def switch_stmt(self, stmt: syntree.SwitchStmt):
+        self.scope = self.new_scope("switch", stmt)
+        if stmt.statement is not None:
+            self.statements(stmt.statement)
+        if stmt.expr is not None:
+            tag = self.default(self.single_value(self.expr(stmt.expr)))
+        else:
+            # a missing switch expression is equivalent to true
+            tag = Operand("value", None, self.universe.lookup("bool").type_)
+
+        clauses = in_order(stmt.clauses)
+        default = None
+        # constant case values seen so far, to report duplicates
+        seen: Dict[tuple, Any] = {}
+        for i, clause in enumerate(clauses):
+            if clause.is_default:
+                if default is not None:
+                    self.error(
+                        "multiple defaults in switch", clause,
+                        [Diagnostic("previous default", default.lineno)]
+                    )
+                default = clause
+            else:
+                for expr in in_order(clause.exprs):
+                    self.case_value(tag, expr, stmt.expr, seen)
+
+            self.scope = self.new_scope("case", clause)
+            body = in_order(clause.body)
+            self.switch_depth += 1
+            for j, s in enumerate(body):
+                if isinstance(s, syntree.Keyword) and s.kw == "FALLTHROUGH":
+                    if j != len(body) - 1:
+                        self.error("fallthrough statement out of place", s)
+                    elif i == len(clauses) - 1:
+                        self.error("cannot fallthrough final case in switch", s)
+                else:
+                    self.statement(s)
+            self.switch_depth -= 1
+            self.scope = self.scope.parent
+        self.scope = self.scope.parent
+
+    def type_switch_stmt(self, stmt: syntree.TypeSwitchStmt):
+        self.scope = self.new_scope("switch", stmt)
+        if stmt.statement is not None:
+            self.statements(stmt.statement)
+        x = self.single_value(self.expr(stmt.expr))
+        text = expr_string(stmt.expr)
+        if x.mode != "invalid" and x.type_ is not None and not syntree.is_interface(x.type_):
+            self.error(f"{describe(x, text)} is not an interface", stmt.expr)
+            x = Operand("invalid", stmt.expr)
+        ident = stmt.ident
+        if ident is not None and ident.ident_name == "_":
+            self.error("no new variable on left side of :=", ident)
+            ident = None
+
+        clauses = in_order(stmt.clauses)
+        default = None
+        # the types of the cases seen so far, to report duplicates
+        seen: List[Tuple[Any, syntree.TypeCase]] = []
+        # the variables of the clauses, it is used if any of them is
+        variables: List[Object] = []
+        for clause in clauses:
+            types = [] if clause.is_default else in_order(clause.types)
+            if clause.is_default:
+                if default is not None:
+                    self.error(
+                        "multiple defaults in switch", clause,
+                        [Diagnostic("previous default", default.lineno)]
+                    )
+                default = clause
+            for case in types:
+                self.type_case(x, text, case, seen)
+
+            self.scope = self.new_scope("case", clause)
+            if ident is not None and clause.ident is not None:
+                # the type of the case if it lists only one, the one of x otherwise
+                type_ = x.type_ if x.mode != "invalid" else None
+                if len(types) == 1 and not types[0].nil:
+                    type_ = types[0].type_
+                obj = Object(ident.ident_name, "var", type_, ident.lineno, ident.col_num)
+                self.declare(self.scope, obj, clause.ident)
+                if not variables:
+                    self.local_var(obj, ident, stmt.expr)
+                variables.append(obj)
+            self.switch_depth += 1
+            for s in in_order(clause.body):
+                if isinstance(s, syntree.Keyword) and s.kw == "FALLTHROUGH":
+                    self.error("cannot fallthrough in type switch", s)
+                else:
+                    self.statement(s)
+            self.switch_depth -= 1
+            self.scope = self.scope.parent
+        if any(id(obj) in self.used for obj in variables):
+            self.used.update(id(obj) for obj in variables)
+        self.scope = self.scope.parent
+
+    def type_case(self, x: Operand, text: str, case: syntree.TypeCase,
+                  seen: List[Tuple[Any, syntree.TypeCase]]):
+        """Checks a type listed by a case of a type switch on x"""
+        type_ = case.type_
+        if type_ is None and not case.nil:
+            return
+        if type_ is not None:
+            self.type_(type_)
+            if x.mode != "invalid" and not syntree.is_interface(type_):
+                # the dynamic type of x can't be type_ if it doesn't implement it
+                reason = self.missing_method(type_, x.type_)
+                if reason is not None:
+                    self.error(
+                        f"impossible type switch case: {type_string(type_)}\n"
+                        f"\t{describe(x, text)} cannot have dynamic type "
+                        f"{type_string(type_)} {reason}", case
+                    )
+                    return
+        for other_type, other in seen:
+            if (other.nil and case.nil) or (
+                    other_type is not None and type_ is not None and identical(other_type, type_)):
+                lineno, col_num, width = position(other)
+                name = "nil" if case.nil else type_string(type_)
+                self.error(f"duplicate case {name} in type switch", case,
+                           [Diagnostic("previous case", lineno, col_num, width)])
+                return
+        seen.append((type_, case))
+
+    def select_stmt(self, stmt: syntree.SelectStmt):
+        default = None
+        for clause in in_order(stmt.clauses):
+            if clause.is_default:
+                if default is not None:
+                    self.error(
+                        "multiple defaults in select", clause,
+                        [Diagnostic("previous default", default.lineno)]
+                    )
+                default = clause
+
+            # variables declared by a receive are in the scope of the clause
+            self.scope = self.new_scope("case", clause)
+            if not clause.is_default:
+                if self.is_comm(clause.comm):
+                    self.statements(clause.comm)
+                else:
+                    self.error("select case must be receive, send or assign recv", clause)
+            self.switch_depth += 1
+            self.statements(clause.body)
+            self.switch_depth -= 1
+            self.scope = self.scope.parent
+
+    def is_comm(self, comm) -> bool:
+        """If comm can be the communication of a select case, a send
+        or a receive, whose value may be assigned to up to two variables"""
+        if isinstance(comm, syntree.SendStmt):
+            return True
+        if isinstance(comm, syntree.Assignment):
+            return (comm.operator == "=" and len(in_order(comm.left)) <= 2
+                    and is_receive(comm.right))
+        decls = in_order(comm)
+        if decls and all(isinstance(d, syntree.VarDecl) for d in decls):
+            if len(decls) > 2:
+                return False
+            if decls[0].unpack is not None:
+                return is_receive(decls[0].unpack[1])
+            return len(decls) == 1 and is_receive(decls[0].value)
+        return is_receive(comm)
+
+    def send(self, stmt: syntree.SendStmt):
+        ch = self.single_value(self.expr(stmt.chan))
+        x = self.single_value(self.expr(stmt.value))
+        if ch.mode == "invalid" or x.mode == "invalid" or ch.type_ is None:
+            return
+        t = underlying(ch.type_)
+        if not isinstance(t, syntree.Chan):
+            self.error(
+                f"invalid operation: cannot send to non-channel {describe(ch)}", stmt.chan
+            )
+        elif t.dir == "recv":
+            self.error(
+                f"invalid operation: cannot send to receive-only channel {describe(ch)}",
+                stmt.chan
+            )
+        else:
+            self.assign(x, t.eltype, "send")
+
+    def suspended_call(self, keyword: str, stmt):
+        """The call of a go or a defer statement, whose results are discarded"""
+        call = in_order(stmt.call)
+        if len(call) != 1 or not isinstance(call[0], syntree.FunctionCall):
+            self.expr(stmt.call)
+            self.error(f"expression in {keyword} must be function call", stmt)
+            return
+        name = call[0].fn_name
+        obj = self.scope.lookup(name) if isinstance(name, str) else None
+        x = self.expr(call[0])
+        if obj is not None and obj.kind == "type":
+            self.error(f"{keyword} requires function call, not conversion", stmt)
+        elif (obj is not None and obj.kind == "builtin" and x.mode != "invalid"
+                and name not in ("close", "copy", "delete", "panic", "recover")):
+            # the other builtins are not permitted in statement context
+            self.error(f"{keyword} discards result of {expr_string(call[0])}", stmt)
+
+    def case_value(self, tag: Operand, expr, tag_expr, seen: Dict[tuple, Any]):
+        x = self.single_value(self.expr(expr))
+        if x.mode == "invalid" or tag.mode == "invalid":
+            return
+        if x.type_ is None or tag.type_ is None:
+            return
+
+        if tag_expr is not None:
+            switch = f"switch on {expr_string(tag_expr)}"
+        else:
+            switch = "switch"
+        if x.is_untyped:
+            mismatch = not untyped.compatible(x.constant.kind, constant_kind(tag.type_))
+        else:
+            mismatch = not identical(x.type_, tag.type_)
+        if mismatch:
+            self.error(
+                f"invalid case {expr_string(expr)} in {switch} (mismatched types "
+                f"{self.typename_of(x)} and {type_string(tag.type_)})", expr
+            )
+            return
+        if x.is_untyped:
+            x = self.convert_untyped(x, tag.type_, "switch case")
+
+        if x.mode == "constant":
+            key = (x.constant.kind, x.constant.value)
+            if key in seen:
+                lineno, col_num, width = position(seen[key])
+                self.error(
+                    f"duplicate case {expr_string(expr)} in expression switch", expr,
+                    [Diagnostic("previous case", lineno, col_num, width)]
+                )
+            else:
+                seen[key] = expr
+
+    def keyword(self, stmt: syntree.Keyword):
+        if stmt.label is not None:
+            # the targets of labels are checked with the whole function
+            return
+        if stmt.kw == "BREAK":
+            if self.loop_depth == 0 and self.switch_depth == 0:
+                self.error("break is not in a loop, switch, or select", stmt)
+        elif stmt.kw == "CONTINUE":
+            if self.loop_depth == 0:
+                self.error("continue is not in a loop", stmt)
+        elif stmt.kw == "FALLTHROUGH":
+            # allowed ones are skipped by switch_stmt
+            self.error("fallthrough statement out of place", stmt)
+        elif stmt.kw == "RETURN":
+            self.return_stmt(stmt)
+
+    def labels(self, body):
+        """Reports the labels of a function body which are declared twice or
+        not used, and the break, continue and goto statements whose label
+        isn't a valid target, like go/types does (labels.go). The labels have
+        the function as their scope, but a goto can't jump into a block, nor
+        over a variable declaration"""
+        declared: Dict[str, syntree.LabeledStmt] = {}
+        used: set = set()
+        jumps = self.block_branches(Branches(None, None), in_order(body), declared, used)
+        # the gotos left have no label before them in their block or in the
+        # blocks around it, nor after them in their block
+        for jump in jumps:
+            name = jump.label.ident_name
+            if name in declared:
+                lineno = span(self.block_of(body, declared[name]) or declared[name])[0]
+                self.error(f"goto {name} jumps into block starting at line {lineno}",
+                           jump.label)
+                used.add(name)
+            else:
+                self.error(f"label {name} not defined", jump.label)
+        for name, stmt in declared.items():
+            if name not in used:
+                self.error(f"label {name} defined and not used", stmt.label)
+
+    def block_branches(self, block: "Branches", stmts: list, declared: dict,
+                       used: set) -> list:
+        """Checks the branches of the statements of a block, like the
+        blockBranches of go/types. Returns the gotos whose label is not
+        declared yet (the forward jumps), which are resolved by the labels
+        declared after them in the block, or in the blocks around it"""
+        jumps: list = []
+        # the last variable declared in the block, and the forward jumps
+        # before it (which jump over it if their label is after it)
+        var_decl = None
+        bad_jumps: list = []
+
+        def nested(labeled, body):
+            jumps.extend(self.block_branches(Branches(block, labeled), in_order(body),
+                                             declared, used))
+
+        def statement(stmt, labeled=None):
+            nonlocal var_decl, bad_jumps
+            if isinstance(stmt, syntree.VarDecl) and not stmt.const:
+                var_decl = stmt
+                bad_jumps = list(jumps)
+
+            elif isinstance(stmt, syntree.LabeledStmt):
+                name = stmt.label.ident_name
+                if name != "_":
+                    other = declared.get(name)
+                    if other is not None:
+                        note = Diagnostic(f"other declaration of {name}", *position(other.label))
+                        self.error(f"label {name} already defined at line {other.lineno}",
+                                   stmt.label, [note])
+                    else:
+                        declared[name] = stmt
+                        block.labels[name] = stmt
+                # the jumps to the label are resolved
+                for jump in list(jumps):
+                    if jump.label.ident_name != name:
+                        continue
+                    jumps.remove(jump)
+                    used.add(name)
+                    if var_decl is not None and jump in bad_jumps:
+                        self.error(f"goto {name} jumps over declaration of "
+                                   f"{var_decl.ident.ident_name} at line {var_decl.ident.lineno}",
+                                   jump.label)
+                for labeled_stmt in labeled_statements(stmt):
+                    statement(labeled_stmt, stmt)
+
+            elif isinstance(stmt, syntree.Keyword) and stmt.label is not None:
+                name = stmt.label.ident_name
+                used.add(name)
+                if stmt.kw in ("BREAK", "CONTINUE"):
+                    target = block.enclosing(name)
+                    kinds = (syntree.ForStmt,) if stmt.kw == "CONTINUE" else (
+                        syntree.ForStmt, syntree.SwitchStmt, syntree.SelectStmt)
+                    if target is None and name not in declared:
+                        self.error(f"{stmt.kw.lower()} label not defined: {name}", stmt.label)
+                    elif target is None or not isinstance(target.stmt, kinds):
+                        self.error(f"invalid {stmt.kw.lower()} label {name}", stmt.label)
+                elif stmt.kw == "GOTO" and block.goto_target(name) is None:
+                    jumps.append(stmt)
+
+            elif isinstance(stmt, syntree.Block):
+                nested(labeled, stmt)
+
+            elif isinstance(stmt, syntree.IfStmt):
+                nested(None, stmt.body)
+                if isinstance(stmt.next_, syntree.IfStmt):
+                    statement(stmt.next_)
+                elif stmt.next_ is not None:
+                    nested(None, stmt.next_)
+
+            elif isinstance(stmt, (syntree.SwitchStmt, syntree.SelectStmt)):
+                for clause in in_order(stmt.clauses):
+                    nested(labeled, clause.body)
+
+            elif isinstance(stmt, syntree.ForStmt):
+                nested(labeled, stmt.body)
+
+        for stmt in stmts:
+            statement(stmt)
+        return jumps
+
+    def block_of(self, body, labeled: syntree.LabeledStmt):
+        """The innermost block of body (or case clause) the labeled
+        statement is in, None if it is in body itself"""
+        for node in syntree.walk(body, False):
+            if isinstance(node, (syntree.Block, syntree.CaseClause, syntree.CommClause)):
+                items = in_order(node.body if not isinstance(node, syntree.Block) else node)
+                if labeled in items:
+                    return node
+        return None
+
+    def missing_return(self, body):
+        """Reports the missing return at the closing brace of a body"""
+        file = fileset.fset.file(body.pos) if getattr(body, "pos", fileset.NoPos) else None
+        if file is None:
+            self.error("missing return", body)
+            return
+        end = file.position(body.end - 1)
+        self.diagnostics.append(Diagnostic("missing return", end.line, end.column, 1,
+                                           file=self.file))
+
+    def terminating_list(self, stmts: list) -> bool:
+        """If a list of statements ends with a terminating statement"""
+        return bool(stmts) and self.terminating(stmts[-1])
+
+    def terminating(self, stmt, label: Optional[str] = None) -> bool:
+        """If a statement is terminating, like the spec defines it: the
+        statements after it in its block are never run. label is the one
+        of the labeled statement it is, a break with it leaves it"""
+        if isinstance(stmt, syntree.Keyword):
+            return stmt.kw in ("RETURN", "GOTO")
+        if isinstance(stmt, syntree.FunctionCall):
+            return id(stmt) in self.panics
+        if isinstance(stmt, syntree.Block):
+            return self.terminating_list(in_order(stmt))
+        if isinstance(stmt, syntree.IfStmt):
+            if stmt.next_ is None or not self.terminating_list(in_order(stmt.body)):
+                return False
+            return self.terminating(stmt.next_)
+        if isinstance(stmt, syntree.ForStmt):
+            # a loop without condition, which only a break leaves
+            clause = stmt.clause
+            cond = clause.cond if isinstance(clause, syntree.ForClause) else clause
+            return no_condition(cond) and not has_break(in_order(stmt.body), label, True)
+        if isinstance(stmt, syntree.SwitchStmt):
+            clauses = in_order(stmt.clauses)
+            if not any(clause.is_default for clause in clauses):
+                return False
+            for clause in clauses:
+                body = in_order(clause.body)
+                if has_break(body, label, True):
+                    return False
+                fallthrough = (body and isinstance(body[-1], syntree.Keyword)
+                               and body[-1].kw == "FALLTHROUGH")
+                if not fallthrough and not self.terminating_list(body):
+                    return False
+            return True
+        if isinstance(stmt, syntree.SelectStmt):
+            for clause in in_order(stmt.clauses):
+                body = in_order(clause.body)
+                if has_break(body, label, True) or not self.terminating_list(body):
+                    return False
+            return True
+        if isinstance(stmt, syntree.LabeledStmt):
+            labeled = labeled_statements(stmt)
+            return len(labeled) == 1 and self.terminating(labeled[0], stmt.label.ident_name)
+        return False
+
+    def unreachable(self, stmts: list):
+        """Reports the first statement of each list after a terminating
+        one (or a break, a continue or a fallthrough), like go vet does.
+        A labeled statement can be the target of a goto, it is reachable"""
+        dead = False
+        for stmt in stmts:
+            if dead and not isinstance(stmt, syntree.LabeledStmt):
+                self.warning("unreachable code", "Unreachable", stmt)
+                break
+            self.unreachable_in(stmt)
+            dead = self.terminating(stmt) or (
+                isinstance(stmt, syntree.Keyword)
+                and stmt.kw in ("BREAK", "CONTINUE", "FALLTHROUGH"))
+
+    def unreachable_in(self, stmt):
+        """Reports the unreachable statements of the blocks of a statement"""
+        if isinstance(stmt, syntree.Block):
+            self.unreachable(in_order(stmt))
+        elif isinstance(stmt, syntree.IfStmt):
+            self.unreachable(in_order(stmt.body))
+            if stmt.next_ is not None:
+                self.unreachable_in(stmt.next_)
+        elif isinstance(stmt, syntree.ForStmt):
+            self.unreachable(in_order(stmt.body))
+        elif isinstance(stmt, (syntree.SwitchStmt, syntree.SelectStmt)):
+            for clause in in_order(stmt.clauses):
+                self.unreachable(in_order(clause.body))
+        elif isinstance(stmt, syntree.LabeledStmt):
+            for labeled in labeled_statements(stmt):
+                self.unreachable_in(labeled)
+
+    def return_stmt(self, stmt: syntree.Keyword):
+        signature = self.signatures[-1]
+        want = results(signature)
+        exprs = in_order(stmt.children[0]) if stmt.children else []
+
+        if not exprs:
+            if want and not signature.has_named_results:
+                self.error(
+                    "not enough return values\n\thave ()\n"
+                    f"\twant ({', '.join(type_string(t) for t in want)})", stmt
+                )
+            return
+
+        values = self.values(exprs)
+        if values is None:
+            return
+        if len(values) != len(want):
+            if not want:
+                self.error("too many return values", stmt)
+            else:
+                problem = "too many" if len(values) > len(want) else "not enough"
+                self.error(
+                    f"{problem} return values\n\thave {self.have(values)}\n"
+                    f"\twant ({', '.join(type_string(t) for t in want)})", stmt
+                )
+            return
+        for x, type_ in zip(values, want):
+            self.assign(x, type_, "return statement")
+
+    def assignment(self, stmt: syntree.Assignment):
+        lhs = in_order(stmt.left)
+        rhs = in_order(stmt.right)
+
+        if stmt.operator != "=":
+            if len(lhs) != 1 or len(rhs) != 1:
+                self.error(
+                    f"assignment operation {stmt.operator} "
+                    "requires single-valued expressions", stmt
+                )
+                return
+            x = self.expr(lhs[0])
+            y = self.single_value(self.expr(rhs[0]))
+            text = f"{expr_string(lhs[0])} {stmt.operator} {expr_string(rhs[0])}"
+            result = self.binary(stmt.operator[:-1], x, y, text, stmt)
+            if result.mode != "invalid":
+                self.assignable_operand(x)
+            return
+
+        values = self.values(rhs, len(lhs))
+        if values is None:
+            return
+        if len(lhs) != len(values):
+            self.assignment_mismatch(len(lhs), len(values), rhs, stmt)
+            return
+
+        context = "multiple assignment" if len(lhs) > 1 else "assignment"
+        for target, y in zip(lhs, values):
+            if self.is_blank(target):
+                self.default(y)
+                continue
+            x = self.assigned(target)
+            if self.assignable_operand(x):
+                self.assign(y, x.type_, context)
+
+    def assigned(self, target) -> Operand:
+        """Checks the target of an assignment, assigning a variable is not
+        a use of it (but assigning one of its elements or fields is)"""
+        if not (isinstance(target, syntree.PrimaryExpr) and not target.children
+                and isinstance(target.data, tuple)):
+            return self.expr(target)
+        obj = self.scope.lookup(target.data[1])
+        was_used = id(obj) in self.used
+        x = self.expr(target)
+        if not was_used:
+            self.used.discard(id(obj))
+        return x
+
+    def assignment_mismatch(self, variables: int, values: int, rhs: list, node):
+        message = f"assignment mismatch: {variables} variable{'s' if variables > 1 else ''} but "
+        if len(rhs) == 1 and isinstance(rhs[0], syntree.FunctionCall):
+            message += f"{expr_string(rhs[0])} returns "
+        message += f"{values} value{'s' if values != 1 else ''}"
+        self.error(message, node)
+
+    def is_blank(self, expr) -> bool:
+        return (isinstance(expr, syntree.PrimaryExpr) and not expr.children
+                and isinstance(expr.data, tuple) and expr.data[1] == "_")
+
+    def assignable_operand(self, x: Operand) -> bool:
+        if x.mode in ("variable", "mapindex", "invalid"):
+            return True
+        self.error(f"cannot assign to {describe(x)}", x.expr)
+        return False
+
+    def values(self, exprs: list, count: Optional[int] = None) -> Optional[List[Operand]]:
+        """Checks expressions used as values, a single call with
+        multiple results gives one operand per result
+
+        count is the number of values wanted, if known. Two values
+        are given by a comma-ok expression, like v, ok := x.(T)
+        Returns None if any of them is invalid"""
+        if len(exprs) == 1:
+            x = self.expr(exprs[0])
+            if x.mode == "tuple":
+                return [Operand("value", x.expr, t) for t in x.tuple_types]
+            if count == 2 and x.comma_ok:
+                return [x, Operand("value", x.expr, self.universe.lookup("bool").type_)]
+            operands = [self.single_value(x)]
+        else:
+            operands = [self.single_value(self.expr(e)) for e in exprs]
+
+        if any(x.mode == "invalid" for x in operands):
+            return None
+        return operands
+
+    def have(self, values: List[Operand], spread: bool = False) -> str:
+        types = []
+        for x in values:
+            if x.is_untyped:
+                types.append("number" if untyped.is_numeric(x.constant.kind) else x.constant.kind)
+            else:
+                types.append(type_string(x.type_))
+        if spread and types:
+            types[-1] += "..."
+        return f"({', '.join(types)})"
+
+    # conversions and assignability
+
+    def assign(self, x: Operand, type_: Optional[syntree.Type], context: str) -> Operand:
+        """Checks that x can be assigned to a variable of type_
+
+        Untyped constants are converted to type_"""
+        if x.mode == "nil" and type_ is not None:
+            if nillable(type_):
+                return Operand("value", x.expr, type_)
+            self.error(f"cannot use nil as {type_string(type_)} value in {context}", x.expr)
+            return Operand("invalid", x.expr)
+        if x.mode == "invalid" or x.type_ is None or type_ is None:
+            return x
+        if x.is_untyped:
+            if syntree.is_interface(type_):
+                # the constant gets its default type in the interface, which
+                # it has to fit in
+                default = self.default_type(x.constant)
+                if not self.representable(x.constant, default):
+                    self.error(
+                        f"cannot use {describe(x)} as {type_string(default)} value in "
+                        f"{context} (overflows)", x.expr
+                    )
+                    return Operand("invalid", x.expr)
+                x = self.default(x)
+                if x.mode == "invalid":
+                    return x
+            else:
+                return self.convert_untyped(x, type_, context)
+        if identical(x.type_, type_):
+            return x
+        xt, t = underlying(x.type_), underlying(type_)
+        if (not (is_named(x.type_) and is_named(type_)) and identical(xt, t)
+                and not isinstance(x.type_, syntree.TypeParam)
+                and not isinstance(type_, syntree.TypeParam)):
+            # like a []int used as an Ints, declared with type Ints []int
+            return x
+        if (isinstance(xt, syntree.Chan) and isinstance(t, syntree.Chan) and xt.dir == "both"
+                and identical(xt.eltype, t.eltype)):
+            # a bidirectional channel can be used as a send or receive-only one
+            return x
+
+        if syntree.is_interface(type_):
+            reason = self.missing_method(x.type_, type_)
+            if reason is None:
+                return x
+            self.error(
+                f"cannot use {describe(x)} as {type_string(type_)} value in {context}: "
+                f"{type_string(x.type_)} does not implement {type_string(type_)} {reason}",
+                x.expr
+            )
+            return Operand("invalid", x.expr)
+
+        self.error(
+            f"cannot use {describe(x)} as {type_string(type_)} value in {context}",
+            x.expr
+        )
+        return Operand("invalid", x.expr)
+
+    def missing_method(self, t: syntree.Type, iface: syntree.Type) -> Optional[str]:
+        """Why t doesn't implement the interface iface, like (missing
+        method m). None if it implements it"""
+        for want in underlying(iface).methods:
+            name = want.m_name
+            have, path = syntree.lookup_field_or_method(t, name)
+            if not isinstance(have, (syntree.Method, syntree.InterfaceMethod)):
+                return f"(missing method {name})"
+            if (isinstance(have, syntree.Method) and have.pointer_receiver
+                    and not syntree.through_pointer(t, path)):
+                return f"(method {name} has pointer receiver)"
+            signature = syntree.method_signature(have, path[-1].type_ if path else t)
+            if not identical_signatures(signature, want.signature):
+                return (
+                    f"(wrong type for method {name})\n"
+                    f"\t\thave {name}{signature_string(signature)}\n"
+                    f"\t\twant {name}{signature_string(want.signature)}"
+                )
+        return None
+
+    def representable(self, c: constant.Constant, type_: syntree.Type) -> bool:
+        """If the constant c can be converted to the basic type type_"""
+        if not untyped.compatible(c.kind, constant_kind(type_)):
+            return False
+        try:
+            constant.convert(c, basic_typename(type_))
+        except constant.ConstError:
+            return False
+        return True
+
+    def convert_untyped(self, x: Operand, type_: syntree.Type, context: str) -> Operand:
+        if isinstance(type_, syntree.TypeParam):
+            # the constant has to be representable by every type in its type set
+            terms = type_terms(type_)
+            if terms is None or not all(self.representable(x.constant, t) for _, t in terms):
+                self.error(
+                    f"cannot use {describe(x)} as {type_string(type_)} value in {context}",
+                    x.expr
+                )
+                return Operand("invalid", x.expr)
+            return Operand("value", x.expr, type_)
+        c = x.constant
+        if not untyped.compatible(c.kind, constant_kind(type_)):
+            self.error(
+                f"cannot use {describe(x)} as {type_string(type_)} value in {context}",
+                x.expr
+            )
+            return Operand("invalid", x.expr)
+        try:
+            const = constant.convert(c, basic_typename(type_))
+        except constant.ConstError as e:
+            self.error(str(e), x.expr)
+            return Operand("invalid", x.expr)
+        return self.record(Operand("constant", x.expr, type_, const))
+
+    def default(self, x: Operand) -> Operand:
+        """Gives untyped constants their default type"""
+        if x.mode == "nil":
+            self.error("use of untyped nil in assignment", x.expr)
+            return Operand("invalid", x.expr)
+        if not x.is_untyped:
+            return x
+        return self.convert_untyped(x, self.default_type(x.constant), "assignment")
+
+    def single_value(self, x: Operand) -> Operand:
+        if x.mode == "novalue":
+            self.error(f"{expr_string(x.expr)} (no value) used as value", x.expr)
+            return Operand("invalid", x.expr)
+        elif x.mode == "tuple":
+            self.error(f"multiple-value {describe(x)} in single-value context", x.expr)
+            return Operand("invalid", x.expr)
+        elif x.mode == "type":
+            self.error(f"{expr_string(x.expr)} (type) is not an expression", x.expr)
+            return Operand("invalid", x.expr)
+        elif x.mode == "builtin":
+            self.error(f"{expr_string(x.expr)} (built-in) must be called", x.expr)
+            return Operand("invalid", x.expr)
+        elif x.mode == "package":
+            self.error(f"use of package {expr_string(x.expr)} without selector", x.expr)
+            return Operand("invalid", x.expr)
+        elif self.is_generic(x):
+            self.error(
+                f"cannot use generic function {expr_string(x.expr)} without instantiation", x.expr
+            )
+            return Operand("invalid", x.expr)
+        return x
+
+    def is_generic(self, x: Operand) -> bool:
+        """If x is a generic function, which has to be instantiated to be used"""
+        return (x.mode == "value" and isinstance(x.type_, syntree.FunctionType)
+                and bool(x.type_.signature.type_params))
+
+    # expressions
+
+    def expr(self, node) -> Operand:
+        x = self.operand(node)
+        self.info.operands[node] = x
+        self.info.files[node] = self.file
+        return x
+
+    def record(self, x: Operand) -> Operand:
+        """Records x as the operand of its expression, for the
+        untyped constants converted to a type"""
+        if x.expr is not None:
+            self.info.operands[x.expr] = x
+            self.info.files[x.expr] = self.file
+        return x
+
+    def operand(self, node) -> Operand:
+        if isinstance(node, syntree.List):
+            exprs = in_order(node)
+            if len(exprs) == 1:
+                return self.expr(exprs[0])
+
+        if isinstance(node, syntree.Literal):
+            return self.literal(node)
+
+        elif isinstance(node, syntree.PrimaryExpr):
+            return self.primary_expr(node)
+
+        elif isinstance(node, syntree.QualifiedIdent):
+            return self.qualified_ident(node)
+
+        elif isinstance(node, syntree.FunctionCall):
+            return self.call(node)
+
+        elif isinstance(node, syntree.Assignment):
+            self.error(f"cannot use assignment {expr_string(node)} as value", node)
+
+        elif isinstance(node, syntree.BinOp):
+            x = self.single_value(self.expr(node.left))
+            y = self.single_value(self.expr(node.right))
+            return self.binary(node.operator, x, y, expr_string(node), node)
+
+        elif isinstance(node, syntree.UnaryOp):
+            return self.unary(node)
+
+        elif isinstance(node, syntree.Function):
+            self.function(node.signature, node.body)
+            return Operand("value", node, syntree.FunctionType(node.signature))
+
+        elif isinstance(node, syntree.Type):
+            # the type argument of a builtin, like make([]int, n)
+            self.type_(node)
+            return Operand("type", node, node)
+
+        elif not isinstance(node, syntree.BadExpr):
+            self.error(f"{expr_string(node)} is not an expression", node)
+
+        return Operand("invalid", node)
+
+    def literal(self, node: syntree.Literal) -> Operand:
+        if isinstance(node.type_, syntree.Type):
+            self.type_(node.type_)
+            self.composite_elements(node.value, node.type_, node)
+            return Operand("value", node, node.type_)
+
+        try:
+            const = constant.from_literal(node)
+        except constant.ConstError as e:
+            self.error(str(e), node)
+            return Operand("invalid", node)
+        return Operand("constant", node, self.default_type(const), const)
+
+    def composite_elements(self, values, type_: syntree.Type, node):
+        """Checks the elements of a composite literal of type_"""
+        # elements can be LiteralValues themselves, for elided types
+        elements = [] if values is None else list(reversed(values.children))
+        t = underlying(type_)
+        if isinstance(t, syntree.Struct):
+            self.struct_elements(elements, t, type_, node)
+        elif isinstance(t, (syntree.Array, syntree.Slice)):
+            self.array_elements(elements, t, node)
+        elif isinstance(t, syntree.Map):
+            self.map_elements(elements, t, node)
+        else:
+            self.error(f"invalid composite literal type {type_string(type_)}", node)
+
+    def element(self, element, type_: Optional[syntree.Type], context: str, node):
+        if isinstance(element, syntree.LiteralValue):
+            if type_ is not None:
+                self.composite_elements(element, type_, node)
+        else:
+            self.assign(self.single_value(self.expr(element)), type_, context)
+
+    def array_elements(self, elements: list, t: syntree.Type, node):
+        seen: Dict[int, Any] = {}
+        index = 0
+        out_of_bounds = None
+        for element in elements:
+            if isinstance(element, syntree.KeyedElement):
+                index = self.element_index(element.key)
+                if index is not None and index in seen:
+                    self.error(f"duplicate index {index} in array or slice literal", element.key)
+                element = element.value
+            if index is not None:
+                seen[index] = element
+                if isinstance(t, syntree.Array) and index >= t.length and out_of_bounds is None:
+                    out_of_bounds = index
+            self.element(element, t.eltype, "array or slice literal", node)
+            index = None if index is None else index + 1
+
+        if out_of_bounds is not None:
+            self.error(f"index {out_of_bounds} is out of bounds (>= {t.length})", node)
+
+    def map_elements(self, elements: list, t: syntree.Map, node):
+        # constant keys seen so far, to report duplicates
+        seen: Dict[tuple, Any] = {}
+        for element in elements:
+            if not isinstance(element, syntree.KeyedElement):
+                self.error("missing key in map literal", element)
+                self.element(element, t.eltype, "map literal", node)
+                continue
+            if isinstance(element.key, syntree.LiteralValue):
+                self.composite_elements(element.key, t.key, node)
+            else:
+                key = self.single_value(self.expr(element.key))
+                key = self.assign(key, t.key, "map literal")
+                if key is not None and key.mode == "constant":
+                    value = (key.constant.kind, key.constant.value)
+                    if value in seen:
+                        self.error(f"duplicate key {expr_string(element.key)} in map literal",
+                                   element.key)
+                    seen[value] = element
+            self.element(element.value, t.eltype, "map literal", node)
+
+    def element_index(self, key) -> Optional[int]:
+        """Value of the index of a keyed element in an array or slice literal"""
+        if isinstance(key, syntree.LiteralValue):
+            self.error("invalid composite literal key", node=key)
+            return None
+        x = self.single_value(self.expr(key))
+        if x.mode == "invalid":
+            return None
+        if x.is_untyped and untyped.is_numeric(x.constant.kind):
+            x = self.convert_untyped(x, self.universe.lookup("int").type_, "index")
+            if x.mode == "invalid":
+                return None
+        elif x.mode != "constant" or not is_integer(x.type_):
+            self.error(f"index {expr_string(key)} must be integer constant", key)
+            return None
+        if x.constant.value < 0:
+            self.error(
+                f"invalid argument: index {expr_string(key)} "
+                f"(constant of type int) must not be negative", key
+            )
+            return None
+        return x.constant.value
+
+    def struct_elements(self, elements: list, t: syntree.Struct, type_: syntree.Type, node):
+        if not elements:
+            return
+        keyed = [isinstance(e, syntree.KeyedElement) for e in elements]
+        if any(keyed) and not all(keyed):
+            element = elements[keyed.index(False) if keyed[0] else keyed.index(True)]
+            self.error("mixture of field:value and value elements in struct literal", element)
+            return
+
+        if not any(keyed):
+            for element, field in zip(elements, t.fields):
+                self.field_value(element, field, node)
+            if len(elements) > len(t.fields):
+                self.error(
+                    f"too many values in struct literal of type {type_string(type_)}",
+                    elements[len(t.fields)]
+                )
+            elif len(elements) < len(t.fields):
+                self.error(f"too few values in struct literal of type {type_string(type_)}", node)
+            return
+
+        seen = set()
+        for element in elements:
+            key = element.key
+            if not (isinstance(key, syntree.PrimaryExpr) and isinstance(key.data, tuple)
+                    and not key.children):
+                self.error(f"invalid field name {expr_string(key)} in struct literal", key)
+                continue
+            name = key.data[1]
+            field = t.field(name)
+            if field is None:
+                self.error(
+                    f"unknown field {name} in struct literal of type {type_string(type_)}", key
+                )
+                continue
+            if name in seen:
+                self.error(f"duplicate field name {name} in struct literal", key)
+            seen.add(name)
+            self.info.keys[key] = field
+            self.field_value(element.value, field, node)
+
+    def field_value(self, value, field: syntree.StructField, node):
+        if isinstance(value, syntree.LiteralValue):
+            # the type can be elided only for elements of arrays and slices
+            self.error("missing type in composite literal", value)
+            return
+        self.element(value, field.type_, "struct literal", node)
+
+    def default_type(self, const: constant.Constant) -> syntree.Type:
+        return self.universe.lookup(untyped.default_typename(const.kind)).type_
+
+    def identifier(self, name: str, node) -> Operand:
+        if name == "_":
+            self.error("cannot use _ as value", node)
+            return Operand("invalid", node)
+
+        obj = self.scope.lookup(name)
+        if obj is None and name in unsupported_builtins:
+            self.unsupported(f"the builtin {name} is not yet supported", node)
+            return Operand("invalid", node)
+        if obj is None:
+            self.error(f"undefined: {name}", node, fix=self.spelling_fix(name, node))
+            return Operand("invalid", node)
+        self.used.add(id(obj))
+        self.refer(obj)
+        self.use(node, obj)
+        return self.object_operand(obj, node)
+
+    def use(self, node, obj: Object):
+        self.info.uses[node] = obj
+        self.info.files[node] = self.file
+
+    def object_operand(self, obj: Object, node) -> Operand:
+        if id(obj) in self.pending and not self.package_object(obj):
+            return Operand("invalid", node)
+        if obj.kind == "const":
+            if obj.name == "iota" and obj.lineno is None:
+                if self.iota is None:
+                    self.error("cannot use iota outside constant declaration", node)
+                    return Operand("invalid", node)
+                const = constant.Constant("int", self.iota)
+                return Operand("constant", node, self.default_type(const), const)
+            return Operand("constant", node, obj.type_, obj.constant)
+        elif obj.kind == "var":
+            return Operand("variable", node, obj.type_)
+        elif obj.kind == "func":
+            return Operand("value", node, obj.type_)
+        elif obj.kind == "type":
+            return Operand("type", node, obj.type_)
+        elif obj.kind == "builtin":
+            return Operand("builtin", node)
+        elif obj.kind == "nil":
+            return Operand("nil", node)
+        return Operand("package", node)
+
+    def primary_expr(self, node: syntree.PrimaryExpr) -> Operand:
+        if isinstance(node.data, tuple):
+            x = self.identifier(node.data[1], node)
+            children = node.children
+            text = node.data[1]
+        else:
+            x = self.expr(node.children[0])
+            children = node.children[1:]
+            text = expr_string(node.children[0])
+
+        for child in children:
+            if isinstance(child, syntree.Index):
+                x = self.index(x, child, node)
+                text = f"{text}[{expr_string(child.expr)}]"
+            elif isinstance(child, syntree.SliceExpr):
+                x = self.slice_expr(x, child, text, node)
+                text = f"{text}{slice_string(child)}"
+            elif isinstance(child, syntree.Selector):
+                x = self.selector(x, child, text, node)
+                text = f"{text}.{child.field_name}"
+            elif isinstance(child, syntree.TypeAssertion):
+                x = self.type_assertion(x, child, text, node)
+                text = f"{text}.({type_string(child.type_)})"
+            # the operand of the expression up to the step
+            self.info.operands[child] = x
+            self.info.files[child] = self.file
+        return x
+
+    def index(self, x: Operand, index: syntree.Index, node) -> Operand:
+        if self.is_generic(x):
+            # an instantiation, like Max[int]
+            name = expr_string(x.expr)
+            if not self.allows("function instantiation", lang.generics, node):
+                return Operand("invalid", node)
+            signature = x.type_.signature
+            exprs = in_order(index.expr)
+            type_args = self.type_arguments(name, signature.type_params, exprs)
+            if type_args is None:
+                return Operand("invalid", node)
+            if len(type_args) < len(signature.type_params):
+                self.error(f"cannot use generic function {name} without instantiation", node)
+                return Operand("invalid", node)
+            if not self.satisfies_all(signature.type_params, type_args, node):
+                return Operand("invalid", node)
+            mapping = dict(zip(signature.type_params, type_args))
+            signature = syntree.substitute_signature(signature, mapping)
+            return Operand("value", node, syntree.FunctionType(signature))
+        x = self.single_value(x)
+        i = self.single_value(self.expr(index.expr))
+        if x.mode == "invalid" or x.type_ is None:
+            return Operand("invalid" if x.mode == "invalid" else "value", node)
+
+        t = underlying(x.type_)
+        if isinstance(t, syntree.Pointer) and isinstance(underlying(t.base), syntree.Array):
+            # the pointed array, like p[i] for (*p)[i]
+            t = underlying(t.base)
+            x = Operand("variable", x.expr, t)
+        if isinstance(t, syntree.Map):
+            self.assign(i, t.key, "map index")
+            x = Operand("mapindex", node, t.eltype)
+            x.comma_ok = True
+            return x
+        elif isinstance(t, (syntree.Array, syntree.Slice)):
+            eltype = t.eltype
+        elif basic_typename(t) == "string":
+            eltype = self.universe.lookup("byte").type_
+        else:
+            self.error(f"invalid operation: cannot index {describe(x)}", x.expr)
+            return Operand("invalid", node)
+
+        self.check_index(i, t.length if isinstance(t, syntree.Array) else None)
+
+        # elements of slices are always addressable
+        mode = "variable" if x.mode == "variable" or isinstance(t, syntree.Slice) else "value"
+        if basic_typename(t) == "string":
+            mode = "value"
+        return Operand(mode, node, eltype)
+
+    def check_index(self, i: Operand, length: Optional[int] = None) -> Operand:
+        """Checks an index (or a size given to make), constant
+        indices must be less than length, if it is known"""
+        if i.mode == "invalid" or i.type_ is None:
+            return i
+        if i.is_untyped and untyped.is_numeric(i.constant.kind):
+            i = self.convert_untyped(i, self.universe.lookup("int").type_, "index")
+        elif not is_integer(i.type_):
+            self.error(f"invalid argument: index {describe(i)} must be integer", i.expr)
+            return Operand("invalid", i.expr)
+        if i.mode == "constant":
+            if i.constant.value < 0:
+                self.error(
+                    f"invalid argument: index {expr_string(i.expr)} "
+                    f"(constant of type int) must not be negative", i.expr
+                )
+            elif length is not None and i.constant.value >= length:
+                self.error(
+                    f"invalid argument: index {i.constant} out of bounds [0:{length}]",
+                    i.expr
+                )
+        return i
+
+    def slice_expr(self, x: Operand, sl: syntree.SliceExpr, text: str, node) -> Operand:
+        """text is the expression sliced, like a in a[1:3]"""
+        x = self.single_value(x)
+        indices = [
+            self.single_value(self.expr(i)) if i is not None else None for i in sl.indices
+        ]
+        if x.mode == "invalid" or x.type_ is None:
+            return Operand("invalid" if x.mode == "invalid" else "value", node)
+
+        t = underlying(x.type_)
+        length = None
+        if isinstance(t, syntree.Pointer) and isinstance(underlying(t.base), syntree.Array):
+            # the pointed array, like p[1:] for (*p)[1:]
+            t = underlying(t.base)
+            x = Operand("variable", x.expr, t)
+
+        if basic_typename(t) == "string":
+            if sl.max is not None:
+                self.error(f"invalid operation: 3-index slice of string", node)
+                return Operand("invalid", node)
+            type_ = self.universe.lookup("string").type_ if x.is_untyped else x.type_
+            if x.mode == "constant":
+                length = len(x.constant.value) + 1
+        elif isinstance(t, syntree.Array):
+            if x.mode != "variable":
+                self.error(
+                    f"invalid operation: {text}{slice_string(sl)} (slice of unaddressable value)",
+                    node
+                )
+                return Operand("invalid", node)
+            type_ = syntree.Slice(t.eltype)
+            # None if the length of the array isn't valid, it is reported
+            if t.length is not None:
+                length = t.length + 1
+        elif isinstance(t, syntree.Slice):
+            type_ = x.type_
+        else:
+            self.error(f"cannot slice {describe(x, text)}", node)
+            return Operand("invalid", node)
+
+        # constant indices must be in bounds and in order
+        previous = None
+        for i in indices:
+            if i is None:
+                continue
+            i = self.check_index(i, length)
+            if i.mode != "constant" or i.constant.value < 0:
+                continue
+            if previous is not None and i.constant.value < previous:
+                self.error(f"invalid slice indices: {i.constant} < {previous}", i.expr)
+            previous = i.constant.value
+        return Operand("value", node, type_)
+
+    def selector(self, x: Operand, sel: syntree.Selector, text: str, node) -> Operand:
+        """text is the expression up to the selector, like p.min in p.min.x"""
+        name = sel.field_name
+        if x.mode == "type":
+            return self.method_expr(x, sel, text, node)
+        x = self.single_value(x)
+        if x.mode == "invalid" or x.type_ is None:
+            return Operand("invalid" if x.mode == "invalid" else "value", node)
+
+        t = underlying(x.type_)
+        if isinstance(t, syntree.Interface) or isinstance(x.type_, syntree.TypeParam):
+            # the methods of a type parameter are the ones of its constraint,
+            # it has no fields
+            method = syntree.find_method(x.type_, name)
+            if method is not None:
+                self.info.selections[sel] = Selection("method", x.type_, method)
+                return Operand("value", node, syntree.FunctionType(method.signature))
+            if isinstance(x.type_, syntree.TypeParam):
+                t = x.type_
+
+        pointer = isinstance(t, syntree.Pointer)
+        # the fields of the pointed struct of a defined pointer type
+        # can be selected, not its methods
+        recv = t if pointer and not isinstance(x.type_, syntree.Pointer) else x.type_
+        obj, path = syntree.lookup_field_or_method(recv, name)
+        if obj is None and path is not None:
+            self.error(f"ambiguous selector {text}.{name}", sel)
+            return Operand("invalid", node)
+        # p.x is (*p).x, a.x is a.B.x if x is promoted from B
+        indirect = syntree.through_pointer(recv, path)
+        if isinstance(obj, syntree.StructField):
+            self.info.selections[sel] = Selection("field", x.type_, obj, pointer, path)
+            # fields of addressable structs are addressable
+            mode = "variable" if x.mode == "variable" or indirect else "value"
+            return Operand(mode, node, obj.type_)
+
+        if recv is not x.type_:
+            obj = None
+        # the method of the embedded field it is promoted from
+        embedded = path[-1].type_ if path else x.type_
+        if isinstance(obj, syntree.InterfaceMethod):
+            self.info.selections[sel] = Selection("method", x.type_, obj, pointer, path)
+            return Operand("value", node, syntree.FunctionType(obj.signature))
+        if isinstance(obj, syntree.Method) and obj.receiver_type is not None:
+            if obj.pointer_receiver and not indirect and x.mode != "variable":
+                # &x is taken for the call, so x has to be addressable
+                self.error(
+                    f"cannot call pointer method {name} on {type_string(x.type_)}", sel
+                )
+                return Operand("invalid", node)
+            self.info.selections[sel] = Selection("method", x.type_, obj, pointer, path)
+            self.refer(obj)
+            signature = syntree.method_signature(obj, embedded)
+            return Operand("value", node, syntree.FunctionType(signature))
+
+        self.error(
+            f"{text}.{name} undefined "
+            f"(type {type_string(x.type_)} has no field or method {name})", sel
+        )
+        return Operand("invalid", node)
+
+    def method_expr(self, x: Operand, sel: syntree.Selector, text: str, node) -> Operand:
+        """A method expression like Point.area, a function
+        with the receiver as its first parameter"""
+        name = sel.field_name
+        method, path = syntree.lookup_field_or_method(x.type_, name)
+        if method is None and path is not None:
+            self.error(f"ambiguous selector {text}.{name}", sel)
+            return Operand("invalid", node)
+        if not isinstance(method, syntree.Method) or method.receiver_type is None:
+            self.error(
+                f"{text}.{name} undefined (type {type_string(x.type_)} has no method {name})", sel
+            )
+            return Operand("invalid", node)
+        if method.pointer_receiver and not syntree.through_pointer(x.type_, path):
+            self.error(
+                f"invalid method expression {text}.{name} "
+                f"(needs pointer receiver (*{text}).{name})", sel
+            )
+            return Operand("invalid", node)
+        self.info.selections[sel] = Selection("methodexpr", x.type_, method, path=path)
+        self.refer(method)
+        # a promoted method has a value of type_ as its receiver,
+        # the method is called with its embedded field
+        embedded = path[-1].type_ if path else x.type_
+        signature = syntree.substitute_signature(
+            method.expr_signature(x.type_), syntree.method_mapping(method, embedded)
+        )
+        return Operand("value", node, syntree.FunctionType(signature))
+
+    def type_assertion(self, x: Operand, assertion: syntree.TypeAssertion, text: str, node
+                       ) -> Operand:
+        """text is the expression asserted, like s in s.(Point)"""
+        x = self.single_value(x)
+        type_ = assertion.type_
+        if x.mode == "invalid" or x.type_ is None or type_ is None:
+            return Operand("invalid" if x.mode == "invalid" else "value", node, type_)
+        if not syntree.is_interface(x.type_):
+            self.error(f"invalid operation: {describe(x, text)} is not an interface", node)
+            return Operand("invalid", node)
+
+        self.type_(type_)
+        if not syntree.is_interface(type_):
+            # the dynamic type of x can't be type_ if it doesn't implement it
+            reason = self.missing_method(type_, x.type_)
+            if reason is not None:
+                self.error(
+                    f"impossible type assertion: {text}.({type_string(type_)})\n"
+                    f"\t{type_string(type_)} does not implement {type_string(x.type_)} {reason}",
+                    node
+                )
+                return Operand("invalid", node)
+
+        x = Operand("value", node, type_)
+        x.comma_ok = True
+        return x
+
+    def qualified_ident(self, node: syntree.QualifiedIdent) -> Operand:
+        name = node.data[0][1]
+        obj = self.scope.lookup(name)
+        if obj is None:
+            self.error(f"undefined: {name}", node)
+            return Operand("invalid", node)
+        if obj.kind != "package":
+            self.error(f"{expr_string(node)} undefined", node)
+            return Operand("invalid", node)
+        self.used.add(id(obj))
+        if obj.members is None:
+            # a package which is not part of the program, like fmt
+            return Operand("value", node)
+        member = obj.members.objects.get(node.data[1][1])
+        if member is None:
+            self.error(f"undefined: {expr_string(node)}", node)
+            return Operand("invalid", node)
+        if not member.name[0].isupper():
+            self.error(f"name {member.name} not exported by package {name}", node)
+            return Operand("invalid", node)
+        self.use(node, member)
+        return self.object_operand(member, node)
+
+    def call(self, node: syntree.FunctionCall) -> Operand:
+        if isinstance(node.fn_name, str):
+            name = node.fn_name
+            fn = self.identifier(name, node)
+        else:
+            name = expr_string(node.fn_name)
+            fn = self.expr(node.fn_name)
+
+        args = in_order(node.arguments.expression_list)
+        if node.arguments.type_ is not None:
+            args = [node.arguments.type_] + args
+
+        if fn.mode == "invalid":
+            for arg in args:
+                self.expr(arg)
+            return Operand("invalid", node)
+
+        spread = node.arguments.ellipsis
+        if fn.mode == "builtin":
+            if spread and name != "append":
+                for arg in args:
+                    self.expr(arg)
+                self.error(f"invalid operation: invalid use of ... with built-in {name}", node)
+                return Operand("invalid", node)
+            x = self.builtin(name, args, node)
+            if x.mode != "constant":
+                self.call_or_receive = True
+            return x
+
+        if fn.mode == "type":
+            if spread:
+                for arg in args:
+                    self.expr(arg)
+                self.error(f"invalid use of ... in conversion to {type_string(fn.type_)}", node)
+                return Operand("invalid", node)
+            return self.conversion(fn.type_, args, node)
+
+        self.call_or_receive = True
+        if fn.type_ is None:
+            # a function from a package
+            for arg in args:
+                self.single_value(self.expr(arg))
+            return Operand("value", node)
+
+        if not isinstance(fn.type_, syntree.FunctionType):
+            self.error(
+                f"invalid operation: cannot call non-function {describe(fn, name)}", node
+            )
+            return Operand("invalid", node)
+
+        signature = fn.type_.signature
+        values = self.values(args) if args else []
+        if signature.type_params:
+            feature = "function instantiation"
+            if not node.type_arg_exprs:
+                feature = "implicit " + feature
+            if not self.allows(feature, lang.generics, node):
+                return Operand("invalid", node)
+            signature = self.infer(name, signature, values, node)
+            if signature is None:
+                return Operand("invalid", node)
+        params = parameters(signature.parameters)
+        if values is not None:
+            self.arguments(name, params, values, node)
+
+        res = results(signature)
+        if len(res) == 0:
+            return Operand("novalue", node)
+        elif len(res) == 1:
+            return Operand("value", node, res[0])
+        x = Operand("tuple", node)
+        x.tuple_types = res
+        return x
+
+    def type_arguments(self, name: str, type_params: list, exprs: list) -> Optional[list]:
+        """The types of the explicit type arguments of an instantiation"""
+        type_args = []
+        for expr in exprs:
+            x = self.expr(expr)
+            if x.mode == "invalid":
+                return None
+            if x.mode != "type":
+                self.error(f"{expr_string(expr)} is not a type", expr)
+                return None
+            type_args.append(x.type_)
+        if len(type_args) > len(type_params):
+            self.error(
+                f"got {len(type_args)} type arguments but {name} "
+                f"has {len(type_params)} type parameters", exprs[len(type_params)]
+            )
+            return None
+        return type_args
+
+    def infer(self, name: str, signature: syntree.Signature, values: Optional[List[Operand]],
+              node: syntree.FunctionCall) -> Optional[syntree.Signature]:
+        """The signature of a call of a generic function, with the type arguments
+        given in the call (like Max[int]) or inferred from the arguments"""
+        type_params = signature.type_params
+        type_args = self.type_arguments(name, type_params, node.type_arg_exprs)
+        if type_args is None or values is None:
+            return None
+        mapping = dict(zip(type_params, type_args))
+
+        params = parameters(signature.parameters)
+        untyped_args: Dict[syntree.TypeParam, List[Operand]] = {}
+        for i, x in enumerate(values):
+            if i >= len(params) and not (params and params[-1][2]):
+                # too many arguments, reported once the types are known
+                break
+            type_ = params[min(i, len(params) - 1)][1]
+            if node.arguments.ellipsis and i == len(params) - 1 and type_ is not None:
+                # the slice of the variadic parameter, like []int for ...T
+                type_ = syntree.Slice(type_)
+            if x.mode in ("invalid", "nil") or x.type_ is None:
+                continue
+            if x.is_untyped:
+                if isinstance(type_, syntree.TypeParam):
+                    untyped_args.setdefault(type_, []).append(x)
+                continue
+            self.unify(type_, x.type_, mapping, type_params)
+
+        # a constraint with a single type in it (like ~[]E) gives the type
+        # arguments of its type parameters, like E for []int
+        for type_param in type_params:
+            terms = type_terms(type_param)
+            if type_param in mapping and terms is not None and len(terms) == 1:
+                tilde, core = terms[0]
+                type_arg = mapping[type_param]
+                self.unify(core, underlying(type_arg) if tilde else type_arg,
+                           mapping, type_params)
+
+        # untyped constants get the default type of the
+        # largest kind of them, like float64 for f(1, 2.5)
+        for type_param, xs in untyped_args.items():
+            if type_param not in mapping:
+                kind = xs[0].constant.kind
+                for x in xs[1:]:
+                    kind = untyped.match(kind, x.constant.kind) or kind
+                mapping[type_param] = self.default_type(constant.Constant(kind, 0))
+
+        for type_param in type_params:
+            if type_param not in mapping:
+                self.error(f"in call to {name}, cannot infer {type_param.typename}", node)
+                return None
+        type_args = [mapping[type_param] for type_param in type_params]
+        if not self.satisfies_all(type_params, type_args, node):
+            return None
+        node.type_args = type_args
+        return syntree.substitute_signature(signature, mapping)
+
+    def unify(self, x: syntree.Type, y: syntree.Type, mapping: dict, type_params: list):
+        """Infers the type arguments of the type parameters in the parameter
+        type x from the argument type y, mismatches are reported by assign"""
+        if isinstance(x, syntree.TypeParam):
+            if any(x is type_param for type_param in type_params) and x not in mapping:
+                mapping[x] = y
+            return
+        if isinstance(x, syntree.NamedType):
+            if (x.origin is not None and isinstance(y, syntree.NamedType)
+                    and y.origin is x.origin):
+                for x_arg, y_arg in zip(x.type_args, y.type_args):
+                    self.unify(x_arg, y_arg, mapping, type_params)
+            return
+        # the underlying type of a named type, like a Celsius slice for []T
+        y = underlying(y)
+        if type(x) is not type(y):
+            return
+        if isinstance(x, (syntree.Array, syntree.Slice, syntree.Chan)):
+            self.unify(x.eltype, y.eltype, mapping, type_params)
+        elif isinstance(x, syntree.Map):
+            self.unify(x.key, y.key, mapping, type_params)
+            self.unify(x.eltype, y.eltype, mapping, type_params)
+        elif isinstance(x, syntree.Pointer):
+            self.unify(x.base, y.base, mapping, type_params)
+        elif isinstance(x, syntree.FunctionType):
+            x_params = parameters(x.signature.parameters)
+            y_params = parameters(y.signature.parameters)
+            for (_, x_type, _), (_, y_type, _) in zip(x_params, y_params):
+                if x_type is not None and y_type is not None:
+                    self.unify(x_type, y_type, mapping, type_params)
+            for x_type, y_type in zip(results(x.signature), results(y.signature)):
+                if x_type is not None and y_type is not None:
+                    self.unify(x_type, y_type, mapping, type_params)
+
+    def arguments(self, name: str, params: list, values: List[Operand], node):
+        variadic = bool(params) and params[-1][2]
+        # the last argument is the slice of the variadic parameter, like f(s...)
+        spread = node.arguments.ellipsis
+        if spread and not variadic:
+            self.error(f"cannot use ... in call to non-variadic {name}", node)
+            return
+        want = f"({', '.join(('...' if v else '') + type_string(t) for _, t, v in params)})"
+        if len(values) < len(params) - (variadic and not spread):
+            self.error(
+                f"not enough arguments in call to {name}\n"
+                f"\thave {self.have(values, spread)}\n\twant {want}", node
+            )
+            return
+        if (not variadic or spread) and len(values) > len(params):
+            self.error(
+                f"too many arguments in call to {name}\n"
+                f"\thave {self.have(values, spread)}\n\twant {want}", node
+            )
+            return
+        for i, x in enumerate(values):
+            type_ = params[min(i, len(params) - 1)][1]
+            if spread and i == len(params) - 1 and type_ is not None:
+                type_ = syntree.Slice(type_)
+            self.assign(x, type_, f"argument to {name}")
+
+    def builtin(self, name: str, args: list, node) -> Operand:
+        if name == "make":
+            return self.make(args, node)
+        elif name == "new":
+            return self.new(args, node)
+
+        # the calls and receives in the arguments, for len and cap
+        outer, self.call_or_receive = self.call_or_receive, False
+        values = self.values(args) if args else []
+        call_or_receive, self.call_or_receive = self.call_or_receive, outer or self.call_or_receive
+        if values is None:
+            return Operand("invalid", node)
+        counts = {
+            "append": (1, None), "close": (1, 1), "complex": (2, 2), "copy": (2, 2),
+            "delete": (2, 2), "recover": (0, 0), "min": (1, None), "max": (1, None),
+        }
+        least, most = counts.get(name, (1, 1))
+        if len(values) < least or most is not None and len(values) > most:
+            problem = "not enough" if len(values) < least else "too many"
+            self.error(f"{problem} arguments for {expr_string(node)}", node)
+            return Operand("invalid", node)
+        if any(x.mode == "invalid" for x in values):
+            return Operand("invalid", node)
+
+        int_type = self.universe.lookup("int").type_
+        if name == "append":
+            s = values[0]
+            t = underlying(s.type_) if s.type_ is not None else None
+            if t is None:
+                return Operand("value", node)
+            if not isinstance(t, syntree.Slice):
+                self.error(f"invalid argument: {describe(s)} is not a slice", s.expr)
+                return Operand("invalid", node)
+            if node.arguments.ellipsis:
+                # the elements of a slice, or the bytes of a string for []byte
+                if len(values) != 2:
+                    problem = "not enough" if len(values) < 2 else "too many"
+                    self.error(f"{problem} arguments for {expr_string(node)}", node)
+                    return Operand("invalid", node)
+                x = values[1]
+                is_string = (x.constant.kind == "string" if x.is_untyped
+                             else constant_kind(x.type_) == "string")
+                byte = basic_aliases.get(basic_typename(t.eltype), basic_typename(t.eltype))
+                if not (is_string and byte == "uint8"):
+                    self.assign(x, syntree.Slice(t.eltype), "argument to append")
+                return Operand("value", node, s.type_)
+            for x in values[1:]:
+                self.assign(x, t.eltype, "argument to append")
+            return Operand("value", node, s.type_)
+
+        elif name == "delete":
+            m, key = values
+            if m.type_ is None:
+                return Operand("novalue", node)
+            t = underlying(m.type_)
+            if not isinstance(t, syntree.Map):
+                self.error(f"invalid argument: {describe(m)} is not a map", m.expr)
+                return Operand("invalid", node)
+            self.assign(key, t.key, "argument to delete")
+            return Operand("novalue", node)
+
+        elif name == "panic":
+            self.panics.add(id(node))
+            # any value can be given, to be recovered
+            self.assign(values[0], self.universe.lookup("any").type_, "argument to panic")
+            return Operand("novalue", node)
+
+        elif name == "recover":
+            return Operand("value", node, self.universe.lookup("any").type_)
+
+        elif name == "close":
+            ch = values[0]
+            if ch.type_ is None:
+                return Operand("novalue", node)
+            t = underlying(ch.type_)
+            if not isinstance(t, syntree.Chan):
+                self.error(
+                    f"invalid operation: cannot close non-channel {describe(ch)}", ch.expr
+                )
+                return Operand("invalid", node)
+            if t.dir == "recv":
+                self.error(
+                    f"invalid operation: cannot close receive-only channel {describe(ch)}",
+                    ch.expr
+                )
+                return Operand("invalid", node)
+            return Operand("novalue", node)
+
+        elif name == "complex":
+            return self.complex_(values, node)
+
+        elif name in ("real", "imag"):
+            return self.complex_part(name, values[0], node)
+
+        elif name in ("min", "max"):
+            if not self.allows(f"built-in {name}", lang.min_max, node):
+                return Operand("invalid", node)
+            return self.min_max(name, values, node)
+
+        elif name == "copy":
+            dst, src = values
+            if dst.type_ is None or src.type_ is None:
+                return Operand("value", node, int_type)
+            dt, st = underlying(dst.type_), underlying(src.type_)
+            if not isinstance(dt, syntree.Slice) or not isinstance(st, syntree.Slice):
+                self.error(
+                    f"invalid argument: copy expects slice arguments; "
+                    f"found {describe(dst)} and {describe(src)}", node
+                )
+                return Operand("invalid", node)
+            if not identical(dt.eltype, st.eltype):
+                self.error(
+                    f"invalid argument: arguments to copy {describe(dst)} and "
+                    f"{describe(src)} have different element types "
+                    f"{type_string(dt.eltype)} and {type_string(st.eltype)}", node
+                )
+                return Operand("invalid", node)
+            return Operand("value", node, int_type)
+
+        # len and cap, of strings and maps (len only), arrays,
+        # slices and channels, and of pointers to arrays
+        x = values[0]
+        t = underlying(x.type_) if x.type_ is not None else None
+        if isinstance(t, syntree.Pointer) and isinstance(underlying(t.base), syntree.Array):
+            t = underlying(t.base)
+        allowed = (syntree.Array, syntree.Slice, syntree.Chan)
+        if t is not None and not isinstance(t, allowed) and not (
+                name == "len" and (basic_typename(t) == "string" or isinstance(t, syntree.Map))):
+            self.error(f"invalid argument: {describe(x)} for built-in {name}", x.expr)
+            return Operand("invalid", node)
+        if x.mode == "constant":
+            # the number of bytes of a constant string is a constant
+            const = constant.Constant("int", len(x.constant.value), "int")
+            return Operand("constant", node, int_type, const)
+        if isinstance(t, syntree.Array) and t.length is not None and not call_or_receive:
+            # so is the length of an array, which isn't evaluated
+            const = constant.Constant("int", t.length, "int")
+            return Operand("constant", node, int_type, const)
+        return Operand("value", node, int_type)
+
+    def min_max(self, name: str, values: List[Operand], node) -> Operand:
+        """min(x, y...) and max(x, y...), of ordered operands of the
+        same type, a constant if they all are"""
+        x = None
+        for y in values:
+            if y.type_ is None:
+                return Operand("value", node)
+            if not self.operator_defined("<", y):
+                self.error(f"invalid argument: {describe(y)} cannot be ordered", y.expr)
+                return Operand("invalid", node)
+            if x is None:
+                x = y
+                continue
+
+            # an untyped argument is converted to the type of the others
+            # it can represent
+            if x.is_untyped and y.is_untyped:
+                mismatch = untyped.match(x.constant.kind, y.constant.kind) is None
+            elif x.is_untyped or y.is_untyped:
+                const, other = (x, y) if x.is_untyped else (y, x)
+                mismatch = not isinstance(other.type_, syntree.TypeParam) and not untyped.compatible(
+                    const.constant.kind, constant_kind(other.type_))
+            else:
+                mismatch = not identical(x.type_, y.type_)
+            if mismatch:
+                self.error(
+                    f"invalid argument: mismatched types {self.typename_of(x)} (previous "
+                    f"argument) and {self.typename_of(y)} (type of {expr_string(y.expr)})", y.expr
+                )
+                return Operand("invalid", node)
+            text = expr_string(node)
+            if x.is_untyped and not y.is_untyped:
+                x = self.implicit(x, y, text, left=True)
+            elif y.is_untyped and not x.is_untyped:
+                y = self.implicit(y, x, text, left=False)
+            if x.mode == "invalid" or y.mode == "invalid":
+                return Operand("invalid", node)
+
+            if x.mode == "constant" and y.mode == "constant":
+                const = constant.builtin(name, [x.constant, y.constant])
+                type_ = x.type_ if not const.is_untyped else self.default_type(const)
+                x = Operand("constant", node, type_, const)
+            else:
+                x = Operand("value", node, x.type_)
+        if x.mode != "constant":
+            return Operand("value", node, x.type_)
+        if x.is_untyped:
+            # the untyped arguments are of the kind of the result, like 1 in min(1, 2.5)
+            for y in values:
+                if y.is_untyped and y.constant.kind != x.constant.kind:
+                    kind = x.constant.kind
+                    const = constant.Constant(
+                        kind, untyped.to_kind(y.constant.kind, y.constant.value, kind))
+                    self.record(Operand("constant", y.expr, x.type_, const))
+        return Operand("constant", node, x.type_, x.constant)
+
+    def complex_(self, values: List[Operand], node) -> Operand:
+        """complex(x, y), of floats of the same type"""
+        x, y = values
+        text = expr_string(node)
+        if x.type_ is None or y.type_ is None:
+            return Operand("value", node)
+        # an untyped argument is converted to the type of the other one
+        if x.is_untyped and not y.is_untyped:
+            x = self.implicit(x, y, text, left=True)
+        elif y.is_untyped and not x.is_untyped:
+            y = self.implicit(y, x, text, left=False)
+        if x.mode == "invalid" or y.mode == "invalid":
+            return Operand("invalid", node)
+
+        if x.is_untyped and y.is_untyped:
+            for z in (x, y):
+                if not untyped.is_numeric(z.constant.kind):
+                    self.error(
+                        f"invalid argument: arguments have type {self.typename_of(z)}, "
+                        f"expected floating-point", z.expr
+                    )
+                    return Operand("invalid", node)
+            type_ = None
+        elif not identical(x.type_, y.type_):
+            self.error(
+                f"invalid operation: {text} (mismatched types "
+                f"{self.typename_of(x)} and {self.typename_of(y)})", node
+            )
+            return Operand("invalid", node)
+        elif constant_kind(x.type_) != "float":
+            self.error(
+                f"invalid argument: arguments have type {type_string(x.type_)}, "
+                f"expected floating-point", x.expr
+            )
+            return Operand("invalid", node)
+        else:
+            typename = untyped.complex_of_float[basic_typename(x.type_)]
+            type_ = self.universe.lookup(typename).type_
+
+        if x.mode == "constant" and y.mode == "constant":
+            try:
+                const = constant.builtin("complex", [x.constant, y.constant])
+            except constant.ConstError as e:
+                self.error(str(e), node)
+                return Operand("invalid", node)
+            return Operand("constant", node, type_ or self.default_type(const), const)
+        return Operand("value", node, type_)
+
+    def complex_part(self, name: str, x: Operand, node) -> Operand:
+        """real(x) and imag(x), of a complex number"""
+        if x.type_ is None:
+            return Operand("value", node)
+        if x.is_untyped:
+            if not untyped.is_numeric(x.constant.kind):
+                self.error(
+                    f"invalid argument: argument has type {self.typename_of(x)}, "
+                    f"expected complex type", x.expr
+                )
+                return Operand("invalid", node)
+            type_ = None
+        elif constant_kind(x.type_) != "complex":
+            self.error(
+                f"invalid argument: argument has type {type_string(x.type_)}, "
+                f"expected complex type", x.expr
+            )
+            return Operand("invalid", node)
+        else:
+            typename = untyped.float_of_complex[basic_typename(x.type_)]
+            type_ = self.universe.lookup(typename).type_
+
+        if x.mode == "constant":
+            const = constant.builtin(name, [x.constant])
+            return Operand("constant", node, type_ or self.default_type(const), const)
+        return Operand("value", node, type_)
+
+    def make(self, args: list, node) -> Operand:
+        if not args:
+            self.error(f"not enough arguments for {expr_string(node)}", node)
+            return Operand("invalid", node)
+        t = self.expr(args[0])
+        sizes = [self.single_value(self.expr(arg)) for arg in args[1:]]
+        if t.mode == "invalid":
+            return Operand("invalid", node)
+        if t.mode != "type":
+            self.error(f"{expr_string(args[0])} is not a type", args[0])
+            return Operand("invalid", node)
+
+        if not isinstance(underlying(t.type_), (syntree.Slice, syntree.Map, syntree.Chan)):
+            self.error(
+                f"invalid argument: cannot make {expr_string(args[0])}; "
+                f"type must be slice, map, or channel", args[0]
+            )
+            return Operand("invalid", node)
+        # the length of a slice is required, the size of a map
+        # and the buffer size of a channel are not
+        counts = (1, 2) if isinstance(underlying(t.type_), syntree.Slice) else (0, 1)
+        if len(sizes) not in counts:
+            self.error(
+                f"invalid operation: {expr_string(node)} expects {counts[0] + 1} or "
+                f"{counts[1] + 1} arguments; found {len(args)}", node
+            )
+            return Operand("invalid", node)
+
+        sizes = [self.check_index(size) for size in sizes]
+        if (len(sizes) == 2 and all(size.mode == "constant" for size in sizes)
+                and sizes[0].constant.value > sizes[1].constant.value):
+            self.error("invalid argument: length and capacity swapped", sizes[0].expr)
+        return Operand("value", node, t.type_)
+
+    def new(self, args: list, node) -> Operand:
+        if len(args) != 1:
+            problem = "not enough" if not args else "too many"
+            self.error(f"{problem} arguments for {expr_string(node)}", node)
+            return Operand("invalid", node)
+        t = self.expr(args[0])
+        if t.mode == "invalid":
+            return Operand("invalid", node)
+        if t.mode != "type":
+            self.error(f"{expr_string(args[0])} is not a type", args[0])
+            return Operand("invalid", node)
+        return Operand("value", node, syntree.Pointer(t.type_))
+
+    def conversion(self, type_: syntree.Type, args: list, node) -> Operand:
+        if len(args) != 1:
+            problem = "missing argument" if not args else "too many arguments"
+            self.error(f"{problem} in conversion to {type_string(type_)}", node)
+            return Operand("invalid", node)
+        x = self.single_value(self.expr(args[0]))
+        if x.mode == "constant" and constant_kind(type_) is not None:
+            kind = constant_kind(type_)
+            if not (untyped.compatible(x.constant.kind, kind)
+                    or kind == "string" and untyped.is_integer(x.constant.kind)):
+                self.error(
+                    f"cannot convert {describe(x)} to type {type_string(type_)}", x.expr
+                )
+                return Operand("invalid", node)
+            try:
+                const = constant.conversion(x.constant, basic_typename(type_))
+            except constant.ConstError as e:
+                # only an integer can overflow, other values can't be converted
+                if untyped.is_integer(x.constant.kind) and kind == "int":
+                    self.error(str(e), x.expr)
+                else:
+                    self.error(
+                        f"cannot convert {describe(x)} to type {type_string(type_)}", x.expr
+                    )
+                return Operand("invalid", node)
+            return Operand("constant", node, type_, const)
+        if x.mode != "invalid" and not self.convertible(x, type_):
+            self.error(f"cannot convert {describe(x)} to type {type_string(type_)}", x.expr)
+            return Operand("invalid", node)
+        return Operand("value", node, type_)
+
+    def convertible(self, x: Operand, type_: syntree.Type) -> bool:
+        """If the non-constant value x can be converted to type_
+        Ref: https://golang.org/ref/spec#Conversions"""
+        if x.mode == "nil":
+            return nillable(type_)
+        v = x.type_
+        if v is None or identical(v, type_):
+            return True
+        # a type parameter converts if every type in its type set does
+        for param, other in ((v, type_), (type_, v)):
+            if isinstance(param, syntree.TypeParam):
+                terms = type_terms(param)
+                if not terms:
+                    return False
+                return all(
+                    self.convertible(Operand("value", x.expr, t), type_) if param is v
+                    else self.convertible(x, t)
+                    for _, t in terms
+                )
+
+        vu, tu = underlying(v), underlying(type_)
+        if identical(vu, tu):
+            # between types with the same underlying type, like Celsius and float64
+            return True
+        if (isinstance(v, syntree.Pointer) and isinstance(type_, syntree.Pointer)
+                and identical(underlying(v.base), underlying(type_.base))):
+            return True
+        if syntree.is_interface(type_):
+            return self.missing_method(v, type_) is None
+        if isinstance(vu, syntree.Chan) and isinstance(tu, syntree.Chan):
+            return vu.dir == "both" and identical(vu.eltype, tu.eltype)
+
+        v_kind, t_kind = constant_kind(v), constant_kind(type_)
+        if v_kind in ("int", "float") and t_kind in ("int", "float"):
+            return True
+        if v_kind == "complex" and t_kind == "complex":
+            return True
+        if t_kind == "string" and (v_kind == "int" or is_bytes_or_runes(v)):
+            return True
+        if v_kind == "string" and is_bytes_or_runes(type_):
+            return True
+        if isinstance(vu, syntree.Slice):
+            # to an array, or a pointer to an array, of its elements
+            array = underlying(tu.base) if isinstance(tu, syntree.Pointer) else tu
+            return isinstance(array, syntree.Array) and identical(vu.eltype, array.eltype)
+        return False
+
+    def binary(self, operator: str, x: Operand, y: Operand, text: str, node) -> Operand:
+        if x.mode == "invalid" or y.mode == "invalid":
+            return Operand("invalid", node)
+        if x.mode == "nil" or y.mode == "nil":
+            return self.nil_comparison(operator, x, y, text, node)
+        if x.type_ is None or y.type_ is None:
+            # operands of unknown type (from packages)
+            return Operand("value", node, x.type_ or y.type_)
+
+        if operator in ("<<", ">>"):
+            return self.shift(operator, x, y, text, node)
+
+        # an untyped operand is converted to the type of the other one
+        if x.is_untyped and not y.is_untyped:
+            x = self.implicit(x, y, text, left=True)
+        elif y.is_untyped and not x.is_untyped:
+            y = self.implicit(y, x, text, left=False)
+        if x.mode == "invalid" or y.mode == "invalid":
+            return Operand("invalid", node)
+
+        both_untyped = x.is_untyped and y.is_untyped
+        if both_untyped:
+            mismatch = untyped.match(x.constant.kind, y.constant.kind) is None
+        else:
+            mismatch = not identical(x.type_, y.type_)
+        if mismatch:
+            self.error(
+                f"invalid operation: {text} (mismatched types "
+                f"{self.typename_of(x)} and {self.typename_of(y)})", node
+            )
+            return Operand("invalid", node)
+
+        u = underlying(x.type_) if x.type_ is not None else None
+        if operator in ("==", "!=") and isinstance(u, (syntree.Slice, syntree.Map,
+                                                       syntree.FunctionType)):
+            kind = {syntree.Slice: "slice", syntree.Map: "map"}.get(type(u), "func")
+            self.error(f"invalid operation: {text} ({kind} can only be compared to nil)", node)
+            return Operand("invalid", node)
+
+        if not self.operator_defined(operator, x):
+            self.error(
+                f"invalid operation: operator {operator} not defined on {describe(x)}", node
+            )
+            return Operand("invalid", node)
+
+        # a float variable divided by zero is an infinity (or NaN), not an error
+        if (operator in ("/", "%") and y.mode == "constant" and y.constant.value in (0, (0, 0))
+                and (x.mode == "constant" or is_integer(x.type_))):
+            self.error("invalid operation: division by zero", y.expr)
+            return Operand("invalid", node)
+
+        if operator in syntree.BinOp.rel_ops:
+            type_ = self.universe.lookup("bool").type_
+        else:
+            type_ = x.type_
+
+        if x.mode == "constant" and y.mode == "constant":
+            try:
+                const = constant.binary_op(operator, x.constant, y.constant)
+            except constant.ConstError as e:
+                self.error(str(e), node)
+                return Operand("invalid", node)
+            if const.is_untyped:
+                type_ = self.default_type(const)
+            return Operand("constant", node, type_, const)
+        return Operand("value", node, type_)
+
+    def nil_comparison(self, operator: str, x: Operand, y: Operand, text: str, node) -> Operand:
+        """Comparison of a pointer, slice, map, function or interface with nil,
+        no other operation is defined on nil"""
+        other = y if x.mode == "nil" else x
+        if operator not in ("==", "!="):
+            self.error(f"invalid operation: operator {operator} not defined on nil", node)
+            return Operand("invalid", node)
+        if other.mode == "nil":
+            self.error(f"invalid operation: {text} (operator {operator} not defined on nil)", node)
+            return Operand("invalid", node)
+        if other.type_ is not None and not nillable(other.type_):
+            self.error(
+                f"invalid operation: {text} (mismatched types "
+                f"{self.typename_of(other)} and untyped nil)", node
+            )
+            return Operand("invalid", node)
+        return Operand("value", node, self.universe.lookup("bool").type_)
+
+    def typename_of(self, x: Operand) -> str:
+        if x.is_untyped:
+            return f"untyped {x.constant.kind}"
+        return type_string(x.type_)
+
+    def implicit(self, x: Operand, target: Operand, text: str, left: bool) -> Operand:
+        """Converts the untyped constant x to the type of target, the other
+        operand. left tells if x is the left operand"""
+        if isinstance(target.type_, syntree.TypeParam):
+            terms = type_terms(target.type_)
+            if terms is None or not all(self.representable(x.constant, t) for _, t in terms):
+                self.error(
+                    f"cannot convert {describe(x)} to type {type_string(target.type_)}",
+                    x.expr
+                )
+                return Operand("invalid", x.expr)
+            return Operand("value", x.expr, target.type_)
+        if not untyped.compatible(x.constant.kind, constant_kind(target.type_)):
+            types = [self.typename_of(x), self.typename_of(target)]
+            if not left:
+                types.reverse()
+            self.error(
+                f"invalid operation: {text} (mismatched types {types[0]} and {types[1]})",
+                x.expr
+            )
+            return Operand("invalid", x.expr)
+        try:
+            const = constant.convert(x.constant, basic_typename(target.type_))
+        except constant.ConstError as e:
+            self.error(str(e), x.expr)
+            return Operand("invalid", x.expr)
+        return self.record(Operand("constant", x.expr, target.type_, const))
+
+    def operator_defined(self, operator: str, x: Operand) -> bool:
+        kind = x.constant.kind if x.is_untyped else constant_kind(x.type_)
+        if operator in ("==", "!="):
+            return comparable(x.type_)
+        if isinstance(x.type_, syntree.TypeParam):
+            # the operator has to be defined on every type in its type set
+            terms = type_terms(x.type_)
+            return terms is not None and all(
+                self.operator_defined(operator, Operand("value", type_=t)) for _, t in terms
+            )
+        elif operator in ("<", "<=", ">", ">="):
+            # complex numbers are not ordered
+            return kind == "string" or (untyped.is_numeric(kind) and kind != "complex")
+        elif operator == "+":
+            return kind == "string" or untyped.is_numeric(kind)
+        elif operator in ("-", "*", "/"):
+            return untyped.is_numeric(kind)
+        elif operator in ("%", "&", "|", "^", "&^"):
+            return untyped.is_integer(kind)
+        elif operator in ("&&", "||"):
+            return kind == "bool"
+        return False
+
+    def shift(self, operator: str, x: Operand, y: Operand, text: str, node) -> Operand:
+        count_text = describe(y)
+        if y.mode == "constant" and untyped.is_numeric(y.constant.kind):
+            count = untyped.to_integer(y.constant.kind, y.constant.value)
+            if count is not None and count < 0:
+                self.error(f"invalid operation: negative shift count {describe(y)}", y.expr)
+                return Operand("invalid", node)
+        if y.is_untyped:
+            try:
+                count = constant.convert(y.constant, "uint")
+            except constant.ConstError:
+                self.error(
+                    f"invalid operation: shift count {describe(y)} must be integer", y.expr
+                )
+                return Operand("invalid", node)
+            y = Operand("constant", y.expr, y.type_, count)
+        elif not is_integer(y.type_):
+            self.error(f"invalid operation: shift count {describe(y)} must be integer", y.expr)
+            return Operand("invalid", node)
+
+        if x.is_untyped:
+            if x.constant.kind in ("float", "complex"):
+                # shifted as an untyped int if the value is a whole number
+                value = untyped.to_integer(x.constant.kind, x.constant.value)
+                if value is not None:
+                    const = constant.Constant("int", value)
+                    x = Operand("constant", x.expr, self.default_type(const), const)
+            if y.mode != "constant":
+                # the untyped constant becomes an int in a non-constant shift
+                x = self.default(x)
+        if x.mode == "invalid":
+            return Operand("invalid", node)
+
+        kind = x.constant.kind if x.is_untyped else constant_kind(x.type_)
+        if not untyped.is_integer(kind):
+            self.error(f"invalid operation: shifted operand {describe(x)} must be integer", node)
+            return Operand("invalid", node)
+
+        if x.mode == "constant" and y.mode == "constant":
+            if y.constant.value > constant.max_shift:
+                self.error(f"invalid operation: invalid shift count {count_text}", y.expr)
+                return Operand("invalid", node)
+            try:
+                const = constant.binary_op(operator, x.constant, y.constant)
+            except constant.ConstError as e:
+                self.error(str(e), node)
+                return Operand("invalid", node)
+            return Operand("constant", node, x.type_, const)
+        return Operand("value", node, x.type_)
+
+    def unary(self, node: syntree.UnaryOp) -> Operand:
+        x = self.expr(node.operand)
+        if node.operator == "*" and x.mode == "type":
+            # a pointer type, like the (*T) of a conversion (*T)(p)
+            return Operand("type", node, syntree.Pointer(x.type_))
+        x = self.single_value(x)
+        if x.mode == "invalid":
+            return x
+        if node.operator == "&":
+            return self.address(x, node)
+        elif node.operator == "*":
+            return self.indirect(x, node)
+        elif node.operator == "<-":
+            self.call_or_receive = True
+            return self.receive(x, node)
+        if x.type_ is None:
+            return Operand("value", node)
+
+        kind = x.constant.kind if x.is_untyped else constant_kind(x.type_)
+        defined = {
+            "+": untyped.is_numeric(kind),
+            "-": untyped.is_numeric(kind),
+            "!": kind == "bool",
+            "^": untyped.is_integer(kind),
+        }.get(node.operator, False)
+        if not defined:
+            self.error(
+                f"invalid operation: operator {node.operator} not defined on {describe(x)}",
+                node
+            )
+            return Operand("invalid", node)
+
+        if x.mode == "constant":
+            try:
+                const = constant.unary_op(node.operator, x.constant)
+            except constant.ConstError as e:
+                self.error(str(e), node)
+                return Operand("invalid", node)
+            return Operand("constant", node, x.type_, const)
+        return Operand("value", node, x.type_)
+
+
+    def address(self, x: Operand, node: syntree.UnaryOp) -> Operand:
+        """&x, of an addressable operand or of a composite literal"""
+        literal = isinstance(node.operand, syntree.Literal) and isinstance(
+            node.operand.value, syntree.LiteralValue)
+        if x.mode != "variable" and not literal:
+            self.error(f"invalid operation: cannot take address of {describe(x)}", node)
+            return Operand("invalid", node)
+        if x.type_ is None:
+            return Operand("value", node)
+        return Operand("value", node, syntree.Pointer(x.type_))
+
+    def indirect(self, x: Operand, node: syntree.UnaryOp) -> Operand:
+        """*x, the variable pointed to by x"""
+        if x.type_ is None and x.mode != "nil":
+            return Operand("variable", node)
+        t = underlying(x.type_) if x.type_ is not None else None
+        if not isinstance(t, syntree.Pointer):
+            self.error(f"invalid operation: cannot indirect {describe(x)}", node)
+            return Operand("invalid", node)
+        return Operand("variable", node, t.base)
+
+    def receive(self, x: Operand, node: syntree.UnaryOp) -> Operand:
+        """<-x, a value received from the channel x, along with
+        whether the channel is still open for v, ok := <-x"""
+        if x.type_ is not None:
+            t = underlying(x.type_)
+            if not isinstance(t, syntree.Chan):
+                self.error(
+                    f"invalid operation: cannot receive from non-channel {describe(x)}", node
+                )
+                return Operand("invalid", node)
+            if t.dir == "send":
+                self.error(
+                    "invalid operation: cannot receive from send-only channel "
+                    f"{describe(x)}", node
+                )
+                return Operand("invalid", node)
+        x = Operand("value", node, t.eltype if x.type_ is not None else None)
+        x.comma_ok = True
+        return x
+
+
+# the builtin functions of Go which aren't in the universe yet, see unsupported
+unsupported_builtins = ("clear", "print", "println")
+
+
+def universe() -> Scope:
+    """Scope of the predeclared identifiers"""
+    scope = Scope(kind="universe")
+    for typename, storage in predefined_identifiers.items():
+        if typename != "unknown":
+            scope.insert(Object(typename, "type", syntree.Type("BasicType", typename, storage)))
+
+    scope.insert(Object("any", "type", syntree.Interface([], alias="any")))
+    scope.insert(Object("error", "type", syntree.error_type()))
+
+    # the value of iota depends on the ConstSpec using it
+    scope.insert(Object("iota", "const", scope.lookup("int").type_))
+    for name in syntree.builtins:
+        scope.insert(Object(name, "builtin"))
+    scope.insert(Object("nil", "nil"))
+    return scope
+
+
+def check(ast: syntree.Node) -> List[Diagnostic]:
+    """Type checks the AST of a package which doesn't import others
+
+    Returns the errors found, in the order they were found"""
+    return check_package(ast, {})[0]
+
+
+def check_package(ast: syntree.Node, imports: Dict[str, Tuple[str, Scope]],
+                  info: Optional[Info] = None, warnings: bool = False,
+                  ctx: Optional[cancel.Context] = None) -> Tuple[List[Diagnostic], Scope]:
+    """Type checks the AST of a package, imports are the names and the package
+    scopes of the packages it imports, by import path (they are checked first).
+    What is found about its expressions is added to info, if given. The
+    shadowed and unused declarations are reported too if warnings. Raises
+    the error of ctx (see cancel.py) if it is done before the end
+
+    Returns the errors found, in the order they were found, and the package scope"""
+    checker = Checker(imports, info, warnings, ctx)
+    checker.check_package(ast)
+    return checker.diagnostics, checker.scope
+
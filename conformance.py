@@ -0,0 +1,333 @@
+import io
+import os
+import bisect
+import re
+import sys
+import json
+import shutil
+import argparse
+import tempfile
+import contextlib
+import subprocess
+
+from dataclasses import dataclass
+from fractions import Fraction
+from typing import Dict, List, Optional, Tuple
+
+
+# The conformance harness checks programs with the type checker of gopy and
+# with go/types (gotypes/main.go, built with the go command), and reports
+# where they diverge: the expressions (matched by their spans) whose types,
+# modes or constant values differ, and the lines where only one of them
+# finds errors. gopy runs in a subprocess for each program (python
+# conformance.py --facts path), so the state of the parser is fresh.
+#
+#   python conformance.py tests tests/packages
+
+here = os.path.dirname(os.path.abspath(__file__))
+# the kinds of divergences, see Divergence
+kinds = ["type", "mode", "value", "missed", "extra"]
+
+
+@dataclass
+class Divergence:
+    """A difference between gopy and go/types, what is either of
+    them is None when only the other one found something"""
+
+    file: str
+    line: int
+    column: Optional[int]
+    # type, mode, value, missed (an error gopy doesn't report) or extra
+    kind: str
+    gopy: Optional[str]
+    go: Optional[str]
+    # the source of the expression, or the message of the error
+    text: str = ""
+
+    def __str__(self) -> str:
+        location = f"{self.file}:{self.line}"
+        if self.column is not None:
+            location += f":{self.column}"
+        if self.kind == "missed":
+            return f"{location}: missed error: {self.go}"
+        elif self.kind == "extra":
+            return f"{location}: extra error: {self.gopy}"
+        return f"{location}: {self.kind} of {self.text}: gopy {self.gopy}, go/types {self.go}"
+
+
+class Source:
+    """The lines of a file, to turn the byte offsets of go/types into the
+    (line, column) of gopy, whose columns count the characters"""
+
+    def __init__(self, filename: str):
+        with open(filename, "rb") as f:
+            self.data = f.read()
+        self.starts = [0] + [m.end() for m in re.finditer(b"\n", self.data)]
+
+    def position(self, offset: int) -> Tuple[int, int]:
+        line = bisect.bisect_right(self.starts, offset)
+        start = self.starts[line - 1]
+        return line, len(self.data[start:offset].decode("utf-8", "replace")) + 1
+
+    def text(self, start: Tuple[int, int], end: Tuple[int, int]) -> str:
+        """The source of a span, up to the end of its first line"""
+        line = self.data[self.starts[start[0] - 1]:].split(b"\n")[0].decode("utf-8", "replace")
+        text = line[start[1] - 1:end[1] - 1 if end[0] == start[0] else None].rstrip()
+        return text if len(text) <= 40 else text[:37] + "..."
+
+
+def constant_value(c) -> str:
+    """The value of a constant.Constant in the form of gotypes"""
+    if c.kind == "bool":
+        return "true" if c.value else "false"
+    elif c.kind == "string":
+        return c.value.hex()
+    elif c.kind == "complex":
+        return f"({fraction(c.value[0])}, {fraction(c.value[1])})"
+    return fraction(c.value)
+
+
+def fraction(value) -> str:
+    value = Fraction(value)
+    if value.denominator == 1:
+        return str(value.numerator)
+    return f"{value.numerator}/{value.denominator}"
+
+
+def gopy_facts(path: str) -> dict:
+    """The types and the values of the expressions of the program in path
+    found by the type checker of gopy, and the errors reported"""
+    import checker
+    import diagnostics
+    import go_parser
+    import syntree
+    from fileset import fset
+
+    diagnostics.printing = False
+    info = checker.Info()
+    with contextlib.redirect_stdout(io.StringIO()):
+        go_parser.check_program(path, verbose=False, info=info)
+
+    # the spans of the expressions, the steps of a PrimaryExpr (like the
+    # [i] of a[i]) start at the start of the whole expression
+    spans = {}
+    for node in info.operands:
+        if getattr(node, "pos", None):
+            spans.setdefault(id(node), (node.pos, node.end))
+        if isinstance(node, syntree.PrimaryExpr) and node.pos:
+            for child in node.children:
+                if getattr(child, "end", None):
+                    spans[id(child)] = (node.pos, child.end)
+
+    exprs = []
+    for node, x in info.operands.items():
+        if id(node) not in spans or x.mode in ("invalid", "package"):
+            continue
+        pos, end = spans[id(node)]
+        file = fset.file(pos)
+        if file is None:
+            continue
+        start, stop = file.position(pos), file.position(end)
+        mode = x.mode if x.mode in ("constant", "type", "builtin", "novalue", "nil") else "value"
+        if x.mode == "nil":
+            type_ = "untyped nil"
+        elif x.mode == "constant" and x.constant.is_untyped:
+            type_ = f"untyped {x.constant.kind}"
+        elif x.mode == "tuple":
+            type_ = "(" + ", ".join(checker.type_string(t) for t in x.tuple_types) + ")"
+        else:
+            type_ = checker.type_string(x.type_) if x.type_ is not None else None
+        value = constant_value(x.constant) if x.mode == "constant" and x.constant else None
+        exprs.append({"file": file.name, "start": [start.line, start.column],
+                      "end": [stop.line, stop.column], "mode": mode, "type": type_,
+                      "value": value})
+
+    errors = [
+        {"file": d.file, "line": d.lineno, "column": d.col_num, "message": d.message}
+        for d in diagnostics.reported if d.severity == "error" and d.lineno is not None
+    ]
+    return {"exprs": exprs, "errors": errors}
+
+
+def programs(paths: List[str]) -> List[str]:
+    """The programs of the paths: a .go file, a directory whose files are
+    of one package (its subdirectories are the packages it imports), or
+    the files and the directories of a directory of programs (like tests)"""
+    found = []
+    for path in paths:
+        if not os.path.isdir(path):
+            found.append(path)
+            continue
+        files = sorted(f for f in os.listdir(path)
+                       if f.endswith(".go") and not f.endswith("_test.go"))
+        if files and len({package_name(os.path.join(path, f)) for f in files}) == 1:
+            found.append(path)
+            continue
+        for entry in sorted(os.listdir(path)):
+            full = os.path.join(path, entry)
+            if entry in files or os.path.isdir(full) and any(
+                    f.endswith(".go") for f in os.listdir(full)):
+                found.append(full)
+    return found
+
+
+def package_name(filename: str) -> Optional[str]:
+    with open(filename, "rt", errors="replace") as f:
+        match = re.search(r"^package\s+(\w+)", f.read(), re.MULTILINE)
+    return match and match.group(1)
+
+
+def compare(gopy: dict, go: dict) -> Tuple[List[Divergence], int]:
+    """The divergences between the facts of gopy and of go/types about a
+    program, and the number of expressions found by both"""
+    sources: Dict[str, Source] = {}
+
+    def source(filename: str) -> Source:
+        filename = os.path.abspath(filename)
+        if filename not in sources:
+            sources[filename] = Source(filename)
+        return sources[filename]
+
+    # the expressions of go/types by span, a few have the span of another
+    # one, like the implicit 1 of i++
+    go_exprs: Dict[tuple, list] = {}
+    for e in go["exprs"]:
+        src = source(e["file"])
+        key = (os.path.abspath(e["file"]), src.position(e["pos"]), src.position(e["end"]))
+        go_exprs.setdefault(key, []).append(e)
+
+    found = []
+    compared = 0
+    for e in gopy["exprs"]:
+        key = (os.path.abspath(e["file"]), tuple(e["start"]), tuple(e["end"]))
+        if key not in go_exprs:
+            continue
+        others = go_exprs[key]
+        other = next((o for o in others if o["mode"] == e["mode"]), others[0])
+        compared += 1
+        text = source(e["file"]).text(key[1], key[2])
+
+        def diverge(kind: str, mine, theirs):
+            found.append(Divergence(e["file"], key[1][0], key[1][1], kind, mine, theirs, text))
+
+        if e["mode"] != other["mode"]:
+            diverge("mode", e["mode"], other["mode"])
+        elif e["mode"] == "constant" and e["value"] is not None \
+                and e["value"] != other.get("value"):
+            diverge("value", e["value"], other.get("value"))
+        if e["type"] is not None and e["mode"] != "builtin" \
+                and not same_type(e["type"], other["type"]):
+            diverge("type", e["type"], other["type"])
+
+    # the errors are matched by line, the columns and the messages differ
+    go_lines = {}
+    for e in go["errors"]:
+        line, column = source(e["file"]).position(e["offset"])
+        go_lines.setdefault((os.path.abspath(e["file"]), line), (column, e["message"]))
+    gopy_lines = {}
+    for e in gopy["errors"]:
+        if e["file"] and os.path.exists(e["file"]):
+            gopy_lines.setdefault((os.path.abspath(e["file"]), e["line"]),
+                                  (e["column"], e["message"]))
+    for (file, line), (column, message) in go_lines.items():
+        if (file, line) not in gopy_lines:
+            found.append(Divergence(os.path.relpath(file), line, column, "missed", None, message))
+    for (file, line), (column, message) in gopy_lines.items():
+        if (file, line) not in go_lines:
+            found.append(Divergence(os.path.relpath(file), line, column, "extra", message, None))
+
+    found.sort(key=lambda d: (d.file, d.line, d.column or 0))
+    return found, compared
+
+
+def same_type(mine: str, theirs: str) -> bool:
+    """If gopy writes the type of go/types the same, any is written
+    interface{} by go/types, and the type of a comma-ok expression used
+    with two variables (like v, ok := m[k]) is (T, bool)"""
+    mine, theirs = mine.replace("interface{}", "any"), theirs.replace("interface{}", "any")
+    return mine == theirs or theirs == f"({mine}, bool)"
+
+
+def build_gotypes(go: str, dir: str) -> str:
+    binary = os.path.join(dir, "gotypes")
+    subprocess.run([go, "build", "-o", binary, os.path.join(here, "gotypes", "main.go")],
+                   check=True)
+    return binary
+
+
+def run(program: str, gotypes: str) -> Tuple[Optional[dict], Optional[dict], str]:
+    """The facts of gopy and of go/types about the program, the
+    message of the failure if either one fails"""
+    try:
+        mine = subprocess.run([sys.executable, os.path.join(here, "conformance.py"),
+                               "--facts", program], capture_output=True, text=True, timeout=120)
+        theirs = subprocess.run([gotypes, program], capture_output=True, text=True, timeout=120)
+    except subprocess.TimeoutExpired as e:
+        return None, None, f"timed out: {' '.join(e.cmd)}"
+    if mine.returncode != 0:
+        return None, None, "gopy failed: " + (mine.stderr.strip().splitlines() or ["?"])[-1]
+    if theirs.returncode != 0:
+        return None, None, "gotypes failed: " + theirs.stderr.strip()
+    return json.loads(mine.stdout), json.loads(theirs.stdout), ""
+
+
+def main(argv: List[str]):
+    arg_parser = argparse.ArgumentParser(
+        prog="conformance.py",
+        description="Compares the type checker of gopy with go/types")
+    arg_parser.add_argument("paths", nargs="*", default=["tests"],
+                            help="programs (.go files or directories), or directories of programs")
+    arg_parser.add_argument("--go", default=shutil.which("go") or "/usr/local/go/bin/go",
+                            help="the go command, gotypes/main.go is built with it")
+    arg_parser.add_argument("--kinds", default=",".join(kinds),
+                            help="the kinds of divergences reported, separated by commas "
+                                 f"(like value,missed), of {', '.join(kinds)}")
+    arg_parser.add_argument("--json", action="store_true",
+                            help="prints the divergences as a JSON array")
+    arg_parser.add_argument("--facts", metavar="PATH",
+                            help="only prints what gopy finds about the program, as JSON")
+    args = arg_parser.parse_args(argv)
+
+    if args.facts is not None:
+        json.dump(gopy_facts(args.facts), sys.stdout)
+        return 0
+    if not os.path.exists(args.go):
+        print(f"conformance.py: {args.go} not found, go/types is needed (see --go)",
+              file=sys.stderr)
+        return 2
+
+    divergences: List[Divergence] = []
+    compared = 0
+    failed = 0
+    with tempfile.TemporaryDirectory() as dir:
+        try:
+            gotypes = build_gotypes(args.go, dir)
+        except subprocess.CalledProcessError:
+            print("conformance.py: gotypes/main.go doesn't build", file=sys.stderr)
+            return 2
+        for program in programs(args.paths):
+            mine, theirs, failure = run(program, gotypes)
+            if failure:
+                print(f"{program}: {failure}", file=sys.stderr)
+                failed += 1
+                continue
+            found, count = compare(mine, theirs)
+            found = [d for d in found if d.kind in args.kinds.split(",")]
+            divergences.extend(found)
+            compared += count
+            if not args.json:
+                for d in found:
+                    print(d)
+
+    if args.json:
+        print(json.dumps([d.__dict__ for d in divergences], indent=2))
+    else:
+        counts = ", ".join(f"{sum(d.kind == k for d in divergences)} {k}"
+                           for k in kinds if k in args.kinds.split(","))
+        print(f"{compared} expressions compared, divergences: {counts}"
+              + (f" ({failed} programs failed)" if failed else ""))
+    return 1 if divergences or failed else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
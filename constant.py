@@ -0,0 +1,566 @@
+import sys
+import math
+import untyped
+
+from fractions import Fraction
+from typing import Any, Optional, Union
+
+
+# Values of constants are kept exact: python ints are already arbitrary
+# precision and Fraction does the job of big.Rat for floats. An untyped
+# constant is converted (truncated/rounded) only when it is used in a
+# typed context, like a typed const declaration, following the rules
+# in untyped.py.
+# Ref: https://golang.org/ref/spec#Constants
+
+# the exact values can have more digits than python converts between ints
+# and strings by default (the lexer limits the length of literals instead)
+if hasattr(sys, "set_int_max_str_digits"):
+    sys.set_int_max_str_digits(0)
+
+
+class ConstError(Exception):
+    """Raised when a constant expression cannot be evaluated"""
+
+
+# escape sequences of string and rune literals, other than the
+# ones of bytes (\x and octal) and of unicode characters
+# Ref: https://golang.org/ref/spec#Rune_literals
+escapes = {
+    "a": "\a", "b": "\b", "f": "\f", "n": "\n", "r": "\r", "t": "\t", "v": "\v",
+    "\\": "\\",
+}
+
+
+def _characters(body: str, quote: str):
+    """The characters of the body of an interpreted string or rune literal,
+    as (value, is_byte) for each character or escape sequence. \\x and octal
+    escapes are bytes, the others are code points
+
+    Raises ConstError for invalid escape sequences"""
+    i = 0
+    while i < len(body):
+        c = body[i]
+        if c != "\\":
+            yield ord(c), False
+            i += 1
+            continue
+        e = body[i + 1:i + 2]
+        if e in escapes or e == quote:
+            yield ord(escapes.get(e, e)), False
+            i += 2
+            continue
+
+        # escapes with digits, like \x7f, \377 or \u00e9
+        base, count, is_byte = {
+            "x": (16, 2, True), "u": (16, 4, False), "U": (16, 8, False),
+        }.get(e, (8, 3, True))
+        if not e or base == 8 and e not in "01234567":
+            raise ConstError("unknown escape sequence")
+        start = i + 1 if base == 8 else i + 2
+        digits = body[start:start + count]
+        valid = "01234567" if base == 8 else "0123456789abcdefABCDEF"
+        if len(digits) < count or any(d not in valid for d in digits):
+            raise ConstError("invalid character in escape sequence")
+        value = int(digits, base)
+        if base == 8 and value > 255:
+            raise ConstError("octal escape value > 255")
+        if not is_byte and (value > 0x10FFFF or 0xD800 <= value <= 0xDFFF):
+            raise ConstError("escape sequence is invalid Unicode code point")
+        yield value, is_byte
+        i = start + count
+
+
+def unquote(text: str) -> bytes:
+    """Value of a string literal (with its quotes), in UTF-8 like the
+    source, raw strings (in backquotes) have no escape sequences
+
+    Raises ConstError for invalid escape sequences"""
+    if text.startswith("`"):
+        # carriage returns are discarded from raw strings
+        return text[1:-1].replace("\r", "").encode("utf-8")
+    value = bytearray()
+    for c, is_byte in _characters(text[1:-1], '"'):
+        if is_byte:
+            value.append(c)
+        else:
+            value += chr(c).encode("utf-8")
+    return bytes(value)
+
+
+def unquote_rune(text: str) -> int:
+    """Value of a rune literal (with its quotes), the code point
+
+    Raises ConstError if it is not a single (valid) character"""
+    characters = list(_characters(text[1:-1], "'"))
+    if not characters:
+        raise ConstError("empty rune literal or unescaped ' in rune literal")
+    if len(characters) > 1:
+        raise ConstError("more than one character in rune literal")
+    return characters[0][0]
+
+
+def quote(value: bytes) -> str:
+    """The interpreted string literal of value, in the form used by
+    the rest of the compiler (like Literal nodes), with escapes for the
+    characters which are not printable and the bytes which are not UTF-8"""
+    text = ['"']
+    # invalid bytes are decoded to the surrogates U+DC80 to U+DCFF
+    for c in value.decode("utf-8", "surrogateescape"):
+        code = ord(c)
+        if 0xDC80 <= code <= 0xDCFF:
+            text.append(f"\\x{code - 0xDC00:02x}")
+        elif c in '"\\':
+            text.append("\\" + c)
+        elif c.isprintable():
+            text.append(c)
+        elif c in escapes.values():
+            text.append("\\" + next(e for e, v in escapes.items() if v == c))
+        elif code < 0x80:
+            text.append(f"\\x{code:02x}")
+        elif code < 0x10000:
+            text.append(f"\\u{code:04x}")
+        else:
+            text.append(f"\\U{code:08x}")
+    text.append('"')
+    return "".join(text)
+
+
+class Constant:
+    """A constant value along with its kind
+
+    typename is None for untyped constants"""
+
+    def __init__(self, kind: str, value: Any, typename: Optional[str] = None):
+        # one of untyped.kinds, even for typed constants
+        self.kind = kind
+        self.value = value
+        self.typename = typename
+
+    @property
+    def is_untyped(self) -> bool:
+        return self.typename is None
+
+    def to_python(self) -> Union[int, float, complex, str]:
+        """Value in the form used by the rest of the compiler
+        (same as the values stored in Literal nodes)"""
+        if self.kind == "bool":
+            return "true" if self.value else "false"
+        elif self.kind == "string":
+            return quote(self.value)
+        elif self.kind == "float":
+            return _fraction_to_float(self.value)
+        elif self.kind == "complex":
+            real, imag = self.value
+            return complex(_fraction_to_float(real), _fraction_to_float(imag))
+        return self.value
+
+    def __str__(self):
+        if self.kind == "float":
+            return _format_float(self.value)
+        elif self.kind == "complex":
+            real, imag = self.value
+            return f"({_format_float(real)} + {_format_float(imag)}i)"
+        return str(self.to_python())
+
+    def __repr__(self):
+        return f"<Constant {self.kind} {self}>"
+
+
+def _fraction_to_float(value: Fraction) -> float:
+    try:
+        return float(value)
+    except OverflowError:
+        return float("inf") if value > 0 else float("-inf")
+
+
+def _format_float(value: Fraction) -> str:
+    # whole numbers are shown exactly, like 300 instead of 300.0
+    if value.denominator == 1 and abs(value) < 10 ** 21:
+        return str(value.numerator)
+    try:
+        return repr(float(value))
+    except OverflowError:
+        # too large for a python float, show it in scientific notation (the
+        # digits are counted from the logarithm, str of a huge int is slow)
+        whole = abs(value.numerator) // value.denominator
+        exponent = int(math.log10(whole))
+        if 10 ** exponent > whole:
+            exponent -= 1
+        elif 10 ** (exponent + 1) <= whole:
+            exponent += 1
+        mantissa = float(value / Fraction(10) ** exponent)
+        return f"{mantissa:g}e+{exponent}"
+
+
+def from_literal(lit: Any) -> Constant:
+    """Make an (untyped) constant from a Literal node"""
+    typename = lit.type_
+    if typename == "int":
+        return Constant("int", int(lit.value))
+    elif typename == "float64":
+        exact = getattr(lit, "exact", None)
+        return Constant("float", Fraction(exact if exact is not None else lit.value))
+    elif typename == "string":
+        return Constant("string", unquote(lit.value))
+    elif typename == "rune":
+        return Constant("rune", lit.value)
+    elif typename == "bool":
+        return Constant("bool", lit.value == "true")
+    elif typename == "complex128":
+        # an imaginary literal, like 2.5i
+        exact = getattr(lit, "exact", None)
+        imag = Fraction(exact[:-1]) if exact is not None else Fraction(lit.value.imag)
+        return Constant("complex", (Fraction(0), imag))
+
+    raise ConstError(f"{lit.value} is not a valid constant")
+
+
+def _match_kinds(x: Constant, y: Constant, operator: str):
+    """Convert x and y to the kind of the operation on them"""
+    kind = untyped.match(x.kind, y.kind)
+    if kind is None:
+        raise ConstError(
+            f"invalid operation: mismatched constants {x} ({x.kind}) "
+            f"{operator} {y} ({y.kind})")
+    return (
+        Constant(kind, untyped.to_kind(x.kind, x.value, kind), x.typename),
+        Constant(kind, untyped.to_kind(y.kind, y.value, kind), y.typename),
+    )
+
+
+def _result_typename(x: Constant, y: Constant) -> Optional[str]:
+    # an untyped operand takes the type of the typed one
+    return x.typename if x.typename is not None else y.typename
+
+
+# the largest count a constant can be shifted by, like in go/types: the
+# shift of a float64 mantissa (52 bits) to the largest (1023) exponent
+max_shift = 1023 - 1 + 52
+
+
+def _to_shift_count(c: Constant) -> int:
+    count = untyped.to_integer(c.kind, c.value) if untyped.is_numeric(c.kind) else None
+    if count is None:
+        raise ConstError(f"invalid operation: shift count {c} must be integer")
+    if count < 0:
+        raise ConstError(f"invalid operation: negative shift count {c}")
+    if count > max_shift:
+        raise ConstError(f"invalid operation: invalid shift count {c}")
+    return count
+
+
+# the bits of the untyped integer constants, like in go/types: the values
+# growing past them overflow
+max_bits = 512
+
+# the names of the operations which can overflow, for the messages
+_op_names = {"+": "addition", "-": "subtraction", "*": "multiplication", "^": "bitwise XOR",
+             "<<": "shift"}
+
+
+def binary_op(operator: str, x: Constant, y: Constant) -> Constant:
+    """Evaluate x operator y exactly"""
+    c = _typed(_binary_op(operator, x, y))
+    if c.is_untyped and c.kind in ("int", "rune") and abs(c.value).bit_length() > max_bits:
+        name = _op_names.get(operator)
+        raise ConstError(f"constant {name + ' ' if name else ''}overflow")
+    return c
+
+
+def _binary_op(operator: str, x: Constant, y: Constant) -> Constant:
+    if operator in ("<<", ">>"):
+        count = _to_shift_count(y)
+        value = untyped.to_integer(x.kind, x.value) if untyped.is_numeric(x.kind) else None
+        if value is None:
+            raise ConstError(f"invalid operation: shift of non-integer {x}")
+        # an untyped float (or complex) with an integer value is shifted as an int
+        x = Constant(x.kind if untyped.is_integer(x.kind) else "int", value, x.typename)
+        if operator == "<<":
+            value = x.value << count
+        else:
+            value = x.value >> count
+        return Constant(x.kind, value, x.typename)
+
+    x, y = _match_kinds(x, y, operator)
+
+    if x.typename is not None and y.typename is not None and x.typename != y.typename:
+        raise ConstError(
+            f"invalid operation: mismatched types {x.typename} and {y.typename}")
+
+    kind = x.kind
+    typename = _result_typename(x, y)
+    a, b = x.value, y.value
+
+    if kind == "complex" and operator not in ("==", "!="):
+        return _complex_op(operator, x, y, typename)
+
+    if operator in ("==", "!=", "<", "<=", ">", ">="):
+        result = {
+            "==": a == b,
+            "!=": a != b,
+            "<": a < b,
+            "<=": a <= b,
+            ">": a > b,
+            ">=": a >= b,
+        }[operator]
+        return Constant("bool", result)
+
+    if kind == "bool":
+        if operator == "&&":
+            return Constant("bool", a and b, typename)
+        elif operator == "||":
+            return Constant("bool", a or b, typename)
+
+    elif kind == "string":
+        if operator == "+":
+            return Constant("string", a + b, typename)
+
+    elif operator == "+":
+        return Constant(kind, a + b, typename)
+    elif operator == "-":
+        return Constant(kind, a - b, typename)
+    elif operator == "*":
+        return Constant(kind, a * b, typename)
+    elif operator in ("/", "%") and b == 0:
+        raise ConstError("invalid operation: division by zero")
+    elif operator == "/":
+        if untyped.is_integer(kind):
+            # integer division truncates towards zero in Go
+            q = abs(a) // abs(b)
+            return Constant(kind, q if (a >= 0) == (b >= 0) else -q, typename)
+        return Constant(kind, Fraction(a) / b, typename)
+
+    elif untyped.is_integer(kind):
+        if operator == "%":
+            r = abs(a) % abs(b)
+            return Constant(kind, r if a >= 0 else -r, typename)
+        elif operator == "&":
+            return Constant(kind, a & b, typename)
+        elif operator == "|":
+            return Constant(kind, a | b, typename)
+        elif operator == "^":
+            return Constant(kind, a ^ b, typename)
+        elif operator == "&^":
+            return Constant(kind, a & ~b, typename)
+
+    raise ConstError(f"invalid operation: operator {operator} not defined on {x}")
+
+
+def _complex_op(operator: str, x: Constant, y: Constant, typename: Optional[str]) -> Constant:
+    (a, b), (c, d) = x.value, y.value
+    if operator == "+":
+        value = (a + c, b + d)
+    elif operator == "-":
+        value = (a - c, b - d)
+    elif operator == "*":
+        value = (a * c - b * d, a * d + b * c)
+    elif operator == "/":
+        # (a + bi) / (c + di) = (a + bi)(c - di) / (c² + d²)
+        divisor = c * c + d * d
+        if divisor == 0:
+            raise ConstError("invalid operation: division by zero")
+        value = ((a * c + b * d) / divisor, (b * c - a * d) / divisor)
+    else:
+        raise ConstError(f"invalid operation: operator {operator} not defined on {x}")
+    return Constant("complex", value, typename)
+
+
+def unary_op(operator: str, x: Constant) -> Constant:
+    return _typed(_unary_op(operator, x))
+
+
+def _unary_op(operator: str, x: Constant) -> Constant:
+    if operator == "+" and untyped.is_numeric(x.kind):
+        return x
+    elif operator == "-" and x.kind == "complex":
+        real, imag = x.value
+        return Constant(x.kind, (-real, -imag), x.typename)
+    elif operator == "-" and untyped.is_numeric(x.kind):
+        return Constant(x.kind, -x.value, x.typename)
+    elif operator == "!" and x.kind == "bool":
+        return Constant("bool", not x.value, x.typename)
+    elif operator == "^" and untyped.is_integer(x.kind):
+        if x.typename is not None and untyped.is_unsigned(x.typename):
+            # for unsigned types, ^x is x xor all bits set
+            size = untyped.int_size(x.typename)
+            return Constant(x.kind, x.value ^ ((1 << size) - 1), x.typename)
+        return Constant(x.kind, ~x.value, x.typename)
+
+    raise ConstError(f"invalid operation: operator {operator} not defined on {x}")
+
+
+def _real_part(c: Constant) -> Fraction:
+    """Value of a numeric constant as a float, the argument of complex()"""
+    if c.kind == "complex":
+        real, imag = c.value
+        if imag != 0:
+            raise ConstError(f"constant {c} truncated to real")
+        return real
+    if not untyped.is_numeric(c.kind):
+        raise ConstError(f"invalid argument: {c} is not a number")
+    return Fraction(c.value)
+
+
+def builtin(name: str, args: list) -> Constant:
+    """Value of a call of the builtin complex, real, imag, len, min or
+    max with constant arguments (constants themselves)"""
+    if name == "complex" and len(args) == 2:
+        x, y = args
+        if x.typename is not None and y.typename is not None and x.typename != y.typename:
+            raise ConstError(
+                f"invalid operation: mismatched types {x.typename} and {y.typename}")
+        typename = x.typename or y.typename
+        value = Constant("complex", (_real_part(x), _real_part(y)))
+        if typename is None:
+            return value
+        if typename not in untyped.complex_of_float:
+            raise ConstError(
+                f"invalid argument: arguments have type {typename}, expected floating-point")
+        return convert(value, untyped.complex_of_float[typename])
+
+    elif name in ("real", "imag") and len(args) == 1:
+        x = args[0]
+        if not untyped.is_numeric(x.kind):
+            raise ConstError(f"invalid argument: {x} is not a number")
+        if x.typename is not None and x.typename not in untyped.float_of_complex:
+            raise ConstError(
+                f"invalid argument: argument has type {x.typename}, expected complex type")
+        real, imag = untyped.to_kind(x.kind, x.value, "complex")
+        typename = untyped.float_of_complex.get(x.typename)
+        return Constant("float", real if name == "real" else imag, typename)
+
+    elif name == "len" and len(args) == 1 and args[0].kind == "string":
+        # the number of bytes of the string
+        return Constant("int", len(args[0].value), "int")
+
+    elif name in ("min", "max") and args:
+        # the least (or the greatest) of ordered constants, in the
+        # largest kind of the untyped ones, like min(1, 2.5) (1.0)
+        for x in args:
+            if x.kind in ("bool", "complex"):
+                raise ConstError(f"invalid argument: {x} cannot be ordered")
+        result = args[0]
+        for x in args[1:]:
+            before = _binary_op("<" if name == "min" else ">", x, result).value
+            kept, other = (x, result) if before else (result, x)
+            kept, _ = _match_kinds(kept, other, name)
+            result = Constant(kept.kind, kept.value, _result_typename(kept, other))
+        return result
+
+    raise ConstError(f"{name}() is not constant")
+
+
+def conversion(c: Constant, typename: str) -> Constant:
+    """Explicit conversion of constant c to the type, like string(c)
+
+    The value has to be representable by the type (see convert) except
+    for integers converted to strings, which give the UTF-8 encoding of
+    the character (U+FFFD if it is not a valid one)"""
+    if untyped.kind_of_typename(typename) == "string" and untyped.is_integer(c.kind):
+        code = c.value
+        if not 0 <= code <= 0x10FFFF or 0xD800 <= code <= 0xDFFF:
+            code = 0xFFFD
+        return Constant("string", chr(code).encode("utf-8"), typename)
+    return convert(c, typename)
+
+
+def convert(c: Constant, typename: str) -> Constant:
+    """Convert constant c to the given type (for typed contexts)
+
+    The value has to be representable by the type, a ConstError
+    is raised if it overflows or has to be truncated"""
+    try:
+        value = untyped.convert(c.kind, c.value, typename)
+    except untyped.ConversionError as e:
+        if e.reason is None:
+            raise ConstError(f"cannot use {c} as {typename} value")
+        raise ConstError(f"constant {c} {e.reason}")
+    return Constant(untyped.kind_of_typename(typename), value, typename)
+
+
+def _typed(c: Constant) -> Constant:
+    """Results of operations on typed constants have to be
+    representable by the type as well"""
+    if c.typename is not None and untyped.is_numeric(c.kind):
+        return convert(c, c.typename)
+    return c
+
+
+def _array_length(expr: Any) -> Optional[int]:
+    """The length of the array (or of the array pointed to) expr is, for
+    len(expr) and cap(expr), which are constants if expr doesn't call a
+    function or receive from a channel (it isn't evaluated then)"""
+    import syntree
+
+    t = syntree.infer_expr_type(expr)
+    if isinstance(t, syntree.Type) and isinstance(t.underlying(), syntree.Pointer):
+        t = t.underlying().base
+    if not isinstance(t, syntree.Type) or not isinstance(t.underlying(), syntree.Array):
+        return None
+    for node in syntree.walk(expr):
+        if isinstance(node, syntree.UnaryOp) and node.operator == "<-":
+            return None
+        if (isinstance(node, syntree.FunctionCall) and not isinstance(
+                getattr(node.fn_sym, "value", None), syntree.Type)):
+            try:
+                evaluate(node)
+            except ConstError:
+                return None
+    return t.underlying().length
+
+
+def evaluate(expr: Any, iota: Optional[int] = None) -> Constant:
+    """Evaluate a constant expression (an AST node)
+
+    iota is the index of the ConstSpec the expression is in, if any.
+    Raises ConstError if expr is not a constant expression"""
+
+    # imported here since syntree uses this module
+    import syntree
+
+    if isinstance(expr, syntree.List) and len(expr) == 1:
+        return evaluate(expr.children[0], iota)
+
+    if isinstance(expr, syntree.Literal) and not isinstance(expr.value, syntree.Node):
+        return from_literal(expr)
+
+    elif isinstance(expr, syntree.BinOp):
+        return binary_op(
+            expr.operator, evaluate(expr.left, iota), evaluate(expr.right, iota)
+        )
+
+    elif isinstance(expr, syntree.UnaryOp):
+        return unary_op(expr.operator, evaluate(expr.operand, iota))
+
+    elif isinstance(expr, syntree.FunctionCall) and expr.is_builtin:
+        exprs = expr.arguments.expressions()
+        if expr.fn_name in ("len", "cap") and len(exprs) == 1:
+            length = _array_length(exprs[0])
+            if length is not None:
+                return Constant("int", length, "int")
+        args = [evaluate(arg, iota) for arg in exprs]
+        return builtin(expr.fn_name, args)
+
+    elif (isinstance(expr, syntree.FunctionCall) and expr.fn_sym is not None
+            and isinstance(expr.fn_sym.value, syntree.Type)):
+        # a conversion to a basic type, like string('a')
+        typename = getattr(expr.fn_sym.value.underlying(), "typename", None)
+        args = expr.arguments.expressions()
+        if len(args) == 1 and untyped.kind_of_typename(typename) is not None:
+            return conversion(evaluate(args[0], iota), typename)
+
+    elif isinstance(expr, syntree.PrimaryExpr) and not expr.children:
+        sym = expr.ident
+        name = expr.data[1] if isinstance(expr.data, tuple) else expr.data
+        if sym is None or sym.lineno is None:
+            raise ConstError(f"undefined: {name}")
+        if name == "iota" and sym.scope_id == "1" and sym.lineno == 0:
+            if iota is None:
+                raise ConstError("cannot use iota outside constant declaration")
+            return Constant("int", iota)
+        if sym.constant is None:
+            raise ConstError(f"{name} is not constant")
+        return sym.constant
+
+    raise ConstError(f"{expr} is not constant")
@@ -0,0 +1,435 @@
+import bisect
+import os
+import go_lexer
+import syntree
+import utils
+
+from checker import in_order
+from dataclasses import dataclass
+from fileset import fset
+from loader import test_main_file
+from typing import Dict, List, Optional, Tuple
+
+
+# The coverage mode (go_parser.py test -cover, and -coverprofile of run)
+# instruments the AST of the packages before the interpreter or the VM runs
+# them, like cmd/cover rewrites the source for go test -cover: a counter
+# (a syntree.CoverStmt) is added at the start of each basic block of the
+# functions, the statements which run one after the other, and counts its
+# runs. The blocks are the ones of cmd/cover (addCounters), found the same
+# way: a block ends with the statements changing the flow of control (if,
+# for, switch, select, break, continue, goto, a labeled statement, a call
+# of panic) or with a function literal, and spans the lines of code up to
+# the next one, without the lines of comments and blank lines, so the
+# profile written is the one go test -coverprofile writes, which go tool
+# cover -func (or -html) reads. The positions of the statements are found
+# in the tokens of the files, the AST has no spans for some of them (like
+# the declarations) and none of the semicolons ending them
+
+modes = ("set", "count", "atomic")
+
+
+@dataclass
+class Block:
+    """A basic block of a file, from the line and the column (in bytes,
+    from 1) of start to the ones of end, the end excluded. Its statements
+    have run count times"""
+    file: str
+    start: Tuple[int, int]
+    end: Tuple[int, int]
+    statements: int
+    count: int = 0
+
+
+class Profile:
+    """The blocks of the files instrumented, see instrument"""
+
+    def __init__(self, mode: str):
+        self.mode = mode
+        self.blocks: List[Block] = []
+
+    def percent(self) -> Optional[float]:
+        """The percentage of the statements run, None if there are none"""
+        total = sum(block.statements for block in self.blocks)
+        if total == 0:
+            return None
+        run = sum(block.statements for block in self.blocks if block.count > 0)
+        return 100 * run / total
+
+    def summary(self) -> str:
+        """The line go test prints, like coverage: 75.0% of statements"""
+        percent = self.percent()
+        if percent is None:
+            return "coverage: [no statements]"
+        return f"coverage: {percent:.1f}% of statements"
+
+    def write(self, path: str):
+        """Writes the profile to path in the format of go test -coverprofile,
+        the blocks ordered by file and position"""
+        with open(path, "w") as f:
+            f.write(f"mode: {self.mode}\n")
+            for block in sorted(self.blocks, key=lambda b: (b.file, b.start, b.end)):
+                count = min(block.count, 1) if self.mode == "set" else block.count
+                f.write(f"{block.file}:{block.start[0]}.{block.start[1]},"
+                        f"{block.end[0]}.{block.end[1]} {block.statements} {count}\n")
+
+
+def profile_name(filename: str) -> str:
+    """The name of a file in a profile: go tool cover finds the files named
+    by a relative path starting with ./ or ../, or by an absolute one"""
+    name = filename.replace(os.sep, "/")
+    if os.path.isabs(filename) or name.startswith("./") or name.startswith("../"):
+        return name
+    return "./" + name
+
+
+def instrument(packages: list, mode: str) -> Profile:
+    """Adds the counters to the functions of the packages (loader.Packages
+    parsed and type checked), but not to the ones of their _test.go files.
+    Returns the profile of their blocks, which the counters count"""
+    profile = Profile(mode)
+    for package in packages:
+        files = {node.filename: node for node in package.ast.children
+                 if isinstance(node, syntree.File)}
+        for filename in package.files:
+            name = os.path.basename(filename)
+            if filename in files and not name.endswith("_test.go") and name != test_main_file:
+                Instrumenter(profile, files[filename]).file(files[filename])
+    return profile
+
+
+@dataclass
+class Group:
+    """A statement of a block: the nodes the parser made from it (a
+    declaration is a VarDecl for each name), and its span in the file"""
+    items: list
+    start: int
+    end: int
+
+
+class Instrumenter:
+    """Adds the counters to the functions of a file"""
+
+    def __init__(self, profile: Profile, file: syntree.File):
+        self.profile = profile
+        self.name = profile_name(file.filename)
+        self.base = next(f.base for f in reversed(fset.files) if f.name == file.filename)
+        lines = utils.lines
+        tokens = go_lexer.tokenize(utils.read_source(file.filename))
+        utils.lines = lines
+        self.code = go_lexer.input_code
+        self.line_starts = [0] + [i + 1 for i, c in enumerate(self.code) if c == "\n"]
+        self.kinds = [tok.type for tok in tokens]
+        self.starts = [tok.lexpos for tok in tokens]
+        # the offsets right after the tokens, the semicolons inserted at the
+        # end of the lines are empty
+        self.ends = [tok.end - 1 for tok in tokens]
+        self.index = {self.starts[i]: i for i in range(len(tokens)) if self.kinds[i] != ";"}
+        # the closing bracket of each opening one, and the other way around
+        self.closing: Dict[int, int] = {}
+        self.opening: Dict[int, int] = {}
+        stack = []
+        for i, kind in enumerate(self.kinds):
+            if kind in ("(", "[", "{", "LIT_LBRACE"):
+                stack.append(i)
+            elif kind in (")", "]", "}") and stack:
+                self.closing[stack[-1]] = i
+                self.opening[i] = stack.pop()
+        # the blocks already in the profile, by span, see counter
+        self.spans: set = set()
+
+    def offset(self, pos: int) -> int:
+        return pos - self.base
+
+    def position(self, offset: int) -> Tuple[int, int]:
+        """The line and the column in bytes of an offset"""
+        index = bisect.bisect_right(self.line_starts, offset) - 1
+        column = len(self.code[self.line_starts[index]:offset].encode("utf-8", "surrogatepass"))
+        return index + 1, column + 1
+
+    def line(self, offset: int) -> int:
+        return bisect.bisect_right(self.line_starts, offset)
+
+    def file(self, file: syntree.File):
+        # the nodes are collected before the counters are added
+        functions = [node for node in syntree.walk(file) if isinstance(node, syntree.Function)]
+        for function in functions:
+            if function.body is None or function.fn_name is not None and function.fn_name[1] == "_":
+                continue
+            self.block(function.body)
+
+    # the statements
+
+    def block(self, block: syntree.Block, start: Optional[int] = None):
+        """Adds the counters to a block in braces, start is where its first
+        basic block starts, after the else of an else block"""
+        lbrace = self.index[self.offset(block.pos)]
+        rbrace = self.closing[lbrace]
+        pos = self.starts[lbrace] if start is None else start
+        groups = self.groups(in_order(block), self.statements(lbrace + 1, rbrace))
+        self.add_counters(block, groups, pos, pos + 1, self.ends[rbrace], True)
+
+    def clauses(self, clauses):
+        """Adds the counters to the case clauses of a switch, or the comm
+        clauses of a select"""
+        for clause in in_order(clauses):
+            colon = self.index[self.offset(clause.pos)] + 1
+            while self.kinds[colon] != "COLON":
+                colon = self.closing.get(colon, colon) + 1
+            last = colon + 1
+            while self.kinds[last] not in ("KW_CASE", "KW_DEFAULT", "}"):
+                last = self.closing.get(last, last) + 1
+            if clause.body is None:
+                clause.body = syntree.Block(None)
+                clause.children.append(clause.body)
+            groups = self.groups(in_order(clause.body), self.statements(colon + 1, last))
+            pos = self.ends[colon]
+            end = groups[-1].end if groups else pos
+            self.add_counters(clause.body, groups, pos, pos, end, False)
+
+    def if_stmt(self, stmt: syntree.IfStmt):
+        self.block(stmt.body)
+        if stmt.next_ is None:
+            return
+        # the else blocks start after the else, an else if is put in a
+        # block starting there, the block of its condition
+        else_ = self.closing[self.index[self.offset(stmt.body.pos)]] + 1
+        start = self.ends[else_]
+        if isinstance(stmt.next_, syntree.Block):
+            self.block(stmt.next_, start)
+            return
+        else_if = stmt.next_
+        block = syntree.Block(syntree.List([else_if]))
+        stmt.children[stmt.children.index(else_if)] = block
+        stmt.next_ = block
+        group = Group([else_if], self.offset(else_if.pos), self.offset(else_if.end))
+        self.add_counters(block, [group], start, start + 1, group.end + 1, True)
+
+    def nested(self, stmt):
+        """Adds the counters to the blocks of a statement"""
+        if isinstance(stmt, syntree.Block):
+            self.block(stmt)
+        elif isinstance(stmt, syntree.IfStmt):
+            self.if_stmt(stmt)
+        elif isinstance(stmt, syntree.ForStmt):
+            self.block(stmt.body)
+        elif isinstance(stmt, (syntree.SwitchStmt, syntree.SelectStmt)):
+            self.clauses(stmt.clauses)
+        elif isinstance(stmt, syntree.LabeledStmt) and stmt.stmt is not None:
+            self.nested(stmt.stmt)
+
+    def statements(self, first: int, last: int) -> List[Tuple[int, int]]:
+        """The spans of the statements of the tokens first to last (excluded),
+        separated by the semicolons out of brackets"""
+        spans = []
+        start = i = first
+        while i < last:
+            if self.kinds[i] == ";":
+                if i > start:
+                    spans.append((self.starts[start], self.ends[i - 1]))
+                start = i + 1
+            elif self.kinds[i] in ("KW_IF", "KW_FOR", "KW_SWITCH"):
+                # the semicolons of the header, up to the block
+                while self.kinds[i] != "{":
+                    i = self.closing.get(i, i) + 1
+                i = self.closing[i]
+            else:
+                i = self.closing.get(i, i)
+            i += 1
+        if start < last:
+            spans.append((self.starts[start], self.ends[last - 1]))
+        return spans
+
+    def groups(self, items: list, spans: List[Tuple[int, int]]) -> List[Group]:
+        """The statements of a block, the items of the AST for each one of
+        the spans of its tokens"""
+        groups: List[Group] = []
+        starts = [start for start, _ in spans]
+        last = -1
+        for item in items:
+            anchor = self.anchor(item)
+            index = last if anchor is None else bisect.bisect_right(starts, anchor) - 1
+            if index == last and groups:
+                groups[-1].items.append(item)
+                continue
+            last = index
+            groups.append(Group([item], *spans[index]))
+        return groups
+
+    def anchor(self, node) -> Optional[int]:
+        """An offset in the statement of a node"""
+        if isinstance(node, syntree.VarDecl):
+            ident = node.ident
+            return self.line_starts[ident.lineno - 1] + ident.col_num - 1
+        if node.pos:
+            return self.offset(node.pos)
+        for child in node.children:
+            if isinstance(child, syntree.Node) and not isinstance(child, syntree.Type):
+                anchor = self.anchor(child)
+                if anchor is not None:
+                    return anchor
+        return None
+
+    # the basic blocks, like cmd/cover
+
+    def add_counters(self, container: syntree.Block, groups: List[Group], pos: int,
+                     insert: int, block_end: int, extend: bool):
+        """Adds the counters of the basic blocks of the statements of the
+        container, from pos to block_end. extend extends the last one to
+        block_end, the closing brace"""
+        if not groups:
+            start, end = self.code_ranges(insert, block_end)[0]
+            container.children = [self.counter(start, end, 0)]
+            return
+        statements: list = []
+        nested = [item for group in groups for item in group.items]
+        groups = list(groups)
+        while True:
+            last = 0
+            end = block_end
+            while last < len(groups):
+                group = groups[last]
+                end = self.boundary(group)
+                if self.ends_block(group):
+                    labeled = group.items[0]
+                    if isinstance(labeled, syntree.LabeledStmt) and not isinstance(
+                            labeled.stmt, (syntree.ForStmt, syntree.SwitchStmt, syntree.SelectStmt)):
+                        # a goto can jump to the label, it starts a block
+                        label = syntree.LabeledStmt(labeled.label, None, labeled.lineno)
+                        label.pos = labeled.pos
+                        inner = self.inner_start(labeled)
+                        end = group.start
+                        groups[last] = Group([label], group.start, inner)
+                        stmt = [] if labeled.stmt is None else [labeled.stmt]
+                        groups.insert(last + 1, Group(stmt, inner, group.end))
+                    last += 1
+                    extend = False
+                    break
+                last += 1
+            if extend:
+                end = block_end
+            block = groups[:last]
+            counters = {}
+            if pos != end:
+                ranges = self.merge_ranges(self.code_ranges(pos, end), block)
+                for i, (start, stop) in enumerate(ranges):
+                    at = 0 if i == 0 else next(
+                        (j for j, group in enumerate(block) if group.start >= start), len(block))
+                    counters.setdefault(at, []).append(self.counter(start, stop, last))
+            for i, group in enumerate(block):
+                statements.extend(counters.get(i, []))
+                statements.extend(group.items)
+            statements.extend(counters.get(len(block), []))
+            groups = groups[last:]
+            if not groups:
+                break
+            pos = groups[0].start
+        container.children = list(reversed(statements))
+        for item in nested:
+            self.nested(item)
+
+    def inner_start(self, labeled: syntree.LabeledStmt) -> int:
+        """The offset of the statement of a labeled statement, the one of
+        the token after its colon for an empty statement"""
+        if labeled.stmt is not None:
+            return self.anchor(labeled.stmt)
+        i = self.index[self.offset(labeled.pos)] + 2
+        while self.kinds[i] == ";" and self.starts[i] == self.ends[i]:
+            i += 1
+        return self.starts[i]
+
+    def boundary(self, group: Group) -> int:
+        """Where the basic block ending with the statement ends"""
+        stmt = group.items[0] if group.items else None
+        while isinstance(stmt, syntree.LabeledStmt):
+            stmt = stmt.stmt
+        if isinstance(stmt, syntree.Block):
+            return self.offset(stmt.pos)
+        if isinstance(stmt, (syntree.IfStmt, syntree.ForStmt)):
+            parts = [stmt.statement, stmt.expr] if isinstance(stmt, syntree.IfStmt) else [
+                stmt.clause.expr if isinstance(stmt.clause, syntree.RangeClause) else stmt.clause]
+            return self.function_literal(parts) or self.offset(stmt.body.pos)
+        if isinstance(stmt, (syntree.SwitchStmt, syntree.SelectStmt)):
+            parts = []
+            if isinstance(stmt, syntree.TypeSwitchStmt):
+                parts = [stmt.statement]
+            elif isinstance(stmt, syntree.SwitchStmt):
+                parts = [stmt.statement, stmt.expr]
+            rbrace = self.index[group.end - 1]
+            return self.function_literal(parts) or self.starts[self.opening[rbrace]]
+        return self.function_literal(group.items) or group.end
+
+    def ends_block(self, group: Group) -> bool:
+        """If the statement changes the flow of control, or has a function
+        literal"""
+        stmt = group.items[0] if group.items else None
+        if isinstance(stmt, (syntree.Block, syntree.ForStmt, syntree.IfStmt, syntree.LabeledStmt,
+                             syntree.SwitchStmt, syntree.SelectStmt)):
+            return True
+        if isinstance(stmt, syntree.Keyword) and stmt.kw in ("BREAK", "CONTINUE", "GOTO",
+                                                             "FALLTHROUGH"):
+            return True
+        if isinstance(stmt, syntree.FunctionCall) and stmt.fn_name == "panic" and len(
+                stmt.arguments.expressions()) == 1:
+            return True
+        return self.function_literal(group.items) is not None
+
+    def function_literal(self, nodes: list) -> Optional[int]:
+        """The offset of the body of the first function literal of the
+        nodes, None if they have none"""
+        bodies = [
+            self.offset(node.body.pos) for node in syntree.walk(nodes, literals=False)
+            if isinstance(node, syntree.Function) and node.fn_name is None and node.body is not None
+        ]
+        return min(bodies, default=None)
+
+    def code_ranges(self, start: int, end: int) -> List[Tuple[int, int]]:
+        """The ranges of the lines of code from start to end, without the
+        lines of comments, the blank lines and the ones with only braces.
+        A range of no code at start if there is none"""
+        ranges = []
+        code_start = 0
+        # the last line with code
+        previous = 0
+        first = bisect.bisect_left(self.starts, start)
+        for i in range(first, len(self.kinds)):
+            if self.starts[i] >= end:
+                break
+            kind = self.kinds[i]
+            if kind in ("{", "LIT_LBRACE", "}") or kind == ";" and self.starts[i] == self.ends[i]:
+                continue
+            line = self.line(self.starts[i])
+            end_line = self.line(self.ends[i] - 1) if kind == "STRING_LIT" else line
+            if previous == 0:
+                code_start = self.starts[i]
+            elif line > previous + 1:
+                ranges.append((code_start, self.line_starts[previous]))
+                code_start = self.starts[i]
+            previous = max(previous, end_line)
+        if previous:
+            if previous < self.line(end - 1):
+                ranges.append((code_start, self.line_starts[previous]))
+            else:
+                ranges.append((code_start, end))
+        return ranges or [(start, start)]
+
+    def merge_ranges(self, ranges: List[Tuple[int, int]], block: List[Group]) -> list:
+        """Merges the ranges starting in a statement with the one before"""
+        merged = [ranges[0]]
+        for start, end in ranges[1:]:
+            if any(group.start < start < group.end for group in block):
+                merged[-1] = (merged[-1][0], end)
+            else:
+                merged.append((start, end))
+        return merged
+
+    def counter(self, start: int, end: int, statements: int) -> syntree.CoverStmt:
+        """The counter of a new block of the profile, the same span is taken
+        once (its end is moved a column further, like cmd/cover does)"""
+        start_position, end_position = self.position(start), self.position(end)
+        while (start_position, end_position) in self.spans:
+            end_position = (end_position[0], end_position[1] + 1)
+        self.spans.add((start_position, end_position))
+        block = Block(self.name, start_position, end_position, statements)
+        self.profile.blocks.append(block)
+        return syntree.CoverStmt(block)
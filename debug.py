@@ -0,0 +1,312 @@
+import os
+import sys
+import runpy
+import shlex
+import utils
+
+from dataclasses import dataclass
+from typing import Callable, Dict, List, Optional, Tuple
+
+
+# The debugger (go_parser.py debug) runs a program with one of the backends
+# and stops at the Go lines it is asked to: the breakpoints, set by file and
+# line, and the next line for the stepping commands. Each backend reports
+# the Go line it is at, from its source map back to the Go source:
+#  - the interpreter runs the statements of the AST, their line is the one
+#    of the statement (Interpreter.trace)
+#  - the VM has the line of each instruction of a Code (Code.lines), and the
+#    Compiler of a VM with a debugger emits a LINE instruction at the start
+#    of each statement, the variables in scope are the slots of Code.spans
+#  - the modules of the python backend have the Go line of their lines in
+#    __gopy_lines__ (see pygen.Generator.source_map), the debugger finds it
+#    for the lines python traces (see trace_python)
+# The commands are the ones of Delve (dlv), the debugger of Go. The files
+# of std aren't stepped into, like the natives of the backends.
+
+prompt = "(gopy) "
+
+help_text = """\
+The program is stopped before it starts, and at the breakpoints.
+  break [file:]line (b)    sets a breakpoint, in the file of the program by default
+  clear [file:]line        removes a breakpoint
+  breakpoints (bp)         lists the breakpoints
+  continue (c)             runs to the next breakpoint, or to the end
+  step (s)                 runs to the next line, into the functions called
+  next (n)                 runs to the next line of the function (over the calls)
+  stepout (so)             runs until the function returns
+  print name (p)           prints the value of a variable
+  locals                   prints the variables in scope
+  stack (bt)               prints the functions being run
+  list (ls)                prints the lines around the current one
+  quit (q)                 ends the program"""
+
+
+@dataclass
+class Frame:
+    """A function being run, as the debugger shows it"""
+    # the name of the function, like main.main or main.(*T).m
+    function: str
+    file: str
+    line: int
+    # the variables in scope and their values, formatted like %v
+    variables: Callable[[], List[Tuple[str, str]]]
+
+
+class Quit(BaseException):
+    """Ends the program being debugged, the backends let it through (it
+    isn't an Exception, like SystemExit)"""
+
+
+class Debugger:
+    """Decides where the program stops, and reads the commands when it does.
+    The backends call line with the Go line each statement is at"""
+
+    def __init__(self, file: str, read: Callable[[str], str] = input, out=None,
+                 flush: Callable[[], None] = lambda: None):
+        # the file of the program, the one of the breakpoints without file
+        self.file = file
+        self.read = read
+        self.out = out
+        # the output of the program, written before the one of the debugger
+        self.flush = flush
+        self.breakpoints: List[Tuple[str, int]] = []
+        # "continue", "step", "next" or "stepout", and the depth of the
+        # frame the command was given in
+        self.mode = "continue"
+        self.depth = 0
+        # the last line reported, by depth, a line with several statements
+        # (or the calls of one) stops once
+        self.last: Dict[int, int] = {}
+
+    def print(self, *args):
+        print(*args, file=self.out if self.out is not None else sys.stdout)
+
+    # the backends
+
+    def line(self, file: str, line: int, depth: int, frames: Callable[[], List[Frame]]):
+        """The program is at a Go line, depth is the number of frames of the
+        Go functions running and frames gives them (the innermost first)"""
+        if file in utils.std_files:
+            return
+        new = self.last.get(depth) != line
+        self.last[depth] = line
+        for d in [d for d in self.last if d > depth]:
+            del self.last[d]
+        if not new:
+            return
+        if (file, line) in self.breakpoints:
+            stop = True
+        elif self.mode == "step":
+            stop = True
+        elif self.mode == "next":
+            stop = depth <= self.depth
+        elif self.mode == "stepout":
+            stop = depth < self.depth
+        else:
+            stop = False
+        if stop:
+            self.stop(frames(), depth)
+
+    def start(self):
+        """Reads the commands before the program runs"""
+        self.print("Type 'help' for the list of commands.")
+        self.commands(None, 0)
+
+    def exited(self, status: int):
+        self.flush()
+        self.print(f"Process exited with status {status}")
+
+    # the commands
+
+    def stop(self, frames: List[Frame], depth: int):
+        self.flush()
+        frame = frames[0]
+        breakpoint = (frame.file, frame.line) in self.breakpoints
+        self.print(f"> {frame.function}() {frame.file}:{frame.line}"
+                   f"{' (breakpoint)' if breakpoint else ''}")
+        self.list(frame, 1)
+        self.commands(frames, depth)
+
+    def commands(self, frames: Optional[List[Frame]], depth: int):
+        """Reads the commands until one runs the program"""
+        while True:
+            try:
+                text = self.read(prompt)
+            except EOFError:
+                raise Quit()
+            words = shlex.split(text) if text.strip() else []
+            if not words:
+                continue
+            command, args = words[0], words[1:]
+            if command in ("continue", "c", "step", "s", "next", "n", "stepout", "so"):
+                if frames is None and command not in ("continue", "c", "step", "s"):
+                    self.print("the program isn't running, step or continue starts it")
+                    continue
+                self.mode = {"c": "continue", "s": "step", "n": "next",
+                             "so": "stepout"}.get(command, command)
+                self.depth = depth
+                return
+            elif command in ("quit", "q", "exit"):
+                raise Quit()
+            elif command in ("help", "h"):
+                self.print(help_text)
+            elif command in ("break", "b", "clear"):
+                self.breakpoint(command, args)
+            elif command in ("breakpoints", "bp"):
+                for i, (file, line) in enumerate(self.breakpoints, 1):
+                    self.print(f"Breakpoint {i} at {file}:{line}")
+            elif frames is None and command in ("print", "p", "locals", "stack", "bt",
+                                                "list", "ls"):
+                self.print("the program isn't running")
+            elif command in ("print", "p"):
+                self.print_variables(frames[0], args)
+            elif command == "locals":
+                for name, value in frames[0].variables():
+                    self.print(f"{name} = {value}")
+            elif command in ("stack", "bt"):
+                for i, frame in enumerate(frames):
+                    self.print(f"{i:>2}  {frame.function}()\n    at {frame.file}:{frame.line}")
+            elif command in ("list", "ls"):
+                self.list(frames[0], 5)
+            else:
+                self.print(f"unknown command {command}, help lists the commands")
+
+    def breakpoint(self, command: str, args: List[str]):
+        location = self.location(args[0]) if len(args) == 1 else None
+        if location is None:
+            self.print(f"usage: {command} [file:]line")
+        elif command == "clear":
+            if location in self.breakpoints:
+                self.breakpoints.remove(location)
+                self.print(f"Breakpoint cleared at {location[0]}:{location[1]}")
+            else:
+                self.print(f"no breakpoint at {location[0]}:{location[1]}")
+        elif location not in self.breakpoints:
+            self.breakpoints.append(location)
+            self.print(f"Breakpoint {len(self.breakpoints)} set at {location[0]}:{location[1]}")
+
+    def location(self, text: str) -> Optional[Tuple[str, int]]:
+        """The (file, line) of [file:]line, the file is matched by its path
+        or its name with the files of the program"""
+        file, _, line = text.rpartition(":")
+        if not line.isdigit():
+            return None
+        if not file:
+            return self.file, int(line)
+        for name in utils.sources:
+            if name == file or os.path.normpath(name) == os.path.normpath(file) or (
+                    os.path.basename(name) == file):
+                return name, int(line)
+        return file, int(line)
+
+    def print_variables(self, frame: Frame, names: List[str]):
+        if not names:
+            self.print("usage: print name")
+            return
+        variables = dict(frame.variables())
+        for name in names:
+            if name in variables:
+                self.print(f"{name} = {variables[name]}")
+            else:
+                self.print(f"could not find symbol value for {name}")
+
+    def list(self, frame: Frame, around: int):
+        lines = utils.sources.get(frame.file, [])
+        for n in range(max(1, frame.line - around), min(len(lines), frame.line + around) + 1):
+            mark = "=>" if n == frame.line else "  "
+            self.print(f"{mark}{n:>5}:\t{lines[n - 1]}")
+
+
+# the python backend
+
+def trace_python(debugger: Debugger, module: str, argv: List[str]) -> int:
+    """Runs the main module of a program built by the python backend, with
+    a trace function reporting the Go lines of its functions. Returns the
+    exit status"""
+    # the last Go line of each python frame, by id of the frame
+    lines: Dict[int, int] = {}
+
+    def generated(frame) -> bool:
+        return "__gopy_lines__" in frame.f_globals
+
+    def function(frame) -> Optional[str]:
+        funcs = frame.f_globals["__gopy_funcs__"]
+        name = funcs.get(frame.f_code.co_firstlineno)
+        # without the (...) of the stack traces
+        return name[:name.rindex("(")] if name is not None else None
+
+    def stack(frame) -> List[Frame]:
+        frames = []
+        inner = None
+        while frame is not None:
+            if generated(frame):
+                where = frame.f_globals["__gopy_lines__"].get(frame.f_lineno)
+                name = function(frame)
+                if name is None:
+                    # the body of a function with defers and named results
+                    inner = inner or (frame, where)
+                elif where is not None or inner is not None:
+                    at, where = inner or (frame, where)
+                    file = frame.f_globals["__gopy_files__"][where[0]]
+                    frames.append(Frame(name, file, where[1], variables(at)))
+                    inner = None
+            frame = frame.f_back
+        return frames
+
+    def variables(frame) -> Callable[[], List[Tuple[str, str]]]:
+        from gopyrt import fmt
+        return lambda: [(name, fmt.format_value(value))
+                        for name, value in frame.f_locals.items()
+                        if not name.startswith("__")]
+
+    def depth(frame) -> int:
+        n = 0
+        while frame is not None:
+            if generated(frame) and function(frame) is not None:
+                n += 1
+            frame = frame.f_back
+        return n
+
+    def trace_line(frame, event, arg):
+        if event == "line":
+            where = frame.f_globals["__gopy_lines__"].get(frame.f_lineno)
+            if where is not None and lines.get(id(frame)) != where[1]:
+                lines[id(frame)] = where[1]
+                file = frame.f_globals["__gopy_files__"][where[0]]
+                debugger.line(file, where[1], depth(frame), lambda: stack(frame))
+        elif event == "return":
+            lines.pop(id(frame), None)
+        return trace_line
+
+    def trace_call(frame, event, arg):
+        if event == "call" and generated(frame):
+            return trace_line
+        return None
+
+    saved = sys.argv
+    sys.argv = argv
+    sys.path.insert(0, os.path.dirname(os.path.abspath(module)))
+    sys.settrace(trace_call)
+    try:
+        runpy.run_path(module, run_name="__main__")
+        status = 0
+    except SystemExit as e:
+        status = e.code if isinstance(e.code, int) else 0
+    finally:
+        sys.settrace(None)
+        sys.argv = saved
+        sys.path.pop(0)
+    return status
+
+
+def attach(debugger: Debugger, run: Callable[[], int]) -> int:
+    """Runs the program with the debugger, run runs it with the backend.
+    Returns its exit status, 0 if the debugger ends it"""
+    try:
+        debugger.start()
+        status = run()
+    except Quit:
+        debugger.flush()
+        return 0
+    debugger.exited(status)
+    return status
@@ -0,0 +1,278 @@
+import re
+import json
+import utils
+
+from contextlib import contextmanager
+from dataclasses import dataclass, field
+from typing import List, Optional
+from utils import print_error, print_line, print_line_marker_nowhitespace, print_marker
+
+
+# Every error (or warning) found by the lexer, the parser and the type
+# checker is a Diagnostic, reported with report. They are printed as they
+# are reported, and kept in reported, in order, for the tools using them.
+
+
+@dataclass
+class Fix:
+    """A suggested fix, replacing the text of the span (of width
+    characters at lineno, col_num) with new_text"""
+
+    message: str
+    new_text: str
+    lineno: Optional[int] = None
+    col_num: Optional[int] = None
+    width: int = 0
+    file: Optional[str] = None
+
+    def to_dict(self) -> dict:
+        return {
+            "message": self.message,
+            "new_text": self.new_text,
+            **span_dict(self),
+        }
+
+
+@dataclass
+class Diagnostic:
+    """An error found in the program, at the span of width characters
+    starting at lineno, col_num (col_num is None if it is the whole line)"""
+
+    message: str
+    lineno: Optional[int] = None
+    col_num: Optional[int] = None
+    width: int = 1
+    # the stage which found it, like SYNTAX ERROR or TYPE ERROR
+    kind: str = "TYPE ERROR"
+    # error, warning or note
+    severity: str = "error"
+    # identifies the kind of error, like UndeclaredName, see code_of
+    code: Optional[str] = None
+    # related locations, like the other declaration of a redeclared symbol
+    notes: List["Diagnostic"] = field(default_factory=list)
+    # the file of the location
+    file: Optional[str] = None
+    fix: Optional[Fix] = None
+
+    @property
+    def end_col_num(self) -> Optional[int]:
+        """Column right after the span"""
+        if self.col_num is None:
+            return None
+        return self.col_num + self.width
+
+    def to_dict(self) -> dict:
+        """The diagnostic as a dict of JSON values, see encode_json"""
+        return {
+            "message": self.message,
+            "severity": self.severity,
+            "kind": self.kind,
+            "code": self.code,
+            **span_dict(self),
+            "notes": [{"message": note.message, **span_dict(note)} for note in self.notes],
+            "fix": self.fix.to_dict() if self.fix is not None else None,
+        }
+
+
+def span_dict(d) -> dict:
+    """The location of a diagnostic (or a fix) as a dict, columns start
+    at 1 and end_column is right after the span"""
+    end = None if d.col_num is None else d.col_num + d.width
+    return {"file": d.file, "line": d.lineno, "column": d.col_num, "end_column": end}
+
+
+def encode_json(diagnostics: List[Diagnostic]) -> str:
+    """The diagnostics as a JSON array, for editors and other tools"""
+    return json.dumps([d.to_dict() for d in diagnostics], indent=2)
+
+
+# the codes of the errors reported without one, by message. They are
+# named after the ones of go/types (internal/types/errors)
+codes = [
+    (r"undefined: |undefined type ", "UndeclaredName"),
+    (r".* redeclared in this block", "DuplicateDecl"),
+    (r".* repeated on left side of :=", "RepeatedDecl"),
+    (r"no new variables? on left side of :=", "NoNewVar"),
+    (r"duplicate (field name|key|index) ", "DuplicateLitKey"),
+    (r"duplicate method |method .* already declared|field and method with the same name",
+     "DuplicateMethod"),
+    (r"cannot use \.\.\. in call to non-variadic", "NonVariadicDotDotDot"),
+    (r"(invalid operation: )?invalid use of \.\.\.", "InvalidDotDotDot"),
+    (r"can only use \.\.\. with final parameter", "MisplacedDotDotDot"),
+    (r"cannot use .* as .* value in .* \(overflows\)$", "NumericOverflow"),
+    (r"cannot use .* as .* value in ", "IncompatibleAssign"),
+    (r"invalid operation: .*mismatched types", "MismatchedTypes"),
+    (r"invalid operation: division by zero", "DivByZero"),
+    (r"invalid operation: (shift count|shifted operand|negative shift count|invalid shift count)"
+     r"|invalid shift count", "InvalidShiftCount"),
+    (r"invalid operation: operator .* not defined|invalid operation: .*\(operator "
+     r"|can only be compared to nil", "UndefinedOp"),
+    (r"invalid operation: cannot index|invalid argument: index ", "NonIndexableOperand"),
+    (r"invalid operation: cannot indirect", "InvalidIndirection"),
+    (r"invalid operation: cannot take address", "UnaddressableOperand"),
+    (r"invalid operation: .* is not an interface", "InvalidAssert"),
+    (r".* is not an interface", "InvalidTypeSwitch"),
+    (r"impossible type switch case", "ImpossibleAssert"),
+    (r"duplicate case .* in type switch", "DuplicateCase"),
+    (r"cannot slice|invalid operation: 3-index slice|invalid slice indices", "InvalidSliceExpr"),
+    (r"cannot assign to ", "UnassignableOperand"),
+    (r"constant .* overflows |.* overflows ", "NumericOverflow"),
+    (r"constant .* truncated |.* truncated to ", "TruncatedFloat"),
+    (r".* is not constant", "InvalidConstInit"),
+    (r"missing init expr|extra init expr", "WrongAssignCount"),
+    (r"assignment mismatch", "WrongAssignCount"),
+    (r"(not enough|too many) arguments", "WrongArgCount"),
+    (r"(not enough|too many) type arguments", "WrongTypeArgCount"),
+    (r"too many return values|not enough return values", "WrongResultCount"),
+    (r"missing return", "MissingReturn"),
+    (r".* is not used", "UnusedExpr"),
+    (r"declared and not used", "UnusedVar"),
+    (r"non-boolean condition", "InvalidCond"),
+    (r"break is not in|continue is not in", "MisplacedBreak"),
+    (r"fallthrough statement out of place|cannot fallthrough", "MisplacedFallthrough"),
+    (r"label .* defined and not used", "UnusedLabel"),
+    (r"label .* already defined", "DuplicateLabel"),
+    (r"label .* not defined|(break|continue) label not defined", "UndeclaredLabel"),
+    (r"invalid (break|continue) label", "MisplacedLabel"),
+    (r"goto .* jumps into block", "JumpIntoBlock"),
+    (r"goto .* jumps over", "JumpOverDecl"),
+    (r"multiple-value .* in single-value context", "TooManyValues"),
+    (r".* is not a type", "NotAType"),
+    (r".* is not an expression", "NotAnExpr"),
+    (r".* \(no value\) used as value", "TooManyValues"),
+    (r"cannot use iota outside", "InvalidIota"),
+    (r"cannot use _ as value", "InvalidBlank"),
+    (r"name .* not exported by package", "UnexportedName"),
+    (r"use of package .* without selector", "InvalidPkgUse"),
+    (r".* \(built-in\) must be called", "UncalledBuiltin"),
+    (r"invalid composite literal|missing type in composite literal|missing key in map",
+     "InvalidLit"),
+    (r"mixture of field:value|too few values in struct literal|invalid field name",
+     "InvalidStructLit"),
+    (r"invalid map key type", "IncomparableMapKey"),
+    (r"invalid receiver type|cannot define new methods", "InvalidRecv"),
+    (r"embedded field type cannot be", "InvalidPtrEmbed"),
+    (r"ambiguous selector", "AmbiguousSelector"),
+    (r"cannot use generic (function|type) .* without instantiation", "WrongTypeArgCount"),
+    (r"in call to .*, cannot infer", "CannotInferTypeArgs"),
+    (r".* does not satisfy ", "InvalidTypeArg"),
+    (r".* is not a generic type", "NotAGenericType"),
+    (r"invalid argument: ", "InvalidArg"),
+    (r"cannot convert ", "InvalidConversion"),
+    (r"mixed named and unnamed parameters", "BadDecl"),
+    (r"non-name on left side of :=", "BadDecl"),
+    (r"import cycle not allowed", "ImportCycle"),
+    (r"invalid recursive type", "InvalidDeclCycle"),
+    (r"initialization cycle", "InvalidInitCycle"),
+    (r"func init must have", "InvalidInitDecl"),
+    (r"invalid array length|array length .* must be", "InvalidArrayLen"),
+    (r"cannot find package|could not import|no required module provides", "BrokenImport"),
+    (r".* requires go1\.\d+ or later", "UnsupportedFeature"),
+]
+
+
+def code_of(message: str) -> Optional[str]:
+    """The code of an error reported without one, from its message"""
+    for pattern, code in codes:
+        if re.match(pattern, message):
+            return code
+    return None
+
+
+# all the diagnostics reported, in the order they were reported
+reported: List[Diagnostic] = []
+# if the diagnostics are printed as they are reported
+printing = True
+# the codes of the warnings which are not reported, like ShadowedVar
+suppressed: set = set()
+# the constructs of Go gopy doesn't support yet are errors in strict mode,
+# in permissive mode they are warnings and skipped, see unsupported
+strict = True
+
+
+def report(diagnostic: Diagnostic) -> Diagnostic:
+    """Prints and keeps the diagnostic, unless it is a warning whose code is
+    suppressed (the errors are always reported)"""
+    if diagnostic.code is None:
+        diagnostic.code = code_of(diagnostic.message)
+    if diagnostic.severity == "warning" and diagnostic.code in suppressed:
+        return diagnostic
+    if diagnostic.file is None:
+        diagnostic.file = utils.filename
+    for note in diagnostic.notes:
+        if note.file is None:
+            note.file = diagnostic.file
+    reported.append(diagnostic)
+    if printing:
+        print_diagnostic(diagnostic)
+    return diagnostic
+
+
+def error(message: str, lineno: Optional[int] = None, col_num: Optional[int] = None,
+          width: int = 1, kind: str = "SYNTAX ERROR", **kwargs) -> Diagnostic:
+    """Reports an error at the span of width characters at lineno, col_num"""
+    return report(Diagnostic(message, lineno, col_num, width, kind=kind, **kwargs))
+
+
+def unsupported(message: str, lineno: Optional[int] = None, col_num: Optional[int] = None,
+                width: int = 1, kind: str = "TYPE ERROR", **kwargs) -> Diagnostic:
+    """The diagnostic of a construct gopy doesn't support yet, like a dot
+    import: an error in strict mode, else a warning (the construct is skipped
+    by the stage which found it). It is not reported, see report"""
+    severity = "error" if strict else "warning"
+    return Diagnostic(message, lineno, col_num, width, kind=kind, severity=severity,
+                      code="NotYetSupported", **kwargs)
+
+
+def errors() -> List[Diagnostic]:
+    """The errors reported, not the warnings"""
+    return [d for d in reported if d.severity == "error"]
+
+
+def clear():
+    reported.clear()
+
+
+@contextmanager
+def muted():
+    """The diagnostics reported in the block are neither printed nor kept,
+    for code which is checked again later, like the one scanned for imports"""
+    global printing
+    was_printing, count = printing, len(reported)
+    printing = False
+    try:
+        yield
+    finally:
+        printing = was_printing
+        del reported[count:]
+
+
+def print_diagnostic(diagnostic: Diagnostic):
+    kind = diagnostic.kind if diagnostic.severity == "error" else diagnostic.severity.upper()
+    print_error(diagnostic.message, kind=kind)
+    print_location(diagnostic)
+    for note in diagnostic.notes:
+        print(note.message)
+        print_location(note)
+    if diagnostic.fix is not None:
+        print(f"suggested fix: {diagnostic.fix.message}")
+
+
+def print_diagnostics(diagnostics: List[Diagnostic]):
+    for diagnostic in diagnostics:
+        print_diagnostic(diagnostic)
+
+
+def print_location(diagnostic: Diagnostic):
+    if diagnostic.file in utils.sources:
+        utils.set_file(diagnostic.file)
+    lineno, col_num = diagnostic.lineno, diagnostic.col_num
+    if lineno is None or not 0 < lineno <= len(utils.lines):
+        return
+    if col_num is None:
+        print(f"at line {lineno}")
+        print_line_marker_nowhitespace(lineno)
+    else:
+        print(f"at line {lineno}, column {col_num}")
+        print_line(lineno)
+        print_marker(col_num - 1, diagnostic.width)
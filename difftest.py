@@ -0,0 +1,213 @@
+import os
+import re
+import sys
+import shutil
+import difflib
+import tempfile
+import subprocess
+
+from conformance import programs
+from dataclasses import dataclass
+from typing import List, Optional
+
+
+# The differential testing of the backends (go_parser.py difftest): each
+# program is built by the go command and run, and run by gopy with each
+# engine given (the interpreter, the VM, or the modules of the python
+# backend), with the same arguments and standard input, and what they
+# print to stdout and to stderr and their exit statuses are compared. The
+# programs are built with go build, not go run, whose exit status is 1
+# whatever the one of the program. The packages a program imports are the
+# subdirectories of its directory, like for the loader, so the program is
+# built in GOPATH mode, from a copy of them, unless its directory has a
+# go.mod. The traces of the panics are compared without what only Go
+# prints: the program counters, the arguments of the frames and the
+# signals. A program go doesn't build must not build with gopy either,
+# the errors themselves are not compared (see conformance.py for them)
+#
+#   python go_parser.py difftest --exec interp,vm,python tests
+
+here = os.path.dirname(os.path.abspath(__file__))
+engines = ("interp", "vm", "python")
+
+
+@dataclass
+class Result:
+    """What a program printed, and its exit status (None if it timed out).
+    built is false if it didn't build, stderr has the errors then"""
+
+    stdout: str
+    stderr: str
+    status: Optional[int]
+    built: bool = True
+
+
+def run_command(command: List[str], stdin: bytes, timeout: float, cwd: Optional[str] = None,
+                env: Optional[dict] = None) -> Result:
+    try:
+        done = subprocess.run(command, input=stdin, capture_output=True, timeout=timeout,
+                              cwd=cwd, env=env)
+    except subprocess.TimeoutExpired as e:
+        return Result(text(e.stdout), text(e.stderr), None)
+    return Result(text(done.stdout), text(done.stderr), done.returncode)
+
+
+def text(output: Optional[bytes]) -> str:
+    return (output or b"").decode("utf-8", "replace")
+
+
+def run_go(go: str, program: str, args: List[str], stdin: bytes, timeout: float) -> Result:
+    """Builds the program with go and runs it, the paths of its files in
+    the traces are the ones of the program"""
+    program = os.path.abspath(program)
+    root = program if os.path.isdir(program) else os.path.dirname(program)
+    with tempfile.TemporaryDirectory(prefix="gopy-difftest-") as dir:
+        binary = os.path.join(dir, "program")
+        env = dict(os.environ)
+        if os.path.exists(os.path.join(root, "go.mod")):
+            build = [go, "build", "-o", binary, "." if root == program else program]
+            cwd = root
+            moved = {}
+        else:
+            # the main package, and the packages it imports by their path
+            src = os.path.join(dir, "src")
+            shutil.copytree(root, src, ignore=lambda d, names: [
+                n for n in names if not os.path.isdir(os.path.join(d, n))])
+            main = os.path.join(src, "_main")
+            os.makedirs(main)
+            files = [program] if root != program else [
+                os.path.join(root, n) for n in os.listdir(root)
+                if n.endswith(".go") and not n.endswith("_test.go")]
+            for filename in files:
+                shutil.copy(filename, main)
+            build = [go, "build", "-o", binary, "."]
+            cwd = main
+            env.update(GO111MODULE="off", GOPATH=dir)
+            moved = {main: root, src: root}
+        built = run_command(build, b"", timeout, cwd, env)
+        if built.status != 0:
+            return Result("", built.stdout + built.stderr, 1, built=False)
+        if not os.access(binary, os.X_OK):
+            # the archive of a package other than main, go run doesn't run it
+            return Result("", f"{program} is not a main package", 1, built=False)
+        result = run_command([binary] + args, stdin, timeout)
+    for copy, original in moved.items():
+        result.stderr = result.stderr.replace(copy + os.sep, original + os.sep)
+    return result
+
+
+def run_gopy(engine: str, program: str, args: List[str], stdin: bytes,
+             timeout: float) -> Result:
+    """Runs the program with the engine of gopy, interp and vm with
+    go_parser.py run, python builds its modules and runs them"""
+    program = os.path.abspath(program)
+    go_parser = os.path.join(here, "go_parser.py")
+    if engine != "python":
+        return run_command([sys.executable, go_parser, "run", "--exec", engine, program]
+                           + args, stdin, timeout)
+    with tempfile.TemporaryDirectory(prefix="gopy-difftest-") as dir:
+        built = run_command([sys.executable, go_parser, "build", "--target=python", "-o", dir,
+                             program], b"", timeout)
+        if built.status != 0:
+            return Result("", built.stdout + built.stderr, 1, built=False)
+        return run_command([sys.executable, os.path.join(dir, "main.py")] + args, stdin,
+                           timeout)
+
+
+def normalize(stderr: str) -> str:
+    """stderr without what only Go prints in the traces: the program
+    counters of the frames (+0x1d), the arguments of the calls (which
+    are words of memory) and the signals of the runtime errors"""
+    lines = []
+    trace = False
+    for line in stderr.splitlines():
+        if re.match(r"goroutine \d+ \[", line):
+            trace = True
+        elif not line:
+            trace = False
+        elif line.startswith("[signal "):
+            continue
+        elif trace and line.startswith("\t"):
+            line = re.sub(r" \+0x[0-9a-f]+$", "", line)
+        elif trace and line.endswith(")") and not line.startswith("created by "):
+            line = line[:call_start(line)] + "(...)"
+        lines.append(line)
+    return "\n".join(lines)
+
+
+def call_start(line: str) -> int:
+    """The index of the parenthesis starting the arguments of the frame"""
+    depth = 0
+    for i in range(len(line) - 1, -1, -1):
+        depth += {")": 1, "(": -1}.get(line[i], 0)
+        if depth == 0:
+            return i
+    return len(line)
+
+
+def compare(go: Result, gopy: Result, engine: str, timeout: float) -> List[str]:
+    """The differences between what go and the engine did"""
+    if not go.built:
+        # gopy reports the errors with the exit status 1, like go run
+        if gopy.built and gopy.status != 1:
+            return [f"go doesn't build it, {engine} runs it:", *indent(go.stderr.splitlines())]
+        return []
+    if gopy.status is None:
+        return [f"{engine} timed out after {timeout:g}s"]
+    if go.status is None:
+        return [f"go timed out after {timeout:g}s"]
+    if not gopy.built:
+        return [f"{engine} doesn't build it:", *indent(gopy.stderr.splitlines())]
+    found = []
+    if go.status != gopy.status:
+        found.append(f"exit status: go {go.status}, {engine} {gopy.status}")
+    for name, theirs, mine in (("stdout", go.stdout, gopy.stdout),
+                               ("stderr", normalize(go.stderr), normalize(gopy.stderr))):
+        if theirs != mine:
+            found.append(f"{name}:")
+            found.extend(indent(diff(theirs, mine, engine)))
+    return found
+
+
+def diff(theirs: str, mine: str, engine: str, context: int = 3, limit: int = 40) -> List[str]:
+    lines = list(difflib.unified_diff(theirs.splitlines(), mine.splitlines(), "go", engine,
+                                      n=context, lineterm=""))
+    if len(lines) > limit:
+        lines = lines[:limit] + [f"... {len(lines) - limit} more lines"]
+    return lines
+
+
+def indent(lines: List[str]) -> List[str]:
+    return ["    " + line for line in lines]
+
+
+def difftest(paths: List[str], selected: List[str], go: Optional[str], args: List[str],
+             stdin: bytes = b"", timeout: float = 60) -> int:
+    """Compares the engines selected with go on the programs of the paths
+    (see conformance.programs), returns the exit status: 1 if any of them
+    differs, 0 if they all match (or there is no go command)"""
+    if go is None or shutil.which(go) is None:
+        print(f"gopy difftest: no go command{f' {go}' if go else ''}, "
+              "the programs are not compared", file=sys.stderr)
+        return 0
+    failed = 0
+    found = programs(paths)
+    for program in found:
+        expected = run_go(go, program, args, stdin, timeout)
+        mismatches = []
+        for engine in selected:
+            differences = compare(expected, run_gopy(engine, program, args, stdin, timeout),
+                                  engine, timeout)
+            if differences:
+                mismatches.append(engine)
+                print(f"--- FAIL: {program} ({engine})")
+                print("\n".join(indent(differences)))
+        if mismatches:
+            failed += 1
+            print(f"FAIL\t{program}\t{', '.join(mismatches)}")
+        else:
+            print(f"ok  \t{program}\t{', '.join(selected)}" +
+                  ("" if expected.built else "\t(doesn't build)"))
+    print(f"FAIL ({failed} of {len(found)} programs)" if failed else
+          f"ok ({len(found)} programs)")
+    return 1 if failed else 0
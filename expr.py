@@ -0,0 +1,359 @@
+import io
+import os
+import sys
+import argparse
+import contextlib
+import cancel
+import checker
+import constant
+import diagnostics
+import go_lexer
+import go_parser
+import interp
+import syntree
+import untyped
+import utils
+
+from typing import Any, Dict, List, Optional, Tuple
+from checker import basic_typename, in_order, underlying
+
+
+# Evaluation of a single Go expression, for the programs embedding gopy as
+# an expression engine (like types.Eval, but the expression is run too):
+#
+#   scope = expr.Scope(imports=["strings"])
+#   scope.var("name", "string", "gopher")
+#   scope.var("n", "int", 3)
+#   value, t = expr.eval_expr("strings.Repeat(name, n)", scope)
+#
+# gives "gophergophergopher" and the type string. The names of the scope
+# are the variables given (with their Go type and their value), the
+# packages imported and the declarations (types, constants and functions)
+# given as Go source, see Scope. The expression is lexed on its own first,
+# so that it can't end main and declare more (its brackets have to match),
+# then it is checked as the only statement of the main function of a
+# program declaring them, one of utils.overlays (nothing is written to the
+# disk). The values of the variables are converted to the ones of the
+# interpreter (see to_go) and the value of the expression back to python
+# (see to_python).
+# The errors of the expression, and the panics, are raised as an EvalError,
+# with their position in the expression, and so is its evaluation aborted
+# past max_steps steps or once ctx is done, like the runs of playground.py:
+#
+#   ctx = cancel.with_timeout(cancel.background(), 1.0)
+#   expr.eval_expr("func() int { for {} }()", ctx=ctx)  # EvalError after 1s
+#
+#   python expr.py -import strings -var "n int 3" "strings.Repeat(\"ab\", n)"
+#
+# prints the value of an expression and its type.
+
+
+# the file of the program evaluating an expression, in no directory of the
+# disk
+path = os.path.join(os.sep, "gopy-expr", "main.go")
+
+
+class EvalError(Exception):
+    """The errors of an expression, or its panic, positions are
+    lineno:col_num in the expression"""
+
+    def __init__(self, message: str, errors: Optional[List[diagnostics.Diagnostic]] = None):
+        super().__init__(message)
+        self.errors = errors or []
+
+
+class Scope:
+    """The names an expression is evaluated with: the packages imported,
+    the package level declarations and the variables, by name, with
+    their type (Go source, like []string) and their value"""
+
+    def __init__(self, imports: Optional[List[str]] = None, decls: Optional[List[str]] = None):
+        self.imports: List[str] = list(imports or [])
+        self.decls: List[str] = list(decls or [])
+        self.variables: Dict[str, Tuple[str, Any]] = {}
+
+    def var(self, name: str, type_: str, value: Any = None) -> "Scope":
+        """Declares the variable name of type type_, value is its python value
+        (None for the zero value)"""
+        self.variables[name] = (type_, value)
+        return self
+
+    def import_(self, path: str) -> "Scope":
+        if path not in self.imports:
+            self.imports.append(path)
+        return self
+
+    def declare(self, decl: str) -> "Scope":
+        """Adds a package level declaration, like type Point struct{ x, y int }"""
+        self.decls.append(decl)
+        return self
+
+    def source(self, src: str) -> Tuple[str, int]:
+        """The program evaluating src, with the line src starts at"""
+        lines = ["package main", ""]
+        lines.extend(f"import {quote(path)}" for path in self.imports)
+        for decl in self.decls:
+            lines.extend(decl.split("\n"))
+        lines.extend(f"var {name} {t}" for name, (t, _) in self.variables.items())
+        lines.append("func main() {")
+        start = len(lines) + 1
+        lines.extend(src.split("\n"))
+        lines.append("}")
+        return "\n".join(lines) + "\n", start
+
+
+def quote(path: str) -> str:
+    return '"' + path.replace("\\", "\\\\").replace('"', '\\"') + '"'
+
+
+def eval_expr(src: str, scope: Optional[Scope] = None, ctx: Optional[cancel.Context] = None,
+              max_steps: Optional[int] = 1_000_000) -> Tuple[Any, Any]:
+    """Checks and evaluates the expression src with the names of scope
+
+    Returns its value (as a python value, see to_python) and its type (a
+    syntree.Type, None for an untyped nil or the calls without results). The
+    value of a call with several results is a tuple, and so is its type.
+    The untyped constants have the value and the type of their default
+    type. Raises an EvalError if the expression has errors, if it panics,
+    or if it is aborted: the check and the evaluation once ctx is done, and
+    the evaluation after max_steps steps (see interp.Interpreter.step), None
+    for no limit"""
+    scope = scope or Scope()
+    stray = stray_token(src)
+    if stray is not None:
+        what = f"unexpected {stray.value}" if stray.type in (")", "]", "}") \
+            else "statement after the expression"
+        raise EvalError(f"{stray.lineno}:{go_lexer.find_column(stray.lexpos)}: {what}")
+    source, start = scope.source(src)
+    end = start + len(src.split("\n"))
+    utils.overlays[path] = source
+    info = checker.Info()
+    diagnostics.clear()
+    go_parser.parse_errors = 0
+    printing, diagnostics.printing = diagnostics.printing, False
+    try:
+        with contextlib.redirect_stdout(io.StringIO()):
+            packages = go_parser.check_program(path, verbose=False, info=info, ctx=ctx)
+    except cancel.ContextError as e:
+        raise EvalError(str(e))
+    finally:
+        diagnostics.printing = printing
+        utils.overlays.pop(path, None)
+
+    errors = [
+        d for d in diagnostics.errors()
+        # src is an expression statement, its value is used
+        if d.code not in ("UnusedExpr", "UnusedImport")
+    ]
+    if errors or not packages or go_parser.parse_errors:
+        raise EvalError(error_message(errors, start, end), errors)
+    ast = packages[-1].ast
+    body = in_order(main_function(ast).body)
+    if len(body) != 1 or body[0] not in info.operands or isinstance(
+            body[0], (syntree.Assignment, syntree.VarDecl)):
+        raise EvalError(f"{src.strip()} is not an expression")
+    node = body[0]
+    x = info.operands[node]
+    if x.mode in ("type", "builtin", "package", "invalid"):
+        raise EvalError(f"{src.strip()} ({x.mode}) is not a value")
+    if x.mode == "constant" and x.constant.is_untyped:
+        # its value is the one of its default type, which it has to fit in
+        try:
+            constant.convert(x.constant, basic_typename(x.type_))
+        except constant.ConstError:
+            lineno, col_num, _ = checker.position(node)
+            raise EvalError(
+                f"{lineno - start + 1}:{col_num}: cannot use {checker.describe(x)} as "
+                f"{checker.type_string(x.type_)} value (overflows)"
+            )
+
+    interpreter = interp.Interpreter(info)
+    interpreter.ctx = ctx
+    interpreter.max_steps = max_steps
+    # calls nest a few python frames for each Go frame
+    sys.setrecursionlimit(max(sys.getrecursionlimit(), 20000))
+    try:
+        for package in packages[:-1]:
+            interpreter.load_package(package)
+        env = interp.Env(interpreter.universe)
+        interpreter.declare_package(ast, env)
+        for decl in interp.package_decls(ast):
+            if isinstance(decl, syntree.VarDecl) and decl.ident.ident_name in scope.variables:
+                _, value = scope.variables[decl.ident.ident_name]
+                if value is not None:
+                    env.lookup(decl.ident.ident_name).set(to_go(value, decl.type_))
+        interpreter.frames[0].fn = main_function(ast)
+        value = interpreter.eval(node, interp.Env(env))
+    except interp.Panic as p:
+        raise EvalError(f"panic: {interpreter.format(p.value)}")
+    except interp.Unsupported as e:
+        raise EvalError(f"{e} by the interpreter")
+    except (interp.Aborted, cancel.ContextError) as e:
+        raise EvalError(str(e))
+    except RecursionError:
+        raise EvalError("stack overflow")
+
+    if x.mode == "novalue":
+        return None, None
+    if x.mode == "tuple":
+        return (tuple(to_python(v, t) for v, t in zip(value, x.tuple_types)),
+                tuple(x.tuple_types))
+    if x.mode == "nil":
+        return None, None
+    if x.mode == "constant":
+        value = interpreter.constant_value(x.constant, None if x.constant.is_untyped else x.type_)
+    return to_python(value, x.type_), x.type_
+
+
+def stray_token(src: str) -> Optional[Any]:
+    """The token of src (lexed on its own) which isn't part of a single
+    expression: a bracket closing one it doesn't open, like the } which
+    would end main, or the start of another statement. None if there is
+    none, the brackets left open are errors of the check"""
+    diagnostics.clear()
+    tokens = go_lexer.tokenize(src)
+    diagnostics.clear()
+    depth = 0
+    for i, tok in enumerate(tokens):
+        if tok.type in ("(", "[", "{", "LIT_LBRACE"):
+            depth += 1
+        elif tok.type in (")", "]", "}"):
+            depth -= 1
+            if depth < 0:
+                return tok
+        elif tok.type == ";" and depth == 0 and i + 1 < len(tokens):
+            return tokens[i + 1]
+    return None
+
+
+def error_message(errors: List[diagnostics.Diagnostic], start: int, end: int) -> str:
+    """The errors, the ones in the expression with their position in it"""
+    messages = []
+    for d in errors:
+        if d.lineno is not None and start <= d.lineno < end:
+            messages.append(f"{d.lineno - start + 1}:{d.col_num}: {d.message}")
+        else:
+            messages.append(d.message)
+    return "\n".join(messages) or "the expression can't be checked"
+
+
+def main_function(ast: syntree.Node) -> syntree.Function:
+    for decl in interp.package_decls(ast):
+        if (isinstance(decl, syntree.Function) and not isinstance(decl, syntree.Method)
+                and decl.fn_name[1] == "main"):
+            return decl
+    raise LookupError("no main function")
+
+
+# the Go type of the python values boxed in an interface
+_python_types = {bool: "bool", int: "int", float: "float64", complex: "complex128", str: "string"}
+
+
+def to_go(value: Any, t: Optional[syntree.Type]) -> Any:
+    """The value of the interpreter for the python value of type t: strings
+    are bytes, lists are slices (or arrays), dicts are maps (or structs,
+    by field name), the values of an interface are boxed with the Go type
+    of their python type. The other values are the ones of the interpreter"""
+    if t is None:
+        return value
+    u = underlying(t)
+    if isinstance(value, str) and untyped.kind_of_typename(basic_typename(u) or "") == "string":
+        return value.encode("utf-8", "surrogateescape")
+    if isinstance(value, float) and basic_typename(u) == "float32":
+        return interp.round_float32(value)
+    if isinstance(u, syntree.Slice) and isinstance(value, (list, tuple)):
+        array = [to_go(v, u.eltype) for v in value]
+        return interp.SliceValue(array, 0, len(array), len(array))
+    if isinstance(u, syntree.Array) and isinstance(value, (list, tuple)):
+        return [to_go(v, u.eltype) for v in value]
+    if isinstance(u, syntree.Map) and isinstance(value, dict):
+        m = interp.MapValue(t)
+        for k, v in value.items():
+            k = to_go(k, u.key)
+            m.entries[interp.key_of(k)] = (k, to_go(v, u.eltype))
+        return m
+    if isinstance(u, syntree.Struct) and isinstance(value, dict):
+        return interp.StructValue(t, {
+            f.f_name: to_go(value[f.f_name], f.type_) for f in u.fields if f.f_name in value
+        })
+    if syntree.is_interface(u) and type(value) in _python_types:
+        boxed = checker.universe().objects[_python_types[type(value)]].type_
+        return interp.Boxed(boxed, to_go(value, boxed))
+    return value
+
+
+def to_python(value: Any, t: Optional[syntree.Type]) -> Any:
+    """The python value of a value of the interpreter of type t, the reverse
+    of to_go: the values of interfaces are unboxed, structs are dicts of
+    their fields. Pointers, functions and channels are left as they are"""
+    if isinstance(value, interp.Boxed):
+        return to_python(value.value, value.type_)
+    if isinstance(value, bytes):
+        return value.decode("utf-8", "surrogateescape")
+    u = underlying(t) if t is not None else None
+    if isinstance(value, interp.SliceValue):
+        eltype = u.eltype if isinstance(u, syntree.Slice) else None
+        return [to_python(v, eltype) for v in value.elements()]
+    if isinstance(value, list):
+        eltype = u.eltype if isinstance(u, syntree.Array) else None
+        return [to_python(v, eltype) for v in value]
+    if isinstance(value, interp.MapValue):
+        key, eltype = (u.key, u.eltype) if isinstance(u, syntree.Map) else (None, None)
+        return {to_python(k, key): to_python(v, eltype) for k, v in value.entries.values()}
+    if isinstance(value, interp.StructValue):
+        fields = {f.f_name: f.type_ for f in underlying(value.type_).fields}
+        return {name: to_python(v, fields.get(name)) for name, v in value.fields.items()}
+    return value
+
+
+def main(argv: List[str]) -> int:
+    arg_parser = argparse.ArgumentParser(
+        prog="expr.py", description="Prints the value of a Go expression, with its type"
+    )
+    arg_parser.add_argument("expression")
+    arg_parser.add_argument("-import", dest="imports", action="append", default=[],
+                            metavar="PATH", help="a package the expression uses")
+    arg_parser.add_argument("-var", dest="variables", action="append", default=[],
+                            metavar='"NAME TYPE VALUE"',
+                            help="a variable, its value is a Go expression of its type")
+    arg_parser.add_argument("-timeout", type=cancel.parse_duration, metavar="DURATION",
+                            help="aborts the check and the evaluation once they take longer "
+                                 "than DURATION (like 10s or 1m30s)")
+    arg_parser.add_argument("-max-steps", type=int, default=1_000_000, metavar="N",
+                            help="aborts the evaluation after N steps (1000000 by default, "
+                                 "0 for no limit)")
+    args = arg_parser.parse_args(argv)
+    ctx = None
+    if args.timeout is not None:
+        ctx = cancel.with_timeout(cancel.background(), args.timeout)
+    max_steps = args.max_steps or None
+
+    scope = Scope(args.imports)
+    for var in args.variables:
+        name, t, value = (var.split(None, 2) + [""])[:3]
+        if not value:
+            scope.var(name, t)
+            continue
+        # the value of the variable is the one of its expression
+        try:
+            scope.var(name, t, eval_expr(f"{t}({value})", Scope(args.imports), ctx,
+                                         max_steps)[0])
+        except EvalError as e:
+            print(f"-var {name}: {e}", file=sys.stderr)
+            return 1
+    try:
+        value, t = eval_expr(args.expression, scope, ctx, max_steps)
+    except EvalError as e:
+        print(e, file=sys.stderr)
+        return 1
+    if isinstance(t, tuple):
+        print(f"{value} ({', '.join(checker.type_string(x) for x in t)})")
+    elif t is not None:
+        print(f"{value!r} ({checker.type_string(t)})")
+    else:
+        print(value)
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
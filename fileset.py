@@ -0,0 +1,133 @@
+import re
+import bisect
+
+from dataclasses import dataclass
+from typing import Dict, List, Optional
+
+
+# Positions in the source of the files of a program, like go/token. A
+# position (a Pos) is an int: the files added to a FileSet get a range of
+# them each, one after the other, so a position maps back to the file it
+# is in, and to its offset, line and column in it. The span of a token or
+# a node is its pos and its end, the position right after it.
+# A FileSet also interns the texts of the tokens of its files.
+
+# no position, like the one of the nodes made by postprocess_AST
+NoPos = 0
+
+
+@dataclass
+class Position:
+    """A position in a file, lines and columns start at 1 (it is
+    invalid if line is 0). Columns count characters, not bytes"""
+
+    filename: Optional[str]
+    offset: int
+    line: int
+    column: int
+
+    def is_valid(self) -> bool:
+        return self.line > 0
+
+    def __str__(self):
+        if not self.is_valid():
+            return self.filename or "-"
+        if not self.filename:
+            return f"{self.line}:{self.column}"
+        return f"{self.filename}:{self.line}:{self.column}"
+
+
+class File:
+    """A file of a FileSet, its positions are base up to base + size (the
+    end of the file)"""
+
+    def __init__(self, name: Optional[str], base: int, source: str):
+        self.name = name
+        self.base = base
+        self.size = len(source)
+        # the offsets the lines start at
+        self.lines = [0] + [m.end() for m in re.finditer("\n", source)]
+
+    def extend(self, text: str):
+        """Appends text to the source of the file, one read as a stream"""
+        self.lines.extend(self.size + m.end() for m in re.finditer("\n", text))
+        self.size += len(text)
+
+    def pos(self, offset: int) -> int:
+        return self.base + offset
+
+    def offset(self, pos: int) -> int:
+        return pos - self.base
+
+    def line_start(self, line: int) -> int:
+        """The position of the first character of line"""
+        return self.base + self.lines[line - 1]
+
+    def line_end(self, line: int) -> int:
+        """The position of the end of line, its newline"""
+        if line < len(self.lines):
+            return self.base + self.lines[line] - 1
+        return self.base + self.size
+
+    def position(self, pos: int) -> Position:
+        offset = pos - self.base
+        index = bisect.bisect_right(self.lines, offset) - 1
+        return Position(self.name, offset, index + 1, offset - self.lines[index] + 1)
+
+    def __repr__(self):
+        return f"File({self.name!r}, {self.base}, {self.size})"
+
+
+class FileSet:
+    """The files of a program, see File"""
+
+    def __init__(self):
+        # the base of the next file, positions start at 1 (0 is NoPos)
+        self.base = 1
+        self.files: List[File] = []
+        self.bases: List[int] = []
+        # the texts of the identifiers and the short literals of the files,
+        # shared by their tokens and the nodes made of them, see intern
+        self.strings: Dict[str, str] = {}
+
+    def add_file(self, name: Optional[str], source: str) -> File:
+        file = File(name, self.base, source)
+        # the end of a file is a position, the one of its last token
+        self.base += file.size + 1
+        self.files.append(file)
+        self.bases.append(file.base)
+        return file
+
+    def extend(self, file: File, text: str):
+        """Appends text to the source of file, the last file added while it
+        is read as a stream (see go_lexer.stream)"""
+        file.extend(text)
+        self.base = file.base + file.size + 1
+
+    def intern(self, text: str) -> str:
+        """The string equal to text the files share, text the first time"""
+        return self.strings.setdefault(text, text)
+
+    def forget_strings(self):
+        """Forgets the strings interned, the texts of the files added
+        afterwards don't share them (see loader.load, each program loaded
+        interns its own, so they don't pile up in a long running process)"""
+        self.strings.clear()
+
+    def file(self, pos: int) -> Optional[File]:
+        """The file pos is in, None for NoPos (or a position of another
+        FileSet)"""
+        index = bisect.bisect_right(self.bases, pos) - 1
+        if pos == NoPos or index < 0 or pos > self.files[index].base + self.files[index].size:
+            return None
+        return self.files[index]
+
+    def position(self, pos: int) -> Position:
+        file = self.file(pos)
+        if file is None:
+            return Position(None, 0, 0, 0)
+        return file.position(pos)
+
+
+# the files parsed, the positions of the tokens and the nodes are in it
+fset = FileSet()
@@ -0,0 +1,344 @@
+import io
+import os
+import gc
+import sys
+import glob
+import random
+import shutil
+import signal
+import hashlib
+import weakref
+import argparse
+import tempfile
+import traceback
+import contextlib
+
+from typing import Callable, List, Optional
+
+import checker
+import diagnostics
+import fileset
+import go_lexer
+import go_parser
+import loader
+import syntree
+import utils
+
+
+# Fuzzing of the lexer, the parser and the type checker. Each target takes
+# random bytes as the source of a file: whatever they are, the errors in
+# it must be reported as diagnostics, the target must not raise (nor hang).
+# The stream target checks go_lexer.stream lexes it like tokenize, and the
+# arena one that the nodes of syntree.Arena are released.
+# The inputs are mutations of a corpus of Go files, like the tests. With
+# atheris (pip install atheris) the mutations are the ones of libFuzzer,
+# guided by the coverage of the Python code, else they are random edits
+# and insertions of Go tokens. The inputs which crash are written to the
+# crashes directory, to be replayed:
+#
+#   python fuzz.py parser tests --runs 5000
+#   python fuzz.py parser --replay crashes/crash-*.go
+
+# the characters stream reads at a time in fuzz_stream, instead of the 64K
+# of go_lexer.chunk_size
+stream_chunk_size = 64
+
+# the files parsed by the targets, the source of the package main of a program
+workdir = tempfile.mkdtemp(prefix="gopy-fuzz-")
+source_path = os.path.join(workdir, "main.go")
+
+
+def reset():
+    """Forgets what was found in the inputs before"""
+    diagnostics.clear()
+    go_parser.parse_errors = 0
+    syntree.type_refs.clear()
+    # the references of the parser to the nodes of the last package parsed
+    go_parser.ast = syntree.Node("start", children=[])
+    go_parser.commented.clear()
+    go_parser.imported.clear()
+    go_parser.forward_types.clear()
+    go_parser.forward_values.clear()
+    go_parser.forward_type_params = None
+    go_parser.type_switches.clear()
+    go_parser.const_decl = go_parser.ConstDeclState()
+    go_parser.parser.symstack = []
+    go_lexer.symtab.switch([])
+
+
+def write_source(data: bytes) -> str:
+    reset()
+    with open(source_path, "wb") as f:
+        f.write(data)
+    return source_path
+
+
+def fuzz_lexer(data: bytes):
+    """Lexes data, like go_lexer.py does"""
+    go_lexer.tokenize(utils.read_source(write_source(data)))
+
+
+def fuzz_stream(data: bytes):
+    """Lexes data with go_lexer.stream, reading stream_chunk_size characters
+    at a time, so it is lexed by many segments: the tokens, and the errors
+    reported, are the ones of tokenize"""
+    path = write_source(data)
+    tokens = [token_key(tok) for tok in go_lexer.tokenize(utils.read_source(path))]
+    found = [(d.message, d.lineno, d.col_num) for d in diagnostics.reported]
+    diagnostics.clear()
+    chunk_size, go_lexer.chunk_size = go_lexer.chunk_size, stream_chunk_size
+    try:
+        with open(path, encoding="utf-8", errors="surrogateescape") as reader:
+            streamed = [token_key(tok) for tok in go_lexer.stream(reader)]
+    finally:
+        go_lexer.chunk_size = chunk_size
+    for i, (tok, other) in enumerate(zip(tokens, streamed)):
+        if tok != other:
+            raise AssertionError(f"token {i} streamed is {other}, not {tok}")
+    if len(tokens) != len(streamed):
+        raise AssertionError(f"{len(streamed)} tokens streamed, not {len(tokens)}")
+    streamed_found = [(d.message, d.lineno, d.col_num) for d in diagnostics.reported]
+    if streamed_found != found:
+        raise AssertionError(f"the errors streamed are {streamed_found}, not {found}")
+
+
+def token_key(tok) -> tuple:
+    return tok.type, tok.value, tok.lineno, tok.lexpos, tok.pos, tok.end
+
+
+def fuzz_parser(data: bytes):
+    """Parses data, the source of the package main of a program, and
+    the packages it imports (only the ones of the standard library). The
+    nodes are freed afterwards, see syntree.Arena"""
+    packages = loader.load(write_source(data))
+    with syntree.Arena() as arena:
+        for package in packages:
+            go_parser.parse_package(package, package is not packages[-1])
+    arena.free()
+
+
+def fuzz_checker(data: bytes):
+    """Parses and type checks data, like go_parser.py does without
+    generating the intermediate code"""
+    with syntree.Arena() as arena:
+        go_parser.check_program(write_source(data), verbose=False, info=checker.Info(),
+                                warnings=True)
+    arena.free()
+
+
+def fuzz_arena(data: bytes):
+    """Parses and type checks data in an arena, like fuzz_checker: once
+    it is freed, and what was found forgotten, none of the nodes made is
+    referenced anymore. Nor are the strings interned before (see
+    fileset.FileSet.forget_strings)"""
+    fileset.fset.intern(stale_string)
+    with syntree.Arena() as arena:
+        go_parser.check_program(write_source(data), verbose=False, info=checker.Info(),
+                                warnings=True)
+    if stale_string in fileset.fset.strings:
+        raise AssertionError("the strings interned before the program was loaded are kept")
+    nodes = [weakref.ref(node) for node in arena.nodes]
+    arena.free()
+    reset()
+    # the cycles of the objects of the type checker, which aren't nodes
+    gc.collect()
+    alive = sum(node() is not None for node in nodes)
+    if alive:
+        raise AssertionError(f"{alive} of the {len(nodes)} nodes are referenced once freed")
+
+
+# a string interned before fuzz_arena loads a program, none of its tokens
+stale_string = "\0 interned before"
+
+
+targets = {"lexer": fuzz_lexer, "stream": fuzz_stream, "parser": fuzz_parser,
+           "checker": fuzz_checker, "arena": fuzz_arena}
+
+
+class Timeout(Exception):
+    """The target took too long with an input, it probably loops forever"""
+
+
+def on_alarm(signum, frame):
+    raise Timeout()
+
+
+def run_one(target: Callable, data: bytes, timeout: float = 0) -> Optional[str]:
+    """Runs the target with data, returns the traceback if it raised (or
+    took more than timeout seconds), None if it didn't"""
+    printing, diagnostics.printing = diagnostics.printing, False
+    if timeout:
+        signal.signal(signal.SIGALRM, on_alarm)
+        signal.setitimer(signal.ITIMER_REAL, timeout)
+    try:
+        with contextlib.redirect_stdout(io.StringIO()):
+            target(data)
+    except Timeout:
+        return f"Timeout: more than {timeout}s\n"
+    except Exception:
+        return traceback.format_exc()
+    finally:
+        if timeout:
+            signal.setitimer(signal.ITIMER_REAL, 0)
+        diagnostics.printing = printing
+    return None
+
+
+# what the mutations insert, parts of the syntax most likely to be
+# in an unusual place (or missing) in a program someone is writing
+tokens = [
+    b"package", b"import", b"const", b"var", b"type", b"func", b"iota", b"map", b"chan",
+    b"struct", b"interface", b"go", b"defer", b"return", b"for", b"range", b"switch",
+    b"case", b"default", b"if", b"else", b"(", b")", b"[", b"]", b"{", b"}", b"[...]",
+    b"=", b":=", b",", b";", b".", b"..", b"...", b"*", b"&", b"<-", b"~", b"|", b"+",
+    b"<<", b"\n", b"'", b'"', b"`", b"/*", b"//", b"0x", b"1e", b"1", b"_", b"x",
+    b"int", b"T", b"\\", b"\t", b"\x00", b"\xff",
+]
+
+
+def mutate(data: bytes, rng: random.Random) -> bytes:
+    """data with 1 to 4 random edits: parts removed, repeated or
+    replaced by random bytes, and tokens inserted"""
+    for _ in range(rng.randint(1, 4)):
+        start = rng.randrange(len(data) + 1)
+        end = min(len(data), start + rng.randint(0, 16))
+        edit = rng.random()
+        if edit < 0.3:
+            data = data[:start] + data[end:]
+        elif edit < 0.7:
+            data = data[:start] + rng.choice(tokens) + b" " + data[start:]
+        elif edit < 0.9:
+            data = data[:start] + data[start:end] * rng.randint(2, 4) + data[end:]
+        else:
+            data = data[:start] + bytes(rng.randrange(256) for _ in range(end - start)) + data[end:]
+    return data
+
+
+def corpus_files(paths: List[str]) -> List[str]:
+    """The .go files in paths, files or directories (with their subdirectories)"""
+    files = []
+    for path in paths:
+        if os.path.isdir(path):
+            files.extend(sorted(glob.glob(os.path.join(path, "**", "*.go"), recursive=True)))
+        else:
+            files.append(path)
+    return files
+
+
+def save_crash(directory: str, data: bytes, failure: str) -> str:
+    """Writes the input and the traceback (as a .txt file next to it),
+    the name is the hash of the input. Returns the path of the input"""
+    os.makedirs(directory, exist_ok=True)
+    name = hashlib.sha1(data).hexdigest()[:16]
+    kind = "hang" if failure.startswith("Timeout") else "crash"
+    path = os.path.join(directory, f"{kind}-{name}.go")
+    with open(path, "wb") as f:
+        f.write(data)
+    with open(path[:-len(".go")] + ".txt", "wt") as f:
+        f.write(failure)
+    return path
+
+
+def failure_key(failure: str) -> str:
+    """The kind of the exception of a traceback and the line raising it,
+    a crash is kept once for each"""
+    lines = failure.strip().split("\n")
+    where = [line.strip() for line in lines if line.strip().startswith("File ")]
+    return lines[-1].split(":")[0] + (where[-1] if where else "")
+
+
+def fuzz(target: Callable, corpus: List[bytes], runs: int, seed: int, crashes: str,
+         timeout: float) -> int:
+    """Runs the target with runs mutations of the inputs of the corpus,
+    returns the number of crashes found (one for each place raising)"""
+    rng = random.Random(seed)
+    seen = set()
+    for i in range(runs):
+        data = mutate(rng.choice(corpus), rng)
+        failure = run_one(target, data, timeout)
+        if failure is None or failure_key(failure) in seen:
+            continue
+        seen.add(failure_key(failure))
+        path = save_crash(crashes, data, failure)
+        print(f"run {i}: {failure.strip().split(chr(10))[-1]}, written to {path}", flush=True)
+    print(f"{runs} runs, {len(seen)} crashes")
+    return len(seen)
+
+
+def replay(target: Callable, paths: List[str], timeout: float) -> int:
+    """Runs the target with the inputs in the files, returns how many crash"""
+    crashed = 0
+    for path in paths:
+        with open(path, "rb") as f:
+            failure = run_one(target, f.read(), timeout)
+        if failure is not None:
+            crashed += 1
+            print(f"{path}:\n{failure}")
+        else:
+            print(f"{path}: ok")
+    return crashed
+
+
+def fuzz_atheris(target: Callable, corpus_paths: List[str], argv: List[str]):
+    """Runs the target with libFuzzer (atheris), the corpus directories
+    are the ones it starts with and adds the inputs it finds to"""
+    import atheris
+
+    def test_one_input(data: bytes):
+        printing, diagnostics.printing = diagnostics.printing, False
+        try:
+            with contextlib.redirect_stdout(io.StringIO()):
+                target(data)
+        finally:
+            diagnostics.printing = printing
+
+    atheris.Setup([sys.argv[0]] + argv + corpus_paths, test_one_input)
+    atheris.Fuzz()
+
+
+def main(argv: List[str]):
+    arg_parser = argparse.ArgumentParser(
+        prog="fuzz.py", description="Fuzzes the lexer, the parser or the type checker"
+    )
+    arg_parser.add_argument("target", choices=sorted(targets))
+    arg_parser.add_argument("corpus", nargs="*", default=["tests"],
+                            help="the .go files (or directories of them) mutated")
+    arg_parser.add_argument("--runs", type=int, default=1000, help="the number of inputs tried")
+    arg_parser.add_argument("--seed", type=int, default=0, help="the seed of the mutations")
+    arg_parser.add_argument("--crashes", default="crashes",
+                            help="the directory the inputs crashing are written to")
+    arg_parser.add_argument("--timeout", type=float, default=10,
+                            help="the seconds an input can take, 0 for no limit")
+    arg_parser.add_argument("--replay", action="store_true",
+                            help="only runs the target with the files given")
+    arg_parser.add_argument("--atheris", action="store_true",
+                            help="fuzzes with atheris, the other arguments after -- go to libFuzzer")
+    # the arguments after -- are the ones of libFuzzer
+    libfuzzer_args = []
+    if "--" in argv:
+        argv, libfuzzer_args = argv[:argv.index("--")], argv[argv.index("--") + 1:]
+    args = arg_parser.parse_intermixed_args(argv)
+    target = targets[args.target]
+
+    if args.atheris:
+        fuzz_atheris(target, args.corpus, libfuzzer_args)
+        return 0
+    files = corpus_files(args.corpus)
+    if args.replay:
+        return 1 if replay(target, files, args.timeout) else 0
+    corpus = []
+    for path in files:
+        with open(path, "rb") as f:
+            corpus.append(f.read())
+    if not corpus:
+        print("fuzz.py: no .go files in the corpus", file=sys.stderr)
+        return 2
+    return 1 if fuzz(target, corpus, args.runs, args.seed, args.crashes, args.timeout) else 0
+
+
+if __name__ == "__main__":
+    try:
+        status = main(sys.argv[1:])
+    finally:
+        shutil.rmtree(workdir, ignore_errors=True)
+    sys.exit(status)
@@ -1,19 +1,35 @@
+import io
+import re
 import sys
+import bisect
 import colorama
+import constant
+import diagnostics
+import fileset
 import utils
 
+from typing import Iterator, List, Optional, TextIO, Tuple
+from collections import namedtuple
 from ply import lex
-from colorama import Fore, Style
+from diagnostics import Fix
 from symbol_table import SymbolTable
-from utils import print_line, print_marker, print_lexer_error
 
 colorama.init()
 
-with open(sys.argv[1], "r") as f:
-    input_code = f.read()
-
-if input_code[len(input_code) - 1] != "\n":
-    input_code += "\n"
+# the source code being lexed, see set_input
+input_code = "\n"
+# the file of input_code, the spans of the tokens are in it
+file = fileset.File(None, 1, input_code)
+# the comments of the file, (pos, text) in the order they are in it. They
+# are not tokens, the parser keeps them in the File node (see printer)
+comments: list = []
+# the positions in input_code of the bytes which aren't UTF-8, see set_input
+invalid_utf8: list = []
+# if the file is scanned ahead of the parser, by a worker of
+# go_parser.lex_files: the tokens depending on the symbols in scope (the
+# QUALIFIED_TYPENAMEs and the LIT_LBRACEs) are told apart when the parser
+# reads them, see Replay
+deferred = False
 
 
 # Find column number of token
@@ -26,7 +42,7 @@ def find_column(lexpos: int):
 states = (("InsertSemi", "exclusive"),)
 
 # List of literal tokens
-literals = ";,.=+-*/%()[]!{}"
+literals = ";,.=+-*/%()[]!{}~"
 
 # List of token names. This is always required
 tokens = (
@@ -37,6 +53,7 @@ tokens = (
     "BAR_EQ",
     "AMP_EQ",
     "AMP_CARET_EQ",
+    "AMP_CARET",
     "RIGHT_SHIFT_EQ",
     "LEFT_SHIFT_EQ",
     "AMPERSAND",
@@ -62,13 +79,21 @@ tokens = (
     "LT_EQ",
     "GT",
     "GT_EQ",
+    # channel operator
+    "ARROW",
     # literals
     "INT_LIT",
     "FLOAT_LIT",
+    "IMAGINARY_LIT",
+    "RUNE_LIT",
     "STRING_LIT",
     "BOOL_LIT",
     "IDENTIFIER",
     "ELLIPSIS",
+    # '{' of a composite literal, see t_curl_start
+    "LIT_LBRACE",
+    # a type of an imported package, like geometry.Point, see t_IDENTIFIER
+    "QUALIFIED_TYPENAME",
 )
 
 # List of keywords
@@ -106,32 +131,7 @@ keywords = {
 
 # updating list of tokens with keywords and types
 tokens = tokens + tuple(keywords.values())
-unused_tokens = {
-    "AMPERSAND",
-    "AMP_CARET_EQ",
-    "AMP_EQ",
-    "BAR",
-    "BAR_EQ",
-    "CARET",
-    "CARET_EQ",
-    "COLON",
-    "KW_CASE",
-    "KW_CHAN",
-    "KW_DEFAULT",
-    "KW_DEFER",
-    "KW_FALLTHROUGH",
-    "KW_GO",
-    "KW_GOTO",
-    "KW_INTERFACE",
-    "KW_MAP",
-    "KW_SELECT",
-    "KW_STRUCT",
-    "KW_SWITCH",
-    "LEFT_SHIFT",
-    "LEFT_SHIFT_EQ",
-    "RIGHT_SHIFT",
-    "RIGHT_SHIFT_EQ",
-}
+unused_tokens = set()
 required_tokens_for_parser = list(set(tokens) - unused_tokens)
 #  print(required_tokens_for_parser)
 
@@ -148,11 +148,15 @@ def t_ANY_ignore_TABS(t):
 
 def t_ANY_ignore_SINGLE_COMMENT(t):
     r"//.*"
+    utf8_error(t)
+    comments.append((file.pos(t.lexpos), t.value))
 
 
 def t_ANY_ignore_MULTI_COMMENT(t):
     r"/\*(.|\n)*?\*/"
 
+    utf8_error(t)
+    comments.append((file.pos(t.lexpos), t.value))
     t.lexer.lineno += t.value.count("\n")
 
 
@@ -165,6 +169,7 @@ t_CARET_EQ = r"\^="
 t_BAR_EQ = r"\|="
 t_AMP_EQ = r"&="
 t_AMP_CARET_EQ = r"&\^="
+t_AMP_CARET = r"&\^"
 t_RIGHT_SHIFT_EQ = r">>="
 t_LEFT_SHIFT_EQ = r"<<="
 t_AMPERSAND = r"&"
@@ -188,6 +193,8 @@ t_LT = r"<"
 t_LT_EQ = r"<="
 t_GT = r">"
 t_GT_EQ = r">="
+# channel operator
+t_ARROW = r"<-"
 t_ELLIPSIS = r"\.\.\."
 
 # tokens with actions
@@ -198,15 +205,10 @@ t_ELLIPSIS = r"\.\.\."
 def t_ANY_UNCLOSED_MULTI_COMMENT(t):
     r"/\*(.|\n)*"
 
-    print_lexer_error("Unclosed Multiline comment")
-    col = find_column(t.lexpos)
-    print(f"at line {t.lineno}, column {col}")
-    print(
-        f"{Fore.GREEN}{t.lineno:>10}:\t{Style.RESET_ALL}",
-        lines[t.lineno - 1],
-        sep="",
+    diagnostics.error(
+        "Unclosed Multiline comment", t.lineno, find_column(t.lexpos), 2,
+        kind="ERROR", code="UnclosedComment"
     )
-    print_marker(col - 1, 1)
 
 
 # token in InsertSemi state
@@ -264,11 +266,57 @@ def t_sq_end(t):
 def t_curl_end(t):
     r"\}"
 
+    if t.lexer.brace_stack and t.lexer.brace_stack.pop():
+        t.lexer.struct_end = t.lexpos + 1
+
     t.lexer.begin("InsertSemi")
     t.type = "}"
     return t
 
 
+# opening parantheses
+
+
+def t_curl_start(t):
+    r"\{"
+
+    # A '{' right after a type starts a composite literal, like Point{1, 2},
+    # and is a LIT_LBRACE. Otherwise it starts a block, like in if x {...}.
+    # The parser can't tell the two apart with a single token of lookahead
+    # Ref: https://golang.org/ref/spec#Composite_literals
+    data = t.lexer.lexdata
+    end = t.lexpos
+    while end > 0 and data[end - 1] in " \t":
+        end -= 1
+    start = end
+    while start > 0 and (data[start - 1].isalnum() or data[start - 1] == "_"):
+        start -= 1
+    word = data[start:end]
+
+    # the brace is after the fields of a struct type, like in struct{x
+    # int}{1}, or the methods of an interface type, like in []interface{}{1}
+    t.brace = (start, word, end == t.lexer.struct_end)
+    t.type = "{" if deferred else brace_type(data, *t.brace)
+    t.lexer.brace_stack.append(word in ("struct", "interface"))
+    return t
+
+
+def brace_type(data: str, start: int, word: str, after_type: bool) -> str:
+    """The type of the token of a '{' after word, which starts at start in
+    data, LIT_LBRACE if it starts a composite literal"""
+    if word and word not in keywords:
+        type_info = symtab.get_symbol(word)
+        if start > 0 and data[start - 1] == ".":
+            # a type of an imported package, like geometry.Point{1, 2}
+            type_info = qualified_member(data, start - 1, word)
+        # types are the only symbols with a storage
+        if type_info is not None and hasattr(type_info.value, "storage"):
+            return "LIT_LBRACE"
+    elif after_type:
+        return "LIT_LBRACE"
+    return "{"
+
+
 # increment/decrement operators
 
 
@@ -289,52 +337,141 @@ def t_DECREMENT(t):
 # literals
 
 
+def literal_error(t, message: str):
+    """Reports an invalid literal"""
+    diagnostics.error(
+        message, t.lineno, find_column(t.lexpos), len(t.value.split("\n")[0]),
+        kind="ERROR", code="InvalidLiteral"
+    )
+
+
+# an interpreted string closed on its line, the other ones t_STRING_LIT
+# matches end at the newline, they aren't terminated
+terminated_string = re.compile(r'"(\\.|[^"\\\n])*"')
+
+
 def t_STRING_LIT(t):
-    r"\"[^\"]*\""
+    r"\"(\\.|[^\"\\\n])*\\?(\"|(?=\n))|`[^`]*`"
+    utf8_error(t)
 
     #  if r"\s*\*/":
     #      print_error("ERROR: Wrong Multiline Comment")
     #      return
 
-    if "\n" in t.value:
-        print_lexer_error("string cannot contain line breaks")
-        lineno = t.lexer.lineno
-        pos = find_column(t.lexpos)
-        splits = list(t.value.split("\n"))
-        for i, line_ in enumerate(splits):
-            print_line(lineno)
-            line_actual = lines[lineno - 1]
-
-            if i == 0:
-                print_marker(pos - 1, len(line_actual) - pos + 1)
-            elif i == len(splits) - 1:
-                print_marker(0, line_actual.find('"') + 1)
-            else:
-                print_marker(0, len(line_actual))
+    if t.value.startswith("`"):
+        # raw strings can span lines, the value is kept like the one of
+        # an interpreted string (with escapes) and the text as well
+        text = t.value
+        t.value = ("string", constant.quote(constant.unquote(text)), text)
+        t.lexer.lineno += text.count("\n")
+
+        t.lexer.begin("InsertSemi")
+        return t
+
+    if not terminated_string.fullmatch(t.value):
+        # an interpreted string ends at the end of its line, like in Go
+        literal_error(t, "string literal not terminated")
+        t.value = ("string", '""')
+        t.lexer.begin("InsertSemi")
+        return t
+
+    try:
+        constant.unquote(t.value)
+        t.value = ("string", t.value)
+    except constant.ConstError as e:
+        literal_error(t, str(e))
+        t.value = ("string", '""')
 
-            lineno += 1
-        t.lexer.lineno += t.value.count("\n")
+    t.lexer.begin("InsertSemi")
+    return t
+
+
+def t_RUNE_LIT(t):
+    r"'(\\.|[^'\\\n])*'"
+    utf8_error(t)
+    # the value is the code point, the text is kept for messages
+    text = t.value
+    try:
+        t.value = ("rune", constant.unquote_rune(text), text)
+    except constant.ConstError as e:
+        literal_error(t, str(e))
+        t.value = ("rune", 0, text)
+
+    t.lexer.begin("InsertSemi")
+    return t
 
-        return
 
-    t.value = ("string", t.value)
+# the number literals longer than this aren't evaluated, like in go/types
+max_literal_length = 10000
+# the texts of the tokens longer than this (the long literals) aren't
+# interned, see intern
+max_interned_length = 64
+
+
+def long_literal(t) -> bool:
+    """Reports the number literal t if it is too long to be meaningful.
+    Returns if it is"""
+    if len(t.value) <= max_literal_length:
+        return False
+    diagnostics.error(
+        f"excessively long constant: {t.value[:10]}... ({len(t.value)} chars)",
+        t.lineno, find_column(t.lexpos), len(t.value), kind="ERROR",
+        code="InvalidConstVal"
+    )
+    return True
+
+
+def t_IMAGINARY_LIT(t):
+    r"(\d+[.]\d*([eE][+-]?\d+)?|\d+[eE][+-]?\d+|[.]\d+([eE][+-]?\d+)?|\d+)i"
+    # like float literals, the text is kept to evaluate the constant exactly
+    if long_literal(t):
+        t.value = "0i"
+    t.value = ("complex128", complex(0, float(t.value[:-1])), t.value)
 
     t.lexer.begin("InsertSemi")
     return t
 
 
 def t_FLOAT_LIT(t):
-    r"[+-]?(\d+[.]\d*[eE][+-]?\d+)|[+-]?(\d+([.]\d*)|[+-]?\d+([eE][+-]?\d+)|[.]\d+([eE][+-]?\d+)?)"
-    t.value = ("float64", float(t.value))
+    r"\d+[.]\d*([eE][+-]?\d+)?|\d+[eE][+-]?\d+|[.]\d+([eE][+-]?\d+)?"
+    # the literal text is kept as well, constants are evaluated exactly
+    if long_literal(t):
+        t.value = "0.0"
+    t.value = ("float64", float(t.value), t.value)
 
     t.lexer.begin("InsertSemi")
     return t
 
 
-def t_INT_LIT(t):
-    r"\d+"
+# the bases of the prefixes of integer literals, a 0 alone is a legacy
+# octal one, like 0644
+int_bases = {"x": (16, "hexadecimal"), "b": (2, "binary"), "o": (8, "octal")}
 
-    t.value = ("int", int(t.value))
+
+def t_INT_LIT(t):
+    r"0[xX][0-9a-fA-F_]*|0[bBoO][0-9_]*|\d[0-9_]*"
+    # the text of the literals with a base other than 10 is kept as well,
+    # for messages and the printer
+    text = t.value
+    if long_literal(t):
+        text = "0"
+    base, name, digits = 10, "decimal", text
+    if text[:2].lower() in ("0x", "0b", "0o"):
+        (base, name), digits = int_bases[text[1].lower()], text[2:]
+        if not digits.replace("_", ""):
+            literal_error(t, f"{name} literal has no digits")
+            digits = "0"
+    elif len(text) > 1 and text[0] == "0":
+        base, name, digits = 8, "octal", text[1:]
+    invalid = next((c for c in digits if c != "_" and int(c, 16) >= base), None)
+    if invalid is not None:
+        literal_error(t, f"invalid digit '{invalid}' in {name} literal")
+        digits = "0"
+    elif "__" in text or text.endswith("_"):
+        literal_error(t, "'_' must separate successive digits")
+        digits = "0"
+    value = int(digits.replace("_", "") or "0", base)
+    t.value = ("int", value) if text == str(value) else ("int", value, text)
 
     t.lexer.begin("InsertSemi")
     return t
@@ -351,7 +488,7 @@ def t_BOOL_LIT(t):
 
 # identifier
 def t_IDENTIFIER(t):
-    r"([a-zA-Z]([a-zA-Z0-9_])*)|_"
+    r"[a-zA-Z_][a-zA-Z0-9_]*"
 
     # There is no limit on length of identifier in go
     # if len(t.value) > 31:
@@ -364,38 +501,353 @@ def t_IDENTIFIER(t):
     else:
         t.type = "IDENTIFIER"
         t.value = ("identifier", t.value, find_column(t.lexpos))
+        if not deferred:
+            qualified_typename(t)
 
     t.lexer.begin('InsertSemi')
     return t
 
 
+def qualified_member(data: str, end: int, name: str):
+    """The symbol of the member name of the package whose
+    name ends at end in data, None if it is not a package"""
+    start = end
+    while start > 0 and (data[start - 1].isalnum() or data[start - 1] == "_"):
+        start -= 1
+    package = symtab.get_symbol(data[start:end])
+    # packages are the only symbols with members
+    if package is None or not hasattr(package.value, "members"):
+        return None
+    return package.value.members.get(name)
+
+
+def qualified_typename(t):
+    """Makes the identifier t a QUALIFIED_TYPENAME if it is the name of an
+    imported package, followed by the name of one of its types
+
+    Like for composite literals, the parser can't tell geometry.Point in
+    geometry.Point{1, 2} apart from a selector, like geometry.Origin"""
+    match = qualified_type(t.lexer.lexdata, t.lexpos, t.lexer.lexpos)
+    if match is None:
+        return
+    t.type = "QUALIFIED_TYPENAME"
+    t.value = (t.value, ("identifier", match.group(1), find_column(match.start(1))))
+    t.lexer.lexpos = match.end()
+
+
+def qualified_type(data: str, start: int, end: int) -> Optional[re.Match]:
+    """The match of the .Name after the identifier from start to end in data,
+    if it is the name of an imported package and Name one of its types"""
+    if start > 0 and data[start - 1] == ".":
+        return None
+    match = re.compile(r"\.([a-zA-Z_][a-zA-Z0-9_]*)").match(data, end)
+    if match is None:
+        return None
+    member = qualified_member(data, end, match.group(1))
+    if member is None or not hasattr(member.value, "storage"):
+        return None
+    return match
+
+
+def utf8_error(t, width: Optional[int] = None) -> bool:
+    """Reports the bytes of the text of the token t (or of its first width
+    characters) which aren't UTF-8, like go/scanner. Returns if there are some"""
+    end = t.lexpos + (len(t.value) if width is None else width)
+    start = bisect.bisect_left(invalid_utf8, t.lexpos)
+    found = False
+    for pos in invalid_utf8[start:bisect.bisect_left(invalid_utf8, end)]:
+        lineno = t.lineno + input_code.count("\n", t.lexpos, pos)
+        diagnostics.error(
+            "illegal UTF-8 encoding", lineno, find_column(pos), 1, kind="ERROR",
+            code="IllegalCharacter"
+        )
+        found = True
+    return found
+
+
 # Error handling rule for ANY state
 def t_ANY_error(t):
-    print_lexer_error(f"Illegal character {t.value[0]}")
+    if utf8_error(t, 1):
+        t.lexer.skip(1)
+        return
     col = find_column(t.lexpos)
-    print(f"at line {t.lineno}, column {col}")
-    print(
-        f"{Fore.GREEN}{t.lineno:>10}:\t{Style.RESET_ALL}",
-        lines[t.lineno - 1],
-        sep="",
+    diagnostics.error(
+        f"Illegal character {t.value[0]}", t.lineno, col, 1, kind="ERROR",
+        code="IllegalCharacter", fix=Fix("remove it", "", t.lineno, col, 1)
     )
-    print_marker(col - 1, 1)
 
     t.lexer.skip(1)
 
 
 # Build the lexer
 lexer = lex.lex()
-
-# Give input to the lexer
-lexer.input(input_code)
+# for every open '{', if it starts the fields of a
+# struct type (or the methods of an interface type)
+lexer.brace_stack = []
+# position after the '}' which closed the last struct or interface type
+lexer.struct_end = -1
 
 lines = input_code.split("\n")
-utils.lines = lines
 
 symtab = SymbolTable()
 
+
+def set_input(code: str, filename: Optional[str] = None):
+    """Starts lexing code, the source of a file. The file is added to
+    fileset.fset if it has a name, the positions of its tokens are in it"""
+    global input_code, lines, file
+    if not code.endswith("\n"):
+        code += "\n"
+    # the bytes which aren't UTF-8 are lone surrogates (see utils.read_source),
+    # they are lexed as U+FFFD and reported where they are
+    invalid_utf8[:] = [m.start() for m in re.finditer("[\udc80-\udcff]", code)]
+    if invalid_utf8:
+        code = re.sub("[\udc80-\udcff]", "\ufffd", code)
+    input_code = code
+    if filename is not None:
+        file = fileset.fset.add_file(filename, code)
+    else:
+        file = fileset.File(None, 1, code)
+    lines = input_code.split("\n")
+    utils.lines = lines
+    comments.clear()
+    lexer.input(input_code)
+    lexer.lineno = 1
+    lexer.begin("INITIAL")
+    lexer.brace_stack = []
+    lexer.struct_end = -1
+
+
+def token() -> Optional[lex.LexToken]:
+    """The next token, with its span: pos is the position of its first
+    character and end the one right after its last one. Its text is
+    interned, see intern"""
+    tok = lexer.token()
+    if tok is not None:
+        tok.value = intern(tok.value)
+        tok.pos = file.pos(tok.lexpos)
+        # the semicolons inserted at the end of lines are empty
+        tok.end = file.pos(max(lexer.lexpos, tok.lexpos))
+    return tok
+
+
+def tokenize(code: str, filename: Optional[str] = None) -> list:
+    """The tokens of code, the source of a file (see set_input), with their
+    spans. The errors in it are reported to diagnostics"""
+    set_input(code, filename)
+    return list(iter(token, None))
+
+
+# the number of characters stream reads at a time
+chunk_size = 1 << 16
+
+# the parts of a source which can span lines, and the ones which can't
+# start them, see segment_end
+spans = re.compile(r"""//[^\n]*|/\*.*?\*/|`[^`]*`|"(\\[^\n]|[^"\\\n])*"|'(\\[^\n]|[^'\\\n])*'"""
+                   r"""|/\*|`|"|\n|[^\n/`"']+|.""", re.S)
+
+
+def segment_end(text: str) -> int:
+    """The end of the lines at the start of text which can be lexed without
+    the text after it, after the last newline which isn't in a comment or a
+    string. 0 if a comment or a raw string started isn't closed yet"""
+    end = 0
+    for match in spans.finditer(text):
+        part = match.group()
+        if part == "\n":
+            end = match.end()
+        elif part in ("/*", "`"):
+            # not closed in text, it may be in the text after it (an
+            # interpreted string ends at the end of its line)
+            break
+    return end
+
+
+class Window:
+    """The lines of a file read by stream, as utils.lines for the diagnostics
+    of the lexer: only the ones of the segment being lexed are kept, the
+    lines before it are empty"""
+
+    def __init__(self):
+        self.first = 1
+        self.lines: List[str] = []
+
+    def __len__(self):
+        return self.first - 1 + len(self.lines)
+
+    def __getitem__(self, index: int) -> str:
+        index -= self.first - 1
+        return self.lines[index] if 0 <= index < len(self.lines) else ""
+
+
+def stream(reader: TextIO, filename: Optional[str] = None) -> Iterator[lex.LexToken]:
+    """The tokens of the source read from reader (like sys.stdin), lexed as
+    it is read, like tokenize does: the source is lexed by segments of whole
+    lines (see segment_end), read chunk_size characters at a time (or more
+    for a comment or a raw string longer than that), and only the segment
+    being lexed is kept. Their lexpos is their offset in the file, and
+    comments has the comments of the segment"""
+    global input_code, file, lines
+    if filename is not None:
+        whole = fileset.fset.add_file(filename, "")
+    else:
+        whole = fileset.File(None, 1, "")
+    window = Window()
+    if filename is not None:
+        utils.sources[filename] = window
+        utils.set_file(filename)
+    utils.lines = window
+    lexer.brace_stack = []
+    buffer, offset, lineno = "", 0, 1
+    size, eof, newline = chunk_size, False, False
+    while not eof or buffer:
+        if not eof:
+            chunk = reader.read(size)
+            if not chunk:
+                eof = True
+                # like set_input, the source ends with a newline
+                chunk = "" if newline else "\n"
+            newline = chunk.endswith("\n") if chunk else newline
+            if filename is not None:
+                fileset.fset.extend(whole, chunk)
+            else:
+                whole.extend(chunk)
+            buffer += chunk
+        end = len(buffer) if eof else segment_end(buffer)
+        if end == 0:
+            # a comment or a raw string longer than the buffer, read more
+            size *= 2
+            continue
+        size = chunk_size
+        segment, buffer = buffer[:end], buffer[end:]
+        invalid_utf8[:] = [m.start() for m in re.finditer("[\udc80-\udcff]", segment)]
+        if invalid_utf8:
+            segment = re.sub("[\udc80-\udcff]", "\ufffd", segment)
+        input_code, lines = segment, window
+        file = fileset.File(filename, whole.base + offset, "")
+        window.first, window.lines = lineno, segment.split("\n")
+        comments.clear()
+        lexer.input(segment)
+        lexer.lineno = lineno
+        lexer.begin("INITIAL")
+        lexer.struct_end = -1
+        for tok in iter(token, None):
+            tok.lexpos += offset
+            yield tok
+        offset += len(segment)
+        lineno += segment.count("\n")
+    file = whole
+
+
+def intern(value):
+    """The value of a token with its strings (the text of an identifier or of
+    a short literal, or the name of a package and of its type) interned in
+    fileset.fset, so the equal ones of the files, which the nodes keep, are
+    a single string"""
+    if isinstance(value, str):
+        return fileset.fset.intern(value) if len(value) <= max_interned_length else value
+    if isinstance(value, tuple):
+        return tuple(intern(v) for v in value)
+    return value
+
+
+# a token of a file scanned ahead of the parser, see scan. end is the offset
+# right after it and brace the context of a '{', see t_curl_start
+Token = namedtuple("Token", "type value lineno lexpos end brace")
+
+
+class Scanned:
+    """The tokens of a file scanned by scan, its comments (with their offset)
+    and the diagnostics of the lexer, with the number of tokens before them"""
+
+    def __init__(self):
+        self.tokens: List[Token] = []
+        self.comments: List[Tuple[int, str]] = []
+        self.diagnostics: List[Tuple[int, diagnostics.Diagnostic]] = []
+
+
+def scan(filename: str, code: str) -> Scanned:
+    """The tokens of code, the source of the file filename, scanned without
+    the symbols of the parser (in a worker process of go_parser.lex_files),
+    the parser reads them with Replay"""
+    global deferred
+    deferred = True
+    diagnostics.printing = False
+    utils.sources[filename] = code.split("\n")
+    utils.set_file(filename)
+    reported = len(diagnostics.reported)
+    scanned = Scanned()
+    set_input(code)
+    try:
+        for tok in iter(lexer.token, None):
+            for diagnostic in diagnostics.reported[reported:]:
+                scanned.diagnostics.append((len(scanned.tokens), diagnostic))
+            reported = len(diagnostics.reported)
+            scanned.tokens.append(Token(tok.type, tok.value, tok.lineno, tok.lexpos,
+                                        max(lexer.lexpos, tok.lexpos), getattr(tok, "brace", None)))
+        for diagnostic in diagnostics.reported[reported:]:
+            scanned.diagnostics.append((len(scanned.tokens), diagnostic))
+    finally:
+        deferred = False
+        del diagnostics.reported[reported:]
+    scanned.comments = [(file.offset(pos), text) for pos, text in comments]
+    return scanned
+
+
+class Replay:
+    """Reads the tokens of the file scanned, which is the input of the lexer
+    (see set_input), like token reads them from the lexer: the identifiers
+    followed by the name of a type of their package are QUALIFIED_TYPENAMEs,
+    the braces starting composite literals LIT_LBRACEs. The diagnostics of
+    the lexer are reported when the token after them is read"""
+
+    def __init__(self, scanned: Scanned):
+        self.scanned = scanned
+        self.index = 0
+        self.reported = 0
+        comments[:] = [(file.pos(offset), text) for offset, text in scanned.comments]
+
+    def report(self):
+        found = self.scanned.diagnostics
+        while self.reported < len(found) and found[self.reported][0] <= self.index:
+            diagnostics.report(found[self.reported][1])
+            self.reported += 1
+
+    def token(self) -> Optional[lex.LexToken]:
+        self.report()
+        tokens = self.scanned.tokens
+        if self.index == len(tokens):
+            lexer.lexpos, lexer.lineno = len(input_code), input_code.count("\n") + 1
+            return None
+        scanned = tokens[self.index]
+        self.index += 1
+        tok = lex.LexToken()
+        tok.type, tok.value, tok.lineno, tok.lexpos = scanned[:4]
+        tok.lexer, end = lexer, scanned.end
+        if tok.type == "IDENTIFIER":
+            match = qualified_type(input_code, tok.lexpos, end)
+            if match is not None:
+                # the '.' and the name of the type are part of it
+                self.index += 2
+                end = match.end()
+                tok.type = "QUALIFIED_TYPENAME"
+                tok.value = (tok.value, ("identifier", match.group(1),
+                                         find_column(match.start(1))))
+        elif tok.type == "{":
+            tok.type = brace_type(input_code, *scanned.brace)
+        tok.value = intern(tok.value)
+        tok.pos, tok.end = file.pos(tok.lexpos), file.pos(end)
+        lexer.lexpos, lexer.lineno = end, tok.lineno
+        return tok
+
+
 if __name__ == "__main__":
-    # Tokenize
-    for tok in lexer:
+    # the tokens of a file, or of the standard input (-), lexed as it is read
+    if sys.argv[1] == "-":
+        reader = io.TextIOWrapper(sys.stdin.buffer, encoding="utf-8", errors="surrogateescape")
+        name = None
+    else:
+        reader = open(sys.argv[1], encoding="utf-8", errors="surrogateescape")
+        name = sys.argv[1]
+    for tok in stream(reader, name):
         print(tok)
@@ -1,17 +1,33 @@
+import io
+import os
 import sys
+import atexit
+import argparse
+import contextlib
+import concurrent.futures
 import go_lexer
 import utils
 import syntree
+import analysis
+import astdump
+import backend
+import cache
+import cancel
+import checker
+import cover
+import diagnostics
+import lang
+import loader
+import optimize
+import sandbox
 
 from ply import yacc
-from typing import Tuple, Dict
-from colorama import Fore, Style
+from fileset import NoPos
+from typing import Any, Callable, Tuple, Dict, List, Optional, Set
 from pptree_mod import print_tree
-from tac import intermediate_codegen
+from tac import declare_runtime, intermediate_codegen
 from ico import optimize_ic
-from tree_vis import draw_AST
 from symbol_table import predefined_identifiers
-from utils import print_error, print_line, print_marker
 from go_lexer import (
     required_tokens_for_parser as tokens,
     lex,
@@ -33,6 +49,32 @@ from go_lexer import (
 
 ast = syntree.Node("start", children=[])
 
+# if the receiver of a method is being parsed, and the type
+# arguments of its type, which declare type parameters
+parsing_receiver = False
+receiver_type_args = False
+# the type parameters used in a type parameter list before they are
+# declared, like the E of [S ~[]E, E any], by name. None outside the list
+forward_type_params: Optional[dict] = None
+# the declarations, specs and fields of the file being parsed, which
+# can have doc and line comments, see syntree.attach_comments
+commented: list = []
+# the packages of the program imported by the package being
+# parsed, by import path. See parse_package
+imported: Dict[str, syntree.Package] = {}
+# the types declared at the package level, made before the files are
+# parsed, so they can be used before their declaration. By the position
+# (file, lineno, col_num) of their name, see declare_package_names
+forward_types: Dict[tuple, syntree.NamedType] = {}
+# the names of the constants and variables declared at the package level,
+# their symbols are made before the files are parsed too
+forward_values: Set[str] = set()
+# the guards of the type switches being parsed, innermost last, as the
+# (identifier, expression) of v := x.(type). See p_case_variable
+type_switches: List[Tuple[Optional[syntree.Identifier], syntree.Node]] = []
+# what the nil of a case of a type switch is parsed to, see p_TypeName
+nil_case = object()
+
 precedence = (
     # ('left', 'IDENTIFIER'),
     # ('left', 'INT', 'BOOL', 'FLOAT64'),
@@ -45,9 +87,13 @@ precedence = (
     ("left", "BAR_BAR"),
     ("left", "AMPER_AMPER"),
     ("left", "EQ_EQ", "NOT_EQ", "LT", "LT_EQ", "GT", "GT_EQ"),
-    ("left", "+", "-"),
-    ("left", "*", "/", "%"),
+    ("left", "+", "-", "BAR", "CARET"),
+    ("left", "*", "/", "%", "LEFT_SHIFT", "RIGHT_SHIFT", "AMPERSAND", "AMP_CARET"),
     ("right", "UNARY"),
+    # the parameters of a function type are followed by its results, like
+    # []func() (int) for the element type of a conversion to []func() int
+    ("left", "SIGNATURE"),
+    ("left", "("),
 )
 
 
@@ -55,8 +101,11 @@ def p_SourceFile(p):
     """SourceFile : PackageClause ';' ImportDeclList TopLevelDeclList"""
     ast.data = p[1]
     utils.package_name = ast.data
-    ast.add_child(p[3])
-    ast.add_child(p[4])
+    # the files are in reverse order, like Lists
+    file = syntree.File(utils.filename, p[3], p[4])
+    file.comments = syntree.comment_groups(go_lexer.comments, go_lexer.file, go_lexer.input_code)
+    syntree.attach_comments(file.comments, commented)
+    ast.children.insert(0, file)
 
 
 def p_PackageClause(p):
@@ -87,8 +136,10 @@ def p_ImportDecl(p):
     """
     if len(p) == 3:
         p[0] = syntree.List([p[2]])
+        group_specs("import", [p[2]], False, rule_span(p))
     elif len(p) == 5:
         p[0] = p[3]
+        group_specs("import", in_order(p[3]), True, rule_span(p))
 
 
 def p_ImportSpecList(p):
@@ -112,6 +163,17 @@ def p_ImportSpec(p):
         p[0] = syntree.Import(p[1], p[2])
     else:
         p[0] = syntree.Import(".", p[2])
+    # the name as it is written, "." is the name of a default import too
+    p[0]._name = p[1]
+
+    # the members of the packages of the program are known, the
+    # others (like fmt) are not in the symbol table
+    package = imported.get(p[2][1].strip('"'))
+    name = p[1][1] if isinstance(p[1], tuple) else p[1]
+    if package is not None and name not in (".", "_"):
+        name = package.data if name is None else name
+        symtab.add_if_not_exists(name)
+        symtab.declare_new_variable(name, p.lineno(2), None, value=package)
 
 
 def p_ImportPath(p):
@@ -119,11 +181,46 @@ def p_ImportPath(p):
     p[0] = p[1]
 
 
+def rule_span(p) -> Tuple[int, int]:
+    """The span of the symbols of the rule being reduced (spanning sets
+    the one of the node the rule makes only after it)"""
+    spans = [span for span in map(symbol_span, p.slice[1:]) if span is not None]
+    if not spans:
+        return NoPos, NoPos
+    return spans[0][0], spans[-1][1]
+
+
+def in_order(specs: Optional[syntree.List]) -> list:
+    """The items of a list the grammar builds in reverse order"""
+    return [] if specs is None else list(reversed(specs.children))
+
+
+def group_specs(keyword: str, specs: list, parenthesized: bool, span: Tuple[int, int]):
+    """Sets the DeclGroup of a declaration as the _group of the nodes made
+    from its specs (in order), which are the Lists of VarDecls with their
+    _spec for var and const declarations. The printer and the doc comments
+    use them (see syntree.doc_comment)"""
+    group = syntree.DeclGroup(
+        keyword, [getattr(spec, "_spec", spec) for spec in specs], parenthesized, span
+    )
+    for spec in specs:
+        for node in spec.children if isinstance(spec, syntree.List) else [spec]:
+            node._group, node._spec = group, getattr(spec, "_spec", spec)
+    if keyword != ":=":
+        commented.append(group)
+        commented.extend(group.specs)
+
+
 def p_TopLevelDeclList(p):
     """TopLevelDeclList : empty
     | TopLevelDecl ';' TopLevelDeclList
     """
     if len(p) == 4:
+        if isinstance(p[1], syntree.Node):
+            # the span of the declaration and its ';', the list of the
+            # declarations of a file goes from the first one to the last one
+            spans = [span for span in map(symbol_span, p.slice[1:3]) if span is not None]
+            p[1]._decl_span = (spans[0][0], spans[-1][1])
         if p[3] is not None:
             p[3].append(p[1])
             p[0] = p[3]
@@ -133,20 +230,44 @@ def p_TopLevelDeclList(p):
 
 def p_TopLevelDecl(p):
     """TopLevelDecl : FunctionDecl
+    | MethodDecl
     | Declaration
     """
-    # TODO : Add MethodDecl
     p[0] = p[1]
 
 
+def p_TopLevelDecl_error(p):
+    """TopLevelDecl : error"""
+    # the tokens up to the next ';' are skipped, the scopes of the
+    # declaration entered before the error are left
+    symtab.leave_scopes_to(1)
+    reset_declaration()
+    p[0] = syntree.BadDecl(p.lineno(1))
+
+
+def reset_declaration():
+    """Forgets what the parser keeps while it parses a declaration,
+    which a syntax error can leave unfinished (like its type parameters)"""
+    global parsing_receiver, receiver_type_args, forward_type_params
+    parsing_receiver = receiver_type_args = False
+    forward_type_params = None
+
+
 def p_FunctionDecl(p):
     """FunctionDecl : KW_FUNC FunctionName Signature
     | KW_FUNC FunctionName Signature FunctionBody
+    | KW_FUNC FunctionName TypeParameters Signature
+    | KW_FUNC FunctionName TypeParameters Signature FunctionBody
     """
-    if len(p) == 4:
-        p[0] = syntree.Function(p[2], p[3], lineno=p.lineno(2))
-    elif len(p) == 5:
-        p[0] = syntree.Function(p[2], p[3], body=p[4], lineno=p.lineno(2))
+    items = p[3:]
+    if isinstance(items[0], list):
+        # the type parameters are in the scope of the function
+        signature = items[1]
+        signature.type_params = items[0]
+        items = items[1:]
+    body = items[1] if len(items) == 2 else None
+    p[0] = syntree.Function(p[2], items[0], body=body, lineno=p.lineno(2))
+    commented.append(p[0])
     symtab.leave_scope()
 
 
@@ -154,7 +275,35 @@ def p_FunctionDecl_error(p):
     """FunctionDecl : KW_FUNC FunctionName error
     | KW_FUNC FunctionName error FunctionBody
     """
-    print_error("Error in function declaration")
+    diagnostics.error("Error in function declaration", p.lineno(1), code="BadDecl")
+    symtab.leave_scopes_to(1)
+    reset_declaration()
+    p[0] = syntree.BadDecl(p.lineno(1))
+
+
+def p_MethodDecl(p):
+    """MethodDecl : KW_FUNC Receiver IDENTIFIER Signature
+    | KW_FUNC Receiver IDENTIFIER Signature FunctionBody
+    """
+    body = p[5] if len(p) == 6 else None
+    p[0] = syntree.Method(p[2], p[3], p[4], lineno=p.lineno(3), body=body)
+    commented.append(p[0])
+    symtab.leave_scope()
+
+
+def p_Receiver(p):
+    """Receiver : receiver_start Parameters"""
+    # the receiver is in the scope of the parameters
+    global parsing_receiver
+    parsing_receiver = False
+    p[0] = p[2]
+
+
+def p_receiver_start(p):
+    """receiver_start :"""
+    global parsing_receiver
+    parsing_receiver = True
+    symtab.enter_scope()
 
 
 def p_FunctionName(p):
@@ -166,7 +315,7 @@ def p_FunctionName(p):
 
 
 def p_Signature(p):
-    """Signature : Parameters
+    """Signature : Parameters %prec SIGNATURE
     | Parameters Result
     """
     if len(p) == 2:
@@ -179,16 +328,127 @@ def p_Parameters(p):
     """Parameters : '(' empty ')'
     | '(' ParameterList ')'
     | '(' ParameterList ',' ')'
+    | '(' error ')'
     """
-    if p[2] is None:
-        p[2] = syntree.List([])
+    if p[2] is None or p.slice[2].type == "error":
+        p[0] = syntree.List([])
+    else:
+        p[0] = make_parameter_list(p[2])
 
-    p[0] = p[2]
+
+def p_TypeParameters(p):
+    """TypeParameters : '[' type_params_start TypeParamList ']'
+    | '[' type_params_start TypeParamList ',' ']'
+    """
+    # a list of the TypeParams, in order
+    p[0] = p[3]
+    type_params_end()
+    if p[0] and not lang.allows(lang.generics, utils.filename):
+        first = p[0][0]
+        diagnostics.error(lang.requires("type parameter", lang.generics), first.lineno,
+                          first.col_num, len(first.typename), kind="TYPE ERROR")
+
+
+def p_type_params_start(p):
+    """type_params_start :"""
+    global forward_type_params
+    forward_type_params = {}
+
+
+def type_params_end():
+    """Reports the types used in the type parameter list, which were
+    taken to be type parameters declared after they are used"""
+    global forward_type_params
+    for type_param in forward_type_params.values():
+        sym = symtab.get_symbol(type_param.typename)
+        if sym is None or sym.value is not type_param:
+            diagnostics.error(
+                f"undefined type {type_param.typename}", type_param.lineno,
+                type_param.col_num, len(type_param.typename), kind="TYPE ERROR"
+            )
+    forward_type_params = None
+
+
+def p_TypeParamList(p):
+    """TypeParamList : TypeParamDecl
+    | TypeParamList ',' TypeParamDecl
+    """
+    if len(p) == 2:
+        p[0] = p[1]
+    else:
+        p[0] = p[1] + p[3]
+
+
+def p_TypeParamDecl(p):
+    """TypeParamDecl : IdentifierList TypeConstraint"""
+    # identifier lists are in reverse order
+    p[0] = declare_type_params(list(reversed(p[1].children)), p[2])
+
+
+def declare_type_params(idents: list, constraint) -> list:
+    """TypeParams of the identifiers with the constraint, they are
+    declared right away, so that the next constraints can refer to them"""
+    if not syntree.is_interface(constraint) and isinstance(constraint, syntree.Type):
+        # a constraint like ~int or int | float64 is short for interface{~int}
+        constraint = syntree.Interface([constraint])
+        constraint._implicit = True
+
+    type_params = []
+    for ident in idents:
+        type_param = forward_type_params.pop(ident.ident_name, None)
+        if type_param is None:
+            type_param = syntree.TypeParam(
+                ident.ident_name, constraint, ident.lineno, ident.col_num
+            )
+        type_param.constraint = constraint
+        type_param.lineno, type_param.col_num = ident.lineno, ident.col_num
+        symtab.add_if_not_exists(ident.ident_name)
+        symtab.declare_new_variable(
+            ident.ident_name, ident.lineno, ident.col_num, value=type_param
+        )
+        type_params.append(type_param)
+    # the parameters declared together, like T, U any, for printing them
+    type_params[0]._group_size = len(type_params)
+    return type_params
+
+
+def p_TypeConstraint(p):
+    """TypeConstraint : Type
+    | TypeUnion
+    | '~' Type
+    """
+    if len(p) == 2:
+        p[0] = p[1]
+    else:
+        p[0] = syntree.TypeUnion([(True, p[2])])
+
+
+def p_TypeUnion(p):
+    """TypeUnion : TypeTerm BAR TypeTerm
+    | TypeUnion BAR TypeTerm
+    """
+    # terms are (tilde, type), left recursive so they are in order
+    if isinstance(p[1], syntree.TypeUnion):
+        p[0] = syntree.TypeUnion(p[1].terms + [p[3]])
+    else:
+        p[0] = syntree.TypeUnion([p[1], p[3]])
+
+
+def p_TypeTerm(p):
+    """TypeTerm : Type
+    | '~' Type
+    """
+    # ~T is any type whose underlying type is T
+    if len(p) == 2:
+        p[0] = (False, p[1])
+    else:
+        p[0] = (True, p[2])
 
 
 def p_Result(p):
     """Result : Parameters
     | TypeName
+    | GenericType
     | TypeLit
     """
     p[0] = p[1]
@@ -202,66 +462,131 @@ def p_ParameterList(p):
         p[1].append(p[3])
         p[0] = p[1]
     elif len(p) == 2:
-        p[0] = syntree.List([p[1]])
+        p[0] = [p[1]]
+
+
+class ParameterEntry:
+    """One entry of a parameter list, as it was parsed
+
+    A lone identifier could either be the name of a parameter (as
+    in a, b int) or its type (as in int, string), which is known
+    only after the whole list is parsed, see make_parameter_list.
+    """
+
+    def __init__(self, ident=None, type_=None, vararg=False, lineno=None, typed=True):
+        # ident is the identifier tuple from the lexer
+        self.ident = ident
+        # if the entry has a type, it is None if it isn't a type (reported already)
+        self.typed = typed
+        self.type_ = type_
+        self.vararg = vararg
+        self.lineno = lineno
 
 
 def p_ParameterDecl(p):
-    """ParameterDecl : Type
+    """ParameterDecl : IDENTIFIER
+    | ParameterType
     | ELLIPSIS Type
-    | IdentifierList Type
-    | IdentifierList ELLIPSIS Type
-    """
-    # TODO: resolve shift/reduce conflict
-
-    # Type and IdentifierList produce shift/reduce conflict
-    # this conflict causes, parser to report syntax error on
-    # unnamed arguments.
-
-    # HOW TO PRODUCE: declare below function
-    # |
-    # |  func test(int, int, bool) {}
-    # |
-    # expected error message:
-    #
-    # SYNTAX ERROR:
-    # at line x, column y
-    #         x:     func test(int, int, bool) {}
-    #                                        ^
-    #
-
-    # CONCERNS: currently parser by default shifts to resolve
-    # shift/reduce conflict. But it is unlikely that, by merely
-    # choosing reduce instead of shift will solve the problem.
-
+    | IDENTIFIER Type
+    | IDENTIFIER ELLIPSIS Type
+    """
+    # the type of a parameter can't be a TypeName here, as the
+    # identifier would be reduced to a TypeName (and looked up
+    # as a type) before knowing if it is a parameter name
     if len(p) == 2:
-        p[0] = syntree.ParameterDecl(p[1])
+        if isinstance(p[1], tuple):
+            p[0] = ParameterEntry(ident=p[1], lineno=p.lineno(1), typed=False)
+        else:
+            p[0] = ParameterEntry(type_=p[1], lineno=p.lineno(1))
     elif len(p) == 3:
-        if isinstance(p[1], syntree.List):
-            for ident in p[1]:
-                ident.add_symtab()
-            p[0] = syntree.ParameterDecl(p[2], ident_list=p[1])
+        if p[1] == "...":
+            p[0] = ParameterEntry(type_=p[2], vararg=True, lineno=p.lineno(1))
         else:
-            p[0] = syntree.ParameterDecl(p[2], vararg=True)
+            p[0] = ParameterEntry(p[1], p[2], lineno=p.lineno(1))
     elif len(p) == 4:
-        for ident in p[1]:
+        p[0] = ParameterEntry(p[1], p[3], vararg=True, lineno=p.lineno(1))
+
+
+def p_ParameterType(p):
+    """ParameterType : TypeLit
+    | '(' Type ')'
+    """
+    if len(p) == 2:
+        p[0] = p[1]
+    elif len(p) == 4:
+        p[0] = p[2]
+
+
+def make_parameter_list(entries: list) -> syntree.List:
+    """Makes the ParameterDecls of a parameter list
+
+    Either all the parameters are named or none of them are. In a list
+    of named parameters, a lone identifier is the name of a parameter
+    which has the type of the next named parameter, like a in a, b int.
+    Ref: https://golang.org/ref/spec#Function_types
+    """
+    parameters = syntree.List([])
+
+    named = any(e.ident is not None and e.typed for e in entries)
+    if not named:
+        for entry in entries:
+            type_ = entry.type_
+            if not entry.typed:
+                type_ = resolve_typename(entry.ident, entry.lineno)
+            parameters.append(syntree.ParameterDecl(type_, vararg=entry.vararg))
+        return parameters
+
+    names = []
+    for entry in entries:
+        if entry.ident is None:
+            diagnostics.error("mixed named and unnamed parameters", entry.lineno)
+            continue
+
+        names.append(entry)
+        if not entry.typed:
+            continue
+
+        ident_list = syntree.List([])
+        # identifier lists are in reverse order
+        for name in reversed(names):
+            ident = syntree.Identifier(name.ident, name.lineno)
             ident.add_symtab()
-        p[0] = syntree.ParameterDecl(p[3], vararg=True, ident_list=p[1])
+            ident_list.append(ident)
+        parameters.append(syntree.ParameterDecl(
+            entry.type_, vararg=entry.vararg, ident_list=ident_list
+        ))
+        names = []
+
+    if names:
+        diagnostics.error("mixed named and unnamed parameters", names[-1].lineno)
+
+    return parameters
 
 
 def p_FunctionBody(p):
-    """FunctionBody : Block"""
-    p[0] = p[1]
+    """FunctionBody : Block
+    | LIT_LBRACE new_scope StatementList '}'
+    """
+    # the '{' after a result type is lexed as the start of a
+    # composite literal (LIT_LBRACE), like in func f() int {...}
+    if len(p) == 2:
+        p[0] = p[1]
+    else:
+        p[0] = syntree.Block(p[3])
+        symtab.leave_scope()
 
 
 def p_Block(p):
     """Block : '{' new_scope StatementList '}' """
-    p[0] = p[3]
+    p[0] = syntree.Block(p[3])
     symtab.leave_scope()
 
 
 def p_new_scope(p):
     """new_scope :"""
     symtab.enter_scope()
+    # the depth of the scope, see p_sync
+    p[0] = symtab.depth
 
 
 def p_leave_scope(p):
@@ -270,10 +595,15 @@ def p_leave_scope(p):
 
 
 def p_StatementList(p):
-    """StatementList : empty
+    """StatementList : Statement
     | Statement ';' StatementList
     """
-    if len(p) == 4:
+    # the semicolon can be omitted before the closing }, like in
+    # { return x }, the last statement is empty otherwise
+    if len(p) == 2:
+        if p[1] is not None:
+            p[0] = syntree.List([p[1]])
+    elif len(p) == 4:
         if p[3] is not None:
             p[3].append(p[1])
             p[0] = p[3]
@@ -281,25 +611,92 @@ def p_StatementList(p):
             p[0] = syntree.List([p[1]])
 
 
+def p_StatementList_error(p):
+    """StatementList : error sync
+    | error sync ';' StatementList
+    """
+    # the tokens up to the end of the statement with the
+    # error are skipped, the next statements are parsed
+    bad = syntree.BadStmt(p.lineno(1))
+    if len(p) == 5 and p[4] is not None:
+        p[4].append(bad)
+        p[0] = p[4]
+    else:
+        p[0] = syntree.List([bad])
+
+
+def p_sync(p):
+    """sync :"""
+    # the scopes entered in the statement with the error are left,
+    # the innermost scope on the stack is the one of the StatementList
+    tok = p.stack[-1].value
+    if (isinstance(tok, lex.LexToken) and tok.type in ("KW_CASE", "KW_DEFAULT")
+            and not in_case_clauses(p.stack)):
+        # a case clause where there can't be one, like in the body of a
+        # function: the statements would end before it again and again.
+        # It is skipped like a statement, up to the ';' it is now
+        if tok is not token_stream.error:
+            p_error(tok)
+        skip_statement(tok)
+        tok.type = ";"
+    for sym in reversed(p.stack):
+        if sym.type == "new_scope":
+            symtab.leave_scopes_to(sym.value)
+            return
+
+
+def in_case_clauses(stack: list) -> bool:
+    """If the innermost block open on the stack of the parser is the
+    body of a switch (or a select) statement, it has the case clauses"""
+    blocks = [i for i, sym in enumerate(stack) if sym.type == "{"]
+    if not blocks:
+        return False
+    for sym in reversed(stack[:blocks[-1]]):
+        if sym.type in ("KW_SWITCH", "KW_SELECT"):
+            return True
+        if sym.type in ("{", "KW_FUNC"):
+            # the body of a function literal in the header
+            return False
+    return False
+
+
 def p_Statement(p):
     """Statement : Block
     | ReturnStmt
     | BreakStmt
     | ContinueStmt
     | IfStmt
+    | SwitchStmt
+    | SelectStmt
     | ForStmt
+    | FallthroughStmt
+    | GotoStmt
+    | LabeledStmt
+    | GoStmt
+    | DeferStmt
     | SimpleStmt
     | Declaration
     """
-    # TODO : Add more statements like SwitchStmt
     p[0] = p[1]
 
 
+def p_GoStmt(p):
+    """GoStmt : KW_GO Expression"""
+    p[0] = syntree.GoStmt(p[2], lineno=p.lineno(1))
+
+
+def p_DeferStmt(p):
+    """DeferStmt : KW_DEFER Expression"""
+    p[0] = syntree.DeferStmt(p[2], lineno=p.lineno(1))
+
+
 def p_ReturnStmt(p):
     """ReturnStmt : KW_RETURN
     | KW_RETURN ExpressionList
     """
-    if len(p) == 3:
+    if len(p) == 2:
+        p[0] = syntree.Keyword("RETURN", lineno=p.lineno(1))
+    elif len(p) == 3:
         p[0] = syntree.Keyword("RETURN", children=[p[2]], lineno=p.lineno(1))
 
 
@@ -328,26 +725,211 @@ def p_ContinueStmt(p):
         p[0] = syntree.Keyword("CONTINUE", ext=p[2], lineno=p.lineno(1))
 
 
+def p_GotoStmt(p):
+    """GotoStmt : KW_GOTO Label"""
+    p[0] = syntree.Keyword("GOTO", ext=p[2], lineno=p.lineno(1))
+
+
+def p_LabeledStmt(p):
+    """LabeledStmt : Label COLON Statement"""
+    # the statement labeled can be empty, like in L: }
+    label = syntree.Identifier(p[1], p.lineno(1))
+    p[0] = syntree.LabeledStmt(label, p[3], lineno=p.lineno(1))
+
+
+def p_FallthroughStmt(p):
+    """FallthroughStmt : KW_FALLTHROUGH"""
+    p[0] = syntree.Keyword("FALLTHROUGH", lineno=p.lineno(1))
+
+
 def p_IfStmt(p):
     """IfStmt : KW_IF new_scope Expression Block
     | KW_IF new_scope SimpleStmt ';' Expression Block
-    | KW_IF new_scope Expression Block leave_scope KW_ELSE IfStmt
-    | KW_IF new_scope Expression Block leave_scope KW_ELSE Block
-    | KW_IF new_scope SimpleStmt ';' Expression Block leave_scope KW_ELSE IfStmt
-    | KW_IF new_scope SimpleStmt ';' Expression Block leave_scope KW_ELSE Block
+    | KW_IF new_scope Expression Block KW_ELSE IfStmt
+    | KW_IF new_scope Expression Block KW_ELSE Block
+    | KW_IF new_scope SimpleStmt ';' Expression Block KW_ELSE IfStmt
+    | KW_IF new_scope SimpleStmt ';' Expression Block KW_ELSE Block
     """
+    # the else branch is in the scope of the if statement too,
+    # so variables declared by SimpleStmt can be used there
     if len(p) == 5:
         p[0] = syntree.IfStmt(body=p[4], expr=p[3], lineno=p.lineno(1))
-        symtab.leave_scope()
-    elif len(p) == 7:
+    elif len(p) == 7 and p[4] == ";":
         p[0] = syntree.IfStmt(body=p[6], expr=p[5], statement=p[3], lineno=p.lineno(1))
-        symtab.leave_scope()
-    elif len(p) == 8:
-        p[0] = syntree.IfStmt(body=p[4], expr=p[3], next_=p[7], lineno=p.lineno(1))
-    elif len(p) == 10:
+    elif len(p) == 7:
+        p[0] = syntree.IfStmt(body=p[4], expr=p[3], next_=p[6], lineno=p.lineno(1))
+    elif len(p) == 9:
         p[0] = syntree.IfStmt(
-            body=p[6], statement=p[3], expr=p[5], next_=p[9], lineno=p.lineno(1)
+            body=p[6], statement=p[3], expr=p[5], next_=p[8], lineno=p.lineno(1)
+        )
+    symtab.leave_scope()
+
+
+def p_SwitchStmt(p):
+    """SwitchStmt : KW_SWITCH new_scope '{' CaseClauseList '}'
+    | KW_SWITCH new_scope Expression '{' CaseClauseList '}'
+    | KW_SWITCH new_scope SimpleStmt ';' '{' CaseClauseList '}'
+    | KW_SWITCH new_scope SimpleStmt ';' Expression '{' CaseClauseList '}'
+    """
+    if len(p) == 6:
+        p[0] = syntree.SwitchStmt(p[4], lineno=p.lineno(1))
+    elif len(p) == 7:
+        p[0] = syntree.SwitchStmt(p[5], expr=p[3], lineno=p.lineno(1))
+    elif len(p) == 8:
+        p[0] = syntree.SwitchStmt(p[6], statement=p[3], lineno=p.lineno(1))
+    elif len(p) == 9:
+        p[0] = syntree.SwitchStmt(p[7], expr=p[5], statement=p[3], lineno=p.lineno(1))
+    symtab.leave_scope()
+
+
+def p_CaseClauseList(p):
+    """CaseClauseList : empty
+    | CaseClause CaseClauseList
+    """
+    if len(p) == 3:
+        if p[2] is not None:
+            p[2].append(p[1])
+            p[0] = p[2]
+        else:
+            p[0] = syntree.List([p[1]])
+
+
+def p_CaseClause(p):
+    """CaseClause : KW_CASE ExpressionList COLON new_scope StatementList
+    | KW_DEFAULT COLON new_scope StatementList
+    """
+    # each clause is a block of its own
+    if len(p) == 6:
+        p[0] = syntree.CaseClause(syntree.Block(p[5]), exprs=p[2], lineno=p.lineno(1))
+    elif len(p) == 5:
+        p[0] = syntree.CaseClause(syntree.Block(p[4]), lineno=p.lineno(1))
+    symtab.leave_scope()
+
+
+def p_TypeSwitchStmt(p):
+    """SwitchStmt : KW_SWITCH new_scope TypeSwitchGuard '{' TypeCaseClauseList '}'
+    | KW_SWITCH new_scope SimpleStmt ';' TypeSwitchGuard '{' TypeCaseClauseList '}'
+    """
+    ident, expr = type_switches.pop()
+    if len(p) == 7:
+        p[0] = syntree.TypeSwitchStmt(p[5], expr, ident, lineno=p.lineno(1))
+    elif len(p) == 9:
+        p[0] = syntree.TypeSwitchStmt(p[7], expr, ident, statement=p[3], lineno=p.lineno(1))
+    symbols = [clause.ident.symbol for clause in in_order(p[0].clauses)
+               if clause.ident is not None]
+    for symbol in symbols:
+        symbol.group = symbols
+    symtab.leave_scope()
+
+
+def p_TypeSwitchGuard(p):
+    """TypeSwitchGuard : PrimaryExpr '.' '(' KW_TYPE ')'
+    | ExpressionList WALRUS PrimaryExpr '.' '(' KW_TYPE ')'
+    """
+    # the variable is declared in each clause, see p_case_variable
+    if len(p) == 6:
+        type_switches.append((None, p[1]))
+        return
+    ident_list = in_order(to_identifier_list(p[1], p.lineno(2)))
+    if len(ident_list) > 1:
+        diagnostics.error("a type switch guard declares only one variable", p.lineno(2))
+    type_switches.append((ident_list[0] if ident_list else None, p[3]))
+
+
+def p_TypeCaseClauseList(p):
+    """TypeCaseClauseList : empty
+    | TypeCaseClause TypeCaseClauseList
+    """
+    if len(p) == 3:
+        if p[2] is not None:
+            p[2].append(p[1])
+            p[0] = p[2]
+        else:
+            p[0] = syntree.List([p[1]])
+
+
+def p_TypeCaseClause(p):
+    """TypeCaseClause : KW_CASE TypeCaseList COLON new_scope case_variable StatementList
+    | KW_DEFAULT COLON new_scope case_variable StatementList
+    """
+    # each clause is a block of its own, with its variable
+    if len(p) == 7:
+        p[0] = syntree.TypeCaseClause(
+            syntree.Block(p[6]), types=syntree.List(list(reversed(p[2]))), ident=p[5],
+            lineno=p.lineno(1)
         )
+    elif len(p) == 6:
+        p[0] = syntree.TypeCaseClause(syntree.Block(p[5]), ident=p[4], lineno=p.lineno(1))
+    symtab.leave_scope()
+
+
+def p_case_variable(p):
+    """case_variable :"""
+    # the variable of the guard, like v in switch v := x.(type), has
+    # the type of the case if it lists only one type, the type of x
+    # otherwise. The types are before the ':' and the new_scope
+    guard, expr = type_switches[-1]
+    if guard is None:
+        return
+    types = p[-3] if isinstance(p[-3], list) else []
+    type_ = syntree.infer_expr_type(expr)
+    if len(types) == 1 and not types[0].nil:
+        type_ = types[0].type_
+    ident = syntree.Identifier((None, guard.ident_name, guard.col_num), guard.lineno)
+    ident.add_symtab()
+    symtab.declare_new_variable(ident.ident_name, ident.lineno, ident.col_num, type_=type_)
+    ident.symbol = symtab.get_symbol(ident.ident_name)
+    p[0] = ident
+
+
+def p_TypeCaseList(p):
+    """TypeCaseList : TypeCase
+    | TypeCaseList ',' TypeCase
+    """
+    # left recursive, so the types are in order
+    if len(p) == 2:
+        p[0] = [p[1]]
+    else:
+        p[0] = p[1] + [p[3]]
+
+
+def p_TypeCase(p):
+    """TypeCase : Type"""
+    # nil is the type of the case of the nil interface value, see p_TypeName
+    if p[1] is nil_case:
+        p[0] = syntree.TypeCase(None, nil=True, lineno=p.lineno(1))
+    else:
+        p[0] = syntree.TypeCase(p[1], lineno=p.lineno(1))
+
+
+def p_SelectStmt(p):
+    """SelectStmt : KW_SELECT '{' CommClauseList '}'"""
+    p[0] = syntree.SelectStmt(p[3], lineno=p.lineno(1))
+
+
+def p_CommClauseList(p):
+    """CommClauseList : empty
+    | CommClause CommClauseList
+    """
+    if len(p) == 3:
+        if p[2] is not None:
+            p[2].append(p[1])
+            p[0] = p[2]
+        else:
+            p[0] = syntree.List([p[1]])
+
+
+def p_CommClause(p):
+    """CommClause : KW_CASE new_scope SimpleStmt COLON StatementList
+    | KW_DEFAULT COLON new_scope StatementList
+    """
+    # each clause is a block of its own, with the variables
+    # declared by its receive, like v := <-ch
+    if len(p) == 6:
+        p[0] = syntree.CommClause(syntree.Block(p[5]), comm=p[3], lineno=p.lineno(1))
+    elif len(p) == 5:
+        p[0] = syntree.CommClause(syntree.Block(p[4]), lineno=p.lineno(1))
+    symtab.leave_scope()
 
 
 def p_ForStmt(p):
@@ -358,7 +940,9 @@ def p_ForStmt(p):
     """
     if len(p) == 5:
         p[0] = syntree.ForStmt(
-            body=p[3], clause=syntree.Literal("bool", "true"), lineno=p.lineno(1)
+            body=p[3],
+            clause=syntree.Literal("bool", "true", lineno=p.lineno(1)),
+            lineno=p.lineno(1),
         )
     elif len(p) == 6:
         p[0] = syntree.ForStmt(body=p[4], clause=p[3], lineno=p.lineno(1))
@@ -375,7 +959,10 @@ def p_ForClause(p):
     """
     if len(p) == 5:
         p[0] = syntree.ForClause(
-            p[1], cond=syntree.Literal("bool", "true"), post=p[4], lineno=p.lineno(1)
+            p[1],
+            cond=syntree.Literal("bool", "true", lineno=p.lineno(1)),
+            post=p[4],
+            lineno=p.lineno(1),
         )
     elif len(p) == 6:
         p[0] = syntree.ForClause(p[1], cond=p[3], post=p[5], lineno=p.lineno(1))
@@ -393,15 +980,16 @@ def p_PostStmt(p):
 
 def p_RangeClause(p):
     """RangeClause : KW_RANGE Expression
-    | IdentifierList WALRUS KW_RANGE Expression
+    | ExpressionList WALRUS KW_RANGE Expression
     | ExpressionList '=' KW_RANGE Expression empty
     """
     if len(p) == 3:
         p[0] = syntree.RangeClause(p[2])
     elif len(p) == 5:
-        for ident in p[1]:
+        ident_list = to_identifier_list(p[1], p.lineno(2))
+        for ident in ident_list:
             ident.add_symtab()
-        p[0] = syntree.RangeClause(p[4], ident_list=p[1])
+        p[0] = syntree.RangeClause(p[4], ident_list=ident_list)
     elif len(p) == 6:
         p[0] = syntree.RangeClause(p[4], expr_list=p[1])
 
@@ -412,10 +1000,16 @@ def p_SimpleStmt(p):
     | IncDecStmt
     | Assignment
     | ShortVarDecl
+    | SendStmt
     """
     p[0] = p[1]
 
 
+def p_SendStmt(p):
+    """SendStmt : Expression ARROW Expression"""
+    p[0] = syntree.SendStmt(p[1], p[3], lineno=p.lineno(2))
+
+
 def p_EmptyStmt(p):
     """EmptyStmt : empty"""
 
@@ -444,18 +1038,48 @@ def p_assign_op(p):
     | MUL_EQ
     | DIV_EQ
     | MOD_EQ
+    | BAR_EQ
+    | AMP_EQ
+    | CARET_EQ
+    | AMP_CARET_EQ
+    | LEFT_SHIFT_EQ
+    | RIGHT_SHIFT_EQ
     """
-    #     # TODO : Add |= ^= <<= >>= &= &^=
     p[0] = p[1]
 
 
 def p_ShortVarDecl(p):
-    """ShortVarDecl : IdentifierList WALRUS ExpressionList"""
-    ident_list = p[1]
+    """ShortVarDecl : ExpressionList WALRUS ExpressionList"""
+    ident_list = to_identifier_list(p[1], p.lineno(2))
     for ident in ident_list:
         ident.add_symtab()
     expr_list = p[3]
     p[0] = syntree.make_variable_decls(ident_list, expression_list=expr_list)
+    p[0]._spec = syntree.Spec(in_order(ident_list), values=in_order(expr_list), span=rule_span(p))
+    p[0]._spec.define = syntree.Token(":=", symbol_span(p.slice[2]) or (NoPos, NoPos))
+    group_specs(":=", [p[0]], False, rule_span(p))
+
+
+def to_identifier_list(expression_list: syntree.List, lineno: int) -> syntree.List:
+    """Identifiers on the left side of :=
+
+    The left side is parsed as an ExpressionList (as for an Assignment)
+    since both start the same way, but it can only have identifiers"""
+    ident_list = syntree.List([])
+    for expr in expression_list:
+        if (
+            not isinstance(expr, syntree.PrimaryExpr)
+            or expr.children
+            or not isinstance(expr.data, tuple)
+        ):
+            diagnostics.error("non-name on left side of :=", lineno)
+            continue
+
+        # it is not a use of a variable declared before
+        if expr.ident is not None and lineno in expr.ident.uses:
+            expr.ident.uses.remove(lineno)
+        ident_list.append(syntree.Identifier(expr.data, expr.lineno))
+    return ident_list
 
 
 def p_Declaration(p):
@@ -472,8 +1096,10 @@ def p_VarDecl(p):
     """
     if len(p) == 3:
         p[0] = syntree.List([p[2]])
+        group_specs("var", [p[2]], False, rule_span(p))
     elif len(p) == 5:
         p[0] = p[3]
+        group_specs("var", in_order(p[3]), True, rule_span(p))
 
 
 def p_VarSpecList(p):
@@ -502,16 +1128,45 @@ def p_VarSpec(p):
         p[0] = syntree.make_variable_decls(p[1], expression_list=p[3])
     elif len(p) == 5:
         p[0] = syntree.make_variable_decls(p[1], p[2], p[4])
+    type_ = p[2] if len(p) != 4 else None
+    values = in_order(p[len(p) - 1]) if len(p) != 3 else None
+    p[0]._spec = syntree.Spec(in_order(p[1]), type_, values, rule_span(p))
+
+
+class ConstDeclState:
+    """State of the const declaration being parsed
+
+    Keeps the value of iota and the last expression list (and type)
+    for the implicit repetition of ConstSpecs without expressions.
+    Ref: https://golang.org/ref/spec#Iota
+    """
+
+    def __init__(self):
+        self.iota = 0
+        self.type_ = None
+        self.expression_list = None
+
+
+const_decl = ConstDeclState()
 
 
 def p_ConstDecl(p):
-    """ConstDecl : KW_CONST ConstSpec
-    | KW_CONST '(' ConstSpecList ')'
+    """ConstDecl : KW_CONST const_decl_start ConstSpec
+    | KW_CONST const_decl_start '(' ConstSpecList ')'
     """
-    if len(p) == 3:
-        p[0] = syntree.List([p[2]])
-    elif len(p) == 5:
-        p[0] = p[3]
+    if len(p) == 4:
+        p[0] = syntree.List([p[3]])
+        group_specs("const", [p[3]], False, rule_span(p))
+    elif len(p) == 6:
+        p[0] = p[4]
+        group_specs("const", in_order(p[4]), True, rule_span(p))
+
+
+def p_const_decl_start(p):
+    """const_decl_start :"""
+    # iota is reset at the start of every const declaration
+    global const_decl
+    const_decl = ConstDeclState()
 
 
 def p_ConstSpecList(p):
@@ -534,12 +1189,31 @@ def p_ConstSpec(p):
     for ident in p[1]:
         ident.add_symtab()
 
-    if len(p) == 2:
-        p[0] = syntree.make_variable_decls(p[1], const=True)
-    elif len(p) == 4:
-        p[0] = syntree.make_variable_decls(p[1], expression_list=p[3], const=True)
+    if len(p) == 4:
+        const_decl.type_ = None
+        const_decl.expression_list = p[3]
     elif len(p) == 5:
-        p[0] = syntree.make_variable_decls(p[1], p[2], p[4], const=True)
+        const_decl.type_ = p[2]
+        const_decl.expression_list = p[4]
+
+    expression_list = const_decl.expression_list
+    iota = const_decl.iota
+    const_decl.iota += 1
+
+    # a ConstSpec without expressions repeats the previous one
+    if expression_list is None or len(expression_list) < len(p[1]):
+        diagnostics.error("missing init expr for const declaration", p.lineno(1), kind="ERROR")
+        p[0] = syntree.make_variable_decls(p[1], const=True)
+    elif len(expression_list) > len(p[1]):
+        diagnostics.error("extra init expr", p.lineno(1), kind="ERROR")
+        p[0] = syntree.make_variable_decls(p[1], const=True)
+    else:
+        p[0] = syntree.make_variable_decls(
+            p[1], const_decl.type_, expression_list, const=True, iota=iota
+        )
+    type_ = p[2] if len(p) == 5 else None
+    values = in_order(p[len(p) - 1]) if len(p) > 2 else None
+    p[0]._spec = syntree.Spec(in_order(p[1]), type_, values, rule_span(p))
 
 
 def p_TypeDecl(p):
@@ -548,8 +1222,10 @@ def p_TypeDecl(p):
     """
     if len(p) == 3:
         p[0] = syntree.List([p[2]])
+        group_specs("type", [p[2]], False, rule_span(p))
     elif len(p) == 5:
         p[0] = p[3]
+        group_specs("type", in_order(p[3]), True, rule_span(p))
 
 
 def p_TypeSpecList(p):
@@ -572,19 +1248,111 @@ def p_TypeSpec(p):
 
 
 def p_TypeDef(p):
-    """TypeDef : IDENTIFIER Type"""
-    new_type: syntree.Type = syntree.Type(
-            "TypeDecl",
-            p[1][1],
-            storage=p[2].storage,
-            children=[p[2]]
-        )
+    """TypeDef : IDENTIFIER declare_type Type
+    | IDENTIFIER declare_type TypeDefParameters Type
+    """
+    new_type: syntree.NamedType = p[2]
+    if len(p) == 5:
+        # the type parameters of a generic type are only in scope in its
+        # definition, its methods declare type parameters of their own
+        for type_param in p[3]:
+            sym = symtab.get_symbol(type_param.typename)
+            if sym is not None and sym.value is type_param:
+                symtab.remove_symbol(sym)
+    new_type.define(p[len(p) - 1])
     p[0] = syntree.TypeDef(p[1], new_type, p.lineno(1))
 
 
+def p_TypeDefParameters(p):
+    """TypeDefParameters : '[' TypeDefParamList ']'
+    | '[' TypeDefParamList ',' ']'
+    """
+    # the definition of the type can refer to instances of it
+    new_type: syntree.NamedType = p[-1]
+    new_type.type_params = p[2]
+    p[0] = p[2]
+    type_params_end()
+
+
+def p_TypeDefParamList(p):
+    """TypeDefParamList : TypeDefParamDecl
+    | TypeDefParamList ',' TypeParamDecl
+    """
+    if len(p) == 2:
+        p[0] = p[1]
+    else:
+        p[0] = p[1] + p[3]
+
+
+def p_TypeDefParamDecl(p):
+    """TypeDefParamDecl : IDENTIFIER type_params_start TypeDefConstraint
+    | IDENTIFIER ',' type_params_start IdentifierList TypeConstraint
+    """
+    # type A[N *T] could also be an array type, with the length N * T.
+    # Like Go, it is an array type, so the constraint of a single type
+    # parameter can't start with *, ( or [ in the type declaration
+    ident = syntree.Identifier(p[1], p.lineno(1))
+    if len(p) == 4:
+        p[0] = declare_type_params([ident], p[3])
+    else:
+        idents = [ident] + list(reversed(p[4].children))
+        p[0] = declare_type_params(idents, p[5])
+
+
+def p_TypeDefConstraint(p):
+    """TypeDefConstraint : TypeName
+    | GenericType
+    | InterfaceType
+    | TypeDefUnion
+    | '~' Type
+    """
+    if len(p) == 2:
+        p[0] = p[1]
+    else:
+        p[0] = syntree.TypeUnion([(True, p[2])])
+
+
+def p_TypeDefUnion(p):
+    """TypeDefUnion : TypeDefTerm BAR TypeTerm
+    | TypeDefUnion BAR TypeTerm
+    """
+    if isinstance(p[1], syntree.TypeUnion):
+        p[0] = syntree.TypeUnion(p[1].terms + [p[3]])
+    else:
+        p[0] = syntree.TypeUnion([p[1], p[3]])
+
+
+def p_TypeDefTerm(p):
+    """TypeDefTerm : TypeName
+    | GenericType
+    | '~' Type
+    """
+    if len(p) == 2:
+        p[0] = (False, p[1])
+    else:
+        p[0] = (True, p[2])
+
+
+def p_declare_type(p):
+    """declare_type : empty"""
+    # the type is declared before its definition is parsed,
+    # so that the definition can refer to it, like a *Node field of Node
+    identifier = p[-1]
+    new_type = forward_types.pop((utils.filename, p.lineno(-1), identifier[2]), None)
+    if new_type is None:
+        new_type = syntree.NamedType(identifier[1])
+        new_type.lineno, new_type.col_num = p.lineno(-1), identifier[2]
+        symtab.add_if_not_exists(identifier[1])
+        symtab.declare_new_variable(
+            identifier[1], p.lineno(-1), identifier[2], value=new_type
+        )
+    p[0] = new_type
+
+
 def p_AliasDecl(p):
     """AliasDecl : IDENTIFIER '=' Type"""
     p[0] = syntree.TypeDef(p[1], p[3], p.lineno(1))
+    p[0]._alias = True
 
 
 def p_IdentifierList(p):
@@ -616,6 +1384,12 @@ def p_Expression(p):
     | Expression '*' Expression
     | Expression '/' Expression
     | Expression '%' Expression
+    | Expression LEFT_SHIFT Expression
+    | Expression RIGHT_SHIFT Expression
+    | Expression AMPERSAND Expression
+    | Expression AMP_CARET Expression
+    | Expression BAR Expression
+    | Expression CARET Expression
     | Expression EQ_EQ Expression
     | Expression NOT_EQ Expression
     | Expression LT Expression
@@ -652,6 +1426,10 @@ def p_UnaryOp(p):
     """UnaryOp : '+' %prec UNARY
     | '-' %prec UNARY
     | '!' %prec UNARY
+    | CARET %prec UNARY
+    | '*' %prec UNARY
+    | AMPERSAND %prec UNARY
+    | ARROW %prec UNARY
     """
     # TODO : Add other unary operators
     p[0] = p[1]
@@ -661,8 +1439,17 @@ def p_PrimaryExpr(p):
     """PrimaryExpr : Operand
     | PrimaryExpr Arguments
     | PrimaryExpr Index
+    | PrimaryExpr Slice
+    | PrimaryExpr Selector
+    | PrimaryExpr TypeAssertion
+    | ConversionType Arguments
     """
     # TODO : This is too less! Many more to add
+    if len(p) == 3 and isinstance(p[1], syntree.Type):
+        # a conversion to a type literal, like []byte(s)
+        p[0] = syntree.FunctionCall(p[1], p[2])
+        p[0].lineno = p.lineno(1)
+        return
     if len(p) == 2:
         if isinstance(p[1], syntree.Node):
             # p[0] = syntree.PrimaryExpr(operand=None, children=[p[1]])
@@ -673,6 +1460,8 @@ def p_PrimaryExpr(p):
     elif len(p) == 3:
         if isinstance(p[2], syntree.Arguments):
             p[0] = syntree.FunctionCall(p[1], p[2])
+        elif isinstance(p[2], syntree.Selector) and is_package_name(p[1]):
+            p[0] = syntree.QualifiedIdent(p[1].data, p[2].data, p[2].lineno)
         else:
             p[0] = syntree.PrimaryExpr(
                       operand=None,
@@ -684,16 +1473,98 @@ def p_PrimaryExpr(p):
 def p_Arguments(p):
     """Arguments : '(' ')'
     | '(' ExpressionList ')'
+    | '(' ExpressionList ELLIPSIS ')'
+    | '(' TypeArgument ')'
+    | '(' TypeArgument ',' ExpressionList ')'
+    | '(' error ')'
     """
+    # a type is the first argument of builtins like make([]int, n),
+    # a declared type is parsed as an expression
     if len(p) == 3:
         p[0] = syntree.Arguments(None)
+    elif len(p) == 4 and isinstance(p[2], syntree.Type):
+        p[0] = syntree.Arguments(None, type_=p[2])
+    elif len(p) == 4 and p.slice[2].type == "error":
+        p[0] = syntree.Arguments(
+            syntree.List([syntree.BadExpr(p.lineno(2), find_column(p.lexpos(2)))])
+        )
     elif len(p) == 4:
         p[0] = syntree.Arguments(p[2])
+    elif p[3] == "...":
+        # the last argument is the slice of the variadic parameter, f(s...)
+        p[0] = syntree.Arguments(p[2], ellipsis=True)
+    else:
+        p[0] = syntree.Arguments(p[4], type_=p[2])
+
+
+def p_TypeArgument(p):
+    """TypeArgument : SliceType
+    | MapType
+    | ChannelType
+    """
+    p[0] = p[1]
+
+
+def p_ConversionType(p):
+    """ConversionType : SliceType
+    | ArrayType
+    | MapType
+    """
+    p[0] = p[1]
+
+
+def is_package_name(expr) -> bool:
+    """If expr is an identifier which could be the name of an imported
+    package (only the packages of the program are in the symbol table)"""
+    return (
+        isinstance(expr, syntree.PrimaryExpr)
+        and isinstance(expr.data, tuple)
+        and not expr.children
+        and (not symtab.is_declared(expr.data[1]) and expr.data[1] not in forward_values
+             or isinstance(symtab.get_symbol(expr.data[1]).value, syntree.Package))
+    )
 
 
 def p_Index(p):
-    """Index : '[' Expression ']'"""
-    p[0] = syntree.Index(p[2])
+    """Index : '[' Expression ']'
+    | '[' Expression ',' ExpressionList ']'
+    """
+    # more than one index is only valid for the type
+    # arguments of a generic function or type, like Pair[int, string]
+    if len(p) == 4:
+        p[0] = syntree.Index(p[2])
+    else:
+        p[4].append(p[2])
+        p[0] = syntree.Index(p[4])
+
+
+def p_Slice(p):
+    """Slice : '[' COLON ']'
+    | '[' Expression COLON ']'
+    | '[' COLON Expression ']'
+    | '[' Expression COLON Expression ']'
+    | '[' COLON Expression COLON Expression ']'
+    | '[' Expression COLON Expression COLON Expression ']'
+    """
+    # the indices are told apart by the positions of the colons
+    indices = [None, None, None]
+    position = 0
+    for item in p[2:-1]:
+        if item == ":":
+            position += 1
+        else:
+            indices[position] = item
+    p[0] = syntree.SliceExpr(*indices, lineno=p.lineno(1))
+
+
+def p_Selector(p):
+    """Selector : '.' IDENTIFIER"""
+    p[0] = syntree.Selector(p[2], p.lineno(2))
+
+
+def p_TypeAssertion(p):
+    """TypeAssertion : '.' '(' Type ')'"""
+    p[0] = syntree.TypeAssertion(p[3], p.lineno(1))
 
 
 def p_Operand(p):
@@ -706,34 +1577,34 @@ def p_Operand(p):
         p[0] = p[1]
     elif len(p) == 4:
         p[0] = p[2]
+        # the parentheses are kept when it is printed
+        p[0]._parens = True
+
+
+def p_Operand_error(p):
+    """Operand : '(' error ')'"""
+    p[0] = syntree.BadExpr(p.lineno(2), find_column(p.lexpos(2)))
 
 
 def p_OperandName(p):
     """OperandName : IDENTIFIER %prec '='
-    | QualifiedIdent
-    """
-    if not isinstance(p[1], syntree.QualifiedIdent):
-        ident: Tuple = p[1]
-        sym = symtab.get_symbol(ident[1])
-        lineno = p.lineno(1)
-        if not symtab.is_declared(ident[1]):
-            print_error()
-            print(f"Undeclared symbol '{ident[1]}' at line {lineno}")
-            print_line(lineno)
-            pos = ident[2] - 1
-            width = len(ident[1])
-            print_marker(pos, width)
-        else:
-            sym.uses.append(lineno)
+    | QUALIFIED_TYPENAME %prec '='
+    """
+    # undefined identifiers are reported by the type checker
+    # a qualified identifier, like fmt.Println, is parsed as a selector
+    # on the package name, see p_PrimaryExpr
+    if p.slice[1].type == "QUALIFIED_TYPENAME":
+        # a type of an imported package, like geometry.Meters(3)
+        package, ident = p[1]
+        p[0] = syntree.QualifiedIdent(package, ident, p.lineno(1))
+        return
+    ident: Tuple = p[1]
+    if symtab.is_declared(ident[1]):
+        symtab.get_symbol(ident[1]).uses.append(p.lineno(1))
 
     p[0] = p[1]
 
 
-def p_QualifiedIdent(p):
-    """QualifiedIdent : PackageName '.' IDENTIFIER"""
-    p[0] = syntree.QualifiedIdent(p[1], p[3], p.lineno(3))
-
-
 def p_Literal(p):
     """Literal : BasicLit
     | FunctionLit
@@ -743,32 +1614,51 @@ def p_Literal(p):
 
 def p_CompositeLit(p):
     """CompositeLit : LiteralType LiteralValue"""
-    p[0] = syntree.Literal(type_=p[1], value=p[2], lineno=p.lineno(1))
+    type_ = p[1]
+    if isinstance(type_, syntree.Array) and type_.length == "...":
+        # the length of [...]T is the one of the elements
+        type_ = syntree.Array(type_.eltype, syntree.literal_length(p[2]))
+        type_._ellipsis = True
+    p[0] = syntree.Literal(type_=type_, value=p[2], lineno=p.lineno(1))
 
 
 def p_LiteralType(p):
-    """LiteralType : ArrayType
-    | '[' '.' '.' '.' ']' ElementType
+    """LiteralType : StructType
+    | ArrayType
+    | '[' ELLIPSIS ']' ElementType
     | SliceType
+    | MapType
+    | TypeName
     """
-    # | TypeName
-    # TypeName is not required as long as StructType is not supported
-    # TODO: add MapType here
-    # TODO: add StructType
     if len(p) == 2:
         p[0] = p[1]
-    else:
-        raise NotImplementedError("Array [...] literal not supported yet")
+    elif p[4] is not None:
+        p[0] = syntree.Array(p[4], "...")
 
 
 def p_LiteralValue(p):
-    """LiteralValue : '{' ElementList '}'"""
+    """LiteralValue : LIT_LBRACE '}'
+    | LIT_LBRACE ElementList '}'
+    """
     if len(p) == 3:
-        p[0] = None
+        p[0] = syntree.LiteralValue(None, p.lineno(1))
     elif len(p) == 4:
-        p[0] = p[2]
-    elif len(p) == 5:
-        p[0] = p[2]
+        p[0] = syntree.LiteralValue(p[2], p.lineno(1))
+    else:
+        raise Exception("Bad grammar or rules!")
+
+
+def p_ElidedLiteralValue(p):
+    """ElidedLiteralValue : '{' '}'
+    | '{' ElementList '}'
+    """
+    # a LiteralValue of an element whose type is elided, like the
+    # {1, 2} in []Point{{1, 2}}. It comes after a '{', ',' or ':'
+    # so the lexer doesn't make its '{' a LIT_LBRACE
+    if len(p) == 3:
+        p[0] = syntree.LiteralValue(None, p.lineno(1))
+    elif len(p) == 4:
+        p[0] = syntree.LiteralValue(p[2], p.lineno(1))
     else:
         raise Exception("Bad grammar or rules!")
 
@@ -784,9 +1674,10 @@ def p_ElementList(p):
 
 def p_KeyedElementList(p):
     """KeyedElementList : KeyedElement
+    | KeyedElement ','
     | KeyedElement ',' KeyedElementList
     """
-    if len(p) == 2:
+    if len(p) in (2, 3):
         p[0] = syntree.List([p[1]])
     elif len(p) == 4:
         p[3].append(p[1])
@@ -796,34 +1687,29 @@ def p_KeyedElementList(p):
 
 
 def p_KeyedElement(p):
-    """KeyedElement : Element"""
-    # TODO: add `Key ':' Element`
+    """KeyedElement : Element
+    | Key COLON Element
+    """
     if len(p) == 2:
         p[0] = p[1]
     elif len(p) == 4:
-        raise Exception("Bad grammar or rules!")
-        # p[0] = (p[1], p[3])
+        p[0] = syntree.KeyedElement(p[1], p[3], p.lineno(2))
     else:
         raise Exception("Bad grammar or rules!")
 
 
-# def p_Key(p):
-#     """Key : FieldName
-#     | Expression
-#     | LiteralValue
-#     """
-#     p[0] = p[1]
-
-
-# def p_FieldName(p):
-#     """FieldName : IDENTIFIER
-#     """
-#     p[0] = p[1]
+def p_Key(p):
+    """Key : Expression
+    | ElidedLiteralValue
+    """
+    # a field name of a struct literal is parsed as an expression too,
+    # the type checker finds out which one it is
+    p[0] = p[1]
 
 
 def p_Element(p):
     """Element : Expression
-    | LiteralValue
+    | ElidedLiteralValue
     """
     p[0] = p[1]
 
@@ -831,16 +1717,30 @@ def p_Element(p):
 def p_BasicLit(p):
     """BasicLit : int_lit
     | float_lit
+    | imaginary_lit
+    | rune_lit
     | string_lit
     | bool_lit
     """
     # TODO : Add other basic literals
-    p[0] = syntree.Literal(p[1][0], p[1][1], lineno=p.lineno(1))
+    exact = p[1][2] if len(p[1]) > 2 else None
+    p[0] = syntree.Literal(
+        p[1][0],
+        p[1][1],
+        lineno=p.lineno(1),
+        exact=exact,
+        col_num=find_column(p.lexpos(1)),
+    )
 
 
 def p_FunctionLit(p):
-    """FunctionLit : KW_FUNC Signature FunctionBody"""
-    p[0] = syntree.Function(None, p[2], p[3])
+    """FunctionLit : KW_FUNC new_scope Signature FunctionBody"""
+    # the parameters are in a scope of their own, like the ones of
+    # a function declaration (see p_FunctionName)
+    p[0] = syntree.Function(None, p[3], p.lineno(1), body=p[4])
+    p[0].col_num = find_column(p.lexpos(1))
+    p[0].scope = symtab.cur_scope
+    symtab.leave_scope()
 
 
 def p_int_lit(p):
@@ -865,6 +1765,16 @@ def p_float_lit(p):
     p[0] = p[1]
 
 
+def p_imaginary_lit(p):
+    """imaginary_lit : IMAGINARY_LIT"""
+    p[0] = p[1]
+
+
+def p_rune_lit(p):
+    """rune_lit : RUNE_LIT"""
+    p[0] = p[1]
+
+
 def p_string_lit(p):
     """string_lit : STRING_LIT"""
 
@@ -882,6 +1792,7 @@ def p_bool_lit(p):
 
 def p_Type(p):
     """Type : TypeName
+    | GenericType
     | TypeLit
     | '(' Type ')'
     """
@@ -893,42 +1804,220 @@ def p_Type(p):
 
 def p_TypeName(p):
     """TypeName : IDENTIFIER
+    | QUALIFIED_TYPENAME
     """
-    def _report_err(err_msg: str, identifier: tuple) -> None:
-        print_error(err_msg, kind="TYPE ERROR")
-        print_line(p.lineno(1))
-        print_marker(identifier[2] - 1, len(identifier[1]))
+    type_name(p)
+    resolved_type_ref(p)
+
+
+def type_name(p):
+    if p.slice[1].type == "QUALIFIED_TYPENAME":
+        # a type of an imported package, see go_lexer.qualified_typename
+        package, ident = p[1]
+        p.slice[0].ident = (ident, p.lineno(1))
+        p[0] = symtab.get_symbol(package[1]).value.members[ident[1]].value
+        add_type_ref(p, f"{package[1]}.{ident[1]}")
+        return
+    # the name of an embedded field, see p_EmbeddedField
+    p.slice[0].ident = (p[1], p.lineno(1))
+    add_type_ref(p, p[1][1])
+    if receiver_type_args:
+        # a type parameter of the generic type of a receiver, its
+        # constraint is the one of the type, see bind_receiver_type_params
+        ident = p[1]
+        p[0] = syntree.TypeParam(ident[1], None, p.lineno(1), ident[2])
+        symtab.add_if_not_exists(ident[1])
+        symtab.declare_new_variable(ident[1], p.lineno(1), ident[2], value=p[0])
+        return
+    name = p[1][1]
+    if name == "nil" and symtab.get_symbol(name) is None and is_type_case(p.stack):
+        p[0] = nil_case
+        return
+    if forward_type_params is not None and symtab.get_symbol(name) is None:
+        # a type parameter declared later in the list, see type_params_end
+        if name not in forward_type_params:
+            forward_type_params[name] = syntree.TypeParam(name, None, p.lineno(1), p[1][2])
+        p[0] = forward_type_params[name]
+        return
+    p[0] = resolve_typename(p[1], p.lineno(1))
+    # the predeclared ones have no line
+    if (name in ("any", "comparable") and getattr(symtab.get_symbol(name), "lineno", 0) is None
+            and not lang.allows(lang.generics, utils.filename)):
+        diagnostics.error(lang.requires(f"predeclared {name}", lang.generics), p.lineno(1),
+                          p[1][2], len(name), kind="TYPE ERROR")
+    if isinstance(p[0], syntree.NamedType) and p[0].type_params and p[0].origin is None:
+        diagnostics.error(
+            f"cannot use generic type {p[1][1]} without instantiation",
+            p.lineno(1), p[1][2], len(p[1][1]), kind="TYPE ERROR"
+        )
 
-    identifier = p[1][1]
-    type_info = symtab.get_symbol(identifier)
-    if type_info is None:
-        err_msg = f"undefined type {identifier}"
-        _report_err(err_msg, p[1])
+
+def is_type_case(stack: list) -> bool:
+    """If the type being parsed is one listed by a case of a type switch,
+    right after the case or a ','"""
+    if not type_switches or not stack:
+        return False
+    if stack[-1].type == "KW_CASE":
+        return True
+    return stack[-1].type == "," and len(stack) > 1 and stack[-2].type == "TypeCaseList"
+
+
+def add_type_ref(p, name: str, type_args: Optional[list] = None):
+    """Keeps how the type the rule reduces to is written, see syntree.TypeRef"""
+    pos, end = rule_span(p)
+    if pos != NoPos:
+        syntree.type_refs[pos] = syntree.TypeRef(name, type_args, (pos, end))
+
+
+def resolved_type_ref(p):
+    """Sets the type the TypeRef of the rule names, once it is parsed"""
+    ref = syntree.type_refs.get(rule_span(p)[0])
+    if ref is not None:
+        ref.type_ = p[0]
+
+
+def p_GenericType(p):
+    """GenericType : IDENTIFIER '[' type_args_start TypeList ']'
+    | QUALIFIED_TYPENAME '[' type_args_start TypeList ']'
+    """
+    # an instance of a generic type, like List[int] or atomic.Pointer[T]
+    generic_type(p)
+    resolved_type_ref(p)
+
+
+def generic_type(p):
+    global receiver_type_args
+    if p.slice[1].type == "QUALIFIED_TYPENAME":
+        package, ident = p[1]
+        add_type_ref(p, f"{package[1]}.{ident[1]}", p[4])
+        generic = symtab.get_symbol(package[1]).value.members[ident[1]].value
+        p[0] = instantiate(ident, p.lineno(1), p[4], generic)
+        return
+    add_type_ref(p, p[1][1], p[4])
+    if receiver_type_args:
+        receiver_type_args = False
+        p[0] = bind_receiver_type_params(p[1], p.lineno(1), p[4])
+        return
+    p[0] = instantiate(p[1], p.lineno(1), p[4])
+
+
+def p_type_args_start(p):
+    """type_args_start :"""
+    # the type arguments of the type of a receiver
+    # declare its type parameters, see p_TypeName
+    global receiver_type_args
+    receiver_type_args = parsing_receiver
+
+
+def p_TypeList(p):
+    """TypeList : Type
+    | TypeList ',' Type
+    """
+    # left recursive, so the types are in order
+    if len(p) == 2:
+        p[0] = [p[1]]
     else:
-        p[0] = type_info.value
-        if not hasattr(type_info.value, "storage"):
-            typename = syntree.infer_expr_typename(type_info.type_)
-            if typename is None:
-                _report_err("type inference failed", p[1])
-                typename = "(undetermined)"
-            err_msg = f"{identifier} (variable of type {typename}) is not a type"
-            _report_err(err_msg, p[1])
+        p[0] = p[1] + [p[3]]
+
+
+def instantiate(identifier: tuple, lineno: int, type_args: list, generic: Any = None):
+    """Instance of the generic type named by the identifier (generic, if it
+    is the one of an imported package), the type checker reports type
+    arguments not satisfying the constraints"""
+    def _report_err(err_msg: str) -> None:
+        diagnostics.error(err_msg, lineno, identifier[2], len(identifier[1]), kind="TYPE ERROR")
+
+    if generic is None:
+        generic = resolve_typename(identifier, lineno)
+    if not isinstance(generic, syntree.NamedType) or None in type_args:
+        return None
+    if not generic.type_params:
+        _report_err(f"{identifier[1]} is not a generic type")
+        return None
+
+    have, want = len(type_args), len(generic.type_params)
+    if have != want:
+        problem = "not enough" if have < want else "too many"
+        _report_err(
+            f"{problem} type arguments for type {identifier[1]}: have {have}, want {want}"
+        )
+        return None
+    return generic.instantiate(type_args)
+
+
+def bind_receiver_type_params(identifier: tuple, lineno: int, type_params: list):
+    """The type of a receiver of a method of a generic type, the instance
+    of the type with the type parameters of the method, like in (s *Stack[T])"""
+    generic = resolve_typename(identifier, lineno)
+    if not isinstance(generic, syntree.NamedType):
+        return None
+    if len(type_params) != len(generic.type_params):
+        diagnostics.error(
+            f"receiver declares {len(type_params)} type parameters, "
+            f"but receiver base type declares {len(generic.type_params)}",
+            lineno, identifier[2], len(identifier[1]), kind="TYPE ERROR",
+            code="BadRecv"
+        )
+        return generic
+
+    for type_param, generic_param in zip(type_params, generic.type_params):
+        type_param.constraint = generic_param.constraint
+    return generic.instantiate(type_params)
+
+
+def resolve_typename(identifier: tuple, lineno: int):
+    """Looks up the type named by the identifier (tuple from the lexer)
+
+    Returns None if it isn't the name of a type"""
+    def _report_err(err_msg: str) -> None:
+        diagnostics.error(err_msg, lineno, identifier[2], len(identifier[1]), kind="TYPE ERROR")
+
+    name = identifier[1]
+    type_info = symtab.get_symbol(name)
+    if type_info is None:
+        _report_err(f"undefined type {name}")
+        return None
+
+    if getattr(type_info, "const", False):
+        _report_err(f"{name} (constant) is not a type")
+        return None
+    if not hasattr(type_info.value, "storage"):
+        typename = syntree.infer_expr_typename(type_info.type_)
+        if typename is None:
+            _report_err("type inference failed")
+            typename = "(undetermined)"
+        _report_err(f"{name} (variable of type {typename}) is not a type")
+        return None
+
+    return type_info.value
 
 
 def p_TypeLit(p):
-    """TypeLit : ArrayType
+    """TypeLit : NonChanTypeLit
+    | ChannelType
+    """
+    p[0] = p[1]
+
+
+def p_NonChanTypeLit(p):
+    """NonChanTypeLit : ArrayType
+    | StructType
     | PointerType
     | FunctionType
+    | InterfaceType
     | SliceType
+    | MapType
     """
     # TODO : Add other type literals
-    # TODO : add StructType
     p[0] = p[1]
 
 
 def p_ArrayType(p):
     """ArrayType : '[' ArrayLength ']' ElementType"""
-    p[0] = syntree.Array(p[4], p[2])
+    # like the other composite types, it isn't a type (None) if its
+    # element type isn't one, the error is reported already
+    if p[4] is not None:
+        p[0] = syntree.Array(p[4], p[2])
 
 
 def p_ArrayLength(p):
@@ -943,59 +2032,176 @@ def p_ElementType(p):
 
 def p_SliceType(p):
     """SliceType : '[' ']' ElementType"""
-    p[0] = syntree.Slice(p[3])
+    if p[3] is not None:
+        p[0] = syntree.Slice(p[3])
+
+
+def p_MapType(p):
+    """MapType : KW_MAP '[' Type ']' ElementType"""
+    if p[3] is not None and p[5] is not None:
+        p[0] = syntree.Map(p[3], p[5], p.lineno(1))
+
+
+def p_ChannelType(p):
+    """ChannelType : SendRecvChanType
+    | ARROW KW_CHAN ElementType
+    """
+    if len(p) == 2:
+        p[0] = p[1]
+    elif p[3] is not None:
+        p[0] = syntree.Chan(p[3], "recv", p.lineno(1))
+
+
+def p_SendRecvChanType(p):
+    """SendRecvChanType : KW_CHAN ChanElementType
+    | KW_CHAN ARROW ElementType
+    """
+    if p[len(p) - 1] is None:
+        p[0] = None
+    elif len(p) == 3:
+        p[0] = syntree.Chan(p[2], lineno=p.lineno(1))
+    else:
+        p[0] = syntree.Chan(p[3], "send", p.lineno(1))
+
+
+def p_ChanElementType(p):
+    """ChanElementType : TypeName
+    | GenericType
+    | NonChanTypeLit
+    | SendRecvChanType
+    | '(' Type ')'
+    """
+    # <- binds to the leftmost chan, so chan <-chan int is chan<- (chan int);
+    # a receive-only element type has to be parenthesized
+    if len(p) == 2:
+        p[0] = p[1]
+    else:
+        p[0] = p[2]
+
+
+def p_StructType(p):
+    """StructType : KW_STRUCT '{' FieldDeclList '}'
+    | KW_STRUCT '{' FieldDeclList FieldDecl '}'
+    """
+    # the ';' after the last field can be omitted, like in struct{x int}
+    if len(p) == 6:
+        p[3].append(p[4])
+    p[0] = syntree.Struct(p[3])
 
 
-# def p_StructType(p):
-#     """StructType : KW_STRUCT '{' FieldDeclList '}' """
-#     p[0] = syntree.Struct(p[3])
+def p_FieldDeclList(p):
+    """FieldDeclList : empty
+    | FieldDeclList FieldDecl ';'
+    """
+    # left recursive, so the fields are in order
+    if len(p) == 2:
+        p[0] = syntree.List([])
+    elif len(p) == 4:
+        p[1].append(p[2])
+        p[0] = p[1]
+    else:
+        raise Exception("Invalid grammar?")
 
 
-# def p_FieldDeclList(p):
-#     """FieldDeclList : empty
-#     | FieldDeclList FieldDecl ';'
-#     """
-#     if len(p) == 2:
-#         p[0] = syntree.List([])
-#     elif len(p) == 4:
-#         p[1].append(p[2])
-#         p[0] = p[1]
-#     else:
-#         raise Exception("Invalid grammar?")
+def p_FieldDecl(p):
+    """FieldDecl : IdentifierList Type Tag
+    | EmbeddedField Tag
+    """
+    if len(p) == 4:
+        p[0] = syntree.StructFieldDecl(p[1], p[2], p[3], rule_span(p))
+    else:
+        ident, type_ = p[1]
+        p[0] = syntree.StructFieldDecl(ident, type_, p[2], rule_span(p))
+    commented.append(p[0])
 
 
-# def p_FieldDecl(p):
-#     """FieldDecl : IdentifierList Type Tag
-#     | EmbeddedField Tag
-#     """
-#     if len(p) == 4:
-#         p[0] = syntree.StructFieldDecl(p[1], p[2], p[3])
-#     else:
-#         p[0] = syntree.StructFieldDecl(p[1], tag=p[2])
+def p_EmbeddedField(p):
+    """EmbeddedField : TypeName
+    | '*' TypeName
+    """
+    # a field without a name is named after its type, like T for *pkg.T
+    ident, lineno = p.slice[-1].ident
+    type_ = p[len(p) - 1]
+    if len(p) == 3 and type_ is not None:
+        type_ = syntree.Pointer(type_)
+        type_.pos, type_.end = rule_span(p)
+    p[0] = (syntree.Identifier(ident, lineno), type_)
+
+
+def p_Tag(p):
+    """Tag : empty
+    | STRING_LIT
+    """
+    p[0] = p[1]
 
 
-# def p_EmbeddedField(p):
-#     """EmbeddedField : '*' TypeName
-#     | TypeName"""
-#     if p[1] == "*":
-#         p[0] = (p[1], p[2])
-#     else:
-#         p[0] = (None, p[1])
+def p_InterfaceType(p):
+    """InterfaceType : KW_INTERFACE '{' InterfaceElemList '}'
+    | KW_INTERFACE '{' InterfaceElemList InterfaceElem '}'
+    """
+    # the ';' after the last element can be omitted, like in interface{m()}
+    if len(p) == 6:
+        p[3].append(p[4])
+    p[0] = syntree.Interface(p[3])
 
 
-# def p_Tag(p):
-#     """Tag : empty
-#     | STRING_LIT
-#     """
-#     p[0] = p[1]
+def p_InterfaceElemList(p):
+    """InterfaceElemList : empty
+    | InterfaceElemList InterfaceElem ';'
+    """
+    # left recursive, so the elements are in order
+    if len(p) == 2:
+        p[0] = []
+    else:
+        p[1].append(p[2])
+        p[0] = p[1]
+
+
+def p_InterfaceElem(p):
+    """InterfaceElem : MethodSpec
+    | IDENTIFIER
+    | TypeUnion
+    | '~' Type
+    """
+    # an identifier is the name of an embedded interface (or a type
+    # in the type set), unions and ~T are only valid in constraints
+    if len(p) == 3:
+        p[0] = syntree.TypeUnion([(True, p[2])])
+    elif isinstance(p[1], tuple):
+        ident = syntree.Identifier(p[1], p.lineno(1))
+        p[0] = (ident, resolve_typename(p[1], p.lineno(1)))
+    else:
+        p[0] = p[1]
+
+
+def p_MethodSpec(p):
+    """MethodSpec : IDENTIFIER Signature"""
+    p[0] = syntree.InterfaceMethod(p[1], p[2], p.lineno(1))
+    commented.append(p[0])
+    forget_parameters(p[2])
+
+
+def forget_parameters(signature: syntree.Signature):
+    """Removes the parameters of a signature without a function body,
+    like the ones of the methods of interfaces, from the symbol table"""
+    for para_list in (signature.parameters, signature.result):
+        if not isinstance(para_list, syntree.List):
+            continue
+        for para in para_list:
+            if para.ident_list is None:
+                continue
+            for ident in para.ident_list:
+                sym = symtab.get_symbol(ident.ident_name)
+                # a symbol declared before with the same name is kept
+                if (sym is not None and sym.lineno == ident.lineno
+                        and sym.col_num == ident.col_num):
+                    symtab.remove_symbol(sym)
 
 
 def p_PointerType(p):
     """PointerType : '*' BaseType"""
-    # TODO: encapsulate error reporting code
-    print_error("PointerType is not supported")
-    print_line(p.lineno(1))
-    print_marker(p.lexpos(1), width=1)  # width = len("*")
+    if p[2] is not None:
+        p[0] = syntree.Pointer(p[2])
 
 
 def p_BaseType(p):
@@ -1005,9 +2211,8 @@ def p_BaseType(p):
 
 def p_FunctionType(p):
     """FunctionType : KW_FUNC Signature"""
-    print_error("FunctionType is not supported")
-    print_line(p.lineno(1))
-    print_marker(p.lexpos(1), width=4)  # width = len("func")
+    p[0] = syntree.FunctionType(p[2])
+    forget_parameters(p[2])
 
 
 def p_empty(p):
@@ -1015,16 +2220,129 @@ def p_empty(p):
     pass
 
 
+def token_text(tok: lex.LexToken) -> str:
+    """The text of a token, like it is in the source"""
+    value = tok.value
+    if not isinstance(value, tuple):
+        return value
+    if value[0] == "identifier":
+        return value[1]
+    if isinstance(value[1], tuple):
+        # a QUALIFIED_TYPENAME, the package and the name of the type
+        return f"{value[0]}.{value[1][1]}"
+    # literals have their text last, if it is not the value
+    return value[-1] if isinstance(value[-1], str) else str(value[1])
+
+
+# the number of syntax errors the parser recovered from
+parse_errors = 0
+
+
+class TokenStream:
+    """The tokens the parser reads, from the lexer once the ones
+    read ahead (by skip_statement) are read"""
+
+    def __init__(self):
+        # called with each token read from the lexer, see incremental.Tree
+        self.watch: Optional[Callable[[lex.LexToken], None]] = None
+        self.reset()
+
+    def reset(self):
+        self.pending = []
+        # the tokens of the file scanned by lex_files, read instead of the lexer
+        self.replay: Optional[go_lexer.Replay] = None
+        # the number of '(' not closed yet in each block, the innermost last
+        self.parens = [0]
+        # the last token p_error reported
+        self.error = None
+        # skip_statement is reading the tokens
+        self.skipping = False
+
+    def token(self) -> Optional[lex.LexToken]:
+        if self.pending:
+            tok = self.pending.pop()
+        else:
+            tok = go_lexer.token() if self.replay is None else self.replay.token()
+            if tok is not None and self.watch is not None:
+                self.watch(tok)
+        if tok is None:
+            return None
+        if tok.type in ("{", "LIT_LBRACE"):
+            self.parens.append(0)
+        elif tok.type == "}" and len(self.parens) > 1:
+            self.parens.pop()
+        elif tok.type == "(":
+            self.parens[-1] += 1
+        elif tok.type == ")" and self.parens[-1] > 0:
+            self.parens[-1] -= 1
+        return tok
+
+    def push_back(self, tok: lex.LexToken):
+        """tok is the next token, it was read already"""
+        if tok.type in ("{", "LIT_LBRACE"):
+            self.parens.pop()
+        elif tok.type == "}":
+            self.parens.append(0)
+        elif tok.type == "(":
+            self.parens[-1] -= 1
+        elif tok.type == ")":
+            self.parens[-1] += 1
+        self.pending.append(tok)
+
+    def __getattr__(self, name):
+        # the position of the parser, like lineno, is the one of the lexer
+        return getattr(go_lexer.lexer, name)
+
+
+token_stream = TokenStream()
+
+
+def skip_statement(tok: lex.LexToken):
+    """Skips the tokens after tok, a token with a syntax error, up to the end
+    of the statement (or the declaration) it is in, with the blocks in it
+
+    The statement ends with the next ';', or with the '}' or the ')' closing
+    the block or the parentheses it is in (a ';' in parentheses doesn't end
+    it). The parser gets that token next, the error productions (like
+    StatementList : error) end with it"""
+    in_parens = token_stream.parens[-1] > 0
+    depth = 1 if tok.type in ("{", "LIT_LBRACE", "(") else 0
+    token_stream.skipping = True
+    try:
+        tok = token_stream.token()
+        while tok is not None:
+            if tok.type in ("{", "LIT_LBRACE", "("):
+                depth += 1
+            elif tok.type in ("}", ")") and depth > 0:
+                depth -= 1
+            elif depth == 0 and (tok.type in ("}", ")", "KW_CASE", "KW_DEFAULT")
+                                 or tok.type == ";" and not in_parens):
+                token_stream.push_back(tok)
+                return
+            tok = token_stream.token()
+    finally:
+        token_stream.skipping = False
+
+
 def p_error(p: lex.LexToken):
-    print(f"{Fore.RED}SYNTAX ERROR:{Style.RESET_ALL}")
+    global parse_errors
+    token_stream.error = p
+    parse_errors += 1
+    if p is not None and (p.type not in (";", "}", ")")
+                          or p.type == ";" and token_stream.parens[-1] > 0):
+        skip_statement(p)
     if p is not None:
-        col = find_column(p.lexpos)
-        print(f"at line {p.lineno}, column {col}")
-        print_line(p.lineno)
-        # print(" " * 10, " \t", " " * (col - 1), "^", sep="")
-        print_marker(col - 1, len(p.value))
+        text = token_text(p)
+        width = len(text)
+        if text == "\n":
+            # a semicolon inserted at the end of the line
+            text, width = "newline", 1
+        diagnostics.error(
+            f"unexpected {text}", p.lineno, find_column(p.lexpos), width,
+            code="UnexpectedToken"
+        )
     else:
-        print("Unexpected end of file")
+        diagnostics.error("Unexpected end of file", code="UnexpectedEOF")
 
 
 def declare_variables(pre_dec: Dict[str, int]):
@@ -1040,53 +2358,1373 @@ def declare_variables(pre_dec: Dict[str, int]):
             value=syntree.Type("BasicType", typename, storage)
         )
 
-
-parser = yacc.yacc(debug=True)
+    # any is an alias for the empty interface
+    symtab.add_if_not_exists("any")
+    symtab.declare_new_variable(
+        symbol="any",
+        lineno=None,
+        col_num=None,
+        type_=None,
+        const=False,
+        value=syntree.Interface([], alias="any")
+    )
+    # the constraint of the types which can be compared with ==
+    symtab.add_if_not_exists("comparable")
+    symtab.declare_new_variable(
+        symbol="comparable",
+        lineno=None,
+        col_num=None,
+        type_=None,
+        const=False,
+        value=syntree.Interface([], alias="comparable")
+    )
+
+    # the interface of errors, interface{ Error() string }
+    symtab.add_if_not_exists("error")
+    symtab.declare_new_variable(
+        symbol="error",
+        lineno=None,
+        col_num=None,
+        type_=None,
+        const=False,
+        value=syntree.error_type()
+    )
+
+    # predeclared constant iota, its value depends on the ConstSpec using it
+    symtab.add_if_not_exists("iota")
+    symtab.declare_new_variable(
+        symbol="iota",
+        lineno=0,
+        col_num=None,
+        type_="int",
+        const=True,
+    )
+
+
+def symbol_span(symbol) -> Optional[Tuple[int, int]]:
+    """The (pos, end) of a symbol of a production, None for the error
+    ones and the empty ones"""
+    if isinstance(symbol, lex.LexToken):
+        return (symbol.pos, symbol.end) if hasattr(symbol, "pos") else None
+    return getattr(symbol, "span", None)
+
+
+def spanning(rule):
+    """The rule, setting the span of the symbols it reduces to the node it makes.
+    A list gets longer with the symbols added to it, other nodes passed up
+    (like the expression in parentheses) keep their span"""
+
+    def reduce(p):
+        count = syntree.Node.count
+        rule(p)
+        spans = [span for span in map(symbol_span, p.slice[1:]) if span is not None]
+        if not spans:
+            return
+        pos, end = spans[0][0], spans[-1][1]
+        p.slice[0].span = (pos, end)
+        node = p[0]
+        if not isinstance(node, syntree.Node):
+            return
+        if node._serial >= count:
+            node.pos, node.end = pos, end
+        elif isinstance(node, syntree.List) and len(p) > 2 and (node is p[1] or node is p[len(p) - 1]):
+            node.pos, node.end = pos, end
+
+    reduce.__name__ = rule.__name__
+    reduce.__doc__ = rule.__doc__
+    return reduce
 
 
-if __name__ == "__main__":
-    with open(sys.argv[1], "rt") as f:
-        input_code = f.read()
-        if input_code[len(input_code) - 1] != "\n":
-            input_code += "\n"
-        go_lexer.input_code = input_code
-        lines = input_code.split("\n")
-        go_lexer.lines = lines
-        utils.lines = lines
-        declare_variables(predefined_identifiers)
-        result = parser.parse(input_code, tracking=True, debug=False)
-        # print(result)
-
-        ast = syntree.postprocess_AST(ast)
-        draw_AST(ast)
-
-        # with open("syntax_tree.txt", "wt", encoding="utf-8") as ast_file:
-        #     sys.stdout = ast_file
-        #     print_tree(ast, nameattr=None, horizontal=True)
-        #     sys.stdout = sys.__stdout__
-
+parser = yacc.yacc(debug=True)
+for production in parser.productions:
+    if production.callable is not None:
+        production.callable = spanning(production.callable)
+# the states with a single reduction read the next token before reducing,
+# so after a syntax error the tokens which can't follow the error
+# productions (for BadDecl, BadStmt and BadExpr) are skipped
+parser.disable_defaulted_states()
+
+
+def package_tokens(filename: str, source: Optional[str] = None) -> list:
+    """The tokens of a file (or of its source, if given), its errors are
+    reported when it is parsed"""
+    with diagnostics.muted():
+        go_lexer.set_input(utils.read_source(filename) if source is None else source)
+        return list(iter(go_lexer.lexer.token, None))
+
+
+def package_types(tokens: list) -> list:
+    """The names (identifiers from the lexer, with their line) of the types
+    declared at the package level of the tokens of a file, not the aliases
+    (their type is only known once it is parsed) nor the generic types"""
+    def spec(i: int) -> bool:
+        # a type TypeSpec starts at tokens[i], like Point struct {...}
+        if i + 1 >= len(tokens) or tokens[i].type != "IDENTIFIER":
+            return False
+        after = tokens[i + 1].type
+        if after == "[":
+            # an array type, not the type parameters of a generic type
+            return i + 2 < len(tokens) and (
+                tokens[i + 2].type in ("]", "INT_LIT")
+                or tokens[i + 2].type == "IDENTIFIER" and tokens[i + 3:i + 4]
+                and tokens[i + 3].type == "]"
+            )
+        return after != "="
+
+    names = []
+    depth = 0
+    i = 0
+    while i < len(tokens):
+        tok = tokens[i]
+        if tok.type in ("{", "LIT_LBRACE", "(", "["):
+            depth += 1
+        elif tok.type in ("}", ")", "]"):
+            depth -= 1
+        elif depth == 0 and tok.type == "KW_TYPE" and i + 1 < len(tokens):
+            if tokens[i + 1].type != "(":
+                if spec(i + 1):
+                    names.append((tokens[i + 1].value, tokens[i + 1].lineno))
+            else:
+                # a group of them, each one after the ( or a ;
+                i += 2
+                inner = 0
+                while i < len(tokens) and not (inner == 0 and tokens[i].type == ")"):
+                    if inner == 0 and tokens[i - 1].type in ("(", ";") and spec(i):
+                        names.append((tokens[i].value, tokens[i].lineno))
+                    if tokens[i].type in ("{", "LIT_LBRACE", "(", "["):
+                        inner += 1
+                    elif tokens[i].type in ("}", ")", "]"):
+                        inner -= 1
+                    i += 1
+        i += 1
+    return names
+
+
+def package_values(tokens: list) -> list:
+    """The names of the constants and the variables declared at the
+    package level of the tokens of a file"""
+
+    def spec(i: int) -> list:
+        # the identifiers of the ConstSpec or VarSpec at tokens[i]
+        names = []
+        while i < len(tokens) and tokens[i].type == "IDENTIFIER":
+            names.append(tokens[i].value[1])
+            if i + 1 >= len(tokens) or tokens[i + 1].type != ",":
+                break
+            i += 2
+        return names
+
+    names = []
+    depth = 0
+    i = 0
+    while i < len(tokens):
+        tok = tokens[i]
+        if tok.type in ("{", "LIT_LBRACE", "(", "["):
+            depth += 1
+        elif tok.type in ("}", ")", "]"):
+            depth -= 1
+        elif depth == 0 and tok.type in ("KW_VAR", "KW_CONST") and i + 1 < len(tokens):
+            if tokens[i + 1].type != "(":
+                names.extend(spec(i + 1))
+            else:
+                i += 2
+                inner = 0
+                while i < len(tokens) and not (inner == 0 and tokens[i].type == ")"):
+                    if inner == 0 and tokens[i - 1].type in ("(", ";"):
+                        names.extend(spec(i))
+                    if tokens[i].type in ("{", "LIT_LBRACE", "(", "["):
+                        inner += 1
+                    elif tokens[i].type in ("}", ")", "]"):
+                        inner -= 1
+                    i += 1
+        i += 1
+    return names
+
+
+def declare_package_names(package: loader.Package, sources: Optional[Dict[str, str]] = None,
+                          scanned: Optional[Dict[str, go_lexer.Scanned]] = None):
+    """Declares the types of the package before its files are parsed, so
+    they can be used before their declaration (in any of the files), see
+    forward_types. p_declare_type defines them. The constants and the
+    variables have symbols too (not declared yet), so the uses before
+    their declaration are the same symbols. sources are the sources of
+    the files to parse, by name, if they are not the ones on disk, and
+    scanned their tokens if lex_files scanned them"""
+    forward_types.clear()
+    forward_values.clear()
+    for filename in package.files if sources is None else sources:
+        if scanned:
+            tokens: list = scanned[filename].tokens
+        else:
+            tokens = package_tokens(filename, None if sources is None else sources[filename])
+        utils.set_file(filename)
+        for ident, lineno in package_types(tokens):
+            named = syntree.NamedType(ident[1])
+            named.lineno, named.col_num = lineno, ident[2]
+            forward_types[(filename, lineno, ident[2])] = named
+            symtab.add_if_not_exists(ident[1])
+            symtab.declare_new_variable(ident[1], lineno, ident[2], value=named)
+        for name in package_values(tokens):
+            if name != "_":
+                forward_values.add(name)
+                symtab.add_if_not_exists(name)
+
+
+def import_packages(package: loader.Package, dependency: bool):
+    """Makes the members of the packages imported by the package the ones
+    its files refer to, see imported"""
+    imported.clear()
+    for path, other in package.imports.items():
+        if other is not None:
+            imported[path] = other.members
+    syntree.imported_package = package.name if dependency else None
+
+
+def start_package(package: loader.Package, dependency: bool,
+                  sources: Optional[Dict[str, str]] = None,
+                  scanned: Optional[Dict[str, go_lexer.Scanned]] = None):
+    """Starts parsing the files of the package (see parse_file), with new
+    symbols and an empty AST. sources and scanned are the ones of
+    declare_package_names"""
+    global ast
+    # the nodes of nested expressions and types are walked recursively
+    sys.setrecursionlimit(max(sys.getrecursionlimit(), 20000))
+    ast = syntree.Node("start", children=[])
+    symtab.switch([])
+    declare_variables(predefined_identifiers)
+    import_packages(package, dependency)
+    declare_package_names(package, sources, scanned)
+
+
+def parse_file(filename: str, source: str,
+               scanned: Optional[go_lexer.Scanned] = None) -> Optional[syntree.File]:
+    """Parses source, the source of a file of the package being parsed, with
+    its tokens scanned by lex_files if given. The File node is added to
+    the AST, None if the parser can't make one. The nodes which can have
+    comments are in commented afterwards"""
+    go_lexer.set_input(source, filename)
+    utils.sources[filename] = go_lexer.lines
+    utils.set_file(filename)
+    token_stream.reset()
+    if scanned is not None:
+        token_stream.replay = go_lexer.Replay(scanned)
+    reset_declaration()
+    commented.clear()
+    type_switches.clear()
+    count = len(ast.children)
+    parser.parse(lexer=token_stream, tracking=True, debug=False)
+    return ast.children[0] if len(ast.children) > count else None
+
+
+def set_members(package: loader.Package):
+    """Sets the members of the package, the package level symbols
+    other than the packages imported"""
+    members = {
+        sym.name: sym for sym in package.symbols
+        if sym.scope_id == "1" and sym.lineno and not isinstance(sym.value, syntree.Package)
+    }
+    package.members = syntree.Package(package.name, package.path, members)
+
+
+def parse_package(package: loader.Package, dependency: bool,
+                  ctx: Optional[cancel.Context] = None):
+    """Parses the files of the package, their declarations are in the same
+    package scope. The packages it imports have to be parsed before it
+
+    The symtab has the symbols of the package afterwards, they are the
+    ones of package.symbols. Dependencies are the packages imported by
+    others. Raises the error of ctx if it is done before a file is parsed"""
+    sources = {filename: utils.read_source(filename) for filename in package.files}
+    scanned = lex_files(sources)
+    start_package(package, dependency, sources, scanned)
+    for filename in package.files:
+        cancel.check(ctx)
+        parse_file(filename, sources[filename], scanned.get(filename))
+
+    package.ast = syntree.postprocess_AST(ast)
+    package.symbols = symtab.symbols
+    set_members(package)
+
+
+# the number of worker processes lexing the files of a package, the number
+# of CPUs by default (GOPY_JOBS sets it), 1 in the browser (Pyodide), which
+# has no processes. The packages with fewer than parallel_files files, or
+# with less than parallel_size bytes of source, are lexed by the parser
+# itself, as it reads them: starting the workers and reading back their
+# tokens takes longer than lexing them (GOPY_PARALLEL_FILES and
+# GOPY_PARALLEL_SIZE set them, golden.py lowers them to 1 so the files of
+# the tests are lexed by the workers too)
+jobs = 1 if sys.platform == "emscripten" else (
+    int(os.environ.get("GOPY_JOBS", 0)) or os.cpu_count() or 1)
+parallel_files = int(os.environ.get("GOPY_PARALLEL_FILES", 0)) or 8
+parallel_size = int(os.environ.get("GOPY_PARALLEL_SIZE", 0)) or 256 * 1024
+pool: Optional[concurrent.futures.ProcessPoolExecutor] = None
+
+
+def lex_files(sources: Dict[str, str]) -> Dict[str, go_lexer.Scanned]:
+    """The tokens of the files of a package (sources by file name), scanned
+    concurrently by a pool of jobs workers (see go_lexer.scan), in the
+    order of the files. Empty if they are lexed as they are parsed
+
+    Only the lexing is concurrent: the files of a package are parsed in
+    order, their declarations (and the numbers of their scopes) are the
+    ones of the package scope"""
+    global pool
+    if (jobs < 2 or len(sources) < parallel_files
+            or sum(len(source) for source in sources.values()) < parallel_size):
+        return {}
+    if pool is None:
+        pool = concurrent.futures.ProcessPoolExecutor(jobs)
+        atexit.register(shutdown_pool)
+    chunksize = max(1, len(sources) // (jobs * 4))
+    return dict(zip(sources, pool.map(go_lexer.scan, sources, sources.values(),
+                                      chunksize=chunksize)))
+
+
+def shutdown_pool():
+    """Stops the workers of lex_files, at exit"""
+    global pool
+    if pool is not None:
+        pool.shutdown(cancel_futures=True)
+        pool = None
+
+
+def check_program(path: str, verbose: bool = True, info: Optional[checker.Info] = None,
+                  warnings: bool = False, tests: bool = False, cached: bool = False,
+                  ctx: Optional[cancel.Context] = None) -> list:
+    """Parses and type checks the program in path, a directory or a file
+
+    Returns its packages (its own package is the last one), the errors
+    are reported to diagnostics. The symbol table of each package imported
+    is printed if verbose (not the ones of std), what is found about the expressions of the
+    packages is added to info, if given. If warnings, the shadowed and
+    unused declarations are reported too (see checker.Checker.unused). If
+    tests, the package in path has its tests (see loader.load). If cached,
+    the packages are the ones of the build cache, if the program didn't
+    change since they were checked (see cache.py). The analyzers
+    registered are run on the program once it is checked (see analysis.py).
+    If ctx is done before the end, its error is raised (see cancel.py), the
+    diagnostics reported so far are the ones of the part checked"""
+    packages = loader.load(path, tests)
+    if info is None and analysis.analyzers:
+        info = checker.Info()
+    key = None
+    if cached and cache.enabled and packages and not diagnostics.errors():
+        key = cache.key(packages, tests, warnings, info is not None, lang.version,
+                        diagnostics.strict, sorted(diagnostics.suppressed))
+        loaded = cache.load(key, info)
+        if loaded is not None:
+            analysis.run(loaded, info)
+            return loaded
+    reported = len(diagnostics.reported)
+    for package in packages:
+        dependency = package is not packages[-1]
+        parse_package(package, dependency, ctx)
+        type_check(package, info, warnings, ctx)
+        if dependency and verbose and not package.std:
+            print(f"Symbol Table of package {package.path}: ")
+            print(symtab)
+    if key is not None and not diagnostics.errors() and not parse_errors:
+        cache.store(key, packages, info, diagnostics.reported[reported:])
+    if packages and not diagnostics.errors() and not parse_errors:
+        analysis.run(packages, info)
+    return packages
+
+
+def package_imports(package: loader.Package) -> Dict[str, tuple]:
+    """The names and the scopes of the packages imported by the package, by
+    import path, see checker.check_package (they are type checked before)"""
+    return {
+        path: (other.name, other.scope)
+        for path, other in package.imports.items() if other is not None
+    }
+
+
+def type_check(package: loader.Package, info: Optional[checker.Info] = None,
+               warnings: bool = False, ctx: Optional[cancel.Context] = None):
+    """Type checks the package parsed, whose symbols are the ones of the
+    symtab, the errors are reported to diagnostics (see check_program)"""
+    found, package.scope = checker.check_package(package.ast, package_imports(package),
+                                                 info, warnings, ctx)
+    # no warnings on the lines with errors, like the imports not found
+    # or the variables the symbol table reports as unused
+    errors = {(s.file, s.lineno) for s in symtab.unused_symbols()}
+    errors.update((d.file, d.lineno) for d in diagnostics.errors() + found
+                  if d.severity == "error")
+    for diagnostic in found:
+        if diagnostic.severity == "error" or (diagnostic.file, diagnostic.lineno) not in errors:
+            diagnostics.report(diagnostic)
+    # the parameters of the functions of std are not used, they have no bodies
+    if not package.std:
         symtab.check_unused()
 
-        print("Finished Parsing!")
-        print("Symbol Table: ")
-        print(symtab)
-        with open("symbol_table.txt", "wt", encoding="utf-8") as symtab_file:
-            print(symtab, file=symtab_file)
-
-        symtab.reset_depth()
-        # Intermediate Code gen
-        ic = intermediate_codegen(ast)
-
-        print("Intermediate code:")
-        print(ic)
-        ic.print_three_address_code()
 
-        print(symtab)
-
-        ico = optimize_ic(ic)
+def build(argv: list):
+    """gopy build --target=python path -o dir, writes the program with the
+    backend given (see backend.py), --target alone lists them"""
+    arg_parser = argparse.ArgumentParser(prog="gopy build",
+                                         description="Translates a Go program to another language")
+    arg_parser.add_argument("path", nargs="?", help="a .go file, or the directory of a program")
+    arg_parser.add_argument("--target", nargs="?", const="", required=True,
+                            help="the backend writing the program (python writes a python 3 "
+                                 "module for each package), without a name lists them")
+    arg_parser.add_argument("-o", "--output", default="build",
+                            help="the directory the program is written to")
+    add_optimize_flag(arg_parser)
+    arg_parser.add_argument("--permissive", action="store_true",
+                            help="skips the constructs gopy doesn't support yet, with warnings "
+                                 "(they are errors by default, in strict mode)")
+    arg_parser.add_argument("-lang", metavar="VERSION",
+                            help="the version of Go the program is written in (like go1.21)")
+    add_cache_flag(arg_parser)
+    add_plugin_flag(arg_parser)
+    args = arg_parser.parse_args(argv)
+    diagnostics.strict = not args.permissive
+    set_lang(arg_parser, args.lang)
+    set_cache(args.cache)
+    load_plugins(arg_parser, args.plugin)
+    if not args.target:
+        print(backend.listing())
+        sys.exit(0)
+    target = find_backend(arg_parser, "--target", args.target, compiles=True)
+    if args.path is None:
+        arg_parser.error("the following arguments are required: path")
+
+    info = checker.Info()
+    packages = check_program(args.path, verbose=False, info=info, cached=True)
+    if not packages or diagnostics.errors() or parse_errors:
+        sys.exit(1)
+    if args.optimize:
+        optimize.optimize(packages, info)
+    if not target.compile(packages, info, args.output):
+        sys.exit(1)
+    print(f"Wrote {target.output(packages, args.output)}")
+    sys.exit(0)
+
+
+def export(argv: list):
+    """gopy export path -o dir, writes a package as python modules with
+    their stubs, for the python code calling it"""
+    arg_parser = argparse.ArgumentParser(prog="gopy export",
+                                         description="Translates a Go package to Python modules "
+                                                     "with typed stubs")
+    arg_parser.add_argument("path", help="a .go file, or the directory of a package")
+    arg_parser.add_argument("-o", "--output", default="build",
+                            help="the directory the modules and their stubs are written to")
+    arg_parser.add_argument("--permissive", action="store_true",
+                            help="skips the constructs gopy doesn't support yet, with warnings "
+                                 "(they are errors by default, in strict mode)")
+    arg_parser.add_argument("-lang", metavar="VERSION",
+                            help="the version of Go the package is written in (like go1.21)")
+    add_cache_flag(arg_parser)
+    args = arg_parser.parse_args(argv)
+    diagnostics.strict = not args.permissive
+    set_lang(arg_parser, args.lang)
+    set_cache(args.cache)
+
+    import pygen
+    import stubs
+    info = checker.Info()
+    packages = check_program(args.path, verbose=False, info=info, cached=True)
+    if not packages or diagnostics.errors() or parse_errors:
+        sys.exit(1)
+    if not pygen.build(packages, info, args.output):
+        sys.exit(1)
+    stubs.write(packages, info, args.output)
+    name = pygen.mangle(packages[-1].name)
+    print(f"Wrote {os.path.join(args.output, name + '.py')} and {name}.pyi")
+    sys.exit(0)
+
+
+def check(argv: list):
+    """gopy check path, prints the diagnostics of the program"""
+    arg_parser = argparse.ArgumentParser(prog="gopy check",
+                                         description="Type checks a Go program")
+    arg_parser.add_argument("path", help="a .go file, or the directory of a program")
+    arg_parser.add_argument("-W", "--warnings", action="store_true",
+                            help="also reports the shadowed and unused declarations")
+    arg_parser.add_argument("--permissive", action="store_true",
+                            help="skips the constructs gopy doesn't support yet, with warnings "
+                                 "(they are errors by default, in strict mode)")
+    arg_parser.add_argument("-lang", metavar="VERSION",
+                            help="the version of Go the program is written in (like go1.21)")
+    add_watch_flag(arg_parser, "checks it again each time its files change, printing the "
+                               "diagnostics new and fixed (until interrupted), see watch.py")
+    args = arg_parser.parse_args(argv)
+    diagnostics.strict = not args.permissive
+    set_lang(arg_parser, args.lang)
+    if args.watch:
+        sys.exit(watch_program(args.path, args.warnings, args.debounce))
+    diagnostics.printing = False
+    with contextlib.redirect_stdout(io.StringIO()):
+        check_program(args.path, verbose=False, warnings=args.warnings)
+    diagnostics.print_diagnostics(diagnostics.reported)
+    sys.exit(1 if diagnostics.errors() or parse_errors else 0)
+
+
+def run(argv: list):
+    """gopy run path [arguments], runs the program with the arguments"""
+    arg_parser = argparse.ArgumentParser(prog="gopy run",
+                                         description="Checks and runs a Go program")
+    arg_parser.add_argument("path", help="a .go file, or the directory of a program")
+    arg_parser.add_argument("arguments", nargs=argparse.REMAINDER,
+                            help="the arguments of the program (os.Args[1:])")
+    arg_parser.add_argument("--exec", metavar="BACKEND",
+                            help="runs it with the tree walking interpreter (interp, the "
+                                 "default), the bytecode VM (vm) or another backend "
+                                 "(build --target lists them)")
+    arg_parser.add_argument("-race", action="store_true",
+                            help="reports the data races of its goroutines (see race.py), "
+                                 "it runs with the VM")
+    add_optimize_flag(arg_parser)
+    arg_parser.add_argument("-W", "--warnings", action="store_true",
+                            help="also reports the shadowed and unused declarations")
+    arg_parser.add_argument("--permissive", action="store_true",
+                            help="skips the constructs gopy doesn't support yet, with warnings "
+                                 "(they are errors by default, in strict mode)")
+    arg_parser.add_argument("-lang", metavar="VERSION",
+                            help="the version of Go the program is written in (like go1.21)")
+    arg_parser.add_argument("--fake-clock", action="store_true",
+                            help="runs it with the fake clock of the time package, starting at "
+                                 "2009-11-10 23:00:00 UTC and moving only when it sleeps")
+    arg_parser.add_argument("-coverprofile", metavar="FILE",
+                            help="writes the coverage profile of the packages of the program "
+                                 "to FILE when it ends, like go test -coverprofile")
+    arg_parser.add_argument("-covermode", choices=cover.modes, default="set",
+                            help="counts if each statement runs (set, the default), or how "
+                                 "many times (count or atomic)")
+    arg_parser.add_argument("-timeout", type=duration, metavar="DURATION",
+                            help="aborts the check and the run once they take longer than "
+                                 "DURATION (like 10s or 1m30s)")
+    arg_parser.add_argument("-max-steps", type=int, metavar="N",
+                            help="aborts the run after N steps: the statements run by the "
+                                 "interpreter, the calls and the loop iterations of the VM")
+    arg_parser.add_argument("-sandbox", action="store_true",
+                            help="runs it in a sandbox, for the code which isn't trusted: "
+                                 "64 MiB allocated, 1 MiB of output, no files and 1000 "
+                                 "goroutines at most (see sandbox.py), the flags below "
+                                 "change them")
+    arg_parser.add_argument("-max-heap", type=int, metavar="BYTES",
+                            help="aborts the run once it allocated more than BYTES")
+    arg_parser.add_argument("-max-output", type=int, metavar="BYTES",
+                            help="aborts the run before it writes more than BYTES to stdout "
+                                 "and stderr")
+    arg_parser.add_argument("-max-goroutines", type=int, metavar="N",
+                            help="aborts the run once it has more than N goroutines at once "
+                                 "(main included)")
+    arg_parser.add_argument("-allow", type=syscall_list, metavar="SYSCALLS",
+                            help="the only syscalls the run can make, separated by commas "
+                                 "(like os.read,os.write), the others abort it")
+    add_profile_flags(arg_parser)
+    add_cache_flag(arg_parser)
+    add_plugin_flag(arg_parser)
+    add_watch_flag(arg_parser, "checks it again each time its files change and runs it again "
+                               "while it has no errors (until interrupted), see watch.py")
+    args = arg_parser.parse_args(argv)
+    if args.race and args.exec == "interp":
+        arg_parser.error("-race runs the program with the VM, not --exec=interp")
+    diagnostics.strict = not args.permissive
+    set_lang(arg_parser, args.lang)
+    set_cache(args.cache)
+    load_plugins(arg_parser, args.plugin)
+    if args.exec is not None:
+        find_backend(arg_parser, "--exec", args.exec, runs=True)
+    if args.watch:
+        # the flags before the path, the arguments of the program are after it
+        flags = argv[:len(argv) - len(args.arguments)]
+        command = [sys.executable, sys.argv[0], "run"] + watched(flags) + args.arguments
+        sys.exit(watch_program(args.path, args.warnings, args.debounce, command))
+    ctx = None
+    if args.timeout is not None:
+        ctx = cancel.with_timeout(cancel.background(), args.timeout)
+    engine = args.exec or ("vm" if args.race else "interp")
+    sys.exit(execute(args.path, engine, [args.path] + args.arguments, args.warnings,
+                     args.fake_clock, args.coverprofile, args.covermode,
+                     args.cpuprofile, args.memprofile, cached=True, ctx=ctx,
+                     max_steps=args.max_steps, limits=sandbox_limits(args),
+                     race=args.race, optimized=args.optimize))
+
+
+def add_watch_flag(arg_parser: argparse.ArgumentParser, help: str):
+    """The flags of the watch mode of check and run"""
+    arg_parser.add_argument("--watch", action="store_true", help=help)
+    arg_parser.add_argument("-debounce", type=duration, metavar="DURATION",
+                            help="how long the files have to stay the same after a change "
+                                 "before they are checked (200ms by default)")
+
+
+def watched(flags: list) -> list:
+    """The flags without the ones of the watch mode"""
+    found = []
+    skip = False
+    for flag in flags:
+        if skip:
+            skip = False
+        elif flag == "-debounce":
+            skip = True
+        elif flag != "--watch" and not flag.startswith("-debounce="):
+            found.append(flag)
+    return found
+
+
+def watch_program(path: str, warnings: bool, debounce: Optional[float],
+                  command: Optional[list] = None) -> int:
+    """Watches the program of path, see watch.py"""
+    import watch
+    if debounce is not None:
+        watch.debounce = debounce
+    return watch.watch(path, warnings, command)
+
+
+def sandbox_limits(args: argparse.Namespace) -> Optional[sandbox.Limits]:
+    """The limits of the sandbox flags of run, None without them"""
+    if not args.sandbox and args.max_heap is None and args.max_output is None \
+            and args.max_goroutines is None and args.allow is None:
+        return None
+    found = sandbox.default() if args.sandbox else sandbox.Limits()
+    if args.max_heap is not None:
+        found.heap = args.max_heap
+    if args.max_output is not None:
+        found.output = args.max_output
+    if args.max_goroutines is not None:
+        found.goroutines = args.max_goroutines
+    if args.allow is not None:
+        found.syscalls = args.allow
+    return found
+
+
+def syscall_list(text: str) -> frozenset:
+    """The syscalls of -allow, see sandbox.parse_syscalls"""
+    try:
+        return sandbox.parse_syscalls(text)
+    except ValueError as e:
+        raise argparse.ArgumentTypeError(str(e))
+
+
+def duration(text: str) -> float:
+    """The seconds of a flag like -timeout=1m30s, see cancel.parse_duration"""
+    try:
+        return cancel.parse_duration(text)
+    except ValueError as e:
+        raise argparse.ArgumentTypeError(str(e))
+
+
+def add_profile_flags(arg_parser: argparse.ArgumentParser):
+    """The flags of the profiles of run and test, see pprof.py"""
+    arg_parser.add_argument("-cpuprofile", metavar="FILE",
+                            help="writes the CPU profile of the Go functions of the program "
+                                 "to FILE when it ends, for go tool pprof")
+    arg_parser.add_argument("-memprofile", metavar="FILE",
+                            help="writes the profile of the allocations of the Go functions "
+                                 "of the program to FILE when it ends, for go tool pprof")
+
+
+def new_profiler(cpuprofile: Optional[str], memprofile: Optional[str]):
+    """The pprof.Profiler of the profiles asked for, None if none is"""
+    if cpuprofile is None and memprofile is None:
+        return None
+    import pprof
+    return pprof.Profiler(cpu=cpuprofile is not None, memory=memprofile is not None)
+
+
+def add_optimize_flag(arg_parser: argparse.ArgumentParser):
+    """The flag of the optimizations of build and run, see optimize.py"""
+    arg_parser.add_argument("-O", dest="optimize", action="store_true",
+                            help="optimizes the program: folds the constants of its "
+                                 "expressions, removes its branches on constant conditions "
+                                 "and its dead stores")
+
+
+def add_plugin_flag(arg_parser: argparse.ArgumentParser):
+    """The flag of the plugins registering analyzers, see analysis.py"""
+    arg_parser.add_argument("-plugin", action="append", default=[], metavar="MODULE",
+                            help="imports the python module (or file) MODULE, whose "
+                                 "analyzers report their warnings once the program is "
+                                 "checked (can be repeated)")
+
+
+def load_plugins(arg_parser: argparse.ArgumentParser, plugins: List[str]):
+    for plugin in plugins:
+        try:
+            module = analysis.load_plugin(plugin)
+        except Exception as e:
+            arg_parser.error(f"cannot load plugin {plugin}: {e}")
+        backend.register(*getattr(module, "backends", []))
+
+
+def find_backend(arg_parser: argparse.ArgumentParser, flag: str, name: str,
+                 compiles: bool = False, runs: bool = False) -> backend.Backend:
+    """The backend registered with the name given to the flag, which must
+    compile or run the programs"""
+    found = backend.lookup(name)
+    names = ", ".join(b.name for b in backend.backends
+                      if (b.compiles() or not compiles) and (b.runs() or not runs))
+    if found is None:
+        arg_parser.error(f"unknown backend {name}, {flag} is one of {names}")
+    if (compiles and not found.compiles()) or (runs and not found.runs()):
+        does = "build" if compiles else "run"
+        arg_parser.error(f"the {name} backend doesn't {does} the programs, "
+                         f"{flag} is one of {names}")
+    return found
+
+
+def add_cache_flag(arg_parser: argparse.ArgumentParser):
+    """The flag of the build cache of run, test, build and debug"""
+    arg_parser.add_argument("-cache", choices=["on", "off"], default="on",
+                            help="off parses and type checks the program again instead of "
+                                 "loading it from the build cache, if it didn't change "
+                                 "(see cache.py)")
+
+
+def set_cache(value: str):
+    """Turns the build cache off if -cache=off"""
+    if value == "off":
+        cache.enabled = False
+
+
+def write_profiles(profiler, cpuprofile: Optional[str], memprofile: Optional[str]):
+    if profiler is None or profiler.machine is None:
+        return
+    if cpuprofile is not None:
+        profiler.write_cpu(cpuprofile)
+    if memprofile is not None:
+        profiler.write_memory(memprofile)
+
+
+def debug(argv: list):
+    """gopy debug path [arguments], runs the program in the debugger"""
+    arg_parser = argparse.ArgumentParser(prog="gopy debug",
+                                         description="Runs a Go program in the debugger")
+    arg_parser.add_argument("path", help="a .go file, or the directory of a program")
+    arg_parser.add_argument("arguments", nargs=argparse.REMAINDER,
+                            help="the arguments of the program (os.Args[1:])")
+    arg_parser.add_argument("--exec", choices=["interp", "vm", "python"], default="interp",
+                            help="runs it with the tree walking interpreter (the default), "
+                                 "the bytecode VM or the modules of the python backend")
+    arg_parser.add_argument("-lang", metavar="VERSION",
+                            help="the version of Go the program is written in (like go1.21)")
+    add_cache_flag(arg_parser)
+    args = arg_parser.parse_args(argv)
+    set_lang(arg_parser, args.lang)
+    set_cache(args.cache)
+
+    import debug as debugging
+    import interp
+    import vm
+    diagnostics.printing = False
+    info = checker.Info()
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = check_program(args.path, verbose=False, info=info, cached=True)
+    if packages and not diagnostics.errors() and not parse_errors:
+        main_package(packages)
+    with contextlib.redirect_stdout(sys.stderr):
+        diagnostics.print_diagnostics(diagnostics.reported)
+    if not packages or diagnostics.errors() or parse_errors:
+        sys.exit(1)
+    main = next((decl for decl in interp.package_decls(packages[-1].ast)
+                 if isinstance(decl, syntree.Function) and not isinstance(decl, syntree.Method)
+                 and decl.fn_name is not None and decl.fn_name[1] == "main"), None)
+    if main is None:
+        print("gopy: the program has no main function", file=sys.stderr)
+        sys.exit(1)
+    from fileset import fset
+    argv = [args.path] + args.arguments
+    debugger = debugging.Debugger(fset.position(main.pos).filename,
+                                  flush=sys.stdout.flush)
+
+    if args.exec == "python":
+        import pygen
+        import tempfile
+        outdir = tempfile.mkdtemp(prefix="gopy-debug-")
+        if not pygen.build(packages, info, outdir):
+            sys.exit(1)
+        module = os.path.join(outdir, pygen.mangle(packages[-1].name) + ".py")
+        sys.exit(debugging.attach(debugger,
+                                  lambda: debugging.trace_python(debugger, module, argv)))
+
+    engine = vm if args.exec == "vm" else interp
+    try:
+        sys.exit(debugging.attach(debugger, lambda: engine.run_program(
+            packages, info, argv=argv, debugger=debugger)))
+    except interp.Unsupported as e:
+        print(f"gopy: {e}", file=sys.stderr)
+        sys.exit(1)
+
+
+def test(argv: list):
+    """gopy test path, runs the tests of the package like go test"""
+    arg_parser = argparse.ArgumentParser(prog="gopy test",
+                                         description="Runs the tests of a Go package")
+    arg_parser.add_argument("path", help="the directory of the package (or a _test.go file)")
+    arg_parser.add_argument("-v", action="store_true",
+                            help="prints each test when it runs and its result, and the "
+                                 "logs of the tests passing too")
+    arg_parser.add_argument("-run", metavar="REGEXP",
+                            help="only runs the tests (and the subtests, after a /) whose "
+                                 "names match the regular expression")
+    arg_parser.add_argument("-bench", metavar="REGEXP",
+                            help="runs the benchmarks whose names match the regular "
+                                 "expression too (. for all of them)")
+    arg_parser.add_argument("-benchtime", metavar="T",
+                            help="runs each benchmark for the duration T (1s by default), "
+                                 "or T times if it is like 100x")
+    arg_parser.add_argument("-benchmem", action="store_true",
+                            help="prints the allocations of the benchmarks")
+    arg_parser.add_argument("-cover", action="store_true",
+                            help="prints the percentage of the statements of the package "
+                                 "the tests run")
+    arg_parser.add_argument("-covermode", choices=cover.modes,
+                            help="counts if each statement runs (set, the default), or how "
+                                 "many times (count or atomic), implies -cover")
+    arg_parser.add_argument("-coverprofile", metavar="FILE",
+                            help="writes the coverage profile to FILE, implies -cover")
+    add_profile_flags(arg_parser)
+    arg_parser.add_argument("--exec", choices=["interp", "vm"], default="interp",
+                            help="runs them with the tree walking interpreter (the "
+                                 "default) or the bytecode VM")
+    arg_parser.add_argument("-lang", metavar="VERSION",
+                            help="the version of Go the package is written in (like go1.21)")
+    add_cache_flag(arg_parser)
+    add_plugin_flag(arg_parser)
+    args = arg_parser.parse_args(argv)
+    set_lang(arg_parser, args.lang)
+    set_cache(args.cache)
+    load_plugins(arg_parser, args.plugin)
+
+    import interp
+    import vm
+    import time
+    start = time.monotonic()
+    name = os.path.normpath(args.path)
+    diagnostics.printing = False
+    info = checker.Info()
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = check_program(args.path, verbose=False, info=info, tests=True, cached=True)
+    with contextlib.redirect_stdout(sys.stderr):
+        diagnostics.print_diagnostics(diagnostics.reported)
+    if not packages or diagnostics.errors() or parse_errors:
+        print(f"FAIL\t{name} [build failed]")
+        sys.exit(1)
+    profile = None
+    if args.cover or args.covermode is not None or args.coverprofile is not None:
+        profile = cover.instrument(packages[-1:], args.covermode or "set")
+
+    # the flags of the test program, see testing.Main
+    argv = [os.path.basename(name) + ".test"]
+    if args.v:
+        argv.append("-test.v=true")
+    if args.run is not None:
+        argv.append("-test.run=" + args.run)
+    if args.bench is not None:
+        argv.append("-test.bench=" + args.bench)
+    if args.benchtime is not None:
+        argv.append("-test.benchtime=" + args.benchtime)
+    if args.benchmem:
+        argv.append("-test.benchmem=true")
+    profiler = new_profiler(args.cpuprofile, args.memprofile)
+    try:
+        code = (vm if args.exec == "vm" else interp).run_program(
+            packages, info, argv=argv, entry=loader.test_main, profiler=profiler)
+    except interp.Unsupported as e:
+        print(f"gopy: {e}", file=sys.stderr)
+        code = 1
+    write_profiles(profiler, args.cpuprofile, args.memprofile)
+    elapsed = time.monotonic() - start
+    coverage = ""
+    if profile is not None:
+        print(profile.summary())
+        coverage = "\t" + profile.summary()
+        if args.coverprofile is not None:
+            profile.write(args.coverprofile)
+    if code == 0:
+        print(f"ok  \t{name}\t{elapsed:.3f}s{coverage}")
+    else:
+        print(f"exit status {code}\nFAIL\t{name}\t{elapsed:.3f}s")
+    sys.exit(1 if code else 0)
+
+
+def difftest(argv: list):
+    """gopy difftest paths, compares what the programs do with gopy and with go"""
+    arg_parser = argparse.ArgumentParser(prog="gopy difftest",
+                                         description="Runs Go programs with gopy and with the "
+                                                     "go command, and compares what they do")
+    arg_parser.add_argument("paths", nargs="+",
+                            help="programs (.go files or directories), or directories of programs")
+    arg_parser.add_argument("--exec", default="interp",
+                            help="the engines compared with go, separated by commas, of interp "
+                                 "(the default), vm and python")
+    arg_parser.add_argument("--go", default="go",
+                            help="the go command building the programs")
+    arg_parser.add_argument("-stdin", metavar="FILE",
+                            help="the file the programs read from their standard input")
+    arg_parser.add_argument("-timeout", type=float, default=60, metavar="SECONDS",
+                            help="the time each program has to build and to run (60s)")
+    arg_parser.add_argument("-args", nargs=argparse.REMAINDER, default=[],
+                            help="the arguments of the programs (os.Args[1:]), the ones after it")
+    args = arg_parser.parse_args(argv)
+
+    import difftest as harness
+    selected = [engine for engine in args.exec.split(",") if engine]
+    for engine in selected:
+        if engine not in harness.engines:
+            arg_parser.error(f"unknown engine {engine}, of {', '.join(harness.engines)}")
+    stdin = b""
+    if args.stdin is not None:
+        with open(args.stdin, "rb") as f:
+            stdin = f.read()
+    sys.exit(harness.difftest(args.paths, selected, args.go, args.args, stdin, args.timeout))
+
+
+def set_lang(arg_parser: argparse.ArgumentParser, version: Optional[str]):
+    """Sets the version of Go given to -lang, see lang.version"""
+    if version is None:
+        return
+    try:
+        lang.set_version(version)
+    except ValueError as e:
+        arg_parser.error(str(e))
+
+
+def execute(path: str, engine: str, argv: list, warnings: bool = False,
+            fake_clock: bool = False, coverprofile: Optional[str] = None,
+            covermode: str = "set", cpuprofile: Optional[str] = None,
+            memprofile: Optional[str] = None, cached: bool = False,
+            ctx: Optional[cancel.Context] = None, max_steps: Optional[int] = None,
+            limits: Optional[sandbox.Limits] = None, race: bool = False,
+            optimized: bool = False) -> int:
+    """Runs the program in path with the backend named engine, argv is
+    os.Args, with the fake clock of interp if fake_clock. Only what the
+    program prints is printed, the errors to stderr. Returns the exit code:
+    1 if the program has errors, 2 if it panics, the code given to os.Exit.
+    The coverage profile of its packages is written to coverprofile, if
+    given, in the covermode (see cover.py), and its CPU and memory profiles
+    to cpuprofile and memprofile (see pprof.py). The packages are the
+    ones of the build cache if cached (see check_program). The check and
+    the run stop once ctx is done, and the run after max_steps steps
+    (see interp.Interpreter.step) or past the limits of its sandbox (see
+    sandbox.py), with 1 as exit code. The VM reports the data races of the
+    program if race (see race.py). It is optimized if optimized (see
+    optimize.py)"""
+    import interp
+    diagnostics.printing = False
+    info = checker.Info()
+    try:
+        with contextlib.redirect_stdout(io.StringIO()):
+            packages = check_program(path, verbose=False, info=info, warnings=warnings,
+                                     cached=cached, ctx=ctx)
+    except cancel.ContextError as e:
+        print(f"gopy: {e}", file=sys.stderr)
+        return 1
+    if packages and not diagnostics.errors() and not parse_errors:
+        main_package(packages)
+    with contextlib.redirect_stdout(sys.stderr):
+        diagnostics.print_diagnostics(diagnostics.reported)
+    if not packages or diagnostics.errors() or parse_errors:
+        return 1
+    profile = None
+    if coverprofile is not None:
+        profile = cover.instrument([package for package in packages if not package.std],
+                                   covermode)
+    if optimized:
+        optimize.optimize(packages, info)
+    profiler = new_profiler(cpuprofile, memprofile)
+    try:
+        clock = interp.FakeClock() if fake_clock else None
+        return backend.lookup(engine).run(packages, info, backend.Options(
+            argv, clock=clock, profiler=profiler, ctx=ctx, max_steps=max_steps,
+            limits=limits, detect_races=race))
+    except (interp.Unsupported, interp.Aborted, cancel.ContextError) as e:
+        print(f"gopy: {e}", file=sys.stderr)
+        return 1
+    finally:
+        if profile is not None:
+            profile.write(coverprofile)
+        write_profiles(profiler, cpuprofile, memprofile)
+
+
+def main_package(packages: list) -> bool:
+    """Reports the package of a program run which isn't package main, like
+    go run does (the type checker only checks func main of package main)"""
+    package = packages[-1]
+    if package.name == "main":
+        return True
+    diagnostics.error(f"package {package.name} is not a main package", kind="ERROR",
+                      code="NotMainPackage")
+    return False
+
+
+def fmt(argv: list):
+    """gopy fmt path, prints the files of the package formatted like gofmt"""
+    arg_parser = argparse.ArgumentParser(prog="gopy fmt",
+                                         description="Formats the files of a Go program")
+    arg_parser.add_argument("path", help="a .go file, or the directory of a program")
+    arg_parser.add_argument("-l", "--list", action="store_true",
+                            help="only lists the files whose formatting differs")
+    arg_parser.add_argument("-w", "--write", action="store_true",
+                            help="writes the formatted files instead of printing them")
+    arg_parser.add_argument("--check", action="store_true",
+                            help="also checks that the output formatted again is the same")
+    args = arg_parser.parse_args(argv)
+
+    import printer
+    from fileset import fset
+    diagnostics.printing = False
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = check_program(args.path, verbose=False)
+    if not packages or parse_errors:
+        with contextlib.redirect_stdout(sys.stderr):
+            diagnostics.print_diagnostics(diagnostics.reported)
+        sys.exit(1)
+
+    package = packages[-1]
+    files = {node.filename: node for node in package.ast.children if isinstance(node, syntree.File)}
+    status = 0
+    for filename in package.files:
+        file = next(f for f in reversed(fset.files) if f.name == filename)
+        source = "\n".join(utils.sources[filename])
+        try:
+            formatted = printer.format_file(files[filename], file, source, package.name)
+        except printer.FormatError as e:
+            print(f"{filename}: {e}", file=sys.stderr)
+            status = 1
+            continue
+        if args.check and not formatted_again(formatted, filename):
+            print(f"{filename}: the formatted file is formatted differently", file=sys.stderr)
+            status = 1
+        changed = utils.read_source(filename) != formatted
+        if args.list:
+            if changed:
+                print(filename)
+        elif args.write:
+            if changed:
+                with open(filename, "wt") as f:
+                    f.write(formatted)
+        else:
+            sys.stdout.write(formatted)
+    sys.exit(status)
+
+
+def doc(argv: list):
+    """gopy doc path, prints the documentation of the package"""
+    arg_parser = argparse.ArgumentParser(prog="gopy doc",
+                                         description="Prints the documentation of a Go package")
+    arg_parser.add_argument("path", help="a .go file, or the directory of a package")
+    arg_parser.add_argument("--format", choices=["text", "markdown", "html"], default="text",
+                            help="text prints it like go doc -all, html as a page")
+    arg_parser.add_argument("-u", "--unexported", action="store_true",
+                            help="also documents the unexported declarations")
+    args = arg_parser.parse_args(argv)
+
+    import godoc
+    diagnostics.printing = False
+    info = checker.Info()
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = check_program(args.path, verbose=False, info=info)
+    if not packages or diagnostics.errors() or parse_errors:
+        with contextlib.redirect_stdout(sys.stderr):
+            diagnostics.print_diagnostics(diagnostics.reported)
+        sys.exit(1)
+    sys.stdout.write(godoc.formats[args.format](godoc.document(packages[-1], info,
+                                                               args.unexported)))
+    sys.exit(0)
+
+
+def refs(argv: list):
+    """gopy refs file.go:#offset, prints the references of what is there"""
+    arg_parser = argparse.ArgumentParser(prog="gopy refs",
+                                         description="Prints the references of an identifier")
+    arg_parser.add_argument("position", help="file.go:#offset (in characters) or "
+                                             "file.go:line:column")
+    arg_parser.add_argument("-d", "--declaration", action="store_true",
+                            help="also prints where it is declared")
+    arg_parser.add_argument("--package", action="store_true",
+                            help="checks the file with the package of its directory (the "
+                                 "file is a program of its own by default)")
+    args = arg_parser.parse_args(argv)
+
+    import xref
+    try:
+        filename, lineno, col_num = xref.parse_location(args.position)
+    except (ValueError, OSError) as e:
+        arg_parser.error(str(e))
+    filename = os.path.normpath(filename)
+    path = os.path.dirname(filename) or "." if args.package else filename
+    diagnostics.printing = False
+    info = checker.Info()
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = check_program(path, verbose=False, info=info)
+    if not packages or parse_errors:
+        with contextlib.redirect_stdout(sys.stderr):
+            diagnostics.print_diagnostics(diagnostics.reported)
+        sys.exit(1)
+    index = xref.Index(packages, info)
+    obj = index.object_at(filename, lineno, col_num)
+    if obj is None:
+        print(f"{filename}:{lineno}:{col_num}: no identifier here", file=sys.stderr)
+        sys.exit(1)
+    for ref in index.references(obj, declarations=args.declaration):
+        print(ref)
+    sys.exit(0)
+
+
+def rename(argv: list):
+    """gopy rename file.go:#offset name, renames what is there"""
+    arg_parser = argparse.ArgumentParser(prog="gopy rename",
+                                         description="Renames an identifier in the files of a "
+                                                     "program")
+    arg_parser.add_argument("position", help="file.go:#offset (in characters) or "
+                                             "file.go:line:column")
+    arg_parser.add_argument("name", help="the new name")
+    arg_parser.add_argument("-d", "--diff", action="store_true",
+                            help="prints the changes of the files as a unified diff")
+    arg_parser.add_argument("-w", "--write", action="store_true",
+                            help="writes the files renamed instead of printing the edits")
+    arg_parser.add_argument("--package", action="store_true",
+                            help="checks the file with the package of its directory (the "
+                                 "file is a program of its own by default)")
+    arg_parser.add_argument("--program", metavar="PATH",
+                            help="checks the program of the path (a .go file or a directory), "
+                                 "which imports the package of the file")
+    args = arg_parser.parse_args(argv)
+
+    import difflib
+    import rename as renaming
+    import xref
+    try:
+        filename, lineno, col_num = xref.parse_location(args.position)
+    except (ValueError, OSError) as e:
+        arg_parser.error(str(e))
+    filename = os.path.normpath(filename)
+    path = os.path.dirname(filename) or "." if args.package else filename
+    if args.program is not None:
+        path = args.program
+    diagnostics.printing = False
+    info = checker.Info()
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = check_program(path, verbose=False, info=info)
+    if not packages or diagnostics.errors() or parse_errors:
+        with contextlib.redirect_stdout(sys.stderr):
+            diagnostics.print_diagnostics(diagnostics.reported)
+        sys.exit(1)
+    index = xref.Index(packages, info)
+    obj = index.object_at(filename, lineno, col_num)
+    if obj is None:
+        print(f"{filename}:{lineno}:{col_num}: no identifier here", file=sys.stderr)
+        sys.exit(1)
+    try:
+        edits = renaming.rename(packages, info, obj, args.name, index)
+    except renaming.Conflict as e:
+        print(f"{filename}:{lineno}:{col_num}: cannot rename {obj.name} to {args.name}: {e}",
+              file=sys.stderr)
+        sys.exit(1)
+    texts = renaming.apply(edits)
+    if args.write:
+        for file, text in texts.items():
+            with open(file, "wt") as f:
+                f.write(text)
+        print(f"renamed {obj.name} to {args.name}: {len(edits)} references in "
+              f"{len(texts)} file" + ("s" if len(texts) > 1 else ""))
+    elif args.diff:
+        for file, text in texts.items():
+            sys.stdout.writelines(difflib.unified_diff(
+                utils.read_source(file).splitlines(keepends=True),
+                text.splitlines(keepends=True), file + ".orig", file))
+    else:
+        for edit in edits:
+            print(edit)
+    sys.exit(0)
+
+
+def lsp(argv: list):
+    """gopy lsp, runs the language server on the standard input and output"""
+    arg_parser = argparse.ArgumentParser(prog="gopy lsp",
+                                         description="Runs the language server of GoPy")
+    arg_parser.add_argument("--single-file", action="store_true",
+                            help="checks each file as a program of its own (like the ones "
+                                 "of tests), not the package of its directory")
+    arg_parser.add_argument("-W", "--warnings", action="store_true",
+                            help="also reports the shadowed and unused declarations")
+    args = arg_parser.parse_args(argv)
+
+    import lsp as server
+    sys.exit(server.serve(sys.stdin.buffer, sys.stdout.buffer, args.single_file, args.warnings))
+
+
+def formatted_again(formatted: str, filename: str) -> bool:
+    """If the formatted source of a file is formatted the same again, it
+    is written next to the file, so the packages it imports are found"""
+    import subprocess
+    import tempfile
+    directory = os.path.dirname(filename) or "."
+    with tempfile.NamedTemporaryFile("wt", suffix=".go", prefix=".fmt-", dir=directory, delete=False) as f:
+        f.write(formatted)
+    try:
+        again = subprocess.run([sys.executable, os.path.abspath(__file__), "fmt", f.name],
+                               capture_output=True, text=True)
+    finally:
+        os.remove(f.name)
+    return again.returncode == 0 and again.stdout == formatted
 
-        # print("Optimized intermediate code:")
-        # print(ico)
-        ico.print_three_address_code()
 
-        print(symtab)
+if __name__ == "__main__":
+    if sys.argv[1:2] == ["build"]:
+        build(sys.argv[2:])
+    if sys.argv[1:2] == ["export"]:
+        export(sys.argv[2:])
+    if sys.argv[1:2] == ["fmt"]:
+        fmt(sys.argv[2:])
+    if sys.argv[1:2] == ["doc"]:
+        doc(sys.argv[2:])
+    if sys.argv[1:2] == ["refs"]:
+        refs(sys.argv[2:])
+    if sys.argv[1:2] == ["rename"]:
+        rename(sys.argv[2:])
+    if sys.argv[1:2] == ["check"]:
+        check(sys.argv[2:])
+    if sys.argv[1:2] == ["run"]:
+        run(sys.argv[2:])
+    if sys.argv[1:2] == ["lsp"]:
+        lsp(sys.argv[2:])
+    if sys.argv[1:2] == ["debug"]:
+        debug(sys.argv[2:])
+    if sys.argv[1:2] == ["test"]:
+        test(sys.argv[2:])
+    if sys.argv[1:2] == ["difftest"]:
+        difftest(sys.argv[2:])
+
+    arg_parser = argparse.ArgumentParser(description="Compiles a Go program")
+    arg_parser.add_argument(
+        "path", help="a .go file, or the directory of a program (repl runs the REPL)"
+    )
+    arg_parser.add_argument(
+        "--diagnostics", choices=["text", "json"], default="text",
+        help="json only prints the errors found, as a JSON array"
+    )
+    arg_parser.add_argument(
+        "--ast", choices=astdump.formats,
+        help="only prints the AST of the program, in the format given"
+    )
+    arg_parser.add_argument(
+        "--exec", metavar="BACKEND",
+        help="runs the program instead of compiling it, with the tree walking "
+             "interpreter (interp), the bytecode VM (vm) or another backend"
+    )
+    arg_parser.add_argument(
+        "-W", "--warnings", action="store_true",
+        help="also reports the shadowed variables, and the unused local "
+             "variables, constants and imports, as warnings"
+    )
+    arg_parser.add_argument(
+        "--suppress", default="", metavar="CODES",
+        help="the codes of the warnings not to report, separated by commas "
+             "(like ShadowedVar,UnusedConst)"
+    )
+    arg_parser.add_argument(
+        "--permissive", action="store_true",
+        help="skips the constructs gopy doesn't support yet (like dot imports), "
+             "reporting them as warnings instead of errors (strict mode, the default)"
+    )
+    arg_parser.add_argument(
+        "-lang", metavar="VERSION",
+        help=f"the version of Go the program is written in, like go1.21 (by default the one "
+             f"of its go.mod, or the latest one gopy supports, {lang.string(lang.latest)}): "
+             f"the features of later versions are errors"
+    )
+    add_optimize_flag(arg_parser)
+    add_plugin_flag(arg_parser)
+    args = arg_parser.parse_args()
+    diagnostics.suppressed.update(code for code in args.suppress.split(",") if code)
+    diagnostics.strict = not args.permissive
+    set_lang(arg_parser, args.lang)
+    load_plugins(arg_parser, args.plugin)
+
+    if args.path == "repl":
+        import repl
+        repl.run(check_program)
+        sys.exit(0)
+
+    if args.ast is not None:
+        # the errors are printed to stderr, so the output can be parsed
+        diagnostics.printing = False
+        info = checker.Info()
+        with contextlib.redirect_stdout(io.StringIO()):
+            packages = check_program(args.path, verbose=False, info=info,
+                                     warnings=args.warnings)
+        with contextlib.redirect_stdout(sys.stderr):
+            diagnostics.print_diagnostics(diagnostics.reported)
+        if args.optimize and not diagnostics.errors() and not parse_errors:
+            optimize.optimize(packages, info)
+        for package in packages:
+            if not package.std:
+                astdump.fprint(package.ast, format=args.ast)
+        sys.exit(1 if diagnostics.errors() else 0)
+
+    if args.exec is not None:
+        find_backend(arg_parser, "--exec", args.exec, runs=True)
+        sys.exit(execute(args.path, args.exec, [args.path], args.warnings,
+                         optimized=args.optimize))
+
+    if args.diagnostics == "json":
+        # nothing else is printed, so the output can be parsed
+        diagnostics.printing = False
+        with contextlib.redirect_stdout(io.StringIO()):
+            check_program(args.path, verbose=False, warnings=args.warnings)
+        print(diagnostics.encode_json(diagnostics.reported))
+        sys.exit(1 if diagnostics.errors() else 0)
+
+    # the packages of the program, its own package is the last one
+    info = checker.Info()
+    packages = check_program(args.path, info=info, warnings=args.warnings)
+    if not packages:
+        sys.exit(1)
+
+    # pydot is only needed to draw the AST
+    from tree_vis import draw_AST
+    ast = packages[-1].ast
+    draw_AST(ast)
+
+    # with open("syntax_tree.txt", "wt", encoding="utf-8") as ast_file:
+    #     sys.stdout = ast_file
+    #     print_tree(ast, nameattr=None, horizontal=True)
+    #     sys.stdout = sys.__stdout__
+
+    print("Finished Parsing!")
+    print("Symbol Table: ")
+    print(symtab)
+    with open("symbol_table.txt", "wt", encoding="utf-8") as symtab_file:
+        print(symtab, file=symtab_file)
+
+    # the AST of a program the parser had to recover from errors in is
+    # partial (it has BadDecl, BadStmt and BadExpr nodes), no code is generated
+    if parse_errors:
+        print("No intermediate code, the program has syntax errors")
+        sys.exit(1)
+    # the constructs skipped in permissive mode have no intermediate code
+    if any(d.code == "NotYetSupported" for d in diagnostics.reported):
+        print("No intermediate code, the program uses constructs gopy doesn't support yet")
+        sys.exit(0)
+
+    # Intermediate Code gen, the code of each package comes after
+    # the code of the ones it imports. The functions of std are
+    # the ones of the runtime
+    ic = None
+    for package in packages:
+        if package.std:
+            ic = declare_runtime(package.ast, ic)
+            continue
+        symtab.switch(package.symbols)
+        ic = intermediate_codegen(package.ast, ic, info.init_order.get(package.ast))
+
+    print("Intermediate code:")
+    print(ic)
+    ic.print_three_address_code()
+
+    print(symtab)
+
+    ico = optimize_ic(ic)
+
+    # print("Optimized intermediate code:")
+    # print(ico)
+    ico.print_three_address_code()
+
+    print(symtab)
@@ -0,0 +1,1178 @@
+import os
+import sys
+import json
+import hashlib
+import argparse
+import subprocess
+
+import checker
+import printer
+import syntree
+
+from fileset import NoPos
+from typing import List, Optional, Tuple
+
+
+# The files of gopy as the trees of go/ast, for the tools of Go (gofmt, the
+# analyzers) to work on the programs gopy checks, builds or transforms, and
+# the other way around. A tree is the JSON of go/ast, which goast/main.go
+# reads and writes (see there):
+#  - each node is a dict with its type in "_type", like "BinaryExpr", and
+#    the fields of its struct in go/ast, like "X", "OpPos", "Op" and "Y"
+#  - the positions are byte offsets in the file, left out if unknown, the
+#    tokens are their strings (like "+="), the ChanDirs 1 (send), 2 (recv)
+#    or 3 (both)
+#  - the File has its name, its size and the offsets of its lines in
+#    "_file", the objects and the scopes of go/ast are left out
+# convert makes the tree of a file checked (see files), with the names of
+# the types as they are written (see syntree.TypeRef), and its comments.
+# to_source prints a tree back as Go source, which load checks: the AST of
+# gopy of a tree made (or changed) by a tool of Go. gofmt prints a tree with
+# go/format, by goast/main.go built by the go command (see summaries.py):
+#
+#   python goast.py tests/iota.go | goast fmt
+#   goast json prog.go | python goast.py -d -
+#
+# Ref: https://pkg.go.dev/go/ast
+
+# the ChanDirs of go/ast
+SEND, RECV = 1, 2
+
+go_command = "go"
+
+here = os.path.dirname(os.path.abspath(__file__))
+source = os.path.join(here, "goast", "main.go")
+
+# the directory of goast built, by the hash of its source
+directory = os.path.join(
+    os.environ.get("XDG_CACHE_HOME") or os.path.join(os.path.expanduser("~"), ".cache"),
+    "gopy", "goast")
+
+
+def node(type_: str, **fields) -> dict:
+    """A node of go/ast, without the fields which are None"""
+    d = {"_type": type_}
+    d.update((name, value) for name, value in fields.items() if value is not None)
+    return d
+
+
+class Converter:
+    """Makes the go/ast tree of a file of gopy, the positions of its tokens
+    are found in the source like the printer finds them (see printer.Printer)"""
+
+    def __init__(self, file_node: syntree.File, file, source: str, package_name: str):
+        self.file_node = file_node
+        self.file = file
+        self.source = source
+        self.package_name = package_name
+        self.p = printer.Printer(file, source, file_node.comments, package_name, {})
+        # the byte offsets of the characters, for the sources which aren't ASCII
+        self.bytes: Optional[List[int]] = None
+        if not source.isascii():
+            self.bytes = [0]
+            for ch in source:
+                self.bytes.append(self.bytes[-1] + len(ch.encode("utf-8", "surrogateescape")))
+
+    # positions
+
+    def offset(self, pos: int) -> Optional[int]:
+        """The byte offset of a position, None if it is unknown"""
+        if pos == NoPos or not self.file.base <= pos <= self.file.base + len(self.source):
+            return None
+        offset = self.file.offset(pos)
+        return offset if self.bytes is None else self.bytes[offset]
+
+    def after(self, pos: int, token: str) -> int:
+        """The position after the token at pos, NoPos if pos is"""
+        return NoPos if pos == NoPos else pos + len(token)
+
+    def ref(self, lo: int) -> Optional[syntree.TypeRef]:
+        """The TypeRef of the first token from lo, if it is a type name"""
+        if lo == NoPos:
+            return None
+        self.p.pos = self.p.position(lo)
+        return self.p.type_ref()
+
+    def next_pos(self, lo: int, token: str) -> int:
+        """The position of the first token from lo, if it is token"""
+        if lo == NoPos:
+            return NoPos
+        self.p.pos = self.p.position(lo)
+        pos = self.p.next_pos(token)
+        end = self.after(pos, token)
+        if pos == NoPos or (self.file.offset(end) < len(self.source) and
+                            (self.source[self.file.offset(end)].isalnum() or self.source[self.file.offset(end)] == "_")):
+            return NoPos
+        return pos
+
+    # the file
+
+    def convert(self) -> dict:
+        source = self.source
+        start = printer.first_token(source, self.file_node.comments, self.file)
+        package = self.file.pos(start)
+        name = self.p.find(self.package_name, self.after(package, "package"))
+        decls: list = []
+
+        def _collect(n):
+            for child in n.children:
+                if isinstance(child, syntree.List) and not isinstance(child, syntree.Block):
+                    _collect(child)
+                elif child is not None:
+                    decls.append(child)
+        _collect(self.file_node)
+        comments = [self.comment_group(g) for g in self.file_node.comments]
+        line = self.file.position(package).line
+        docs = [g for g in self.file_node.comments if g.end <= package and g.last_line + 1 >= line]
+        size = len(source) if self.bytes is None else self.bytes[-1]
+        lines = [self.offset(self.file.line_start(i)) for i in range(1, len(self.file.lines) + 1)]
+        return node(
+            "File", Doc=self.comment_group(docs[-1]) if docs else None,
+            Package=self.offset(package), Name=self.ident(self.package_name, name),
+            Decls=[self.decl(d) for d in self.p.in_source_order(decls)],
+            Comments=comments or None,
+            _file={"name": os.path.basename(self.file.name), "size": size,
+                   "lines": [line for line in lines if line is not None and line < size] or [0]},
+        )
+
+    def comment_group(self, group: Optional[syntree.CommentGroup]) -> Optional[dict]:
+        if group is None:
+            return None
+        return node("CommentGroup", List=[node("Comment", Slash=self.offset(pos), Text=text)
+                                          for pos, text in group.comments])
+
+    # declarations
+
+    def decl(self, d) -> dict:
+        if isinstance(d, syntree.Function):
+            return self.func_decl(d)
+        if isinstance(d, (syntree.BadDecl, syntree.BadStmt)):
+            return node("BadDecl", From=self.offset(d.pos), To=self.offset(d.end))
+        return self.gen_decl(d)
+
+    def func_decl(self, d: syntree.Function) -> dict:
+        recv = None
+        if isinstance(d, syntree.Method):
+            recv = self.fields(d.receiver, d.receiver.pos, d.receiver.end - 1)
+        name_pos = self.p.ident_pos(d.lineno, d.fn_name[2])
+        return node(
+            "FuncDecl", Doc=self.comment_group(d.doc), Recv=recv,
+            Name=self.ident(d.fn_name[1], name_pos),
+            Type=self.func_type(d.signature, d.pos, self.after(name_pos, d.fn_name[1])),
+            Body=None if d.body is None else self.block(d.body),
+        )
+
+    def gen_decl(self, d: syntree.DeclGroup) -> dict:
+        lparen = rparen = NoPos
+        if d.parenthesized or len(d.specs) != 1:
+            lparen, rparen = self.p.find("(", d.pos), d.end - 1
+        return node(
+            "GenDecl", Doc=self.comment_group(d.doc), TokPos=self.offset(d.pos), Tok=d.keyword,
+            Lparen=self.offset(lparen), Specs=[self.spec(s) for s in d.specs],
+            Rparen=self.offset(rparen),
+        )
+
+    def spec(self, s) -> dict:
+        if isinstance(s, syntree.Import):
+            name = s._name
+            ident = None
+            if isinstance(name, tuple):
+                ident = self.ident(name[1], s.pos)
+            elif name == ".":
+                ident = self.ident(".", s.pos)
+            path = s.data[1][1]
+            path_pos = self.p.rfind(path, s.pos, s.end) if s.end != NoPos else NoPos
+            return node(
+                "ImportSpec", Doc=self.comment_group(s.doc), Name=ident,
+                Path=self.basic_lit("STRING", path, path_pos),
+                Comment=self.comment_group(s.comment),
+            )
+        if isinstance(s, syntree.TypeDef):
+            name_pos = self.p.ident_pos(s.lineno, s.typename[2])
+            lo = self.after(name_pos, s.typename[1])
+            alias = getattr(s, "_alias", False)
+            type_params, assign = None, NoPos
+            if alias:
+                assign = self.p.find("=", lo)
+                type_, _ = self.type_(s.type_, self.after(assign, "="))
+            else:
+                if s.type_.type_params:
+                    type_params, lo = self.type_params(s.type_.type_params, lo)
+                type_, _ = self.type_(s.type_.definition, lo)
+            return node(
+                "TypeSpec", Doc=self.comment_group(s.doc), Name=self.ident(s.typename[1], name_pos),
+                TypeParams=type_params, Assign=self.offset(assign), Type=type_,
+                Comment=self.comment_group(s.comment),
+            )
+        names = [self.expr(name) for name in s.names]
+        lo = self.p.end_of(s.names[-1])
+        type_ = None
+        if s.type_ is not None or self.ref(lo) is not None:
+            type_, _ = self.type_(s.type_, lo)
+        return node(
+            "ValueSpec", Doc=self.comment_group(s.doc), Names=names, Type=type_,
+            Values=None if s.values is None else [self.expr(v) for v in s.values],
+            Comment=self.comment_group(s.comment),
+        )
+
+    # types
+
+    def type_(self, t, lo: int) -> Tuple[dict, int]:
+        """The node of a type written from lo, and the position after it"""
+        if t is None or not (printer.has_span(t) or isinstance(t, (syntree.Interface, syntree.TypeUnion))):
+            ref = self.ref(lo)
+            if ref is not None:
+                return self.type_ref(ref), ref.end
+        if t is None:
+            return node("BadExpr"), lo
+        pos = self.p.node_start(t) if printer.has_span(t) else NoPos
+        end = t.end if printer.has_span(t) else NoPos
+        if isinstance(t, syntree.Array):
+            lbrack = t.pos
+            rbrack = self.p.matching(lbrack, "[", "]")
+            if getattr(t, "_ellipsis", False):
+                length = node("Ellipsis", Ellipsis=self.offset(self.p.find("...", lbrack)))
+            elif t.length_expr is not None:
+                length = self.expr(t.length_expr)
+            else:
+                length = self.basic_lit("INT", str(t.length), NoPos)
+            elt, _ = self.type_(t.eltype, self.after(rbrack, "]"))
+            return node("ArrayType", Lbrack=self.offset(lbrack), Len=length, Elt=elt), end
+        if isinstance(t, syntree.Slice):
+            rbrack = self.p.find("]", t.pos)
+            elt, _ = self.type_(t.eltype, self.after(rbrack, "]"))
+            return node("ArrayType", Lbrack=self.offset(t.pos), Elt=elt), end
+        if isinstance(t, syntree.Map):
+            lbrack = self.p.find("[", t.pos)
+            key, _ = self.type_(t.key, self.after(lbrack, "["))
+            rbrack = self.p.matching(lbrack, "[", "]")
+            value, _ = self.type_(t.eltype, self.after(rbrack, "]"))
+            return node("MapType", Map=self.offset(t.pos), Key=key, Value=value), end
+        if isinstance(t, syntree.Pointer):
+            base, _ = self.type_(t.base, self.after(t.pos, "*"))
+            return node("StarExpr", Star=self.offset(t.pos), X=base), end
+        if isinstance(t, syntree.Chan):
+            arrow = NoPos
+            if t.dir == "recv":
+                arrow, lo = t.pos, self.after(self.p.find("chan", t.pos), "chan")
+            elif t.dir == "send":
+                arrow = self.p.find("<-", t.pos)
+                lo = self.after(arrow, "<-")
+            else:
+                lo = self.after(t.pos, "chan")
+            if t.dir != "recv" and isinstance(t.eltype, syntree.Chan) and t.eltype.dir == "recv":
+                # chan <-chan T would be chan<- (chan T)
+                lparen = self.p.find("(", lo)
+                elt, _ = self.type_(t.eltype, self.after(lparen, "("))
+                value = node("ParenExpr", Lparen=self.offset(lparen), X=elt,
+                             Rparen=self.offset(self.p.find(")", t.eltype.end)))
+            else:
+                value, _ = self.type_(t.eltype, lo)
+            dir_ = {"send": SEND, "recv": RECV}.get(t.dir, SEND | RECV)
+            return node("ChanType", Begin=self.offset(t.pos), Arrow=self.offset(arrow),
+                        Dir=dir_, Value=value), end
+        if isinstance(t, syntree.FunctionType):
+            return self.func_type(t.signature, t.pos, self.after(t.pos, "func")), end
+        if isinstance(t, syntree.Struct):
+            lbrace = self.p.find("{", t.pos)
+            fields = [self.struct_field(f) for f in t._field_decls]
+            return node("StructType", Struct=self.offset(t.pos), Fields=node(
+                "FieldList", Opening=self.offset(lbrace), List=fields,
+                Closing=self.offset(t.end - 1))), end
+        if isinstance(t, syntree.Interface):
+            if t.alias is not None:
+                pos = self.next_pos(lo, t.alias)
+                return self.ident(t.alias, pos), self.after(pos, t.alias) if pos != NoPos else lo
+            if getattr(t, "_implicit", False):
+                # a constraint like ~int, short for interface{~int}
+                field, end = self.interface_elem(t._elements[0], lo)
+                return field["Type"], end
+            lbrace = self.p.find("{", t.pos)
+            methods = [self.interface_elem(e, self.p.elem_pos(e))[0] for e in t._elements]
+            for method, e in zip(methods, t._elements):
+                if isinstance(e, syntree.InterfaceMethod):
+                    method.update((k, v) for k, v in (("Doc", self.comment_group(e.doc)),
+                                                      ("Comment", self.comment_group(e.comment)))
+                                  if v is not None)
+            return node("InterfaceType", Interface=self.offset(pos), Methods=node(
+                "FieldList", Opening=self.offset(lbrace), List=methods,
+                Closing=self.offset(t.end - 1))), end
+        if isinstance(t, syntree.TypeUnion):
+            x = None
+            for tilde, term in t.terms:
+                op = NoPos
+                if x is not None:
+                    op = self.p.find("|", lo)
+                    lo = self.after(op, "|")
+                tilde_pos = NoPos
+                if tilde:
+                    tilde_pos = self.p.find("~", lo)
+                    lo = self.after(tilde_pos, "~")
+                y, lo = self.type_(term, lo)
+                if tilde:
+                    y = node("UnaryExpr", OpPos=self.offset(tilde_pos), Op="~", X=y)
+                x = y if x is None else node("BinaryExpr", X=x, OpPos=self.offset(op), Op="|", Y=y)
+            return x, lo
+        if isinstance(t, syntree.NamedType) and t.origin is not None:
+            x, _ = self.type_(t.origin, NoPos)
+            args = [self.type_(arg, NoPos)[0] for arg in t.type_args]
+            return self.index(x, NoPos, args, NoPos), lo
+        if isinstance(t, syntree.Type):
+            # a name without a TypeRef (like the types of unnamed
+            # parameters), at lo if it is written there
+            package = getattr(t, "package", None)
+            qualified = package not in (None, self.package_name)
+            text = f"{package}.{t.typename}" if qualified else t.typename
+            pos = self.next_pos(lo, text)
+            end = self.after(pos, text) if pos != NoPos else lo
+            name = self.ident(t.typename, self.after(pos, f"{package}.") if qualified and pos != NoPos else pos)
+            if qualified:
+                return node("SelectorExpr", X=self.ident(package, pos), Sel=name), end
+            return name, end
+        raise printer.FormatError(f"cannot convert type {t}")
+
+    def type_ref(self, ref: syntree.TypeRef) -> dict:
+        """A type written by its name, like geometry.Point or List[int]"""
+        if "." in ref.name:
+            package, name = ref.name.split(".", 1)
+            dot = ref.pos + len(package)
+            x = node("SelectorExpr", X=self.ident(package, ref.pos),
+                     Sel=self.ident(name, self.after(dot, ".")))
+        else:
+            x = self.ident(ref.name, ref.pos)
+        if ref.type_args is None:
+            return x
+        lbrack = self.p.find("[", self.after(ref.pos, ref.name))
+        lo = self.after(lbrack, "[")
+        args = []
+        for i, arg in enumerate(ref.type_args):
+            if i > 0:
+                lo = self.after(self.p.find(",", lo), ",")
+            arg, lo = self.type_(arg, lo)
+            args.append(arg)
+        return self.index(x, lbrack, args, ref.end - 1)
+
+    def index(self, x: dict, lbrack: int, indices: list, rbrack: int) -> dict:
+        if len(indices) == 1:
+            return node("IndexExpr", X=x, Lbrack=self.offset(lbrack), Index=indices[0],
+                        Rbrack=self.offset(rbrack))
+        return node("IndexListExpr", X=x, Lbrack=self.offset(lbrack), Indices=indices,
+                    Rbrack=self.offset(rbrack))
+
+    def struct_field(self, field: syntree.StructFieldDecl) -> dict:
+        names = printer.field_names(field)
+        lo = self.p.end_of(names[-1]) if names else field.pos
+        type_, _ = self.type_(field.type_, lo)
+        tag = None
+        if field.tag is not None:
+            text = field.tag[2] if len(field.tag) > 2 else field.tag[1]
+            tag = self.basic_lit("STRING", text, self.p.rfind(text, field.pos, field.end))
+        return node(
+            "Field", Doc=self.comment_group(field.doc), Names=[self.expr(n) for n in names] or None,
+            Type=type_, Tag=tag, Comment=self.comment_group(field.comment),
+        )
+
+    def interface_elem(self, elem, lo: int) -> Tuple[dict, int]:
+        """The Field of an element of an interface"""
+        if isinstance(elem, syntree.InterfaceMethod):
+            name = self.expr(elem.ident)
+            pos = self.p.pos_of(elem.ident)
+            return node("Field", Names=[name], Type=self.func_type(
+                elem.signature, NoPos, self.after(pos, elem.m_name))), NoPos
+        if isinstance(elem, tuple):
+            # an embedded interface
+            type_, end = self.type_(None, self.p.pos_of(elem[0]))
+            if type_["_type"] == "BadExpr":
+                type_ = self.expr(elem[0])
+            return node("Field", Type=type_), end
+        type_, end = self.type_(elem, lo)
+        return node("Field", Type=type_), end
+
+    def func_type(self, signature: syntree.Signature, func: int, name_end: int) -> dict:
+        """The FuncType of a signature, func is the position of its func
+        keyword and name_end the one after its name"""
+        type_params = None
+        if signature.type_params:
+            type_params, _ = self.type_params(signature.type_params, name_end)
+        parameters = signature.parameters
+        params = self.fields(parameters, parameters.pos, parameters.end - 1)
+        results = None
+        result = signature.result
+        if result is not None and not isinstance(result, syntree.List):
+            type_, _ = self.type_(result, parameters.end)
+            results = node("FieldList", List=[node("Field", Type=type_)])
+        elif result is not None and len(result.children) > 0:
+            results = self.fields(result, result.pos, result.end - 1)
+        return node("FuncType", Func=self.offset(func), TypeParams=type_params, Params=params,
+                    Results=results)
+
+    def fields(self, parameters, opening: int, closing: int) -> dict:
+        """The FieldList of the ParameterDecls of a List"""
+        fields = []
+        # the types without names are found from the ( or the , before them
+        lo = self.after(opening, "(")
+        for para in checker.in_order_params(parameters):
+            if fields:
+                lo = self.after(self.p.find(",", lo), ",")
+            names = [] if para.ident_list is None else list(reversed(para.ident_list.children))
+            if names:
+                lo = self.p.end_of(names[-1])
+            if para.vararg:
+                ellipsis = self.p.find("...", lo)
+                elt, lo = self.type_(para.type_, self.after(ellipsis, "..."))
+                type_ = node("Ellipsis", Ellipsis=self.offset(ellipsis), Elt=elt)
+            else:
+                type_, lo = self.type_(para.type_, lo)
+            fields.append(node("Field", Names=[self.expr(n) for n in names] or None, Type=type_))
+        return node("FieldList", Opening=self.offset(opening), List=fields or None,
+                    Closing=self.offset(closing))
+
+    def type_params(self, type_params: list, start: int) -> Tuple[dict, int]:
+        """The FieldList of the type parameters from the [ after start, and
+        the position after it"""
+        opening = self.p.find("[", start)
+        closing = self.p.matching(opening, "[", "]")
+        fields = []
+        i = 0
+        while i < len(type_params):
+            n = getattr(type_params[i], "_group_size", 1)
+            group = type_params[i:i + n]
+            names = [self.ident(t.typename, self.p.ident_pos(t.lineno, t.col_num)) for t in group]
+            last = self.p.ident_pos(group[-1].lineno, group[-1].col_num)
+            type_, _ = self.type_(group[0].constraint, self.after(last, group[-1].typename))
+            fields.append(node("Field", Names=names, Type=type_))
+            i += n
+        return node("FieldList", Opening=self.offset(opening), List=fields,
+                    Closing=self.offset(closing)), self.after(closing, "]")
+
+    # expressions
+
+    def ident(self, name: str, pos: int) -> dict:
+        return node("Ident", NamePos=self.offset(pos), Name=name)
+
+    def basic_lit(self, kind: str, value: str, pos: int) -> dict:
+        return node("BasicLit", ValuePos=self.offset(pos), Kind=kind, Value=value)
+
+    def exprs(self, xs) -> list:
+        return [self.expr(x) for x in xs]
+
+    def expr(self, x, bare: bool = False) -> dict:
+        if getattr(x, "_parens", False) and not bare:
+            return node("ParenExpr", Lparen=self.offset(self.p.pos_of(x)), X=self.expr(x, bare=True),
+                        Rparen=self.offset(self.p.end_of(x) - 1))
+        if isinstance(x, syntree.Type):
+            return self.type_(x, self.p.node_start(x) if printer.has_span(x) else NoPos)[0]
+        if isinstance(x, (syntree.BadExpr, syntree.BadStmt, syntree.BadDecl)):
+            return node("BadExpr", From=self.offset(x.pos), To=self.offset(x.end))
+        if isinstance(x, syntree.Identifier):
+            return self.ident(x.ident_name, self.p.pos_of(x))
+        start = self.p.node_start(x)
+        if isinstance(x, syntree.BinOp) and not isinstance(x, syntree.Assignment):
+            op = self.p.find(x.operator, self.p.end_of(x.left), self.p.pos_of(x.right))
+            return node("BinaryExpr", X=self.expr(x.left), OpPos=self.offset(op), Op=x.operator,
+                        Y=self.expr(x.right))
+        if isinstance(x, syntree.KeyedElement):
+            colon = self.p.find(":", self.p.end_of(x.key))
+            return node("KeyValueExpr", Key=self.expr(x.key), Colon=self.offset(colon),
+                        Value=self.expr(x.value))
+        if isinstance(x, syntree.UnaryOp):
+            if x.operator == "*":
+                return node("StarExpr", Star=self.offset(start), X=self.expr(x.operand))
+            return node("UnaryExpr", OpPos=self.offset(start), Op=x.operator, X=self.expr(x.operand))
+        if isinstance(x, syntree.LiteralValue):
+            return self.composite_lit(None, x)
+        if isinstance(x, syntree.Literal):
+            if isinstance(x.value, syntree.LiteralValue) or isinstance(x.type_, syntree.Type):
+                return self.composite_lit(x, x.value)
+            text = self.p.literal_text(x)
+            if x.type_ == "bool":
+                return self.ident(text, start)
+            return self.basic_lit(literal_kind(text), text, start)
+        if isinstance(x, syntree.Function):
+            return node("FuncLit", Type=self.func_type(x.signature, x.pos, self.after(x.pos, "func")),
+                        Body=self.block(x.body))
+        if isinstance(x, syntree.PrimaryExpr):
+            return self.primary(x, len(printer.suffixes(x)))
+        if isinstance(x, syntree.FunctionCall):
+            return self.call(x)
+        if isinstance(x, syntree.QualifiedIdent):
+            (_, package, _), (_, name, col) = x.data
+            return node("SelectorExpr", X=self.ident(package, start),
+                        Sel=self.ident(name, self.p.ident_pos(x.lineno, col)))
+        raise printer.FormatError(f"cannot convert {x}")
+
+    def primary(self, x: syntree.PrimaryExpr, k: int) -> dict:
+        """The node of the operand of x and its first k suffixes"""
+        if k == 0:
+            if isinstance(x.data, tuple):
+                return self.ident(x.data[1], x.pos)
+            return self.expr(x.children[0])
+        suffix = printer.suffixes(x)[k - 1]
+        operand = self.primary(x, k - 1)
+        if isinstance(suffix, syntree.Selector):
+            pos = self.p.ident_pos(suffix.lineno, suffix.col_num)
+            return node("SelectorExpr", X=operand, Sel=self.ident(suffix.field_name, pos))
+        if isinstance(suffix, syntree.Index):
+            if isinstance(suffix.expr, syntree.List):
+                indices = self.exprs(checker.in_order(suffix.expr))
+            else:
+                indices = [self.expr(suffix.expr)]
+            return self.index(operand, suffix.pos, indices, suffix.end - 1)
+        if isinstance(suffix, syntree.SliceExpr):
+            return node(
+                "SliceExpr", X=operand, Lbrack=self.offset(suffix.pos),
+                Low=None if suffix.low is None else self.expr(suffix.low),
+                High=None if suffix.high is None else self.expr(suffix.high),
+                Max=None if suffix.max is None else self.expr(suffix.max),
+                Slice3=suffix.max is not None or None, Rbrack=self.offset(suffix.end - 1),
+            )
+        if isinstance(suffix, syntree.TypeAssertion):
+            lparen = self.p.find("(", suffix.pos)
+            type_, _ = self.type_(suffix.type_, self.after(lparen, "("))
+            return node("TypeAssertExpr", X=operand, Lparen=self.offset(lparen), Type=type_,
+                        Rparen=self.offset(suffix.end - 1))
+        raise printer.FormatError(f"cannot convert {suffix}")
+
+    def call(self, x: syntree.FunctionCall) -> dict:
+        arguments = x.arguments
+        lparen, rparen = arguments.pos, arguments.end - 1
+        fn = x.fn_name
+        if isinstance(fn, str):
+            fun = self.ident(fn, x.pos)
+            if x.type_arg_exprs:
+                # an explicit instantiation, like Max[int]
+                lbrack = self.p.find("[", x.pos)
+                rbrack = self.p.rfind("]", x.pos, lparen)
+                fun = self.index(fun, lbrack, self.exprs(x.type_arg_exprs), rbrack)
+        elif isinstance(fn, syntree.Type) and not printer.has_span(fn):
+            fun, _ = self.type_(fn, x.pos)
+        elif isinstance(fn, (syntree.FunctionType, syntree.Chan)) and \
+                (isinstance(fn, syntree.FunctionType) or fn.dir == "recv") and \
+                not getattr(fn, "_parens", False):
+            # conversions to func types and <-chan types need parentheses
+            fun = node("ParenExpr", Lparen=self.offset(x.pos), X=self.expr(fn),
+                       Rparen=self.offset(self.p.rfind(")", x.pos, lparen)))
+        else:
+            fun = self.expr(fn)
+        args = []
+        if arguments.type_ is not None:
+            type_, _ = self.type_(arguments.type_, self.after(lparen, "("))
+            args.append(type_)
+        args += self.exprs(arguments.expressions())
+        ellipsis = self.p.rfind("...", lparen, rparen) if arguments.ellipsis else NoPos
+        return node("CallExpr", Fun=fun, Lparen=self.offset(lparen), Args=args or None,
+                    Ellipsis=self.offset(ellipsis), Rparen=self.offset(rparen))
+
+    def composite_lit(self, x: Optional[syntree.Literal], value: Optional[syntree.LiteralValue]) -> dict:
+        type_ = None
+        if x is not None:
+            type_, _ = self.type_(x.type_, self.p.node_start(x))
+        elements = [] if value is None else list(reversed(value.children))
+        return node(
+            "CompositeLit", Type=type_, Lbrace=self.offset(NoPos if value is None else value.pos),
+            Elts=self.exprs(elements) or None,
+            Rbrace=self.offset(NoPos if value is None else value.end - 1),
+        )
+
+    # statements
+
+    def block(self, block: syntree.Block) -> dict:
+        return node("BlockStmt", Lbrace=self.offset(block.pos), List=self.stmts(block),
+                    Rbrace=self.offset(block.end - 1))
+
+    def stmts(self, block) -> list:
+        return [self.stmt(s) for s in self.p.block_stmts(block)]
+
+    def simple_stmt(self, s) -> Optional[dict]:
+        s = self.p.simple_stmt(s)
+        return None if s is None else self.stmt(s)
+
+    def stmt(self, s) -> dict:
+        if isinstance(s, syntree.List) and not isinstance(s, syntree.Block):
+            s = self.p.simple_stmt(s)
+        pos = self.offset(self.p.pos_of(s))
+        if isinstance(s, syntree.DeclGroup):
+            if s.keyword == ":=":
+                spec = s.specs[0]
+                return self.assign(spec.names, ":=", spec.values)
+            return node("DeclStmt", Decl=self.gen_decl(s))
+        if isinstance(s, syntree.VarDecl):
+            return self.stmt(s._group)
+        if isinstance(s, syntree.Assignment):
+            return self.assign(checker.in_order(s.left), s.operator, checker.in_order(s.right))
+        if isinstance(s, syntree.UnaryOp) and s.operator in ("++", "--"):
+            tok = self.p.find(s.operator, self.p.end_of(s.operand))
+            return node("IncDecStmt", X=self.expr(s.operand), TokPos=self.offset(tok), Tok=s.operator)
+        if isinstance(s, syntree.SendStmt):
+            arrow = self.p.find("<-", self.p.end_of(s.chan))
+            return node("SendStmt", Chan=self.expr(s.chan), Arrow=self.offset(arrow),
+                        Value=self.expr(s.value))
+        if isinstance(s, (syntree.GoStmt, syntree.DeferStmt)):
+            keyword = "go" if isinstance(s, syntree.GoStmt) else "defer"
+            if not isinstance(s.call, syntree.FunctionCall) or getattr(s.call, "_parens", False):
+                # not a call, like go/parser makes it
+                return node("BadStmt", From=pos, To=None if pos is None else pos + len(keyword))
+            return node(keyword.capitalize() + "Stmt", **{keyword.capitalize(): pos, "Call": self.expr(s.call)})
+        if isinstance(s, syntree.Keyword):
+            if s.kw == "RETURN":
+                results = checker.in_order(s.children[0]) if s.children else []
+                return node("ReturnStmt", Return=pos, Results=self.exprs(results) or None)
+            label = None if s.label is None else self.expr(s.label)
+            return node("BranchStmt", TokPos=pos, Tok=s.kw.lower(), Label=label)
+        if isinstance(s, syntree.LabeledStmt):
+            colon = self.p.find(":", self.p.end_of(s.label))
+            if s.stmt is None:
+                semicolon = self.p.find(";", colon)
+                stmt = node("EmptyStmt", Semicolon=self.offset(semicolon),
+                            Implicit=semicolon == NoPos or None)
+            else:
+                stmt = self.stmt(s.stmt)
+            return node("LabeledStmt", Label=self.expr(s.label), Colon=self.offset(colon), Stmt=stmt)
+        if isinstance(s, syntree.Block):
+            return self.block(s)
+        if isinstance(s, syntree.IfStmt):
+            return node("IfStmt", If=pos, Init=self.simple_stmt(s.statement), Cond=self.expr(s.expr),
+                        Body=self.block(s.body),
+                        Else=None if s.next_ is None else self.stmt(s.next_))
+        if isinstance(s, syntree.ForStmt):
+            return self.for_stmt(s, pos)
+        if isinstance(s, syntree.TypeSwitchStmt):
+            lparen = self.p.find("(", self.p.end_of(s.expr))
+            rparen = self.p.find(")", lparen)
+            x = node("TypeAssertExpr", X=self.expr(s.expr), Lparen=self.offset(lparen),
+                     Rparen=self.offset(rparen))
+            if s.ident is not None:
+                define = self.p.find(":=", self.p.end_of(s.ident))
+                assign = node("AssignStmt", Lhs=[self.expr(s.ident)], TokPos=self.offset(define),
+                              Tok=":=", Rhs=[x])
+            else:
+                assign = node("ExprStmt", X=x)
+            lbrace = self.p.find("{", rparen)
+            return node("TypeSwitchStmt", Switch=pos, Init=self.simple_stmt(s.statement),
+                        Assign=assign, Body=self.clauses(s.clauses, lbrace, s.end - 1))
+        if isinstance(s, syntree.SwitchStmt):
+            header_end = self.p.end_of(s.expr) if s.expr is not None else NoPos
+            if header_end == NoPos and s.statement is not None:
+                header_end = self.p.end_of(self.p.simple_stmt(s.statement))
+            lbrace = self.p.find("{", header_end if header_end != NoPos else s.pos)
+            return node("SwitchStmt", Switch=pos, Init=self.simple_stmt(s.statement),
+                        Tag=None if s.expr is None else self.expr(s.expr),
+                        Body=self.clauses(s.clauses, lbrace, s.end - 1))
+        if isinstance(s, syntree.SelectStmt):
+            lbrace = self.p.find("{", s.pos)
+            return node("SelectStmt", Select=pos, Body=self.clauses(s.clauses, lbrace, s.end - 1))
+        if isinstance(s, syntree.TypeCaseClause):
+            if s.types is not None:
+                types = checker.in_order(s.types)
+                cases = [self.ident("nil", case.pos) if case.nil else self.type_(case.type_, case.pos)[0]
+                         for case in types]
+                colon = self.p.find(":", types[-1].end)
+            else:
+                cases, colon = None, self.p.find(":", s.pos)
+            return node("CaseClause", Case=pos, List=cases, Colon=self.offset(colon),
+                        Body=self.stmts(s.body))
+        if isinstance(s, syntree.CaseClause):
+            if s.exprs is not None:
+                exprs = checker.in_order(s.exprs)
+                cases, colon = self.exprs(exprs), self.p.find(":", self.p.end_of(exprs[-1]))
+            else:
+                cases, colon = None, self.p.find(":", s.pos)
+            return node("CaseClause", Case=pos, List=cases, Colon=self.offset(colon),
+                        Body=self.stmts(s.body))
+        if isinstance(s, syntree.CommClause):
+            comm = None
+            if s.comm is not None:
+                comm = self.p.simple_stmt(s.comm)
+                colon = self.p.find(":", self.p.end_of(comm))
+                comm = self.stmt(comm)
+            else:
+                colon = self.p.find(":", s.pos)
+            return node("CommClause", Case=pos, Comm=comm, Colon=self.offset(colon),
+                        Body=self.stmts(s.body))
+        if isinstance(s, (syntree.BadStmt, syntree.BadDecl)):
+            return node("BadStmt", From=self.offset(s.pos), To=self.offset(s.end))
+        return node("ExprStmt", X=self.expr(s))
+
+    def assign(self, lhs: list, op: str, rhs: list) -> dict:
+        tok = self.p.find(op, self.p.end_of(lhs[-1]))
+        return node("AssignStmt", Lhs=self.exprs(lhs), TokPos=self.offset(tok), Tok=op,
+                    Rhs=self.exprs(rhs))
+
+    def clauses(self, clauses, lbrace: int, rbrace: int) -> dict:
+        stmts = [self.stmt(c) for c in self.p.in_source_order(checker.in_order(clauses))]
+        return node("BlockStmt", Lbrace=self.offset(lbrace), List=stmts, Rbrace=self.offset(rbrace))
+
+    def for_stmt(self, s: syntree.ForStmt, pos: Optional[int]) -> dict:
+        clause = s.clause
+        if isinstance(clause, syntree.RangeClause):
+            if clause.ident_list is not None:
+                keys, tok = list(reversed(clause.ident_list.children)), ":="
+            else:
+                keys, tok = checker.in_order(clause.expr_list), "="
+            tok_pos = self.p.find(tok, self.p.end_of(keys[-1])) if keys else NoPos
+            range_ = self.p.find("range", self.after(tok_pos, tok) if keys else s.pos)
+            return node(
+                "RangeStmt", For=pos, Key=self.expr(keys[0]) if keys else None,
+                Value=self.expr(keys[1]) if len(keys) > 1 else None,
+                TokPos=self.offset(tok_pos), Tok=tok if keys else None, Range=self.offset(range_),
+                X=self.expr(clause.expr), Body=self.block(s.body),
+            )
+        init = cond = post = None
+        if isinstance(clause, syntree.ForClause):
+            init, post = self.simple_stmt(clause.init), self.simple_stmt(clause.post)
+            if self.p.pos_of(clause.cond) != NoPos:
+                cond = self.expr(clause.cond)
+        elif self.p.pos_of(clause) != NoPos:
+            cond = self.expr(clause)
+        return node("ForStmt", For=pos, Init=init, Cond=cond, Post=post, Body=self.block(s.body))
+
+
+def literal_kind(text: str) -> str:
+    """The token of a basic literal, like FLOAT for 1.5"""
+    if text[:1] in ('"', "`"):
+        return "STRING"
+    if text[:1] == "'":
+        return "CHAR"
+    if text.endswith("i"):
+        return "IMAG"
+    if text[:2].lower() == "0x":
+        return "FLOAT" if "." in text or "p" in text.lower() else "INT"
+    if text[:2].lower() in ("0b", "0o") or not any(c in text for c in ".eE"):
+        return "INT"
+    return "FLOAT"
+
+
+def files(packages: list) -> List[dict]:
+    """The trees of the files of the package of a program checked (the
+    last one of packages), in order"""
+    import utils
+    from fileset import fset
+    package = packages[-1]
+    nodes = {n.filename: n for n in package.ast.children if isinstance(n, syntree.File)}
+    trees = []
+    for filename in package.files:
+        file = next(f for f in reversed(fset.files) if f.name == filename)
+        source = "\n".join(utils.sources[filename])
+        trees.append(Converter(nodes[filename], file, source, package.name).convert())
+    return trees
+
+
+# back to Go source
+
+precedences = printer.precedences
+
+# the line breaks of raw strings, until the end (Go source has no NUL)
+RAW_NEWLINE = "\0"
+
+
+class SourcePrinter:
+    """Prints a tree of go/ast as Go source, one statement (or
+    declaration) by line, indented by tabs. The comments are left out,
+    but for the doc comments of the declarations"""
+
+    def __init__(self):
+        self.lines: List[str] = []
+        self.indent = 0
+
+    def line(self, text: str):
+        # the lines after the first one of a function literal (or of a
+        # struct type) are indented relative to it
+        self.lines.extend("\t" * self.indent + line for line in text.split("\n"))
+
+    def file(self, f: dict) -> str:
+        self.doc(f.get("Doc"))
+        self.line(f"package {f['Name']['Name']}")
+        for d in f.get("Decls") or []:
+            self.line("")
+            self.decl(d)
+        return "\n".join(self.lines).replace(RAW_NEWLINE, "\n") + "\n"
+
+    def doc(self, group: Optional[dict]):
+        if group is not None:
+            for comment in group.get("List") or []:
+                for line in comment["Text"].split("\n"):
+                    self.line(line)
+
+    # declarations
+
+    def decl(self, d: dict):
+        kind = d["_type"]
+        if kind == "FuncDecl":
+            self.doc(d.get("Doc"))
+            recv = f"({self.fields(d['Recv'])}) " if d.get("Recv") else ""
+            header = f"func {recv}{d['Name']['Name']}{self.signature(d['Type'])}"
+            if d.get("Body") is None:
+                self.line(header)
+            else:
+                self.block(d["Body"], header + " ")
+        elif kind == "GenDecl":
+            self.doc(d.get("Doc"))
+            specs = d.get("Specs") or []
+            if "Lparen" in d or len(specs) != 1:
+                self.line(f"{d['Tok']} (")
+                self.indent += 1
+                for spec in specs:
+                    self.doc(spec.get("Doc"))
+                    self.line(self.spec(spec))
+                self.indent -= 1
+                self.line(")")
+            else:
+                self.line(f"{d['Tok']} {self.spec(specs[0])}")
+        else:
+            raise ValueError(f"cannot print {kind}")
+
+    def spec(self, s: dict) -> str:
+        kind = s["_type"]
+        if kind == "ImportSpec":
+            name = f"{s['Name']['Name']} " if s.get("Name") else ""
+            return name + s["Path"]["Value"]
+        if kind == "TypeSpec":
+            params = f"[{self.fields(s['TypeParams'])}]" if s.get("TypeParams") else ""
+            assign = " =" if "Assign" in s else ""
+            return f"{s['Name']['Name']}{params}{assign} {self.expr(s['Type'])}"
+        text = ", ".join(n["Name"] for n in s["Names"])
+        if s.get("Type"):
+            text += " " + self.expr(s["Type"])
+        if s.get("Values"):
+            text += " = " + self.exprs(s["Values"])
+        return text
+
+    def fields(self, fields: dict, sep: str = ", ") -> str:
+        items = []
+        for f in fields.get("List") or []:
+            names = ", ".join(n["Name"] for n in f.get("Names") or [])
+            type_ = self.expr(f["Type"])
+            if f.get("Names") and f["Type"]["_type"] == "FuncType" and sep == "\n":
+                # a method of an interface
+                items.append(names + self.signature(f["Type"]))
+                continue
+            item = f"{names} {type_}" if names else type_
+            if f.get("Tag"):
+                item += " " + f["Tag"]["Value"]
+            items.append(item)
+        return sep.join(items)
+
+    def signature(self, t: dict) -> str:
+        params = f"[{self.fields(t['TypeParams'])}]" if t.get("TypeParams") else ""
+        text = f"{params}({self.fields(t['Params'])})"
+        results = t.get("Results")
+        if results and results.get("List"):
+            fields = results["List"]
+            if len(fields) == 1 and not fields[0].get("Names"):
+                text += " " + self.expr(fields[0]["Type"])
+            else:
+                text += f" ({self.fields(results)})"
+        return text
+
+    # expressions
+
+    def exprs(self, xs: list) -> str:
+        return ", ".join(self.expr(x) for x in xs)
+
+    def expr(self, x: dict, prec: int = 0) -> str:
+        kind = x["_type"]
+        if kind == "Ident":
+            return x["Name"]
+        if kind == "BasicLit":
+            # the lines of a raw string aren't indented
+            return x["Value"].replace("\n", RAW_NEWLINE)
+        if kind == "BinaryExpr":
+            p = precedences[x["Op"]] if x["Op"] in precedences else 1
+            text = f"{self.expr(x['X'], p)} {x['Op']} {self.expr(x['Y'], p + 1)}"
+            return f"({text})" if p < prec else text
+        if kind == "UnaryExpr":
+            text = x["Op"] + self.expr(x["X"], printer.UNARY_PREC)
+            return f"({text})" if printer.UNARY_PREC < prec else text
+        if kind == "StarExpr":
+            text = "*" + self.expr(x["X"], printer.UNARY_PREC)
+            return f"({text})" if printer.UNARY_PREC < prec else text
+        if kind == "ParenExpr":
+            return f"({self.expr(x['X'])})"
+        if kind == "SelectorExpr":
+            return f"{self.expr(x['X'], printer.HIGHEST_PREC)}.{x['Sel']['Name']}"
+        if kind == "IndexExpr":
+            return f"{self.expr(x['X'], printer.HIGHEST_PREC)}[{self.expr(x['Index'])}]"
+        if kind == "IndexListExpr":
+            return f"{self.expr(x['X'], printer.HIGHEST_PREC)}[{self.exprs(x['Indices'])}]"
+        if kind == "SliceExpr":
+            indices = [x.get("Low"), x.get("High")] + ([x.get("Max")] if x.get("Slice3") else [])
+            text = ":".join("" if i is None else self.expr(i) for i in indices)
+            return f"{self.expr(x['X'], printer.HIGHEST_PREC)}[{text}]"
+        if kind == "TypeAssertExpr":
+            type_ = "type" if x.get("Type") is None else self.expr(x["Type"])
+            return f"{self.expr(x['X'], printer.HIGHEST_PREC)}.({type_})"
+        if kind == "CallExpr":
+            ellipsis = "..." if "Ellipsis" in x else ""
+            return f"{self.expr(x['Fun'], printer.HIGHEST_PREC)}({self.exprs(x.get('Args') or [])}{ellipsis})"
+        if kind == "KeyValueExpr":
+            return f"{self.expr(x['Key'])}: {self.expr(x['Value'])}"
+        if kind == "CompositeLit":
+            type_ = self.expr(x["Type"]) if x.get("Type") else ""
+            return f"{type_}{{{self.exprs(x.get('Elts') or [])}}}"
+        if kind == "FuncLit":
+            return self.nested(lambda: self.block(x["Body"], "func" + self.signature(x["Type"]) + " "))
+        if kind == "Ellipsis":
+            return "..." + (self.expr(x["Elt"]) if x.get("Elt") else "")
+        if kind == "ArrayType":
+            length = self.expr(x["Len"]) if x.get("Len") else ""
+            return f"[{length}]{self.expr(x['Elt'])}"
+        if kind == "MapType":
+            return f"map[{self.expr(x['Key'])}]{self.expr(x['Value'])}"
+        if kind == "ChanType":
+            keyword = {SEND: "chan<-", RECV: "<-chan"}.get(x["Dir"], "chan")
+            return f"{keyword} {self.expr(x['Value'])}"
+        if kind == "FuncType":
+            return "func" + self.signature(x)
+        if kind in ("StructType", "InterfaceType"):
+            keyword = kind[:-4].lower()
+            fields = self.fields(x["Fields" if kind == "StructType" else "Methods"], "\n").split("\n")
+            if fields == [""]:
+                return keyword + "{}"
+            return self.nested(lambda: self.lines_in(keyword + "{", fields, "}"))
+        raise ValueError(f"cannot print {kind}")
+
+    def nested(self, print_) -> str:
+        """The lines printed by print_, as the text of an expression"""
+        lines, indent = self.lines, self.indent
+        self.lines, self.indent = [], 0
+        try:
+            print_()
+            return "\n".join(self.lines)
+        finally:
+            self.lines, self.indent = lines, indent
+
+    def lines_in(self, opening: str, lines: list, closing: str):
+        self.line(opening)
+        self.indent += 1
+        for line in lines:
+            self.line(line)
+        self.indent -= 1
+        self.line(closing)
+
+    # statements
+
+    def block(self, b: dict, header: str = ""):
+        self.line(header + "{")
+        self.indent += 1
+        for s in b.get("List") or []:
+            self.stmt(s)
+        self.indent -= 1
+        self.line("}")
+
+    def simple(self, s: Optional[dict]) -> str:
+        return "" if s is None else self.nested(lambda: self.stmt(s)).strip()
+
+    def stmt(self, s: dict):
+        kind = s["_type"]
+        if kind == "DeclStmt":
+            self.decl(s["Decl"])
+        elif kind == "AssignStmt":
+            self.line(f"{self.exprs(s['Lhs'])} {s['Tok']} {self.exprs(s['Rhs'])}")
+        elif kind == "IncDecStmt":
+            self.line(self.expr(s["X"]) + s["Tok"])
+        elif kind == "SendStmt":
+            self.line(f"{self.expr(s['Chan'])} <- {self.expr(s['Value'])}")
+        elif kind == "ExprStmt":
+            self.line(self.expr(s["X"]))
+        elif kind in ("GoStmt", "DeferStmt"):
+            self.line(f"{kind[:-4].lower()} {self.expr(s['Call'])}")
+        elif kind == "ReturnStmt":
+            results = s.get("Results")
+            self.line("return" + (" " + self.exprs(results) if results else ""))
+        elif kind == "BranchStmt":
+            self.line(s["Tok"] + (" " + s["Label"]["Name"] if s.get("Label") else ""))
+        elif kind == "LabeledStmt":
+            self.indent -= 1
+            self.line(s["Label"]["Name"] + ":")
+            self.indent += 1
+            if s["Stmt"]["_type"] == "EmptyStmt":
+                self.line(";")
+            else:
+                self.stmt(s["Stmt"])
+        elif kind == "EmptyStmt":
+            self.line(";")
+        elif kind == "BlockStmt":
+            self.block(s)
+        elif kind == "IfStmt":
+            self.if_stmt(s, "")
+        elif kind == "ForStmt":
+            header = "for "
+            if s.get("Init") or s.get("Post"):
+                header += f"{self.simple(s.get('Init'))}; {self.cond(s.get('Cond'))}; {self.simple(s.get('Post'))} "
+            elif s.get("Cond"):
+                header += self.cond(s["Cond"]) + " "
+            self.block(s["Body"], header)
+        elif kind == "RangeStmt":
+            keys = ", ".join(self.expr(s[k]) for k in ("Key", "Value") if s.get(k))
+            header = f"for {keys} {s['Tok']} range " if keys else "for range "
+            self.block(s["Body"], header + self.cond(s["X"]) + " ")
+        elif kind in ("SwitchStmt", "TypeSwitchStmt"):
+            header = "switch "
+            if s.get("Init"):
+                header += self.simple(s["Init"]) + "; "
+            if kind == "TypeSwitchStmt":
+                header += self.simple(s["Assign"]) + " "
+            elif s.get("Tag"):
+                header += self.cond(s["Tag"]) + " "
+            self.clauses(s["Body"], header)
+        elif kind == "SelectStmt":
+            self.clauses(s["Body"], "select ")
+        else:
+            raise ValueError(f"cannot print {kind}")
+
+    def cond(self, x: dict) -> str:
+        """An expression before a {, in parentheses if the { of a composite
+        literal of a type name in it would be read as the one of the block"""
+        text = self.expr(x)
+        return f"({text})" if has_type_name_lit(x) else text
+
+    def if_stmt(self, s: dict, prefix: str):
+        init = self.simple(s.get("Init"))
+        header = f"{prefix}if {init + '; ' if init else ''}{self.cond(s['Cond'])} "
+        else_ = s.get("Else")
+        if else_ is None:
+            self.block(s["Body"], header)
+            return
+        self.block(s["Body"], header)
+        # the } of the block is the one before the else
+        self.lines.pop()
+        if else_["_type"] == "IfStmt":
+            self.if_stmt(else_, "} else ")
+        else:
+            self.block(else_, "} else ")
+
+    def clauses(self, body: dict, header: str):
+        self.line(header + "{")
+        for clause in body.get("List") or []:
+            if clause["_type"] == "CommClause":
+                case = f"case {self.simple(clause['Comm'])}:" if clause.get("Comm") else "default:"
+            else:
+                items = clause.get("List")
+                case = f"case {self.exprs(items)}:" if items else "default:"
+            self.line(case)
+            self.indent += 1
+            for s in clause.get("Body") or []:
+                self.stmt(s)
+            self.indent -= 1
+        self.line("}")
+
+
+def has_type_name_lit(x: dict) -> bool:
+    """If a composite literal of a type name is an operand of x, not in
+    parentheses, brackets or braces (like the arguments of a call)"""
+    kind = x["_type"]
+    if kind == "CompositeLit":
+        return x.get("Type", {}).get("_type") in ("Ident", "SelectorExpr", "IndexExpr", "IndexListExpr")
+    if kind == "BinaryExpr":
+        return has_type_name_lit(x["X"]) or has_type_name_lit(x["Y"])
+    if kind in ("UnaryExpr", "StarExpr", "SelectorExpr", "IndexExpr", "IndexListExpr",
+                "SliceExpr", "TypeAssertExpr"):
+        return has_type_name_lit(x["X"])
+    if kind == "CallExpr":
+        return has_type_name_lit(x["Fun"])
+    return False
+
+
+def to_source(tree: dict) -> str:
+    """The Go source of the tree of a file"""
+    return SourcePrinter().file(tree)
+
+
+def load(tree: dict, path: str = "") -> list:
+    """The packages of the program of the tree of a file checked (see
+    go_parser.check_program), its file is one of utils.overlays, named
+    path (or the name of its "_file") in no directory of the disk"""
+    import go_parser
+    import utils
+    import contextlib
+    import io
+    name = os.path.basename(tree.get("_file", {}).get("name", "main.go"))
+    path = path or os.path.join(os.sep, "goast", name)
+    syntree.type_refs.clear()
+    utils.overlays[path] = to_source(tree)
+    with contextlib.redirect_stdout(io.StringIO()):
+        return go_parser.check_program(path, verbose=False)
+
+
+def key() -> str:
+    """The hash of goast/main.go"""
+    with open(source, "rb") as f:
+        return hashlib.sha256(f.read()).hexdigest()[:16]
+
+
+def command() -> Optional[str]:
+    """goast/main.go built by the go command, the first time. None if it
+    can't be built (or there is no go command)"""
+    binary = os.path.join(directory, key(), "goast")
+    if os.path.exists(binary):
+        return binary
+    os.makedirs(os.path.dirname(binary), exist_ok=True)
+    tmp = f"{binary}.{os.getpid()}"
+    try:
+        done = subprocess.run([go_command, "build", "-o", tmp, source], capture_output=True,
+                              timeout=300, env=dict(os.environ, GO111MODULE="off"))
+    except (OSError, subprocess.TimeoutExpired):
+        return None
+    if done.returncode != 0:
+        return None
+    os.replace(tmp, binary)
+    return binary
+
+
+def gofmt(tree: dict) -> Optional[str]:
+    """The file of the tree printed by go/format, None if goast fails
+    (or there is no go command)"""
+    binary = command()
+    if binary is None:
+        return None
+    try:
+        done = subprocess.run([binary, "fmt"], input=json.dumps(tree), capture_output=True,
+                              text=True, timeout=300)
+    except (OSError, subprocess.TimeoutExpired):
+        return None
+    return done.stdout if done.returncode == 0 else None
+
+
+if __name__ == "__main__":
+    arg_parser = argparse.ArgumentParser(
+        description="Prints the go/ast trees of the files of a Go program, or one printed back as Go")
+    arg_parser.add_argument("path", help="a .go file or the directory of a program, or with "
+                                         "-d the JSON of a tree (- for the standard input)")
+    arg_parser.add_argument("-d", "--decode", action="store_true",
+                            help="prints the Go source of the tree in path")
+    arg_parser.add_argument("--gofmt", action="store_true",
+                            help="prints the files formatted by go/format, from their trees")
+    args = arg_parser.parse_args()
+    if args.decode:
+        if args.path == "-":
+            tree = json.load(sys.stdin)
+        else:
+            with open(args.path) as f:
+                tree = json.load(f)
+        sys.stdout.write(to_source(tree))
+        sys.exit(0)
+
+    import io
+    import contextlib
+    import diagnostics
+    import go_parser
+    diagnostics.printing = False
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = go_parser.check_program(args.path, verbose=False)
+    if not packages or go_parser.parse_errors:
+        with contextlib.redirect_stdout(sys.stderr):
+            diagnostics.print_diagnostics(diagnostics.reported)
+        sys.exit(1)
+    status = 0
+    for tree in files(packages):
+        if args.gofmt:
+            formatted = gofmt(tree)
+            if formatted is None:
+                print(f"{tree['_file']['name']}: goast failed", file=sys.stderr)
+                status = 1
+                continue
+            sys.stdout.write(formatted)
+        else:
+            json.dump(tree, sys.stdout, indent=1)
+            print()
+    sys.exit(status)
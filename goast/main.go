@@ -0,0 +1,349 @@
+// Command goast turns the go/ast trees goast.py makes from the AST of gopy
+// (encoded as JSON) into the nodes of go/ast, for the tools of Go to work
+// on, and the other way around:
+//
+//	go build -o goast ./goast/main.go
+//	python goast.py tests/iota.go | ./goast fmt
+//	./goast json tests/iota.go | python goast.py -d -
+//
+// fmt prints the file of the JSON read from its argument (or stdin) with
+// go/format, like gofmt, and json prints the JSON of the file parsed by
+// go/parser. Each node is an object with its go/ast type in "_type" and
+// the fields of its go/ast struct, the positions being byte offsets in the
+// file (left out if unknown), the tokens their strings (like "+=") and
+// the ChanDirs their values. The File has the name, the size and the
+// offsets of the lines of the file in "_file", the objects and the scopes
+// of go/ast are left out, and the Imports are the specs of the imports
+// of the file. decode makes the *ast.File of the JSON, in a fileset with
+// the file, for the tools which take a go/ast tree.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+)
+
+// nodeTypes are the types of the nodes of go/ast, by name.
+var nodeTypes = map[string]reflect.Type{}
+
+// tokens are the tokens of go/token, by their string.
+var tokens = map[string]token.Token{}
+
+var (
+	posType      = reflect.TypeOf(token.NoPos)
+	tokenType    = reflect.TypeOf(token.ILLEGAL)
+	chanDirType  = reflect.TypeOf(ast.SEND)
+	objectType   = reflect.TypeOf((*ast.Object)(nil))
+	scopeType    = reflect.TypeOf((*ast.Scope)(nil))
+	commentsType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+func init() {
+	for _, node := range []any{
+		ast.ArrayType{}, ast.AssignStmt{}, ast.BadDecl{}, ast.BadExpr{}, ast.BadStmt{},
+		ast.BasicLit{}, ast.BinaryExpr{}, ast.BlockStmt{}, ast.BranchStmt{}, ast.CallExpr{},
+		ast.CaseClause{}, ast.ChanType{}, ast.CommClause{}, ast.Comment{}, ast.CommentGroup{},
+		ast.CompositeLit{}, ast.DeclStmt{}, ast.DeferStmt{}, ast.Ellipsis{}, ast.EmptyStmt{},
+		ast.ExprStmt{}, ast.Field{}, ast.FieldList{}, ast.File{}, ast.ForStmt{},
+		ast.FuncDecl{}, ast.FuncLit{}, ast.FuncType{}, ast.GenDecl{}, ast.GoStmt{},
+		ast.Ident{}, ast.IfStmt{}, ast.ImportSpec{}, ast.IncDecStmt{}, ast.IndexExpr{},
+		ast.IndexListExpr{}, ast.InterfaceType{}, ast.KeyValueExpr{}, ast.LabeledStmt{},
+		ast.MapType{}, ast.ParenExpr{}, ast.RangeStmt{}, ast.ReturnStmt{}, ast.SelectStmt{},
+		ast.SelectorExpr{}, ast.SendStmt{}, ast.SliceExpr{}, ast.StarExpr{}, ast.StructType{},
+		ast.SwitchStmt{}, ast.TypeAssertExpr{}, ast.TypeSpec{}, ast.TypeSwitchStmt{},
+		ast.UnaryExpr{}, ast.ValueSpec{},
+	} {
+		t := reflect.TypeOf(node)
+		nodeTypes[t.Name()] = t
+	}
+	for tok := token.ILLEGAL; tok <= token.TILDE; tok++ {
+		if s := tok.String(); s != fmt.Sprintf("token(%d)", int(tok)) {
+			tokens[s] = tok
+		}
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 || len(os.Args) > 3 || os.Args[1] != "fmt" && os.Args[1] != "json" {
+		fmt.Fprintln(os.Stderr, "usage: goast fmt [file.json] | goast json file.go")
+		os.Exit(2)
+	}
+	var err error
+	if os.Args[1] == "fmt" {
+		err = formatFile(os.Args[2:])
+	} else if len(os.Args) == 3 {
+		err = encodeFile(os.Args[2])
+	} else {
+		err = fmt.Errorf("goast json: no file given")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func formatFile(args []string) error {
+	in := io.Reader(os.Stdin)
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	file, err := decode(fset, data)
+	if err != nil {
+		return err
+	}
+	return format.Node(os.Stdout, fset, file)
+}
+
+func encodeFile(filename string) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", " ")
+	return enc.Encode(encode(fset, file))
+}
+
+// fileInfo is the "_file" of a File.
+type fileInfo struct {
+	Name  string `json:"name"`
+	Size  int    `json:"size"`
+	Lines []int  `json:"lines"`
+}
+
+// decode makes the file of its JSON, the file is added to fset.
+func decode(fset *token.FileSet, data []byte) (*ast.File, error) {
+	var object map[string]any
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	var info fileInfo
+	if raw, ok := object["_file"]; ok {
+		encoded, _ := json.Marshal(raw)
+		if err := json.Unmarshal(encoded, &info); err != nil {
+			return nil, fmt.Errorf("goast: _file: %v", err)
+		}
+	}
+	if info.Name == "" {
+		info.Name = "main.go"
+	}
+	d := &decoder{file: fset.AddFile(info.Name, -1, info.Size+1), comments: map[token.Pos]*ast.CommentGroup{}}
+	if len(info.Lines) > 0 && !d.file.SetLines(info.Lines) {
+		return nil, fmt.Errorf("goast: invalid lines in _file")
+	}
+	v, err := d.node(object, reflect.TypeOf(ast.File{}))
+	if err != nil {
+		return nil, err
+	}
+	file := v.Interface().(*ast.File)
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			for _, spec := range gen.Specs {
+				file.Imports = append(file.Imports, spec.(*ast.ImportSpec))
+			}
+		}
+	}
+	return file, nil
+}
+
+type decoder struct {
+	file *token.File
+	// the CommentGroups decoded, the ones of the Docs are the ones of
+	// the Comments of the file
+	comments map[token.Pos]*ast.CommentGroup
+}
+
+// node decodes a node of the type t (or of the "_type" of the object if
+// t is an interface), a pointer to it.
+func (d *decoder) node(object map[string]any, t reflect.Type) (reflect.Value, error) {
+	if name, ok := object["_type"].(string); ok {
+		nt, known := nodeTypes[name]
+		if !known {
+			return reflect.Value{}, fmt.Errorf("goast: unknown node type %s", name)
+		}
+		t = nt
+	} else if t.Kind() == reflect.Interface {
+		return reflect.Value{}, fmt.Errorf("goast: node without _type")
+	}
+	ptr := reflect.New(t)
+	v := ptr.Elem()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		raw, ok := object[field.Name]
+		if !ok || raw == nil {
+			continue
+		}
+		value, err := d.value(raw, field.Type)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s.%s: %v", t.Name(), field.Name, err)
+		}
+		if value.IsValid() {
+			v.Field(i).Set(value)
+		}
+	}
+	if t == commentsType.Elem() {
+		group := ptr.Interface().(*ast.CommentGroup)
+		if len(group.List) > 0 {
+			if seen, ok := d.comments[group.Pos()]; ok {
+				return reflect.ValueOf(seen), nil
+			}
+			d.comments[group.Pos()] = group
+		}
+	}
+	return ptr, nil
+}
+
+// value decodes the value of a field of the type t.
+func (d *decoder) value(raw any, t reflect.Type) (reflect.Value, error) {
+	switch {
+	case t == posType:
+		offset, ok := raw.(float64)
+		if !ok || int(offset) < 0 || int(offset) > d.file.Size() {
+			return reflect.Value{}, fmt.Errorf("invalid position %v", raw)
+		}
+		return reflect.ValueOf(d.file.Pos(int(offset))), nil
+	case t == tokenType:
+		tok, ok := tokens[fmt.Sprint(raw)]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown token %v", raw)
+		}
+		return reflect.ValueOf(tok), nil
+	case t == chanDirType:
+		dir, ok := raw.(float64)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("invalid ChanDir %v", raw)
+		}
+		return reflect.ValueOf(ast.ChanDir(dir)), nil
+	case t == objectType || t == scopeType:
+		return reflect.Value{}, nil
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool:
+		v := reflect.ValueOf(raw)
+		if v.Kind() != t.Kind() {
+			return reflect.Value{}, fmt.Errorf("invalid %s %v", t.Kind(), raw)
+		}
+		return v.Convert(t), nil
+	case reflect.Interface, reflect.Ptr:
+		object, ok := raw.(map[string]any)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("not a node: %v", raw)
+		}
+		elem := t
+		if t.Kind() == reflect.Ptr {
+			elem = t.Elem()
+		}
+		v, err := d.node(object, elem)
+		if err != nil {
+			return v, err
+		}
+		if !v.Type().AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("a %s isn't a %s", v.Type().Elem().Name(), t)
+		}
+		return v, nil
+	case reflect.Slice:
+		items, ok := raw.([]any)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("not a list: %v", raw)
+		}
+		s := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			v, err := d.value(item, t.Elem())
+			if err != nil {
+				return v, fmt.Errorf("[%d]: %v", i, err)
+			}
+			s.Index(i).Set(v)
+		}
+		return s, nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot decode a %s", t)
+}
+
+// encode is the JSON value of a node (of the file), see decode.
+func encode(fset *token.FileSet, node ast.Node) map[string]any {
+	e := encoder{fset: fset}
+	object := e.node(reflect.ValueOf(node))
+	if file, ok := node.(*ast.File); ok {
+		tf := fset.File(file.Pos())
+		object["_file"] = fileInfo{Name: tf.Name(), Size: tf.Size(), Lines: tf.Lines()}
+		delete(object, "Imports")
+	}
+	return object
+}
+
+type encoder struct {
+	fset *token.FileSet
+}
+
+// node encodes the node v points to.
+func (e *encoder) node(v reflect.Value) map[string]any {
+	v = v.Elem()
+	t := v.Type()
+	object := map[string]any{"_type": t.Name()}
+	for i := 0; i < t.NumField(); i++ {
+		if value, ok := e.value(v.Field(i)); ok {
+			object[t.Field(i).Name] = value
+		}
+	}
+	return object
+}
+
+// value encodes a field, ok is false for the ones left out.
+func (e *encoder) value(v reflect.Value) (value any, ok bool) {
+	switch t := v.Type(); {
+	case t == posType:
+		pos := v.Interface().(token.Pos)
+		if !pos.IsValid() {
+			return nil, false
+		}
+		return e.fset.Position(pos).Offset, true
+	case t == tokenType:
+		return v.Interface().(token.Token).String(), true
+	case t == chanDirType:
+		return int(v.Interface().(ast.ChanDir)), true
+	case t == objectType || t == scopeType:
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Bool:
+		return v.Interface(), true
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, false
+		}
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		return e.node(v), true
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, false
+		}
+		items := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if item, ok := e.value(v.Index(i)); ok {
+				items = append(items, item)
+			}
+		}
+		return items, true
+	}
+	return nil, false
+}
@@ -0,0 +1,348 @@
+import html
+
+from dataclasses import dataclass, field
+from typing import List, Optional
+
+import checker
+import fileset
+import printer
+import scopes
+import syntree
+import utils
+
+from checker import results
+
+
+# The documentation of a package type checked (go_parser.py doc), like the
+# one go doc -all prints: the doc comment of the package, then its constants,
+# variables, functions and types with their doc comments, the exported ones
+# only (all of them with unexported). The functions and types are printed as
+# they are written, without their bodies, the constants with the values the
+# type checker computed (like 2 for the third iota of a group) and the
+# variables with their types. The constants and the variables are in the
+# order they are declared, the functions, the types and the methods are
+# sorted by name. The constants, the variables and the functions returning
+# a type of the package (or a pointer to it) are listed with the type,
+# after it, then its methods:
+#
+#   doc = godoc.document(packages[-1], info)
+#   print(godoc.formats["markdown"](doc))
+
+
+@dataclass
+class Decl:
+    """A declaration documented: its objects (the ones of a group of
+    constants or variables, or one object), the declaration in Go and the
+    text of its doc comment"""
+
+    objects: List[checker.Object]
+    text: str
+    doc: str = ""
+    # if it is a group of constants or variables, written in parentheses
+    group: bool = False
+    # for a type, what is listed with it (see document)
+    consts: List["Decl"] = field(default_factory=list)
+    vars: List["Decl"] = field(default_factory=list)
+    funcs: List["Decl"] = field(default_factory=list)
+    methods: List["Decl"] = field(default_factory=list)
+
+
+@dataclass
+class Package:
+    """The documentation of a package, its declarations in the order they
+    are declared (the ones of the types are in their Decl)"""
+
+    name: str
+    path: str
+    doc: str = ""
+    consts: List[Decl] = field(default_factory=list)
+    vars: List[Decl] = field(default_factory=list)
+    funcs: List[Decl] = field(default_factory=list)
+    types: List[Decl] = field(default_factory=list)
+
+
+def is_exported(name: str) -> bool:
+    return name[:1].isupper()
+
+
+def comment_text(group: Optional[syntree.CommentGroup]) -> str:
+    return group.text().strip() if group is not None else ""
+
+
+def package_doc(ast) -> str:
+    """The doc comment of the package: the one right before the package
+    clause of one of its files (the first file having one)"""
+    for file in reversed(ast.children):
+        for group in file.comments:
+            if group.prev_end == fileset.NoPos and group.is_lead_comment:
+                return comment_text(group)
+    return ""
+
+
+def source(node, end: Optional[int] = None) -> Optional[str]:
+    """The text of the node in its file, up to the position end (by
+    default its end), None if it has no position"""
+    end = node.end if end is None else end
+    if node.pos == fileset.NoPos or end == fileset.NoPos:
+        return None
+    file = fileset.fset.file(node.pos)
+    return utils.read_source(file.name)[file.offset(node.pos):file.offset(end)].rstrip()
+
+
+def columns(rows: List[List[str]]) -> List[str]:
+    """The cells of the rows aligned in columns, like gofmt aligns the
+    specs of a group, the empty columns are left out"""
+    widths = [max(len(row[i]) for row in rows) for i in range(len(rows[0]))]
+    lines = []
+    for row in rows:
+        cells = [cell.ljust(width) for cell, width in zip(row, widths) if width]
+        lines.append(" ".join(cells).rstrip())
+    return lines
+
+
+def spec(obj: checker.Object) -> List[str]:
+    """The name, the type and the value of a constant or a variable"""
+    if obj.kind == "const":
+        c = obj.constant
+        untyped = c is not None and c.is_untyped
+        type_ = "" if untyped or obj.type_ is None else checker.type_string(obj.type_)
+        return [obj.name, type_, "" if c is None else f"= {c}"]
+    return [obj.name, checker.type_string(obj.type_) if obj.type_ is not None else ""]
+
+
+def value_decl(objects: List[checker.Object], group: bool) -> str:
+    """The declaration of the constants or the variables, of a group
+    (parenthesized) if group"""
+    keyword = objects[0].kind
+    lines = columns([spec(obj) for obj in objects])
+    if not group:
+        return f"{keyword} {lines[0]}"
+    return "\n".join([f"{keyword} ("] + ["\t" + line for line in lines] + [")"])
+
+
+def func_decl(obj: checker.Object) -> str:
+    """The declaration of a function or a method, without its body"""
+    decl = obj.decl
+    text = None
+    if isinstance(decl, syntree.Function):
+        text = source(decl, decl.body.pos if decl.body is not None else None)
+    return text or checker.object_string(obj)
+
+
+def type_decl(obj: checker.Object) -> str:
+    text = source(obj.decl) if isinstance(obj.decl, syntree.TypeDef) else None
+    return f"type {text}" if text else checker.object_string(obj)
+
+
+class Documenter:
+
+    def __init__(self, package, info: checker.Info, unexported: bool):
+        self.package = package
+        self.info = info
+        self.unexported = unexported
+        # the Decls of the types of the package, by the id of their type
+        self.types = {}
+
+    def shown(self, obj: checker.Object) -> bool:
+        return self.unexported or is_exported(obj.name)
+
+    def document(self) -> Package:
+        package = self.package
+        doc = Package(package.name, package.path, package_doc(package.ast))
+        objects = [obj for obj in scopes.declarations(package.scope, self.info)
+                   if obj.kind != "package"]
+        for obj in objects:
+            if obj.kind == "type" and self.shown(obj):
+                decl = Decl([obj], type_decl(obj), comment_text(syntree.doc_comment(obj.decl)))
+                self.types[id(obj.type_)] = decl
+                doc.types.append(decl)
+        for decl in self.values(objects):
+            owner = self.owner([obj.type_ for obj in decl.objects])
+            if decl.objects[0].kind == "const":
+                (doc.consts if owner is None else owner.consts).append(decl)
+            else:
+                (doc.vars if owner is None else owner.vars).append(decl)
+        for obj in objects:
+            if obj.kind != "func" or not self.shown(obj):
+                continue
+            decl = Decl([obj], func_decl(obj), comment_text(syntree.doc_comment(obj.decl)))
+            if isinstance(obj.decl, syntree.Method):
+                owner = self.types.get(id(obj.decl.base_type))
+                if owner is not None:
+                    owner.methods.append(decl)
+                continue
+            owner = None
+            if isinstance(obj.type_, syntree.FunctionType) and results(obj.type_.signature):
+                owner = self.owner([results(obj.type_.signature)[0]])
+            (doc.funcs if owner is None else owner.funcs).append(decl)
+        for decls in [doc.funcs, doc.types] + [d.funcs for d in doc.types] \
+                + [d.methods for d in doc.types]:
+            decls.sort(key=lambda decl: decl.objects[0].name)
+        return doc
+
+    def values(self, objects: List[checker.Object]) -> List[Decl]:
+        """The Decls of the constants and the variables, one for each
+        declaration (a group has the ones shown)"""
+        decls = []
+        groups = {}
+        for obj in objects:
+            if obj.kind not in ("const", "var") or not self.shown(obj):
+                continue
+            group = getattr(obj.decl, "_group", None)
+            if group is not None and group.parenthesized and id(group) in groups:
+                groups[id(group)].objects.append(obj)
+                continue
+            parenthesized = group is not None and group.parenthesized
+            doc = comment_text(group.doc if parenthesized else syntree.doc_comment(obj.decl))
+            decl = Decl([obj], "", doc, group=parenthesized)
+            if parenthesized:
+                groups[id(group)] = decl
+            decls.append(decl)
+        for decl in decls:
+            decl.text = value_decl(decl.objects, decl.group)
+        return decls
+
+    def owner(self, types: list) -> Optional[Decl]:
+        """The Decl of the type of the package all the types are (or are
+        pointers to), if there is one"""
+        owners = set()
+        for type_ in types:
+            if isinstance(type_, syntree.Pointer):
+                type_ = type_.base
+            owners.add(id(type_))
+        if len(owners) != 1:
+            return None
+        return self.types.get(owners.pop())
+
+
+def document(package, info: checker.Info, unexported: bool = False) -> Package:
+    """The documentation of the package checked with info, its unexported
+    declarations too if unexported"""
+    return Documenter(package, info, unexported).document()
+
+
+def sections(doc: Package) -> list:
+    return [("Constants", doc.consts), ("Variables", doc.vars),
+            ("Functions", doc.funcs), ("Types", doc.types)]
+
+
+def members(decl: Decl) -> List[Decl]:
+    """What is listed with a type, in order"""
+    return decl.consts + decl.vars + decl.funcs + decl.methods
+
+
+def text(doc: Package) -> str:
+    """The documentation as go doc prints it"""
+    out = [f"package {doc.name}" + (f' // import "{doc.path}"' if doc.name != "main" else ""), ""]
+    if doc.doc:
+        out += [doc.doc, ""]
+
+    def item(decl: Decl):
+        out.append(decl.text)
+        if decl.doc:
+            out.extend(("    " + line).rstrip() for line in decl.doc.split("\n"))
+        out.append("")
+
+    for title, decls in sections(doc):
+        if not decls:
+            continue
+        out += [title.upper(), ""]
+        for decl in decls:
+            item(decl)
+            for member in members(decl):
+                item(member)
+    return "\n".join(out).rstrip() + "\n"
+
+
+def paragraphs(doc: str) -> List[tuple]:
+    """The paragraphs of a doc comment, (code, lines): the indented ones
+    are code, like in the doc comments of Go"""
+    blocks = []
+    lines: List[str] = []
+    for line in doc.split("\n") + [""]:
+        if line.strip():
+            lines.append(line)
+            continue
+        if lines:
+            code = all(printer.indented(line) for line in lines)
+            blocks.append((code, printer.unindent(lines) if code else lines))
+            lines = []
+    return blocks
+
+
+def markdown(doc: Package) -> str:
+    """The documentation in Markdown, a heading for each declaration"""
+    out = [f"# package {doc.name}", ""]
+    if doc.name != "main":
+        out += [f'`import "{doc.path}"`', ""]
+
+    def item(decl: Decl, level: str, title: str):
+        out.extend([f"{level} {title}", "", "```go", decl.text, "```", ""])
+        for code, lines in paragraphs(decl.doc):
+            out.extend((["```"] + lines + ["```"]) if code else lines)
+            out.append("")
+
+    for code, lines in paragraphs(doc.doc):
+        out.extend((["```"] + lines + ["```"]) if code else lines)
+        out.append("")
+    for title, decls in sections(doc):
+        if not decls:
+            continue
+        out += [f"## {title}", ""]
+        for decl in decls:
+            item(decl, "###", heading(decl))
+            for member in members(decl):
+                item(member, "####", heading(member))
+    return "\n".join(out).rstrip() + "\n"
+
+
+def heading(decl: Decl) -> str:
+    """The title of a declaration, like func (Grid) String"""
+    obj = decl.objects[0]
+    if obj.kind == "func" and isinstance(obj.decl, syntree.Method):
+        return f"func ({checker.type_string(obj.decl.receiver_type)}) {obj.name}"
+    return f"{obj.kind} " + ", ".join(o.name for o in decl.objects)
+
+
+def html_page(doc: Package) -> str:
+    """The documentation as an HTML page"""
+    e = html.escape
+    out = ["<!DOCTYPE html>", "<html>", "<head>", '<meta charset="utf-8">',
+           f"<title>package {e(doc.name)}</title>", "</head>", "<body>",
+           f"<h1>package {e(doc.name)}</h1>"]
+    if doc.name != "main":
+        out.append(f'<p><code>import "{e(doc.path)}"</code></p>')
+
+    def comment(text: str):
+        for code, lines in paragraphs(text):
+            body = e("\n".join(lines))
+            out.append(f"<pre>{body}</pre>" if code else f"<p>{body}</p>")
+
+    def item(decl: Decl, tag: str):
+        out.append(f'<{tag} id="{e(anchor(decl))}">{e(heading(decl))}</{tag}>')
+        out.append(f"<pre>{e(decl.text)}</pre>")
+        comment(decl.doc)
+
+    comment(doc.doc)
+    for title, decls in sections(doc):
+        if not decls:
+            continue
+        out.append(f"<h2>{title}</h2>")
+        for decl in decls:
+            item(decl, "h3")
+            for member in members(decl):
+                item(member, "h4")
+    out += ["</body>", "</html>"]
+    return "\n".join(out) + "\n"
+
+
+def anchor(decl: Decl) -> str:
+    """The id of a declaration in the page, like Grid.String for a method"""
+    obj = decl.objects[0]
+    if obj.kind == "func" and isinstance(obj.decl, syntree.Method):
+        return f"{checker.type_string(obj.decl.base_type)}.{obj.name}"
+    return obj.name
+
+
+# the formats of go_parser.py doc --format
+formats = {"text": text, "markdown": markdown, "html": html_page}
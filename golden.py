@@ -0,0 +1,273 @@
+import os
+import re
+import sys
+import json
+import shlex
+import argparse
+import difflib
+import subprocess
+
+from dataclasses import dataclass
+from typing import List, Optional, Tuple
+
+
+# The golden files of the parser and of the type checker: for each input of
+# table, the AST dump of its packages (go_parser.py --ast text) and the
+# diagnostics reported (go_parser.py --diagnostics=json, written a line
+# each) are compared with the ones of tests/golden, NAME.ast and
+# NAME.diagnostics. A change of the output of either one shows as a diff,
+# and -update writes the golden files again once the change is the one
+# wanted (review them with git diff). Each input is checked by go_parser.py
+# in a subprocess, with the flags of its case, so the state of the parser
+# is fresh. It is checked again with its files lexed by the worker
+# processes of go_parser.lex_files, however few they are: the outputs must
+# be the ones of the files lexed by the parser. The values of the
+# expressions of expressions, evaluated by expr.py, are compared with
+# tests/golden/expressions.txt too, and the edits of the renamings of
+# renames with tests/golden/renames.txt.
+#
+#   python golden.py
+#   python golden.py -update -run errors
+
+here = os.path.dirname(os.path.abspath(__file__))
+golden_dir = os.path.join("tests", "golden")
+# the environment of go_parser.py lexing the files with its workers
+workers_env = dict(os.environ, GOPY_JOBS="2", GOPY_PARALLEL_FILES="1",
+                   GOPY_PARALLEL_SIZE="1")
+
+
+@dataclass
+class Case:
+    """An input (a .go file or the directory of a program), checked with
+    the flags of go_parser.py given. Its diagnostics are compared, and its
+    AST dump too if ast. name is the one of its golden files, the name of
+    the input by default"""
+
+    path: str
+    flags: Tuple[str, ...] = ()
+    ast: bool = False
+    name: Optional[str] = None
+
+    @property
+    def golden_name(self) -> str:
+        return self.name or os.path.splitext(os.path.basename(os.path.normpath(self.path)))[0]
+
+
+table = [
+    # the declarations and the statements the parser builds
+    Case("tests/const_declarations.go", ast=True),
+    Case("tests/var_declarations.go", ast=True),
+    Case("tests/type_decls.go", ast=True),
+    Case("tests/struct.go", ast=True),
+    Case("tests/function.go", ast=True),
+    Case("tests/if.go", ast=True),
+    Case("tests/for.go", ast=True),
+    Case("tests/switch.go", ast=True),
+    Case("tests/labels.go", ast=True),
+    # the nodes of the parts the parser recovers from
+    Case("tests/syntax_errors.go", ast=True),
+    Case("tests/malformed_decls.go", ast=True),
+    # the errors of the type checker
+    Case("tests/assign_ops_errors.go"),
+    Case("tests/builtins_errors.go"),
+    Case("tests/const_cycles_errors.go"),
+    Case("tests/const_declarations_errors.go"),
+    Case("tests/conversions_errors.go"),
+    Case("tests/embedded_errors.go"),
+    Case("tests/errors_errors.go"),
+    Case("tests/init_cycles_errors.go"),
+    Case("tests/interface_values_errors.go"),
+    Case("tests/labels_errors.go"),
+    Case("tests/range_errors.go"),
+    Case("tests/short_var_decl_errors.go"),
+    Case("tests/type_switch_errors.go"),
+    Case("tests/variadic_errors.go"),
+    Case("tests/func_call_check_err.go"),
+    Case("tests/type_check.go"),
+    Case("tests/wrong.go"),
+    Case("tests/packages"),
+    Case("tests/import_errors"),
+    Case("tests/module_errors"),
+    Case("tests/lang_errors.go", ("-lang=go1.17",)),
+    Case("tests/lang_errors.go", ("-lang=go1.21",), name="lang_errors_go1.21"),
+    Case("tests/lang_module"),
+    Case("tests/permissive.go", ("--permissive",)),
+    # and its warnings
+    Case("tests/warnings.go", ("--warnings",)),
+    Case("tests/terminating_errors.go", ("--warnings",)),
+]
+
+
+# the expressions evaluated by expr.py (see expr.eval_expr), with its
+# flags: what it prints for each one (its value and its type, or its
+# errors) is compared with tests/golden/expressions.txt, after the command
+expressions = [
+    ("1 << 100 >> 98",),
+    ("1 << 62",),
+    # the untyped constants have to fit in their default type
+    ("1 << 100",),
+    ("1e400",),
+    ("1 << 63",),
+    ("-var", "n int 3", "n + 1<<70"),
+    # the evaluations running too long are aborted
+    ("-max-steps=1000", "func() int { for {} }()"),
+    ("-import", "strings", "func() int { return len(strings.Repeat(\"ab\", 3)) }()"),
+]
+
+
+# the renamings of go_parser.py rename (see rename.py), a position and a
+# name: the edits it prints for each one, or why the name is refused, are
+# compared with tests/golden/renames.txt
+renames = [
+    ("tests/rename.go:11:2", "Size"),
+    ("tests/rename.go:29:3", "total"),
+    # init and main are the names of the functions the program runs, the
+    # methods and the local variables can have them
+    ("tests/rename.go:10:6", "init"),
+    ("tests/rename.go:10:6", "main"),
+    ("tests/rename.go:15:17", "init"),
+    ("tests/rename.go:27:6", "main"),
+]
+
+
+def commands_text(script: str, commands: List[Tuple[str, ...]]) -> str:
+    """What the script prints for each of the commands (its arguments),
+    stdout and stderr"""
+    lines = []
+    for args in commands:
+        done = subprocess.run([sys.executable, os.path.join(here, script.split()[0]),
+                               *script.split()[1:], *args],
+                              capture_output=True, cwd=here, timeout=300)
+        lines.append(f"$ {script} {shlex.join(args)}")
+        lines.extend((done.stdout + done.stderr).decode("utf-8", "surrogateescape").splitlines())
+    return "".join(line + "\n" for line in lines)
+
+
+def go_parser(case: Case, *flags: str, env: Optional[dict] = None) -> str:
+    """What go_parser.py prints to stdout for the input of the case"""
+    done = subprocess.run([sys.executable, os.path.join(here, "go_parser.py"), *flags,
+                           *case.flags, case.path], capture_output=True, cwd=here, timeout=300,
+                          env=env)
+    return done.stdout.decode("utf-8", "surrogateescape")
+
+
+def location(d: dict) -> str:
+    parts = [d["file"] or "-"]
+    if d["line"] is not None:
+        parts.append(str(d["line"]))
+        if d["column"] is not None:
+            parts.append(str(d["column"]))
+    return ":".join(parts)
+
+
+def diagnostics_text(diagnostics: List[dict]) -> str:
+    """The diagnostics a line each, like file:line:column: severity:
+    message [code], with their notes and their fix indented below"""
+    lines = []
+    for d in diagnostics:
+        code = f" [{d['code']}]" if d["code"] else ""
+        lines.append(f"{location(d)}: {d['severity']}: {d['message']}{code}")
+        for note in d["notes"]:
+            lines.append(f"\t{location(note)}: note: {note['message']}")
+        if d["fix"] is not None:
+            lines.append(f"\tfix: {d['fix']['message']}: {json.dumps(d['fix']['new_text'])}")
+    return "".join(line + "\n" for line in lines)
+
+
+def outputs(case: Case, env: Optional[dict] = None) -> List[Tuple[str, str]]:
+    """The (golden file, output) of the case"""
+    found = []
+    if case.ast:
+        found.append((f"{case.golden_name}.ast", go_parser(case, "--ast", "text", env=env)))
+    diagnostics = json.loads(go_parser(case, "--diagnostics=json", env=env) or "[]")
+    found.append((f"{case.golden_name}.diagnostics", diagnostics_text(diagnostics)))
+    return found
+
+
+def read(path: str) -> Optional[str]:
+    try:
+        with open(path, "rt", encoding="utf-8", errors="surrogateescape", newline="") as f:
+            return f.read()
+    except FileNotFoundError:
+        return None
+
+
+def diff(expected: str, got: str, name: str, limit: int = 40,
+         labels: Tuple[str, str] = ("golden", "got")) -> List[str]:
+    lines = list(difflib.unified_diff(expected.splitlines(), got.splitlines(),
+                                      f"{name} ({labels[0]})", f"{name} ({labels[1]})",
+                                      lineterm=""))
+    if len(lines) > limit:
+        lines = lines[:limit] + [f"... {len(lines) - limit} more lines"]
+    return lines
+
+
+def main(argv: List[str]) -> int:
+    arg_parser = argparse.ArgumentParser(
+        prog="golden.py",
+        description="Compares the AST dumps and the diagnostics of the inputs of the "
+                    "table with their golden files")
+    arg_parser.add_argument("-update", action="store_true",
+                            help="writes the golden files with the outputs instead")
+    arg_parser.add_argument("-run", metavar="REGEXP",
+                            help="only the inputs whose path or golden name match")
+    args = arg_parser.parse_args(argv)
+
+    cases = [case for case in table if args.run is None
+             or re.search(args.run, case.path) or re.search(args.run, case.golden_name)]
+    failed = 0
+    for case in cases:
+        mismatches = []
+        found = outputs(case)
+        for name, got in found:
+            path = os.path.join(here, golden_dir, name)
+            expected = read(path)
+            if expected == got:
+                continue
+            if args.update:
+                os.makedirs(os.path.dirname(path), exist_ok=True)
+                with open(path, "wt", encoding="utf-8", errors="surrogateescape",
+                          newline="") as f:
+                    f.write(got)
+                print(f"wrote {os.path.join(golden_dir, name)}")
+                continue
+            mismatches.append(name)
+            print(f"--- FAIL: {case.path} ({name})")
+            if expected is None:
+                print(f"    no golden file {os.path.join(golden_dir, name)}, run with -update")
+                continue
+            print("\n".join("    " + line for line in diff(expected, got, name)))
+        if not args.update:
+            for (name, got), (_, lexed) in zip(found, outputs(case, workers_env)):
+                if lexed != got:
+                    mismatches.append(name)
+                    print(f"--- FAIL: {case.path} ({name}, lexed by the workers)")
+                    lines = diff(got, lexed, name, labels=("parser", "workers"))
+                    print("\n".join("    " + line for line in lines))
+        if mismatches:
+            failed += 1
+    inputs = len(cases)
+    for name, script, commands in [("expressions", "expr.py", expressions),
+                                   ("renames", "go_parser.py rename", renames)]:
+        if args.run is not None and not re.search(args.run, name):
+            continue
+        inputs += 1
+        path = os.path.join(here, golden_dir, f"{name}.txt")
+        expected, got = read(path), commands_text(script, commands)
+        if args.update and expected != got:
+            with open(path, "wt", encoding="utf-8", newline="") as f:
+                f.write(got)
+            print(f"wrote {os.path.join(golden_dir, name + '.txt')}")
+        elif expected != got:
+            failed += 1
+            print(f"--- FAIL: {name} ({name}.txt)")
+            print("\n".join("    " + line for line in diff(expected or "", got,
+                                                            f"{name}.txt")))
+    if args.update:
+        return 0
+    print(f"FAIL ({failed} of {inputs} inputs)" if failed else f"ok ({inputs} inputs)")
+    return 1 if failed else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
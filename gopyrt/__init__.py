@@ -0,0 +1,639 @@
+from __future__ import annotations
+
+import sys
+import math as _math  # gopyrt.math is the math package of Go (gopyrt/math.py)
+import random
+import struct
+import functools
+
+from typing import Any, Callable, Dict, Generic, List, Optional, TypeVar
+
+
+# The runtime of the Python modules generated by pygen.py (gopy build
+# --target=python), for the semantics of Go the generated code can't get
+# from plain Python: integers wrapping around, division truncated towards
+# zero, slices sharing their arrays, maps giving the zero value of missing
+# keys, and defer, panic and recover. The modules import it as go.
+
+
+# integers, the results of + - * << and the like are wrapped to the size of
+# their type once they are used (a ring operation and then the wrap is the
+# same as wrapping every intermediate result)
+
+def _signed(size: int) -> Callable[[int], int]:
+    def wrap(x: int) -> int:
+        x &= (1 << size) - 1
+        return x - (1 << size) if x >> (size - 1) else x
+    return wrap
+
+
+def _unsigned(size: int) -> Callable[[int], int]:
+    def wrap(x: int) -> int:
+        return x & ((1 << size) - 1)
+    return wrap
+
+
+int8, int16, int32, int64 = (_signed(size) for size in (8, 16, 32, 64))
+uint8, uint16, uint32, uint64 = (_unsigned(size) for size in (8, 16, 32, 64))
+builtins_int = type(0)
+# int and uint are 64 bits wide, byte and rune are aliases (the builtin
+# int of python is builtins_int)
+int = int64
+uint = uint64
+byte = uint8
+rune = int32
+
+
+def float32(x: float) -> "Float32":
+    """x rounded to the nearest float32"""
+    try:
+        return Float32(struct.unpack("f", struct.pack("f", x))[0])
+    except OverflowError:
+        return Float32(_math.copysign(_math.inf, x))
+
+
+class Float32(float):
+    """A float32 value, which fmt formats with the shortest representation
+    of a float32. The operations on them give floats, the code rounds
+    them back with float32"""
+
+
+class Int(builtins_int):
+    """An integer value of a sized type (like a rune or a byte) passed to
+    fmt, which %T prints with the name of its type"""
+
+    def __new__(cls, value: int, typename: str) -> "Int":
+        self = super().__new__(cls, value)
+        self.typename = typename
+        return self
+
+
+class Complex64(complex):
+    """A complex64 value, its parts are formatted like float32 values"""
+
+
+class Named:
+    """A value of a named type which isn't a struct passed to fmt, with the
+    class of the methods of its type (they are called like T.m(x)), so
+    fmt calls its String or Error method"""
+
+    __slots__ = ("value", "methods")
+
+    def __init__(self, value, methods):
+        self.value = value
+        self.methods = methods
+
+
+def complex64(x: complex) -> Complex64:
+    return Complex64(float32(x.real), float32(x.imag))
+
+
+def div(x, y):
+    """x / y for integers, truncated towards zero"""
+    if y == 0:
+        raise runtime_error("integer divide by zero")
+    q = abs(x) // abs(y)
+    return q if (x < 0) == (y < 0) else -q
+
+
+def mod(x, y):
+    """x % y for integers, it has the sign of x"""
+    return x - div(x, y) * y
+
+
+def fdiv(x, y):
+    """x / y for floats and complex numbers, dividing by zero gives an infinity or NaN"""
+    try:
+        return x / y
+    except ZeroDivisionError:
+        if isinstance(x, complex) or isinstance(y, complex):
+            return complex(_math.nan, _math.nan)
+        if x == 0 or _math.isnan(x):
+            return _math.nan
+        return _math.copysign(_math.inf, x) * _math.copysign(1, y)
+
+
+def fmin(*values):
+    """min of floats, a NaN if one of them is and -0.0 is less than 0.0"""
+    if any(_math.isnan(x) for x in values):
+        return _math.nan
+    result = min(values)
+    return -0.0 if result == 0 and any(_math.copysign(1, x) < 0 for x in values if x == 0) else result
+
+
+def fmax(*values):
+    if any(_math.isnan(x) for x in values):
+        return _math.nan
+    result = max(values)
+    return 0.0 if result == 0 and any(_math.copysign(1, x) > 0 for x in values if x == 0) else result
+
+
+def shl(x, n):
+    """x << n for a count which isn't a constant"""
+    if n < 0:
+        raise runtime_error("negative shift amount")
+    # the result is wrapped afterwards, so larger counts give 0
+    return x << min(n, 64)
+
+
+def shr(x, n):
+    if n < 0:
+        raise runtime_error("negative shift amount")
+    return x >> min(n, 64)
+
+
+# panics
+
+class Panic(Exception):
+    """A panic, value is the value given to panic"""
+
+    def __init__(self, value: Any):
+        super().__init__(value)
+        self.value = value
+
+
+class RuntimeError_:
+    """The value of a runtime panic, like an index out of range (it is
+    the runtime.Error of Go, the name doesn't hide the Python one)"""
+
+    def __init__(self, message: str):
+        self.message = message
+
+    def Error(self) -> str:
+        return "runtime error: " + self.message
+
+    def __str__(self):
+        return self.Error()
+
+
+def runtime_error(message: str) -> Panic:
+    return Panic(RuntimeError_(message))
+
+
+def panic(value: Any):
+    raise Panic(value)
+
+
+class _Frame:
+    """A call of a function which defers calls"""
+
+    def __init__(self):
+        self.defers: List[tuple] = []
+        self.panic: Optional[Panic] = None
+
+
+_frames: List[_Frame] = []
+
+
+def defer(fn: Callable, *args):
+    """Defers the call of fn with args (evaluated now) to the return of
+    the function being run, which has to be decorated with deferring"""
+    _frames[-1].defers.append((fn, args))
+
+
+def _run_defers(frame: _Frame):
+    # last in first out, a panic in a deferred call replaces the one before
+    while frame.defers:
+        fn, args = frame.defers.pop()
+        try:
+            fn(*args)
+        except Panic as p:
+            frame.panic = p
+
+
+def deferring(fn: Optional[Callable] = None, *, zero: Any = None):
+    """Decorator of the functions with defer statements, it runs the calls
+    they defer when they return or panic. zero is the result of a call
+    whose panic is stopped by recover"""
+    if fn is None:
+        return lambda fn: deferring(fn, zero=zero)
+
+    @functools.wraps(fn)
+    def call(*args):
+        frame = _Frame()
+        _frames.append(frame)
+        try:
+            result = zero
+            try:
+                result = fn(*args)
+            except Exception as e:
+                frame.panic = as_panic(e)
+            _run_defers(frame)
+            if frame.panic is not None:
+                raise frame.panic
+            return result
+        finally:
+            _frames.pop()
+    return call
+
+
+def as_panic(e: Exception) -> Exception:
+    """The panic an exception of the generated code is, the python
+    ones are the errors the Go runtime would panic with"""
+    if isinstance(e, Panic):
+        return e
+    elif isinstance(e, (AttributeError, TypeError)) and "NoneType" in str(e):
+        p = runtime_error("invalid memory address or nil pointer dereference")
+    elif isinstance(e, RecursionError):
+        p = runtime_error("stack overflow")
+    elif isinstance(e, ZeroDivisionError):
+        p = runtime_error("integer divide by zero")
+    else:
+        raise e
+    # it panics where the python error is raised, for its stack trace
+    return p.with_traceback(e.__traceback__)
+
+
+def recover() -> Any:
+    """The value of the panic being stopped, when called by a deferred call
+    (not by a function it calls), None otherwise"""
+    caller = sys._getframe(2)
+    # a deferred function with defers of its own is called by deferring
+    if caller.f_code is _call_code:
+        caller = caller.f_back
+    if caller is None or caller.f_code is not _run_defers.__code__:
+        return None
+    frame = caller.f_locals["frame"]
+    if frame.panic is None:
+        return None
+    value = frame.panic.value
+    frame.panic = None
+    return value
+
+
+_call_code = deferring(lambda: None).__code__
+
+
+def run(main: Callable):
+    """Runs the main function, a panic ends the program like in Go"""
+    try:
+        try:
+            main()
+        except Exception as e:
+            raise as_panic(e)
+    except Panic as p:
+        from gopyrt import fmt
+        value = p.value
+        text = value.Error() if callable(getattr(value, "Error", None)) else fmt.format_value(value)
+        sys.stdout.flush()
+        print(f"panic: {text}\n\ngoroutine 1 [running]:\n{stack_trace(p.__traceback__)}",
+              file=sys.stderr)
+        sys.exit(2)
+
+
+# the frames of a stack trace printed at most, like the runtime of Go
+_max_frames = 100
+
+
+def stack_trace(tb) -> str:
+    """The Go stack trace of a panic from its python traceback: the frames
+    of the functions of the generated modules, with the Go file and line
+    of their __gopy_lines__ (see pygen.Generator.source_map). The frames of
+    the runtime are left out, like the ones of the natives of gopy run"""
+    entries = []
+    while tb is not None:
+        entries.append(tb)
+        tb = tb.tb_next
+    frames: List[str] = []
+    # the line in the body of a function with defers and named results
+    # (its def is the one of the Go function)
+    inner = None
+    for tb in reversed(entries):
+        names = tb.tb_frame.f_globals
+        if "__gopy_lines__" not in names:
+            continue
+        where = names["__gopy_lines__"].get(tb.tb_lineno)
+        func = names["__gopy_funcs__"].get(tb.tb_frame.f_code.co_firstlineno)
+        if func is None:
+            inner = inner or where
+            continue
+        file, line = inner or where or names["__gopy_lines__"][tb.tb_frame.f_code.co_firstlineno]
+        inner = None
+        frames.append(f"{func}\n\t{names['__gopy_files__'][file]}:{line}")
+    if len(frames) > _max_frames:
+        frames[_max_frames:] = ["...additional frames elided..."]
+    return "\n".join(frames) or "main.main()"
+
+
+# values
+
+def copy(value: Any) -> Any:
+    """The value as it is assigned, structs and arrays are copied"""
+    if isinstance(value, (Struct, Array)):
+        return value.copy()
+    return value
+
+
+class Struct:
+    """Base of the classes of struct types, _fields are the names of the
+    fields in order"""
+
+    _fields: tuple = ()
+    __slots__ = ()
+
+    def copy(self):
+        other = object.__new__(type(self))
+        for name in self._fields:
+            object.__setattr__(other, name, copy(getattr(self, name)))
+        return other
+
+    def set(self, other: "Struct"):
+        """*p = other, the fields of other are copied in the struct p points to"""
+        for name in self._fields:
+            setattr(self, name, copy(getattr(other, name)))
+
+    def __eq__(self, other):
+        return (type(self) is type(other)
+                and all(getattr(self, f) == getattr(other, f) for f in self._fields))
+
+    def __hash__(self):
+        return hash(tuple(getattr(self, f) for f in self._fields))
+
+    def __repr__(self):
+        from gopyrt import fmt
+        return fmt.Sprint(self)
+
+
+def check_index(i, length):
+    if not 0 <= i < length:
+        # like Go, the length isn't given for a negative index
+        raise runtime_error(f"index out of range [{i}]" if i < 0 else
+                            f"index out of range [{i}] with length {length}")
+
+
+def check_bounds(low, high, cap):
+    if not 0 <= high <= cap:
+        raise runtime_error(f"slice bounds out of range [:{high}] with capacity {cap}")
+    if not 0 <= low <= high:
+        raise runtime_error(f"slice bounds out of range [{low}:{high}]")
+
+
+# the types of the elements (and of the keys) of the arrays, the slices and
+# the maps, for the stubs of gopy export, like go.Slice[int]
+_T = TypeVar("_T")
+_K = TypeVar("_K")
+
+
+class Array(List[_T]):
+    """An array, a list of a fixed length whose indices are checked"""
+
+    def __getitem__(self, i):
+        if isinstance(i, slice):
+            return Slice(self)[i]
+        check_index(i, len(self))
+        return list.__getitem__(self, i)
+
+    def __setitem__(self, i, value):
+        check_index(i, len(self))
+        list.__setitem__(self, i, value)
+
+    def copy(self) -> "Array":
+        return Array(copy(v) for v in self)
+
+    def slice(self, low, high, max_):
+        return Slice(self).slice(low, high, max_)
+
+    def __hash__(self):
+        return hash(tuple(self))
+
+
+class Slice(Generic[_T]):
+    """A slice, a part of an array (a python list) with a capacity.
+    The nil slice has no array"""
+
+    __slots__ = ("array", "offset", "length", "cap")
+
+    def __init__(self, array: Optional[list] = None, offset: int = 0,
+                 length: Optional[int] = None, cap: Optional[int] = None):
+        self.array = array
+        self.offset = offset
+        size = 0 if array is None else len(array)
+        self.length = size - offset if length is None else length
+        self.cap = size - offset if cap is None else cap
+
+    def is_nil(self) -> bool:
+        return self.array is None
+
+    def __len__(self):
+        return self.length
+
+    def __iter__(self):
+        # the length is the one when the loop starts, like range
+        for i in range(self.length):
+            yield self.array[self.offset + i]
+
+    def __getitem__(self, i):
+        if isinstance(i, slice):
+            return self.slice(i.start, i.stop, None)
+        check_index(i, self.length)
+        return self.array[self.offset + i]
+
+    def __setitem__(self, i, value):
+        check_index(i, self.length)
+        self.array[self.offset + i] = value
+
+    def slice(self, low, high, max_):
+        """s[low:high:max], the bounds can be None"""
+        low = 0 if low is None else low
+        high = self.length if high is None else high
+        if max_ is None:
+            check_bounds(low, high, self.cap)
+            max_ = self.cap
+        else:
+            check_bounds(low, high, max_)
+            if max_ > self.cap:
+                raise runtime_error(f"slice bounds out of range [::{max_}] with capacity {self.cap}")
+        if self.array is None:
+            return self
+        return Slice(self.array, self.offset + low, high - low, max_ - low)
+
+    def __eq__(self, other):
+        # slices can only be compared to nil
+        return self is other
+
+    __hash__ = object.__hash__
+
+    def __repr__(self):
+        from gopyrt import fmt
+        return fmt.Sprint(self)
+
+
+def make_slice(zero: Any, length: int, cap: Optional[int] = None) -> Slice:
+    """make([]T, length, cap), zero is the zero value of T (or a function
+    making it, for structs and arrays)"""
+    cap = length if cap is None else cap
+    if length < 0:
+        raise runtime_error("makeslice: len out of range")
+    if cap < length:
+        raise runtime_error("makeslice: cap out of range")
+    return Slice([zero() if callable(zero) else zero for _ in range(cap)], 0, length, cap)
+
+
+def append(s: Slice, *values) -> Slice:
+    """append(s, values...), the elements are added in the same array if
+    it has room for them, else in a new one, twice as large"""
+    if not values:
+        return s
+    n = s.length + len(values)
+    if s.array is not None and n <= s.cap:
+        for i, value in enumerate(values, s.offset + s.length):
+            s.array[i] = value
+        return Slice(s.array, s.offset, n, s.cap)
+    cap = max(2 * s.cap, n)
+    array = list(s) + list(values)
+    # the rest of the array has room for the next elements
+    array += [None] * (cap - n)
+    return Slice(array, 0, n, cap)
+
+
+def copy_slice(dst: Slice, src) -> int:
+    """copy(dst, src), src can be a string for a []byte"""
+    elements = list(src.encode()) if isinstance(src, str) else list(src)
+    n = min(len(dst), len(elements))
+    for i in range(n):
+        dst[i] = copy(elements[i])
+    return n
+
+
+def cap(x) -> int:
+    if isinstance(x, Slice):
+        return x.cap
+    return len(x)
+
+
+class Map(Dict[_K, _T]):
+    """A map, reading a missing key gives the zero value of the elements
+    (zero can be a function making it, for structs and arrays). The nil
+    map has no room for entries"""
+
+    def __init__(self, entries: Optional[dict] = None, zero: Any = None, nil: bool = False):
+        super().__init__(entries or {})
+        self.zero = zero
+        self.nil = nil
+
+    def is_nil(self) -> bool:
+        return self.nil
+
+    def __missing__(self, key):
+        return self.zero() if callable(self.zero) else self.zero
+
+    def __setitem__(self, key, value):
+        if self.nil:
+            raise Panic("assignment to entry in nil map")
+        dict.__setitem__(self, key, value)
+
+    def lookup(self, key) -> tuple:
+        """v, ok := m[key]"""
+        if key in self:
+            return dict.__getitem__(self, key), True
+        return self[key], False
+
+    def __eq__(self, other):
+        return self is other
+
+    __hash__ = object.__hash__
+
+
+# strings are python strings, their lengths and indices are the
+# ones of their UTF-8 encoding
+
+def strlen(s: str) -> int:
+    return len(s) if s.isascii() else len(s.encode())
+
+
+def byte_at(s: str, i: int) -> int:
+    data = s.encode()
+    check_index(i, len(data))
+    return data[i]
+
+
+def substr(s: str, low: Optional[int], high: Optional[int]) -> str:
+    data = s.encode()
+    low = 0 if low is None else low
+    high = len(data) if high is None else high
+    check_bounds(low, high, len(data))
+    return data[low:high].decode("utf-8", "replace")
+
+
+def keys(m: Map):
+    """The keys of a range over the map m, from a random one on like Go.
+    The entries deleted during the iteration are not reached"""
+    keys = list(m)
+    if keys:
+        start = random.randrange(len(keys))
+        keys = keys[start:] + keys[:start]
+    return (k for k in keys if k in m)
+
+
+def items(m: Map):
+    """The (key, element) pairs of a range over the map m"""
+    return ((k, dict.__getitem__(m, k)) for k in keys(m))
+
+
+def runes(s: str):
+    """The (index, rune) pairs of a range over a string"""
+    i = 0
+    for c in s:
+        yield i, ord(c)
+        i += len(c.encode())
+
+
+def string(x) -> str:
+    """string(x) of a rune or a []byte"""
+    if isinstance(x, builtins_int):
+        valid = 0 <= x <= 0x10FFFF and not 0xD800 <= x <= 0xDFFF
+        return chr(x if valid else 0xFFFD)
+    return bytes(x).decode("utf-8", "replace")
+
+
+def string_of_runes(runes) -> str:
+    """string(r) of a []rune, the runes which aren't valid are U+FFFD"""
+    return "".join(map(string, runes))
+
+
+def bytes_of(s: str) -> Slice:
+    return Slice(list(s.encode()))
+
+
+def runes_of(s: str) -> Slice:
+    return Slice([ord(c) for c in s])
+
+
+# type assertions, a type is a class (for structs), the name of a
+# basic type, or the names of the methods of an interface
+
+_basic = {
+    "bool": bool, "string": str, "float64": float, "float32": Float32,
+    "complex128": complex, "complex64": Complex64,
+}
+# the float64 and complex128 values aren't the float32 and complex64 ones
+_narrow = {"float64": Float32, "complex128": Complex64}
+
+
+def has_type(x: Any, t: Any) -> bool:
+    if isinstance(t, tuple):
+        return x is not None and all(callable(getattr(x, m, None)) for m in t)
+    if isinstance(t, str):
+        if t in _basic:
+            return isinstance(x, _basic[t]) and not isinstance(x, _narrow.get(t, ()))
+        return isinstance(x, builtins_int) and not isinstance(x, bool)
+    return isinstance(x, t)
+
+
+def assert_type(x: Any, t: Any, name: str) -> Any:
+    """x.(T), name is T in Go"""
+    if not has_type(x, t):
+        from gopyrt import fmt
+        if x is None:
+            raise Panic(RuntimeError_(f"interface conversion: interface is nil, not {name}"))
+        raise Panic(RuntimeError_(
+            f"interface conversion: interface {{}} is {fmt.type_name(x)}, not {name}"
+        ))
+    return x
+
+
+def type_ok(x: Any, t: Any, zero: Any) -> tuple:
+    """v, ok := x.(T)"""
+    if has_type(x, t):
+        return x, True
+    return zero, False
@@ -0,0 +1,18 @@
+from typing import Any
+
+
+# The cmp package, like std/cmp/cmp.go which the interpreter and the VM
+# run. A NaN is less than any other value, and equal to a NaN
+# Ref: https://pkg.go.dev/cmp
+
+
+def Less(x: Any, y: Any) -> bool:
+    return (x != x and y == y) or x < y
+
+
+def Compare(x: Any, y: Any) -> int:
+    if x != x:
+        return 0 if y != y else -1
+    if y != y:
+        return 1
+    return -1 if x < y else 1 if x > y else 0
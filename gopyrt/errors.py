@@ -0,0 +1,47 @@
+from typing import Any
+
+import gopyrt as go
+
+
+# The errors package, like std/errors/errors.go which the interpreter and
+# the VM run. An error is compared by identity, like the pointer to the
+# errorString it is in Go
+# Ref: https://pkg.go.dev/errors
+
+
+class errorString(go.Struct):
+    _fields = ("s",)
+    __slots__ = _fields
+
+    def __init__(self, s: str = ""):
+        self.s = s
+
+    def Error(self) -> str:
+        return self.s
+
+    def __eq__(self, other):
+        return self is other
+
+    __hash__ = object.__hash__
+
+
+def New(text: str) -> errorString:
+    return errorString(text)
+
+
+def Unwrap(err: Any) -> Any:
+    unwrap = getattr(err, "Unwrap", None)
+    return unwrap() if callable(unwrap) else None
+
+
+def Is(err: Any, target: Any) -> bool:
+    if err is None or target is None:
+        return err is target
+    while err is not None:
+        if err == target:
+            return True
+        is_ = getattr(err, "Is", None)
+        if callable(is_) and is_(target):
+            return True
+        err = Unwrap(err)
+    return False
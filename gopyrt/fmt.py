@@ -0,0 +1,471 @@
+import sys
+import math
+import struct
+
+from decimal import Decimal
+from typing import Any, Callable, Optional, Tuple
+
+import gopyrt as go
+
+
+# The fmt package, the verbs of Printf are the common ones with their
+# flags. Values are formatted by their python type, the float32 and the
+# complex64 values have their own (see gopyrt.Float32 and Complex64), and
+# the integers of the other types than int have their type name (gopyrt.Int)
+# Ref: https://pkg.go.dev/fmt
+
+
+def Print(*args) -> tuple:
+    return write(Sprint(*args))
+
+
+def Println(*args) -> tuple:
+    return write(Sprintln(*args))
+
+
+def Printf(template: str, *args) -> tuple:
+    return write(Sprintf(template, *args))
+
+
+def Fprint(w: Any, *args) -> tuple:
+    return w.Write(go.bytes_of(Sprint(*args)))
+
+
+def Fprintln(w: Any, *args) -> tuple:
+    return w.Write(go.bytes_of(Sprintln(*args)))
+
+
+def Fprintf(w: Any, template: str, *args) -> tuple:
+    return w.Write(go.bytes_of(Sprintf(template, *args)))
+
+
+def Sprint(*args) -> str:
+    # spaces are added between operands when neither is a string
+    text = ""
+    for i, arg in enumerate(args):
+        if i > 0 and not isinstance(args[i - 1], str) and not isinstance(arg, str):
+            text += " "
+        text += format_value(arg)
+    return text
+
+
+def Sprintln(*args) -> str:
+    return " ".join(format_value(arg) for arg in args) + "\n"
+
+
+def write(text: str) -> tuple:
+    sys.stdout.write(text)
+    sys.stdout.flush()
+    return len(text.encode()), None
+
+
+class fmtError(go.Struct):
+    # the error made by Errorf, compared by identity like the pointer it
+    # is in Go
+    _fields = ("msg",)
+    __slots__ = _fields
+
+    def __init__(self, msg: str = ""):
+        self.msg = msg
+
+    def Error(self) -> str:
+        return self.msg
+
+    def __eq__(self, other):
+        return self is other
+
+    __hash__ = object.__hash__
+
+
+class wrapError(fmtError):
+    # the error made by Errorf with a %w verb, errors.Unwrap gives err
+    _fields = ("msg", "err")
+    __slots__ = ("err",)
+
+    def __init__(self, msg: str = "", err: Any = None):
+        super().__init__(msg)
+        self.err = err
+
+    def Unwrap(self) -> Any:
+        return self.err
+
+
+def Errorf(template: str, *args) -> fmtError:
+    wrapped: list = []
+    text = Sprintf(template, *args, wrapped=wrapped)
+    return wrapError(text, args[wrapped[0]]) if wrapped else fmtError(text)
+
+
+def format_value(value: Any, plus: bool = False, depth: int = 0,
+                 padded: Optional[Callable[[str], str]] = None) -> str:
+    """The value formatted like fmt does for the verbs v or s
+    (plus is for %+v, which shows the names of the fields). padded pads the
+    values which aren't slices, arrays, maps or structs, like fmt does for a
+    width: the elements are padded, not the brackets"""
+    leaf = padded or (lambda text: text)
+    method = string_method(value)
+    if method is not None:
+        return leaf(method())
+    if isinstance(value, go.Named):
+        return format_value(value.value, plus, depth, padded)
+    if value is None:
+        # a nil element of an interface type isn't padded (nor the nil
+        # pointers here, they are None too)
+        return "<nil>" if depth > 0 else leaf("<nil>")
+    elif isinstance(value, bool):
+        return leaf("true" if value else "false")
+    elif isinstance(value, int):
+        return leaf(str(value))
+    elif isinstance(value, go.Float32):
+        return leaf(format_float(value, 32))
+    elif isinstance(value, float):
+        return leaf(format_float(value))
+    elif isinstance(value, go.Complex64):
+        return leaf(format_complex(value, 32))
+    elif isinstance(value, complex):
+        return leaf(format_complex(value))
+    elif isinstance(value, str):
+        return leaf(value)
+    elif isinstance(value, (go.Slice, go.Array)):
+        return "[" + " ".join(format_value(e, plus, depth + 1, padded) for e in value) + "]"
+    elif isinstance(value, go.Map):
+        return "map[" + " ".join(
+            f"{format_value(k, plus, depth + 1, padded)}:"
+            f"{format_value(v, plus, depth + 1, padded)}" for k, v in sorted_entries(value)
+        ) + "]"
+    elif isinstance(value, go.Struct):
+        fields = []
+        for name in value._fields:
+            text = format_value(getattr(value, name), plus, depth + 1, padded)
+            fields.append(f"{name}:{text}" if plus else text)
+        return "{" + " ".join(fields) + "}"
+    return leaf(address(value))
+
+
+def string_method(value: Any):
+    """The Error or String method of a value, which fmt calls to format it"""
+    if isinstance(value, go.RuntimeError_):
+        return value.Error
+    if isinstance(value, go.Named):
+        for name in ("Error", "String"):
+            method = getattr(value.methods, name, None)
+            if callable(method):
+                return lambda: method(value.value)
+        return None
+    if not isinstance(value, go.Struct):
+        return None
+    for name in ("Error", "String"):
+        method = getattr(value, name, None)
+        if callable(method):
+            return method
+    return None
+
+
+def sorted_entries(m: go.Map) -> list:
+    """The entries of the map sorted by key, like fmt prints them"""
+    entries = list(m.items())
+    try:
+        return sorted(entries, key=lambda entry: sort_key(entry[0]))
+    except TypeError:
+        return entries
+
+
+def sort_key(key: Any) -> Any:
+    if isinstance(key, go.Struct):
+        return tuple(sort_key(getattr(key, f)) for f in key._fields)
+    elif isinstance(key, list):
+        return tuple(sort_key(v) for v in key)
+    elif isinstance(key, complex):
+        return key.real, key.imag
+    return key
+
+
+def address(value: Any) -> str:
+    return f"0xc{id(value) & 0xffffffffff:010x}"
+
+
+def format_float(value: float, size: int = 64, verb: str = "g", prec: int = -1) -> str:
+    """The float formatted like strconv.FormatFloat with the verb b, e, E, f,
+    g, G, x or X, with the shortest representation giving it back if prec
+    is -1 (like %v)"""
+    if math.isnan(value):
+        return "NaN"
+    if math.isinf(value):
+        return "+Inf" if value > 0 else "-Inf"
+    if verb in "EGX":
+        return format_float(value, size, verb.lower(), prec).upper()
+    if verb == "b":
+        return format_binary(value, size)
+    if verb == "x":
+        return format_hex(value, prec)
+    if prec >= 0:
+        if verb == "g":
+            return f"{value:.{max(prec, 1)}g}"
+        return f"{value:.{prec}{verb}}"
+
+    minus = "-" if math.copysign(1, value) < 0 else ""
+    digits, point = shortest(abs(value), size)
+    # the exponent of the first digit, g uses %e if it is
+    # less than -4 or at least 6 (the precision of %g)
+    exp = point - 1
+    if verb == "e" or verb == "g" and (exp < -4 or exp >= 6):
+        mantissa = digits[0] + ("." + digits[1:] if len(digits) > 1 else "")
+        return f"{minus}{mantissa}e{'-' if exp < 0 else '+'}{abs(exp):02d}"
+    if point <= 0:
+        return f"{minus}0.{'0' * -point}{digits}"
+    if point >= len(digits):
+        return minus + digits + "0" * (point - len(digits))
+    return f"{minus}{digits[:point]}.{digits[point:]}"
+
+
+def format_binary(value: float, size: int = 64) -> str:
+    """The float formatted like strconv.FormatFloat with the verb b: the
+    integer mantissa and the binary exponent, 6755399441055744p-51 is 3"""
+    mantbits, bias = (23, -127) if size == 32 else (52, -1023)
+    if size == 32:
+        bits = struct.unpack("<I", struct.pack("<f", value))[0]
+    else:
+        bits = struct.unpack("<Q", struct.pack("<d", value))[0]
+    exp, mant = bits >> mantbits & (1 << size - 1 - mantbits) - 1, bits & (1 << mantbits) - 1
+    if exp == 0:
+        exp = 1
+    else:
+        mant |= 1 << mantbits
+    exp += bias - mantbits
+    minus = "-" if bits >> size - 1 else ""
+    return f"{minus}{mant}p{'-' if exp < 0 else '+'}{abs(exp)}"
+
+
+def format_hex(value: float, prec: int = -1) -> str:
+    """The float formatted like strconv.FormatFloat with the verb x: the
+    mantissa 1.h (rounded to prec hex digits, all of them if prec is -1)
+    and the binary exponent, 0x1.8p+01 is 3"""
+    minus = "-" if math.copysign(1, value) < 0 else ""
+    mant, exp = 0, 0
+    if value != 0:
+        # the mantissa has its leading 1 at bit 60, like the one of strconv
+        m, exp = math.frexp(abs(value))
+        mant, exp = int(math.ldexp(m, 61)), exp - 1
+    if 0 <= prec < 15:
+        shift = prec * 4
+        extra = (mant << shift) & (1 << 60) - 1
+        mant >>= 60 - shift
+        if extra | mant & 1 > 1 << 59:
+            mant += 1
+        mant <<= 60 - shift
+        if mant & 1 << 61:
+            mant >>= 1
+            exp += 1
+    text = [minus, "0x", str(mant >> 60 & 1)]
+    mant = mant << 4 & (1 << 64) - 1
+    if prec < 0 and mant or prec > 0:
+        text.append(".")
+        n = 0
+        while n < prec if prec >= 0 else mant:
+            text.append("0123456789abcdef"[mant >> 60 & 15])
+            mant = mant << 4 & (1 << 64) - 1
+            n += 1
+    text.append(f"p{'-' if exp < 0 else '+'}{abs(exp):02d}")
+    return "".join(text)
+
+
+def shortest(value: float, size: int = 64) -> Tuple[str, int]:
+    """The fewest decimal digits giving the float (of size bits) back, and
+    the position of the decimal point in them (0.25 is 25 and 0)"""
+    if size == 32:
+        for n in range(1, 10):
+            text = f"{value:.{n - 1}e}"
+            if go.float32(float(text)) == value:
+                break
+    else:
+        text = repr(float(value))
+    _, digits, exponent = Decimal(text).normalize().as_tuple()
+    digits = "".join(map(str, digits))
+    return digits, len(digits) + exponent
+
+
+def format_complex(value: complex, size: int = 64) -> str:
+    imag = format_float(value.imag, size)
+    if not imag.startswith(("-", "+")):
+        imag = "+" + imag
+    return f"({format_float(value.real, size)}{imag}i)"
+
+
+def type_name(value: Any) -> str:
+    """The Go type of a value, as far as its python type tells it"""
+    if value is None:
+        return "<nil>"
+    elif isinstance(value, bool):
+        return "bool"
+    elif isinstance(value, go.Int):
+        return value.typename
+    elif isinstance(value, int):
+        return "int"
+    elif isinstance(value, go.Float32):
+        return "float32"
+    elif isinstance(value, float):
+        return "float64"
+    elif isinstance(value, go.Complex64):
+        return "complex64"
+    elif isinstance(value, complex):
+        return "complex128"
+    elif isinstance(value, str):
+        return "string"
+    elif isinstance(value, (go.Struct, go.Named)):
+        cls = value.methods if isinstance(value, go.Named) else type(value)
+        # the module of the main package is run as a script
+        return f"{'main' if cls.__module__ == '__main__' else cls.__module__}.{cls.__name__}"
+    return type(value).__name__
+
+
+def Sprintf(template: str, *args, wrapped: Optional[list] = None) -> str:
+    # for Errorf, the errors of %w verbs are formatted like %v and their
+    # indices are added to wrapped
+    text = []
+    i = 0
+    used = 0
+    while i < len(template):
+        c = template[i]
+        if c != "%":
+            text.append(c)
+            i += 1
+            continue
+        i += 1
+        flags = ""
+        while i < len(template) and template[i] in "-+# 0":
+            flags += template[i]
+            i += 1
+        width = ""
+        while i < len(template) and template[i].isdigit():
+            width += template[i]
+            i += 1
+        prec = None
+        if i < len(template) and template[i] == ".":
+            i += 1
+            prec = ""
+            while i < len(template) and template[i].isdigit():
+                prec += template[i]
+                i += 1
+            prec = int(prec or "0")
+        if i >= len(template):
+            text.append("%!(NOVERB)")
+            break
+        verb = template[i]
+        i += 1
+        if verb == "%":
+            text.append("%")
+            continue
+        if used >= len(args):
+            text.append(f"%!{verb}(MISSING)")
+            continue
+        arg = args[used]
+        used += 1
+        if verb == "w" and wrapped is not None and callable(getattr(arg, "Error", None)):
+            wrapped.append(used - 1)
+            verb = "v"
+        text.append(format_verb(arg, verb, flags, prec, int(width) if width else 0))
+    if used < len(args):
+        extra = ", ".join("<nil>" if arg is None else f"{type_name(arg)}={format_value(arg)}"
+                          for arg in args[used:])
+        text.append(f"%!(EXTRA {extra})")
+    return "".join(text)
+
+
+def format_verb(value: Any, verb: str, flags: str, prec: Optional[int], width: int = 0) -> str:
+    """The operand formatted with the verb, padded to width: the elements
+    of slices, arrays, maps and structs are, one by one, like fmt does"""
+    def padded(text: str) -> str:
+        return pad(text, width, flags, verb)
+
+    if verb == "T":
+        return padded(type_name(value))
+    if verb in "qxX" and string_method(value) is not None:
+        # the string given by the Error or String method is formatted
+        return format_verb(string_method(value)(), verb, flags, prec, width)
+    if isinstance(value, go.Named) and verb not in "vs":
+        # the String method is only called for the verbs v and s
+        value = value.value
+    is_int = isinstance(value, int) and not isinstance(value, bool)
+    if verb == "v":
+        if isinstance(value, float) and prec is not None:
+            return padded(format_float(value, 64, "g", prec))
+        return format_value(value, plus="+" in flags, padded=padded)
+    elif verb == "p" and isinstance(value, (go.Struct, go.Slice, go.Map)):
+        return padded(address(value))
+
+    if is_int and verb in "dboxXcqU":
+        sign = "+" if "+" in flags else (" " if " " in flags else "")
+        if verb == "c":
+            return padded(chr(value) if 0 <= value <= 0x10FFFF else "�")
+        elif verb == "q":
+            return padded("'" + (chr(value) if 0 <= value <= 0x10FFFF else "�") + "'")
+        elif verb == "U":
+            return padded(f"U+{value:04X}")
+        digits = format(abs(value), {"d": "d", "b": "b", "o": "o", "x": "x", "X": "X"}[verb])
+        if "#" in flags and verb in "xXo":
+            digits = {"x": "0x", "X": "0X", "o": "0"}[verb] + digits
+        return padded(("-" if value < 0 else sign) + digits)
+    elif isinstance(value, float) and verb in "eEfFgGxX":
+        sign = ("+" if "+" in flags else " " if " " in flags else "") if value >= 0 else ""
+        if verb in "gGxX" and prec is None:
+            text = format_float(value, 32 if isinstance(value, go.Float32) else 64, verb)
+        else:
+            text = format_float(value, 64, "f" if verb == "F" else verb,
+                                6 if prec is None else prec)
+        return padded(sign + text)
+    elif isinstance(value, bool) and verb == "t":
+        return padded("true" if value else "false")
+    elif isinstance(value, str) and verb in "sqxX":
+        if prec is not None:
+            value = value[:prec]
+        if verb == "s":
+            return padded(value)
+        elif verb == "q":
+            return padded(quote(value))
+        return padded(hex_bytes(value.encode(), verb, flags))
+    elif verb == "s" and (string_method(value) is not None or isinstance(value, go.Struct)):
+        return format_value(value, padded=padded)
+    elif isinstance(value, (go.Slice, go.Array)):
+        # the verb is the one of each element
+        return "[" + " ".join(format_verb(e, verb, flags, prec, width) for e in value) + "]"
+    elif value is None:
+        return padded(f"%!{verb}(<nil>)")
+    return padded(f"%!{verb}({type_name(value)}={format_value(value)})")
+
+
+def hex_bytes(value: bytes, verb: str, flags: str) -> str:
+    """The bytes in hexadecimal for %x and %X, spaced by the flag ' ' and
+    prefixed with 0x by the flag '#' (each of them if they are spaced)"""
+    digits = [f"{b:02x}" if verb == "x" else f"{b:02X}" for b in value]
+    prefix = ("0x" if verb == "x" else "0X") if "#" in flags and value else ""
+    if " " in flags:
+        return " ".join(prefix + d for d in digits)
+    return prefix + "".join(digits)
+
+
+def quote(s: str) -> str:
+    """s as a double quoted Go string literal, like strconv.Quote"""
+    escapes = {"\a": "\\a", "\b": "\\b", "\f": "\\f", "\n": "\\n", "\r": "\\r",
+               "\t": "\\t", "\v": "\\v", "\\": "\\\\", '"': '\\"'}
+    text = []
+    for c in s:
+        if c in escapes:
+            text.append(escapes[c])
+        elif c.isprintable():
+            text.append(c)
+        elif ord(c) < 0x10000:
+            text.append(f"\\u{ord(c):04x}" if ord(c) > 0xFF else f"\\x{ord(c):02x}")
+        else:
+            text.append(f"\\U{ord(c):08x}")
+    return '"' + "".join(text) + '"'
+
+
+def pad(text: str, width: int, flags: str, verb: str) -> str:
+    if len(text) >= width:
+        return text
+    if "-" in flags:
+        return text + " " * (width - len(text))
+    if "0" in flags and verb in "dboxXeEfFgG":
+        sign = text[0] if text[:1] in ("-", "+") else ""
+        return sign + "0" * (width - len(text)) + text[len(sign):]
+    return " " * (width - len(text)) + text
@@ -0,0 +1,25 @@
+from typing import Any, Tuple
+
+import gopyrt as go
+from gopyrt import errors
+
+
+# The io package, like std/io/io.go which the interpreter and the VM run.
+# A Reader or a Writer is any value with a Read or a Write method
+# Ref: https://pkg.go.dev/io
+
+EOF = errors.New("EOF")
+
+
+def ReadAll(r: Any) -> Tuple[go.Slice, Any]:
+    data = bytearray()
+    b = go.make_slice(0, 512)
+    while True:
+        n, err = r.Read(b)
+        data += bytes(b.array[:n])
+        if err is not None:
+            return go.Slice(list(data)), None if err is EOF else err
+
+
+def WriteString(w: Any, s: str) -> tuple:
+    return w.Write(go.bytes_of(s))
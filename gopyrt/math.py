@@ -0,0 +1,65 @@
+import math
+import sys
+
+
+# The math package, like std/math/math.go is for the interpreter and the
+# VM. The constants are folded by the type checker, the functions have the
+# special cases of Go instead of the exceptions of python
+# Ref: https://pkg.go.dev/math
+
+MaxFloat64 = sys.float_info.max
+
+
+def Sqrt(x: float) -> float:
+    return math.nan if x < 0 else math.sqrt(x)
+
+
+def Floor(x: float) -> float:
+    if x == 0 or math.isinf(x) or math.isnan(x):
+        return x
+    return float(math.floor(x))
+
+
+def Ceil(x: float) -> float:
+    return -Floor(-x)
+
+
+def Abs(x: float) -> float:
+    return math.fabs(x)
+
+
+def Pow(x: float, y: float) -> float:
+    try:
+        return math.pow(x, y)
+    except ValueError:
+        # 0 to a negative power, or a negative number to a non-integer one
+        if x == 0:
+            odd = y == int(y) and int(y) % 2 == 1
+            return math.copysign(math.inf, x) if odd else math.inf
+        return math.nan
+    except OverflowError:
+        odd = y == int(y) and int(y) % 2 == 1
+        return -math.inf if x < 0 and odd else math.inf
+
+
+def Mod(x: float, y: float) -> float:
+    try:
+        return math.fmod(x, y)
+    except ValueError:
+        return math.nan
+
+
+def Inf(sign: int) -> float:
+    return math.inf if sign >= 0 else -math.inf
+
+
+def NaN() -> float:
+    return math.nan
+
+
+def IsNaN(f: float) -> bool:
+    return math.isnan(f)
+
+
+def IsInf(f: float, sign: int) -> bool:
+    return sign >= 0 and f > MaxFloat64 or sign <= 0 and f < -MaxFloat64
@@ -0,0 +1,197 @@
+import os
+import sys
+from typing import Any, Tuple
+
+import gopyrt as go
+from gopyrt import errors, io
+
+
+# The os package, like std/os/os.go is for the interpreter and the VM.
+# The arguments of the program are the ones of the python module, the first
+# one is its path
+# Ref: https://pkg.go.dev/os
+
+Args = go.Slice(list(sys.argv))
+
+
+def Exit(code: int):
+    # SystemExit isn't a panic, the deferred calls are not run
+    sys.stdout.flush()
+    sys.exit(code)
+
+
+ErrPermission = errors.New("permission denied")
+ErrExist = errors.New("file already exists")
+ErrNotExist = errors.New("file does not exist")
+
+ModeDir = 1 << 31
+ModePerm = 0o777
+
+
+class FileMode:
+    """The methods of FileMode, called like FileMode.m(m)"""
+
+    def IsDir(m: int) -> bool:
+        return m & ModeDir != 0
+
+    def Perm(m: int) -> int:
+        return m & ModePerm
+
+    def String(m: int) -> str:
+        bits = "".join(c if m & (1 << (8 - i)) else "-" for i, c in enumerate("rwxrwxrwx"))
+        return ("d" if m & ModeDir else "-") + bits
+
+
+class fileStat(go.Struct):
+    _fields = ("name", "size", "mode")
+    __slots__ = _fields
+
+    def __init__(self, name: str = "", size: int = 0, mode: int = 0):
+        self.name = name
+        self.size = size
+        self.mode = mode
+
+    def Name(self) -> str:
+        return self.name
+
+    def Size(self) -> int:
+        return self.size
+
+    def Mode(self) -> int:
+        return self.mode
+
+    def IsDir(self) -> bool:
+        return FileMode.IsDir(self.mode)
+
+    def __eq__(self, other):
+        return self is other
+
+    __hash__ = object.__hash__
+
+
+class File(go.Struct):
+    _fields = ("fd", "name")
+    __slots__ = _fields
+
+    def __init__(self, fd: int = 0, name: str = ""):
+        self.fd = fd
+        self.name = name
+
+    def Name(self) -> str:
+        return self.name
+
+    def Read(self, b: go.Slice) -> Tuple[int, Any]:
+        if len(b) == 0:
+            return 0, None
+        data = sys.stdin.buffer.read1(len(b)) if self.fd == 0 else b""
+        if not data:
+            return 0, io.EOF
+        b.array[b.offset:b.offset + len(data)] = data
+        return len(data), None
+
+    def Write(self, b: go.Slice) -> Tuple[int, Any]:
+        out = sys.stdout if self.fd == 1 else sys.stderr if self.fd == 2 else None
+        if out is None:
+            return 0, None
+        out.flush()
+        out.buffer.write(bytes(b))
+        out.buffer.flush()
+        return len(b), None
+
+    def WriteString(self, s: str) -> Tuple[int, Any]:
+        return self.Write(go.bytes_of(s))
+
+    def __eq__(self, other):
+        return self is other
+
+    __hash__ = object.__hash__
+
+
+Stdin = File(0, "/dev/stdin")
+Stdout = File(1, "/dev/stdout")
+Stderr = File(2, "/dev/stderr")
+
+
+class PathError(go.Struct):
+    _fields = ("Op", "Path", "Err")
+    __slots__ = _fields
+
+    def __init__(self, Op: str = "", Path: str = "", Err: Any = None):
+        self.Op = Op
+        self.Path = Path
+        self.Err = Err
+
+    def Error(self) -> str:
+        return self.Op + " " + self.Path + ": " + self.Err.Error()
+
+    def Unwrap(self) -> Any:
+        return self.Err
+
+    def __eq__(self, other):
+        return self is other
+
+    __hash__ = object.__hash__
+
+
+class errno(go.Struct):
+    """The number of the error of a system call, like syscall.Errno (a
+    struct here, the methods of the named types are not of their values)"""
+
+    _fields = ("value",)
+    __slots__ = _fields
+
+    def __init__(self, value: int = 0):
+        self.value = value
+
+    def Error(self) -> str:
+        message = os.strerror(self.value)
+        return message[:1].lower() + message[1:]
+
+    def Is(self, target: Any) -> bool:
+        if target is ErrPermission:
+            return self.value in (1, 13)
+        if target is ErrExist:
+            return self.value in (17, 39)
+        if target is ErrNotExist:
+            return self.value == 2
+        return False
+
+
+def ReadFile(name: str) -> Tuple[go.Slice, Any]:
+    try:
+        with open(name, "rb") as f:
+            return go.Slice(list(f.read())), None
+    except OSError as e:
+        op = "read" if e.errno == 21 else "open"
+        return go.Slice(), PathError(op, name, errno(e.errno))
+
+
+def WriteFile(name: str, data: go.Slice, perm: int) -> Any:
+    try:
+        fd = os.open(name, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, perm)
+        with open(fd, "wb") as f:
+            f.write(bytes(data))
+    except OSError as e:
+        return PathError("open", name, errno(e.errno))
+    return None
+
+
+def Stat(name: str) -> Tuple[Any, Any]:
+    try:
+        st = os.stat(name)
+    except OSError as e:
+        return None, PathError("stat", name, errno(e.errno))
+    mode = st.st_mode & ModePerm | (ModeDir if os.path.isdir(name) else 0)
+    base = name.rstrip("/") or "/"
+    return fileStat(base.rsplit("/", 1)[-1] or "/", st.st_size, mode), None
+
+
+def Remove(name: str) -> Any:
+    try:
+        if os.path.isdir(name):
+            os.rmdir(name)
+        else:
+            os.remove(name)
+    except OSError as e:
+        return PathError("remove", name, errno(e.errno))
+    return None
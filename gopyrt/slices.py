@@ -0,0 +1,51 @@
+import functools
+from typing import Any, Callable
+
+import gopyrt as go
+from gopyrt import cmp
+from gopyrt.sort import sort_slice
+
+
+# The slices package, like std/slices/slices.go is for the interpreter and
+# the VM. The sorts are the ones of the sort package, stable
+# Ref: https://pkg.go.dev/slices
+
+
+def Sort(x: go.Slice):
+    sort_slice(x)
+
+
+def SortFunc(x: go.Slice, compare: Callable[[Any, Any], int]):
+    sort_slice(x, functools.cmp_to_key(compare))
+
+
+def IsSorted(x: go.Slice) -> bool:
+    return not any(cmp.Less(x[i], x[i - 1]) for i in range(1, len(x)))
+
+
+def Index(s: go.Slice, v: Any) -> int:
+    for i, e in enumerate(s):
+        if v == e:
+            return i
+    return -1
+
+
+def Contains(s: go.Slice, v: Any) -> bool:
+    return Index(s, v) >= 0
+
+
+def Reverse(s: go.Slice):
+    if s.array is not None:
+        s.array[s.offset:s.offset + s.length] = list(s)[::-1]
+
+
+def Max(x: go.Slice) -> Any:
+    if len(x) < 1:
+        go.panic("slices.Max: empty list")
+    return go.fmax(*x) if isinstance(x[0], float) else max(x)
+
+
+def Min(x: go.Slice) -> Any:
+    if len(x) < 1:
+        go.panic("slices.Min: empty list")
+    return go.fmin(*x) if isinstance(x[0], float) else min(x)
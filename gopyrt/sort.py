@@ -0,0 +1,88 @@
+import functools
+from typing import Any, Callable, Optional
+
+import gopyrt as go
+
+
+# The sort package, like std/sort/sort.go is for the interpreter and the
+# VM. The elements are sorted in place with the sort of python, which is
+# stable (Go's isn't, equal elements can be in any order)
+# Ref: https://pkg.go.dev/sort
+
+
+def sort_slice(s: go.Slice, key: Optional[Callable] = None):
+    """Sorts the elements of s in increasing order (the NaNs first)"""
+    if s.array is None:
+        return
+    elements = list(s)
+    # NaN isn't ordered, (x == x, x) puts it before the other values
+    elements.sort(key=key or (lambda x: (x == x, x)))
+    s.array[s.offset:s.offset + s.length] = elements
+
+
+def Ints(x: go.Slice):
+    sort_slice(x)
+
+
+def Float64s(x: go.Slice):
+    sort_slice(x)
+
+
+def Strings(x: go.Slice):
+    # Go compares the UTF-8 bytes of strings, python their code points,
+    # which is the same order
+    sort_slice(x)
+
+
+def kind(x: Any) -> str:
+    """The kind of the value, like reflect.Kind"""
+    if x is None:
+        return "zero"
+    if isinstance(x, go.Map):
+        return "map"
+    if isinstance(x, go.Array):
+        return "array"
+    if isinstance(x, go.Struct):
+        return "struct"
+    if callable(x):
+        return "func"
+    from gopyrt import fmt
+    return fmt.type_name(x)
+
+
+def Slice(x: Any, less: Callable[[int, int], bool]):
+    if not isinstance(x, go.Slice):
+        go.panic(f"reflect: call of Swapper on {kind(x)} Value")
+    if x.array is None:
+        return
+
+    def compare(i: int, j: int) -> int:
+        return -1 if less(i, j) else 1 if less(j, i) else 0
+
+    # less compares the elements at their indexes before the sort
+    elements = list(x)
+    order = sorted(range(len(x)), key=functools.cmp_to_key(compare))
+    x.array[x.offset:x.offset + x.length] = [elements[i] for i in order]
+
+
+def SliceStable(x: Any, less: Callable[[int, int], bool]):
+    Slice(x, less)
+
+
+def IntsAreSorted(x: go.Slice) -> bool:
+    return all(x[i - 1] <= x[i] for i in range(1, len(x)))
+
+
+def StringsAreSorted(x: go.Slice) -> bool:
+    return all(x[i - 1] <= x[i] for i in range(1, len(x)))
+
+
+def SearchInts(a: go.Slice, x: int) -> int:
+    i, j = 0, len(a)
+    while i < j:
+        h = (i + j) // 2
+        if a[h] < x:
+            i = h + 1
+        else:
+            j = h
+    return i
@@ -0,0 +1,143 @@
+import math
+import re
+from typing import Any, Tuple
+
+import gopyrt as go
+from gopyrt import errors
+from gopyrt.fmt import format_float, quote
+
+
+# The strconv package, like std/strconv/strconv.go is for the interpreter
+# and the VM, with the same functions: the errors of parseInt and
+# parseFloat are codes, 0 if there is none, 1 for ErrSyntax and 2 for
+# ErrRange
+# Ref: https://pkg.go.dev/strconv
+
+ErrRange = errors.New("value out of range")
+ErrSyntax = errors.New("invalid syntax")
+
+digit_chars = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+
+class NumError(go.Struct):
+    _fields = ("Func", "Num", "Err")
+    __slots__ = _fields
+
+    def __init__(self, Func: str = "", Num: str = "", Err: Any = None):
+        self.Func = Func
+        self.Num = Num
+        self.Err = Err
+
+    def Error(self) -> str:
+        return "strconv." + self.Func + ": parsing " + Quote(self.Num) + ": " + self.Err.Error()
+
+    def Unwrap(self) -> Any:
+        return self.Err
+
+    def __eq__(self, other):
+        return self is other
+
+    __hash__ = object.__hash__
+
+
+def numError(fn: str, s: str, ok: int) -> Any:
+    if ok == 0:
+        return None
+    return NumError(fn, s, ErrSyntax if ok == 1 else ErrRange)
+
+
+def Itoa(i: int) -> str:
+    return FormatInt(i, 10)
+
+
+def Atoi(s: str) -> Tuple[int, Any]:
+    i, ok = parseInt(s, 10, 0)
+    return i, numError("Atoi", s, ok)
+
+
+def ParseInt(s: str, base: int, bitSize: int) -> Tuple[int, Any]:
+    i, ok = parseInt(s, base, bitSize)
+    return i, numError("ParseInt", s, ok)
+
+
+def ParseFloat(s: str, bitSize: int) -> Tuple[float, Any]:
+    f, ok = parseFloat(s, bitSize)
+    return f, numError("ParseFloat", s, ok)
+
+
+def ParseBool(s: str) -> Tuple[bool, Any]:
+    if s in ("1", "t", "T", "TRUE", "true", "True"):
+        return True, None
+    if s in ("0", "f", "F", "FALSE", "false", "False"):
+        return False, None
+    return False, numError("ParseBool", s, 1)
+
+
+def FormatInt(i: int, base: int) -> str:
+    if not 2 <= base <= 36:
+        go.panic("strconv: illegal AppendInt/FormatInt base")
+    digits = ""
+    n = abs(i)
+    while True:
+        n, d = divmod(n, base)
+        digits = digit_chars[d] + digits
+        if n == 0:
+            break
+    return ("-" if i < 0 else "") + digits
+
+
+def FormatFloat(f: float, fmt: int, prec: int, bitSize: int) -> str:
+    verb = chr(fmt)
+    if verb not in "beEfgGxX":
+        return "%" + verb
+    if bitSize == 32:
+        f = go.float32(f)
+    return format_float(f, bitSize, verb, prec)
+
+
+def FormatBool(b: bool) -> str:
+    return "true" if b else "false"
+
+
+def Quote(s: str) -> str:
+    return quote(s)
+
+
+def parseInt(s: str, base: int, bitSize: int) -> Tuple[int, int]:
+    size = bitSize or 64
+    sign, digits = (s[0], s[1:]) if s[:1] in ("+", "-") else ("", s)
+    prefixed = False
+    if base == 0:
+        # the base is the one of the prefix, and underscores can separate the digits
+        base = 10
+        prefix = digits[:2].lower()
+        if prefix in ("0b", "0o", "0x"):
+            base, digits, prefixed = {"b": 2, "o": 8, "x": 16}[prefix[1]], digits[2:], True
+        elif digits[:1] == "0" and len(digits) > 1:
+            base, digits, prefixed = 8, digits[1:], True
+        if "_" in digits:
+            if not re.fullmatch(r"(_?)[^_]+(_[^_]+)*", digits) or digits[0] == "_" and not prefixed:
+                return 0, 1
+            digits = digits.replace("_", "")
+    if not 2 <= base <= 36 or not digits or any(c not in digit_chars[:base] for c in digits.lower()):
+        return 0, 1
+    value = int(digits, base) * (-1 if sign == "-" else 1)
+    low, high = -(1 << (size - 1)), (1 << (size - 1)) - 1
+    if not low <= value <= high:
+        return (low if value < 0 else high), 2
+    return value, 0
+
+
+def parseFloat(s: str, bitSize: int) -> Tuple[float, int]:
+    if re.fullmatch(r"[+-]?(inf|infinity)|nan", s, re.IGNORECASE):
+        return float(s), 0
+    if re.fullmatch(r"[+-]?0[xX]([0-9a-fA-F]+[.]?[0-9a-fA-F]*|[.][0-9a-fA-F]+)[pP][+-]?\d+", s):
+        value = float.fromhex(s)
+    elif re.fullmatch(r"[+-]?(\d+[.]?\d*|[.]\d+)([eE][+-]?\d+)?", s):
+        value = float(s)
+    else:
+        return 0.0, 1
+    if bitSize == 32:
+        # a float64, rounded to a float32
+        value = float(go.float32(value))
+    return value, 2 if math.isinf(value) else 0
@@ -0,0 +1,90 @@
+import gopyrt as go
+
+
+# The strings package, like std/strings/strings.go is for the interpreter
+# and the VM. The strings are python strings, the indexes are byte offsets
+# of their UTF-8 encoding
+# Ref: https://pkg.go.dev/strings
+
+
+def Index(s: str, substr: str) -> int:
+    return s.encode().find(substr.encode())
+
+
+def LastIndex(s: str, substr: str) -> int:
+    return s.encode().rfind(substr.encode())
+
+
+def Contains(s: str, substr: str) -> bool:
+    return substr in s
+
+
+def ContainsRune(s: str, r: int) -> bool:
+    return go.string(r) in s
+
+
+def Count(s: str, substr: str) -> int:
+    return s.count(substr) if substr else len(s) + 1
+
+
+def HasPrefix(s: str, prefix: str) -> bool:
+    return s.startswith(prefix)
+
+
+def HasSuffix(s: str, suffix: str) -> bool:
+    return s.endswith(suffix)
+
+
+def Split(s: str, sep: str) -> go.Slice:
+    return go.Slice(s.split(sep) if sep else list(s))
+
+
+def Fields(s: str) -> go.Slice:
+    return go.Slice(s.split())
+
+
+def Join(elems: go.Slice, sep: str) -> str:
+    return sep.join(elems or [])
+
+
+def Repeat(s: str, count: int) -> str:
+    if count < 0:
+        go.panic("strings: negative Repeat count")
+    return s * count
+
+
+def Replace(s: str, old: str, new: str, n: int) -> str:
+    if old:
+        return s.replace(old, new, n)
+    # an empty old matches at the start and after each rune
+    n = len(s) + 1 if n < 0 else n
+    return "".join((new if i < n else "") + c for i, c in enumerate(list(s) + [""]))
+
+
+def ReplaceAll(s: str, old: str, new: str) -> str:
+    return Replace(s, old, new, -1)
+
+
+def _case(c: str, mapped: str) -> str:
+    # the runes are mapped one by one, like ß which stays ß in upper case
+    return mapped if len(mapped) == 1 else c
+
+
+def ToUpper(s: str) -> str:
+    return "".join(_case(c, c.upper()) for c in s)
+
+
+def ToLower(s: str) -> str:
+    return "".join(_case(c, c.lower()) for c in s)
+
+
+def TrimSpace(s: str) -> str:
+    return s.strip()
+
+
+def TrimPrefix(s: str, prefix: str) -> str:
+    return s[len(prefix):] if prefix and s.startswith(prefix) else s
+
+
+def TrimSuffix(s: str, suffix: str) -> str:
+    return s[:len(s) - len(suffix)] if suffix and s.endswith(suffix) else s
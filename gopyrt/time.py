@@ -0,0 +1,161 @@
+import datetime
+import os
+import time as _time
+
+import gopyrt as go
+
+
+# The time package, like std/time/time.go is for the interpreter and the
+# VM. A Duration is an int, the class has its methods (called like
+# Duration.m(d)). The clock can be replaced by a FakeClock, which the
+# module uses if the environment variable GOPY_FAKE_CLOCK is set
+# Ref: https://pkg.go.dev/time
+
+Nanosecond = 1
+Microsecond = 1000 * Nanosecond
+Millisecond = 1000 * Microsecond
+Second = 1000 * Millisecond
+Minute = 60 * Second
+Hour = 60 * Minute
+
+# the seconds between year 1 and 1970
+unixToInternal = (1969 * 365 + 1969 // 4 - 1969 // 100 + 1969 // 400) * 24 * 60 * 60
+
+
+class Clock:
+    """The clock of Now and Sleep, the one of the system"""
+
+    def now(self) -> int:
+        return _time.time_ns()
+
+    def sleep(self, ns: int):
+        _time.sleep(ns / 1e9)
+
+
+class FakeClock(Clock):
+    """A clock starting at the time of the Go playground (2009-11-10
+    23:00:00 UTC), which only moves when the program sleeps"""
+
+    def __init__(self, start: int = 1257894000 * 10**9):
+        self.ns = start
+
+    def now(self) -> int:
+        return self.ns
+
+    def sleep(self, ns: int):
+        self.ns += ns
+
+
+clock = FakeClock() if os.environ.get("GOPY_FAKE_CLOCK") else Clock()
+
+
+class Duration:
+    """The methods of Duration, called like Duration.m(d)"""
+
+    def String(d: int) -> str:
+        neg, u = d < 0, abs(d)
+        if u == 0:
+            return "0s"
+        if u < Second:
+            unit, scale = (("ns", 1) if u < Microsecond else ("µs", Microsecond)
+                           if u < Millisecond else ("ms", Millisecond))
+            text = fraction(u, scale) + unit
+        else:
+            text = fraction(u % Minute, Second) + "s"
+            if u >= Minute:
+                text = f"{u // Minute % 60}m" + text
+            if u >= Hour:
+                text = f"{u // Hour}h" + text
+        return "-" + text if neg else text
+
+    def Nanoseconds(d: int) -> int:
+        return d
+
+    def Microseconds(d: int) -> int:
+        return go.div(d, Microsecond)
+
+    def Milliseconds(d: int) -> int:
+        return go.div(d, Millisecond)
+
+    def Seconds(d: int) -> float:
+        return go.div(d, Second) + go.mod(d, Second) / 1e9
+
+    def Minutes(d: int) -> float:
+        return go.div(d, Minute) + go.mod(d, Minute) / (60 * 1e9)
+
+    def Hours(d: int) -> float:
+        return go.div(d, Hour) + go.mod(d, Hour) / (60 * 60 * 1e9)
+
+
+def fraction(u: int, scale: int) -> str:
+    """u / scale with the digits of the fraction, without trailing zeros"""
+    whole, rest = divmod(u, scale)
+    digits = len(str(scale)) - 1
+    return str(whole) + (f".{rest:0{digits}d}".rstrip("0") if rest else "")
+
+
+class Time(go.Struct):
+    _fields = ("sec", "nsec")
+    __slots__ = _fields
+
+    def __init__(self, sec: int = 0, nsec: int = 0):
+        self.sec = sec
+        self.nsec = nsec
+
+    def IsZero(self) -> bool:
+        return self.sec == 0 and self.nsec == 0
+
+    def Add(self, d: int) -> "Time":
+        sec, nsec = divmod(self.nsec + d, Second)
+        return Time(self.sec + sec, nsec)
+
+    def Sub(self, u: "Time") -> int:
+        return go.int64((self.sec - u.sec) * Second + self.nsec - u.nsec)
+
+    def After(self, u: "Time") -> bool:
+        return (self.sec, self.nsec) > (u.sec, u.nsec)
+
+    def Before(self, u: "Time") -> bool:
+        return (self.sec, self.nsec) < (u.sec, u.nsec)
+
+    def Equal(self, u: "Time") -> bool:
+        return (self.sec, self.nsec) == (u.sec, u.nsec)
+
+    def Unix(self) -> int:
+        return self.sec - unixToInternal
+
+    def UnixMilli(self) -> int:
+        return self.Unix() * 1000 + self.nsec // Millisecond
+
+    def UnixNano(self) -> int:
+        return self.Unix() * Second + self.nsec
+
+    def String(self) -> str:
+        try:
+            t = datetime.datetime(1, 1, 1) + datetime.timedelta(seconds=self.sec)
+        except OverflowError:
+            return f"Time(sec={self.sec}, nsec={self.nsec})"
+        fraction = f".{self.nsec:09d}".rstrip("0").rstrip(".")
+        return f"{t.year:04d}-{t:%m-%d %H:%M:%S}{fraction} +0000 UTC"
+
+
+def Unix(sec: int, nsec: int) -> Time:
+    sec, nsec = sec + nsec // Second, nsec % Second
+    return Time(sec + unixToInternal, nsec)
+
+
+def Now() -> Time:
+    return Unix(0, clock.now())
+
+
+def Since(t: Time) -> int:
+    return Now().Sub(t)
+
+
+def Until(t: Time) -> int:
+    return t.Sub(Now())
+
+
+def Sleep(d: int):
+    if d > 0:
+        clock.sleep(d)
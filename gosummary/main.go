@@ -0,0 +1,490 @@
+// Command gosummary prints the summary of a package of the standard
+// library, for the loader of gopy to type check the programs importing the
+// packages std doesn't declare: a Go file with the exported declarations
+// of the package, found by go/types in the export data of the Go toolchain
+// (or in its sources), whose functions have no bodies.
+//
+//	go build -o gosummary ./gosummary/main.go
+//	./gosummary -std std unicode/utf8
+//
+// The summary declares what the programs can refer to: the exported
+// constants (with their exact values), variables, functions, types and
+// methods, and the unexported types of the package they use. The fields
+// and the methods of the structs and of the interfaces which aren't
+// exported are left out, and a type of another package which isn't
+// exported (or of an internal package) is written as its underlying type,
+// like the instances of the generic types of other packages and the types
+// of the packages of std (the directory given by -std) which std doesn't
+// declare, since gopy doesn't know them. The types are declared first.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+type summary struct {
+	pkg *types.Package
+	// the names of the packages imported, by path
+	imports map[string]string
+	// the unexported types of the package used, to be declared
+	used    map[*types.TypeName]bool
+	pending []*types.TypeName
+	// the objects declared
+	done map[types.Object]bool
+	// the directory of the packages of std, and the names they declare
+	std      string
+	declared map[string]map[string]bool
+}
+
+func main() {
+	std := flag.String("std", "", "the directory of the packages of std of gopy")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gosummary [-std DIR] PATH")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	pkg, err := importer.Default().Import(path)
+	if err != nil {
+		// without export data, like when the toolchain can't build it
+		pkg, err = importer.ForCompiler(token.NewFileSet(), "source", nil).Import(path)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gosummary:", err)
+		os.Exit(1)
+	}
+	s := &summary{pkg: pkg, imports: map[string]string{}, used: map[*types.TypeName]bool{},
+		done: map[types.Object]bool{}, std: *std, declared: map[string]map[string]bool{}}
+	body := s.declarations()
+	fmt.Printf("// Code generated by gosummary from the export data of %s. DO NOT EDIT.\n\n",
+		runtime.Version())
+	fmt.Printf("// Package %s is the summary of the package %q, its functions have no\n", pkg.Name(), path)
+	fmt.Printf("// bodies: the programs importing it are type checked, not run.\n")
+	fmt.Printf("package %s\n", pkg.Name())
+	if len(s.imports) > 0 {
+		paths := make([]string, 0, len(s.imports))
+		for p := range s.imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		fmt.Printf("\nimport (\n")
+		for _, p := range paths {
+			if name := s.imports[p]; name != p[strings.LastIndex(p, "/")+1:] {
+				fmt.Printf("\t%s %q\n", name, p)
+			} else {
+				fmt.Printf("\t%q\n", p)
+			}
+		}
+		fmt.Printf(")\n")
+	}
+	fmt.Print(body)
+}
+
+// declarations are the declarations of the exported names of the package
+// (then of the unexported types used) in the order of their names, the ones
+// of the generic types first, since gopy needs them to be declared before
+// their instances, then the other types, the aliases and the rest
+func (s *summary) declarations() string {
+	var generics, typeDecls, aliases, decls strings.Builder
+	group := func(obj types.Object) *strings.Builder {
+		typeName, ok := obj.(*types.TypeName)
+		switch {
+		case !ok:
+			return &decls
+		case typeName.IsAlias():
+			return &aliases
+		}
+		if named, ok := typeName.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+			return &generics
+		}
+		return &typeDecls
+	}
+	var declare func(obj types.Object)
+	declare = func(obj types.Object) {
+		if s.done[obj] {
+			return
+		}
+		s.done[obj] = true
+		// the interfaces an interface embeds are declared before it, gopy
+		// doesn't know their methods otherwise
+		if iface, ok := obj.Type().Underlying().(*types.Interface); ok {
+			if _, ok := obj.(*types.TypeName); ok {
+				for i := 0; i < iface.NumEmbeddeds(); i++ {
+					named, ok := iface.EmbeddedType(i).(*types.Named)
+					if ok && named.Obj().Pkg() == s.pkg && named.Obj().Parent() == s.pkg.Scope() {
+						s.used[named.Obj()] = true
+						declare(named.Obj())
+					}
+				}
+			}
+		}
+		s.declare(group(obj), obj)
+	}
+	scope := s.pkg.Scope()
+	for _, name := range scope.Names() {
+		if token.IsExported(name) {
+			declare(scope.Lookup(name))
+		}
+	}
+	for len(s.pending) > 0 {
+		obj := s.pending[0]
+		s.pending = s.pending[1:]
+		declare(obj)
+	}
+	return generics.String() + typeDecls.String() + aliases.String() + decls.String()
+}
+
+func (s *summary) declare(b *strings.Builder, obj types.Object) {
+	b.WriteString("\n")
+	switch obj := obj.(type) {
+	case *types.Const:
+		if basic, ok := obj.Type().(*types.Basic); ok && basic.Info()&types.IsUntyped != 0 {
+			fmt.Fprintf(b, "const %s = %s\n", obj.Name(), value(obj.Val()))
+		} else {
+			fmt.Fprintf(b, "const %s %s = %s\n", obj.Name(), s.typ(obj.Type()), value(obj.Val()))
+		}
+	case *types.Var:
+		fmt.Fprintf(b, "var %s %s\n", obj.Name(), s.typ(obj.Type()))
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		fmt.Fprintf(b, "func %s%s%s\n", obj.Name(), s.typeParams(sig.TypeParams()), s.signature(sig))
+	case *types.TypeName:
+		if obj.IsAlias() {
+			fmt.Fprintf(b, "type %s = %s\n", obj.Name(), s.typ(types.Unalias(obj.Type())))
+			return
+		}
+		named, ok := obj.Type().(*types.Named)
+		if !ok {
+			return
+		}
+		fmt.Fprintf(b, "type %s%s %s\n", obj.Name(), s.typeParams(named.TypeParams()),
+			s.typ(named.Underlying()))
+		for i := 0; i < named.NumMethods(); i++ {
+			m := named.Method(i)
+			if !m.Exported() {
+				continue
+			}
+			sig := m.Type().(*types.Signature)
+			recv := obj.Name()
+			if tparams := named.TypeParams(); tparams.Len() > 0 {
+				names := make([]string, tparams.Len())
+				for j := range names {
+					names[j] = tparams.At(j).Obj().Name()
+				}
+				recv += "[" + strings.Join(names, ", ") + "]"
+			}
+			if _, ok := sig.Recv().Type().(*types.Pointer); ok {
+				recv = "*" + recv
+			}
+			// gopy needs the name of the receiver of a generic type
+			if name := sig.Recv().Name(); token.IsIdentifier(name) {
+				recv = name + " " + recv
+			} else {
+				recv = "_ " + recv
+			}
+			fmt.Fprintf(b, "\nfunc (%s) %s%s\n", recv, m.Name(), s.signature(sig))
+		}
+	}
+}
+
+// value is the exact value of a constant, in Go syntax: the floats which
+// are fractions are divisions of a float by an integer
+func value(v constant.Value) string {
+	switch v.Kind() {
+	case constant.Float:
+		if n, d := constant.Num(v), constant.Denom(v); n.Kind() == constant.Int {
+			if constant.Compare(d, token.EQL, constant.MakeInt64(1)) {
+				return n.ExactString() + ".0"
+			}
+			return "(" + n.ExactString() + ".0 / " + d.ExactString() + ")"
+		}
+		return v.String()
+	case constant.Complex:
+		return "(" + value(constant.Real(v)) + " + " + value(constant.Imag(v)) + "i)"
+	}
+	return v.ExactString()
+}
+
+// qualify is the name of the package of a type of another package, which
+// is imported by the summary (as name_ if names clash)
+func (s *summary) qualify(pkg *types.Package) string {
+	if pkg == s.pkg {
+		return ""
+	}
+	if name, ok := s.imports[pkg.Path()]; ok {
+		return name
+	}
+	name := pkg.Name()
+	for taken := true; taken; {
+		taken = name == s.pkg.Name()
+		for _, other := range s.imports {
+			taken = taken || other == name
+		}
+		if taken {
+			name += "_"
+		}
+	}
+	s.imports[pkg.Path()] = name
+	return name
+}
+
+func (s *summary) typ(t types.Type) string {
+	switch t := t.(type) {
+	case *types.Basic:
+		// gopy has neither unsafe.Pointer nor uintptr
+		if t.Kind() == types.UnsafePointer || t.Kind() == types.Uintptr {
+			return "uint64"
+		}
+		return t.Name()
+	case *types.Pointer:
+		return "*" + s.typ(t.Elem())
+	case *types.Slice:
+		return "[]" + s.typ(t.Elem())
+	case *types.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), s.typ(t.Elem()))
+	case *types.Map:
+		return "map[" + s.typ(t.Key()) + "]" + s.typ(t.Elem())
+	case *types.Chan:
+		switch t.Dir() {
+		case types.SendOnly:
+			return "chan<- " + s.typ(t.Elem())
+		case types.RecvOnly:
+			return "<-chan " + s.typ(t.Elem())
+		}
+		if c, ok := t.Elem().(*types.Chan); ok && c.Dir() == types.RecvOnly {
+			return "chan (" + s.typ(t.Elem()) + ")"
+		}
+		return "chan " + s.typ(t.Elem())
+	case *types.Signature:
+		return "func" + s.signature(t)
+	case *types.Struct:
+		return s.structType(t)
+	case *types.Interface:
+		return s.interfaceType(t)
+	case *types.Union:
+		terms := make([]string, t.Len())
+		for i := range terms {
+			term := t.Term(i)
+			terms[i] = s.typ(term.Type())
+			if term.Tilde() {
+				terms[i] = "~" + terms[i]
+			}
+		}
+		return strings.Join(terms, " | ")
+	case *types.TypeParam:
+		return t.Obj().Name()
+	case *types.Alias:
+		return s.typ(types.Unalias(t))
+	case *types.Named:
+		return s.named(t)
+	}
+	return types.TypeString(t, s.qualify)
+}
+
+func (s *summary) named(t *types.Named) string {
+	obj := t.Obj()
+	if obj.Pkg() == nil {
+		// error and comparable
+		return obj.Name()
+	}
+	name := obj.Name()
+	if obj.Pkg() == s.pkg {
+		if !obj.Exported() && !s.used[obj] && obj.Parent() == s.pkg.Scope() {
+			s.used[obj] = true
+			s.pending = append(s.pending, obj)
+		}
+		if obj.Parent() != s.pkg.Scope() {
+			// declared in a function
+			return s.typ(t.Underlying())
+		}
+	} else if !obj.Exported() || internal(obj.Pkg().Path()) || t.TypeArgs().Len() > 0 ||
+		!s.inStd(obj.Pkg().Path(), obj.Name()) {
+		return s.typ(t.Underlying())
+	} else {
+		name = s.qualify(obj.Pkg()) + "." + name
+	}
+	if args := t.TypeArgs(); args.Len() > 0 {
+		list := make([]string, args.Len())
+		for i := range list {
+			list[i] = s.typ(args.At(i))
+		}
+		name += "[" + strings.Join(list, ", ") + "]"
+	}
+	return name
+}
+
+// inStd reports whether the package of std of gopy path declares name, or
+// whether it isn't one of them
+func (s *summary) inStd(path, name string) bool {
+	if s.std == "" {
+		return true
+	}
+	names, ok := s.declared[path]
+	if !ok {
+		dir := filepath.Join(s.std, filepath.FromSlash(path))
+		if _, err := os.Stat(dir); err == nil {
+			names = map[string]bool{}
+			pkgs, _ := parser.ParseDir(token.NewFileSet(), dir, nil, parser.SkipObjectResolution)
+			for _, pkg := range pkgs {
+				for _, file := range pkg.Files {
+					for _, decl := range file.Decls {
+						declNames(decl, names)
+					}
+				}
+			}
+		}
+		s.declared[path] = names
+	}
+	return names == nil || names[name]
+}
+
+func declNames(decl ast.Decl, names map[string]bool) {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Recv == nil {
+			names[decl.Name.Name] = true
+		}
+	case *ast.GenDecl:
+		for _, spec := range decl.Specs {
+			switch spec := spec.(type) {
+			case *ast.TypeSpec:
+				names[spec.Name.Name] = true
+			case *ast.ValueSpec:
+				for _, name := range spec.Names {
+					names[name.Name] = true
+				}
+			}
+		}
+	}
+}
+
+func internal(path string) bool {
+	return path == "internal" || strings.HasPrefix(path, "internal/") ||
+		strings.Contains(path, "/internal/") || strings.HasSuffix(path, "/internal")
+}
+
+func (s *summary) structType(t *types.Struct) string {
+	var fields []string
+	for i := 0; i < t.NumFields(); i++ {
+		f := t.Field(i)
+		if !f.Exported() {
+			continue
+		}
+		typ := s.typ(f.Type())
+		if !f.Embedded() {
+			fields = append(fields, f.Name()+" "+typ)
+		} else if token.IsIdentifier(strings.TrimPrefix(strings.Replace(typ, ".", "", 1), "*")) {
+			fields = append(fields, typ)
+		}
+		// else the embedded type is written as its underlying type, without its name
+	}
+	if len(fields) == 0 {
+		return "struct{}"
+	}
+	return "struct {\n\t" + indent(strings.Join(fields, "\n")) + "\n}"
+}
+
+func (s *summary) interfaceType(t *types.Interface) string {
+	var elems []string
+	for i := 0; i < t.NumEmbeddeds(); i++ {
+		embedded := t.EmbeddedType(i)
+		typ := s.typ(embedded)
+		iface, ok := embedded.Underlying().(*types.Interface)
+		if !ok || token.IsIdentifier(typ) {
+			elems = append(elems, typ)
+			continue
+		}
+		// written as its underlying type (or of another package, which gopy
+		// doesn't parse), its methods are the ones of t
+		for j := 0; j < iface.NumMethods(); j++ {
+			elems = append(elems, s.method(iface.Method(j))...)
+		}
+	}
+	for i := 0; i < t.NumExplicitMethods(); i++ {
+		elems = append(elems, s.method(t.ExplicitMethod(i))...)
+	}
+	if len(elems) == 0 {
+		return "any"
+	}
+	// an embedded interface alone on the line would be a constraint for gopy
+	if len(elems) == 1 && strings.Contains(elems[0], "(") && !strings.Contains(elems[0], "\n") {
+		return "interface{ " + elems[0] + " }"
+	}
+	return "interface {\n\t" + indent(strings.Join(elems, "\n")) + "\n}"
+}
+
+func (s *summary) method(m *types.Func) []string {
+	if !m.Exported() {
+		return nil
+	}
+	return []string{m.Name() + s.signature(m.Type().(*types.Signature))}
+}
+
+func indent(s string) string {
+	return strings.ReplaceAll(s, "\n", "\n\t")
+}
+
+func (s *summary) typeParams(list *types.TypeParamList) string {
+	if list.Len() == 0 {
+		return ""
+	}
+	params := make([]string, list.Len())
+	for i := range params {
+		p := list.At(i)
+		params[i] = p.Obj().Name() + " " + s.typ(p.Constraint())
+	}
+	return "[" + strings.Join(params, ", ") + "]"
+}
+
+// signature is the parameters and the results of a function, named like
+// in the package if they all are, else _ (gopy doesn't parse the lists of
+// types of other packages without names), but a single result
+func (s *summary) signature(sig *types.Signature) string {
+	params := s.tuple(sig.Params(), sig.Variadic(), true)
+	results := s.tuple(sig.Results(), false, sig.Results().Len() > 1)
+	switch {
+	case sig.Results().Len() == 0:
+		return "(" + params + ")"
+	case sig.Results().Len() == 1 && !strings.Contains(results, " "):
+		return "(" + params + ") " + results
+	}
+	return "(" + params + ") (" + results + ")"
+}
+
+func (s *summary) tuple(t *types.Tuple, variadic, named bool) string {
+	names := make([]string, t.Len())
+	for i := range names {
+		if names[i] = t.At(i).Name(); !token.IsIdentifier(names[i]) {
+			names = make([]string, t.Len())
+			for j := range names {
+				names[j] = "_"
+			}
+			break
+		}
+	}
+	list := make([]string, t.Len())
+	for i := range list {
+		typ := t.At(i).Type()
+		if variadic && i == t.Len()-1 {
+			list[i] = "..." + s.typ(typ.(*types.Slice).Elem())
+		} else {
+			list[i] = s.typ(typ)
+		}
+		if named || names[i] != "_" {
+			list[i] = names[i] + " " + list[i]
+		}
+	}
+	return strings.Join(list, ", ")
+}
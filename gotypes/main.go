@@ -0,0 +1,270 @@
+// Command gotypes type checks a Go program with go/types and prints what
+// it finds as JSON, for conformance.py to compare with the type checker of
+// gopy: the type (and the constant value) of each expression, and the errors.
+//
+//	go build -o gotypes ./gotypes/main.go
+//	./gotypes tests/packages
+//
+// The path is a .go file or the directory of a package. The packages it
+// imports are found like gopy does: relative to the directory of the
+// importer (like "./units") or of the program (like "geometry"), the
+// others are the ones of the standard library.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Expr is an expression, its span is from Pos to End (byte offsets in File).
+type Expr struct {
+	File  string `json:"file"`
+	Pos   int    `json:"pos"`
+	End   int    `json:"end"`
+	Mode  string `json:"mode"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Error is an error of the parser or of the type checker.
+type Error struct {
+	File    string `json:"file"`
+	Offset  int    `json:"offset"`
+	Message string `json:"message"`
+	// Soft errors don't make the program invalid for go/types, like unused imports
+	Soft bool `json:"soft"`
+}
+
+type output struct {
+	Exprs  []Expr  `json:"exprs"`
+	Errors []Error `json:"errors"`
+}
+
+type program struct {
+	root     string
+	fset     *token.FileSet
+	std      types.Importer
+	packages map[string]*types.Package
+	out      output
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: gotypes path")
+		os.Exit(2)
+	}
+	path := os.Args[1]
+	fset := token.NewFileSet()
+	p := &program{
+		root:     path,
+		fset:     fset,
+		std:      importer.ForCompiler(fset, "source", nil),
+		packages: map[string]*types.Package{},
+		out:      output{Exprs: []Expr{}, Errors: []Error{}},
+	}
+	files := []string{path}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		files = packageFiles(path)
+	} else {
+		p.root = filepath.Dir(path)
+	}
+	p.check(".", files)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(p.out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// packageFiles are the .go files of dir, like loader.package_files.
+func packageFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") && !strings.HasSuffix(e.Name(), "_test.go") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files
+}
+
+// check parses and type checks the files of the package at path, and adds
+// the types of its expressions and its errors to the output.
+func (p *program) check(path string, filenames []string) *types.Package {
+	var files []*ast.File
+	for _, name := range filenames {
+		f, err := parser.ParseFile(p.fset, name, nil, parser.ParseComments)
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				p.out.Errors = append(p.out.Errors, Error{e.Pos.Filename, e.Pos.Offset, e.Msg, false})
+			}
+		}
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+
+	dir := p.root
+	if len(filenames) > 0 {
+		dir = filepath.Dir(filenames[0])
+	}
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+	conf := types.Config{
+		Importer: importerFunc(func(imported string) (*types.Package, error) {
+			return p.importPackage(dir, imported)
+		}),
+		Error: func(err error) {
+			// the ones starting with a tab are notes of the error before,
+			// like the other declaration of a redeclared name
+			if e, ok := err.(types.Error); ok && e.Pos.IsValid() && !strings.HasPrefix(e.Msg, "\t") {
+				pos := p.fset.Position(e.Pos)
+				p.out.Errors = append(p.out.Errors, Error{pos.Filename, pos.Offset, e.Msg, e.Soft})
+			}
+		},
+	}
+	pkg, _ := conf.Check(path, p.fset, files, info)
+
+	qualifier := func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+	for e, tv := range info.Types {
+		start, end := p.fset.Position(e.Pos()), p.fset.Position(e.End())
+		if !start.IsValid() {
+			continue
+		}
+		expr := Expr{File: start.Filename, Pos: start.Offset, End: end.Offset, Mode: mode(tv)}
+		if tv.Type != nil {
+			expr.Type = typeString(tv.Type, qualifier)
+		}
+		if tv.Value != nil {
+			expr.Value = value(tv.Value)
+		}
+		p.out.Exprs = append(p.out.Exprs, expr)
+	}
+	return pkg
+}
+
+// importPackage type checks the package of the program imported by
+// path from dir (once), or imports the one of the standard library.
+func (p *program) importPackage(dir, path string) (*types.Package, error) {
+	pkgDir := filepath.Join(p.root, path)
+	if strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") {
+		pkgDir = filepath.Join(dir, path)
+	}
+	files := packageFiles(pkgDir)
+	if len(files) == 0 {
+		return p.std.Import(path)
+	}
+	if pkg, ok := p.packages[pkgDir]; ok {
+		if pkg == nil {
+			return nil, fmt.Errorf("import cycle not allowed")
+		}
+		return pkg, nil
+	}
+	// nil while it is checked
+	p.packages[pkgDir] = nil
+	pkg := p.check(path, files)
+	p.packages[pkgDir] = pkg
+	return pkg, nil
+}
+
+// typeString is the type the way gopy writes it: the aliases are the types
+// they stand for, and the parameters and the results have no names.
+func typeString(t types.Type, qualifier types.Qualifier) string {
+	switch t := types.Unalias(t).(type) {
+	case *types.Signature:
+		var params []string
+		for i := 0; i < t.Params().Len(); i++ {
+			param := t.Params().At(i).Type()
+			if slice, ok := param.(*types.Slice); ok && t.Variadic() && i == t.Params().Len()-1 {
+				params = append(params, "..."+typeString(slice.Elem(), qualifier))
+			} else {
+				params = append(params, typeString(param, qualifier))
+			}
+		}
+		s := "func(" + strings.Join(params, ", ") + ")"
+		if t.Results().Len() == 1 {
+			s += " " + typeString(t.Results().At(0).Type(), qualifier)
+		} else if t.Results().Len() > 1 {
+			s += " " + typeString(t.Results(), qualifier)
+		}
+		return s
+	case *types.Tuple:
+		var elems []string
+		for i := 0; i < t.Len(); i++ {
+			elems = append(elems, typeString(t.At(i).Type(), qualifier))
+		}
+		return "(" + strings.Join(elems, ", ") + ")"
+	default:
+		return types.TypeString(t, qualifier)
+	}
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// mode is the mode of an expression, with the names of checker.Operand.
+func mode(tv types.TypeAndValue) string {
+	switch {
+	case tv.IsVoid():
+		return "novalue"
+	case tv.IsType():
+		return "type"
+	case tv.IsBuiltin():
+		return "builtin"
+	case tv.IsNil():
+		return "nil"
+	case tv.Value != nil:
+		return "constant"
+	}
+	return "value"
+}
+
+// value is the exact value of a constant: an integer or a fraction (n/d)
+// for numbers, (re, im) for complex numbers, the hex encoding of the bytes
+// of a string, or true and false.
+func value(v constant.Value) string {
+	switch v.Kind() {
+	case constant.Bool:
+		return fmt.Sprint(constant.BoolVal(v))
+	case constant.String:
+		return hex.EncodeToString([]byte(constant.StringVal(v)))
+	case constant.Int, constant.Float:
+		return fraction(v)
+	case constant.Complex:
+		return fmt.Sprintf("(%s, %s)", fraction(constant.Real(v)), fraction(constant.Imag(v)))
+	}
+	return v.ExactString()
+}
+
+func fraction(v constant.Value) string {
+	v = constant.ToFloat(v)
+	num, denom := constant.Num(v), constant.Denom(v)
+	if num.Kind() == constant.Unknown {
+		return v.ExactString()
+	}
+	if denom.String() == "1" {
+		return num.ExactString()
+	}
+	return num.ExactString() + "/" + denom.ExactString()
+}
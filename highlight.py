@@ -0,0 +1,274 @@
+import io
+import os
+import sys
+import html
+import json
+import bisect
+import argparse
+import contextlib
+
+from dataclasses import dataclass
+from typing import Dict, List, Optional, Tuple
+
+import checker
+import diagnostics
+import fileset
+import go_lexer
+import go_parser
+import syntree
+import utils
+
+
+# The tokens of a file classified for highlighting, by what the type checker
+# resolved its identifiers to (a constant, a type, a function...), so the
+# editors (see the semantic tokens of lsp.py) and the tools documenting the
+# code highlight them the same way:
+#
+#   info = checker.Info()
+#   go_parser.check_program("tests/methods.go", info=info)
+#   for tok in highlight.tokens(info, "tests/methods.go"):
+#       tok.lineno, tok.col_num, tok.length, tok.kind, tok.modifiers
+#
+# The identifiers the checker didn't resolve (like the labels, or the ones
+# of code with errors) are not classified, nor are the punctuation tokens.
+#
+#   python highlight.py tests/methods.go --format=html
+#
+# prints the file as HTML, the tokens in <span>s with their kind as class.
+
+# the kinds of the tokens
+kinds = [
+    "keyword", "comment", "string", "number", "operator", "namespace", "type",
+    "constant", "variable", "field", "function", "method",
+]
+# the modifiers, declaration for the identifiers declaring an object, and
+# defaultLibrary for the predeclared ones (like int, len or nil)
+modifiers = ["declaration", "defaultLibrary"]
+
+# the kinds of the objects of the checker
+object_kinds = {
+    "const": "constant", "var": "variable", "type": "type", "func": "function",
+    "package": "namespace", "builtin": "function", "field": "field", "nil": "constant",
+}
+literal_kinds = {
+    "INT_LIT": "number", "FLOAT_LIT": "number", "IMAGINARY_LIT": "number",
+    "STRING_LIT": "string", "RUNE_LIT": "string",
+}
+punctuation = set(",;.()[]{}:") | {"LIT_LBRACE", "ELLIPSIS"}
+predeclared = checker.universe().objects
+
+
+@dataclass
+class Token:
+    """A token of a line (the ones spanning several lines, like the comments,
+    have a Token for each), col_num counts the characters from 1"""
+
+    lineno: int
+    col_num: int
+    length: int
+    kind: str
+    modifiers: Tuple[str, ...] = ()
+
+
+class Lines:
+    """The starts of the lines of a text, to find the line and the
+    column of its offsets"""
+
+    def __init__(self, text: str):
+        self.starts = [0] + [i + 1 for i, c in enumerate(text) if c == "\n"]
+
+    def position(self, offset: int) -> Tuple[int, int]:
+        index = bisect.bisect_right(self.starts, offset) - 1
+        return index + 1, offset - self.starts[index] + 1
+
+    def pieces(self, start: int, end: int) -> List[Tuple[int, int, int]]:
+        """The (lineno, col_num, length) of the part of each line between the
+        offsets start and end, without the newlines"""
+        found = []
+        lineno, col_num = self.position(start)
+        while start < end:
+            line_end = self.starts[lineno] - 1 if lineno < len(self.starts) else end
+            stop = min(end, line_end)
+            if stop > start:
+                found.append((lineno, col_num, stop - start))
+            start, lineno, col_num = line_end + 1, lineno + 1, 1
+        return found
+
+
+def object_kind(obj: checker.Object) -> Tuple[str, Tuple[str, ...]]:
+    """The kind and the modifiers of the identifiers referring to obj"""
+    kind = object_kinds.get(obj.kind, "variable")
+    # the universe objects don't have a file
+    if obj.file is None and obj.kind in ("builtin", "nil", "type", "const"):
+        return kind, ("defaultLibrary",)
+    return kind, ()
+
+
+def resolved(info: checker.Info, filename: str) -> Dict[Tuple[int, int], tuple]:
+    """The (name, kind, modifiers) of the identifiers the checker resolved in
+    the file, by their (lineno, col_num). The name tells the identifiers apart
+    from the ones of the types of the other packages, which are checked again
+    where they are used (their fields have the file of the package using them)"""
+    found: Dict[Tuple[int, int], tuple] = {}
+
+    def add(lineno, col_num, name, kind, mods=()):
+        if lineno is not None and col_num is not None:
+            found.setdefault((lineno, col_num), (name, kind, mods))
+
+    for node, obj in info.defs.items():
+        if info.files.get(node) == filename:
+            lineno, col_num, _ = checker.position(node)
+            kind, mods = object_kind(obj)
+            add(lineno, col_num, obj.name, kind, ("declaration",) + mods)
+    for obj in info.methods.values():
+        if obj.file == filename:
+            add(obj.lineno, obj.col_num, obj.name, "method", ("declaration",))
+    for sel, selection in info.selections.items():
+        if info.files.get(sel) == filename:
+            lineno, col_num, _ = checker.position(sel)
+            add(lineno, col_num, sel.field_name,
+                "field" if selection.kind == "field" else "method")
+    for node, obj in info.uses.items():
+        if info.files.get(node) != filename:
+            continue
+        if isinstance(node, syntree.QualifiedIdent):
+            package, member = node.data
+            add(node.lineno, package[-1], package[1], "namespace")
+            add(node.lineno, member[-1], member[1], *object_kind(obj))
+        else:
+            lineno, col_num, _ = checker.position(node)
+            add(lineno, col_num, obj.name, *object_kind(obj))
+
+    # the types written by their name, like the ones of the declarations
+    for pos, ref in syntree.type_refs.items():
+        position = fileset.fset.position(pos)
+        if position.filename != filename:
+            continue
+        name = ref.name.split("[")[0]
+        if "." in name:
+            package, name = name.split(".", 1)
+            add(position.line, position.column, package, "namespace")
+            add(position.line, position.column + len(package) + 1, name, "type")
+        else:
+            add(position.line, position.column, name, "type",
+                ("defaultLibrary",) if name in predeclared else ())
+    return found
+
+
+def tokens(info: checker.Info, filename: str, text: Optional[str] = None) -> List[Token]:
+    """The tokens of the file checked with info, whose text is text (by
+    default the one read by utils.read_source), in the order of the text"""
+    if text is None:
+        text = utils.read_source(filename)
+    names = resolved(info, filename)
+    lines = Lines(text)
+    found: List[Token] = []
+
+    def add(start, end, kind, mods=()):
+        for lineno, col_num, length in lines.pieces(start, end):
+            found.append(Token(lineno, col_num, length, kind, mods))
+
+    with diagnostics.muted():
+        lexed = go_lexer.tokenize(text)
+    file = go_lexer.file
+    previous = None
+    for tok in lexed:
+        start, end = tok.lexpos, file.offset(tok.end)
+        if start == end or tok.type in punctuation:
+            pass
+        elif tok.type.startswith("KW_"):
+            add(start, end, "keyword")
+        elif tok.type in literal_kinds:
+            add(start, end, literal_kinds[tok.type])
+        elif tok.type == "BOOL_LIT":
+            add(start, end, "constant", ("defaultLibrary",))
+        elif tok.type in ("IDENTIFIER", "QUALIFIED_TYPENAME"):
+            idents = [tok.value] if tok.type == "IDENTIFIER" else list(tok.value)
+            for _, name, col_num in idents:
+                lineno, _ = lines.position(start)
+                offset = lines.starts[lineno - 1] + col_num - 1
+                kind, mods = classify(names.get((lineno, col_num)), name, previous)
+                if kind is not None:
+                    add(offset, offset + len(name), kind, mods)
+        else:
+            add(start, end, "operator")
+        if start != end:
+            previous = tok.type
+    for pos, comment in go_lexer.comments:
+        start = file.offset(pos)
+        add(start, start + len(comment), "comment")
+    found.sort(key=lambda tok: (tok.lineno, tok.col_num))
+    return found
+
+
+def classify(found: Optional[tuple], name: str, previous: Optional[str]
+             ) -> Tuple[Optional[str], Tuple[str, ...]]:
+    """The kind and the modifiers of an identifier, found by resolved,
+    after a token of type previous"""
+    if previous == "KW_PACKAGE":
+        return "namespace", ("declaration",)
+    if found is None or found[0] != name:
+        return None, ()
+    _, kind, mods = found
+    # the methods of the interfaces are declared as funcs, not after a func
+    if kind == "function" and "declaration" in mods and previous != "KW_FUNC":
+        return "method", mods
+    return kind, mods
+
+
+def to_html(text: str, toks: List[Token]) -> str:
+    """The text as the HTML of a <pre>, the tokens in <span>s with their
+    kind and their modifiers as classes"""
+    lines = text.split("\n")
+    parts = ['<pre class="gopy">']
+    by_line: Dict[int, List[Token]] = {}
+    for tok in toks:
+        by_line.setdefault(tok.lineno, []).append(tok)
+    for lineno, line in enumerate(lines, 1):
+        col = 0
+        for tok in by_line.get(lineno, []):
+            start = tok.col_num - 1
+            if start < col:
+                continue
+            classes = " ".join((tok.kind,) + tok.modifiers)
+            parts.append(html.escape(line[col:start]))
+            parts.append(f'<span class="{classes}">{html.escape(line[start:start + tok.length])}</span>')
+            col = start + tok.length
+        parts.append(html.escape(line[col:]))
+        if lineno < len(lines):
+            parts.append("\n")
+    parts.append("</pre>")
+    return "".join(parts)
+
+
+def to_json(toks: List[Token]) -> str:
+    return json.dumps([{"line": tok.lineno, "column": tok.col_num, "length": tok.length,
+                        "kind": tok.kind, "modifiers": list(tok.modifiers)} for tok in toks],
+                      indent=2)
+
+
+def main(argv: List[str]) -> int:
+    arg_parser = argparse.ArgumentParser(
+        prog="highlight.py", description="Prints the tokens of a file classified for highlighting"
+    )
+    arg_parser.add_argument("file", help="a .go file, checked as a program of its own "
+                                         "unless --package")
+    arg_parser.add_argument("--format", choices=["html", "json"], default="html")
+    arg_parser.add_argument("--package", action="store_true",
+                            help="checks the file with the package of its directory")
+    args = arg_parser.parse_args(argv)
+
+    filename = os.path.normpath(args.file)
+    path = os.path.dirname(filename) or "." if args.package else filename
+    info = checker.Info()
+    diagnostics.printing = False
+    with contextlib.redirect_stdout(io.StringIO()):
+        go_parser.check_program(path, verbose=False, info=info)
+    text = utils.read_source(filename)
+    toks = tokens(info, filename, text)
+    print(to_html(text, toks) if args.format == "html" else to_json(toks))
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
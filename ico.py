@@ -1,13 +1,20 @@
+from collections import defaultdict
 from math import log2, floor, ceil
 
-from tac import IntermediateCode, Label, Quad, Assign, Operand, TempVar, ActualVar
+from tac import (
+    IntermediateCode, Label, Quad, Assign, Store, RuntimeCall, Operand, TempVar, ActualVar,
+    CompositeValue, AddressOf,
+)
 from syntree import Literal
+from constant import quote, unquote
 
 
 bools = {True: "true", False: "false"}
 
 
 def is_power_of_2(x):
+    if isinstance(x, complex):
+        return False
     if floor(x) != ceil(x) or x == 1:
         return False
     x = int(x)
@@ -25,8 +32,20 @@ def is_literal_or_const_operand(op):
 def binary_eval(q: Quad):
     dest, op1, operator, op2 = q.dest, q.op1, q.operator, q.op2
 
+    if operator in ("[]", "[]=") or isinstance(q, RuntimeCall):
+        # loads and stores of elements and fields, and calls of the
+        # runtime, whose arguments can be constants
+        return q
+
     if is_literal_or_const_operand(op1) and is_literal_or_const_operand(op2):
-        if operator == "+":
+        if operator in ("/", "%") and op2.value == 0:
+            # not folded, a float is divided by zero at run time (an integer
+            # divided by zero panics, the type checker rejects the constant ones)
+            return q
+        if operator == "+" and isinstance(op1.value, str) and isinstance(op2.value, str):
+            # string literals are quoted, like "a" + "b"
+            dest.value = quote(unquote(op1.value) + unquote(op2.value))
+        elif operator == "+":
             dest.value = op1.value + op2.value
         elif operator == "-":
             dest.value = op1.value - op2.value
@@ -34,7 +53,8 @@ def binary_eval(q: Quad):
             dest.value = op1.value * op2.value
         elif operator == "/":
             ints = {"int", "int8", "int16", "int32", "int64"}
-            floats = {"float32", "float64"}
+            # complex numbers are divided like floats
+            floats = {"float32", "float64", "complex64", "complex128"}
             dest_typename = dest.type_
             assert isinstance(dest_typename, str)
             if dest_typename in ints:
@@ -47,6 +67,26 @@ def binary_eval(q: Quad):
                 # )
                 pass
 
+        elif operator == "%":
+            # the result has the sign of the dividend in Go
+            rem = abs(op1.value) % abs(op2.value)
+            dest.value = rem if op1.value >= 0 else -rem
+        elif operator == "&":
+            dest.value = op1.value & op2.value
+        elif operator == "|":
+            dest.value = op1.value | op2.value
+        elif operator == "^":
+            dest.value = op1.value ^ op2.value
+        elif operator == "&^":
+            dest.value = op1.value & ~op2.value
+        elif operator == "<<":
+            dest.value = op1.value << op2.value
+        elif operator == ">>":
+            dest.value = op1.value >> op2.value
+        elif operator == "&&":
+            dest.value = bools[op1.value == "true" and op2.value == "true"]
+        elif operator == "||":
+            dest.value = bools[op1.value == "true" or op2.value == "true"]
         elif operator == "==":
             dest.value = bools[op1.value == op2.value]
         elif operator == "!=":
@@ -63,7 +103,7 @@ def binary_eval(q: Quad):
             raise Exception(operator + " is an invalid binary operator!")
         q = Assign(dest, dest.value, q.scope_id)
     elif is_literal_or_const_operand(op1) and isinstance(op2, Operand):
-        if is_power_of_2(op1.value) and operator == "*":
+        if operator == "*" and is_power_of_2(op1.value):
             q.op1, q.op2 = q.op2, int(log2(op1.value))
             q.operator = "<<"
         elif op1.value == 0:
@@ -80,7 +120,7 @@ def binary_eval(q: Quad):
         elif op1.value == "false" and operator == "||":
             q = Assign(dest, op2, q.scope_id)
     elif is_literal_or_const_operand(op2) and isinstance(op1, Operand):
-        if is_power_of_2(op2.value):
+        if operator in ("*", "/") and is_power_of_2(op2.value):
             q.op2 = int(log2(op2.value))
             if operator == "*":
                 q.operator = "<<"
@@ -104,33 +144,43 @@ def binary_eval(q: Quad):
     return q
 
 
-def deconstantize_loop(ic: IntermediateCode, line_num: int):
-    label_start = ic.code_list[line_num].dest
-    label_end = label_start.replace('start', 'end')
-
-    for i in range(line_num+1, len(ic.code_list)):
-        q = ic.code_list[i]
-        if q.dest == label_end:
-            break
-        if isinstance(q.dest, ActualVar):
-            q.dest.deconstantize()
-
-
 def const_fold_const_prop_strength_red(ic: IntermediateCode):
     ico = IntermediateCode()
+    # variables which got a value so far
+    assigned = set()
+    # variables assigned only once (at their declaration) keep their value
+    num_assignments = defaultdict(lambda: 0)
+    for q in ic.code_list:
+        if isinstance(q.dest, ActualVar):
+            num_assignments[q.dest] += 1
+    # variables whose address is taken can be changed through pointers
+    escaped = {
+        q.op1 for q in ic.code_list if isinstance(q, AddressOf) and isinstance(q.op1, ActualVar)
+    }
 
     for i, q in enumerate(ic.code_list):
 
         if isinstance(q, Assign):
-            if isinstance(q.op2, Literal):
+            if isinstance(q.dest, ActualVar) and q.dest.symbol.const:
+                # value of a declared constant is already known
+                pass
+            elif q.dest in escaped:
+                pass
+            elif isinstance(q.op2, Literal):
                 q.dest.value = q.op2.value
             elif isinstance(q.op2, Operand) and q.op2.is_const():
                 q.dest.value = q.op2.value
                 q.op2 = q.dest.value
-        elif q.operator == 'LABEL' and q.dest.startswith('for_'):
-            deconstantize_loop(ic, i)
+        elif q.operator == 'LABEL':
+            # a label can be reached from a goto (of a loop, if or switch),
+            # so the values of variables are not known anymore
+            for var in assigned:
+                if not var.symbol.const and num_assignments[var] > 1:
+                    var.deconstantize()
 
         q = binary_eval(q)
+        if isinstance(q.dest, ActualVar):
+            assigned.add(q.dest)
 
         ico.add_to_list(q)
 
@@ -138,87 +188,90 @@ def const_fold_const_prop_strength_red(ic: IntermediateCode):
 
 
 def loop_invariant(ic: IntermediateCode):
-    loops = {}
+    def _find_loops():
+        loops = {}
 
-    for i, code in enumerate(ic.code_list):
-        if isinstance(code, Label):
-            if code.name.startswith("for_simple_start") or code.name.startswith(
-                "for_cmpd_start"
-            ):
-                loops[code.name] = (i,)
+        for i, code in enumerate(ic.code_list):
+            if isinstance(code, Label):
+                if code.name.startswith("for_simple_start") or code.name.startswith(
+                    "for_cmpd_start"
+                ):
+                    loops[code.name] = (i,)
 
-            elif code.name.startswith("for_simple_end") or code.name.startswith(
-                "for_cmpd_end"
-            ):
-                start_name = code.name.replace("end", "start")
-                loops[start_name] = (loops[start_name][0], i)
+                elif code.name.startswith("for_simple_end") or code.name.startswith(
+                    "for_cmpd_end"
+                ):
+                    start_name = code.name.replace("end", "start")
+                    loops[start_name] = (loops[start_name][0], i)
+
+        return loops
 
+    loops = _find_loops()
     print("got loops", loops)
 
+    def _is_movable_dest(dest, loop_scope: str):
+        # temporaries are assigned once, variables declared in the body
+        # of the loop are not seen outside of it
+        if isinstance(dest, TempVar):
+            return True
+        return isinstance(dest, ActualVar) and dest.symbol.scope_id.startswith(
+            loop_scope + "."
+        )
+
     def _loop_invar(ic: IntermediateCode, loop_start: int, loop_end: int):
-        required = {}
-        blacklisted = set()
+        loop_scope = ic.code_list[loop_start].scope_id
+        body = ic.code_list[loop_start + 1:loop_end]
 
-        def _is_literal_const_or_required(op: Quad):
-            return (
-                is_literal_or_const_operand(op) or op in required or isinstance(op, int) or isinstance(op, float)
-            ) and op not in blacklisted
-
-        for ind, code in enumerate(ic.code_list[loop_start:loop_end]):
-
-            if isinstance(code, Assign) or isinstance(code.dest, (ActualVar, TempVar)):
-                flag = False
-
-                if code.op1 is None:
-                    if _is_literal_const_or_required(code.op2):
-                        required[code.dest] = (ind, code, [code.op2])
-                        flag = True
-
-                else:
-                    if _is_literal_const_or_required(
-                        code.op1
-                    ) and _is_literal_const_or_required(code.op2):
-                        required[code.dest] = (ind, code, [code.op1, code.op2])
-                        flag = True
-
-                if not flag:
-                    if code.dest in required:
-                        print("is dest, removing", code.dest)
-                        required.pop(code.dest)
-                        blacklisted.add(code.dest)
-
-        print("required in loop", required.keys())
-
-        codes = []
-        moved = set()
-        for ind, code, dep_list in reversed(required.values()):
-            flag = True
-            for dep in dep_list:
-                if not _is_literal_const_or_required(dep):
-                    flag = False
-
-            if not flag:
-                continue
+        # variables assigned more than once in the loop are not invariant
+        num_assignments = defaultdict(lambda: 0)
+        for code in body:
+            if isinstance(code.dest, Operand):
+                num_assignments[code.dest] += 1
 
-            new_ind = loop_start + ind
+        required = set()
 
-            codes.append((ic.code_list.pop(new_ind), dep_list))
-            moved.add(codes[-1][0].dest)
+        def _is_literal_const_or_required(op):
+            return (
+                is_literal_or_const_operand(op) or op in required
+                or isinstance(op, (int, float))
+            )
+
+        moved = []
+        for code in body:
+            if code.operator in (
+                "call", "go", "defer", "pop", "push", "return", "LABEL", "goto", "if", "[]="
+            ):
+                continue
+            # calls of the runtime allocate memory or read memory
+            # changed in the loop, like new(24) or lookup(m, k)
+            if isinstance(code, RuntimeCall):
+                continue
+            if not _is_movable_dest(code.dest, loop_scope):
+                continue
+            if num_assignments[code.dest] != 1:
+                continue
 
-        for code_, dep_list in codes:
-            flag = True
-            for dep in dep_list:
-                if dep in required and dep not in moved:
-                    flag = False
+            operands = [code.op2] if code.op1 is None else [code.op1, code.op2]
+            if all(_is_literal_const_or_required(op) for op in operands):
+                required.add(code.dest)
+                moved.append(code)
 
-            if not flag:
-                continue
+        print("required in loop", [str(code.dest) for code in moved])
 
-            print("moving to", loop_start, ic.code_list[loop_start])
+        if not moved:
+            return False
 
-            ic.code_list.insert(loop_start, code_)
+        # invariants are moved just before the start of the loop,
+        # in the same order
+        print("moving to", loop_start, ic.code_list[loop_start])
+        ic.code_list[loop_start:loop_end] = (
+            moved + [c for c in ic.code_list[loop_start:loop_end] if c not in moved]
+        )
+        return True
 
-    for _, (start, end) in loops.items():
+    for name in loops:
+        # code is moved around, so the positions are found again
+        start, end = _find_loops()[name]
         _loop_invar(ic, start, end)
 
 
@@ -277,26 +330,53 @@ def remove_deadcode(ic):
             discard = True
             curr_scope = q.scope_id
 
-    ico2 = IntermediateCode()
-
     required_ops = set()
 
-    for q in reversed(ico1.code_list):
-        if q.operator == "LABEL":
-            ico2.add_to_list(q)
-            required_ops.add(q.dest)
-        elif q.operator == "call":
-            ico2.add_to_list(q)
-            required_ops.add(q.dest)
-        elif q.operator in ("return", "push"):
-            ico2.add_to_list(q)
-            required_ops.add(q.op2)
-        elif q.dest in required_ops:
-            ico2.add_to_list(q)
-            if isinstance(q.op1, Operand):
-                required_ops.add(q.op1)
-            if isinstance(q.op2, Operand):
+    # a goto (of a loop) can go back to an earlier label, values used
+    # after it are required before it as well. so repeat until nothing
+    # new is required
+    while True:
+        ico2 = IntermediateCode()
+        num_required = len(required_ops)
+
+        for q in reversed(ico1.code_list):
+            if q.operator == "LABEL":
+                ico2.add_to_list(q)
+                required_ops.add(q.dest)
+            elif q.operator in ("call", "go", "defer", "pop"):
+                ico2.add_to_list(q)
+                required_ops.add(q.dest)
+                # the function called, for dynamic calls
+                if isinstance(q.op2, Operand):
+                    required_ops.add(q.op2)
+            elif q.operator in ("return", "push"):
+                ico2.add_to_list(q)
                 required_ops.add(q.op2)
+                if isinstance(q.op2, CompositeValue):
+                    required_ops.update(q.op2.operands())
+            elif isinstance(q, RuntimeCall) and q.operator in RuntimeCall.effects:
+                ico2.add_to_list(q)
+                required_ops.update(op for op in (q.op1, q.op2) if isinstance(op, Operand))
+            elif isinstance(q, Store) and q.indirect:
+                # a store through a pointer changes memory which
+                # is not the variable's own, so it is always required
+                ico2.add_to_list(q)
+                required_ops.update(
+                    op for op in (q.dest, q.op1, q.op2) if isinstance(op, Operand)
+                )
+            elif q.dest in required_ops:
+                # a store to an element or a field (operator []=) is
+                # required if the variable is, like an assignment
+                ico2.add_to_list(q)
+                if isinstance(q.op1, Operand):
+                    required_ops.add(q.op1)
+                if isinstance(q.op2, Operand):
+                    required_ops.add(q.op2)
+                elif isinstance(q.op2, CompositeValue):
+                    required_ops.update(q.op2.operands())
+
+        if len(required_ops) == num_required:
+            break
 
     ico2.code_list = ico2.code_list[::-1]
 
@@ -306,17 +386,34 @@ def remove_deadcode(ic):
 def copy_prop(ic):
     copy_prop_vars = {}
     ico = IntermediateCode()
+    # variables whose address is taken can be changed through pointers,
+    # their copies are not the same after that
+    escaped = {
+        q.op1 for q in ic.code_list if isinstance(q, AddressOf) and isinstance(q.op1, ActualVar)
+    }
 
     for q in ic.code_list:
-        if isinstance(q, Assign):
-            if isinstance(q.dest, ActualVar):
-                if isinstance(q.op2, ActualVar) and not q.op2.is_const():
-                    copy_prop_vars[q.dest] = q.op2
-                    continue
-        if q.op1 in copy_prop_vars:
+        if q.operator == "LABEL":
+            # a label can be reached from a goto, where the
+            # copies (made after the goto) are not made yet
+            copy_prop_vars.clear()
+        # the address of a variable is not the address of its copy
+        if q.op1 in copy_prop_vars and q.operator != "base":
             q.op1 = copy_prop_vars[q.op1]
         if q.op2 in copy_prop_vars:
             q.op2 = copy_prop_vars[q.op2]
+        elif isinstance(q.op2, CompositeValue):
+            q.op2 = q.op2.replace(copy_prop_vars)
+
+        if isinstance(q.dest, ActualVar):
+            # a copy is not valid anymore once either of them changes,
+            # so the assignment is kept (dead code elimination removes
+            # it if it isn't used)
+            for var in [k for k, v in copy_prop_vars.items() if q.dest in (k, v)]:
+                copy_prop_vars.pop(var)
+            if isinstance(q, Assign):
+                if isinstance(q.op2, ActualVar) and not q.op2.is_const() and q.op2 not in escaped:
+                    copy_prop_vars[q.dest] = q.op2
         ico.add_to_list(q)
 
     return ico
@@ -0,0 +1,1114 @@
+import io
+import os
+import re
+import sys
+import copy
+import bisect
+import random
+import shutil
+import argparse
+import tempfile
+import traceback
+import contextlib
+
+from typing import Dict, List, Optional, Set, Tuple
+
+import astdump
+import checker
+import conformance
+import diagnostics
+import fileset
+import go_lexer
+import go_parser
+import loader
+import syntree
+import utils
+
+from dataclasses import dataclass
+from diagnostics import Diagnostic
+from fileset import NoPos
+from go_lexer import symtab
+from symbol_table import SymbolInfo, predefined_identifiers
+
+
+# Incremental parsing of the files of a package, for editors which parse a
+# file again at each change. An edit lexes and parses again the top level
+# declarations it changes, and the ones referring to the names they declare
+# in any file of the package (when only the body of a function changes,
+# the ones referring to it are kept). The nodes of the other declarations
+# are kept, moved by the edit. The AST is the one parse_package makes of
+# the files edited, and it is type checked the same way:
+#
+#   tree = incremental.parse(package)
+#   tree.edit("main.go", incremental.Edit(offset, length, "text"))
+#   checker.check_package(tree.package.ast, imports)
+#
+# A declaration is the text from the line of its keyword up to the next
+# one. The ones with a syntax error, or which the parser doesn't end there
+# (like at an unbalanced brace), are parsed with the next one. The header
+# of a file is its package clause and its imports, an edit of the header
+# parses the whole file again. The scopes of the declarations
+# parsed again are numbered after the ones of the others, so the AST is
+# not the one the intermediate code is generated from.
+#
+#   python incremental.py tests --edits 20
+#
+# checks it: the files of the programs are edited at random and parsed both
+# ways, the ASTs and the diagnostics found in them have to be the same. The
+# diagnostics of each program checked by lsp.Program (which the language
+# server and the watch mode use) are compared with a full check first.
+
+# the keywords of the top level declarations
+keywords = ("KW_FUNC", "KW_VAR", "KW_CONST", "KW_TYPE", "KW_IMPORT")
+
+
+@dataclass
+class Edit:
+    """Replaces the length characters at offset in the text of a file by
+    text, like a TextEdit of LSP (the offsets count characters)"""
+
+    offset: int
+    length: int
+    text: str
+
+    @property
+    def end(self) -> int:
+        return self.offset + self.length
+
+    def apply(self, source: str) -> str:
+        return source[:self.offset] + self.text + source[self.end:]
+
+
+class Decl:
+    """A top level declaration of a file, its text from start to end (or
+    the header of the file). items are the nodes the parser made of it,
+    before they are optimized (see syntree.postprocess_AST), commented the
+    ones which can have comments, comments its comments as (pos, text),
+    errors the diagnostics the parser reported in it and type_refs
+    its syntree.TypeRefs"""
+
+    def __init__(self, start: int, end: int, tokens: list, header: bool):
+        self.start = start
+        self.end = end
+        self.header = header
+        self.idents = {tok.value[1] for tok in tokens if tok.type == "IDENTIFIER"}
+        # the names it declares at the package level, the one of a method,
+        # with the ones declare_package_names finds in it (like the a of
+        # func var a = 5). The parser declares its types before the files
+        # are parsed, and adds its constants and variables
+        self.types = {ident[1] for ident, _ in go_parser.package_types(tokens)}
+        self.values = set(go_parser.package_values(tokens)) - {"_"}
+        self.names = declared_names(tokens) | self.types | self.values
+        self.function = bool(tokens) and tokens[0].type == "KW_FUNC"
+        self.imports = bool(tokens) and tokens[0].type == "KW_IMPORT"
+        self.outline = outline(tokens)
+        self.outline_idents = {value for type_, value in self.outline if type_ == "IDENTIFIER"}
+        self.items: list = []
+        self.commented: list = []
+        self.comments: list = []
+        self.errors: List[Diagnostic] = []
+        # the parser reported a syntax error in it or didn't end a declaration
+        # at its end (like at an unbalanced brace), the next one is parsed with it
+        self.joined = False
+        self.type_refs: List[syntree.TypeRef] = []
+        # the package level symbols of its constants and variables, with the
+        # type and the value the parser gave them, as (symbol, type_, constant)
+        self.declared: list = []
+        # what its nodes were optimized to, with their children before, see
+        # Tree.optimize
+        self.optimized: Dict[syntree.Node, Tuple[syntree.Node, syntree.Node, list]] = {}
+
+    def unclosed(self) -> bool:
+        """If it has a quote or a comment the lexer found no end of, the
+        ones closing it later make the text up to them a token"""
+        return any(
+            d.code == "UnclosedComment"
+            or d.code == "IllegalCharacter"
+            and d.message in ('Illegal character "', "Illegal character `")
+            for d in self.errors
+        )
+
+    def __repr__(self):
+        return f"Decl({self.start}, {self.end}, {sorted(self.names)})"
+
+
+class Source:
+    """A file of the package: its text, the fileset.File of the positions of
+    its nodes, its File node and its declarations, which cover its text
+    (the first one is its header)"""
+
+    def __init__(self, filename: str, text: str):
+        self.filename = filename
+        self.text = text
+        self.file = fileset.File(None, 1, text)
+        self.node: Optional[syntree.File] = None
+        # the List of its imports, from its header
+        self.imports: Optional[syntree.Node] = None
+        # the name in its package clause
+        self.package_name = None
+        self.decls: List[Decl] = []
+
+    def lines(self, decl: Decl) -> Tuple[int, int]:
+        """The first and the last line of the declaration"""
+        first = bisect.bisect_right(self.file.lines, decl.start)
+        return first, max(first, bisect.bisect_right(self.file.lines, decl.end - 1))
+
+    def decl_at(self, offset: int) -> Decl:
+        """The declaration the character at offset is in"""
+        starts = [decl.start for decl in self.decls]
+        return self.decls[max(bisect.bisect_right(starts, offset) - 1, 0)]
+
+    def decl_at_line(self, lineno) -> Decl:
+        if not isinstance(lineno, int) or lineno < 1:
+            return self.decls[0]
+        return self.decl_at(self.file.lines[min(lineno, len(self.file.lines)) - 1])
+
+    def decl_of_diagnostic(self, d: Diagnostic) -> Decl:
+        """The declaration a diagnostic is in. The ';' of a newline is at the
+        start of the next line, it ends the declaration before"""
+        if not isinstance(d.lineno, int) or d.lineno > len(self.file.lines) or d.col_num is None:
+            return self.decl_at_line(d.lineno)
+        offset = self.file.lines[d.lineno - 1] + d.col_num - 1
+        if d.message == "unexpected ;" and self.text[offset:offset + 1] != ";":
+            offset -= 1
+        return self.decl_at(max(offset, 0))
+
+    def decl_of(self, node) -> Decl:
+        """The declaration of a node, by its position (or its line)"""
+        nodes = [node] + checker.in_order(node)
+        for n in nodes:
+            if getattr(n, "pos", NoPos) != NoPos:
+                return self.decl_at(self.file.offset(n.pos))
+        for n in nodes:
+            lineno = n.data[1] if isinstance(n, syntree.Function) else getattr(n, "lineno", None)
+            if isinstance(lineno, int):
+                return self.decl_at_line(lineno)
+        return self.decls[-1]
+
+
+def declared_names(tokens: list) -> Set[str]:
+    """The names declared by the tokens of a top level declaration (or
+    the name of its method)"""
+    if not tokens:
+        return set()
+    if tokens[0].type == "KW_FUNC":
+        i = 1
+        if i < len(tokens) and tokens[i].type == "(":
+            # after the receiver of a method
+            depth = 0
+            while i < len(tokens):
+                depth += {"(": 1, ")": -1}.get(tokens[i].type, 0)
+                i += 1
+                if depth == 0:
+                    break
+        return {tokens[i].value[1]} if i < len(tokens) and tokens[i].type == "IDENTIFIER" else set()
+    if tokens[0].type in ("KW_VAR", "KW_CONST"):
+        return set(go_parser.package_values(tokens))
+    names = set()
+    if tokens[0].type == "KW_TYPE":
+        # the first identifier of each TypeSpec
+        group = len(tokens) > 1 and tokens[1].type == "("
+        depth = 0
+        for i, tok in enumerate(tokens[1:], 1):
+            if tok.type in ("{", "LIT_LBRACE", "(", "["):
+                depth += 1
+            elif tok.type in ("}", ")", "]"):
+                depth -= 1
+            elif tok.type == "IDENTIFIER" and (
+                    i == 1 if not group else depth == 1 and tokens[i - 1].type in ("(", ";")):
+                names.add(tok.value[1])
+    return names
+
+
+def outline(tokens: list) -> tuple:
+    """The tokens of a top level declaration but the body of its function,
+    as (type, value) without their positions"""
+    end = len(tokens)
+    if tokens and tokens[0].type == "KW_FUNC":
+        i = end - 1
+        while i > 0 and tokens[i].type == ";":
+            i -= 1
+        if tokens[i].type == "}":
+            depth = 0
+            for j in range(i, 0, -1):
+                if tokens[j].type == "}":
+                    depth += 1
+                elif tokens[j].type in ("{", "LIT_LBRACE"):
+                    depth -= 1
+                if depth == 0:
+                    end = j
+                    break
+    return tuple(
+        (tok.type, tok.value[1] if tok.type == "IDENTIFIER" else tok.value) for tok in tokens[:end]
+    )
+
+
+def split(text: str, start: int, header: bool) -> Tuple[List[Decl], bool]:
+    """The declarations of text, the part of a file at offset start (the start
+    of a line), and whether it ends them: its tokens are the same when it is
+    lexed with the rest of the file, which they wouldn't be after an unclosed
+    comment or brace, or a line not ending a statement. If header, text
+    starts the file and its first declaration is the header"""
+    found: list = []
+    with capturing(found):
+        tokens = go_lexer.tokenize(text)
+    starts = [(0, 0)]
+    depth = 0
+    # the '(' not closed in each block, like go_parser.TokenStream counts them
+    parens = [0]
+    for i, tok in enumerate(tokens):
+        if tok.type in ("{", "LIT_LBRACE"):
+            parens.append(0)
+        elif tok.type == "}" and len(parens) > 1:
+            parens.pop()
+        elif tok.type == "(":
+            parens[-1] += 1
+        elif tok.type == ")" and parens[-1] > 0:
+            parens[-1] -= 1
+        if tok.type in ("{", "LIT_LBRACE", "(", "["):
+            depth += 1
+        elif tok.type in ("}", ")", "]"):
+            depth -= 1
+        elif depth == 0 and parens == [0] and tok.type in keywords and i > 0 \
+                and tokens[i - 1].type == ";" \
+                and not (header and len(starts) == 1 and tok.type == "KW_IMPORT"):
+            line_start = text.rfind("\n", 0, tok.lexpos) + 1
+            if line_start > starts[-1][0] and not text[line_start:tok.lexpos].strip():
+                starts.append((line_start, i))
+    complete = not found and depth == 0 and parens == [0] and (not tokens or tokens[-1].type == ";")
+    decls = []
+    for k, (offset, first) in enumerate(starts):
+        end, last = starts[k + 1] if k + 1 < len(starts) else (len(text), len(tokens))
+        decls.append(Decl(start + offset, start + end, tokens[first:last], header and k == 0))
+    return decls, complete
+
+
+def blank(text: str) -> str:
+    """The text with spaces in place of all but its line breaks, the lines
+    and the columns of the text around it stay the same"""
+    return re.sub("[^\n]", " ", text)
+
+
+def source_lines(text: str) -> List[str]:
+    """The lines of the text of a file, like the ones go_lexer.set_input
+    makes (see utils.sources)"""
+    return (text if text.endswith("\n") else text + "\n").split("\n")
+
+
+@contextlib.contextmanager
+def capturing(found: list):
+    """The diagnostics reported in the block are added to found, they
+    are neither printed nor kept"""
+    was_printing, count = diagnostics.printing, len(diagnostics.reported)
+    diagnostics.printing = False
+    try:
+        yield
+    finally:
+        found.extend(diagnostics.reported[count:])
+        del diagnostics.reported[count:]
+        diagnostics.printing = was_printing
+
+
+# the nodes whose identifier is their own, it has no position
+owning_ident = (syntree.InterfaceMethod, syntree.TypeSwitchStmt, syntree.TypeCaseClause)
+
+
+class Move:
+    """Moves what a declaration kept by an edit was parsed to, from its span
+    in the file before the edit (old, from start to end) to the file after
+    it (new), delta characters and lines lines further. The nodes it refers
+    to in other declarations are left as they are. seen are the objects
+    moved already"""
+
+    def __init__(self, old: fileset.File, new: fileset.File, start: int, end: int,
+                 delta: int, lines: int, seen: Set[int]):
+        self.old = old
+        self.new = new
+        self.start = old.pos(start)
+        self.end = old.pos(end)
+        self.delta = delta
+        self.lines = lines
+        self.seen = seen
+
+    def pos(self, pos: int) -> int:
+        if self.start <= pos <= self.end:
+            return self.new.pos(self.old.offset(pos) + self.delta)
+        return pos
+
+    def line(self, lineno):
+        return lineno + self.lines if isinstance(lineno, int) else lineno
+
+    def value(self, value, child: bool = False, declared: bool = False):
+        """Moves value and what is under it. The types without a position are
+        only moved as children (else they can be the ones of other
+        declarations), the named types where they are declared"""
+        if isinstance(value, (list, tuple)):
+            for item in value:
+                self.value(item, child)
+            return
+        if type(value).__module__ != "syntree" or not hasattr(value, "__dict__") \
+                or id(value) in self.seen:
+            return
+        pos = getattr(value, "pos", NoPos)
+        if pos != NoPos and not self.start <= pos <= self.end:
+            return
+        if isinstance(value, syntree.NamedType) and not declared \
+                or isinstance(value, syntree.Type) and pos == NoPos and not child:
+            return
+        self.seen.add(id(value))
+        attrs = vars(value)
+        for name in ("pos", "end"):
+            if attrs.get(name, NoPos) != NoPos:
+                attrs[name] = self.pos(attrs[name])
+        if "_decl_span" in attrs:
+            value._decl_span = tuple(map(self.pos, value._decl_span))
+        if "lineno" in attrs:
+            attrs["lineno"] = self.line(attrs["lineno"])
+        if isinstance(value, syntree.Identifier):
+            value.data = (value.data[0], self.line(value.data[1]), value.data[2])
+        elif isinstance(value, syntree.Function):
+            value.data = (value.data[0], self.line(value.data[1]))
+        for name, attr in list(attrs.items()):
+            if name in syntree._references and name != "receiver" \
+                    and not isinstance(value, owning_ident):
+                # the nodes it refers to in the declaration, the receiver of a
+                # call is made of its selector (without a position)
+                if getattr(attr, "pos", NoPos) != NoPos:
+                    self.value(attr)
+            elif name not in ("children", "doc", "comment", "methods", "instances", "origin"):
+                self.value(attr)
+        if isinstance(value, syntree.Node):
+            for c in value.children:
+                self.value(c, True, isinstance(value, syntree.TypeDef))
+
+    def diagnostic(self, d: Diagnostic):
+        d.lineno = self.line(d.lineno)
+        if d.fix is not None and d.fix.file == d.file:
+            d.fix.lineno = self.line(d.fix.lineno)
+        for note in d.notes:
+            if note.file == d.file:
+                note.lineno = self.line(note.lineno)
+
+    def decl(self, decl: Decl):
+        self.value(decl.items)
+        # and the ones its nodes had before they were optimized
+        for _, _, children in decl.optimized.values():
+            self.value(children, True)
+        self.value(decl.commented)
+        for ref in decl.type_refs:
+            ref.pos, ref.end = self.pos(ref.pos), self.pos(ref.end)
+        decl.comments = [(self.pos(pos), text) for pos, text in decl.comments]
+        for d in decl.errors:
+            self.diagnostic(d)
+
+
+class Tree:
+    """The files of a package being edited, see parse. The AST is package.ast
+    and the symbols package.symbols, like after go_parser.parse_package"""
+
+    def __init__(self, package: loader.Package, dependency: bool = False):
+        self.package = package
+        self.dependency = dependency
+        self.sources: Dict[str, Source] = {}
+        # the declarations the last edit parsed
+        self.parsed: List[Decl] = []
+
+    def text(self, filename: str) -> str:
+        return self.sources[filename].text
+
+    def diagnostics(self) -> List[Diagnostic]:
+        """What the parser reported in the files (like the syntax errors),
+        in the order of the files and of their declarations"""
+        return [d for filename in self.package.files
+                for decl in self.sources[filename].decls for d in decl.errors]
+
+    def parse_all(self, texts: Dict[str, str]):
+        """Parses the files of the package, texts are their text by name"""
+        package = self.package
+        go_parser.start_package(package, self.dependency, texts)
+        self.sources = {}
+        parsed = {}
+        for filename in package.files:
+            s = self.sources[filename] = Source(filename, texts[filename])
+            s.decls, _ = split(s.text, 0, True)
+            parsed[filename] = {id(decl) for decl in s.decls}
+            self.parse_file(s, s.text, parsed[filename])
+        package.symbols = symtab.symbols
+        package.ast = go_parser.ast
+        self.order_methods({})
+        self.finish(parsed)
+        self.parsed = [decl for s in self.sources.values() for decl in s.decls]
+
+    def parse_file(self, s: Source, text: str, parsed: Set[int]) -> bool:
+        """Parses text, the text of the file s where the declarations other
+        than the ones parsed (their ids) are blank, and gives them what the
+        parser made of them. False if it made no File node"""
+        found: list = []
+        with capturing(found):
+            node = go_parser.parse_file(s.filename, text)
+        utils.sources[s.filename] = source_lines(s.text)
+        s.file = go_lexer.file
+        for decl in s.decls:
+            if id(decl) in parsed:
+                decl.items, decl.commented, decl.comments = [], [], []
+                decl.errors, decl.type_refs, decl.optimized = [], [], {}
+        for d in found:
+            decl = s.decl_of_diagnostic(d) if d.file == s.filename else s.decls[0]
+            if id(decl) in parsed:
+                decl.errors.append(d)
+        s.node = node
+        if node is None:
+            return False
+        s.package_name = go_parser.ast.data
+        if id(s.decls[0]) in parsed:
+            s.imports = None
+        for k, child in enumerate(node.children):
+            # the imports (if any) then the declarations, the Lists of the parser
+            if len(node.children) == 2 and k == 0 or len(node.children) == 1 and (
+                    not child.children
+                    or any(isinstance(n, syntree.Import) for n in checker.in_order(child))):
+                if id(s.decls[0]) in parsed:
+                    s.imports = child
+                continue
+            for item in reversed(child.children):
+                decl = s.decl_of(item)
+                if id(decl) in parsed:
+                    decl.items.append(item)
+        # the nodes kept don't go on in the ones parsed, they are joined to them
+        for decl in s.decls:
+            if id(decl) in parsed:
+                symbols = [symtab.stack[0].get(name) for name in sorted(decl.values)]
+                decl.declared = [(sym, sym.type_, sym.constant) for sym in symbols
+                                 if sym is not None and sym.file == s.filename]
+                # and the ones the parser declared after a syntax error
+                first, last = s.lines(decl)
+                decl.names |= {sym.name for sym in symtab.stack[0].values()
+                               if sym.file == s.filename and isinstance(sym.lineno, int)
+                               and first <= sym.lineno <= last}
+
+        def span(item):
+            # the span of a BadDecl is the one of its ';', it starts on its line
+            start, end = map(s.file.offset, item._decl_span)
+            if isinstance(item, syntree.BadDecl) and isinstance(item.lineno, int):
+                start = min(start, s.file.lines[item.lineno - 1])
+            return start, end
+
+        spans = [span(item) for decl in s.decls if id(decl) in parsed
+                 for item in decl.items if hasattr(item, "_decl_span")]
+        for decl in s.decls:
+            if id(decl) in parsed:
+                # the ';' of a newline is at the start of the next line, the
+                # next declaration starts with a keyword. The parser doesn't
+                # report the syntax errors right after another one (a BadDecl)
+                decl.joined = bool(decl.errors) or any(
+                    start < decl.end and end > decl.end + 1 for start, end in spans) \
+                    or any(isinstance(item, syntree.BadDecl) for item in decl.items)
+        for n in go_parser.commented:
+            decl = s.decl_of(n)
+            if id(decl) in parsed:
+                decl.commented.append(n)
+        for pos, comment in go_lexer.comments:
+            decl = s.decl_at(s.file.offset(pos))
+            if id(decl) in parsed:
+                decl.comments.append((pos, comment))
+        for pos, ref in syntree.type_refs.items():
+            if s.file.base <= pos <= s.file.base + s.file.size:
+                decl = s.decl_at(s.file.offset(pos))
+                if id(decl) in parsed:
+                    decl.type_refs.append(ref)
+        return True
+
+    def order_methods(self, types: Dict[int, syntree.NamedType]):
+        """Adds the methods to their types in the order of their declarations,
+        like the parser does (the first one is kept for duplicates). types
+        are the ones which had methods before, by id"""
+        named = dict(types)
+        methods: Dict[int, list] = {key: [] for key in named}
+        for filename in self.package.files:
+            for decl in self.sources[filename].decls:
+                for m in methods_of(decl):
+                    named[id(m.base_type)] = m.base_type
+                    methods.setdefault(id(m.base_type), []).append(m)
+        for key, base_type in named.items():
+            base_type.methods.clear()
+            for m in methods[key]:
+                base_type.add_method(m)
+
+    def finish(self, parsed: Dict[str, Set[int]]):
+        """Makes the AST of the package once the declarations parsed (their
+        ids in each file) are, like syntree.postprocess_AST"""
+        for filename, ids in parsed.items():
+            s = self.sources[filename]
+            if s.node is None:
+                continue
+            for decl in s.decls:
+                if id(decl) in ids:
+                    decl.items = [syntree.postprocess(item) for item in decl.items]
+            if id(s.decls[0]) in ids and s.imports is not None:
+                s.imports = syntree.postprocess(s.imports)
+            imports = s.imports
+            items = [item for decl in s.decls for item in decl.items]
+            decls = syntree.List(list(reversed(items))) if items else None
+            if decls is not None:
+                decls.pos, decls.end = items[0]._decl_span[0], items[-1]._decl_span[1]
+            node = s.node
+            # the nodes kept were optimized in place, the Lists of the file
+            # are optimized with the children the parser gave them
+            if decls is not None:
+                decls.children = [self.as_parsed(s, item) for item in decls.children]
+            node.children = [self.as_parsed(s, child) if child is imports else child
+                             for child in (imports, decls) if child is not None]
+            syntree.optimize_children(node)
+            for i, child in enumerate(node.children):
+                if child is decls:
+                    decls = syntree.optimize_children(decls)
+                    for k, item in enumerate(decls.children):
+                        decls.children[k] = self.optimize(s, getattr(item, "_original", item))
+                    node.children[i] = decls
+                else:
+                    node.children[i] = self.optimize(s, getattr(child, "_original", child))
+            commented = [n for decl in s.decls for n in decl.commented]
+            for n in commented:
+                vars(n).pop("doc", None)
+                vars(n).pop("comment", None)
+            node.comments = syntree.comment_groups(
+                [c for decl in s.decls for c in decl.comments], s.file,
+                "\n".join(source_lines(s.text))
+            )
+            syntree.attach_comments(node.comments, commented)
+        files = [self.sources[f] for f in self.package.files if self.sources[f].node is not None]
+        self.package.ast.children = [s.node for s in reversed(files)]
+        if files:
+            self.package.ast.data = utils.package_name = files[-1].package_name
+        go_parser.set_members(self.package)
+
+    def optimize(self, s: Source, node: syntree.Node) -> syntree.Node:
+        """What syntree.optimize_AST makes of a node the List of the
+        declarations of a file has, the nodes kept are optimized once"""
+        memo = s.decl_of(node).optimized
+
+        def visit(n):
+            if not isinstance(n, syntree.Node):
+                return n
+            if n not in memo:
+                children = list(n.children)
+                result = syntree.optimize_children(n)
+                # before its children, a named type is in its own tree when
+                # a method of its interface (or a field of its struct) refers
+                # to it, like in optimize_AST
+                memo[n] = (n, result, children)
+                for i, child in enumerate(result.children):
+                    result.children[i] = visit(child)
+            return memo[n][1]
+
+        return visit(node)
+
+    def as_parsed(self, s: Source, node, depth: int = 2):
+        """A copy of the node with the children the parser gave it, and the
+        same for them down to depth (what optimize_children looks at). Its
+        _original is the node"""
+        if not isinstance(node, syntree.Node) or depth == 0:
+            return node
+        memo = s.decl_of(node).optimized
+        view = copy.copy(node)
+        view._original = node
+        children = memo[node][2] if node in memo else node.children
+        view.children = [self.as_parsed(s, child, depth - 1) for child in children]
+        return view
+
+    def edit(self, filename: str, edit: Edit) -> List[Decl]:
+        """Applies the edit to the file filename and parses again what it changes,
+        returns the declarations parsed"""
+        source = self.sources[filename]
+        if not 0 <= edit.offset <= edit.end <= len(source.text):
+            raise ValueError(f"{edit} is not in {filename}, of {len(source.text)} characters")
+        text = edit.apply(source.text)
+        delta = len(edit.text) - edit.length
+        decls = source.decls
+        # the declarations the edit is in, from i to j. The ones after are in
+        # too if they aren't lexed the same way, like after an unclosed brace,
+        # and the ones joined to the ones parsed. The ones before from one
+        # with an unclosed quote too, and the header if imports follow it
+        i = decls.index(source.decl_at(edit.offset))
+        j = decls.index(source.decl_at(edit.end))
+        i = next((k for k in range(i) if decls[k].unclosed()), i)
+        while True:
+            while i > 1 and decls[i - 1].joined:
+                i -= 1
+            while j < len(decls) - 1 and decls[j].joined:
+                j += 1
+            if i == 0:
+                j = len(decls) - 1
+            parts, complete = split(text[decls[i].start:decls[j].end + delta], decls[i].start, i == 0)
+            rest = [decl for decl in decls[1:i] + parts + decls[j + 1:] if decl.outline]
+            if i > 0 and (any(decl.imports for decl in parts) or rest and rest[0].imports):
+                i = 0
+            elif complete or j == len(decls) - 1:
+                break
+            else:
+                j = len(decls) - 1
+        old = decls[i:j + 1]
+        lines, parsed, same = self.affected(old, parts)
+
+        edit_line = bisect.bisect_right(source.file.lines, edit.end)
+        lines_delta = edit.text.count("\n") - source.text.count("\n", edit.offset, edit.end)
+        # where the declarations kept were before the edit, and how they move
+        moves: Dict[int, Tuple[int, int, int]] = {}
+        for s in self.sources.values():
+            for decl in s.decls:
+                if id(decl) not in parsed and all(decl is not d for d in old):
+                    moves[id(decl)] = (decl.start, 0, 0)
+        for decl in decls[j + 1:]:
+            if id(decl) in moves:
+                moves[id(decl)] = (decl.start, delta, lines_delta)
+            decl.start += delta
+            decl.end += delta
+        removed = old + [decl for s in self.sources.values() for decl in s.decls if id(decl) in parsed]
+        source.decls = decls[:i] + parts + decls[j + 1:]
+        source.text = text
+        if not self.reparse(parsed, removed, same, lines, moves, filename, edit_line, lines_delta):
+            return self.reparse_all(self.texts())
+        self.parsed = [decl for s in self.sources.values() for decl in s.decls if id(decl) in parsed]
+        # the declarations joined to the next one are parsed again with it, and
+        # with the ones parsed after it (the parser wasn't done with it there)
+        for s in self.sources.values():
+            for k, (decl, after) in enumerate(zip(s.decls, s.decls[1:]), 1):
+                if id(decl) in parsed and decl.joined and id(after) not in parsed:
+                    end = k
+                    later = [n for n in range(k + 1, len(s.decls)) if id(s.decls[n]) in parsed]
+                    if later:
+                        end = later[0]
+                        while end + 1 < len(s.decls) and id(s.decls[end + 1]) in parsed:
+                            end += 1
+                    start, stop = after.start, s.decls[end].end
+                    again = Edit(start, stop - start, s.text[start:stop])
+                    parsed |= {id(d) for d in self.edit(s.filename, again)}
+                    self.parsed = [d for s in self.sources.values() for d in s.decls if id(d) in parsed]
+                    return self.parsed
+        return self.parsed
+
+    def texts(self) -> Dict[str, str]:
+        return {filename: s.text for filename, s in self.sources.items()}
+
+    def reparse_all(self, texts: Dict[str, str]) -> List[Decl]:
+        self.package.symbols.clear()
+        self.parse_all(texts)
+        return self.parsed
+
+    def affected(self, old: List[Decl], parts: List[Decl]):
+        """The declarations to parse again when the old ones of a file are
+        replaced by the parts: the lines of the ones they replace in each file,
+        their ids, and the pairs of functions declaring the same (the ones
+        whose outline and package level names are the same), new by old"""
+        same: Dict[int, Decl] = {}
+        unmatched = [decl for decl in old if decl.function]
+        for decl in parts:
+            for o in unmatched:
+                if decl.function and decl.outline == o.outline \
+                        and (decl.types, decl.values) == (o.types, o.values):
+                    same[id(decl)] = o
+                    unmatched.remove(o)
+                    break
+        matched = {id(o) for o in same.values()}
+        # the names whose declarations change, the declarations referring to
+        # them are parsed again. The ones of a function declaring the same
+        # change only if its outline refers to names which change
+        names: Set[str] = set()
+        for decl in old + parts:
+            if id(decl) not in matched and id(decl) not in same:
+                names |= decl.names
+        parsed = {id(decl) for decl in parts}
+        # the files the parser made no File node of have no nodes to keep
+        parsed.update(id(decl) for s in self.sources.values() if s.node is None
+                      for decl in s.decls)
+        others = [decl for s in self.sources.values() for decl in s.decls[1:]
+                  if all(decl is not d for d in old)]
+        while True:
+            count = len(names), len(parsed)
+            for decl in parts + [decl for decl in others if id(decl) in parsed]:
+                unchanged = decl.function and (id(decl) in same or all(decl is not d for d in parts))
+                if not unchanged or decl.outline_idents & names:
+                    names |= decl.names
+            parsed.update(id(decl) for decl in others if decl.idents & names)
+            for s in self.sources.values():
+                # the header is parsed with the file
+                reparsed = any(id(decl) in parsed for decl in s.decls)
+                for decl, after in zip(s.decls, s.decls[1:]):
+                    if decl.joined and (id(decl) in parsed or id(after) in parsed
+                                        or decl.header and reparsed):
+                        parsed.add(id(after))
+                        if not decl.header:
+                            parsed.add(id(decl))
+            if (len(names), len(parsed)) == count:
+                break
+        for decl in parts:
+            o = same.get(id(decl))
+            if o is not None and decl.outline_idents & names:
+                del same[id(decl)]
+        lines = {}
+        for s in self.sources.values():
+            lines[s.filename] = [s.lines(decl) for decl in s.decls
+                                 if id(decl) in parsed or any(decl is d for d in old)]
+        return lines, parsed, same
+
+    def hidden(self, symbols: List[SymbolInfo]) -> list:
+        """The package level symbols of the declarations kept, which the parser
+        doesn't find before their declaration: the types it declares first
+        are found, the constants and the variables are not declared yet and
+        the others don't exist. As (where, symbol, what it is once declared),
+        in order, what it is is None for the ones which don't exist"""
+        order = {filename: k for k, filename in enumerate(self.package.files)}
+        lines = {filename: fileset.File(None, 1, s.text).lines for filename, s in self.sources.items()}
+        hidden = []
+        for sym in symbols:
+            if sym.scope_id != "1" or sym.file not in self.sources or not isinstance(sym.lineno, int) \
+                    or sym.lineno < 1:
+                continue
+            s = self.sources[sym.file]
+            decl = s.decl_at(lines[sym.file][min(sym.lineno, len(lines[sym.file])) - 1])
+            if sym.name not in decl.types:
+                saved = dict(vars(sym)) if sym.name in decl.values else None
+                hidden.append(((order[sym.file], decl.start), sym, saved))
+        hidden.sort(key=lambda h: h[0])
+        return hidden
+
+    def show(self, sym: SymbolInfo, saved: Optional[dict]):
+        """Makes a symbol of hidden found, like once its declaration is parsed"""
+        if saved is None:
+            symtab.stack[0][sym.name] = sym
+        else:
+            vars(sym).update(saved)
+
+    def reparse(self, parsed: Set[int], removed: List[Decl], same: Dict[int, Decl],
+                lines: Dict[str, list], moves: Dict[int, tuple], edited: str,
+                edit_line: int, lines_delta: int) -> bool:
+        """Parses the declarations parsed (their ids) in place of the removed
+        ones, whose lines were the lines of each file. moves are the declarations
+        kept, with their start before the edit of the file edited and how they
+        move: the lines after edit_line move by lines_delta. same are the
+        functions declaring the same as removed ones. False if a file
+        has no File node"""
+        package = self.package
+        files = [f for f in package.files if any(id(d) in parsed for d in self.sources[f].decls)]
+        # the type checker completes the constants the parser doesn't
+        # evaluate, the parser finds them as it left them
+        for s in self.sources.values():
+            for decl in s.decls:
+                if id(decl) not in parsed:
+                    for sym, type_, constant in decl.declared:
+                        sym.type_, sym.constant = type_, constant
+
+        # the symbols of the declarations parsed again are made again, but the
+        # package level ones stay the same (the nodes kept refer to them), they
+        # are reused once added again. Their scopes are numbered after the others
+        symbols = []
+        reused = {}
+        top = 0
+        # the names declare_package_names adds for the declarations kept, the
+        # ones the parser didn't declare have no line (unlike the predeclared
+        # ones, they have no value)
+        kept = {name for s in self.sources.values() for decl in s.decls
+                if id(decl) not in parsed for name in decl.values}
+        # the predeclared ones a declaration parsed again overrode are
+        # predeclared again. The header is parsed again, its imports too
+        symtab.switch([])
+        go_parser.declare_variables(predefined_identifiers)
+        universe = dict(symtab.stack[0])
+        for sym in package.symbols:
+            scope = sym.scope_id.split(".")
+            if len(scope) > 1:
+                top = max(top, int(scope[1]))
+            if sym.scope_id == "1" and sym.lineno is None and sym.value is None and sym.name not in kept \
+                    or sym.scope_id == "1" and isinstance(sym.value, syntree.Package) and sym.file in files \
+                    or sym.file in lines and isinstance(sym.lineno, int) \
+                    and any(first <= sym.lineno <= last for first, last in lines[sym.file]):
+                if sym.name in universe and sym.scope_id == "1":
+                    vars(sym).update(vars(universe[sym.name]))
+                    symbols.append(sym)
+                elif sym.scope_id == "1":
+                    sym.lineno = sym.col_num = sym.type_ = sym.value = sym.constant = None
+                    sym.file = sym.group = None
+                    sym.const = sym.const_flag = False
+                    sym.uses = []
+                    reused[sym.name] = sym
+                continue
+            if sym.file == edited and isinstance(sym.lineno, int) and sym.lineno > edit_line:
+                sym.lineno += lines_delta
+            if sym.file == edited and sym.scope_id != "1":
+                sym.uses = [u + lines_delta if isinstance(u, int) and u > edit_line else u
+                            for u in sym.uses]
+            symbols.append(sym)
+
+        # the methods of the types are added again, and the instances of
+        # the generic types made of names which change are made again
+        types = {}
+        names = set()
+        for decl in removed:
+            names |= decl.names
+            for m in methods_of(decl):
+                types[id(m.base_type)] = m.base_type
+                # the calls parsed again find the new one
+                if m.base_type.methods.get(m.fn_name[1]) is m:
+                    del m.base_type.methods[m.fn_name[1]]
+        changed = re.compile(r"\b(" + "|".join(map(re.escape, sorted(names))) + r")\b") \
+            if names else None
+        for sym in symbols:
+            if isinstance(sym.value, syntree.NamedType) and changed is not None:
+                for key in [k for k in sym.value.instances if changed.search(k)]:
+                    del sym.value.instances[key]
+
+        # the header of a file is parsed with it, for its package clause
+        hidden = self.hidden(symbols)
+        texts = {}
+        for filename in files:
+            s = self.sources[filename]
+            texts[filename] = "".join(
+                s.text[decl.start:decl.end] if id(decl) in parsed or decl.header
+                else blank(s.text[decl.start:decl.end])
+                for decl in s.decls
+            )
+        old_files = {filename: self.sources[filename].file for filename in files}
+        go_parser.ast = syntree.Node("start", children=[])
+        symtab.switch(symbols, reused)
+        symtab.scopes_at_depth[2] = top
+        go_parser.import_packages(package, self.dependency)
+        go_parser.declare_package_names(package, texts)
+        # (the ones of the declarations kept are blank in the texts)
+        go_parser.forward_values.update(kept - {"_"})
+        for name in sorted(kept - {"_"}):
+            symtab.add_if_not_exists(name)
+        for _, sym, saved in hidden:
+            if saved is None:
+                symtab.stack[0].pop(sym.name, None)
+            else:
+                vars(sym).update(vars(SymbolInfo(sym.name, "1", uses=sym.uses)))
+        # the parser reports the syntax errors after the ones it recovered
+        # from once it has read 3 tokens, a declaration kept (blank in the
+        # text) has more than that
+        order = {filename: k for k, filename in enumerate(package.files)}
+        resumed = sorted(
+            (order[filename], decl.start)
+            for filename in files for prev, decl in zip(self.sources[filename].decls,
+                                                        self.sources[filename].decls[1:])
+            if id(decl) in parsed and id(prev) not in parsed and not prev.header
+        )
+        index = 0
+
+        def passed(tok):
+            # the symbols declared before the token are found from now on
+            # (the ';' of a newline is at the start of the next line)
+            if tok.type == ";":
+                return
+            at = (index, go_lexer.file.offset(tok.pos))
+            while hidden and hidden[0][0] <= at:
+                self.show(*hidden.pop(0)[1:])
+            while resumed and resumed[0] <= at:
+                resumed.pop(0)
+                if not go_parser.token_stream.skipping:
+                    go_parser.parser.errok()
+
+        go_parser.token_stream.watch = passed
+        try:
+            for index, filename in enumerate(package.files):
+                if filename in files and not self.parse_file(self.sources[filename], texts[filename], parsed):
+                    return False
+        finally:
+            go_parser.token_stream.watch = None
+            for _, sym, saved in hidden:
+                self.show(sym, saved)
+        symtab.reused = {}
+        package.symbols = symtab.symbols
+
+        # the declarations kept are moved to the files parsed again
+        seen: Set[int] = set()
+        for filename in files:
+            s, old_file = self.sources[filename], old_files[filename]
+            for key in [pos for pos in syntree.type_refs
+                        if old_file.base <= pos <= old_file.base + old_file.size]:
+                del syntree.type_refs[key]
+            for k, decl in enumerate(s.decls):
+                if id(decl) in parsed:
+                    continue
+                # its nodes go on in the declarations it is joined to
+                end = k
+                while s.decls[end].joined and end + 1 < len(s.decls) and id(s.decls[end + 1]) not in parsed:
+                    end += 1
+                start, delta, lines = moves[id(decl)]
+                # the ';' at the end of the file is after the newline the lexer adds
+                last = s.decls[end].end - decl.start + (end == len(s.decls) - 1)
+                Move(old_file, s.file, start, start + last, delta, lines, seen).decl(decl)
+                for ref in decl.type_refs:
+                    syntree.type_refs[ref.pos] = ref
+        # the functions declaring the same are the ones the nodes kept refer to
+        replaced = {}
+        for decl in [d for s in self.sources.values() for d in s.decls if id(d) in same]:
+            o = same[id(decl)]
+            if o.items and decl.items and isinstance(decl.items[0], type(o.items[0])):
+                replaced[id(o.items[0])] = decl.items[0]
+        if replaced:
+            for s in self.sources.values():
+                for decl in s.decls:
+                    if id(decl) not in parsed:
+                        for n in syntree.walk(decl.items):
+                            if id(getattr(n, "method", None)) in replaced:
+                                n.method = replaced[id(n.method)]
+        self.order_methods(types)
+        self.finish({filename: parsed for filename in files})
+        return True
+
+
+def methods_of(decl: Decl) -> list:
+    """The methods of the declaration, of named types"""
+    return [m for item in decl.items for m in checker.in_order(item)
+            if isinstance(m, syntree.Method) and isinstance(m.base_type, syntree.NamedType)]
+
+
+def parse(package: loader.Package, dependency: bool = False) -> Tree:
+    """Parses the files of the package, like go_parser.parse_package, for edits
+    of them (see Tree.edit). The packages it imports have to be parsed before"""
+    tree = Tree(package, dependency)
+    tree.parse_all({filename: utils.read_source(filename) for filename in package.files})
+    return tree
+
+
+# the text the edits of the check insert, parts of declarations and
+# statements, and what changes the lines and the scopes around them
+fragments = [
+    "\n", " ", "x", "1", "_", "{", "}", "(", ")", "[", "]", ",", ";", ":=", "=", "\"", "`",
+    "/*", "*/", "// c\n", "var v = 1\n", "const c = 2\n", "type T int\n", "func g() {}\n",
+    "func (T) M() {}\n", "return\n", "x := 1\n", "import \"fmt\"\n", "int", "string",
+    "type S struct{ f int }\n", "func init() {}\n",
+]
+
+
+def random_edit(text: str, rng: random.Random) -> Edit:
+    """A random edit of text: a part removed, replaced or repeated, a line
+    removed or repeated, or a fragment or an identifier of text inserted"""
+    offset = rng.randrange(len(text) + 1)
+    length = min(len(text) - offset, rng.randint(0, 12))
+    kind = rng.random()
+    if kind < 0.25:
+        return Edit(offset, length, "")
+    if kind < 0.6:
+        return Edit(offset, 0, rng.choice(fragments))
+    if kind < 0.75:
+        idents = re.findall(r"[A-Za-z_]\w*", text)
+        return Edit(offset, 0, rng.choice(idents) if idents else "x")
+    if kind < 0.85:
+        return Edit(offset, length, text[offset:offset + length] * 2)
+    starts = [0] + [m.end() for m in re.finditer("\n", text)]
+    start = rng.choice(starts)
+    end = text.find("\n", start) + 1 or len(text)
+    return Edit(start, end - start, "" if kind < 0.93 else text[start:end] * 2)
+
+
+def keys(found: List[Diagnostic]) -> list:
+    return sorted((str(d.file), str(d.lineno), str(d.col_num), d.message) for d in found)
+
+
+def spans(ast: syntree.Node) -> list:
+    """The classes and the spans of the nodes, as positions in their files"""
+    def where(pos):
+        p = fileset.fset.position(pos)
+        return p.filename, p.line, p.column
+    return [(type(n).__name__, where(n.pos), where(n.end)) for n in syntree.walk(ast)]
+
+
+def check(tree: Tree, package: loader.Package) -> list:
+    """Type checks the AST of the tree and the one of a full parse of its
+    files, the divergences between them"""
+    imports = {
+        path: (other.name, other.scope)
+        for path, other in package.imports.items() if other is not None
+    }
+    full = copy.copy(package)
+    parse_errors: list = []
+    with capturing(parse_errors):
+        go_parser.parse_package(full, False)
+    refs = [pos for pos in syntree.type_refs
+            if any(fileset.fset.file(pos) is f for f in fileset.fset.files[-len(package.files):])]
+    divergences = []
+    if keys(tree.diagnostics()) != keys(parse_errors):
+        divergences.append("parse diagnostics")
+    # the type checker sets the types of the nodes, the ones kept were checked
+    # before. It doesn't get through some programs with errors, the
+    # rest is left for those
+    with capturing([]), contextlib.suppress(Exception):
+        theirs, _ = checker.check_package(full.ast, imports)
+        mine, _ = checker.check_package(tree.package.ast, imports)
+        if keys(mine) != keys(theirs):
+            divergences.append("type check diagnostics")
+        if astdump.dump(tree.package.ast) != astdump.dump(full.ast):
+            divergences.append("AST")
+        elif spans(tree.package.ast) != spans(full.ast):
+            divergences.append("spans")
+    for pos in refs:
+        syntree.type_refs.pop(pos, None)
+    return divergences
+
+
+def check_program(program: str, edits: int, rng: random.Random) -> int:
+    """Edits the files of the program at random and checks its tree after
+    each edit, returns the number of divergences"""
+    dir = tempfile.mkdtemp(prefix="gopy-incremental-")
+    try:
+        path = os.path.join(dir, os.path.basename(program))
+        if os.path.isdir(program):
+            shutil.copytree(program, path)
+        else:
+            shutil.copy(program, path)
+        checked: list = []
+        with capturing(checked), contextlib.redirect_stdout(io.StringIO()):
+            packages = go_parser.check_program(path, verbose=False)
+        package = packages[-1]
+        # the language server (and the watch mode) check it with a tree
+        import lsp
+        with capturing([]), contextlib.redirect_stdout(io.StringIO()):
+            server = lsp.Program(path)
+        if keys(server.found) != keys(checked):
+            print(f"{program}: the diagnostics of lsp.Program differ", flush=True)
+            return 1
+        found: list = []
+        with capturing(found):
+            tree = parse(package)
+        for n in range(edits):
+            filename = rng.choice(package.files)
+            edit = random_edit(tree.text(filename), rng)
+            with capturing(found), contextlib.redirect_stdout(io.StringIO()):
+                tree.edit(filename, edit)
+                with open(filename, "wt", encoding="utf-8", errors="surrogateescape") as f:
+                    f.write(tree.text(filename))
+                divergences = check(tree, package)
+            if divergences:
+                print(f"{program}: edit {n} {edit} of {os.path.basename(filename)}: "
+                      f"{', '.join(divergences)} differ", flush=True)
+                return 1
+        return 0
+    finally:
+        shutil.rmtree(dir, ignore_errors=True)
+
+
+def main(argv: List[str]):
+    arg_parser = argparse.ArgumentParser(
+        prog="incremental.py", description="Checks the incremental parser against full parses"
+    )
+    arg_parser.add_argument("paths", nargs="*", default=["tests"],
+                            help="the programs, .go files or directories of them")
+    arg_parser.add_argument("--edits", type=int, default=20,
+                            help="the number of edits of each program")
+    arg_parser.add_argument("--seed", type=int, default=0, help="the seed of the edits")
+    args = arg_parser.parse_args(argv)
+
+    rng = random.Random(args.seed)
+    failed = 0
+    for program in conformance.programs(args.paths):
+        try:
+            failed += check_program(program, args.edits, rng)
+        except Exception:
+            print(f"{program}:\n{traceback.format_exc()}", flush=True)
+            failed += 1
+    return 1 if failed else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
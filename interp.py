@@ -0,0 +1,3997 @@
+import re
+import os
+import errno
+import bisect
+import sys
+import math
+import time
+import random
+import datetime
+import struct
+import functools
+import contextlib
+import collections
+import debug
+import cancel
+import checker
+import constant
+import diagnostics
+import fileset
+import lang
+import pyffi
+import sandbox
+import sched
+import syntree
+import untyped
+
+from decimal import Decimal
+from fractions import Fraction
+from typing import Any, Callable, Dict, Iterator, List, Optional, Set, Tuple
+from checker import (basic_typename, in_order, parameters, results, runtime_type_string,
+                     type_string, underlying)
+
+
+# The interpreter runs a type checked AST, walking it with scopes of its
+# own like the type checker does. The operands recorded by the checker
+# (see checker.Info) give the types of the expressions, and the values of
+# the constant ones. The REPL uses it, since the intermediate code is for
+# a machine which doesn't exist yet.
+#
+# Values of basic types are python ints (wrapped to the size of their
+# type), floats, complexes, bools and bytes for strings. Arrays are lists,
+# the values of the other composite types are the classes below, and nil
+# is None whatever its type is. Structs and arrays are copied when they
+# are assigned, the other values are references.
+# Ref: https://golang.org/ref/spec#Statements
+
+
+class Unsupported(Exception):
+    """Raised for what the interpreter can't run, like range over functions"""
+
+
+class Aborted(Exception):
+    """Raised once the program runs more steps than its budget (see
+    Interpreter.max_steps), it ends without running the deferred calls"""
+
+
+class GoRuntimeError:
+    """The value of the panics raised by the runtime, like for an
+    index out of range (it is a runtime.Error in Go)"""
+
+    def __init__(self, message: str):
+        self.message = message
+
+    def __str__(self):
+        return f"runtime error: {self.message}"
+
+
+class PlainError(GoRuntimeError):
+    """The value of the panics of the runtime which are printed without
+    "runtime error: ", like "send on closed channel" """
+
+    def __str__(self):
+        return self.message
+
+
+class TypeAssertionError(GoRuntimeError):
+    """The value of the panic of a failed type assertion"""
+
+    def __str__(self):
+        return f"interface conversion: {self.message}"
+
+
+class Panic(Exception):
+    """A panic, value is the (interface) value given to panic. trace is
+    the (function, line) of each frame it unwound, the innermost first,
+    line is the one of the statement running in the frame it is in"""
+
+    def __init__(self, value: Any):
+        super().__init__(value)
+        self.value = value
+        self.trace: List[Tuple[syntree.Function, Optional[int]]] = []
+        self.line: Optional[int] = None
+
+    def unwind(self, fn: syntree.Function):
+        """Leaves the frame of the function fn, the line is the end of
+        its body if it panics in one of the calls fn deferred"""
+        line = self.line
+        if line is None and fn.body is not None:
+            line = fileset.fset.position(fn.body.end).line or None
+        self.trace.append((fn, line))
+        self.line = None
+
+
+def runtime_error(message: str) -> Panic:
+    return Panic(GoRuntimeError(message))
+
+
+def nil_dereference() -> Panic:
+    return runtime_error("invalid memory address or nil pointer dereference")
+
+
+def promote(value: Any, ref: Optional["Ref"], path: list) -> Tuple[Any, Optional["Ref"]]:
+    """The field at the end of the path of fields of the struct value (or
+    of the struct it points to), and the variable it is if value is one"""
+    for field in path:
+        if isinstance(value, Ref):
+            # p.x is (*p).x, so is the x of an embedded pointer
+            value = value.get()
+            ref = True
+        elif value is None:
+            raise nil_dereference()
+        ref = FieldRef(value, field.f_name) if ref is not None else None
+        value = value.fields[field.f_name]
+    return value, ref
+
+
+# statements leaving a loop, a switch or a function
+class _Break(Exception):
+    def __init__(self, label: Optional[str] = None):
+        self.label = label
+
+
+class _Continue(Exception):
+    def __init__(self, label: Optional[str] = None):
+        self.label = label
+
+
+class _Goto(Exception):
+    def __init__(self, label: str):
+        self.label = label
+
+
+class _Return(Exception):
+    def __init__(self, values: Optional[list] = None):
+        # None for a return without values
+        self.values = values
+
+
+class _Exit(Exception):
+    """os.Exit, it ends the program without running the deferred calls"""
+
+    def __init__(self, code: int):
+        self.code = code
+
+
+# values
+
+class Ref:
+    """A variable, the value of a pointer to it"""
+
+    def get(self) -> Any:
+        raise NotImplementedError
+
+    def set(self, value: Any):
+        raise NotImplementedError
+
+
+class Cell(Ref):
+    """A declared variable, or one made by new or &T{}"""
+
+    def __init__(self, value: Any = None):
+        self.value = value
+
+    def get(self) -> Any:
+        return self.value
+
+    def set(self, value: Any):
+        self.value = value
+
+
+class ElementRef(Ref):
+    """An element of an array, which can be the one of a slice"""
+
+    def __init__(self, array: list, index: int):
+        self.array = array
+        self.index = index
+
+    def get(self) -> Any:
+        return self.array[self.index]
+
+    def set(self, value: Any):
+        self.array[self.index] = value
+
+    def __eq__(self, other):
+        return (isinstance(other, ElementRef) and self.array is other.array
+                and self.index == other.index)
+
+    def __hash__(self):
+        return hash((id(self.array), self.index))
+
+
+class FieldRef(Ref):
+    """A field of a struct"""
+
+    def __init__(self, struct_: "StructValue", name: str):
+        self.struct = struct_
+        self.name = name
+
+    def get(self) -> Any:
+        return self.struct.fields[self.name]
+
+    def set(self, value: Any):
+        self.struct.fields[self.name] = value
+
+    def __eq__(self, other):
+        return (isinstance(other, FieldRef) and self.struct is other.struct
+                and self.name == other.name)
+
+    def __hash__(self):
+        return hash((id(self.struct), self.name))
+
+
+class MapRef(Ref):
+    """An element of a map, assignable but not addressable. zero is the
+    value of the elements not in the map"""
+
+    def __init__(self, map_: Optional["MapValue"], key: Any, zero: Any):
+        self.map = map_
+        self.key = key
+        self.zero = zero
+
+    def get(self) -> Any:
+        if self.map is None:
+            return self.zero
+        entry = self.map.entries.get(key_of(self.key))
+        return self.zero if entry is None else entry[1]
+
+    def set(self, value: Any):
+        if self.map is None:
+            raise runtime_error("assignment to entry in nil map")
+        self.map.entries[key_of(self.key)] = (self.key, value)
+
+
+class StructValue:
+
+    def __init__(self, type_: syntree.Type, fields: Dict[str, Any]):
+        self.type_ = type_
+        self.fields = fields
+
+    def copy(self) -> "StructValue":
+        return StructValue(self.type_, {k: copy_value(v) for k, v in self.fields.items()})
+
+
+class SliceValue:
+    """The elements of array from offset, cap is the
+    number of elements after offset"""
+
+    def __init__(self, array: list, offset: int, length: int, cap: int):
+        self.array = array
+        self.offset = offset
+        self.length = length
+        self.cap = cap
+
+    def elements(self) -> list:
+        return self.array[self.offset:self.offset + self.length]
+
+
+class MapValue:
+    """entries are the (key, value) pairs by key_of the key"""
+
+    def __init__(self, type_: syntree.Type):
+        self.type_ = type_
+        self.entries: Dict[Any, Tuple[Any, Any]] = {}
+
+
+class ChanValue:
+    """A channel, buffer has the values sent and not received yet (up to cap
+    of them), the sched.Waiters of the goroutines blocked sending to it and
+    receiving from it are in sendq and recvq. zero makes the zero value of
+    its elements, received once it is closed"""
+
+    def __init__(self, type_: syntree.Type, cap: int, zero: Callable[[], Any]):
+        self.type_ = type_
+        self.cap = cap
+        self.zero = zero
+        self.buffer: collections.deque = collections.deque()
+        self.closed = False
+        self.sendq: collections.deque = collections.deque()
+        self.recvq: collections.deque = collections.deque()
+
+
+class Boxed:
+    """A value of an interface type which is not nil, with its dynamic type"""
+
+    def __init__(self, type_: syntree.Type, value: Any):
+        self.type_ = type_
+        self.value = value
+
+
+class Closure:
+    """A function, or a function literal with the scope it is declared in"""
+
+    def __init__(self, node: syntree.Function, env: "Env", mapping: Optional[dict] = None):
+        self.node = node
+        self.env = env
+        # the type arguments of the enclosing generic function
+        self.mapping = mapping or {}
+
+
+class BoundMethod:
+    """A method value, like p.area"""
+
+    def __init__(self, method: syntree.Method, recv: Any, mapping: dict):
+        self.method = method
+        self.recv = recv
+        self.mapping = mapping
+
+
+class MethodExpr:
+    """A method expression, like Point.area, the receiver is the first
+    argument. A promoted method is called with the embedded field of the
+    receiver (of type recv) at the end of the path"""
+
+    def __init__(self, method: syntree.Method, mapping: dict, path: Optional[list] = None,
+                 recv: Optional[syntree.Type] = None):
+        self.method = method
+        self.mapping = mapping
+        self.path = path or []
+        self.recv = recv or method.receiver_type
+
+    def receiver(self, value: Any) -> Any:
+        """The receiver of the method for the first argument"""
+        if self.path:
+            value, ref = promote(value, None, self.path)
+            if self.method.pointer_receiver and not isinstance(value, Ref):
+                # the address of the embedded field of the pointed struct
+                return ref
+        if not self.method.pointer_receiver and isinstance(value, Ref):
+            value = copy_value(value.get())
+        return value
+
+
+class Native:
+    """A function of a package of the standard library, written in python.
+    fn is called with the interpreter and the arguments, all boxed"""
+
+    def __init__(self, name: str, fn: Callable):
+        self.name = name
+        self.fn = fn
+
+
+def denied(syscall: str) -> Callable:
+    def native(interp: "Interpreter", args: list):
+        raise Aborted(f"the program called {syscall}, which the sandbox doesn't allow")
+    return native
+
+
+def charged(fn: Callable) -> Callable:
+    """The native fn, with what it returns counted as allocated"""
+    def native(interp: "Interpreter", args: list):
+        return interp.allocate_result(fn(interp, args))
+    return native
+
+
+class Builtin:
+    def __init__(self, name: str):
+        self.name = name
+
+
+class TypeName:
+    def __init__(self, type_: syntree.Type):
+        self.type_ = type_
+
+
+class PackageRef:
+    """An imported package, members is None if the
+    interpreter doesn't have it"""
+
+    def __init__(self, path: str, members: Optional[Dict[str, Any]]):
+        self.path = path
+        self.members = members
+
+
+def copy_value(value: Any) -> Any:
+    """The value as it is assigned, structs and arrays are copied"""
+    if isinstance(value, StructValue):
+        return value.copy()
+    elif isinstance(value, list):
+        return [copy_value(v) for v in value]
+    return value
+
+
+def key_of(value: Any) -> Any:
+    """The value as a key of a python dict, equal for equal Go values"""
+    if isinstance(value, Boxed):
+        return type_string(value.type_), key_of(value.value)
+    elif isinstance(value, StructValue):
+        return tuple(key_of(v) for v in value.fields.values())
+    elif isinstance(value, list):
+        return tuple(key_of(v) for v in value)
+    return value
+
+
+class Env:
+    """Maps names to values (Cells for variables), nested in the
+    enclosing scope"""
+
+    def __init__(self, parent: Optional["Env"] = None):
+        self.parent = parent
+        self.names: Dict[str, Any] = {}
+
+    def lookup(self, name: str) -> Any:
+        env = self
+        while env is not None:
+            if name in env.names:
+                return env.names[name]
+            env = env.parent
+        raise KeyError(name)
+
+    def declare(self, name: str, value: Any):
+        if name != "_":
+            self.names[name] = value
+
+
+def universe() -> Env:
+    env = Env()
+    for name, obj in checker.universe().objects.items():
+        if obj.kind == "type":
+            env.declare(name, TypeName(obj.type_))
+        elif obj.kind == "builtin":
+            env.declare(name, Builtin(name))
+        elif obj.kind == "nil":
+            env.declare(name, None)
+    return env
+
+
+class Frame:
+    """A function being run"""
+
+    def __init__(self, fn: Optional[syntree.Function], mapping: Optional[dict] = None):
+        self.fn = fn
+        # the type arguments of a generic function, by type parameter
+        self.mapping = mapping or {}
+        # the calls deferred, run when the function returns (or panics)
+        self.defers: List[Tuple[Any, list]] = []
+        self.panic: Optional[Panic] = None
+        # the frame running the deferred call, recover stops its panic
+        self.deferred_by: Optional["Frame"] = None
+        # the line of the call run, for testing.caller (the one of the
+        # statement run with the debugger, see Interpreter.trace), and for
+        # the debugger the (name, value) of the variables in scope there
+        # and the scope of the parameters
+        self.line: Optional[int] = None
+        self.scope: Optional[Env] = None
+        self.variables: Callable[[], List[Tuple[str, Any]]] = list
+
+
+class Clock:
+    """The clock of time.Now and time.Sleep, the one of the system"""
+
+    def now(self) -> int:
+        """The time in nanoseconds since January 1, 1970 UTC"""
+        return time.time_ns()
+
+    def sleep(self, ns: int, ctx: Optional[cancel.Context] = None):
+        """Waits for ns nanoseconds, or until ctx is done (then raises
+        its error)"""
+        if ctx is not None:
+            ctx.sleep(ns / 1e9)
+        else:
+            time.sleep(ns / 1e9)
+
+
+class FakeClock(Clock):
+    """A clock for deterministic runs, which starts at start (nanoseconds
+    since 1970, the time of the Go playground by default: 2009-11-10
+    23:00:00 UTC) and only moves when the program sleeps, right away"""
+
+    def __init__(self, start: int = 1257894000 * 10**9):
+        self.ns = start
+
+    def now(self) -> int:
+        return self.ns
+
+    def sleep(self, ns: int, ctx: Optional[cancel.Context] = None):
+        self.ns += ns
+
+
+class Interpreter:
+
+    def __init__(self, info: checker.Info, out=None, argv: Optional[List[str]] = None,
+                 clock: Optional[Clock] = None):
+        self.info = info
+        # sys.stdout when it is None, looked up when printing
+        self.out = out
+        # the standard error (sys.stderr when None) and the standard input
+        # (sys.stdin.buffer when None, a binary stream with read1 like an
+        # io.BytesIO) of the program
+        self.err = None
+        self.stdin = None
+        # the files of os.ReadFile, os.WriteFile, os.Stat and os.Remove, the
+        # ones of the disk when None, else the contents of the files by name
+        # (both bytes, like the strings of Go), like in the playground.py
+        self.files: Optional[Dict[bytes, bytes]] = None
+        # the permissions of the files created by os.WriteFile among them,
+        # the other ones are 0644
+        self.modes: Dict[bytes, int] = {}
+        # os.Args, the path of the program and its arguments
+        self.argv = argv or []
+        # the clock of the time package
+        self.clock = clock or Clock()
+        self.universe = universe()
+        # the package scope of the main package, in which methods run
+        self.globals = Env(self.universe)
+        self.frames: List[Frame] = [Frame(None)]
+        # the goroutines (see sched.py), the frames are the ones of the one
+        # running, which lets the others run at the step preempt_at
+        self.scheduler = sched.Scheduler(self)
+        self.preempt_at = math.inf
+        # the race.Detector of go_parser.py run -race, the VM's
+        self.race: Any = None
+        # the members of the packages loaded, by import path
+        self.packages: Dict[str, Dict[str, Any]] = {}
+        # the packages of the program run, for the stack traces of panics
+        self.program: list = []
+        # the functions of the packages of std without bodies, by import path
+        self.natives: Dict[str, Dict[str, Any]] = {
+            "fmt": fmt_package(), "os": os_package(), "strings": strings_package(),
+            "strconv": strconv_package(), "math": math_package(), "time": time_package(),
+            "sort": sort_package(), "slices": slices_package(), "testing": testing_package(),
+            "python": python_package(), "reflect": reflect_package(), "sync": sync_package(),
+            "sync/atomic": atomic_package(),
+        }
+        # the package scope each method runs in, by id of the method
+        self.method_envs: Dict[int, Env] = {}
+        self.bool_type = self.universe.lookup("bool").type_
+        self.any_type = self.universe.lookup("any").type_
+        self.string_type = self.universe.lookup("string").type_
+        # the ids of the statements skipped in permissive mode, see skip
+        self.skipped: Set[int] = set()
+        # the debug.Debugger the lines of the statements are reported to
+        self.debugger: Any = None
+        # the names of the functions of the program, see syntree.function_names
+        self.function_names: Dict[int, str] = {}
+        # the objects allocated and their bytes, like the Mallocs and the
+        # TotalAlloc of runtime.MemStats, see allocate
+        self.mallocs = 0
+        self.total_alloc = 0
+        # the pprof.Profiler the allocations are reported to, if any
+        self.profiler: Any = None
+        # the steps run so far (the statements and the loop iterations, the
+        # VM counts its calls and its jumps back instead), the run is aborted
+        # past max_steps or once ctx is done (see cancel.py), checked at each
+        # step
+        self.steps = 0
+        self.max_steps: Optional[int] = None
+        self.ctx: Optional[cancel.Context] = None
+        # the limits of the sandbox the program runs in (none by default),
+        # and the bytes it wrote to stdout and stderr so far, see sandbox.py
+        self.limits = sandbox.Limits()
+        self.written = 0
+        # the types of the Go values of the Python values, once the python
+        # package is loaded (see from_python)
+        self.python_types: Dict[str, Any] = {}
+        # the types reflect gave the program, by index (0 is none) and by
+        # %T, and reflect.Value once the package is loaded (see reflect_id)
+        self.reflect_types: List[Any] = [None]
+        self.reflect_ids: Dict[str, int] = {}
+        self.reflect_value: Optional[syntree.Type] = None
+
+    def output(self):
+        return self.out if self.out is not None else sys.stdout
+
+    def errors(self):
+        return self.err if self.err is not None else sys.stderr
+
+    def input(self):
+        return self.stdin if self.stdin is not None else sys.stdin.buffer
+
+    # memory statistics, for the allocs/op of the benchmarks
+
+    def allocate(self, t: Any, n: int = 1):
+        """Counts the allocation of n values of type t on the heap. They are
+        the ones of new, make, append growing a slice, the slice and map
+        literals, &T{...}, and the strings concatenated or converted: there is
+        no escape analysis, gc puts some of them on the stack. The closures,
+        the values put in interfaces and the maps growing aren't counted"""
+        self.allocate_bytes(size_of(self.resolve(t))[0] * n)
+
+    def allocate_map(self, t: Any, n: int):
+        """Counts the allocation of a map of type t for n entries: its header,
+        and its buckets (of 8 entries) if n isn't 0"""
+        self.allocate_bytes(48)
+        if n > 0:
+            u = underlying(self.resolve(t))
+            buckets = 1
+            while n > 8 and n > 6.5 * buckets:
+                buckets *= 2
+            bucket = 16 + 8 * (size_of(u.key)[0] + size_of(u.eltype)[0])
+            self.allocate_bytes(buckets * bucket)
+
+    def allocate_bytes(self, size: int):
+        if size > 0:
+            self.mallocs += 1
+            self.total_alloc += size_class(size)
+            if self.profiler is not None:
+                self.profiler.allocated(size_class(size))
+            if self.limits.heap is not None and self.total_alloc > self.limits.heap:
+                raise Aborted(f"the program allocated more than {self.limits.heap} bytes")
+
+    def reserve(self, size: int):
+        """Aborts the program if size more bytes would be past the limit of
+        the heap, before a native builds them (they are counted once built,
+        see allocate_result)"""
+        if self.limits.heap is not None and self.total_alloc + size > self.limits.heap:
+            raise Aborted(f"the program allocated more than {self.limits.heap} bytes")
+
+    def allocate_result(self, result: Any) -> Any:
+        """Counts the strings and the slices returned by a native of std as
+        allocated, like the ones of fmt.Sprintf or strings.Split"""
+        for value in (result if isinstance(result, tuple) else (result,)):
+            if isinstance(value, bytes):
+                self.allocate_bytes(len(value))
+            elif isinstance(value, SliceValue):
+                self.allocate_bytes(sum(16 + len(e) if isinstance(e, bytes) else 8
+                                        for e in value.array))
+        return result
+
+    def write_output(self, size: int):
+        """Counts the bytes about to be written to stdout or stderr, the
+        program is aborted before they are if they are past the limit"""
+        self.written += size
+        if self.limits.output is not None and self.written > self.limits.output:
+            raise Aborted(f"the program wrote more than {self.limits.output} bytes")
+
+    def concat(self, x: bytes, y: bytes) -> bytes:
+        """The string x + y, a new one if neither is empty"""
+        if not x or not y:
+            return x or y
+        s = x + y
+        self.allocate_bytes(len(s))
+        return s
+
+    # types
+
+    def resolve(self, t: Any) -> Any:
+        """The type t with the type parameters of the function being run substituted"""
+        mapping = self.frames[-1].mapping
+        if mapping and t is not None:
+            return syntree.substitute(t, mapping)
+        return t
+
+    def type_of(self, node) -> Optional[syntree.Type]:
+        x = self.info.operands.get(node)
+        if x is None:
+            return None
+        return self.resolve(x.type_)
+
+    def zero(self, t: Optional[syntree.Type]) -> Any:
+        """The zero value of the type"""
+        t = self.resolve(t)
+        if t is None:
+            return None
+        u = underlying(t)
+        kind = untyped.kind_of_typename(basic_typename(u) or "")
+        if kind is not None:
+            return {"bool": False, "int": 0, "float": 0.0, "complex": 0j, "string": b""}[kind]
+        if isinstance(u, syntree.Struct):
+            return StructValue(t, {f.f_name: self.zero(f.type_) for f in u.fields})
+        if isinstance(u, syntree.Array):
+            return [self.zero(u.eltype) for _ in range(u.length)]
+        return None
+
+    def constant_value(self, c: constant.Constant, t: Optional[syntree.Type]) -> Any:
+        """The value of a constant of type t (its default type if t is None)"""
+        typename = basic_typename(underlying(t)) if t is not None else None
+        if typename is None or untyped.kind_of_typename(typename) is None:
+            typename = c.typename or untyped.default_typename(c.kind)
+        if c.typename != typename:
+            try:
+                c = constant.convert(c, typename)
+            except constant.ConstError:
+                pass
+        if c.kind == "bool":
+            return bool(c.value)
+        elif c.kind == "string":
+            return c.value
+        kind = untyped.kind_of_typename(typename)
+        if kind == "float":
+            value = c.value[0] if c.kind == "complex" else c.value
+            return wrap(constant._fraction_to_float(Fraction(value)), typename)
+        elif kind == "complex":
+            real, imag = untyped.to_kind(c.kind, c.value, "complex")
+            value = complex(constant._fraction_to_float(real), constant._fraction_to_float(imag))
+            return wrap(value, typename)
+        return untyped.to_integer(c.kind, c.value)
+
+    def assign_value(self, value: Any, from_type: Any, to_type: Any) -> Any:
+        """The value of type from_type as it is stored in a variable
+        of type to_type, it is boxed if to_type is an interface"""
+        value = copy_value(value)
+        to_type = self.resolve(to_type)
+        if (to_type is not None and syntree.is_interface(to_type)
+                and from_type is not None and not syntree.is_interface(from_type)):
+            return Boxed(from_type, value)
+        return value
+
+    # declarations
+
+    def declare_package(self, ast: syntree.Node, env: Env):
+        """Declares the functions, types and imports of the package in env,
+        then initializes its variables in the order the checker found (the
+        order they are declared, without it)"""
+        self.globals = env
+        variables = []
+        for decl in package_decls(ast):
+            if isinstance(decl, syntree.Import):
+                name, path = decl.data
+                path = path[1].strip('"')
+                # the package name is the last element of the import path
+                name = name[1] if isinstance(name, tuple) else path.split("/")[-1]
+                env.declare(name, PackageRef(path, self.packages.get(path)))
+            elif isinstance(decl, syntree.Method):
+                self.method_envs[id(decl)] = env
+            elif isinstance(decl, syntree.Function) and not is_native(decl, env):
+                env.declare(decl.fn_name[1], self.function_value(decl, env))
+            elif isinstance(decl, syntree.TypeDef):
+                env.declare(decl.typename[1], TypeName(decl.type_))
+            elif isinstance(decl, syntree.VarDecl):
+                variables.append(decl)
+        self.run(self.info.init_order.get(ast, variables), env)
+
+    def load_package(self, package) -> Env:
+        """Declares a package (a loader.Package checked after the ones it
+        imports) in an env of its own, the packages importing it refer to
+        its members. The functions of std without bodies are natives, the
+        summaries of the packages of std have none (their uses are not
+        supported)"""
+        env = Env(self.universe)
+        if package.summary:
+            return env
+        if package.python:
+            env.names.update(self.python_natives(package))
+        elif package.std:
+            # declared first, the variables of the package can call them
+            env.names.update(self.package_natives(package.path))
+        self.declare_package(package.ast, env)
+        self.packages[package.path] = env.names
+        if package.path == "python":
+            self.python_types = {
+                "Object": env.names["Object"].type_,
+                "int": self.universe.lookup("int").type_,
+                "float64": self.universe.lookup("float64").type_,
+                "[]byte": syntree.Slice(self.universe.lookup("byte").type_),
+                "[]any": syntree.Slice(self.any_type),
+                "map[any]any": syntree.Map(self.any_type, self.any_type),
+            }
+        elif package.path == "reflect":
+            self.reflect_value = env.names["Value"].type_
+        return env
+
+    def python_natives(self, package) -> Dict[str, Any]:
+        """The natives of the functions of the bindings of a Python module,
+        calling its functions (see pyffi.py)"""
+        module = pyffi.import_module(package.path)
+        natives = {}
+        for decl in package_decls(package.ast):
+            if isinstance(decl, syntree.Function) and not isinstance(decl, syntree.Method):
+                name = decl.fn_name[1]
+                fn = getattr(module, pyffi.names[package.path][name])
+                result = results(decl.signature)
+                natives[name] = Native(name, python_function(fn, result[0] if result else None)
+                                       if self.limits.allows("python.call")
+                                       else denied("python.call"))
+        return natives
+
+    def package_natives(self, path: str) -> Dict[str, Any]:
+        """The natives of the package of std path, the syscalls the sandbox
+        doesn't allow abort the program when they are called"""
+        natives = dict(self.natives.get(path, {}))
+        for name in natives:
+            # the objects of Python run any code, like its functions
+            syscall = "python.call" if path == "python" else f"{path}.{name}"
+            if not self.limits.allows(syscall):
+                natives[name] = Native(name, denied(syscall))
+            else:
+                natives[name] = Native(name, charged(natives[name].fn))
+        return natives
+
+    def run_program(self, packages: list, entry: str = "main") -> int:
+        """Runs a program checked by go_parser.check_program: the variables
+        and the init functions of each package, then main (or the function
+        entry of the last package, like the one running the tests of
+        go_parser.py test). Returns the exit code, 2 if it panics like in Go
+        (in any goroutine) or for a fatal error, like a deadlock, the one
+        given to os.Exit if it is called. Raises Aborted past the step budget
+        and the error of ctx once it is done, where it is"""
+        env = None
+        self.program = packages
+        goroutine = self.scheduler.main
+        try:
+            try:
+                for package in packages:
+                    env = self.load_package(package)
+                    for init in package_inits(package.ast):
+                        self.call_function(self.function_value(init, env), [])
+                if env is None or entry not in env.names:
+                    raise Unsupported(f"the program has no {entry} function")
+                signature = env.names[entry].node.signature
+                if parameters(signature.parameters) or results(signature):
+                    raise Unsupported(f"func {entry} must have no arguments and no return values")
+                self.call_function(env.names[entry], [])
+            except sched.Crash as c:
+                # the error of another goroutine ends the program
+                goroutine = c.goroutine
+                raise c.error
+        except Panic as p:
+            return self.report_panic(p, goroutine)
+        except sched.Fatal as f:
+            return self.report_fatal(f)
+        except _Exit as e:
+            self.output().flush()
+            return e.code
+        except RecursionError:
+            self.output().flush()
+            print("fatal error: stack overflow", file=self.errors())
+            return 2
+        except (Aborted, cancel.ContextError):
+            self.output().flush()
+            raise
+        finally:
+            # the goroutines still running end with the program
+            self.scheduler.exit()
+        return 0
+
+    def step(self):
+        """Counts a step of the program, see max_steps"""
+        self.steps += 1
+        if self.max_steps is not None and self.steps > self.max_steps:
+            raise Aborted(f"the program ran more than {self.max_steps} steps")
+        if self.ctx is not None:
+            self.ctx.check()
+        if self.steps >= self.preempt_at:
+            # the goroutine ran for its time slice
+            self.preempt_at = self.steps + sched.preempt_steps
+            self.scheduler.yield_()
+
+    def function_value(self, node: syntree.Function, env: Env) -> Any:
+        """The value of a function declared in the package scope env"""
+        return Closure(node, env)
+
+    def report_panic(self, p: Panic, goroutine: Optional[sched.Goroutine] = None) -> int:
+        self.output().flush()
+        g = goroutine or self.scheduler.main
+        print(f"panic: {self.format(p.value)}\n\ngoroutine {g.id} [running]:\n"
+              f"{stack_trace(p.trace, self.program)}{self.created_by(g)}", file=self.errors())
+        return 2
+
+    def report_fatal(self, f: sched.Fatal) -> int:
+        """Prints a fatal error with the traces of the goroutines, like Go"""
+        self.output().flush()
+        traces = [f"goroutine {g.id} [{state or 'running'}]:\n"
+                  f"{stack_trace(trace, self.program)}{self.created_by(g)}"
+                  for g, state, trace in f.goroutines]
+        print(f"fatal error: {f.message}\n\n" + "\n\n".join(traces), file=self.errors())
+        return 2
+
+    def created_by(self, g: sched.Goroutine) -> str:
+        """The line of the trace of a goroutine with the go statement starting it"""
+        if g.created_by is None or g.created_by[0] is None:
+            return ""
+        fn, line, parent = g.created_by
+        if not self.function_names:
+            self.function_names = program_function_names(self.program)
+        name = self.function_names.get(id(fn), "main.main")
+        return (f"\ncreated by {name} in goroutine {parent.id}\n"
+                f"\t{fileset.fset.position(fn.pos).filename}:{line or fn.lineno}")
+
+    # statements
+
+    def statements(self, node, env: Env):
+        self.run(in_order(node), env)
+
+    def run(self, stmts: list, env: Env):
+        # the values of the VarSpecs like var a, b = f(), by expression list
+        unpacked: Dict[int, list] = {}
+        i = 0
+        while i < len(stmts):
+            try:
+                self.step()
+                if self.debugger is not None:
+                    self.trace(stmts[i], env)
+                self.statement(stmts[i], env, unpacked)
+                i += 1
+            except Unsupported as e:
+                self.skip(e, stmts[i])
+                i += 1
+            except Panic as p:
+                if p.line is None:
+                    p.line = checker.statement_line(stmts[i])
+                raise
+            except _Goto as g:
+                # the label is in this block, or in one around it
+                i = next((j for j, stmt in enumerate(stmts) if isinstance(stmt, syntree.LabeledStmt)
+                          and stmt.label.ident_name == g.label), -1)
+                if i < 0:
+                    raise
+                # the declarations run again declare new variables, the
+                # closures made before keep the previous ones
+                names, env = env.names, Env(env.parent)
+                env.names.update(names)
+                unpacked.clear()
+
+    def trace(self, stmt, env: Env):
+        """Reports the line of the statement run to the debugger, with
+        the variables of the function declared in env (and around it)"""
+        def variables() -> List[Tuple[str, Any]]:
+            # the scopes up to the one of the parameters, the innermost first,
+            # without the variables shadowed
+            scopes: List[List[Tuple[str, Any]]] = []
+            seen: Set[str] = set()
+            scope = env
+            while scope is not None and scope.parent is not self.universe:
+                scopes.append([(name, value.value) for name, value in scope.names.items()
+                               if isinstance(value, Cell) and name not in seen])
+                seen.update(scope.names)
+                if scope is frame.scope:
+                    break
+                scope = scope.parent
+            found = [variable for names in reversed(scopes) for variable in names]
+            if frame.fn is not None and frame.fn.fn_name is None and scope is not None:
+                # the variables a function literal captures, the ones it uses
+                used = {n.data[1] for n in syntree.walk(frame.fn.body)
+                        if isinstance(n, syntree.PrimaryExpr) and isinstance(n.data, tuple)}
+                scope = scope.parent
+                while scope is not None and scope.parent is not self.universe:
+                    for name, value in scope.names.items():
+                        if isinstance(value, Cell) and name in used and name not in seen:
+                            found.append((name, value.value))
+                    seen.update(scope.names)
+                    scope = scope.parent
+            return found
+
+        frame = self.frames[-1]
+        frame.line, frame.variables = checker.statement_line(stmt), variables
+        if frame.fn is not None and frame.line is not None:
+            self.debugger.line(fileset.fset.position(frame.fn.pos).filename, frame.line,
+                               len(self.frames), self.debug_frames)
+
+    def debug_frames(self) -> list:
+        """The functions being run as the debugger shows them, the innermost first"""
+        if not self.function_names:
+            self.function_names = program_function_names(self.program)
+        frames = []
+        for frame in reversed(self.frames):
+            if frame.fn is None or frame.line is None:
+                continue
+            variables = frame.variables
+            frames.append(debug.Frame(
+                self.function_names.get(id(frame.fn), "main.main"),
+                fileset.fset.position(frame.fn.pos).filename, frame.line,
+                lambda variables=variables: [(name, self.format(value))
+                                             for name, value in variables()]
+            ))
+        return frames
+
+    def skip(self, e: Unsupported, stmt):
+        """Skips a statement which can't be run in permissive mode (see
+        diagnostics.strict), it is reported once to stderr"""
+        if diagnostics.strict:
+            raise e
+        if id(stmt) in self.skipped:
+            return
+        self.skipped.add(id(stmt))
+        self.output().flush()
+        lineno, col_num, width = checker.position(stmt)
+        d = diagnostics.unsupported(f"{e}, the statement is skipped", lineno, col_num, width,
+                                    kind="RUNTIME ERROR",
+                                    file=fileset.fset.position(stmt.pos).filename)
+        with contextlib.redirect_stdout(self.errors()):
+            diagnostics.print_diagnostic(d)
+
+    def statement(self, stmt, env: Env, unpacked: Optional[Dict[int, list]] = None):
+        if isinstance(stmt, syntree.CoverStmt):
+            stmt.block.count += 1
+
+        elif isinstance(stmt, syntree.Block):
+            self.statements(stmt, Env(env))
+
+        elif isinstance(stmt, syntree.VarDecl):
+            self.var_decl(stmt, env, {} if unpacked is None else unpacked)
+
+        elif isinstance(stmt, syntree.TypeDef):
+            env.declare(stmt.typename[1], TypeName(stmt.type_))
+
+        elif isinstance(stmt, syntree.IfStmt):
+            self.if_stmt(stmt, env)
+
+        elif isinstance(stmt, syntree.TypeSwitchStmt):
+            self.type_switch_stmt(stmt, env)
+
+        elif isinstance(stmt, syntree.SwitchStmt):
+            self.switch_stmt(stmt, env)
+
+        elif isinstance(stmt, syntree.ForStmt):
+            self.for_stmt(stmt, env)
+
+        elif isinstance(stmt, syntree.Keyword):
+            self.keyword(stmt, env)
+
+        elif isinstance(stmt, syntree.LabeledStmt):
+            # a loop or a switch is the target of break and continue
+            label = stmt.label.ident_name
+            if isinstance(stmt.stmt, syntree.ForStmt):
+                self.for_stmt(stmt.stmt, env, label)
+            elif isinstance(stmt.stmt, syntree.TypeSwitchStmt):
+                self.type_switch_stmt(stmt.stmt, env, label)
+            elif isinstance(stmt.stmt, syntree.SwitchStmt):
+                self.switch_stmt(stmt.stmt, env, label)
+            elif isinstance(stmt.stmt, syntree.SelectStmt):
+                self.select_stmt(stmt.stmt, env, label)
+            else:
+                for labeled in checker.labeled_statements(stmt):
+                    self.statement(labeled, env, unpacked)
+
+        elif isinstance(stmt, syntree.Assignment):
+            self.assignment(stmt, env)
+
+        elif isinstance(stmt, syntree.DeferStmt):
+            self.defer(stmt, env)
+
+        elif isinstance(stmt, syntree.UnaryOp) and stmt.operator in ("++", "--"):
+            ref = self.place(stmt.operand, env)
+            one = 1 if isinstance(ref.get(), int) else 1.0
+            operator = "+" if stmt.operator == "++" else "-"
+            ref.set(self.arith(operator, ref.get(), one, self.type_of(stmt.operand)))
+
+        elif isinstance(stmt, syntree.GoStmt):
+            self.go(stmt, env)
+
+        elif isinstance(stmt, syntree.SendStmt):
+            ch = self.eval(stmt.chan, env)
+            value = self.eval(stmt.value, env)
+            t = self.type_of(stmt.chan)
+            value = self.assign_value(value, self.type_of(stmt.value),
+                                      underlying(t).eltype if t is not None else None)
+            self.frames[-1].line = stmt.lineno
+            self.send(ch, value)
+
+        elif isinstance(stmt, syntree.SelectStmt):
+            self.select_stmt(stmt, env)
+
+        elif not isinstance(stmt, syntree.BadStmt):
+            self.eval(stmt, env)
+
+    def var_decl(self, decl: syntree.VarDecl, env: Env, unpacked: Dict[int, list]):
+        if decl.const:
+            # the uses of constants are constant operands
+            return
+        type_ = None if decl.type_inferred else decl.type_
+        if not isinstance(type_, syntree.Type):
+            type_ = None
+        # like err in b, err := g(), assigned instead of declared
+        redeclared = self.info.redeclared.get(decl.ident)
+        if redeclared is not None:
+            type_ = redeclared.type_
+        if decl.unpack is not None:
+            ident_list, expression_list = decl.unpack
+            idents = in_order(ident_list)
+            key = id(expression_list)
+            if key not in unpacked:
+                unpacked[key] = self.values(in_order(expression_list), env, len(idents))
+            value, from_type = unpacked[key][idents.index(decl.ident)]
+            value = self.assign_value(value, from_type, type_)
+        elif decl.value is not None:
+            value = self.assign_value(self.eval(decl.value, env), self.type_of(decl.value), type_)
+        else:
+            value = self.zero(type_)
+        if redeclared is not None:
+            env.lookup(decl.ident.ident_name).set(value)
+        else:
+            env.declare(decl.ident.ident_name, Cell(value))
+
+    def if_stmt(self, stmt: syntree.IfStmt, env: Env):
+        env = Env(env)
+        if stmt.statement is not None:
+            self.statements(stmt.statement, env)
+        if self.eval(stmt.expr, env):
+            self.statements(stmt.body, Env(env))
+        elif isinstance(stmt.next_, syntree.IfStmt):
+            self.if_stmt(stmt.next_, env)
+        elif stmt.next_ is not None:
+            self.statements(stmt.next_, Env(env))
+
+    def loop_body(self, stmt: syntree.ForStmt, env: Env, label: Optional[str] = None) -> bool:
+        """Runs the body of a loop, False if it breaks out of it. label is
+        the one of the loop, if it is labeled"""
+        # an iteration is a step too, so the loops without statements
+        # (like for {}) are aborted and preempted
+        self.step()
+        try:
+            self.statements(stmt.body, Env(env))
+        except _Break as b:
+            if b.label not in (None, label):
+                raise
+            return False
+        except _Continue as c:
+            if c.label not in (None, label):
+                raise
+        return True
+
+    def for_stmt(self, stmt: syntree.ForStmt, env: Env, label: Optional[str] = None):
+        clause = stmt.clause
+        env = Env(env)
+        if isinstance(clause, syntree.RangeClause):
+            self.range_loop(stmt, clause, env, label)
+        elif isinstance(clause, syntree.ForClause):
+            self.statements(clause.init, env)
+            while self.loop_cond(stmt, clause.cond, env):
+                if not self.loop_body(stmt, env, label):
+                    break
+                # each iteration has its own variables, initialized
+                # with the values of the previous ones (since Go 1.22)
+                if lang.allows(lang.loop_var):
+                    parent, env = env, Env(env.parent)
+                    for name, value in parent.names.items():
+                        env.declare(name, Cell(value.value) if isinstance(value, Cell) else value)
+                self.statements(clause.post, env)
+        else:
+            while self.loop_cond(stmt, clause, env):
+                if not self.loop_body(stmt, env, label):
+                    break
+
+    def loop_cond(self, stmt: syntree.ForStmt, cond, env: Env) -> bool:
+        """If the loop does another iteration. The debugger is at the line
+        of the loop before each one, and when it ends, like in Go"""
+        if self.debugger is not None:
+            self.trace(stmt, env)
+        return cond is None or self.eval(cond, env)
+
+    def traced(self, stmt: syntree.ForStmt, env: Env, pairs: Iterator) -> Iterator:
+        """The pairs of a range loop, the debugger is at the line of the
+        loop before each one, and when they end"""
+        pairs = iter(pairs)
+        while True:
+            self.trace(stmt, env)
+            pair = next(pairs, None)
+            if pair is None:
+                return
+            yield pair
+
+    def range_loop(self, stmt: syntree.ForStmt, clause: syntree.RangeClause, env: Env,
+                   label: Optional[str] = None):
+        x = self.eval(clause.expr, env)
+        t = self.type_of(clause.expr)
+        u = underlying(t) if t is not None else None
+        eltype = getattr(u, "eltype", None)
+        int_type = self.universe.lookup("int").type_
+
+        if isinstance(x, int) and not isinstance(x, bool):
+            pairs = ((i, None) for i in range(x))
+            types = [t, None]
+        elif isinstance(x, bytes):
+            pairs = runes(x)
+            types = [int_type, self.universe.lookup("rune").type_]
+        elif isinstance(x, list):
+            # the range expression is evaluated once, arrays are copied
+            pairs = enumerate(x)
+            types = [int_type, eltype]
+        elif isinstance(x, Ref):
+            # a pointer to an array
+            array = x.get()
+            pairs = ((i, array[i]) for i in range(len(array)))
+            types = [int_type, getattr(underlying(u.base), "eltype", None) if u else None]
+        elif isinstance(x, SliceValue):
+            pairs = ((i, x.array[x.offset + i]) for i in range(x.length))
+            types = [int_type, eltype]
+        elif isinstance(x, MapValue):
+            pairs = map_entries(x)
+            types = [u.key, eltype]
+        elif isinstance(x, ChanValue) or isinstance(u, syntree.Chan):
+            # a range over a nil channel blocks forever
+            pairs = self.received(x, stmt.lineno)
+            types = [eltype, None]
+        elif x is None:
+            pairs = iter(())
+            types = [None, None]
+        else:
+            raise Unsupported("range over this type is not supported")
+
+        if clause.ident_list is not None:
+            variables = in_order(clause.ident_list)
+        else:
+            variables = in_order(clause.expr_list)
+
+        if self.debugger is not None:
+            pairs = self.traced(stmt, env, pairs)
+        # before Go 1.22 the iterations share the variables
+        shared = not lang.allows(lang.loop_var)
+        loop_env = Env(env)
+        for pair in pairs:
+            # each iteration has its own variables
+            if not shared:
+                loop_env = Env(env)
+            for target, value, type_ in zip(variables, pair, types):
+                if clause.ident_list is not None and target.ident_name in loop_env.names:
+                    loop_env.names[target.ident_name].set(copy_value(value))
+                elif clause.ident_list is not None:
+                    loop_env.declare(target.ident_name, Cell(copy_value(value)))
+                elif not is_blank(target):
+                    self.place(target, env).set(
+                        self.assign_value(value, type_, self.type_of(target))
+                    )
+            if not self.loop_body(stmt, loop_env, label):
+                break
+
+    def switch_stmt(self, stmt: syntree.SwitchStmt, env: Env, label: Optional[str] = None):
+        env = Env(env)
+        if stmt.statement is not None:
+            self.statements(stmt.statement, env)
+        if stmt.expr is not None:
+            tag = self.eval(stmt.expr, env)
+            tag_type = self.type_of(stmt.expr)
+        else:
+            tag, tag_type = True, self.bool_type
+
+        clauses = in_order(stmt.clauses)
+        chosen = None
+        for i, clause in enumerate(clauses):
+            if clause.is_default:
+                continue
+            for expr in in_order(clause.exprs):
+                value = self.assign_value(self.eval(expr, env), self.type_of(expr), tag_type)
+                if self.equal(tag, value):
+                    chosen = i
+                    break
+            if chosen is not None:
+                break
+        if chosen is None:
+            chosen = next((i for i, c in enumerate(clauses) if c.is_default), None)
+            if chosen is None:
+                return
+
+        try:
+            for clause in clauses[chosen:]:
+                body = in_order(clause.body)
+                fallthrough = (bool(body) and isinstance(body[-1], syntree.Keyword)
+                               and body[-1].kw == "FALLTHROUGH")
+                self.run(body[:-1] if fallthrough else body, Env(env))
+                if not fallthrough:
+                    break
+        except _Break as b:
+            if b.label not in (None, label):
+                raise
+
+    def type_switch_stmt(self, stmt: syntree.TypeSwitchStmt, env: Env,
+                         label: Optional[str] = None):
+        env = Env(env)
+        if stmt.statement is not None:
+            self.statements(stmt.statement, env)
+        x = self.eval(stmt.expr, env)
+
+        # the first case (in order) listing the dynamic type of x, or nil
+        clauses = in_order(stmt.clauses)
+        chosen = value = None
+        for clause in clauses:
+            if clause.is_default:
+                continue
+            cases = in_order(clause.types)
+            for case in cases:
+                if case.nil:
+                    asserted, ok = x, not isinstance(x, Boxed)
+                else:
+                    asserted, ok = self.asserted(x, self.resolve(case.type_))
+                if ok:
+                    # the variable has the type of the case if it lists only one
+                    chosen, value = clause, asserted if len(cases) == 1 else x
+                    break
+            if chosen is not None:
+                break
+        if chosen is None:
+            chosen = next((c for c in clauses if c.is_default), None)
+            if chosen is None:
+                return
+            value = x
+
+        clause_env = Env(env)
+        if chosen.ident is not None and chosen.ident in self.info.defs:
+            clause_env.declare(chosen.ident.ident_name, Cell(value))
+        try:
+            self.run(in_order(chosen.body), clause_env)
+        except _Break as b:
+            if b.label not in (None, label):
+                raise
+
+    def select_stmt(self, stmt: syntree.SelectStmt, env: Env, label: Optional[str] = None):
+        # the channels and the values sent are evaluated in source order,
+        # the variables the value received is assigned to once it is
+        clauses = in_order(stmt.clauses) if stmt.clauses is not None else []
+        cases, chosen = [], []
+        default = None
+        for clause in clauses:
+            if clause.is_default:
+                default = clause
+            elif isinstance(clause.comm, syntree.SendStmt):
+                comm = clause.comm
+                t = self.type_of(comm.chan)
+                ch = self.eval(comm.chan, env)
+                value = self.assign_value(self.eval(comm.value, env), self.type_of(comm.value),
+                                          underlying(t).eltype if t is not None else None)
+                cases.append((ch, value, True))
+                chosen.append(clause)
+            else:
+                receive = received_expr(clause.comm)
+                cases.append((self.eval(receive.operand, env), None, False))
+                chosen.append(clause)
+        self.frames[-1].line = stmt.lineno
+        i, value, ok = self.selectgo(cases, default is not None)
+        clause = default if i < 0 else chosen[i]
+        env = Env(env)
+        if i >= 0 and not cases[i][2]:
+            self.receive_into(clause.comm, value, ok, env)
+        try:
+            self.statements(clause.body, env)
+        except _Break as b:
+            if b.label not in (None, label):
+                raise
+
+    def receive_into(self, comm, value: Any, ok: bool, env: Env):
+        """Assigns the value received by the case of a select (and whether
+        it was sent) to its variables, or declares them in env"""
+        receive = received_expr(comm)
+        values = [(value, self.type_of(receive)), (ok, self.bool_type)]
+        if isinstance(comm, syntree.Assignment):
+            for target, (v, t) in zip(in_order(comm.left), values):
+                if not is_blank(target):
+                    self.place(target, env).set(self.assign_value(v, t, self.type_of(target)))
+        elif isinstance(in_order(comm)[0], syntree.VarDecl):
+            for decl, (v, _) in zip(in_order(comm), values):
+                env.declare(decl.ident.ident_name, Cell(v))
+
+    def go(self, stmt: syntree.GoStmt, env: Env):
+        # the function and the arguments are evaluated by the goroutine running the statement
+        fn, args = self.prepare_call(in_order(stmt.call)[0], env)
+        self.start(fn, args, stmt.lineno)
+
+    def start(self, fn: Any, args: list, line: Optional[int]):
+        """Starts a goroutine calling fn, for a go statement at the line"""
+        if line is not None:
+            self.frames[-1].line = line
+        parent = self.scheduler.current
+        created_by = (self.frames[-1].fn, line, parent)
+        g = self.scheduler.go(lambda: self.call_function(fn, args), [Frame(None)], created_by)
+        if self.race is not None:
+            self.race.go(parent, g)
+        if self.preempt_at == math.inf:
+            self.preempt_at = self.steps + sched.preempt_steps
+
+    def keyword(self, stmt: syntree.Keyword, env: Env):
+        label = stmt.label.ident_name if stmt.label is not None else None
+        if stmt.kw == "BREAK":
+            raise _Break(label)
+        elif stmt.kw == "CONTINUE":
+            raise _Continue(label)
+        elif stmt.kw == "GOTO":
+            raise _Goto(label)
+        elif stmt.kw == "RETURN":
+            exprs = in_order(stmt.children[0]) if stmt.children else []
+            if not exprs:
+                raise _Return()
+            want = [self.resolve(t) for t in results(self.frames[-1].fn.signature)]
+            values = self.values(exprs, env, len(want))
+            raise _Return([self.assign_value(value, from_type, type_)
+                           for (value, from_type), type_ in zip(values, want)])
+        else:
+            raise Unsupported(f"{stmt.kw.lower()} statements are not supported")
+
+    def assignment(self, stmt: syntree.Assignment, env: Env):
+        lhs = in_order(stmt.left)
+        rhs = in_order(stmt.right)
+        if stmt.operator != "=":
+            ref = self.place(lhs[0], env)
+            y = self.eval(rhs[0], env)
+            ref.set(self.arith(stmt.operator[:-1], ref.get(), y, self.type_of(lhs[0])))
+            return
+
+        # the operands of the index expressions and pointer indirections on
+        # the left are evaluated first, then the values on the right
+        refs = [None if is_blank(target) else self.place(target, env) for target in lhs]
+        values = self.values(rhs, env, len(lhs))
+        for ref, target, (value, from_type) in zip(refs, lhs, values):
+            if ref is not None:
+                ref.set(self.assign_value(value, from_type, self.type_of(target)))
+
+    def defer(self, stmt: syntree.DeferStmt, env: Env):
+        call = in_order(stmt.call)[0]
+        if not isinstance(call, syntree.FunctionCall):
+            raise Unsupported("only calls can be deferred")
+        # the function and the arguments are evaluated when the call is deferred
+        fn, args = self.prepare_call(call, env)
+        self.frames[-1].defers.append((fn, args))
+
+    def place(self, node, env: Env) -> Ref:
+        """The variable an expression on the left of an assignment is"""
+        if isinstance(node, syntree.List):
+            return self.place(in_order(node)[0], env)
+        if isinstance(node, syntree.UnaryOp) and node.operator == "*":
+            pointer = self.eval(node.operand, env)
+            if pointer is None:
+                raise nil_dereference()
+            return pointer
+        if isinstance(node, syntree.PrimaryExpr):
+            _, ref, _ = self.primary(node, env)
+            if ref is not None:
+                return ref
+        raise Unsupported(f"cannot assign to {checker.expr_string(node)}")
+
+    # expressions
+
+    def values(self, exprs: list, env: Env, count: Optional[int] = None) -> List[Tuple[Any, Any]]:
+        """The values of expressions with their types, the ones of a call
+        with multiple results, or of a comma ok expression if count is 2"""
+        if len(exprs) == 1:
+            x = self.info.operands.get(exprs[0])
+            if x is not None and x.mode == "tuple":
+                return list(zip(self.eval(exprs[0], env),
+                                (self.resolve(t) for t in x.tuple_types)))
+            if x is not None and x.comma_ok and count == 2:
+                if isinstance(exprs[0], syntree.UnaryOp):
+                    value, ok = self.receive_expr(exprs[0], env)
+                else:
+                    value, _, ok = self.primary(exprs[0], env, comma_ok=True)
+                return [(value, self.type_of(exprs[0])), (ok, self.bool_type)]
+        return [(self.eval(expr, env), self.type_of(expr)) for expr in exprs]
+
+    def eval(self, node, env: Env) -> Any:
+        x = self.info.operands.get(node)
+        if x is not None and x.mode == "constant" and x.constant is not None:
+            return self.constant_value(x.constant, self.resolve(x.type_))
+
+        if isinstance(node, syntree.List):
+            return self.eval(in_order(node)[0], env)
+
+        elif isinstance(node, syntree.Literal):
+            return self.literal(node, env)
+
+        elif isinstance(node, syntree.PrimaryExpr):
+            return self.primary(node, env)[0]
+
+        elif isinstance(node, syntree.QualifiedIdent):
+            return self.qualified_ident(node, env)
+
+        elif isinstance(node, syntree.FunctionCall):
+            return self.call(node, env)
+
+        elif isinstance(node, syntree.BinOp):
+            return self.binary(node, env)
+
+        elif isinstance(node, syntree.UnaryOp):
+            return self.unary(node, env)
+
+        elif isinstance(node, syntree.Function):
+            return Closure(node, env, self.frames[-1].mapping)
+
+        elif isinstance(node, syntree.Type):
+            return TypeName(self.resolve(node))
+
+        raise Unsupported(f"{checker.expr_string(node)} can't be evaluated")
+
+    def lookup(self, name: str, env: Env) -> Any:
+        try:
+            return env.lookup(name)
+        except KeyError:
+            try:
+                return self.universe.lookup(name)
+            except KeyError:
+                if name in checker.unsupported_builtins:
+                    raise Unsupported(f"the builtin {name} is not supported")
+                raise Unsupported(f"undefined: {name}")
+
+    def literal(self, node: syntree.Literal, env: Env) -> Any:
+        if isinstance(node.type_, syntree.Type):
+            return self.composite(self.resolve(node.type_), node.value, env)
+        # a constant converted to a type parameter, which isn't constant
+        return self.constant_value(constant.from_literal(node), self.type_of(node))
+
+    def composite(self, t: syntree.Type, values, env: Env) -> Any:
+        elements = [] if values is None else list(reversed(values.children))
+        u = underlying(t)
+        if isinstance(u, syntree.Struct):
+            value = self.zero(t)
+            for element, field in zip(elements, u.fields):
+                if isinstance(element, syntree.KeyedElement):
+                    field = u.field(element.key.data[1])
+                    element = element.value
+                value.fields[field.f_name] = self.element(element, field.type_, env)
+            return value
+
+        elif isinstance(u, (syntree.Array, syntree.Slice)):
+            items: Dict[int, Any] = {}
+            index = 0
+            for element in elements:
+                if isinstance(element, syntree.KeyedElement):
+                    index = self.eval(element.key, env)
+                    element = element.value
+                items[index] = self.element(element, u.eltype, env)
+                index += 1
+            length = u.length if isinstance(u, syntree.Array) else max(items, default=-1) + 1
+            array = [items[i] if i in items else self.zero(u.eltype) for i in range(length)]
+            if isinstance(u, syntree.Array):
+                return array
+            self.allocate(u.eltype, length)
+            return SliceValue(array, 0, length, length)
+
+        elif isinstance(u, syntree.Map):
+            value = MapValue(t)
+            self.allocate_map(t, len(elements))
+            for element in elements:
+                key = self.element(element.key, u.key, env)
+                value.entries[key_of(key)] = (key, self.element(element.value, u.eltype, env))
+            return value
+        raise Unsupported(f"composite literals of type {type_string(t)} are not supported")
+
+    def element(self, node, type_: syntree.Type, env: Env) -> Any:
+        if isinstance(node, syntree.LiteralValue):
+            # the type of the elements can be elided, like {1, 2} for &Point{1, 2}
+            if isinstance(underlying(type_), syntree.Pointer):
+                base = underlying(type_).base
+                value = self.composite(base, node, env)
+                self.allocate(base)
+                return Cell(value)
+            return self.composite(type_, node, env)
+        return self.assign_value(self.eval(node, env), self.type_of(node), type_)
+
+    def primary(self, node: syntree.PrimaryExpr, env: Env, comma_ok: bool = False
+                ) -> Tuple[Any, Optional[Ref], bool]:
+        """The value of a primary expression, the variable it is if it is
+        addressable (or a map index) and, if comma_ok, if the last index
+        of a map or type assertion succeeded instead of panicking"""
+        if isinstance(node.data, tuple):
+            obj = self.info.uses.get(node)
+            if obj is not None and obj.kind == "const":
+                # a constant with steps which aren't constant, like digits[i]
+                value, ref = self.constant_value(obj.constant, self.resolve(obj.type_)), None
+            else:
+                obj = self.lookup(node.data[1], env)
+                value, ref = (obj.value, obj) if isinstance(obj, Cell) else (obj, None)
+            steps = node.children
+        else:
+            base = node.children[0]
+            x = self.info.operands.get(base)
+            if x is not None and x.mode == "type":
+                # the pointer type of a method expression, like (*Point).scale
+                value, ref = None, None
+            elif isinstance(base, syntree.UnaryOp) and base.operator == "*":
+                ref = self.place(base, env)
+                value = ref.get()
+            else:
+                value, ref = self.eval(base, env), None
+            steps = node.children[1:]
+
+        ok = True
+        for i, step in enumerate(steps):
+            last = comma_ok and i == len(steps) - 1
+            if isinstance(step, syntree.Index):
+                value, ref, ok = self.index(value, ref, step, env, last)
+            elif isinstance(step, syntree.SliceExpr):
+                value, ref = self.slice(value, step, env), None
+            elif isinstance(step, syntree.Selector):
+                value, ref = self.select(value, ref, step)
+            elif isinstance(step, syntree.TypeAssertion):
+                value, ok = self.type_assertion(value, step, steps[i - 1] if i else None, last)
+                ref = None
+        return value, ref, ok
+
+    def index(self, value: Any, ref: Optional[Ref], step: syntree.Index, env: Env,
+              comma_ok: bool) -> Tuple[Any, Optional[Ref], bool]:
+        x = self.info.operands.get(step)
+        if isinstance(value, Closure):
+            # an instantiation of a generic function, the type arguments
+            # are the ones of the call
+            return value, None, True
+        if x is not None and x.mode == "mapindex":
+            key = self.eval(step.expr, env)
+            if isinstance(value, MapValue):
+                key = self.assign_value(key, self.type_of(step.expr), underlying(value.type_).key)
+            ref = MapRef(value, key, self.zero(x.type_))
+            ok = value is not None and key_of(key) in value.entries
+            return ref.get(), ref, ok
+
+        i = self.eval(step.expr, env)
+        if isinstance(value, Ref):
+            # a pointer to an array
+            value = value.get()
+            ref = True
+        if isinstance(value, bytes):
+            check_index(i, len(value))
+            return value[i], None, True
+        elif isinstance(value, list):
+            check_index(i, len(value))
+            return value[i], ElementRef(value, i) if ref is not None else None, True
+        elif isinstance(value, SliceValue):
+            check_index(i, value.length)
+            return value.array[value.offset + i], ElementRef(value.array, value.offset + i), True
+        elif value is None:
+            check_index(i, 0)
+        raise Unsupported(f"cannot index {checker.expr_string(step.expr)}")
+
+    def slice(self, value: Any, step: syntree.SliceExpr, env: Env) -> Any:
+        low = 0 if step.low is None else self.eval(step.low, env)
+        high = None if step.high is None else self.eval(step.high, env)
+        max_ = None if step.max is None else self.eval(step.max, env)
+        return self.slice_of(value, low, high, max_)
+
+    def slice_of(self, value: Any, low: int, high: Optional[int], max_: Optional[int]) -> Any:
+        """value[low:high:max_], high and max_ are None if they aren't given"""
+        if isinstance(value, Ref):
+            value = value.get()
+
+        if isinstance(value, bytes):
+            high = len(value) if high is None else high
+            check_bounds(low, high, len(value))
+            return value[low:high]
+        if isinstance(value, list):
+            array, offset, length, cap = value, 0, len(value), len(value)
+        elif isinstance(value, SliceValue):
+            array, offset, length, cap = value.array, value.offset, value.length, value.cap
+        else:
+            array, offset, length, cap = [], 0, 0, 0
+        high = length if high is None else high
+        check_bounds(low, high, cap if max_ is None else max_)
+        max_ = cap if max_ is None else max_
+        if max_ > cap:
+            raise runtime_error(f"slice bounds out of range [::{max_}] with capacity {cap}")
+        if value is None and high == 0:
+            return None
+        return SliceValue(array, offset + low, high - low, max_ - low)
+
+    def select(self, value: Any, ref: Optional[Ref], step: syntree.Selector
+               ) -> Tuple[Any, Optional[Ref]]:
+        selection = self.info.selections.get(step)
+        name = step.field_name
+        if isinstance(value, PackageRef):
+            return self.member(value, name), None
+        if selection is None:
+            raise Unsupported(f"selector .{name} can't be evaluated")
+
+        if selection.kind == "field":
+            # the x of a.x is the one of a.B if it is promoted from B
+            return promote(value, ref, selection.path + [selection.obj])
+
+        if selection.kind == "methodexpr":
+            return self.method_expr(selection), None
+        method, recv_type, value, ref = self.dispatch(
+            selection.obj, name, self.resolve(selection.recv), value, ref, selection.path
+        )
+        return self.bind(method, recv_type, value, ref), None
+
+    def method_expr(self, selection) -> MethodExpr:
+        recv_type = self.resolve(selection.recv)
+        path = selection.path
+        embedded = self.resolve(path[-1].type_) if path else recv_type
+        return MethodExpr(selection.obj, syntree.method_mapping(selection.obj, embedded),
+                          path, recv_type)
+
+    def dispatch(self, method: Any, name: str, recv_type: Any, value: Any, ref: Optional[Ref],
+                 path: list) -> Tuple[syntree.Method, Any, Any, Optional[Ref]]:
+        """The method name called and its receiver (with its type), for a
+        method of a value of recv_type promoted through the embedded fields
+        of the path. The method of an interface is the one of its dynamic type"""
+        while True:
+            if path:
+                value, ref = promote(value, ref, path)
+                recv_type = self.resolve(path[-1].type_)
+            if not (syntree.is_interface(recv_type) or isinstance(recv_type, syntree.TypeParam)):
+                return method, recv_type, value, ref
+            # the method of the dynamic type
+            if value is None:
+                raise nil_dereference()
+            if isinstance(value, Boxed):
+                recv_type, value = value.type_, value.value
+            method, path = syntree.lookup_field_or_method(recv_type, name)
+            ref = None
+
+    def bind(self, method: syntree.Method, recv_type: syntree.Type, value: Any,
+             ref: Optional[Ref]) -> BoundMethod:
+        """The method value of a value of type recv_type (taking its
+        address or dereferencing it for the receiver of the method)"""
+        pointer = isinstance(underlying(recv_type), syntree.Pointer)
+        if method.pointer_receiver:
+            if not pointer:
+                value = ref if isinstance(ref, Ref) else Cell(value)
+        elif pointer:
+            if value is None:
+                raise nil_dereference()
+            value = copy_value(value.get())
+        else:
+            value = copy_value(value)
+        return BoundMethod(method, value, syntree.method_mapping(method, recv_type))
+
+    def type_assertion(self, value: Any, step: syntree.TypeAssertion, prev, comma_ok: bool
+                       ) -> Tuple[Any, bool]:
+        t = self.resolve(step.type_)
+        result, ok = self.asserted(value, t)
+        if not ok and not comma_ok:
+            static = self.type_of(prev) if prev is not None else None
+            iface = type_string(static) if static is not None else "interface {}"
+            if not isinstance(value, Boxed):
+                raise Panic(TypeAssertionError(f"{iface} is nil, not {type_string(t)}"))
+            if syntree.is_interface(t):
+                raise Panic(TypeAssertionError(
+                    f"{type_string(value.type_)} is not {type_string(t)}: missing method"
+                ))
+            raise Panic(TypeAssertionError(
+                f"{iface} is {type_string(value.type_)}, not {type_string(t)}"
+            ))
+        return result, ok
+
+    def asserted(self, value: Any, t: syntree.Type) -> Tuple[Any, bool]:
+        """The value of the interface value asserted to be of type t, and
+        whether it is (it is the zero value of t otherwise)"""
+        if syntree.is_interface(t):
+            ok = isinstance(value, Boxed) and self.implements(value.type_, t)
+            return (value if ok else None), ok
+        ok = isinstance(value, Boxed) and identical(value.type_, t)
+        return (value.value if ok else self.zero(t)), ok
+
+    def implements(self, t: syntree.Type, iface: syntree.Type) -> bool:
+        for method in underlying(iface).methods:
+            found, path = syntree.lookup_field_or_method(t, method.m_name)
+            if (not isinstance(found, (syntree.Method, syntree.InterfaceMethod))
+                    or (getattr(found, "pointer_receiver", False)
+                        and not syntree.through_pointer(t, path))):
+                return False
+        return True
+
+    def qualified_ident(self, node: syntree.QualifiedIdent, env: Env) -> Any:
+        package = self.lookup(node.data[0][1], env)
+        return self.member(package, node.data[1][1])
+
+    def member(self, package: PackageRef, name: str) -> Any:
+        if package.members is None:
+            raise Unsupported(f"package {package.path} is not supported")
+        if name not in package.members:
+            raise Unsupported(f"{package.path}.{name} is not supported")
+        member = package.members[name]
+        return member.value if isinstance(member, Cell) else member
+
+    def binary(self, node: syntree.BinOp, env: Env) -> Any:
+        operator = node.operator
+        if operator == "&&":
+            return self.eval(node.left, env) and self.eval(node.right, env)
+        elif operator == "||":
+            return self.eval(node.left, env) or self.eval(node.right, env)
+
+        x = self.eval(node.left, env)
+        y = self.eval(node.right, env)
+        if operator in ("==", "!="):
+            left, right = self.type_of(node.left), self.type_of(node.right)
+            # a value compared to an interface is boxed
+            x = self.assign_value(x, left, right)
+            y = self.assign_value(y, right, left)
+            return self.equal(x, y) == (operator == "==")
+        elif operator in ("<", "<=", ">", ">="):
+            return {"<": x < y, "<=": x <= y, ">": x > y, ">=": x >= y}[operator]
+        return self.arith(operator, x, y, self.type_of(node))
+
+    def arith(self, operator: str, x: Any, y: Any, t: Optional[syntree.Type]) -> Any:
+        typename = basic_typename(underlying(t)) if t is not None else None
+        if isinstance(x, bytes):
+            return self.concat(x, y)
+        if isinstance(x, int) and not isinstance(x, bool):
+            if operator == "+":
+                r = x + y
+            elif operator == "-":
+                r = x - y
+            elif operator == "*":
+                r = x * y
+            elif operator in ("/", "%"):
+                if y == 0:
+                    raise runtime_error("integer divide by zero")
+                # the quotient is truncated towards zero
+                q = abs(x) // abs(y)
+                q = q if (x < 0) == (y < 0) else -q
+                r = q if operator == "/" else x - q * y
+            elif operator == "&":
+                r = x & y
+            elif operator == "|":
+                r = x | y
+            elif operator == "^":
+                r = x ^ y
+            elif operator == "&^":
+                r = x & ~y
+            elif operator in ("<<", ">>"):
+                if y < 0:
+                    raise runtime_error("negative shift amount")
+                size = untyped.int_size(typename) if typename in untyped.int_typenames else 64
+                if operator == "<<":
+                    r = 0 if y >= size else x << y
+                else:
+                    r = (-1 if x < 0 else 0) if y >= size else x >> y
+            else:
+                raise Unsupported(f"operator {operator}")
+            return wrap(r, typename or "int")
+
+        if operator == "+":
+            r = x + y
+        elif operator == "-":
+            r = x - y
+        elif operator == "*":
+            r = x * y
+        elif operator == "/":
+            try:
+                r = x / y
+            except ZeroDivisionError:
+                r = float_division_by_zero(x, y)
+        else:
+            raise Unsupported(f"operator {operator}")
+        return wrap(r, typename) if typename is not None else r
+
+    def equal(self, x: Any, y: Any) -> bool:
+        if isinstance(x, Boxed) or isinstance(y, Boxed):
+            if not (isinstance(x, Boxed) and isinstance(y, Boxed)):
+                return False
+            if not identical(x.type_, y.type_):
+                return False
+            if not checker.comparable(x.type_):
+                raise runtime_error(f"comparing uncomparable type {type_string(x.type_)}")
+            return self.equal(x.value, y.value)
+        if isinstance(x, StructValue):
+            return all(self.equal(v, y.fields[k]) for k, v in x.fields.items())
+        if isinstance(x, list):
+            return all(self.equal(v, w) for v, w in zip(x, y))
+        if x is None or y is None:
+            return x is y
+        if isinstance(x, (SliceValue, MapValue, Closure)):
+            return x is y
+        return x == y
+
+    def unary(self, node: syntree.UnaryOp, env: Env) -> Any:
+        operator = node.operator
+        if operator == "&":
+            operand = node.operand
+            if isinstance(operand, syntree.List):
+                operand = in_order(operand)[0]
+            if isinstance(operand, syntree.Literal):
+                value = self.eval(operand, env)
+                self.allocate(self.type_of(operand))
+                return Cell(value)
+            return self.place(operand, env)
+        elif operator == "*":
+            pointer = self.eval(node.operand, env)
+            if pointer is None:
+                raise nil_dereference()
+            return pointer.get()
+        elif operator == "<-":
+            return self.receive_expr(node, env)[0]
+
+        x = self.eval(node.operand, env)
+        typename = basic_typename(underlying(self.type_of(node)))
+        if operator == "!":
+            return not x
+        elif operator == "+":
+            return x
+        elif operator == "-":
+            return wrap(-x, typename) if typename is not None else -x
+        elif operator == "^":
+            if typename is not None and untyped.is_unsigned(typename):
+                return x ^ ((1 << untyped.int_size(typename)) - 1)
+            return wrap(~x, typename or "int")
+        raise Unsupported(f"operator {operator}")
+
+    # calls
+
+    def call(self, node: syntree.FunctionCall, env: Env) -> Any:
+        fn, args = self.prepare_call(node, env)
+        if node.lineno is not None:
+            self.frames[-1].line = node.lineno
+        return self.call_function(fn, args)
+
+    def callee(self, node: syntree.FunctionCall, env: Env) -> Any:
+        if isinstance(node.fn_name, str):
+            fn = self.lookup(node.fn_name, env)
+            return fn.value if isinstance(fn, Cell) else fn
+        x = self.info.operands.get(node.fn_name)
+        if x is not None and x.mode == "type":
+            # a conversion to a type literal, like []byte(s) or (*T)(p)
+            return TypeName(self.resolve(x.type_))
+        return self.eval(node.fn_name, env)
+
+    def prepare_call(self, node: syntree.FunctionCall, env: Env) -> Tuple[Any, list]:
+        """The function called and its arguments, converted to the types of
+        the parameters (the variadic ones are in a slice)"""
+        args = in_order(node.arguments.expression_list)
+        if node.arguments.type_ is not None:
+            args = [node.arguments.type_] + args
+        fn = self.callee(node, env)
+
+        if isinstance(fn, Builtin):
+            values = [(self.resolve(arg) if isinstance(arg, syntree.Type)
+                       else self.builtin_arg(arg, env), self.type_of(arg)) for arg in args]
+            spread = node.arguments.ellipsis
+            return Native(fn.name, lambda interp, _: interp.builtin(fn.name, values, spread)), []
+        if isinstance(fn, TypeName):
+            x = self.eval(args[0], env)
+            return Native("conversion", lambda interp, _: interp.convert(
+                x, self.type_of(args[0]), fn.type_)), []
+
+        values = self.values(args, env) if args else []
+        if isinstance(fn, Native):
+            if node.arguments.ellipsis:
+                # the natives (like fmt.Println) take the elements of the slice
+                slice_, t = values.pop()
+                eltype = underlying(t).eltype if t is not None else None
+                values += [(v, eltype) for v in elements_of(slice_)]
+            return fn, [self.assign_value(v, t, self.any_type) for v, t in values]
+
+        if isinstance(fn, Closure):
+            signature, mapping = fn.node.signature, dict(fn.mapping)
+            type_args = getattr(node, "type_args", None)
+            if signature.type_params and type_args:
+                mapping.update(zip(signature.type_params, (self.resolve(t) for t in type_args)))
+            fn = Closure(fn.node, fn.env, mapping)
+            params = parameters(signature.parameters)
+        elif isinstance(fn, BoundMethod):
+            mapping = fn.mapping
+            params = parameters(fn.method.signature.parameters)
+        elif isinstance(fn, MethodExpr):
+            mapping = fn.mapping
+            params = [(None, fn.recv, False)]
+            params += parameters(fn.method.signature.parameters)
+        elif fn is None:
+            raise nil_dereference()
+        else:
+            raise Unsupported("call of a value which is not a function")
+
+        converted = []
+        for i, (ident, type_, vararg) in enumerate(params):
+            type_ = syntree.substitute(type_, mapping)
+            if vararg and node.arguments.ellipsis:
+                # f(s...) passes the slice itself
+                converted.append(values[i][0])
+                break
+            elif vararg:
+                rest = [self.assign_value(v, t, type_) for v, t in values[i:]]
+                converted.append(SliceValue(rest, 0, len(rest), len(rest)) if rest else None)
+                break
+            value, from_type = values[i]
+            converted.append(self.assign_value(value, from_type, type_))
+        return fn, converted
+
+    def builtin_arg(self, arg, env: Env) -> Any:
+        value = self.eval(arg, env)
+        return value.type_ if isinstance(value, TypeName) else value
+
+    def call_function(self, fn: Any, args: list, deferred_by: Optional[Frame] = None) -> Any:
+        if isinstance(fn, Native):
+            return fn.fn(self, args)
+        elif isinstance(fn, Closure):
+            return self.run_function(fn.node, fn.env, args, fn.mapping, deferred_by=deferred_by)
+        elif isinstance(fn, BoundMethod):
+            env = self.method_envs.get(id(fn.method), self.globals)
+            return self.run_function(fn.method, env, args, fn.mapping, fn.recv, deferred_by)
+        elif isinstance(fn, MethodExpr):
+            recv = fn.receiver(args[0])
+            env = self.method_envs.get(id(fn.method), self.globals)
+            return self.run_function(fn.method, env, args[1:], fn.mapping, recv, deferred_by)
+        raise nil_dereference()
+
+    def run_function(self, node: syntree.Function, parent: Env, args: list, mapping: dict,
+                     recv: Any = None, deferred_by: Optional[Frame] = None) -> Any:
+        signature = node.signature
+        env = Env(parent)
+        frame = Frame(node, mapping)
+        frame.deferred_by = deferred_by
+        frame.scope = env
+        self.frames.append(frame)
+        try:
+            # the receiver of a method is declared like a parameter
+            params = (parameters(node.receiver) if isinstance(node, syntree.Method) else [])
+            values = ([recv] if params else []) + args
+            for (ident, _, _), value in zip(params + parameters(signature.parameters), values):
+                if ident is not None:
+                    env.declare(ident.ident_name, Cell(value))
+            named = []
+            if signature.has_named_results:
+                for ident, type_, _ in parameters(signature.result):
+                    cell = Cell(self.zero(syntree.substitute(type_, mapping)))
+                    named.append(cell)
+                    if ident is not None:
+                        env.declare(ident.ident_name, cell)
+
+            returned = None
+            try:
+                # the parameters and the function body are in the same block
+                self.statements(node.body, env)
+            except _Return as r:
+                returned = r.values
+                if returned is not None and named:
+                    for cell, value in zip(named, returned):
+                        cell.value = value
+            except Panic as p:
+                frame.panic = p
+            self.run_defers(frame)
+            if frame.panic is not None:
+                frame.panic.unwind(node)
+                raise frame.panic
+
+            # deferred functions can change the named results
+            if named:
+                returned = [cell.value for cell in named]
+            returned = returned or []
+            if len(returned) == 1:
+                return returned[0]
+            return tuple(returned) if returned else None
+        finally:
+            self.frames.pop()
+
+    def run_defers(self, frame: Frame):
+        """Runs the calls deferred by the function of the frame, last in first out.
+        A panic in a deferred call replaces the one the function was in"""
+        while frame.defers:
+            fn, args = frame.defers.pop()
+            panic = frame.panic
+            try:
+                self.call_function(fn, args, deferred_by=frame)
+            except Panic as p:
+                if panic is not None and p is not panic:
+                    # the deferred call ran on top of the frames the panic
+                    # it replaces was in, the stack trace goes through them
+                    p.trace.extend(panic.trace)
+                    p.line = panic.line
+                frame.panic = p
+
+    def recover(self) -> Any:
+        # it stops a panic only if it is called by the deferred function itself
+        deferred_by = self.frames[-1].deferred_by
+        if deferred_by is None or deferred_by.panic is None:
+            return None
+        value = deferred_by.panic.value
+        deferred_by.panic = None
+        return value
+
+    def builtin(self, name: str, args: List[Tuple[Any, Any]], spread: bool = False) -> Any:
+        values = [value for value, _ in args]
+        if name == "len":
+            return length(values[0])
+        elif name == "cap":
+            x = values[0]
+            if isinstance(x, Ref):
+                x = x.get()
+            if isinstance(x, (SliceValue, ChanValue)):
+                return x.cap
+            return 0 if x is None else len(x)
+        elif name == "append":
+            s, t = args[0]
+            eltype = underlying(t).eltype if t is not None else None
+            if spread:
+                # append(s, t...), t can be a string for a []byte
+                other = args[1][0]
+                values = list(other) if isinstance(other, bytes) else elements_of(other)
+                values = [copy_value(v) for v in values]
+            else:
+                values = [self.assign_value(v, vt, eltype) for v, vt in args[1:]]
+            result = append(s, values, lambda: self.zero(eltype))
+            if result is not None and (s is None or result.array is not s.array):
+                self.allocate(eltype, result.cap)
+            return result
+        elif name == "copy":
+            dst, src = values
+            elements = list(src) if isinstance(src, bytes) else elements_of(src)
+            n = min(length(dst), len(elements))
+            for i in range(n):
+                dst.array[dst.offset + i] = copy_value(elements[i])
+            return n
+        elif name == "delete":
+            m, key = values
+            if m is not None:
+                key = self.assign_value(key, args[1][1], underlying(m.type_).key)
+                m.entries.pop(key_of(key), None)
+            return None
+        elif name == "make":
+            t = values[0]
+            u = underlying(t)
+            if isinstance(u, syntree.Map):
+                self.allocate_map(t, values[1] if len(values) > 1 else 0)
+                return MapValue(t)
+            elif isinstance(u, syntree.Slice):
+                n = values[1] if len(values) > 1 else 0
+                cap = values[2] if len(values) > 2 else n
+                if n < 0:
+                    raise runtime_error("makeslice: len out of range")
+                if cap < n:
+                    raise runtime_error("makeslice: cap out of range")
+                self.allocate(u.eltype, cap)
+                return SliceValue([self.zero(u.eltype) for _ in range(cap)], 0, n, cap)
+            elif isinstance(u, syntree.Chan):
+                n = values[1] if len(values) > 1 else 0
+                if n < 0:
+                    raise Panic(PlainError("makechan: size out of range"))
+                # the header of the channel (an hchan) and its buffer
+                eltype = self.resolve(u.eltype)
+                self.allocate_bytes(96 + size_of(eltype)[0] * n)
+                return ChanValue(t, n, lambda: self.zero(eltype))
+            raise Unsupported(f"make of {type_string(t)} is not supported")
+        elif name == "new":
+            self.allocate(values[0])
+            return Cell(self.zero(values[0]))
+        elif name == "panic":
+            value, t = args[0]
+            raise Panic(self.assign_value(value, t, self.any_type))
+        elif name == "recover":
+            return self.recover()
+        elif name == "close":
+            self.close(values[0])
+            return None
+        elif name == "complex":
+            real, imag = values
+            return wrap(complex(real, imag), basic_typename(args[0][1]) == "float32"
+                        and "complex64" or "complex128")
+        elif name in ("real", "imag"):
+            value = values[0].real if name == "real" else values[0].imag
+            return wrap(value, "float32" if basic_typename(args[0][1]) == "complex64"
+                        else "float64")
+        elif name in ("min", "max"):
+            return min_max(name, values)
+        raise Unsupported(f"{name} is not supported")
+
+    # channels, the goroutines blocked on them wait in their queues (see sched.py)
+
+    def receive_expr(self, node: syntree.UnaryOp, env: Env) -> Tuple[Any, bool]:
+        """The value <-ch receives, and whether it was sent"""
+        ch = self.eval(node.operand, env)
+        if node.lineno is not None:
+            self.frames[-1].line = node.lineno
+        return self.receive(ch)
+
+    def send(self, ch: Optional[ChanValue], value: Any):
+        if ch is None:
+            self.scheduler.park("chan send (nil chan)")
+        self.race_sync(ch, write=False)
+        if ch.closed:
+            raise Panic(PlainError("send on closed channel"))
+        receiver = sched.first(ch.recvq)
+        if receiver is not None:
+            self.scheduler.wake(receiver, value, True)
+        elif len(ch.buffer) < ch.cap:
+            ch.buffer.append(value)
+        else:
+            g = self.scheduler.current
+            ch.sendq.append(sched.Waiter(g, value))
+            self.scheduler.park("chan send")
+            self.race_sync(ch)
+            if not g.ok:
+                raise Panic(PlainError("send on closed channel"))
+
+    def receive(self, ch: Optional[ChanValue]) -> Tuple[Any, bool]:
+        """The value received from ch, and whether it was sent (it is the
+        zero value if ch is closed)"""
+        if ch is None:
+            self.scheduler.park("chan receive (nil chan)")
+        self.race_sync(ch)
+        sender = sched.first(ch.sendq)
+        if sender is not None:
+            # the buffer is full, the sender's value goes at its end
+            value = sender.value
+            if ch.cap:
+                value = ch.buffer.popleft()
+                ch.buffer.append(sender.value)
+            self.scheduler.wake(sender, None, True)
+            return value, True
+        if ch.buffer:
+            return ch.buffer.popleft(), True
+        if ch.closed:
+            return ch.zero(), False
+        g = self.scheduler.current
+        ch.recvq.append(sched.Waiter(g))
+        self.scheduler.park("chan receive")
+        self.race_sync(ch)
+        return g.value, g.ok
+
+    def received(self, ch: Optional[ChanValue], line: Optional[int]) -> Iterator:
+        """The values of a range over ch, received until it is closed"""
+        while True:
+            self.frames[-1].line = line
+            value, ok = self.receive(ch)
+            if not ok:
+                return
+            yield value, None
+
+    def close(self, ch: Optional[ChanValue]):
+        if ch is None:
+            raise Panic(PlainError("close of nil channel"))
+        if ch.closed:
+            raise Panic(PlainError("close of closed channel"))
+        self.race_sync(ch, write=True)
+        ch.closed = True
+        # the receivers get the zero value, the senders panic
+        for queue, value in ((ch.recvq, ch.zero), (ch.sendq, lambda: None)):
+            waiter = sched.first(queue)
+            while waiter is not None:
+                self.scheduler.wake(waiter, value(), False)
+                waiter = sched.first(queue)
+
+    def selectgo(self, cases: List[Tuple[Optional[ChanValue], Any, bool]], default: bool
+                 ) -> Tuple[int, Any, bool]:
+        """Runs one of the communications of a select which can proceed,
+        chosen at random. cases are the (channel, value sent, if it is a
+        send) of its cases, the nil channels are never ready. Returns the
+        index of the case with the value received and whether it was sent,
+        -1 if none is ready and there is a default case, else the goroutine
+        waits for one"""
+        for i in sched.poll_order(len(cases)):
+            ch, value, send = cases[i]
+            if ch is None:
+                continue
+            if send and (ch.closed or sched.peek(ch.recvq) or len(ch.buffer) < ch.cap):
+                self.send(ch, value)
+                return i, None, True
+            if not send and (sched.peek(ch.sendq) or ch.buffer or ch.closed):
+                value, ok = self.receive(ch)
+                return i, value, ok
+        if default:
+            return -1, None, False
+
+        g = self.scheduler.current
+        selection = sched.Selection()
+        waiters = []
+        for i, (ch, value, send) in enumerate(cases):
+            if ch is not None:
+                self.race_sync(ch)
+                waiter = sched.Waiter(g, value, i, selection)
+                queue = ch.sendq if send else ch.recvq
+                queue.append(waiter)
+                waiters.append((queue, waiter))
+        self.scheduler.park("select" if cases else "select (no cases)")
+        for queue, waiter in waiters:
+            if waiter in queue:
+                queue.remove(waiter)
+        i = g.case
+        self.race_sync(cases[i][0])
+        if cases[i][2]:
+            if not g.ok:
+                raise Panic(PlainError("send on closed channel"))
+            return i, None, True
+        return i, g.value, g.ok
+
+    def race_sync(self, ch: ChanValue, write: Optional[bool] = None):
+        """The communications of ch happen in order, for the race detector:
+        the goroutines sync on it when they start one and when they are
+        woken up by another one. A send reads ch and close writes it (write
+        is given then), so they race if they aren't synchronized, like Go"""
+        if self.race is not None:
+            if write is not None:
+                self.race.access(ch, write)
+            self.race.sync(self.scheduler.current, ch)
+
+    def convert(self, value: Any, from_type: Any, to_type: syntree.Type) -> Any:
+        """The value converted to the type, like T(x)"""
+        to_type = self.resolve(to_type)
+        u = underlying(to_type)
+        if syntree.is_interface(to_type):
+            return self.assign_value(value, from_type, to_type)
+        typename = basic_typename(u)
+        from_name = basic_typename(underlying(from_type)) if from_type is not None else None
+        kind = untyped.kind_of_typename(typename) if typename is not None else None
+        if kind == "string":
+            if isinstance(value, int):
+                # the UTF-8 encoding of a rune
+                valid = 0 <= value <= 0x10FFFF and not 0xD800 <= value <= 0xDFFF
+                return chr(value if valid else 0xFFFD).encode()
+            if isinstance(value, (SliceValue, type(None))):
+                elements = elements_of(value)
+                if from_name is None and isinstance(underlying(from_type), syntree.Slice):
+                    from_name = basic_typename(underlying(underlying(from_type).eltype))
+                if from_name in ("rune", "int32"):
+                    s = "".join(chr(r) if 0 <= r <= 0x10FFFF and not 0xD800 <= r <= 0xDFFF
+                                else "�" for r in elements).encode()
+                else:
+                    s = bytes(elements)
+                self.allocate_bytes(len(s))
+                return s
+            return value
+        if isinstance(u, syntree.Slice) and isinstance(value, bytes):
+            # []byte(s) or []rune(s)
+            if basic_typename(underlying(u.eltype)) in ("rune", "int32"):
+                elements = [r for _, r in runes(value)]
+            else:
+                elements = list(value)
+            self.allocate(u.eltype, len(elements))
+            return SliceValue(elements, 0, len(elements), len(elements))
+        if kind == "int":
+            if isinstance(value, float):
+                if math.isnan(value) or math.isinf(value):
+                    # the result is implementation dependent
+                    return wrap(-(1 << 63), typename)
+                value = int(value)
+            return wrap(value, typename)
+        if kind == "float":
+            return wrap(float(value.real if isinstance(value, complex) else value), typename)
+        if kind == "complex":
+            return wrap(complex(value), typename)
+        return copy_value(value)
+
+    # formatting, like fmt does for %v
+
+    def format(self, value: Any, t: Any = None, verb: str = "v", plus: bool = False,
+               depth: int = 0, padded: Optional[Callable[[str], str]] = None) -> str:
+        """The value of type t formatted like fmt does for the verbs v or s
+        (plus is for %+v, which shows the names of the fields). padded pads
+        the values which aren't slices, arrays, maps or structs, like fmt
+        does for a width: the elements are padded, not the brackets"""
+        t = self.resolve(t)
+        leaf = padded or (lambda text: text)
+        if isinstance(value, Boxed):
+            held = reflect_held(self, value)
+            if held is not value:
+                # a reflect.Value is formatted like the value it holds
+                return self.format(held, None, verb, plus, depth, padded)
+            return self.format(value.value, value.type_, verb, plus, depth, padded)
+        method = self.string_method(value, t)
+        if method is not None:
+            return leaf(self.call_function(method, []).decode("utf-8", "replace"))
+        u = underlying(t) if t is not None else None
+
+        if value is None:
+            if isinstance(u, syntree.Slice):
+                return "[]"
+            elif isinstance(u, syntree.Map):
+                return "map[]"
+            elif depth > 0 and syntree.is_interface(u):
+                # a nil element of an interface type isn't padded
+                return "<nil>"
+            return leaf("<nil>")
+        elif isinstance(value, bool):
+            return leaf("true" if value else "false")
+        elif isinstance(value, int):
+            return leaf(str(value))
+        elif isinstance(value, float):
+            return leaf(format_float(value, 32 if basic_typename(u) == "float32" else 64))
+        elif isinstance(value, complex):
+            size = 32 if basic_typename(u) == "complex64" else 64
+            return leaf(format_complex(value, size))
+        elif isinstance(value, bytes):
+            return leaf(value.decode("utf-8", "replace"))
+        elif isinstance(value, GoRuntimeError):
+            return leaf(str(value))
+
+        eltype = getattr(u, "eltype", None)
+        if isinstance(value, (list, SliceValue)):
+            elements = value if isinstance(value, list) else value.elements()
+            return "[" + " ".join(self.format(e, eltype, verb, plus, depth + 1, padded)
+                                  for e in elements) + "]"
+        elif isinstance(value, MapValue):
+            key_type = underlying(value.type_).key
+            entries = sorted_entries(value)
+            return "map[" + " ".join(
+                f"{self.format(k, key_type, verb, plus, depth + 1, padded)}:"
+                f"{self.format(v, eltype, verb, plus, depth + 1, padded)}" for k, v in entries
+            ) + "]"
+        elif isinstance(value, StructValue):
+            struct_type = underlying(value.type_)
+            fields = []
+            for field in struct_type.fields:
+                text = self.format(value.fields[field.f_name], field.type_, verb, plus,
+                                   depth + 1, padded)
+                fields.append(f"{field.f_name}:{text}" if plus else text)
+            return "{" + " ".join(fields) + "}"
+        elif isinstance(value, Ref):
+            pointee = value.get()
+            if depth == 0 and isinstance(pointee, (StructValue, list, SliceValue, MapValue)):
+                base = u.base if isinstance(u, syntree.Pointer) else None
+                return "&" + self.format(pointee, base, verb, plus, depth + 1, padded)
+            return leaf(address(value))
+        return leaf(address(value))
+
+    def go_syntax(self, value: Any, t: Any, depth: int = 0) -> str:
+        """The value of type t formatted like fmt does for %#v, in Go syntax:
+        the composite values have their type, like []int{1, 2}, the strings
+        are quoted and the unsigned integers are in hexadecimal. A GoString
+        method formats the value of its type"""
+        t = self.resolve(t)
+        if isinstance(value, Boxed):
+            return self.go_syntax(value.value, value.type_, depth)
+        method = self.string_method(value, t, ("GoString",))
+        if method is not None:
+            return self.call_function(method, []).decode("utf-8", "replace")
+        if t is None:
+            return "<nil>"
+        u = underlying(t)
+        name = runtime_type_string(t)
+        if syntree.is_interface(u) or (value is None and isinstance(u, (syntree.Slice,
+                                                                         syntree.Map))):
+            return f"{name}(nil)"
+        elif isinstance(u, (syntree.Pointer, syntree.FunctionType, syntree.Chan)):
+            if value is None:
+                return f"({name})(nil)"
+            if (depth == 0 and isinstance(u, syntree.Pointer) and isinstance(
+                    underlying(u.base), (syntree.Struct, syntree.Array, syntree.Slice,
+                                         syntree.Map))):
+                return "&" + self.go_syntax(value.get(), u.base, depth + 1)
+            return f"({name})({address(value)})"
+        elif isinstance(value, int) and not isinstance(value, bool) and (
+                basic_typename(u) or "").startswith(("uint", "byte")):
+            return hex(value)
+        elif isinstance(value, bytes):
+            return constant.quote(value)
+        elif isinstance(value, (list, SliceValue)):
+            elements = value if isinstance(value, list) else value.elements()
+            return name + "{" + ", ".join(self.go_syntax(e, u.eltype, depth + 1)
+                                          for e in elements) + "}"
+        elif isinstance(value, MapValue):
+            return name + "{" + ", ".join(
+                f"{self.go_syntax(k, u.key, depth + 1)}:{self.go_syntax(v, u.eltype, depth + 1)}"
+                for k, v in sorted_entries(value)
+            ) + "}"
+        elif isinstance(value, StructValue):
+            return name + "{" + ", ".join(
+                f"{f.f_name}:{self.go_syntax(value.fields[f.f_name], f.type_, depth + 1)}"
+                for f in u.fields
+            ) + "}"
+        return self.format(value, t, depth=depth + 1)
+
+    def string_method(self, value: Any, t: Any,
+                      names: Tuple[str, ...] = ("Error", "String")) -> Optional[BoundMethod]:
+        """The Error or String method of a value, which fmt calls to format it
+        (the first of names it has)"""
+        if t is None or syntree.is_interface(t) or not isinstance(t, (syntree.NamedType,
+                                                                       syntree.Pointer)):
+            return None
+        pointer = isinstance(t, syntree.Pointer)
+        for name in names:
+            method, path = syntree.lookup_field_or_method(t, name)
+            if (isinstance(method, syntree.Method)
+                    and (syntree.through_pointer(t, path) or not method.pointer_receiver)
+                    and not parameters(method.signature.parameters)
+                    and [basic_typename(r) for r in results(method.signature)] == ["string"]):
+                if pointer and value is None and not method.pointer_receiver:
+                    return None
+                method, recv_type, value, ref = self.dispatch(method, name, t, value, None, path)
+                return self.bind(method, recv_type, value, ref)
+        return None
+
+
+def run_program(packages: list, info: checker.Info, out=None,
+                argv: Optional[List[str]] = None, clock: Optional[Clock] = None,
+                debugger: Any = None, entry: str = "main", profiler: Any = None,
+                ctx: Optional[cancel.Context] = None, max_steps: Optional[int] = None,
+                limits: Optional[sandbox.Limits] = None) -> int:
+    """Runs the program of the packages (its own package is the last one)
+    with the interpreter, see Interpreter.run_program. argv is os.Args,
+    clock the one of the time package (the one of the system by default),
+    debugger the debug.Debugger of gopy debug, entry the function run instead
+    of main, profiler the pprof.Profiler profiling the run. The run is
+    aborted once ctx is done, past max_steps steps (see Interpreter.step), or
+    past the limits of its sandbox (see sandbox.py)"""
+    sys.setrecursionlimit(max(sys.getrecursionlimit(), 20000))
+    interpreter = Interpreter(info, out, argv, clock)
+    interpreter.debugger = debugger
+    interpreter.ctx = ctx
+    interpreter.max_steps = max_steps
+    if limits is not None:
+        interpreter.limits = limits
+    if profiler is None:
+        return interpreter.run_program(packages, entry)
+    profiler.start(interpreter)
+    try:
+        return interpreter.run_program(packages, entry)
+    finally:
+        profiler.stop()
+
+
+def program_function_names(packages: list) -> Dict[int, str]:
+    """The names of the functions of the packages, see syntree.function_names"""
+    names: Dict[int, str] = {}
+    for package in packages:
+        path = "main" if package.name == "main" else package.path
+        names.update(syntree.function_names(package.ast, path))
+    return names
+
+
+# the frames of a stack trace printed at most, like the runtime of Go
+max_frames = 100
+
+
+def stack_trace(trace: list, packages: list) -> str:
+    """The frames of a panic like Go prints them, the function called
+    with (...) if it has parameters, and the file and the line it is at"""
+    names = program_function_names(packages)
+    frames = []
+    for fn, line in trace[:max_frames]:
+        name = names.get(id(fn), "main.main")
+        has_params = (isinstance(fn, syntree.Method) or
+                      bool(parameters(fn.signature.parameters)))
+        frames.append(f"{name}({'...' if has_params else ''})\n"
+                      f"\t{fileset.fset.position(fn.pos).filename}:{line or fn.lineno}")
+    if len(trace) > max_frames:
+        frames.append("...additional frames elided...")
+    return "\n".join(frames) or "main.main()"
+
+
+def received_expr(comm) -> syntree.UnaryOp:
+    """The receive of the case of a select, like <-ch of v, ok := <-ch"""
+    if isinstance(comm, syntree.Assignment):
+        comm = comm.right
+    else:
+        decl = in_order(comm)[0]
+        if isinstance(decl, syntree.VarDecl):
+            comm = decl.unpack[1] if decl.unpack is not None else decl.value
+    return in_order(comm)[0]
+
+
+def package_decls(ast: syntree.Node) -> list:
+    """The declarations of the files of a package, in source order"""
+    decls = []
+    for file in reversed(ast.children):
+        for child in file.children:
+            decls.extend(in_order(child))
+    return decls
+
+
+def is_native(decl: syntree.Function, env: Env) -> bool:
+    """If the function declared in the package scope env is a native"""
+    return isinstance(env.names.get(decl.fn_name[1]), Native)
+
+
+def package_inits(ast: syntree.Node) -> list:
+    """The init functions of a package, run in the order they are declared"""
+    return [decl for decl in package_decls(ast) if isinstance(decl, syntree.Function)
+            and not isinstance(decl, syntree.Method) and decl.fn_name is not None
+            and decl.fn_name[1] == "init"]
+
+
+def identical(x: syntree.Type, y: syntree.Type) -> bool:
+    """If the dynamic types x and y are the same. The REPL parses the program
+    again for each input, so a named type can be one of an earlier parse"""
+    return checker.identical(x, y) or type_string(x) == type_string(y)
+
+
+def is_blank(expr) -> bool:
+    return (isinstance(expr, syntree.PrimaryExpr) and not expr.children
+            and isinstance(expr.data, tuple) and expr.data[1] == "_")
+
+
+def wrap(value: Any, typename: Optional[str]) -> Any:
+    """The value of an operation as a value of the numeric type, integers
+    wrap around and float32 values are rounded"""
+    if typename in untyped.int_typenames:
+        size = untyped.int_size(typename)
+        value &= (1 << size) - 1
+        if not untyped.is_unsigned(typename) and value >> (size - 1):
+            value -= 1 << size
+        return value
+    elif typename == "float32":
+        return round_float32(value)
+    elif typename == "complex64":
+        return complex(round_float32(value.real), round_float32(value.imag))
+    return value
+
+
+def round_float32(value: float) -> float:
+    try:
+        return struct.unpack("f", struct.pack("f", value))[0]
+    except OverflowError:
+        return math.copysign(math.inf, value)
+
+
+def float_division_by_zero(x: Any, y: Any) -> Any:
+    if isinstance(x, complex) or isinstance(y, complex):
+        return complex(math.nan, math.nan)
+    if x == 0 or math.isnan(x):
+        return math.nan
+    return math.copysign(math.inf, x) * math.copysign(1, y)
+
+
+def check_index(i: int, length: int):
+    if not 0 <= i < length:
+        # like Go, the length isn't given for a negative index
+        raise runtime_error(f"index out of range [{i}]" if i < 0 else
+                            f"index out of range [{i}] with length {length}")
+
+
+def check_bounds(low: int, high: int, cap: int):
+    if not 0 <= high <= cap:
+        raise runtime_error(f"slice bounds out of range [:{high}] with capacity {cap}")
+    if not 0 <= low <= high:
+        raise runtime_error(f"slice bounds out of range [{low}:{high}]")
+
+
+def length(x: Any) -> int:
+    if isinstance(x, Ref):
+        x = x.get()
+    if x is None:
+        return 0
+    elif isinstance(x, SliceValue):
+        return x.length
+    elif isinstance(x, MapValue):
+        return len(x.entries)
+    elif isinstance(x, ChanValue):
+        return len(x.buffer)
+    return len(x)
+
+
+def min_max(name: str, values: list) -> Any:
+    """The least (or the greatest) of the ordered values, a NaN if one
+    of them is and -0.0 is less than 0.0, like the min and max of Go"""
+    result = values[0]
+    for value in values[1:]:
+        if isinstance(value, float) and (math.isnan(value) or math.isnan(result)):
+            result = math.nan
+        elif value == result == 0 and isinstance(value, float):
+            negative = [math.copysign(1, v) < 0 for v in (value, result)]
+            result = -0.0 if (any(negative) if name == "min" else all(negative)) else 0.0
+        elif (value < result) == (name == "min"):
+            result = value
+    return result
+
+
+def elements_of(x: Any) -> list:
+    if x is None:
+        return []
+    elif isinstance(x, SliceValue):
+        return x.elements()
+    return list(x)
+
+
+# the sizes of the objects gc allocates up to 32 KiB, the larger ones are
+# rounded to pages (runtime/sizeclasses.go)
+size_classes = [
+    8, 16, 24, 32, 48, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224, 240, 256,
+    288, 320, 352, 384, 416, 448, 480, 512, 576, 640, 704, 768, 896, 1024, 1152, 1280,
+    1408, 1536, 1792, 2048, 2304, 2688, 3072, 3200, 3456, 4096, 4864, 5376, 6144, 6528,
+    6784, 6912, 8192, 9472, 9728, 10240, 10880, 12288, 13568, 14336, 16384, 18432,
+    19072, 20480, 21760, 24576, 27264, 28672, 32768,
+]
+
+# the sizes of the basic types on amd64, their alignment too (up to 8, the
+# one of complex64 is 4)
+basic_sizes = {
+    "bool": 1, "int8": 1, "uint8": 1, "byte": 1, "int16": 2, "uint16": 2,
+    "int32": 4, "uint32": 4, "rune": 4, "float32": 4, "int": 8, "uint": 8,
+    "int64": 8, "uint64": 8, "uintptr": 8, "float64": 8, "complex64": 8,
+    "complex128": 16, "string": 16,
+}
+
+
+def size_of(t: Any) -> Tuple[int, int]:
+    """The size and the alignment of the values of type t, like gc lays
+    them out on amd64"""
+    u = underlying(t) if t is not None else None
+    if isinstance(u, syntree.Struct):
+        size, align = 0, 1
+        for field in u.fields:
+            s, a = size_of(field.type_)
+            size = -(-size // a) * a + s
+            align = max(align, a)
+        return -(-size // align) * align, align
+    if isinstance(u, syntree.Array):
+        s, a = size_of(u.eltype)
+        return u.length * s, a
+    if isinstance(u, syntree.Slice):
+        return 24, 8
+    if isinstance(u, syntree.Interface):
+        return 16, 8
+    name = basic_typename(u) if u is not None else None
+    size = basic_sizes.get(name, 8)
+    return size, 4 if name == "complex64" else min(size, 8)
+
+
+def size_class(size: int) -> int:
+    """The bytes gc allocates for an object of the size"""
+    if size > size_classes[-1]:
+        return -(-size // 8192) * 8192
+    return size_classes[bisect.bisect_left(size_classes, size)]
+
+
+def append(s: Optional[SliceValue], values: list, zero: Callable) -> Optional[SliceValue]:
+    if not values:
+        return s
+    if s is None:
+        s = SliceValue([], 0, 0, 0)
+    n = s.length + len(values)
+    if n <= s.cap:
+        # the elements are added in the same array
+        s.array[s.offset + s.length:s.offset + n] = values
+        return SliceValue(s.array, s.offset, n, s.cap)
+    cap = max(2 * s.cap, n)
+    array = s.elements() + values + [zero() for _ in range(cap - n)]
+    return SliceValue(array, 0, n, cap)
+
+
+def runes(s: bytes):
+    """The (index, rune) pairs of a string decoded as UTF-8, the
+    invalid bytes are decoded as U+FFFD, one at a time"""
+    i = 0
+    while i < len(s):
+        for width in (1, 2, 3, 4):
+            try:
+                r = s[i:i + width].decode("utf-8")
+            except UnicodeDecodeError:
+                continue
+            yield i, ord(r)
+            i += width
+            break
+        else:
+            yield i, 0xFFFD
+            i += 1
+
+
+def map_entries(m: MapValue):
+    """The entries of a range over the map m, from a random one on like Go,
+    so that programs don't depend on the order. The entries deleted during
+    the iteration are not reached"""
+    keys = list(m.entries)
+    if keys:
+        start = random.randrange(len(keys))
+        keys = keys[start:] + keys[:start]
+    return (m.entries[k] for k in keys if k in m.entries)
+
+
+def sorted_entries(m: MapValue) -> list:
+    """The entries of the map sorted by key, like fmt prints them"""
+    entries = list(m.entries.values())
+    try:
+        return sorted(entries, key=lambda entry: sort_key(entry[0]))
+    except TypeError:
+        return entries
+
+
+def sort_key(key: Any) -> Any:
+    if isinstance(key, Boxed):
+        return type_string(key.type_), sort_key(key.value)
+    elif isinstance(key, StructValue):
+        return tuple(sort_key(v) for v in key.fields.values())
+    elif isinstance(key, list):
+        return tuple(sort_key(v) for v in key)
+    elif isinstance(key, complex):
+        return key.real, key.imag
+    elif isinstance(key, Ref):
+        return id(key)
+    return key
+
+
+def address(value: Any) -> str:
+    return f"0xc{id(value) & 0xffffffffff:010x}"
+
+
+def format_float(value: float, size: int = 64, verb: str = "g", prec: int = -1) -> str:
+    """The float formatted like strconv.FormatFloat with the verb b, e, E, f,
+    g, G, x or X, with the shortest representation giving it back if prec
+    is -1 (like %v)"""
+    if math.isnan(value):
+        return "NaN"
+    if math.isinf(value):
+        return "+Inf" if value > 0 else "-Inf"
+    if verb in "EGX":
+        return format_float(value, size, verb.lower(), prec).upper()
+    if verb == "b":
+        return format_binary(value, size)
+    if verb == "x":
+        return format_hex(value, prec)
+    if prec >= 0:
+        if verb == "g":
+            return f"{value:.{max(prec, 1)}g}"
+        return f"{value:.{prec}{verb}}"
+
+    minus = "-" if math.copysign(1, value) < 0 else ""
+    digits, point = shortest(abs(value), size)
+    # the exponent of the first digit, g uses %e if it is
+    # less than -4 or at least 6 (the precision of %g)
+    exp = point - 1
+    if verb == "e" or verb == "g" and (exp < -4 or exp >= 6):
+        mantissa = digits[0] + ("." + digits[1:] if len(digits) > 1 else "")
+        return f"{minus}{mantissa}e{'-' if exp < 0 else '+'}{abs(exp):02d}"
+    if point <= 0:
+        return f"{minus}0.{'0' * -point}{digits}"
+    if point >= len(digits):
+        return minus + digits + "0" * (point - len(digits))
+    return f"{minus}{digits[:point]}.{digits[point:]}"
+
+
+def format_binary(value: float, size: int = 64) -> str:
+    """The float formatted like strconv.FormatFloat with the verb b: the
+    integer mantissa and the binary exponent, 6755399441055744p-51 is 3"""
+    mantbits, bias = (23, -127) if size == 32 else (52, -1023)
+    if size == 32:
+        bits = struct.unpack("<I", struct.pack("<f", value))[0]
+    else:
+        bits = struct.unpack("<Q", struct.pack("<d", value))[0]
+    exp, mant = bits >> mantbits & (1 << size - 1 - mantbits) - 1, bits & (1 << mantbits) - 1
+    if exp == 0:
+        exp = 1
+    else:
+        mant |= 1 << mantbits
+    exp += bias - mantbits
+    minus = "-" if bits >> size - 1 else ""
+    return f"{minus}{mant}p{'-' if exp < 0 else '+'}{abs(exp)}"
+
+
+def format_hex(value: float, prec: int = -1) -> str:
+    """The float formatted like strconv.FormatFloat with the verb x: the
+    mantissa 1.h (rounded to prec hex digits, all of them if prec is -1)
+    and the binary exponent, 0x1.8p+01 is 3"""
+    minus = "-" if math.copysign(1, value) < 0 else ""
+    mant, exp = 0, 0
+    if value != 0:
+        # the mantissa has its leading 1 at bit 60, like the one of strconv
+        m, exp = math.frexp(abs(value))
+        mant, exp = int(math.ldexp(m, 61)), exp - 1
+    if 0 <= prec < 15:
+        shift = prec * 4
+        extra = (mant << shift) & (1 << 60) - 1
+        mant >>= 60 - shift
+        if extra | mant & 1 > 1 << 59:
+            mant += 1
+        mant <<= 60 - shift
+        if mant & 1 << 61:
+            mant >>= 1
+            exp += 1
+    text = [minus, "0x", str(mant >> 60 & 1)]
+    mant = mant << 4 & (1 << 64) - 1
+    if prec < 0 and mant or prec > 0:
+        text.append(".")
+        n = 0
+        while n < prec if prec >= 0 else mant:
+            text.append("0123456789abcdef"[mant >> 60 & 15])
+            mant = mant << 4 & (1 << 64) - 1
+            n += 1
+    text.append(f"p{'-' if exp < 0 else '+'}{abs(exp):02d}")
+    return "".join(text)
+
+
+def shortest(value: float, size: int = 64) -> Tuple[str, int]:
+    """The fewest decimal digits giving the float (of size bits) back, and
+    the position of the decimal point in them (0.25 is 25 and 0)"""
+    if size == 32:
+        for n in range(1, 10):
+            text = f"{value:.{n - 1}e}"
+            if round_float32(float(text)) == value:
+                break
+    else:
+        text = repr(value)
+    _, digits, exponent = Decimal(text).normalize().as_tuple()
+    digits = "".join(map(str, digits))
+    return digits, len(digits) + exponent
+
+
+def format_complex(value: complex, size: int = 64) -> str:
+    imag = format_float(value.imag, size)
+    if not imag.startswith(("-", "+")):
+        imag = "+" + imag
+    return f"({format_float(value.real, size)}{imag}i)"
+
+
+# the fmt package, the verbs of Printf are the common ones with their flags
+# Ref: https://pkg.go.dev/fmt
+
+
+def sprint(interp: Interpreter, args: list) -> str:
+    # spaces are added between operands when neither is a string
+    text = ""
+    for i, arg in enumerate(args):
+        if (i > 0 and not is_string(args[i - 1]) and not is_string(arg)):
+            text += " "
+        text += interp.format(arg)
+    return text
+
+
+def sprintln(interp: Interpreter, args: list) -> str:
+    return " ".join(interp.format(arg) for arg in args) + "\n"
+
+
+def is_string(arg: Any) -> bool:
+    return isinstance(arg, Boxed) and basic_typename(underlying(arg.type_)) == "string"
+
+
+def sprintf(interp: Interpreter, args: list, wrapped: Optional[list] = None) -> str:
+    """The operands of args[1:] formatted with the verbs of args[0]. For
+    fmt.Errorf, wrapped is given: the errors of %w verbs are formatted like
+    %v and their indices (in args[1:]) are added to it"""
+    template = unbox(args[0]).decode("utf-8", "replace")
+    args = args[1:]
+    text = []
+    i = 0
+    used = 0
+    while i < len(template):
+        c = template[i]
+        if c != "%":
+            text.append(c)
+            i += 1
+            continue
+        i += 1
+        flags = ""
+        while i < len(template) and template[i] in "-+# 0":
+            flags += template[i]
+            i += 1
+        width = ""
+        if i < len(template) and template[i] == "*":
+            # the width is the next operand, a negative one pads on the right
+            i += 1
+            n = int_arg(args, used)
+            used += 1
+            if n is None:
+                text.append("%!(BADWIDTH)")
+            elif n < 0:
+                flags += "-"
+                width = str(-n)
+            else:
+                width = str(n)
+        else:
+            width, i = parse_number(template, i)
+        prec = None
+        if i < len(template) and template[i] == ".":
+            i += 1
+            if i < len(template) and template[i] == "*":
+                i += 1
+                n = int_arg(args, used)
+                used += 1
+                if n is None or n < 0:
+                    text.append("%!(BADPREC)")
+                else:
+                    prec = n
+            else:
+                digits, i = parse_number(template, i)
+                prec = int(digits or "0")
+        if i >= len(template):
+            text.append("%!(NOVERB)")
+            break
+        verb = template[i]
+        i += 1
+        if verb == "%":
+            text.append("%")
+            continue
+        if used >= len(args):
+            text.append(f"%!{verb}(MISSING)")
+            continue
+        arg = args[used]
+        used += 1
+        if (verb == "w" and wrapped is not None and isinstance(arg, Boxed)
+                and interp.implements(arg.type_, syntree.error_type())):
+            wrapped.append(used - 1)
+            verb = "v"
+        text.append(format_verb(interp, arg, verb, flags, prec, int(width) if width else 0))
+    if used < len(args):
+        extra = ", ".join("<nil>" if arg is None else f"{type_name(arg)}={interp.format(arg)}"
+                          for arg in args[used:])
+        text.append(f"%!(EXTRA {extra})")
+    return "".join(text)
+
+
+def parse_number(template: str, i: int) -> Tuple[str, int]:
+    """The digits of a width or a precision at i, and the index after them.
+    Past 1e6 the rest of the template is skipped, like fmt does"""
+    start = i
+    while i < len(template) and template[i].isdigit():
+        if i > start and int(template[start:i]) > 1_000_000:
+            return "", len(template)
+        i += 1
+    return template[start:i], i
+
+
+def int_arg(args: list, i: int) -> Optional[int]:
+    """The integer operand i of a * width or precision, None if it is
+    missing, isn't an integer or is too large, like fmt does"""
+    arg = args[i] if i < len(args) else None
+    if (not isinstance(arg, Boxed)
+            or untyped.kind_of_typename(basic_typename(underlying(arg.type_)) or "") != "int"
+            or abs(arg.value) > 1_000_000):
+        return None
+    return arg.value
+
+
+def unbox(arg: Any) -> Any:
+    return arg.value if isinstance(arg, Boxed) else arg
+
+
+def type_name(arg: Any) -> str:
+    return runtime_type_string(arg.type_) if isinstance(arg, Boxed) else "<nil>"
+
+
+def format_verb(interp: Interpreter, arg: Any, verb: str, flags: str,
+                prec: Optional[int], width: int = 0) -> str:
+    """The operand formatted with the verb, padded to width: the elements
+    of slices, arrays, maps and structs are, one by one, like fmt does"""
+    def padded(text: str) -> str:
+        interp.reserve(width)
+        return pad(text, width, flags, verb)
+
+    if verb != "T":
+        arg = reflect_held(interp, arg)
+    value = unbox(arg)
+    typename = basic_typename(underlying(arg.type_)) if isinstance(arg, Boxed) else None
+    kind = untyped.kind_of_typename(typename) if typename is not None else None
+    if verb == "T":
+        return padded(type_name(arg))
+    elif verb == "v":
+        if "#" in flags:
+            return padded(interp.go_syntax(arg, None))
+        if kind == "float" and prec is not None:
+            return padded(format_float(value, 64, "g", prec))
+        return interp.format(arg, plus="+" in flags, padded=padded)
+    elif verb == "p" and isinstance(value, (Ref, SliceValue, MapValue, ChanValue, Closure)):
+        return padded(address(value))
+    elif verb == "p" and value is None and isinstance(arg, Boxed) and isinstance(
+            underlying(arg.type_), (syntree.Pointer, syntree.Slice, syntree.Map, syntree.Chan,
+                                    syntree.FunctionType)):
+        return padded("0x0")
+    elif (verb in "qxX" and isinstance(arg, Boxed)
+          and interp.string_method(value, arg.type_) is not None):
+        # the string given by the Error or String method is formatted
+        return format_verb(interp, Boxed(interp.string_type, interp.format(arg).encode()),
+                           verb, flags, prec, width)
+
+    if kind == "int" and verb in "dboxXcqU":
+        sign = "+" if "+" in flags else (" " if " " in flags else "")
+        if verb == "c":
+            return padded(chr(value) if 0 <= value <= 0x10FFFF else "�")
+        elif verb == "q":
+            return padded("'" + (chr(value) if 0 <= value <= 0x10FFFF else "�") + "'")
+        elif verb == "U":
+            return padded(f"U+{value:04X}")
+        digits = format(abs(value), {"d": "d", "b": "b", "o": "o", "x": "x", "X": "X"}[verb])
+        if "#" in flags and verb in "xXo":
+            digits = {"x": "0x", "X": "0X", "o": "0"}[verb] + digits
+        return padded(("-" if value < 0 else sign) + digits)
+    elif kind == "float" and verb in "eEfFgGxX":
+        sign = ("+" if "+" in flags else " " if " " in flags else "") if value >= 0 else ""
+        if verb in "gGxX" and prec is None:
+            text = format_float(value, 32 if typename == "float32" else 64, verb)
+        else:
+            text = format_float(value, 64, "f" if verb == "F" else verb,
+                                6 if prec is None else prec)
+        return padded(sign + text)
+    elif kind == "bool" and verb == "t":
+        return padded("true" if value else "false")
+    elif kind == "string" and verb in "sqxX":
+        if prec is not None:
+            value = value.decode("utf-8", "replace")[:prec].encode()
+        if verb == "s":
+            return padded(value.decode("utf-8", "replace"))
+        elif verb == "q":
+            return padded(constant.quote(value))
+        return padded(hex_bytes(value, verb, flags))
+    elif (isinstance(arg, Boxed) and isinstance(underlying(arg.type_), (syntree.Slice,
+                                                                          syntree.Array))
+          and interp.string_method(value, arg.type_) is None):
+        eltype = underlying(arg.type_).eltype
+        elements = elements_of(value)
+        if verb in "sqxX" and basic_typename(underlying(eltype)) in ("byte", "uint8"):
+            # the bytes are formatted like a string
+            return format_verb(interp, Boxed(interp.string_type, bytes(elements)), verb,
+                               flags, prec, width)
+        # the verb is the one of each element
+        return "[" + " ".join(
+            format_verb(interp, interp.assign_value(e, eltype, interp.any_type), verb, flags,
+                        prec, width)
+            for e in elements
+        ) + "]"
+    elif verb == "s" and isinstance(arg, Boxed):
+        if interp.string_method(value, arg.type_) is not None or kind is None:
+            return interp.format(arg, padded=padded)
+    return padded(bad_verb(interp, verb, arg))
+
+
+def bad_verb(interp: Interpreter, verb: str, arg: Any) -> str:
+    """The text of a verb which doesn't apply to arg, like %!d(string=hi)"""
+    if arg is None:
+        return f"%!{verb}(<nil>)"
+    return f"%!{verb}({type_name(arg)}={interp.format(arg)})"
+
+
+def hex_bytes(value: bytes, verb: str, flags: str) -> str:
+    """The bytes in hexadecimal for %x and %X, spaced by the flag ' ' and
+    prefixed with 0x by the flag '#' (each of them if they are spaced)"""
+    digits = [f"{b:02x}" if verb == "x" else f"{b:02X}" for b in value]
+    prefix = ("0x" if verb == "x" else "0X") if "#" in flags and value else ""
+    if " " in flags:
+        return " ".join(prefix + d for d in digits)
+    return prefix + "".join(digits)
+
+
+def pad(text: str, width: int, flags: str, verb: str) -> str:
+    if len(text) >= width:
+        return text
+    if "-" in flags:
+        return text + " " * (width - len(text))
+    if "0" in flags and verb in "dboxXeEfFgG":
+        sign = text[0] if text[:1] in ("-", "+") else ""
+        return sign + "0" * (width - len(text)) + text[len(sign):]
+    return " " * (width - len(text)) + text
+
+
+def write(interp: Interpreter, text: str) -> tuple:
+    size = len(text.encode())
+    interp.write_output(size)
+    interp.output().write(text)
+    interp.output().flush()
+    return size, None
+
+
+def fmt_package() -> Dict[str, Any]:
+    def string(text: str) -> bytes:
+        return text.encode()
+
+    def errorf(interp: Interpreter, args: list) -> tuple:
+        wrapped: list = []
+        text = sprintf(interp, args, wrapped)
+        return string(text), wrapped[0] if wrapped else -1
+
+    return {
+        "Print": Native("Print", lambda interp, args: write(interp, sprint(interp, args))),
+        "Println": Native("Println", lambda interp, args: write(interp, sprintln(interp, args))),
+        "Printf": Native("Printf", lambda interp, args: write(interp, sprintf(interp, args))),
+        "Sprint": Native("Sprint", lambda interp, args: string(sprint(interp, args))),
+        "Sprintln": Native("Sprintln", lambda interp, args: string(sprintln(interp, args))),
+        "Sprintf": Native("Sprintf", lambda interp, args: string(sprintf(interp, args))),
+        "errorf": Native("errorf", errorf),
+    }
+
+
+def os_package() -> Dict[str, Any]:
+    def args(interp: Interpreter, _: list) -> SliceValue:
+        argv = [arg.encode() for arg in interp.argv]
+        return SliceValue(argv, 0, len(argv), len(argv))
+
+    def exit(interp: Interpreter, args: list):
+        raise _Exit(args[0].value)
+
+    def read(interp: Interpreter, args: list) -> int:
+        fd, b = args[0].value, args[1].value
+        if b is None or b.length == 0:
+            return 0
+        data = interp.input().read1(b.length) if fd == 0 else b""
+        b.array[b.offset:b.offset + len(data)] = data
+        return len(data)
+
+    def write(interp: Interpreter, args: list) -> int:
+        fd, b = args[0].value, args[1].value
+        data = bytes(b.elements()) if b is not None else b""
+        out = interp.output() if fd == 1 else interp.errors() if fd == 2 else None
+        if out is None:
+            return 0
+        interp.write_output(len(data))
+        out.flush()
+        if hasattr(out, "buffer"):
+            out.buffer.write(data)
+            out.buffer.flush()
+        else:
+            out.write(data.decode("utf-8", "replace"))
+        return len(data)
+
+    def read_file(interp: Interpreter, args: list) -> tuple:
+        if interp.files is not None:
+            if args[0].value not in interp.files:
+                return None, errno.ENOENT
+            data = list(interp.files[args[0].value])
+            return SliceValue(data, 0, len(data), len(data)), 0
+        try:
+            with open(args[0].value, "rb") as f:
+                data = list(f.read())
+        except OSError as e:
+            return None, e.errno
+        return SliceValue(data, 0, len(data), len(data)), 0
+
+    def write_file(interp: Interpreter, args: list) -> int:
+        name, b, perm = (arg.value for arg in args)
+        if interp.files is not None:
+            if name not in interp.files:
+                interp.modes[name] = perm & 0o777
+            interp.files[name] = bytes(b.elements()) if b is not None else b""
+            return 0
+        try:
+            fd = os.open(name, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, perm)
+            with open(fd, "wb") as f:
+                f.write(bytes(b.elements()) if b is not None else b"")
+        except OSError as e:
+            return e.errno
+        return 0
+
+    def stat(interp: Interpreter, args: list) -> tuple:
+        name = args[0].value
+        if interp.files is not None:
+            if name not in interp.files:
+                return 0, 0, errno.ENOENT
+            return len(interp.files[name]), interp.modes.get(name, 0o644), 0
+        try:
+            st = os.stat(name)
+        except OSError as e:
+            return 0, 0, e.errno
+        mode = st.st_mode & 0o777 | (1 << 31 if os.path.isdir(name) else 0)
+        return st.st_size, mode, 0
+
+    def remove(interp: Interpreter, args: list) -> int:
+        name = args[0].value
+        if interp.files is not None:
+            interp.modes.pop(name, None)
+            return errno.ENOENT if interp.files.pop(name, None) is None else 0
+        try:
+            if os.path.isdir(name):
+                os.rmdir(name)
+            else:
+                os.remove(name)
+        except OSError as e:
+            return e.errno
+        return 0
+
+    def strerror(interp: Interpreter, args: list) -> bytes:
+        message = os.strerror(args[0].value)
+        return (message[:1].lower() + message[1:]).encode()
+
+    return {
+        "Exit": Native("Exit", exit),
+        "args": Native("args", args),
+        "read": Native("read", read),
+        "write": Native("write", write),
+        "readFile": Native("readFile", read_file),
+        "writeFile": Native("writeFile", write_file),
+        "stat": Native("stat", stat),
+        "remove": Native("remove", remove),
+        "strerror": Native("strerror", strerror),
+    }
+
+
+def strings_package() -> Dict[str, Any]:
+    # the strings are bytes, the functions about letters and white space
+    # decode them (the bytes which aren't UTF-8 are kept as they are)
+    def text(s: bytes) -> str:
+        return s.decode("utf-8", "surrogateescape")
+
+    def string(t: str) -> bytes:
+        return t.encode("utf-8", "surrogateescape")
+
+    def runes(s: bytes) -> List[bytes]:
+        """The UTF-8 sequences of s"""
+        return [string(c) for c in text(s)]
+
+    def split(interp: Interpreter, args: list) -> SliceValue:
+        s, sep = args[0].value, args[1].value
+        parts = s.split(sep) if sep else runes(s)
+        return SliceValue(parts, 0, len(parts), len(parts))
+
+    def fields(interp: Interpreter, args: list) -> SliceValue:
+        parts = [string(part) for part in text(args[0].value).split()]
+        return SliceValue(parts, 0, len(parts), len(parts))
+
+    def join(interp: Interpreter, args: list) -> bytes:
+        # an untyped nil isn't boxed
+        elems = args[0].value if args[0] is not None else None
+        return args[1].value.join(elements_of(elems))
+
+    def count(interp: Interpreter, args: list) -> int:
+        s, substr = args[0].value, args[1].value
+        return s.count(substr) if substr else len(runes(s)) + 1
+
+    def repeat(interp: Interpreter, args: list) -> bytes:
+        if args[1].value < 0:
+            raise Panic(Boxed(interp.string_type, b"strings: negative Repeat count"))
+        interp.reserve(len(args[0].value) * args[1].value)
+        return args[0].value * args[1].value
+
+    def replace(interp: Interpreter, args: list) -> bytes:
+        s, old, new, n = (arg.value for arg in args)
+        if old:
+            return s.replace(old, new, n)
+        # an empty old matches at the start and after each UTF-8 sequence
+        parts = runes(s)
+        n = len(parts) + 1 if n < 0 else n
+        return b"".join((new if i < n else b"") + part for i, part in enumerate(parts + [b""]))
+
+    def case(convert: Callable[[str], str]) -> Callable:
+        # the runes are mapped one by one, like ß which stays ß in upper case
+        def native(interp: Interpreter, args: list) -> bytes:
+            return string("".join(c if len(convert(c)) != 1 else convert(c)
+                                  for c in text(args[0].value)))
+        return native
+
+    return {
+        "Index": Native("Index", lambda interp, args: args[0].value.find(args[1].value)),
+        "LastIndex": Native("LastIndex", lambda interp, args: args[0].value.rfind(args[1].value)),
+        "Count": Native("Count", count),
+        "Split": Native("Split", split),
+        "Fields": Native("Fields", fields),
+        "Join": Native("Join", join),
+        "Repeat": Native("Repeat", repeat),
+        "Replace": Native("Replace", replace),
+        "ToUpper": Native("ToUpper", case(str.upper)),
+        "ToLower": Native("ToLower", case(str.lower)),
+        "TrimSpace": Native("TrimSpace", lambda interp, args: string(text(args[0].value).strip())),
+    }
+
+
+# strconv, the natives return the errors of the parse functions as
+# codes: 0 if there is none, 1 for ErrSyntax and 2 for ErrRange
+# Ref: https://pkg.go.dev/strconv
+
+digit_chars = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+
+def parse_int(s: str, base: int, size: int) -> Tuple[int, int]:
+    """The value of s like strconv.ParseInt, and its error code"""
+    size = size or 64
+    sign, digits = (s[0], s[1:]) if s[:1] in ("+", "-") else ("", s)
+    prefixed = False
+    if base == 0:
+        # the base is the one of the prefix, and underscores can separate the digits
+        base = 10
+        prefix = digits[:2].lower()
+        if prefix in ("0b", "0o", "0x"):
+            base, digits, prefixed = {"b": 2, "o": 8, "x": 16}[prefix[1]], digits[2:], True
+        elif digits[:1] == "0" and len(digits) > 1:
+            base, digits, prefixed = 8, digits[1:], True
+        if "_" in digits:
+            if not re.fullmatch(r"(_?)[^_]+(_[^_]+)*", digits) or digits[0] == "_" and not prefixed:
+                return 0, 1
+            digits = digits.replace("_", "")
+    if not 2 <= base <= 36 or not digits or any(c not in digit_chars[:base] for c in digits.lower()):
+        return 0, 1
+    value = int(digits, base) * (-1 if sign == "-" else 1)
+    low, high = -(1 << (size - 1)), (1 << (size - 1)) - 1
+    if not low <= value <= high:
+        return (low if value < 0 else high), 2
+    return value, 0
+
+
+def parse_float(s: str, size: int) -> Tuple[float, int]:
+    """The value of s like strconv.ParseFloat, and its error code"""
+    if re.fullmatch(r"[+-]?(inf|infinity)|nan", s, re.IGNORECASE):
+        return float(s), 0
+    if re.fullmatch(r"[+-]?0[xX]([0-9a-fA-F]+[.]?[0-9a-fA-F]*|[.][0-9a-fA-F]+)[pP][+-]?\d+", s):
+        value = float.fromhex(s)
+    elif re.fullmatch(r"[+-]?(\d+[.]?\d*|[.]\d+)([eE][+-]?\d+)?", s):
+        value = float(s)
+    else:
+        return 0.0, 1
+    if size == 32:
+        value = round_float32(value)
+    return value, 2 if math.isinf(value) else 0
+
+
+def format_int(i: int, base: int) -> str:
+    """i in the base (2 to 36), like strconv.FormatInt"""
+    digits = ""
+    n = abs(i)
+    while True:
+        n, d = divmod(n, base)
+        digits = digit_chars[d] + digits
+        if n == 0:
+            break
+    return ("-" if i < 0 else "") + digits
+
+
+def strconv_package() -> Dict[str, Any]:
+    def text(s: bytes) -> str:
+        return s.decode("utf-8", "surrogateescape")
+
+    def format_float_(interp: Interpreter, args: list) -> bytes:
+        value, verb, prec, size = (arg.value for arg in args)
+        verb = chr(verb)
+        if verb not in "beEfgGxX":
+            return b"%" + verb.encode()
+        if size == 32:
+            value = round_float32(value)
+        return format_float(value, size, verb, prec).encode()
+
+    def format_int_(interp: Interpreter, args: list) -> bytes:
+        i, base = (arg.value for arg in args)
+        if not 2 <= base <= 36:
+            raise Panic(Boxed(interp.string_type, b"strconv: illegal AppendInt/FormatInt base"))
+        return format_int(i, base).encode()
+
+    return {
+        "FormatInt": Native("FormatInt", format_int_),
+        "FormatFloat": Native("FormatFloat", format_float_),
+        "Quote": Native("Quote", lambda interp, args: constant.quote(args[0].value).encode()),
+        "parseInt": Native("parseInt", lambda interp, args: parse_int(
+            text(args[0].value), args[1].value, args[2].value)),
+        "parseFloat": Native("parseFloat", lambda interp, args: parse_float(
+            text(args[0].value), args[1].value)),
+    }
+
+
+# math, the functions with the special cases of Go instead of the
+# exceptions of python (math.sqrt(-1) is NaN)
+# Ref: https://pkg.go.dev/math
+
+
+def go_floor(x: float) -> float:
+    if x == 0 or math.isinf(x) or math.isnan(x):
+        return x
+    return float(math.floor(x))
+
+
+def go_pow(x: float, y: float) -> float:
+    try:
+        return math.pow(x, y)
+    except ValueError:
+        # 0 to a negative power, or a negative number to a non-integer one
+        if x == 0:
+            odd = y == int(y) and int(y) % 2 == 1
+            return math.copysign(math.inf, x) if odd else math.inf
+        return math.nan
+    except OverflowError:
+        odd = y == int(y) and int(y) % 2 == 1
+        return -math.inf if x < 0 and odd else math.inf
+
+
+def go_mod(x: float, y: float) -> float:
+    try:
+        return math.fmod(x, y)
+    except ValueError:
+        return math.nan
+
+
+def math_package() -> Dict[str, Any]:
+    return {
+        "Sqrt": Native("Sqrt", lambda interp, args: (
+            math.sqrt(args[0].value) if not args[0].value < 0 else math.nan)),
+        "Floor": Native("Floor", lambda interp, args: go_floor(args[0].value)),
+        "Abs": Native("Abs", lambda interp, args: math.fabs(args[0].value)),
+        "Pow": Native("Pow", lambda interp, args: go_pow(args[0].value, args[1].value)),
+        "Mod": Native("Mod", lambda interp, args: go_mod(args[0].value, args[1].value)),
+        "Inf": Native("Inf", lambda interp, args: math.inf if args[0].value >= 0 else -math.inf),
+        "NaN": Native("NaN", lambda interp, args: math.nan),
+    }
+
+
+# time, the clock is the one of the interpreter (see Clock)
+# Ref: https://pkg.go.dev/time
+
+def format_time(sec: int, nsec: int) -> str:
+    """The time of sec seconds since year 1 (and nsec nanoseconds) formatted
+    like Time.String, "2006-01-02 15:04:05.999999999 -0700 MST" in UTC"""
+    try:
+        t = datetime.datetime(1, 1, 1) + datetime.timedelta(seconds=sec)
+    except OverflowError:
+        return f"Time(sec={sec}, nsec={nsec})"
+    fraction = f".{nsec:09d}".rstrip("0").rstrip(".")
+    return f"{t.year:04d}-{t:%m-%d %H:%M:%S}{fraction} +0000 UTC"
+
+
+def time_package() -> Dict[str, Any]:
+    def sleep(interp: Interpreter, args: list):
+        # the other goroutines run meanwhile
+        interp.scheduler.sleep(args[0].value)
+
+    return {
+        "now": Native("now", lambda interp, args: interp.clock.now()),
+        "sleep": Native("sleep", sleep),
+        "format": Native("format", lambda interp, args: format_time(
+            args[0].value, args[1].value).encode()),
+    }
+
+
+def sync_package() -> Dict[str, Any]:
+    def semacquire(interp: Interpreter, args: list):
+        interp.scheduler.semacquire(args[0].value, args[1].value.decode())
+
+    def fatal(interp: Interpreter, args: list):
+        g = interp.scheduler.current
+        raise sched.Fatal(args[0].value.decode(), [(g, None, g.trace())])
+
+    return {
+        "semacquire": Native("semacquire", semacquire),
+        "semrelease": Native("semrelease", lambda interp, args:
+                             interp.scheduler.semrelease(args[0].value)),
+        "fatal": Native("fatal", fatal),
+        "raceAcquire": Native("raceAcquire", race_native("acquire")),
+        "raceRelease": Native("raceRelease", race_native("release")),
+        "raceReleaseMerge": Native("raceReleaseMerge", race_native("release", merge=True)),
+    }
+
+
+def atomic_package() -> Dict[str, Any]:
+    return {
+        "sameType": Native("sameType", lambda interp, args:
+                           identical(args[0].type_, args[1].type_)),
+        "raceSync": Native("raceSync", race_native("sync")),
+    }
+
+
+def race_native(method: str, **kwargs) -> Callable:
+    """A native calling the method of the race detector (if it is on) with
+    the running goroutine and the variable its argument points to"""
+    def native(interp: Interpreter, args: list):
+        if interp.race is not None:
+            ref = args[0].value
+            if isinstance(ref, Boxed):
+                ref = ref.value
+            getattr(interp.race, method)(interp.scheduler.current, ref, **kwargs)
+    return native
+
+
+# sort and slices, the elements are sorted in place with the sort of
+# python, which is stable (Go's isn't, equal elements can be in any order)
+# Ref: https://pkg.go.dev/sort and https://pkg.go.dev/slices
+
+def sort_slice(s: Optional[SliceValue], key: Optional[Callable] = None):
+    """Sorts the elements of s in increasing order (the NaNs first)"""
+    if s is None:
+        return
+    elements = s.elements()
+    # NaN isn't ordered, (x == x, x) puts it before the other values
+    elements.sort(key=key or (lambda x: (x == x, x)))
+    s.array[s.offset:s.offset + s.length] = elements
+
+
+def kind(x: Optional[Boxed]) -> str:
+    """The kind of the dynamic type of x, like reflect.Kind, zero for nil"""
+    if x is None:
+        return "zero"
+    u = underlying(x.type_)
+    kinds = {syntree.Struct: "struct", syntree.Pointer: "ptr", syntree.Array: "array",
+             syntree.Slice: "slice", syntree.Map: "map", syntree.Chan: "chan",
+             syntree.FunctionType: "func"}
+    return kinds.get(type(u)) or basic_typename(u) or type_string(u)
+
+
+def sort_package() -> Dict[str, Any]:
+    def slice_(interp: Interpreter, args: list):
+        x, less = args
+        if x is None or not isinstance(underlying(x.type_), syntree.Slice):
+            raise Panic(Boxed(interp.string_type,
+                              f"reflect: call of Swapper on {kind(x)} Value".encode()))
+        s = x.value
+        if s is None:
+            return
+
+        def compare(i: int, j: int) -> int:
+            if interp.call_function(less.value, [i, j]):
+                return -1
+            return 1 if interp.call_function(less.value, [j, i]) else 0
+
+        # less compares the elements at their indexes before the sort
+        elements = s.elements()
+        order = sorted(range(s.length), key=functools.cmp_to_key(compare))
+        s.array[s.offset:s.offset + s.length] = [elements[i] for i in order]
+
+    return {
+        "Ints": Native("Ints", lambda interp, args: sort_slice(args[0].value)),
+        "Float64s": Native("Float64s", lambda interp, args: sort_slice(args[0].value)),
+        "Strings": Native("Strings", lambda interp, args: sort_slice(args[0].value)),
+        "Slice": Native("Slice", slice_),
+    }
+
+
+def slices_package() -> Dict[str, Any]:
+    def sort_func(interp: Interpreter, args: list):
+        s, cmp = args[0].value, args[1].value
+        sort_slice(s, functools.cmp_to_key(lambda a, b: interp.call_function(cmp, [a, b])))
+
+    return {
+        "Sort": Native("Sort", lambda interp, args: sort_slice(args[0].value)),
+        "SortFunc": Native("SortFunc", sort_func),
+    }
+
+
+# testing, the patterns of -test.run are the regular expressions of python
+# (the syntax of the ones of Go is mostly the same)
+# Ref: https://pkg.go.dev/testing
+
+def testing_package() -> Dict[str, Any]:
+    def match_string(interp: Interpreter, args: list) -> Tuple[bool, bytes]:
+        pattern, s = (arg.value.decode("utf-8", "surrogateescape") for arg in args)
+        try:
+            return re.search(pattern, s) is not None, b""
+        except re.error as e:
+            return False, f"error parsing regexp: {e}".encode()
+
+    def caller(interp: Interpreter, args: list) -> Tuple[int, bytes, int]:
+        # the natives have no frame, the last one is the function calling it
+        skip = args[0].value
+        if skip >= len(interp.frames) or interp.frames[-1 - skip].fn is None:
+            return 0, b"", 0
+        frame = interp.frames[-1 - skip]
+        filename = fileset.fset.position(frame.fn.pos).filename
+        return id(frame.fn), filename.encode(), frame.line or frame.fn.lineno
+
+    def mem_stats(interp: Interpreter, args: list) -> Tuple[int, int]:
+        return interp.mallocs, interp.total_alloc
+
+    def sysinfo(interp: Interpreter, args: list) -> Tuple[bytes, bytes, bytes]:
+        goos = {"win32": "windows", "cygwin": "windows"}.get(sys.platform, sys.platform)
+        cpu = ""
+        try:
+            with open("/proc/cpuinfo") as f:
+                for line in f:
+                    if line.startswith("model name"):
+                        cpu = line.partition(":")[2].strip()
+                        break
+        except OSError:
+            pass
+        # the sizes of the values are the ones of amd64, see size_of
+        return goos.encode(), b"amd64", cpu.encode()
+
+    return {
+        "matchString": Native("matchString", match_string),
+        "caller": Native("caller", caller),
+        "memStats": Native("memStats", mem_stats),
+        "sysinfo": Native("sysinfo", sysinfo),
+    }
+
+
+# python, the functions of the Python modules imported as python/NAME (see
+# pyffi.py), their arguments and their results are converted from and to
+# the values of the interpreter
+
+class PythonError(GoRuntimeError):
+    """The value of the panic of an exception raised by a Python function,
+    or of a value which can't be converted"""
+
+    def __str__(self):
+        return f"python: {self.message}"
+
+
+def python_call(fn: Callable, args: list) -> Any:
+    """fn(*args), an exception is a panic"""
+    try:
+        return fn(*args)
+    except Exception as e:
+        raise Panic(PythonError(f"{type(e).__name__}: {e}"))
+
+
+def to_python(interp: Interpreter, value: Any, t: Any) -> Any:
+    """The Python value of a value of type t (or boxed with its type): a
+    str of a string, a list of a slice or an array (bytes of a []byte),
+    a dict of a map or of the exported fields of a struct"""
+    if isinstance(value, Boxed):
+        return to_python(interp, value.value, value.type_)
+    if value is None:
+        return None
+    if interp.python_types and identical(t, interp.python_types["Object"]):
+        # the object is the field ref of a python.Object, the zero one is None
+        ref = value.fields["ref"]
+        return None if isinstance(ref, int) else ref
+    u = underlying(interp.resolve(t))
+    if isinstance(value, bytes):
+        return value.decode("utf-8", "surrogateescape")
+    elif isinstance(value, (bool, int, float, complex)):
+        return value
+    elif isinstance(value, (list, SliceValue)):
+        elements = elements_of(value)
+        if basic_typename(underlying(u.eltype)) in ("byte", "uint8"):
+            return bytes(elements)
+        return [to_python(interp, e, u.eltype) for e in elements]
+    elif isinstance(value, MapValue):
+        return {to_python(interp, k, u.key): to_python(interp, v, u.eltype)
+                for k, v in value.entries.values()}
+    elif isinstance(value, StructValue):
+        return {f.f_name: to_python(interp, value.fields[f.f_name], f.type_)
+                for f in u.fields if f.f_name[:1].isupper()}
+    raise Panic(PythonError(f"{type_string(t)} can't be converted to a Python value"))
+
+
+def from_python(interp: Interpreter, value: Any, t: Any) -> Any:
+    """The value of type t of a Python value, see pyffi.py"""
+    t = interp.resolve(t)
+    types = interp.python_types
+    if syntree.is_interface(t):
+        if value is None:
+            return None
+        if isinstance(value, bool):
+            found = interp.bool_type
+        elif isinstance(value, int):
+            found = types["int"]
+        elif isinstance(value, float):
+            found = types["float64"]
+        elif isinstance(value, str):
+            found = interp.string_type
+        elif isinstance(value, (bytes, bytearray)):
+            found = types["[]byte"]
+        elif isinstance(value, (list, tuple)):
+            found = types["[]any"]
+        elif isinstance(value, dict):
+            found = types["map[any]any"]
+        else:
+            found = types["Object"]
+        return Boxed(found, from_python(interp, value, found))
+    if identical(t, types["Object"]):
+        return StructValue(t, {"ref": value})
+    u = underlying(t)
+    typename = basic_typename(u)
+    kind = untyped.kind_of_typename(typename or "")
+    if kind == "bool" and isinstance(value, bool):
+        return value
+    elif kind == "int" and isinstance(value, int) and not isinstance(value, bool):
+        return wrap(value, typename)
+    elif kind == "float" and isinstance(value, (int, float)) and not isinstance(value, bool):
+        return wrap(float(value), typename)
+    elif kind == "string" and isinstance(value, str):
+        return value.encode("utf-8", "surrogateescape")
+    elif isinstance(u, syntree.Slice) and isinstance(value, (bytes, bytearray)) \
+            and basic_typename(underlying(u.eltype)) in ("byte", "uint8"):
+        return SliceValue(list(value), 0, len(value), len(value))
+    elif isinstance(u, syntree.Slice) and isinstance(value, (list, tuple)):
+        elements = [from_python(interp, e, u.eltype) for e in value]
+        return SliceValue(elements, 0, len(elements), len(elements))
+    elif isinstance(u, syntree.Map) and isinstance(value, dict):
+        m = MapValue(t)
+        for k, v in value.items():
+            key = from_python(interp, k, u.key)
+            m.entries[key_of(key)] = (key, from_python(interp, v, u.eltype))
+        return m
+    raise Panic(PythonError(f"a {type(value).__name__} can't be converted to "
+                            f"{type_string(t)}"))
+
+
+def python_function(fn: Callable, result: Optional[syntree.Type]) -> Callable:
+    """The native calling the Python function fn, result is the type of
+    its result (None if it has none)"""
+    def native(interp: Interpreter, args: list) -> Any:
+        value = python_call(fn, [to_python(interp, arg, None) for arg in args])
+        return from_python(interp, value, result) if result is not None else None
+    return native
+
+
+def python_package() -> Dict[str, Any]:
+    def str_(interp: Interpreter, args: list) -> bytes:
+        return python_call(str, [to_python(interp, args[0], None)]).encode("utf-8",
+                                                                           "surrogateescape")
+
+    def attr(interp: Interpreter, args: list) -> Any:
+        o, name = to_python(interp, args[0], None), args[1].value.decode()
+        return from_python(interp, python_call(getattr, [o, name]), interp.any_type)
+
+    def call(interp: Interpreter, args: list) -> Any:
+        o = to_python(interp, args[0], None)
+        values = to_python(interp, args[1], None) or []
+        return from_python(interp, python_call(o, values), interp.any_type)
+
+    return {
+        "str": Native("str", str_),
+        "attr": Native("attr", attr),
+        "call": Native("call", call),
+    }
+
+
+# reflect, the types of the values are given to the program by index in
+# interp.reflect_types (see std/reflect), and the Values are the Refs of the
+# variables holding them, copies for the ones which aren't addressable
+
+reflect_kinds = {
+    "bool": 1, "int": 2, "int8": 3, "int16": 4, "int32": 5, "rune": 5, "int64": 6,
+    "uint": 7, "uint8": 8, "byte": 8, "uint16": 9, "uint32": 10, "uint64": 11,
+    "uintptr": 12, "float32": 13, "float64": 14, "complex64": 15, "complex128": 16,
+    "string": 24,
+}
+
+reflect_type_kinds = [
+    (syntree.Array, 17), (syntree.Chan, 18), (syntree.FunctionType, 19),
+    (syntree.Interface, 20), (syntree.Map, 21), (syntree.Pointer, 22),
+    (syntree.Slice, 23), (syntree.Struct, 25),
+]
+
+
+def reflect_id(interp: Interpreter, t: Optional[syntree.Type]) -> int:
+    """The index of the type t in interp.reflect_types, 0 for none. The
+    types with the same %T are the same, like for identical"""
+    if t is None:
+        return 0
+    key = runtime_type_string(t)
+    if key not in interp.reflect_ids:
+        interp.reflect_ids[key] = len(interp.reflect_types)
+        interp.reflect_types.append(t)
+    return interp.reflect_ids[key]
+
+
+def reflect_kind(t: syntree.Type) -> int:
+    u = underlying(t)
+    typename = basic_typename(u)
+    if typename is not None:
+        return reflect_kinds.get(typename, 0)
+    return next((kind for cls, kind in reflect_type_kinds if isinstance(u, cls)), 0)
+
+
+def reflect_held(interp: Interpreter, arg: Any) -> Any:
+    """The value a reflect.Value holds as an any, which fmt formats instead
+    of it (a string for the zero Value), other values are the same"""
+    if (interp.reflect_value is None or not isinstance(arg, Boxed)
+            or not identical(arg.type_, interp.reflect_value)):
+        return arg
+    typ, ref = arg.value.fields["typ"], arg.value.fields["ref"]
+    if typ == 0:
+        return Boxed(interp.string_type, b"<invalid reflect.Value>")
+    return interp.assign_value(ref.get(), interp.reflect_types[typ], interp.any_type)
+
+
+def reflect_package() -> Dict[str, Any]:
+    def typ(interp: Interpreter, arg: Boxed) -> Any:
+        return interp.reflect_types[arg.value]
+
+    def go_string(s: str) -> bytes:
+        return s.encode("utf-8", "surrogateescape")
+
+    def type_of(interp: Interpreter, args: list) -> int:
+        return reflect_id(interp, args[0].type_) if args[0] is not None else 0
+
+    def type_kind(interp: Interpreter, args: list) -> int:
+        return reflect_kind(typ(interp, args[0]))
+
+    def declared(t: syntree.Type) -> bool:
+        """If t is a named type declared in a package, not a predeclared one"""
+        return isinstance(t, syntree.NamedType) and not identical(t, syntree.error_type())
+
+    def type_name(interp: Interpreter, args: list) -> bytes:
+        t = typ(interp, args[0])
+        if declared(t):
+            if t.origin is None:
+                return go_string(t.typename)
+            type_args = ",".join(runtime_type_string(arg) for arg in t.type_args)
+            return go_string(f"{t.origin.typename}[{type_args}]")
+        if isinstance(t, syntree.NamedType) or basic_typename(t) is not None:
+            return go_string(runtime_type_string(t))
+        return b""
+
+    def type_pkg_path(interp: Interpreter, args: list) -> bytes:
+        t = typ(interp, args[0])
+        return go_string(t.package or "main") if declared(t) else b""
+
+    def type_string_(interp: Interpreter, args: list) -> bytes:
+        return go_string(runtime_type_string(typ(interp, args[0])))
+
+    def type_elem(interp: Interpreter, args: list) -> int:
+        u = underlying(typ(interp, args[0]))
+        return reflect_id(interp, u.base if isinstance(u, syntree.Pointer) else u.eltype)
+
+    def type_key(interp: Interpreter, args: list) -> int:
+        return reflect_id(interp, underlying(typ(interp, args[0])).key)
+
+    def type_len(interp: Interpreter, args: list) -> int:
+        return underlying(typ(interp, args[0])).length
+
+    def type_num_field(interp: Interpreter, args: list) -> int:
+        return len(underlying(typ(interp, args[0])).fields)
+
+    def type_field(interp: Interpreter, args: list) -> tuple:
+        t = typ(interp, args[0])
+        field = underlying(t).fields[args[1].value]
+        package = b""
+        if not field.f_name[:1].isupper():
+            package = go_string(getattr(t, "package", None) or "main")
+        return (go_string(field.f_name), package, reflect_id(interp, field.type_),
+                go_string(field.tag_value), field.embedded)
+
+    def pointer_to(interp: Interpreter, args: list) -> int:
+        return reflect_id(interp, syntree.Pointer(typ(interp, args[0])))
+
+    def implements(interp: Interpreter, args: list) -> bool:
+        return interp.implements(typ(interp, args[0]), typ(interp, args[1]))
+
+    def lookup_tag(interp: Interpreter, args: list) -> tuple:
+        tag = args[0].value.decode("utf-8", "surrogateescape")
+        value = syntree.lookup_tag(tag, args[1].value.decode("utf-8", "surrogateescape"))
+        return (b"", False) if value is None else (go_string(value), True)
+
+    def value_of(interp: Interpreter, args: list) -> Ref:
+        return Cell(copy_value(args[0].value))
+
+    def addr(interp: Interpreter, args: list) -> Ref:
+        # the pointer to the variable is its Ref
+        return Cell(args[0].value)
+
+    def value_interface(interp: Interpreter, args: list) -> Any:
+        return interp.assign_value(args[1].value.get(), typ(interp, args[0]), interp.any_type)
+
+    def zero(interp: Interpreter, args: list) -> Ref:
+        return Cell(interp.zero(typ(interp, args[0])))
+
+    def new_value(interp: Interpreter, args: list) -> Ref:
+        t = typ(interp, args[0])
+        interp.allocate(t)
+        return Cell(Cell(interp.zero(t)))
+
+    def make_slice(interp: Interpreter, args: list) -> Ref:
+        eltype = underlying(typ(interp, args[0])).eltype
+        n, cap = args[1].value, args[2].value
+        interp.allocate(eltype, cap)
+        return Cell(SliceValue([interp.zero(eltype) for _ in range(cap)], 0, n, cap))
+
+    def make_map(interp: Interpreter, args: list) -> Ref:
+        t = typ(interp, args[0])
+        interp.allocate_map(t, 0)
+        return Cell(MapValue(t))
+
+    def value(interp: Interpreter, t: Boxed, ref: Boxed, to_type: Any) -> Any:
+        """The value of a Value (of type t, its variable ref) assigned to a
+        variable of type to_type"""
+        return interp.assign_value(ref.value.get(), typ(interp, t), to_type)
+
+    def append_value(interp: Interpreter, args: list) -> Ref:
+        s = args[1].value.get()
+        eltype = underlying(typ(interp, args[0])).eltype
+        result = append(s, [value(interp, args[2], args[3], eltype)],
+                        lambda: interp.zero(eltype))
+        if s is None or result.array is not s.array:
+            interp.allocate(eltype, result.cap)
+        return Cell(result)
+
+    def assignable(interp: Interpreter, args: list) -> bool:
+        x, t = typ(interp, args[0]), typ(interp, args[1])
+        return identical(x, t) or (syntree.is_interface(t) and interp.implements(x, t))
+
+    def load(interp: Interpreter, args: list) -> Any:
+        return args[0].value.get()
+
+    def value_len(interp: Interpreter, args: list) -> int:
+        return length(args[0].value.get())
+
+    def value_cap(interp: Interpreter, args: list) -> int:
+        s = args[0].value.get()
+        return s.cap if isinstance(s, SliceValue) else len(elements_of(s))
+
+    def is_nil(interp: Interpreter, args: list) -> bool:
+        return args[0].value.get() is None
+
+    def is_zero(interp: Interpreter, args: list) -> bool:
+        return key_of(args[1].value.get()) == key_of(interp.zero(typ(interp, args[0])))
+
+    def value_elem(interp: Interpreter, args: list) -> tuple:
+        t, x = typ(interp, args[0]), args[1].value.get()
+        if x is None:
+            return 0, 0
+        if isinstance(x, Boxed):
+            return reflect_id(interp, x.type_), Cell(copy_value(x.value))
+        # the variable the pointer points to
+        return reflect_id(interp, underlying(t).base), x
+
+    def value_index(interp: Interpreter, args: list) -> Ref:
+        x, i = args[0].value.get(), args[1].value
+        if isinstance(x, bytes):
+            return Cell(x[i])
+        if isinstance(x, SliceValue):
+            return ElementRef(x.array, x.offset + i)
+        return ElementRef(x, i)
+
+    def value_field(interp: Interpreter, args: list) -> Ref:
+        return FieldRef(args[0].value.get(), args[1].value.decode())
+
+    def map_keys(interp: Interpreter, args: list) -> Optional[SliceValue]:
+        m = args[0].value.get()
+        if m is None or not m.entries:
+            return None
+        keys = [Cell(copy_value(k)) for k, _ in map_entries(m)]
+        return SliceValue(keys, 0, len(keys), len(keys))
+
+    def map_index(interp: Interpreter, args: list) -> tuple:
+        m = args[1].value.get()
+        key = value(interp, args[2], args[3], underlying(typ(interp, args[0])).key)
+        entry = m.entries.get(key_of(key)) if m is not None else None
+        return (0, False) if entry is None else (Cell(copy_value(entry[1])), True)
+
+    def set_map_index(interp: Interpreter, args: list):
+        u = underlying(typ(interp, args[0]))
+        m = args[1].value.get()
+        key = value(interp, args[2], args[3], u.key)
+        if args[4].value == 0:
+            # the zero Value deletes the key
+            if m is not None:
+                m.entries.pop(key_of(key), None)
+            return
+        m.entries[key_of(key)] = (key, value(interp, args[4], args[5], u.eltype))
+
+    def store(interp: Interpreter, args: list):
+        args[1].value.set(value(interp, args[2], args[3], typ(interp, args[0])))
+
+    def store_value(interp: Interpreter, args: list):
+        args[0].value.set(args[1].value)
+
+    def store_number(interp: Interpreter, args: list):
+        typename = basic_typename(underlying(typ(interp, args[0])))
+        x = args[2].value
+        if untyped.kind_of_typename(typename) == "float":
+            x = float(x)
+        args[1].value.set(wrap(x, typename))
+
+    def set_len(interp: Interpreter, args: list):
+        ref, n = args[0].value, args[1].value
+        s = ref.get()
+        if s is not None:
+            ref.set(SliceValue(s.array, s.offset, n, s.cap))
+
+    natives = {
+        "typeOf": type_of, "typeKind": type_kind, "typeName": type_name,
+        "typePkgPath": type_pkg_path, "typeString": type_string_, "typeElem": type_elem,
+        "typeKey": type_key, "typeLen": type_len, "typeNumField": type_num_field,
+        "typeField": type_field, "pointerTo": pointer_to, "implements": implements,
+        "lookupTag": lookup_tag, "valueOf": value_of, "addr": addr,
+        "valueInterface": value_interface, "zero": zero, "newValue": new_value,
+        "makeSlice": make_slice, "makeMap": make_map,
+        "appendValue": append_value, "assignable": assignable, "loadBool": load,
+        "loadInt": load, "loadUint": load, "loadFloat": load, "loadString": load,
+        "valueLen": value_len, "valueCap": value_cap, "isNil": is_nil, "isZero": is_zero,
+        "valueElem": value_elem, "valueIndex": value_index, "valueField": value_field,
+        "mapKeys": map_keys, "mapIndex": map_index, "setMapIndex": set_map_index,
+        "store": store, "storeBool": store_value, "storeNumber": store_number,
+        "storeString": store_value, "setLen": set_len,
+    }
+    return {name: Native(name, fn) for name, fn in natives.items()}
@@ -0,0 +1,76 @@
+import re
+import utils
+
+from typing import Optional, Tuple
+
+
+# The version of the Go language the program is written in, like the -lang
+# flag of cmd/compile (-lang=go1.21). The parser and the type checker report
+# the features of later versions, like type parameters (go1.18) or range over
+# integers (go1.22), with "requires go1.xx or later" errors, and the backends
+# run the loops of an earlier version than go1.22 with a single copy of their
+# variables. The files of std are written for the latest version. Without
+# -lang, the version is the one of the go directive of the go.mod of the
+# program (see loader.load), the latest one if it has none
+
+# the latest version gopy supports, the default one
+latest = (1, 22)
+version = latest
+# the version given to -lang, whatever the go.mod says
+flag: Optional[Tuple[int, int]] = None
+
+# the versions introducing the features gated
+generics = (1, 18)
+min_max = (1, 21)
+range_int = (1, 22)
+loop_var = (1, 22)
+
+
+def parse(s: str) -> Optional[Tuple[int, int]]:
+    """The version of a string like go1.21 (or go1.21.3), None if it isn't one"""
+    m = re.fullmatch(r"go1\.(0|[1-9]\d*)(\.(0|[1-9]\d*))?", s)
+    return None if m is None else (1, int(m.group(1)))
+
+
+def string(v: Tuple[int, int]) -> str:
+    return f"go{v[0]}.{v[1]}"
+
+
+def set_version(s: str):
+    """Sets the version of the program to the one of s, raises a
+    ValueError with the message of cmd/compile if it isn't one"""
+    global version, flag
+    v = parse(s)
+    if v is None:
+        raise ValueError(f'invalid value "{s}" for flag -lang: should be something like "go1.12"')
+    if v > latest:
+        raise ValueError(f"invalid value \"{s}\" for flag -lang: max known version is "
+                         f"{string(latest)}")
+    version = flag = v
+
+
+def parse_go_directive(s: str) -> Optional[Tuple[int, int]]:
+    """The version of the go directive of a go.mod, like 1.21, 1.21.3 or
+    1.21rc1, None if it isn't one"""
+    m = re.fullmatch(r"1\.(0|[1-9]\d*)((\.(0|[1-9]\d*))?|(rc|beta)[1-9]\d*)", s)
+    return None if m is None else (1, int(m.group(1)))
+
+
+def set_module_version(go: Optional[str]):
+    """Sets the version of the program to the one of the go directive of its
+    go.mod (None if it has none), unless -lang gave one. gopy checks the
+    programs of later versions than the latest one for the latest one"""
+    global version
+    v = parse_go_directive(go) if go is not None else None
+    version = flag or (min(v, latest) if v is not None else latest)
+
+
+def allows(v: Tuple[int, int], file: Optional[str] = None) -> bool:
+    """If the features of the version v can be used in file"""
+    return version >= v or file in utils.std_files
+
+
+def requires(feature: str, v: Tuple[int, int]) -> str:
+    """The error of a feature of the version v, used in an earlier version"""
+    return (f"{feature} requires {string(v)} or later "
+            f"(-lang was set to {string(version)}; check go.mod)")
@@ -0,0 +1,449 @@
+import os
+import json
+import diagnostics
+import fileset
+import go_lexer
+import lang
+import pyffi
+import summaries
+import utils
+
+from dataclasses import dataclass, field
+from diagnostics import Diagnostic
+from typing import Any, Dict, List, Optional, Tuple
+
+
+# The loader finds the packages of a program: the package given, made of
+# all the .go files of its directory, and the ones it imports (directly or
+# not). The imports of each file are read before parsing, so the packages
+# can be parsed and type checked in order, each one after the ones it imports.
+# The packages of the standard library the backends implement, like fmt, are
+# declared in std (their functions have no bodies), the import paths which
+# are not in the program are looked up there, then in the summaries of the
+# packages of the standard library of the Go toolchain (see summaries.py).
+# The import paths python/NAME are the Python modules NAME, whose packages
+# are their bindings (see pyffi.py)
+#
+# The program is in a module if a directory above its own (or its own) has a
+# go.mod: the import paths starting with the module path are the packages
+# of the directories of the module, the ones of the modules it requires are
+# found in the module cache of the go command, or in the directories the
+# replace directives give, and the other ones (with a dot in their first
+# element, like github.com/...) can't be imported. Without a go.mod, the
+# import paths are the directories relative to the one of the program
+# Ref: https://golang.org/ref/spec#Import_declarations
+# Ref: https://go.dev/ref/mod#go-mod-file
+
+# the declarations of the packages of the standard library, by import path
+std_root = os.path.join(os.path.dirname(os.path.abspath(__file__)), "std")
+
+# the file go_parser.py test adds to the package tested, like the one go
+# test generates: its function test_main runs the tests of the package
+# with testing.Main, instead of main (see add_test_main)
+test_main_file = "_testmain.go"
+test_main = "testmain"
+
+
+@dataclass
+class Package:
+    """A package of the program, the .go files of a directory"""
+
+    # the import path, the path of the directory for the package given
+    path: str
+    dir: str
+    files: List[str] = field(default_factory=list)
+    # the name in the package clause of the files
+    name: Optional[str] = None
+    # the packages imported, by import path. None for the packages which
+    # are not part of the program, nor of std
+    imports: Dict[str, Optional["Package"]] = field(default_factory=dict)
+    # set by parse_package, the AST and the symbols of the package, and
+    # the syntree.Package the packages importing it refer to
+    ast: Any = None
+    symbols: list = field(default_factory=list)
+    members: Any = None
+    # the package scope, once it is type checked
+    scope: Any = None
+    # a package of std, the backends have their own implementation of it
+    std: bool = False
+    # a package of std made of its summary (see summaries.py), which the
+    # backends don't implement
+    summary: bool = False
+    # a Python module, made of its bindings (see pyffi.py)
+    python: bool = False
+
+
+@dataclass
+class Module:
+    """The module of a go.mod, in the directory dir"""
+
+    path: str
+    dir: str
+    # the version of Go of the go directive
+    go: Optional[str] = None
+    # the versions of the modules required, by module path
+    requires: Dict[str, str] = field(default_factory=dict)
+    # the replacements of the modules, by module path: a directory (relative
+    # to dir), or the (path, version) of another module
+    replaces: Dict[str, Any] = field(default_factory=dict)
+
+
+def find_module(dir: str) -> Optional[Module]:
+    """The module of the go.mod of dir or of the closest directory above it,
+    None if there is none (or it has no module directive, which is reported)"""
+    dir = os.path.abspath(dir)
+    while True:
+        filename = os.path.join(dir, "go.mod")
+        if os.path.isfile(filename):
+            return parse_go_mod(filename)
+        parent = os.path.dirname(dir)
+        if parent == dir:
+            return None
+        dir = parent
+
+
+def parse_go_mod(filename: str) -> Optional[Module]:
+    """The module of a go.mod: its module, go, require and replace directives
+    (the other ones are left out), their blocks in parentheses included"""
+    module = Module("", os.path.dirname(filename))
+    block = None
+    for lineno, line in enumerate(utils.read_source(filename).splitlines(), 1):
+        words = line.split("//")[0].split()
+        if not words:
+            continue
+        if block is not None:
+            if words == [")"]:
+                block = None
+                continue
+            words = [block] + words
+        elif words[1:] == ["("]:
+            block = words[0]
+            continue
+        directive, args = words[0], [arg.strip('"') for arg in words[1:]]
+        if directive == "module" and args:
+            module.path = args[0]
+        elif directive == "go" and args:
+            if lang.parse_go_directive(args[0]) is None:
+                diagnostics.error(f"invalid go version '{args[0]}': must match format 1.23.0",
+                                  kind="ERROR", code="BrokenImport", file=filename,
+                                  lineno=lineno)
+            else:
+                module.go = args[0]
+        elif directive == "require" and len(args) >= 2:
+            module.requires[args[0]] = args[1]
+        elif directive == "replace" and "=>" in args:
+            arrow = args.index("=>")
+            new = args[arrow + 1:]
+            if len(new) == 1:
+                module.replaces[args[0]] = new[0]
+            elif len(new) == 2:
+                module.replaces[args[0]] = (new[0], new[1])
+    if not module.path:
+        diagnostics.error("go.mod has no module directive", kind="ERROR",
+                          code="BrokenImport", file=filename)
+        return None
+    return module
+
+
+def module_cache() -> str:
+    """The directory of the module cache of the go command"""
+    if os.environ.get("GOMODCACHE"):
+        return os.environ["GOMODCACHE"]
+    gopath = os.environ.get("GOPATH", "").split(os.pathsep)[0]
+    return os.path.join(gopath or os.path.join(os.path.expanduser("~"), "go"), "pkg", "mod")
+
+
+def escape_path(path: str) -> str:
+    """The path of a module in the module cache, the upper case letters
+    are escaped as ! and the lower case one (like github.com/!burnt!sushi)"""
+    return "".join("!" + c.lower() if c.isupper() else c for c in path)
+
+
+def in_module(path: str, module_path: str) -> bool:
+    return path == module_path or path.startswith(module_path + "/")
+
+
+def package_files(dir: str, tests: bool = False) -> List[str]:
+    """The source files of the package in dir, test files are not part of
+    it unless tests"""
+    if not os.path.isdir(dir):
+        return []
+    return [
+        os.path.join(dir, name) for name in sorted(os.listdir(dir))
+        if name.endswith(".go") and (tests or not name.endswith("_test.go"))
+    ]
+
+
+class Loader:
+    """Loads the packages of a program, see load"""
+
+    def __init__(self, root: str, module: Optional[Module] = None):
+        # the directory import paths are relative to, without a module
+        self.root = root
+        # the module of the program, see find_module
+        self.module = module
+        # the packages loaded, by directory
+        self.packages: Dict[str, Package] = {}
+        # the packages loaded, each one after the ones it imports
+        self.order: List[Package] = []
+        # the packages being loaded, each one imported by the one before
+        self.stack: List[Package] = []
+
+    def load(self, package: Package):
+        """Loads the files of the package, and the packages it imports"""
+        self.packages[package.dir] = package
+        self.stack.append(package)
+        # the position of the first import of each path, it is reported if
+        # the package can't be imported
+        positions = {}
+        first = None
+        for filename in list(package.files):
+            name, imports = self.scan(filename)
+            if name is None:
+                # the parser reports it
+                continue
+            if package.name is None:
+                package.name, first = name, filename
+            elif name != package.name:
+                diagnostics.error(
+                    f"found packages {package.name} ({os.path.basename(first)}) "
+                    f"and {name} ({os.path.basename(filename)}) in {package.dir}",
+                    kind="ERROR", code="MismatchedPkgName"
+                )
+                # the file is not part of the package
+                package.files.remove(filename)
+                continue
+            for path, position in imports:
+                package.imports.setdefault(path, None)
+                positions.setdefault(path, position)
+        for path in package.imports:
+            package.imports[path] = self.import_(package, path, positions[path])
+        self.stack.pop()
+        self.order.append(package)
+
+    def scan(self, filename: str) -> Tuple[Optional[str], list]:
+        """The name in the package clause of the file, and the
+        (import path, position) of each of its imports
+
+        The errors in the file are reported when it is parsed"""
+        with diagnostics.muted():
+            return self.scan_imports(filename)
+
+    def scan_imports(self, filename: str) -> Tuple[Optional[str], list]:
+        go_lexer.set_input(utils.read_source(filename))
+        utils.sources[filename] = go_lexer.lines
+        utils.set_file(filename)
+
+        tokens = iter(go_lexer.lexer.token, None)
+        clause = [next(tokens, None) for _ in range(3)]
+        if None in clause or [tok.type for tok in clause] != ["KW_PACKAGE", "IDENTIFIER", ";"]:
+            return None, []
+
+        # the imports come right after the package clause, each import
+        # declaration is a single spec or a list of them in parentheses
+        imports = []
+        tok = next(tokens, None)
+        while tok is not None and tok.type == "KW_IMPORT":
+            tok = next(tokens, None)
+            grouped = tok is not None and tok.type == "("
+            while tok is not None and tok.type != (")" if grouped else ";"):
+                if tok.type == "STRING_LIT":
+                    position = (filename, tok.lineno, go_lexer.find_column(tok.lexpos))
+                    imports.append((tok.value[1].strip('"'), position))
+                tok = next(tokens, None)
+            if grouped:
+                tok = next(tokens, None)
+            tok = next(tokens, None)
+        return clause[1].value[1], imports
+
+    def scan_tests(self, filename: str) -> Tuple[List[str], List[str]]:
+        """The names of the test and the benchmark functions of the file,
+        func TestXxx(t *testing.T) and func BenchmarkXxx(b *testing.B) where
+        Xxx doesn't start with a lower case letter (other than TestMain).
+        The other functions named like them are reported"""
+        go_lexer.set_input(utils.read_source(filename))
+        utils.sources[filename] = go_lexer.lines
+        utils.set_file(filename)
+
+        tokens = list(iter(go_lexer.lexer.token, None))
+        found: Dict[str, List[str]] = {"T": [], "B": []}
+        for i, tok in enumerate(tokens[:-1]):
+            if tok.type != "KW_FUNC" or tokens[i + 1].type != "IDENTIFIER":
+                continue
+            ident = tokens[i + 1]
+            name = ident.value[1]
+            for prefix, type_ in (("Test", "T"), ("Benchmark", "B")):
+                if name.startswith(prefix) and not name[len(prefix):len(prefix) + 1].islower():
+                    break
+            else:
+                continue
+            if name == "TestMain":
+                continue
+            # the parameters and the start of the body, (t *testing.T) {
+            signature = [t.value[1] if t.type == "IDENTIFIER" else t.type
+                         for t in tokens[i + 2:i + 10]]
+            if len(signature) > 1 and signature[1] not in ("*", ")"):
+                # the name of the parameter
+                del signature[1]
+            if signature[:7] == ["(", "*", "testing", ".", type_, ")", "{"]:
+                found[type_].append(name)
+            else:
+                diagnostics.error(f"wrong signature for {name}, must be: "
+                                  f"func {name}({type_.lower()} *testing.{type_})", ident.lineno,
+                                  go_lexer.find_column(ident.lexpos), len(name),
+                                  kind="ERROR", file=filename)
+        return found["T"], found["B"]
+
+    def resolve(self, importer: Package, path: str) -> Optional[str]:
+        """The directory of the package imported by path, relative to the
+        directory of the importer (like ./units) or to the root, else to
+        std_root. None if the package is neither in the program nor in std.
+        In a module, the path is the one of a package of a module instead
+        of being relative to the root, see resolve_module"""
+        if pyffi.is_python(path):
+            return pyffi.bind(path, self.root)
+        if path.startswith("./") or path.startswith("../"):
+            dirs = [os.path.join(importer.dir, path)]
+        elif self.module is not None:
+            dir, _ = self.resolve_module(path)
+            dirs = [dir] if dir is not None else [os.path.join(std_root, path)]
+        else:
+            dirs = [os.path.join(self.root, path), os.path.join(std_root, path)]
+        for dir in map(os.path.normpath, dirs):
+            if package_files(dir):
+                return dir
+        if not path.startswith("./") and not path.startswith("../"):
+            return summaries.find(path)
+        return None
+
+    def resolve_module(self, path: str) -> Tuple[Optional[str], Optional[str]]:
+        """The directory the package of path would be in, if it is in the
+        module of the program or in one it requires (or replaces), and
+        the module (its path and its version) it is in"""
+        module = self.module
+        if in_module(path, module.path):
+            return os.path.join(module.dir, path[len(module.path) + 1:]), module.path
+        # the longest module path the path is in
+        found = max((m for m in list(module.replaces) + list(module.requires)
+                     if in_module(path, m)), key=len, default=None)
+        if found is None:
+            return None, None
+        rest = path[len(found) + 1:]
+        replacement = module.replaces.get(found)
+        if isinstance(replacement, str):
+            return os.path.join(module.dir, replacement, rest), f"{found} => {replacement}"
+        name, version = replacement or (found, module.requires[found])
+        cached = os.path.join(module_cache(), f"{escape_path(name)}@{version}")
+        return os.path.join(cached, rest), f"{name} {version}"
+
+    def import_(self, importer: Package, path: str, position: tuple) -> Optional[Package]:
+        dir = self.resolve(importer, path)
+        if dir is None:
+            if path.startswith("./") or path.startswith("../"):
+                self.error(f"cannot find package {path}", path, position)
+            elif pyffi.is_python(path):
+                self.error(f"cannot import Python module {pyffi.module_name(path)}: "
+                           f"{pyffi.errors[path]}", path, position)
+            elif self.module is not None:
+                self.module_error(path, position)
+            return None
+
+        package = self.packages.get(dir)
+        if package is None:
+            summary = dir.startswith(os.path.join(summaries.directory, ""))
+            python = pyffi.is_python(path)
+            std = summary or python or dir.startswith(std_root + os.sep)
+            files = [pyffi.filename(path)] if python else package_files(dir)
+            package = Package(path, dir, files, std=std, summary=summary, python=python)
+            if std:
+                utils.std_files.update(package.files)
+            self.load(package)
+        elif package in self.stack:
+            # the packages of the cycle, each one imported by the one before
+            cycle = self.stack[self.stack.index(package):]
+            notes = [Diagnostic(f"package {cycle[0].path}")]
+            for imported in cycle[1:] + [package]:
+                notes.append(Diagnostic(f"\timports {imported.path}"))
+            self.error("import cycle not allowed", path, position, notes)
+            return None
+
+        if package.name == "main":
+            self.error(f"import \"{path}\" is a program, not an importable package",
+                       path, position)
+            return None
+        return package
+
+    def module_error(self, path: str, position: tuple):
+        """Reports the import of a package which isn't in the module of
+        the program, nor in the ones it requires or in std. The paths whose
+        first element has no dot are the ones of std, like for the go
+        command, the packages of std gopy doesn't declare are not known"""
+        dir, module = self.resolve_module(path)
+        if module == self.module.path:
+            self.error(f"cannot find package {path} in module {module} "
+                       f"(no Go files in {os.path.relpath(dir)})", path, position)
+        elif module is not None and "=>" in module:
+            self.error(f"cannot find package {path} in the replacement {module} "
+                       f"(no Go files in {os.path.relpath(dir)})", path, position)
+        elif module is not None:
+            self.error(f"cannot find package {path} in module {module}, which isn't in the "
+                       f"module cache (go mod download downloads it)", path, position)
+        elif "." in path.split("/")[0]:
+            self.error(f"no required module provides package {path} "
+                       f"(go.mod has no require directive for it)", path, position)
+
+    def error(self, message: str, path: str, position: tuple, notes=None):
+        filename, lineno, col_num = position
+        diagnostics.error(message, lineno, col_num, len(path) + 2, kind="ERROR",
+                          file=filename, notes=notes or [])
+
+
+def add_test_main(loader: Loader, package: Package):
+    """Adds the file test_main_file to the package, its function test_main
+    calls testing.Main with the tests and the benchmarks of its _test.go
+    files (in the order of their files). The file is one of utils.overlays"""
+    name, tests, benchmarks = None, [], []
+    for filename in package.files:
+        name = name or loader.scan(filename)[0]
+        if filename.endswith("_test.go"):
+            file_tests, file_benchmarks = loader.scan_tests(filename)
+            tests.extend(file_tests)
+            benchmarks.extend(file_benchmarks)
+    filename = os.path.join(package.dir, test_main_file)
+    utils.overlays[filename] = (
+        f"package {name}\n\nimport \"testing\"\n\nfunc {test_main}() {{\n"
+        f"\ttesting.Main({json.dumps(package.path)}, []testing.InternalTest{{\n" +
+        "".join(f"\t\t{{\"{test}\", {test}}},\n" for test in tests) +
+        "\t}, []testing.InternalBenchmark{\n" +
+        "".join(f"\t\t{{\"{benchmark}\", {benchmark}}},\n" for benchmark in benchmarks) +
+        "\t})\n}\n"
+    )
+    package.files.append(filename)
+
+
+def load(path: str, tests: bool = False) -> List[Package]:
+    """The packages of the program in path, a directory (or a single file),
+    each one after the ones it imports, so the package in path is the last.
+    If tests, its _test.go files are part of it, with the file running
+    them (see add_test_main)
+
+    Import paths are relative to the directory of the program, like "geometry"
+    for the package in its directory geometry, or are the ones of std, like
+    "fmt". The other packages are not loaded (their members are not known)"""
+    path = os.path.normpath(path)
+    fileset.fset.forget_strings()
+    if os.path.isdir(path):
+        package = Package(path, path, package_files(path, tests))
+    else:
+        package = Package(path, os.path.dirname(path) or ".", [path])
+    if not package.files:
+        diagnostics.error(f"no Go files in {path}", kind="ERROR", code="NoGoFiles")
+        return []
+
+    module = find_module(package.dir)
+    lang.set_module_version(module.go if module is not None else None)
+    loader = Loader(package.dir, module)
+    if tests:
+        add_test_main(loader, package)
+    loader.load(package)
+    return loader.order
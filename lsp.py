@@ -0,0 +1,777 @@
+import io
+import os
+import sys
+import json
+import queue
+import threading
+import traceback
+import contextlib
+import urllib.parse
+import urllib.request
+
+from typing import BinaryIO, Dict, List, Optional, Set, Tuple
+
+import cancel
+import checker
+import diagnostics
+import fileset
+import go_parser
+import highlight
+import incremental
+import loader
+import query
+import syntree
+import utils
+
+from diagnostics import Diagnostic
+from go_lexer import symtab
+from incremental import capturing
+
+
+# A language server for editors, speaking the Language Server Protocol over
+# the standard input and output: gopy lsp. The files open in the editor are
+# read from it (see utils.overlays), not from the disk. The program of a file
+# is the package of its directory, with the packages it imports, or the file
+# alone with --single-file (like the programs of tests). Its own package is
+# parsed with an incremental.Tree, an edit of a file parses again the
+# declarations it changes, then the package is type checked again. An edit
+# of the imports loads the whole program again. It provides:
+#
+#  - the diagnostics of the program, published at each change
+#  - hover: the declaration an identifier refers to (with the value of
+#    a constant), or the type and the value of an expression
+#  - go to definition, of the identifiers, the fields, the methods and the
+#    types written by their name
+#  - the symbols of a document, its top level declarations
+#  - the semantic tokens of a document, classified by highlight.py
+#
+# The messages are read by a thread of their own, so $/cancelRequest
+# cancels the request it names (see cancel.py), which is answered with
+# request_canceled, and a change of a document cancels the check of the
+# change before it, if it isn't done yet: its diagnostics would be stale.
+#
+# Ref: https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+# the codes of the JSON-RPC errors
+method_not_found = -32601
+internal_error = -32603
+request_canceled = -32800
+# the severities, the kinds of the symbols and the sync of the documents
+severities = {"error": 1, "warning": 2, "note": 3}
+symbol_kinds = {
+    "method": 6, "field": 8, "interface": 11, "function": 12, "variable": 13,
+    "constant": 14, "struct": 23, "class": 5,
+}
+incremental_sync = 2
+# the legend of the semantic tokens, the kinds of highlight.py are
+# the types of the same name, but the constants and the fields
+token_types = [
+    "namespace", "type", "function", "method", "property", "variable",
+    "keyword", "comment", "string", "number", "operator",
+]
+token_modifiers = ["declaration", "readonly", "defaultLibrary"]
+token_kinds = {"constant": ("variable", ("readonly",)), "field": ("property", ())}
+
+
+def read_message(reader: BinaryIO) -> Optional[dict]:
+    """The next message from the client, None at the end of the input"""
+    length = None
+    while True:
+        line = reader.readline()
+        if not line:
+            return None
+        line = line.strip()
+        if not line:
+            break
+        name, _, value = line.decode("ascii").partition(":")
+        if name.lower() == "content-length":
+            length = int(value)
+    if length is None:
+        return None
+    return json.loads(reader.read(length).decode("utf-8"))
+
+
+def write_message(writer: BinaryIO, message: dict):
+    body = json.dumps(message, ensure_ascii=False).encode("utf-8", errors="surrogateescape")
+    writer.write(f"Content-Length: {len(body)}\r\n\r\n".encode("ascii") + body)
+    writer.flush()
+
+
+def uri_to_path(uri: str) -> str:
+    return os.path.normpath(urllib.request.url2pathname(urllib.parse.urlparse(uri).path))
+
+
+def path_to_uri(path: str) -> str:
+    return "file://" + urllib.request.pathname2url(os.path.abspath(path))
+
+
+def utf16_length(text: str) -> int:
+    """The length of text in UTF-16 code units, the unit of the columns of LSP"""
+    return sum(2 if ord(c) > 0xFFFF else 1 for c in text)
+
+
+def offset_of(text: str, position: dict) -> int:
+    """The offset (in characters) of a Position of LSP in text, the end
+    of its line if it is past it"""
+    start = 0
+    for _ in range(position["line"]):
+        start = text.find("\n", start) + 1
+        if start == 0:
+            return len(text)
+    end = text.find("\n", start)
+    end = len(text) if end == -1 else end
+    units, offset = 0, start
+    while offset < end and units < position["character"]:
+        units += utf16_length(text[offset])
+        offset += 1
+    return offset
+
+
+class Lines:
+    """The lines of the files, for the Positions of LSP"""
+
+    def __init__(self):
+        self.lines: Dict[str, List[str]] = {}
+
+    def of(self, filename: str) -> List[str]:
+        if filename not in self.lines:
+            try:
+                self.lines[filename] = utils.read_source(filename).split("\n")
+            except OSError:
+                self.lines[filename] = []
+        return self.lines[filename]
+
+    def position(self, filename: str, lineno: Optional[int], col_num: Optional[int]) -> dict:
+        """The Position of the column col_num (counting characters from 1)
+        of line lineno, the start of the line if col_num is None"""
+        if not lineno:
+            return {"line": 0, "character": 0}
+        lines = self.of(filename)
+        line = lines[lineno - 1] if lineno <= len(lines) else ""
+        return {"line": lineno - 1, "character": utf16_length(line[:(col_num or 1) - 1])}
+
+    def range(self, filename: str, lineno: Optional[int], col_num: Optional[int],
+              width: int) -> dict:
+        """The Range of width characters at lineno, col_num, the whole line
+        if col_num is None"""
+        start = self.position(filename, lineno, col_num)
+        if col_num is None:
+            lines = self.of(filename)
+            end_col = len(lines[lineno - 1]) + 1 if lineno and lineno <= len(lines) else 1
+        else:
+            end_col = col_num + width
+        return {"start": start, "end": self.position(filename, lineno, end_col)}
+
+    def span(self, pos: int, end: int) -> dict:
+        """The Range of the span from pos to end, see fileset"""
+        start, stop = fileset.fset.position(pos), fileset.fset.position(end)
+        return {
+            "start": self.position(start.filename, start.line, start.column),
+            "end": self.position(stop.filename, stop.line, stop.column),
+        }
+
+
+def semantic_tokens(toks: List[highlight.Token], lines: List[str]) -> List[int]:
+    """The data of the SemanticTokens of the tokens of a file, the line, the
+    start (in UTF-16 code units) relative to the token before, the length, the
+    type and the modifiers of each token"""
+    data: List[int] = []
+    last_line, last_start = 0, 0
+    for tok in toks:
+        kind, mods = token_kinds.get(tok.kind, (tok.kind, ()))
+        line = lines[tok.lineno - 1] if tok.lineno <= len(lines) else ""
+        text = line[tok.col_num - 1:tok.col_num - 1 + tok.length]
+        lineno, start = tok.lineno - 1, utf16_length(line[:tok.col_num - 1])
+        bits = sum(1 << token_modifiers.index(m) for m in set(mods + tok.modifiers))
+        data += [lineno - last_line, start - last_start if lineno == last_line else start,
+                 utf16_length(text), token_types.index(kind), bits]
+        last_line, last_start = lineno, start
+    return data
+
+
+def lsp_diagnostic(d: Diagnostic, lines: Lines) -> dict:
+    result = {
+        "range": lines.range(d.file, d.lineno, d.col_num, d.width),
+        "severity": severities.get(d.severity, 1),
+        "source": "gopy",
+        "message": d.message,
+    }
+    if d.code is not None:
+        result["code"] = d.code
+    related = [
+        {"location": {"uri": path_to_uri(note.file),
+                      "range": lines.range(note.file, note.lineno, note.col_num, note.width)},
+         "message": note.message}
+        for note in d.notes if note.file is not None and note.lineno
+    ]
+    if related:
+        result["relatedInformation"] = related
+    return result
+
+
+def type_check(package: loader.Package, info: checker.Info, warnings: bool,
+               ctx: Optional[cancel.Context] = None):
+    """go_parser.type_check, which logs the exceptions of the checker (to
+    stderr) instead of raising them: a program the checker doesn't get
+    through is reported with the errors found so far, and the server
+    keeps answering"""
+    try:
+        go_parser.type_check(package, info, warnings, ctx)
+    except cancel.ContextError:
+        raise
+    except Exception:
+        print(traceback.format_exc(), file=sys.stderr)
+
+
+class Program:
+    """A program of the files open in the editor: its packages, the
+    incremental.Tree of its own package, and what the type checker
+    found in it (see check)"""
+
+    def __init__(self, path: str, warnings: bool = False):
+        self.path = path
+        self.warnings = warnings
+        self.packages: List[loader.Package] = []
+        self.tree: Optional[incremental.Tree] = None
+        # the fileset.Files of the packages imported, parsed by load
+        self.imported_files: List[fileset.File] = []
+        # what the loader and the packages imported reported, and what the
+        # checker found in the packages imported
+        self.load_errors: List[Diagnostic] = []
+        self.imported_info = checker.Info()
+        self.info = checker.Info()
+        self.found: List[Diagnostic] = []
+        self.load()
+
+    @property
+    def package(self) -> Optional[loader.Package]:
+        return self.packages[-1] if self.packages else None
+
+    def files(self) -> List[str]:
+        """The files of the packages of the program"""
+        return [filename for package in self.packages for filename in package.files]
+
+    def load(self, ctx: Optional[cancel.Context] = None):
+        """Loads the packages of the program again, like go_parser.check_program,
+        and checks its own package (until ctx is done, see check)"""
+        self.forget()
+        first = len(fileset.fset.files)
+        self.load_errors = []
+        self.imported_info = checker.Info()
+        with capturing(self.load_errors), contextlib.redirect_stdout(io.StringIO()):
+            self.packages = loader.load(self.path)
+            for package in self.packages[:-1]:
+                go_parser.parse_package(package, True)
+                type_check(package, self.imported_info, self.warnings)
+            self.imported_files = fileset.fset.files[first:]
+            self.tree = incremental.parse(self.package) if self.packages else None
+        self.check(ctx)
+
+    def forget(self):
+        """Forgets the syntree.TypeRefs of the files parsed before"""
+        files = self.imported_files + self.own_files()
+        if not files:
+            return
+        ids = {id(f) for f in files}
+        for pos in [pos for pos in syntree.type_refs if id(fileset.fset.file(pos)) in ids]:
+            del syntree.type_refs[pos]
+
+    def own_files(self) -> List[fileset.File]:
+        if self.tree is None:
+            return []
+        return [s.file for s in self.tree.sources.values() if s.file is not None]
+
+    def check(self, ctx: Optional[cancel.Context] = None):
+        """Type checks the package of the tree again. If ctx is done before
+        the end, its error is raised and the program is checked again
+        by the next change"""
+        self.info = checker.Info()
+        self.found = []
+        package = self.package
+        if package is None:
+            self.found = list(self.load_errors)
+            return
+        symtab.switch(package.symbols)
+        utils.package_name = package.name
+        with capturing(self.found), contextlib.redirect_stdout(io.StringIO()):
+            # the errors found before are on the lines the warnings are
+            # not reported on, like in check_program
+            diagnostics.reported.extend(self.load_errors + self.tree.diagnostics())
+            type_check(package, self.info, self.warnings, ctx)
+
+    def edit(self, filename: str, edits: List[incremental.Edit],
+             ctx: Optional[cancel.Context] = None):
+        """Applies the edits to the file of the package (and parses again
+        what they change), then checks it again (until ctx is done). The
+        whole program is loaded again if they change its imports"""
+        reload = False
+        with capturing([]), contextlib.redirect_stdout(io.StringIO()):
+            for edit in edits:
+                parsed = self.tree.edit(filename, edit)
+                reload = reload or any(decl.header or decl.imports for decl in parsed)
+        if reload:
+            self.load(ctx)
+        else:
+            self.check(ctx)
+
+    def diagnostics(self) -> Dict[str, List[Diagnostic]]:
+        """The diagnostics of the program by file, the ones without a
+        file are at the start of the first file of the program"""
+        files: Dict[str, List[Diagnostic]] = {}
+        first = self.package.files[0] if self.package and self.package.files else self.path
+        for d in self.found:
+            files.setdefault(d.file or first, []).append(d)
+        return files
+
+    def type_ref_at(self, filename: str, lineno: int, col_num: int
+                    ) -> Optional[syntree.TypeRef]:
+        """The narrowest type written by its name at the position"""
+        source = self.tree.sources.get(filename) if self.tree is not None else None
+        if source is None or source.file is None:
+            return None
+        if lineno > len(source.file.lines):
+            return None
+        pos = source.file.line_start(lineno) + col_num - 1
+        refs = [ref for ref in syntree.type_refs.values()
+                if ref.pos <= pos < ref.end and fileset.fset.file(ref.pos) is source.file]
+        return min(refs, key=lambda ref: ref.end - ref.pos, default=None)
+
+    def type_object(self, ref: syntree.TypeRef, filename: str) -> Optional[checker.Object]:
+        """The type a syntree.TypeRef names, in the package scope (or in the
+        one of the package imported), else the last one declared with its
+        name in the file before it"""
+        name = ref.name.split("[")[0]
+        package = self.package
+        if "." in name:
+            prefix, member = name.split(".", 1)
+            for other in package.imports.values():
+                if other is not None and other.name == prefix and other.scope is not None:
+                    return other.scope.objects.get(member)
+            return None
+        if package.scope is not None and name in package.scope.objects:
+            return package.scope.objects[name]
+        line = fileset.fset.position(ref.pos).line
+        local = [obj for node, obj in self.info.defs.items()
+                 if obj.kind == "type" and obj.name == name and obj.file == filename
+                 and obj.lineno is not None and obj.lineno <= line]
+        if local:
+            return max(local, key=lambda obj: (obj.lineno, obj.col_num or 0))
+        return package.scope.lookup(name) if package.scope is not None else None
+
+    def ident_object(self, node) -> Optional[checker.Object]:
+        """The object declared by the identifier of a field, or of a method of
+        an interface, in the package or in one imported (the types of the
+        ones imported are checked again where they are used)"""
+        return self.imported_info.defs.get(node.ident) or self.info.defs.get(node.ident)
+
+    def method_object(self, method: syntree.Method) -> Optional[checker.Object]:
+        return self.info.methods.get(method) or self.imported_info.methods.get(method)
+
+    def hover(self, filename: str, lineno: int, col_num: int) -> Optional[Tuple[str, tuple]]:
+        """What is at the position: the declaration of the object an identifier
+        refers to, else the type and the value of the expression, with the
+        (lineno, col_num, width) of its span"""
+        for node in query.nodes_at(self.info, filename, lineno, col_num):
+            obj = self.info.defs.get(node) or self.info.uses.get(node)
+            if obj is not None and (obj.lineno is not None or node not in self.info.operands):
+                return checker.object_string(obj), checker.position(node)
+            selection = self.info.selections.get(node)
+            if selection is not None:
+                if selection.kind == "field":
+                    field = self.ident_object(selection.obj)
+                    if field is not None:
+                        return checker.object_string(field), checker.position(node)
+                else:
+                    return checker.method_string(selection.obj), checker.position(node)
+            x = self.info.operands.get(node)
+            if x is not None and x.mode != "invalid":
+                return checker.describe(x), checker.position(node)
+        ref = self.type_ref_at(filename, lineno, col_num)
+        if ref is not None:
+            obj = self.type_object(ref, filename)
+            if obj is not None:
+                start = fileset.fset.position(ref.pos)
+                return checker.object_string(obj), (start.line, start.column, ref.end - ref.pos)
+        return None
+
+    def definition(self, filename: str, lineno: int, col_num: int) -> Optional[tuple]:
+        """The (file, lineno, col_num, width) of the declaration of what is
+        at the position, None if there is none (like for the predeclared ones)"""
+        def location(obj):
+            if obj is None or obj.lineno is None or obj.file is None:
+                return None
+            return obj.file, obj.lineno, obj.col_num, len(obj.name)
+
+        for node in query.nodes_at(self.info, filename, lineno, col_num):
+            obj = self.info.uses.get(node) or self.info.defs.get(node)
+            if obj is not None:
+                return location(obj)
+            selection = self.info.selections.get(node)
+            if selection is not None:
+                if selection.kind == "field":
+                    return location(self.ident_object(selection.obj))
+                if isinstance(selection.obj, syntree.InterfaceMethod):
+                    return location(self.ident_object(selection.obj))
+                return location(self.method_object(selection.obj))
+        ref = self.type_ref_at(filename, lineno, col_num)
+        if ref is not None:
+            return location(self.type_object(ref, filename))
+        return None
+
+    def symbols(self, filename: str, lines: Lines) -> List[dict]:
+        """The DocumentSymbols of the top level declarations of the file"""
+        file = next((f for f in self.package.ast.children
+                     if isinstance(f, syntree.File) and f.filename == filename), None)
+        if file is None:
+            return []
+        symbols = []
+        for child in file.children:
+            for decl in checker.in_order(child):
+                symbol = self.symbol(decl, filename, lines)
+                if symbol is not None:
+                    symbols.append(symbol)
+        return symbols
+
+    def symbol(self, decl, filename: str, lines: Lines) -> Optional[dict]:
+        def make(name, kind, lineno, col_num, detail="", children=None):
+            selection = lines.range(filename, lineno, col_num, len(name))
+            whole = lines.span(decl.pos, decl.end) if decl.pos != fileset.NoPos else selection
+            symbol = {"name": name, "detail": detail, "kind": symbol_kinds[kind],
+                      "range": whole, "selectionRange": selection}
+            if children:
+                symbol["children"] = children
+            return symbol
+
+        if isinstance(decl, syntree.Method):
+            name = decl.fn_name
+            recv = checker.type_string(decl.receiver_type)
+            return make(f"({recv}).{name[1]}", "method", decl.lineno, name[2],
+                        checker.signature_string(decl.signature))
+        elif isinstance(decl, syntree.Function) and decl.fn_name is not None:
+            name = decl.fn_name
+            return make(name[1], "function", decl.lineno, name[2],
+                        checker.signature_string(decl.signature))
+        elif isinstance(decl, syntree.TypeDef):
+            name = decl.typename
+            t = decl.type_
+            definition = t.definition if isinstance(t, syntree.NamedType) else t
+            kind = "class"
+            fields = []
+            if isinstance(definition, syntree.Struct):
+                kind = "struct"
+                for f in definition.fields:
+                    ident = f.ident
+                    field_range = lines.range(filename, ident.lineno, ident.col_num, len(f.f_name))
+                    fields.append({"name": f.f_name, "detail": checker.type_string(f.type_),
+                                   "kind": symbol_kinds["field"], "range": field_range,
+                                   "selectionRange": field_range})
+            elif isinstance(definition, syntree.Interface):
+                kind = "interface"
+            return make(name[1], kind, decl.lineno, name[2],
+                        checker.type_string(definition), fields)
+        elif isinstance(decl, syntree.VarDecl):
+            ident = decl.ident
+            if ident.ident_name == "_":
+                return None
+            obj = self.info.defs.get(ident)
+            detail = checker.type_string(obj.type_) if obj is not None else ""
+            return make(ident.ident_name, "constant" if decl.const else "variable",
+                        ident.lineno, ident.col_num, detail)
+        return None
+
+    def tokens(self, filename: str) -> List[highlight.Token]:
+        """The tokens of the file classified for highlighting, see highlight.py"""
+        return highlight.tokens(self.info, filename)
+
+
+class Server:
+    """The language server, see serve"""
+
+    def __init__(self, reader: BinaryIO, writer: BinaryIO, single_file: bool = False,
+                 warnings: bool = False):
+        self.reader = reader
+        self.writer = writer
+        self.single_file = single_file
+        self.warnings = warnings
+        # the programs of the documents open, by path
+        self.programs: Dict[str, Program] = {}
+        # the files diagnostics were published for, by the path of their program
+        self.published: Dict[str, set] = {}
+        self.shutdown_requested = False
+        # the messages read by the reader thread, None at the end of the input
+        self.messages: "queue.Queue[Optional[dict]]" = queue.Queue()
+        # the message being handled and its context, the ids of the requests
+        # canceled before they are answered, guarded by lock
+        self.lock = threading.Lock()
+        self.current: Optional[dict] = None
+        self.ctx: Optional[cancel.Context] = None
+        self.canceled: Set = set()
+        self.handlers = {
+            "initialize": self.initialize,
+            "shutdown": self.shutdown,
+            "textDocument/didOpen": self.did_open,
+            "textDocument/didChange": self.did_change,
+            "textDocument/didClose": self.did_close,
+            "textDocument/hover": self.hover,
+            "textDocument/definition": self.definition,
+            "textDocument/documentSymbol": self.document_symbol,
+            "textDocument/semanticTokens/full": self.semantic_tokens,
+        }
+
+    def serve(self) -> int:
+        """Answers the messages of the client until it exits, returns the exit code"""
+        threading.Thread(target=self.read, daemon=True).start()
+        while True:
+            message = self.messages.get()
+            if message is None:
+                return 1
+            method = message.get("method")
+            if method == "exit":
+                return 0 if self.shutdown_requested else 1
+            self.dispatch(message)
+
+    def read(self):
+        """Reads the messages of the client for serve, canceling the ones
+        they make useless"""
+        while True:
+            message = read_message(self.reader)
+            if message is not None and message.get("method") == "$/cancelRequest":
+                self.cancel((message.get("params") or {}).get("id"))
+                continue
+            if message is not None and message.get("method") == "textDocument/didChange":
+                self.supersede(message)
+            self.messages.put(message)
+            if message is None:
+                return
+
+    def cancel(self, id_):
+        """Cancels the request id_, the one being handled or a later one"""
+        with self.lock:
+            self.canceled.add(id_)
+            if self.current is not None and self.current.get("id") == id_:
+                self.ctx.cancel()
+
+    def supersede(self, change: dict):
+        """Cancels the check of the change of the same document being
+        handled, the change after it checks the document again"""
+        uri = change["params"]["textDocument"]["uri"]
+        with self.lock:
+            current = self.current
+            if (current is not None and current.get("method") == "textDocument/didChange"
+                    and current["params"]["textDocument"]["uri"] == uri):
+                self.ctx.cancel()
+
+    def dispatch(self, message: dict):
+        method, id_ = message.get("method"), message.get("id")
+        if method is None:
+            # a response, the server sends no requests
+            return
+        handler = self.handlers.get(method)
+        if handler is None:
+            if id_ is not None:
+                self.respond_error(id_, method_not_found, f"method not found: {method}")
+            return
+        with self.lock:
+            if id_ is not None and id_ in self.canceled:
+                self.canceled.discard(id_)
+                self.respond_error(id_, request_canceled, "request canceled")
+                return
+            self.current, self.ctx = message, cancel.with_cancel(cancel.background())
+        try:
+            result = handler(message.get("params") or {})
+        except cancel.ContextError:
+            if id_ is not None:
+                self.respond_error(id_, request_canceled, "request canceled")
+            return
+        except Exception as e:
+            print(traceback.format_exc(), file=sys.stderr)
+            if id_ is not None:
+                self.respond_error(id_, internal_error, str(e))
+            return
+        finally:
+            with self.lock:
+                self.current, self.ctx = None, None
+                self.canceled.discard(id_)
+        if id_ is not None:
+            write_message(self.writer, {"jsonrpc": "2.0", "id": id_, "result": result})
+
+    def respond_error(self, id_, code: int, message: str):
+        write_message(self.writer, {"jsonrpc": "2.0", "id": id_,
+                                    "error": {"code": code, "message": message}})
+
+    def notify(self, method: str, params: dict):
+        write_message(self.writer, {"jsonrpc": "2.0", "method": method, "params": params})
+
+    # the lifecycle
+
+    def initialize(self, params: dict) -> dict:
+        return {
+            "capabilities": {
+                "textDocumentSync": {"openClose": True, "change": incremental_sync},
+                "hoverProvider": True,
+                "definitionProvider": True,
+                "documentSymbolProvider": True,
+                "semanticTokensProvider": {
+                    "legend": {"tokenTypes": token_types, "tokenModifiers": token_modifiers},
+                    "full": True,
+                },
+            },
+            "serverInfo": {"name": "gopy"},
+        }
+
+    def shutdown(self, params: dict):
+        self.shutdown_requested = True
+        return None
+
+    # the documents
+
+    def program_path(self, filename: str) -> str:
+        return filename if self.single_file else os.path.dirname(filename)
+
+    def program_of(self, filename: str) -> Optional[Program]:
+        """The program of the file, see Program"""
+        return self.programs.get(self.program_path(filename))
+
+    def did_open(self, params: dict):
+        document = params["textDocument"]
+        filename = uri_to_path(document["uri"])
+        utils.overlays[filename] = document["text"]
+        path = self.program_path(filename)
+        if path in self.programs:
+            self.programs[path].load()
+        else:
+            self.programs[path] = Program(path, self.warnings)
+        self.changed(filename, path)
+
+    def did_change(self, params: dict):
+        filename = uri_to_path(params["textDocument"]["uri"])
+        text = utils.overlays.get(filename)
+        if text is None:
+            return
+        edits = []
+        for change in params["contentChanges"]:
+            if "range" in change:
+                start = offset_of(text, change["range"]["start"])
+                end = offset_of(text, change["range"]["end"])
+            else:
+                start, end = 0, len(text)
+            edit = incremental.Edit(start, end - start, change["text"])
+            edits.append(edit)
+            text = edit.apply(text)
+        utils.overlays[filename] = text
+        program = self.program_of(filename)
+        if program is not None and program.tree is not None and filename in program.tree.sources:
+            program.edit(filename, edits, self.ctx)
+        elif program is not None:
+            program.load(self.ctx)
+        self.changed(filename, self.program_path(filename))
+
+    def did_close(self, params: dict):
+        filename = uri_to_path(params["textDocument"]["uri"])
+        utils.overlays.pop(filename, None)
+        path = self.program_path(filename)
+        program = self.programs.get(path)
+        if program is None:
+            return
+        if any(self.program_path(other) == path for other in utils.overlays):
+            program.load()
+        else:
+            program.forget()
+            del self.programs[path]
+        self.changed(filename, path)
+
+    def changed(self, filename: str, path: str):
+        """Loads again the other programs the file is a part of (like the
+        ones importing its package), and publishes the diagnostics"""
+        for other_path, program in self.programs.items():
+            if other_path != path and filename in program.files():
+                program.load()
+        for other_path in sorted(self.published.keys() | self.programs.keys()):
+            self.publish(other_path)
+
+    def publish(self, path: str):
+        """Publishes the diagnostics of the program, an empty list for its
+        files which have none, and clears the ones of the other files
+        which have none anymore"""
+        lines = Lines()
+        program = self.programs.get(path)
+        files = program.diagnostics() if program is not None else {}
+        for filename in program.package.files if program and program.package else []:
+            files.setdefault(filename, [])
+        # the files of the other programs are theirs
+        files = {filename: found for filename, found in files.items()
+                 if self.program_path(filename) == path or filename not in self.owned()}
+        for filename in self.published.get(path, set()) - files.keys():
+            files[filename] = []
+        for filename, found in files.items():
+            self.notify("textDocument/publishDiagnostics", {
+                "uri": path_to_uri(filename),
+                "diagnostics": [lsp_diagnostic(d, lines) for d in found],
+            })
+        self.published[path] = {filename for filename, found in files.items() if found}
+        if program is None and not self.published[path]:
+            del self.published[path]
+
+    def owned(self) -> set:
+        """The files of the packages of the programs, the ones the
+        diagnostics of other packages importing them are not published for"""
+        return {filename for program in self.programs.values()
+                for filename in (program.package.files if program.package else [])}
+
+    # the queries
+
+    def query(self, params: dict) -> Tuple[Optional[Program], str, int, int]:
+        """The program of the document of the params, with the (lineno,
+        col_num) of their position"""
+        filename = uri_to_path(params["textDocument"]["uri"])
+        program = self.program_of(filename)
+        text = utils.overlays.get(filename, "")
+        position = params["position"]
+        offset = offset_of(text, position)
+        line_start = text.rfind("\n", 0, offset) + 1
+        return program, filename, position["line"] + 1, offset - line_start + 1
+
+    def hover(self, params: dict) -> Optional[dict]:
+        program, filename, lineno, col_num = self.query(params)
+        if program is None or program.package is None:
+            return None
+        found = program.hover(filename, lineno, col_num)
+        if found is None:
+            return None
+        text, (line, col, width) = found
+        return {
+            "contents": {"kind": "markdown", "value": f"```go\n{text}\n```"},
+            "range": Lines().range(filename, line, col, width),
+        }
+
+    def definition(self, params: dict) -> Optional[dict]:
+        program, filename, lineno, col_num = self.query(params)
+        if program is None or program.package is None:
+            return None
+        found = program.definition(filename, lineno, col_num)
+        if found is None:
+            return None
+        file, line, col, width = found
+        return {"uri": path_to_uri(file), "range": Lines().range(file, line, col, width)}
+
+    def document_symbol(self, params: dict) -> List[dict]:
+        filename = uri_to_path(params["textDocument"]["uri"])
+        program = self.program_of(filename)
+        if program is None or program.package is None:
+            return []
+        return program.symbols(filename, Lines())
+
+    def semantic_tokens(self, params: dict) -> Optional[dict]:
+        filename = uri_to_path(params["textDocument"]["uri"])
+        program = self.program_of(filename)
+        if program is None or program.package is None:
+            return None
+        toks = program.tokens(filename)
+        return {"data": semantic_tokens(toks, Lines().of(filename))}
+
+
+def serve(reader: BinaryIO, writer: BinaryIO, single_file: bool = False,
+          warnings: bool = False) -> int:
+    """Runs the language server on the streams, returns its exit code"""
+    diagnostics.printing = False
+    return Server(reader, writer, single_file, warnings).serve()
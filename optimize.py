@@ -0,0 +1,303 @@
+import checker
+import constant
+import interp
+import syntree
+
+from checker import in_order
+from dataclasses import dataclass
+from typing import Optional, Set
+
+
+# The optimizations of -O (go_parser.py build, run and --ast), on the AST of
+# the packages once they are type checked, before a backend compiles or runs
+# them. The constant expressions are already evaluated by the checker, the
+# backends use their values, so the optimizations are the ones it doesn't do:
+#  - the constants of the integer (and string) operations of an expression
+#    whose other operand isn't constant are folded, x * 60 * 60 becomes
+#    x * 3600 and s + "a" + "b" becomes s + "ab": the integers wrap around,
+#    so the order of + and - (or of *) doesn't change the result, but it does
+#    for the floats, which are left as they are
+#  - the branches of an if whose condition is constant are removed (only the
+#    block run is left, in a block with the statement of the if), and so are
+#    the loops whose condition is false
+#  - the assignments of a local variable whose value is assigned again
+#    before it is read, or never read before the function returns, are
+#    removed, if the value assigned can't have side effects or panic. The
+#    variables are the ones of basic types declared in the function, not
+#    captured by a function literal, whose address isn't taken and which
+#    aren't results, so nothing else can read them. A statement changing the
+#    flow of control (like a loop, a label or a break) keeps them all
+
+
+@dataclass
+class Stats:
+    """The optimizations done"""
+    folded: int = 0
+    branches: int = 0
+    stores: int = 0
+
+
+def optimize(packages: list, info: checker.Info) -> Stats:
+    """Optimizes the functions of the packages (but the ones of std)
+    checked with info, the operands of the constants folded are added
+    to info"""
+    stats = Stats()
+    for package in packages:
+        if package.std or package.ast is None:
+            continue
+        optimizer = Optimizer(info, stats)
+        for node in syntree.walk(package.ast):
+            if isinstance(node, syntree.Function) and node.body is not None:
+                optimizer.function(node)
+    return stats
+
+
+def is_constant(info: checker.Info, node) -> bool:
+    x = info.operands.get(node)
+    return x is not None and x.mode == "constant" and x.constant is not None
+
+
+def condition(info: checker.Info, node) -> Optional[bool]:
+    """The value of a constant condition, None if it isn't constant"""
+    if not is_constant(info, node):
+        return None
+    return bool(info.operands[node].constant.value)
+
+
+class Optimizer:
+
+    def __init__(self, info: checker.Info, stats: Stats):
+        self.info = info
+        self.stats = stats
+
+    def function(self, fn: syntree.Function):
+        syntree.rewrite(fn.body, self.fold)
+        blocks = [node for node in syntree.walk(fn.body, literals=False)
+                  if isinstance(node, syntree.Block)]
+        for block in blocks:
+            self.branches(block)
+        variables = self.variables(fn)
+        for block in [node for node in syntree.walk(fn.body, literals=False)
+                      if isinstance(node, syntree.Block)]:
+            self.dead_stores(block, variables, variables if block is fn.body else set())
+
+    # the constants folded
+
+    def fold(self, node):
+        """x op c1 op c2 as x op c, for the integer + and - (and *), and
+        the string +, see optimize"""
+        if not self.binary(node) or node.operator not in ("+", "-", "*") \
+                or is_constant(self.info, node):
+            return node
+        x = self.info.operands.get(node)
+        typename = checker.basic_typename(x.type_) if x is not None else None
+        kind = checker.constant_kind(x.type_) if typename is not None else None
+        left, right = node.left, node.right
+        if kind == "string":
+            if node.operator != "+" or not is_constant(self.info, right) \
+                    or self.operation(left, "+") is None:
+                return node
+            y, k = self.operation(left, "+")
+            if y is not left.left:
+                return node
+            sign, k = 1, k + self.value(right)
+        elif kind == "int" and node.operator == "*":
+            if is_constant(self.info, left):
+                left, right = right, left
+            if not is_constant(self.info, right) or self.operation(left, "*") is None:
+                return node
+            y, k = self.operation(left, "*")
+            sign, k = 1, interp.wrap(k * self.value(right), typename)
+        elif kind == "int":
+            if is_constant(self.info, right) and self.linear(left) is not None:
+                y, k, sign = self.linear(left)
+                k += self.value(right) if node.operator == "+" else -self.value(right)
+            elif is_constant(self.info, left) and self.linear(right) is not None:
+                y, k, sign = self.linear(right)
+                if node.operator == "-":
+                    sign, k = -sign, -k
+                k += self.value(left)
+            else:
+                return node
+            k = interp.wrap(k, typename)
+        else:
+            return node
+        c = constant.Constant(kind, k, typename)
+        literal = syntree.Literal(typename, c.to_python(), node.lineno)
+        syntree.fix_position(literal, node.right)
+        self.info.operands[literal] = checker.Operand("constant", literal, x.type_, c)
+        if sign < 0:
+            folded = syntree.BinOp("-", literal, y, node.lineno)
+        else:
+            folded = syntree.BinOp("+" if node.operator == "-" else node.operator, y, literal,
+                                   node.lineno)
+        self.info.operands[folded] = x
+        if node in self.info.files:
+            self.info.files[folded] = self.info.files[node]
+        self.stats.folded += 1
+        return folded
+
+    def binary(self, node) -> bool:
+        return isinstance(node, syntree.BinOp) and not isinstance(node, syntree.Assignment)
+
+    def value(self, node):
+        return self.info.operands[node].constant.value
+
+    def operation(self, node, operator: str):
+        """(y, c) for y op c, or c op y, of the operator, None if it isn't"""
+        if not self.binary(node) or node.operator != operator:
+            return None
+        if is_constant(self.info, node.right) and not is_constant(self.info, node.left):
+            return node.left, self.value(node.right)
+        if is_constant(self.info, node.left) and not is_constant(self.info, node.right):
+            return node.right, self.value(node.left)
+        return None
+
+    def linear(self, node):
+        """(y, k, sign) for an integer y + c, y - c, c + y or c - y, which
+        is sign * y + k, None if it isn't one of them"""
+        if not self.binary(node) or node.operator not in ("+", "-") \
+                or self.operation(node, node.operator) is None:
+            return None
+        y, c = self.operation(node, node.operator)
+        if node.operator == "+":
+            return y, c, 1
+        if y is node.left:
+            return y, -c, 1
+        return y, c, -1
+
+    # the branches on constant conditions
+
+    def branches(self, block: syntree.Block):
+        """Removes the branches of the ifs of the block not run, and its
+        loops whose condition is false"""
+        statements = []
+        changed = False
+        for stmt in in_order(block):
+            new = stmt
+            if isinstance(stmt, syntree.IfStmt):
+                new = self.if_stmt(stmt)
+            elif isinstance(stmt, syntree.ForStmt):
+                new = self.for_stmt(stmt)
+            changed = changed or new is not stmt
+            if new is not None:
+                statements.append(new)
+        if changed:
+            block.children = list(reversed(statements))
+
+    def if_stmt(self, stmt: syntree.IfStmt):
+        """The statement run instead of the if, None if it is nothing"""
+        while stmt.next_ is not None and isinstance(stmt.next_, syntree.IfStmt):
+            # the else ifs
+            inner = stmt.next_
+            value = condition(self.info, inner.expr)
+            if value is None or inner.statement is not None:
+                break
+            syntree.replace(stmt, inner, inner.body if value else inner.next_)
+            self.stats.branches += 1
+        value = condition(self.info, stmt.expr)
+        if value is None:
+            if isinstance(stmt.next_, syntree.IfStmt):
+                syntree.replace(stmt, stmt.next_, self.if_stmt(stmt.next_))
+            return stmt
+        self.stats.branches += 1
+        run = stmt.body if value else stmt.next_
+        if isinstance(run, syntree.IfStmt):
+            run = self.if_stmt(run)
+        if stmt.statement is None:
+            return run
+        return self.block([stmt.statement, run], stmt)
+
+    def for_stmt(self, stmt: syntree.ForStmt):
+        """The statement run instead of a loop whose condition is false"""
+        clause = stmt.clause
+        init = None
+        if isinstance(clause, syntree.ForClause):
+            clause, init = clause.cond, clause.init
+        if isinstance(clause, (syntree.RangeClause, syntree.ForClause)) or clause is None \
+                or condition(self.info, clause) is not False:
+            return stmt
+        self.stats.branches += 1
+        return None if init is None else self.block([init], stmt)
+
+    def block(self, statements: list, stmt) -> syntree.Block:
+        """A block of the statements, in place of stmt"""
+        block = syntree.Block(syntree.List(list(reversed([s for s in statements if s]))))
+        syntree.fix_position(block, stmt)
+        return block
+
+    # the dead stores
+
+    def variables(self, fn: syntree.Function) -> Set[int]:
+        """The local variables of the function whose stores can be removed
+        (see optimize), by the id of their object"""
+        results = set()
+        if fn.signature is not None and fn.signature.result is not None:
+            results = {id(self.info.defs.get(node)) for node in syntree.walk(fn.signature.result)}
+        found = set()
+        shared = set()
+        for node in syntree.walk(fn, literals=False):
+            obj = self.info.defs.get(node)
+            if obj is not None and obj.kind == "var" and id(obj) not in results \
+                    and isinstance(obj.type_, syntree.Type) and obj.type_.name == "BasicType":
+                found.add(id(obj))
+            if isinstance(node, syntree.Function) and node is not fn:
+                shared |= self.uses(node)
+            elif isinstance(node, syntree.UnaryOp) and node.operator == "&":
+                shared |= self.uses(node)
+        return found - shared
+
+    def uses(self, node) -> Set[int]:
+        """The objects used in the tree of node, by id"""
+        return {id(self.info.uses[n]) for n in syntree.walk(node) if n in self.info.uses}
+
+    def variable(self, node, variables: Set[int]) -> Optional[int]:
+        """The variable of the expression, if it is one of variables"""
+        if not isinstance(node, syntree.PrimaryExpr) or node.children:
+            return None
+        obj = id(self.info.uses.get(node))
+        return obj if obj in variables else None
+
+    def pure(self, node) -> bool:
+        """If the expression can't have side effects, nor panic"""
+        if is_constant(self.info, node):
+            return True
+        x = self.info.operands.get(node)
+        if x is None or checker.basic_typename(x.type_) is None:
+            return False
+        if isinstance(node, syntree.PrimaryExpr):
+            return not node.children and node in self.info.uses
+        if isinstance(node, syntree.UnaryOp):
+            return node.operator in ("-", "+", "!", "^") and self.pure(node.operand)
+        if isinstance(node, syntree.BinOp) and not isinstance(node, syntree.Assignment):
+            return node.operator not in ("/", "%", "<<", ">>") \
+                and self.pure(node.left) and self.pure(node.right)
+        return False
+
+    def dead_stores(self, block: syntree.Block, variables: Set[int], dead: Set[int]):
+        """Removes the stores of the variables of the block whose values are
+        not read, dead are the ones not read after the block"""
+        dead = set(dead)
+        statements = []
+        for stmt in reversed(in_order(block)):
+            if isinstance(stmt, syntree.Assignment) and stmt.operator == "=":
+                left, right = in_order(stmt.left), in_order(stmt.right)
+                v = self.variable(left[0], variables) if len(left) == 1 == len(right) else None
+                if v is not None:
+                    if v in dead and self.pure(right[0]):
+                        self.stats.stores += 1
+                        continue
+                    dead = (dead | {v}) - self.uses(right[0])
+                else:
+                    dead -= self.uses(stmt)
+            elif isinstance(stmt, syntree.Keyword) and stmt.kw == "RETURN":
+                dead = set(variables) - self.uses(stmt)
+            elif isinstance(stmt, (syntree.Keyword, syntree.LabeledStmt, syntree.Block,
+                                   syntree.IfStmt, syntree.ForStmt, syntree.SwitchStmt,
+                                   syntree.SelectStmt, syntree.GoStmt, syntree.DeferStmt)):
+                dead = set()
+            else:
+                dead -= self.uses(stmt)
+            statements.append(stmt)
+        if len(statements) != len(in_order(block)):
+            block.children = statements
@@ -0,0 +1,217 @@
+import io
+import os
+import sys
+import json
+import inspect
+import contextlib
+import cancel
+import checker
+import diagnostics
+import go_parser
+import interp
+import pyffi
+import sandbox
+import syntree
+import utils
+
+from typing import Any, Dict, List, Optional, Tuple
+
+
+# The API of a playground embedding gopy, like the one behind the Go
+# playground: the functions take the source of a program (a single file,
+# prog.go) instead of a path, return dicts of JSON values and neither read
+# nor write the files of the disk, other than the declarations of std, so
+# gopy runs where there is no file system to speak of nor processes, like in
+# the browser with Pyodide, which has std in the files of its package:
+#
+#   const playground = pyodide.pyimport("playground");
+#   const reply = JSON.parse(playground.handle(JSON.stringify(
+#       {method: "run", source: "package main\n..."})));
+#
+# The source is one of utils.overlays, the program imports the packages of
+# std only, not the modules of Python (see pyffi.enabled). It runs with the fake clock of the time package (time.Sleep
+# doesn't wait, like in the Go playground), its output is collected and
+# os.ReadFile, os.WriteFile and os.Stat use the files given, not the disk (see
+# interp.Interpreter.files). The diagnostics are the dicts of
+# diagnostics.encode_json
+
+# the file of the program, in no directory of the disk
+path = os.path.join(os.sep, "playground", "prog.go")
+
+
+def reset(source: str):
+    """Forgets the programs checked before, source is the one of prog.go"""
+    diagnostics.clear()
+    go_parser.parse_errors = 0
+    syntree.type_refs.clear()
+    utils.overlays[path] = source
+    pyffi.enabled = False
+
+
+def reported() -> List[dict]:
+    return [d.to_dict() for d in diagnostics.reported]
+
+
+@contextlib.contextmanager
+def quiet():
+    """Nothing is printed in the block, the diagnostics are only kept"""
+    printing, diagnostics.printing = diagnostics.printing, False
+    try:
+        with contextlib.redirect_stdout(io.StringIO()):
+            yield
+    finally:
+        diagnostics.printing = printing
+
+
+def load(source: str, warnings: bool = False,
+         ctx: Optional[cancel.Context] = None) -> Tuple[list, checker.Info]:
+    """The packages of the program checked, with the Info of its expressions.
+    Raises the error of ctx if it is done before the end"""
+    reset(source)
+    info = checker.Info()
+    with quiet():
+        packages = go_parser.check_program(path, verbose=False, info=info, warnings=warnings,
+                                           ctx=ctx)
+    return packages, info
+
+
+def failed(packages: list) -> bool:
+    return not packages or bool(diagnostics.errors()) or go_parser.parse_errors > 0
+
+
+def parse(source: str) -> Dict[str, Any]:
+    """The AST of the program (see astdump.to_dict), None if the parser
+    can't make one, and the syntax errors"""
+    import astdump
+    import loader
+    reset(source)
+    file = None
+    with quiet():
+        packages = loader.load(path)
+        for package in packages:
+            go_parser.parse_package(package, package is not packages[-1])
+        if packages:
+            file = next((node for node in packages[-1].ast.children
+                         if isinstance(node, syntree.File)), None)
+    return {"ast": astdump.to_dict(file) if file is not None else None,
+            "diagnostics": reported()}
+
+
+def check(source: str, warnings: bool = False) -> Dict[str, Any]:
+    """The diagnostics of the program, with its warnings if warnings"""
+    load(source, warnings)
+    return {"diagnostics": reported()}
+
+
+def format(source: str) -> Dict[str, Any]:
+    """The source formatted like gofmt does, None if it has syntax errors"""
+    import printer
+    from fileset import fset
+    packages, _ = load(source)
+    if not packages or go_parser.parse_errors:
+        return {"source": None, "diagnostics": reported()}
+    package = packages[-1]
+    node = next(node for node in package.ast.children if isinstance(node, syntree.File))
+    file = next(f for f in reversed(fset.files) if f.name == path)
+    try:
+        formatted = printer.format_file(node, file, source, package.name)
+    except printer.FormatError as e:
+        return {"source": None, "diagnostics": reported(), "error": str(e)}
+    return {"source": formatted, "diagnostics": reported()}
+
+
+def run(source: str, stdin: str = "", args: Optional[List[str]] = None,
+        engine: str = "interp", files: Optional[Dict[str, str]] = None,
+        timeout: Optional[float] = 10.0, max_steps: Optional[int] = 10_000_000,
+        max_heap: Optional[int] = None, max_output: Optional[int] = None,
+        max_goroutines: Optional[int] = None) -> Dict[str, Any]:
+    """Runs the program with the interpreter (or the VM if engine is vm),
+    with stdin as its standard input, args as os.Args[1:] and files as
+    the ones it reads and writes (by name, their contents as text). The
+    check and the run are aborted after timeout seconds, and the run
+    after max_steps steps (see interp.Interpreter.step), None for no limit.
+    It runs in the sandbox of sandbox.default, with the files given:
+    it is aborted once it allocated more than max_heap bytes, before it
+    writes more than max_output bytes and once it has more than
+    max_goroutines goroutines, the ones of the sandbox if they are None
+
+    The reply has what it printed to stdout and to stderr, its exit
+    status (1 if it has errors or is aborted, 2 if it panics), its
+    diagnostics and the files afterwards"""
+    import vm
+    # calls nest a few python frames for each Go frame
+    sys.setrecursionlimit(max(sys.getrecursionlimit(), 20000))
+    ctx = None
+    if timeout is not None:
+        ctx = cancel.with_timeout(cancel.background(), timeout)
+    try:
+        packages, info = load(source, ctx=ctx)
+    except cancel.ContextError as e:
+        return {"stdout": "", "stderr": f"gopy: {e}\n", "status": 1,
+                "diagnostics": reported(), "files": files or {}}
+    if not failed(packages):
+        with contextlib.redirect_stdout(io.StringIO()):
+            go_parser.main_package(packages)
+    if failed(packages):
+        return {"stdout": "", "stderr": "", "status": 1, "diagnostics": reported(),
+                "files": files or {}}
+    machine = (vm.VM if engine == "vm" else interp.Interpreter)(
+        info, io.StringIO(), ["prog"] + list(args or []), interp.FakeClock())
+    machine.err = io.StringIO()
+    machine.stdin = io.BytesIO(encode(stdin))
+    # the strings of the interpreter are bytes, the names of the files too
+    machine.files = {encode(name): encode(text) for name, text in (files or {}).items()}
+    machine.ctx = ctx
+    machine.max_steps = max_steps
+    machine.limits = sandbox.default()
+    machine.limits.syscalls |= sandbox.files
+    if max_heap is not None:
+        machine.limits.heap = max_heap
+    if max_output is not None:
+        machine.limits.output = max_output
+    if max_goroutines is not None:
+        machine.limits.goroutines = max_goroutines
+    try:
+        status = machine.run_program(packages)
+    except (interp.Unsupported, interp.Aborted, cancel.ContextError) as e:
+        print(f"gopy: {e}", file=machine.err)
+        status = 1
+    except MemoryError:
+        # a value too large for Python, built before it is counted
+        print(f"gopy: the program allocated more than {machine.limits.heap} bytes",
+              file=machine.err)
+        status = 1
+    return {
+        "stdout": machine.out.getvalue(),
+        "stderr": machine.err.getvalue(),
+        "status": status,
+        "diagnostics": reported(),
+        "files": {decode(name): decode(data) for name, data in machine.files.items()},
+    }
+
+
+def encode(text: str) -> bytes:
+    return text.encode("utf-8", "surrogateescape")
+
+
+def decode(data: bytes) -> str:
+    return data.decode("utf-8", "surrogateescape")
+
+
+methods = {"parse": parse, "check": check, "format": format, "run": run}
+
+
+def handle(request: str) -> str:
+    """Calls the method of the request, a JSON object with the method and
+    its arguments, like {"method": "check", "source": "...", "warnings":
+    true}, and returns its reply as JSON. A request which isn't valid gets
+    {"error": message}"""
+    try:
+        params = json.loads(request)
+        if not isinstance(params, dict):
+            raise ValueError("the request is not an object")
+        method = methods[params.pop("method")]
+        inspect.signature(method).bind(**params)
+    except (ValueError, KeyError, TypeError, AttributeError) as e:
+        return json.dumps({"error": f"invalid request: {e!r}"})
+    return json.dumps(method(**params))
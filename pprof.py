@@ -0,0 +1,238 @@
+import sys
+import gzip
+import time
+import threading
+
+import checker
+import fileset
+import interp
+import vm
+
+from typing import Any, Dict, List, Optional, Tuple
+
+
+# The profiles of a program run by the interpreter or the VM (the flags
+# -cpuprofile and -memprofile of go_parser.py run and test), written in the
+# format of runtime/pprof, a gzipped profile.proto, which go tool pprof
+# reads. Their samples are stacks of the Go functions of the program (the
+# Frames of the interpreter), with the line each one is at, not the ones of
+# the python functions running them:
+#  - the CPU profile samples the stack every 10ms, from a thread reading
+#    the frames of the one running the program (without the samples of the
+#    program sleeping in time.Sleep), and its values are the number of
+#    samples and the time between them
+#  - the memory profile has every allocation Interpreter.allocate counts,
+#    with the number of objects and the bytes allocated. Unlike the heap
+#    profile of Go, it isn't sampled and it has no in use values, the
+#    interpreter doesn't know when the values are collected
+
+# the time between two samples of the CPU profile, in seconds
+period = 0.01
+
+# the python functions whose frames give the line of a Go function: the
+# statement run by the interpreter, the instruction run by the VM
+statement_code = interp.Interpreter.statement.__code__
+run_code_code = vm.VM.run_code.__code__
+sleep_codes = {interp.Clock.sleep.__code__, interp.FakeClock.sleep.__code__}
+
+# a stack of a sample, the functions and their lines, the innermost first
+Stack = Tuple[Tuple[Any, int], ...]
+
+
+class Profiler:
+    """Samples the stacks of a program while it runs, see start"""
+
+    def __init__(self, cpu: bool = False, memory: bool = False):
+        self.cpu = cpu
+        self.memory = memory
+        self.machine: Any = None
+        # the number of samples and their time in nanoseconds, by stack
+        self.samples: Dict[Stack, List[int]] = {}
+        # the objects and the bytes allocated, by stack
+        self.allocations: Dict[Stack, List[int]] = {}
+        self.start_time = 0
+        self.duration = 0
+        self.thread: Optional[threading.Thread] = None
+        self.stopped = threading.Event()
+
+    def start(self, machine: interp.Interpreter):
+        """Starts profiling the program the interpreter (or the VM) runs in
+        this thread"""
+        self.machine = machine
+        self.start_time = time.time_ns()
+        if self.memory:
+            machine.profiler = self
+        if self.cpu:
+            self.thread = threading.Thread(target=self.sample, args=(threading.get_ident(),),
+                                           daemon=True)
+            self.thread.start()
+
+    def stop(self):
+        self.duration = time.time_ns() - self.start_time
+        self.machine.profiler = None
+        if self.thread is not None:
+            self.stopped.set()
+            self.thread.join()
+
+    def sample(self, thread: int):
+        """Samples the stack of the thread running the program until it stops"""
+        last = time.perf_counter_ns()
+        while not self.stopped.wait(period):
+            now = time.perf_counter_ns()
+            # the thread of the goroutine running, see sched.py
+            frame = sys._current_frames().get(self.machine.scheduler.current.thread or thread)
+            stack = self.stack(frame) if frame is not None else None
+            if stack:
+                counts = self.samples.setdefault(stack, [0, 0])
+                counts[0] += 1
+                counts[1] += now - last
+            last = now
+
+    def allocated(self, size: int):
+        """Called by the interpreter for each allocation of size bytes"""
+        stack = self.stack(sys._getframe(1))
+        if stack:
+            counts = self.allocations.setdefault(stack, [0, 0])
+            counts[0] += 1
+            counts[1] += size
+
+    def stack(self, frame) -> Optional[Stack]:
+        """The stack of the Go functions being run, frame is the python frame
+        running the innermost one. None if the program sleeps"""
+        frames = [f for f in list(self.machine.frames) if f.fn is not None]
+        if not frames:
+            return None
+        leaf = frames[-1].fn
+        first, last = fileset.fset.position(leaf.pos).line, fileset.fset.position(leaf.end).line
+        line = None
+        while frame is not None and line is None:
+            code = frame.f_code
+            if code in sleep_codes:
+                return None
+            if code is statement_code:
+                line = checker.statement_line(frame.f_locals.get("stmt"))
+                if line is not None and not first <= line <= last:
+                    line = None
+                    break
+            elif code is run_code_code:
+                # a function just called has no pc yet
+                locals_ = frame.f_locals
+                code, pc = locals_.get("code"), locals_.get("pc")
+                if code is None or code.node is not leaf or pc is None:
+                    break
+                line = code.lines[max(pc - 1, 0)]
+            frame = frame.f_back
+        stack = [(leaf, line or leaf.lineno)]
+        for f in reversed(frames[:-1]):
+            stack.append((f.fn, f.line or f.fn.lineno))
+        return tuple(stack)
+
+    # the profiles
+
+    def write_cpu(self, path: str):
+        """Writes the CPU profile to path"""
+        builder = Builder(self.machine.program)
+        builder.sample_types([("samples", "count"), ("cpu", "nanoseconds")])
+        builder.period("cpu", "nanoseconds", int(period * 1e9))
+        for stack, values in self.samples.items():
+            builder.sample(stack, values)
+        builder.write(path, self.start_time, self.duration)
+
+    def write_memory(self, path: str):
+        """Writes the memory profile to path"""
+        builder = Builder(self.machine.program)
+        builder.sample_types([("alloc_objects", "count"), ("alloc_space", "bytes")])
+        builder.period("space", "bytes", 1)
+        builder.default_type = builder.string("alloc_space")
+        for stack, values in self.allocations.items():
+            builder.sample(stack, values)
+        builder.write(path, self.start_time, self.duration)
+
+
+# profile.proto, written by hand: the fields of the messages are varints,
+# the embedded messages, the strings and the packed repeated fields are
+# bytes prefixed by their length
+
+def varint(n: int) -> bytes:
+    n &= (1 << 64) - 1
+    out = bytearray()
+    while n >= 0x80:
+        out.append(n & 0x7f | 0x80)
+        n >>= 7
+    out.append(n)
+    return bytes(out)
+
+
+def field(number: int, value: int) -> bytes:
+    return varint(number << 3) + varint(value)
+
+
+def field_bytes(number: int, data: bytes) -> bytes:
+    return varint(number << 3 | 2) + varint(len(data)) + data
+
+
+def packed(number: int, values: list) -> bytes:
+    return field_bytes(number, b"".join(varint(v) for v in values))
+
+
+class Builder:
+    """Builds a Profile message, the functions and the locations of the
+    samples are added as they come"""
+
+    def __init__(self, packages: list):
+        self.names = interp.program_function_names(packages)
+        self.strings: Dict[str, int] = {"": 0}
+        self.functions: Dict[int, int] = {}
+        self.locations: Dict[Tuple[int, int], int] = {}
+        self.messages: List[bytes] = []
+        self.default_type = 0
+
+    def string(self, s: str) -> int:
+        return self.strings.setdefault(s, len(self.strings))
+
+    def value_type(self, type_: str, unit: str) -> bytes:
+        return field(1, self.string(type_)) + field(2, self.string(unit))
+
+    def sample_types(self, types: List[Tuple[str, str]]):
+        for type_, unit in types:
+            self.messages.append(field_bytes(1, self.value_type(type_, unit)))
+
+    def period(self, type_: str, unit: str, period: int):
+        self.messages.append(field_bytes(11, self.value_type(type_, unit)))
+        self.messages.append(field(12, period))
+
+    def function(self, fn: Any) -> int:
+        if id(fn) not in self.functions:
+            self.functions[id(fn)] = len(self.functions) + 1
+            name = self.string(self.names.get(id(fn), "main.main"))
+            self.messages.append(field_bytes(5, (
+                field(1, self.functions[id(fn)]) + field(2, name) + field(3, name) +
+                field(4, self.string(fileset.fset.position(fn.pos).filename or "")) +
+                field(5, fn.lineno or 0)
+            )))
+        return self.functions[id(fn)]
+
+    def location(self, fn: Any, line: int) -> int:
+        key = (self.function(fn), line)
+        if key not in self.locations:
+            self.locations[key] = len(self.locations) + 1
+            self.messages.append(field_bytes(4, (
+                field(1, self.locations[key]) + field(2, 1) +
+                field_bytes(4, field(1, key[0]) + field(2, line))
+            )))
+        return self.locations[key]
+
+    def sample(self, stack: Stack, values: List[int]):
+        locations = [self.location(fn, line) for fn, line in stack]
+        self.messages.append(field_bytes(2, packed(1, locations) + packed(2, values)))
+
+    def write(self, path: str, start_time: int, duration: int):
+        # a single mapping, whose functions, files and lines are known
+        mapping = field_bytes(3, field(1, 1) + field(5, self.string("gopy")) +
+                              field(7, 1) + field(8, 1) + field(9, 1))
+        strings = b"".join(field_bytes(6, s.encode("utf-8", "surrogateescape"))
+                           for s in self.strings)
+        data = b"".join(self.messages) + mapping + strings + field(9, start_time) + field(
+            10, duration) + field(14, self.default_type)
+        with gzip.open(path, "wb") as f:
+            f.write(data)
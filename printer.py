@@ -0,0 +1,2378 @@
+import math
+
+import checker
+import syntree
+
+from fileset import NoPos
+from typing import Dict, List, Optional, Tuple
+
+
+# The printer prints a file back as Go source (see gopy fmt), formatted
+# like gofmt does it. It follows go/printer: the layout of the source (its
+# line breaks, blank lines and comments) is kept where gofmt keeps it, and
+# the columns of grouped declarations, fields and comments are aligned by a
+# text/tabwriter (see tabwrite). Positions of the tokens of the source which
+# the AST doesn't keep, like the ones of the operators, are found in it.
+# Ref: https://pkg.go.dev/go/printer
+
+
+class FormatError(Exception):
+    """What the printer can't print, like an undefined type (the AST
+    has the types, not their names in the source)"""
+
+
+class _Whitespace(str):
+    pass
+
+
+# whitespace between tokens, kept in a buffer until the next token, so that
+# comments can be interspersed. A vtab ends a cell of the tabwriter, a
+# formfeed is a line break which ends the columns aligned so far
+IGNORE = _Whitespace("")
+BLANK = _Whitespace(" ")
+VTAB = _Whitespace("\v")
+NEWLINE = _Whitespace("\n")
+FORMFEED = _Whitespace("\f")
+INDENT = _Whitespace(">")
+UNINDENT = _Whitespace("<")
+
+
+class _Mode(int):
+    pass
+
+
+# the modes of the printer, they are toggled
+NO_EXTRA_BLANK = _Mode(1)
+NO_EXTRA_LINEBREAK = _Mode(2)
+
+
+class _Ident(str):
+    pass
+
+
+class _Lit(str):
+    pass
+
+
+# the most line breaks kept between two items (a blank line)
+MAX_NEWLINES = 2
+INFINITY = 1 << 30
+
+# the modes of exprList
+COMMA_TERM = 1
+NO_INDENT = 2
+
+LOWEST_PREC = 0
+UNARY_PREC = 6
+HIGHEST_PREC = 7
+
+precedences = {
+    "||": 1, "&&": 2,
+    "==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+    "+": 4, "-": 4, "|": 4, "^": 4,
+    "*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5, "&^": 5,
+}
+
+# tokens ending a statement if a line break follows them
+implied_semi_tokens = {"break", "continue", "fallthrough", "return", "++", "--", ")", "]", "}"}
+
+# (offset, line, column) of the source, the line is 0 if it is unknown
+Position = Tuple[int, int, int]
+INVALID: Position = (0, 0, 0)
+
+# the tabwriter doesn't look into the text between two of them
+ESCAPE = "￾"
+
+
+def nlimit(n: int) -> int:
+    return min(n, MAX_NEWLINES)
+
+
+def may_combine(prev: str, next_: str) -> bool:
+    """If the token prev and a token starting with next_ would be read
+    as another token without a blank between them, like - -"""
+    return next_ in {"INT": ".", "+": "+", "-": "-", "/": "*", "<": "-<", "&": "&^"}.get(prev, "")
+
+
+def leading_space(line: str) -> str:
+    return line[:len(line) - len(line.lstrip(" \t"))]
+
+
+def indented(line: str) -> bool:
+    return line != "" and line[0] in " \t"
+
+
+def unindent(lines: list) -> list:
+    """The lines without the blank ones around them and without the
+    indentation they have in common, blank lines are empty"""
+    while lines and not lines[0].strip():
+        lines = lines[1:]
+    while lines and not lines[-1].strip():
+        lines = lines[:-1]
+    if not lines:
+        return []
+    prefix = leading_space(lines[0])
+    for line in lines[1:]:
+        if line.strip():
+            space = leading_space(line)
+            i = 0
+            while i < len(prefix) and i < len(space) and prefix[i] == space[i]:
+                i += 1
+            prefix = prefix[:i]
+    return [line[len(prefix):] if line.strip() else "" for line in lines]
+
+
+def list_marker(line: str) -> Optional[Tuple[str, str]]:
+    """The number (empty for a bullet) of an item of a list and the text
+    after its marker, None if the line doesn't start an item"""
+    line = line.strip()
+    if not line:
+        return None
+    if line[0] in "•*+-":
+        number, rest = "", line[1:]
+    elif line[0].isdigit() and line[0] < "\x80":
+        n = 1
+        while n < len(line) and "0" <= line[n] <= "9":
+            n += 1
+        if n >= len(line) or line[n] not in ".)":
+            return None
+        number, rest = line[:n], line[n + 1:]
+    else:
+        return None
+    if not indented(rest) or not rest.strip():
+        return None
+    return number, rest
+
+
+def is_list(line: str) -> bool:
+    return list_marker(line) is not None
+
+
+def is_heading(line: str) -> bool:
+    return len(line) >= 2 and line[0] == "#" and line[1] in " \t" and line.strip() != "#"
+
+
+def is_old_heading(line: str, lines: list, i: int) -> bool:
+    """If a line is a heading like go/doc recognized them before # headings:
+    an upper case line of its own, without punctuation"""
+    if i <= 0 or lines[i - 1] != "" or i + 2 >= len(lines) or lines[i + 1] != "" or leading_space(lines[i + 2]):
+        return False
+    line = line.strip()
+    if not (line[0].isalpha() and line[0].isupper()) or not line[-1].isalnum():
+        return False
+    if any(ch in line for ch in ';:!?+*/=[]{}_^°&§~%#@<">\\'):
+        return False
+    rest = line
+    while "'" in rest:
+        rest = rest.split("'", 1)[1]
+        if rest != "s" and not rest.startswith("s "):
+            return False
+    rest = line
+    while "." in rest:
+        rest = rest.split(".", 1)[1]
+        if rest == "" or rest.startswith(" "):
+            return False
+    return True
+
+
+def doc_spans(lines: list) -> list:
+    """The (start, end, kind) of the blocks of the lines of a doc comment,
+    like go/doc/comment finds them: paragraphs, headings, code and lists"""
+    spans = []
+    i = 0
+    force_indent = 0
+    while True:
+        while i < len(lines) and lines[i] == "":
+            i += 1
+        if i >= len(lines):
+            break
+        start = i
+        if i < force_indent or indented(lines[i]):
+            # indented lines are code or a list, up to the next unindented one
+            unindented_list_ok = is_list(lines[i]) and i < force_indent
+            i += 1
+            while i < len(lines) and (lines[i] == "" or i < force_indent or indented(lines[i])
+                                      or (unindented_list_ok and is_list(lines[i]))):
+                if lines[i] == "":
+                    unindented_list_ok = False
+                i += 1
+            end = i
+            while end > start and lines[end - 1] == "":
+                end -= 1
+            # code followed by its closing brace, not indented
+            if end < len(lines) and lines[end].startswith("}"):
+                end += 1
+            kind = "list" if is_list(lines[start]) else "code"
+        else:
+            i += 1
+            while i < len(lines) and lines[i] != "" and not indented(lines[i]):
+                i += 1
+            end = i
+            if i < len(lines) and lines[i] != "" and not is_list(lines[i]):
+                # the last lines may be the first one of misindented code or list
+                if is_list(lines[i - 1]):
+                    force_indent = end
+                    end -= 1
+                    while end > start and is_list(lines[end - 1]):
+                        end -= 1
+                elif lines[i - 1].endswith(("{", "\\")):
+                    force_indent = end
+                    end -= 1
+                if start == end and force_indent > start:
+                    i = start
+                    continue
+            if end - start == 1 and is_heading(lines[start]):
+                kind = "heading"
+            elif end - start == 1 and is_old_heading(lines[start], lines, start):
+                kind = "old heading"
+            else:
+                kind = "paragraph"
+        spans.append((start, end, kind))
+        i = end
+    return spans
+
+
+def doc_list(lines: list, before_blank: bool) -> Tuple[list, bool, bool]:
+    """The items of a list, each one the paragraphs (lists of lines) of its
+    text, if they are printed with blank lines between them and if one
+    is printed before the list"""
+    marker = list_marker(lines[0])
+    numbered = marker is not None and marker[0] != ""
+    items: list = []
+    text: list = []
+    blank_between = False
+
+    def _flush():
+        nonlocal text
+        if items and text:
+            items[-1][1].append(text)
+        text = []
+
+    for line in lines:
+        marker = list_marker(line)
+        if marker is not None and (marker[0] != "") == numbered:
+            _flush()
+            items.append((marker[0], []))
+            line = marker[1]
+        line = line.strip()
+        if not line:
+            blank_between = True
+            _flush()
+            continue
+        text.append(line)
+    _flush()
+    blank_between = blank_between or any(len(paragraphs) > 1 for _, paragraphs in items)
+    return items, blank_between, before_blank or blank_between
+
+
+def format_doc_text(text: str) -> str:
+    """The text of a doc comment formatted like gofmt does, see go/doc/comment"""
+    lines = unindent([line.rstrip(" \t") for line in text.split("\n")])
+    out: List[str] = []
+    prev_end = 0
+    for k, (start, end, kind) in enumerate(doc_spans(lines)):
+        blank_before = True
+        block: List[str] = []
+        if kind == "paragraph":
+            block = [line.strip() for line in lines[start:end]]
+        elif kind in ("heading", "old heading"):
+            heading = lines[start].strip()
+            block = [heading if kind == "heading" else "# " + heading]
+        elif kind == "code":
+            block = ["\t" + line if line else "" for line in unindent(lines[start:end])]
+        else:
+            items, loose, blank_before = doc_list(lines[start:end], prev_end < start)
+            for i, (number, paragraphs) in enumerate(items):
+                if i > 0 and loose:
+                    block.append("")
+                prefix = "  - " if number == "" else f" {number}. "
+                for j, paragraph in enumerate(paragraphs):
+                    if j > 0:
+                        block.append("")
+                    for n, line in enumerate(paragraph):
+                        block.append((prefix if j == 0 and n == 0 else "    ") + line)
+        if k > 0 and blank_before:
+            out.append("")
+        out.extend(block)
+        prev_end = end
+    return "".join(line + "\n" for line in out)
+
+
+def format_doc_comment(comments: list) -> list:
+    """The (pos, text) of a doc comment formatted like gofmt does, the
+    directives (like //go:generate) are moved after its text"""
+    pos, first = comments[0]
+    directives = []
+    if len(comments) == 1 and first.startswith("/*"):
+        lines = first.split("\n")
+        if len(lines) == 1 or all(line.strip().startswith("*") for line in lines[1:]):
+            return comments
+        text = first[2:-2]
+    elif first.startswith("//"):
+        text = ""
+        for comment in comments:
+            if not comment[1].startswith("//"):
+                return comments
+            after = comment[1][2:]
+            if syntree.is_directive(after):
+                directives.append(comment)
+                continue
+            text += (after[1:] if after.startswith(" ") else after) + "\n"
+        if first.startswith("/*"):
+            return comments
+    else:
+        return comments
+    if not text:
+        return comments
+
+    formatted = format_doc_text(text)
+    if first.startswith("/*"):
+        return [(pos, "/*\n" + formatted + "*/")]
+    out = []
+    for line in formatted.split("\n")[:-1]:
+        if line == "":
+            line = "//"
+        elif line.startswith("\t"):
+            line = "//" + line
+        else:
+            line = "// " + line
+        out.append((pos, line))
+    if directives:
+        out.append((pos, "//"))
+        out.extend((pos, text) for _, text in directives)
+    return out
+
+
+class _Cell:
+    __slots__ = ("text", "width", "htab")
+
+    def __init__(self, text: str, width: int, htab: bool):
+        self.text = text
+        self.width = width
+        self.htab = htab
+
+
+class TabWriter:
+    """A text/tabwriter, with the settings of go/printer (tabs of 8 columns,
+    cells padded with one blank, empty columns discarded and leading empty
+    cells padded with tabs). A cell ends with a tab (or a soft vtab), a
+    line with a newline, a formfeed also ends the columns aligned so far.
+    The text between two ESCAPEs is in a cell as it is"""
+
+    def __init__(self):
+        self.out: List[str] = []
+        self.lines: List[List[_Cell]] = [[]]
+        self.cell = ""
+        self.widths: List[int] = []
+
+    def write(self, text: str):
+        escaped = False
+        for segment in text.split(ESCAPE):
+            if escaped:
+                self.cell += ESCAPE + segment + ESCAPE
+            else:
+                start = 0
+                for i, ch in enumerate(segment):
+                    if ch not in "\t\v\n\f":
+                        continue
+                    self.cell += segment[start:i]
+                    start = i + 1
+                    ncells = self.terminate_cell(ch == "\t")
+                    if ch in "\n\f":
+                        self.lines.append([])
+                        if ch == "\f" or ncells == 1:
+                            # a line with one cell isn't in a column
+                            self.flush()
+                self.cell += segment[start:]
+            escaped = not escaped
+
+    def terminate_cell(self, htab: bool) -> int:
+        line = self.lines[-1]
+        line.append(_Cell(self.cell, len(self.cell.replace(ESCAPE, "")), htab))
+        self.cell = ""
+        return len(line)
+
+    def flush(self) -> str:
+        if self.cell:
+            self.terminate_cell(False)
+        self.format(0, len(self.lines))
+        self.lines = [[]]
+        return "".join(self.out)
+
+    def format(self, line0: int, line1: int):
+        column = len(self.widths)
+        this = line0
+        while this < line1:
+            if column >= len(self.lines[this]) - 1:
+                this += 1
+                continue
+            # a block of the lines with a cell in the column
+            self.write_lines(line0, this)
+            line0 = this
+            width, discardable = 0, True
+            while this < line1 and column < len(self.lines[this]) - 1:
+                cell = self.lines[this][column]
+                width = max(width, cell.width + 1)
+                if cell.width > 0 or cell.htab:
+                    discardable = False
+                this += 1
+            if discardable:
+                width = 0
+            self.widths.append(width)
+            self.format(line0, this)
+            self.widths.pop()
+            line0 = this
+        self.write_lines(line0, line1)
+
+    def write_lines(self, line0: int, line1: int):
+        for i in range(line0, line1):
+            use_tabs = True
+            for j, cell in enumerate(self.lines[i]):
+                if not cell.text:
+                    if j < len(self.widths):
+                        self.pad(cell.width, self.widths[j], use_tabs)
+                    continue
+                use_tabs = False
+                self.out.append(cell.text)
+                if j < len(self.widths):
+                    self.pad(cell.width, self.widths[j], False)
+            if i + 1 == len(self.lines):
+                # the last line has the text of the cell not ended yet
+                self.out.append(self.cell)
+                self.cell = ""
+            else:
+                self.out.append("\n")
+
+    def pad(self, textw: int, cellw: int, use_tabs: bool):
+        if use_tabs:
+            # the indentation of a line, in tabs
+            cellw = (cellw + 7) // 8 * 8
+            self.out.append("\t" * ((cellw - textw + 7) // 8))
+        else:
+            self.out.append(" " * (cellw - textw))
+
+
+def trim(text: str) -> str:
+    """The text without the ESCAPEs and the blanks at the end of its lines
+    (but not the ones of raw strings), vtabs are tabs"""
+    out: List[str] = []
+    space: List[str] = []
+    escaped = False
+    for segment in text.split(ESCAPE):
+        if escaped:
+            out.extend(space)
+            space = []
+            out.append(segment)
+        else:
+            for ch in segment:
+                if ch in " \t\v":
+                    space.append("\t" if ch == "\v" else ch)
+                elif ch in "\n\f":
+                    space = []
+                    out.append("\n")
+                else:
+                    out.extend(space)
+                    space = []
+                    out.append(ch)
+        escaped = not escaped
+    return "".join(out)
+
+
+def is_blank(s: str) -> bool:
+    return all(ch <= " " for ch in s)
+
+
+def common_prefix(a: str, b: str) -> str:
+    i = 0
+    while i < len(a) and i < len(b) and a[i] == b[i] and (a[i] <= " " or a[i] == "*"):
+        i += 1
+    return a[:i]
+
+
+def strip_common_prefix(lines: list):
+    """Removes the indentation the lines of a /*-style comment have in
+    common, like go/printer does (with a line of stars on the left too)"""
+    if len(lines) <= 1:
+        return
+    prefix, prefix_set = "", False
+    if len(lines) > 2:
+        for i in range(1, len(lines) - 1):
+            if is_blank(lines[i]):
+                lines[i] = ""
+            else:
+                if not prefix_set:
+                    prefix, prefix_set = lines[i], True
+                prefix = common_prefix(prefix, lines[i])
+    if not prefix_set:
+        prefix = common_prefix(lines[-1], lines[-1])
+
+    line_of_stars = False
+    if "*" in prefix:
+        prefix = prefix[:prefix.index("*")]
+        if prefix.endswith(" "):
+            prefix = prefix[:-1]
+        line_of_stars = True
+    else:
+        first = lines[0]
+        if is_blank(first[2:]):
+            i = len(prefix)
+            n = 0
+            while n < 3 and i > 0 and prefix[i - 1] == " ":
+                i -= 1
+                n += 1
+            if i == len(prefix) and i > 0 and prefix[i - 1] == "\t":
+                i -= 1
+            prefix = prefix[:i]
+        else:
+            n = 2
+            while n < len(first) and first[n] <= " ":
+                n += 1
+            if n > 2 and first[2] == "\t":
+                suffix = first[2:n]
+            else:
+                suffix = "  " + first[2:n]
+            if prefix.endswith(suffix):
+                prefix = prefix[:len(prefix) - len(suffix)]
+
+    last = lines[-1]
+    closing = "*/"
+    before = last[:last.index(closing)] if closing in last else last
+    if is_blank(before):
+        if line_of_stars:
+            closing = " */"
+        lines[-1] = prefix + closing
+    else:
+        prefix = common_prefix(prefix, last)
+
+    for i in range(1, len(lines)):
+        if lines[i] != "":
+            lines[i] = lines[i][len(prefix):]
+
+
+class Printer:
+    """Prints the nodes of a file, see format_file. The output is the
+    input of the tabwriter, sizes are the ones of nodes printed
+    on one line (see node_size), shared by the printers of a file"""
+
+    def __init__(self, file, source: str, groups: list, package: Optional[str],
+                 sizes: Dict[int, int]):
+        self.file = file
+        self.source = source
+        self.groups = groups
+        self.package = package
+        self.sizes = sizes
+        # the positions of the specs of sorted imports, see sort_imports
+        self.moved: Dict[int, int] = {}
+
+        self.output: List[str] = []
+        self.has_output = False
+        self.indent = 0
+        self.level = 0
+        self.mode = 0
+        self.implied_semi = False
+        self.last_tok = ""
+        self.prev_open = ""
+        self.wsbuf: List[str] = []
+        # the position of the next token in the source and the one after
+        # the last one written, the line and column of the output
+        self.pos: Position = (0, 1, 1)
+        self.last: Position = INVALID
+        self.out_line = 1
+        self.out_col = 1
+        self.line_ptr: Optional[list] = None
+
+        # the offsets the comments end at, by the ones they start at
+        self.comment_ends = {
+            self.offset(pos): self.offset(pos) + len(text) for g in groups for pos, text in g.comments
+        }
+        self.cindex = 0
+        self.comment: Optional[syntree.CommentGroup] = None
+        self.comment_offset = INFINITY
+        self.comment_newline = False
+        self.next_comment()
+
+    # positions
+
+    def position(self, pos: int) -> Position:
+        if pos == NoPos or not self.file.base <= pos <= self.file.base + len(self.source):
+            return INVALID
+        p = self.file.position(pos)
+        return p.offset, p.line, p.column
+
+    def line_for(self, pos: int) -> int:
+        return self.position(pos)[1]
+
+    def offset(self, pos: int) -> int:
+        return self.file.offset(pos)
+
+    def find(self, token: str, start: int, end: int = NoPos) -> int:
+        """The position of the token in the source, from start
+        (and before end), NoPos if it isn't there"""
+        if start == NoPos:
+            return NoPos
+        stop = len(self.source) if end == NoPos else self.offset(end)
+        i = self.source.find(token, self.offset(start), stop)
+        return NoPos if i < 0 else self.file.pos(i)
+
+    def rfind(self, token: str, start: int, end: int) -> int:
+        """The position of the last token in the source before end"""
+        if end == NoPos:
+            return NoPos
+        lo = 0 if start == NoPos else self.offset(start)
+        i = self.source.rfind(token, lo, self.offset(end))
+        return NoPos if i < 0 else self.file.pos(i)
+
+    def ident_pos(self, lineno: Optional[int], col: Optional[int]) -> int:
+        if not lineno or not col or lineno > len(self.file.lines):
+            return NoPos
+        return self.file.line_start(lineno) + col - 1
+
+    def pos_of(self, node) -> int:
+        """The position of the first token of node, NoPos if it isn't known"""
+        if node is None:
+            return NoPos
+        if id(node) in self.moved:
+            return self.moved[id(node)]
+        if getattr(node, "_parens", False):
+            return self.rfind("(", NoPos, self.node_start(node))
+        return self.node_start(node)
+
+    def node_start(self, node) -> int:
+        if isinstance(node, (syntree.Spec, syntree.DeclGroup)):
+            return node.pos
+        if isinstance(node, syntree.Identifier):
+            return self.ident_pos(node.lineno, node.col_num)
+        if isinstance(node, tuple) or (isinstance(node, syntree.Type) and not has_span(node)):
+            return NoPos
+        if node.pos != NoPos:
+            return node.pos
+        if isinstance(node, syntree.TypeParam):
+            return self.ident_pos(node.lineno, node.col_num)
+        if isinstance(node, syntree.Type):
+            return NoPos
+        if isinstance(node, syntree.UnaryOp) and node.operator in ("++", "--"):
+            return self.pos_of(node.operand)
+        starts = [self.pos_of(child) for child in node.children]
+        starts = [pos for pos in starts if pos != NoPos]
+        return min(starts) if starts else NoPos
+
+    def end_of(self, node) -> int:
+        """The position after the last token of node, NoPos if it isn't known"""
+        if node is None or isinstance(node, tuple) or (isinstance(node, syntree.Type) and not has_span(node)):
+            return NoPos
+        if isinstance(node, (syntree.Spec, syntree.DeclGroup)):
+            return node.end
+        if isinstance(node, syntree.Identifier):
+            start = self.pos_of(node)
+            return NoPos if start == NoPos else start + len(node.ident_name)
+        end = node.end
+        if getattr(node, "_parens", False) and end != NoPos:
+            closing = self.find(")", end)
+            return NoPos if closing == NoPos else closing + 1
+        if end != NoPos:
+            return end
+        if isinstance(node, syntree.TypeParam):
+            start = self.ident_pos(node.lineno, node.col_num)
+            return NoPos if start == NoPos else start + len(node.typename)
+        if isinstance(node, syntree.Type):
+            return NoPos
+        ends = [self.end_of(child) for child in node.children]
+        ends = [pos for pos in ends if pos != NoPos]
+        return max(ends) if ends else NoPos
+
+    # the output
+
+    def next_comment(self):
+        while self.cindex < len(self.groups):
+            group = self.groups[self.cindex]
+            self.cindex += 1
+            self.comment = group
+            self.comment_offset = self.offset(group.pos)
+            self.comment_newline = len(group.comments) > 1 or \
+                any("\n" in text or text.startswith("//") for _, text in group.comments)
+            return
+        self.comment = None
+        self.comment_offset = INFINITY
+
+    def comment_before(self, next_: Position) -> bool:
+        return self.comment_offset < next_[0] and (not self.implied_semi or not self.comment_newline)
+
+    def comment_size_before(self, next_: Position) -> int:
+        saved = self.cindex, self.comment, self.comment_offset, self.comment_newline
+        size = 0
+        while self.comment_before(next_):
+            size += sum(len(text) for _, text in self.comment.comments)
+            self.next_comment()
+        self.cindex, self.comment, self.comment_offset, self.comment_newline = saved
+        return size
+
+    def write_indent(self):
+        n = self.indent
+        self.output.append("\t" * n)
+        offset, line, column = self.pos
+        self.pos = (offset + n, line, column + n)
+        self.out_col += n
+
+    def write_byte(self, ch: str, n: int):
+        if self.out_col == 1:
+            self.write_indent()
+        self.output.append(ch * n)
+        self.has_output = True
+        offset, line, column = self.pos
+        if ch in "\n\f":
+            self.pos = (offset + n, line + n, 1)
+            self.out_line += n
+            self.out_col = 1
+            return
+        self.pos = (offset + n, line, column + n)
+        self.out_col += n
+
+    def write_string(self, pos: Position, s: str, is_lit: bool):
+        if self.out_col == 1:
+            self.write_indent()
+        if pos[1] > 0:
+            self.pos = pos
+        self.output.append(ESCAPE + s + ESCAPE if is_lit else s)
+        self.has_output = True
+        offset, line, column = self.pos
+        nlines = s.count("\n")
+        if nlines:
+            column = len(s) - s.rindex("\n")
+            self.pos = (offset + len(s), line + nlines, column)
+            self.out_line += nlines
+            self.out_col = column
+        else:
+            self.pos = (offset + len(s), line, column + len(s))
+            self.out_col += len(s)
+        self.last = self.pos
+
+    def write_whitespace(self, n: int):
+        i = 0
+        while i < n:
+            ch = self.wsbuf[i]
+            if ch == IGNORE:
+                pass
+            elif ch == INDENT:
+                self.indent += 1
+            elif ch == UNINDENT:
+                self.indent = max(self.indent - 1, 0)
+            elif ch in (NEWLINE, FORMFEED) and i + 1 < n and self.wsbuf[i + 1] == UNINDENT:
+                # a line break followed by an unindent is swapped with
+                # it, the formfeed ends the section before the label
+                self.wsbuf[i], self.wsbuf[i + 1] = UNINDENT, FORMFEED
+                continue
+            else:
+                self.write_byte(str(ch), 1)
+            i += 1
+        self.wsbuf = self.wsbuf[n:]
+
+    def write_comment_prefix(self, pos: Position, next_: Position, prev: Optional[str], tok: str):
+        if not self.has_output:
+            # the comment is the first thing printed
+            return
+
+        if pos[1] == self.last[1] and (prev is None or prev[1] != "/"):
+            # the comment is on the line of the last token
+            has_sep = False
+            if prev is None:
+                j = 0
+                for i, ch in enumerate(self.wsbuf):
+                    if ch == BLANK:
+                        self.wsbuf[i] = IGNORE
+                        continue
+                    if ch == VTAB:
+                        has_sep = True
+                        continue
+                    if ch == INDENT:
+                        continue
+                    j = i
+                    break
+                self.write_whitespace(j)
+            if not has_sep:
+                # a blank before a /*-style comment followed by a token
+                self.write_byte(" " if pos[1] == next_[1] else "\t", 1)
+            return
+
+        # the comment is on a line of its own
+        dropped_linebreak = False
+        j = 0
+        for i, ch in enumerate(self.wsbuf):
+            if ch in (BLANK, VTAB):
+                self.wsbuf[i] = IGNORE
+                continue
+            if ch == INDENT:
+                continue
+            if ch == UNINDENT:
+                if i + 1 < len(self.wsbuf) and self.wsbuf[i + 1] == UNINDENT:
+                    continue
+                if tok != "}" and pos[2] == next_[2]:
+                    continue
+            elif ch in (NEWLINE, FORMFEED):
+                self.wsbuf[i] = IGNORE
+                dropped_linebreak = prev is None
+            j = i
+            break
+        self.write_whitespace(j)
+
+        n = 0
+        if pos[1] > 0 and self.last[1] > 0:
+            n = max(pos[1] - self.last[1], 0)
+        # a blank line before a comment at the package level is kept
+        if self.indent == 0 and dropped_linebreak:
+            n += 1
+        if n == 0 and prev is not None and prev[1] == "/":
+            n = 1
+        if n > 0:
+            self.write_byte("\f", nlimit(n))
+
+    def write_comment(self, pos: Position, text: str):
+        if text[1] == "/":
+            self.write_string(pos, text.rstrip(), True)
+            return
+        # /*-style comments are printed line by line, the lines are indented
+        lines = text.split("\n")
+        if pos[1] > 0 and pos[2] == 1 and self.indent > 0:
+            lines[1:] = ["   " + line for line in lines[1:]]
+        strip_common_prefix(lines)
+        for i, line in enumerate(lines):
+            if i > 0:
+                self.write_byte("\f", 1)
+                pos = self.pos
+            if line:
+                self.write_string(pos, line.rstrip(), True)
+
+    def write_comment_suffix(self, needs_linebreak: bool) -> Tuple[bool, bool]:
+        wrote_newline = dropped_ff = False
+        for i, ch in enumerate(self.wsbuf):
+            if ch in (BLANK, VTAB):
+                self.wsbuf[i] = IGNORE
+            elif ch in (NEWLINE, FORMFEED):
+                # one line break is kept if it is needed
+                if needs_linebreak:
+                    needs_linebreak = False
+                    wrote_newline = True
+                else:
+                    if ch == FORMFEED:
+                        dropped_ff = True
+                    self.wsbuf[i] = IGNORE
+        self.write_whitespace(len(self.wsbuf))
+        if needs_linebreak:
+            self.write_byte("\n", 1)
+            wrote_newline = True
+        return wrote_newline, dropped_ff
+
+    def intersperse_comments(self, next_: Position, tok: str) -> Tuple[bool, bool]:
+        last: Optional[Tuple[int, str]] = None
+        while self.comment_before(next_):
+            comments = original = self.comment.comments
+            if (self.last_tok != "import" and self.position(self.comment.pos)[2] == 1
+                    and self.offset(self.comment.end) + 1 == next_[0]):
+                # a comment at the start of the line before the next
+                # token is a doc comment, like the one of a declaration
+                comments = format_doc_comment(comments)
+            for pos, text in comments:
+                position = self.position(pos)
+                self.write_comment_prefix(position, next_, None if last is None else last[1], tok)
+                self.write_comment(position, text)
+                last = (pos, text)
+            if comments is not original:
+                # the comments written end where the comment group does
+                last = self.comment.comments[-1]
+                self.pos = self.last = self.position(self.comment.end)
+            self.next_comment()
+
+        needs_linebreak = False
+        text = last[1]
+        if (not self.mode & NO_EXTRA_BLANK and text[1] == "*"
+                and self.line_for(last[0]) == next_[1] and tok != ","
+                and (tok != ")" or self.prev_open == "(")
+                and (tok != "]" or self.prev_open == "[")):
+            if (any(ch in (NEWLINE, FORMFEED) for ch in self.wsbuf)
+                    and not self.mode & NO_EXTRA_LINEBREAK and self.level == 0):
+                needs_linebreak = True
+            else:
+                self.write_byte(" ", 1)
+        # a line break after a //-style comment, before the end
+        # of the file and before a } (unless it is disabled)
+        if text[1] == "/" or tok == "EOF" or (tok == "}" and not self.mode & NO_EXTRA_LINEBREAK):
+            needs_linebreak = True
+        return self.write_comment_suffix(needs_linebreak)
+
+    def flush(self, next_: Position, tok: str) -> Tuple[bool, bool]:
+        if self.comment_before(next_):
+            return self.intersperse_comments(next_, tok)
+        self.write_whitespace(len(self.wsbuf))
+        return False, False
+
+    def print(self, *args):
+        """Prints tokens (strings), identifiers (_Ident), literals (_Lit),
+        whitespace and modes. A position is the one of the next token"""
+        for arg in args:
+            if self.last_tok in ("(", "["):
+                self.prev_open = self.last_tok
+            elif self.last_tok != "":
+                self.prev_open = ""
+
+            if isinstance(arg, _Mode):
+                self.mode ^= arg
+                continue
+            if isinstance(arg, _Whitespace):
+                if arg == IGNORE:
+                    continue
+                self.wsbuf.append(arg)
+                if arg in (NEWLINE, FORMFEED):
+                    self.implied_semi = False
+                self.last_tok = ""
+                continue
+            if isinstance(arg, int):
+                position = self.position(arg)
+                if position[1] > 0:
+                    self.pos = position
+                continue
+
+            is_lit = False
+            if isinstance(arg, _Ident):
+                implied_semi = True
+                self.last_tok = "IDENT"
+            elif isinstance(arg, _Lit):
+                implied_semi = is_lit = True
+                self.last_tok = "INT" if arg.isdigit() else "LIT"
+            else:
+                if may_combine(self.last_tok, arg[0]):
+                    self.wsbuf = [BLANK]
+                implied_semi = arg in implied_semi_tokens
+                self.last_tok = arg
+
+            next_ = self.pos
+            wrote_newline, dropped_ff = self.flush(next_, self.last_tok)
+            # the line breaks of the source between the tokens are kept,
+            # unless they would end the statement
+            if not self.implied_semi:
+                n = nlimit(next_[1] - self.pos[1])
+                if wrote_newline and n == MAX_NEWLINES:
+                    n = MAX_NEWLINES - 1
+                if n > 0:
+                    self.write_byte("\f" if dropped_ff else "\n", n)
+                    implied_semi = False
+
+            if self.line_ptr is not None:
+                self.line_ptr[0] = self.out_line
+                self.line_ptr = None
+            self.write_string(next_, str(arg), is_lit)
+            self.implied_semi = implied_semi
+
+    def set_pos(self, pos: int):
+        self.print(pos)
+
+    def record_line(self, line: list):
+        self.line_ptr = line
+
+    def lines_from(self, line: list) -> int:
+        return self.out_line - line[0]
+
+    def linebreak(self, line: int, min_: int, ws: str, new_section: bool) -> int:
+        """Prints the line breaks before the token on the line of the
+        source (at least min_), the first one is a formfeed for a new
+        section. The number of them printed"""
+        n = max(nlimit(line - self.pos[1]), min_)
+        nbreaks = 0
+        if n > 0:
+            self.print(ws)
+            if new_section:
+                self.print(FORMFEED)
+                n -= 1
+                nbreaks = 2
+            nbreaks += n
+            for _ in range(n):
+                self.print(NEWLINE)
+        return nbreaks
+
+    def finish(self) -> str:
+        self.implied_semi = False
+        self.flush((INFINITY, INFINITY, 0), "EOF")
+        return "".join(self.output)
+
+    # sizes
+
+    def node_size(self, node, max_size: int) -> int:
+        """The size of node printed on one line, more than max_size
+        if it is bigger or can't be printed on one line"""
+        key = id(node)
+        if key in self.sizes:
+            return self.sizes[key]
+        size = max_size + 1
+        self.sizes[key] = size
+        printer = Printer(self.file, self.source, [], self.package, self.sizes)
+        printer.moved = self.moved
+        if is_statement(node):
+            printer.stmt(node, False)
+        else:
+            printer.expr(node)
+        text = trim(printer.finish()).rstrip(" \t")
+        if "\n" not in text and len(text.encode()) <= max_size:
+            size = len(text.encode())
+            self.sizes[key] = size
+        return size
+
+    def body_size(self, body: syntree.Block, stmts: list, max_size: int) -> int:
+        lbrace, rbrace = body.pos, body.end - 1
+        if lbrace != NoPos and self.line_for(lbrace) != self.line_for(rbrace):
+            # the braces are on different lines
+            return max_size + 1
+        if len(stmts) > 5:
+            return max_size + 1
+        size = self.comment_size_before(self.position(rbrace))
+        for i, stmt in enumerate(stmts):
+            if size > max_size:
+                break
+            if i > 0:
+                size += 2
+            size += self.node_size(stmt, max_size)
+        return size
+
+    def distance_from(self, start: int, start_col: int) -> int:
+        if start != NoPos and self.pos[1] > 0 and self.line_for(start) == self.pos[1]:
+            return self.out_col - start_col
+        return INFINITY
+
+    # lists
+
+    def expr_list(self, prev0: int, items: list, depth: int, mode: int, next0: int):
+        """Prints a list of expressions separated by commas, the line
+        breaks of the source between them are kept. prev0 and next0
+        are the positions of the tokens before and after the list"""
+        if not items:
+            return
+        prev, next_ = self.position(prev0), self.position(next0)
+        line = self.line_for(self.pos_of(items[0]))
+        end_line = self.line_for(self.end_of(items[-1]))
+
+        if prev[1] > 0 and prev[1] == line and line == end_line:
+            # all on one line
+            for i, x in enumerate(items):
+                if i > 0:
+                    self.set_pos(self.pos_of(x))
+                    self.print(",", BLANK)
+                self.expr0(x, depth)
+            return
+
+        ws = IGNORE if mode & NO_INDENT else INDENT
+        prev_break = -1
+        if prev[1] > 0 and prev[1] < line and self.linebreak(line, 0, ws, True) > 0:
+            ws = IGNORE
+            prev_break = 0
+
+        size = 0
+        lnsum, count = 0.0, 0
+        prev_line = prev[1]
+        for i, x in enumerate(items):
+            line = self.line_for(self.pos_of(x))
+            # a formfeed breaks the alignment of the keys of the elements
+            use_ff = True
+            prev_size = size
+            size = self.node_size(x, 1000000)
+            is_pair = isinstance(x, syntree.KeyedElement)
+            if size <= 1000000 and prev[1] > 0 and next_[1] > 0:
+                if is_pair:
+                    size = self.node_size(x.key, 1000000)
+            else:
+                size = 0
+
+            if prev_size > 0 and size > 0:
+                if count == 0 or prev_size <= 40 and size <= 40:
+                    use_ff = False
+                else:
+                    geomean = math.exp(lnsum / count)
+                    ratio = size / geomean
+                    use_ff = 2.5 * ratio <= 1 or 2.5 <= ratio
+
+            needs_linebreak = 0 < prev_line < line
+            if i > 0:
+                if not needs_linebreak:
+                    self.set_pos(self.pos_of(x))
+                self.print(",")
+                needs_blank = True
+                if needs_linebreak:
+                    nbreaks = self.linebreak(line, 0, ws, use_ff or prev_break + 1 < i)
+                    if nbreaks > 0:
+                        ws = IGNORE
+                        prev_break = i
+                        needs_blank = False
+                    if nbreaks > 1:
+                        lnsum, count = 0.0, 0
+                if needs_blank:
+                    self.print(BLANK)
+
+            if len(items) > 1 and is_pair and size > 0 and needs_linebreak:
+                # the values of keyed elements on their own lines are aligned
+                self.expr(x.key)
+                self.set_pos(self.find(":", self.end_of(x.key)))
+                self.print(":", VTAB)
+                self.expr(x.value)
+            else:
+                self.expr0(x, depth)
+
+            if size > 0:
+                lnsum += math.log(size)
+                count += 1
+            prev_line = self.line_for(self.end_of(x))
+
+        if mode & COMMA_TERM and next_[1] > 0 and self.pos[1] < next_[1]:
+            # a comma after the last one, if the next token is on another line
+            self.print(",")
+            if ws == IGNORE and not mode & NO_INDENT:
+                self.print(UNINDENT)
+            self.print(FORMFEED)
+            return
+        if ws == IGNORE and not mode & NO_INDENT:
+            self.print(UNINDENT)
+
+    def ident_list(self, idents: list, indent: bool):
+        self.expr_list(NoPos, idents, 1, 0 if indent else NO_INDENT, NoPos)
+
+    def indent_list(self, items: list) -> bool:
+        """If the results of a return are indented, if more than one of
+        them spans lines or one doesn't start where the previous one ends"""
+        if len(items) < 2:
+            return False
+        b = self.line_for(self.pos_of(items[0]))
+        e = self.line_for(self.end_of(items[-1]))
+        if not 0 < b < e:
+            return False
+        n = 0
+        line = b
+        for x in items:
+            xb = self.line_for(self.pos_of(x))
+            xe = self.line_for(self.end_of(x))
+            if line < xb:
+                return True
+            if xb < xe:
+                n += 1
+            line = xe
+        return n > 1
+
+    # types and signatures
+
+    def parameters(self, params: list, opening: int, closing: int, brackets: bool = False):
+        """Prints ParameterDecls (or the groups of TypeParams, for brackets)"""
+        self.set_pos(opening)
+        self.print("[" if brackets else "(")
+        if params:
+            prev_line = self.line_for(opening)
+            ws = INDENT
+            for i, (names, type_, vararg) in enumerate(params):
+                type_line = self.line_for(self.pos_of(type_))
+                line_beg = self.line_for(self.pos_of(names[0])) if names else type_line
+                line_end = type_line or line_beg
+                needs_linebreak = 0 < prev_line < line_beg
+                if i > 0:
+                    if not needs_linebreak:
+                        self.set_pos(self.pos_of(names[0]) if names else self.pos_of(type_))
+                    self.print(",")
+                if needs_linebreak and self.linebreak(line_beg, 0, ws, True) > 0:
+                    ws = IGNORE
+                elif i > 0:
+                    self.print(BLANK)
+                if names:
+                    self.ident_list(names, ws == INDENT)
+                    self.print(BLANK)
+                if vararg:
+                    self.print("...")
+                self.type_(type_)
+                prev_line = line_end or prev_line
+            closing_line = self.line_for(closing)
+            if 0 < prev_line < closing_line:
+                self.print(",")
+                self.linebreak(closing_line, 0, IGNORE, True)
+            if ws == IGNORE:
+                self.print(UNINDENT)
+        self.set_pos(closing)
+        self.print("]" if brackets else ")")
+
+    def parameter_list(self, parameters) -> list:
+        """(names, type, vararg) of a List of ParameterDecls"""
+        params = []
+        for para in checker.in_order_params(parameters):
+            names = [] if para.ident_list is None else list(reversed(para.ident_list.children))
+            params.append((names, para.type_, para.vararg))
+        return params
+
+    def type_params(self, type_params: list, start: int):
+        """Prints the type parameters of a generic function or type, the [
+        is the first one from start"""
+        groups = []
+        i = 0
+        while i < len(type_params):
+            n = getattr(type_params[i], "_group_size", 1)
+            group = type_params[i:i + n]
+            idents = [syntree.Identifier(("identifier", t.typename, t.col_num), t.lineno) for t in group]
+            groups.append((idents, group[0].constraint, False))
+            i += n
+        opening = self.find("[", start)
+        self.parameters(groups, opening, self.matching(opening, "[", "]"), brackets=True)
+
+    def matching(self, opening: int, left: str, right: str) -> int:
+        """The position of the bracket closing the one at opening"""
+        if opening == NoPos:
+            return NoPos
+        depth = 0
+        for i in range(self.offset(opening), len(self.source)):
+            if self.source[i] == left:
+                depth += 1
+            elif self.source[i] == right:
+                depth -= 1
+                if depth == 0:
+                    return self.file.pos(i)
+        return NoPos
+
+    def signature(self, signature: syntree.Signature, name_end: int = NoPos):
+        if signature.type_params:
+            self.type_params(signature.type_params, name_end)
+        parameters = signature.parameters
+        self.parameters(self.parameter_list(parameters), parameters.pos, parameters.end - 1)
+        result = signature.result
+        if result is None:
+            return
+        if not isinstance(result, syntree.List):
+            self.print(BLANK)
+            self.type_(result)
+            return
+        results = self.parameter_list(result)
+        n = sum(len(names) or 1 for names, _, _ in results)
+        if n > 0:
+            self.print(BLANK)
+            if n == 1 and not results[0][0]:
+                # a single result without a name has no parentheses
+                self.type_(results[0][1])
+                return
+            self.parameters(results, result.pos, result.end - 1)
+
+    def type_(self, t):
+        """Prints a type, in the source or from the AST"""
+        ref = None
+        if t is None or not (has_span(t) or isinstance(t, (syntree.Interface, syntree.TypeUnion))):
+            ref = self.type_ref()
+        if ref is not None:
+            # how a named type (or an alias) is written where it is used
+            self.set_pos(ref.pos)
+            self.print(_Ident(ref.name))
+            if ref.type_args is not None:
+                self.set_pos(self.next_pos("["))
+                self.print("[")
+                for i, arg in enumerate(ref.type_args):
+                    if i > 0:
+                        self.set_pos(self.next_pos(","))
+                        self.print(",", BLANK)
+                    self.type_(arg)
+                self.set_pos(ref.end - 1)
+                self.print("]")
+            return
+        if t is None:
+            raise FormatError("undefined type")
+        self.set_pos(self.node_start(t) if isinstance(t, syntree.Node) else NoPos)
+        if isinstance(t, syntree.Array):
+            self.print("[")
+            if getattr(t, "_ellipsis", False):
+                self.print("...")
+            elif t.length_expr is not None:
+                self.expr(t.length_expr)
+            else:
+                self.print(_Lit(str(t.length)))
+            self.print("]")
+            self.type_(t.eltype)
+        elif isinstance(t, syntree.Slice):
+            self.print("[", "]")
+            self.type_(t.eltype)
+        elif isinstance(t, syntree.Map):
+            self.print("map", "[")
+            self.type_(t.key)
+            self.print("]")
+            self.type_(t.eltype)
+        elif isinstance(t, syntree.Pointer):
+            self.print("*")
+            self.type_(t.base)
+        elif isinstance(t, syntree.Chan):
+            if t.dir == "recv":
+                self.print("<-", "chan")
+            elif t.dir == "send":
+                self.print("chan", "<-")
+            else:
+                self.print("chan")
+            self.print(BLANK)
+            if t.dir != "recv" and isinstance(t.eltype, syntree.Chan) and t.eltype.dir == "recv":
+                # chan <-chan T would be chan<- (chan T)
+                self.print("(")
+                self.type_(t.eltype)
+                self.print(")")
+            else:
+                self.type_(t.eltype)
+        elif isinstance(t, syntree.FunctionType):
+            self.print("func")
+            self.signature(t.signature)
+        elif isinstance(t, syntree.Struct):
+            self.print("struct")
+            self.struct_fields(t)
+        elif isinstance(t, syntree.Interface):
+            if t.alias is not None:
+                self.print(_Ident(t.alias))
+            elif getattr(t, "_implicit", False):
+                # a constraint like ~int, short for interface{~int}
+                self.interface_elem(t._elements[0])
+            else:
+                self.print("interface")
+                self.interface_elems(t)
+        elif isinstance(t, syntree.TypeUnion):
+            for i, (tilde, term) in enumerate(t.terms):
+                if i > 0:
+                    self.print(BLANK)
+                    self.set_pos(self.next_pos("|"))
+                    self.print("|", BLANK)
+                if tilde:
+                    self.set_pos(self.next_pos("~"))
+                    self.print("~")
+                self.type_(term)
+        elif isinstance(t, syntree.NamedType) and t.origin is not None:
+            self.type_(t.origin)
+            self.print("[")
+            for i, arg in enumerate(t.type_args):
+                if i > 0:
+                    self.print(",", BLANK)
+                self.type_(arg)
+            self.print("]")
+        elif isinstance(t, syntree.Type):
+            package = getattr(t, "package", None)
+            if package not in (None, self.package):
+                # a type of an imported package, like geometry.Point
+                self.print(_Ident(package), ".")
+            self.print(_Ident(t.typename))
+        else:
+            raise FormatError(f"cannot print type {t}")
+
+    def next_token(self) -> int:
+        """The offset of the next token of the source, -1 if it isn't known"""
+        if self.pos[1] == 0:
+            return -1
+        i = self.pos[0]
+        while i < len(self.source):
+            if self.source[i] in " \t\r\n":
+                i += 1
+            elif i in self.comment_ends:
+                i = self.comment_ends[i]
+            else:
+                break
+        return i
+
+    def next_pos(self, token: str) -> int:
+        """The position of the next token of the source, if it is token"""
+        i = self.next_token()
+        return self.file.pos(i) if i >= 0 and self.source.startswith(token, i) else NoPos
+
+    def type_ref(self) -> Optional[syntree.TypeRef]:
+        """The TypeRef of the next token of the source, if it is a type name"""
+        i = self.next_token()
+        return None if i < 0 else syntree.type_refs.get(self.file.pos(i))
+
+    def struct_fields(self, t: syntree.Struct):
+        lbrace = self.find("{", t.pos)
+        self.field_list(lbrace, t.end - 1, list(t._field_decls), True)
+
+    def interface_elems(self, t: syntree.Interface):
+        lbrace = self.find("{", t.pos)
+        self.field_list(lbrace, t.end - 1, list(t._elements), False)
+
+    def interface_elem(self, elem):
+        if isinstance(elem, syntree.InterfaceMethod):
+            self.set_pos(self.pos_of(elem.ident))
+            self.print(_Ident(elem.m_name))
+            self.signature(elem.signature)
+        elif isinstance(elem, tuple):
+            # an embedded interface
+            self.set_pos(self.pos_of(elem[0]))
+            self.print(_Ident(elem[0].ident_name))
+        else:
+            self.type_(elem)
+
+    def elem_pos(self, elem) -> int:
+        if isinstance(elem, syntree.InterfaceMethod):
+            return self.pos_of(elem.ident)
+        if isinstance(elem, tuple):
+            return self.pos_of(elem[0])
+        return self.pos_of(elem)
+
+    def has_line_comment(self, field) -> bool:
+        if isinstance(field, (syntree.StructFieldDecl, syntree.InterfaceMethod)):
+            return field.comment is not None
+        # embedded interfaces and unions don't keep theirs
+        end = self.end_of(field[0] if isinstance(field, tuple) else field)
+        return end != NoPos and any(g.is_line_comment and g.prev_end == end for g in self.groups)
+
+    def is_one_line_field_list(self, fields: list, is_struct: bool) -> bool:
+        if len(fields) != 1:
+            return False
+        field = fields[0]
+        if self.has_line_comment(field):
+            return False
+        if is_struct:
+            if field.tag is not None:
+                return False
+            names_size = 1 if field.ident_list is not None else 0
+            return names_size + self.node_size(field.type_, 30) <= 30
+        if isinstance(field, syntree.InterfaceMethod):
+            # the size of the name is not counted, like in go/printer
+            return 1 + self.node_size(syntree.FunctionType(field.signature), 30) <= 30
+        return self.node_size(field[1] if isinstance(field, tuple) else field, 30) <= 30
+
+    def field_list(self, lbrace: int, rbrace: int, fields: list, is_struct: bool):
+        has_comments = self.comment_before(self.position(rbrace))
+        one_line = lbrace != NoPos and rbrace != NoPos and self.line_for(lbrace) == self.line_for(rbrace)
+
+        if not has_comments and one_line:
+            if not fields:
+                self.set_pos(lbrace)
+                self.print("{")
+                self.set_pos(rbrace)
+                self.print("}")
+                return
+            if self.is_one_line_field_list(fields, is_struct):
+                self.set_pos(lbrace)
+                self.print("{", BLANK)
+                if is_struct:
+                    names = field_names(fields[0])
+                    for i, name in enumerate(names):
+                        if i > 0:
+                            self.print(",", BLANK)
+                        self.ident(name)
+                    if names:
+                        self.print(BLANK)
+                    self.type_(fields[0].type_)
+                else:
+                    self.interface_elem(fields[0])
+                self.print(BLANK)
+                self.set_pos(rbrace)
+                self.print("}")
+                return
+
+        self.print(BLANK)
+        self.set_pos(lbrace)
+        self.print("{", INDENT)
+        if has_comments or fields:
+            self.print(FORMFEED)
+
+        line = [0]
+        if is_struct:
+            sep = BLANK if len(fields) == 1 else VTAB
+            for i, field in enumerate(fields):
+                names, type_, tag = field_names(field), field.type_, field.tag
+                if i > 0:
+                    first = self.pos_of(names[0]) if names else self.pos_of(type_)
+                    self.linebreak(self.line_for(first), 1, IGNORE, self.lines_from(line) > 0)
+                self.record_line(line)
+                if names:
+                    self.ident_list(names, False)
+                    self.print(sep)
+                    self.type_(type_)
+                    extra_tabs = 1
+                else:
+                    # an embedded field
+                    self.type_(type_)
+                    extra_tabs = 2
+                if tag is not None:
+                    if names and sep == VTAB:
+                        self.print(sep)
+                    self.print(sep)
+                    self.print(_Lit(tag[2] if len(tag) > 2 else tag[1]))
+                    extra_tabs = 0
+                if field.comment is not None:
+                    for _ in range(extra_tabs):
+                        self.print(sep)
+        else:
+            for i, elem in enumerate(fields):
+                if i > 0:
+                    self.linebreak(self.line_for(self.elem_pos(elem)), 1, IGNORE, self.lines_from(line) > 0)
+                self.record_line(line)
+                self.interface_elem(elem)
+        self.print(UNINDENT, FORMFEED)
+        self.set_pos(rbrace)
+        self.print("}")
+
+    # expressions
+
+    def expr(self, x):
+        self.expr1(x, LOWEST_PREC, 1)
+
+    def expr0(self, x, depth: int):
+        self.expr1(x, LOWEST_PREC, depth)
+
+    def ident(self, ident: syntree.Identifier):
+        self.set_pos(self.pos_of(ident))
+        self.print(_Ident(ident.ident_name))
+
+    def literal_text(self, x: syntree.Literal) -> str:
+        if x.pos != NoPos and x.end != NoPos:
+            return self.source[self.offset(x.pos):self.offset(x.end)].replace("\r", "")
+        if x.exact is not None:
+            return x.exact
+        return str(x.value)
+
+    def expr1(self, x, prec1: int, depth: int, bare: bool = False):
+        if getattr(x, "_parens", False) and not bare:
+            # the parentheses undo one level of depth
+            self.set_pos(self.pos_of(x))
+            self.print("(")
+            self.expr1(x, LOWEST_PREC, reduce_depth(depth), bare=True)
+            self.set_pos(self.find(")", self.end_of(x) - 1))
+            self.print(")")
+            return
+
+        if isinstance(x, syntree.Type):
+            self.type_(x)
+            return
+        if isinstance(x, (syntree.BadExpr, syntree.BadStmt, syntree.BadDecl)):
+            raise FormatError("the file has syntax errors")
+        if isinstance(x, syntree.Identifier):
+            self.ident(x)
+            return
+
+        self.set_pos(self.node_start(x))
+        if isinstance(x, syntree.BinOp) and not isinstance(x, syntree.Assignment):
+            self.binary_expr(x, prec1, cutoff(x, depth), depth)
+        elif isinstance(x, syntree.KeyedElement):
+            self.expr(x.key)
+            self.set_pos(self.find(":", self.end_of(x.key)))
+            self.print(":", BLANK)
+            self.expr(x.value)
+        elif isinstance(x, syntree.UnaryOp):
+            if UNARY_PREC < prec1:
+                self.print("(")
+                self.expr(x)
+                self.print(")")
+            else:
+                self.print(x.operator)
+                self.expr1(x.operand, UNARY_PREC, depth)
+        elif isinstance(x, syntree.LiteralValue):
+            self.composite_lit(None, x, depth)
+        elif isinstance(x, syntree.Literal):
+            if isinstance(x.value, syntree.LiteralValue) or isinstance(x.type_, syntree.Type):
+                self.composite_lit(x.type_, x.value, depth)
+            elif x.type_ == "bool":
+                self.print(_Ident(self.literal_text(x)))
+            else:
+                self.print(_Lit(normalize_number(self.literal_text(x))))
+        elif isinstance(x, syntree.Function):
+            self.print("func")
+            start_col = self.out_col - len("func")
+            self.signature(x.signature)
+            self.func_body(self.distance_from(x.pos, start_col), BLANK, x.body)
+        elif isinstance(x, syntree.PrimaryExpr):
+            self.primary(x, len(suffixes(x)), depth)
+        elif isinstance(x, syntree.FunctionCall):
+            self.call(x, depth)
+        elif isinstance(x, syntree.QualifiedIdent):
+            (_, package, _), (_, name, col) = x.data
+            self.print(_Ident(package), ".")
+            self.set_pos(self.ident_pos(x.lineno, col))
+            self.print(_Ident(name))
+        else:
+            raise FormatError(f"cannot print {x}")
+
+    def binary_expr(self, x: syntree.BinOp, prec1: int, cutoff_: int, depth: int):
+        prec = precedences[x.operator]
+        if prec < prec1:
+            self.print("(")
+            self.expr0(x, reduce_depth(depth))
+            self.print(")")
+            return
+
+        print_blank = prec < cutoff_
+        ws = INDENT
+        self.expr1(x.left, prec, depth + diff_prec(x.left, prec))
+        if print_blank:
+            self.print(BLANK)
+        xline = self.pos[1]
+        yline = self.line_for(self.pos_of(x.right))
+        self.set_pos(self.find(x.operator, self.end_of(x.left), self.pos_of(x.right)))
+        self.print(x.operator)
+        if xline != yline and xline > 0 and yline > 0:
+            # the operands are on different lines
+            if self.linebreak(yline, 1, ws, True) > 0:
+                ws = IGNORE
+                print_blank = False
+        if print_blank:
+            self.print(BLANK)
+        self.expr1(x.right, prec + 1, depth + 1)
+        if ws == IGNORE:
+            self.print(UNINDENT)
+
+    def primary(self, x: syntree.PrimaryExpr, k: int, depth: int, is_method: bool = False) -> bool:
+        """Prints the operand of x and its first k suffixes, if the last
+        one is a selector of a method called, if it is on another line"""
+        if k == 0:
+            if isinstance(x.data, tuple):
+                self.set_pos(x.pos)
+                self.print(_Ident(x.data[1]))
+            else:
+                self.expr1(x.children[0], HIGHEST_PREC, depth)
+            return False
+        suffix = suffixes(x)[k - 1]
+        if isinstance(suffix, syntree.Selector):
+            self.primary(x, k - 1, depth)
+            self.print(".")
+            pos = self.ident_pos(suffix.lineno, suffix.col_num)
+            line = self.line_for(pos)
+            if self.pos[1] > 0 and self.pos[1] < line:
+                self.print(INDENT, NEWLINE)
+                self.set_pos(pos)
+                self.print(_Ident(suffix.field_name))
+                if not is_method:
+                    self.print(UNINDENT)
+                return True
+            self.set_pos(pos)
+            self.print(_Ident(suffix.field_name))
+        elif isinstance(suffix, syntree.Index):
+            self.primary(x, k - 1, 1)
+            self.set_pos(suffix.pos)
+            self.print("[")
+            if isinstance(suffix.expr, syntree.List):
+                self.expr_list(suffix.pos, checker.in_order(suffix.expr), depth + 1, COMMA_TERM, suffix.end - 1)
+            else:
+                self.expr0(suffix.expr, depth + 1)
+            self.set_pos(suffix.end - 1)
+            self.print("]")
+        elif isinstance(suffix, syntree.SliceExpr):
+            self.primary(x, k - 1, 1)
+            self.set_pos(suffix.pos)
+            self.print("[")
+            indices = [suffix.low, suffix.high]
+            if suffix.max is not None:
+                indices.append(suffix.max)
+            needs_blanks = False
+            if depth <= 1:
+                given = [i for i in indices if i is not None]
+                needs_blanks = len(given) > 1 and any(is_binary(i) for i in given)
+            for i, index in enumerate(indices):
+                if i > 0:
+                    if indices[i - 1] is not None and needs_blanks:
+                        self.print(BLANK)
+                    self.print(":")
+                    if index is not None and needs_blanks:
+                        self.print(BLANK)
+                if index is not None:
+                    self.expr0(index, depth + 1)
+            self.set_pos(suffix.end - 1)
+            self.print("]")
+        elif isinstance(suffix, syntree.TypeAssertion):
+            self.primary(x, k - 1, depth)
+            self.print(".")
+            self.set_pos(self.find("(", suffix.pos))
+            self.print("(")
+            self.type_(suffix.type_)
+            self.set_pos(suffix.end - 1)
+            self.print(")")
+        else:
+            raise FormatError(f"cannot print {suffix}")
+        return False
+
+    def call(self, x: syntree.FunctionCall, depth: int):
+        arguments = x.arguments
+        args = arguments.expressions()
+        if arguments.type_ is not None:
+            args.insert(0, arguments.type_)
+        if len(args) > 1:
+            depth += 1
+
+        fn = x.fn_name
+        was_indented = False
+        if isinstance(fn, str):
+            self.print(_Ident(fn))
+            if x.type_arg_exprs:
+                # an explicit instantiation, like Max[int]
+                lbrack = self.find("[", x.pos)
+                rbrack = self.rfind("]", x.pos, arguments.pos)
+                self.set_pos(lbrack)
+                self.print("[")
+                self.expr_list(lbrack, x.type_arg_exprs, depth + 1, COMMA_TERM, rbrack)
+                self.set_pos(rbrack)
+                self.print("]")
+        elif isinstance(fn, syntree.PrimaryExpr) and suffixes(fn) and \
+                isinstance(suffixes(fn)[-1], syntree.Selector) and not getattr(fn, "_parens", False):
+            self.set_pos(self.node_start(fn))
+            was_indented = self.primary(fn, len(suffixes(fn)), depth, is_method=True)
+        elif isinstance(fn, (syntree.FunctionType, syntree.Chan)) and \
+                (isinstance(fn, syntree.FunctionType) or fn.dir == "recv"):
+            # conversions to func types and <-chan types need parentheses
+            self.print("(")
+            self.type_(fn)
+            self.print(")")
+        else:
+            self.expr1(fn, HIGHEST_PREC, depth)
+
+        lparen, rparen = arguments.pos, arguments.end - 1
+        self.set_pos(lparen)
+        self.print("(")
+        if arguments.ellipsis:
+            ellipsis = self.rfind("...", lparen, rparen)
+            self.expr_list(lparen, args, depth, 0, ellipsis)
+            self.set_pos(ellipsis)
+            self.print("...")
+            if rparen != NoPos and self.line_for(ellipsis) < self.line_for(rparen):
+                self.print(",", FORMFEED)
+        else:
+            self.expr_list(lparen, args, depth, COMMA_TERM, rparen)
+        self.set_pos(rparen)
+        self.print(")")
+        if was_indented:
+            self.print(UNINDENT)
+
+    def composite_lit(self, type_, value: Optional[syntree.LiteralValue], depth: int):
+        if type_ is not None:
+            self.type_(type_)
+        elements = [] if value is None else list(reversed(value.children))
+        lbrace = NoPos if value is None else value.pos
+        rbrace = NoPos if value is None else value.end - 1
+        self.level += 1
+        self.set_pos(lbrace)
+        self.print("{")
+        self.expr_list(lbrace, elements, 1, COMMA_TERM, rbrace)
+        # no line break (or blank if there are elements) after a
+        # /*-style comment before the }, it could need a comma
+        mode = NO_EXTRA_LINEBREAK
+        if elements:
+            mode |= NO_EXTRA_BLANK
+        self.print(INDENT, UNINDENT, _Mode(mode))
+        self.set_pos(rbrace)
+        self.print("}", _Mode(mode))
+        self.level -= 1
+
+    # statements
+
+    def block_stmts(self, block) -> list:
+        """The statements of a block (or a case clause) in order, the
+        declarations as they are written"""
+        items: list = []
+
+        def _collect(node):
+            for child in node.children:
+                if isinstance(child, syntree.List) and not isinstance(child, (syntree.Block, syntree.LiteralValue)):
+                    _collect(child)
+                elif child is not None:
+                    items.append(child)
+        _collect(block)
+        return self.in_source_order(items)
+
+    def in_source_order(self, items: list) -> list:
+        """The statements (or declarations) of the nodes, a declaration
+        made of many nodes once, in the order they are in the source"""
+        nodes, seen = [], set()
+        for item in items:
+            group = getattr(item, "_group", None)
+            node = item if group is None else group
+            if id(node) not in seen:
+                seen.add(id(node))
+                nodes.append(node)
+        nodes.sort(key=lambda node: self.pos_of(node))
+        return nodes
+
+    def simple_stmt(self, stmt):
+        """The statement of a List of the VarDecls of a :=, or stmt"""
+        if isinstance(stmt, syntree.List) and not isinstance(stmt, syntree.Block):
+            for child in stmt.children:
+                node = self.simple_stmt(child)
+                if node is not None:
+                    return node
+            return None
+        return getattr(stmt, "_group", stmt)
+
+    def stmt_list(self, stmts: list, nindent: int, next_is_rbrace: bool):
+        if nindent > 0:
+            self.print(INDENT)
+        line = [0]
+        for i, stmt in enumerate(stmts):
+            if self.has_output:
+                # case clauses (nindent == 0) are sections
+                self.linebreak(self.line_for(self.pos_of(stmt)), 1, IGNORE,
+                               i == 0 or nindent == 0 or self.lines_from(line) > 0)
+            self.record_line(line)
+            self.stmt(stmt, next_is_rbrace and i == len(stmts) - 1)
+            # the labels are on lines of their own, the line recorded is
+            # the one of the statement labeled
+            labeled = stmt
+            while isinstance(labeled, syntree.LabeledStmt):
+                line[0] += 1
+                labeled = labeled.stmt
+        if nindent > 0:
+            self.print(UNINDENT)
+
+    def block(self, lbrace: int, stmts: list, rbrace: int, nindent: int):
+        self.set_pos(lbrace)
+        self.print("{")
+        self.stmt_list(stmts, nindent, True)
+        self.linebreak(self.line_for(rbrace), 1, IGNORE, True)
+        self.set_pos(rbrace)
+        self.print("}")
+
+    def body(self, block: syntree.Block, nindent: int = 1):
+        self.block(block.pos, self.block_stmts(block), block.end - 1, nindent)
+
+    def control_clause(self, is_for: bool, init, expr, post):
+        self.print(BLANK)
+        needs_blank = False
+        if init is None and post is None:
+            if expr is not None:
+                self.expr1(expr, LOWEST_PREC, 1, bare=strip_parens(expr))
+                needs_blank = True
+        else:
+            if init is not None:
+                self.stmt(init, False)
+            self.print(";", BLANK)
+            if expr is not None:
+                self.expr1(expr, LOWEST_PREC, 1, bare=strip_parens(expr))
+                needs_blank = True
+            if is_for:
+                self.print(";", BLANK)
+                needs_blank = False
+                if post is not None:
+                    self.stmt(post, False)
+                    needs_blank = True
+        if needs_blank:
+            self.print(BLANK)
+
+    def func_body(self, header_size: int, sep: str, body: Optional[syntree.Block]):
+        if body is None:
+            return
+        level, self.level = self.level, 0
+        stmts = self.block_stmts(body)
+        max_size = 100
+        if header_size + self.body_size(body, stmts, max_size) <= max_size:
+            # a small body is on the line of the header
+            self.print(sep)
+            self.set_pos(body.pos)
+            self.print("{")
+            if stmts:
+                self.print(BLANK)
+                for i, stmt in enumerate(stmts):
+                    if i > 0:
+                        self.print(";", BLANK)
+                    self.stmt(stmt, i == len(stmts) - 1)
+                self.print(BLANK)
+            self.print(NO_EXTRA_LINEBREAK)
+            self.set_pos(body.end - 1)
+            self.print("}", NO_EXTRA_LINEBREAK)
+            self.level = level
+            return
+        if sep != IGNORE:
+            self.print(BLANK)
+        self.block(body.pos, stmts, body.end - 1, 1)
+        self.level = level
+
+    def assign(self, lhs: list, op: str, rhs: list, start: int):
+        depth = 2 if len(lhs) > 1 and len(rhs) > 1 else 1
+        tok_pos = self.find(op, self.end_of(lhs[-1]))
+        self.expr_list(start, lhs, depth, 0, tok_pos)
+        self.print(BLANK)
+        self.set_pos(tok_pos)
+        self.print(op, BLANK)
+        self.expr_list(tok_pos, rhs, depth, 0, NoPos)
+
+    def stmt(self, s, next_is_rbrace: bool):
+        self.set_pos(self.pos_of(s))
+        if isinstance(s, syntree.List) and not isinstance(s, syntree.Block):
+            s = self.simple_stmt(s)
+        if isinstance(s, syntree.DeclGroup):
+            if s.keyword == ":=":
+                spec = s.specs[0]
+                self.assign(spec.names, ":=", spec.values, spec.pos)
+            else:
+                self.gen_decl(s)
+        elif isinstance(s, syntree.VarDecl):
+            self.stmt(s._group, next_is_rbrace)
+        elif isinstance(s, syntree.Assignment):
+            self.assign(checker.in_order(s.left), s.operator, checker.in_order(s.right), self.pos_of(s))
+        elif isinstance(s, syntree.UnaryOp) and s.operator in ("++", "--"):
+            self.expr0(s.operand, 2)
+            self.set_pos(self.find(s.operator, self.end_of(s.operand)))
+            self.print(s.operator)
+        elif isinstance(s, syntree.SendStmt):
+            self.expr0(s.chan, 1)
+            self.print(BLANK)
+            self.set_pos(self.find("<-", self.end_of(s.chan)))
+            self.print("<-", BLANK)
+            self.expr0(s.value, 1)
+        elif isinstance(s, syntree.GoStmt):
+            self.print("go", BLANK)
+            self.expr(s.call)
+        elif isinstance(s, syntree.DeferStmt):
+            self.print("defer", BLANK)
+            self.expr(s.call)
+        elif isinstance(s, syntree.Keyword):
+            self.print(s.kw.lower())
+            if s.kw == "RETURN" and s.children:
+                results = checker.in_order(s.children[0])
+                self.print(BLANK)
+                if self.indent_list(results):
+                    self.print(INDENT)
+                    self.expr_list(NoPos, results, 1, NO_INDENT, NoPos)
+                    self.print(UNINDENT)
+                else:
+                    self.expr_list(NoPos, results, 1, 0, NoPos)
+            elif len(s.ext) > 1:
+                self.print(BLANK, _Ident(s.ext[1]))
+        elif isinstance(s, syntree.LabeledStmt):
+            # a "correcting" unindent right after a line break is
+            # applied before the line break if there is no comment between
+            self.print(UNINDENT)
+            self.expr(s.label)
+            self.print(":", INDENT)
+            if s.stmt is None:
+                if not next_is_rbrace:
+                    self.print(NEWLINE)
+                    self.set_pos(self.find(";", self.end_of(s.label)))
+                    self.print(";")
+            else:
+                self.linebreak(self.line_for(self.pos_of(s.stmt)), 1, IGNORE, True)
+                self.stmt(s.stmt, next_is_rbrace)
+        elif isinstance(s, syntree.Block):
+            self.body(s)
+        elif isinstance(s, syntree.IfStmt):
+            self.print("if")
+            self.control_clause(False, self.simple_stmt(s.statement), s.expr, None)
+            self.body(s.body)
+            if s.next_ is not None:
+                self.print(BLANK, "else", BLANK)
+                self.stmt(s.next_, next_is_rbrace)
+        elif isinstance(s, syntree.ForStmt):
+            self.for_stmt(s)
+        elif isinstance(s, syntree.TypeSwitchStmt):
+            self.print("switch", BLANK)
+            init = self.simple_stmt(s.statement)
+            if init is not None:
+                self.stmt(init, False)
+                self.print(";", BLANK)
+            if s.ident is not None:
+                self.expr(s.ident)
+                self.print(BLANK)
+                self.set_pos(self.find(":=", self.end_of(s.ident)))
+                self.print(":=", BLANK)
+            self.expr(s.expr)
+            self.print(".")
+            lparen = self.find("(", self.end_of(s.expr))
+            self.set_pos(lparen)
+            self.print("(", "type")
+            rparen = self.find(")", lparen)
+            self.set_pos(rparen)
+            self.print(")", BLANK)
+            lbrace = self.find("{", rparen)
+            self.block(lbrace, self.in_source_order(checker.in_order(s.clauses)), s.end - 1, 0)
+        elif isinstance(s, syntree.SwitchStmt):
+            self.print("switch")
+            self.control_clause(False, self.simple_stmt(s.statement), s.expr, None)
+            header_end = self.end_of(s.expr) if s.expr is not None else NoPos
+            if header_end == NoPos and s.statement is not None:
+                header_end = self.end_of(self.simple_stmt(s.statement))
+            lbrace = self.find("{", header_end if header_end != NoPos else s.pos)
+            self.block(lbrace, self.in_source_order(checker.in_order(s.clauses)), s.end - 1, 0)
+        elif isinstance(s, syntree.SelectStmt):
+            self.print("select", BLANK)
+            lbrace, rbrace = self.find("{", s.pos), s.end - 1
+            clauses = self.in_source_order(checker.in_order(s.clauses))
+            if not clauses and not self.comment_before(self.position(rbrace)):
+                self.set_pos(lbrace)
+                self.print("{")
+                self.set_pos(rbrace)
+                self.print("}")
+            else:
+                self.block(lbrace, clauses, rbrace, 0)
+        elif isinstance(s, syntree.TypeCaseClause):
+            if s.types is not None:
+                self.print("case", BLANK)
+                types = checker.in_order(s.types)
+                for i, case in enumerate(types):
+                    if i > 0:
+                        self.print(",", BLANK)
+                    self.set_pos(case.pos)
+                    if case.nil:
+                        self.print(_Ident("nil"))
+                    else:
+                        self.type_(case.type_)
+                colon = self.find(":", types[-1].end)
+            else:
+                self.print("default")
+                colon = self.find(":", s.pos)
+            self.set_pos(colon)
+            self.print(":")
+            self.stmt_list(self.block_stmts(s.body), 1, next_is_rbrace)
+        elif isinstance(s, syntree.CaseClause):
+            exprs = checker.in_order(s.exprs)
+            if s.exprs is not None:
+                self.print("case", BLANK)
+                colon = self.find(":", self.end_of(exprs[-1]))
+                self.expr_list(self.pos_of(s), exprs, 1, 0, colon)
+            else:
+                self.print("default")
+                colon = self.find(":", s.pos)
+            self.set_pos(colon)
+            self.print(":")
+            self.stmt_list(self.block_stmts(s.body), 1, next_is_rbrace)
+        elif isinstance(s, syntree.CommClause):
+            if s.comm is not None:
+                self.print("case", BLANK)
+                comm = self.simple_stmt(s.comm)
+                self.stmt(comm, False)
+                colon = self.find(":", self.end_of(comm))
+            else:
+                self.print("default")
+                colon = self.find(":", s.pos)
+            self.set_pos(colon)
+            self.print(":")
+            self.stmt_list(self.block_stmts(s.body), 1, next_is_rbrace)
+        elif isinstance(s, (syntree.BadStmt, syntree.BadDecl)):
+            raise FormatError("the file has syntax errors")
+        else:
+            self.expr0(s, 1)
+
+    def for_stmt(self, s: syntree.ForStmt):
+        clause = s.clause
+        if isinstance(clause, syntree.RangeClause):
+            self.print("for", BLANK)
+            if clause.ident_list is not None:
+                keys, tok = list(reversed(clause.ident_list.children)), ":="
+            else:
+                keys, tok = checker.in_order(clause.expr_list), "="
+            if keys:
+                self.expr(keys[0])
+                if len(keys) > 1:
+                    self.set_pos(self.pos_of(keys[1]))
+                    self.print(",", BLANK)
+                    self.expr(keys[1])
+                self.print(BLANK)
+                self.set_pos(self.find(tok, self.end_of(keys[-1])))
+                self.print(tok, BLANK)
+            self.print("range", BLANK)
+            self.expr1(clause.expr, LOWEST_PREC, 1, bare=strip_parens(clause.expr))
+            self.print(BLANK)
+            self.body(s.body)
+            return
+        self.print("for")
+        if isinstance(clause, syntree.ForClause):
+            cond = clause.cond if self.pos_of(clause.cond) != NoPos else None
+            self.control_clause(True, self.simple_stmt(clause.init), cond, self.simple_stmt(clause.post))
+        elif self.pos_of(clause) != NoPos:
+            self.control_clause(True, None, clause, None)
+        else:
+            # for { ... }
+            self.control_clause(True, None, None, None)
+        self.body(s.body)
+
+    # declarations
+
+    def gen_decl(self, d: syntree.DeclGroup):
+        self.set_pos(d.pos)
+        self.print(d.keyword, BLANK)
+        specs = d.specs
+        if d.parenthesized or len(specs) != 1:
+            lparen = self.find("(", d.pos)
+            self.set_pos(lparen)
+            self.print("(")
+            n = len(specs)
+            if n > 0:
+                self.print(INDENT, FORMFEED)
+                line = [0]
+                if d.keyword == "import":
+                    specs = self.sort_imports(specs)
+                keep_type = keep_type_column(specs) if n > 1 and d.keyword in ("var", "const") else None
+                for i, spec in enumerate(specs):
+                    if i > 0:
+                        self.linebreak(self.line_for(self.pos_of(spec)), 1, IGNORE, self.lines_from(line) > 0)
+                    self.record_line(line)
+                    if keep_type is not None:
+                        self.value_spec(spec, keep_type[i])
+                    else:
+                        self.spec(spec, n, False)
+                self.print(UNINDENT, FORMFEED)
+            self.set_pos(d.end - 1)
+            self.print(")")
+        elif specs:
+            self.spec(specs[0], 1, True)
+
+    def value_spec(self, s: syntree.Spec, keep_type: bool):
+        self.ident_list(s.names, False)
+        extra_tabs = 3
+        typed = s.type_ is not None or self.type_ref() is not None
+        if typed or keep_type:
+            self.print(VTAB)
+            extra_tabs -= 1
+        if typed:
+            self.type_(s.type_)
+        if s.values is not None:
+            self.print(VTAB, "=", BLANK)
+            self.expr_list(NoPos, s.values, 1, 0, NoPos)
+            extra_tabs -= 1
+        if s.comment is not None:
+            for _ in range(extra_tabs):
+                self.print(VTAB)
+
+    def spec(self, s, n: int, do_indent: bool):
+        if isinstance(s, syntree.Import):
+            name = s._name
+            if isinstance(name, tuple):
+                self.set_pos(s.pos)
+                self.print(_Ident(name[1]), BLANK)
+            elif name == ".":
+                self.set_pos(s.pos)
+                self.print(".", BLANK)
+            path = s.data[1][1]
+            self.set_pos(self.rfind(path, s.pos, s.end) if s.end != NoPos else NoPos)
+            self.print(_Lit(path))
+        elif isinstance(s, syntree.Spec):
+            self.ident_list(s.names, do_indent)
+            if s.type_ is not None or self.type_ref() is not None:
+                self.print(BLANK)
+                self.type_(s.type_)
+            if s.values is not None:
+                self.print(BLANK, "=", BLANK)
+                self.expr_list(NoPos, s.values, 1, 0, NoPos)
+        elif isinstance(s, syntree.TypeDef):
+            self.set_pos(self.ident_pos(s.lineno, s.typename[2]))
+            self.print(_Ident(s.typename[1]))
+            alias = getattr(s, "_alias", False)
+            if not alias and s.type_.type_params:
+                self.type_params(s.type_.type_params, self.pos_of(s))
+            self.print(BLANK if n == 1 else VTAB)
+            if alias:
+                self.print("=", BLANK)
+                self.type_(s.type_)
+            else:
+                self.type_(s.type_.definition)
+
+    def sort_imports(self, specs: list) -> list:
+        """The imports sorted by path in the runs of them on consecutive
+        lines, like gofmt does (if there are no comments between them).
+        The sorted ones are printed at the positions of the ones before"""
+        group_start, group_end = self.pos_of(specs[0]), self.end_of(specs[-1])
+        if any(group_start <= g.pos < group_end for g in self.groups):
+            return specs
+        result, run = [], []
+
+        def _flush():
+            ordered = sorted(run, key=lambda s: (s.data[1][1], str(s._name)))
+            for slot, spec in zip(run, ordered):
+                self.moved[id(spec)] = self.pos_of(slot)
+            result.extend(ordered)
+
+        for spec in specs:
+            if run and self.line_for(self.pos_of(spec)) > self.line_for(self.end_of(run[-1]) - 1) + 1:
+                _flush()
+                run = []
+            run.append(spec)
+        _flush()
+        # the same import twice is printed once
+        unique, seen = [], set()
+        for spec in result:
+            key = (spec.data[1][1], str(spec._name))
+            if key not in seen:
+                seen.add(key)
+                unique.append(spec)
+        return unique
+
+    def func_decl(self, d: syntree.Function):
+        self.set_pos(d.pos)
+        self.print("func", BLANK)
+        start_col = self.out_col - len("func ")
+        if isinstance(d, syntree.Method):
+            receiver = d.receiver
+            self.parameters(self.parameter_list(receiver), receiver.pos, receiver.end - 1)
+            self.print(BLANK)
+        name_pos = self.ident_pos(d.lineno, d.fn_name[2])
+        self.set_pos(name_pos)
+        self.print(_Ident(d.fn_name[1]))
+        self.signature(d.signature, name_pos)
+        self.func_body(self.distance_from(d.pos, start_col), VTAB, d.body)
+
+    def decl_list(self, decls: list):
+        tok = ""
+        for d in decls:
+            prev = tok
+            tok = "func" if isinstance(d, syntree.Function) else d.keyword
+            if self.has_output:
+                min_ = 2 if prev != tok or d.doc is not None else 1
+                lines = self.line_for(d.end - 1) - self.line_for(d.pos) + 1
+                self.linebreak(self.line_for(self.pos_of(d)), min_, IGNORE, tok == "func" and lines > 1)
+            if isinstance(d, syntree.Function):
+                self.func_decl(d)
+            else:
+                self.gen_decl(d)
+
+    def print_file(self, file: syntree.File, package_name: str):
+        start = first_token(self.source, self.groups, self.file)
+        self.set_pos(self.file.pos(start))
+        self.print("package", BLANK)
+        self.set_pos(self.find(package_name, self.file.pos(start + len("package"))))
+        self.print(_Ident(package_name))
+        decls: list = []
+
+        def _collect(node):
+            for child in node.children:
+                if isinstance(child, syntree.List) and not isinstance(child, syntree.Block):
+                    _collect(child)
+                elif isinstance(child, syntree.BadDecl):
+                    raise FormatError("the file has syntax errors")
+                elif child is not None:
+                    decls.append(child)
+        _collect(file)
+        self.decl_list(self.in_source_order(decls))
+        self.print(NEWLINE)
+
+
+def first_token(source: str, groups: list, file) -> int:
+    """The offset of the first token of the source, after the comments"""
+    ends = {file.offset(pos): file.offset(pos) + len(text) for g in groups for pos, text in g.comments}
+    i = 0
+    while i < len(source):
+        if source[i] in " \t\r\n":
+            i += 1
+        elif i in ends:
+            i = ends[i]
+        else:
+            break
+    return i
+
+
+def normalize_number(lit: str) -> str:
+    """A number with the lower case prefix and exponent, like gofmt
+    prints 0X1P4 as 0x1p4 (the digits are kept), other literals as they are"""
+    if not lit or not (lit[0].isdigit() or lit[0] == "."):
+        return lit
+    if lit[:2] in ("0X", "0x"):
+        return "0x" + lit[2:].replace("P", "p")
+    if lit[:2] in ("0B", "0O"):
+        return lit[:2].lower() + lit[2:]
+    return lit.replace("E", "e")
+
+
+def field_names(field: syntree.StructFieldDecl) -> list:
+    """The Identifiers of the names of a field, in order"""
+    return [] if field.ident_list is None else list(reversed(field.ident_list.children))
+
+
+def suffixes(x: syntree.PrimaryExpr) -> list:
+    """The suffixes of a PrimaryExpr, like the index and the selector of a[i].x"""
+    return x.children if isinstance(x.data, tuple) else x.children[1:]
+
+
+def has_span(t: syntree.Type) -> bool:
+    """If the span of the type is the one of where it is written, named
+    types (and their instances) are the same node wherever they are"""
+    if isinstance(t, syntree.Interface):
+        return t.alias is None and not getattr(t, "_implicit", False)
+    return isinstance(t, (syntree.Array, syntree.Slice, syntree.Map, syntree.Chan,
+                          syntree.Pointer, syntree.FunctionType, syntree.Struct))
+
+
+def is_statement(node) -> bool:
+    return isinstance(node, (
+        syntree.DeclGroup, syntree.Assignment, syntree.SendStmt, syntree.GoStmt,
+        syntree.DeferStmt, syntree.Keyword, syntree.Block, syntree.IfStmt, syntree.ForStmt,
+        syntree.SwitchStmt, syntree.SelectStmt, syntree.CaseClause, syntree.CommClause,
+    )) or (isinstance(node, syntree.UnaryOp) and node.operator in ("++", "--"))
+
+
+def is_binary(x) -> bool:
+    return isinstance(x, syntree.BinOp) and not getattr(x, "_parens", False)
+
+
+def strip_parens(x) -> bool:
+    """If the parentheses around the expression of an if, for or switch
+    can be left out, unless a composite literal with a type name is in
+    it, which would be read as a block"""
+    if not getattr(x, "_parens", False):
+        return False
+    strip = True
+
+    def _inspect(node, top: bool):
+        nonlocal strip
+        if not top and getattr(node, "_parens", False):
+            return
+        if isinstance(node, syntree.Literal) and isinstance(node.value, syntree.LiteralValue):
+            if isinstance(node.type_, syntree.NamedType):
+                strip = False
+            return
+        if isinstance(node, syntree.Function):
+            return
+        for child in getattr(node, "children", []):
+            if isinstance(child, syntree.Node) and not isinstance(child, syntree.Type):
+                _inspect(child, False)
+    _inspect(x, True)
+    return strip
+
+
+def walk_binary(e: syntree.BinOp) -> Tuple[bool, bool, int]:
+    prec = precedences[e.operator]
+    has4, has5, max_problem = prec == 4, prec == 5, 0
+
+    left = e.left
+    if is_binary(left) and not precedences[left.operator] < prec:
+        h4, h5, mp = walk_binary(left)
+        has4, has5, max_problem = has4 or h4, has5 or h5, max(max_problem, mp)
+
+    right = e.right
+    if is_binary(right):
+        if not precedences[right.operator] <= prec:
+            h4, h5, mp = walk_binary(right)
+            has4, has5, max_problem = has4 or h4, has5 or h5, max(max_problem, mp)
+    elif isinstance(right, syntree.UnaryOp) and not getattr(right, "_parens", False):
+        ops = e.operator + right.operator
+        if ops in ("/*", "&&", "&^"):
+            max_problem = 5
+        elif ops in ("++", "--"):
+            max_problem = max(max_problem, 4)
+    return has4, has5, max_problem
+
+
+def cutoff(e: syntree.BinOp, depth: int) -> int:
+    """The precedence of the operators printed without blanks around them"""
+    has4, has5, max_problem = walk_binary(e)
+    if max_problem > 0:
+        return max_problem + 1
+    if has4 and has5:
+        return 5 if depth == 1 else 4
+    return 6 if depth == 1 else 4
+
+
+def diff_prec(x, prec: int) -> int:
+    if not is_binary(x) or prec != precedences[x.operator]:
+        return 1
+    return 0
+
+
+def reduce_depth(depth: int) -> int:
+    return max(depth - 1, 1)
+
+
+def keep_type_column(specs: list) -> list:
+    """For grouped var and const specs, if the column of their types
+    is kept, in the runs of specs with values where one has a type"""
+    keep = [False] * len(specs)
+    start, keep_type = -1, False
+    for i, spec in enumerate(specs):
+        if spec.values is not None:
+            if start < 0:
+                start, keep_type = i, False
+        elif start >= 0:
+            if keep_type:
+                keep[start:i] = [True] * (i - start)
+            start = -1
+        if spec.type_ is not None:
+            keep_type = True
+    if start >= 0 and keep_type:
+        keep[start:] = [True] * (len(specs) - start)
+    return keep
+
+
+def format_file(file_node: syntree.File, file, source: str, package_name: str) -> str:
+    """The source of a file (of the fileset) formatted like gofmt
+    does, file_node is its AST. Raises FormatError for what can't
+    be printed (the file shouldn't have syntax errors)"""
+    printer = Printer(file, source, file_node.comments, package_name, {})
+    printer.print_file(file_node, package_name)
+    writer = TabWriter()
+    writer.write(printer.finish())
+    return trim(writer.flush())
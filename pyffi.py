@@ -0,0 +1,238 @@
+import os
+import sys
+import json
+import math
+import typing
+import inspect
+import importlib
+
+from typing import Any, Dict, List, Optional, Set, Tuple
+from symbol_table import predefined_identifiers
+
+
+# The Python modules Go code imports, as "python/NAME": import "python/math"
+# imports the module math, "python/os/path" the module os.path. The loader
+# imports the module (the directory of the program is on sys.path, for its
+# own modules) and gives the package its bindings, a Go file declaring its
+# functions without bodies, which the interpreter and the VM implement by
+# calling the Python functions (see interp.python_natives):
+#
+#   // Sqrt calls the function sqrt of the Python module math.
+#   func Sqrt(x any) any
+#
+# The names are exported: the first letter is upper case, the names with
+# a _ are left out. The types of the parameters and of the results are the
+# ones of the annotations of the functions (int, float, str, bool, bytes,
+# list[T] and dict[K, V] are int, float64, string, bool, []byte, []T and
+# map[K]V), so the calls are type checked, and any for the others. The
+# parameters with a default value are given after the other ones, as
+# ...any, like the ones of *args. The classes are functions returning their
+# objects, the ints, the floats, the strings and the bools of the module
+# are constants, with their values when it is imported.
+#
+# The arguments are converted to Python values (a string to a str, a slice
+# to a list, a map to a dict...) and the results to the Go type of the
+# result. An any gets the Go type of the value: bool, int, float64, string,
+# []byte, []any (of a list or a tuple), map[any]any (of a dict), nil (of
+# None), or python.Object for the other ones (see std/python). A Python
+# exception is a panic, like panic: python: ValueError: math domain error
+
+prefix = "python/"
+
+# if the modules can be imported, the playground doesn't import them (the
+# code importing a module can do anything)
+enabled = True
+
+# the Python names of the functions declared by the bindings, by the import
+# path of their package and by Go name
+names: Dict[str, Dict[str, str]] = {}
+# why the modules which can't be imported can't be, by import path
+errors: Dict[str, str] = {}
+
+go_keywords = {
+    "break", "case", "chan", "const", "continue", "default", "defer", "else",
+    "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map",
+    "package", "range", "return", "select", "struct", "switch", "type", "var",
+}
+
+# the Go types of the annotations
+basic_types = {int: "int", float: "float64", str: "string", bool: "bool", bytes: "[]byte"}
+
+
+def is_python(path: str) -> bool:
+    return path.startswith(prefix) and len(path) > len(prefix)
+
+
+def module_name(path: str) -> str:
+    return path[len(prefix):].replace("/", ".")
+
+
+def directory(path: str) -> str:
+    """The directory of the package of path, which isn't on the disk"""
+    return os.path.join(os.sep, "python", *module_name(path).split("."))
+
+
+def filename(path: str) -> str:
+    """The file of the bindings of the package of path, see bind"""
+    return os.path.join(directory(path), "bindings.go")
+
+
+def import_module(path: str, root: Optional[str] = None):
+    """The module of the import path, the modules of root can be imported"""
+    if root is not None and os.path.abspath(root) not in sys.path:
+        sys.path.insert(0, os.path.abspath(root))
+    return importlib.import_module(module_name(path))
+
+
+def bind(path: str, root: Optional[str] = None) -> Optional[str]:
+    """Imports the module of path and puts its bindings in utils.overlays,
+    returns the directory of its package. None if it can't be imported,
+    errors has why"""
+    import utils
+    if not enabled:
+        errors[path] = "the Python modules can't be imported here"
+        return None
+    try:
+        module = import_module(path, root)
+    except Exception as e:
+        errors[path] = f"{type(e).__name__}: {e}"
+        return None
+    utils.overlays[filename(path)] = bindings(path, module)
+    return directory(path)
+
+
+def go_name(name: str) -> Optional[str]:
+    """The exported Go name of a member of a module, None for the ones with
+    a _ (or which aren't ASCII, like the names the lexer knows)"""
+    if name.startswith("_") or not name.isascii() or not name.isidentifier():
+        return None
+    return name[0].upper() + name[1:]
+
+
+def param_name(name: str, taken: Set[str] = frozenset()) -> str:
+    """The Go name of a parameter (or of a package), the keywords and the
+    predeclared identifiers get a _, so do the names taken"""
+    while name in go_keywords or name in predefined_identifiers or name in taken:
+        name += "_"
+    return name
+
+
+def go_type(hint: Any) -> str:
+    """The Go type of an annotation"""
+    if hint in basic_types:
+        return basic_types[hint]
+    origin, args = typing.get_origin(hint), typing.get_args(hint)
+    if hint is list or origin is list:
+        return "[]" + (go_type(args[0]) if args else "any")
+    if hint is dict or origin is dict:
+        key = go_type(args[0]) if args else "any"
+        # the keys of a map are comparable
+        if key.startswith("[]") or key.startswith("map["):
+            key = "any"
+        return f"map[{key}]" + (go_type(args[1]) if len(args) > 1 else "any")
+    return "any"
+
+
+def type_hints(fn: Any) -> Dict[str, Any]:
+    try:
+        return typing.get_type_hints(fn)
+    except Exception:
+        return getattr(fn, "__annotations__", None) or {}
+
+
+def signature(fn: Any) -> Optional[Tuple[List[str], List[str]]]:
+    """The Go parameters and results of a function, None if Go can't call
+    it (it has a keyword-only parameter without a default value)"""
+    try:
+        sig = inspect.signature(fn)
+    except (TypeError, ValueError):
+        return ["args ...any"], ["any"]
+    hints = {} if inspect.isclass(fn) else type_hints(fn)
+    params = []
+    taken = {"python"}
+    for p in sig.parameters.values():
+        if p.kind == p.KEYWORD_ONLY and p.default is p.empty:
+            return None
+        if p.kind in (p.POSITIONAL_ONLY, p.POSITIONAL_OR_KEYWORD):
+            if p.default is not p.empty:
+                name = param_name("rest", taken | set(sig.parameters))
+                params.append(f"{name} ...any")
+                break
+            name = param_name(p.name, taken)
+            params.append(f"{name} {go_type(hints.get(p.name))}")
+        elif p.kind == p.VAR_POSITIONAL:
+            name = param_name(p.name, taken)
+            params.append(f"{name} ...{go_type(hints.get(p.name))}")
+            break
+        else:
+            continue
+        taken.add(name)
+    if inspect.isclass(fn):
+        return params, ["any"]
+    if "return" in hints and hints["return"] is type(None):
+        return params, []
+    return params, [go_type(hints.get("return"))]
+
+
+def constant(value: Any) -> Optional[str]:
+    """The Go constant of the value of a module, None if it isn't one"""
+    if isinstance(value, bool):
+        return "true" if value else "false"
+    elif isinstance(value, int):
+        return str(value)
+    elif isinstance(value, float) and math.isfinite(value):
+        return repr(value)
+    elif isinstance(value, str):
+        try:
+            value.encode("utf-8")
+        except UnicodeEncodeError:
+            return None
+        return json.dumps(value)
+    return None
+
+
+def members(module: Any) -> List[Tuple[str, str, Any]]:
+    """The (Go name, Python name, value) of the members of the module, the
+    ones of __all__ if it has one. Of two names with the same Go name,
+    like Counter and counter, the one starting with an upper case is it"""
+    all_ = getattr(module, "__all__", None)
+    found: Dict[str, Tuple[str, Any]] = {}
+    for name in sorted(all_ if all_ is not None else dir(module)):
+        exported = go_name(name)
+        if exported is None or not hasattr(module, name):
+            continue
+        if exported in found and found[exported][0] == exported:
+            continue
+        found[exported] = (name, getattr(module, name))
+    return [(exported, name, value) for exported, (name, value) in sorted(found.items())]
+
+
+def bindings(path: str, module: Any) -> str:
+    """The Go file declaring the members of the module of path"""
+    package = module_name(path).split(".")[-1]
+    lines = [f"// Code generated by gopy from the Python module {module.__name__}. DO NOT EDIT.",
+             "", f"package {param_name(package)}", "", 'import "python"', "",
+             "var _ python.Object", ""]
+    functions = names[path] = {}
+    for exported, name, value in members(module):
+        if inspect.ismodule(value):
+            continue
+        if callable(value):
+            found = signature(value)
+            if found is None:
+                continue
+            params, results = found
+            result = " " + results[0] if results else ""
+            what = "class" if inspect.isclass(value) else "function"
+            lines.append(f"// {exported} calls the {what} {name} of the Python module "
+                         f"{module.__name__}.")
+            lines.append(f"func {exported}({', '.join(params)}){result}")
+            functions[exported] = name
+        else:
+            value = constant(value)
+            if value is None:
+                continue
+            lines.append(f"// {exported} is {name} of the Python module {module.__name__}.")
+            lines.append(f"const {exported} = {value}")
+        lines.append("")
+    return "\n".join(lines)
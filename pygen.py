@@ -0,0 +1,2133 @@
+import os
+import shutil
+import keyword
+import builtins
+import checker
+import constant
+import diagnostics
+import lang
+import syntree
+import untyped
+
+from dataclasses import dataclass, field
+from fractions import Fraction
+from typing import Any, Dict, List, Optional, Set
+from checker import (basic_typename, in_order, is_integer, parameters, results,
+                     runtime_type_string, underlying)
+
+
+# The Python backend (gopy build --target=python) translates the type
+# checked AST of each package of a program into a Python 3 module, which
+# reads like one written by hand: Go functions are python functions, structs
+# are classes with their methods, constants are module level constants and
+# results are returned as tuples. What Go has and Python doesn't is in the
+# gopyrt package (imported as go), copied next to the modules: integers
+# wrapping around (go.int(a * b)), division truncated towards zero, slices
+# sharing their arrays, maps with zero values, defer, panic and recover.
+#
+# The types of the expressions are the ones found by the type checker (see
+# checker.Info), so the program has to type check. Go names become python
+# names, renamed (x_1) when they shadow a name visible in an enclosing scope,
+# since python has one scope per function. What can't be translated (like
+# goroutines and channels) is reported as a build error.
+# Ref: https://docs.python.org/3/reference/
+
+
+class Unsupported(Exception):
+    """Raised for the constructs the backend can't translate"""
+
+    def __init__(self, message: str, node=None):
+        super().__init__(message)
+        self.message = message
+        self.node = node
+
+
+# precedences of the python operators, from the loosest, the expressions
+# which never need parentheses (like calls) are ATOMs
+OR, AND, NOT, COMPARE, BIT_OR, BIT_XOR, BIT_AND, SHIFT, SUM, PRODUCT, UNARY, ATOM = range(12)
+
+
+class Code(str):
+    """Python code of an expression, with the precedence of its operator"""
+
+    prec = ATOM
+
+
+def code(text: str, prec: int) -> Code:
+    c = Code(text)
+    c.prec = prec
+    return c
+
+
+def operand(c: str, prec: int) -> str:
+    """c as the operand of an operator, in parentheses if it binds less"""
+    if isinstance(c, Code) and c.prec < prec:
+        return f"({c})"
+    return c
+
+
+binary_operators = {
+    "+": ("+", SUM), "-": ("-", SUM), "*": ("*", PRODUCT), "/": ("/", PRODUCT),
+    "%": ("%", PRODUCT), "<<": ("<<", SHIFT), ">>": (">>", SHIFT),
+    "&": ("&", BIT_AND), "|": ("|", BIT_OR), "^": ("^", BIT_XOR),
+    "==": ("==", COMPARE), "!=": ("!=", COMPARE), "<": ("<", COMPARE),
+    "<=": ("<=", COMPARE), ">": (">", COMPARE), ">=": (">=", COMPARE),
+    "&&": ("and", AND), "||": ("or", OR),
+}
+
+# the integer operations whose results are wrapped, the others give a
+# value of the type when their operands are (like & and >>)
+ring_operators = {"+", "-", "*", "<<"}
+
+# the packages of std, they are the modules of the runtime with their names
+runtime_packages = ("cmp", "errors", "fmt", "io", "math", "os", "slices", "sort", "strconv",
+                    "strings", "time")
+
+# Go names which are python keywords or builtins (which the generated code
+# uses, like len) get a trailing _, so do the names of the modules imported
+reserved = (set(keyword.kwlist) | set(dir(builtins)) | {"go", "sys"} | set(runtime_packages)) - {"_"}
+
+
+def mangle(name: str) -> str:
+    return name + "_" if name in reserved else name
+
+
+def attribute(name: str) -> str:
+    """The python name of a field or a method, only keywords can't be attributes"""
+    return name + "_" if keyword.iskeyword(name) else name
+
+
+def init_param(field: syntree.StructField) -> str:
+    """The parameter of __init__ of a struct class for the field, an embedded
+    field is named after its type, whose class __init__ uses"""
+    return "_" + attribute(field.f_name) if field.embedded else attribute(field.f_name)
+
+
+def promoted_methods(t: syntree.NamedType) -> list:
+    """The methods promoted to the struct type t from its embedded fields,
+    (name, method, path) like syntree.lookup_field_or_method selects them"""
+    names: List[str] = []
+    current, seen = [t], set()
+    while current:
+        embedded = []
+        for e in current:
+            if isinstance(e, syntree.Pointer):
+                e = e.base
+            if not isinstance(e, syntree.Type) or id(e) in seen:
+                continue
+            seen.add(id(e))
+            u = underlying(e)
+            if e is not t and isinstance(u, syntree.Interface):
+                names += [m.m_name for m in u.methods]
+            elif e is not t and isinstance(e, syntree.NamedType):
+                names += list((e.origin or e).methods)
+            if isinstance(u, syntree.Struct):
+                embedded += [f.type_ for f in u.fields if f.embedded]
+        current = embedded
+    promoted = []
+    for name in dict.fromkeys(names):
+        method, path = syntree.lookup_field_or_method(t, name)
+        if path and isinstance(method, (syntree.Method, syntree.InterfaceMethod)):
+            promoted.append((name, method, path))
+    return promoted
+
+
+@dataclass
+class Binding:
+    """What a Go name is in the generated code"""
+
+    pyname: str
+    # the nesting of the function it is declared in, 0 for the module
+    level: int
+    kind: str = "var"
+    type_: Any = None
+    # if it is declared in a loop, so each iteration has its own
+    loop: bool = False
+    constant: Any = None
+
+
+@dataclass
+class Function:
+    """The function being generated"""
+
+    level: int
+    node: Any
+    # the names assigned which are declared in the module or in
+    # enclosing functions, they are declared global or nonlocal
+    globals: Set[str] = field(default_factory=set)
+    nonlocals: Set[str] = field(default_factory=set)
+    # the python names bound in the function
+    used: Set[str] = field(default_factory=set)
+    has_literals: bool = False
+    loops: int = 0
+    # the variables of the loops of enclosing functions it reads
+    captured: Dict[str, Binding] = field(default_factory=dict)
+    # the named results, set by return statements in the body of a
+    # function with defers (see function)
+    result_names: List[str] = field(default_factory=list)
+    returns_by_names: bool = False
+    results: list = field(default_factory=list)
+
+
+@dataclass
+class Loop:
+    """A loop (or a switch, which break leaves) being generated"""
+
+    # the lines of the post statement of a for clause, run before continue
+    post: Optional[List[str]] = None
+    switch: bool = False
+
+
+# the predeclared types, calls of which (like float64(x)) are conversions
+universe = {name: Binding(mangle(name), 0, "type", obj.type_)
+            for name, obj in checker.universe().objects.items() if obj.kind == "type"}
+
+
+class Generator:
+    """Generates the python module of a package, see module"""
+
+    def __init__(self, package, info: checker.Info, modules: Dict[str, str], static: Set[int]):
+        self.package = package
+        self.info = info
+        # the module of each package of the program, by import path
+        self.modules = modules
+        self.lines: List[str] = []
+        self.indent = 0
+        self.scopes: List[Dict[str, Binding]] = [{}]
+        self.fn: Optional[Function] = None
+        self.loops: List[Loop] = []
+        # the class of each named struct type
+        self.classes: Dict[int, str] = {}
+        # the named types which aren't structs but have methods (of all the
+        # packages), which are called like functions (Meters.Double(m)), see static_method
+        self.static = static
+        # the file of each top level declaration, and of the one generated
+        self.files: Dict[int, str] = {}
+        self.file: Optional[str] = None
+        # the Go line of the statement generated, and the name of the function
+        # whose def is, in the stack traces of panics (see source_map)
+        self.line: Optional[int] = None
+        self.func: Optional[str] = None
+        self.names = syntree.function_names(
+            package.ast, "main" if package.name == "main" else package.path
+        )
+        # the selectors of the methods called, the other ones are method values
+        self.called: Set[int] = set()
+
+    # output
+
+    def emit(self, line: str = ""):
+        if line and self.line is not None:
+            # the Go source of the line, taken out by source_map
+            line += f"\0{self.file}\0{self.line}\0{self.func or ''}"
+        self.lines.append("    " * self.indent + line if line else "")
+
+    def begin(self) -> List[str]:
+        """Starts generating lines apart, for a block whose first lines are
+        known afterwards (like the global declarations of a function)"""
+        saved = self.lines
+        self.lines = []
+        self.indent += 1
+        return saved
+
+    def end(self, saved: List[str]) -> List[str]:
+        lines = self.lines
+        self.lines = saved
+        self.indent -= 1
+        return lines
+
+    def block(self, stmts: list):
+        """The statements of a block, indented"""
+        self.indent += 1
+        start = len(self.lines)
+        self.statements(stmts)
+        if len(self.lines) == start:
+            self.emit("pass")
+        self.indent -= 1
+
+    # names
+
+    def push(self):
+        self.scopes.append({})
+
+    def pop(self):
+        self.scopes.pop()
+
+    def level(self) -> int:
+        return self.fn.level if self.fn is not None else 0
+
+    def visible(self, pyname: str) -> bool:
+        return any(b.pyname == pyname for scope in self.scopes for b in scope.values())
+
+    def fresh(self, name: str) -> str:
+        """A python name for a new variable named like name, which doesn't hide
+        a name visible in an enclosing scope (python has one scope per function)"""
+        base = mangle(name)
+        pyname, n = base, 0
+        # a name used in a block before can be captured by a function literal
+        while self.visible(pyname) or (self.fn is not None and self.fn.has_literals
+                                        and pyname in self.fn.used):
+            n += 1
+            pyname = f"{base}_{n}"
+        if self.fn is not None:
+            self.fn.used.add(pyname)
+        return pyname
+
+    def declare(self, name: str, kind: str = "var", type_: Any = None, const: Any = None,
+                pyname: Optional[str] = None) -> str:
+        if name == "_":
+            return "_"
+        if pyname is None:
+            pyname = self.fresh(name) if self.fn is not None else mangle(name)
+        loop = self.fn is not None and self.fn.loops > 0
+        self.scopes[-1][name] = Binding(pyname, self.level(), kind, type_, loop, const)
+        return pyname
+
+    def lookup(self, name: str) -> Optional[Binding]:
+        for scope in reversed(self.scopes):
+            if name in scope:
+                return scope[name]
+        return universe.get(name)
+
+    def name(self, name: str) -> str:
+        """The python name of a variable read"""
+        binding = self.lookup(name)
+        if binding is None:
+            return mangle(name)
+        if binding.loop and binding.level < self.level() and self.fn.node.fn_name is None:
+            self.fn.captured[binding.pyname] = binding
+        return binding.pyname
+
+    def assigned(self, name: str) -> str:
+        """The python name of a variable assigned, declared global or nonlocal
+        if it is declared in the module or in an enclosing function"""
+        binding = self.lookup(name)
+        if name == "_":
+            return "_"
+        if binding is None:
+            return mangle(name)
+        if binding.level < self.level():
+            if binding.level == 0:
+                self.fn.globals.add(binding.pyname)
+            else:
+                self.fn.nonlocals.add(binding.pyname)
+        return binding.pyname
+
+    # types
+
+    def type_of(self, node) -> Optional[syntree.Type]:
+        x = self.info.operands.get(node)
+        return x.type_ if x is not None else None
+
+    def class_name(self, t: syntree.Type) -> str:
+        """The python class of a named struct type"""
+        origin = getattr(t, "origin", None) or t
+        if id(origin) in self.classes:
+            return self.classes[id(origin)]
+        name = attribute(origin.typename)
+        package = getattr(origin, "package", None)
+        if package is not None and package != self.package.name:
+            # the modules of the runtime keep their names (see import_)
+            return f"{package if package in runtime_packages else mangle(package)}.{name}"
+        return mangle(origin.typename)
+
+    def zero(self, t: Optional[syntree.Type], node=None) -> str:
+        """The zero value of the type"""
+        if t is None:
+            return "None"
+        u = underlying(t)
+        typename = basic_typename(u)
+        if typename is not None:
+            kind = untyped.kind_of_typename(typename)
+            if typename in ("float32", "complex64"):
+                return "go.Float32(0.0)" if typename == "float32" else "go.Complex64(0j)"
+            if kind is not None:
+                return {"bool": "False", "int": "0", "float": "0.0",
+                        "complex": "0j", "string": '""'}[kind]
+        if isinstance(t, syntree.TypeParam):
+            raise Unsupported(f"the zero value of type parameter {t.typename} is not supported",
+                              node)
+        if isinstance(u, syntree.Struct):
+            if not isinstance(t, syntree.NamedType):
+                raise Unsupported("struct types without a name are not supported", node)
+            return f"{self.class_name(t)}()"
+        elif isinstance(u, syntree.Array):
+            element = self.zero(u.eltype, node)
+            if self.mutable(u.eltype):
+                return f"go.Array([{element} for _ in range({u.length})])"
+            return f"go.Array([{element}] * {u.length})"
+        elif isinstance(u, syntree.Slice):
+            return "go.Slice()"
+        elif isinstance(u, syntree.Map):
+            return f"go.Map(zero={self.zero_factory(u.eltype, node)}, nil=True)"
+        return "None"
+
+    def mutable(self, t: syntree.Type) -> bool:
+        """If the values of the type are python objects changed in place
+        (structs and arrays), which are copied when they are assigned"""
+        return isinstance(underlying(t), (syntree.Struct, syntree.Array))
+
+    def zero_factory(self, t: syntree.Type, node=None) -> str:
+        """The zero value of the elements of a map or a slice, or a
+        function making it if each element has its own"""
+        u = underlying(t)
+        if isinstance(u, syntree.Struct) and isinstance(t, syntree.NamedType):
+            return self.class_name(t)
+        elif isinstance(u, syntree.Slice):
+            return "go.Slice"
+        elif isinstance(u, (syntree.Array, syntree.Map)):
+            return f"lambda: {self.zero(t, node)}"
+        return self.zero(t, node)
+
+    def type_test(self, t: syntree.Type, node) -> str:
+        """The second argument of go.assert_type for a type"""
+        u = underlying(t)
+        if syntree.is_interface(t):
+            names = [attribute(m.m_name) for m in getattr(u, "methods", [])]
+            return "(" + "".join(f'"{name}", ' for name in names).rstrip(" ") + ")"
+        typename = basic_typename(u)
+        if typename is not None:
+            return f'"{typename}"'
+        if isinstance(u, syntree.Pointer):
+            return self.type_test(u.base, node)
+        if isinstance(u, syntree.Struct) and isinstance(t, syntree.NamedType):
+            return self.class_name(t)
+        elif isinstance(u, syntree.Slice):
+            return "go.Slice"
+        elif isinstance(u, syntree.Map):
+            return "go.Map"
+        raise Unsupported(f"type assertions to {checker.type_string(t)} are not supported", node)
+
+    # constants
+
+    def const_literal(self, c: constant.Constant, t: Optional[syntree.Type]) -> Code:
+        """A python literal for a constant of type t (its default type if t is None)"""
+        typename = basic_typename(t) if t is not None else None
+        if typename is None or untyped.kind_of_typename(typename) is None:
+            typename = c.typename or untyped.default_typename(c.kind)
+        if c.typename != typename:
+            try:
+                c = constant.convert(c, typename)
+            except constant.ConstError:
+                pass
+        if c.kind == "bool":
+            return code("True" if c.value else "False", ATOM)
+        elif c.kind == "string":
+            return code(python_string(c.value), ATOM)
+        kind = untyped.kind_of_typename(typename)
+        if kind == "float":
+            value = c.value[0] if c.kind == "complex" else c.value
+            literal = float_literal(constant._fraction_to_float(Fraction(value)))
+            if typename == "float32":
+                return code(f"go.Float32({literal})", ATOM)
+            return literal
+        elif kind == "complex":
+            real, imag = untyped.to_kind(c.kind, c.value, "complex")
+            real, imag = constant._fraction_to_float(real), constant._fraction_to_float(imag)
+            cls = "go.Complex64" if typename == "complex64" else "complex"
+            return code(f"{cls}({float_literal(real)}, {float_literal(imag)})", ATOM)
+        value = untyped.to_integer(c.kind, c.value)
+        return code(str(value), UNARY if value < 0 else ATOM)
+
+    def python_kind(self, c: constant.Constant, t: Optional[syntree.Type]) -> str:
+        typename = basic_typename(t) if t is not None else None
+        if typename is None or untyped.kind_of_typename(typename) is None:
+            typename = c.typename or untyped.default_typename(c.kind)
+        return untyped.kind_of_typename(typename)
+
+    # declarations
+
+    def module(self) -> str:
+        """The python module of the package"""
+        decls = []
+        for file in reversed(self.package.ast.children):
+            for child in file.children:
+                for decl in in_order(child):
+                    decls.append(decl)
+                    self.files[id(decl)] = file.filename
+        files = ", ".join(os.path.basename(file.filename) for file in reversed(self.package.ast.children))
+
+        imports = []
+        for decl in decls:
+            if isinstance(decl, syntree.Import):
+                self.file = self.files[id(decl)]
+                try:
+                    line = self.import_(decl)
+                except Unsupported as e:
+                    if diagnostics.strict:
+                        raise
+                    self.skip(e, "import")
+                    continue
+                # the files of a package can import the same packages
+                if line not in imports:
+                    imports.append(line)
+
+        # the package level names are visible in the whole package
+        for decl in decls:
+            if isinstance(decl, syntree.Method) or isinstance(decl, syntree.Import):
+                continue
+            elif isinstance(decl, syntree.Function):
+                if decl.fn_name[1] == "init":
+                    continue
+                self.declare(decl.fn_name[1], "func")
+            elif isinstance(decl, syntree.TypeDef):
+                self.declare(decl.typename[1], "type", decl.type_)
+                self.classes[id(decl.type_)] = mangle(decl.typename[1])
+            elif isinstance(decl, syntree.VarDecl):
+                obj = self.info.defs.get(decl.ident)
+                self.declare(decl.ident.ident_name, "const" if decl.const else "var",
+                             obj.type_ if obj is not None else None,
+                             obj.constant if obj is not None else None)
+
+        self.emit(f"# Generated by gopy from package {self.package.name} ({files}), do not edit")
+        self.emit()
+        self.emit("import gopyrt as go")
+        for line in imports:
+            self.emit(line)
+
+        consts = [d for d in decls if isinstance(d, syntree.VarDecl) and d.const]
+        if consts:
+            self.emit()
+            for decl in consts:
+                self.file = self.files[id(decl)]
+                self.const_decl(decl)
+
+        methods: Dict[str, list] = {}
+        for decl in decls:
+            if isinstance(decl, syntree.Method):
+                methods.setdefault(decl.base_type.typename, []).append(decl)
+        for decl in decls:
+            if isinstance(decl, syntree.TypeDef):
+                self.file = self.files[id(decl)]
+                self.type_decl(decl, methods.pop(decl.typename[1], []))
+        for method in methods.values():
+            raise Unsupported("methods of types declared in another package", method[0])
+
+        inits = []
+        for decl in decls:
+            if isinstance(decl, syntree.Function) and not isinstance(decl, syntree.Method):
+                self.file = self.files[id(decl)]
+                self.emit()
+                self.emit()
+                name = decl.fn_name[1]
+                if name == "init":
+                    # a package can have several init functions
+                    name = "init" if not inits else f"init_{len(inits)}"
+                    inits.append(name)
+                self.function(decl, mangle(name) if name != "init" else name)
+
+        variables = [d for d in decls if isinstance(d, syntree.VarDecl) and not d.const]
+        if variables:
+            self.emit()
+            self.emit()
+            # each one after the ones its value refers to, see checker.init_order
+            for decl in self.info.init_order.get(self.package.ast, variables):
+                self.file = self.files[id(decl)]
+                self.statements([decl])
+        for name in inits:
+            self.emit(f"{name}()")
+        self.source_map()
+
+        if self.package.name == "main":
+            self.emit()
+            self.emit()
+            self.emit('if __name__ == "__main__":')
+            self.emit("    go.run(main)")
+        return "\n".join(self.lines) + "\n"
+
+    def source_map(self):
+        """Takes the Go file and line out of the lines generated, to the
+        tables gopyrt.run prints the stack trace of a panic with: the Go
+        file and line of the python lines (by index in __gopy_files__), and
+        the names of the Go functions by the line of their def (and the
+        decorator of it)"""
+        files: List[str] = []
+        lines: Dict[int, tuple] = {}
+        funcs: Dict[int, str] = {}
+        for i, line in enumerate(self.lines):
+            if "\0" not in line:
+                continue
+            self.lines[i], file, lineno, func = line.split("\0")
+            if file not in files:
+                files.append(file)
+            lines[i + 1] = (files.index(file), int(lineno))
+            if func:
+                funcs[i + 1] = func
+        self.emit()
+        self.emit()
+        self.emit("# the Go source of the lines, for the stack traces of panics (see go.run)")
+        quoted = [python_string(file.encode()) for file in files]
+        self.emit(f"__gopy_files__ = ({', '.join(quoted)}{',' if len(files) == 1 else ''})")
+        self.emit("__gopy_lines__ = {")
+        items = [f"{i}: ({file}, {lineno})," for i, (file, lineno) in lines.items()]
+        for k in range(0, len(items), 8):
+            self.emit("    " + " ".join(items[k:k + 8]))
+        self.emit("}")
+        self.emit("__gopy_funcs__ = {")
+        for i, func in funcs.items():
+            self.emit(f"    {i}: {python_string(func.encode())},")
+        self.emit("}")
+
+    def import_(self, decl: syntree.Import) -> str:
+        name, path = decl.data
+        path = path[1].strip('"')
+        name = name[1] if isinstance(name, tuple) else path.split("/")[-1]
+        if path in runtime_packages:
+            # the name of the module is reserved for the package itself
+            self.declare(name, "package", pyname=path if name == path else mangle(name))
+            return (f"from gopyrt import {path}" if name == path
+                    else f"from gopyrt import {path} as {mangle(name)}")
+        if path not in self.modules:
+            raise Unsupported(f"package {path} is not supported by the python backend", decl)
+        module = self.modules[path]
+        self.declare(name, "package", pyname=mangle(name))
+        return f"import {module}" if mangle(name) == module else f"import {module} as {mangle(name)}"
+
+    def const_decl(self, decl: syntree.VarDecl):
+        obj = self.info.defs.get(decl.ident)
+        if decl.ident.ident_name == "_" or obj is None or obj.constant is None:
+            return
+        if self.fn is None:
+            pyname = self.lookup(decl.ident.ident_name).pyname
+        else:
+            pyname = self.declare(decl.ident.ident_name, "const", obj.type_, obj.constant)
+        self.emit(f"{pyname} = {self.const_literal(obj.constant, obj.type_)}")
+
+    def type_decl(self, decl: syntree.TypeDef, methods: list):
+        t = decl.type_
+        u = underlying(t)
+        if decl.type_ is not None and not isinstance(t, syntree.NamedType):
+            # an alias
+            return
+        if not isinstance(u, syntree.Struct):
+            # values of the type are values of its underlying type
+            if not methods:
+                return
+            for method in methods:
+                if method.pointer_receiver:
+                    raise Unsupported("methods with pointer receivers of types which are not "
+                                      "structs are not supported by the python backend", method)
+            name = self.scopes[-1][decl.typename[1]].pyname if self.fn is None else \
+                self.declare(decl.typename[1], "type", t)
+            self.static.add(id(t))
+            self.emit()
+            self.emit()
+            self.emit(f"class {name}:")
+            self.indent += 1
+            self.emit(f'"""The methods of {decl.typename[1]}, called like {name}.m(x)"""')
+            self.methods(methods)
+            self.indent -= 1
+            return
+        name = self.scopes[-1][decl.typename[1]].pyname if self.fn is None else \
+            self.declare(decl.typename[1], "type", t)
+        self.classes[id(t)] = name
+        self.emit()
+        self.emit()
+        self.emit(f"class {name}(go.Struct):")
+        self.indent += 1
+        fields = [attribute(f.f_name) for f in u.fields]
+        names = ", ".join(f'"{f}"' for f in fields)
+        self.emit(f"_fields = ({names}{',' if len(fields) == 1 else ''})")
+        self.emit("__slots__ = _fields")
+        if fields:
+            self.emit()
+            params = []
+            body = []
+            for f, pyname in zip(u.fields, fields):
+                param = init_param(f)
+                if isinstance(f.type_, syntree.TypeParam):
+                    # the values of the fields of generic structs are given
+                    params.append(f"{param}=None")
+                    body.append(f"self.{pyname} = {param}")
+                elif self.mutable(f.type_) or isinstance(underlying(f.type_), (syntree.Slice,
+                                                                              syntree.Map)):
+                    params.append(f"{param}=None")
+                    body.append(f"self.{pyname} = {self.zero(f.type_, decl)} "
+                                f"if {param} is None else {param}")
+                else:
+                    params.append(f"{param}={self.zero(f.type_, decl)}")
+                    body.append(f"self.{pyname} = {param}")
+            self.emit(f"def __init__(self, {', '.join(params)}):")
+            for line in body:
+                self.emit("    " + line)
+        self.promoted(t)
+        self.methods(methods)
+        self.indent -= 1
+
+    def promoted(self, t: syntree.NamedType):
+        """Emits the methods promoted to the struct type t from its embedded
+        fields, calling the ones of the fields (a.m() is a.B.m()), for the
+        calls of the methods of interface values and method expressions"""
+        for name, method, path in promoted_methods(t):
+            embedded = path[-1].type_
+            if isinstance(embedded, syntree.Pointer):
+                embedded = embedded.base
+            field = ".".join(["self"] + [attribute(f.f_name) for f in path])
+            self.emit()
+            self.emit(f"def {attribute(name)}(self, *args):")
+            if isinstance(method, syntree.Method) and not isinstance(underlying(embedded),
+                                                                     syntree.Struct):
+                # the methods of the types which aren't structs, see static_method
+                self.emit(f"    return {self.class_name(embedded)}.{attribute(name)}"
+                          f"({field}, *args)")
+            else:
+                self.emit(f"    return {field}.{attribute(name)}(*args)")
+
+    def methods(self, methods: list):
+        for method in methods:
+            self.file = self.files.get(id(method), self.file)
+            self.emit()
+            self.function(method, attribute(method.fn_name[1]))
+
+    def function(self, node: syntree.Function, name: str, literal: bool = False):
+        """Emits a def for the function (or method, or function literal)"""
+        signature = node.signature
+        outer = self.fn
+        fn = Function(level=self.level() + 1, node=node)
+        fn.has_literals = any(isinstance(n, syntree.Function)
+                              for n in syntree.walk(node.body, True))
+        fn.results = results(signature)
+        self.fn = fn
+        self.push()
+        loops = self.loops
+        self.loops = []
+
+        params = []
+        if isinstance(node, syntree.Method):
+            for ident, _, _ in parameters(node.receiver):
+                params.append(self.parameter(ident))
+        for ident, type_, _ in parameters(signature.parameters):
+            params.append(self.parameter(ident))
+
+        defers = any(isinstance(n, syntree.DeferStmt) for n in syntree.walk(node.body, False))
+        saved = self.begin()
+        receiver_copied = (isinstance(node, syntree.Method) and not node.pointer_receiver
+                           and self.mutable(node.receiver_type) and params[0] != "_"
+                           and modifies(node.body, receiver_name(node)))
+        if receiver_copied:
+            # the receiver is a copy of the value the method is called on
+            self.emit(f"{params[0]} = {params[0]}.copy()")
+        if signature.has_named_results:
+            names = []
+            for ident, type_, _ in parameters(signature.result):
+                pyname = self.declare(ident.ident_name if ident is not None else "_", "var", type_)
+                if pyname == "_":
+                    pyname = self.fresh("result")
+                names.append(pyname)
+                self.emit(f"{pyname} = {self.zero(type_, node)}")
+            if defers:
+                self.named_results_body(node, names)
+            else:
+                fn.result_names = names
+                self.statements(in_order(node.body))
+        else:
+            self.statements(in_order(node.body))
+        lines = self.end(saved)
+
+        self.pop()
+        self.loops = loops
+        self.fn = outer
+        if literal:
+            # each iteration of a loop has its own variables, they are bound
+            # when the function is made, unless it assigns them
+            for pyname in sorted(fn.captured):
+                if pyname not in fn.nonlocals:
+                    params.append(f"{pyname}={pyname}")
+        line, self.line, self.func = self.line, node.lineno, self.names.get(id(node))
+        if self.func is not None:
+            has_params = isinstance(node, syntree.Method) or parameters(signature.parameters)
+            self.func += "(...)" if has_params else "()"
+        if defers and not signature.has_named_results:
+            zero = self.zero_results(fn.results, node)
+            self.emit("@go.deferring" if zero is None else f"@go.deferring(zero={zero})")
+        self.emit(f"def {name}({', '.join(params)}):")
+        self.line, self.func = line, None
+        if fn.globals:
+            self.emit(f"    global {', '.join(sorted(fn.globals))}")
+        if fn.nonlocals:
+            self.emit(f"    nonlocal {', '.join(sorted(fn.nonlocals))}")
+        if not lines:
+            self.emit("    pass")
+        self.lines.extend(lines)
+        if outer is not None:
+            # the function reads the variables its literals capture
+            for pyname, binding in fn.captured.items():
+                if binding.level < outer.level and outer.node.fn_name is None:
+                    outer.captured[pyname] = binding
+            for pyname in fn.nonlocals:
+                binding = next((b for scope in self.scopes for b in scope.values()
+                                if b.pyname == pyname), None)
+                if binding is not None and binding.level < outer.level:
+                    outer.nonlocals.add(pyname)
+
+    def named_results_body(self, node: syntree.Function, names: List[str]):
+        """The body of a function with named results and defers, in a function
+        of its own: the deferred calls can change the results once it returns"""
+        outer = self.fn
+        body = self.fresh("body")
+        fn = Function(level=outer.level + 1, node=node, has_literals=outer.has_literals,
+                      results=outer.results, result_names=names, returns_by_names=True)
+        self.fn = fn
+        self.push()
+        saved = self.begin()
+        self.statements(in_order(node.body))
+        lines = self.end(saved)
+        self.pop()
+        self.fn = outer
+        self.emit("@go.deferring")
+        self.emit(f"def {body}():")
+        if fn.globals:
+            self.emit(f"    global {', '.join(sorted(fn.globals))}")
+        if fn.nonlocals:
+            self.emit(f"    nonlocal {', '.join(sorted(fn.nonlocals))}")
+        self.lines.extend(lines or ["    " * (self.indent + 1) + "pass"])
+        self.emit()
+        self.emit(f"{body}()")
+        self.emit(f"return {', '.join(names)}")
+        outer.globals |= fn.globals
+
+    def parameter(self, ident) -> str:
+        if ident is None or ident.ident_name == "_":
+            return self.fresh("_")
+        obj = self.info.defs.get(ident)
+        return self.declare(ident.ident_name, "var", obj.type_ if obj is not None else None)
+
+    def zero_results(self, types: list, node) -> Optional[str]:
+        """The results of a function stopped by a panic which is recovered"""
+        if not types:
+            return None
+        zeros = [self.zero(t, node) for t in types]
+        return zeros[0] if len(zeros) == 1 else f"({', '.join(zeros)})"
+
+    # statements
+
+    def statements(self, stmts: list):
+        # the VarDecls of a spec like a, b := f() are generated once
+        unpacked: Set[int] = set()
+        line = self.line
+        for stmt in stmts:
+            mark = self.lines, len(self.lines), self.indent, len(self.scopes), len(self.loops)
+            self.line = checker.statement_line(stmt) or line
+            try:
+                self.statement(stmt, unpacked)
+            except Unsupported as e:
+                if e.node is None:
+                    e.node = stmt
+                if diagnostics.strict:
+                    raise
+                # skipped in permissive mode, without the lines generated for it
+                self.rewind(*mark)
+                self.skip(e, "statement")
+        self.line = line
+
+    def skip(self, e: Unsupported, what: str):
+        """Reports the construct skipped in permissive mode, see diagnostics.strict"""
+        lineno, col_num, width = checker.position(e.node)
+        diagnostics.report(diagnostics.unsupported(
+            f"{e.message}, the {what} is skipped", lineno, col_num, width,
+            kind="BUILD ERROR", file=self.file
+        ))
+
+    def rewind(self, lines: List[str], count: int, indent: int, scopes: int, loops: int):
+        """Drops the lines generated from count on, with the scopes and the
+        loops of the statement they are the code of"""
+        self.lines = lines
+        del self.lines[count:], self.scopes[scopes:], self.loops[loops:]
+        self.indent = indent
+
+    def statement(self, stmt, unpacked: Set[int]):
+        if isinstance(stmt, syntree.Block):
+            self.push()
+            self.statements(in_order(stmt))
+            self.pop()
+
+        elif isinstance(stmt, syntree.List):
+            self.statements(in_order(stmt))
+
+        elif isinstance(stmt, syntree.VarDecl):
+            self.var_decl(stmt, unpacked)
+
+        elif isinstance(stmt, syntree.TypeDef):
+            self.type_decl(stmt, [])
+
+        elif isinstance(stmt, syntree.IfStmt):
+            self.push()
+            if stmt.statement is not None:
+                self.statements(in_order(stmt.statement))
+            self.if_stmt(stmt, "if")
+            self.pop()
+
+        elif isinstance(stmt, syntree.TypeSwitchStmt):
+            self.type_switch_stmt(stmt)
+
+        elif isinstance(stmt, syntree.SwitchStmt):
+            self.switch_stmt(stmt)
+
+        elif isinstance(stmt, syntree.ForStmt):
+            self.for_stmt(stmt)
+
+        elif isinstance(stmt, syntree.Keyword):
+            self.keyword(stmt)
+
+        elif isinstance(stmt, syntree.Assignment):
+            self.assignment(stmt)
+
+        elif isinstance(stmt, syntree.DeferStmt):
+            self.defer(stmt)
+
+        elif isinstance(stmt, syntree.UnaryOp) and stmt.operator in ("++", "--"):
+            operator = "+" if stmt.operator == "++" else "-"
+            self.update(stmt.operand, operator, code("1", ATOM), stmt)
+
+        elif isinstance(stmt, (syntree.GoStmt, syntree.SendStmt, syntree.SelectStmt)):
+            raise Unsupported(f"{stmt.name.lower()} statements are not supported "
+                              "by the python backend", stmt)
+
+        elif isinstance(stmt, syntree.LabeledStmt):
+            raise Unsupported("labels are not supported by the python backend", stmt)
+
+        elif isinstance(stmt, syntree.FunctionCall) or isinstance(stmt, syntree.Node):
+            self.emit(self.expr(stmt))
+
+    def var_decl(self, decl: syntree.VarDecl, unpacked: Set[int]):
+        if decl.const:
+            self.const_decl(decl)
+            return
+        if decl.unpack is not None:
+            ident_list, expression_list = decl.unpack
+            if id(expression_list) in unpacked:
+                return
+            unpacked.add(id(expression_list))
+            idents = in_order(ident_list)
+            exprs = in_order(expression_list)
+            types = [self.var_type(ident) for ident in idents]
+            values = self.values(exprs, types)
+            names = [self.declare_var(ident) for ident in idents]
+            self.emit(f"{', '.join(names)} = {values}")
+            return
+        t = self.var_type(decl.ident)
+        if isinstance(decl.value, syntree.Function) and self.fn is not None:
+            # f := func() {...} is a def named f
+            self.function_literal(decl.value, self.declare_var(decl.ident))
+            return
+        if decl.value is not None:
+            value = self.value(decl.value, t)
+        else:
+            value = self.zero(t, decl)
+        self.emit(f"{self.declare_var(decl.ident)} = {value}")
+
+    def var_type(self, ident) -> Optional[syntree.Type]:
+        obj = self.info.defs.get(ident) or self.info.redeclared.get(ident)
+        return obj.type_ if obj is not None else None
+
+    def declare_var(self, ident) -> str:
+        # like err in b, err := g(), the variable is assigned
+        if self.fn is None or ident in self.info.redeclared:
+            return self.assigned(ident.ident_name)
+        return self.declare(ident.ident_name, "var", self.var_type(ident))
+
+    def if_stmt(self, stmt: syntree.IfStmt, keyword: str):
+        start = len(self.lines)
+        cond = self.expr(stmt.expr)
+        if keyword == "elif" and len(self.lines) != start:
+            # the condition needs statements before it, the chain goes on in the else
+            lines = self.lines[start:]
+            del self.lines[start:]
+            self.emit("else:")
+            self.indent += 1
+            self.lines.extend("    " + line for line in lines)
+            self.emit(f"if {cond}:")
+            self.if_body(stmt)
+            self.indent -= 1
+            return
+        self.emit(f"{keyword} {cond}:")
+        self.if_body(stmt)
+
+    def if_body(self, stmt: syntree.IfStmt):
+        self.push()
+        self.block(in_order(stmt.body))
+        self.pop()
+        if isinstance(stmt.next_, syntree.IfStmt):
+            if stmt.next_.statement is not None:
+                self.emit("else:")
+                self.indent += 1
+                self.push()
+                self.statements(in_order(stmt.next_.statement))
+                self.if_stmt(stmt.next_, "if")
+                self.pop()
+                self.indent -= 1
+            else:
+                self.if_stmt(stmt.next_, "elif")
+        elif stmt.next_ is not None:
+            self.emit("else:")
+            self.push()
+            self.block(in_order(stmt.next_))
+            self.pop()
+
+    def for_stmt(self, stmt: syntree.ForStmt):
+        clause = stmt.clause
+        self.push()
+        self.fn.loops += 1
+        if isinstance(clause, syntree.RangeClause):
+            self.range_loop(stmt, clause)
+        elif isinstance(clause, syntree.ForClause):
+            counted = self.counted_loop(stmt, clause)
+            if counted is None:
+                self.statements(in_order(clause.init))
+                cond = "True" if clause.cond is None else self.expr(clause.cond)
+                saved = self.begin()
+                self.statements(in_order(clause.post))
+                post = self.end(saved)
+                self.emit(f"while {cond}:")
+                self.loop_body(stmt, Loop(post=post))
+                self.lines.extend(post)
+            else:
+                self.emit(counted)
+                self.loop_body(stmt, Loop())
+        else:
+            cond = "True" if clause is None else self.expr(clause)
+            self.emit(f"while {cond}:")
+            self.loop_body(stmt, Loop())
+        self.fn.loops -= 1
+        self.pop()
+
+    def loop_body(self, stmt: syntree.ForStmt, loop: Loop):
+        if not lang.allows(lang.loop_var):
+            # before Go 1.22 the iterations share the variables the loop
+            # declares, the function literals of the body don't bind them
+            for binding in self.scopes[-1].values():
+                binding.loop = False
+        self.loops.append(loop)
+        self.push()
+        self.block(in_order(stmt.body))
+        self.pop()
+        self.loops.pop()
+
+    def counted_loop(self, stmt: syntree.ForStmt, clause: syntree.ForClause) -> Optional[str]:
+        """for i := a; i < b; i++ as a for over a range, if neither i nor b
+        change in the body (and b is a constant or a variable)"""
+        init, post, cond = in_order(clause.init), in_order(clause.post), clause.cond
+        if len(init) != 1 or len(post) != 1 or not isinstance(init[0], syntree.VarDecl):
+            return None
+        decl = init[0]
+        name = decl.ident.ident_name
+        t = self.var_type(decl.ident)
+        if decl.value is None or basic_typename(t) not in untyped.int_typenames:
+            return None
+        step = post[0]
+        if not (isinstance(step, syntree.UnaryOp) and step.operator in ("++", "--")
+                and is_name(step.operand, name)):
+            return None
+        up = step.operator == "++"
+        if not (isinstance(cond, syntree.BinOp)
+                and cond.operator in (("<", "<=") if up else (">", ">="))
+                and is_name(cond.left, name)):
+            return None
+        bound = cond.right
+        changed = modified_names(stmt.body)
+        if name in changed or not self.loop_bound(bound, changed):
+            return None
+        if not lang.allows(lang.loop_var) and any(isinstance(n, syntree.Function)
+                                                   for n in syntree.walk(stmt.body, True)):
+            # the function literals see the value after the last iteration
+            return None
+        start = self.expr(decl.value)
+        end = self.expr(bound)
+        if cond.operator in ("<=", ">="):
+            end = code(f"{operand(end, SUM)} {'+' if up else '-'} 1", SUM)
+        pyname = self.declare(name, "var", t)
+        if up:
+            if start == "0":
+                return f"for {pyname} in range({end}):"
+            return f"for {pyname} in range({start}, {end}):"
+        return f"for {pyname} in range({start}, {end}, -1):"
+
+    def loop_bound(self, bound, changed: Set[str]) -> bool:
+        """If the bound of a counted loop is the same in each iteration: a
+        constant, or a variable (or the length of one) the body doesn't assign"""
+        x = self.info.operands.get(bound)
+        if x is not None and x.mode == "constant":
+            return True
+        if isinstance(bound, syntree.FunctionCall) and bound.fn_name == "len" \
+                and self.lookup("len") is None:
+            args = in_order(bound.arguments.expression_list)
+            return len(args) == 1 and self.loop_bound(args[0], changed)
+        if isinstance(bound, syntree.List):
+            bound = in_order(bound)[0]
+        if isinstance(bound, syntree.PrimaryExpr) and not bound.children \
+                and isinstance(bound.data, tuple) and bound.data[1] not in changed:
+            binding = self.lookup(bound.data[1])
+            return binding is not None and binding.kind in ("var", "const")
+        return False
+
+    def range_loop(self, stmt: syntree.ForStmt, clause: syntree.RangeClause):
+        t = self.type_of(clause.expr)
+        u = underlying(t) if t is not None else None
+        x = self.expr(clause.expr)
+        if isinstance(u, syntree.Pointer):
+            u = underlying(u.base)
+
+        targets = in_order(clause.ident_list if clause.ident_list is not None
+                           else clause.expr_list)
+        if clause.ident_list is not None:
+            names = [self.declare_var(ident) for ident in targets]
+        else:
+            names = [self.target(target) for target in targets]
+        key = names[0] if names else "_"
+        value = names[1] if len(names) > 1 and names[1] != "_" else None
+
+        copied = None
+        if basic_typename(u) in untyped.int_typenames or basic_typename(u) == "untyped int":
+            self.emit(f"for {key} in range({x}):")
+        elif basic_typename(u) == "string":
+            self.emit(f"for {key}, {value or '_'} in go.runes({x}):")
+        elif isinstance(u, (syntree.Slice, syntree.Array)):
+            if value is None:
+                self.emit(f"for {key} in range(len({x})):")
+            elif key == "_":
+                self.emit(f"for {value} in {x}:")
+            else:
+                self.emit(f"for {key}, {value} in enumerate({x}):")
+            if value is not None and self.mutable(u.eltype):
+                copied = value
+        elif isinstance(u, syntree.Map):
+            if value is None:
+                self.emit(f"for {key} in go.keys({x}):")
+            else:
+                self.emit(f"for {key}, {value} in go.items({x}):")
+            if value is not None and self.mutable(u.eltype):
+                copied = value
+        else:
+            raise Unsupported(f"range over {checker.type_string(t)} is not supported "
+                              "by the python backend", stmt)
+        if copied is not None and copied in modified_names(stmt.body, roots=True):
+            # the variable is a copy of the element
+            self.indent += 1
+            self.emit(f"{copied} = {copied}.copy()")
+            self.indent -= 1
+        self.loop_body(stmt, Loop())
+
+    def switch_stmt(self, stmt: syntree.SwitchStmt):
+        self.push()
+        if stmt.statement is not None:
+            self.statements(in_order(stmt.statement))
+        tag = None
+        if stmt.expr is not None:
+            tag = self.expr(stmt.expr)
+            if not (isinstance(stmt.expr, syntree.PrimaryExpr) and not stmt.expr.children):
+                pyname = self.fresh("tag")
+                self.emit(f"{pyname} = {tag}")
+                tag = code(pyname, ATOM)
+
+        clauses = in_order(stmt.clauses)
+        breaks = any(breaks_out(clause.body) for clause in clauses)
+        if breaks:
+            # break leaves the switch, which is a loop run once
+            if any(continues_in(clause.body) for clause in clauses):
+                raise Unsupported("continue in a switch with break is not supported "
+                                  "by the python backend", stmt)
+            self.emit("while True:")
+            self.indent += 1
+            self.loops.append(Loop(switch=True))
+
+        cases = [c for c in clauses if not c.is_default]
+        default = next((c for c in clauses if c.is_default), None)
+        for i, clause in enumerate(cases):
+            conds = []
+            tag_type = self.type_of(stmt.expr) if stmt.expr is not None else None
+            for expr in in_order(clause.exprs):
+                if tag is None:
+                    conds.append(self.expr(expr))
+                else:
+                    conds.append(self.equality(tag, tag_type, expr, "=="))
+            cond = conds[0] if len(conds) == 1 else code(
+                " or ".join(operand(c, OR + 1) for c in conds), OR)
+            self.emit(f"{'if' if i == 0 else 'elif'} {cond}:")
+            self.case_body(clauses, clauses.index(clause))
+        if default is not None:
+            if cases:
+                self.emit("else:")
+                self.case_body(clauses, clauses.index(default))
+            else:
+                self.push()
+                self.statements(in_order(default.body))
+                self.pop()
+
+        if breaks:
+            self.emit("break")
+            self.loops.pop()
+            self.indent -= 1
+        self.pop()
+
+    def type_switch_stmt(self, stmt: syntree.TypeSwitchStmt):
+        self.push()
+        if stmt.statement is not None:
+            self.statements(in_order(stmt.statement))
+        x = self.expr(stmt.expr)
+        if not (isinstance(stmt.expr, syntree.PrimaryExpr) and not stmt.expr.children):
+            pyname = self.fresh("x")
+            self.emit(f"{pyname} = {x}")
+            x = code(pyname, ATOM)
+
+        clauses = in_order(stmt.clauses)
+        breaks = any(breaks_out(clause.body) for clause in clauses)
+        if breaks:
+            # break leaves the switch, which is a loop run once
+            if any(continues_in(clause.body) for clause in clauses):
+                raise Unsupported("continue in a switch with break is not supported "
+                                  "by the python backend", stmt)
+            self.emit("while True:")
+            self.indent += 1
+            self.loops.append(Loop(switch=True))
+
+        # interface values are the python values, nil is None
+        cases = [c for c in clauses if not c.is_default]
+        default = next((c for c in clauses if c.is_default), None)
+        for i, clause in enumerate(cases):
+            conds = []
+            for case in in_order(clause.types):
+                if case.nil:
+                    conds.append(code(f"{x} is None", COMPARE))
+                else:
+                    conds.append(code(f"go.has_type({x}, {self.type_test(case.type_, case)})", ATOM))
+            cond = conds[0] if len(conds) == 1 else code(
+                " or ".join(operand(c, OR + 1) for c in conds), OR)
+            self.emit(f"{'if' if i == 0 else 'elif'} {cond}:")
+            self.indent += 1
+            self.type_case_body(clause, x)
+            self.indent -= 1
+        if default is not None:
+            if cases:
+                self.emit("else:")
+                self.indent += 1
+            self.type_case_body(default, x)
+            if cases:
+                self.indent -= 1
+
+        if breaks:
+            self.emit("break")
+            self.loops.pop()
+            self.indent -= 1
+        self.pop()
+
+    def type_case_body(self, clause: syntree.TypeCaseClause, x: Code):
+        """The body of a clause of a type switch on x, with its variable"""
+        start = len(self.lines)
+        self.push()
+        obj = self.info.defs.get(clause.ident) if clause.ident is not None else None
+        if obj is not None and uses_name(clause.body, obj.name):
+            name = self.declare(obj.name, "var", obj.type_)
+            # a value asserted to be of a struct or array type is a copy
+            copied = (not clause.is_default and len(in_order(clause.types)) == 1
+                      and self.mutable(obj.type_) and modifies(clause.body, obj.name))
+            self.emit(f"{name} = {x}.copy()" if copied else f"{name} = {x}")
+        self.statements(in_order(clause.body))
+        self.pop()
+        if len(self.lines) == start:
+            self.emit("pass")
+
+    def case_body(self, clauses: list, i: int):
+        """The body of a case clause, and the next ones it falls through to"""
+        body = []
+        while i < len(clauses):
+            stmts = in_order(clauses[i].body)
+            fallthrough = (bool(stmts) and isinstance(stmts[-1], syntree.Keyword)
+                           and stmts[-1].kw == "FALLTHROUGH")
+            body.append(stmts[:-1] if fallthrough else stmts)
+            if not fallthrough:
+                break
+            i += 1
+        self.indent += 1
+        start = len(self.lines)
+        for stmts in body:
+            self.push()
+            self.statements(stmts)
+            self.pop()
+        if len(self.lines) == start:
+            self.emit("pass")
+        self.indent -= 1
+
+    def keyword(self, stmt: syntree.Keyword):
+        if stmt.label is not None:
+            raise Unsupported("labels are not supported by the python backend", stmt)
+        if stmt.kw == "BREAK":
+            self.emit("break")
+        elif stmt.kw == "CONTINUE":
+            loop = next(loop for loop in reversed(self.loops) if not loop.switch)
+            if loop.post:
+                self.lines.extend(loop.post)
+            self.emit("continue")
+        elif stmt.kw == "RETURN":
+            exprs = in_order(stmt.children[0]) if stmt.children else []
+            fn = self.fn
+            if fn.returns_by_names:
+                if exprs:
+                    names = [self.assigned_pyname(n) for n in fn.result_names]
+                    self.emit(f"{', '.join(names)} = {self.values(exprs, fn.results)}")
+                self.emit("return")
+            elif not exprs and fn.result_names:
+                self.emit(f"return {', '.join(fn.result_names)}")
+            elif not exprs:
+                self.emit("return")
+            else:
+                self.emit(f"return {self.values(exprs, fn.results)}")
+        else:
+            raise Unsupported(f"{stmt.kw.lower()} statements are not supported "
+                              "by the python backend", stmt)
+
+    def assigned_pyname(self, pyname: str) -> str:
+        """A python name assigned, which is declared in an enclosing function"""
+        for scope in self.scopes:
+            for name, binding in scope.items():
+                if binding.pyname == pyname:
+                    return self.assigned(name)
+        return pyname
+
+    def assignment(self, stmt: syntree.Assignment):
+        lhs = in_order(stmt.left)
+        rhs = in_order(stmt.right)
+        if stmt.operator != "=":
+            self.update(lhs[0], stmt.operator[:-1], self.expr(rhs[0]), stmt, rhs[0])
+            return
+        types = [self.type_of(target) for target in lhs]
+        values = self.values(rhs, types)
+        if len(lhs) == 1 and self.addressed_struct(lhs[0]):
+            self.emit(f"{self.expr(lhs[0].operand)}.set({values})")
+            return
+        targets = [self.target(target) for target in lhs]
+        for i, target in enumerate(lhs):
+            assigned_before = any(isinstance(t, syntree.PrimaryExpr) and not t.children
+                                  and isinstance(t.data, tuple) and t.data[1] != "_"
+                                  for t in lhs[:i])
+            if assigned_before and isinstance(target, syntree.PrimaryExpr) and target.children:
+                targets[i] = self.operands_first(target)
+        self.emit(f"{', '.join(targets)} = {values}")
+
+    def operands_first(self, target: syntree.PrimaryExpr) -> str:
+        """The target of an index or a field, with its operands evaluated before
+        the variables before it are assigned (python assigns them in order), like
+        values[j] in j, values[j] = 2, 99"""
+        last = target.children[-1]
+        if not isinstance(last, (syntree.Index, syntree.Selector)):
+            return self.target(target)
+        base = self.fresh("base")
+        self.emit(f"{base} = {self.primary(target, len(target.children) - 1)}")
+        if isinstance(last, syntree.Selector):
+            return self.step(code(base, ATOM), last, target.children[-2]
+                             if len(target.children) > 1 else target.data)
+        index = self.fresh("index")
+        self.emit(f"{index} = {self.value(last.expr, None)}")
+        return f"{base}[{index}]"
+
+    def addressed_struct(self, target) -> bool:
+        """If the target is *p, for a pointer to a struct"""
+        return (isinstance(target, syntree.UnaryOp) and target.operator == "*"
+                and isinstance(underlying(self.type_of(target)), syntree.Struct))
+
+    def update(self, target, operator: str, y: str, stmt, right=None):
+        """x op= y, and x++ and x--"""
+        t = self.type_of(target)
+        typename = basic_typename(t)
+        x = self.expr(target)
+        if typename == "string" or (typename is not None and
+                                    untyped.kind_of_typename(typename) in ("float", "complex")
+                                    and typename not in ("float32", "complex64")
+                                    and operator != "/"):
+            self.emit(f"{self.target(target)} {operator}= {y}")
+            return
+        value = self.arith(operator, x, y, t, right)
+        self.emit(f"{self.target(target)} = {value}")
+
+    def target(self, node) -> str:
+        """Python code for the left side of an assignment"""
+        if isinstance(node, syntree.List):
+            return self.target(in_order(node)[0])
+        if isinstance(node, syntree.PrimaryExpr) and isinstance(node.data, tuple) \
+                and not node.children:
+            return self.assigned(node.data[1])
+        if isinstance(node, syntree.UnaryOp) and node.operator == "*":
+            raise Unsupported("assignments through pointers to values which are "
+                              "not structs are not supported by the python backend", node)
+        return self.expr(node)
+
+    def defer(self, stmt: syntree.DeferStmt):
+        call = in_order(stmt.call)[0]
+        if not isinstance(call, syntree.FunctionCall):
+            raise Unsupported("only calls can be deferred", stmt)
+        builtin = (isinstance(call.fn_name, str) and self.lookup(call.fn_name) is None
+                   and call.fn_name in syntree.builtins)
+        if builtin:
+            if call.fn_name != "panic":
+                raise Unsupported(f"deferring {call.fn_name} is not supported", stmt)
+            args = [self.value(arg, None) for arg in in_order(call.arguments.expression_list)]
+            self.emit(f"go.defer(go.panic, {args[0]})")
+            return
+        callee, args = self.call_parts(call)
+        self.emit(f"go.defer({', '.join([callee] + args)})")
+
+    # expressions
+
+    def values(self, exprs: list, types: list) -> str:
+        """The values assigned to variables of the types, they are a tuple
+        if there are several"""
+        if len(exprs) == 1 and len(types) == 2:
+            x = self.info.operands.get(exprs[0])
+            if x is not None and x.comma_ok:
+                return self.comma_ok(exprs[0])
+        if len(exprs) == 1 and len(types) > 1:
+            return self.expr(exprs[0])
+        values = [self.value(expr, t) for expr, t in zip(exprs, types + [None] * len(exprs))]
+        return ", ".join(values)
+
+    def comma_ok(self, node) -> str:
+        """v, ok of a map index or of a type assertion"""
+        node = in_order(node)[0] if isinstance(node, syntree.List) else node
+        last = node.children[-1]
+        base = self.primary(node, len(node.children) - 1)
+        if isinstance(last, syntree.Index):
+            return f"{base}.lookup({self.value(last.expr, None)})"
+        t = last.type_
+        return f"go.type_ok({base}, {self.type_test(t, node)}, {self.zero(t, node)})"
+
+    def value(self, node, t: Optional[syntree.Type]) -> str:
+        """The value of an expression as it is assigned to a variable of type t,
+        structs and arrays are copied"""
+        x = self.info.operands.get(node)
+        if x is not None and x.mode == "nil":
+            return self.zero(t, node) if t is not None else "None"
+        c = self.expr(node)
+        vt = self.type_of(node)
+        if t is not None and syntree.is_interface(t) and vt is not None and \
+                id(getattr(vt, "origin", None) or vt) in self.static:
+            raise Unsupported(f"values of type {checker.type_string(vt)} in interfaces are not "
+                              "supported by the python backend, its methods aren't of the value",
+                              node)
+        if vt is not None and self.mutable(vt) and not fresh(node):
+            return code(f"{operand(c, ATOM)}.copy()", ATOM)
+        return c
+
+    def expr(self, node) -> Code:
+        try:
+            return self.expression(node)
+        except Unsupported as e:
+            if e.node is None:
+                e.node = node
+            raise
+
+    def expression(self, node) -> Code:
+        x = self.info.operands.get(node)
+        if x is not None and x.mode == "constant" and x.constant is not None:
+            # a constant of the module, if it has the python type of the value
+            if (isinstance(node, syntree.PrimaryExpr) and not node.children
+                    and isinstance(node.data, tuple)):
+                binding = self.lookup(node.data[1])
+                if (binding is not None and binding.kind == "const" and binding.constant is not None
+                        and self.python_kind(binding.constant, binding.type_)
+                        == self.python_kind(x.constant, x.type_)
+                        and basic_typename(x.type_) not in ("float32", "complex64")):
+                    return code(self.name(node.data[1]), ATOM)
+            return self.const_literal(x.constant, x.type_)
+        if x is not None and x.mode == "nil":
+            return code(self.zero(x.type_, node) if x.type_ is not None else "None", ATOM)
+
+        if isinstance(node, syntree.List):
+            return self.expr(in_order(node)[0])
+        elif isinstance(node, syntree.Literal):
+            return self.literal(node)
+        elif isinstance(node, syntree.PrimaryExpr):
+            return self.primary(node, len(node.children))
+        elif isinstance(node, syntree.QualifiedIdent):
+            package = self.name(node.data[0][1])
+            return code(f"{package}.{attribute(node.data[1][1])}", ATOM)
+        elif isinstance(node, syntree.FunctionCall):
+            return self.call(node)
+        elif isinstance(node, syntree.BinOp):
+            return self.binary(node)
+        elif isinstance(node, syntree.UnaryOp):
+            return self.unary(node)
+        elif isinstance(node, syntree.Function):
+            return code(self.function_literal(node), ATOM)
+        elif isinstance(node, (syntree.BadExpr, syntree.BadStmt)):
+            raise Unsupported("the program has syntax errors", node)
+        raise Unsupported(f"{checker.expr_string(node)} is not supported "
+                          "by the python backend", node)
+
+    def function_literal(self, node: syntree.Function, name: Optional[str] = None) -> str:
+        """Emits a def for a function literal, before the statement using it"""
+        if name is None:
+            name = self.fresh("func")
+        self.function(node, name, literal=True)
+        return name
+
+    def literal(self, node: syntree.Literal) -> Code:
+        t = node.type_
+        if not isinstance(t, syntree.Type):
+            c = constant.from_literal(node)
+            return self.const_literal(c, self.type_of(node))
+        return self.composite(t, node.value, node)
+
+    def composite(self, t: syntree.Type, values, node) -> Code:
+        # elements can be LiteralValues themselves, for elided types
+        elements = [] if values is None else list(reversed(values.children))
+        u = underlying(t)
+        if isinstance(u, syntree.Struct):
+            if not isinstance(t, syntree.NamedType):
+                raise Unsupported("struct types without a name are not supported", node)
+            args = []
+            for element, f in zip(elements, u.fields):
+                if isinstance(element, syntree.KeyedElement):
+                    f = u.field(element.key.data[1])
+                    args.append(f"{init_param(f)}={self.element(element.value, f.type_)}")
+                else:
+                    args.append(self.element(element, f.type_))
+            return code(f"{self.class_name(t)}({', '.join(args)})", ATOM)
+
+        elif isinstance(u, (syntree.Array, syntree.Slice)):
+            items: Dict[int, str] = {}
+            index = 0
+            for element in elements:
+                if isinstance(element, syntree.KeyedElement):
+                    key = self.info.operands.get(element.key)
+                    index = untyped.to_integer(key.constant.kind, key.constant.value)
+                    element = element.value
+                items[index] = self.element(element, u.eltype)
+                index += 1
+            length = u.length if isinstance(u, syntree.Array) else max(items, default=-1) + 1
+            if len(items) == length:
+                values = [items[i] for i in range(length)]
+                text = f"[{', '.join(values)}]"
+            elif not items:
+                zero = self.zero(u.eltype, node)
+                text = (f"[{zero} for _ in range({length})]" if self.mutable(u.eltype)
+                        else f"[{zero}] * {length}")
+            else:
+                zero = self.zero(u.eltype, node)
+                values = [items.get(i, zero) for i in range(length)]
+                text = f"[{', '.join(values)}]"
+            return code(f"go.{'Array' if isinstance(u, syntree.Array) else 'Slice'}({text})", ATOM)
+
+        elif isinstance(u, syntree.Map):
+            entries = [f"{self.element(e.key, u.key)}: {self.element(e.value, u.eltype)}"
+                       for e in elements]
+            zero = self.zero_factory(u.eltype, node)
+            return code(f"go.Map({{{', '.join(entries)}}}, {zero})", ATOM)
+        raise Unsupported(f"composite literals of type {checker.type_string(t)} "
+                          "are not supported", node)
+
+    def element(self, node, t: syntree.Type) -> str:
+        if isinstance(node, syntree.LiteralValue):
+            # the type of the elements can be elided, like {1, 2} for &Point{1, 2}
+            if isinstance(underlying(t), syntree.Pointer):
+                return self.composite(underlying(t).base, node, node)
+            return self.composite(t, node, node)
+        return self.value(node, t)
+
+    def primary(self, node: syntree.PrimaryExpr, count: int) -> Code:
+        """The primary expression with its first count steps"""
+        if isinstance(node.data, tuple):
+            binding = self.lookup(node.data[1])
+            if binding is not None and binding.kind == "type" and not node.children:
+                return code(self.class_name(binding.type_), ATOM)
+            value = code(self.name(node.data[1]), ATOM)
+            steps = node.children[:count]
+            prev = node.data
+        else:
+            base = node.children[0]
+            value = self.expr(base)
+            steps = node.children[1:count]
+            prev = base
+
+        for step in steps:
+            value = self.step(value, step, prev)
+            prev = step
+        return value
+
+    def step(self, value: Code, step, prev) -> Code:
+        """An index, slice, selector or type assertion applied to value"""
+        x = self.info.operands.get(prev) if not isinstance(prev, tuple) else None
+        t = None
+        if x is not None:
+            t = x.type_
+        elif isinstance(prev, tuple):
+            binding = self.lookup(prev[1])
+            t = binding.type_ if binding is not None else None
+        u = underlying(t) if t is not None else None
+        if isinstance(u, syntree.Pointer):
+            u = underlying(u.base)
+        base = operand(value, ATOM)
+
+        if isinstance(step, syntree.Index):
+            if isinstance(u, syntree.FunctionType) or (isinstance(prev, tuple)
+                                                       and self.is_function(prev[1])):
+                # an instantiation of a generic function, type arguments are erased
+                return value
+            index = self.value(step.expr, None)
+            if basic_typename(u) == "string":
+                return code(f"go.byte_at({value}, {index})", ATOM)
+            return code(f"{base}[{index}]", ATOM)
+
+        elif isinstance(step, syntree.SliceExpr):
+            low = "None" if step.low is None else self.expr(step.low)
+            high = "None" if step.high is None else self.expr(step.high)
+            if basic_typename(u) == "string":
+                return code(f"go.substr({value}, {low}, {high})", ATOM)
+            if step.max is not None:
+                return code(f"{base}.slice({low}, {high}, {self.expr(step.max)})", ATOM)
+            low = "" if step.low is None else low
+            high = "" if step.high is None else high
+            return code(f"{base}[{low}:{high}]", ATOM)
+
+        elif isinstance(step, syntree.Selector):
+            selection = self.info.selections.get(step)
+            name = attribute(step.field_name)
+            if selection is not None and selection.kind == "methodexpr":
+                recv = selection.recv
+                if isinstance(recv, syntree.Pointer):
+                    recv = recv.base
+                return code(f"{self.class_name(recv)}.{name}", ATOM)
+            if self.static_method(step) is not None:
+                # the calls are static_calls
+                raise Unsupported("method values of types which are not structs are not "
+                                  "supported by the python backend", step)
+            # a promoted field or method is the one of the embedded field
+            path = "".join(f".{attribute(f.f_name)}" for f in selection.path) \
+                if selection is not None else ""
+            method = selection.obj if selection is not None else None
+            if isinstance(method, syntree.Method) and not method.pointer_receiver \
+                    and id(step) not in self.called and self.mutable(method.receiver_type):
+                # a method value is bound to a copy of its receiver, made
+                # when it is evaluated (the calls copy it themselves)
+                return code(f"{base}{path}.copy().{name}", ATOM)
+            return code(f"{base}{path}.{name}", ATOM)
+
+        elif isinstance(step, syntree.TypeAssertion):
+            t = step.type_
+            return code(f"go.assert_type({value}, {self.type_test(t, step)}, "
+                        f"{python_string(checker.type_string(t).encode())})", ATOM)
+        raise Unsupported("this expression is not supported", step)
+
+    def is_function(self, name: str) -> bool:
+        binding = self.lookup(name)
+        return binding is not None and binding.kind == "func"
+
+    def binary(self, node: syntree.BinOp) -> Code:
+        operator = node.operator
+        if operator in ("&&", "||"):
+            py, prec = binary_operators[operator]
+            x = operand(self.expr(node.left), prec)
+            y = operand(self.expr(node.right), prec + 1)
+            return code(f"{x} {py} {y}", prec)
+        if operator in ("==", "!="):
+            return self.equality(self.expr(node.left), self.type_of(node.left), node.right,
+                                 operator, node.left)
+        if operator in ("<", "<=", ">", ">="):
+            x = operand(self.expr(node.left), COMPARE + 1)
+            y = operand(self.expr(node.right), COMPARE + 1)
+            return code(f"{x} {operator} {y}", COMPARE)
+        t = self.type_of(node)
+        if operator not in ring_operators:
+            return self.arith(operator, self.expr(node.left), self.expr(node.right), t, node.right)
+        return self.arith(operator, self.raw(node.left, t), self.raw(node.right, t, operator),
+                          t, node.right)
+
+    def raw(self, node, t, operator: str = "") -> Code:
+        """An operand of an integer operation, the operations of the same type
+        in it are not wrapped (wrapping the result is the same)"""
+        typename = basic_typename(t)
+        if (typename in untyped.int_typenames and operator not in ("<<", ">>")
+                and isinstance(node, syntree.BinOp) and node.operator in ring_operators
+                and self.info.operands.get(node) is not None
+                and self.info.operands[node].mode != "constant"
+                and basic_typename(self.type_of(node)) == typename):
+            return self.arith(node.operator, self.raw(node.left, t),
+                              self.raw(node.right, t, node.operator), t, node.right, wrap=False)
+        return self.expr(node)
+
+    def arith(self, operator: str, x: str, y: str, t: Optional[syntree.Type], right=None,
+              wrap: bool = True) -> Code:
+        """x op y for values of type t"""
+        typename = basic_typename(t)
+        kind = untyped.kind_of_typename(typename) if typename is not None else None
+        constant_y = self.info.operands.get(right) if right is not None else None
+        constant_y = constant_y.constant if constant_y is not None and \
+            constant_y.mode == "constant" else None
+
+        if kind == "int":
+            wrapper = f"go.{typename}"
+            if operator in ("/", "%"):
+                if untyped.is_unsigned(typename) and constant_y is not None and \
+                        constant_y.value != 0:
+                    py = "//" if operator == "/" else "%"
+                    return code(f"{operand(x, PRODUCT)} {py} {operand(y, PRODUCT + 1)}", PRODUCT)
+                result = code(f"go.{'div' if operator == '/' else 'mod'}({x}, {y})", ATOM)
+                # the most negative integer divided by -1 overflows back to itself
+                if operator == "/" and not untyped.is_unsigned(typename) and (
+                        constant_y is None or constant_y.value == -1):
+                    return code(f"{wrapper}({result})", ATOM)
+                return result
+            if operator == "&^":
+                return code(f"{operand(x, BIT_AND)} & ~{operand(y, UNARY)}", BIT_AND)
+            if operator in ("<<", ">>") and constant_y is None:
+                result = code(f"go.{'shl' if operator == '<<' else 'shr'}({x}, {y})", ATOM)
+            else:
+                py, prec = binary_operators[operator]
+                result = code(f"{operand(x, prec)} {py} {operand(y, prec + 1)}", prec)
+            if operator in ring_operators or (operator == "<<"):
+                return code(f"{wrapper}({result})", ATOM) if wrap else result
+            return result
+
+        if operator == "/" and kind in ("float", "complex"):
+            if constant_y is None or constant_y.value in (0, (0, 0)):
+                result = code(f"go.fdiv({x}, {y})", ATOM)
+            else:
+                result = code(f"{operand(x, PRODUCT)} / {operand(y, PRODUCT + 1)}", PRODUCT)
+        else:
+            py, prec = binary_operators[operator]
+            result = code(f"{operand(x, prec)} {py} {operand(y, prec + 1)}", prec)
+        if typename in ("float32", "complex64"):
+            return code(f"go.{typename}({result})", ATOM)
+        return result
+
+    def equality(self, x: str, xt, right, operator: str, left=None) -> Code:
+        """x == y (or x != y) for the values of two expressions"""
+        y_operand = self.info.operands.get(right)
+        x_operand = self.info.operands.get(left) if left is not None else None
+        negate = operator == "!="
+        for value, other, other_type in ((x, y_operand, xt),
+                                         (None, x_operand, self.type_of(right))):
+            if other is not None and other.mode == "nil":
+                if value is None:
+                    value = self.expr(right)
+                u = underlying(other_type) if other_type is not None else None
+                if isinstance(u, (syntree.Slice, syntree.Map)):
+                    test = code(f"{operand(value, ATOM)}.is_nil()", ATOM)
+                    return code(f"not {test}", NOT) if negate else test
+                return code(f"{operand(value, COMPARE + 1)} is {'not ' if negate else ''}None",
+                            COMPARE)
+        y = self.expr(right)
+        return code(f"{operand(x, COMPARE + 1)} {operator} {operand(y, COMPARE + 1)}", COMPARE)
+
+    def unary(self, node: syntree.UnaryOp) -> Code:
+        operator = node.operator
+        operand_node = node.operand
+        if operator == "&":
+            if isinstance(operand_node, syntree.List):
+                operand_node = in_order(operand_node)[0]
+            t = self.type_of(operand_node)
+            if t is None or not self.mutable(t):
+                raise Unsupported(f"pointers to values of type {checker.type_string(t)} are "
+                                  "not supported by the python backend", node)
+            # a pointer to a struct or an array is the python object itself
+            return self.expr(operand_node)
+        elif operator == "*":
+            t = self.type_of(node)
+            if t is None or not self.mutable(t):
+                raise Unsupported(f"pointers to values of type {checker.type_string(t)} are "
+                                  "not supported by the python backend", node)
+            return self.expr(operand_node)
+        elif operator == "<-":
+            raise Unsupported("channels are not supported by the python backend", node)
+
+        t = self.type_of(node)
+        typename = basic_typename(t)
+        x = self.expr(operand_node)
+        if operator == "!":
+            return code(f"not {operand(x, NOT)}", NOT)
+        elif operator == "+":
+            return x
+        elif operator == "-":
+            result = code(f"-{operand(x, UNARY)}", UNARY)
+        elif operator == "^":
+            result = code(f"~{operand(x, UNARY)}", UNARY)
+        else:
+            raise Unsupported(f"operator {operator} is not supported", node)
+        if typename in untyped.int_typenames or typename in ("float32", "complex64"):
+            return code(f"go.{typename}({result})", ATOM)
+        return result
+
+    # calls
+
+    def call(self, node: syntree.FunctionCall) -> Code:
+        fn = node.fn_name
+        if isinstance(fn, str):
+            binding = self.lookup(fn)
+            if binding is None and fn in syntree.builtins:
+                return self.builtin(fn, node)
+            if binding is None and fn in checker.unsupported_builtins:
+                raise Unsupported(f"the builtin {fn} is not supported", node)
+            if binding is not None and binding.kind == "type":
+                return self.conversion(node, binding.type_)
+        x = self.info.operands.get(fn) if not isinstance(fn, str) else None
+        if x is not None and x.mode == "type":
+            return self.conversion(node, x.type_)
+        if isinstance(fn, syntree.Type):
+            return self.conversion(node, fn)
+        if node.arguments.type_ is not None and not isinstance(fn, str):
+            raise Unsupported("this call is not supported", node)
+        callee, args = self.call_parts(node)
+        return code(f"{callee}({', '.join(args)})", ATOM)
+
+    def call_parts(self, node: syntree.FunctionCall):
+        """The function called and its arguments, the variadic ones in a slice"""
+        fn = node.fn_name
+        receiver = []
+        static = self.static_call(fn)
+        if static is not None:
+            # a method of a type which isn't a struct, the receiver is the first argument
+            callee, receiver = static[0], [static[1]]
+        elif isinstance(fn, str):
+            callee = code(self.name(fn), ATOM)
+        elif isinstance(fn, syntree.Function):
+            callee = code(self.function_literal(fn), ATOM)
+        else:
+            if isinstance(fn, syntree.PrimaryExpr) and fn.children:
+                self.called.add(id(fn.children[-1]))
+            callee = self.expr(fn)
+        args = in_order(node.arguments.expression_list)
+        spread = node.arguments.ellipsis
+        native = isinstance(fn, syntree.QualifiedIdent) and self.is_native(fn)
+        if native:
+            # the functions of the runtime take f(*args)
+            signature = self.signature_of(node)
+            params = parameters(signature.parameters) if signature is not None else []
+            types = [getattr(type_, "eltype", type_) if vararg else type_
+                     for _, type_, vararg in params]
+            values = [self.native_arg(arg, types[min(i, len(types) - 1)] if types else None)
+                      for i, arg in enumerate(args)]
+            if spread:
+                values[-1] = f"*{operand(values[-1], ATOM)}"
+            return callee, values
+
+        t = self.type_of(fn) if not isinstance(fn, str) else None
+        signature = getattr(underlying(t), "signature", None) if t is not None else None
+        if signature is None:
+            signature = self.signature_of(node)
+        if signature is None:
+            return callee, receiver + [self.value(arg, None) for arg in args]
+        params = parameters(signature.parameters)
+        if len(args) == 1 and len(params) > 1:
+            x = self.info.operands.get(args[0])
+            if x is not None and x.mode == "tuple":
+                # f(g()) with the results of g
+                return callee, receiver + [f"*{operand(self.expr(args[0]), ATOM)}"]
+        values = receiver
+        for i, (_, type_, vararg) in enumerate(params):
+            if vararg and spread:
+                values.append(self.value(args[i], None))
+                break
+            elif vararg:
+                rest = [self.value(arg, getattr(type_, "eltype", type_)) for arg in args[i:]]
+                values.append(f"go.Slice([{', '.join(rest)}])" if rest else "go.Slice()")
+                break
+            if i < len(args):
+                values.append(self.value(args[i], type_))
+        return callee, values
+
+    def static_method(self, step) -> Optional[syntree.Type]:
+        """The type of the receiver if the selector is a method of a type which isn't a struct"""
+        selection = self.info.selections.get(step)
+        if selection is None or selection.kind != "method":
+            return None
+        # the embedded field of a promoted method
+        recv = selection.path[-1].type_ if selection.path else selection.recv
+        if isinstance(recv, syntree.Pointer):
+            recv = recv.base
+        origin = getattr(recv, "origin", None) or recv
+        return recv if id(origin) in self.static else None
+
+    def static_call(self, fn) -> Optional[tuple]:
+        """The function and the receiver of a call of a method of a type
+        which isn't a struct (see static_method), None for other calls"""
+        if not isinstance(fn, syntree.PrimaryExpr) or not fn.children:
+            return None
+        last = fn.children[-1]
+        recv = self.static_method(last) if isinstance(last, syntree.Selector) else None
+        if recv is None:
+            return None
+        callee = code(f"{self.class_name(recv)}.{attribute(last.field_name)}", ATOM)
+        path = "".join(f".{attribute(f.f_name)}" for f in self.info.selections[last].path)
+        receiver = self.primary(fn, len(fn.children) - 1)
+        return callee, code(f"{operand(receiver, ATOM)}{path}", ATOM) if path else receiver
+
+    def signature_of(self, node: syntree.FunctionCall):
+        if getattr(node, "method", None) is not None:
+            return node.method.signature
+        sym = getattr(node, "fn_sym", None)
+        value = getattr(sym, "value", None) if sym is not None else None
+        return getattr(value, "signature", None)
+
+    def is_native(self, node: syntree.QualifiedIdent) -> bool:
+        """If the function is one of the runtime (of fmt), not of a package of the program"""
+        binding = self.lookup(node.data[0][1])
+        return (binding is not None and binding.kind == "package"
+                and binding.pyname not in self.modules.values())
+
+    def native_arg(self, node, param: Optional[syntree.Type] = None) -> str:
+        """An argument of a function of the runtime (like the ones of fmt), of
+        the parameter type param: the values passed to interfaces have their
+        methods if their types aren't structs, and float32 values and sized
+        integers are marked (the values aren't copied, fmt doesn't change them)"""
+        value = self.expr(node)
+        t = self.type_of(node)
+        typename = basic_typename(t)
+        boxed = param is None or isinstance(underlying(param), syntree.Interface)
+        if boxed and typename == "float32":
+            return f"go.Float32({value})"
+        if boxed and typename is not None and t.name == "BasicType" and is_integer(t):
+            name = runtime_type_string(t)
+            if name != "int":
+                return f"go.Int({value}, {name!r})"
+        if boxed and t is not None and id(getattr(t, "origin", None) or t) in self.static:
+            return f"go.Named({value}, {self.class_name(t)})"
+        x = self.info.operands.get(node)
+        if x is not None and x.mode == "tuple":
+            return f"*{operand(value, ATOM)}"
+        return value
+
+    def builtin(self, name: str, node: syntree.FunctionCall) -> Code:
+        args = in_order(node.arguments.expression_list)
+        if node.arguments.type_ is not None:
+            args = [node.arguments.type_] + args
+        types = [arg if isinstance(arg, syntree.Type) else self.type_of(arg) for arg in args]
+
+        def arg(i: int) -> str:
+            return self.value(args[i], None)
+
+        if name == "len":
+            if basic_typename(types[0]) == "string":
+                return code(f"go.strlen({arg(0)})", ATOM)
+            return code(f"len({arg(0)})", ATOM)
+        elif name == "cap":
+            return code(f"go.cap({arg(0)})", ATOM)
+        elif name == "append":
+            s = arg(0)
+            if node.arguments.ellipsis:
+                other = arg(1)
+                if basic_typename(types[1]) == "string":
+                    other = f"{operand(other, ATOM)}.encode()"
+                return code(f"go.append({s}, *{operand(other, ATOM)})", ATOM)
+            eltype = getattr(underlying(types[0]), "eltype", None)
+            values = [self.value(a, eltype) for a in args[1:]]
+            return code(f"go.append({', '.join([s] + values)})", ATOM)
+        elif name == "copy":
+            return code(f"go.copy_slice({arg(0)}, {arg(1)})", ATOM)
+        elif name == "delete":
+            return code(f"{operand(arg(0), ATOM)}.pop({arg(1)}, None)", ATOM)
+        elif name == "make":
+            u = underlying(types[0])
+            if isinstance(u, syntree.Map):
+                return code(f"go.Map(zero={self.zero_factory(u.eltype, node)})", ATOM)
+            elif isinstance(u, syntree.Slice):
+                sizes = [arg(i) for i in range(1, len(args))]
+                return code(f"go.make_slice({', '.join([self.zero_factory(u.eltype, node)] + sizes)})",
+                            ATOM)
+            raise Unsupported("channels are not supported by the python backend", node)
+        elif name == "new":
+            t = types[0]
+            if not self.mutable(t):
+                raise Unsupported(f"pointers to values of type {checker.type_string(t)} are "
+                                  "not supported by the python backend", node)
+            return code(self.zero(t, node), ATOM)
+        elif name == "panic":
+            return code(f"go.panic({arg(0)})", ATOM)
+        elif name == "recover":
+            return code("go.recover()", ATOM)
+        elif name == "complex":
+            return code(f"complex({arg(0)}, {arg(1)})", ATOM)
+        elif name in ("real", "imag"):
+            return code(f"{operand(arg(0), ATOM)}.{name}", ATOM)
+        elif name in ("min", "max"):
+            t = self.type_of(node)
+            if len(args) == 1:
+                return self.value(args[0], t)
+            values = ", ".join(self.value(a, t) for a in args)
+            # the NaNs and the signed zeros of floats
+            if untyped.kind_of_typename(basic_typename(underlying(t))) == "float":
+                return code(f"go.f{name}({values})", ATOM)
+            return code(f"{name}({values})", ATOM)
+        raise Unsupported(f"{name} is not supported by the python backend", node)
+
+    def conversion(self, node: syntree.FunctionCall, t: syntree.Type) -> Code:
+        """T(x)"""
+        args = in_order(node.arguments.expression_list)
+        x = args[0]
+        value = self.value(x, t)
+        from_type = self.type_of(x)
+        u = underlying(t)
+        if syntree.is_interface(t):
+            return value
+        typename = basic_typename(u)
+        from_name = basic_typename(from_type) if from_type is not None else None
+        kind = untyped.kind_of_typename(typename) if typename is not None else None
+        from_kind = untyped.kind_of_typename(from_name) if from_name is not None else None
+        if kind == "string":
+            if from_kind == "string":
+                return value
+            fu = underlying(from_type)
+            if isinstance(fu, syntree.Slice) and basic_typename(fu.eltype) in ("rune", "int32"):
+                return code(f"go.string_of_runes({value})", ATOM)
+            return code(f"go.string({value})", ATOM)
+        if isinstance(u, syntree.Slice) and from_kind == "string":
+            if basic_typename(u.eltype) in ("rune", "int32"):
+                return code(f"go.runes_of({value})", ATOM)
+            return code(f"go.bytes_of({value})", ATOM)
+        if kind == "int":
+            if from_kind == "float":
+                return code(f"go.{typename}(int({value}))", ATOM)
+            if from_kind == "int" and same_integers(from_name, typename):
+                return value
+            return code(f"go.{typename}({value})", ATOM)
+        if kind == "float":
+            if typename == "float32":
+                return code(f"go.float32({value})", ATOM)
+            if from_name == typename or from_name == "float32":
+                return value if from_name == typename else code(f"float({value})", ATOM)
+            return code(f"float({value})", ATOM)
+        if kind == "complex":
+            return code(f"go.complex64({value})" if typename == "complex64"
+                        else f"complex({value})", ATOM)
+        return value
+
+
+def fresh(node) -> bool:
+    """If the value of the expression is a new one, which isn't copied"""
+    if isinstance(node, syntree.List):
+        node = in_order(node)[0]
+    return isinstance(node, (syntree.Literal, syntree.FunctionCall))
+
+
+def same_integers(x: str, y: str) -> bool:
+    """If the values of the integer types are the same"""
+    aliases = {"byte": "uint8", "rune": "int32", "int": "int64", "uint": "uint64"}
+    return aliases.get(x, x) == aliases.get(y, y)
+
+
+def python_string(value: bytes) -> str:
+    text = value.decode("utf-8", "replace")
+    # a double quoted literal, like Go
+    quoted = repr(text)
+    if quoted.startswith("'") and '"' not in text:
+        quoted = '"' + quoted[1:-1].replace("\\'", "'") + '"'
+    return quoted
+
+
+def float_literal(value: float) -> Code:
+    if value != value:
+        return code('float("nan")', ATOM)
+    if value in (float("inf"), float("-inf")):
+        return code(f'float("{"-" if value < 0 else ""}inf")', ATOM)
+    return code(repr(value), UNARY if value < 0 else ATOM)
+
+
+def is_name(node, name: str) -> bool:
+    if isinstance(node, syntree.List):
+        node = in_order(node)[0]
+    return (isinstance(node, syntree.PrimaryExpr) and not node.children
+            and isinstance(node.data, tuple) and node.data[1] == name)
+
+
+def receiver_name(method: syntree.Method) -> Optional[str]:
+    params = parameters(method.receiver)
+    return params[0][0].ident_name if params and params[0][0] is not None else None
+
+
+def modified_names(body, roots: bool = False) -> Set[str]:
+    """The names of the variables the statements assign to (with roots, the
+    ones whose fields or elements they assign to or whose address they take)"""
+    names = set()
+
+    def root(target):
+        if isinstance(target, syntree.List):
+            items = in_order(target)
+            target = items[0] if items else None
+        if isinstance(target, syntree.PrimaryExpr) and isinstance(target.data, tuple):
+            if not target.children or roots:
+                names.add(target.data[1])
+
+    for node in syntree.walk(body):
+        if isinstance(node, syntree.Assignment):
+            for target in in_order(node.left):
+                root(target)
+        elif isinstance(node, syntree.UnaryOp) and node.operator in ("++", "--"):
+            root(node.operand)
+        elif isinstance(node, syntree.UnaryOp) and node.operator == "&" and roots:
+            root(node.operand)
+        elif isinstance(node, syntree.FunctionCall) and roots and node.method is not None \
+                and getattr(node.method, "pointer_receiver", False):
+            root(node.receiver)
+    return names
+
+
+def uses_name(body, name: str) -> bool:
+    return any(isinstance(n, syntree.PrimaryExpr) and isinstance(n.data, tuple)
+               and n.data[1] == name for n in syntree.walk(body))
+
+
+def modifies(body, name: Optional[str]) -> bool:
+    return name is not None and name in modified_names(body, roots=True)
+
+
+def breaks_out(body) -> bool:
+    """If the statements have a break which isn't in a loop or a switch of their own"""
+    for stmt in in_order(body):
+        if isinstance(stmt, syntree.Keyword) and stmt.kw == "BREAK" and len(stmt.ext) <= 1:
+            return True
+        if isinstance(stmt, (syntree.ForStmt, syntree.SwitchStmt, syntree.SelectStmt,
+                             syntree.Function)):
+            continue
+        if isinstance(stmt, syntree.IfStmt):
+            if breaks_out(stmt.body) or (stmt.next_ is not None and breaks_out(
+                    [stmt.next_] if isinstance(stmt.next_, syntree.IfStmt) else stmt.next_)):
+                return True
+        elif isinstance(stmt, syntree.Block) and breaks_out(stmt):
+            return True
+    return False
+
+
+def continues_in(body) -> bool:
+    return any(isinstance(n, syntree.Keyword) and n.kw == "CONTINUE"
+               for n in syntree.walk(body, False))
+
+
+def static_types(package) -> Set[int]:
+    """The ids of the named types of a package of std which aren't structs
+    but have methods, like time.Duration: the class of the runtime has
+    their methods (time.Duration.String(d)), see Generator.static"""
+    decls = [decl for file in package.ast.children for child in file.children
+             for decl in in_order(child)]
+    receivers = {decl.base_type.typename for decl in decls if isinstance(decl, syntree.Method)}
+    return {id(decl.type_) for decl in decls if isinstance(decl, syntree.TypeDef)
+            and isinstance(decl.type_, syntree.NamedType)
+            and not isinstance(underlying(decl.type_), syntree.Struct)
+            and decl.typename[1] in receivers}
+
+
+def build(packages: list, info: checker.Info, outdir: str) -> bool:
+    """Writes the python module of each package in outdir, with the runtime
+    (the gopyrt package). Returns False if a package can't be translated,
+    the constructs which can't are reported as errors"""
+    os.makedirs(outdir, exist_ok=True)
+    static: Set[int] = set()
+    for package in packages:
+        if package.std:
+            static |= static_types(package)
+    # the packages of std are the ones of the runtime, like gopyrt.fmt
+    packages = [package for package in packages if not package.std]
+    modules = {package.path: mangle(package.name) for package in packages}
+    ok = True
+    for package in packages:
+        generator = Generator(package, info, modules, static)
+        try:
+            source = generator.module()
+        except Unsupported as e:
+            lineno, col_num, width = checker.position(e.node) if e.node is not None else (0, 0, 1)
+            diagnostics.error(e.message, lineno, col_num, width, kind="BUILD ERROR",
+                              file=generator.file)
+            ok = False
+            continue
+        with open(os.path.join(outdir, mangle(package.name) + ".py"), "wt", encoding="utf-8") as f:
+            f.write(source)
+    runtime = os.path.join(os.path.dirname(os.path.abspath(__file__)), "gopyrt")
+    shutil.copytree(runtime, os.path.join(outdir, "gopyrt"), dirs_exist_ok=True,
+                    ignore=shutil.ignore_patterns("__pycache__"))
+    return ok
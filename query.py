@@ -0,0 +1,136 @@
+import io
+import os
+import sys
+import argparse
+import contextlib
+
+from dataclasses import dataclass
+from typing import Any, List, Optional, Tuple
+
+import checker
+import constant
+import diagnostics
+import go_parser
+import syntree
+import utils
+
+
+# Queries of what the type checker found at a position of a file, for the
+# tools showing it (like the tooltips of an editor, see lsp.py, or a
+# debugger): the innermost node checked there, its type and its value,
+# and the object an identifier declares or refers to:
+#
+#   info = checker.Info()
+#   go_parser.check_program("tests/iota.go", info=info)
+#   q = query.query_at(info, "tests/iota.go", offset)
+#   q.node, q.type_, q.value
+#
+# The nodes are the ones info has the file of (see checker.Info.files):
+# the expressions, the identifiers of the declarations and the ones used.
+#
+#   python query.py tests/iota.go 120
+#
+# prints what is at the offset 120 (in characters) of the file.
+
+
+@dataclass
+class Query:
+    """What is at a position: the innermost node checked there, with the
+    (lineno, col_num, width) of its span (see checker.position)"""
+
+    node: Any
+    span: Tuple[int, int, int]
+    # the mode of the operand of an expression (see checker.Operand), or
+    # the kind of the object of an identifier
+    mode: str
+    # None if it has no type, like a package
+    type_: Optional[syntree.Type] = None
+    # the value of a constant
+    value: Optional[constant.Constant] = None
+    # the object the identifier declares or refers to, if it is one
+    obj: Optional[checker.Object] = None
+
+    def __str__(self) -> str:
+        type_ = "" if self.type_ is None else checker.type_string(self.type_)
+        if self.obj is not None:
+            s = f"{self.obj.kind} {self.obj.name} {type_}".rstrip()
+        elif type_:
+            s = f"{checker.expr_string(self.node)} ({self.mode} of type {type_})"
+        else:
+            s = f"{checker.expr_string(self.node)} ({self.mode})"
+        if self.value is not None:
+            s += f" = {self.value}"
+        return s
+
+
+def nodes_at(info: checker.Info, filename: str, lineno: int, col_num: int) -> list:
+    """The identifiers and the expressions checked at the position, the
+    narrowest ones first (the identifiers before the expressions of the
+    same width)"""
+    found = []
+    for node, file in info.files.items():
+        if file != filename:
+            continue
+        # the position of a call is the one of its function, unless
+        # it is an expression (then it is its first column)
+        if isinstance(node, syntree.FunctionCall) and not isinstance(node.fn_name, str):
+            continue
+        line, col, width = checker.position(node)
+        if line == lineno and col is not None and col <= col_num < col + width:
+            ident = node in info.defs or node in info.uses
+            found.append((width, not ident, node))
+    found.sort(key=lambda item: item[:2])
+    return [node for _, _, node in found]
+
+
+def query(info: checker.Info, node) -> Query:
+    """What the checker found about the node, one of nodes_at"""
+    span = checker.position(node)
+    obj = info.defs.get(node) or info.uses.get(node)
+    x = info.operands.get(node)
+    if x is not None and x.mode != "invalid":
+        return Query(node, span, x.mode, x.type_, x.constant, obj)
+    if obj is not None:
+        return Query(node, span, obj.kind, obj.type_, obj.constant, obj)
+    return Query(node, span, "invalid")
+
+
+def query_at(info: checker.Info, filename: str, offset: int,
+             text: Optional[str] = None) -> Optional[Query]:
+    """What is at the offset (in characters) of the file, whose text is text
+    (by default the one read by utils.read_source). None if the checker
+    found nothing there"""
+    if text is None:
+        text = utils.read_source(filename)
+    nodes = nodes_at(info, filename, *utils.line_column(text, offset))
+    return query(info, nodes[0]) if nodes else None
+
+
+def main(argv: List[str]) -> int:
+    arg_parser = argparse.ArgumentParser(
+        prog="query.py", description="Prints what the type checker found at an offset of a file"
+    )
+    arg_parser.add_argument("file", help="a .go file, checked as a program of its own "
+                                         "unless --package")
+    arg_parser.add_argument("offset", type=int, help="the offset, in characters")
+    arg_parser.add_argument("--package", action="store_true",
+                            help="checks the file with the package of its directory")
+    args = arg_parser.parse_args(argv)
+
+    filename = os.path.normpath(args.file)
+    path = os.path.dirname(filename) or "." if args.package else filename
+    info = checker.Info()
+    diagnostics.printing = False
+    with contextlib.redirect_stdout(io.StringIO()):
+        go_parser.check_program(path, verbose=False, info=info)
+    q = query_at(info, filename, args.offset)
+    if q is None:
+        print(f"{filename}: nothing at offset {args.offset}", file=sys.stderr)
+        return 1
+    lineno, col_num, _ = q.span
+    print(f"{filename}:{lineno}:{col_num}: {q}")
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
@@ -0,0 +1,189 @@
+import interp
+
+from typing import Any, Dict, Optional, Set, Tuple
+
+
+# The race detector of the VM (go_parser.py run -race), like the one of Go
+# (ThreadSanitizer) with vector clocks: each goroutine has the clocks of
+# the goroutines it has synchronized with, and an access to a variable is a
+# race with a previous one by another goroutine which doesn't happen before
+# it (whose time is past the clock of its goroutine the accessing one has),
+# if one of them is a write. The compiler of the VM puts a RACE instruction
+# before the instructions accessing the variables shared by the goroutines,
+# the package variables, the variables captured by function literals or
+# whose address is taken, the fields, the elements and the maps (the
+# accesses of std aren't checked), and the goroutines synchronize:
+#  - a go statement happens before the goroutine starts
+#  - the communications of a channel happen in order, a send before the
+#    receive of its value, a receive before the send completing, and close
+#    before the receives of the zero value
+#  - the sync package releases the Mutexes and the RWMutexes when they are
+#    unlocked and acquires them when they are locked, Done and Add happen
+#    before the Wait they unblock, and the call of the function of a Once
+#    before the Do returning, with the race* natives of std/sync
+#  - the functions of sync/atomic are acquired and released on their
+#    variable
+# Ref: https://go.dev/doc/articles/race_detector and https://go.dev/ref/mem
+
+
+class Access:
+    """An access to a variable: the goroutine, its time then, its trace
+    (the (function, line) of its frames, the innermost first) and if it
+    is a write"""
+
+    def __init__(self, g: Any, time: int, trace: list, write: bool):
+        self.g = g
+        self.time = time
+        self.trace = trace
+        self.write = write
+
+
+class Shadow:
+    """The last write of a variable, and the reads since, by goroutine"""
+
+    def __init__(self):
+        self.write: Optional[Access] = None
+        self.reads: Dict[int, Access] = {}
+
+
+class Detector:
+    """The races of the goroutines of machine, a VM. They are reported
+    once (for each pair of lines) to its stderr, like Go does"""
+
+    def __init__(self, machine: Any):
+        self.machine = machine
+        # the vector clock of each goroutine, by id
+        self.clocks: Dict[int, Dict[int, int]] = {1: {1: 1}}
+        # the clocks released to the variables the goroutines synchronize on
+        self.released: Dict[Any, Dict[int, int]] = {}
+        self.shadows: Dict[Any, Shadow] = {}
+        # the trace of the go statement of each goroutine
+        self.created_at: Dict[int, list] = {}
+        self.reported: Set[Tuple[tuple, tuple]] = set()
+        self.races = 0
+
+    def trace(self) -> list:
+        """The trace of the running goroutine, the go statement for the
+        ones running a builtin (like go close(ch)), which have no frames"""
+        trace = [(frame.fn, frame.line) for frame in reversed(self.machine.frames)
+                 if frame.fn is not None]
+        return trace or self.created_at.get(self.machine.scheduler.current.id, [])[:1]
+
+    def clock(self, g: Any) -> Dict[int, int]:
+        return self.clocks.setdefault(g.id, {g.id: 1})
+
+    # synchronization
+
+    def go(self, parent: Any, child: Any):
+        """The go statement of parent starting child happens before it"""
+        clock = self.clock(parent)
+        self.clocks[child.id] = dict(clock)
+        self.clocks[child.id][child.id] = 1
+        clock[parent.id] += 1
+        self.created_at[child.id] = self.trace()
+
+    def acquire(self, g: Any, key: Any):
+        """What was released to key happens before what g does next"""
+        released = self.released.get(key)
+        if released is not None:
+            join(self.clock(g), released)
+
+    def release(self, g: Any, key: Any, merge: bool = False):
+        """What g did happens before what acquires key next, merge keeps
+        what was released before (like the RUnlocks of a RWMutex)"""
+        clock = self.clock(g)
+        if merge and key in self.released:
+            join(self.released[key], clock)
+        else:
+            self.released[key] = dict(clock)
+        clock[g.id] += 1
+
+    def sync(self, g: Any, key: Any):
+        """Acquires and releases key, for the operations happening in order"""
+        self.acquire(g, key)
+        self.release(g, key, merge=True)
+
+    # accesses
+
+    def access(self, key: Any, write: bool):
+        """Checks an access of the running goroutine to the variable key"""
+        g = self.machine.scheduler.current
+        clock = self.clock(g)
+        shadow = self.shadows.get(key)
+        if shadow is None:
+            shadow = self.shadows[key] = Shadow()
+        previous = shadow.write
+        if previous is not None and previous.g is not g and previous.time > clock.get(previous.g.id, 0):
+            self.report(key, write, previous)
+        elif write:
+            for read in shadow.reads.values():
+                if read.g is not g and read.time > clock.get(read.g.id, 0):
+                    self.report(key, write, read)
+                    break
+        access = Access(g, clock[g.id], self.trace(), write)
+        if write:
+            shadow.write = access
+            shadow.reads.clear()
+        else:
+            shadow.reads[g.id] = access
+
+    def report(self, key: Any, write: bool, previous: Access):
+        trace = self.trace()
+        lines = (location(trace), location(previous.trace))
+        if lines in self.reported:
+            return
+        self.reported.add(lines)
+        self.races += 1
+        g = self.machine.scheduler.current
+        machine = self.machine
+        machine.output().flush()
+        at = address(key)
+        sections = [f"{'Write' if write else 'Read'} at {at} by {name(g)}:\n"
+                    f"{self.frames(trace)}",
+                    f"Previous {'write' if previous.write else 'read'} at {at} by "
+                    f"{name(previous.g)}:\n{self.frames(previous.trace)}"]
+        for goroutine in (g, previous.g):
+            if goroutine.id != 1:
+                state = "running" if goroutine.id in machine.scheduler.goroutines else "finished"
+                sections.append(f"Goroutine {goroutine.id} ({state}) created at:\n"
+                                f"{self.frames(self.created_at.get(goroutine.id, []))}")
+        print("==================\nWARNING: DATA RACE\n" + "\n\n".join(sections) +
+              "\n==================", file=machine.errors())
+
+    def frames(self, trace: list) -> str:
+        """The frames of a trace like the race detector of Go prints them"""
+        text = interp.stack_trace(trace, self.machine.program)
+        # without the arguments, (...) for the functions with parameters
+        return "\n".join("      " + line[1:] if line.startswith("\t") else
+                         "  " + line.replace("(...)", "()")
+                         for line in text.split("\n"))
+
+    def summary(self) -> Optional[str]:
+        """What Go prints at the exit of a program with races"""
+        return f"Found {self.races} data race(s)" if self.races else None
+
+
+def join(clock: Dict[int, int], other: Dict[int, int]):
+    """Sets clock to the latest times of both"""
+    for g, time in other.items():
+        if clock.get(g, 0) < time:
+            clock[g] = time
+
+
+def name(g: Any) -> str:
+    return "main goroutine" if g.id == 1 else f"goroutine {g.id}"
+
+
+def location(trace: list) -> tuple:
+    return tuple((id(fn), line) for fn, line in trace[:1])
+
+
+def address(key: Any) -> str:
+    """The address of a variable, made up like the ones of %p"""
+    if isinstance(key, interp.FieldRef):
+        fields = list(key.struct.fields)
+        offset = 8 * fields.index(key.name) if key.name in fields else 0
+        return hex(int(interp.address(key.struct), 16) + offset)
+    if isinstance(key, interp.ElementRef):
+        return hex(int(interp.address(key.array), 16) + 8 * key.index)
+    return interp.address(key)
@@ -0,0 +1,278 @@
+import re
+
+import checker
+import fileset
+import go_lexer
+import scopes
+import syntree
+import utils
+import xref
+
+from dataclasses import dataclass
+from typing import Dict, List, Optional, Tuple
+
+
+# Renaming an object of a program type checked (go_parser.py rename): its
+# references in the files of the program (see xref.py) are renamed, nothing
+# else of the files changes. The scopes of the type checker (see scopes.py)
+# tell if the program would mean something else once renamed, then it is
+# refused, with the reason (a Conflict):
+#  - the new name is declared in the scope of the object (or imported in a
+#    file, for a package level one), or it is the name of a field or a method
+#    of the same type, for a field or a method
+#  - a reference would refer to another object of the new name, declared in
+#    a scope the reference is in, nested in the one of the object
+#  - a reference to another object of the new name (like a predeclared one)
+#    would refer to the object, its scope being nested in the one of the
+#    other object
+#  - another package refers to it, and the new name isn't exported
+#  - the new name is init, or main in package main, for a package level
+#    one: these names are the ones of the functions the program runs
+# The predeclared objects, the ones of std, the packages imported, main and
+# init, and the methods of interfaces can't be renamed, nor the methods an
+# interface of the program has (the types would not implement it anymore).
+
+
+class Conflict(Exception):
+    """Why an object can't be renamed"""
+
+
+@dataclass
+class Edit:
+    """The text replacing the columns col_num up to end of a line"""
+
+    file: str
+    lineno: int
+    col_num: int
+    end: int
+    text: str
+
+    def __str__(self) -> str:
+        return f"{self.file}:{self.lineno}:{self.col_num}-{self.end}: {self.text}"
+
+
+def is_identifier(name: str) -> bool:
+    return re.fullmatch(r"[a-zA-Z_][a-zA-Z0-9_]*", name) is not None \
+        and name not in go_lexer.keywords
+
+
+def where(obj: checker.Object) -> str:
+    return f"{obj.file}:{obj.lineno}:{obj.col_num}"
+
+
+class Renamer:
+
+    def __init__(self, packages: list, info: checker.Info, index: xref.Index):
+        self.packages = [package for package in packages if not package.std]
+        self.info = info
+        self.index = index
+        # the extent of the scopes (but the ones of packages), (file, pos, end)
+        self.extents: Dict[int, Tuple[str, int, int]] = {}
+        functions = {}
+        for package in self.packages:
+            for node in syntree.walk(package.ast):
+                if isinstance(node, syntree.Function):
+                    functions[id(node.signature)] = node
+        for node, scope in info.scopes.items():
+            if isinstance(node, syntree.File):
+                self.extents[id(scope)] = (node.filename, fileset.NoPos, fileset.NoPos)
+                continue
+            node = functions.get(id(node), node)
+            file = xref.file_of(getattr(node, "pos", fileset.NoPos))
+            if file is not None:
+                self.extents[id(scope)] = (file, node.pos, node.end)
+
+    def package_of(self, file: Optional[str]):
+        return next((package for package in self.packages if file in package.files), None)
+
+    def pos(self, file: str, lineno: int, col_num: int) -> int:
+        f = next(f for f in reversed(fileset.fset.files) if f.name == file)
+        return f.line_start(lineno) + col_num - 1
+
+    def scope_at(self, file: str, lineno: int, col_num: int) -> Optional[checker.Scope]:
+        """The innermost scope of the position"""
+        package = self.package_of(file)
+        if package is None or package.scope is None:
+            return None
+        pos = self.pos(file, lineno, col_num)
+        scope = package.scope
+        while True:
+            for child in scope.children:
+                extent = self.extents.get(id(child))
+                if extent is not None and extent[0] == file and (
+                        extent[1] == fileset.NoPos or extent[1] <= pos < extent[2]):
+                    scope = child
+                    break
+            else:
+                return scope
+
+    def scope_of(self, obj: checker.Object) -> Optional[checker.Scope]:
+        """The scope obj is declared in"""
+        for package in self.packages:
+            if package.scope is not None and package.scope.objects.get(obj.name) is obj:
+                return package.scope
+        for scope in self.info.scopes.values():
+            if scope.objects.get(obj.name) is obj:
+                return scope
+        return None
+
+    def visible(self, obj: checker.Object, scope: checker.Scope, lineno: int,
+                col_num: int) -> bool:
+        """If obj, declared in scope, is visible at the position: the local
+        ones are from their declaration"""
+        if scope.kind in ("universe", "package", "file"):
+            return True
+        return (obj.lineno, obj.col_num) <= (lineno, col_num)
+
+    def rename(self, obj: checker.Object, new: str) -> List[Edit]:
+        if not is_identifier(new) or new == "_":
+            raise Conflict(f"invalid identifier {new}")
+        if new == obj.name:
+            raise Conflict(f"{obj.name} is already named {new}")
+        if obj.lineno is None:
+            raise Conflict(f"cannot rename the predeclared {obj.name}")
+        if obj.file not in self.index.files:
+            raise Conflict(f"cannot rename {obj.name}, it isn't declared in the program")
+        if obj.kind == "package":
+            raise Conflict(f"cannot rename the package {obj.name} imported")
+        package = self.package_of(obj.file)
+        refs = self.index.references(obj)
+        if any(self.package_of(ref.file) is not package for ref in refs) \
+                and obj.name[:1].isupper() and not new[:1].isupper():
+            raise Conflict(f"{obj.name} is used by other packages, {new} would not be exported")
+
+        method = next((decl for decl, m in self.info.methods.items() if m is obj), None)
+        if method is not None:
+            self.method(obj, method, new)
+        elif obj.kind == "field":
+            self.field(obj, new)
+        else:
+            scope = self.scope_of(obj)
+            if scope is None or scope.kind == "interface":
+                raise Conflict(f"cannot rename {obj.name}, a method of an interface")
+            if scope.kind == "package" and obj.kind == "func" and obj.name in ("main", "init") \
+                    and package.name == "main":
+                raise Conflict(f"cannot rename the function {obj.name} of package main")
+            if scope.kind == "package" and new == "init":
+                raise Conflict("init is reserved for the init functions of the package")
+            if scope.kind == "package" and new == "main" and package.name == "main":
+                raise Conflict("main is reserved for the function main of package main")
+            self.in_scope(obj, scope, new, [ref for ref in refs
+                                            if self.package_of(ref.file) is package])
+        return [Edit(ref.file, ref.lineno, ref.col_num, ref.col_num + ref.width, new)
+                for ref in refs]
+
+    def in_scope(self, obj: checker.Object, scope: checker.Scope, new: str, refs: list):
+        """Refuses the names conflicting with the ones of the scopes"""
+        other = scope.objects.get(new)
+        if other is not None:
+            raise Conflict(f"{new} is already declared in the scope of {obj.name}"
+                           + (f", at {where(other)}" if other.lineno is not None else ""))
+        if scope.kind == "package":
+            for child in scope.children:
+                if child.kind == "file" and new in child.objects:
+                    raise Conflict(f"{new} is imported at {where(child.objects[new])}")
+        # the references which would refer to another object
+        for ref in refs:
+            if ref.declaration:
+                continue
+            inner = self.scope_at(ref.file, ref.lineno, ref.col_num)
+            while inner is not None and inner is not scope:
+                other = inner.objects.get(new)
+                if other is not None and self.visible(other, inner, ref.lineno, ref.col_num):
+                    raise Conflict(f"the reference to {obj.name} at {ref.file}:{ref.lineno}:"
+                                   f"{ref.col_num} would refer to {new} declared at {where(other)}")
+                inner = inner.parent
+        # the references to another object which would refer to it
+        for file, lineno, col_num in self.uses(new):
+            inner = self.scope_at(file, lineno, col_num)
+            while inner is not None:
+                if inner is scope:
+                    if self.visible(obj, scope, lineno, col_num):
+                        raise Conflict(f"the reference to {new} at {file}:{lineno}:{col_num} "
+                                       f"would refer to {obj.name} renamed")
+                    break
+                other = inner.objects.get(new)
+                if other is not None and self.visible(other, inner, lineno, col_num):
+                    break
+                inner = inner.parent
+
+    def uses(self, name: str) -> List[Tuple[str, int, int]]:
+        """Where an object named name is referred to by its name alone (the
+        identifiers used, the types written by their name and the packages
+        of the qualified ones)"""
+        found = []
+        for node, obj in self.info.uses.items():
+            file = self.info.files.get(node)
+            if file not in self.index.files:
+                continue
+            if isinstance(node, syntree.QualifiedIdent):
+                package = node.data[0]
+                if package[1] == name:
+                    found.append((file, node.lineno, package[2]))
+            elif obj.name == name:
+                lineno, col_num, _ = checker.position(node)
+                found.append((file, lineno, col_num))
+        for ref in syntree.type_refs.values():
+            file = xref.file_of(ref.pos)
+            if ref.name.split(".")[0] == name and file in self.index.files:
+                start = fileset.fset.position(ref.pos)
+                found.append((file, start.line, start.column))
+        return found
+
+    def members(self, type_obj: Optional[checker.Object]) -> Dict[str, checker.Object]:
+        """The fields (of a struct) and the methods of a type, by name"""
+        if type_obj is None:
+            return {}
+        found = {}
+        t = checker.underlying(type_obj.type_)
+        if isinstance(t, syntree.Struct):
+            for field in t.fields:
+                obj = self.info.defs.get(field.ident)
+                if obj is not None:
+                    found[field.f_name] = obj
+        for method in scopes.methods(self.info, type_obj):
+            found[method.name] = method
+        return found
+
+    def member(self, obj: checker.Object, type_obj: Optional[checker.Object], new: str):
+        other = self.members(type_obj).get(new)
+        if other is not None:
+            raise Conflict(f"{type_obj.name} already has a {'method' if other.kind == 'func' else 'field'} "
+                           f"{new}, at {where(other)}")
+
+    def method(self, obj: checker.Object, decl: syntree.Method, new: str):
+        self.member(obj, self.index.types.get(id(decl.base_type)), new)
+        for type_obj in self.index.types.values():
+            t = checker.underlying(type_obj.type_) if type_obj.file in self.index.files else None
+            if isinstance(t, syntree.Interface) and any(m.m_name == obj.name for m in t.methods):
+                raise Conflict(f"the interface {type_obj.name} at {where(type_obj)} has a method "
+                               f"{obj.name}, the types having it may implement it")
+
+    def field(self, obj: checker.Object, new: str):
+        for type_obj in self.index.types.values():
+            if any(o is obj for o in self.members(type_obj).values()):
+                self.member(obj, type_obj, new)
+                return
+
+
+def rename(packages: list, info: checker.Info, obj: checker.Object, new: str,
+           index: Optional[xref.Index] = None) -> List[Edit]:
+    """The edits renaming obj to new in the files of the packages checked
+    with info, raises Conflict if it can't be"""
+    index = index if index is not None else xref.Index(packages, info)
+    return Renamer(packages, info, index).rename(obj, new)
+
+
+def apply(edits: List[Edit]) -> Dict[str, str]:
+    """The text of the files the edits change, once changed, by name"""
+    texts = {}
+    for file in sorted({edit.file for edit in edits}):
+        text = utils.read_source(file)
+        starts = [0] + [m.end() for m in re.finditer("\n", text)]
+        for edit in sorted((e for e in edits if e.file == file),
+                           key=lambda e: (e.lineno, e.col_num), reverse=True):
+            start = starts[edit.lineno - 1] + edit.col_num - 1
+            text = text[:start] + edit.text + text[start + edit.end - edit.col_num:]
+        texts[file] = text
+    return texts
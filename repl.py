@@ -0,0 +1,336 @@
+import io
+import os
+import re
+import sys
+import shutil
+import tempfile
+import contextlib
+import dataclasses
+import checker
+import constant
+import diagnostics
+import interp
+import sched
+import syntree
+import utils
+
+from typing import Callable, List, Optional, Tuple
+from checker import in_order, type_string
+from utils import print_error
+
+
+# The REPL reads declarations and statements one at a time, and runs them
+# as if they were typed in the body of main, one after the other (functions,
+# methods, types and imports are declared at the package level). The
+# program typed so far is checked again with each input, but only the
+# statements of the input are run, the variables declared by the previous
+# ones are kept in the scope of the session. The value of an expression
+# statement is printed, with its type.
+
+prompt = ">>> "
+continuation = "... "
+# the file the errors of an input are shown in
+input_name = "<input>"
+# the functions of fmt writing to the standard output
+writing = ("Print", "Println", "Printf")
+
+help_text = """\
+Declarations (func, type and import) and statements are run as they are typed,
+the value of an expression is printed. Lines are joined while brackets are open.
+  :help     shows this help
+  :source   shows the program typed so far
+  :reset    forgets the declarations and the variables
+  :quit     leaves (so does Ctrl-D)"""
+
+
+def decl_key(text: str) -> Optional[str]:
+    """What a package level declaration declares, like func f, a declaration
+    replaces the previous one with the same key. None for statements"""
+    match = re.match(r"\s*func\s*\(\s*\w*\s*\*?\s*(\w+)[^)]*\)\s*(\w+)", text)
+    if match:
+        return f"method {match[1]}.{match[2]}"
+    match = re.match(r"\s*(func|type)\s+(\w+)", text)
+    if match:
+        return f"{match[1]} {match[2]}"
+    match = re.match(r"\s*(import|type)\b", text)
+    if match:
+        # a group of them, like import ("fmt"; "os")
+        return text.strip()
+    return None
+
+
+def open_brackets(text: str) -> int:
+    """How many brackets are left open at the end of text, the ones in
+    strings, runes and comments are not counted"""
+    depth = 0
+    i = 0
+    while i < len(text):
+        c = text[i]
+        if c in "\"'`":
+            # skip the literal, with its escapes
+            i += 1
+            while i < len(text) and text[i] != c:
+                if text[i] == "\\" and c != "`":
+                    i += 1
+                i += 1
+        elif text.startswith("//", i):
+            i = text.find("\n", i)
+            if i == -1:
+                break
+        elif text.startswith("/*", i):
+            end = text.find("*/", i + 2)
+            if end == -1:
+                # the comment isn't closed yet
+                return depth + 1
+            i = end + 1
+        elif c in "([{":
+            depth += 1
+        elif c in ")]}":
+            depth -= 1
+        i += 1
+    return depth
+
+
+class Session:
+    """The declarations and the statements typed so far, with the
+    variables declared by the statements"""
+
+    def __init__(self, check: Callable):
+        # check_program of go_parser
+        self.check = check
+        self.dir = tempfile.mkdtemp(prefix="gopy-repl-")
+        self.reset()
+
+    def reset(self):
+        # (key, text) of the package level declarations, see decl_key
+        self.decls: List[Tuple[str, str]] = [('import "fmt"', 'import "fmt"')]
+        self.stmts: List[str] = []
+        # the number of statements of main which were run
+        self.count = 0
+        self.info = checker.Info()
+        self.interpreter = interp.Interpreter(self.info)
+        self.env = interp.Env(self.interpreter.globals)
+
+    def close(self):
+        shutil.rmtree(self.dir, ignore_errors=True)
+
+    def source(self, decls: Optional[list] = None, stmts: Optional[list] = None
+               ) -> Tuple[str, int, int]:
+        """The program of the declarations and the statements, with the first
+        and the last line of the body of main"""
+        decls = self.decls if decls is None else decls
+        stmts = self.stmts if stmts is None else stmts
+        lines = ["package main", ""]
+        for _, text in decls:
+            lines.extend(text.split("\n"))
+            lines.append("")
+        lines.append("func main() {")
+        first = len(lines) + 1
+        for text in stmts:
+            lines.extend(text.split("\n"))
+        last = len(lines)
+        lines.append("}")
+        return "\n".join(lines) + "\n", first, last
+
+    def eval(self, text: str) -> bool:
+        """Checks and runs an input, it is kept if it has no errors
+        and doesn't panic. Returns if it is kept"""
+        key = decl_key(text)
+        decls, stmts = self.decls, self.stmts
+        if key is not None:
+            decls = [d for d in decls if d[0] != key] + [(key, text)]
+        else:
+            stmts = stmts + [text]
+        source, first, last = self.source(decls, stmts)
+        # the line the input starts at, it is the last statement or declaration
+        if key is None:
+            start = last - len(text.split("\n")) + 1
+        else:
+            start = self.decl_line(decls)
+
+        path = os.path.join(self.dir, "main.go")
+        with open(path, "w") as f:
+            f.write(source)
+        info = checker.Info()
+        diagnostics.clear()
+        printing, diagnostics.printing = diagnostics.printing, False
+        try:
+            with contextlib.redirect_stdout(io.StringIO()):
+                packages = self.check(path, verbose=False, info=info)
+        finally:
+            diagnostics.printing = printing
+
+        errors = [
+            d for d in diagnostics.errors()
+            # the variables are used by the next inputs, and the
+            # values of expressions in main are printed
+            if d.code != "UnusedVar"
+            and not (d.code == "UnusedExpr" and first <= (d.lineno or 0) <= last)
+        ]
+        if errors or not packages:
+            self.report(errors, text, start)
+            return False
+
+        ast = packages[-1].ast
+        main = main_function(ast)
+        body = in_order(main.body)
+        self.info.operands.update(info.operands)
+        self.info.selections.update(info.selections)
+        self.info.defs.update(info.defs)
+        for package in packages[:-1]:
+            if package.path not in self.interpreter.packages:
+                self.interpreter.load_package(package)
+        package_env = interp.Env(self.interpreter.universe)
+        self.interpreter.declare_package(ast, package_env)
+        self.env.parent = package_env
+        self.interpreter.frames[0].fn = main
+
+        new = body[self.count:] if key is None else []
+        try:
+            try:
+                unpacked: dict = {}
+                for stmt in new:
+                    self.run(stmt, unpacked)
+            except sched.Crash as c:
+                # the panic of a goroutine, which ran while the input blocked
+                raise c.error
+        except interp.Panic as p:
+            print(f"panic: {self.interpreter.format(p.value)}")
+            return False
+        except sched.Fatal as f:
+            print(f"fatal error: {f.message}")
+            return False
+        except interp.Unsupported as e:
+            print_error(f"{e} by the interpreter", kind="UNSUPPORTED")
+            return False
+        except RecursionError:
+            print("fatal error: stack overflow")
+            return False
+        except (interp._Return, interp._Break, interp._Continue):
+            # a return in main, which ends the input
+            pass
+
+        self.decls, self.stmts = decls, stmts
+        self.count = len(body)
+        return True
+
+    def decl_line(self, decls: list) -> int:
+        """The line of the last declaration of the program"""
+        line = 3
+        for _, text in decls[:-1]:
+            line += len(text.split("\n")) + 1
+        return line
+
+    def run(self, stmt, unpacked: dict):
+        """Runs a statement of main, printing the value of an expression"""
+        x = self.info.operands.get(stmt)
+        if (x is None or x.mode in ("novalue", "invalid") or isinstance(stmt, syntree.Assignment)
+                or self.writes(stmt)):
+            self.interpreter.statement(stmt, self.env, unpacked)
+            return
+
+        value = self.interpreter.eval(stmt, self.env)
+        if x.mode == "constant" and x.constant.is_untyped:
+            print(f"{x.constant} (untyped {x.constant.kind} constant)")
+        elif x.mode == "constant":
+            print(f"{self.show(value, x.type_)} ({type_string(x.type_)} constant)")
+        elif x.mode == "tuple":
+            shown = ", ".join(self.show(v, t) for v, t in zip(value, x.tuple_types))
+            types = ", ".join(type_string(t) for t in x.tuple_types)
+            print(f"({shown}) ({types})")
+        elif x.type_ is not None:
+            print(f"{self.show(value, x.type_)} ({type_string(x.type_)})")
+        elif value is not None:
+            # a value from a package, its type isn't known
+            print(self.show(value, None))
+
+    def writes(self, stmt) -> bool:
+        """Whether stmt calls fmt.Print, Println or Printf, whose results
+        (the number of bytes written and the error) aren't printed"""
+        fn = getattr(stmt, "fn_name", None)
+        if not isinstance(fn, syntree.QualifiedIdent) or fn.data[1][1] not in writing:
+            return False
+        try:
+            package = self.env.lookup(fn.data[0][1])
+        except KeyError:
+            return False
+        return isinstance(package, interp.PackageRef) and package.path == "fmt"
+
+    def show(self, value, t) -> str:
+        # strings are quoted, so the type of the value is not mistaken
+        if isinstance(value, bytes):
+            return constant.quote(value)
+        return self.interpreter.format(value, t)
+
+    def report(self, errors: list, text: str, start: int):
+        """Prints the errors, the ones in the input with their location in it"""
+        utils.sources[input_name] = text.split("\n")
+        end = start + len(text.split("\n"))
+        for d in errors:
+            if d.lineno is not None and start <= d.lineno < end:
+                notes = [dataclasses.replace(note, lineno=None) for note in d.notes]
+                diagnostics.print_diagnostic(dataclasses.replace(
+                    d, lineno=d.lineno - start + 1, file=input_name, notes=notes, fix=None
+                ))
+            else:
+                print_error(d.message, kind=d.kind)
+
+
+def main_function(ast: syntree.Node) -> syntree.Function:
+    for file in ast.children:
+        for child in file.children:
+            for decl in in_order(child):
+                if (isinstance(decl, syntree.Function) and not isinstance(decl, syntree.Method)
+                        and decl.fn_name[1] == "main"):
+                    return decl
+    raise LookupError("no main function")
+
+
+def read_input(read: Callable[[str], str]) -> str:
+    """An input, its lines are joined while brackets are left open"""
+    text = read(prompt)
+    while open_brackets(text) > 0:
+        line = read(continuation)
+        if not line.strip():
+            # an empty line gives up, the input is checked as it is
+            break
+        text += "\n" + line
+    return text
+
+
+def run(check: Callable, read: Callable[[str], str] = input):
+    """Runs the REPL until the end of the input, or :quit"""
+    session = Session(check)
+    # calls nest a few python frames for each Go frame
+    sys.setrecursionlimit(max(sys.getrecursionlimit(), 20000))
+    print("gopy REPL, :help for help")
+    try:
+        while True:
+            try:
+                text = read_input(read)
+            except KeyboardInterrupt:
+                print()
+                continue
+            except EOFError:
+                print()
+                break
+            command = text.strip()
+            if not command:
+                continue
+            elif command in (":quit", ":q"):
+                break
+            elif command == ":help":
+                print(help_text)
+            elif command == ":source":
+                print(session.source()[0], end="")
+            elif command == ":reset":
+                session.reset()
+            elif command.startswith(":"):
+                print_error(f"unknown command {command}, :help for the commands", kind="ERROR")
+            else:
+                try:
+                    session.eval(text)
+                except KeyboardInterrupt:
+                    print("interrupted")
+    finally:
+        session.close()
@@ -0,0 +1,75 @@
+from dataclasses import dataclass
+from typing import FrozenSet, Iterable, Optional
+
+
+# The limits of the programs run by the interpreter and the VM, for the
+# code which isn't trusted, like the one of a playground service: the bytes
+# a program allocates, the bytes it writes to stdout and stderr, and the
+# syscalls it makes, the natives of std reaching out of the interpreter (see
+# syscalls). A program going past one is aborted where it is, with an
+# interp.Aborted saying which, like the ones running out of steps (see
+# Interpreter.step). The limits are deterministic: the bytes allocated are
+# the ones the interpreter counts (see Interpreter.allocate), not the memory
+# of Python, so a program is aborted at the same point at each run
+#
+#   machine.limits = sandbox.default()
+#
+# The goroutines are threads (see sched.py), so the ones a program has at
+# once are limited too. The Python backend doesn't have the limits, its
+# modules run on their own
+
+# the natives of std which are syscalls, by package.name: the ones reading
+# and writing the standard streams (os.File.Read and Write) and the files
+# (os.ReadFile, os.WriteFile, os.Stat and os.Remove), the clock, and the
+# calls of Python (python.call, the functions of the modules imported as
+# python/NAME and the methods of python.Object, which can do anything). The other ones
+# only compute (like strconv.Itoa) or are given by the runner (os.Args)
+syscalls: FrozenSet[str] = frozenset({
+    "os.read", "os.write", "os.readFile", "os.writeFile", "os.stat", "os.remove", "time.now",
+    "time.sleep", "python.call",
+})
+
+# the syscalls of the default sandbox: the standard streams and the clock,
+# without the files
+streams: FrozenSet[str] = frozenset({"os.read", "os.write", "time.now", "time.sleep"})
+
+# the syscalls of the files, the playground allows them since its files
+# aren't the ones of the disk (see interp.Interpreter.files)
+files: FrozenSet[str] = frozenset({"os.readFile", "os.writeFile", "os.stat", "os.remove"})
+
+
+@dataclass
+class Limits:
+    """The limits of a run, None for no limit: the bytes allocated (in
+    total, the interpreter doesn't know when they are collected), the
+    bytes written to stdout and stderr, the syscalls allowed, and the
+    goroutines which didn't end (main included)"""
+
+    heap: Optional[int] = None
+    output: Optional[int] = None
+    syscalls: Optional[FrozenSet[str]] = None
+    goroutines: Optional[int] = None
+
+    def allows(self, syscall: str) -> bool:
+        return self.syscalls is None or syscall not in syscalls or syscall in self.syscalls
+
+
+def default() -> Limits:
+    """The limits of a sandbox: 64 MiB allocated, 1 MiB of output,
+    neither files read nor written, and 1000 goroutines at once"""
+    return Limits(heap=64 << 20, output=1 << 20, syscalls=streams, goroutines=1000)
+
+
+def parse_syscalls(text: str) -> FrozenSet[str]:
+    """The syscalls of a list separated by commas, like os.read,os.write.
+    Raises ValueError for the ones which aren't syscalls"""
+    return check_syscalls(name.strip() for name in text.split(",") if name.strip())
+
+
+def check_syscalls(names: Iterable[str]) -> FrozenSet[str]:
+    found = frozenset(names)
+    unknown = sorted(found - syscalls)
+    if unknown:
+        raise ValueError(f"not a syscall: {', '.join(unknown)} (the syscalls are "
+                         f"{', '.join(sorted(syscalls))})")
+    return found
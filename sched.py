@@ -0,0 +1,332 @@
+import heapq
+import random
+import threading
+import collections
+
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+
+# The goroutines of the interpreter and the VM. Each one is a python
+# thread, but only one of them runs at a time: the one holding the baton,
+# which it hands to the next one when it blocks (on a channel, a select,
+# a semaphore of the sync package or a sleep), when it ends, and once it
+# has run preempt_steps steps, like the scheduler of Go preempts the
+# goroutines running for more than 10ms. The next one is the goroutine
+# made runnable last (the runnext of the scheduler of Go), then the others
+# in the order they were, so that the runs are the ones of Go with
+# GOMAXPROCS=1, and are deterministic with a FakeClock. The program is
+# deadlocked once all the goroutines are blocked, with none sleeping.
+#
+# The interpreter has the frames of the goroutine running, the ones of
+# the others are in their Goroutine. The program ends when main returns,
+# the goroutines still blocked then are unwound (without running their
+# deferred calls), and so does an error which isn't recovered in one of
+# them, like a panic: it is raised in the main goroutine instead.
+# Ref: https://go.dev/src/runtime/proc.go and https://go.dev/src/runtime/chan.go
+
+# the steps a goroutine runs before another one runs, if one is runnable
+preempt_steps = 2000
+
+# the size of the stack of the threads, for the recursion of the functions
+stack_size = 256 * 1024 * 1024
+
+
+class Fatal(Exception):
+    """A fatal error of the runtime, like a deadlock: the program ends with
+    exit status 2, without running the deferred calls (recover doesn't stop
+    it). goroutines are the (goroutine, state, trace) of the goroutines
+    it prints the traces of"""
+
+    def __init__(self, message: str, goroutines: List[Tuple["Goroutine", str, list]]):
+        super().__init__(message)
+        self.message = message
+        self.goroutines = goroutines
+
+
+class Crash(BaseException):
+    """Raised in the main goroutine for the error of another goroutine
+    which ends the program, like a panic (the deferred calls of main
+    don't run)"""
+
+    def __init__(self, error: BaseException, goroutine: "Goroutine"):
+        super().__init__(error)
+        self.error = error
+        self.goroutine = goroutine
+
+
+class _GoExit(BaseException):
+    """Unwinds the goroutines once the program ends"""
+
+
+class Goroutine:
+    """A goroutine, frames are the ones of the interpreter it runs in"""
+
+    def __init__(self, id_: int, frames: list, created_by: Optional[tuple] = None):
+        self.id = id_
+        self.frames = frames
+        # the (function, line) of the go statement, and the goroutine it ran in
+        self.created_by = created_by
+        # why it is blocked (its wait reason), like "chan receive"
+        self.state: Optional[str] = None
+        # the goroutine may run once it is released, in its thread
+        self.turn = threading.Semaphore(0)
+        self.thread: Optional[int] = None
+        # what the goroutine waking it up gives it: the value received,
+        # whether it was sent (not the zero value of a closed channel),
+        # and the case chosen if it is in a select
+        self.value: Any = None
+        self.ok = False
+        self.case = -1
+
+    def trace(self) -> list:
+        """The (function, line) of the frames, the innermost first"""
+        return [(frame.fn, frame.line) for frame in reversed(self.frames)
+                if frame.fn is not None]
+
+
+class Waiter:
+    """A goroutine blocked on a channel, the sudog of Go: the value it
+    sends, the case it is if it is in a select (then select is the
+    Selection of all its cases)"""
+
+    def __init__(self, g: Goroutine, value: Any = None, case: int = -1,
+                 select: Optional["Selection"] = None):
+        self.g = g
+        self.value = value
+        self.case = case
+        self.select = select
+
+    @property
+    def done(self) -> bool:
+        """If another case of its select was chosen"""
+        return self.select is not None and self.select.done
+
+
+class Selection:
+    def __init__(self):
+        self.done = False
+
+
+class Scheduler:
+    """The goroutines of the program run by machine, an Interpreter"""
+
+    def __init__(self, machine: Any):
+        self.machine = machine
+        self.main = Goroutine(1, machine.frames)
+        self.main.thread = threading.get_ident()
+        self.current = self.main
+        # the goroutine run next, and the other runnable ones
+        self.next: Optional[Goroutine] = None
+        self.runnable: collections.deque = collections.deque()
+        # the (time, order, goroutine) of the goroutines sleeping
+        self.sleeping: List[Tuple[int, int, Goroutine]] = []
+        self.sleeps = 0
+        # the goroutines which didn't end, by id
+        self.goroutines: Dict[int, Goroutine] = {1: self.main}
+        self.ids = 1
+        # the goroutines waiting on the semaphores of the sync package,
+        # by the pointer to their count
+        self.semaphores: Dict[Any, collections.deque] = {}
+        # the error ending the program, raised in main, and the goroutine
+        # it was in
+        self.failure: Optional[Tuple[BaseException, Goroutine]] = None
+        self.exiting = False
+
+    @property
+    def alone(self) -> bool:
+        """If main is the only goroutine"""
+        return len(self.goroutines) == 1
+
+    def go(self, run: Callable[[], Any], frames: list, created_by: tuple) -> Goroutine:
+        """Starts a goroutine calling run in the frames, it runs next
+        (after the running one blocks or is preempted). The program is
+        aborted if it would have more goroutines than its sandbox allows"""
+        limit = self.machine.limits.goroutines
+        if limit is not None and len(self.goroutines) >= limit:
+            from interp import Aborted
+            raise Aborted(f"the program has more than {limit} goroutines")
+        self.ids += 1
+        g = Goroutine(self.ids, frames, created_by)
+        self.goroutines[g.id] = g
+        size = threading.stack_size(stack_size)
+        try:
+            threading.Thread(target=self.body, args=(g, run), daemon=True,
+                             name=f"goroutine {g.id}").start()
+        finally:
+            threading.stack_size(size)
+        self.ready(g)
+        return g
+
+    def body(self, g: Goroutine, run: Callable[[], Any]):
+        try:
+            self.wait(g)
+            run()
+        except _GoExit:
+            pass
+        except BaseException as e:
+            if self.failure is None:
+                self.failure = (e, g)
+        del self.goroutines[g.id]
+        if self.failure is not None or self.exiting:
+            self.switch(self.main)
+            return
+        try:
+            following = self.pick()
+        except BaseException as e:
+            # the error of the context of the run while sleeping
+            self.failure, following = (e, g), self.main
+        self.switch(following or self.deadlock())
+
+    def ready(self, g: Goroutine):
+        """Makes g runnable, it runs next"""
+        if self.next is not None:
+            self.runnable.append(self.next)
+        self.next = g
+
+    def pick(self) -> Optional[Goroutine]:
+        """The goroutine to run next, None if all of them are blocked.
+        The clock moves to the time the first sleeping one wakes up if none
+        is runnable"""
+        if self.next is not None:
+            g, self.next = self.next, None
+            return g
+        if self.runnable:
+            return self.runnable.popleft()
+        if self.sleeping:
+            when, _, g = heapq.heappop(self.sleeping)
+            clock = self.machine.clock
+            clock.sleep(max(0, when - clock.now()), self.machine.ctx)
+            return g
+        return None
+
+    def deadlock(self) -> Goroutine:
+        """Makes main raise the fatal error of a deadlock, it runs next"""
+        traces = [(g, g.state, g.trace())
+                  for g in sorted(self.goroutines.values(), key=lambda g: g.id)]
+        self.failure = (Fatal("all goroutines are asleep - deadlock!", traces), self.main)
+        return self.main
+
+    def switch(self, g: Goroutine):
+        """Hands the baton to g"""
+        self.current = g
+        g.turn.release()
+
+    def wait(self, g: Goroutine):
+        """Waits for the turn of g (the goroutine of the caller)"""
+        g.turn.acquire()
+        self.resume(g)
+
+    def resume(self, g: Goroutine):
+        g.thread = threading.get_ident()
+        self.machine.frames = g.frames
+        if g is self.main and self.failure is not None:
+            error, goroutine = self.failure
+            self.failure = None
+            raise error if goroutine is self.main else Crash(error, goroutine)
+        if self.exiting and g is not self.main:
+            raise _GoExit()
+
+    def park(self, state: str):
+        """Blocks the running goroutine until it is made runnable, it
+        is in the state (its wait reason) meanwhile, like "chan send" """
+        g = self.current
+        g.state = state
+        try:
+            following = self.pick() or self.deadlock()
+            if following is not g:
+                self.switch(following)
+                self.wait(g)
+            else:
+                # it woke up from a sleep, or main is deadlocked
+                self.resume(g)
+        finally:
+            g.state = None
+
+    def yield_(self):
+        """Lets the runnable goroutines run, the running one runs after them"""
+        if self.next is None and not self.runnable:
+            return
+        g = self.current
+        self.runnable.append(g)
+        following = self.pick()
+        if following is not g:
+            self.switch(following)
+            self.wait(g)
+
+    def sleep(self, ns: int):
+        """Blocks the running goroutine for ns nanoseconds"""
+        clock = self.machine.clock
+        if self.alone:
+            clock.sleep(ns, self.machine.ctx)
+            return
+        self.sleeps += 1
+        heapq.heappush(self.sleeping, (clock.now() + max(ns, 0), self.sleeps, self.current))
+        self.park("sleep")
+
+    def semacquire(self, count: Any, state: str):
+        """Waits until the variable count (a Ref) is more than 0, then
+        decrements it, like runtime_Semacquire"""
+        while count.get() == 0:
+            self.semaphores.setdefault(count, collections.deque()).append(self.current)
+            self.park(state)
+        count.set(count.get() - 1)
+
+    def semrelease(self, count: Any):
+        """Increments the variable count, the first goroutine waiting
+        for it in semacquire runs next"""
+        count.set(count.get() + 1)
+        waiting = self.semaphores.get(count)
+        if waiting:
+            self.ready(waiting.popleft())
+            if not waiting:
+                del self.semaphores[count]
+
+    def exit(self):
+        """Unwinds the goroutines once main returns (or the program ends)"""
+        self.exiting = True
+        self.next = None
+        self.runnable.clear()
+        self.sleeping.clear()
+        for g in sorted(self.goroutines.values(), key=lambda g: g.id):
+            if g is not self.main:
+                self.switch(g)
+                self.main.turn.acquire()
+        self.current = self.main
+        self.machine.frames = self.main.frames
+        self.failure = None
+        self.semaphores.clear()
+        self.exiting = False
+
+    # channels
+
+    def wake(self, waiter: Waiter, value: Any, ok: bool):
+        """Makes the goroutine of a waiter dequeued runnable, it gets the
+        value (received) and ok"""
+        g = waiter.g
+        g.value, g.ok, g.case = value, ok, waiter.case
+        if waiter.select is not None:
+            waiter.select.done = True
+        self.ready(g)
+
+
+def peek(queue: collections.deque) -> Optional[Waiter]:
+    """The first waiter of a channel queue, the ones whose select
+    ended are dropped"""
+    while queue and queue[0].done:
+        queue.popleft()
+    return queue[0] if queue else None
+
+
+def first(queue: collections.deque) -> Optional[Waiter]:
+    """Dequeues the first waiter of a channel queue, see peek"""
+    waiter = peek(queue)
+    if waiter is not None:
+        queue.popleft()
+    return waiter
+
+
+def poll_order(n: int) -> List[int]:
+    """The order the cases of a select are tried in, a random one"""
+    order = list(range(n))
+    random.shuffle(order)
+    return order
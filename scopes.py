@@ -0,0 +1,118 @@
+import io
+import os
+import sys
+import argparse
+import contextlib
+
+from typing import List, Optional
+
+import checker
+import diagnostics
+import fileset
+import go_parser
+import syntree
+
+
+# The scopes of a type checked package and the objects declared in them,
+# for the tools listing what a package or a file declares (like a
+# documentation generator). The package scope is loader.Package.scope
+# (each file has a scope of its own, with its imports, nested in it), the
+# other ones are nested in it as checker.Scope.children, and Info.scopes
+# has the scope of each node having one:
+#
+#   info = checker.Info()
+#   packages = go_parser.check_program("tests/declarations.go", info=info)
+#   scope = packages[-1].scope
+#   scope.names(), scope.lookup("Area"), scope.children
+#   obj.kind, obj.type_, obj.constant, obj.file, obj.lineno, obj.col_num
+#
+# An object has the node of its declaration (checker.Object.decl), the
+# doc comment of a package level one is syntree.doc_comment(obj.decl).
+#
+#   python scopes.py tests/declarations.go
+#
+# prints the declarations of the file, --tree prints all its scopes.
+
+
+def position(obj: checker.Object) -> str:
+    """Where the object is declared, file:line:column"""
+    return f"{obj.file}:{obj.lineno}:{obj.col_num}"
+
+
+def methods(info: checker.Info, obj: checker.Object) -> List[checker.Object]:
+    """The methods declared for the type of obj, sorted by name"""
+    found = [method for decl, method in info.methods.items()
+             if obj.type_ is not None and decl.base_type is obj.type_]
+    return sorted(found, key=lambda method: method.name)
+
+
+def declarations(scope: checker.Scope, info: checker.Info,
+                 filename: Optional[str] = None) -> List[checker.Object]:
+    """The objects declared in the package scope, with the methods and
+    the imports of its files, in the order they are declared. Only the
+    ones of the file if filename"""
+    files = [child for child in scope.children if child.kind == "file"]
+    filenames = {child.node.filename for child in files}
+    # info.methods has the ones of the other packages checked with info
+    found = list(scope.objects.values()) + [obj for obj in info.methods.values()
+                                            if obj.file in filenames]
+    for child in files:
+        found.extend(child.objects.values())
+    found = [obj for obj in found
+             if obj.lineno is not None and (filename is None or obj.file == filename)]
+    return sorted(found, key=lambda obj: (obj.file or "", obj.lineno, obj.col_num or 0))
+
+
+def scope_string(scope: checker.Scope) -> str:
+    """The kind of the scope, with the position of its node if it has one"""
+    node = scope.node
+    if isinstance(node, syntree.File):
+        return f"{scope.kind} {node.filename}"
+    if getattr(node, "pos", fileset.NoPos) == fileset.NoPos:
+        return scope.kind
+    start = fileset.fset.position(node.pos)
+    return f"{scope.kind} {start.line}:{start.column}"
+
+
+def print_tree(scope: checker.Scope, indent: int = 0):
+    """Prints the scope, its objects and the scopes nested in it"""
+    print("  " * indent + scope_string(scope))
+    for name in scope.names():
+        obj = scope.objects[name]
+        print("  " * (indent + 1) + f"{checker.object_string(obj)}  {obj.lineno}:{obj.col_num}")
+    for child in scope.children:
+        print_tree(child, indent + 1)
+
+
+def main(argv: List[str]) -> int:
+    arg_parser = argparse.ArgumentParser(
+        prog="scopes.py", description="Prints the declarations of a file, or its scopes"
+    )
+    arg_parser.add_argument("file", help="a .go file, checked as a program of its own "
+                                         "unless --package")
+    arg_parser.add_argument("--package", action="store_true",
+                            help="checks the file with the package of its directory")
+    arg_parser.add_argument("--tree", action="store_true",
+                            help="prints the scopes of the package, with their objects")
+    args = arg_parser.parse_args(argv)
+
+    filename = os.path.normpath(args.file)
+    path = os.path.dirname(filename) or "." if args.package else filename
+    info = checker.Info()
+    diagnostics.printing = False
+    with contextlib.redirect_stdout(io.StringIO()):
+        packages = go_parser.check_program(path, verbose=False, info=info)
+    if not packages or packages[-1].scope is None:
+        print(f"{filename}: not type checked", file=sys.stderr)
+        return 1
+    scope = packages[-1].scope
+    if args.tree:
+        print_tree(scope)
+        return 0
+    for obj in declarations(scope, info, filename):
+        print(f"{position(obj)}: {checker.object_string(obj)}")
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv[1:]))
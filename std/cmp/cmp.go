@@ -0,0 +1,51 @@
+// Package cmp has the Ordered constraint of the cmp package of Go (without
+// uintptr, which gopy doesn't have), and the functions comparing two values
+// of an ordered type. It is written in Go: the interpreter and the VM run
+// it like the packages of the program (gopyrt/cmp.py is the one of the
+// Python modules).
+package cmp
+
+// Ordered is a constraint that permits any ordered type: any type that
+// supports the operators < <= >= >.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64 |
+		~string
+}
+
+// Less reports whether x is less than y. A NaN is considered less than
+// any non-NaN, and -0.0 is not less than (is equal to) 0.0.
+func Less[T Ordered](x, y T) bool {
+	return (isNaN(x) && !isNaN(y)) || x < y
+}
+
+// Compare returns -1 if x is less than y, 0 if x equals y, and +1 if x is
+// greater than y. A NaN is considered less than any non-NaN, a NaN is
+// considered equal to a NaN, and -0.0 is equal to 0.0.
+func Compare[T Ordered](x, y T) int {
+	xNaN := isNaN(x)
+	yNaN := isNaN(y)
+	if xNaN {
+		if yNaN {
+			return 0
+		}
+		return -1
+	}
+	if yNaN {
+		return +1
+	}
+	if x < y {
+		return -1
+	}
+	if x > y {
+		return +1
+	}
+	return 0
+}
+
+// isNaN reports whether x is a NaN without requiring the math package.
+// This will always return false if T is not floating-point.
+func isNaN[T Ordered](x T) bool {
+	return x != x
+}
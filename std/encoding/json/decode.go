@@ -0,0 +1,624 @@
+package json
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshaler is the interface of the types decoding themselves from JSON,
+// given the JSON of a value.
+type Unmarshaler interface {
+	UnmarshalJSON([]byte) error
+}
+
+// An UnmarshalTypeError is a JSON value which can't be decoded into a
+// value of a Go type, in the field Struct.Field if it is in one.
+type UnmarshalTypeError struct {
+	Value  string       // the JSON value: "bool", "array", "number -5"...
+	Type   reflect.Type // the type it can't be decoded into
+	Offset int64        // the bytes read before the error
+	Struct string       // the name of the struct with the field
+	Field  string       // the path of the field, with the JSON names
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Struct != "" || e.Field != "" {
+		return "json: cannot unmarshal " + e.Value + " into Go struct field " + e.Struct + "." + e.Field + " of type " + e.Type.String()
+	}
+	return "json: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+}
+
+// An InvalidUnmarshalError is the error of Unmarshal given something else
+// than a non-nil pointer.
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "json: Unmarshal(nil)"
+	}
+	if e.Type.Kind() != reflect.Pointer {
+		return "json: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+	return "json: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// Unmarshal decodes the JSON data into the value v points to. The pointers
+// in it which are nil are allocated, the slices are resized, the maps are
+// made if they are nil and their entries added, and the members of the
+// objects without a field are ignored. A JSON value decoded into an empty
+// interface is a bool, a float64, a string, a []any, a map[string]any or
+// nil. A value of the wrong type is left as it is and the decoding goes
+// on, Unmarshal returns the UnmarshalTypeError of the first one.
+func Unmarshal(data []byte, v any) error {
+	if err := checkValid(data); err != nil {
+		return err
+	}
+	d := &decodeState{data: data}
+	return d.unmarshal(v)
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+var emptyInterfaceType = reflect.TypeOf((*any)(nil)).Elem()
+
+// the fields of the structs being decoded, for the errors
+type errorContext struct {
+	Struct     reflect.Type
+	FieldStack []string
+}
+
+// a decodeState decodes valid JSON
+type decodeState struct {
+	data                  []byte
+	off                   int
+	errorContext          errorContext
+	savedError            error
+	disallowUnknownFields bool
+}
+
+func (d *decodeState) unmarshal(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+	if err := d.value(rv); err != nil {
+		return d.addErrorContext(err)
+	}
+	return d.savedError
+}
+
+// saveError keeps the first error of the values which can't be decoded.
+func (d *decodeState) saveError(err error) {
+	if d.savedError == nil {
+		d.savedError = d.addErrorContext(err)
+	}
+}
+
+func (d *decodeState) addErrorContext(err error) error {
+	if d.errorContext.Struct != nil || len(d.errorContext.FieldStack) > 0 {
+		if err, ok := err.(*UnmarshalTypeError); ok {
+			err.Struct = d.errorContext.Struct.Name()
+			err.Field = strings.Join(d.errorContext.FieldStack, ".")
+		}
+	}
+	return err
+}
+
+func (d *decodeState) skipSpace() {
+	for d.off < len(d.data) && isSpace(d.data[d.off]) {
+		d.off++
+	}
+}
+
+// skip returns the JSON of the value at d.off, and moves past it.
+func (d *decodeState) skip() []byte {
+	d.skipSpace()
+	start := d.off
+	s := &scanner{data: d.data, off: d.off}
+	s.value()
+	d.off = s.off
+	return d.data[start:d.off]
+}
+
+// value decodes the value at d.off into v, or skips it if v is invalid.
+func (d *decodeState) value(v reflect.Value) error {
+	d.skipSpace()
+	if !v.IsValid() {
+		d.skip()
+		return nil
+	}
+	switch d.data[d.off] {
+	case '{':
+		return d.object(v)
+	case '[':
+		return d.array(v)
+	}
+	return d.literal(v)
+}
+
+// indirect goes through the pointers of v, allocating the nil ones, to the
+// value which isn't a pointer. It stops at an Unmarshaler, and at a
+// settable pointer to decode a null.
+func indirect(v reflect.Value, decodingNull bool) (u Unmarshaler, pv reflect.Value) {
+	v0 := v
+	haveAddr := false
+	// a named type may have the methods with its pointer receiver
+	if v.Kind() != reflect.Pointer && v.Type().Name() != "" && v.CanAddr() {
+		haveAddr = true
+		v = v.Addr()
+	}
+	for {
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			e := v.Elem()
+			if e.Kind() == reflect.Pointer && !e.IsNil() && (!decodingNull || e.Elem().Kind() == reflect.Pointer) {
+				haveAddr = false
+				v = e
+				continue
+			}
+		}
+		if v.Kind() != reflect.Pointer {
+			break
+		}
+		if decodingNull && v.CanSet() {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if v.Type().Implements(unmarshalerType) && v.CanInterface() {
+			return v.Interface().(Unmarshaler), reflect.Value{}
+		}
+		if haveAddr {
+			v = v0
+			haveAddr = false
+		} else {
+			v = v.Elem()
+		}
+	}
+	return nil, v
+}
+
+// isEmptyInterface reports whether v is an interface without methods.
+func isEmptyInterface(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && emptyInterfaceType.Implements(v.Type())
+}
+
+func (d *decodeState) array(v reflect.Value) error {
+	u, pv := indirect(v, false)
+	if u != nil {
+		return u.UnmarshalJSON(d.skip())
+	}
+	v = pv
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+	default:
+		if isEmptyInterface(v) {
+			v.Set(reflect.ValueOf(d.arrayInterface()))
+			return nil
+		}
+		d.saveError(&UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: int64(d.off + 1)})
+		d.skip()
+		return nil
+	}
+
+	d.off++
+	i := 0
+	for {
+		d.skipSpace()
+		if d.data[d.off] == ']' {
+			d.off++
+			break
+		}
+		if v.Kind() == reflect.Slice {
+			// the slice grows like with append
+			if i >= v.Cap() {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			if i >= v.Len() {
+				v.SetLen(i + 1)
+			}
+		}
+		if i < v.Len() {
+			if err := d.value(v.Index(i)); err != nil {
+				return err
+			}
+		} else {
+			// the elements past the length of an array are ignored
+			d.skip()
+		}
+		i++
+		d.skipSpace()
+		if d.data[d.off] == ',' {
+			d.off++
+		}
+	}
+	if i < v.Len() {
+		if v.Kind() == reflect.Array {
+			for ; i < v.Len(); i++ {
+				v.Index(i).SetZero()
+			}
+		} else {
+			v.SetLen(i)
+		}
+	}
+	if i == 0 && v.Kind() == reflect.Slice {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+	}
+	return nil
+}
+
+func (d *decodeState) object(v reflect.Value) error {
+	u, pv := indirect(v, false)
+	if u != nil {
+		return u.UnmarshalJSON(d.skip())
+	}
+	v = pv
+	t := v.Type()
+	if isEmptyInterface(v) {
+		v.Set(reflect.ValueOf(d.objectInterface()))
+		return nil
+	}
+
+	var fields []field
+	switch v.Kind() {
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Uintptr:
+		default:
+			d.saveError(&UnmarshalTypeError{Value: "object", Type: t, Offset: int64(d.off + 1)})
+			d.skip()
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+	case reflect.Struct:
+		fields = cachedTypeFields(t)
+	default:
+		d.saveError(&UnmarshalTypeError{Value: "object", Type: t, Offset: int64(d.off + 1)})
+		d.skip()
+		return nil
+	}
+
+	origErrorContext := d.errorContext
+	d.off++
+	for {
+		d.skipSpace()
+		if d.data[d.off] == '}' {
+			d.off++
+			return nil
+		}
+		start := d.off
+		key := unquote(d.skip())
+		d.skipSpace()
+		d.off++ // the colon
+
+		var subv reflect.Value
+		if v.Kind() == reflect.Map {
+			subv = reflect.New(t.Elem()).Elem()
+		} else if f, ok := fieldNamed(fields, key); ok {
+			subv = v
+			for _, i := range f.index {
+				if subv.Kind() == reflect.Pointer {
+					if subv.IsNil() {
+						if !subv.CanSet() {
+							d.saveError(errors.New("json: cannot set embedded pointer to unexported struct: " + subv.Type().Elem().String()))
+							subv = reflect.Value{}
+							break
+						}
+						subv.Set(reflect.New(subv.Type().Elem()))
+					}
+					subv = subv.Elem()
+				}
+				subv = subv.Field(i)
+			}
+			d.errorContext.FieldStack = append(d.errorContext.FieldStack, f.name)
+			d.errorContext.Struct = t
+		} else if d.disallowUnknownFields {
+			d.saveError(errors.New("json: unknown field " + strconv.Quote(key)))
+		}
+
+		if err := d.value(subv); err != nil {
+			return err
+		}
+
+		if v.Kind() == reflect.Map {
+			kt := t.Key()
+			kv := reflect.New(kt).Elem()
+			switch kt.Kind() {
+			case reflect.String:
+				kv.SetString(key)
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				n, err := strconv.ParseInt(key, 10, 64)
+				if err != nil || kv.OverflowInt(n) {
+					d.saveError(&UnmarshalTypeError{Value: "number " + key, Type: kt, Offset: int64(start + 1)})
+					kv = reflect.Value{}
+					break
+				}
+				kv.SetInt(n)
+			default:
+				n, ok := parseUint(key)
+				if !ok || kv.OverflowUint(n) {
+					d.saveError(&UnmarshalTypeError{Value: "number " + key, Type: kt, Offset: int64(start + 1)})
+					kv = reflect.Value{}
+					break
+				}
+				kv.SetUint(n)
+			}
+			if kv.IsValid() {
+				v.SetMapIndex(kv, subv)
+			}
+		}
+
+		d.errorContext.FieldStack = d.errorContext.FieldStack[:len(origErrorContext.FieldStack)]
+		d.errorContext.Struct = origErrorContext.Struct
+		d.skipSpace()
+		if d.data[d.off] == ',' {
+			d.off++
+		}
+	}
+}
+
+// fieldNamed returns the field of the member key, the one with its name
+// or else one with it in another case.
+func fieldNamed(fields []field, key string) (field, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.ToLower(f.name) == strings.ToLower(key) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// literal decodes a null, a bool, a number or a string into v.
+func (d *decodeState) literal(v reflect.Value) error {
+	item := d.skip()
+	isNull := item[0] == 'n'
+	u, pv := indirect(v, isNull)
+	if u != nil {
+		return u.UnmarshalJSON(item)
+	}
+	v = pv
+	offset := int64(d.off)
+
+	switch c := item[0]; {
+	case c == 'n':
+		switch v.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			v.SetZero()
+		}
+	case c == 't' || c == 'f':
+		value := c == 't'
+		switch {
+		case v.Kind() == reflect.Bool:
+			v.SetBool(value)
+		case isEmptyInterface(v):
+			v.Set(reflect.ValueOf(value))
+		default:
+			d.saveError(&UnmarshalTypeError{Value: "bool", Type: v.Type(), Offset: offset})
+		}
+	case c == '"':
+		s := unquote(item)
+		switch {
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			b, err := base64Decode(s)
+			if err != nil {
+				d.saveError(err)
+				break
+			}
+			bv := reflect.MakeSlice(v.Type(), len(b), len(b))
+			for i, x := range b {
+				bv.Index(i).SetUint(uint64(x))
+			}
+			v.Set(bv)
+		case v.Kind() == reflect.String:
+			v.SetString(s)
+		case isEmptyInterface(v):
+			v.Set(reflect.ValueOf(s))
+		default:
+			d.saveError(&UnmarshalTypeError{Value: "string", Type: v.Type(), Offset: offset})
+		}
+	default:
+		s := string(item)
+		switch v.Kind() {
+		case reflect.Interface:
+			if !isEmptyInterface(v) {
+				d.saveError(&UnmarshalTypeError{Value: "number", Type: v.Type(), Offset: offset})
+				break
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: reflect.TypeOf(0.0), Offset: offset})
+				break
+			}
+			v.Set(reflect.ValueOf(f))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || v.OverflowInt(n) {
+				d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: offset})
+				break
+			}
+			v.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Uintptr:
+			n, ok := parseUint(s)
+			if !ok || v.OverflowUint(n) {
+				d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: offset})
+				break
+			}
+			v.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			n, err := strconv.ParseFloat(s, v.Type().Bits())
+			if err != nil || v.OverflowFloat(n) {
+				d.saveError(&UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: offset})
+				break
+			}
+			v.SetFloat(n)
+		default:
+			d.saveError(&UnmarshalTypeError{Value: "number", Type: v.Type(), Offset: offset})
+		}
+	}
+	return nil
+}
+
+// valueInterface returns the value at d.off as a bool, a float64, a
+// string, a []any, a map[string]any or nil.
+func (d *decodeState) valueInterface() any {
+	d.skipSpace()
+	switch d.data[d.off] {
+	case '{':
+		return d.objectInterface()
+	case '[':
+		return d.arrayInterface()
+	}
+	item := d.skip()
+	switch item[0] {
+	case 'n':
+		return nil
+	case 't':
+		return true
+	case 'f':
+		return false
+	case '"':
+		return unquote(item)
+	}
+	f, _ := strconv.ParseFloat(string(item), 64)
+	return f
+}
+
+func (d *decodeState) arrayInterface() []any {
+	v := []any{}
+	d.off++
+	for {
+		d.skipSpace()
+		if d.data[d.off] == ']' {
+			d.off++
+			return v
+		}
+		v = append(v, d.valueInterface())
+		d.skipSpace()
+		if d.data[d.off] == ',' {
+			d.off++
+		}
+	}
+}
+
+func (d *decodeState) objectInterface() map[string]any {
+	m := map[string]any{}
+	d.off++
+	for {
+		d.skipSpace()
+		if d.data[d.off] == '}' {
+			d.off++
+			return m
+		}
+		key := unquote(d.skip())
+		d.skipSpace()
+		d.off++ // the colon
+		m[key] = d.valueInterface()
+		d.skipSpace()
+		if d.data[d.off] == ',' {
+			d.off++
+		}
+	}
+}
+
+// parseUint returns the unsigned decimal integer s.
+func parseUint(s string) (uint64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		d := uint64(c - '0')
+		if n > (1<<64-1-d)/10 {
+			return 0, false
+		}
+		n = n*10 + d
+	}
+	return n, true
+}
+
+// unquote returns the string of the valid JSON string item, the lone
+// surrogates and the invalid UTF-8 in it as U+FFFD.
+func unquote(item []byte) string {
+	s := string(item[1 : len(item)-1])
+	var b []byte
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == '\\' {
+			i++
+			switch e := s[i]; e {
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'u':
+				r := hexRune(s[i+1 : i+5])
+				i += 4
+				if surr1 <= r && r < surr2 && i+6 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+					// a pair of surrogates is a rune after U+FFFF
+					if r2 := hexRune(s[i+3 : i+7]); surr2 <= r2 && r2 < surr3 {
+						r = 1<<16 + (r-surr1)<<10 + (r2 - surr2)
+						i += 6
+					}
+				}
+				if surr1 <= r && r < surr3 {
+					r = runeError
+				}
+				b = append(b, string(r)...)
+			default:
+				b = append(b, e)
+			}
+			i++
+			continue
+		}
+		r, size := decodeRune(s[i:])
+		if r == runeError && size == 1 {
+			b = append(b, string(r)...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return string(b)
+}
+
+func hexRune(s string) rune {
+	var r rune
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		default:
+			c -= 'A' - 10
+		}
+		r = r<<4 | rune(c)
+	}
+	return r
+}
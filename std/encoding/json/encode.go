@@ -0,0 +1,766 @@
+// Package json encodes and decodes JSON like the encoding/json package of
+// Go, written with std/reflect: Marshal and Unmarshal the bools, the
+// numbers, the strings, the slices and arrays (a []byte as base64), the
+// maps with string or integer keys, the pointers, the interfaces and the
+// structs, whose exported fields are the members of their objects, named
+// by their json tags (`json:"name,omitempty"`). The fields of the embedded
+// structs without a tag are promoted like in Go, and the types with the
+// methods MarshalJSON and UnmarshalJSON encode and decode themselves. The
+// ",string" option and Number aren't supported.
+package json
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Marshaler is the interface of the types encoding themselves as JSON.
+type Marshaler interface {
+	MarshalJSON() ([]byte, error)
+}
+
+// An UnsupportedTypeError is the error of Marshal for a value of a type
+// JSON can't have, like a func or a chan.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "json: unsupported type: " + e.Type.String()
+}
+
+// An UnsupportedValueError is the error of Marshal for a value JSON can't
+// have, like a NaN or a cycle of pointers.
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	return "json: unsupported value: " + e.Str
+}
+
+// A MarshalerError is the error of the MarshalJSON method of a type, or of
+// what it returned if it isn't valid JSON.
+type MarshalerError struct {
+	Type reflect.Type
+	Err  error
+}
+
+func (e *MarshalerError) Error() string {
+	return "json: error calling MarshalJSON for type " + e.Type.String() + ": " + e.Err.Error()
+}
+
+func (e *MarshalerError) Unwrap() error {
+	return e.Err
+}
+
+// Marshal returns the JSON encoding of v. The strings are escaped for HTML,
+// like "<" as "\u003c".
+func Marshal(v any) ([]byte, error) {
+	e := &encodeState{escapeHTML: true}
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// MarshalIndent is like Marshal, with each element of an array or of an
+// object on its own line, starting with prefix and indented with indent
+// for each level.
+func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	b, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendIndent(nil, b, prefix, indent), nil
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// an encodeState is the JSON written by Marshal
+type encodeState struct {
+	buf        []byte
+	escapeHTML bool
+	// the pointers encoded in the ones being encoded, for the cycles
+	seen map[any]bool
+}
+
+func (e *encodeState) value(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	t := v.Type()
+	if t.Implements(marshalerType) && v.CanInterface() {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			e.buf = append(e.buf, "null"...)
+			return nil
+		}
+		return e.marshaler(v.Interface().(Marshaler))
+	}
+	if t.Kind() != reflect.Pointer && v.CanAddr() &&
+		reflect.PointerTo(t).Implements(marshalerType) && v.CanInterface() {
+		return e.marshaler(v.Addr().Interface().(Marshaler))
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		e.buf = append(e.buf, strconv.FormatBool(v.Bool())...)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.buf = append(e.buf, strconv.FormatInt(v.Int(), 10)...)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		e.buf = append(e.buf, formatUint(v.Uint())...)
+	case reflect.Float32, reflect.Float64:
+		return e.float(v)
+	case reflect.String:
+		e.buf = appendString(e.buf, v.String(), e.escapeHTML)
+	case reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, "null"...)
+			return nil
+		}
+		return e.value(v.Elem())
+	case reflect.Pointer:
+		return e.pointer(v)
+	case reflect.Struct:
+		return e.object(v)
+	case reflect.Map:
+		return e.mapObject(v)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, "null"...)
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 && !t.Elem().Implements(marshalerType) &&
+			!reflect.PointerTo(t.Elem()).Implements(marshalerType) {
+			// a []byte is a base64 string
+			b := make([]byte, v.Len())
+			for i := range b {
+				b[i] = byte(v.Index(i).Uint())
+			}
+			e.buf = append(e.buf, '"')
+			e.buf = append(e.buf, base64Encode(b)...)
+			e.buf = append(e.buf, '"')
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		return e.array(v)
+	default:
+		return &UnsupportedTypeError{t}
+	}
+	return nil
+}
+
+// marshaler appends the JSON m encodes itself as, compacted.
+func (e *encodeState) marshaler(m Marshaler) error {
+	b, err := m.MarshalJSON()
+	if err == nil {
+		err = checkValid(b)
+	}
+	if err != nil {
+		return &MarshalerError{reflect.TypeOf(m), err}
+	}
+	e.buf = appendCompact(e.buf, b)
+	return nil
+}
+
+func (e *encodeState) float(v reflect.Value) error {
+	f := v.Float()
+	bits := v.Type().Bits()
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return &UnsupportedValueError{v, strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+	// like ES6, the exponent form is for the very large and small numbers
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	s := strconv.FormatFloat(f, format, -1, bits)
+	if format == 'e' {
+		// e-09 is e-9
+		if n := len(s); n >= 4 && s[n-4] == 'e' && s[n-3] == '-' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+	}
+	e.buf = append(e.buf, s...)
+	return nil
+}
+
+func (e *encodeState) pointer(v reflect.Value) error {
+	if v.IsNil() {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	if v.CanInterface() {
+		p := v.Interface()
+		if e.seen[p] {
+			return &UnsupportedValueError{v, "encountered a cycle via " + v.Type().String()}
+		}
+		if e.seen == nil {
+			e.seen = map[any]bool{}
+		}
+		e.seen[p] = true
+		defer delete(e.seen, p)
+	}
+	return e.value(v.Elem())
+}
+
+func (e *encodeState) array(v reflect.Value) error {
+	e.buf = append(e.buf, '[')
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		if err := e.value(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, ']')
+	return nil
+}
+
+func (e *encodeState) object(v reflect.Value) error {
+	e.buf = append(e.buf, '{')
+	first := true
+fields:
+	for _, f := range cachedTypeFields(v.Type()) {
+		fv := v
+		for _, i := range f.index {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					// the fields of a nil embedded pointer are left out
+					continue fields
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(i)
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		if !first {
+			e.buf = append(e.buf, ',')
+		}
+		first = false
+		e.buf = appendString(e.buf, f.name, e.escapeHTML)
+		e.buf = append(e.buf, ':')
+		if err := e.value(fv); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, '}')
+	return nil
+}
+
+// mapObject writes a map as an object whose members are sorted by key.
+func (e *encodeState) mapObject(v reflect.Value) error {
+	if v.IsNil() {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	var keys []string
+	values := map[string]reflect.Value{}
+	for _, k := range v.MapKeys() {
+		var key string
+		switch k.Kind() {
+		case reflect.String:
+			key = k.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key = strconv.FormatInt(k.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Uintptr:
+			key = formatUint(k.Uint())
+		default:
+			return &UnsupportedTypeError{v.Type()}
+		}
+		keys = append(keys, key)
+		values[key] = v.MapIndex(k)
+	}
+	sort.Strings(keys)
+	e.buf = append(e.buf, '{')
+	for i, key := range keys {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.buf = appendString(e.buf, key, e.escapeHTML)
+		e.buf = append(e.buf, ':')
+		if err := e.value(values[key]); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, '}')
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// A field is a field of a struct type encoded as a member of its objects,
+// index is its path from the struct through the embedded structs.
+type field struct {
+	name      string
+	tagged    bool
+	index     []int
+	typ       reflect.Type
+	omitEmpty bool
+}
+
+var fieldCache = map[reflect.Type][]field{}
+
+func cachedTypeFields(t reflect.Type) []field {
+	fields, ok := fieldCache[t]
+	if !ok {
+		fields = typeFields(t)
+		fieldCache[t] = fields
+	}
+	return fields
+}
+
+// typeFields returns the fields of the struct type t encoded, in the order
+// of their index, with the ones of its embedded structs without a tag. Of
+// the fields with the same name, the least embedded one is encoded, the
+// tagged one of several at the same depth, and none if it is ambiguous.
+func typeFields(t reflect.Type) []field {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var fields []field
+	next := []embedded{{typ: t}}
+	visited := map[reflect.Type]bool{}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, s := range current {
+			if visited[s.typ] {
+				continue
+			}
+			visited[s.typ] = true
+			for i := 0; i < s.typ.NumField(); i++ {
+				sf := s.typ.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+				if !isValidTag(name) {
+					name = ""
+				}
+				index := append(append([]int{}, s.index...), i)
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{ft, index})
+					continue
+				}
+				f := field{name: name, tagged: name != "", index: index, typ: sf.Type,
+					omitEmpty: opts.contains("omitempty")}
+				if f.name == "" {
+					f.name = sf.Name
+				}
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	var dominant []field
+	for _, f := range fields {
+		if g, ok := dominantField(fields, f.name); ok && sameIndex(f.index, g.index) {
+			dominant = append(dominant, f)
+		}
+	}
+	sort.Slice(dominant, func(i, j int) bool {
+		x, y := dominant[i].index, dominant[j].index
+		for k := 0; k < len(x) && k < len(y); k++ {
+			if x[k] != y[k] {
+				return x[k] < y[k]
+			}
+		}
+		return len(x) < len(y)
+	})
+	return dominant
+}
+
+// dominantField returns the field named name which is encoded.
+func dominantField(fields []field, name string) (field, bool) {
+	var found []field
+	depth := -1
+	for _, f := range fields {
+		if f.name != name {
+			continue
+		}
+		if depth == -1 || len(f.index) < depth {
+			depth = len(f.index)
+			found = nil
+		}
+		if len(f.index) == depth {
+			found = append(found, f)
+		}
+	}
+	var tagged []field
+	for _, f := range found {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	if len(tagged) == 0 && len(found) == 1 {
+		return found[0], true
+	}
+	return field{}, false
+}
+
+func sameIndex(x, y []int) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+			// the punctuation allowed in the names
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c >= runeSelf:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+const hex = "0123456789abcdef"
+
+// appendString appends s as a JSON string: the quotes, the backslashes and
+// the control characters are escaped, the invalid UTF-8 is \ufffd, and
+// <, > and & are escaped too with escapeHTML.
+func appendString(dst []byte, s string, escapeHTML bool) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < runeSelf {
+			if b >= ' ' && b != '"' && b != '\\' && (!escapeHTML || b != '<' && b != '>' && b != '&') {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&15])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := decodeRune(s[i:])
+		if r == runeError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 end the lines of JavaScript
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&15])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+const (
+	runeSelf  = '\u0080' // the runes under it are a byte in UTF-8
+	runeError = '\uFFFD' // the rune of the invalid UTF-8
+	maxRune   = '\U0010FFFF'
+	// the surrogates, from surr1 to surr3, are the halves of the runes of
+	// UTF-16 after U+FFFF (U+D800 to U+DBFF, then U+DC00 to U+DFFF)
+	surr1 = 55296
+	surr2 = 56320
+	surr3 = 57344
+)
+
+// decodeRune returns the first rune of s and its size, (runeError, 1) if
+// s doesn't start with valid UTF-8.
+func decodeRune(s string) (rune, int) {
+	b := s[0]
+	var size int
+	var r, min rune
+	switch {
+	case b < runeSelf:
+		return rune(b), 1
+	case b>>5 == 6: // 110xxxxx
+		size, r, min = 2, rune(b&(1<<5-1)), 1<<7
+	case b>>4 == 14: // 1110xxxx
+		size, r, min = 3, rune(b&(1<<4-1)), 1<<11
+	case b>>3 == 30: // 11110xxx
+		size, r, min = 4, rune(b&(1<<3-1)), 1<<16
+	default:
+		return runeError, 1
+	}
+	if len(s) < size {
+		return runeError, 1
+	}
+	for i := 1; i < size; i++ {
+		if s[i]>>6 != 2 { // 10xxxxxx
+			return runeError, 1
+		}
+		r = r<<6 | rune(s[i]&(1<<6-1))
+	}
+	if r < min || r > maxRune || surr1 <= r && r < surr3 {
+		return runeError, 1
+	}
+	return r, size
+}
+
+func formatUint(u uint64) string {
+	if u == 0 {
+		return "0"
+	}
+	var b []byte
+	for ; u > 0; u /= 10 {
+		b = append([]byte{byte('0' + u%10)}, b...)
+	}
+	return string(b)
+}
+
+// appendCompact appends the valid JSON src without its spaces.
+func appendCompact(dst, src []byte) []byte {
+	inString := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if inString {
+			dst = append(dst, c)
+			if c == '\\' {
+				i++
+				dst = append(dst, src[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if isSpace(c) {
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// appendIndent appends the compact JSON src with its elements and its
+// members on lines of their own.
+func appendIndent(dst, src []byte, prefix, indent string) []byte {
+	depth := 0
+	newline := func() {
+		dst = append(dst, '\n')
+		dst = append(dst, prefix...)
+		for i := 0; i < depth; i++ {
+			dst = append(dst, indent...)
+		}
+	}
+	inString := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if inString {
+			dst = append(dst, c)
+			if c == '\\' {
+				i++
+				dst = append(dst, src[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+			dst = append(dst, c)
+		case '{', '[':
+			dst = append(dst, c)
+			if i+1 < len(src) && (src[i+1] == '}' || src[i+1] == ']') {
+				// an empty object or array
+				i++
+				dst = append(dst, src[i])
+				continue
+			}
+			depth++
+			newline()
+		case ',':
+			dst = append(dst, c)
+			newline()
+		case ':':
+			dst = append(dst, ':', ' ')
+		case '}', ']':
+			depth--
+			newline()
+			dst = append(dst, c)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// base64Encode returns b in the standard base64 encoding, padded.
+func base64Encode(b []byte) string {
+	var out []byte
+	for i := 0; i < len(b); i += 3 {
+		n := len(b) - i
+		v := uint(b[i]) << 16
+		if n > 1 {
+			v |= uint(b[i+1]) << 8
+		}
+		if n > 2 {
+			v |= uint(b[i+2])
+		}
+		out = append(out, base64Alphabet[v>>18&(1<<6-1)], base64Alphabet[v>>12&(1<<6-1)])
+		if n > 1 {
+			out = append(out, base64Alphabet[v>>6&(1<<6-1)])
+		} else {
+			out = append(out, '=')
+		}
+		if n > 2 {
+			out = append(out, base64Alphabet[v&(1<<6-1)])
+		} else {
+			out = append(out, '=')
+		}
+	}
+	return string(out)
+}
+
+// A corruptInputError is the error of the base64 decoding of a []byte,
+// at the byte of the input it is at.
+type corruptInputError int64
+
+func (e corruptInputError) Error() string {
+	return "illegal base64 data at input byte " + strconv.FormatInt(int64(e), 10)
+}
+
+// base64Decode returns the bytes of the standard base64 encoding s, the
+// newlines in it are ignored. It is read in quanta of 4 characters, the
+// last one may be padded with =.
+func base64Decode(s string) ([]byte, error) {
+	var out []byte
+	si := 0
+	for si < len(s) {
+		var q [4]byte
+		j := 0
+	quantum:
+		for j < 4 {
+			if si == len(s) {
+				if j == 0 {
+					return out, nil
+				}
+				return nil, corruptInputError(si - j)
+			}
+			c := s[si]
+			si++
+			if c == '\n' || c == '\r' {
+				continue
+			}
+			if c != '=' {
+				k := strings.Index(base64Alphabet, string(c))
+				if k < 0 {
+					return nil, corruptInputError(si - 1)
+				}
+				q[j] = byte(k)
+				j++
+				continue
+			}
+			// the padding ends the input
+			switch j {
+			case 0, 1:
+				return nil, corruptInputError(si - 1)
+			case 2:
+				si = skipNewlines(s, si)
+				if si == len(s) {
+					return nil, corruptInputError(len(s))
+				}
+				if s[si] != '=' {
+					return nil, corruptInputError(si - 1)
+				}
+				si++
+			}
+			if si = skipNewlines(s, si); si < len(s) {
+				return nil, corruptInputError(si)
+			}
+			break quantum
+		}
+		v := uint(q[0])<<18 | uint(q[1])<<12 | uint(q[2])<<6 | uint(q[3])
+		out = append(out, byte(v>>16), byte(v>>8), byte(v))[:len(out)+j-1]
+	}
+	return out, nil
+}
+
+func skipNewlines(s string, i int) int {
+	for i < len(s) && (s[i] == '\n' || s[i] == '\r') {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,253 @@
+package json
+
+import "strconv"
+
+// A SyntaxError is a description of a JSON syntax error, at the byte
+// Offset of the input.
+type SyntaxError struct {
+	msg    string
+	Offset int64 // the bytes read before the error
+}
+
+func (e *SyntaxError) Error() string {
+	return e.msg
+}
+
+// a scanner checks that its data is valid JSON, with the errors of Go
+type scanner struct {
+	data []byte
+	off  int
+}
+
+// errorAt returns the error of the unexpected byte at s.off, or of the end
+// of the data if there is none.
+func (s *scanner) errorAt(context string) error {
+	if s.off >= len(s.data) {
+		return &SyntaxError{"unexpected end of JSON input", int64(len(s.data))}
+	}
+	c := s.data[s.off]
+	return &SyntaxError{"invalid character " + quoteChar(c) + " " + context, int64(s.off + 1)}
+}
+
+// errorInLiteral is errorAt in a number or a literal, where the end of
+// the data is read as a space, which is invalid in them.
+func (s *scanner) errorInLiteral(context string) error {
+	if s.off >= len(s.data) {
+		return &SyntaxError{"invalid character ' ' " + context, int64(len(s.data))}
+	}
+	return s.errorAt(context)
+}
+
+func (s *scanner) skipSpace() {
+	for s.off < len(s.data) && isSpace(s.data[s.off]) {
+		s.off++
+	}
+}
+
+func (s *scanner) peek() byte {
+	if s.off < len(s.data) {
+		return s.data[s.off]
+	}
+	return 0
+}
+
+// value scans the value at s.off, after the spaces before it.
+func (s *scanner) value() error {
+	s.skipSpace()
+	switch c := s.peek(); {
+	case c == '{':
+		return s.object()
+	case c == '[':
+		return s.array()
+	case c == '"':
+		return s.str()
+	case c == '-' || '0' <= c && c <= '9':
+		return s.number()
+	case c == 't':
+		return s.literal("true")
+	case c == 'f':
+		return s.literal("false")
+	case c == 'n':
+		return s.literal("null")
+	}
+	return s.errorAt("looking for beginning of value")
+}
+
+func (s *scanner) object() error {
+	s.off++
+	s.skipSpace()
+	if s.peek() == '}' {
+		s.off++
+		return nil
+	}
+	for {
+		if s.peek() != '"' {
+			return s.errorAt("looking for beginning of object key string")
+		}
+		if err := s.str(); err != nil {
+			return err
+		}
+		s.skipSpace()
+		if s.peek() != ':' {
+			return s.errorAt("after object key")
+		}
+		s.off++
+		if err := s.value(); err != nil {
+			return err
+		}
+		s.skipSpace()
+		switch s.peek() {
+		case ',':
+			s.off++
+			s.skipSpace()
+		case '}':
+			s.off++
+			return nil
+		default:
+			return s.errorAt("after object key:value pair")
+		}
+	}
+}
+
+func (s *scanner) array() error {
+	s.off++
+	s.skipSpace()
+	if s.peek() == ']' {
+		s.off++
+		return nil
+	}
+	for {
+		if err := s.value(); err != nil {
+			return err
+		}
+		s.skipSpace()
+		switch s.peek() {
+		case ',':
+			s.off++
+		case ']':
+			s.off++
+			return nil
+		default:
+			return s.errorAt("after array element")
+		}
+	}
+}
+
+func (s *scanner) str() error {
+	s.off++
+	for s.off < len(s.data) {
+		c := s.data[s.off]
+		switch {
+		case c == '"':
+			s.off++
+			return nil
+		case c < ' ':
+			return s.errorAt("in string literal")
+		case c == '\\':
+			s.off++
+			switch s.peek() {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				s.off++
+			case 'u':
+				s.off++
+				for i := 0; i < 4; i++ {
+					if !isHex(s.peek()) {
+						return s.errorAt("in \\u hexadecimal character escape")
+					}
+					s.off++
+				}
+			default:
+				return s.errorAt("in string escape code")
+			}
+		default:
+			s.off++
+		}
+	}
+	return s.errorAt("")
+}
+
+func (s *scanner) number() error {
+	if s.peek() == '-' {
+		s.off++
+		if c := s.peek(); c < '0' || c > '9' {
+			return s.errorInLiteral("in numeric literal")
+		}
+	}
+	if s.peek() == '0' {
+		s.off++
+	} else {
+		s.digits()
+	}
+	if s.peek() == '.' {
+		s.off++
+		if c := s.peek(); c < '0' || c > '9' {
+			return s.errorInLiteral("after decimal point in numeric literal")
+		}
+		s.digits()
+	}
+	if c := s.peek(); c == 'e' || c == 'E' {
+		s.off++
+		if c := s.peek(); c == '+' || c == '-' {
+			s.off++
+		}
+		if c := s.peek(); c < '0' || c > '9' {
+			return s.errorInLiteral("in exponent of numeric literal")
+		}
+		s.digits()
+	}
+	return nil
+}
+
+func (s *scanner) digits() {
+	for s.off < len(s.data) && '0' <= s.data[s.off] && s.data[s.off] <= '9' {
+		s.off++
+	}
+}
+
+func (s *scanner) literal(lit string) error {
+	for i := 0; i < len(lit); i++ {
+		if s.peek() != lit[i] {
+			return s.errorInLiteral("in literal " + lit + " (expecting " + quoteChar(lit[i]) + ")")
+		}
+		s.off++
+	}
+	return nil
+}
+
+// checkValid returns the error of the data if it isn't one JSON value.
+func checkValid(data []byte) error {
+	s := &scanner{data: data}
+	if err := s.value(); err != nil {
+		return err
+	}
+	s.skipSpace()
+	if s.off < len(data) {
+		return s.errorAt("after top-level value")
+	}
+	return nil
+}
+
+// Valid reports whether data is a valid JSON encoding.
+func Valid(data []byte) bool {
+	return checkValid(data) == nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// quoteChar formats c as a quoted character literal.
+func quoteChar(c byte) string {
+	if c == '\'' {
+		return `'\''`
+	}
+	if c == '"' {
+		return `'"'`
+	}
+	s := strconv.Quote(string(rune(c)))
+	return "'" + s[1:len(s)-1] + "'"
+}
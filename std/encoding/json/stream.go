@@ -0,0 +1,137 @@
+package json
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// A Decoder reads the JSON values of an input one after the other. It
+// reads the whole input at its first value.
+type Decoder struct {
+	r                     io.Reader
+	data                  []byte
+	off                   int
+	read                  bool
+	err                   error
+	disallowUnknownFields bool
+}
+
+// errUnexpectedEOF is the error of a value cut by the end of the input,
+// io.ErrUnexpectedEOF in Go.
+var errUnexpectedEOF = errors.New("unexpected EOF")
+
+// NewDecoder returns a Decoder reading r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// DisallowUnknownFields makes Decode return an error for the members of
+// the objects without a field in the struct they are decoded into.
+func (dec *Decoder) DisallowUnknownFields() {
+	dec.disallowUnknownFields = true
+}
+
+func (dec *Decoder) readAll() error {
+	if !dec.read {
+		dec.read = true
+		dec.data, dec.err = io.ReadAll(dec.r)
+	}
+	return dec.err
+}
+
+// Decode decodes the next JSON value of the input into the value v
+// points to, like Unmarshal. It returns io.EOF after the last one.
+func (dec *Decoder) Decode(v any) error {
+	if err := dec.readAll(); err != nil {
+		return err
+	}
+	s := &scanner{data: dec.data, off: dec.off}
+	s.skipSpace()
+	if s.off == len(dec.data) {
+		return io.EOF
+	}
+	start := s.off
+	if err := s.value(); err != nil {
+		// the errors of the input are the errors of the next Decode calls
+		dec.err = err
+		if s.off >= len(dec.data) {
+			dec.err = errUnexpectedEOF
+		}
+		return dec.err
+	}
+	dec.off = s.off
+	d := &decodeState{data: dec.data[start:dec.off],
+		disallowUnknownFields: dec.disallowUnknownFields}
+	return d.unmarshal(v)
+}
+
+// More reports whether there is another value to decode in the input.
+func (dec *Decoder) More() bool {
+	if dec.readAll() != nil {
+		return false
+	}
+	s := &scanner{data: dec.data, off: dec.off}
+	s.skipSpace()
+	c := s.peek()
+	return s.off < len(dec.data) && c != ']' && c != '}'
+}
+
+// An Encoder writes the JSON values to an output, each on its line.
+type Encoder struct {
+	w          io.Writer
+	escapeHTML bool
+	prefix     string
+	indent     string
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, escapeHTML: true}
+}
+
+// SetIndent makes the Encoder write the values like MarshalIndent does.
+func (enc *Encoder) SetIndent(prefix, indent string) {
+	enc.prefix = prefix
+	enc.indent = indent
+}
+
+// SetEscapeHTML sets whether <, > and & are escaped in the strings.
+func (enc *Encoder) SetEscapeHTML(on bool) {
+	enc.escapeHTML = on
+}
+
+// Encode writes the JSON encoding of v and a newline.
+func (enc *Encoder) Encode(v any) error {
+	e := &encodeState{escapeHTML: enc.escapeHTML}
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	b := e.buf
+	if enc.prefix != "" || enc.indent != "" {
+		b = appendIndent(nil, b, enc.prefix, enc.indent)
+	}
+	b = append(b, '\n')
+	_, err := enc.w.Write(b)
+	return err
+}
+
+// RawMessage is JSON encoded as it is, and decoded as the JSON of a value.
+type RawMessage []byte
+
+// MarshalJSON returns m, or null if it is nil.
+func (m RawMessage) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	return m, nil
+}
+
+// UnmarshalJSON sets *m to a copy of data.
+func (m *RawMessage) UnmarshalJSON(data []byte) error {
+	if m == nil {
+		return errors.New("json.RawMessage: UnmarshalJSON on nil pointer")
+	}
+	*m = append((*m)[0:0], data...)
+	return nil
+}
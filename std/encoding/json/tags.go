@@ -0,0 +1,24 @@
+package json
+
+import "strings"
+
+// tagOptions is the part of a json tag after the name.
+type tagOptions string
+
+// parseTag splits a json tag into its name and its options.
+func parseTag(tag string) (string, tagOptions) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tagOptions(tag[i+1:])
+	}
+	return tag, ""
+}
+
+// contains reports whether the options have the option name.
+func (o tagOptions) contains(name string) bool {
+	for _, opt := range strings.Split(string(o), ",") {
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
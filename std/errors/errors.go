@@ -0,0 +1,60 @@
+// Package errors makes errors with a text and unwraps the errors wrapping
+// others, like the errors package of Go does. Unlike fmt, it is written in
+// Go: the interpreter and the VM run it like the packages of the program
+// (gopyrt/errors.py is the one of the Python modules). There is no As, it
+// needs reflection.
+package errors
+
+// New returns an error whose Error method gives text. Each call returns a
+// distinct error, even for the same text.
+func New(text string) error {
+	return &errorString{text}
+}
+
+// errorString is the error made by New.
+type errorString struct {
+	s string
+}
+
+func (e *errorString) Error() string {
+	return e.s
+}
+
+// wrapper is an error wrapping another one, like the errors made by
+// fmt.Errorf with a %w verb.
+type wrapper interface {
+	Unwrap() error
+}
+
+// Unwrap returns the error err wraps, nil if it doesn't wrap one.
+func Unwrap(err error) error {
+	u, ok := err.(wrapper)
+	if !ok {
+		return nil
+	}
+	return u.Unwrap()
+}
+
+// matcher is an error matching others with an Is method, like the errno
+// of os.PathError matches os.ErrNotExist.
+type matcher interface {
+	Is(target error) bool
+}
+
+// Is reports whether err, or one of the errors it wraps (unwrapping it
+// repeatedly), is target or has an Is method reporting it matches it.
+func Is(err, target error) bool {
+	if err == nil || target == nil {
+		return err == target
+	}
+	for err != nil {
+		if err == target {
+			return true
+		}
+		if m, ok := err.(matcher); ok && m.Is(target) {
+			return true
+		}
+		err = Unwrap(err)
+	}
+	return false
+}
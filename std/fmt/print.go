@@ -0,0 +1,86 @@
+// Package fmt formats values like the fmt package of Go does, with the
+// verbs of Printf and their flags. The functions have no bodies: they are
+// implemented by the runtime of each backend (interp.fmt_package for the
+// interpreter and the VM, gopyrt/fmt.py for the Python modules), the
+// declarations are what the type checker knows of them. Errorf and the
+// Fprint functions are written in Go, the interpreter and the VM run them
+// like the functions of the program.
+package fmt
+
+import "io"
+
+// Print formats its operands like %v and writes them to the standard output,
+// spaces are added between operands when neither is a string. It returns
+// the number of bytes written, the error is always nil.
+func Print(a ...any) (n int, err error)
+
+// Println formats its operands like %v and writes them to the standard
+// output, with spaces between operands and a newline at the end.
+func Println(a ...any) (n int, err error)
+
+// Printf formats its operands with the verbs of format and writes them to
+// the standard output.
+func Printf(format string, a ...any) (n int, err error)
+
+// Fprint formats its operands like Print and writes them to w. It returns
+// the number of bytes written and the error of w.
+func Fprint(w io.Writer, a ...any) (n int, err error) {
+	return w.Write([]byte(Sprint(a...)))
+}
+
+// Fprintln formats its operands like Println and writes them to w.
+func Fprintln(w io.Writer, a ...any) (n int, err error) {
+	return w.Write([]byte(Sprintln(a...)))
+}
+
+// Fprintf formats its operands like Printf and writes them to w.
+func Fprintf(w io.Writer, format string, a ...any) (n int, err error) {
+	return w.Write([]byte(Sprintf(format, a...)))
+}
+
+// Sprint formats its operands like Print and returns the string.
+func Sprint(a ...any) string
+
+// Sprintln formats its operands like Println and returns the string.
+func Sprintln(a ...any) string
+
+// Sprintf formats its operands like Printf and returns the string.
+func Sprintf(format string, a ...any) string
+
+// Errorf formats its operands like Sprintf and returns the string as an
+// error. The operand of a %w verb, which has to be an error, is wrapped by
+// it: errors.Unwrap gives it back.
+func Errorf(format string, a ...any) error {
+	text, wrapped := errorf(format, a...)
+	if wrapped < 0 {
+		return &fmtError{text}
+	}
+	return &wrapError{text, a[wrapped].(error)}
+}
+
+// errorf formats its operands like Sprintf, with %w like %v for an error,
+// and gives the index of the operand of the %w verb (-1 if there is none).
+func errorf(format string, a ...any) (string, int)
+
+// fmtError is the error made by Errorf without a %w verb.
+type fmtError struct {
+	msg string
+}
+
+func (e *fmtError) Error() string {
+	return e.msg
+}
+
+// wrapError is the error made by Errorf wrapping another one.
+type wrapError struct {
+	msg string
+	err error
+}
+
+func (e *wrapError) Error() string {
+	return e.msg
+}
+
+func (e *wrapError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,50 @@
+// Package io has the Reader and Writer interfaces of the io package of Go,
+// which os.File implements and fmt.Fprint writes to, and the functions
+// reading and writing them. It is written in Go: the interpreter and the
+// VM run it like the packages of the program (gopyrt/io.py is the one of
+// the Python modules).
+package io
+
+import "errors"
+
+// EOF is the error returned by Read when no more input is available.
+var EOF = errors.New("EOF")
+
+// Reader is the interface that wraps the basic Read method. Read reads up
+// to len(p) bytes into p and returns the number of bytes read, with EOF
+// at the end of the input.
+type Reader interface {
+	Read(p []byte) (n int, err error)
+}
+
+// Writer is the interface that wraps the basic Write method. Write writes
+// len(p) bytes from p and returns the number of bytes written, an error if
+// it is less than len(p).
+type Writer interface {
+	Write(p []byte) (n int, err error)
+}
+
+// ReadAll reads from r until an error or EOF and returns the data it read.
+// A successful call returns err == nil, not err == EOF.
+func ReadAll(r Reader) ([]byte, error) {
+	b := make([]byte, 0, 512)
+	for {
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err != nil {
+			if err == EOF {
+				err = nil
+			}
+			return b, err
+		}
+		if len(b) == cap(b) {
+			// grows the array, the data is read after the appended byte
+			b = append(b, 0)[:len(b)]
+		}
+	}
+}
+
+// WriteString writes the contents of the string s to w.
+func WriteString(w Writer, s string) (n int, err error) {
+	return w.Write([]byte(s))
+}
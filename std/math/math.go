@@ -0,0 +1,96 @@
+// Package math has the mathematical constants and a subset of the
+// functions of the math package of Go. The constants are exact, like the
+// ones of the program, so expressions of them are folded by the type
+// checker (const tau = math.Pi * 2). The functions without bodies are
+// implemented by the runtime of each backend (interp.math_package for the
+// interpreter and the VM, gopyrt/math.py for the Python modules).
+package math
+
+// Mathematical constants.
+const (
+	E   = 2.71828182845904523536028747135266249775724709369995957496696763
+	Pi  = 3.14159265358979323846264338327950288419716939937510582097494459
+	Phi = 1.61803398874989484820458683436563811772030917980576286213544862
+
+	Sqrt2  = 1.41421356237309504880168872420969807856967187537694807317667974
+	Ln2    = 0.693147180559945309417232121458176568075500134360255254120680009
+	Log2E  = 1 / Ln2
+	Ln10   = 2.30258509299404568401799145468436420760110148862877297603332790
+	Log10E = 1 / Ln10
+)
+
+// Floating-point limit values. Max is the largest finite value
+// representable by the type. SmallestNonzero is the smallest positive,
+// non-zero value representable by the type. (They are 0x1p127 * (1 + (1 -
+// 0x1p-23)) and so on in Go, the lexer has no hexadecimal floats, and the
+// untyped integer constants have 512 bits at most.)
+const (
+	MaxFloat32             = 1.0 * (1<<24 - 1) * (1 << 104)
+	SmallestNonzeroFloat32 = 1.0 / (1 << 149)
+
+	MaxFloat64             = 1.0 * (1<<53 - 1) * (1 << 500) * (1 << 471)
+	SmallestNonzeroFloat64 = 1.0 / (1 << 358) / (1 << 358) / (1 << 358)
+)
+
+// Integer limit values.
+const (
+	intSize = 64 // the size of int and uint in bits
+
+	MaxInt    = 1<<(intSize-1) - 1
+	MinInt    = -1 << (intSize - 1)
+	MaxInt8   = 1<<7 - 1
+	MinInt8   = -1 << 7
+	MaxInt16  = 1<<15 - 1
+	MinInt16  = -1 << 15
+	MaxInt32  = 1<<31 - 1
+	MinInt32  = -1 << 31
+	MaxInt64  = 1<<63 - 1
+	MinInt64  = -1 << 63
+	MaxUint   = 1<<intSize - 1
+	MaxUint8  = 1<<8 - 1
+	MaxUint16 = 1<<16 - 1
+	MaxUint32 = 1<<32 - 1
+	MaxUint64 = 1<<64 - 1
+)
+
+// Sqrt returns the square root of x, NaN if x < 0.
+func Sqrt(x float64) float64
+
+// Floor returns the greatest integer value less than or equal to x.
+func Floor(x float64) float64
+
+// Ceil returns the least integer value greater than or equal to x.
+func Ceil(x float64) float64 {
+	return -Floor(-x)
+}
+
+// Abs returns the absolute value of x.
+func Abs(x float64) float64
+
+// Pow returns x**y, with the special cases of Go: Pow(x, ±0) is 1 for any
+// x, Pow(±0, y) is ±Inf for y < 0, and Pow(x, y) is NaN for a finite x < 0
+// and a finite non-integer y.
+func Pow(x, y float64) float64
+
+// Mod returns the floating-point remainder of x/y, with the sign of x. It
+// is NaN if x is ±Inf or NaN, or if y is 0 or NaN.
+func Mod(x, y float64) float64
+
+// Inf returns positive infinity if sign >= 0, negative infinity if sign < 0.
+func Inf(sign int) float64
+
+// NaN returns an IEEE 754 “not-a-number” value.
+func NaN() float64
+
+// IsNaN reports whether f is an IEEE 754 “not-a-number” value.
+func IsNaN(f float64) (is bool) {
+	return f != f
+}
+
+// IsInf reports whether f is an infinity, according to sign. If sign > 0,
+// IsInf reports whether f is positive infinity. If sign < 0, IsInf
+// reports whether f is negative infinity. If sign == 0, IsInf reports
+// whether f is either infinity.
+func IsInf(f float64, sign int) bool {
+	return sign >= 0 && f > MaxFloat64 || sign <= 0 && f < -MaxFloat64
+}
@@ -0,0 +1,243 @@
+// Package os gives the arguments of the program, ends it with an exit
+// code, and reads and writes files and the standard streams, like the os
+// package of Go does. The functions without bodies are implemented by the
+// runtime of each backend (interp.os_package for the interpreter and the
+// VM, gopyrt/os.py for the Python modules). There are no environment
+// variables, and files are read and written whole.
+package os
+
+import (
+	"errors"
+	"io"
+)
+
+// Args holds the arguments of the program, starting with the path of the
+// program (the one given to go_parser.py run).
+var Args = args()
+
+// Exit ends the program with the status code, right away: the deferred
+// calls are not run. Status 0 is success, an error is non-zero.
+func Exit(code int)
+
+// args returns the arguments of the program.
+func args() []string
+
+// Portable analogs of some common system call errors, which errors.Is
+// matches with the errors of the functions of the package.
+var (
+	ErrPermission = errors.New("permission denied")
+	ErrExist      = errors.New("file already exists")
+	ErrNotExist   = errors.New("file does not exist")
+)
+
+// A FileMode represents the permission bits of a file, like 0644, and if
+// it is a directory.
+type FileMode uint32
+
+const (
+	ModeDir  FileMode = 1 << 31 // d: is a directory
+	ModePerm FileMode = 0777    // Unix permission bits
+)
+
+// IsDir reports whether m describes a directory.
+func (m FileMode) IsDir() bool {
+	return m&ModeDir != 0
+}
+
+// Perm returns the Unix permission bits in m (m & ModePerm).
+func (m FileMode) Perm() FileMode {
+	return m & ModePerm
+}
+
+func (m FileMode) String() string {
+	const rwx = "rwxrwxrwx"
+	buf := []byte("----------")
+	if m.IsDir() {
+		buf[0] = 'd'
+	}
+	for i := 0; i < 9; i++ {
+		if m>>uint(8-i)&1 != 0 {
+			buf[i+1] = rwx[i]
+		}
+	}
+	return string(buf)
+}
+
+// A FileInfo describes a file and is returned by Stat.
+type FileInfo interface {
+	Name() string   // base name of the file
+	Size() int64    // length in bytes
+	Mode() FileMode // file mode bits
+	IsDir() bool    // abbreviation for Mode().IsDir()
+}
+
+type fileStat struct {
+	name string
+	size int64
+	mode FileMode
+}
+
+func (fs *fileStat) Name() string   { return fs.name }
+func (fs *fileStat) Size() int64    { return fs.size }
+func (fs *fileStat) Mode() FileMode { return fs.mode }
+func (fs *fileStat) IsDir() bool    { return fs.mode.IsDir() }
+
+// File is an open file, one of the standard streams.
+type File struct {
+	fd   int
+	name string
+}
+
+// Stdin, Stdout, and Stderr are open Files pointing to the standard input,
+// standard output, and standard error file descriptors.
+var (
+	Stdin  = &File{0, "/dev/stdin"}
+	Stdout = &File{1, "/dev/stdout"}
+	Stderr = &File{2, "/dev/stderr"}
+)
+
+var _ io.Reader = Stdin
+var _ io.Writer = Stdout
+
+// Name returns the name of the file.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Read reads up to len(b) bytes from the File and stores them in b. It
+// returns the number of bytes read, and io.EOF at the end of the file.
+func (f *File) Read(b []byte) (n int, err error) {
+	n = read(f.fd, b)
+	if n == 0 && len(b) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes len(b) bytes from b to the File.
+func (f *File) Write(b []byte) (n int, err error) {
+	return write(f.fd, b), nil
+}
+
+// WriteString is like Write, but writes the contents of string s.
+func (f *File) WriteString(s string) (n int, err error) {
+	return f.Write([]byte(s))
+}
+
+// read reads up to len(b) bytes of the file descriptor fd into b, 0 at its end.
+func read(fd int, b []byte) int
+
+// write writes b to the file descriptor fd.
+func write(fd int, b []byte) int
+
+// PathError records an error and the operation and file path that caused it.
+type PathError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// errno is the number of the error of a system call, like syscall.Errno.
+type errno int
+
+const (
+	eperm     errno = 1
+	enoent    errno = 2
+	eacces    errno = 13
+	eexist    errno = 17
+	eisdir    errno = 21
+	enotempty errno = 39
+)
+
+func (e errno) Error() string {
+	return strerror(int(e))
+}
+
+// Is matches the errno with the portable errors of the package.
+func (e errno) Is(target error) bool {
+	switch target {
+	case ErrPermission:
+		return e == eacces || e == eperm
+	case ErrExist:
+		return e == eexist || e == enotempty
+	case ErrNotExist:
+		return e == enoent
+	}
+	return false
+}
+
+// strerror is the message of the errno e, like "no such file or directory".
+func strerror(e int) string
+
+// ReadFile reads the named file and returns the contents. A successful
+// call returns err == nil, not err == io.EOF.
+func ReadFile(name string) ([]byte, error) {
+	data, e := readFile(name)
+	if e != 0 {
+		op := "open"
+		if errno(e) == eisdir {
+			op = "read"
+		}
+		return nil, &PathError{op, name, errno(e)}
+	}
+	return data, nil
+}
+
+// WriteFile writes data to the named file, creating it with the
+// permissions perm if necessary. If the file exists, it is truncated.
+func WriteFile(name string, data []byte, perm FileMode) error {
+	if e := writeFile(name, data, uint32(perm)); e != 0 {
+		return &PathError{"open", name, errno(e)}
+	}
+	return nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func Stat(name string) (FileInfo, error) {
+	size, mode, e := stat(name)
+	if e != 0 {
+		return nil, &PathError{"stat", name, errno(e)}
+	}
+	base := name
+	for len(base) > 1 && base[len(base)-1] == '/' {
+		base = base[:len(base)-1]
+	}
+	for i := len(base) - 2; i >= 0; i-- {
+		if base[i] == '/' {
+			base = base[i+1:]
+			break
+		}
+	}
+	return &fileStat{base, int64(size), FileMode(mode)}, nil
+}
+
+// Remove removes the named file or empty directory.
+func Remove(name string) error {
+	if e := remove(name); e != 0 {
+		return &PathError{"remove", name, errno(e)}
+	}
+	return nil
+}
+
+// readFile returns the contents of the named file, or the errno of the error.
+func readFile(name string) ([]byte, int)
+
+// writeFile writes data to the named file and returns the errno of the
+// error, 0 if there is none.
+func writeFile(name string, data []byte, perm uint32) int
+
+// stat returns the size and the mode of the named file (ModeDir is set for
+// a directory), or the errno of the error.
+func stat(name string) (int, uint32, int)
+
+// remove removes the named file or empty directory and returns the errno
+// of the error, 0 if there is none.
+func remove(name string) int
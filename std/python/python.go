@@ -0,0 +1,39 @@
+// Package python holds the values of Python without a Go type, which the
+// functions of the Python modules imported as "python/NAME" return, like
+// the objects of their classes (see pyffi.py). The functions without
+// bodies are implemented by the interpreter and the VM
+// (interp.python_package), the Python backend doesn't have the package.
+package python
+
+// An Object is a value of Python which isn't converted to a Go value: not
+// a bool, a number, a string, a list or a dict. Its methods get its
+// attributes and call it, and fmt prints it like str does. The zero Object
+// is None.
+type Object struct {
+	ref int
+}
+
+// String returns str(o).
+func (o Object) String() string {
+	return str(o)
+}
+
+// Attr returns the attribute name of o, getattr(o, name), converted like
+// the results of the functions of the Python modules.
+func (o Object) Attr(name string) any {
+	return attr(o, name)
+}
+
+// Call calls o with the arguments, o(args...), and returns its result.
+func (o Object) Call(args ...any) any {
+	return call(o, args)
+}
+
+// str returns str(o).
+func str(o Object) string
+
+// attr returns getattr(o, name).
+func attr(o Object, name string) any
+
+// call returns o(args...).
+func call(o Object, args []any) any
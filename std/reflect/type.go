@@ -0,0 +1,252 @@
+// Package reflect is the reflection of the values of a program, the part of
+// the reflect package of Go the encoding packages need: the kinds and the
+// types of the values, the fields of the structs with their tags, and the
+// Values reading and setting them. The functions without bodies are
+// implemented by the interpreter and the VM (interp.reflect_package), the
+// Python backend doesn't have the package.
+package reflect
+
+import "strconv"
+
+// A Kind is the kind of type a Type is.
+type Kind uint
+
+const (
+	Invalid Kind = iota
+	Bool
+	Int
+	Int8
+	Int16
+	Int32
+	Int64
+	Uint
+	Uint8
+	Uint16
+	Uint32
+	Uint64
+	Uintptr
+	Float32
+	Float64
+	Complex64
+	Complex128
+	Array
+	Chan
+	Func
+	Interface
+	Map
+	Pointer
+	Slice
+	String
+	Struct
+	UnsafePointer
+)
+
+// Ptr is the old name of the Pointer kind.
+const Ptr = Pointer
+
+var kindNames = []string{
+	"invalid", "bool", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16",
+	"uint32", "uint64", "uintptr", "float32", "float64", "complex64", "complex128", "array",
+	"chan", "func", "interface", "map", "ptr", "slice", "string", "struct", "unsafe.Pointer",
+}
+
+// String returns the name of k.
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "kind" + strconv.Itoa(int(k))
+}
+
+// Type is the representation of a Go type. Two Types are equal (==) if
+// they are the same type.
+type Type interface {
+	// Name returns the name of a named type (or of a predeclared one),
+	// "" for the other ones.
+	Name() string
+	// PkgPath returns the package of a named type, "" for the other ones.
+	PkgPath() string
+	// String returns the type as Go code, like []main.Point.
+	String() string
+	// Kind returns the kind of the type.
+	Kind() Kind
+	// Elem returns the type of the elements of an Array, a Chan, a Map,
+	// a Pointer or a Slice type. It panics for the other ones.
+	Elem() Type
+	// Key returns the type of the keys of a Map type.
+	Key() Type
+	// Len returns the length of an Array type.
+	Len() int
+	// NumField returns the number of fields of a Struct type.
+	NumField() int
+	// Field returns the i'th field of a Struct type.
+	Field(i int) StructField
+	// FieldByName returns the field of a Struct type with the name, and
+	// if there is one. The fields of the embedded fields aren't searched.
+	FieldByName(name string) (StructField, bool)
+	// Bits returns the size of an Int, Uint, Float or Complex type in bits.
+	Bits() int
+	// AssignableTo returns whether the values of the type can be assigned
+	// to the variables of type u.
+	AssignableTo(u Type) bool
+	// Implements returns whether the type implements the interface type u.
+	Implements(u Type) bool
+}
+
+// rtype is a type of the program, id is its index in the types of the
+// interpreter (0 is none).
+type rtype struct {
+	id int
+}
+
+func (t rtype) Name() string    { return typeName(t.id) }
+func (t rtype) PkgPath() string { return typePkgPath(t.id) }
+func (t rtype) String() string  { return typeString(t.id) }
+func (t rtype) Kind() Kind      { return Kind(typeKind(t.id)) }
+
+func (t rtype) Elem() Type {
+	switch t.Kind() {
+	case Array, Chan, Map, Pointer, Slice:
+		return rtype{typeElem(t.id)}
+	}
+	panic("reflect: Elem of invalid type " + t.String())
+}
+
+func (t rtype) Key() Type {
+	if t.Kind() != Map {
+		panic("reflect: Key of non-map type " + t.String())
+	}
+	return rtype{typeKey(t.id)}
+}
+
+func (t rtype) Len() int {
+	if t.Kind() != Array {
+		panic("reflect: Len of non-array type " + t.String())
+	}
+	return typeLen(t.id)
+}
+
+func (t rtype) NumField() int {
+	if t.Kind() != Struct {
+		panic("reflect: NumField of non-struct type " + t.String())
+	}
+	return typeNumField(t.id)
+}
+
+func (t rtype) Field(i int) StructField {
+	if t.Kind() != Struct {
+		panic("reflect: Field of non-struct type " + t.String())
+	}
+	if i < 0 || i >= typeNumField(t.id) {
+		panic("reflect: Field index out of bounds")
+	}
+	name, pkgPath, typ, tag, embedded := typeField(t.id, i)
+	return StructField{Name: name, PkgPath: pkgPath, Type: rtype{typ}, Tag: StructTag(tag),
+		Index: []int{i}, Anonymous: embedded}
+}
+
+func (t rtype) FieldByName(name string) (StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Name == name {
+			return f, true
+		}
+	}
+	return StructField{}, false
+}
+
+func (t rtype) Bits() int {
+	switch k := t.Kind(); k {
+	case Int8, Uint8:
+		return 8
+	case Int16, Uint16:
+		return 16
+	case Int32, Uint32, Float32:
+		return 32
+	case Int, Int64, Uint, Uint64, Uintptr, Float64, Complex64:
+		return 64
+	case Complex128:
+		return 128
+	}
+	panic("reflect: Bits of non-arithmetic Type " + t.String())
+}
+
+func (t rtype) AssignableTo(u Type) bool {
+	if u == nil {
+		panic("reflect: nil type passed to Type.AssignableTo")
+	}
+	return assignable(t.id, u.(rtype).id)
+}
+
+func (t rtype) Implements(u Type) bool {
+	if u == nil {
+		panic("reflect: nil type passed to Type.Implements")
+	}
+	if u.Kind() != Interface {
+		panic("reflect: non-interface type passed to Type.Implements")
+	}
+	return implements(t.id, u.(rtype).id)
+}
+
+// TypeOf returns the dynamic type of i, nil if i is nil.
+func TypeOf(i any) Type {
+	id := typeOf(i)
+	if id == 0 {
+		return nil
+	}
+	return rtype{id}
+}
+
+// PointerTo returns the type of the pointers to the values of type t.
+func PointerTo(t Type) Type {
+	return rtype{pointerTo(t.(rtype).id)}
+}
+
+// A StructField is a field of a struct type.
+type StructField struct {
+	Name      string
+	PkgPath   string // the package of the fields which aren't exported, "" for the others
+	Type      Type
+	Tag       StructTag
+	Index     []int
+	Anonymous bool // an embedded field
+}
+
+// IsExported returns whether the name of the field is exported.
+func (f StructField) IsExported() bool {
+	return f.PkgPath == ""
+}
+
+// A StructTag is the tag of a struct field, key:"value" pairs separated by
+// spaces, like `json:"name,omitempty" xml:"name"`.
+type StructTag string
+
+// Get returns the value of the key in the tag, "" if there is none.
+func (tag StructTag) Get(key string) string {
+	v, _ := tag.Lookup(key)
+	return v
+}
+
+// Lookup returns the value of the key in the tag, and whether it is in it.
+func (tag StructTag) Lookup(key string) (value string, ok bool) {
+	return lookupTag(string(tag), key)
+}
+
+// the types of the program are the ones of the interpreter, by index
+
+// typeOf returns the index of the dynamic type of i, 0 if i is nil.
+func typeOf(i any) int
+
+func typeKind(t int) int
+func typeName(t int) string
+func typePkgPath(t int) string
+func typeString(t int) string
+func typeElem(t int) int
+func typeKey(t int) int
+func typeLen(t int) int
+func typeNumField(t int) int
+func typeField(t, i int) (name, pkgPath string, typ int, tag string, embedded bool)
+func pointerTo(t int) int
+func implements(t, u int) bool
+
+// lookupTag returns the value of the key in the tag (see syntree.lookup_tag).
+func lookupTag(tag, key string) (string, bool)
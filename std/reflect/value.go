@@ -0,0 +1,483 @@
+package reflect
+
+import "math"
+
+// A Value is a value of the program with its type, the zero Value is none
+// (its Kind is Invalid). The Values of the elements of a pointer, of a
+// slice or of an addressable array or struct are addressable: they are the
+// variables holding them, which the Set methods set, unless they are
+// fields which aren't exported.
+type Value struct {
+	typ  int // the index of the type, see rtype
+	ref  int // the variable of the value, an interp.Ref and not an int
+	flag int
+}
+
+const (
+	flagAddr     = 1 << iota // the value is addressable
+	flagStickyRO             // the value is in a field which isn't exported
+	flagEmbedRO              // the value is an embedded field which isn't exported
+	// the fields of an embedded field which isn't exported are exported
+	// if their names are, like the ones promoted from it
+	flagRO = flagStickyRO | flagEmbedRO
+)
+
+// A ValueError is the panic of a method of Value called on a value of a
+// kind it doesn't take.
+type ValueError struct {
+	Method string
+	Kind   Kind
+}
+
+func (e *ValueError) Error() string {
+	if e.Kind == Invalid {
+		return "reflect: call of " + e.Method + " on zero Value"
+	}
+	return "reflect: call of " + e.Method + " on " + e.Kind.String() + " Value"
+}
+
+// ValueOf returns the Value of the dynamic value of i, the zero Value if i
+// is nil.
+func ValueOf(i any) Value {
+	id := typeOf(i)
+	if id == 0 {
+		return Value{}
+	}
+	return Value{typ: id, ref: valueOf(i)}
+}
+
+// Zero returns the zero value of the type t, not addressable.
+func Zero(t Type) Value {
+	id := t.(rtype).id
+	return Value{typ: id, ref: zero(id)}
+}
+
+// New returns a pointer to a new zero value of the type t.
+func New(t Type) Value {
+	id := t.(rtype).id
+	return Value{typ: pointerTo(id), ref: newValue(id)}
+}
+
+// Indirect returns the value v points to if it is a pointer, else v.
+func Indirect(v Value) Value {
+	if v.Kind() != Pointer {
+		return v
+	}
+	return v.Elem()
+}
+
+// MakeSlice returns a new slice of the slice type t.
+func MakeSlice(t Type, len, cap int) Value {
+	if t.Kind() != Slice {
+		panic("reflect.MakeSlice of non-slice type")
+	}
+	if len < 0 || cap < len {
+		panic("reflect.MakeSlice: len out of range")
+	}
+	id := t.(rtype).id
+	return Value{typ: id, ref: makeSlice(id, len, cap)}
+}
+
+// MakeMap returns a new map of the map type t.
+func MakeMap(t Type) Value {
+	if t.Kind() != Map {
+		panic("reflect.MakeMap of non-map type")
+	}
+	id := t.(rtype).id
+	return Value{typ: id, ref: makeMap(id)}
+}
+
+// Append appends the values to the slice s, like append(s, x...).
+func Append(s Value, x ...Value) Value {
+	s.mustBe("reflect.Append", Slice)
+	ref := s.ref
+	for _, v := range x {
+		v.assignableTo("reflect.Append", rtype{typeElem(s.typ)})
+		ref = appendValue(s.typ, ref, v.typ, v.ref)
+	}
+	return Value{typ: s.typ, ref: ref}
+}
+
+func (v Value) mustBe(method string, kinds ...Kind) {
+	k := v.Kind()
+	for _, kind := range kinds {
+		if k == kind {
+			return
+		}
+	}
+	panic(&ValueError{method, k})
+}
+
+func (v Value) mustBeSettable(method string, kinds ...Kind) {
+	v.mustBe(method, kinds...)
+	if v.flag&flagRO != 0 {
+		panic("reflect: " + method + " using value obtained using unexported field")
+	}
+	if v.flag&flagAddr == 0 {
+		panic("reflect: " + method + " using unaddressable value")
+	}
+}
+
+func (v Value) assignableTo(method string, t Type) {
+	if v.typ == 0 || !assignable(v.typ, t.(rtype).id) {
+		panic(method + ": value of type " + v.typeString() + " is not assignable to type " +
+			t.String())
+	}
+}
+
+func (v Value) typeString() string {
+	if v.typ == 0 {
+		return "<invalid Value>"
+	}
+	return typeString(v.typ)
+}
+
+// IsValid returns whether v isn't the zero Value.
+func (v Value) IsValid() bool {
+	return v.typ != 0
+}
+
+// Kind returns the kind of the type of v, Invalid for the zero Value.
+func (v Value) Kind() Kind {
+	if v.typ == 0 {
+		return Invalid
+	}
+	return Kind(typeKind(v.typ))
+}
+
+// Type returns the type of v.
+func (v Value) Type() Type {
+	if v.typ == 0 {
+		panic(&ValueError{"reflect.Value.Type", Invalid})
+	}
+	return rtype{v.typ}
+}
+
+// CanAddr returns whether v is addressable.
+func (v Value) CanAddr() bool {
+	return v.flag&flagAddr != 0
+}
+
+// Addr returns a pointer to v, which has to be addressable.
+func (v Value) Addr() Value {
+	if v.flag&flagAddr == 0 {
+		panic("reflect.Value.Addr of unaddressable value")
+	}
+	return Value{typ: pointerTo(v.typ), ref: addr(v.ref), flag: v.ro()}
+}
+
+// CanSet returns whether v is addressable and isn't a field which isn't
+// exported.
+func (v Value) CanSet() bool {
+	return v.flag&(flagAddr|flagRO) == flagAddr
+}
+
+// CanInterface returns whether Interface can be called on v.
+func (v Value) CanInterface() bool {
+	if v.typ == 0 {
+		panic(&ValueError{"reflect.Value.CanInterface", Invalid})
+	}
+	return v.flag&flagRO == 0
+}
+
+// Interface returns the value of v as an any.
+func (v Value) Interface() any {
+	if v.typ == 0 {
+		panic(&ValueError{"reflect.Value.Interface", Invalid})
+	}
+	if v.flag&flagRO != 0 {
+		panic("reflect.Value.Interface: cannot return value obtained from unexported field or method")
+	}
+	return valueInterface(v.typ, v.ref)
+}
+
+// Bool returns the value of a Bool.
+func (v Value) Bool() bool {
+	v.mustBe("reflect.Value.Bool", Bool)
+	return loadBool(v.ref)
+}
+
+// Int returns the value of an Int, Int8, Int16, Int32 or Int64.
+func (v Value) Int() int64 {
+	v.mustBe("reflect.Value.Int", Int, Int8, Int16, Int32, Int64)
+	return loadInt(v.ref)
+}
+
+// Uint returns the value of a Uint, Uint8, Uint16, Uint32, Uint64 or Uintptr.
+func (v Value) Uint() uint64 {
+	v.mustBe("reflect.Value.Uint", Uint, Uint8, Uint16, Uint32, Uint64, Uintptr)
+	return loadUint(v.ref)
+}
+
+// Float returns the value of a Float32 or Float64.
+func (v Value) Float() float64 {
+	v.mustBe("reflect.Value.Float", Float32, Float64)
+	return loadFloat(v.ref)
+}
+
+// OverflowInt returns whether x doesn't fit in an Int, Int8, Int16, Int32
+// or Int64.
+func (v Value) OverflowInt(x int64) bool {
+	v.mustBe("reflect.Value.OverflowInt", Int, Int8, Int16, Int32, Int64)
+	bits := uint(v.Type().Bits())
+	trunc := (x << (64 - bits)) >> (64 - bits)
+	return x != trunc
+}
+
+// OverflowUint returns whether x doesn't fit in a Uint, Uint8, Uint16,
+// Uint32, Uint64 or Uintptr.
+func (v Value) OverflowUint(x uint64) bool {
+	v.mustBe("reflect.Value.OverflowUint", Uint, Uint8, Uint16, Uint32, Uint64, Uintptr)
+	bits := uint(v.Type().Bits())
+	trunc := (x << (64 - bits)) >> (64 - bits)
+	return x != trunc
+}
+
+// OverflowFloat returns whether x doesn't fit in a Float32 or Float64.
+func (v Value) OverflowFloat(x float64) bool {
+	v.mustBe("reflect.Value.OverflowFloat", Float32, Float64)
+	if v.Kind() == Float64 {
+		return false
+	}
+	if x < 0 {
+		x = -x
+	}
+	return math.MaxFloat32 < x && x <= math.MaxFloat64
+}
+
+// String returns the value of a String, and "<T Value>" for the other
+// kinds (fmt prints the values of the Values).
+func (v Value) String() string {
+	if v.typ == 0 {
+		return "<invalid Value>"
+	}
+	if v.Kind() != String {
+		return "<" + v.typeString() + " Value>"
+	}
+	return loadString(v.ref)
+}
+
+// Len returns the length of an Array, a Map, a Slice or a String.
+func (v Value) Len() int {
+	v.mustBe("reflect.Value.Len", Array, Map, Slice, String)
+	return valueLen(v.ref)
+}
+
+// Cap returns the capacity of an Array or a Slice.
+func (v Value) Cap() int {
+	v.mustBe("reflect.Value.Cap", Array, Slice)
+	return valueCap(v.ref)
+}
+
+// IsNil returns whether a Chan, a Func, an Interface, a Map, a Pointer or
+// a Slice is nil.
+func (v Value) IsNil() bool {
+	v.mustBe("reflect.Value.IsNil", Chan, Func, Interface, Map, Pointer, Slice)
+	return isNil(v.ref)
+}
+
+// IsZero returns whether v is the zero value of its type.
+func (v Value) IsZero() bool {
+	if v.typ == 0 {
+		panic(&ValueError{"reflect.Value.IsZero", Invalid})
+	}
+	return isZero(v.typ, v.ref)
+}
+
+// Elem returns the value a Pointer points to, or the one in an Interface,
+// the zero Value if it is nil.
+func (v Value) Elem() Value {
+	v.mustBe("reflect.Value.Elem", Interface, Pointer)
+	typ, ref := valueElem(v.typ, v.ref)
+	if typ == 0 {
+		return Value{}
+	}
+	if v.Kind() == Pointer {
+		// the variable pointed to
+		return Value{typ: typ, ref: ref, flag: flagAddr}
+	}
+	return Value{typ: typ, ref: ref, flag: v.ro()}
+}
+
+// ro is flagStickyRO if v is in a field which isn't exported, which the
+// values in it are in too.
+func (v Value) ro() int {
+	if v.flag&flagRO != 0 {
+		return flagStickyRO
+	}
+	return 0
+}
+
+// Index returns the i'th element of an Array, a Slice or a String.
+func (v Value) Index(i int) Value {
+	v.mustBe("reflect.Value.Index", Array, Slice, String)
+	if i < 0 || i >= valueLen(v.ref) {
+		panic("reflect: " + v.Kind().String() + " index out of range")
+	}
+	flag := v.flag&flagAddr | v.ro()
+	switch v.Kind() {
+	case Slice:
+		// the elements of a slice are in its array
+		flag |= flagAddr
+	case String:
+		flag &^= flagAddr
+	}
+	typ := typeElem(v.typ)
+	if v.Kind() == String {
+		typ = typeOf(byte(0))
+	}
+	return Value{typ: typ, ref: valueIndex(v.ref, i), flag: flag}
+}
+
+// NumField returns the number of fields of a Struct.
+func (v Value) NumField() int {
+	v.mustBe("reflect.Value.NumField", Struct)
+	return typeNumField(v.typ)
+}
+
+// Field returns the i'th field of a Struct.
+func (v Value) Field(i int) Value {
+	v.mustBe("reflect.Value.Field", Struct)
+	f := v.Type().Field(i)
+	flag := v.flag & (flagAddr | flagStickyRO)
+	if !f.IsExported() {
+		if f.Anonymous {
+			flag |= flagEmbedRO
+		} else {
+			flag |= flagStickyRO
+		}
+	}
+	return Value{typ: f.Type.(rtype).id, ref: valueField(v.ref, f.Name), flag: flag}
+}
+
+// FieldByName returns the field of a Struct with the name, the zero Value
+// if there is none.
+func (v Value) FieldByName(name string) Value {
+	v.mustBe("reflect.Value.FieldByName", Struct)
+	if f, ok := v.Type().FieldByName(name); ok {
+		return v.Field(f.Index[0])
+	}
+	return Value{}
+}
+
+// MapKeys returns the keys of a Map, in no order.
+func (v Value) MapKeys() []Value {
+	v.mustBe("reflect.Value.MapKeys", Map)
+	key := typeKey(v.typ)
+	var keys []Value
+	for _, ref := range mapKeys(v.ref) {
+		keys = append(keys, Value{typ: key, ref: ref})
+	}
+	return keys
+}
+
+// MapIndex returns the value of the key in a Map, the zero Value if it
+// isn't in it.
+func (v Value) MapIndex(key Value) Value {
+	v.mustBe("reflect.Value.MapIndex", Map)
+	key.assignableTo("reflect.Value.MapIndex", rtype{typeKey(v.typ)})
+	ref, ok := mapIndex(v.typ, v.ref, key.typ, key.ref)
+	if !ok {
+		return Value{}
+	}
+	return Value{typ: typeElem(v.typ), ref: ref}
+}
+
+// SetMapIndex sets the value of the key in a Map, or deletes the key if
+// elem is the zero Value.
+func (v Value) SetMapIndex(key, elem Value) {
+	v.mustBe("reflect.Value.SetMapIndex", Map)
+	key.assignableTo("reflect.Value.SetMapIndex", rtype{typeKey(v.typ)})
+	if elem.typ != 0 {
+		elem.assignableTo("reflect.Value.SetMapIndex", rtype{typeElem(v.typ)})
+		if isNil(v.ref) {
+			panic("assignment to entry in nil map")
+		}
+	}
+	setMapIndex(v.typ, v.ref, key.typ, key.ref, elem.typ, elem.ref)
+}
+
+// Set assigns x to v, which has to be settable.
+func (v Value) Set(x Value) {
+	v.mustBeSettable("reflect.Set", v.Kind())
+	x.assignableTo("reflect.Set", v.Type())
+	store(v.typ, v.ref, x.typ, x.ref)
+}
+
+// SetZero sets v to the zero value of its type.
+func (v Value) SetZero() {
+	v.mustBeSettable("reflect.Value.SetZero", v.Kind())
+	store(v.typ, v.ref, v.typ, zero(v.typ))
+}
+
+// SetBool sets a Bool.
+func (v Value) SetBool(x bool) {
+	v.mustBeSettable("reflect.Value.SetBool", Bool)
+	storeBool(v.ref, x)
+}
+
+// SetInt sets an Int, Int8, Int16, Int32 or Int64, wrapped to its size.
+func (v Value) SetInt(x int64) {
+	v.mustBeSettable("reflect.Value.SetInt", Int, Int8, Int16, Int32, Int64)
+	storeNumber(v.typ, v.ref, x)
+}
+
+// SetUint sets a Uint, Uint8, Uint16, Uint32, Uint64 or Uintptr.
+func (v Value) SetUint(x uint64) {
+	v.mustBeSettable("reflect.Value.SetUint", Uint, Uint8, Uint16, Uint32, Uint64, Uintptr)
+	storeNumber(v.typ, v.ref, x)
+}
+
+// SetFloat sets a Float32 or Float64.
+func (v Value) SetFloat(x float64) {
+	v.mustBeSettable("reflect.Value.SetFloat", Float32, Float64)
+	storeNumber(v.typ, v.ref, x)
+}
+
+// SetString sets a String.
+func (v Value) SetString(x string) {
+	v.mustBeSettable("reflect.Value.SetString", String)
+	storeString(v.ref, x)
+}
+
+// SetLen sets the length of a Slice, up to its capacity.
+func (v Value) SetLen(n int) {
+	v.mustBeSettable("reflect.Value.SetLen", Slice)
+	if n < 0 || n > valueCap(v.ref) {
+		panic("reflect: slice length out of range in SetLen")
+	}
+	setLen(v.ref, n)
+}
+
+// the values are the variables of the interpreter holding them (its
+// Refs), the ones which aren't addressable are copies
+
+func valueOf(i any) int
+func addr(ref int) int
+func valueInterface(t, ref int) any
+func zero(t int) int
+func newValue(t int) int
+func makeSlice(t, len, cap int) int
+func makeMap(t int) int
+func appendValue(t, ref, xt, xref int) int
+func assignable(xt, t int) bool
+func loadBool(ref int) bool
+func loadInt(ref int) int64
+func loadUint(ref int) uint64
+func loadFloat(ref int) float64
+func loadString(ref int) string
+func valueLen(ref int) int
+func valueCap(ref int) int
+func isNil(ref int) bool
+func isZero(t, ref int) bool
+func valueElem(t, ref int) (int, int)
+func valueIndex(ref, i int) int
+func valueField(ref int, name string) int
+func mapKeys(ref int) []int
+func mapIndex(t, ref, kt, kref int) (int, bool)
+func setMapIndex(t, ref, kt, kref, et, eref int)
+func store(t, ref, xt, xref int)
+func storeBool(ref int, x bool)
+func storeNumber(t, ref int, x any)
+func storeString(ref int, x string)
+func setLen(ref, n int)
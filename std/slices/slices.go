@@ -0,0 +1,79 @@
+// Package slices has generic functions for slices of any type, a subset of
+// the slices package of Go. The functions without bodies are implemented
+// by the runtime of each backend (interp.slices_package for the
+// interpreter and the VM, gopyrt/slices.py for the Python modules), the
+// others are run like the functions of the program.
+package slices
+
+import "cmp"
+
+// Sort sorts a slice of any ordered type in ascending order. When sorting
+// floating-point numbers, NaNs are ordered before other values.
+func Sort[S ~[]E, E cmp.Ordered](x S)
+
+// SortFunc sorts the slice x in ascending order as determined by the cmp
+// function, which returns a negative number when a < b, a positive number
+// when a > b and zero when a == b. The sort is stable: the equal elements
+// keep their order (it isn't guaranteed by Go).
+func SortFunc[S ~[]E, E any](x S, cmp func(a, b E) int)
+
+// IsSorted reports whether x is sorted in ascending order.
+func IsSorted[S ~[]E, E cmp.Ordered](x S) bool {
+	for i := len(x) - 1; i > 0; i-- {
+		if cmp.Less(x[i], x[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Index returns the index of the first occurrence of v in s, or -1 if not
+// present.
+func Index[S ~[]E, E comparable](s S, v E) int {
+	for i := range s {
+		if v == s[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// Contains reports whether v is present in s.
+func Contains[S ~[]E, E comparable](s S, v E) bool {
+	return Index(s, v) >= 0
+}
+
+// Reverse reverses the elements of the slice in place.
+func Reverse[S ~[]E, E any](s S) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// Max returns the maximal value in x. It panics if x is empty. For
+// floating-point E, Max propagates NaNs (any NaN value in x forces the
+// output to be NaN).
+func Max[S ~[]E, E cmp.Ordered](x S) E {
+	if len(x) < 1 {
+		panic("slices.Max: empty list")
+	}
+	m := x[0]
+	for i := 1; i < len(x); i++ {
+		m = max(m, x[i])
+	}
+	return m
+}
+
+// Min returns the minimal value in x. It panics if x is empty. For
+// floating-point numbers, Min propagates NaNs (any NaN value in x forces
+// the output to be NaN).
+func Min[S ~[]E, E cmp.Ordered](x S) E {
+	if len(x) < 1 {
+		panic("slices.Min: empty list")
+	}
+	m := x[0]
+	for i := 1; i < len(x); i++ {
+		m = min(m, x[i])
+	}
+	return m
+}
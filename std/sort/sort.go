@@ -0,0 +1,65 @@
+// Package sort sorts slices of ints, float64s and strings, and any slice
+// with a less function, a subset of the sort package of Go. The functions
+// without bodies are implemented by the runtime of each backend
+// (interp.sort_package for the interpreter and the VM, gopyrt/sort.py for
+// the Python modules): they sort with the sort of python, which is stable,
+// so Slice keeps the equal elements in order (it isn't guaranteed by Go).
+package sort
+
+// Ints sorts a slice of ints in increasing order.
+func Ints(x []int)
+
+// Float64s sorts a slice of float64s in increasing order. Not-a-number
+// (NaN) values are ordered before other values.
+func Float64s(x []float64)
+
+// Strings sorts a slice of strings in increasing order.
+func Strings(x []string)
+
+// Slice sorts the slice x given the provided less function. It panics if
+// x is not a slice. The less function reports whether the element with
+// index i must sort before the element with index j.
+func Slice(x any, less func(i, j int) bool)
+
+// SliceStable sorts the slice x using the provided less function, keeping
+// equal elements in their original order. It panics if x is not a slice.
+func SliceStable(x any, less func(i, j int) bool) {
+	Slice(x, less)
+}
+
+// IntsAreSorted reports whether the slice x is sorted in increasing order.
+func IntsAreSorted(x []int) bool {
+	for i := len(x) - 1; i > 0; i-- {
+		if x[i] < x[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// StringsAreSorted reports whether the slice x is sorted in increasing order.
+func StringsAreSorted(x []string) bool {
+	for i := len(x) - 1; i > 0; i-- {
+		if x[i] < x[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchInts searches for x in a sorted slice of ints and returns the
+// index as specified by Search: the index to insert x if x is not
+// present (it could be len(a)). The slice must be sorted in ascending
+// order.
+func SearchInts(a []int, x int) int {
+	i, j := 0, len(a)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if a[h] < x {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return i
+}
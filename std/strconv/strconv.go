@@ -0,0 +1,115 @@
+// Package strconv converts numbers and booleans to strings and back, a
+// subset of the strconv package of Go. The functions without bodies are
+// implemented by the runtime of each backend (interp.strconv_package for
+// the interpreter and the VM, gopyrt/strconv.py for the Python modules).
+// Floats are formatted with the fewest digits giving them back, like Go.
+package strconv
+
+import "errors"
+
+// ErrRange indicates that a value is out of range for the target type.
+var ErrRange = errors.New("value out of range")
+
+// ErrSyntax indicates that a value does not have the right syntax for the
+// target type.
+var ErrSyntax = errors.New("invalid syntax")
+
+// A NumError records a failed conversion.
+type NumError struct {
+	Func string // the failing function (ParseBool, ParseInt, ParseFloat, Atoi)
+	Num  string // the input
+	Err  error  // the reason the conversion failed (ErrRange, ErrSyntax)
+}
+
+func (e *NumError) Error() string {
+	return "strconv." + e.Func + ": parsing " + Quote(e.Num) + ": " + e.Err.Error()
+}
+
+func (e *NumError) Unwrap() error {
+	return e.Err
+}
+
+// numError is the error of a parse function failing, ok is 0 when it
+// doesn't, 1 for ErrSyntax and 2 for ErrRange.
+func numError(fn, s string, ok int) error {
+	if ok == 0 {
+		return nil
+	}
+	if ok == 1 {
+		return &NumError{fn, s, ErrSyntax}
+	}
+	return &NumError{fn, s, ErrRange}
+}
+
+// Itoa is equivalent to FormatInt(int64(i), 10).
+func Itoa(i int) string {
+	return FormatInt(int64(i), 10)
+}
+
+// Atoi is equivalent to ParseInt(s, 10, 0), converted to type int.
+func Atoi(s string) (int, error) {
+	i, ok := parseInt(s, 10, 0)
+	return int(i), numError("Atoi", s, ok)
+}
+
+// ParseInt interprets a string s in the given base (0, 2 to 36) and bit
+// size (0 to 64) and returns the corresponding value i. If the base is 0,
+// it is implied by the prefix of the string: 0b, 0o (or 0) and 0x, and
+// underscores may separate the digits. A value out of range is the
+// maximum magnitude integer of the size, with ErrRange.
+func ParseInt(s string, base int, bitSize int) (i int64, err error) {
+	i, ok := parseInt(s, base, bitSize)
+	return i, numError("ParseInt", s, ok)
+}
+
+// ParseFloat converts the string s to a floating-point number with the
+// precision of bitSize: 32 for float32, or 64 for float64. It accepts
+// decimal numbers, and "Inf" and "NaN" in any case, with a sign. A value
+// out of range is ±Inf, with ErrRange.
+func ParseFloat(s string, bitSize int) (float64, error) {
+	f, ok := parseFloat(s, bitSize)
+	return f, numError("ParseFloat", s, ok)
+}
+
+// ParseBool returns the boolean value represented by the string. It
+// accepts 1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False.
+func ParseBool(str string) (bool, error) {
+	switch str {
+	case "1", "t", "T", "TRUE", "true", "True":
+		return true, nil
+	case "0", "f", "F", "FALSE", "false", "False":
+		return false, nil
+	}
+	return false, numError("ParseBool", str, 1)
+}
+
+// FormatInt returns the string representation of i in the given base, for
+// 2 <= base <= 36, with the lower-case letters 'a' to 'z' for the digits
+// >= 10.
+func FormatInt(i int64, base int) string
+
+// FormatFloat converts the floating-point number f to a string, according
+// to the format fmt ('e', 'E', 'f', 'g' or 'G') and the precision prec,
+// the number of digits (after the decimal point for 'e', 'E' and 'f', the
+// significant ones for 'g' and 'G'). A precision of -1 uses the smallest
+// number of digits necessary to represent the value of bitSize bits.
+func FormatFloat(f float64, fmt byte, prec, bitSize int) string
+
+// FormatBool returns "true" or "false" according to the value of b.
+func FormatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// Quote returns a double-quoted Go string literal representing s, with
+// the control characters and the non-printable runes escaped.
+func Quote(s string) string
+
+// parseInt is the value of s in the base, and 0, 1 for a syntax error or
+// 2 for a value out of the range of bitSize bits.
+func parseInt(s string, base int, bitSize int) (int64, int)
+
+// parseFloat is the value of s of bitSize bits, and its error like parseInt.
+func parseFloat(s string, bitSize int) (float64, int)
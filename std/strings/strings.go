@@ -0,0 +1,93 @@
+// Package strings has functions for the strings of UTF-8 encoded text, a
+// subset of the strings package of Go. The functions without bodies are
+// implemented by the runtime of each backend (interp.strings_package for
+// the interpreter and the VM, gopyrt/strings.py for the Python modules).
+// The indexes are byte offsets, like the ones of s[i].
+package strings
+
+// Contains reports whether substr is within s.
+func Contains(s, substr string) bool {
+	return Index(s, substr) >= 0
+}
+
+// ContainsRune reports whether the rune r is within s.
+func ContainsRune(s string, r rune) bool {
+	return Index(s, string(r)) >= 0
+}
+
+// Index returns the index of the first instance of substr in s, or -1 if
+// substr is not present in s.
+func Index(s, substr string) int
+
+// LastIndex returns the index of the last instance of substr in s, or -1
+// if substr is not present in s.
+func LastIndex(s, substr string) int
+
+// Count counts the number of non-overlapping instances of substr in s. If
+// substr is empty, it returns 1 + the number of runes in s.
+func Count(s, substr string) int
+
+// HasPrefix reports whether s begins with prefix.
+func HasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
+}
+
+// HasSuffix reports whether s ends with suffix.
+func HasSuffix(s, suffix string) bool {
+	return len(s) >= len(suffix) && s[len(s)-len(suffix):] == suffix
+}
+
+// Split slices s into all substrings separated by sep and returns a slice
+// of the substrings between those separators. If sep is empty, Split
+// splits after each UTF-8 sequence.
+func Split(s, sep string) []string
+
+// Fields splits s around each instance of one or more consecutive white
+// space characters, it returns an empty slice if s contains only white
+// space.
+func Fields(s string) []string
+
+// Join concatenates the elements of elems, with sep placed between them.
+func Join(elems []string, sep string) string
+
+// Repeat returns a new string consisting of count copies of s. It panics
+// if count is negative.
+func Repeat(s string, count int) string
+
+// Replace returns a copy of s with the first n non-overlapping instances
+// of old replaced by new, all of them if n < 0.
+func Replace(s, old, new string, n int) string
+
+// ReplaceAll returns a copy of s with all non-overlapping instances of old
+// replaced by new.
+func ReplaceAll(s, old, new string) string {
+	return Replace(s, old, new, -1)
+}
+
+// ToUpper returns s with all Unicode letters mapped to their upper case.
+func ToUpper(s string) string
+
+// ToLower returns s with all Unicode letters mapped to their lower case.
+func ToLower(s string) string
+
+// TrimSpace returns a slice of s, with all leading and trailing white
+// space removed, as defined by Unicode.
+func TrimSpace(s string) string
+
+// TrimPrefix returns s without the provided leading prefix string. If s
+// doesn't start with prefix, s is returned unchanged.
+func TrimPrefix(s, prefix string) string {
+	if HasPrefix(s, prefix) {
+		return s[len(prefix):]
+	}
+	return s
+}
+
+// TrimSuffix returns s without the provided trailing suffix string. If s
+// doesn't end with suffix, s is returned unchanged.
+func TrimSuffix(s, suffix string) string {
+	if HasSuffix(s, suffix) {
+		return s[:len(s)-len(suffix)]
+	}
+	return s
+}
@@ -0,0 +1,161 @@
+// Package atomic provides the atomic memory primitives of the sync/atomic
+// package of Go. The goroutines of the interpreter and the VM switch only
+// at calls, at jumps back and when they block (see sched.py), so the
+// functions are the plain operations on the variables. sameType and
+// raceSync are implemented by interp.atomic_package.
+package atomic
+
+// sameType reports whether x and y have the same dynamic type.
+func sameType(x, y any) bool
+
+// raceSync tells the race detector of go_parser.py run -race (see race.py)
+// the operations on the variable addr points to happen in order.
+func raceSync(addr any)
+
+// AddInt32 atomically adds delta to *addr and returns the new value.
+func AddInt32(addr *int32, delta int32) (new int32) {
+	raceSync(addr)
+	*addr += delta
+	return *addr
+}
+
+// LoadInt32 atomically loads *addr.
+func LoadInt32(addr *int32) (val int32) {
+	raceSync(addr)
+	return *addr
+}
+
+// StoreInt32 atomically stores val into *addr.
+func StoreInt32(addr *int32, val int32) {
+	raceSync(addr)
+	*addr = val
+}
+
+// SwapInt32 atomically stores new into *addr and returns the previous *addr value.
+func SwapInt32(addr *int32, new int32) (old int32) {
+	raceSync(addr)
+	old = *addr
+	*addr = new
+	return old
+}
+
+// CompareAndSwapInt32 executes the compare-and-swap operation for a int32 value.
+func CompareAndSwapInt32(addr *int32, old, new int32) (swapped bool) {
+	raceSync(addr)
+	if *addr != old {
+		return false
+	}
+	*addr = new
+	return true
+}
+
+// AddInt64 atomically adds delta to *addr and returns the new value.
+func AddInt64(addr *int64, delta int64) (new int64) {
+	raceSync(addr)
+	*addr += delta
+	return *addr
+}
+
+// LoadInt64 atomically loads *addr.
+func LoadInt64(addr *int64) (val int64) {
+	raceSync(addr)
+	return *addr
+}
+
+// StoreInt64 atomically stores val into *addr.
+func StoreInt64(addr *int64, val int64) {
+	raceSync(addr)
+	*addr = val
+}
+
+// SwapInt64 atomically stores new into *addr and returns the previous *addr value.
+func SwapInt64(addr *int64, new int64) (old int64) {
+	raceSync(addr)
+	old = *addr
+	*addr = new
+	return old
+}
+
+// CompareAndSwapInt64 executes the compare-and-swap operation for a int64 value.
+func CompareAndSwapInt64(addr *int64, old, new int64) (swapped bool) {
+	raceSync(addr)
+	if *addr != old {
+		return false
+	}
+	*addr = new
+	return true
+}
+
+// AddUint32 atomically adds delta to *addr and returns the new value.
+func AddUint32(addr *uint32, delta uint32) (new uint32) {
+	raceSync(addr)
+	*addr += delta
+	return *addr
+}
+
+// LoadUint32 atomically loads *addr.
+func LoadUint32(addr *uint32) (val uint32) {
+	raceSync(addr)
+	return *addr
+}
+
+// StoreUint32 atomically stores val into *addr.
+func StoreUint32(addr *uint32, val uint32) {
+	raceSync(addr)
+	*addr = val
+}
+
+// SwapUint32 atomically stores new into *addr and returns the previous *addr value.
+func SwapUint32(addr *uint32, new uint32) (old uint32) {
+	raceSync(addr)
+	old = *addr
+	*addr = new
+	return old
+}
+
+// CompareAndSwapUint32 executes the compare-and-swap operation for a uint32 value.
+func CompareAndSwapUint32(addr *uint32, old, new uint32) (swapped bool) {
+	raceSync(addr)
+	if *addr != old {
+		return false
+	}
+	*addr = new
+	return true
+}
+
+// AddUint64 atomically adds delta to *addr and returns the new value.
+func AddUint64(addr *uint64, delta uint64) (new uint64) {
+	raceSync(addr)
+	*addr += delta
+	return *addr
+}
+
+// LoadUint64 atomically loads *addr.
+func LoadUint64(addr *uint64) (val uint64) {
+	raceSync(addr)
+	return *addr
+}
+
+// StoreUint64 atomically stores val into *addr.
+func StoreUint64(addr *uint64, val uint64) {
+	raceSync(addr)
+	*addr = val
+}
+
+// SwapUint64 atomically stores new into *addr and returns the previous *addr value.
+func SwapUint64(addr *uint64, new uint64) (old uint64) {
+	raceSync(addr)
+	old = *addr
+	*addr = new
+	return old
+}
+
+// CompareAndSwapUint64 executes the compare-and-swap operation for a uint64 value.
+func CompareAndSwapUint64(addr *uint64, old, new uint64) (swapped bool) {
+	raceSync(addr)
+	if *addr != old {
+		return false
+	}
+	*addr = new
+	return true
+}
@@ -0,0 +1,72 @@
+// Package sync provides the mutual exclusion locks, the WaitGroups and the
+// Once of the sync package of Go, for the goroutines of the interpreter and
+// the VM (the Python modules don't have goroutines). They switch only at
+// calls, at jumps back and when they block (see sched.py), so the updates
+// of the fields of the locks between two calls are atomic. The functions
+// without bodies are implemented by interp.sync_package: the semaphores the
+// goroutines block on, like the ones of the runtime of Go.
+package sync
+
+// semacquire waits until *s > 0, then decrements it. The goroutine is in
+// the state (its wait reason in the traces) meanwhile.
+func semacquire(s *uint32, state string)
+
+// semrelease increments *s, the first goroutine waiting for it runs next.
+func semrelease(s *uint32)
+
+// fatal ends the program with a fatal error, which isn't recovered.
+func fatal(msg string)
+
+// raceAcquire, raceRelease and raceReleaseMerge tell the race detector of
+// go_parser.py run -race (see race.py) the synchronization of the locks on
+// *addr, they do nothing without it.
+func raceAcquire(addr *uint32)
+func raceRelease(addr *uint32)
+func raceReleaseMerge(addr *uint32)
+
+// A Locker represents an object that can be locked and unlocked.
+type Locker interface {
+	Lock()
+	Unlock()
+}
+
+// A Mutex is a mutual exclusion lock. The zero value for a Mutex is an
+// unlocked mutex. A locked Mutex is not associated with a particular
+// goroutine: one may lock it and another one unlock it.
+type Mutex struct {
+	state int32 // the goroutine holding the lock and the ones waiting for it
+	sema  uint32
+}
+
+// Lock locks m. If the lock is already in use, the calling goroutine blocks
+// until the mutex is available.
+func (m *Mutex) Lock() {
+	m.state++
+	if m.state > 1 {
+		semacquire(&m.sema, "sync.Mutex.Lock")
+	}
+	raceAcquire(&m.sema)
+}
+
+// TryLock tries to lock m and reports whether it succeeded.
+func (m *Mutex) TryLock() bool {
+	if m.state != 0 {
+		return false
+	}
+	m.state = 1
+	raceAcquire(&m.sema)
+	return true
+}
+
+// Unlock unlocks m, the first goroutine waiting in Lock holds it next. It
+// is a fatal error if m is not locked on entry to Unlock.
+func (m *Mutex) Unlock() {
+	if m.state == 0 {
+		fatal("sync: unlock of unlocked mutex")
+	}
+	raceRelease(&m.sema)
+	m.state--
+	if m.state > 0 {
+		semrelease(&m.sema)
+	}
+}
@@ -0,0 +1,118 @@
+package sync
+
+// the most readers, readerCount is less than 0 while a writer holds the
+// lock or waits for it
+const rwmutexMaxReaders = 1 << 30
+
+// A RWMutex is a reader/writer mutual exclusion lock. The lock can be held
+// by an arbitrary number of readers or a single writer. The zero value for
+// a RWMutex is an unlocked mutex. Once a writer waits for the lock, the
+// readers calling RLock wait for the writer to release it.
+// Ref: https://go.dev/src/sync/rwmutex.go
+type RWMutex struct {
+	w           Mutex  // held if there are pending writers
+	writerSem   uint32 // semaphore for writers to wait for completing readers
+	readerSem   uint32 // semaphore for readers to wait for completing writers
+	readerCount int32  // number of pending readers
+	readerWait  int32  // number of departing readers
+}
+
+// RLock locks rw for reading.
+func (rw *RWMutex) RLock() {
+	rw.readerCount++
+	if rw.readerCount < 0 {
+		// a writer is pending, wait for it
+		semacquire(&rw.readerSem, "sync.RWMutex.RLock")
+	}
+	raceAcquire(&rw.readerSem)
+}
+
+// TryRLock tries to lock rw for reading and reports whether it succeeded.
+func (rw *RWMutex) TryRLock() bool {
+	if rw.readerCount < 0 {
+		return false
+	}
+	rw.readerCount++
+	raceAcquire(&rw.readerSem)
+	return true
+}
+
+// RUnlock undoes a single RLock call. It is a fatal error if rw is not
+// locked for reading on entry to RUnlock.
+func (rw *RWMutex) RUnlock() {
+	raceReleaseMerge(&rw.writerSem)
+	rw.readerCount--
+	if r := rw.readerCount; r < 0 {
+		if r+1 == 0 || r+1 == -rwmutexMaxReaders {
+			fatal("sync: RUnlock of unlocked RWMutex")
+		}
+		// a writer is pending, the last reader departing lets it hold the lock
+		rw.readerWait--
+		if rw.readerWait == 0 {
+			semrelease(&rw.writerSem)
+		}
+	}
+}
+
+// Lock locks rw for writing. If the lock is already locked for reading or
+// writing, Lock blocks until the lock is available.
+func (rw *RWMutex) Lock() {
+	// first, resolve competition with other writers
+	rw.w.Lock()
+	// announce to readers there is a pending writer
+	r := rw.readerCount
+	rw.readerCount -= rwmutexMaxReaders
+	// wait for active readers
+	if r != 0 {
+		rw.readerWait += r
+		if rw.readerWait != 0 {
+			semacquire(&rw.writerSem, "sync.RWMutex.Lock")
+		}
+	}
+	raceAcquire(&rw.readerSem)
+	raceAcquire(&rw.writerSem)
+}
+
+// TryLock tries to lock rw for writing and reports whether it succeeded.
+func (rw *RWMutex) TryLock() bool {
+	if !rw.w.TryLock() {
+		return false
+	}
+	if rw.readerCount != 0 {
+		rw.w.Unlock()
+		return false
+	}
+	rw.readerCount = -rwmutexMaxReaders
+	raceAcquire(&rw.readerSem)
+	raceAcquire(&rw.writerSem)
+	return true
+}
+
+// Unlock unlocks rw for writing. It is a fatal error if rw is not locked
+// for writing on entry to Unlock.
+func (rw *RWMutex) Unlock() {
+	raceRelease(&rw.readerSem)
+	// announce to readers there is no active writer
+	rw.readerCount += rwmutexMaxReaders
+	r := rw.readerCount
+	if r >= rwmutexMaxReaders {
+		fatal("sync: Unlock of unlocked RWMutex")
+	}
+	// unblock blocked readers, if any
+	for i := 0; i < int(r); i++ {
+		semrelease(&rw.readerSem)
+	}
+	// allow other writers to proceed
+	rw.w.Unlock()
+}
+
+// RLocker returns a Locker interface that implements the Lock and Unlock
+// methods by calling rw.RLock and rw.RUnlock.
+func (rw *RWMutex) RLocker() Locker {
+	return (*rlocker)(rw)
+}
+
+type rlocker RWMutex
+
+func (r *rlocker) Lock()   { (*RWMutex)(r).RLock() }
+func (r *rlocker) Unlock() { (*RWMutex)(r).RUnlock() }
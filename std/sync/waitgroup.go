@@ -0,0 +1,58 @@
+package sync
+
+// A WaitGroup waits for a collection of goroutines to finish. The main
+// goroutine calls Add to set the number of goroutines to wait for, then
+// each of them runs and calls Done when finished. At the same time, Wait
+// can be used to block until all goroutines have finished.
+type WaitGroup struct {
+	count   int32  // the goroutines to wait for
+	waiters uint32 // the goroutines in Wait
+	sema    uint32
+}
+
+// Add adds delta, which may be negative, to the WaitGroup counter. If the
+// counter becomes zero, all goroutines blocked on Wait are released. If
+// the counter goes negative, Add panics.
+func (wg *WaitGroup) Add(delta int) {
+	if delta < 0 {
+		raceReleaseMerge(&wg.sema)
+	}
+	wg.count += int32(delta)
+	if wg.count < 0 {
+		panic("sync: negative WaitGroup counter")
+	}
+	if wg.count > 0 || wg.waiters == 0 {
+		return
+	}
+	waiters := wg.waiters
+	wg.waiters = 0
+	for ; waiters != 0; waiters-- {
+		semrelease(&wg.sema)
+	}
+}
+
+// Done decrements the WaitGroup counter by one.
+func (wg *WaitGroup) Done() {
+	wg.Add(-1)
+}
+
+// Wait blocks until the WaitGroup counter is zero.
+func (wg *WaitGroup) Wait() {
+	if wg.count == 0 {
+		raceAcquire(&wg.sema)
+		return
+	}
+	wg.waiters++
+	semacquire(&wg.sema, "sync.WaitGroup.Wait")
+	raceAcquire(&wg.sema)
+}
+
+// Go calls f in a new goroutine and adds that task to the WaitGroup. When
+// f returns, the task is removed from the WaitGroup.
+func (wg *WaitGroup) Go(f func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f()
+	}()
+}
@@ -0,0 +1,430 @@
+package testing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationOrCount is the value of -test.benchtime, a duration or a number
+// of iterations.
+type durationOrCount struct {
+	d time.Duration
+	n int
+}
+
+// set sets it to the value of the flag, like 2s or 100x, the error is the
+// one of a value which isn't one.
+func (f *durationOrCount) set(s string) string {
+	if strings.HasSuffix(s, "x") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "x"))
+		if err != nil || n <= 0 {
+			return "invalid count"
+		}
+		*f = durationOrCount{n: n}
+		return ""
+	}
+	d, ok := parseDuration(s)
+	if !ok || d <= 0 {
+		return fmt.Sprintf("time: invalid duration %q", s)
+	}
+	*f = durationOrCount{d: d}
+	return ""
+}
+
+// parseDuration parses a duration like 1.5s, a decimal number with one of
+// the units ns, us, ms, s, m or h.
+func parseDuration(s string) (d time.Duration, ok bool) {
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"ns", time.Nanosecond}, {"us", time.Microsecond}, {"µs", time.Microsecond},
+		{"ms", time.Millisecond}, {"s", time.Second}, {"m", time.Minute}, {"h", time.Hour},
+	}
+	for _, unit := range units {
+		if !strings.HasSuffix(s, unit.name) {
+			continue
+		}
+		number := strings.TrimSuffix(s, unit.name)
+		for _, c := range number {
+			if (c < '0' || c > '9') && c != '.' {
+				return 0, false
+			}
+		}
+		x, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(x * float64(unit.d)), true
+	}
+	return 0, false
+}
+
+// the width of the names of the benchmarks printed, the longest one (they
+// are padded to it)
+var maxLen int
+
+// the labels printed before the first result, see printLabels
+var (
+	pkgPath       string
+	labelsPrinted bool
+)
+
+// B is a type passed to Benchmark functions to manage benchmark timing and
+// to specify the number of iterations to run.
+//
+// A benchmark ends when its Benchmark function returns or calls any of the
+// methods FailNow, Fatal, Fatalf, SkipNow, Skip, or Skipf, like a test.
+type B struct {
+	common
+	N         int
+	benchFunc func(b *B)
+	// it ended with FailNow or SkipNow
+	finished bool
+	// it ran subbenchmarks, it isn't timed itself
+	hasSub          bool
+	showAllocResult bool
+	// the timer, the memory statistics when it started and the time and
+	// allocations measured since it was reset
+	timerOn     bool
+	start       time.Time
+	startAllocs uint64
+	startBytes  uint64
+	duration    time.Duration
+	netAllocs   uint64
+	netBytes    uint64
+	result      BenchmarkResult
+}
+
+// StartTimer starts timing a test. This function is called automatically
+// before a benchmark starts, but it can also be used to resume timing after
+// a call to StopTimer.
+func (b *B) StartTimer() {
+	if !b.timerOn {
+		b.startAllocs, b.startBytes = memStats()
+		b.start = time.Now()
+		b.timerOn = true
+	}
+}
+
+// StopTimer stops timing a test. This can be used to pause the timer while
+// performing complex initialization that you don't want to measure.
+func (b *B) StopTimer() {
+	if b.timerOn {
+		b.duration += time.Since(b.start)
+		mallocs, bytes := memStats()
+		b.netAllocs += mallocs - b.startAllocs
+		b.netBytes += bytes - b.startBytes
+		b.timerOn = false
+	}
+}
+
+// ResetTimer zeroes the elapsed benchmark time and memory allocation
+// counters and deletes user-reported metrics. It does not affect whether
+// the timer is running.
+func (b *B) ResetTimer() {
+	if b.timerOn {
+		b.startAllocs, b.startBytes = memStats()
+		b.start = time.Now()
+	}
+	b.duration = 0
+	b.netAllocs = 0
+	b.netBytes = 0
+}
+
+// ReportAllocs enables malloc statistics for this benchmark. It is
+// equivalent to setting -test.benchmem, but it only affects the benchmark
+// function that calls ReportAllocs.
+func (b *B) ReportAllocs() {
+	b.showAllocResult = true
+}
+
+// Elapsed returns the measured elapsed time of the benchmark.
+func (b *B) Elapsed() time.Duration {
+	d := b.duration
+	if b.timerOn {
+		d += time.Since(b.start)
+	}
+	return d
+}
+
+// runN runs the benchmark function with b.N set to n, timing it.
+func (b *B) runN(n int) {
+	b.N = n
+	b.ResetTimer()
+	b.StartTimer()
+	b.call()
+	b.StopTimer()
+}
+
+// call calls the benchmark function, recovering the goexit of FailNow and
+// SkipNow. A benchmark panicking fails and the panic goes on.
+func (b *B) call() {
+	defer func() {
+		err := recover()
+		if _, ok := err.(goexit); ok {
+			b.finished = true
+		} else if err != nil {
+			b.Fail()
+			panic(err)
+		}
+	}()
+	b.benchFunc(b)
+}
+
+// run1 runs the benchmark once, to find out if it has subbenchmarks (it
+// isn't timed then), and reports whether it is to be run.
+func (b *B) run1() bool {
+	if n := len(b.name) + 1; n > maxLen {
+		// with some slack, to avoid too many jumps in size
+		maxLen = n + 8
+	}
+	b.runN(1)
+	if b.failed {
+		fmt.Printf("--- FAIL: %s\n%s", b.name, b.output)
+		return false
+	}
+	if b.hasSub || b.finished {
+		tag := "BENCH"
+		if b.skipped {
+			tag = "SKIP"
+		}
+		if chatty && (len(b.output) > 0 || b.finished) {
+			b.trimOutput()
+			fmt.Printf("--- %s: %s\n%s", tag, b.name, b.output)
+		}
+		return false
+	}
+	return true
+}
+
+// run runs the benchmark for -test.benchtime, and prints its result.
+func (b *B) run() {
+	printLabels()
+	if !chatty {
+		fmt.Print(b.paddedName())
+	}
+	b.launch()
+	if b.failed {
+		fmt.Printf("--- FAIL: %s\n%s", b.name, b.output)
+		return
+	}
+	results := b.result.String()
+	if chatty {
+		fmt.Print(b.paddedName())
+	}
+	if benchmem || b.showAllocResult {
+		results += "\t" + b.result.MemString()
+	}
+	fmt.Println(results)
+	// the output is printed even without -test.v, it would skew the
+	// results if it was printed when logged
+	if len(b.output) > 0 {
+		b.trimOutput()
+		fmt.Printf("--- BENCH: %s\n%s", b.name, b.output)
+	}
+}
+
+func (b *B) paddedName() string {
+	return b.name + strings.Repeat(" ", max(maxLen-len(b.name), 0)) + "\t"
+}
+
+// launch runs the benchmark with an increasing b.N until it runs for
+// -test.benchtime (or with its count), predicting the iterations needed
+// from the last run.
+func (b *B) launch() {
+	if benchTime.n > 0 {
+		// run1 already ran a single iteration
+		if benchTime.n > 1 {
+			b.runN(benchTime.n)
+		}
+	} else {
+		d := benchTime.d
+		for n := 1; !b.failed && b.duration < d && n < 1e9; {
+			last := n
+			goalns := d.Nanoseconds()
+			prevIters := int64(b.N)
+			prevns := max(b.duration.Nanoseconds(), 1)
+			// multiplying first, dividing first would hide an order of
+			// magnitude for the fast ones
+			n = int(goalns * prevIters / prevns)
+			// more iterations than predicted (1.2x), growing at most 100x
+			// (in case of timing errors), and at least one more than last
+			n += n / 5
+			n = min(n, 100*last)
+			n = max(n, last+1)
+			n = min(n, 1e9)
+			b.runN(n)
+		}
+	}
+	b.result = BenchmarkResult{b.N, b.duration, b.netAllocs, b.netBytes}
+}
+
+// trimOutput shortens the output of a benchmark to its first 10 lines.
+func (b *B) trimOutput() {
+	const maxNewlines = 10
+	for nlCount, j := 0, 0; j < len(b.output); j++ {
+		if b.output[j] == '\n' {
+			nlCount++
+			if nlCount >= maxNewlines {
+				b.output = b.output[:j] + "\n\t... [output truncated]\n"
+				break
+			}
+		}
+	}
+}
+
+// Run benchmarks f as a subbenchmark with the given name. It reports
+// whether there were any failures.
+//
+// A subbenchmark is like any other benchmark. A benchmark that calls Run at
+// least once will not be measured itself and will be called once with N=1.
+func (b *B) Run(name string, f func(b *B)) bool {
+	b.hasSub = true
+	name = b.subName(name)
+	matched, partial := b.matches(name, bench)
+	if !matched {
+		return true
+	}
+	sub := &B{
+		common:    common{name: name, parent: &b.common, level: b.level + 1, bench: true},
+		benchFunc: f,
+	}
+	if partial {
+		// like -bench=X/Y matching BenchmarkX, only its subbenchmarks are run
+		sub.hasSub = true
+	}
+	if chatty {
+		printLabels()
+		fmt.Println(name)
+	}
+	if sub.run1() {
+		sub.run()
+	}
+	return !sub.failed
+}
+
+// runBenchmarks runs the benchmarks matching -test.bench, as the
+// subbenchmarks of a benchmark run once, and reports whether they passed.
+func runBenchmarks(pkg string, benchmarks []InternalBenchmark) bool {
+	pkgPath = pkg
+	main := &B{common: common{level: -1, bench: true}}
+	for _, benchmark := range benchmarks {
+		if matched, _ := main.matches(benchmark.Name, bench); matched {
+			maxLen = max(maxLen, len(benchmark.Name)+1)
+		}
+	}
+	main.benchFunc = func(b *B) {
+		for _, benchmark := range benchmarks {
+			b.Run(benchmark.Name, benchmark.F)
+		}
+	}
+	main.runN(1)
+	return !main.failed
+}
+
+// printLabels prints the platform and the package benchmarked, once.
+func printLabels() {
+	if labelsPrinted {
+		return
+	}
+	labelsPrinted = true
+	goos, goarch, cpu := sysinfo()
+	fmt.Printf("goos: %s\ngoarch: %s\n", goos, goarch)
+	if pkgPath != "" {
+		fmt.Printf("pkg: %s\n", pkgPath)
+	}
+	if cpu != "" {
+		fmt.Printf("cpu: %s\n", cpu)
+	}
+}
+
+// BenchmarkResult contains the results of a benchmark run.
+type BenchmarkResult struct {
+	N         int           // The number of iterations.
+	T         time.Duration // The total time taken.
+	MemAllocs uint64        // The total number of memory allocations.
+	MemBytes  uint64        // The total number of bytes allocated.
+}
+
+// NsPerOp returns the "ns/op" metric.
+func (r BenchmarkResult) NsPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return r.T.Nanoseconds() / int64(r.N)
+}
+
+// AllocsPerOp returns the "allocs/op" metric, which is calculated as
+// r.MemAllocs / r.N.
+func (r BenchmarkResult) AllocsPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return int64(r.MemAllocs) / int64(r.N)
+}
+
+// AllocedBytesPerOp returns the "B/op" metric, which is calculated as
+// r.MemBytes / r.N.
+func (r BenchmarkResult) AllocedBytesPerOp() int64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return int64(r.MemBytes) / int64(r.N)
+}
+
+// String returns a summary of the benchmark results: the number of
+// iterations and the time per iteration, with 4 or 5 significant figures
+// for the small ones.
+func (r BenchmarkResult) String() string {
+	s := fmt.Sprintf("%8d", r.N)
+	if r.N > 0 {
+		if ns := float64(r.T.Nanoseconds()) / float64(r.N); ns != 0 {
+			s += "\t" + prettyPrint(ns, "ns/op")
+		}
+	}
+	return s
+}
+
+// MemString returns r.AllocedBytesPerOp and r.AllocsPerOp in the same
+// format as 'go test'.
+func (r BenchmarkResult) MemString() string {
+	return fmt.Sprintf("%8d B/op\t%8d allocs/op", r.AllocedBytesPerOp(), r.AllocsPerOp())
+}
+
+// prettyPrint formats x with 10 places before the decimal point, the
+// small ones with four or five significant figures.
+func prettyPrint(x float64, unit string) string {
+	var format string
+	switch y := math.Abs(x); {
+	case y == 0 || y >= 999.95:
+		format = "%10.0f %s"
+	case y >= 99.995:
+		format = "%12.1f %s"
+	case y >= 9.9995:
+		format = "%13.2f %s"
+	case y >= 0.99995:
+		format = "%14.3f %s"
+	case y >= 0.099995:
+		format = "%15.4f %s"
+	case y >= 0.0099995:
+		format = "%16.5f %s"
+	case y >= 0.00099995:
+		format = "%17.6f %s"
+	default:
+		format = "%18.7f %s"
+	}
+	return fmt.Sprintf(format, x, unit)
+}
+
+// memStats returns the number of objects allocated by the program and
+// their bytes, like the Mallocs and the TotalAlloc of runtime.MemStats
+// (see Interpreter.allocate).
+func memStats() (mallocs, bytes uint64)
+
+// sysinfo returns the GOOS and the GOARCH of the runtime, and the name of
+// the CPU ("" if it isn't known).
+func sysinfo() (goos, goarch, cpu string)
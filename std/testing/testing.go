@@ -0,0 +1,390 @@
+// Package testing runs the tests and the benchmarks of a package with
+// go_parser.py test, a subset of the testing package of Go: the TestXxx
+// functions of the _test.go files and their subtests run one after the
+// other (there is no Parallel), then the BenchmarkXxx functions, and their
+// results are printed like go test does. It is
+// written in Go, the interpreter and the VM run it like the packages of the
+// program; the functions without bodies are implemented by their runtime
+// (interp.testing_package). The python backend doesn't have it.
+package testing
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// InternalTest is a test function of the package and its name, the main
+// function go_parser.py test generates gives them to Main.
+type InternalTest struct {
+	Name string
+	F    func(*T)
+}
+
+// InternalBenchmark is a benchmark function of the package and its name,
+// like InternalTest.
+type InternalBenchmark struct {
+	Name string
+	F    func(b *B)
+}
+
+// the flags of the test program, read from os.Args by Main
+var (
+	// -test.v, the tests are printed when they run and when they pass
+	chatty bool
+	// -test.run, a regular expression for each level of the test names,
+	// split at the slashes
+	run []string
+	// -test.bench, the same for the benchmarks, none are run without it
+	bench []string
+	// -test.benchtime, the time each benchmark runs for, or its number
+	// of iterations (like 100x)
+	benchTime = durationOrCount{d: time.Second}
+	// -test.benchmem, the allocations of all the benchmarks are printed
+	benchmem bool
+)
+
+// the names of the tests run, each one with the number of its duplicates
+var names = map[string]int{}
+
+// common is the state of a test, a T.
+type common struct {
+	name    string
+	parent  *common
+	level   int // 0 for the tests of the package, 1 for their subtests...
+	failed  bool
+	skipped bool
+	// it is a B, its output is printed when it ends (even with -test.v)
+	bench bool
+	// its report was printed, see tRunner
+	done bool
+	// the log of the test, and the reports of its subtests, printed with
+	// its own report (the log is printed right away with -test.v)
+	output string
+	// the functions calling Helper, see decorate
+	helpers map[int]bool
+	start   time.Time
+}
+
+// T is a type passed to Test functions to manage test state and support
+// formatted test logs.
+//
+// A test ends when its Test function returns or calls any of the methods
+// FailNow, Fatal, Fatalf, SkipNow, Skip, or Skipf: they panic with a value
+// the test runner recovers, so the deferred calls of the test run (a test
+// recovering it goes on).
+type T struct {
+	common
+}
+
+// goexit is the value FailNow and SkipNow panic with, instead of the
+// runtime.Goexit of Go, see tRunner.
+type goexit struct{}
+
+// Name returns the name of the running test, with the names of the tests
+// running it before its own, separated by slashes.
+func (c *common) Name() string {
+	return c.name
+}
+
+// Fail marks the function (and the ones running it) as having failed but
+// continues execution.
+func (c *common) Fail() {
+	if c.parent != nil {
+		c.parent.Fail()
+	}
+	c.failed = true
+}
+
+// Failed reports whether the function has failed.
+func (c *common) Failed() bool {
+	return c.failed
+}
+
+// FailNow marks the function as having failed and stops its execution.
+func (c *common) FailNow() {
+	c.Fail()
+	panic(goexit{})
+}
+
+// Skipped reports whether the test was skipped.
+func (c *common) Skipped() bool {
+	return c.skipped
+}
+
+// SkipNow marks the test as having been skipped and stops its execution.
+// A test failing before is still failed.
+func (c *common) SkipNow() {
+	c.skipped = true
+	panic(goexit{})
+}
+
+// Helper marks the calling function as a test helper function. When
+// printing file and line information, that function will be skipped.
+func (c *common) Helper() {
+	fn, _, _ := caller(1)
+	if c.helpers == nil {
+		c.helpers = map[int]bool{}
+	}
+	c.helpers[fn] = true
+}
+
+// Log formats its arguments using default formatting, analogous to
+// Println, and records the text in the error log.
+func (c *common) Log(args ...any) { c.log(fmt.Sprintln(args...)) }
+
+// Logf formats its arguments according to the format, analogous to
+// Printf, and records the text in the error log.
+func (c *common) Logf(format string, args ...any) { c.log(fmt.Sprintf(format, args...)) }
+
+// Error is equivalent to Log followed by Fail.
+func (c *common) Error(args ...any) {
+	c.log(fmt.Sprintln(args...))
+	c.Fail()
+}
+
+// Errorf is equivalent to Logf followed by Fail.
+func (c *common) Errorf(format string, args ...any) {
+	c.log(fmt.Sprintf(format, args...))
+	c.Fail()
+}
+
+// Fatal is equivalent to Log followed by FailNow.
+func (c *common) Fatal(args ...any) {
+	c.log(fmt.Sprintln(args...))
+	c.FailNow()
+}
+
+// Fatalf is equivalent to Logf followed by FailNow.
+func (c *common) Fatalf(format string, args ...any) {
+	c.log(fmt.Sprintf(format, args...))
+	c.FailNow()
+}
+
+// Skip is equivalent to Log followed by SkipNow.
+func (c *common) Skip(args ...any) {
+	c.log(fmt.Sprintln(args...))
+	c.SkipNow()
+}
+
+// Skipf is equivalent to Logf followed by SkipNow.
+func (c *common) Skipf(format string, args ...any) {
+	c.log(fmt.Sprintf(format, args...))
+	c.SkipNow()
+}
+
+// log adds the text to the log of the test, with the file and the line of
+// the call of the method logging it.
+func (c *common) log(s string) {
+	s = c.decorate(s)
+	if chatty && !c.bench {
+		fmt.Print(s)
+	} else {
+		c.output += s
+	}
+}
+
+// decorate prefixes the string with the file and line of the call site
+// (the first function out of this file which isn't a helper, or the test
+// function if they all are) and indents it, its lines after the first one
+// a bit more.
+func (c *common) decorate(s string) string {
+	_, here, _ := caller(0)
+	file, line := "???", 1
+	for skip := 1; ; skip++ {
+		fn, f, l := caller(skip)
+		if f == "" || f == here && file != "???" {
+			break
+		}
+		if f == here {
+			continue
+		}
+		file, line = f, l
+		if !c.isHelper(fn) {
+			break
+		}
+	}
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		file = file[i+1:]
+	}
+	if i := strings.LastIndex(file, "\\"); i >= 0 {
+		file = file[i+1:]
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	return fmt.Sprintf("    %s:%d: %s\n", file, line, strings.Join(lines, "\n        "))
+}
+
+func (c *common) isHelper(fn int) bool {
+	for t := c; t != nil; t = t.parent {
+		if t.helpers[fn] {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs f as a subtest of t called name, and waits for it to return.
+// It reports whether f succeeded, it isn't run (and succeeds) if its name
+// doesn't match the -test.run flag.
+func (t *T) Run(name string, f func(t *T)) bool {
+	name = t.subName(name)
+	if matched, _ := t.matches(name, run); !matched {
+		return true
+	}
+	sub := &T{common{name: name, parent: &t.common, level: t.level + 1}}
+	if chatty {
+		fmt.Printf("=== RUN   %s\n", sub.name)
+	}
+	tRunner(sub, f)
+	return !sub.failed
+}
+
+// subName is the name of the subtest name of c: the names of the tests
+// running it before, separated by slashes, and name with its spaces
+// replaced by underscores. The ones already taken get a #01, #02... suffix.
+func (c *common) subName(name string) string {
+	name = strings.ReplaceAll(name, " ", "_")
+	if c.parent != nil {
+		name = c.name + "/" + name
+	}
+	n, taken := names[name]
+	for taken {
+		names[name] = n + 1
+		name = fmt.Sprintf("%s#%02d", name, n)
+		n, taken = names[name]
+	}
+	names[name] = 1
+	return name
+}
+
+// matches reports whether the test name of a subtest of c matches the
+// element of the patterns (the ones of -test.run or -test.bench) of its
+// level, and if it is a partial match: there are patterns for its subtests.
+func (c *common) matches(name string, patterns []string) (matched, partial bool) {
+	level := c.level + 1
+	if level >= len(patterns) {
+		return true, false
+	}
+	elements := strings.Split(name, "/")
+	matched, _ = matchString(patterns[level], elements[len(elements)-1])
+	return matched, matched && level < len(patterns)-1
+}
+
+// tRunner runs the test, and prints its report: recovering the goexit of
+// FailNow and SkipNow, a test panicking fails (with the ones running it)
+// and the panic goes on, like in Go it ends the program.
+func tRunner(t *T, fn func(t *T)) {
+	defer func() {
+		err := recover()
+		if _, ok := err.(goexit); err != nil && !ok {
+			// the tests running it recover the panic too, once reported
+			t.Fail()
+			for c := &t.common; c.parent != nil && !c.done; c = c.parent {
+				c.report()
+			}
+			panic(err)
+		}
+		t.report()
+	}()
+	t.start = time.Now()
+	fn(t)
+}
+
+// report prints the result of the test and its output, if it failed (or
+// always with -test.v). The ones of a subtest are part of the output of
+// the test running it, indented.
+func (c *common) report() {
+	status := "PASS"
+	if c.failed {
+		status = "FAIL"
+	} else if c.skipped {
+		status = "SKIP"
+	}
+	if status == "FAIL" || chatty {
+		seconds := time.Since(c.start).Seconds()
+		s := fmt.Sprintf("--- %s: %s (%.2fs)\n", status, c.name, seconds) + c.output
+		if c.level == 0 {
+			fmt.Print(s)
+		} else {
+			c.parent.output += indent(s)
+		}
+	}
+	c.output = ""
+	c.done = true
+}
+
+// indent indents the lines of s by 4 spaces.
+func indent(s string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	return "    " + strings.Join(lines, "\n    ") + "\n"
+}
+
+// Main runs the tests whose names match the -test.run flag of os.Args,
+// then the benchmarks matching the -test.bench flag, and prints PASS, or
+// FAIL and ends the program with the status 1 if one of them fails. It is
+// called by the main function go_parser.py test generates, with the import
+// path of the package and its tests and benchmarks in the order of their
+// files.
+func Main(pkg string, tests []InternalTest, benchmarks []InternalBenchmark) {
+	for _, arg := range os.Args[1:] {
+		if arg == "-test.v" || arg == "-test.v=true" {
+			chatty = true
+		} else if strings.HasPrefix(arg, "-test.run=") {
+			run = strings.Split(strings.TrimPrefix(arg, "-test.run="), "/")
+		} else if strings.HasPrefix(arg, "-test.bench=") {
+			if value := strings.TrimPrefix(arg, "-test.bench="); value != "" {
+				bench = strings.Split(value, "/")
+			}
+		} else if strings.HasPrefix(arg, "-test.benchtime=") {
+			value := strings.TrimPrefix(arg, "-test.benchtime=")
+			if err := benchTime.set(value); err != "" {
+				fmt.Fprintf(os.Stderr, "invalid value %q for flag -test.benchtime: %s\n", value, err)
+				os.Exit(2)
+			}
+		} else if arg == "-test.benchmem" || arg == "-test.benchmem=true" {
+			benchmem = true
+		}
+	}
+	for _, flag := range []struct {
+		name     string
+		patterns []string
+	}{{"run", run}, {"bench", bench}} {
+		for i, element := range flag.patterns {
+			if _, err := matchString(element, ""); err != "" {
+				fmt.Fprintf(os.Stderr, "testing: invalid regexp for element %d of -test.%s (%q): %s\n",
+					i, flag.name, element, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// the tests of the package are its subtests
+	root := &T{common{level: -1}}
+	ran := false
+	for _, test := range tests {
+		if matched, _ := root.matches(test.Name, run); matched {
+			ran = true
+			root.Run(test.Name, test.F)
+		}
+	}
+	if !ran && bench == nil {
+		fmt.Fprintln(os.Stderr, "testing: warning: no tests to run")
+	}
+	benchOk := bench == nil || runBenchmarks(pkg, benchmarks)
+	if root.failed || !benchOk {
+		fmt.Println("FAIL")
+		os.Exit(1)
+	}
+	fmt.Println("PASS")
+}
+
+// matchString reports whether the regular expression pat matches str, the
+// error is the one of pat if it isn't a regular expression.
+func matchString(pat, str string) (bool, string)
+
+// caller returns the function, the file and the line of the call being run
+// by the function skip frames up the stack from the one calling caller
+// (its file is "" if there are less frames). The functions are numbered
+// by the runtime, it is the same number for each call.
+func caller(skip int) (fn int, file string, line int)
@@ -0,0 +1,282 @@
+// Package time measures and displays time, a subset of the time package of
+// Go: Durations and their constants, and the Times of Now and Unix, which
+// are in UTC (there are no locations, nor a monotonic clock). The functions
+// without bodies are implemented by the runtime of each backend
+// (interp.time_package for the interpreter and the VM, gopyrt/time.py for
+// the Python modules), which read and sleep on a clock a test can replace
+// by a fake one, starting at the time of the Go playground and moving only
+// when the program sleeps (go_parser.py run --fake-clock).
+package time
+
+// A Duration represents the elapsed time between two instants as an int64
+// nanosecond count.
+type Duration int64
+
+// Common durations.
+const (
+	Nanosecond  Duration = 1
+	Microsecond          = 1000 * Nanosecond
+	Millisecond          = 1000 * Microsecond
+	Second               = 1000 * Millisecond
+	Minute               = 60 * Second
+	Hour                 = 60 * Minute
+)
+
+// String returns a string representing the duration in the form "72h3m0.5s".
+// Leading zero units are omitted. Durations less than one second use a
+// smaller unit (milli-, micro-, or nanoseconds), and the zero duration
+// formats as 0s.
+func (d Duration) String() string {
+	var buf [32]byte
+	w := len(buf)
+
+	u := uint64(d)
+	neg := d < 0
+	if neg {
+		u = -u
+	}
+
+	if u < uint64(Second) {
+		// a smaller unit, with up to three digits after the decimal point
+		var prec int
+		w--
+		buf[w] = 's'
+		w--
+		switch {
+		case u == 0:
+			return "0s"
+		case u < uint64(Microsecond):
+			prec = 0
+			buf[w] = 'n'
+		case u < uint64(Millisecond):
+			prec = 3
+			// U+00B5 'µ' micro sign == 0xC2 0xB5
+			buf[w] = '\xb5'
+			w--
+			buf[w] = '\xc2'
+		default:
+			prec = 6
+			buf[w] = 'm'
+		}
+		w, u = fmtFrac(buf[:w], u, prec)
+		w = fmtInt(buf[:w], u)
+	} else {
+		w--
+		buf[w] = 's'
+		w, u = fmtFrac(buf[:w], u, 9)
+		// u is now integer seconds
+		w = fmtInt(buf[:w], u%60)
+		u /= 60
+		// u is now integer minutes
+		if u > 0 {
+			w--
+			buf[w] = 'm'
+			w = fmtInt(buf[:w], u%60)
+			u /= 60
+			// u is now integer hours
+			if u > 0 {
+				w--
+				buf[w] = 'h'
+				w = fmtInt(buf[:w], u)
+			}
+		}
+	}
+
+	if neg {
+		w--
+		buf[w] = '-'
+	}
+	return string(buf[w:])
+}
+
+// fmtFrac formats the fraction of v/10**prec (e.g., ".12345") into the
+// tail of buf, omitting trailing zeros. It omits the decimal point too
+// when the fraction is 0. It returns the index where the output bytes
+// begin and the value v/10**prec.
+func fmtFrac(buf []byte, v uint64, prec int) (nw int, nv uint64) {
+	w := len(buf)
+	print := false
+	for i := 0; i < prec; i++ {
+		digit := v % 10
+		print = print || digit != 0
+		if print {
+			w--
+			buf[w] = byte(digit) + '0'
+		}
+		v /= 10
+	}
+	if print {
+		w--
+		buf[w] = '.'
+	}
+	return w, v
+}
+
+// fmtInt formats v into the tail of buf. It returns the index where the
+// output begins.
+func fmtInt(buf []byte, v uint64) int {
+	w := len(buf)
+	if v == 0 {
+		w--
+		buf[w] = '0'
+	} else {
+		for v > 0 {
+			w--
+			buf[w] = byte(v%10) + '0'
+			v /= 10
+		}
+	}
+	return w
+}
+
+// Nanoseconds returns the duration as an integer nanosecond count.
+func (d Duration) Nanoseconds() int64 { return int64(d) }
+
+// Microseconds returns the duration as an integer microsecond count.
+func (d Duration) Microseconds() int64 { return int64(d) / 1e3 }
+
+// Milliseconds returns the duration as an integer millisecond count.
+func (d Duration) Milliseconds() int64 { return int64(d) / 1e6 }
+
+// Seconds returns the duration as a floating point number of seconds.
+func (d Duration) Seconds() float64 {
+	sec := d / Second
+	nsec := d % Second
+	return float64(sec) + float64(nsec)/1e9
+}
+
+// Minutes returns the duration as a floating point number of minutes.
+func (d Duration) Minutes() float64 {
+	min := d / Minute
+	nsec := d % Minute
+	return float64(min) + float64(nsec)/(60*1e9)
+}
+
+// Hours returns the duration as a floating point number of hours.
+func (d Duration) Hours() float64 {
+	hour := d / Hour
+	nsec := d % Hour
+	return float64(hour) + float64(nsec)/(60*60*1e9)
+}
+
+// A Time represents an instant in time with nanosecond precision, in UTC.
+// The zero value is January 1, year 1, 00:00:00 UTC.
+type Time struct {
+	sec  int64 // the seconds since January 1, year 1 00:00:00 UTC
+	nsec int64 // the nanoseconds in the second, in the range [0, 999999999]
+}
+
+// unixToInternal is the number of seconds between year 1 and 1970.
+const unixToInternal int64 = (1969*365 + 1969/4 - 1969/100 + 1969/400) * 24 * 60 * 60
+
+// Now returns the current time, the one of the clock of the runtime.
+func Now() Time {
+	return Unix(0, now())
+}
+
+// Unix returns the Time corresponding to the given Unix time, sec seconds
+// and nsec nanoseconds since January 1, 1970 UTC. It is valid to pass
+// nsec outside the range [0, 999999999].
+func Unix(sec int64, nsec int64) Time {
+	if nsec < 0 || nsec >= 1e9 {
+		n := nsec / 1e9
+		sec += n
+		nsec -= n * 1e9
+		if nsec < 0 {
+			nsec += 1e9
+			sec--
+		}
+	}
+	return Time{sec + unixToInternal, nsec}
+}
+
+// Since returns the time elapsed since t, Now().Sub(t).
+func Since(t Time) Duration {
+	return Now().Sub(t)
+}
+
+// Until returns the duration until t, t.Sub(Now()).
+func Until(t Time) Duration {
+	return t.Sub(Now())
+}
+
+// Sleep pauses the current goroutine for at least the duration d. A
+// negative or zero duration causes Sleep to return immediately.
+func Sleep(d Duration) {
+	if d > 0 {
+		sleep(int64(d))
+	}
+}
+
+// now returns the time of the clock in nanoseconds since January 1, 1970 UTC.
+func now() int64
+
+// sleep waits for ns nanoseconds on the clock.
+func sleep(ns int64)
+
+// IsZero reports whether t represents the zero time instant,
+// January 1, year 1, 00:00:00 UTC.
+func (t Time) IsZero() bool {
+	return t.sec == 0 && t.nsec == 0
+}
+
+// Add returns the time t+d.
+func (t Time) Add(d Duration) Time {
+	dsec := int64(d / 1e9)
+	nsec := t.nsec + int64(d%1e9)
+	if nsec >= 1e9 {
+		dsec++
+		nsec -= 1e9
+	} else if nsec < 0 {
+		dsec--
+		nsec += 1e9
+	}
+	return Time{t.sec + dsec, nsec}
+}
+
+// Sub returns the duration t-u.
+func (t Time) Sub(u Time) Duration {
+	return Duration(t.sec-u.sec)*Second + Duration(t.nsec-u.nsec)
+}
+
+// After reports whether the time instant t is after u.
+func (t Time) After(u Time) bool {
+	return t.sec > u.sec || t.sec == u.sec && t.nsec > u.nsec
+}
+
+// Before reports whether the time instant t is before u.
+func (t Time) Before(u Time) bool {
+	return t.sec < u.sec || t.sec == u.sec && t.nsec < u.nsec
+}
+
+// Equal reports whether t and u represent the same time instant.
+func (t Time) Equal(u Time) bool {
+	return t.sec == u.sec && t.nsec == u.nsec
+}
+
+// Unix returns t as a Unix time, the number of seconds elapsed since
+// January 1, 1970 UTC.
+func (t Time) Unix() int64 {
+	return t.sec - unixToInternal
+}
+
+// UnixMilli returns t as a Unix time, the number of milliseconds elapsed
+// since January 1, 1970 UTC.
+func (t Time) UnixMilli() int64 {
+	return t.Unix()*1e3 + t.nsec/1e6
+}
+
+// UnixNano returns t as a Unix time, the number of nanoseconds elapsed
+// since January 1, 1970 UTC.
+func (t Time) UnixNano() int64 {
+	return t.Unix()*1e9 + t.nsec
+}
+
+// String returns the time formatted like "2006-01-02 15:04:05.999999999
+// -0700 MST", with the fraction of the second if it isn't 0.
+func (t Time) String() string {
+	return format(t.sec, t.nsec)
+}
+
+// format formats the time of sec seconds since year 1 and nsec nanoseconds.
+func format(sec, nsec int64) string
@@ -0,0 +1,275 @@
+import os
+import checker
+import syntree
+import untyped
+
+from typing import List, Optional, Set
+from checker import basic_typename, in_order, parameters, results, underlying
+from pygen import attribute, init_param, mangle, receiver_name
+
+
+# The stubs of the modules of the Python backend (gopy export): a .pyi file
+# next to the module of each package, with the exported functions, types,
+# constants and variables of the package, and the Python types of their Go
+# types, so the type checkers (and the editors) of the Python code calling
+# the Go code know what it takes and returns:
+#
+#   def Area(width: int, height: int, /) -> int:
+#       """Area returns the area of a rectangle."""
+#
+# The values are the ones of the modules (see pygen.py): the integers are
+# ints, the strings strs, the slices go.Slice, the maps go.Map, the structs
+# (and the pointers to them) the objects of their classes, and the values
+# of the named types which aren't structs the ones of their underlying type,
+# whose methods are called on the class (Meters.String(m)). The interfaces
+# and the type parameters are Any (the type arguments are erased). The
+# parameters are positional only: the backend renames the ones shadowing a
+# name of the module, and Go has no keyword arguments. The variadic
+# parameters take a go.Slice, and the functions with several results
+# return a tuple
+
+kinds = {"bool": "bool", "int": "int", "float": "float", "complex": "complex", "string": "str"}
+
+
+class Stub:
+    """The stub of the module of a package"""
+
+    def __init__(self, package, info: checker.Info):
+        self.package = package
+        self.info = info
+        self.lines: List[str] = []
+        # the modules of the other packages whose types the stub refers to
+        self.imports: Set[str] = set()
+        # if it uses Any, Callable, Final, Optional or Tuple
+        self.typing: Set[str] = set()
+
+    def emit(self, line: str = "", level: int = 0):
+        self.lines.append("    " * level + line if line else "")
+
+    def annotation(self, t: Optional[syntree.Type]) -> str:
+        """The Python type of the values of the Go type t"""
+        if t is None:
+            return "None"
+        if isinstance(t, syntree.TypeParam):
+            return self.any()
+        origin = getattr(t, "origin", None) or t
+        if isinstance(origin, syntree.NamedType) and isinstance(underlying(origin), syntree.Struct):
+            return self.class_name(origin)
+        u = underlying(t)
+        typename = basic_typename(u)
+        if typename in ("float32", "complex64"):
+            return "go.Float32" if typename == "float32" else "go.Complex64"
+        if typename is not None:
+            kind = untyped.kind_of_typename(typename)
+            if kind in kinds:
+                return kinds[kind]
+            # an untyped nil
+            return "None"
+        if isinstance(u, syntree.Pointer):
+            base = self.annotation(u.base)
+            if not isinstance(underlying(u.base), (syntree.Struct, syntree.Array)):
+                return self.any()
+            self.typing.add("Optional")
+            return f"Optional[{base}]"
+        if isinstance(u, syntree.Slice):
+            return f"go.Slice[{self.annotation(u.eltype)}]"
+        if isinstance(u, syntree.Array):
+            return f"go.Array[{self.annotation(u.eltype)}]"
+        if isinstance(u, syntree.Map):
+            return f"go.Map[{self.annotation(u.key)}, {self.annotation(u.eltype)}]"
+        if isinstance(u, syntree.FunctionType):
+            self.typing.add("Callable")
+            params = [self.annotation(p) for p in self.parameter_types(u.signature)]
+            return f"Callable[[{', '.join(params)}], {self.result(u.signature)}]"
+        # the interfaces (and the errors) and the channels
+        return self.any()
+
+    def member(self):
+        """The blank line before a member of a class, but the first one"""
+        if not self.lines[-1].startswith("class "):
+            self.emit()
+
+    def any(self) -> str:
+        self.typing.add("Any")
+        return "Any"
+
+    def class_name(self, t: syntree.NamedType) -> str:
+        """The class of a named struct type, in the module of its package"""
+        package = getattr(t, "package", None)
+        if package is not None and package != self.package.name:
+            self.imports.add(mangle(package))
+            return f"{mangle(package)}.{attribute(t.typename)}"
+        return mangle(t.typename)
+
+    def parameter_types(self, signature: syntree.Signature) -> List[syntree.Type]:
+        """The types of the parameters, the variadic one is a slice"""
+        types = []
+        for _, type_, variadic in parameters(signature.parameters):
+            types.append(syntree.Slice(type_) if variadic else type_)
+        return types
+
+    def result(self, signature: syntree.Signature) -> str:
+        types = results(signature)
+        if not types:
+            return "None"
+        if len(types) == 1:
+            return self.annotation(types[0])
+        self.typing.add("Tuple")
+        return f"Tuple[{', '.join(self.annotation(t) for t in types)}]"
+
+    def function(self, decl: syntree.Function, name: str, level: int = 0,
+                 receiver: Optional[str] = None):
+        """The def of a function, or of a method (of the class of its
+        receiver, whose type is given if it isn't self)"""
+        params, taken = [], set()
+        if receiver == "self":
+            params.append("self")
+            taken.add("self")
+        elif receiver is not None:
+            # a method of a type which isn't a struct, called on the class
+            recv = receiver_name(decl)
+            recv = mangle(recv) if recv not in (None, "_") else "value"
+            params.append(f"{recv}: {receiver}")
+            taken.add(recv)
+        for (ident, _, _), type_ in zip(parameters(decl.signature.parameters),
+                                        self.parameter_types(decl.signature)):
+            param = mangle(ident.ident_name) if ident is not None else "_"
+            while param == "_" or param in taken:
+                param = f"p{len(params)}" if param == "_" else param + "_"
+            taken.add(param)
+            params.append(f"{param}: {self.annotation(type_)}")
+        if params:
+            params.append("/")
+        line = f"def {name}({', '.join(params)}) -> {self.result(decl.signature)}:"
+        if doc(decl) is None:
+            self.emit(line + " ...", level)
+            return
+        self.emit(line, level)
+        self.docstring(decl, level + 1)
+
+    def docstring(self, decl, level: int):
+        """The doc comment of the declaration as a docstring"""
+        text = doc(decl)
+        if text is None:
+            return
+        text = text.replace("\\", "\\\\").replace('"""', '\\"\\"\\"')
+        lines = text.split("\n")
+        if len(lines) == 1:
+            self.emit(f'"""{text}"""', level)
+            return
+        self.emit(f'"""{lines[0]}', level)
+        for line in lines[1:]:
+            self.emit(line, level)
+        self.emit('"""', level)
+
+    def type_decl(self, decl: syntree.TypeDef, methods: list):
+        t = decl.type_
+        if not isinstance(t, syntree.NamedType):
+            # an alias
+            return
+        u = underlying(t)
+        name = mangle(decl.typename[1])
+        methods = [m for m in methods if is_exported(m.fn_name[1])]
+        if not isinstance(u, syntree.Struct):
+            if not methods:
+                return
+            # the values are the ones of the underlying type
+            self.emit()
+            self.emit()
+            self.emit(f"class {name}:")
+            self.docstring(decl, 1)
+            underlying_type = self.annotation(u)
+            for method in methods:
+                self.member()
+                self.emit("@staticmethod", 1)
+                self.function(method, attribute(method.fn_name[1]), 1, underlying_type)
+            return
+        self.emit()
+        self.emit()
+        self.emit(f"class {name}(go.Struct):")
+        self.docstring(decl, 1)
+        fields = [f for f in u.fields if is_exported(f.f_name)]
+        if doc(decl) is None and not fields and not methods:
+            self.emit("...", 1)
+        for f in fields:
+            self.emit(f"{attribute(f.f_name)}: {self.annotation(f.type_)}", 1)
+        if fields:
+            self.member()
+            params = ", ".join(f"{init_param(f)}: {self.annotation(f.type_)} = ..." for f in fields)
+            self.emit(f"def __init__(self, {params}) -> None: ...", 1)
+        for method in methods:
+            self.member()
+            self.function(method, attribute(method.fn_name[1]), 1, "self")
+
+    def module(self) -> str:
+        decls = []
+        for file in reversed(self.package.ast.children):
+            for child in file.children:
+                decls.extend(in_order(child))
+        methods = {}
+        for decl in decls:
+            if isinstance(decl, syntree.Method):
+                methods.setdefault(decl.base_type.typename, []).append(decl)
+        for decl in decls:
+            if isinstance(decl, syntree.VarDecl) and is_exported(decl.ident.ident_name):
+                obj = self.info.defs.get(decl.ident)
+                if obj is None:
+                    continue
+                if not decl.const:
+                    self.emit(f"{mangle(decl.ident.ident_name)}: {self.annotation(obj.type_)}")
+                    continue
+                typename = basic_typename(obj.type_) if obj.type_ is not None else None
+                if typename is None or untyped.kind_of_typename(typename) is None:
+                    # an untyped constant is one of its default type
+                    kind = untyped.kind_of_typename(obj.constant.typename or
+                                                    untyped.default_typename(obj.constant.kind))
+                    annotation = kinds[kind]
+                else:
+                    annotation = self.annotation(obj.type_)
+                self.typing.add("Final")
+                self.emit(f"{mangle(decl.ident.ident_name)}: Final[{annotation}]")
+        for decl in decls:
+            if isinstance(decl, syntree.TypeDef) and is_exported(decl.typename[1]):
+                self.type_decl(decl, methods.get(decl.typename[1], []))
+        for decl in decls:
+            if isinstance(decl, syntree.Function) and not isinstance(decl, syntree.Method) \
+                    and is_exported(decl.fn_name[1]):
+                self.emit()
+                self.emit()
+                self.function(decl, mangle(decl.fn_name[1]))
+
+        header = [f"# Stubs generated by gopy from package {self.package.name}, do not edit", ""]
+        if self.typing:
+            header.append(f"from typing import {', '.join(sorted(self.typing))}")
+        header.append("import gopyrt as go")
+        header.extend(f"import {module}" for module in sorted(self.imports))
+        body = self.lines
+        if body and body[0]:
+            header.append("")
+        return "\n".join(header + body).rstrip("\n") + "\n"
+
+
+def doc(decl) -> Optional[str]:
+    """The text of the doc comment of a declaration, None if it has none"""
+    comment = syntree.doc_comment(decl)
+    text = comment.text().strip() if comment is not None else ""
+    return text or None
+
+
+def is_exported(name: str) -> bool:
+    return name[:1].isupper()
+
+
+def stub(package, info: checker.Info) -> str:
+    """The stub of the module of a package checked"""
+    return Stub(package, info).module()
+
+
+def write(packages: list, info: checker.Info, outdir: str):
+    """Writes the stubs of the modules pygen.build wrote for the packages"""
+    for package in packages:
+        if package.std:
+            continue
+        with open(os.path.join(outdir, mangle(package.name) + ".pyi"), "wt",
+                  encoding="utf-8") as f:
+            f.write(stub(package, info))
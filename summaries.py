@@ -0,0 +1,137 @@
+import os
+import hashlib
+import subprocess
+import tempfile
+
+from typing import Optional
+
+
+# The summaries of the packages of the standard library std doesn't declare,
+# like unicode or bufio: a Go file with their exported declarations, whose
+# functions have no bodies, which gosummary/main.go prints from the export
+# data of the Go toolchain installed (go/types reads it). The loader finds
+# there the import paths which are neither in the program nor in std, so
+# the programs importing them are type checked, and the backends report
+# their uses as not supported. The summaries are made once, by the go
+# command given (go_command), and kept in directory by version of Go and
+# of gosummary (the hash of its source and of std, whose declarations are
+# the ones a summary refers to):
+#
+#   ~/.cache/gopy/summaries/go1.22.1-2f0c5e1a9b3d4c6e/unicode/utf8/summary.go
+#
+# GOPYSUMMARIES=off (or no go command) leaves them out, the packages are
+# unknown then, like before
+
+# the directory of the summaries, GOPYSUMMARIES or the summaries directory
+# of the gopy directory of the user cache directory
+directory = os.environ.get("GOPYSUMMARIES") or os.path.join(
+    os.environ.get("XDG_CACHE_HOME") or os.path.join(os.path.expanduser("~"), ".cache"),
+    "gopy", "summaries")
+enabled = directory != "off"
+
+go_command = "go"
+
+here = os.path.dirname(os.path.abspath(__file__))
+source = os.path.join(here, "gosummary", "main.go")
+
+# the version of the go command, None if there is none
+_version: Optional[str] = None
+_tried = False
+_key: Optional[str] = None
+
+
+def go_version() -> Optional[str]:
+    global _version, _tried
+    if not _tried:
+        _tried = True
+        try:
+            done = subprocess.run([go_command, "env", "GOVERSION"], capture_output=True,
+                                  text=True, timeout=60)
+            if done.returncode == 0 and done.stdout.strip():
+                _version = done.stdout.strip()
+        except OSError:
+            pass
+    return _version
+
+
+def key() -> str:
+    """The hash of gosummary/main.go and of the files of std"""
+    global _key
+    if _key is None:
+        import loader
+        h = hashlib.sha256()
+        files = [source] + sorted(os.path.join(dir, name)
+                                  for dir, _, names in os.walk(loader.std_root)
+                                  for name in names if name.endswith(".go"))
+        for filename in files:
+            with open(filename, "rb") as f:
+                h.update(os.path.relpath(filename, here).encode() + b"\0" + f.read())
+        _key = h.hexdigest()[:16]
+    return _key
+
+
+def std_path(path: str) -> bool:
+    """If path may be the one of a package of the standard library: the
+    first element of the other ones has a dot, like in github.com/..."""
+    first = path.split("/")[0]
+    return bool(first) and "." not in first and not path.startswith("./") and ":" not in path
+
+
+def find(path: str) -> Optional[str]:
+    """The directory of the summary of the package of std path, made with
+    gosummary if it isn't there yet. None if there is no such package in
+    the standard library (or no go command)"""
+    if not enabled or not std_path(path):
+        return None
+    version = go_version()
+    if version is None:
+        return None
+    root = os.path.join(directory, f"{version}-{key()}")
+    dir = os.path.join(root, *path.split("/"))
+    filename = os.path.join(dir, "summary.go")
+    missing = os.path.join(dir, "missing")
+    if os.path.exists(filename):
+        return dir
+    if os.path.exists(missing):
+        return None
+    summary = make(path, root)
+    os.makedirs(dir, exist_ok=True)
+    # written to a temporary file, then renamed, for the runs made at once
+    fd, tmp = tempfile.mkstemp(dir=dir)
+    with os.fdopen(fd, "w", encoding="utf-8") as f:
+        f.write(summary or "")
+    os.replace(tmp, filename if summary is not None else missing)
+    return dir if summary is not None else None
+
+
+def make(path: str, root: str) -> Optional[str]:
+    """The summary gosummary prints for path, None if it fails"""
+    import loader
+    binary = gosummary(root)
+    if binary is None:
+        return None
+    try:
+        done = subprocess.run([binary, "-std", loader.std_root, path], capture_output=True,
+                              text=True, timeout=300)
+    except (OSError, subprocess.TimeoutExpired):
+        return None
+    return done.stdout if done.returncode == 0 else None
+
+
+def gosummary(root: str) -> Optional[str]:
+    """The gosummary command of the summaries of root, built by the go
+    command the first time"""
+    binary = os.path.join(root, "gosummary")
+    if os.path.exists(binary):
+        return binary
+    os.makedirs(root, exist_ok=True)
+    tmp = f"{binary}.{os.getpid()}"
+    try:
+        done = subprocess.run([go_command, "build", "-o", tmp, source], capture_output=True,
+                              timeout=300, env=dict(os.environ, GO111MODULE="off"))
+    except (OSError, subprocess.TimeoutExpired):
+        return None
+    if done.returncode != 0:
+        return None
+    os.replace(tmp, binary)
+    return binary
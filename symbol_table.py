@@ -1,10 +1,11 @@
+import diagnostics
 import utils
 
 from dataclasses import dataclass, field
 from collections import defaultdict
 from tabulate import tabulate
 from typing import Dict, Optional, List, Any
-from utils import print_marker, print_line, print_error
+from diagnostics import Fix
 
 
 predefined_identifiers = {
@@ -30,8 +31,8 @@ predefined_identifiers = {
     "complex64": 8,
     "complex128": 16,
 
-    # string
-    "string": None,
+    # string, pointer to the bytes and length
+    "string": 16,
 
     # for misc
     "byte": 1,
@@ -57,7 +58,14 @@ class SymbolInfo:
     const: bool = False
     const_flag: bool = False
     value: Any = None
+    # evaluated value, for constants (constant.Constant)
+    constant: Optional[Any] = None
     uses: list = field(default_factory=list)
+    # the file it is declared in
+    file: Optional[str] = None
+    # the symbols of the variable of a type switch, one for each clause,
+    # which is used if any of them is (see go_parser.p_TypeSwitchStmt)
+    group: Optional[list] = field(default=None, compare=False, repr=False)
 
 
 class SymbolTable:
@@ -66,6 +74,21 @@ class SymbolTable:
 
     def __init__(self):
         self.symbols: List[SymbolInfo] = []
+        self.reused: Dict[str, SymbolInfo] = {}
+        # the symbols by the id of their scope, in the order of symbols
+        self.scopes: Dict[str, List[SymbolInfo]] = defaultdict(list)
+        self.reset_depth()
+
+    def switch(self, symbols: List[SymbolInfo], reused: Optional[Dict[str, SymbolInfo]] = None):
+        """Makes symbols the symbols of the table, each package
+        has its own, see parse_package. The package level symbols added
+        afterwards are the ones of reused (by name) if it has them, the
+        nodes incremental.Tree keeps refer to them"""
+        self.symbols = symbols
+        self.reused = {} if reused is None else reused
+        self.scopes = defaultdict(list)
+        for symbol in symbols:
+            self.scopes[symbol.scope_id].append(symbol)
         self.reset_depth()
 
     def reset_depth(self):
@@ -79,9 +102,8 @@ class SymbolTable:
         self.scopes_at_depth[0] = 1
 
     def _add_cur_scope_symbols(self):
-        for symbol in self.symbols:
-            if symbol.scope_id == self.cur_scope:
-                self.stack[-1][symbol.name] = symbol
+        for symbol in self.scopes.get(self.cur_scope, ()):
+            self.stack[-1][symbol.name] = symbol
 
     def enter_scope(self):
         self.depth += 1
@@ -98,22 +120,33 @@ class SymbolTable:
         self.scopes_at_depth[self.depth + 2] = 0
         self.stack.pop()
 
+    def leave_scopes_to(self, depth: int):
+        """Leaves the scopes entered after the one at depth, like the
+        ones left open by a syntax error"""
+        while self.depth > depth:
+            self.leave_scope()
+
     def add_if_not_exists(self, symbol: str) -> SymbolInfo:
         if symbol in self.stack[-1]:
             return self.stack[-1][symbol]
 
-        new_symbol = SymbolInfo(symbol, self.cur_scope)
+        new_symbol = self.reused.pop(symbol, None) if self.depth == 1 else None
+        if new_symbol is None:
+            new_symbol = SymbolInfo(symbol, self.cur_scope)
 
         self.symbols.append(new_symbol)
+        self.scopes[new_symbol.scope_id].append(new_symbol)
         self.stack[-1][symbol] = new_symbol
 
         return new_symbol
 
     def remove_symbol(self, symbol: SymbolInfo):
         self.symbols.remove(symbol)
+        self.scopes[symbol.scope_id].remove(symbol)
         for symtab_ in reversed(self.stack):
-            if symbol in symtab_:
+            if symtab_.get(symbol.name) is symbol:
                 symtab_.pop(symbol.name)
+                break
 
     def get_symbol(self, symbol: str) -> Optional[SymbolInfo]:
         """Finds the symbol in the closest symtab
@@ -131,12 +164,14 @@ class SymbolTable:
         col_num=None,
         type_=None,
         const=None,
-        value=None
+        value=None,
+        constant=None
     ):
         sym = self.get_symbol(symbol)
         sym.lineno = lineno
         sym.type_ = None
         sym.col_num = col_num
+        sym.file = utils.filename
 
         if value is not None:
             sym.value = value
@@ -144,14 +179,17 @@ class SymbolTable:
         if const is not None:
             sym.const = const
 
+        if constant is not None:
+            sym.constant = constant
+
         # TODO: improve messages
         if type_ is not None:
             # TODO: use isinstance instead of hasattr
             if hasattr(type_, "storage"):
                 # every type has to have storage attribute
                 type_classes = [
-                    "BasicType", "ARRAY", "SLICE",
-                    "TypeDecl", "FUNCTION", "FUNCTION_TYPE"
+                    "BasicType", "ARRAY", "SLICE", "MAP", "CHAN", "STRUCT", "POINTER", "INTERFACE",
+                    "TypeDecl", "FUNCTION", "FUNCTION_TYPE", "TYPEPARAM"
                 ]
                 if type_.name in type_classes:
                     sym.type_ = type_
@@ -168,7 +206,7 @@ class SymbolTable:
 
             else:
                 err_msg = f"Could not determine type, issue in code. Found {type_}"
-                print_error(err_msg, kind="TYPE ERROR")
+                diagnostics.error(err_msg, lineno, kind="TYPE ERROR")
 
             if sym.type_ is None:
                 # TODO: improve error message
@@ -180,8 +218,7 @@ class SymbolTable:
                     typename = getattr(type_, attr, typename)
 
                 err_msg = f"Type '{typename}' is not defined at line {lineno}"
-                print_error(err_msg, "TYPE ERROR")
-                print_line(lineno)
+                diagnostics.error(err_msg, lineno, kind="TYPE ERROR", code="UndeclaredName")
 
                 # line = utils.lines[lineno]
                 # pos = line.find(typename)
@@ -212,66 +249,64 @@ class SymbolTable:
         type_=None,
         const=False,
         value=None,
+        constant=None,
     ):
         """Helper function to add symbol to the Symbol Table
         with declaration set to given line number.
 
-        Prints an error if the symbol is already declared at
-        current depth.
+        A symbol already declared at current depth is left as it is,
+        the redeclaration is reported by the type checker. The blank
+        identifier _ is never considered to be redeclared.
         """
-        if self.is_declared_in_cur_symtab(symbol):
-            print_error()
-            print(f"Re-declaration of symbol '{symbol}' at line {lineno}")
-            print_line(lineno)
-
-            pos = col_num - 1
-            width = len(symbol)
-            print_marker(pos, width)
-
-            other_sym = self.get_symbol(symbol)
-            print(f"{symbol} previously declared at line {other_sym.lineno}")
-            print_line(other_sym.lineno)
-
-            pos = other_sym.col_num - 1
-            print_marker(pos, width)
-        else:
+        if symbol == "_" or not self.is_declared_in_cur_symtab(symbol):
             self.update_info(
                 symbol,
                 lineno,
                 col_num=col_num,
                 type_=type_,
                 const=const,
-                value=value
+                value=value,
+                constant=constant
             )
 
-    def check_unused(self):
+    def unused_symbols(self) -> list:
+        """The local variables reported as declared and not used"""
+        unused = []
         for symbol in self.symbols:
             node_class = getattr(symbol.type_, "name", "")
+            if symbol.group is not None:
+                if symbol is not symbol.group[0] or any(s.uses for s in symbol.group):
+                    continue
             if (
                 symbol.uses == []
+                and symbol.name != "_"
                 and symbol.scope_id != "1"
+                # types, like type parameters, are not variables
+                and not hasattr(symbol.value, "storage")
                 and node_class not in [
-                    "FUNCTION", "BasicType", "TypeDecl"
+                    "FUNCTION", "BasicType", "TypeDecl", "TYPEPARAM"
                 ]
             ):
-                print_error("Unused variable", kind="ERROR")
-                print(
-                    f"Variable {symbol.name} is defined at line {symbol.lineno} "
-                    "but never used."
-                )
-                print_line(symbol.lineno)
+                unused.append(symbol)
+        return unused
 
-                pos = symbol.col_num - 1
-                width = len(symbol.name)
-                print_marker(pos, width)
+    def check_unused(self):
+        for symbol in self.unused_symbols():
+            width = len(symbol.name)
+            diagnostics.error(
+                f"declared and not used: {symbol.name}", symbol.lineno,
+                symbol.col_num, width, kind="ERROR", code="UnusedVar", file=symbol.file,
+                fix=Fix("use the blank identifier _", "_", symbol.lineno,
+                        symbol.col_num, width, symbol.file)
+            )
 
         if utils.package_name == "main":
             main_fn = self.get_symbol("main")
 
             if main_fn is None:
-                print_error("main is undeclared in package main", kind="ERROR")
-
-                print("main function is not declared in a file with 'main' package")
+                diagnostics.error(
+                    "main is undeclared in package main", kind="ERROR", code="MissingMain"
+                )
 
     def __str__(self):
         return str(
@@ -1,14 +1,50 @@
-import traceback
+import gc
+import constant
+import untyped
 
-from symbol_table import SymbolInfo
-from typing import Any, Optional, Tuple, Union
+from fileset import NoPos
+from symbol_table import SymbolInfo, predefined_identifiers
+from typing import Any, Callable, Dict, List, Optional, Tuple, Union
 from go_lexer import symtab
-from utils import (
-    print_error,
-    print_line,
-    print_line_marker_nowhitespace,
-    print_marker,
-)
+
+
+class Arena:
+    """The nodes made while it is active, in a with statement, for the tools
+    parsing many files (one arena for each): they are kept in a list of the
+    arena, the cyclic garbage collector doesn't walk the AST growing
+    meanwhile, and free releases all of them at once. The nodes made outside
+    of an arena are left to the garbage collector, like before"""
+
+    def __init__(self):
+        self.nodes: List["Node"] = []
+        self.outer: Optional[Arena] = None
+        self.collecting = False
+
+    def __enter__(self) -> "Arena":
+        global arena
+        self.outer, arena = arena, self
+        self.collecting = gc.isenabled()
+        gc.disable()
+        return self
+
+    def __exit__(self, *exc_info):
+        global arena
+        arena = self.outer
+        if self.collecting:
+            gc.enable()
+
+    def free(self):
+        """Releases the nodes of the arena, which can't be used afterwards:
+        their attributes are removed, so the cycles they are in (with their
+        parents, their symbols and their types) are broken, and they are
+        freed right away instead of by the garbage collector"""
+        for node in self.nodes:
+            node.__dict__.clear()
+        self.nodes.clear()
+
+
+# the arena the nodes made are added to, if any
+arena: Optional[Arena] = None
 
 
 class Node:
@@ -17,7 +53,17 @@ class Node:
     Warning: pls don't change the children values after setting them
     for nodes which depend on it"""
 
+    # the span of the source the parser made the node from, see fileset
+    pos = NoPos
+    end = NoPos
+    # the number of nodes made, the serial of a node is the count before it
+    count = 0
+
     def __init__(self, name, **kwargs):
+        self._serial = Node.count
+        Node.count += 1
+        if arena is not None:
+            arena.nodes.append(self)
         self.name = name
         self.children: list = [c for c in kwargs["children"] if c is not None]
         self.data = kwargs.get("data", None)
@@ -76,81 +122,41 @@ class BinOp(Node):
 
         self.type_: str = None
 
-        def get_type(expr: Node) -> str:
-            infered_type: Optional[str] = infer_expr_typename(expr)
-            if infered_type is None:
-                print(traceback.format_exc())
-                print_error(f"type inference failed on expression '{expr}: {type(expr)}'", kind="TYPE ERROR")
-
-            return infered_type
-
         def _unpack(lst: Node) -> Node:
             """unlists lst, if it is instance of List of length one
             """
             # an ugly patch, this will allow opportunity
             # for single assignment type checking
             expr: Node = lst
-            if isinstance(lst, List):
-                assert len(lst) == 1
+            if isinstance(lst, List) and len(lst) == 1:
                 [expr := e for e in lst]
             return expr
 
-        x = get_type(_unpack(left))
-        y = get_type(_unpack(right))
-
-        def check_type(x, y):
-            if x == "int":
-                if y == "float64":
-                    self.type_ = "float64"
-                    return 1
-
-            return 0
-
-        if x != y:
-            val1 = check_type(x, y)
-            val2 = check_type(y, x)
-            if ((not isinstance(self.children[0], Literal)
-                and not isinstance(self.children[1], Literal))
-                or not (val1 | val2)):
-                print_error(
-                    "Type Mismatch",
-                    kind="TYPE ERROR",
-                )
-                print(f"Cannot apply operation {self.operator}"
-                      f" on types '{x}' and '{y}'")
-                print_line_marker_nowhitespace(self.lineno)
-
-            if self.is_relop:
-                self.type_ = "bool"
-
-        else:
-            if self.is_relop:
-                self.type_ = "bool"
-
-            elif self.is_logical:
-                if x == "bool":
-                    self.type_ = "bool"
-                else:
-                    print_error("Invalid Operation", kind="Operation Error")
-
-            else:
-                self.type_ = x
+        left, right = _unpack(left), _unpack(right)
+        x = infer_expr_typename(left)
+        y = infer_expr_typename(right)
+
+        # mismatched types are reported by the type checker,
+        # this only infers the type of the result
+        if self.is_relop or self.is_logical:
+            self.type_ = "bool"
+        elif self.operator in ("<<", ">>") or x == y:
+            self.type_ = x
+        elif is_untyped_constant(left) and is_untyped_constant(right):
+            # the default type of the larger kind, like float64 for 1 + 2.5
+            kind = untyped.match(untyped.kind_of_default(x), untyped.kind_of_default(y))
+            if kind is not None:
+                self.type_ = untyped.default_typename(kind)
+        elif is_untyped_constant(left):
+            # an untyped constant takes the type of the other operand
+            self.type_ = y
+        elif is_untyped_constant(right):
+            self.type_ = x
 
 
 class Assignment(BinOp):
     """Node for assignment operations"""
 
-    def __init__(self, operator, left=None, right=None, lineno=None):
-        if isinstance(left, List) and len(left.children) == 1 and isinstance(left.children[0], PrimaryExpr):
-            left_ = left.children[0]
-            if left_.ident is not None:
-                if left_.ident.const:
-                    print_error("Constant assignment")
-                    print(f"Constant {left_.ident.name} cannot be assigned to")
-                    print_line_marker_nowhitespace(lineno)
-
-        super().__init__(operator, left, right, lineno)
-
 
 class UnaryOp(Node):
     """Node for unary operations"""
@@ -165,16 +171,23 @@ class UnaryOp(Node):
         self.type_ = None
         self.lineno = lineno
 
-        if hasattr(operand, "type_"):
-            self.type_ = operand.type_
+        if self.operator == "!":
+            self.type_ = "bool"
+        elif self.operator == "&":
+            # a pointer to the operand, like &x or &Point{1, 2}
+            base = infer_expr_type(operand)
+            self.type_ = Pointer(base) if base is not None else None
+        elif self.operator == "*":
+            # the variable pointed to
+            pointer = infer_expr_type(operand)
+            if pointer is not None and isinstance(pointer.underlying(), Pointer):
+                self.type_ = pointer.underlying().base
+        elif self.operator == "<-":
+            # the value received from a channel
+            chan = infer_expr_type(operand)
+            self.type_ = chan.underlying().eltype if is_chan(chan) else None
         else:
-            self.type_ = operand.data[0]
-
-        if self.type_ == "string":
-            print_error("Type Error", kind="Invalid Operation")
-
-        if self.operator == '!' and self.type_ != "bool":
-            print_error("Type Error", kind="Invalid Operation")
+            self.type_ = infer_expr_typename(operand)
 
 
 class PrimaryExpr(Node):
@@ -185,13 +198,12 @@ class PrimaryExpr(Node):
 
     def __init__(self, operand, lineno: int, children=None):
         # small optimization for the case when PrimaryExpr
-        # has children of [PrimaryExpr, something]
-        # with PrimaryExpr having only data and no children
+        # has children of [PrimaryExpr, something]. The chain is kept
+        # flat, like a[i].x has the operand a and children [Index, Selector]
         if operand is None and children is not None:
             if len(children) == 2 and isinstance(children[0], PrimaryExpr):
-                if children[0].children is None or children[0].children == []:
-                    operand = children[0].data
-                    children = children[1:]
+                operand = children[0].data
+                children = children[0].children + children[1:]
 
         super().__init__("PrimaryExpr",
                          children=[] if children is None else children,
@@ -206,7 +218,9 @@ class PrimaryExpr(Node):
 
     @property
     def col_no(self):
-        return self.operand[-1]
+        if isinstance(self.operand, tuple):
+            return self.operand[-1]
+        return getattr(self.children[0], "col_no", None)
 
     def data_str(self):
         # self.data can be an IDENTIFIER sometimes, so just show the name
@@ -219,7 +233,14 @@ class PrimaryExpr(Node):
 class Literal(Node):
     """Node to store literals"""
 
-    def __init__(self, type_, value, lineno: int):
+    def __init__(
+        self,
+        type_,
+        value,
+        lineno: int,
+        exact: Optional[str] = None,
+        col_num: Optional[int] = None,
+    ):
         children = []
         if isinstance(type_, Node):
             children.append(type_)
@@ -232,6 +253,10 @@ class Literal(Node):
         self.type_ = type_
         self.value = value
         self.lineno = lineno
+        # literal text of float, imaginary and rune literals (and raw
+        # strings), to evaluate constants exactly and for messages
+        self.exact = exact
+        self.col_num = col_num
 
     def data_str(self):
         return f"type: {self.type_}, value: {self.value}"
@@ -243,6 +268,10 @@ class Literal(Node):
 class Import(Node):
     """Node to store imports"""
 
+    # its doc and line comments, see attach_comments
+    doc: Optional["CommentGroup"] = None
+    comment: Optional["CommentGroup"] = None
+
     def __init__(self, pkg_name, import_path):
         # import_path is a STRING_LIT, so it has ("string", value)
         super().__init__("import", children=[], data=(pkg_name, import_path))
@@ -251,6 +280,177 @@ class Import(Node):
         return f"name: {self.data[0]}, path: {self.data[1][1]}"
 
 
+class File(Node):
+    """Node for a source file of a package, its children are the
+    imports and the top level declarations"""
+
+    def __init__(self, filename: str, imports, decls):
+        super().__init__("FILE", children=[imports, decls], data=filename)
+        self.filename = filename
+        # the CommentGroups of the file, in order
+        self.comments: list = []
+
+
+class CommentGroup:
+    """Comments with only blanks and a line break between them, like the
+    ones of go/ast. comments are (pos, text), the lines are the ones of the
+    first and the last comment. A group is the doc comment of the declaration
+    (or field) after it if it is on the lines right before it, and a line
+    comment of the one before it if it is after it on its last line"""
+
+    def __init__(self, comments: list, first_line: int, last_line: int, after_token: bool):
+        self.comments = comments
+        self.first_line = first_line
+        self.last_line = last_line
+        # if a token is before it on its first line
+        self.after_token = after_token
+        self.is_line_comment = False
+        self.is_lead_comment = False
+        self.pos = comments[0][0]
+        self.end = comments[-1][0] + len(comments[-1][1])
+        # the end of the token before it and the position of the one after it
+        self.prev_end = NoPos
+        self.next_token = NoPos
+
+    def text(self) -> str:
+        """The text of the comments, without their markers and the
+        directives (like //go:generate), like go/ast CommentGroup.Text"""
+        lines = []
+        for _, text in self.comments:
+            if text[1] == "/":
+                text = text[2:]
+                if text.startswith(" "):
+                    text = text[1:]
+                elif is_directive(text):
+                    continue
+            else:
+                text = text[2:-2]
+            lines.extend(line.rstrip(" \t") for line in text.split("\n"))
+        # no blank lines before the text, one between its paragraphs
+        kept = []
+        for line in lines:
+            if line or kept and kept[-1]:
+                kept.append(line)
+        if kept and kept[-1]:
+            kept.append("")
+        return "\n".join(kept)
+
+    def __repr__(self):
+        return f"CommentGroup({self.text()!r})"
+
+
+def is_directive(text: str) -> bool:
+    """If a //-style comment (without the //) is a directive, like go:generate"""
+    if text.startswith(("line ", "extern ", "export ")):
+        return True
+    colon = text.find(":")
+    if colon <= 0 or colon + 1 >= len(text):
+        return False
+    return all(i == colon or "a" <= text[i] <= "z" or "0" <= text[i] <= "9" for i in range(colon + 2))
+
+
+def comment_groups(comments: list, file, source: str) -> list:
+    """The CommentGroups of the comments (pos, text) of a file, like the
+    ones of go/parser: a group after a token on the same line ends on it"""
+    comments = [(pos, text.replace("\r", "")) for pos, text in comments]
+    starts = {file.offset(pos) + len(text): file.offset(pos) for pos, text in comments}
+    ends = {file.offset(pos): file.offset(pos) + len(text) for pos, text in comments}
+
+    def _line(offset: int) -> int:
+        return file.position(file.pos(offset)).line
+
+    def _token_before(offset: int) -> int:
+        # the offset of the last character of the token before offset, -1 if none
+        i = offset - 1
+        while i >= 0:
+            if source[i] in " \t\r\n":
+                i -= 1
+            elif i + 1 in starts:
+                i = starts[i + 1] - 1
+            else:
+                return i
+        return -1
+
+    def _next_token(offset: int) -> int:
+        # the offset of the token after offset, past all comments
+        i = offset
+        while i < len(source):
+            if source[i] in " \t\r\n":
+                i += 1
+            elif i in ends:
+                i = ends[i]
+            else:
+                return i
+        return len(source)
+
+    groups = []
+    i = 0
+    while i < len(comments):
+        offset = file.offset(comments[i][0])
+        before = _token_before(offset)
+        after_token = before >= 0 and _line(before) == _line(offset)
+        # a group after a token is on its line, the others can span lines
+        n = 0 if after_token else 1
+        group = [comments[i]]
+        end_line = _line(offset + len(comments[i][1]))
+        i += 1
+        while i < len(comments):
+            start = file.offset(comments[i][0])
+            between = source[file.offset(group[-1][0]) + len(group[-1][1]):start]
+            if between.strip() or _line(start) > end_line + n:
+                break
+            group.append(comments[i])
+            end_line = _line(start + len(comments[i][1]))
+            i += 1
+        g = CommentGroup(group, _line(offset), end_line, after_token)
+        last = group[-1]
+        next_token = _next_token(file.offset(last[0]) + len(last[1]))
+        g.is_line_comment = after_token and (
+            next_token >= len(source) or _line(next_token) != end_line or source[next_token] == ";"
+        )
+        g.is_lead_comment = not after_token and next_token < len(source) and _line(next_token) == end_line + 1
+        if before >= 0:
+            g.prev_end = file.pos(before + 1)
+        g.next_token = file.pos(next_token)
+        groups.append(g)
+    return groups
+
+
+def attach_comments(groups: list, nodes: list):
+    """Sets the doc comments of the declarations and the fields (or specs)
+    in nodes, and the line comments of the fields and the specs"""
+    docs = {g.next_token: g for g in groups if g.is_lead_comment}
+    line_comments = {g.prev_end: g for g in groups if g.is_line_comment}
+    for node in nodes:
+        if node.pos == NoPos:
+            continue
+        if node.pos in docs:
+            node.doc = docs[node.pos]
+        if not isinstance(node, (Function, DeclGroup)) and node.end in line_comments:
+            node.comment = line_comments[node.end]
+
+
+def doc_comment(node) -> Optional[CommentGroup]:
+    """The doc comment of a declaration, the one of its spec or of the
+    declaration it is in (like the one of var x int for x)"""
+    for n in (node, getattr(node, "_spec", None), getattr(node, "_group", None)):
+        if getattr(n, "doc", None) is not None:
+            return n.doc
+    return None
+
+
+class Package(Node):
+    """An imported package, its package level symbols are its members"""
+
+    def __init__(self, name: str, path: str, members: Dict[str, SymbolInfo]):
+        super().__init__("PACKAGE", children=[], data=name)
+        self.path = path
+        self.members = members
+
+    def __str__(self) -> str:
+        return f"<package {self.data}>"
+
+
 class List(Node):
     """Node to store literals"""
 
@@ -265,12 +465,60 @@ class List(Node):
         return len(self.children)
 
 
+class LiteralValue(List):
+    """Node for the elements of a composite literal, like {1, 2}
+
+    Like other Lists, elements are stored in reverse order. An element
+    can be a LiteralValue itself, when its type is elided"""
+
+    def __init__(self, element_list: Optional[List], lineno: int):
+        super().__init__([] if element_list is None else element_list.children)
+        self.name = "LITERAL_VALUE"
+        self.lineno = lineno
+
+
+class KeyedElement(Node):
+    """Node for an element with a key (a field name or an index)
+    in a composite literal, like x: 1"""
+
+    def __init__(self, key, value, lineno: int):
+        super().__init__("KEYED_ELEMENT", children=[key, value])
+        self.key = key
+        self.value = value
+        self.lineno = lineno
+
+        # signal the AST optimizer to not optimize these children
+        self._no_optim = True
+
+
+class Block(List):
+    """Node for a block of statements, which has a scope of its own
+
+    Like other Lists, statements are stored in reverse order"""
+
+    def __init__(self, statement_list: Optional[List]):
+        super().__init__([] if statement_list is None else statement_list.children)
+        self.name = "BLOCK"
+
+
 class Arguments(Node):
-    """Node to store function arguments"""
+    """Node to store function arguments
 
-    def __init__(self, expression_list):
-        super().__init__("arguments", children=[expression_list])
+    type_ is the type given as the first argument of
+    a builtin, like the []int in make([]int, n). ellipsis is
+    set if the last argument is spread, like s in f(s...)"""
+
+    def __init__(self, expression_list, type_=None, ellipsis=False):
+        super().__init__("arguments", children=[type_, expression_list])
         self.expression_list = expression_list
+        self.type_ = type_
+        self.ellipsis = ellipsis
+
+    def expressions(self) -> list:
+        """The arguments (other than type_) in order"""
+        if self.expression_list is None:
+            return []
+        return list(reversed(self.expression_list.children))
 
 
 class FunctionCall(Node):
@@ -279,66 +527,137 @@ class FunctionCall(Node):
     Is a part of PrimaryExpr in the grammar, but separated here"""
 
     def __init__(self, fn_name: Any, arguments: Arguments):
-        pos = fn_name.lineno, fn_name.col_no
+        # a function literal called, like func() {...}(), has no col_no, nor
+        # has a type literal converted to, like []byte(s), a lineno
+        self.lineno = getattr(fn_name, "lineno", None)
+        self.col_no = getattr(fn_name, "col_no", None)
+
+        # the type arguments of an explicit instantiation, like Max[int](a, b)
+        self.type_arg_exprs: list = []
+        if (isinstance(fn_name, PrimaryExpr) and isinstance(fn_name.data, tuple)
+                and len(fn_name.children) == 1 and isinstance(fn_name.children[0], Index)
+                and is_generic_function(fn_name.data[1])):
+            index = fn_name.children[0]
+            exprs = index.expr.children if isinstance(index.expr, List) else [index.expr]
+            # Lists are in reverse order
+            self.type_arg_exprs = list(reversed(exprs))
+            fn_name = PrimaryExpr(fn_name.data, fn_name.lineno)
 
         if (isinstance(fn_name, PrimaryExpr) and
                 isinstance(fn_name.data, tuple) and
-                fn_name.data[0] == "identifier"):
+                fn_name.data[0] == "identifier" and
+                not fn_name.children):
             fn_name = str(fn_name.data[1])
 
         self.fn_name = fn_name
         self.arguments = arguments
-        expression_list = arguments.expression_list
-        if expression_list is None:
-            expression_list = []
-
-        self.fn_sym = symtab.get_symbol(str(fn_name))
-        if self.fn_sym is not None:
-            parameters = self.fn_sym.type_.signature.parameters
-            param_decls = []  # list of types in declared order
-            for para in parameters:
-                para_list: List[VarDecl] = [
-                    decl for decl in para.var_decl
-                ]
-                para_list.reverse()
-                param_decls.extend(para_list)
-
-            expected_count = len(param_decls)
-            recieved_count = len(expression_list)
-            if recieved_count != expected_count:
-                print_error("Arguments Number Mismatch Declaration", kind="TYPE ERROR")
-                tense = "were" if recieved_count > 1 else "was"
-                err_msg = (f"{fn_name}() takes {expected_count} arguments"
-                           f" but {recieved_count} {tense} given")
-                print_func_err(pos, len(fn_name), err_msg)
-            else:
-                param_decls.reverse()  # to match order of expression_list
-                for arg, param_decl in zip(expression_list, param_decls):
-                    arg_type = infer_expr_typename(arg)
-                    data = arg.data
-                    para_type = param_decl.symbol.type_.typename
-                    if arg_type != para_type:
-                        print_error("Arguments Type Mismatch Declaration", kind="TYPE ERROR")
-                        exp = data
-                        if isinstance(data, tuple):
-                            exp = data[1]
-                        err_msg_call = (f"{exp} has type {arg_type}")
-                        err_msg_decl = f"but function wanted {para_type}"
-                        print_func_err(
-                            pos,
-                            len(fn_name),
-                            err_msg_call,
-                            err_msg_decl,
-                            param_decl.ident
-                        )
+        # the type arguments of a generic function, for each of its type
+        # parameters, set by the type checker (explicit or inferred)
+        self.type_args: list = []
 
+        # arguments are checked against the signature by the type checker
+        if isinstance(fn_name, QualifiedIdent):
+            self.fn_sym = fn_name.symbol
+        else:
+            self.fn_sym = symtab.get_symbol(str(fn_name))
         self.type_ = None
         if self.fn_sym is not None:
-            if self.fn_sym.value is not None:
+            if isinstance(self.fn_sym.value, Function):
                 self.type_ = self.fn_sym.value.signature.ret_type
+        elif self.is_builtin:
+            result = builtin_result_type(self)
+            self.type_ = getattr(result, "typename", None)
+
+        # a call of a method, like p.area(). The receiver is p, or the
+        # type for a method expression like Point.area(p)
+        self.receiver = None
+        self.method: Optional[Method] = None
+        # the embedded fields of the receiver a promoted method is of
+        self.method_path: list = []
+        if (isinstance(fn_name, PrimaryExpr) and fn_name.children
+                and isinstance(fn_name.children[-1], Selector)):
+            self.receiver = selector_operand(fn_name)
+            self.resolve_method()
 
         super().__init__("FunctionCall", children=[arguments], data=fn_name)
 
+    @property
+    def is_builtin(self) -> bool:
+        """If a builtin function is called, they can be shadowed by declarations"""
+        return isinstance(self.fn_name, str) and self.fn_name in builtins and self.fn_sym is None
+
+    @property
+    def is_method_expr(self) -> bool:
+        return (isinstance(self.receiver, PrimaryExpr)
+                and isinstance(self.receiver.data, tuple)
+                and not self.receiver.children
+                and self.receiver.ident is not None
+                and isinstance(self.receiver.ident.value, Type))
+
+    def resolve_method(self):
+        """Finds the called method, it could be declared after the call"""
+        if self.is_method_expr:
+            type_ = self.receiver.ident.value
+        else:
+            type_ = infer_expr_type(self.receiver)
+        name = self.fn_name.children[-1].field_name
+        method, path = lookup_field_or_method(type_, name)
+        if isinstance(method, (Method, InterfaceMethod)):
+            self.method, self.method_path = method, path
+        else:
+            # the methods of a type parameter are the ones of its constraint
+            self.method, self.method_path = find_method(type_, name), []
+        if self.method is not None:
+            self.type_ = self.method.signature.ret_type
+
+    def type_mapping(self) -> dict:
+        """The type arguments of the call of a generic function,
+        or of a method of an instance of a generic type, like
+        s.Push(v) for s of type Stack[int], by type parameter"""
+        if self.method is not None and self.receiver is not None:
+            type_ = self.receiver.ident.value if self.is_method_expr else \
+                    infer_expr_type(self.receiver)
+            if self.method_path:
+                type_ = self.method_path[-1].type_
+            return method_mapping(self.method, type_)
+        fn_sym = self.fn_sym or symtab.get_symbol(str(self.fn_name))
+        if self.type_args and fn_sym is not None and isinstance(fn_sym.value, Function):
+            return dict(zip(fn_sym.value.signature.type_params, self.type_args))
+        return {}
+
+    def callee(self) -> Optional[SymbolInfo]:
+        """The symbol of the function called, if it is called by name"""
+        if isinstance(self.fn_name, QualifiedIdent):
+            return self.fn_name.symbol
+        return symtab.get_symbol(self.fn_name)
+
+    def conversion_type(self) -> Optional["Type"]:
+        """The type converted to if the call is a conversion, like the
+        float64 of float64(x), []byte(s) or (*T)(p)"""
+        fn = self.fn_name
+        if isinstance(fn, Type):
+            return fn
+        if isinstance(fn, UnaryOp) and fn.operator == "*":
+            base = fn.operand
+            sym = base.ident if isinstance(base, PrimaryExpr) and not base.children else None
+            if sym is not None and isinstance(sym.value, Type):
+                return Pointer(sym.value)
+            return base.type_ if isinstance(base, Type) else None
+        if self.fn_sym is not None and isinstance(self.fn_sym.value, Type):
+            return self.fn_sym.value
+        return None
+
+    def function_type(self) -> Optional["FunctionType"]:
+        """The type of the function value called, like the one of
+        a variable f for f(x) or of a function literal called"""
+        if isinstance(self.fn_name, (str, QualifiedIdent)):
+            sym = self.callee()
+            t = sym.type_ if sym is not None else None
+        else:
+            t = infer_expr_type(self.fn_name)
+        t = t.underlying() if isinstance(t, Type) else None
+        return t if isinstance(t, FunctionType) else None
+
     @staticmethod
     def get_fn_name(fn_name) -> str:
         if isinstance(fn_name, QualifiedIdent):
@@ -357,24 +676,6 @@ class FunctionCall(Node):
             return self.fn_name.data_str()
         return self.fn_name
 
-def print_func_err(
-    pos: Tuple[int, int],
-    width: int,
-    err_msg_call: str,
-    err_msg_decl: Optional[str] = None,
-    param_ident: Optional[Identifier] = None
-):
-    line_no = pos[0]
-    col_no = pos[1]
-    print(err_msg_call)
-    print_line(line_no)
-    print_marker(col_no - 1, width)
-    if param_ident is not None:
-        print(err_msg_decl)
-        print_line(param_ident.lineno)
-        print_marker(param_ident.col_num - 1, len(param_ident.ident_name))
-
-
 class Signature(Node):
     """Node to store function signature"""
 
@@ -384,14 +685,60 @@ class Signature(Node):
 
         self.ret_type = None
         if self.result is not None:
-            self.ret_type = infer_expr_typename(self.result)
+            self.ret_type = FunctionType.get_ret_typename(self)
+        # TypeParams of a generic function, in order
+        self.type_params: list = []
 
         super().__init__("signature", children=[parameters, result])
 
+    @property
+    def has_named_results(self) -> bool:
+        return (isinstance(self.result, List) and len(self.result) > 0
+                and self.result.children[0].ident_list is not None)
+
+    @property
+    def parameter_types(self) -> list:
+        """Types of the parameters, one per parameter, the
+        variadic one is a slice"""
+        types = []
+        for para in self.parameters or []:
+            if para.vararg:
+                types.append(Slice(para.type_) if para.type_ is not None else None)
+                continue
+            count = 1 if para.ident_list is None else len(para.ident_list)
+            types.extend([para.type_] * count)
+        return types
+
+    @property
+    def variadic(self) -> bool:
+        return any(para.vararg for para in self.parameters or [])
+
+    @property
+    def result_types(self) -> list:
+        """Types of the results, one per result"""
+        if self.result is None:
+            return []
+        if not isinstance(self.result, List):
+            return [self.result]
+
+        types = []
+        for para in self.result:
+            count = 1 if para.ident_list is None else len(para.ident_list)
+            types.extend([para.type_] * count)
+        return types
+
+
+# the name of the package being parsed if it is imported by another one,
+# None for the package of the program. See parse_package
+imported_package: Optional[str] = None
+
 
 class Function(Node):
     """Node to store function declaration"""
 
+    # its doc comment, see attach_comments
+    doc: Optional[CommentGroup] = None
+
     def __init__(self, name: Optional[tuple], signature, lineno: int, body=None):
         super().__init__("FUNCTION",
                          children=[signature, body],
@@ -402,6 +749,12 @@ class Function(Node):
         self.lineno = lineno
         self.signature = signature
         self.body = body
+        # the labels of the functions of imported packages have
+        # the name of the package, like geometry__Area
+        self.label_prefix = "" if imported_package is None else f"{imported_package}__"
+        # the scope of the parameters of a function literal, the
+        # variables it declares are in it (or in scopes under it)
+        self.scope: Optional[str] = None
 
         if name is not None:
             symtab.update_info(name[1],
@@ -414,8 +767,14 @@ class Function(Node):
     def __str__(self) -> str:
         func_typename: str = FunctionType.get_func_typename(self.signature)
         para_list: str = func_typename[4:]
+        if self.fn_name is None:
+            return f"func{para_list} {{...}}"
         return f"func {self.fn_name[1]}{para_list} {{...}}"
 
+    @property
+    def label_name(self) -> str:
+        return self.label_prefix + FunctionCall.get_fn_name(self.fn_name)
+
     @staticmethod
     def add_func_to_symtab(name, lineno, value=None):
         sig = Signature(List([]))
@@ -430,13 +789,75 @@ class Function(Node):
         return f"name: {self.fn_name}, lineno: {self.lineno}"
 
 
+class Method(Function):
+    """Node to store method declaration
+
+    The receiver is a list of ParameterDecls like the parameters, the
+    type checker reports if there isn't exactly one receiver"""
+
+    def __init__(self, receiver, name: tuple, signature, lineno: int, body=None):
+        # methods are not in the symbol table, they are
+        # found through the type of the receiver
+        super().__init__(None, signature, lineno, body=body)
+        self.fn_name = name
+        self.data = (name, lineno)
+        self.receiver = receiver
+        self.children.insert(0, receiver)
+
+        self.receiver_type: Optional[Type] = None
+        params = list(receiver)
+        if len(params) == 1 and isinstance(params[0].type_, Type):
+            self.receiver_type = params[0].type_
+
+        # the type the method belongs to, T for receivers of type T or *T
+        self.base_type = self.receiver_type
+        self.pointer_receiver = isinstance(self.receiver_type, Pointer)
+        if self.pointer_receiver:
+            self.base_type = self.receiver_type.base
+
+        # the type parameters of the receiver of a method of a generic type,
+        # like the T of (s *Stack[T]), it is an instance of the generic type
+        self.type_params: list = []
+        if isinstance(self.base_type, NamedType) and self.base_type.origin is not None:
+            self.type_params = self.base_type.type_args
+            self.base_type = self.base_type.origin
+
+        if isinstance(self.base_type, NamedType):
+            self.base_type.add_method(self)
+
+    def __str__(self) -> str:
+        func_typename: str = FunctionType.get_func_typename(self.signature)
+        receiver = getattr(self.receiver_type, "typename", "")
+        return f"func ({receiver}) {self.fn_name[1]}{func_typename[4:]} {{...}}"
+
+    @property
+    def label_name(self) -> str:
+        # methods of different types can have the same name
+        typename = getattr(self.base_type, "typename", None)
+        if typename is None:
+            return self.label_prefix + self.fn_name[1]
+        return f"{self.label_prefix}{typename}__{self.fn_name[1]}"
+
+    def expr_signature(self, type_: Optional["Type"] = None) -> Signature:
+        """Signature of the method expression T.m, the receiver is the first
+        parameter. type_ is T if the method is promoted to it"""
+        parameters = List([ParameterDecl(type_ or self.receiver_type)])
+        for para in self.signature.parameters:
+            parameters.append(para)
+        return Signature(parameters, self.signature.result)
+
+
 class Keyword(Node):
-    """Node to store a single keyword - like return, break, continue, etc."""
+    """Node to store a single keyword - like return, break, continue, etc.
+
+    ext is the identifier tuple of the label of a break, a continue or a
+    goto statement, label its Identifier"""
 
     def __init__(self, kw, ext=None, children=None, lineno=None):
         self.kw = kw
         self.ext = ext if ext is not None else ()
         self.lineno = lineno
+        self.label: Optional[Identifier] = Identifier(ext, lineno) if ext else None
         children = [] if children is None else children
 
         super().__init__(kw, children=children, data=(kw, *self.ext))
@@ -445,6 +866,22 @@ class Keyword(Node):
         return ""
 
 
+class LabeledStmt(Node):
+    """Node for a labeled statement, like outer: for {...}
+
+    stmt is None for an empty statement, the label is in the scope of
+    the labels of the function"""
+
+    def __init__(self, label: Identifier, stmt, lineno: int):
+        super().__init__("LABELED", children=[stmt] if stmt is not None else [])
+        self.label = label
+        self.stmt = stmt
+        self.lineno = lineno
+
+    def data_str(self):
+        return f"label: {self.label.ident_name}"
+
+
 class Type(Node):
     """Parent class for all types"""
 
@@ -467,6 +904,475 @@ class Type(Node):
     def __str__(self):
         return f"<{self.typename}>"
 
+    def underlying(self) -> "Type":
+        """The type of a type declaration (TypeDecl), the type itself otherwise"""
+        t = self
+        while t.name == "TypeDecl" and t.children:
+            t = t.children[0]
+        return t
+
+
+class NamedType(Type):
+    """Node for a type declared with a name, like type Point struct{...}
+
+    The method set of the type has the methods with value receivers,
+    the one of a pointer to it has all of them.
+    Ref: https://golang.org/ref/spec#Method_sets
+    """
+
+    def __init__(self, typename: str, type_: Optional[Type] = None):
+        # in the declared order, the first one is kept for duplicates
+        self.methods: Dict[str, Method] = {}
+        # TypeParams of a generic type, like the T of type List[T any] ...
+        self.type_params: list = []
+        # the generic type and the type arguments of an instance of it,
+        # like List and [int] for List[int]. Instances by type arguments
+        self.origin: Optional[NamedType] = None
+        self.type_args: list = []
+        self.instances: Dict[str, NamedType] = {}
+        # the name of its package, if it is declared in an imported one
+        self.package = imported_package
+        # the type in its declaration, and the position of its name
+        self.definition = type_
+        self.lineno: Optional[int] = None
+        self.col_num: Optional[int] = None
+        storage = type_.storage if type_ is not None else None
+        super().__init__("TypeDecl", typename, storage=storage, children=[type_])
+
+    def define(self, type_: Type):
+        """Sets the type of a type declared before its definition, which
+        can refer to it, like type Node struct { next *Node }"""
+        self.definition = type_
+        if type_ is None or cycle_path(self) is not None:
+            # like type T T or type T struct{ t T }, it has no underlying
+            # type (the type checker reports the cycle), nor has a type
+            # defined with one which isn't a type
+            return
+        self.children = [type_]
+        self.storage = getattr(type_, "storage", None)
+
+    def add_method(self, method: "Method"):
+        if method.fn_name[1] not in self.methods:
+            self.methods[method.fn_name[1]] = method
+
+    def method_set(self, pointer: bool = False) -> list:
+        """Methods of the type, or of a pointer to it"""
+        methods = self.methods if self.origin is None else self.origin.methods
+        return [m for m in methods.values() if pointer or not m.pointer_receiver]
+
+    def instantiate(self, type_args: list) -> "NamedType":
+        """The instance of the generic type with the type arguments, which
+        are the same type for the same type arguments. The generic type
+        itself is the instance with its type parameters, like the
+        List[T] of a next *List[T] field of List"""
+        if all(arg is param for arg, param in zip(type_args, self.type_params)):
+            return self
+        typenames = ", ".join(arg.typename for arg in type_args)
+        # type parameters are told apart by identity, they can have the same name
+        key = typenames + "".join(f"#{id(t)}" for t in type_params_in(type_args))
+        if key not in self.instances:
+            instance = NamedType(f"{self.typename}[{typenames}]")
+            instance.origin = self
+            instance.type_args = list(type_args)
+            instance.package = self.package
+            # added first, the definition can refer to the instance
+            self.instances[key] = instance
+            if self.children:
+                mapping = dict(zip(self.type_params, type_args))
+                instance.define(substitute(self.children[0], mapping))
+        return self.instances[key]
+
+
+def cycle_path(t: "NamedType") -> Optional[list]:
+    """The named types t is made of up to itself, like [A, B] for type A B
+    and type B struct{ a A }: in its definition, the types of its fields and
+    the elements of its arrays (not through pointers, slices or maps, which
+    refer to other values). None if it isn't made of itself"""
+    def walk(u, path: list) -> Optional[list]:
+        if isinstance(u, NamedType):
+            if u is t:
+                return path
+            if any(u is v for v in path):
+                return None
+            return walk(u.definition, path + [u])
+        elif isinstance(u, Array):
+            return walk(u.eltype, path)
+        elif isinstance(u, Struct):
+            for field in u.fields:
+                found = walk(field.type_, path)
+                if found is not None:
+                    return found
+        return None
+
+    return walk(t.definition, [t])
+
+
+class Pointer(Type):
+    """Node for a pointer type"""
+
+    def __init__(self, base: Type):
+        self.base = base
+        typename = f"POINTER_{getattr(base, 'typename', 'unknown')}"
+        super().__init__("POINTER", typename, storage=8)
+
+    def data_str(self):
+        return f"base: {getattr(self.base, 'typename', None)}"
+
+
+class Interface(Type):
+    """Node for an interface type, methods are in the declared order
+    followed by the ones of the embedded interfaces
+
+    A value of an interface type is the dynamic type of
+    the value along with the value
+    Ref: https://golang.org/ref/spec#Interface_types
+    """
+
+    def __init__(self, elements: list, alias: Optional[str] = None):
+        # the methods declared in the interface, all of them are in methods
+        self.own_methods: list = []
+        # embedded types, (Identifier, Type). Interfaces if valid
+        self.embedded: list = []
+        # the type set of a constraint, (tilde, type) terms of the types
+        # in all its unions (None for any type), and if the types have
+        # to be comparable. Ref: https://go.dev/ref/spec#General_interfaces
+        self.terms: Optional[list] = None
+        self.comparable = alias == "comparable"
+        for element in elements:
+            if isinstance(element, InterfaceMethod):
+                self.own_methods.append(element)
+            elif isinstance(element, TypeUnion):
+                self.terms = intersect_terms(self.terms, element.terms)
+            elif isinstance(element, Type):
+                # a single type, like the int of [T int]
+                self.terms = intersect_terms(self.terms, [(False, element)])
+            elif isinstance(element, tuple) and isinstance(element[1], Type):
+                if is_interface(element[1]):
+                    self.embedded.append(element)
+                    embedded = element[1].underlying()
+                    self.terms = intersect_terms(self.terms, embedded.terms)
+                    self.comparable = self.comparable or embedded.comparable
+                else:
+                    self.terms = intersect_terms(self.terms, [(False, element[1])])
+
+        self.methods: list = []
+        for method in self.own_methods:
+            if self.method(method.m_name) is None:
+                self.methods.append(method)
+        for _, t in self.embedded:
+            t = t.underlying()
+            if isinstance(t, Interface):
+                # the same method can come from more than one
+                # embedded interface, the type checker reports
+                # it if the signatures are different
+                self.methods.extend(m for m in t.methods if self.method(m.m_name) is None)
+
+        # the name of a predeclared alias, like any
+        self.alias = alias
+        # the elements as they are written, for printing them back
+        self._elements = elements
+
+        method_strs = [f"{m.m_name}{m.typename[4:]}" for m in self.methods]
+        if self.terms is not None:
+            method_strs.append(TypeUnion(self.terms).typename[6:])
+        if self.comparable:
+            method_strs.append("comparable")
+        typename = f"INTERFACE_{{{'; '.join(method_strs)}}}"
+        # the type and the value (or a pointer to it)
+        super().__init__("INTERFACE", typename, storage=16, children=self.methods)
+
+    def method(self, name: str) -> Optional["InterfaceMethod"]:
+        for method in self.methods:
+            if method.m_name == name:
+                return method
+        return None
+
+    @property
+    def is_constraint(self) -> bool:
+        """If the interface can only be used as a constraint, it has a
+        type set other than the types implementing its methods"""
+        return self.terms is not None or self.comparable
+
+
+class TypeUnion(Type):
+    """Node for a union of types in a constraint, like ~int | float64.
+    terms are (tilde, type), ~T is any type whose underlying type is T"""
+
+    def __init__(self, terms: list):
+        self.terms: list = []
+        for tilde, t in terms:
+            if is_interface(t) and t.underlying().terms is not None:
+                # a union of constraints is the union of their type sets
+                self.terms.extend(t.underlying().terms)
+            elif t is not None:
+                self.terms.append((tilde, t))
+        typename = " | ".join(("~" if tilde else "") + t.typename for tilde, t in self.terms)
+        super().__init__("UNION", f"UNION_{typename}")
+
+
+def intersect_terms(x: Optional[list], y: Optional[list]) -> Optional[list]:
+    """Terms of the types in both the type sets x and y, None is any type"""
+    if x is None or y is None:
+        return y if x is None else x
+
+    def _includes(terms: list, term: tuple) -> bool:
+        tilde, t = term
+        for other_tilde, other in terms:
+            if other_tilde and t.underlying().typename == other.typename:
+                return True
+            if (other_tilde or not tilde) and t.typename == other.typename:
+                return True
+        return False
+    return [term for term in x if _includes(y, term)]
+
+
+class TypeParam(Type):
+    """Node for a type parameter of a generic function or type, like the
+    T of func Max[T Number](a, b T) T. Its constraint is an interface,
+    the types in its type set are the ones it can be instantiated with
+
+    There is no code for generic functions, they are generated once for
+    each instantiation, with the type arguments substituted"""
+
+    def __init__(self, name: str, constraint: Optional[Type], lineno: int, col_num: int):
+        self.constraint = constraint
+        self.lineno = lineno
+        self.col_num = col_num
+        super().__init__("TYPEPARAM", name)
+
+    def data_str(self):
+        return f"name: {self.typename}"
+
+
+def is_generic_function(name: str) -> bool:
+    """If name is the name of a generic function, or of a function
+    which is not declared yet (it could be declared after it is used)"""
+    sym = symtab.get_symbol(name)
+    if sym is None:
+        return True
+    return isinstance(sym.value, Function) and bool(sym.value.signature.type_params)
+
+
+def type_params_in(t: Any) -> list:
+    """The type parameters the type t (or a list of types) depends
+    on, like the T of []T. A generic type depends on its own"""
+    if isinstance(t, list):
+        return [p for type_ in t for p in type_params_in(type_)]
+    if isinstance(t, TypeParam):
+        return [t]
+    if isinstance(t, NamedType):
+        return t.type_params if t.origin is None else type_params_in(t.type_args)
+    if isinstance(t, (Array, Slice, Chan)):
+        return type_params_in(t.eltype)
+    if isinstance(t, Map):
+        return type_params_in([t.key, t.eltype])
+    if isinstance(t, Pointer):
+        return type_params_in(t.base)
+    if isinstance(t, FunctionType):
+        signature = t.signature
+        return type_params_in([para.type_ for para in signature.parameters]
+                              + signature.result_types)
+    if isinstance(t, Struct):
+        return type_params_in([f.type_ for f in t.fields])
+    return []
+
+
+def has_type_params(t: Any) -> bool:
+    """If the type t depends on a type parameter, like []T"""
+    return bool(type_params_in(t))
+
+
+def substitute(t: Any, mapping: dict) -> Any:
+    """The type t with the type parameters in mapping replaced by their
+    type arguments, like []int for []T with T int"""
+    if not mapping or not has_type_params(t):
+        return t
+    if isinstance(t, TypeParam):
+        return mapping.get(t, t)
+    if isinstance(t, NamedType):
+        generic = t if t.origin is None else t.origin
+        type_args = t.type_params if t.origin is None else t.type_args
+        return generic.instantiate([substitute(arg, mapping) for arg in type_args])
+    if isinstance(t, Array):
+        return Array(substitute(t.eltype, mapping), t.length)
+    if isinstance(t, Slice):
+        return Slice(substitute(t.eltype, mapping))
+    if isinstance(t, Map):
+        return Map(substitute(t.key, mapping), substitute(t.eltype, mapping), t.lineno)
+    if isinstance(t, Chan):
+        return Chan(substitute(t.eltype, mapping), t.dir, t.lineno)
+    if isinstance(t, Pointer):
+        return Pointer(substitute(t.base, mapping))
+    if isinstance(t, FunctionType):
+        return FunctionType(substitute_signature(t.signature, mapping))
+    if isinstance(t, Struct):
+        return Struct([
+            StructFieldDecl(f.ident if f.embedded else List([f.ident]),
+                            substitute(f.type_, mapping), f.tag)
+            for f in t.fields
+        ])
+    return t
+
+
+def substitute_signature(signature: Signature, mapping: dict) -> Signature:
+    """The signature with the types of the parameters and the results
+    substituted, the parameters are unnamed"""
+    if not mapping:
+        return signature
+
+    def _parameters(para_list: List) -> List:
+        paras = List([])
+        for para in para_list:
+            count = 1 if para.ident_list is None else len(para.ident_list)
+            for _ in range(count):
+                paras.append(ParameterDecl(substitute(para.type_, mapping), vararg=para.vararg))
+        return paras
+
+    result = signature.result
+    if isinstance(result, List):
+        result = _parameters(result)
+    elif result is not None:
+        result = substitute(result, mapping)
+    return Signature(_parameters(signature.parameters), result)
+
+
+def method_mapping(method: Any, type_: Any) -> dict:
+    """The type arguments of the method of a value of type_, an instance of
+    a generic type (or a pointer to it), by type parameter of the method"""
+    if isinstance(type_, Pointer):
+        type_ = type_.base
+    if (isinstance(method, Method) and isinstance(type_, NamedType)
+            and type_.origin is not None):
+        return dict(zip(method.type_params, type_.type_args))
+    return {}
+
+
+def method_signature(method: Any, type_: Any) -> Signature:
+    """Signature of the method of a value of type_, the type
+    parameters of the methods of generic types are substituted"""
+    return substitute_signature(method.signature, method_mapping(method, type_))
+
+
+class InterfaceMethod(Node):
+
+    # its doc and line comments, see attach_comments
+    doc: Optional[CommentGroup] = None
+    comment: Optional[CommentGroup] = None
+
+    def __init__(self, ident: tuple, signature, lineno: int):
+        self.ident = Identifier(ident, lineno)
+        self.m_name = ident[1]
+        self.signature = signature
+        self.typename = FunctionType.get_func_typename(signature)
+
+        super().__init__("InterfaceMethod", children=[signature], data=self.m_name)
+
+    def data_str(self):
+        return f"name: {self.m_name}, type: {self.typename}"
+
+
+def is_interface(type_: Any) -> bool:
+    return isinstance(type_, Type) and isinstance(type_.underlying(), Interface)
+
+
+# the predeclared error type, made once: the symbol table of the parser and
+# the universe of the type checker have to declare the same named type
+_error_type: Optional["NamedType"] = None
+
+
+def error_type() -> "NamedType":
+    """The predeclared error, a defined type of interface{ Error() string }
+
+    Ref: https://go.dev/ref/spec#Errors"""
+    global _error_type, arena
+    if _error_type is None:
+        # it outlives the arena active, if any
+        outer, arena = arena, None
+        try:
+            string = Type("BasicType", "string", predefined_identifiers["string"])
+            method = InterfaceMethod(("IDENTIFIER", "Error", None), Signature(List([]), string),
+                                     None)
+            _error_type = NamedType("error", Interface([method]))
+        finally:
+            arena = outer
+        # it is not declared by a package, like the ones imported
+        _error_type.package = None
+    return _error_type
+
+
+def find_method(type_: Optional[Type], name: str) -> Optional[Union["Method", InterfaceMethod]]:
+    """Method of a value of type_, which can be a pointer to the type.
+    Pointer methods are found for values as well, they are addressable
+    if they are variables (the type checker reports it if not)"""
+    if is_interface(type_):
+        return type_.underlying().method(name)
+    if isinstance(type_, TypeParam):
+        # the methods of a type parameter are the ones of its constraint
+        return find_method(type_.constraint, name)
+    if isinstance(type_, Pointer):
+        type_ = type_.base
+    if isinstance(type_, NamedType):
+        # the methods of a generic type are the ones of its instances too
+        methods = type_.methods if type_.origin is None else type_.origin.methods
+        return methods.get(name)
+    return None
+
+
+def lookup_field_or_method(type_: Optional[Type], name: str) -> Tuple[Any, Optional[list]]:
+    """The field or the method name of a value of type_ (which can be a
+    pointer to the type) with the embedded fields it is promoted through,
+    like [B] for x in a.x when it is a.B.x
+
+    The ones at the shallowest depth are found. The path is None if there
+    isn't any, the field or method is None with a path if there are several
+    at that depth (the selector is ambiguous)
+    Ref: https://go.dev/ref/spec#Selectors"""
+    if isinstance(type_, Pointer):
+        if is_interface(type_.base):
+            # a pointer to an interface has no methods
+            return None, None
+        type_ = type_.base
+    # the types embedded at the current depth, with their paths
+    current, seen = [(type_, [])], set()
+    while current:
+        found, embedded = [], []
+        for t, path in current:
+            if not isinstance(t, Type) or isinstance(t, TypeParam) or id(t) in seen:
+                # the types embedded at a lower depth are hidden by them
+                continue
+            u = t.underlying()
+            method = find_method(t, name)
+            # a method named like a field is reported by the
+            # type checker, the field is the one selected
+            if method is not None and not (isinstance(u, Struct) and u.field(name)):
+                found.append((method, path))
+            if not isinstance(u, Struct):
+                continue
+            for field_ in u.fields:
+                if field_.f_name == name:
+                    found.append((field_, path))
+                if field_.embedded:
+                    base = field_.type_
+                    if isinstance(base, Pointer):
+                        base = base.base
+                    embedded.append((base, path + [field_]))
+        if len(found) == 1:
+            return found[0]
+        if found:
+            return None, found[0][1]
+        # a type embedded twice at a depth is seen after it, so that its
+        # fields and methods are ambiguous
+        seen.update(id(t) for t, _ in current)
+        current = embedded
+    return None, None
+
+
+def through_pointer(type_: Optional[Type], path: Optional[list]) -> bool:
+    """If a value of type_ is a pointer or one of the embedded fields of the
+    path is, the field or the method selected through them is of a pointed
+    value (fields are addressable, pointer methods can be called)"""
+    return isinstance(type_, Pointer) or any(isinstance(f.type_, Pointer) for f in path or [])
+
 
 class FunctionType(Type):
     """Node for FunctionType"""
@@ -476,39 +1382,49 @@ class FunctionType(Type):
         self.signature = signature
         self.ret_typename: str = FunctionType.get_ret_typename(self.signature)
         typename = FunctionType.get_func_typename(self.signature)
-        super().__init__("FUNCTION_TYPE", typename)
+        # a function value is the address of a closure
+        super().__init__("FUNCTION_TYPE", typename, storage=8)
 
     @staticmethod
     def get_ret_typename(signature: Signature) -> str:
-        if signature.result is not None:
-            return infer_expr_typename(signature.result)
-        return ""
+        """Typename of the result, like int or (int, string)
+        for multiple results. Empty if there is no result"""
+        result = signature.result
+        if result is None:
+            return ""
+        if not isinstance(result, List):
+            return infer_expr_typename(result)
+
+        result_types = FunctionType.get_typenames(result)
+        if len(result_types) == 1:
+            return result_types[0]
+        return f"({', '.join(result_types)})"
 
     @staticmethod
-    def get_func_typename(signature: Signature) -> str:
-        para_types: List[str] = []
-        for para in signature.parameters:
+    def get_typenames(parameters: List) -> list:
+        """Typenames of a list of ParameterDecls, one per parameter"""
+        typenames: List[str] = []
+        for para in parameters:
             ellipsis: str = "..." if para.vararg else ""
+            # the type is None if it isn't a type, it has been reported
             if para.ident_list is None:
-                typename: str = f"{ellipsis}{para.type_.typename}"
-                para_types.append(typename)
+                typenames.append(f"{ellipsis}{getattr(para.type_, 'typename', 'unknown')}")
             else:
                 for para_decl in para.var_decl:
-                    typename: str = f"{ellipsis}{para_decl.type_.typename}"
-                    para_types.append(typename)
-
-        func_typename = "func("
-        for typename in para_types:
-            func_typename = f"{func_typename}{typename}, "
+                    typenames.append(
+                        f"{ellipsis}{getattr(para_decl.type_, 'typename', 'unknown')}"
+                    )
+        return typenames
 
-        if para_types != []:
-            # replace last comma with parenthesis
-            func_typename = func_typename[:-2] + ") "
-        else:
-            func_typename = "func()"
+    @staticmethod
+    def get_func_typename(signature: Signature) -> str:
+        para_types = FunctionType.get_typenames(signature.parameters)
+        func_typename = f"func({', '.join(para_types)})"
 
         ret_type = FunctionType.get_ret_typename(signature)
-        return f"{func_typename}{ret_type}"
+        if ret_type:
+            return f"{func_typename} {ret_type}"
+        return func_typename
 
 
 class Array(Type):
@@ -516,31 +1432,124 @@ class Array(Type):
 
     def __init__(self, eltype, length):
         self.eltype = eltype
-        self.length = length.value
-
-        eltype_info = symtab.get_symbol(eltype.typename)
-
-        eltype_storage = eltype_info.value.storage
-        storage = self.length * eltype_storage
+        # the length is a constant expression, or its value. It is None
+        # if it isn't a valid length, the type checker reports why, and
+        # "..." in the type of an array literal until its elements are known
+        self.length_expr = length if isinstance(length, Node) else None
+        self.length = length
+        if isinstance(length, Node):
+            self.length = array_length(length)
+
+        storage = None
+        if eltype.storage is not None and isinstance(self.length, int):
+            storage = self.length * eltype.storage
         typename = f"ARRAY_[{self.length}]{eltype.typename}"
         super().__init__("ARRAY", typename, storage)
 
+    def resize(self, length: int):
+        """Sets the length, once the type checker knows the value of a
+        length referring to a constant declared after the type"""
+        self.length = length
+        if self.eltype.storage is not None:
+            self.storage = length * self.eltype.storage
+        self.typename = f"ARRAY_[{length}]{self.eltype.typename}"
+
     def data_str(self):
         return f"eltype: {self.eltype.typename}"
 
 
+def array_length(expr: Node) -> Optional[int]:
+    """The value of the length of an array type, None if it isn't a
+    constant which can be an int and isn't negative"""
+    try:
+        value = constant.evaluate(expr)
+    except constant.ConstError:
+        return None
+    return constant_length(value)
+
+
+def constant_length(value: constant.Constant) -> Optional[int]:
+    """The length of an array type of the value of its length"""
+    if value.is_untyped and untyped.is_numeric(value.kind):
+        length = untyped.to_integer(value.kind, value.value)
+    elif untyped.is_integer(value.kind):
+        length = value.value
+    else:
+        return None
+    if length is None or length < 0 or length > untyped.int_range("int")[1]:
+        return None
+    return length
+
+
+def literal_length(value: Optional["LiteralValue"]) -> int:
+    """The length of an array literal with [...] for its length, one
+    more than the highest index of its elements (constant indices which
+    aren't valid are reported by the type checker)"""
+    elements = [] if value is None else list(reversed(value.children))
+    length = index = 0
+    for element in elements:
+        if isinstance(element, KeyedElement):
+            try:
+                key = constant.evaluate(element.key)
+                index = untyped.to_integer(key.kind, key.value) or 0
+            except constant.ConstError:
+                pass
+        index += 1
+        length = max(length, index)
+    return length
+
+
 class Slice(Type):
     """Node for a slice type"""
 
     def __init__(self, eltype: Type):
         self.eltype = eltype
         typename = f"SLICE_{self.eltype.typename}"
-        super().__init__("SLICE", typename, storage=None)
+        # pointer to the array, length and capacity
+        super().__init__("SLICE", typename, storage=24)
 
     def data_str(self):
         return f"eltype: {self.eltype.typename}"
 
 
+class Map(Type):
+    """Node for a map type, the value of a map is a
+    reference to its hash table, kept by the runtime"""
+
+    def __init__(self, key: Type, eltype: Type, lineno: Optional[int] = None):
+        self.key = key
+        self.eltype = eltype
+        self.lineno = lineno
+        typename = f"MAP_[{self.key.typename}]{self.eltype.typename}"
+        super().__init__("MAP", typename, storage=8)
+
+    def data_str(self):
+        return f"key: {self.key.typename}, eltype: {self.eltype.typename}"
+
+
+class Chan(Type):
+    """Node for a channel type, dir is "both", "send" (for chan<- T)
+    or "recv" (for <-chan T). The value of a channel is a reference
+    to its buffer and queues of waiting goroutines, kept by the runtime"""
+
+    prefixes = {"both": "CHAN", "send": "CHAN_SEND", "recv": "CHAN_RECV"}
+
+    def __init__(self, eltype: Type, dir_: str = "both", lineno: Optional[int] = None):
+        self.eltype = eltype
+        self.dir = dir_
+        self.lineno = lineno
+        typename = f"{self.prefixes[dir_]}_{self.eltype.typename}"
+        super().__init__("CHAN", typename, storage=8)
+
+    def data_str(self):
+        return f"eltype: {self.eltype.typename}, dir: {self.dir}"
+
+
+# type arguments of the instance of the generic function being generated,
+# by type parameter. The types inferred for its expressions are substituted
+type_args: Dict[TypeParam, Type] = {}
+
+
 def infer_expr_type(expr: Union[Node | str]) -> Optional[
         Union[Type | Array | Slice | FunctionType]
     ]:
@@ -558,9 +1567,15 @@ def infer_expr_type(expr: Union[Node | str]) -> Optional[
                 infered_type = type_info.value
 
     elif isinstance(expr, FunctionCall):
-        fn_name_info = symtab.get_symbol(expr.fn_name)
-        if fn_name_info is not None:
-            infered_type = fn_name_info.type_.signature.result
+        if expr.conversion_type() is not None:
+            infered_type = expr.conversion_type()
+        elif expr.method is not None:
+            infered_type = expr.method.signature.result
+        elif expr.is_builtin:
+            infered_type = builtin_result_type(expr)
+        elif expr.function_type() is not None:
+            infered_type = expr.function_type().signature.result
+        infered_type = substitute(infered_type, expr.type_mapping())
 
     elif isinstance(expr, Function):
         infered_type = FunctionType(expr.signature)
@@ -570,22 +1585,117 @@ def infer_expr_type(expr: Union[Node | str]) -> Optional[
         if type_info is not None and hasattr(type_info.type_, "storage"):
             infered_type = type_info.type_
 
-    elif isinstance(expr, PrimaryExpr):
-        if len(expr.children) > 0 and isinstance(expr.children[0], Index):
-            # primaryExp[Index]
-            # operand: primaryExpr, children[0]: Index
-            infered_type = symtab.get_symbol(expr.data[1]).type_.eltype
+    elif isinstance(expr, QualifiedIdent):
+        if expr.symbol is not None:
+            infered_type = expr.symbol.type_
 
+    elif isinstance(expr, PrimaryExpr):
+        # undefined identifiers are reported by the type checker
+        if isinstance(expr.data, tuple):
+            sym = expr.ident
+            infered_type = sym.type_ if sym is not None else None
+            accessors = expr.children
         else:
-            # identifier
-            infered_type = symtab.get_symbol(expr.data[1]).type_
+            infered_type = infer_expr_type(expr.children[0])
+            accessors = expr.children[1:]
+
+        # elements and fields, like a[i].x
+        for accessor in accessors:
+            infered_type = accessed_type(infered_type, accessor)
 
     if isinstance(infered_type, (Array, Type, Slice, FunctionType)):
-        return infered_type
+        return substitute(infered_type, type_args)
+
+    return None
+
 
+def accessed_type(type_: Optional[Type], accessor: Node) -> Optional[Type]:
+    """Type of an element (for an Index) or a field (for a Selector)
+    of a value of type_, None if it doesn't have one"""
+    if not isinstance(type_, Type):
+        return None
+    t = type_.underlying()
+    if isinstance(t, Pointer) and isinstance(t.base, Type):
+        # fields and elements of the pointed value, like p.x for (*p).x
+        t = t.base.underlying()
+    if isinstance(accessor, Index):
+        return getattr(t, "eltype", None)
+    elif isinstance(accessor, SliceExpr):
+        # slicing an array gives a slice, strings and slices stay the same
+        if isinstance(t, Array):
+            return Slice(t.eltype)
+        return type_ if isinstance(t, Slice) or t.typename == "string" else None
+    elif isinstance(accessor, Selector) and isinstance(t, Struct):
+        # a promoted field too, like the x of a.x for a.B.x
+        field, _ = lookup_field_or_method(t, accessor.field_name)
+        return field.type_ if isinstance(field, StructField) else None
+    elif isinstance(accessor, TypeAssertion):
+        return accessor.type_
     return None
 
 
+# builtin functions, these are not in the symbol table
+builtins = (
+    "append", "cap", "close", "complex", "copy", "delete", "imag", "len", "make", "max",
+    "min", "new", "panic", "real", "recover"
+)
+
+
+def builtin_result_type(call: FunctionCall) -> Optional[Type]:
+    """Type of the result of a call of a builtin function"""
+    if call.fn_name in ("len", "cap", "copy"):
+        return symtab.get_symbol("int").value
+
+    args = call.arguments.expressions()
+    if call.fn_name in ("make", "new"):
+        type_ = call.arguments.type_
+        # a declared type, like make(Ints, n) or new(int)
+        if type_ is None and args and isinstance(args[0], PrimaryExpr) and args[0].ident is not None:
+            type_ = args[0].ident.value if isinstance(args[0].ident.value, Type) else None
+        if call.fn_name == "new" and type_ is not None:
+            return Pointer(type_)
+        return type_
+    elif call.fn_name == "append" and args:
+        return infer_expr_type(args[0])
+    elif call.fn_name == "recover":
+        # the value given to panic
+        return symtab.get_symbol("any").value
+    elif call.fn_name in ("complex", "real", "imag") and args:
+        # the parts of complex64 values are float32, of untyped
+        # constants float64 (and complex128)
+        types = [infer_expr_type(arg) for arg in args]
+        typenames = [t.underlying().typename for t in types if isinstance(t, Type)]
+        if call.fn_name == "complex":
+            small = "float32" in typenames
+            return symtab.get_symbol("complex64" if small else "complex128").value
+        small = "complex64" in typenames
+        return symtab.get_symbol("float32" if small else "float64").value
+    elif call.fn_name in ("min", "max") and args:
+        # the type of the typed arguments, untyped constants take it
+        typed = [arg for arg in args if not is_untyped_constant(arg)]
+        return infer_expr_type((typed or args)[0])
+    return None
+
+
+def infer_result_types(expr: Node) -> list:
+    """Types of the results of a function call, empty if
+    expr is not a call of a declared function"""
+    if isinstance(expr, FunctionCall):
+        mapping = expr.type_mapping()
+        result_types = []
+        if expr.method is not None:
+            result_types = expr.method.signature.result_types
+        # the function could be declared after the call
+        fn_sym = expr.fn_sym or symtab.get_symbol(str(expr.fn_name))
+        if expr.method is None and fn_sym is not None and isinstance(fn_sym.value, Function):
+            result_types = fn_sym.value.signature.result_types
+        elif expr.method is None and expr.function_type() is not None:
+            # a function value, like f() for a variable f
+            result_types = expr.function_type().signature.result_types
+        return [substitute(substitute(t, mapping), type_args) for t in result_types]
+    return []
+
+
 def infer_expr_typename(expr: Union[
         BinOp | UnaryOp | PrimaryExpr | Function | Type | FunctionCall
     ]) -> Optional[str]:
@@ -596,11 +1706,21 @@ def infer_expr_typename(expr: Union[
         return expr.typename
 
     elif isinstance(expr, (BinOp, UnaryOp)):
-        return expr.type_
+        # the types of pointer operations are Types, like POINTER_int
+        return getattr(expr.type_, "typename", expr.type_)
 
     elif isinstance(expr, FunctionCall):
-        fn_name_info = symtab.get_symbol(expr.fn_name)
-        return fn_name_info.type_.ret_typename
+        if expr.type_mapping() or type_args:
+            # the result of an instance of a generic function (or method)
+            result_types = infer_result_types(expr)
+            if len(result_types) == 1:
+                return getattr(result_types[0], "typename", None)
+        if expr.method is not None:
+            return expr.method.signature.ret_type
+        if expr.is_builtin:
+            return getattr(builtin_result_type(expr), "typename", None)
+        if expr.function_type() is not None:
+            return expr.function_type().ret_typename
 
     elif isinstance(expr, Literal):
         lit_type = expr.type_
@@ -609,15 +1729,10 @@ def infer_expr_typename(expr: Union[
     elif isinstance(expr, Function):
         return FunctionType.get_func_typename(expr.signature)
 
-    elif isinstance(expr, PrimaryExpr):
-        if (len(expr.children) > 0 and isinstance(expr.children[0], Index)):
-            # primaryExp[Index]
-            # operand: primaryExpr, children[0]: Index
-            return symtab.get_symbol(expr.data[1]).type_.eltype.typename
-
-        else:
-            # identifier
-            return symtab.get_symbol(expr.data[1]).type_.typename
+    elif isinstance(expr, (PrimaryExpr, QualifiedIdent)):
+        infered_type = infer_expr_type(expr)
+        if infered_type is not None:
+            return infered_type.typename
 
     return None
 
@@ -631,6 +1746,107 @@ class Index(Node):
         self.expr = expr
 
 
+class SliceExpr(Node):
+    """Node for a slice expression, like the [1:3] in a[1:3]
+
+    low, high and max are None when they are omitted,
+    max is given only by a 3-index slice like a[1:3:5]"""
+
+    def __init__(self, low, high, max_=None, lineno=None):
+        super().__init__("SLICE_EXPR", children=[low, high, max_], data=None)
+        self.low = low
+        self.high = high
+        self.max = max_
+        self.lineno = lineno
+
+    @property
+    def indices(self) -> list:
+        return [self.low, self.high, self.max]
+
+
+class Selector(Node):
+    """Node for selecting a field, like the .x in p.x"""
+
+    def __init__(self, ident_tuple, lineno: int):
+        super().__init__("SELECTOR", children=[], data=ident_tuple)
+        self.field_name = ident_tuple[1]
+        self.lineno = lineno
+        self.col_num = ident_tuple[2]
+
+    def data_str(self):
+        return f"name: {self.field_name}"
+
+
+class TypeAssertion(Node):
+    """Node for a type assertion, like the .(Point) in s.(Point)"""
+
+    def __init__(self, type_, lineno: int):
+        super().__init__("TYPE_ASSERTION", children=[], data=type_)
+        self.type_ = type_
+        self.lineno = lineno
+
+    def data_str(self):
+        return f"type: {getattr(self.type_, 'typename', None)}"
+
+
+def is_comma_ok(expr: Node) -> bool:
+    """If expr can give a second, boolean value, like v, ok := x.(T),
+    v, ok := m[k] or v, ok := <-ch"""
+    if isinstance(expr, UnaryOp):
+        return expr.operator == "<-"
+    if not isinstance(expr, PrimaryExpr) or not expr.children:
+        return False
+    if isinstance(expr.children[-1], TypeAssertion):
+        return True
+    return isinstance(expr.children[-1], Index) and is_map(infer_expr_type(selector_operand(expr)))
+
+
+def is_map(t: Any) -> bool:
+    return isinstance(t, Type) and isinstance(t.underlying(), Map)
+
+
+def is_chan(t: Any) -> bool:
+    return isinstance(t, Type) and isinstance(t.underlying(), Chan)
+
+
+def is_string(t: Any) -> bool:
+    return isinstance(t, Type) and getattr(t.underlying(), "typename", None) == "string"
+
+
+def is_integer(t: Any) -> bool:
+    return isinstance(t, Type) and getattr(t.underlying(), "typename", None) in untyped.int_typenames
+
+
+def selector_operand(expr: PrimaryExpr) -> Node:
+    """expr without its last selector, like p.min for p.min.x"""
+    children = expr.children[:-1]
+    if isinstance(expr.data, tuple):
+        operand = PrimaryExpr(expr.data, expr.lineno, children=children)
+        operand.ident = expr.ident
+        return operand
+    if len(children) == 1:
+        return children[0]
+    return PrimaryExpr(None, expr.lineno, children=children)
+
+
+class TypeRef:
+    """A type written by its name, like geometry.Point or an instance of a
+    generic type (type_args are the types of its type arguments). The node
+    of a named type is the same wherever it is used, the printer finds
+    how it is written by its position, in type_refs"""
+
+    def __init__(self, name: str, type_args: Optional[list], span: Tuple[int, int]):
+        self.name = name
+        self.type_args = type_args
+        self.pos, self.end = span
+        # the type it names, set once it is parsed
+        self.type_: Optional[Type] = None
+
+
+# the TypeRefs, by their position
+type_refs: Dict[int, TypeRef] = {}
+
+
 class QualifiedIdent(Node):
     """Node for qualified identifiers"""
 
@@ -639,10 +1855,15 @@ class QualifiedIdent(Node):
                          children=[],
                          data=(package_name, identifier))
         self.lineno = lineno
+        # the member of the package, if the package is loaded
+        self.symbol: Optional[SymbolInfo] = None
+        package = symtab.get_symbol(package_name[1])
+        if package is not None and isinstance(package.value, Package):
+            self.symbol = package.value.members.get(identifier[1])
 
     @property
     def col_no(self) -> int:
-        self.data[-1][-1]
+        return self.data[0][-1]
 
     def data_str(self):
         return f"package: {self.data[0][1]}, name: {self.data[1][1]}"
@@ -655,11 +1876,21 @@ class VarDecl(Node):
                  ident: Identifier,
                  type_=None,
                  value=None,
-                 const: bool = False):
+                 const: bool = False,
+                 type_inferred: bool = False,
+                 iota: Optional[int] = None,
+                 unpack: Optional[tuple] = None):
         self.ident = ident
         self.type_ = type_
         self.value = value
         self.const = const
+        # type_ was not given in the declaration, but inferred from value
+        self.type_inferred = type_inferred
+        # index of the ConstSpec, for const declarations
+        self.iota = iota
+        # (identifier_list, expression_list) of the whole spec when the
+        # values can't be paired with the identifiers, like a, b = f()
+        self.unpack = unpack
         self.symbol: Optional[SymbolInfo] = symtab.get_symbol(
             self.ident.ident_name)
 
@@ -693,16 +1924,91 @@ class VarDecl(Node):
         return s
 
 
+def is_untyped_constant(expr: Node, iota: Optional[int] = None) -> bool:
+    try:
+        return constant.evaluate(expr, iota).is_untyped
+    except constant.ConstError:
+        return False
+
+
+def eval_const_decl(
+    expr: Node, type_=None, iota: Optional[int] = None
+) -> Optional[constant.Constant]:
+    """Evaluates the value of a constant declaration.
+
+    The value stays untyped unless a type is given in the declaration.
+    Returns None if it can't be evaluated, the type checker reports why"""
+    try:
+        value = constant.evaluate(expr, iota)
+
+        typename = infer_expr_typename(type_) if type_ is not None else None
+        if typename is not None and untyped.kind_of_typename(typename) is not None:
+            value = constant.convert(value, typename)
+
+        return value
+    except constant.ConstError:
+        return None
+
+
+class Spec:
+    """A VarSpec or a ConstSpec as it is written (or the two sides of a :=),
+    which the VarDecls made from it don't keep. names are Identifiers and
+    values expressions, in order. values is None if there are none, like
+    for a ConstSpec repeating the expressions of the previous one"""
+
+    # its doc and line comments, see attach_comments
+    doc: Optional[CommentGroup] = None
+    comment: Optional[CommentGroup] = None
+    # the := of a short variable declaration
+    define: Optional["Token"] = None
+
+    def __init__(self, names: list, type_=None, values: Optional[list] = None,
+                 span: Tuple[int, int] = (NoPos, NoPos)):
+        self.names = names
+        self.type_ = type_
+        self.values = values
+        self.pos, self.end = span
+
+
+class Token:
+    """A token kept for its position, like the := of a short variable
+    declaration, where one declaring no new variables is reported"""
+
+    def __init__(self, value: str, span: Tuple[int, int]):
+        self.value = value
+        self.pos, self.end = span
+
+
+class DeclGroup:
+    """A declaration as it is written, like var (...) or a :=, for printing
+    it back (see printer). keyword is the one it starts with (or ":="),
+    specs are Specs for var and const declarations and the nodes of the
+    others (Imports or TypeDefs), in order. The nodes made from a spec
+    have the declaration as their _group and the spec as their _spec"""
+
+    # its doc comment, see attach_comments
+    doc: Optional[CommentGroup] = None
+
+    def __init__(self, keyword: str, specs: list, parenthesized: bool,
+                 span: Tuple[int, int] = (NoPos, NoPos)):
+        self.keyword = keyword
+        self.specs = specs
+        self.parenthesized = parenthesized
+        self.pos, self.end = span
+
+
 def make_variable_decls(
     identifier_list: List,
     type_=None,
     expression_list: Optional[List] = None,
     const: bool = False,
+    iota: Optional[int] = None,
 ):
     var_list = List([])
 
     if expression_list is None:
-        # TODO: implement default values
+        # variables are initialized to the zero value of
+        # their type, this is done by the IC generator
         ident: Identifier
         for ident in identifier_list:
             symtab.declare_new_variable(
@@ -713,56 +2019,94 @@ def make_variable_decls(
                 const=const,
             )
             var_list.append(VarDecl(ident, type_, const=const))
-    elif len(identifier_list) == len(expression_list):
+    elif len(identifier_list) == len(expression_list) and not refers_to_spec(
+            identifier_list, expression_list, const):
         ident: Identifier
         expr: Node
 
         orig_type = type_
 
         for ident, expr in zip(identifier_list, expression_list):
-            # type inference
-            inf_type = infer_expr_type(expr)
-            if inf_type is None:
-                print(f"WARNING: failed to deduce type of expression {expr}: {type(expr)}")
-                inf_type = "unknown"
-
-            inf_typename = infer_expr_typename(inf_type)
-
-            # now check if the LHS and RHS types match
+            # type inference, mismatches with the declared
+            # type are reported by the type checker
             if type_ is None:
-                type_ = inf_type
-            else:
-                # get just the type name
-                typename = infer_expr_typename(type_)
-
-                if typename != inf_typename:
-                    # special case for literal
-                    # Question: what's with this special case?
-                    if not isinstance(expr, Literal):
-                        print_error("Type Mismatch", kind="TYPE ERROR")
-                        print(
-                            f"Cannot use expression of type {inf_typename} as "
-                            f"assignment to type {typename}")
-                        print_line_marker_nowhitespace(ident.lineno)
+                type_ = infer_expr_type(expr)
+                if type_ is None:
+                    type_ = "unknown"
+
+            value = expr
+            const_value = None
+            if const:
+                const_value = eval_const_decl(expr, orig_type, iota)
+                if const_value is not None:
+                    value = const_value.to_python()
+                if const_value is not None and type_ == "unknown":
+                    # the type of conversions isn't inferred, like string(r)
+                    typename = const_value.typename or untyped.default_typename(const_value.kind)
+                    type_ = symtab.get_symbol(typename).value
 
             symtab.declare_new_variable(
                 ident.ident_name,
                 ident.lineno,
                 ident.col_num,
                 type_=type_,
-                value=expr,
+                value=value,
                 const=const,
+                constant=const_value,
             )
 
-            var_list.append(VarDecl(ident, type_, expr, const))
+            var_list.append(VarDecl(
+                ident, type_, expr, const,
+                type_inferred=orig_type is None,
+                iota=iota,
+            ))
             type_ = orig_type
     else:
-        raise NotImplementedError(
-            "Declaration with unpacking not implemented yet")
+        # either a single call returning multiple values or a
+        # mismatch, the type checker finds out which one it is
+        result_types = []
+        if type_ is None and len(expression_list) == 1:
+            expr = expression_list.children[0]
+            result_types = infer_result_types(expr)
+            if len(identifier_list) == 2 and is_comma_ok(expr):
+                result_types = [infer_expr_type(expr), symtab.get_symbol("bool").value]
+        elif type_ is None and len(expression_list) == len(identifier_list):
+            result_types = [infer_expr_type(expr) or "unknown"
+                            for expr in reversed(expression_list.children)]
+        if len(result_types) != len(identifier_list):
+            result_types = [type_ if type_ is not None else "unknown"] * len(identifier_list)
+
+        ident: Identifier
+        # identifier lists are in reverse order
+        for ident, ident_type in zip(identifier_list, reversed(result_types)):
+            symtab.declare_new_variable(
+                ident.ident_name,
+                ident.lineno,
+                ident.col_num,
+                type_=ident_type,
+                const=const,
+            )
+            var_list.append(VarDecl(
+                ident, type_, const=const,
+                type_inferred=type_ is None,
+                iota=iota,
+                unpack=(identifier_list, expression_list),
+            ))
 
     return var_list
 
 
+def refers_to_spec(identifier_list: List, expression_list: List, const: bool) -> bool:
+    """If a value of a VarSpec (or of a :=) in a function uses a name it
+    declares, like i in i, j := i*10, i. The values are then evaluated before
+    the variables are declared, like the ones of a := f() are (see unpack)"""
+    names = {ident.ident_name for ident in identifier_list} - {"_"}
+    if const or len(identifier_list) < 2 or symtab.depth <= 1:
+        return False
+    return any(isinstance(n, PrimaryExpr) and isinstance(n.data, tuple) and n.data[1] in names
+               for n in walk(expression_list))
+
+
 class ParameterDecl(Node):
 
     def __init__(self, type_, vararg=False, ident_list=None):
@@ -773,6 +2117,10 @@ class ParameterDecl(Node):
         self.vararg = vararg
         self.ident_list = ident_list
         if ident_list is not None:
+            # a variadic parameter is a slice in the function (None if
+            # its type isn't a type, it is reported already)
+            if vararg and type_ is not None:
+                type_ = Slice(type_)
             self.var_decl = make_variable_decls(ident_list, type_=type_)
 
     def data_str(self):
@@ -793,19 +2141,6 @@ class IfStmt(Node):
         # signal the AST optimizer to not optimize these children
         self._no_optim = True
 
-        expr_typename = infer_expr_typename(expr)
-        if isinstance(self.expr, BinOp):
-            if expr_typename != "bool":
-                print_error("Invalid operator in condition", kind="ERROR")
-                print("Cannot use non-boolean binary operator "
-                      f"{self.expr.operator}"
-                      " in a condition")
-                print_line_marker_nowhitespace(lineno)
-        elif expr_typename != "bool":
-            print_error("Invalid condition", kind="TYPE ERROR")
-            print("Cannot use non-binary expression in condition")
-            print_line_marker_nowhitespace(lineno)
-
 
 class ForStmt(Node):
 
@@ -818,16 +2153,6 @@ class ForStmt(Node):
         # signal the AST optimizer to not optimize these children
         self._no_optim = True
 
-        clause_typename = infer_expr_typename(clause)
-        if clause_typename == "bool":
-            pass
-        elif isinstance(clause, ForClause):
-            pass
-        else:
-            print_error("Invalid condition", kind="TYPE ERROR")
-            print("Cannot use non-binary expression in for loop")
-            print_line_marker_nowhitespace(lineno)
-
 
 class ForClause(Node):
 
@@ -841,28 +2166,204 @@ class ForClause(Node):
         # signal the AST optimizer to not optimize these children
         self._no_optim = True
 
-        cond_typename = infer_expr_typename(cond)
-        if cond_typename != "bool":
-            print_error("Invalid condition", kind="TYPE ERROR")
-            print("Cannot use non-binary expression in for loop")
-            print_line_marker_nowhitespace(lineno)
-
 
 class RangeClause(Node):
+    """Node for the range clause of a for statement, like k, v := range m
+
+    ident_list has the variables declared, expr_list
+    the ones assigned to, like in k, v = range m"""
 
     def __init__(self, expr, ident_list=None, expr_list=None):
         if ident_list is not None:
-            self.var_decl = make_variable_decls(ident_list, expr)
-        else:
-            self.var_decl = None
-        super().__init__("RANGE",
-                         children=[expr, ident_list, expr_list, self.var_decl])
+            types = range_types(expr)
+            # identifier lists are in reverse order
+            for i, ident in enumerate(reversed(ident_list.children)):
+                symtab.declare_new_variable(
+                    ident.ident_name,
+                    ident.lineno,
+                    ident.col_num,
+                    type_=types[i] if i < len(types) else None,
+                )
+        super().__init__("RANGE", children=[expr, ident_list, expr_list])
         self.expr = expr
         self.ident_list = ident_list
         self.expr_list = expr_list
 
 
+def range_types(expr: Node) -> list:
+    """Types of the iteration variables of a range over expr: the key and
+    the element of a map, the index and the element of an array (or a
+    pointer to one) or a slice, the index of a byte and the rune of a
+    string, the value received from a channel or the integer counted to"""
+    t = infer_expr_type(expr)
+    if not isinstance(t, Type):
+        return []
+    u = t.underlying()
+    if isinstance(u, Pointer) and isinstance(u.base, Type):
+        u = u.base.underlying()
+    if isinstance(u, Map):
+        return [u.key, u.eltype]
+    if isinstance(u, Chan):
+        return [u.eltype]
+    if is_integer(t):
+        return [t]
+    int_type = symtab.get_symbol("int").value
+    if isinstance(u, (Array, Slice)):
+        return [int_type, u.eltype]
+    if is_string(t):
+        return [int_type, symtab.get_symbol("rune").value]
+    return []
+
+
+class SwitchStmt(Node):
+    """Node for an expression switch, expr is None for a tagless switch
+
+    Ref: https://golang.org/ref/spec#Expression_switches
+    """
+
+    def __init__(self, clauses, expr=None, statement=None, lineno=None):
+        super().__init__("SWITCH", children=[statement, expr, clauses])
+        self.statement = statement
+        self.expr = expr
+        # List of CaseClauses (None if there are none)
+        self.clauses = clauses
+        self.lineno = lineno
+
+        # signal the AST optimizer to not optimize these children
+        self._no_optim = True
+
+
+class CaseClause(Node):
+    """Node for a case (or default, when exprs is None) of a switch"""
+
+    def __init__(self, body, exprs=None, lineno=None):
+        super().__init__("CASE" if exprs is not None else "DEFAULT",
+                         children=[exprs, body])
+        self.exprs = exprs
+        self.body = body
+        self.lineno = lineno
+
+        # signal the AST optimizer to not optimize these children
+        self._no_optim = True
+
+    @property
+    def is_default(self) -> bool:
+        return self.exprs is None
+
+
+class TypeSwitchStmt(SwitchStmt):
+    """Node for a type switch, like switch v := x.(type), expr is the x
+    and ident the v (None if the guard declares no variable)
+
+    Ref: https://golang.org/ref/spec#Type_switches
+    """
+
+    def __init__(self, clauses, expr, ident=None, statement=None, lineno=None):
+        super().__init__(clauses, expr=expr, statement=statement, lineno=lineno)
+        self.name = "TYPE_SWITCH"
+        self.ident = ident
+
+
+class TypeCaseClause(CaseClause):
+    """Node for a case (or default, when types is None) of a type switch.
+    ident is the variable of the guard declared in the clause (None if the
+    guard declares none), of the type of the case if it lists one type"""
+
+    def __init__(self, body, types=None, ident=None, lineno=None):
+        super().__init__(body, exprs=types, lineno=lineno)
+        self.ident = ident
+
+    @property
+    def types(self):
+        """The List of TypeCases, the exprs of the clause"""
+        return self.exprs
+
+
+class TypeCase(Node):
+    """Node for a type listed by a case of a type switch, or nil (type_
+    is None then), the case of the nil interface value"""
+
+    def __init__(self, type_, nil: bool = False, lineno=None):
+        super().__init__("TYPE_CASE", children=[], data=type_)
+        self.type_ = type_
+        self.nil = nil
+        self.lineno = lineno
+
+    def data_str(self):
+        return "nil" if self.nil else f"type: {getattr(self.type_, 'typename', None)}"
+
+
+class SendStmt(Node):
+    """Node for a send statement, like ch <- v"""
+
+    def __init__(self, chan, value, lineno=None):
+        super().__init__("SEND", children=[chan, value])
+        self.chan = chan
+        self.value = value
+        self.lineno = lineno
+
+
+class GoStmt(Node):
+    """Node for a go statement, the call runs in a new goroutine"""
+
+    def __init__(self, call, lineno=None):
+        super().__init__("GO", children=[call])
+        self.call = call
+        self.lineno = lineno
+
+
+class DeferStmt(Node):
+    """Node for a defer statement, the call is done when the
+    function returns, but its arguments are evaluated now"""
+
+    def __init__(self, call, lineno=None):
+        super().__init__("DEFER", children=[call])
+        self.call = call
+        self.lineno = lineno
+
+
+class SelectStmt(Node):
+    """Node for a select statement
+
+    Ref: https://golang.org/ref/spec#Select_statements
+    """
+
+    def __init__(self, clauses, lineno=None):
+        super().__init__("SELECT", children=[clauses])
+        # List of CommClauses (None if there are none)
+        self.clauses = clauses
+        self.lineno = lineno
+
+        # signal the AST optimizer to not optimize these children
+        self._no_optim = True
+
+
+class CommClause(Node):
+    """Node for a case (or default, when comm is None) of a select
+
+    comm is a SendStmt, a receive (an ExpressionStmt), or an Assignment
+    or a list of VarDecls with a receive on the right, like v, ok := <-ch"""
+
+    def __init__(self, body, comm=None, lineno=None):
+        super().__init__("CASE" if comm is not None else "DEFAULT",
+                         children=[comm, body])
+        self.comm = comm
+        self.body = body
+        self.lineno = lineno
+
+        # signal the AST optimizer to not optimize these children
+        self._no_optim = True
+
+    @property
+    def is_default(self) -> bool:
+        return self.comm is None
+
+
 class Struct(Type):
+    """Node for a struct type, fields are in the declared order
+
+    Fields are laid out one after the other, their offsets (and the
+    storage of the struct) are None if the size of a field isn't known"""
 
     def __init__(self, field_decl_list):
         self.fields = []
@@ -870,50 +2371,151 @@ class Struct(Type):
         for i in field_decl_list:
             i: StructFieldDecl
             if i.ident_list is not None:
-                for ident in i.ident_list:
+                # identifier lists are in reverse order
+                for ident in reversed(i.ident_list.children):
                     ident: Identifier
-                    self.fields.append(
-                        StructField(ident.ident_name, i.type_, i.tag))
-            elif i.embed_field is not None:
-                # TODO: handle pointer type here
-                self.fields.append(StructField(i.embed_field[1], None, i.tag))
+                    self.fields.append(StructField(ident, i.type_, i.tag))
+            else:
+                # named after its type, like T for *pkg.T
+                self.fields.append(StructField(i.embed_field, i.type_, i.tag, embedded=True))
+        # the StructFieldDecls, for printing the fields as they are declared
+        self._field_decls = list(field_decl_list)
+
+        offset = 0
+        for field_ in self.fields:
+            field_.offset = offset
+            # the type of a field is None if it is undefined
+            if offset is not None and getattr(field_.type_, "storage", None) is not None:
+                offset += field_.type_.storage
+            else:
+                offset = None
+
+        field_strs = []
+        for field_ in self.fields:
+            tag = "" if field_.tag is None else f" {field_.tag[1]}"
+            typename = getattr(field_.type_, "typename", "unknown")
+            if field_.embedded:
+                field_strs.append(f"{typename}{tag}")
+            else:
+                field_strs.append(f"{field_.f_name} {typename}{tag}")
+        typename = f"STRUCT_{{{'; '.join(field_strs)}}}"
 
-        super().__init__("Struct", children=self.fields)
+        super().__init__("STRUCT", typename, offset, children=self.fields)
+
+    def field(self, name: str) -> Optional["StructField"]:
+        """The field declared with the name, not the promoted
+        ones (see lookup_field_or_method)"""
+        for field_ in self.fields:
+            if field_.f_name == name:
+                return field_
+        return None
 
 
 class StructField(Node):
 
-    def __init__(self, name, type_, tag):
-        self.f_name = name
+    def __init__(self, ident, type_, tag, embedded: bool = False):
+        self.ident = ident
+        self.f_name = ident.ident_name
         self.type_ = type_
+        # STRING_LIT from the lexer, ("string", value)
         self.tag = tag
+        # an embedded field, like the T of struct{ T }, its fields
+        # and methods are promoted to the struct
+        self.embedded = embedded
+        # in bytes, from the start of the struct
+        self.offset: Optional[int] = None
 
         super().__init__("StructField",
                          children=[type_],
-                         data=(name, type_, tag))
+                         data=(self.f_name, type_, tag))
 
     def data_str(self):
         return f"name: {self.f_name}, type: {self.type_}, tag: {self.tag}"
 
+    @property
+    def tag_value(self) -> str:
+        """The value of the tag, like json:"name" for `json:"name"`, the
+        bytes which aren't UTF-8 are surrogates"""
+        if self.tag is None:
+            return ""
+        try:
+            return constant.unquote(self.tag[1]).decode("utf-8", "surrogateescape")
+        except constant.ConstError:
+            return ""
+
+
+def tag_pairs(tag: str) -> Tuple[list, Optional[str]]:
+    """The key:"value" pairs of a struct tag, in the order
+    reflect.StructTag.Lookup scans them, and why it stops before the end of
+    the tag (None if it doesn't), the way go vet reports it
+    Ref: https://pkg.go.dev/reflect#StructTag"""
+    pairs = []
+    while tag:
+        tag = tag.lstrip(" ")
+        if not tag:
+            break
+        i = 0
+        while i < len(tag) and tag[i] > " " and tag[i] not in ':"\x7f':
+            i += 1
+        if i == 0:
+            return pairs, "bad syntax for struct tag key"
+        if i + 1 >= len(tag) or tag[i] != ":":
+            return pairs, "bad syntax for struct tag pair"
+        if tag[i + 1] != '"':
+            return pairs, "bad syntax for struct tag value"
+        name, tag = tag[:i], tag[i + 1:]
+        i = 1
+        while i < len(tag) and tag[i] != '"':
+            i += 2 if tag[i] == "\\" else 1
+        if i >= len(tag):
+            return pairs, "bad syntax for struct tag value"
+        quoted, tag = tag[:i + 1], tag[i + 1:]
+        try:
+            value = constant.unquote(quoted).decode("utf-8", "surrogateescape")
+        except constant.ConstError:
+            return pairs, "bad syntax for struct tag value"
+        pairs.append((name, value))
+    return pairs, None
+
+
+def lookup_tag(tag: str, key: str) -> Optional[str]:
+    """The value of the key in a struct tag, like reflect.StructTag.Lookup,
+    None if it isn't there"""
+    pairs, _ = tag_pairs(tag)
+    return next((value for name, value in pairs if name == key), None)
+
 
 class StructFieldDecl:
 
-    def __init__(self, ident_list_or_embed_field, type_=None, tag=None):
+    # its doc and line comments, see attach_comments
+    doc: Optional[CommentGroup] = None
+    comment: Optional[CommentGroup] = None
+
+    def __init__(self, ident_list_or_embed_field, type_=None, tag=None,
+                 span: Tuple[int, int] = (NoPos, NoPos)):
         if isinstance(ident_list_or_embed_field, List):
             self.ident_list = ident_list_or_embed_field
             self.embed_field = None
         else:
+            # the Identifier an embedded field is named with, its type is type_
             self.embed_field = ident_list_or_embed_field
             self.ident_list = None
 
         self.type_ = type_
         self.tag = tag
+        self.pos, self.end = span
 
 
 class TypeDef(Node):
+
+    # its doc and line comments, see attach_comments
+    doc: Optional[CommentGroup] = None
+    comment: Optional[CommentGroup] = None
+
     def __init__(self, typename: tuple, type_: Type, lineno: int):
         self.typename = typename
         self.type_ = type_
+        self.lineno = lineno
 
         super().__init__(name="TypeDecl", children=[type_], data=typename)
 
@@ -929,14 +2531,58 @@ class TypeDef(Node):
             )
 
 
-def _optimize(node: Node) -> Node:
+class CoverStmt(Node):
+    """The counter of a basic block, which the coverage mode adds before
+    its statements (see cover.py), block is the cover.Block it counts the
+    runs of"""
+
+    def __init__(self, block):
+        super().__init__("COVER", children=[])
+        self.block = block
+        self.lineno = None
+
+
+class BadExpr(Node):
+    """An expression with a syntax error, like the arguments of a call,
+    the parser skips the tokens up to the closing parenthesis"""
+
+    def __init__(self, lineno: int, col_num: int):
+        super().__init__("BadExpr", children=[])
+        self.lineno = lineno
+        self.col_num = col_num
+
+
+class BadStmt(Node):
+    """A statement with a syntax error, the parser skips the tokens
+    up to the end of the statement"""
+
+    def __init__(self, lineno: int):
+        super().__init__("BadStmt", children=[])
+        self.lineno = lineno
+
+
+class BadDecl(Node):
+    """A top level declaration with a syntax error, the parser skips
+    the tokens up to the end of the declaration"""
+
+    def __init__(self, lineno: int):
+        super().__init__("BadDecl", children=[])
+        self.lineno = lineno
+
+
+def optimize_children(node: Node) -> Node:
+    """The node with the Lists among its children with a single child
+    replaced by it (a List of Lists is flattened), its children are
+    optimized afterwards, see optimize_AST"""
     num_list_childs = 0
 
     # a _no_optim attribute set to True signals this to not touch
     # the node's immediate children. Deeper children are optimized anyway.
     if not (hasattr(node, "_no_optim") and getattr(node, "_no_optim")):
         for i, child in enumerate(node.children):
-            if isinstance(child, List):
+            # blocks are kept as they are, for their scopes. So are the
+            # elements of composite literals, a nested one is an element
+            if isinstance(child, List) and not isinstance(child, (Block, LiteralValue)):
                 num_list_childs += 1
 
                 # if List has only one child, remove the list
@@ -945,8 +2591,14 @@ def _optimize(node: Node) -> Node:
                     if not isinstance(node.children[i], List):
                         num_list_childs -= 1
 
-        # if List has all List children, flatten out the nesting
-        if isinstance(node, List) and num_list_childs == len(node.children):
+        # if List has all List children, flatten out the nesting (an empty
+        # one is kept, it can be the one of a type shared by the packages)
+        if (
+            isinstance(node, List)
+            and not isinstance(node, LiteralValue)
+            and node.children
+            and num_list_childs == len(node.children)
+        ):
             new_children = List([])
 
             for child in node.children:
@@ -954,10 +2606,26 @@ def _optimize(node: Node) -> Node:
                 for child_child in child.children:
                     new_children.append(child_child)
 
-            node = new_children
+            if isinstance(node, Block):
+                # the same node is kept, statements like IfStmt refer to it
+                node.children = new_children.children
+            else:
+                node = new_children
+
+    return node
 
+
+def _optimize(node: Node, types: Optional[set] = None) -> Node:
+    # the types are visited once, a named type is in its own tree when a
+    # method of its interface (or a field of its struct) refers to it
+    types = set() if types is None else types
+    if isinstance(node, Type):
+        if id(node) in types:
+            return node
+        types.add(id(node))
+    node = optimize_children(node)
     for i, child in enumerate(node.children):
-        node.children[i] = _optimize(child)
+        node.children[i] = _optimize(child, types)
 
     return node
 
@@ -966,20 +2634,230 @@ def optimize_AST(ast: Node):
     return _optimize(ast)
 
 
-def _postprocess(node: Node) -> Node:
-
+def postprocess(node: Node, types: Optional[set] = None) -> Node:
+    """Resolves what the parser couldn't in the tree of node, like the
+    methods called before their declaration"""
+    types = set() if types is None else types
+    if isinstance(node, Type):
+        if id(node) in types:
+            return node
+        types.add(id(node))
     if isinstance(node, FunctionCall):
+        if node.receiver is not None and node.method is None:
+            node.resolve_method()
         if node.type_ is None:
             if node.fn_sym is not None:
-                if node.fn_sym.value is not None:
+                if isinstance(node.fn_sym.value, Function):
                     node.type_ = node.fn_sym.value.signature.ret_type
 
     for i, child in enumerate(node.children):
-        node.children[i] = _postprocess(child)
+        node.children[i] = postprocess(child, types)
 
     return node
 
 
 def postprocess_AST(ast: Node):
-    ast = _postprocess(ast)
+    ast = postprocess(ast)
     return _optimize(ast)
+
+
+# the attributes of the nodes which refer to other declarations, or to
+# nodes which are elsewhere in the tree
+_references = {"method", "fn_sym", "symbol", "receiver", "scope", "ident", "typename"}
+
+
+def walk(node, literals: bool = True):
+    """The nodes in the tree of node, the bodies of function literals
+    are left out unless literals"""
+    seen = set()
+
+    def visit(n):
+        if n is None or id(n) in seen or isinstance(n, Type):
+            return
+        if isinstance(n, (list, tuple)):
+            for item in n:
+                visit(item)
+            return
+        if not isinstance(n, Node):
+            return
+        seen.add(id(n))
+        yield_list.append(n)
+        if isinstance(n, Function) and not literals and n is not node:
+            return
+        for name, value in vars(n).items():
+            if name in _references or name.startswith("_"):
+                continue
+            if isinstance(value, (Node, list, tuple)):
+                visit(value)
+
+    yield_list: list = []
+    visit(node)
+    return yield_list
+
+
+def sub_nodes(node: Node) -> list:
+    """The nodes right under node, in its fields and its children, each
+    one once (in source order for the items of a List). Like walk, the
+    types and the references to the nodes elsewhere are left out"""
+    found: list = []
+    seen = set()
+
+    def add(value):
+        if isinstance(value, Type) or id(value) in seen:
+            return
+        if isinstance(value, Node):
+            seen.add(id(value))
+            found.append(value)
+        elif isinstance(value, (list, tuple)):
+            for item in value:
+                add(item)
+
+    for name, value in vars(node).items():
+        if name in _references or name.startswith("_"):
+            continue
+        if name == "children" and isinstance(node, List):
+            # built in reverse by the parser
+            value = list(reversed(value))
+        add(value)
+    return found
+
+
+class Visitor:
+    """visit is called with each node of a tree by visit_tree, its
+    result is the Visitor of the nodes under it (None skips them), like
+    go/ast.Visitor"""
+
+    def visit(self, node: Optional[Node]) -> Optional["Visitor"]:
+        return self
+
+
+def visit_tree(visitor: Visitor, node: Node, seen: Optional[set] = None):
+    """Walks the tree of node depth first, like go/ast.Walk: visitor.visit(node)
+    is called first, then the Visitor it returns (if not None) visits the
+    nodes under it (see sub_nodes) and is called with None afterwards.
+    The nodes in several fields (like the parameters of a function, in
+    its signature too) are visited once, in seen"""
+    seen = set() if seen is None else seen
+    seen.add(id(node))
+    w = visitor.visit(node)
+    if w is None:
+        return
+    for child in sub_nodes(node):
+        if id(child) not in seen:
+            visit_tree(w, child, seen)
+    w.visit(None)
+
+
+def inspect(node: Node, f: Callable[[Optional[Node]], bool]):
+    """Calls f with each node of the tree of node, depth first, like
+    go/ast.Inspect: the nodes under a node are only inspected if f returns
+    True for it, then f is called with None"""
+    class Inspector(Visitor):
+        def visit(self, n: Optional[Node]) -> Optional[Visitor]:
+            return self if f(n) else None
+
+    visit_tree(Inspector(), node)
+
+
+def rewrite(node: Node, f: Callable[[Node], Optional[Node]]) -> Optional[Node]:
+    """Rewrites the tree of node bottom up: f is called with each node once
+    the nodes under it are rewritten, and returns the node replacing it (the
+    same node to keep it), or None to remove it (from the lists it is in,
+    the fields it is in are set to None). The node replacing another one
+    takes its place in the children and in the fields of its parent, and
+    its span, if it has none (like the nodes made by f), so the positions
+    of the tree are still the ones of the source. Returns the node replacing
+    node. The tree has to be type checked again, checker.Info has the nodes
+    it had before"""
+    return _rewrite(node, f, {})
+
+
+def _rewrite(node: Node, f: Callable[[Node], Optional[Node]], done: dict) -> Optional[Node]:
+    # the nodes rewritten, by id, with the node replacing them: the ones
+    # in several fields are rewritten once, and replaced in all of them
+    done[id(node)] = (node, node)
+    for child in sub_nodes(node):
+        new = done[id(child)][1] if id(child) in done else _rewrite(child, f, done)
+        if new is not child:
+            replace(node, child, new)
+    new = f(node)
+    if new is not None and new is not node:
+        fix_position(new, node)
+    done[id(node)] = (node, new)
+    return new
+
+
+def replace(parent: Node, old: Node, new: Optional[Node]):
+    """Replaces old with new in the children and in the fields of
+    parent, old is removed from them if new is None"""
+    def replaced(value):
+        if value is old:
+            return new
+        elif isinstance(value, list):
+            items = [new if item is old else item for item in value]
+            value[:] = [item for item in items if item is not None]
+        elif isinstance(value, tuple) and any(item is old for item in value):
+            return tuple(item for item in (new if item is old else item for item in value)
+                         if item is not None)
+        return value
+
+    for name, value in list(vars(parent).items()):
+        if name in _references or name.startswith("_"):
+            continue
+        setattr(parent, name, replaced(value))
+
+
+def fix_position(new: Node, old: Node):
+    """Gives new, which replaces old, the span and the line of old if it
+    doesn't have them"""
+    if new.pos == NoPos:
+        new.pos, new.end = old.pos, old.end
+    for name in ("lineno", "col_num"):
+        if getattr(new, name, None) is None and getattr(old, name, None) is not None:
+            setattr(new, name, getattr(old, name))
+
+
+def function_names(ast: Node, path: str) -> Dict[int, str]:
+    """The names of the functions of a package in the stack trace of a
+    panic, by id of their node, like Go prints them: main.f, main.(*T).m,
+    main.Map[...] for a generic function and main.main.func1 for the first
+    function literal of main (main.main.func1.func1 for one in it). path is
+    the import path of the package, main for the one of the program"""
+    names: Dict[int, str] = {}
+
+    def literals(fn: Function, name: str):
+        found = sorted((n for n in walk(fn.body, literals=False)
+                        if isinstance(n, Function) and n.fn_name is None),
+                       key=lambda n: (n.pos, n._serial))
+        for i, literal in enumerate(found, 1):
+            names[id(literal)] = f"{name}.func{i}"
+            literals(literal, names[id(literal)])
+
+    inits = 0
+    package_literals = []
+    for fn in sorted((n for n in walk(ast, literals=False) if isinstance(n, Function)),
+                     key=lambda n: (n.pos, n._serial)):
+        if fn.fn_name is None:
+            package_literals.append(fn)
+            continue
+        name = fn.fn_name[1]
+        if isinstance(fn, Method):
+            base = fn.base_type
+            typename = getattr(base, "typename", None) or str(base)
+            if isinstance(base, NamedType) and base.origin is not None:
+                typename = base.origin.typename
+            if fn.type_params:
+                typename += "[...]"
+            name = f"(*{typename}).{name}" if fn.pointer_receiver else f"{typename}.{name}"
+        elif name == "init":
+            name = f"init.{inits}"
+            inits += 1
+        elif fn.signature.type_params:
+            name += "[...]"
+        names[id(fn)] = f"{path}.{name}"
+        if fn.body is not None:
+            literals(fn, names[id(fn)])
+    for i, literal in enumerate(package_literals, 1):
+        names[id(literal)] = f"{path}.init.func{i}"
+        literals(literal, names[id(literal)])
+    return names
@@ -1,12 +1,15 @@
 import abc
+import copy
+import constant
+import diagnostics
 import syntree
+import untyped
 
 from collections import defaultdict
 from symbol_table import SymbolInfo
-from typing import Any, Dict, List, Optional, Tuple
+from typing import Any, Dict, List, Optional, Set, Tuple
 from tabulate import tabulate
 from go_lexer import symtab  # type_table
-from utils import print_error, print_line_marker_nowhitespace
 from syntree import infer_expr_typename
 
 
@@ -68,6 +71,34 @@ class Call(Quad):
         return f"{self.dest} = call {self.op2}"
 
 
+class Go(Quad):
+    """Starts a goroutine running the function label_name (or the value
+    of a TempVar, for dynamic calls), the arguments are pushed before
+    it like for a call. The results are discarded"""
+
+    def __init__(self, label_name: Any):
+        self.label_name = label_name
+
+        super().__init__(None, None, label_name, "go")
+
+    def __str__(self):
+        return f"go {self.op2}"
+
+
+class Defer(Quad):
+    """Defers the call of the function label_name (or of a function of
+    the runtime, for builtins like close), with the arguments pushed
+    before it. The deferred calls are done by rundefers()"""
+
+    def __init__(self, label_name: Any):
+        self.label_name = label_name
+
+        super().__init__(None, None, label_name, "defer")
+
+    def __str__(self):
+        return f"defer {self.op2}"
+
+
 class ConditionalGoTo(Quad):
     """if operation goto label_name1 else goto label_name2"""
 
@@ -90,6 +121,64 @@ class ConditionalGoTo(Quad):
             )
 
 
+class Store(Quad):
+    """Stores a value to an element or a field of a variable"""
+
+    def __init__(self, ref: "MemoryRef", value: Any):
+        self.indirect = ref.indirect
+        super().__init__(ref.base, ref.address, value, "[]=")
+
+    def __str__(self):
+        return f"{self.dest} [] {self.op1} = {self.op2}"
+
+
+class MapStore(Store):
+    """Stores a value to the element of a map with a key, like m[k] = v"""
+
+    def __init__(self, ref: "MapRef", value: Any):
+        super().__init__(ref, value)
+
+    def __str__(self):
+        return f"{self.dest}[{self.op1}] = {self.op2}"
+
+
+class AddressOf(Quad):
+    """Address of a variable"""
+
+    def __init__(self, dest: "TempVar", var: "Operand"):
+        super().__init__(dest, var, None, "base")
+
+    def __str__(self):
+        return f"{self.dest} = base({self.op1})"
+
+
+class RuntimeCall(Quad):
+    """Call of a function of the runtime, like iface(Point, p),
+    see the README for the functions
+
+    Arguments after the first two are constants, like the widths of
+    elements, so the optimizations need to look at op1 and op2 only"""
+
+    # functions which change memory, the calls are kept even if
+    # their results are not used
+    effects = (
+        "assert", "copy", "delete",
+        # channel operations block until they can be done
+        "send", "recv", "close", "selectsend", "selectrecv", "select",
+        "panic", "recover", "rundefers",
+    )
+
+    def __init__(self, dest: "TempVar", fn: str, arg1: Any, arg2: Any = None, *args: Any):
+        super().__init__(dest, arg1, arg2, fn)
+        self.args = args
+
+    def __str__(self):
+        args = [str(arg) for arg in (self.op1, self.op2, *self.args) if arg is not None]
+        call = f"{self.operator}({', '.join(args)})"
+        # calls without a result, like delete(m, k)
+        return call if self.dest is None else f"{self.dest} = {call}"
+
+
 class Single(Quad):
     """Quad to store a single value like a keyword"""
 
@@ -109,6 +198,8 @@ class Double(Quad):
     def __str__(self):
         if self.dest is None:
             return f"{self.operator} {self.op2}"
+        elif self.op2 is None:
+            return f"{self.dest} = {self.operator}"
         else:
             return f"{self.dest} = {self.operator} {self.op2}"
 
@@ -257,6 +348,82 @@ class ActualVar(Operand):
         return f"<ActualVar {self.name}>"
 
 
+class MemoryRef:
+    """An element or a field of a variable (or a temporary), as the target
+    of an assignment. address is base(variable) + offset of the element
+
+    The memory is indirect if it is reached through a pointer, it is
+    not the variable's own then"""
+
+    def __init__(self, base: Operand, address: Any, type_: Any, indirect: bool = False):
+        self.base = base
+        self.address = address
+        self.type_ = type_
+        self.indirect = indirect
+
+    def __str__(self):
+        return f"{self.base} [] {self.address}"
+
+
+class MapRef(MemoryRef):
+    """The element of a map with a key, like m[k]. Maps are not
+    addressable, elements are read with lookup(m, k) and stored to by
+    the runtime, so the memory is always indirect"""
+
+    def __init__(self, base: Operand, key: Any, type_: Any):
+        super().__init__(base, key, type_, indirect=True)
+
+    def __str__(self):
+        return f"{self.base}[{self.address}]"
+
+
+class CompositeValue:
+    """Value of a composite literal (or the zero value of an array or a
+    struct). Elements are in order, fields are in the declared order"""
+
+    def __init__(self, elements: list):
+        # values or operands, nested CompositeValues for nested literals
+        self.elements = elements
+
+    def operands(self) -> List[Operand]:
+        """Operands used by the elements, nested ones too"""
+        operands = []
+        for element in self.elements:
+            if isinstance(element, CompositeValue):
+                operands.extend(element.operands())
+            elif isinstance(element, Operand):
+                operands.append(element)
+        return operands
+
+    def replace(self, operands: dict) -> "CompositeValue":
+        """Same value, with the operands replaced by the ones mapped to"""
+        elements = []
+        for element in self.elements:
+            if isinstance(element, CompositeValue):
+                element = element.replace(operands)
+            elif isinstance(element, Operand) and element in operands:
+                element = operands[element]
+            elements.append(element)
+        return CompositeValue(elements)
+
+    def __str__(self):
+        return "{" + ", ".join(map(str, self.elements)) + "}"
+
+
+class FunctionLiteral:
+    """A function literal to generate, with the state of the symtab
+    where it is declared and the variables it captures"""
+
+    def __init__(self, label: str, node: syntree.Function, captures: List[SymbolInfo]):
+        self.label = label
+        self.node = node
+        self.captures = captures
+        self.scopes = (symtab.cur_scope, symtab.depth, list(symtab.stack),
+                       dict(symtab.scopes_at_depth))
+        # the type arguments of the instance of a generic function it is in
+        self.type_args = dict(syntree.type_args)
+
+
 class IntermediateCode:
     def __init__(self):
         self.code_list: List[Quad] = []
@@ -264,11 +431,76 @@ class IntermediateCode:
         self.label_prefix_counts: Dict[str, int] = defaultdict(lambda: 0)
         self.label_map: Dict[str, Label] = {}
         self.loop_stack: List[Tuple[str, str]] = []
+        # targets of break statements, for loops and switches
+        self.break_stack: List[str] = []
+        # the labels of the labeled statements, and the (continue, break)
+        # targets of the labeled loops and switches, by (function, instance,
+        # name), see user_label. The label of the statement being generated,
+        # for the loop or switch it labels
+        self.user_labels: Dict[tuple, str] = {}
+        self.label_targets: Dict[tuple, Tuple[Optional[str], str]] = {}
+        self.labeling: Optional[tuple] = None
+        self.function_stack: List[syntree.Function] = []
+        # values of the VarSpecs unpacked so far, like var a, b = f()
+        self.unpacked: Dict[int, List[Any]] = {}
+        # the labels of the init functions but the first one of a
+        # package, by their id, see _declare_functions
+        self.init_labels: Dict[int, str] = {}
+        # the (start, end) of the code of each package level variable
+        # declaration in code_list, by its id, see initialization_order
+        self.var_code: Dict[int, List[int]] = {}
+        # ids of the PrimaryExprs assigned to, see tac_pre_Assignment
+        self.assign_targets: Set[int] = set()
+        # receivers of method calls by the id of the Arguments,
+        # see tac_pre_FunctionCall
+        self.receivers: Dict[int, Any] = {}
+        # types of the parameters of the called functions, by the id of
+        # the Arguments. Arguments are converted to interface parameters
+        self.parameter_types: Dict[int, list] = {}
+        # the number of fixed parameters of the variadic functions called,
+        # by the id of the Arguments. The other arguments are packed in a slice
+        self.variadic: Dict[int, int] = {}
+        # methods of the interface values called, by the id of the call
+        self.dynamic_calls: Dict[int, TempVar] = {}
+        # ids of the comma-ok expressions giving two values, like x.(T)
+        self.comma_ok: Set[int] = set()
+        # ids of the Arguments of builtin calls, these are not pushed
+        self.builtin_args: Set[int] = set()
+        # ids of the calls of go statements, see tac_pre_GoStmt
+        self.go_calls: Set[int] = set()
+        # ids of the calls of defer statements, see tac_pre_DeferStmt
+        self.deferred_calls: Set[int] = set()
+        # if each function in function_stack has defer statements
+        self.defer_stack: List[bool] = []
+        # the scope counters of the symtab where each generic function (or
+        # method of a generic type) is declared, by id. See generate_instances
+        self.generics: Dict[int, Dict[int, int]] = {}
+        # the instances to generate, (label name, function, type arguments)
+        self.instances: List[Tuple[str, syntree.Function, list]] = []
+        # the generic function of the instance being generated, and its label
+        self.generating: Optional[syntree.Function] = None
+        self.instance_label: Optional[str] = None
+        # the variables captured by each function literal (by its id), and
+        # the ids of their symbols. Each one is in memory of its own, the
+        # variable holds its address, see boxed_ref
+        self.captures: Dict[int, List[SymbolInfo]] = {}
+        self.boxed: Set[int] = set()
+        # the function literals to generate, see generate_literals, and
+        # the number of literals in each function, by its label
+        self.literals: List[FunctionLiteral] = []
+        self.literal_counts: Dict[str, int] = defaultdict(lambda: 0)
+        # the function literal being generated, and the addresses of the
+        # variables it captures (by the id of their symbols)
+        self.literal: Optional[FunctionLiteral] = None
+        self.captured: Dict[int, TempVar] = {}
 
         # BUILT-IN functions (or labels)
         self._add_label(self.get_fn_label("fmt__Println"))
         self._add_label(self.get_fn_label("fmt__Printf"))
         self._add_label(self.get_fn_label("fmt__Print"))
+        self._add_label(self.get_fn_label("fmt__Sprintln"))
+        self._add_label(self.get_fn_label("fmt__Sprintf"))
+        self._add_label(self.get_fn_label("fmt__Sprint"))
 
     def get_new_temp_var(self, value: Any = None):
         self.temp_var_count += 1
@@ -277,6 +509,26 @@ class IntermediateCode:
     def add_to_list(self, code: Quad):
         self.code_list.append(code)
 
+    def add_assign(self, dest: Any, value: Any):
+        """dest can be a variable, or an element or a field of one"""
+        if isinstance(dest, MapRef):
+            self.add_to_list(MapStore(dest, value))
+        elif isinstance(dest, MemoryRef):
+            self.add_to_list(Store(dest, value))
+        else:
+            self.add_to_list(Assign(dest, value))
+
+    def add_load(self, ref: MemoryRef) -> TempVar:
+        temp = self.get_new_temp_var()
+        temp.type_ = ref.type_
+        if isinstance(ref, MapRef):
+            # the zero value of the element if the key is not in the map
+            self.add_to_list(RuntimeCall(temp, "lookup", ref.base, ref.address))
+        else:
+            self.add_to_list(Quad(temp, ref.base, ref.address, "[]"))
+
+        return temp
+
     # generating labels
     @staticmethod
     def get_fn_label(fn_name: str):
@@ -296,7 +548,7 @@ class IntermediateCode:
 
     def add_label(self, label_name: str) -> Label:
         """Add given label name. For named labels like functions, etc."""
-        if label_name in self.label_map:
+        if label_name in self.label_map and self.label_map[label_name].index != -1:
             raise Exception(f"Label {label_name} already exists")
 
         label = self._add_label(label_name, len(self.code_list))
@@ -336,10 +588,26 @@ class IntermediateCode:
         return call_stmt
 
     def enter_new_loop(self, start_label: str, end_label: str):
+        """start_label is where a continue goes to, and end_label
+        is where a break goes to"""
         self.loop_stack.append((start_label, end_label))
+        self.break_stack.append(end_label)
+        if self.labeling is not None:
+            self.label_targets[self.labeling] = (start_label, end_label)
+            self.labeling = None
 
     def exit_loop(self):
         self.loop_stack.pop()
+        self.break_stack.pop()
+
+    def enter_new_switch(self, end_label: str):
+        self.break_stack.append(end_label)
+        if self.labeling is not None:
+            self.label_targets[self.labeling] = (None, end_label)
+            self.labeling = None
+
+    def exit_switch(self):
+        self.break_stack.pop()
 
     def is_inloop(self):
         return len(self.loop_stack) > 0
@@ -364,20 +632,114 @@ class IntermediateCode:
         )
 
 
+def expression_values(result: List[Any]) -> List[Any]:
+    """Values of an expression (list) in source order, from the return
+    value of _recur_codegen. A call can give multiple values"""
+    if result and isinstance(result[0], list):
+        if len(result) == 1:
+            return result[0]
+        # a List of expressions, in reverse order
+        return [r[0] if r else None for r in reversed(result)]
+    return result
+
+
+def expression_nodes(node: syntree.Node) -> List[syntree.Node]:
+    """Expressions of an expression List (or a single one) in source order"""
+    if isinstance(node, syntree.List):
+        return list(reversed(node.children))
+    return [node]
+
+
+def concrete(type_: Any) -> Any:
+    """type_ in the instance of the generic function being generated, like
+    int for T in Max[int]. Typenames of type parameters are replaced too"""
+    if not syntree.type_args:
+        return type_
+    if isinstance(type_, str):
+        sym = symtab.get_symbol(type_)
+        if sym is not None and isinstance(sym.value, syntree.TypeParam):
+            return syntree.substitute(sym.value, syntree.type_args).typename
+        return type_
+    return syntree.substitute(type_, syntree.type_args)
+
+
+def convert(ic: IntermediateCode, value: Any, from_type: Any, to_type: Any) -> Any:
+    """value (of type from_type) converted to to_type, for an assignment
+
+    Only conversions to interfaces generate code, the value of an
+    interface is the dynamic type along with the value"""
+    from_type, to_type = concrete(from_type), concrete(to_type)
+    if (not syntree.is_interface(to_type) or not isinstance(from_type, syntree.Type)
+            or syntree.is_interface(from_type)):
+        return value
+    # the methods of an instance of a generic type can be called dynamically
+    instance = from_type.base if isinstance(from_type, syntree.Pointer) else from_type
+    if isinstance(instance, syntree.NamedType) and instance.origin is not None:
+        for method in instance.origin.methods.values():
+            instance_label(ic, method, instance.type_args)
+    temp = ic.get_new_temp_var()
+    temp.type_ = to_type.typename
+    ic.add_to_list(RuntimeCall(temp, "iface", from_type.typename, value))
+    return temp
+
+
+def tac_pre_Assignment(ic: IntermediateCode, node: syntree.Assignment):
+    # elements and fields assigned to are stored to,
+    # instead of loading their values
+    targets = node.children[0]
+    if not isinstance(targets, syntree.List):
+        targets = [targets]
+    for target in targets:
+        if isinstance(target, syntree.PrimaryExpr) or is_indirection(target):
+            ic.assign_targets.add(id(target))
+
+    values = expression_nodes(node.children[1])
+    if len(targets) == 2 and len(values) == 1 and syntree.is_comma_ok(values[0]):
+        ic.comma_ok.add(id(values[0]))
+
+
 def tac_Assignment(
     ic: IntermediateCode,
     node: syntree.Assignment,
     new_children: List[List[Any]],
     return_val: List[Any],
 ):
-    left = new_children[0][0]
-    right = new_children[1][0]
-    if len(node.operator) == 2 and node.operator[1] == "=":
-        ic.add_to_list(Quad(left, left, right, node.operator[0]))
-        return_val.append(left)
+    left = expression_values(new_children[0])
+    right = expression_values(new_children[1])
+    if node.operator != "=":
+        # x op= y, like x &^= y or x <<= y
+        operator = node.operator[:-1]
+        if isinstance(left[0], MemoryRef):
+            current = ic.add_load(left[0])
+            temp = ic.get_new_temp_var()
+            temp.type_ = concrete(node.type_)
+            ic.add_to_list(Quad(temp, current, right[0], operator))
+            ic.add_assign(left[0], temp)
+        else:
+            ic.add_to_list(Quad(left[0], left[0], right[0], operator))
+        return_val.append(left[0])
     elif node.operator == "=":
-        ic.add_to_list(Assign(left, right))
-        return_val.append(left)
+        if len(left) > 1:
+            # all the values are evaluated before assigning any of
+            # them, so variables are copied, like for a, b = b, a
+            for i, value in enumerate(right):
+                if isinstance(value, ActualVar):
+                    temp = ic.get_new_temp_var()
+                    temp.type_ = getattr(value.type_, "typename", value.type_)
+                    ic.add_to_list(Assign(temp, value))
+                    right[i] = temp
+
+        exprs = expression_nodes(node.children[1])
+        if len(exprs) != len(right):
+            # values of a call with multiple results
+            exprs = [None] * len(right)
+        for dest, value, expr in zip(left, right, exprs):
+            # dest is None for the blank identifier
+            if dest is not None:
+                dest_type = dest.type_ if isinstance(dest, MemoryRef) else dest.symbol.type_
+                value = convert(ic, value, syntree.infer_expr_type(expr), dest_type)
+                ic.add_assign(dest, value)
+        return_val.extend(left)
 
     return_val.append(node)
 
@@ -389,7 +751,7 @@ def tac_BinOp(
     return_val: List[Any],
 ):
     temp = ic.get_new_temp_var()
-    temp.type_ = node.type_
+    temp.type_ = concrete(node.type_)
 
     # the children can be temporaries made in the _recur_codegen call above
     # so they are stored in new_children which is used here
@@ -399,6 +761,20 @@ def tac_BinOp(
     return_val.append(temp)
 
 
+def tac_pre_UnaryOp(ic: IntermediateCode, node: syntree.UnaryOp):
+    if node.operator == "++" or node.operator == "--":
+        if isinstance(node.operand, syntree.PrimaryExpr) or is_indirection(node.operand):
+            ic.assign_targets.add(id(node.operand))
+    elif node.operator == "&" and node.operand in node.children:
+        # the address is generated by tac_UnaryOp, see address_of
+        node.children.remove(node.operand)
+
+
+def is_indirection(node: syntree.Node) -> bool:
+    """If node is a pointer indirection, like *p"""
+    return isinstance(node, syntree.UnaryOp) and node.operator == "*"
+
+
 def tac_UnaryOp(
     ic: IntermediateCode,
     node: syntree.UnaryOp,
@@ -407,21 +783,61 @@ def tac_UnaryOp(
 ):
     if node.operator == "++" or node.operator == "--":
 
-        ic.add_to_list(
-            Quad(new_children[0][0], new_children[0][0], 1, node.operator[0])
-        )
+        if isinstance(new_children[0][0], MemoryRef):
+            current = ic.add_load(new_children[0][0])
+            temp = ic.get_new_temp_var()
+            temp.type_ = concrete(node.type_)
+            ic.add_to_list(Quad(temp, current, 1, node.operator[0]))
+            ic.add_assign(new_children[0][0], temp)
+        else:
+            ic.add_to_list(
+                Quad(new_children[0][0], new_children[0][0], 1, node.operator[0])
+            )
 
         return_val.append(new_children[0][0])
 
+    elif node.operator == "&":
+        return_val.append(address_of(ic, node.operand))
+
+    elif node.operator == "<-":
+        # blocks until a value is sent, or the channel is closed
+        ch = as_operand(ic, new_children[0][0])
+        value = ic.get_new_temp_var()
+        type_ = concrete(node.type_)
+        value.type_ = getattr(type_, "typename", type_)
+        ic.add_to_list(RuntimeCall(value, "recv", ch))
+        return_val.append(value)
+        if id(node) in ic.comma_ok:
+            ok = ic.get_new_temp_var()
+            ok.type_ = "bool"
+            ic.add_to_list(RuntimeCall(ok, "recvok", ch))
+            return_val.append(ok)
+
+    elif node.operator == "*":
+        # the pointer is the address of the variable pointed to
+        pointer = as_operand(ic, new_children[0][0])
+        ref = MemoryRef(pointer, pointer, concrete(node.type_), indirect=True)
+        if id(node) in ic.assign_targets:
+            return_val.append(ref)
+        else:
+            return_val.append(ic.add_load(ref))
+
     else:
         temp = ic.get_new_temp_var()
-        temp.type_ = node.type_
+        temp.type_ = concrete(node.type_)
 
         ic.add_to_list(Double(node.operator, new_children[0][0], temp))
 
         return_val.append(temp)
 
 
+def tac_pre_Literal(ic: IntermediateCode, node: syntree.Literal):
+    # the elements of a composite literal are generated by tac_Literal,
+    # since the types of elided elements are known only from the literal
+    if isinstance(node.value, syntree.LiteralValue) and node.value in node.children:
+        node.children.remove(node.value)
+
+
 def tac_Literal(
     ic: IntermediateCode,
     node: syntree.Literal,
@@ -436,15 +852,186 @@ def tac_Literal(
 
     if not isinstance(node.value, syntree.Node):
         return_val.append(node)
+    elif isinstance(node.value, syntree.LiteralValue):
+        return_val.append(composite_value(ic, node.type_, node.value))
     else:
-        if len(new_children) > 1:
-            if isinstance(new_children[0][0], syntree.Array):
-                arr = "{" + ", ".join(map(lambda x: str(x[0]), new_children[1])) + "}"
-                return_val.append(arr)
+        return_val.append(node)
+
+
+def composite_value(
+    ic: IntermediateCode, type_: syntree.Type, literal_value: syntree.LiteralValue
+) -> CompositeValue:
+    """Generates the elements of a composite literal of type_ in order,
+    the elements (or fields) not given have their zero value"""
+    t = type_.underlying()
+    # Lists are in reverse order
+    elements = list(reversed(literal_value.children))
+
+    if isinstance(t, syntree.Struct):
+        values = {}
+        for i, element in enumerate(elements):
+            if isinstance(element, syntree.KeyedElement):
+                key = element.key
+                field_ = None
+                if isinstance(key, syntree.PrimaryExpr) and isinstance(key.data, tuple):
+                    field_ = t.field(key.data[1])
+                element = element.value
             else:
-                return_val.append(new_children[1][0])
-        else:
-            return_val.append(new_children[0][0])
+                field_ = t.fields[i] if i < len(t.fields) else None
+            if field_ is not None:
+                values[field_.f_name] = element_value(ic, field_.type_, element)
+
+        return CompositeValue([
+            values[f.f_name] if f.f_name in values else zero_value(f.type_)
+            for f in t.fields
+        ])
+
+    elif isinstance(t, (syntree.Array, syntree.Slice)):
+        values = {}
+        index = 0
+        for element in elements:
+            if isinstance(element, syntree.KeyedElement):
+                # indices are constants, checked by the type checker
+                try:
+                    index = int(constant.evaluate(element.key).value)
+                except constant.ConstError:
+                    continue
+                element = element.value
+            values[index] = element_value(ic, t.eltype, element)
+            index += 1
+
+        if isinstance(t, syntree.Slice):
+            return new_slice(ic, t, values)
+        return CompositeValue([
+            values[i] if i in values else zero_value(t.eltype) for i in range(t.length)
+        ])
+
+    elif isinstance(t, syntree.Map):
+        m = ic.get_new_temp_var()
+        m.type_ = type_.typename
+        ic.add_to_list(RuntimeCall(m, "makemap", len(elements)))
+        for element in elements:
+            if not isinstance(element, syntree.KeyedElement):
+                # a missing key, reported by the type checker
+                continue
+            key = element_value(ic, t.key, element.key)
+            value = element_value(ic, t.eltype, element.value)
+            ic.add_assign(MapRef(m, as_operand(ic, key, t.key), t.eltype), value)
+        return m
+
+    return CompositeValue([])
+
+
+def new_slice(ic: IntermediateCode, type_: syntree.Slice, values: Dict[int, Any]) -> CompositeValue:
+    """Header of a slice literal, the elements are stored in a new array
+    (its memory is zeroed, so the elements not given are not stored)"""
+    width = type_.eltype.storage
+    length = max(values, default=-1) + 1
+    array = ic.get_new_temp_var()
+    array.type_ = "int"
+    ic.add_to_list(RuntimeCall(array, "new", length * width))
+    for index, value in sorted(values.items()):
+        address = arith(ic, "+", array, index * width) if index else array
+        ic.add_to_list(Store(MemoryRef(array, address, type_.eltype, indirect=True), value))
+    return CompositeValue([array, length, length])
+
+
+def pack_variadic(
+    ic: IntermediateCode, fixed: int, type_: syntree.Slice, values: List[Any], exprs: List[Any]
+) -> Tuple[List[Any], List[Any]]:
+    """The arguments of a call of a variadic function (in push order) with
+    the ones after the fixed parameters packed in a new slice, nil if there
+    are none. A multi-value call as the arguments has no expression per value"""
+    values = list(reversed(values))
+    if len(exprs) != len(values):
+        exprs = [None] * len(values)
+    elements = {
+        index: convert(ic, value, syntree.infer_expr_type(expr), type_.eltype)
+        for index, (value, expr) in enumerate(zip(values[fixed:], exprs[fixed:]))
+    }
+    packed = new_slice(ic, type_, elements) if elements else CompositeValue([0, 0, 0])
+    values = values[:fixed] + [packed]
+    # the type of the slice as its expression, it is not converted again
+    exprs = exprs[:fixed] + [type_]
+    return list(reversed(values)), list(reversed(exprs))
+
+
+def arith(ic: IntermediateCode, operator: str, x: Any, y: Any) -> TempVar:
+    """An int operation, like an offset added to an address"""
+    if isinstance(x, int):
+        x = syntree.Literal("int", x, None)
+    if isinstance(y, int):
+        y = syntree.Literal("int", y, None)
+    temp = ic.get_new_temp_var()
+    temp.type_ = "int"
+    ic.add_to_list(Quad(temp, x, y, operator))
+    return temp
+
+
+def as_operand(ic: IntermediateCode, value: Any, type_: Any = None) -> Any:
+    """value in a temporary, if it is a composite value like a slice header"""
+    if not isinstance(value, CompositeValue):
+        return value
+    temp = ic.get_new_temp_var()
+    temp.type_ = getattr(type_, "typename", None)
+    ic.add_to_list(Assign(temp, value))
+    return temp
+
+
+def header_word(ic: IntermediateCode, header: Any, offset: int) -> TempVar:
+    """A word of a slice header: the address of the array (offset 0),
+    the length (8) or the capacity (16)"""
+    if isinstance(header, CompositeValue):
+        word = header.elements[offset // 8]
+        if isinstance(word, int):
+            word = syntree.Literal("int", word, None)
+        return word
+    address = ic.get_new_temp_var()
+    address.type_ = "int"
+    ic.add_to_list(AddressOf(address, header))
+    if offset:
+        address = arith(ic, "+", address, offset)
+    return ic.add_load(MemoryRef(header, address, "int"))
+
+
+def slice_value(
+    ic: IntermediateCode, value: Any, type_: Any, indices: list
+) -> CompositeValue:
+    """Header of a slice of an array or of a slice, like a[low:high:max]
+
+    For an array, value is its address. For a slice, value is its
+    header. The new slice starts at the low element of the same array,
+    so they share the elements"""
+    t = type_.underlying()
+    if isinstance(t, syntree.Pointer):
+        t = t.base.underlying()
+    low, high, max_ = indices
+    if isinstance(t, syntree.Array):
+        array, length, capacity = value, t.length, t.length
+    else:
+        array = header_word(ic, value, 0)
+        length = header_word(ic, value, 8) if high is None else None
+        capacity = header_word(ic, value, 16) if max_ is None else None
+
+    high = length if high is None else high
+    max_ = capacity if max_ is None else max_
+    if low is None or isinstance(low, syntree.Literal) and str(low.value) == "0":
+        return CompositeValue([array, high, max_])
+
+    offset = arith(ic, "*", low, t.eltype.storage)
+    return CompositeValue([
+        arith(ic, "+", array, offset),
+        arith(ic, "-", high, low),
+        arith(ic, "-", max_, low),
+    ])
+
+
+def element_value(ic: IntermediateCode, type_: syntree.Type, element: syntree.Node) -> Any:
+    if isinstance(element, syntree.LiteralValue):
+        # the type of the element is elided, like in []Point{{1, 2}}
+        return composite_value(ic, type_, element)
+    value = _recur_codegen(element, ic)[0]
+    return convert(ic, value, syntree.infer_expr_type(element), type_)
 
 
 def tac_Keyword(
@@ -455,20 +1042,131 @@ def tac_Keyword(
 ):
     if node.kw == "RETURN":
         if len(new_children) > 0 and len(new_children[0]) > 0:
-            ic.add_to_list(Double("return", new_children[0][0]))
+            values = expression_values(new_children[0])
+            exprs = expression_nodes(node.children[0])
+            types = ic.function_stack[-1].signature.result_types if ic.function_stack else []
+            if len(exprs) == len(values) == len(types):
+                values = [
+                    convert(ic, value, syntree.infer_expr_type(expr), type_)
+                    for value, expr, type_ in zip(values, exprs, types)
+                ]
+            # the results are set before the deferred calls run
+            run_defers(ic)
+            # the first result is returned, the others are
+            # pushed on the stack in reverse order (like arguments)
+            for value in reversed(values[1:]):
+                ic.add_to_list(Double("push", value))
+            ic.add_to_list(Double("return", values[0]))
+        elif ic.function_stack and ic.function_stack[-1].signature.has_named_results:
+            # a return without values returns the named results
+            results = ic.function_stack[-1].signature.result
+            values = [
+                variable_value(ic, symtab.get_symbol(ident.ident_name))
+                for para in results
+                for ident in reversed(para.ident_list.children)
+            ]
+            run_defers(ic)
+            for value in reversed(values[1:]):
+                ic.add_to_list(Double("push", value))
+            ic.add_to_list(Double("return", values[0]))
         else:
+            run_defers(ic)
             ic.add_to_list(Single("return"))
-    elif node.kw == "BREAK" or node.kw == "CONTINUE":
+    elif node.label is not None:
+        # the checker reported the labels which aren't targets
+        key = label_key(ic, node.label.ident_name)
+        if node.kw == "GOTO":
+            ic.add_goto(user_label(ic, node.label.ident_name))
+        elif key in ic.label_targets:
+            continue_label, break_label = ic.label_targets[key]
+            ic.add_goto(break_label if node.kw == "BREAK" else continue_label)
+    elif node.kw == "BREAK":
+        if not ic.break_stack:
+            diagnostics.error(
+                f"Invalid keyword usage: {node.kw} not allowed outside a loop or switch",
+                node.lineno, code="MisplacedBreak"
+            )
+        else:
+            ic.add_goto(ic.break_stack[-1])
+    elif node.kw == "CONTINUE":
         if not ic.is_inloop():
-            print_error("Invalid keyword usage")
-            print(f"Keyword {node.kw} not allowed outside a loop")
-            print_line_marker_nowhitespace(node.lineno)
+            diagnostics.error(
+                f"Invalid keyword usage: {node.kw} not allowed outside a loop",
+                node.lineno, code="MisplacedBreak"
+            )
+        else:
+            ic.add_goto(ic.get_nearest_loop()[0])
+    elif node.kw == "FALLTHROUGH":
+        # handled by tac_pre_SwitchStmt, the next case body follows
+        pass
     else:
         print(f"Keyword {node.kw} not implemented yet!")
 
     return_val.append(node)
 
 
+def label_key(ic: IntermediateCode, name: str) -> tuple:
+    # labels are in the scope of their function (of the instance
+    # generated, for a generic one)
+    return id(ic.function_stack[-1]), ic.instance_label, name
+
+
+def user_label(ic: IntermediateCode, name: str) -> str:
+    """The label of the statement labeled name in the function, added when
+    it is first used: a goto can be before its label"""
+    key = label_key(ic, name)
+    if key not in ic.user_labels:
+        ic.user_labels[key] = ic.get_new_increment_label(f"label_{name}")
+        ic._add_label(ic.user_labels[key])
+    return ic.user_labels[key]
+
+
+def tac_pre_LabeledStmt(ic: IntermediateCode, node: syntree.LabeledStmt):
+    ic.add_label(user_label(ic, node.label.ident_name))
+    if isinstance(node.stmt, (syntree.ForStmt, syntree.SwitchStmt, syntree.SelectStmt)):
+        # the loop or the switch is the target of break and continue
+        ic.labeling = label_key(ic, node.label.ident_name)
+
+
+def tac_pre_PrimaryExpr(ic: IntermediateCode, node: syntree.PrimaryExpr):
+    # fields and elements of a pointed value, like (*p).x, are
+    # reached through the pointer, like for p.x
+    if node.data is None and node.children and is_indirection(node.children[0]):
+        ic.assign_targets.add(id(node.children[0]))
+
+
+def tac_QualifiedIdent(
+    ic: IntermediateCode,
+    node: syntree.QualifiedIdent,
+    new_children: List[List[Any]],
+    return_val: List[Any],
+):
+    # a variable or a constant of an imported package, like geometry.Origin
+    if node.symbol is None:
+        return_val.append(node)
+    elif declared_function(node.symbol) is not None:
+        return_val.append(function_value(ic, node.symbol.value))
+    else:
+        return_val.append(ActualVar(node.symbol))
+
+
+def declared_function(symbol: Optional[SymbolInfo]) -> Optional[syntree.Function]:
+    """The function declared by symbol, None for variables (of function types)"""
+    if (symbol is not None and symbol.const and isinstance(symbol.value, syntree.Function)
+            and symbol.value.fn_name is not None):
+        return symbol.value
+    return None
+
+
+def function_value(ic: IntermediateCode, fn: syntree.Function) -> TempVar:
+    """A declared function used as a value, like f in apply(f, x), is a
+    closure without captured variables"""
+    closure = ic.get_new_temp_var()
+    closure.type_ = infer_expr_typename(fn)
+    ic.add_to_list(RuntimeCall(closure, "closure", ic.get_fn_label(fn.label_name)))
+    return closure
+
+
 def tac_PrimaryExpr(
     ic: IntermediateCode,
     node: syntree.PrimaryExpr,
@@ -478,79 +1176,241 @@ def tac_PrimaryExpr(
     if isinstance(node.data, tuple) and node.data[0] == "identifier":
         # a simple identifier
         if not node.children:
-            if node.ident is None:
+            if node.ident is None and node.data[1] == "nil":
+                # the zero value of pointers, slices, maps and interfaces
+                return_val.append("nil")
+            elif node.ident is None:
                 print(f"Skipping undeclared identifier {node.data[1]}")
+            elif declared_function(node.ident) is not None and not is_generic(node.ident.value):
+                return_val.append(function_value(ic, node.ident.value))
+            elif boxed_ref(ic, node.ident) is not None:
+                # a variable captured by function literals is in memory
+                ref = boxed_ref(ic, node.ident)
+                return_val.append(ref if id(node) in ic.assign_targets else ic.add_load(ref))
             else:
                 return_val.append(ActualVar(node.ident))
+            return
 
-        # not so simple identifier
-        elif len(node.children) == 1 and isinstance(node.children[0], syntree.Index):
-            arr_name = node.data[1]
-            index: syntree.Index = node.children[0]
-            ident: Optional[SymbolInfo] = node.ident
-
-            base_addr_t = ic.get_new_temp_var()
-            base_addr_t.type_ = "int"
-            ic.add_to_list(Assign(base_addr_t, f"base({arr_name})"))
-            # return_val.append(base_addr_t)
-
-            if ident is not None:
-                ind = new_children[0][0][0]
-                # width = syntree.Literal(
-                #     "int", type_table.get_type(ident.type_.eltype).storage
-                # )
-                width = syntree.Literal(
-                    "int", ident.type_.storage, None
-                )
-
-                offset_t = ic.get_new_temp_var()
-                offset_t.type_ = "int"
-                ic.add_to_list(Quad(offset_t, ind, width, "*"))
-
-                index_t = ic.get_new_temp_var()
-                index_t.type_ = "int"
-                ic.add_to_list(Quad(index_t, base_addr_t, offset_t, "+"))
+        # not so simple identifier, like a[i] or p.x
+        if node.ident is None:
+            print(f"Skipping undeclared identifier {node.data[1]}")
+            return_val.append(node)
+            return
+        base = ActualVar(node.ident)
+        type_ = concrete(node.ident.type_)
+        ref = boxed_ref(ic, node.ident)
+        if (ref is not None and isinstance(type_, syntree.Type)
+                and isinstance(type_.underlying(), (syntree.Array, syntree.Struct))):
+            # the elements and fields are in the memory of the
+            # variable, they are reached like through a pointer
+            base, type_ = ref.address, syntree.Pointer(type_)
+        elif ref is not None:
+            base = ic.add_load(ref)
+        accessors = list(zip(node.children, new_children))
+
+    elif node.data is None and len(node.children) > 1:
+        # elements and fields of the value of another expression, like f().x
+        type_ = syntree.infer_expr_type(node.children[0])
+        if isinstance(new_children[0][0], MemoryRef):
+            # of the variable pointed to, see tac_pre_PrimaryExpr
+            type_ = syntree.infer_expr_type(node.children[0].operand)
+            base = new_children[0][0].base
+        else:
+            base = as_operand(ic, new_children[0][0], type_)
+        accessors = list(zip(node.children[1:], new_children[1:]))
 
-                res_t = ic.get_new_temp_var()
-                res_t.type_ = ident.type_.eltype
-                ic.add_to_list(Quad(res_t, arr_name, index_t, "[]"))
+    # TODO: implement other variants of PrimaryExpr
 
-                return_val.append(res_t)
+    else:
+        return_val.append(node)
+        return
+
+    # type assertions, slice expressions and map indexing give new values,
+    # the accessors after them are of those values, like s.(Point).x or a[1:][0]
+    while True:
+        k = new_value_accessor(type_, accessors)
+        if k is None:
+            break
+        ref = None
+        if k > 0:
+            ref = element_ref(ic, base, type_, accessors[:k])
+            if ref is None:
+                print("Could not determine the type of the element or field")
+                return_val.append(node)
+                return
+        container = ref.type_ if ref is not None else type_
+        accessor, result = accessors[k]
+        last = k == len(accessors) - 1
+
+        if isinstance(accessor, syntree.SliceExpr):
+            t = container.underlying()
+            if isinstance(t, syntree.Array):
+                # the array is not copied, the slice has its address
+                if ref is not None:
+                    value = ref.address
+                else:
+                    value = ic.get_new_temp_var()
+                    value.type_ = "int"
+                    ic.add_to_list(AddressOf(value, base))
+            elif isinstance(t, (syntree.Slice, syntree.Pointer)):
+                value = ic.add_load(ref) if ref is not None else base
             else:
-                print("uhhh could not get type")
-
+                print("Slicing strings not implemented yet!")
                 return_val.append(node)
-
+                return
+            value = slice_value(ic, value, container, result[0])
+            type_ = syntree.accessed_type(container, accessor)
+            if last:
+                return_val.append(value)
+                return
+            base = as_operand(ic, value, type_)
+        elif isinstance(accessor, syntree.Index):
+            m = ic.add_load(ref) if ref is not None else base
+            key = as_operand(ic, result[0][0], container.underlying().key)
+            element = MapRef(m, key, container.underlying().eltype)
+            if last and id(node) in ic.assign_targets:
+                return_val.append(element)
+                return
+            value = ic.add_load(element)
+            if last:
+                return_val.append(value)
+                if id(node) in ic.comma_ok:
+                    ok = ic.get_new_temp_var()
+                    ok.type_ = "bool"
+                    ic.add_to_list(RuntimeCall(ok, "has", m, element.address))
+                    return_val.append(ok)
+                return
+            base = value
+            type_ = element.type_
         else:
-
-            return_val.append(node)
-
-    elif (
-        node.data is None
-        and len(new_children) == 2
-        and isinstance(new_children[1][0], syntree.Index)
-    ):
-        # TODO: do array/slice indexing here
-        arr_name_, index_ = new_children
-        arr_name = arr_name_[0]
-        index: syntree.Index = index_[0]
-        ident: Optional[SymbolInfo] = node.ident
-
-        # temp1 = ic.get_new_temp_var()
-        base_addr_t = ic.get_new_temp_var()
-        base_addr_t.type_ = "int"
-        ic.add_to_list(Assign(base_addr_t, f"base({arr_name})"))
-        return_val.append(base_addr_t)
-
-        if ident is not None:
-            print(ident.type_)
+            value = ic.add_load(ref) if ref is not None else base
+            if last:
+                comma_ok = id(node) in ic.comma_ok
+                return_val.extend(type_assertion(ic, value, accessor.type_, comma_ok))
+                return
+            base = type_assertion(ic, value, accessor.type_)[0]
+            type_ = accessor.type_
+        accessors = accessors[k + 1:]
+
+    ref = element_ref(ic, base, type_, accessors)
+    if ref is None:
+        print("Could not determine the type of the element or field")
+        return_val.append(node)
+    elif id(node) in ic.assign_targets:
+        return_val.append(ref)
+    else:
+        return_val.append(ic.add_load(ref))
+
+
+def new_value_accessor(type_: Any, accessors: list) -> Optional[int]:
+    """Position of the first accessor giving a new value, which is not an
+    element or a field of the one accessed, None if there is none"""
+    for i, (accessor, _) in enumerate(accessors):
+        if isinstance(accessor, (syntree.TypeAssertion, syntree.SliceExpr)):
+            return i
+        if isinstance(accessor, syntree.Index) and syntree.is_map(type_):
+            return i
+        type_ = syntree.accessed_type(type_, accessor)
+    return None
+
+
+def type_assertion(
+    ic: IntermediateCode, value: Any, type_: Any, comma_ok: bool = False
+) -> List[TempVar]:
+    """Value of an interface value asserted to be of type_, like x.(T)
+
+    assert(x, T) panics if the dynamic type of x is not T (or does not
+    implement T, if T is an interface). For the comma-ok form, is(x, T)
+    gives whether it is and value(x, T) gives the value, or the zero
+    value of T if it is not"""
+    typename = getattr(type_, "typename", None)
+    result = ic.get_new_temp_var()
+    result.type_ = typename
+    if not comma_ok:
+        ic.add_to_list(RuntimeCall(result, "assert", value, typename))
+        return [result]
+
+    ok = ic.get_new_temp_var()
+    ok.type_ = "bool"
+    ic.add_to_list(RuntimeCall(ok, "is", value, typename))
+    ic.add_to_list(RuntimeCall(result, "value", value, typename))
+    return [result, ok]
+
+
+def element_ref(
+    ic: IntermediateCode, base: Operand, type_: Any, accessors: list
+) -> Optional[MemoryRef]:
+    """Reference to an element or a field of base, like a[i].x
+
+    accessors are the Index and Selector nodes along with the code
+    generated for them. Offsets of fields and elements (index times
+    the width of an element) are added to the base address.
+    Returns None if the type of an element or a field is not known"""
+    offsets = []
+    for accessor, result in accessors:
+        container = type_
+        type_ = syntree.accessed_type(container, accessor)
+        if type_ is None or type_.storage is None:
+            return None
+
+        # the address of the pointed value is the value of the pointer,
+        # and the elements of a slice are in the array its header points to
+        deref = None
+        if isinstance(container.underlying(), syntree.Pointer):
+            deref = "pointer"
+        elif isinstance(container.underlying(), syntree.Slice):
+            deref = "slice"
+        if isinstance(accessor, syntree.Index):
+            offsets.append((deref, result[0][0], type_.storage))
         else:
-            print("This should not be None, something is wrong", index, arr_name)
+            struct = container.underlying()
+            if deref:
+                struct = struct.base.underlying()
+            field_, path = syntree.lookup_field_or_method(struct, accessor.field_name)
+            # a promoted field is in the embedded fields of the path,
+            # which are pointed to by the embedded pointers
+            for embedded in path + [field_]:
+                if embedded.offset is None:
+                    return None
+                offsets.append((deref, None, embedded.offset))
+                deref = "pointer" if isinstance(embedded.type_, syntree.Pointer) else None
+
+    address = None
+    indirect = False
+    for deref, index, width in offsets:
+        if deref == "slice":
+            # the address of the array is the first word of the header
+            if address is None:
+                address = ic.get_new_temp_var()
+                address.type_ = "int"
+                ic.add_to_list(AddressOf(address, base))
+            address = ic.add_load(MemoryRef(base, address, "int", indirect))
+            indirect = True
+        elif deref:
+            indirect = True
+            if address is None:
+                address = base
+            else:
+                address = ic.add_load(MemoryRef(base, address, "int", indirect))
+        elif address is None:
+            address = ic.get_new_temp_var()
+            address.type_ = "int"
+            ic.add_to_list(AddressOf(address, base))
 
-    # TODO: implement other variants of PrimaryExpr
+        # offset of a field, or of an element (index * width)
+        offset = syntree.Literal("int", width, None)
+        if index is not None:
+            element_offset = ic.get_new_temp_var()
+            element_offset.type_ = "int"
+            ic.add_to_list(Quad(element_offset, index, offset, "*"))
+            offset = element_offset
 
-    else:
-        return_val.append(node)
+        next_address = ic.get_new_temp_var()
+        next_address.type_ = "int"
+        ic.add_to_list(Quad(next_address, address, offset, "+"))
+        address = next_address
+
+    return MemoryRef(base, address, type_, indirect)
 
 
 def tac_Index(
@@ -562,8 +1422,30 @@ def tac_Index(
     return_val.append(new_children[0])
 
 
+def tac_SliceExpr(
+    ic: IntermediateCode,
+    node: syntree.SliceExpr,
+    new_children: List[List[Any]],
+    return_val: List[Any],
+):
+    # the indices given are the children, the omitted ones are None
+    values = iter(new_children)
+    return_val.append([None if i is None else next(values)[0] for i in node.indices])
+
+
 def tac_pre_VarDecl(ic: IntermediateCode, node: syntree.VarDecl):
-    if len(node.children) > 1 and isinstance(node.children[1], syntree.BinOp):
+    if not ic.function_stack and not node.const:
+        ic.var_code[id(node)] = [len(ic.code_list), len(ic.code_list)]
+    if node.const and node.symbol is not None and node.symbol.constant is not None:
+        # constant expressions are evaluated while parsing
+        # so the value is assigned directly
+        ic.add_to_list(Assign(ActualVar(node.symbol), node.symbol.constant.to_python()))
+        if node.value in node.children:
+            node.children.remove(node.value)
+        return
+
+    if (len(node.children) > 1 and isinstance(node.children[1], syntree.BinOp)
+            and not syntree.is_interface(node.type_) and id(node.symbol) not in ic.boxed):
         op = node.children[1]
 
         if isinstance(op.left, syntree.Literal):
@@ -594,6 +1476,82 @@ def tac_pre_VarDecl(ic: IntermediateCode, node: syntree.VarDecl):
                 node.children.remove(op)
 
 
+def zero_value(type_: syntree.Type) -> Any:
+    """Zero value of a type, in the same form as the values of literals
+
+    Ref: https://golang.org/ref/spec#The_zero_value
+    """
+    if type_.name == "TypeDecl":
+        return zero_value(type_.children[0])
+
+    if isinstance(type_, syntree.Array):
+        return CompositeValue([zero_value(type_.eltype) for _ in range(type_.length)])
+    elif isinstance(type_, syntree.Slice):
+        # a nil slice, the header has no array
+        return CompositeValue([0, 0, 0])
+    elif isinstance(type_, syntree.Struct):
+        return CompositeValue([zero_value(f.type_) for f in type_.fields])
+
+    kind = untyped.kind_of_typename(type_.typename)
+    if kind in ("int", "complex"):
+        return 0
+    elif kind == "float":
+        return 0.0
+    elif kind == "bool":
+        return "false"
+    elif kind == "string":
+        return '""'
+
+    # slices, functions, etc.
+    return "nil"
+
+
+def boxed_ref(ic: IntermediateCode, symbol: Optional[SymbolInfo]) -> Optional[MemoryRef]:
+    """The memory of a variable captured by function literals, None for
+    the other variables. The function declaring it has its address in the
+    variable, and a function literal gets it from its closure"""
+    if symbol is None or id(symbol) not in ic.boxed:
+        return None
+    address = ic.captured.get(id(symbol), ActualVar(symbol))
+    return MemoryRef(address, address, concrete(symbol.type_), indirect=True)
+
+
+def variable_value(ic: IntermediateCode, symbol: SymbolInfo) -> Operand:
+    ref = boxed_ref(ic, symbol)
+    return ActualVar(symbol) if ref is None else ic.add_load(ref)
+
+
+def declare_variable(ic: IntermediateCode, symbol: SymbolInfo, value: Any):
+    """Assigns the first value of a variable. A captured variable gets new
+    memory each time it is declared, so each iteration of a loop declaring
+    it has a variable of its own for the function literals in it"""
+    if id(symbol) not in ic.boxed:
+        ic.add_to_list(Assign(ActualVar(symbol), value))
+        return
+    address = ActualVar(symbol)
+    type_ = concrete(symbol.type_)
+    ic.add_to_list(RuntimeCall(address, "new", getattr(type_, "storage", None) or 8))
+    ic.add_to_list(Store(MemoryRef(address, address, type_, indirect=True), value))
+
+
+def redeclares(node: syntree.VarDecl) -> bool:
+    """If the VarDecl of a := assigns a variable declared before in the
+    block instead, like err in b, err := g() after a, err := f(). Its
+    symbol is the one of the other declaration"""
+    symbol = node.symbol
+    return (symbol is not None and symbol.lineno is not None
+            and (symbol.lineno, symbol.col_num) != (node.ident.lineno, node.ident.col_num))
+
+
+def initialize_variable(ic: IntermediateCode, node: syntree.VarDecl, value: Any):
+    """Declares the variable of the VarDecl, or assigns the one it redeclares"""
+    if not redeclares(node):
+        declare_variable(ic, node.symbol, value)
+        return
+    ref = boxed_ref(ic, node.symbol)
+    ic.add_assign(ref if ref is not None else ActualVar(node.symbol), value)
+
+
 def tac_VarDecl(
     ic: IntermediateCode,
     node: syntree.VarDecl,
@@ -602,8 +1560,44 @@ def tac_VarDecl(
 ):
     if len(new_children) > 1:
         if len(new_children[1]) > 0:
-            ic.add_to_list(Assign(ActualVar(node.symbol), new_children[1][0]))
+            value = convert(
+                ic, new_children[1][0], syntree.infer_expr_type(node.value), node.type_
+            )
+            initialize_variable(ic, node, value)
+        elif node.unpack is not None:
+            value = unpacked_value(ic, node)
+            if value is not None:
+                initialize_variable(ic, node, value)
+        elif (
+            node.value is None
+            and node.ident.ident_name != "_"
+            and isinstance(node.type_, syntree.Type)
+        ):
+            # a variable declared without a value
+            declare_variable(ic, node.symbol, zero_value(concrete(node.type_)))
         return_val.append(node.ident.ident_name)
+    if id(node) in ic.var_code:
+        ic.var_code[id(node)][1] = len(ic.code_list)
+
+
+def unpacked_value(ic: IntermediateCode, node: syntree.VarDecl) -> Any:
+    """Value of one variable of a VarSpec like var a, b = f()
+
+    The values are generated only once for the whole spec"""
+    ident_list, expression_list = node.unpack
+    key = id(expression_list)
+    if key not in ic.unpacked:
+        exprs = expression_nodes(expression_list)
+        if len(ident_list) == 2 and len(exprs) == 1 and syntree.is_comma_ok(exprs[0]):
+            ic.comma_ok.add(id(exprs[0]))
+        ic.unpacked[key] = expression_values(_recur_codegen(expression_list, ic))
+
+    values = ic.unpacked[key]
+    # identifier lists are in reverse order
+    index = len(ident_list) - 1 - ident_list.children.index(node.ident)
+    if index < len(values):
+        return values[index]
+    return None
 
 
 def tac_List(
@@ -615,13 +1609,164 @@ def tac_List(
     return_val.extend(new_children)
 
 
+# a Block is a List of statements
+tac_Block = tac_List
+
+
+def function_label(ic: IntermediateCode, node: syntree.Function) -> str:
+    if node is ic.generating:
+        return ic.instance_label
+    if node.fn_name is None:
+        # the function literal being generated
+        return ic.literal.label
+    return ic.init_labels.get(id(node), node.label_name)
+
+
 def tac_pre_Function(ic: IntermediateCode, node: syntree.Function):
     symtab.enter_scope()
     symtab.enter_scope()
 
-    fn_name = syntree.FunctionCall.get_fn_name(node.fn_name)
-    fn_label = ic.get_fn_label(fn_name)
+    fn_label = ic.get_fn_label(function_label(ic, node))
     ic.add_label(fn_label)
+    ic.function_stack.append(node)
+    ic.defer_stack.append(has_defer(node.body))
+
+    # the addresses of the variables captured by a function literal
+    # are in its closure, capture(i) gives the i-th one
+    ic.captured = {}
+    if node.fn_name is None:
+        for i, symbol in enumerate(ic.literal.captures):
+            address = ic.get_new_temp_var()
+            address.type_ = "int"
+            ic.add_to_list(RuntimeCall(address, "capture", i))
+            ic.captured[id(symbol)] = address
+
+    # the parameters (and named results) captured by function
+    # literals are moved to memory of their own
+    results = {id(symbol) for symbol in result_symbols(node)}
+    for symbol in parameter_symbols(node):
+        if id(symbol) not in ic.boxed:
+            continue
+        if id(symbol) in results:
+            value = zero_value(concrete(symbol.type_))
+        else:
+            value = ic.get_new_temp_var()
+            value.type_ = getattr(symbol.type_, "typename", symbol.type_)
+            ic.add_to_list(Assign(value, ActualVar(symbol)))
+        declare_variable(ic, symbol, value)
+
+
+def parameter_symbols(node: syntree.Function) -> List[SymbolInfo]:
+    """Symbols of the receiver, the parameters and the named results"""
+    decls = list(node.signature.parameters or [])
+    if isinstance(node, syntree.Method):
+        decls += list(node.receiver)
+    symbols = [
+        decl.symbol
+        for para in decls
+        for decl in getattr(para, "var_decl", [])
+        if decl.symbol is not None
+    ]
+    return symbols + result_symbols(node)
+
+
+def result_symbols(node: syntree.Function) -> List[SymbolInfo]:
+    if not node.signature.has_named_results:
+        return []
+    return [
+        decl.symbol
+        for para in node.signature.result
+        for decl in para.var_decl
+        if decl.symbol is not None
+    ]
+
+
+def captured_symbols(node: syntree.Function) -> List[SymbolInfo]:
+    """The variables a function literal uses which are declared
+    outside of it (in the functions it is in), in order"""
+    symbols: Dict[int, SymbolInfo] = {}
+
+    def add(symbol: Optional[SymbolInfo]):
+        if (symbol is None or symbol.scope_id == "1" or symbol.const
+                or isinstance(symbol.value, syntree.Type)):
+            return
+        if symbol.scope_id == node.scope or symbol.scope_id.startswith(node.scope + "."):
+            return
+        symbols.setdefault(id(symbol), symbol)
+
+    stack: List[Any] = [node]
+    while stack:
+        n = stack.pop()
+        if not isinstance(n, syntree.Node):
+            continue
+        if isinstance(n, syntree.PrimaryExpr):
+            add(n.ident)
+        elif isinstance(n, syntree.FunctionCall):
+            if isinstance(n.fn_name, str):
+                add(n.fn_sym)
+            stack.append(n.fn_name)
+        elif isinstance(n, syntree.VarDecl) and n.unpack is not None:
+            # the values of the spec are not children of its VarDecls
+            stack.append(n.unpack[1])
+        stack.extend(reversed(n.children))
+    return list(symbols.values())
+
+
+def find_captures(node: Any, ic: IntermediateCode):
+    """Finds the variables captured by the function literals in node,
+    before the code of the functions which declare them is generated"""
+    stack = [node]
+    while stack:
+        n = stack.pop()
+        if not isinstance(n, syntree.Node):
+            continue
+        if isinstance(n, syntree.Function) and n.fn_name is None and n.scope is not None:
+            ic.captures[id(n)] = captured_symbols(n)
+            ic.boxed.update(id(symbol) for symbol in ic.captures[id(n)])
+        if isinstance(n, syntree.FunctionCall):
+            stack.append(n.fn_name)
+        elif isinstance(n, syntree.VarDecl) and n.unpack is not None:
+            stack.append(n.unpack[1])
+        stack.extend(n.children)
+
+
+def function_literal(ic: IntermediateCode, node: syntree.Function) -> TempVar:
+    """The value of a function literal, a closure of the function with the
+    addresses of the variables it captures: closure(f, {a1, a2, ...})
+
+    The function is generated once all the other code is, see generate_literals"""
+    enclosing = function_label(ic, ic.function_stack[-1]) if ic.function_stack else "glob"
+    ic.literal_counts[enclosing] += 1
+    label = f"{enclosing}__func{ic.literal_counts[enclosing]}"
+    captures = ic.captures.get(id(node), [])
+    ic.literals.append(FunctionLiteral(label, node, captures))
+    ic._add_label(ic.get_fn_label(label))
+    # the scopes of the function are counted like if it was generated
+    symtab.scopes_at_depth[symtab.depth + 1] += 1
+
+    addresses = [ic.captured.get(id(symbol), ActualVar(symbol)) for symbol in captures]
+    closure = ic.get_new_temp_var()
+    closure.type_ = infer_expr_typename(node)
+    ic.add_to_list(RuntimeCall(closure, "closure", ic.get_fn_label(label),
+                               CompositeValue(addresses) if addresses else None))
+    return closure
+
+
+def has_defer(node: Any) -> bool:
+    """If there is a defer statement in node, other than
+    in the function literals in it"""
+    if isinstance(node, syntree.DeferStmt):
+        return True
+    if not isinstance(node, syntree.Node) or isinstance(node, syntree.Function):
+        return False
+    return any(has_defer(child) for child in node.children)
+
+
+def run_defers(ic: IntermediateCode):
+    """Runs the deferred calls of the function (last deferred first)
+    before it returns, if it has defer statements"""
+    if ic.defer_stack and ic.defer_stack[-1]:
+        ic.add_to_list(RuntimeCall(None, "rundefers", None))
 
 
 def tac_Function(
@@ -630,33 +1775,224 @@ def tac_Function(
     new_children: List[List[Any]],
     return_val: List[Any],
 ):
-    fn_name = syntree.FunctionCall.get_fn_name(node.fn_name)
-    fn_label = ic.get_fn_end_label(fn_name)
+    # the end of the body returns too
+    run_defers(ic)
+    fn_label = ic.get_fn_end_label(function_label(ic, node))
     ic.add_label(fn_label)
+    ic.function_stack.pop()
+    ic.defer_stack.pop()
 
     symtab.leave_scope()
     symtab.leave_scope()
 
 
+# the receiver is generated like the parameters
+tac_pre_Method = tac_pre_Function
+tac_Method = tac_Function
+
+
+def is_generic(node: Any) -> bool:
+    """If node is a generic function, or a method of a generic type"""
+    if isinstance(node, syntree.Method):
+        return bool(node.type_params)
+    return isinstance(node, syntree.Function) and bool(node.signature.type_params)
+
+
+def instance_label(ic: IntermediateCode, fn: syntree.Function, type_args: list) -> str:
+    """Label name of the instance of the generic function fn with the type
+    arguments, like Max[int] or Stack[int]__Push for a method of Stack[T]
+
+    Instances are generated once all the other code is, see generate_instances"""
+    type_args = [concrete(type_) for type_ in type_args]
+    if isinstance(fn, syntree.Method):
+        typename = fn.base_type.instantiate(type_args).typename
+        label = f"{fn.label_prefix}{typename}__{fn.fn_name[1]}"
+    else:
+        label = f"{fn.label_name}[{', '.join(t.typename for t in type_args)}]"
+    fn_label = ic.get_fn_label(label)
+    if fn_label not in ic.label_map:
+        ic._add_label(fn_label)
+        ic.instances.append((label, fn, type_args))
+    return label
+
+
+def callee_label(ic: IntermediateCode, node: syntree.FunctionCall,
+                 fn: syntree.Function) -> Optional[str]:
+    """Label name of the function (or method) called, the instance for generic
+    ones. None if the type arguments are not known (the type checker reports it)"""
+    if not is_generic(fn):
+        return fn.label_name
+    type_params = fn.type_params if isinstance(fn, syntree.Method) else fn.signature.type_params
+    mapping = node.type_mapping()
+    type_args = [concrete(mapping.get(p, p)) for p in type_params]
+    if syntree.has_type_params(type_args):
+        return None
+    return instance_label(ic, fn, type_args)
+
+
 def tac_Arguments(
     ic: IntermediateCode,
     node: syntree.Arguments,
     new_children: List[List[Any]],
     return_val: List[Any],
 ):
+    if node.type_ is not None:
+        # the type argument of a builtin
+        new_children = new_children[1:]
+
+    values = []
     for child in new_children:
         if isinstance(child, list):
             for subchild in child:
                 if isinstance(subchild, list):
-                    for subsubchild in subchild:
-                        ic.add_to_list(Double("push", subsubchild))
-                        return_val.append(subsubchild)
+                    values.extend(subchild)
                 else:
-                    ic.add_to_list(Double("push", subchild))
-                    return_val.append(subchild)
+                    values.append(subchild)
         else:
-            ic.add_to_list(Double("push", child[0]))
-            return_val.append(child[0])
+            values.append(child[0])
+
+    # values are in the order they are pushed, last to first
+    if id(node) in ic.builtin_args:
+        # builtins are generated inline, see builtin_call
+        ic.builtin_args.remove(id(node))
+        return_val.extend(values)
+        return
+
+    types = ic.parameter_types.pop(id(node), None)
+    exprs = []
+    if node.expression_list is not None:
+        exprs = expression_nodes(node.expression_list)
+    if id(node) in ic.variadic:
+        values, exprs = pack_variadic(ic, ic.variadic.pop(id(node)), types[-1], values, exprs)
+    if types is not None and len(types) == len(values) == len(exprs):
+        values = [
+            convert(ic, value, syntree.infer_expr_type(expr), type_)
+            for value, expr, type_ in zip(values, reversed(exprs), reversed(types))
+        ]
+    for value in values:
+        ic.add_to_list(Double("push", value))
+        return_val.append(value)
+
+    # the arguments are pushed last to first, and the
+    # receiver of a method is like the first argument
+    if id(node) in ic.receivers:
+        receiver = ic.receivers.pop(id(node))
+        ic.add_to_list(Double("push", receiver))
+        return_val.append(receiver)
+
+
+def tac_pre_FunctionCall(ic: IntermediateCode, node: syntree.FunctionCall):
+    if node.is_builtin or node.conversion_type() is not None:
+        if id(node) not in ic.deferred_calls:
+            ic.builtin_args.add(id(node.arguments))
+        elif node.fn_name == "panic":
+            # the value is pushed as an argument of type any
+            ic.parameter_types[id(node.arguments)] = [symtab.get_symbol("any").value]
+        return
+    if syntree.type_args and node.receiver is not None:
+        # the method of the type argument, for a receiver of a type parameter
+        node.resolve_method()
+
+    # types of the parameters, to convert the arguments to
+    signature = None
+    if node.is_method_expr:
+        signature = node.method.expr_signature()
+    elif node.method is not None:
+        signature = node.method.signature
+    elif node.receiver is None:
+        # the function could be declared after the call
+        fn_sym = node.fn_sym or symtab.get_symbol(str(node.fn_name))
+        fn_type = node.function_type()
+        if declared_function(fn_sym) is not None:
+            signature = fn_sym.value.signature
+        elif fn_type is not None and not (fn_sym is not None and isinstance(fn_sym.value, syntree.Type)):
+            # a function value, like a variable or a function literal,
+            # is evaluated before the arguments
+            if isinstance(node.fn_name, str):
+                value = variable_value(ic, fn_sym)
+            else:
+                value = expression_values(_recur_codegen(node.fn_name, ic))[0]
+            ic.dynamic_calls[id(node)] = as_operand(ic, value)
+            signature = fn_type.signature
+    if signature is not None and node.arguments is not None:
+        mapping = node.type_mapping()
+        types = [concrete(syntree.substitute(type_, mapping)) for type_ in signature.parameter_types]
+        ic.parameter_types[id(node.arguments)] = types
+        if signature.variadic and not node.arguments.ellipsis:
+            ic.variadic[id(node.arguments)] = len(types) - 1
+
+    if node.method is None or node.is_method_expr:
+        # the receiver of a method expression is the first argument
+        return
+    receiver = promoted_receiver(node)
+
+    if isinstance(node.method, syntree.InterfaceMethod):
+        # dynamic dispatch, the method of the dynamic type is called
+        # with the value held by the interface as the receiver
+        value = expression_values(_recur_codegen(receiver, ic))[0]
+        fn = ic.get_new_temp_var()
+        fn.type_ = node.method.typename
+        ic.add_to_list(RuntimeCall(fn, "method", value, node.method.m_name))
+        data = ic.get_new_temp_var()
+        data.type_ = "int"
+        ic.add_to_list(RuntimeCall(data, "data", value))
+        ic.receivers[id(node.arguments)] = data
+        ic.dynamic_calls[id(node)] = fn
+        return
+
+    pointer = isinstance(syntree.infer_expr_type(receiver), syntree.Pointer)
+    if node.method.pointer_receiver and not pointer:
+        # the address of the receiver, like (&p).scale()
+        value = address_of(ic, receiver)
+    else:
+        value = expression_values(_recur_codegen(receiver, ic))[0]
+        if pointer and not node.method.pointer_receiver and isinstance(value, Operand):
+            # the pointed value, like (*p).area()
+            ref = MemoryRef(value, value, node.method.receiver_type, indirect=True)
+            value = ic.add_load(ref)
+    ic.receivers[id(node.arguments)] = value
+
+
+def promoted_receiver(node: syntree.FunctionCall) -> syntree.Node:
+    """The receiver of the method called, the embedded field of the
+    receiver a promoted method is of, like a.B for a.m() if m is B's"""
+    receiver = node.receiver
+    if not node.method_path:
+        return receiver
+    selectors = [syntree.Selector(("identifier", f.f_name, None), node.lineno)
+                 for f in node.method_path]
+    if isinstance(receiver, syntree.PrimaryExpr) and isinstance(receiver.data, tuple):
+        promoted = copy.copy(receiver)
+        promoted.children = receiver.children + selectors
+        return promoted
+    return syntree.PrimaryExpr(None, node.lineno, [receiver] + selectors)
+
+
+def address_of(ic: IntermediateCode, operand: syntree.Node) -> Any:
+    """Address of an addressable operand (a variable, an element or a field
+    of one, or a pointer indirection), like &a[i] or the receiver of p.scale()
+
+    A composite literal is stored in new memory, like for &Point{1, 2}"""
+    if isinstance(operand, syntree.Literal) and isinstance(operand.value, syntree.LiteralValue):
+        value = expression_values(_recur_codegen(operand, ic))[0]
+        type_ = syntree.infer_expr_type(operand)
+        address = ic.get_new_temp_var()
+        address.type_ = "int"
+        ic.add_to_list(RuntimeCall(address, "new", type_.storage))
+        ic.add_to_list(Store(MemoryRef(address, address, type_, indirect=True), value))
+        return address
+
+    # the memory of a variable captured by function literals is its own
+    if is_indirection(operand) or isinstance(operand, syntree.PrimaryExpr):
+        ic.assign_targets.add(id(operand))
+    value = expression_values(_recur_codegen(operand, ic))[0]
+    if isinstance(value, MemoryRef):
+        return value.address
+
+    address = ic.get_new_temp_var()
+    address.type_ = "int"
+    ic.add_to_list(AddressOf(address, value))
+    return address
 
 
 def tac_FunctionCall(
@@ -665,12 +2001,280 @@ def tac_FunctionCall(
     new_children: List[List[Any]],
     return_val: List[Any],
 ):
-    label = ic.get_fn_label(node.get_fn_name(node.fn_name))
+    if node.is_builtin and id(node) in ic.deferred_calls:
+        # the function of the runtime is called, with the arguments pushed
+        ic.add_to_list(Defer(node.fn_name))
+        return_val.append(node)
+        return
+    if node.is_builtin:
+        # the arguments are last to first
+        value = builtin_call(ic, node, list(reversed(new_children[0])))
+        if value is None:
+            print(f"Builtin {node.fn_name} not implemented yet!")
+            value = node
+        return_val.append(value)
+        return
+
+    to_type = node.conversion_type()
+    if to_type is not None:
+        # the value of the argument, see tac_Arguments
+        return_val.append(conversion(ic, node, new_children[0][-1], to_type))
+        return
+
+    if node.is_method_expr and node.method_path:
+        name = node.fn_name.children[-1].field_name
+        print(f"Method expressions of promoted methods (like {name}) not implemented yet!")
+        return_val.append(node)
+        return
+
+    if id(node) in ic.dynamic_calls:
+        label = ic.dynamic_calls.pop(id(node))
+    elif node.method is not None:
+        label = callee_label(ic, node, node.method)
+    elif node.receiver is not None:
+        print(f"Skipping call of unknown method {node.fn_name.children[-1].field_name}")
+        return_val.append(node)
+        return
+    else:
+        fn_sym = node.fn_sym or symtab.get_symbol(str(node.fn_name))
+        if fn_sym is not None and is_generic(fn_sym.value):
+            label = callee_label(ic, node, fn_sym.value)
+        elif fn_sym is not None and isinstance(fn_sym.value, syntree.Function):
+            # the functions of imported packages have the name of
+            # the package in their labels, see parse_package
+            label = fn_sym.value.label_name
+        else:
+            label = node.get_fn_name(node.fn_name)
+    if label is None:
+        print(f"Skipping call of generic function {node.get_fn_name(node.fn_name)}")
+        return_val.append(node)
+        return
+    if isinstance(label, str):
+        label = ic.get_fn_label(label)
+    if id(node) in ic.go_calls:
+        # the results of the goroutine are discarded
+        ic.add_to_list(Go(label))
+        return_val.append(node)
+        return
+    if id(node) in ic.deferred_calls:
+        ic.add_to_list(Defer(label))
+        return_val.append(node)
+        return
+    result_types = syntree.infer_result_types(node)
+
     temp = ic.get_new_temp_var()
     temp.type_ = node.type_
-    ic.add_call(label, temp)
+    # the results of generic functions are of the type arguments
+    generic = bool(node.type_mapping() or syntree.type_args)
+    if len(result_types) > 1 or result_types and (generic or temp.type_ is None):
+        temp.type_ = infer_expr_typename(result_types[0])
+    if isinstance(label, Operand):
+        # the function is the value of label
+        ic.add_to_list(Call(label, temp))
+    else:
+        ic.add_call(label, temp)
     return_val.append(temp)
 
+    # the other results are popped in order
+    for type_ in result_types[1:]:
+        temp = ic.get_new_temp_var()
+        temp.type_ = infer_expr_typename(type_)
+        ic.add_to_list(Double("pop", None, temp))
+        return_val.append(temp)
+
+
+def builtin_call(ic: IntermediateCode, node: syntree.FunctionCall, values: list) -> Any:
+    """Value of a call of a builtin function, values are the (generated)
+    arguments in order. None if the call can't be generated"""
+    name = node.fn_name
+    args = node.arguments.expressions()
+    types = [syntree.infer_expr_type(arg) for arg in args]
+    t = types[0].underlying() if types and types[0] is not None else None
+    if isinstance(t, syntree.Pointer):
+        t = t.base.underlying()
+
+    if name in ("len", "cap") and len(values) == 1:
+        if isinstance(t, syntree.Array):
+            return syntree.Literal("int", t.length, None)
+        elif isinstance(t, syntree.Slice):
+            return header_word(ic, values[0], 8 if name == "len" else 16)
+        elif isinstance(t, syntree.Map) or t is not None and t.typename == "string":
+            length = ic.get_new_temp_var()
+            length.type_ = "int"
+            ic.add_to_list(RuntimeCall(length, "len", values[0]))
+            return length
+        elif isinstance(t, syntree.Chan):
+            # the values in the buffer, or the size of the buffer
+            count = ic.get_new_temp_var()
+            count.type_ = "int"
+            ic.add_to_list(RuntimeCall(count, name, values[0]))
+            return count
+
+    elif name == "make":
+        t = concrete(syntree.builtin_result_type(node))
+        sizes = values if node.arguments.type_ is not None else values[1:]
+        if not isinstance(t, syntree.Type):
+            return None
+        if isinstance(t.underlying(), syntree.Map):
+            # the size is a hint for the runtime
+            m = ic.get_new_temp_var()
+            m.type_ = t.typename
+            ic.add_to_list(RuntimeCall(m, "makemap", sizes[0] if sizes else 0))
+            return m
+        if isinstance(t.underlying(), syntree.Chan):
+            # an unbuffered channel without a size
+            ch = ic.get_new_temp_var()
+            ch.type_ = t.typename
+            size = sizes[0] if sizes else 0
+            ic.add_to_list(RuntimeCall(ch, "makechan", t.underlying().eltype.storage, size))
+            return ch
+        if isinstance(t.underlying(), syntree.Slice) and sizes:
+            length = sizes[0]
+            capacity = sizes[1] if len(sizes) > 1 else length
+            array = ic.get_new_temp_var()
+            array.type_ = "int"
+            size = arith(ic, "*", capacity, t.underlying().eltype.storage)
+            ic.add_to_list(RuntimeCall(array, "new", size))
+            return CompositeValue([array, length, capacity])
+
+    elif name == "append" and isinstance(t, syntree.Slice) and values:
+        slice_ = as_operand(ic, values[0], types[0])
+        if node.arguments.ellipsis and len(values) == 2:
+            return append_slice(ic, slice_, types[0], as_operand(ic, values[1], types[1]), types[1])
+        elements = [
+            convert(ic, value, type_, t.eltype) for value, type_ in zip(values[1:], types[1:])
+        ]
+        if not elements:
+            return slice_
+
+        # the elements are stored after the last one of the grown slice,
+        # which has the same array if it has room for them
+        width = t.eltype.storage
+        grown = ic.get_new_temp_var()
+        grown.type_ = types[0].typename
+        ic.add_to_list(RuntimeCall(grown, "grow", slice_, len(elements), width))
+        array = header_word(ic, grown, 0)
+        length = header_word(ic, grown, 8)
+        capacity = header_word(ic, grown, 16)
+        for i, element in enumerate(elements):
+            index = arith(ic, "+", length, i) if i else length
+            address = arith(ic, "+", array, arith(ic, "*", index, width))
+            ic.add_to_list(Store(MemoryRef(grown, address, t.eltype, indirect=True), element))
+        return CompositeValue([array, arith(ic, "+", length, len(elements)), capacity])
+
+    elif name == "copy" and isinstance(t, syntree.Slice) and len(values) == 2:
+        count = ic.get_new_temp_var()
+        count.type_ = "int"
+        dst = as_operand(ic, values[0], types[0])
+        src = as_operand(ic, values[1], types[1])
+        ic.add_to_list(RuntimeCall(count, "copy", dst, src, t.eltype.storage))
+        return count
+
+    elif name == "new":
+        # new memory for a (zero) value of the type
+        t = concrete(syntree.builtin_result_type(node))
+        if not isinstance(t, syntree.Pointer) or t.base.storage is None:
+            return None
+        pointer = ic.get_new_temp_var()
+        pointer.type_ = t.typename
+        ic.add_to_list(RuntimeCall(pointer, "new", t.base.storage))
+        return pointer
+
+    elif name == "delete" and isinstance(t, syntree.Map) and len(values) == 2:
+        key = convert(ic, as_operand(ic, values[1], types[1]), types[1], t.key)
+        ic.add_to_list(RuntimeCall(None, "delete", values[0], key))
+        return node
+
+    elif name == "panic" and len(values) == 1:
+        # the value is given to recover() in a deferred call
+        value = convert(ic, as_operand(ic, values[0], types[0]), types[0],
+                        symtab.get_symbol("any").value)
+        ic.add_to_list(RuntimeCall(None, "panic", value))
+        return node
+
+    elif name == "recover" and not values:
+        value = ic.get_new_temp_var()
+        value.type_ = "any"
+        ic.add_to_list(RuntimeCall(value, "recover", None))
+        return value
+
+    elif name == "close" and isinstance(t, syntree.Chan) and len(values) == 1:
+        ic.add_to_list(RuntimeCall(None, "close", values[0]))
+        return node
+
+    elif name in ("complex", "real", "imag", "min", "max") and values:
+        result_type = syntree.builtin_result_type(node)
+        try:
+            # calls with constant arguments are constants, like real(2 + 3i)
+            const = constant.evaluate(node)
+            return syntree.Literal(result_type.typename, const.to_python(), None)
+        except constant.ConstError:
+            pass
+        value = ic.get_new_temp_var()
+        value.type_ = result_type.typename
+        ic.add_to_list(RuntimeCall(value, name, *values))
+        return value
+
+    return None
+
+
+def conversion(ic: IntermediateCode, node: syntree.FunctionCall, value: Any, to_type: Any) -> Any:
+    """T(x), the value of x converted to to_type. The conversions which
+    change the representation of the value call conv(T, x) of the runtime,
+    the others (like between Celsius and float64) give the value itself"""
+    to_type = concrete(to_type)
+    try:
+        # the conversions of constants are constants, like float64(3)
+        const = constant.evaluate(node)
+        return syntree.Literal(to_type.typename, const.to_python(), None)
+    except constant.ConstError:
+        pass
+    from_type = concrete(syntree.infer_expr_type(node.arguments.expressions()[0]))
+    if syntree.is_interface(to_type):
+        return convert(ic, value, from_type, to_type)
+    if not isinstance(from_type, syntree.Type):
+        return value
+    # between basic types, and between strings and byte or rune slices,
+    # the others have the same underlying type (or base types of pointers)
+    f, t = from_type.underlying(), to_type.underlying()
+    aliases = {"byte": "uint8", "rune": "int32"}
+    names = [aliases.get(u.typename, u.typename) if u.name == "BasicType" else None
+             for u in (f, t)]
+    if names[0] == names[1] or None in names and "string" not in names:
+        return value
+    value = as_operand(ic, value, from_type)
+    converted = ic.get_new_temp_var()
+    converted.type_ = to_type.typename
+    ic.add_to_list(RuntimeCall(converted, "conv", to_type.typename, value))
+    return converted
+
+
+def append_slice(ic: IntermediateCode, slice_: Any, type_: Any, other: Any, other_type: Any) -> CompositeValue:
+    """append(s, t...), the elements of t (a slice, or the bytes of a string)
+    are copied after the last one of the grown slice s"""
+    t = concrete(type_).underlying()
+    width = t.eltype.storage
+    if isinstance(concrete(other_type).underlying(), syntree.Slice):
+        count = header_word(ic, other, 8)
+    else:
+        count = ic.get_new_temp_var()
+        count.type_ = "int"
+        ic.add_to_list(RuntimeCall(count, "len", other))
+    grown = ic.get_new_temp_var()
+    grown.type_ = concrete(type_).typename
+    ic.add_to_list(RuntimeCall(grown, "grow", slice_, count, width))
+    array = header_word(ic, grown, 0)
+    length = header_word(ic, grown, 8)
+    capacity = header_word(ic, grown, 16)
+    # the part of the array after the last element
+    dst = as_operand(ic, CompositeValue([
+        arith(ic, "+", array, arith(ic, "*", length, width)), count, arith(ic, "-", capacity, length)
+    ]), type_)
+    copied = ic.get_new_temp_var()
+    copied.type_ = "int"
+    ic.add_to_list(RuntimeCall(copied, "copy", dst, other, width))
+    return CompositeValue([array, arith(ic, "+", length, count), capacity])
+
 
 def tac_pre_IfStmt(
     ic: IntermediateCode,
@@ -707,20 +2311,32 @@ def tac_pre_IfStmt(
     body = node.body
     node.children.remove(body)
     _recur_codegen(body, ic)
+
+    next_ = node.next_
+    if next_ is not None:
+        # skip the else part after the body
+        end_label = ic.get_new_increment_label("if_end")
+        ic._add_label(end_label)
+        ic.add_goto(end_label)
+
     # false label after body
     ic.add_label(false_label)
 
     symtab.leave_scope()
 
     # else part
-    next_ = node.next_
     if next_ is not None:
-        symtab.enter_scope()
-
         node.children.remove(next_)
-        _recur_codegen(next_, ic)
 
-        symtab.leave_scope()
+        # an else if enters its own scope
+        if isinstance(next_, syntree.IfStmt):
+            _recur_codegen(next_, ic)
+        else:
+            symtab.enter_scope()
+            _recur_codegen(next_, ic)
+            symtab.leave_scope()
+
+        ic.add_label(end_label)
 
     symtab.leave_scope()
 
@@ -759,6 +2375,8 @@ def tac_pre_ForStmt(ic: IntermediateCode, node: syntree.ForStmt):
         ic.add_to_list(g1)
         ic.add_label(true_label)
 
+        # the end label is added later, but a break can refer to it
+        ic._add_label(end_label)
         ic.enter_new_loop(start_label, end_label)
 
         # now the body (after true label)
@@ -791,6 +2409,7 @@ def tac_pre_ForStmt(ic: IntermediateCode, node: syntree.ForStmt):
         condition_res = _recur_codegen(condition, ic)[0]
 
         true_label = ic.get_new_increment_label("for_cmpd_true")
+        post_label = ic.get_new_increment_label("for_cmpd_post")
         end_label = ic.get_new_increment_label("for_cmpd_end")
 
         symtab.enter_scope()
@@ -800,7 +2419,10 @@ def tac_pre_ForStmt(ic: IntermediateCode, node: syntree.ForStmt):
         ic.add_to_list(g1)
         ic.add_label(true_label)
 
-        ic.enter_new_loop(start_label, end_label)
+        # labels are added later, but a break or continue can refer to them
+        ic._add_label(post_label)
+        ic._add_label(end_label)
+        ic.enter_new_loop(post_label, end_label)
 
         # now the body (after true label)
         body = node.body
@@ -808,6 +2430,16 @@ def tac_pre_ForStmt(ic: IntermediateCode, node: syntree.ForStmt):
             node.children.remove(body)
             _recur_codegen(body, ic)
         # the post statement (increment/decrement)
+        # a continue goes here
+        ic.add_label(post_label)
+        # each iteration has its own copy of the variables declared
+        # by the init statement, the function literals of the body
+        # keep the one of their iteration, the next one starts as
+        # a copy of it
+        for decl in init_decls(clause.init):
+            ref = boxed_ref(ic, decl.symbol)
+            if ref is not None:
+                declare_variable(ic, decl.symbol, ic.add_load(ref))
         if clause.post is not None:
             _recur_codegen(clause.post, ic)
             clause.children.remove(clause.post)
@@ -818,12 +2450,185 @@ def tac_pre_ForStmt(ic: IntermediateCode, node: syntree.ForStmt):
 
         ic.exit_loop()
 
+    elif isinstance(node.clause, syntree.RangeClause):
+        node.children.remove(node.clause)
+        range_loop(ic, node)
+
     else:
         print("Could not determine clause type")
 
     symtab.leave_scope()
 
 
+def init_decls(init: Any) -> List[syntree.VarDecl]:
+    """The variables declared by the init statement of a for clause"""
+    if isinstance(init, syntree.VarDecl):
+        return [init]
+    if isinstance(init, syntree.List):
+        return [decl for decl in init.children if isinstance(decl, syntree.VarDecl)]
+    return []
+
+
+def range_loop(ic: IntermediateCode, node: syntree.ForStmt):
+    """A for loop with a range clause, evaluating the range expression once
+
+    Over a map, iter(m) gives an iterator over the entries, next(it)
+    advances it to the next entry (false if there is none), key(it) and
+    elem(it) give the key and the element of the current entry. Over a
+    channel, the values are received until it is closed. The other ones
+    count an index up to the length: the integer itself, the elements of
+    an array (or the array a pointer points to) or a slice, and the bytes
+    of a string, advanced by the size of the rune decoded at the index"""
+    clause = node.clause
+    type_ = syntree.infer_expr_type(clause.expr)
+    t = type_.underlying() if isinstance(type_, syntree.Type) else None
+    if isinstance(t, syntree.Pointer):
+        t = t.base.underlying()
+    if not (isinstance(t, (syntree.Map, syntree.Chan, syntree.Array, syntree.Slice))
+            or syntree.is_integer(type_) or syntree.is_string(type_)):
+        # the body is skipped, its scope still left by tac_pre_ForStmt
+        print(f"Range over {type_} not implemented yet!")
+        node.children.remove(node.body)
+        symtab.enter_scope()
+        return
+
+    x = as_operand(ic, _recur_codegen(clause.expr, ic)[0], type_)
+    start_label = ic.get_new_increment_label("for_range_start")
+    true_label = ic.get_new_increment_label("for_range_true")
+    post_label = ic.get_new_increment_label("for_range_post")
+    end_label = ic.get_new_increment_label("for_range_end")
+
+    index = None
+    if isinstance(t, syntree.Map):
+        iterator = ic.get_new_temp_var()
+        iterator.type_ = "int"
+        ic.add_to_list(RuntimeCall(iterator, "iter", x))
+        ic.add_label(start_label)
+        ok = ic.get_new_temp_var()
+        ok.type_ = "bool"
+        ic.add_to_list(RuntimeCall(ok, "next", iterator))
+    elif isinstance(t, syntree.Chan):
+        ic.add_label(start_label)
+        received = ic.get_new_temp_var()
+        received.type_ = t.eltype.typename
+        ic.add_to_list(RuntimeCall(received, "recv", x))
+        ok = ic.get_new_temp_var()
+        ok.type_ = "bool"
+        ic.add_to_list(RuntimeCall(ok, "recvok", x))
+    else:
+        if isinstance(x, ActualVar) and not isinstance(t, syntree.Array):
+            # assigning the variable in the body doesn't change the range
+            temp = ic.get_new_temp_var()
+            temp.type_ = type_.typename
+            ic.add_to_list(Assign(temp, x))
+            x = temp
+        if isinstance(t, syntree.Array):
+            length = syntree.Literal("int", t.length, None)
+        elif isinstance(t, syntree.Slice):
+            length = header_word(ic, x, 8)
+        elif syntree.is_string(type_):
+            length = ic.get_new_temp_var()
+            length.type_ = "int"
+            ic.add_to_list(RuntimeCall(length, "len", x))
+        else:
+            length = x
+        index = ic.get_new_temp_var()
+        index.type_ = "int"
+        ic.add_to_list(Assign(index, syntree.Literal("int", 0, None)))
+        ic.add_label(start_label)
+        ok = ic.get_new_temp_var()
+        ok.type_ = "bool"
+        ic.add_to_list(Quad(ok, index, length, "<"))
+
+    symtab.enter_scope()
+
+    ic.add_to_list(ConditionalGoTo(true_label, ok, end_label))
+    ic.add_label(true_label)
+
+    # the iteration variables declared, or the expressions assigned to
+    if clause.ident_list is not None:
+        # declared by each iteration, see declare_variable
+        targets = [
+            None if ident.ident_name == "_" else symtab.get_symbol(ident.ident_name)
+            for ident in reversed(clause.ident_list.children)
+        ]
+    elif clause.expr_list is not None:
+        targets = []
+        for expr in expression_nodes(clause.expr_list):
+            if isinstance(expr, syntree.PrimaryExpr):
+                ic.assign_targets.add(id(expr))
+            targets.extend(_recur_codegen(expr, ic))
+    else:
+        targets = []
+    for i, target in enumerate(targets[:2]):
+        if target is None:
+            continue
+        if isinstance(t, syntree.Map):
+            value = ic.get_new_temp_var()
+            value.type_ = (t.key, t.eltype)[i].typename
+            ic.add_to_list(RuntimeCall(value, ("key", "elem")[i], iterator))
+        elif isinstance(t, syntree.Chan):
+            value = received
+        elif i == 0:
+            value = index
+        else:
+            value = range_element(ic, x, type_, index)
+        if isinstance(target, SymbolInfo):
+            declare_variable(ic, target, value)
+        else:
+            ic.add_assign(target, value)
+
+    # the labels are added later, but a break or continue can refer to them,
+    # a continue advances the index (if any) first
+    continue_label = start_label if index is None else post_label
+    ic._add_label(continue_label)
+    ic._add_label(end_label)
+    ic.enter_new_loop(continue_label, end_label)
+
+    if node.body is not None:
+        node.children.remove(node.body)
+        _recur_codegen(node.body, ic)
+    if index is not None:
+        ic.add_label(post_label)
+        if syntree.is_string(type_):
+            step = ic.get_new_temp_var()
+            step.type_ = "int"
+            ic.add_to_list(RuntimeCall(step, "runelen", x, index))
+        else:
+            step = syntree.Literal("int", 1, None)
+        ic.add_to_list(Quad(index, index, step, "+"))
+    ic.add_goto(start_label)
+    ic.add_label(end_label)
+
+    ic.exit_loop()
+
+
+def range_element(ic: IntermediateCode, x: Any, type_: syntree.Type, index: TempVar) -> TempVar:
+    """The element at index of a range over x: the rune decoded from the
+    bytes of a string starting there (U+FFFD for an invalid encoding),
+    or the element of an array or a slice"""
+    if syntree.is_string(type_):
+        rune = ic.get_new_temp_var()
+        rune.type_ = "int32"
+        ic.add_to_list(RuntimeCall(rune, "decoderune", x, index))
+        return rune
+    t = type_.underlying()
+    indirect = isinstance(t, syntree.Pointer)
+    if indirect:
+        # the address of the array is the value of the pointer
+        t = t.base.underlying()
+        address = x
+    elif isinstance(t, syntree.Slice):
+        indirect = True
+        address = header_word(ic, x, 0)
+    else:
+        address = ic.get_new_temp_var()
+        address.type_ = "int"
+        ic.add_to_list(AddressOf(address, x))
+    offset = arith(ic, "*", index, t.eltype.storage)
+    return ic.add_load(MemoryRef(x, arith(ic, "+", address, offset), t.eltype, indirect))
+
+
 def tac_ForStmt(
     ic: IntermediateCode,
     node: syntree.ForStmt,
@@ -833,6 +2638,312 @@ def tac_ForStmt(
     symtab.leave_scope()
 
 
+def tac_pre_SwitchStmt(ic: IntermediateCode, node: syntree.SwitchStmt):
+    symtab.enter_scope()
+
+    # the statement before the tag, like "switch a := f(); a {...}"
+    if node.statement is not None:
+        _recur_codegen(node.statement, ic)
+        node.children.remove(node.statement)
+
+    # the tag is evaluated once, before the cases
+    tag = None
+    if node.expr is not None:
+        tag = _recur_codegen(node.expr, ic)[0]
+        node.children.remove(node.expr)
+        if isinstance(tag, ActualVar):
+            temp = ic.get_new_temp_var()
+            temp.type_ = getattr(tag.type_, "typename", tag.type_)
+            ic.add_to_list(Assign(temp, tag))
+            tag = temp
+
+    clauses = []
+    if node.clauses is not None:
+        clauses = list(reversed(node.clauses.children))
+        node.children.remove(node.clauses)
+
+    end_label = ic.get_new_increment_label("switch_end")
+    ic._add_label(end_label)
+    case_labels = []
+    for clause in clauses:
+        case_labels.append(ic.get_new_increment_label("switch_case"))
+        ic._add_label(case_labels[-1])
+
+    # cases are tried in order, from top to bottom and left to right
+    default_label = end_label
+    for clause, case_label in zip(clauses, case_labels):
+        if clause.is_default:
+            default_label = case_label
+            continue
+        for expr in reversed(clause.exprs.children):
+            value = _recur_codegen(expr, ic)[0]
+            if tag is not None:
+                cond = ic.get_new_temp_var()
+                cond.type_ = "bool"
+                ic.add_to_list(Quad(cond, tag, value, "=="))
+            else:
+                cond = value
+            ic.add_to_list(ConditionalGoTo(case_label, cond))
+    # the default case runs if none of the others matched
+    ic.add_goto(default_label)
+
+    ic.enter_new_switch(end_label)
+    for clause, case_label in zip(clauses, case_labels):
+        ic.add_label(case_label)
+
+        symtab.enter_scope()
+        _recur_codegen(clause.body, ic)
+        symtab.leave_scope()
+
+        # control goes to the next case body only with a fallthrough
+        last = clause.body.children[0] if clause.body.children else None
+        if not (isinstance(last, syntree.Keyword) and last.kw == "FALLTHROUGH"):
+            ic.add_goto(end_label)
+    ic.exit_switch()
+
+    ic.add_label(end_label)
+
+
+def tac_SwitchStmt(
+    ic: IntermediateCode,
+    node: syntree.SwitchStmt,
+    new_children: List[List[Any]],
+    return_val: List[Any],
+):
+    symtab.leave_scope()
+
+
+def tac_pre_TypeSwitchStmt(ic: IntermediateCode, node: syntree.TypeSwitchStmt):
+    """The types of the cases are tried in order with is(x, T), and nil
+    with x == nil. The variable of a clause is x, or value(x, T) if the
+    clause lists only the type T (see type_assertion)"""
+    symtab.enter_scope()
+
+    if node.statement is not None:
+        _recur_codegen(node.statement, ic)
+        node.children.remove(node.statement)
+
+    x = _recur_codegen(node.expr, ic)[0]
+    node.children.remove(node.expr)
+    if isinstance(x, ActualVar):
+        temp = ic.get_new_temp_var()
+        temp.type_ = getattr(x.type_, "typename", x.type_)
+        ic.add_to_list(Assign(temp, x))
+        x = temp
+
+    clauses = []
+    if node.clauses is not None:
+        clauses = list(reversed(node.clauses.children))
+        node.children.remove(node.clauses)
+
+    end_label = ic.get_new_increment_label("switch_end")
+    ic._add_label(end_label)
+    case_labels = []
+    for clause in clauses:
+        case_labels.append(ic.get_new_increment_label("switch_case"))
+        ic._add_label(case_labels[-1])
+
+    default_label = end_label
+    for clause, case_label in zip(clauses, case_labels):
+        if clause.is_default:
+            default_label = case_label
+            continue
+        for case in reversed(clause.types.children):
+            cond = ic.get_new_temp_var()
+            cond.type_ = "bool"
+            if case.nil:
+                ic.add_to_list(Quad(cond, x, "nil", "=="))
+            else:
+                ic.add_to_list(RuntimeCall(cond, "is", x, getattr(case.type_, "typename", None)))
+            ic.add_to_list(ConditionalGoTo(case_label, cond))
+    ic.add_goto(default_label)
+
+    ic.enter_new_switch(end_label)
+    for clause, case_label in zip(clauses, case_labels):
+        ic.add_label(case_label)
+
+        symtab.enter_scope()
+        if clause.ident is not None and clause.ident.ident_name != "_":
+            types = [] if clause.is_default else list(reversed(clause.types.children))
+            value = x
+            if len(types) == 1 and not types[0].nil:
+                value = ic.get_new_temp_var()
+                value.type_ = getattr(types[0].type_, "typename", None)
+                ic.add_to_list(RuntimeCall(value, "value", x, value.type_))
+            declare_variable(ic, clause.ident.symbol, value)
+        _recur_codegen(clause.body, ic)
+        symtab.leave_scope()
+        ic.add_goto(end_label)
+    ic.exit_switch()
+
+    ic.add_label(end_label)
+
+
+def tac_TypeSwitchStmt(
+    ic: IntermediateCode,
+    node: syntree.TypeSwitchStmt,
+    new_children: List[List[Any]],
+    return_val: List[Any],
+):
+    symtab.leave_scope()
+
+
+def tac_SendStmt(
+    ic: IntermediateCode,
+    node: syntree.SendStmt,
+    new_children: List[List[Any]],
+    return_val: List[Any],
+):
+    # blocks until the value is received, or put in the buffer
+    type_ = syntree.infer_expr_type(node.chan)
+    value = as_operand(ic, new_children[1][0], syntree.infer_expr_type(node.value))
+    if syntree.is_chan(type_):
+        value = convert(
+            ic, value, syntree.infer_expr_type(node.value), type_.underlying().eltype
+        )
+    ic.add_to_list(RuntimeCall(None, "send", new_children[0][0], value))
+    return_val.append(node)
+
+
+def tac_pre_GoStmt(ic: IntermediateCode, node: syntree.GoStmt):
+    # the call starts a goroutine instead, see tac_FunctionCall.
+    # builtins don't block, so they are called in place
+    if isinstance(node.call, syntree.FunctionCall) and not node.call.is_builtin:
+        ic.go_calls.add(id(node.call))
+
+
+def tac_pre_DeferStmt(ic: IntermediateCode, node: syntree.DeferStmt):
+    # the arguments are evaluated and pushed now, see tac_FunctionCall
+    if isinstance(node.call, syntree.FunctionCall):
+        ic.deferred_calls.add(id(node.call))
+
+
+def tac_pre_SelectStmt(ic: IntermediateCode, node: syntree.SelectStmt):
+    """The communications of the cases are registered in order, with
+    selectsend(ch, v) and selectrecv(ch). select(d) blocks until one of
+    them can proceed (if d is 0) and does it, giving its position, or
+    gives -1 if none can and there is a default case (d is 1).
+    selectvalue() and selectok() give the value received and whether
+    the channel is open, like for v, ok := <-ch"""
+    clauses = []
+    if node.clauses is not None:
+        clauses = list(reversed(node.clauses.children))
+        node.children.remove(node.clauses)
+
+    end_label = ic.get_new_increment_label("select_end")
+    ic._add_label(end_label)
+    case_labels = []
+    for clause in clauses:
+        case_labels.append(ic.get_new_increment_label("select_case"))
+        ic._add_label(case_labels[-1])
+
+    # the channels and the values sent are evaluated once, in order.
+    # cases without a send or a receive are reported by the type checker
+    cases = [
+        clause for clause in clauses
+        if isinstance(clause.comm, syntree.SendStmt) or is_receive(select_receive(clause.comm))
+    ]
+    for clause in cases:
+        if isinstance(clause.comm, syntree.SendStmt):
+            type_ = syntree.infer_expr_type(clause.comm.chan)
+            ch = expression_values(_recur_codegen(clause.comm.chan, ic))[0]
+            value = expression_values(_recur_codegen(clause.comm.value, ic))[0]
+            value = as_operand(ic, value, syntree.infer_expr_type(clause.comm.value))
+            if syntree.is_chan(type_):
+                value = convert(ic, value, syntree.infer_expr_type(clause.comm.value),
+                                type_.underlying().eltype)
+            ic.add_to_list(RuntimeCall(None, "selectsend", ch, value))
+        else:
+            receive = select_receive(clause.comm)
+            ch = expression_values(_recur_codegen(receive.operand, ic))[0]
+            ic.add_to_list(RuntimeCall(None, "selectrecv", as_operand(ic, ch)))
+
+    has_default = any(clause.is_default for clause in clauses)
+    chosen = ic.get_new_temp_var()
+    chosen.type_ = "int"
+    ic.add_to_list(RuntimeCall(chosen, "select", int(has_default)))
+    default_label = end_label
+    i = 0
+    for clause, case_label in zip(clauses, case_labels):
+        if clause.is_default:
+            default_label = case_label
+            continue
+        if clause not in cases:
+            continue
+        cond = ic.get_new_temp_var()
+        cond.type_ = "bool"
+        ic.add_to_list(Quad(cond, chosen, syntree.Literal("int", i, None), "=="))
+        ic.add_to_list(ConditionalGoTo(case_label, cond))
+        i += 1
+    ic.add_goto(default_label)
+
+    ic.enter_new_switch(end_label)
+    for clause, case_label in zip(clauses, case_labels):
+        ic.add_label(case_label)
+
+        symtab.enter_scope()
+        if clause in cases and not isinstance(clause.comm, syntree.SendStmt):
+            targets = select_targets(ic, clause.comm)
+            for target, fn in zip(targets, ("selectvalue", "selectok")):
+                if target is None:
+                    continue
+                value = ic.get_new_temp_var()
+                value.type_ = "bool" if fn == "selectok" else infer_expr_typename(
+                    select_receive(clause.comm))
+                ic.add_to_list(RuntimeCall(value, fn, None))
+                if isinstance(target, SymbolInfo):
+                    declare_variable(ic, target, value)
+                else:
+                    ic.add_assign(target, value)
+        _recur_codegen(clause.body, ic)
+        symtab.leave_scope()
+
+        ic.add_goto(end_label)
+    ic.exit_switch()
+
+    ic.add_label(end_label)
+
+
+def is_receive(node: syntree.Node) -> bool:
+    """If node is a receive operation, like <-ch"""
+    return isinstance(node, syntree.UnaryOp) and node.operator == "<-"
+
+
+def select_receive(comm: syntree.Node) -> syntree.Node:
+    """The receive of the communication of a select case,
+    like <-ch for v, ok := <-ch"""
+    if isinstance(comm, syntree.Assignment):
+        return expression_nodes(comm.right)[0]
+    if isinstance(comm, syntree.List) and isinstance(comm.children[0], syntree.VarDecl):
+        decl = comm.children[0]
+        if decl.unpack is not None:
+            return expression_nodes(decl.unpack[1])[0]
+        return decl.value
+    return comm
+
+
+def select_targets(ic: IntermediateCode, comm: syntree.Node) -> list:
+    """Variables (or elements and fields) the value received by a
+    select case and the ok value are assigned to, None if not assigned.
+    The symbols of the ones declared by the case, like v, ok := <-ch"""
+    if isinstance(comm, syntree.Assignment):
+        targets = []
+        for expr in expression_nodes(comm.left):
+            if isinstance(expr, syntree.PrimaryExpr):
+                ic.assign_targets.add(id(expr))
+            # nothing is generated for the blank identifier
+            target = _recur_codegen(expr, ic)
+            targets.append(target[0] if target else None)
+        return targets
+    if isinstance(comm, syntree.List):
+        # declared by the case, like v, ok := <-ch
+        return [
+            None if decl.ident.ident_name == "_" else decl.symbol
+            for decl in reversed(comm.children)
+        ]
+    return []
+
+
 ignored_nodes = {"Identifier", "Type", "Array"}
 
 
@@ -842,6 +2953,16 @@ def _recur_codegen(node: syntree.Node, ic: IntermediateCode):
 
     node_class_name = node.__class__.__name__
 
+    if is_generic(node) and node is not ic.generating:
+        # only the instances have code, the scopes of the
+        # function are counted like if it was generated
+        ic.generics[id(node)] = dict(symtab.scopes_at_depth)
+        symtab.scopes_at_depth[symtab.depth + 1] += 1
+        return [node]
+    if (isinstance(node, syntree.Function) and node.fn_name is None
+            and (ic.literal is None or node is not ic.literal.node)):
+        return [function_literal(ic, node)]
+
     # call TAC functions before processing children
     # these have the prefix tac_pre_
     tac_pre_fn_name = f"tac_pre_{node_class_name}"
@@ -872,9 +2993,152 @@ def _recur_codegen(node: syntree.Node, ic: IntermediateCode):
     return return_val
 
 
-def intermediate_codegen(ast: syntree.Node) -> IntermediateCode:
-    ic = IntermediateCode()
+def package_functions(node: syntree.Node) -> List[syntree.Function]:
+    """The functions declared at package level, in source order"""
+    functions = []
+    for child in reversed(node.children):
+        if (isinstance(child, syntree.Function) and child.fn_name is not None
+                and not is_generic(child)):
+            functions.append(child)
+        elif isinstance(child, (syntree.List, syntree.File)):
+            functions.extend(package_functions(child))
+    return functions
+
+
+def _declare_functions(node: syntree.Node, ic: IntermediateCode):
+    """Adds the labels of all the functions declared at package level. A
+    package can have several init functions, the ones after the first
+    one are numbered, like FUNCTION_init_1"""
+    inits = 0
+    for fn in package_functions(node):
+        label = fn.label_name
+        if fn.fn_name[1] == "init" and not isinstance(fn, syntree.Method):
+            if inits:
+                label = ic.init_labels[id(fn)] = f"{label}_{inits}"
+            inits += 1
+        ic._add_label(ic.get_fn_label(label))
+
+
+def declare_runtime(ast: syntree.Node, ic: Optional[IntermediateCode] = None) -> IntermediateCode:
+    """Adds the labels of the functions of a package of std, like errors.New,
+    which are the ones of the runtime: the code calls them but has no code
+    for them"""
+    if ic is None:
+        ic = IntermediateCode()
+    _declare_functions(ast, ic)
+    return ic
+
 
+def initialization_order(ic: IntermediateCode, order: List[syntree.VarDecl]):
+    """Reorders the code of the package level variables (generated in the
+    order they are declared) to the order they are initialized, from where
+    the code of the first one is"""
+    ranges = [ic.var_code[id(decl)] for decl in order if id(decl) in ic.var_code]
+    if not ranges:
+        return
+    start = min(begin for begin, _ in ranges)
+    moved = [code for begin, end in ranges for code in ic.code_list[begin:end]]
+    inside = set()
+    for begin, end in ranges:
+        inside.update(range(begin, end))
+    rest = [code for i, code in enumerate(ic.code_list) if i not in inside]
+    ic.code_list = rest[:start] + moved + rest[start:]
+
+
+def intermediate_codegen(ast: syntree.Node, ic: Optional[IntermediateCode] = None,
+                         init_order: Optional[List[syntree.VarDecl]] = None) -> IntermediateCode:
+    """The code of the package of ast, added to ic for the packages
+    of a program. The symtab has the symbols of the package. The package
+    level variables are initialized in init_order, if given (see
+    checker.Info), instead of the order they are declared"""
+    if ic is None:
+        ic = IntermediateCode()
+
+    # functions can be called before they are declared
+    _declare_functions(ast, ic)
+    find_captures(ast, ic)
     _recur_codegen(ast, ic)
+    if init_order is not None:
+        initialization_order(ic, init_order)
+    ic.var_code.clear()
+    # instances and function literals can be in each other
+    while ic.instances or ic.literals:
+        generate_instances(ic)
+        generate_literals(ic)
 
     return ic
+
+
+# instances of generic functions generated at most, an instance
+# can instantiate the function again with other type arguments
+max_instances = 1000
+
+
+def subtree_children(node: Any) -> list:
+    """(node, children) of the nodes in the tree of node, code generation
+    removes children of some nodes which it generates itself"""
+    nodes = []
+    stack = [node]
+    while stack:
+        node = stack.pop()
+        if isinstance(node, syntree.Node):
+            nodes.append((node, list(node.children)))
+            stack.extend(node.children)
+    return nodes
+
+
+def generate_instances(ic: IntermediateCode):
+    """Generates the instances of the generic functions called, each one
+    is the code of the function with the type arguments substituted
+
+    The symtab scopes are the ones of the function where it is declared"""
+    scopes_at_depth = symtab.scopes_at_depth
+    count = 0
+    while ic.instances:
+        label, fn, type_args = ic.instances.pop(0)
+        if id(fn) not in ic.generics:
+            continue
+        count += 1
+        if count > max_instances:
+            print(f"Too many instances of generic functions, {label} is not generated")
+            break
+
+        symtab.scopes_at_depth = defaultdict(lambda: 0, ic.generics[id(fn)])
+        type_params = fn.type_params if isinstance(fn, syntree.Method) else fn.signature.type_params
+        syntree.type_args = dict(zip(type_params, type_args))
+        ic.generating, ic.instance_label = fn, label
+        # the values of VarSpecs are generated again for each instance
+        ic.unpacked.clear()
+        children = subtree_children(fn)
+        _recur_codegen(fn, ic)
+        for node, node_children in children:
+            node.children = node_children
+
+    syntree.type_args = {}
+    ic.generating, ic.instance_label = None, None
+    symtab.scopes_at_depth = scopes_at_depth
+
+
+def generate_literals(ic: IntermediateCode):
+    """Generates the function literals, each one is a function of its own
+    called through its closures, see function_literal
+
+    The symtab scopes are the ones of the function where it is declared"""
+    scopes = (symtab.cur_scope, symtab.depth, symtab.stack, symtab.scopes_at_depth)
+    while ic.literals:
+        literal = ic.literals.pop(0)
+        cur_scope, depth, stack, scopes_at_depth = literal.scopes
+        symtab.cur_scope, symtab.depth = cur_scope, depth
+        symtab.stack = list(stack)
+        symtab.scopes_at_depth = defaultdict(lambda: 0, scopes_at_depth)
+        syntree.type_args = literal.type_args
+        ic.literal = literal
+        ic.unpacked.clear()
+        children = subtree_children(literal.node)
+        _recur_codegen(literal.node, ic)
+        for node, node_children in children:
+            node.children = node_children
+
+    syntree.type_args = {}
+    ic.literal = None
+    symtab.cur_scope, symtab.depth, symtab.stack, symtab.scopes_at_depth = scopes
@@ -0,0 +1,62 @@
+package main
+
+// go_parser.py --exec interp tests/array_values.go prints what go run does,
+// so does the VM. Constant array lengths, [...] array literals, and arrays
+// copied by assignments and calls
+
+import "fmt"
+
+const size = 4
+
+type Matrix [size][size]int
+
+// arrays are values: the parameter is a copy of the argument
+func sum(a [size]int) int {
+	s := 0
+	for i := 0; i < len(a); i++ {
+		s += a[i]
+	}
+	a[0] = 100
+	return s
+}
+
+func identity() Matrix {
+	var m Matrix
+	for i := 0; i < size; i++ {
+		m[i][i] = 1
+	}
+	return m
+}
+
+func main() {
+	var a [32]byte
+	var squares [size]int
+	var halves [size * 2]float64
+	for i := 0; i < size; i++ {
+		squares[i] = i * i
+	}
+
+	// assigning an array copies its elements
+	c := squares
+	c[0] = 42
+	fmt.Println(squares[0], c[0], len(a), len(halves))
+	fmt.Println(sum(squares), squares[0])
+
+	m := identity()
+	n := m
+	n[1][2] = 5
+	fmt.Println(m[1][2], n[1][2], m == identity())
+
+	// the length of [...]T is the number of elements
+	names := [...]string{"x", "y", "z"}
+	sparse := [...]int{size: 1, 2}
+	fmt.Println(len(names), len(sparse), names[2], sparse[size+1])
+
+	// slicing an array shares its elements
+	s := squares[1:3]
+	s[0] = 7
+	p := &squares
+	p[3] = 11
+	all := p[:]
+	fmt.Println(squares[1], len(s), cap(s), len(all), squares[3])
+}
@@ -0,0 +1,98 @@
+package main
+
+// go_parser.py --exec interp tests/assign_ops.go prints what go run does,
+// so does the VM. Assignment operations, increments and decrements, and
+// assignments of several values
+
+import "fmt"
+
+type Counter struct {
+	hits  int
+	flags uint8
+}
+
+func pair() (int, string) {
+	return 7, "seven"
+}
+
+func main() {
+	x := 100
+	x += 5
+	x -= 3
+	x *= 2
+	x /= 4
+	x %= 7
+	fmt.Println(x)
+
+	var b uint8 = 240
+	b |= 15
+	fmt.Println(b)
+	b &= 60
+	fmt.Println(b)
+	b ^= 255
+	fmt.Println(b)
+	b &^= 129
+	fmt.Println(b)
+	b <<= 2
+	fmt.Println(b)
+	b >>= 3
+	fmt.Println(b)
+
+	n := -17
+	shift := uint(2)
+	n >>= shift
+	n <<= 1
+	fmt.Println(n)
+
+	i := 0
+	i++
+	i++
+	i--
+	fmt.Println(i)
+
+	f := 1.5
+	f *= 3
+	f++
+	fmt.Println(f)
+
+	s := "go"
+	s += "py"
+	fmt.Println(s)
+
+	values := []int{1, 2, 3}
+	values[1] += 10
+	values[2] <<= 4
+	values[0]--
+	fmt.Println(values)
+
+	c := Counter{}
+	c.hits++
+	c.flags |= 1 << 3
+	p := &c
+	p.hits += 2
+	p.flags ^= 9
+	fmt.Println(c.hits, c.flags)
+
+	counts := map[string]int{}
+	counts["a"]++
+	counts["a"] *= 5
+	counts["b"] -= 1
+	fmt.Println(counts["a"], counts["b"])
+
+	a, z := 1, 2
+	a, z = z, a
+	fmt.Println(a, z)
+
+	values[0], values[2] = values[2], values[0]
+	fmt.Println(values)
+
+	j := 0
+	j, values[j] = 2, 99
+	fmt.Println(j, values)
+
+	_ = x
+	_, name := pair()
+	number, _ := pair()
+	fmt.Println(name, number)
+	_, _ = pair()
+}
@@ -0,0 +1,40 @@
+package main
+
+// go_parser.py tests/assign_ops_errors.go reports the assignments below,
+// like go vet does
+
+func pair() (int, int) {
+	return 1, 2
+}
+
+func main() {
+	// the operator has to be defined on the type of the variable
+	s := "text"
+	s -= "t"
+	s <<= 1
+
+	f := 2.5
+	f %= 2
+	f |= 1
+
+	b := true
+	b++
+	b &= false
+
+	// shift counts are non-negative integers
+	x, y := 1, 2
+	x <<= -1
+	x >>= 1.5
+	// the blank identifier has no value, and the number of values
+	// has to be the number of variables
+	_ += 1
+	_++
+	x, y = pair(), 1
+	x, y = y
+
+	// only variables can be assigned to
+	const k = 10
+	k++
+	k |= 1
+	pair()++
+}
@@ -0,0 +1,37 @@
+package main
+
+// go_parser.py build --target -plugin tests/plugins/sexpbackend.py lists the
+// backends with the one of the plugin, and build --target=sexp with it writes
+// the AST of the program in build/main.sexp. run --exec=interp, vm or python
+// runs it with a backend, they print the same
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type backend struct {
+	name string
+	runs bool
+}
+
+func (b backend) String() string {
+	if b.runs {
+		return b.name + " (run)"
+	}
+	return b.name
+}
+
+func main() {
+	backends := []backend{{"interp", true}, {"vm", true}, {"python", true}, {"sexp", false}}
+	var names []string
+	for _, b := range backends {
+		names = append(names, b.String())
+	}
+	fmt.Println(strings.Join(names, ", "))
+	if len(os.Args) > 1 {
+		fmt.Println("arguments:", os.Args[1:])
+		os.Exit(3)
+	}
+}
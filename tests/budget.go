@@ -0,0 +1,51 @@
+package main
+
+// A program running for a while, which a step budget or a timeout aborts
+// where it is, without running its deferred calls ("done" isn't printed):
+// with -max-steps=100000 the interpreter stops after the first round
+// ("gopy: the program ran more than 100000 steps", exit status 1), the VM
+// after the third one (it counts the loop iterations and the calls, the
+// interpreter the statements and the loop iterations), and -timeout=10ms
+// stops them before the first one. With the argument forever it runs an
+// empty loop, which they abort the same way
+//
+//   python go_parser.py run tests/budget.go
+//   python go_parser.py run -max-steps=100000 tests/budget.go
+//   python go_parser.py run --exec=vm -timeout=10ms tests/budget.go
+//   python go_parser.py run -timeout=1s tests/budget.go forever
+
+import (
+	"fmt"
+	"os"
+)
+
+// collatz is the number of steps from n to 1
+func collatz(n int) int {
+	steps := 0
+	for n != 1 {
+		if n%2 == 0 {
+			n /= 2
+		} else {
+			n = 3*n + 1
+		}
+		steps++
+	}
+	return steps
+}
+
+func main() {
+	defer fmt.Println("done")
+	if len(os.Args) > 1 && os.Args[1] == "forever" {
+		for {
+		}
+	}
+	for round := 1; round <= 5; round++ {
+		longest, start := 0, 0
+		for n := 1; n < round*200; n++ {
+			if steps := collatz(n); steps > longest {
+				longest, start = steps, n
+			}
+		}
+		fmt.Printf("round %d: %d takes %d steps\n", round, start, longest)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+// go_parser.py --exec interp tests/builtins.go prints what go run does,
+// the lengths and the bounds below are constants checked like go vet would
+
+import "fmt"
+
+const greeting = "hello, 世界"
+
+// len of a constant string is a constant, so are min and max of constants
+const (
+	size    = len(greeting)
+	least   = min(3, 1.5, 2)
+	largest = max("go", "gopher", "a")
+)
+
+type Grid [4][3]int
+
+var grid Grid
+
+// len of an array is a constant unless the operand calls
+// a function or receives from a channel
+var rows [len(grid)]string
+var columns [len(grid[0]) * 2]bool
+
+func next(values []int) *[3]int {
+	return &[3]int{values[0], values[1], len(values)}
+}
+
+type Celsius float64
+
+// min and max of type parameters are ordered if their type sets are
+func clamp[T ~int | ~float64](x T) T {
+	return max(0, min(x, 100))
+}
+
+func main() {
+	fmt.Println(size, least, largest, len(rows), len(columns), cap(columns))
+
+	// make takes the type, then the length and the capacity
+	s := make([]int, 2, 5)
+	s = append(s, 7)
+	fmt.Println(len(s), cap(s), s)
+	counts := make(map[string]int)
+	counts["a"]++
+	fmt.Println(len(counts), counts)
+
+	// new gives a pointer to a zero value
+	p := new(Grid)
+	p[1][2] = 5
+	fmt.Println(len(p), len(p[1]), p[1])
+
+	// the operand is evaluated when it calls a function
+	fmt.Println(len(next(s)), len(next(s[1:])))
+
+	// min and max of values of the same ordered type
+	x, y := 3, -4
+	fmt.Println(min(x, y), max(x, y, 10), min(x), max(2.5, float64(x)))
+	fmt.Println(min("b", "ab", "c"), max("b", "ab", "c"))
+	var low, high Celsius = -1.5, 30
+	fmt.Println(min(low, high, 0), max(low, high), clamp(150), clamp(low))
+	zero := 0.0
+	negative := -zero
+	fmt.Println(min(zero, negative), max(negative, zero))
+}
@@ -0,0 +1,37 @@
+package main
+
+// go_parser.py tests/builtins_errors.go reports the wrong calls of the
+// builtins below, like go vet does
+
+import "fmt"
+
+type Grid [4][3]int
+
+var grid Grid
+
+func rows() Grid {
+	return grid
+}
+
+// the operands with a call or a receive are evaluated,
+// so their lengths aren't constants
+const fromCall = len(rows())
+
+func main() {
+	ch := make(chan Grid, 1)
+	const fromReceive = len(<-ch)
+	var byPointer [len(&grid)]bool
+
+	// make and new take a type
+	s := make(int, 3)
+	p := new(3)
+	m := make(map[string]int, 1, 2)
+	t := make([]int)
+	fmt.Println(s, p, m, t, byPointer, len(5), cap(map[int]bool{}))
+
+	// min and max take ordered values of the same type
+	x, f := 1, 2.5
+	fmt.Println(min(), max(true, false), min(x, f), max(x, 2.5), min("a", 1))
+	var c = 1i
+	fmt.Println(max(c, c), min(x, 1, "b"))
+}
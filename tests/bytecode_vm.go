@@ -0,0 +1,202 @@
+package main
+
+// go_parser.py tests/bytecode_vm.go --exec=vm runs it with the bytecode VM,
+// --exec=interp with the interpreter, the output is the same
+
+import "fmt"
+
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(x T) {
+	s.items = append(s.items, x)
+}
+
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.items) == 0 {
+		return zero, false
+	}
+	x := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return x, true
+}
+
+type Animal interface {
+	Sound() string
+}
+
+type Dog struct{ name string }
+
+func (d Dog) Sound() string { return d.name + " says woof" }
+
+type Counter struct{ n int }
+
+func (c *Counter) Inc() { c.n++ }
+
+func Map[T, U any](xs []T, f func(T) U) []U {
+	out := make([]U, 0, len(xs))
+	for i := range xs {
+		out = append(out, f(xs[i]))
+	}
+	return out
+}
+
+func primes(n int) []int {
+	sieve := make([]bool, n+1)
+	var found []int
+	for i := 2; i <= n; i++ {
+		if sieve[i] {
+			continue
+		}
+		found = append(found, i)
+		for j := i * i; j <= n; j += i {
+			sieve[j] = true
+		}
+	}
+	return found
+}
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+func counter() func() int {
+	count := 0
+	return func() int {
+		count++
+		return count
+	}
+}
+
+func find(m map[string]int, key string) (value int, err string) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Sprint("recovered: ", r)
+		}
+	}()
+	v, ok := m[key]
+	if !ok {
+		panic("no " + key)
+	}
+	return v, ""
+}
+
+var total = sum(1, 2, 3)
+
+func sum(nums ...int) int {
+	s := 0
+	for i := range nums {
+		s += nums[i]
+	}
+	return s
+}
+
+func main() {
+	fmt.Println(primes(50))
+	fmt.Println(fib(20), total)
+
+	loops := 0
+	for i := 0; i < 1000; i++ {
+		if i%3 == 0 {
+			continue
+		}
+		if i > 900 {
+			break
+		}
+		loops += i
+	}
+	fmt.Println(loops)
+
+	var s Stack[string]
+	s.Push("a")
+	s.Push("b")
+	x, ok := s.Pop()
+	fmt.Println(x, ok, len(s.items))
+
+	next := counter()
+	next()
+	next()
+	fmt.Println(next())
+
+	var funcs []func() int
+	for i := 0; i < 3; i++ {
+		funcs = append(funcs, func() int { return i * 10 })
+	}
+	for i := range funcs {
+		fmt.Print(funcs[i](), " ")
+	}
+	fmt.Println()
+
+	c := Counter{}
+	for i := 0; i < 5; i++ {
+		c.Inc()
+	}
+	p := &c
+	p.Inc()
+	fmt.Println(c.n)
+
+	var a Animal = Dog{"rex"}
+	if d, ok := a.(Dog); ok {
+		fmt.Println(a.Sound(), d.name)
+	}
+
+	ages := map[string]int{"ann": 31, "bob": 27}
+	ages["cid"] = 40
+	ages["bob"]++
+	delete(ages, "ann")
+	fmt.Println(ages, len(ages))
+	v, err := find(ages, "bob")
+	fmt.Println(v, err)
+	v, err = find(ages, "dan")
+	fmt.Println(v, err)
+
+	words := Map([]int{1, 2, 3}, func(n int) string { return fmt.Sprint(n * n) })
+	fmt.Println(words, len(words))
+
+	grid := [3][3]int{}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			grid[i][j] = i * j
+		}
+	}
+	copied := grid
+	copied[2][2] = 100
+	fmt.Println(grid, copied[2])
+
+	a1, b1 := 1, 2
+	a1, b1 = b1, a1
+	fmt.Println(a1, b1)
+
+	switch n := len(words); {
+	case n > 5:
+		fmt.Println("many")
+	case n > 2:
+		fmt.Println("some")
+		fallthrough
+	default:
+		fmt.Println("done")
+	}
+
+	for i, r := range "hé!" {
+		fmt.Print(i, ":", string(r), " ")
+	}
+	fmt.Println()
+
+	var u8 uint8 = 250
+	for i := 0; i < 10; i++ {
+		u8++
+	}
+	fmt.Println(u8, -7/2, 7>>1, 1<<10)
+
+	ptr := &loops
+	*ptr = 7
+	fmt.Println(loops)
+
+	var nums []int
+	fmt.Println(nums[5])
+}
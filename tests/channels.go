@@ -0,0 +1,86 @@
+package main
+
+import "fmt"
+
+func produce(n int, out chan<- int) {
+	for i := 0; i < n; i++ {
+		out <- i * i
+	}
+	close(out)
+}
+
+func sum(in <-chan int, done chan bool) {
+	total := 0
+	for {
+		v, ok := <-in
+		if !ok {
+			break
+		}
+		total += v
+	}
+	fmt.Println(total)
+	done <- true
+}
+
+func signal(ch chan bool) {
+	ch <- true
+}
+
+func main() {
+	squares := make(chan int)
+	done := make(chan bool, 1)
+	go produce(5, squares)
+	go sum(squares, done)
+	<-done
+
+	// a buffered channel doesn't block until it is full
+	words := make(chan string, 2)
+	words <- "hello"
+	words <- "world"
+	fmt.Println(len(words), cap(words), <-words)
+
+	var quit chan int
+	select {
+	case w := <-words:
+		fmt.Println(w)
+	case v, ok := <-quit:
+		fmt.Println(v, ok)
+	case done <- false:
+	default:
+		fmt.Println("nothing ready")
+	}
+
+	timeout := make(chan bool)
+	go signal(timeout)
+	var received bool
+	for {
+		select {
+		case received = <-timeout:
+			break
+		case words <- "again":
+			continue
+		}
+		if received {
+			break
+		}
+	}
+
+	// should report errors
+	n := 0
+	n <- 1
+	_ = <-n
+	var recv <-chan int = squares
+	recv <- 1
+	close(recv)
+	var send chan<- int = squares
+	_ = <-send
+	squares <- "one"
+	go n
+	go len(words)
+	_ = make(chan int, 1, 2)
+	select {
+	case n > 0:
+	default:
+	default:
+	}
+}
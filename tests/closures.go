@@ -0,0 +1,89 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	x, y int
+}
+
+// the closure keeps n after counter returns
+func counter() func() int {
+	n := 0
+	return func() int {
+		n++
+		return n
+	}
+}
+
+func apply(f func(int) int, x int) int {
+	return f(x)
+}
+
+func double(x int) int {
+	return x * 2
+}
+
+// the receiver is captured like a parameter
+func (p *Point) mover() func(int) {
+	return func(d int) {
+		p.x += d
+	}
+}
+
+func adder[T int | float64](base T) func(T) T {
+	return func(x T) T { return base + x }
+}
+
+func main() {
+	next := counter()
+	next()
+	fmt.Println(next())
+
+	// captured by reference, the literal sees the later assignment
+	k := 3
+	add := func(x int) int { return x + k }
+	k = 10
+	fmt.Println(apply(add, 1), apply(double, 1))
+
+	// each iteration has its own i
+	var fs []func() int
+	for i := 0; i < 3; i++ {
+		fs = append(fs, func() int { return i })
+	}
+	for j := 0; j < len(fs); j++ {
+		fmt.Println(fs[j]())
+	}
+
+	func() {
+		k++
+	}()
+	fmt.Println(k)
+
+	pt := Point{1, 2}
+	sum := func() int { return pt.x + pt.y }
+	pt.mover()(3)
+	fmt.Println(sum())
+
+	var arr [3]int
+	set := func(i, v int) { arr[i] = v }
+	set(1, 7)
+	fmt.Println(arr[1])
+
+	var fib func(int) int
+	fib = func(n int) int {
+		if n < 2 {
+			return n
+		}
+		return fib(n-1) + fib(n-2)
+	}
+	fmt.Println(fib(10), adder[int](2)(3))
+
+	done := make(chan bool)
+	go func() {
+		done <- true
+	}()
+	<-done
+
+	var none func()
+	fmt.Println(none == nil)
+}
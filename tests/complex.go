@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+const i = 1i
+const z = 3 + 4i
+const product = z * (1 - 2i)
+const quotient = z / 2i
+const re = real(z)
+const im = imag(quotient)
+const c64 complex64 = complex(1.5, 2)
+
+func abs2(c complex128) float64 {
+	return real(c)*real(c) + imag(c)*imag(c)
+}
+
+func main() {
+	var x float64 = 2
+	var y float64 = 0.5
+	c := complex(x, y)
+	d := c * z
+	var f32 float32 = 1
+	small := complex(f32, 2)
+	fmt.Println(i, z, product, quotient, re, im, c64, abs2(d), real(small), c == d)
+
+	// should report errors
+	var n int = 3
+	_ = complex(n, 1)
+	_ = complex(x, f32)
+	_ = complex(1, 2i)
+	_ = real(x)
+	_ = imag("abc")
+	_ = c < d
+	var k int = imag(z) / 3
+	var f float32 = c
+	fmt.Println(k, f)
+}
@@ -0,0 +1,28 @@
+package main
+
+// go_parser.py tests/const_cycles_errors.go reports the constants below
+// whose value refers to itself, with the path of each cycle, like go build
+// does
+
+const a = b + 1
+const b = a
+
+const (
+	x = y
+	y = z * 2
+	z = x
+)
+
+const self = len("go") + self
+
+// only q and r are in the cycle
+const p = q
+const q = r * 2
+const r = q - 1
+
+const ok = fine
+const fine = 1
+
+func main() {
+	_ = ok
+}
@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+const x = 1 / 0
+const y = 1 % 0
+const z = 1.5 / 0
+const c = (1 + 2i) / 0
+const neg = 1 << -1
+const half = 1 << 1.5
+const whole = 1 << 2.0
+const float = 1.5 << 2
+const huge = 1 << 2000
+const over = 1 << 1074 >> 1070
+const fits = 1 << 511 >> 508
+
+func main() {
+	a := 5
+	var f float64 = 2
+	fmt.Println(a/0, a%0, f/0)
+	fmt.Println(a<<-1, a<<0.5, a<<2000)
+	fmt.Println(x, y, z, c, neg, half, whole, float, huge, over, fits)
+}
@@ -0,0 +1,40 @@
+package main
+
+// go_parser.py --exec interp tests/const_order.go prints what go run does,
+// so does the VM. Package level constants can refer to the ones declared
+// after them, each one is evaluated once
+
+import "fmt"
+
+const area = Pi * radius * radius
+
+const Pi = 3.14159
+const radius = diameter / 2
+const diameter = 10.0
+
+const label = prefix + "-" + suffix
+
+const (
+	first = iota * step
+	second
+	third
+)
+
+const step = 5
+const prefix, suffix = "go", "py"
+
+var grid [rows][cols]bool
+
+const rows, cols = cols + 1, 3
+
+type Buffer [size]byte
+
+const size = 1 << shift
+const shift = 4
+
+func main() {
+	const local = area * 2
+	fmt.Println(area, local, radius)
+	fmt.Println(label, first, second, third)
+	fmt.Println(len(grid), len(grid[0]), len(Buffer{}))
+}
@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+const x int8 = 300
+const y uint = -1
+const z int = 3.5
+const f float32 = 1e200
+const d float64 = 1e400
+const fits int8 = -128
+const ok uint8 = 255.0
+const big = 1 << 64
+const u64 uint64 = big - 1
+const i64 int64 = big
+
+const (
+	small int8 = 100
+	double     = small + small
+)
+
+func main() {
+	var v int8 = 200
+	var w float32 = 0.5
+	fmt.Println(v, w)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+// untyped constants are exact, so intermediate values can be huge
+const huge = 1 << 100 >> 98
+const big = 1 << 200
+const small = big >> 199
+const third = 1.0 / 3
+const one = third * 3
+const Pi = 3.14159265358979323846264338327950288419716939937510582097494459
+const bits = 240 & 60
+const mask = 7 &^ 2
+const neg = -7 / 2
+const rem = -7 % 2
+
+// typed constants are converted (rounded/truncated) to their type
+const f32 float32 = 0.1
+const f64 float64 = Pi
+const i8 int8 = 1 << 3
+
+func main() {
+	var a int = huge
+	var b int = small + a
+	fmt.Println(b)
+}
@@ -0,0 +1,52 @@
+package main
+
+// go_parser.py --exec interp tests/conversions.go prints what go run does,
+// so do the VM and the python module written by go_parser.py build
+
+import "fmt"
+
+const Pi = 3.14159
+
+type Celsius float64
+type Fahrenheit float64
+
+type Point struct{ X, Y int }
+type Vector Point
+
+func toFahrenheit(c Celsius) Fahrenheit {
+	return Fahrenheit(c*9/5 + 32)
+}
+
+func main() {
+	// between integers and floats, floats are truncated towards zero
+	size := 7
+	half := float64(size) / 2
+	fmt.Println(half, int(half), int(-half), int(Pi*100 - 0.159), float32(Pi))
+	big := 300
+	fmt.Println(int8(big), uint8(big), uint16(-1*big), int64(big)<<40, uint(size))
+	f := 1e10
+	fmt.Println(int32(int64(f)), uint8(int(f)), float32(f))
+
+	// between named types with the same underlying type
+	var c Celsius = 100
+	fmt.Println(toFahrenheit(c), float64(c)+1, Celsius(37.5))
+	p := Point{1, 2}
+	v := (*Vector)(&p)
+	v.X = 10
+	fmt.Println(p, Vector(p), Point(*v))
+
+	// an integer is a rune, its UTF-8 encoding ("�" if it isn't valid)
+	r := 'é'
+	fmt.Println(string(r), string(rune(65)), string(rune(-1)), string(rune(1114112)))
+
+	// strings to and from byte and rune slices
+	s := "héllo, 世界"
+	bytes := []byte(s)
+	runes := []rune(s)
+	fmt.Println(len(bytes), len(runes), bytes[1], runes[1], string(runes[7]))
+	bytes[0] = 'H'
+	runes[0] = 'J'
+	fmt.Println(string(bytes), string(runes), s)
+	fmt.Println([]rune(string([]byte{255, 97})))
+	fmt.Println([]byte("abc"), string([]rune{19990, -1, 'z'}))
+}
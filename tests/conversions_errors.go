@@ -0,0 +1,28 @@
+package main
+
+// go_parser.py tests/conversions_errors.go reports the conversions below,
+// like go vet does
+
+const Pi = 3.14159
+
+type Names []string
+
+func main() {
+	// a constant has to be representable by the type, an
+	// integer overflows it and other values can't be converted
+	_ = int8(300)
+	_ = uint(-1)
+	_ = int(Pi)
+	_ = float32(1e100)
+	_ = string(1.5)
+
+	// between types which don't convert
+	var f float64
+	_ = int("a")
+	_ = []byte(5)
+	_ = string([]int{1})
+	_ = string(f)
+	_ = Names("x")
+	_ = int(nil)
+	_ = (*int)(&f)
+}
@@ -0,0 +1,49 @@
+package main
+
+// go_parser.py run -coverprofile c.out tests/coverage.go writes the
+// coverage profile of the program to c.out, the one go build -cover writes
+// (go tool covdata textfmt converts it), with the blocks ordered by line.
+// -covermode count counts the runs of each block instead, go tool cover
+// -func=c.out prints the coverage of each function (sign 80.0%, kind
+// 75.0%, retry and main 100.0%, 90.0% in total) and -html=c.out shows the
+// lines run. Like cmd/cover, the else if of sign starts a block of its
+// own, and so does the label of retry (a goto may jump to it)
+
+import "fmt"
+
+func sign(x int) string {
+	if x > 0 {
+		return "+"
+	} else if x < 0 {
+		return "-"
+	}
+	return "0"
+}
+
+func kind(v any) string {
+	switch v.(type) {
+	case int:
+		return "int"
+	case string:
+		return "string"
+	default:
+		return "other"
+	}
+}
+
+func retry(n int) int {
+	tries := 0
+retry:
+	tries++
+	if tries < n {
+		goto retry
+	}
+	return tries
+}
+
+func main() {
+	fmt.Println(sign(2), sign(0))
+	fmt.Println(kind(1), kind(2.5))
+	apply := func(f func(int) int) int { return f(3) }
+	fmt.Println(apply(retry))
+}
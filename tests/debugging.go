@@ -0,0 +1,39 @@
+package main
+
+// go_parser.py debug tests/debugging.go runs the program in the debugger,
+// stopped before it starts. With the commands
+//   break 25, continue, locals, next, next, print total x, stack, clear 25,
+//   stepout, step, step, locals, continue
+// it stops in the loop of sum (total = 0, x = 1), at the line of the loop,
+// at the next iteration (total = 1, x = 2), back in main at line 35, then
+// at 38 and in the function literal f, whose locals are k and the n it
+// captures. --exec=vm and --exec=python (the modules of the python
+// backend) stop at the same lines and show the same variables
+
+import "fmt"
+
+type Point struct{ X, Y int }
+
+func (p *Point) Move(dx int) {
+	p.X += dx
+	p.Y++
+}
+
+func sum(xs []int) int {
+	total := 0
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+
+func main() {
+	p := &Point{1, 2}
+	p.Move(3)
+	fmt.Println(p.X, p.Y)
+	n := sum([]int{1, 2, 3})
+	f := func(k int) int {
+		return k * n
+	}
+	fmt.Println(f(2))
+}
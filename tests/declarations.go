@@ -0,0 +1,65 @@
+package main
+
+// python scopes.py tests/declarations.go prints what the file declares, in the
+// order it is declared, and --tree prints its scopes with their objects
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Size is the size of a grid
+const Size = 3
+
+// the cells of a grid
+const (
+	Empty Cell = iota
+	Cross
+	Nought
+)
+
+// Cell is a cell of a grid
+type Cell int
+
+// Grid is a grid of cells
+type Grid [Size][Size]Cell
+
+var names = map[Cell]string{Empty: ".", Cross: "x", Nought: "o"}
+
+// String is the grid, a line for each row
+func (g Grid) String() string {
+	var rows []string
+	for _, row := range g {
+		s := ""
+		for _, c := range row {
+			s += names[c]
+		}
+		rows = append(rows, s)
+	}
+	return strings.Join(rows, "\n") + "\n"
+}
+
+// Winner is the cell of the row full of it, Empty if there is none
+func (g Grid) Winner() Cell {
+	for i := 0; i < Size; i++ {
+		if c := g[i][0]; c != Empty && c == g[i][1] && c == g[i][2] {
+			return c
+		}
+	}
+	return Empty
+}
+
+func main() {
+	var g Grid
+	for i := range Size {
+		g[1][i] = Cross
+	}
+	g[0][0] = Nought
+	fmt.Print(g.String())
+	switch w := g.Winner(); w {
+	case Empty:
+		fmt.Println("nobody")
+	default:
+		fmt.Println(names[w], "wins")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "fmt"
+
+func cleanup(name string) {
+	fmt.Println("cleaning up", name)
+}
+
+func divide(a, b int) int {
+	if b == 0 {
+		panic("division by zero")
+	}
+	return a / b
+}
+
+func safeDivide(a, b int) int {
+	defer handle()
+	return divide(a, b)
+}
+
+func handle() {
+	if r := recover(); r != nil {
+		fmt.Println("recovered:", r)
+	}
+}
+
+func count(ch chan int) {
+	defer close(ch)
+	for i := 0; i < 3; i++ {
+		// the argument is evaluated when the call is deferred
+		defer cleanup("step")
+		ch <- i
+	}
+}
+
+func main() {
+	defer cleanup("main")
+	defer fmt.Println("deferred calls run last to first")
+	fmt.Println(safeDivide(10, 2), safeDivide(1, 0))
+
+	ch := make(chan int, 3)
+	count(ch)
+	x := 5
+	defer fmt.Println(x)
+	x = 6
+
+	// should report errors
+	defer x
+	defer len("abc")
+	defer int(x)
+	panic()
+	_ = recover(x)
+}
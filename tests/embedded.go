@@ -0,0 +1,109 @@
+package main
+
+// go_parser.py --exec interp tests/embedded.go prints what go run does,
+// so does the VM
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) Sum() int {
+	return p.X + p.Y
+}
+
+func (p *Point) Move(dx int) {
+	p.X += dx
+}
+
+type Named struct {
+	Name string
+}
+
+func (n Named) String() string {
+	return "named " + n.Name
+}
+
+// the fields and methods of Point and Named are promoted to Circle,
+// c.X is c.Point.X and c.String() is c.Named.String()
+type Circle struct {
+	Point
+	*Named
+	R int
+}
+
+type Stringer interface {
+	String() string
+}
+
+// an embedded interface, its methods are the ones of the value held
+type Labeled struct {
+	Stringer
+	depth int
+}
+
+// X of Outer hides the one of Circle.Point, which is deeper
+type Outer struct {
+	Circle
+	X int
+}
+
+type Counter int
+
+func (c Counter) Twice() Counter {
+	return c * 2
+}
+
+type Tally struct {
+	Counter
+}
+
+type Twicer interface {
+	Twice() Counter
+}
+
+func main() {
+	c := Circle{Point{1, 2}, &Named{"c"}, 3}
+	fmt.Println(c.X, c.Y, c.R, c.Name)
+	fmt.Println(c.Sum())
+
+	// &c.Point is taken for the pointer receiver
+	c.Move(10)
+	fmt.Println(c.X, c.Point.X)
+	c.Name = "d"
+	fmt.Println(c.String(), c.Named.Name)
+
+	// the promoted methods are in the method set of Circle
+	var s Stringer = c
+	fmt.Println(s.String())
+	l := Labeled{c, 1}
+	fmt.Println(l.String(), l.depth)
+
+	o := Outer{c, 7}
+	fmt.Println(o.X, o.Circle.X, o.Y, o.Sum())
+	o.Y = 20
+	fmt.Println(o.Circle.Point.Y, c.Y)
+
+	// method values and expressions of promoted methods
+	sum := c.Sum
+	c.X = 100
+	fmt.Println(sum(), Circle.Sum(c))
+
+	// through a pointer the pointer methods are promoted too
+	p := &c
+	p.Move(1)
+	p.Y = 5
+	fmt.Println(p.X, p.Sum(), c.Y)
+	var m interface{ Move(int) } = p
+	m.Move(2)
+	fmt.Println(c.X)
+
+	t := Tally{4}
+	var tw Twicer = t
+	fmt.Println(t.Twice(), tw.Twice(), t.Counter)
+
+	// fmt calls the promoted String method
+	fmt.Println(Circle{Point{1, 2}, &Named{"x"}, 3})
+	fmt.Printf("%+v\n", o.Point)
+}
@@ -0,0 +1,56 @@
+package main
+
+// go_parser.py tests/embedded_errors.go reports the selectors and the
+// embedded fields below, like go build does
+
+type A struct {
+	X int
+}
+
+func (A) M() {}
+
+func (*A) P() {}
+
+type B struct {
+	X int
+}
+
+func (B) M() {}
+
+// X and M are promoted from both A and B at the same depth
+type C struct {
+	A
+	B
+}
+
+type I interface {
+	M()
+}
+
+type PA *A
+
+// only type names, and pointers to the ones which aren't
+// pointers or interfaces, can be embedded
+type D struct {
+	*I
+	PA
+}
+
+// a field is named after its type
+type E struct {
+	A
+	*A
+}
+
+func main() {
+	var c C
+	_ = c.X
+	c.M()
+	_ = c.A.X
+
+	// the pointer methods of A are in the method set of *C only
+	var a A
+	var i interface{ P() } = C{a, B{}}
+	_ = i
+	C{}.P()
+}
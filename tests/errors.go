@@ -0,0 +1,69 @@
+package main
+
+// go_parser.py --exec interp tests/errors.go prints what go run does,
+// so do the VM and the python module written by go_parser.py build
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// a type with an Error method is an error
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+func find(keys []string, key string) (int, error) {
+	for i, k := range keys {
+		if k == key {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("find %q: %w", key, ErrNotFound)
+}
+
+func parse(s string) error {
+	if s == "" {
+		return &ParseError{3, "empty"}
+	}
+	return nil
+}
+
+func main() {
+	keys := []string{"a", "b"}
+	i, err := find(keys, "b")
+	fmt.Println(i, err, err == nil)
+
+	// fmt.Errorf wraps the error of its %w verb
+	_, err = find(keys, "c")
+	if err != nil {
+		fmt.Println(err, errors.Is(err, ErrNotFound), errors.Unwrap(err) == ErrNotFound)
+	}
+	plain := fmt.Errorf("plain %d", 5)
+	fmt.Println(plain, errors.Unwrap(plain) == nil, errors.Is(plain, ErrNotFound))
+
+	// each errors.New makes a new error, even for the same text
+	fmt.Println(errors.New("x") == errors.New("x"), errors.Is(ErrNotFound, ErrNotFound))
+
+	// the dynamic type of an error is asserted like any interface value
+	if err := parse(""); err != nil {
+		if pe, ok := err.(*ParseError); ok {
+			fmt.Println("parse error at", pe.Line, err)
+		}
+	}
+	fmt.Println(parse("x") == nil)
+
+	// the verbs of strings format the Error method of an error
+	var none error
+	fmt.Printf("%v|%s|%q|%v\n", none, ErrNotFound, ErrNotFound, none == nil)
+	n, werr := fmt.Println("hello")
+	fmt.Println(n, werr)
+	fmt.Println(fmt.Errorf("x %w", 3))
+}
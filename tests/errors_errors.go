@@ -0,0 +1,28 @@
+package main
+
+// go_parser.py tests/errors_errors.go reports the uses of errors below,
+// like go vet does
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Code int
+
+type Message struct{ text string }
+
+func (m Message) Error() int {
+	return len(m.text)
+}
+
+func main() {
+	// only the types with an Error() string method are errors
+	var c error = Code(1)
+	var m error = Message{"x"}
+	e := errors.New(42)
+	var s string = errors.New("x")
+	var n int = fmt.Println()
+	_, _, _, _ = c, m, e, s
+	_ = n
+}
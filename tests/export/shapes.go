@@ -0,0 +1,87 @@
+// Package shapes is called from Python: gopy export writes its module and
+// the stub of it, shapes.pyi, with the Python types of its declarations
+//
+//	python go_parser.py export -o out tests/export
+//	cd out && python -c "import shapes; print(shapes.Area(2, 3), shapes.New(1, 2))"
+package shapes
+
+import "fmt"
+
+// Sides is the number of sides of a square.
+const Sides = 4
+
+// Ratio is a float64, Name an untyped string constant.
+const Ratio float64 = 1.5
+
+const Name = "shapes"
+
+// Unit is the unit of the lengths.
+var Unit = "cm"
+
+var count int
+
+// Point is a point of the plane.
+// Its coordinates are integers.
+type Point struct {
+	X, Y  int
+	label string
+}
+
+// Move moves p.
+func (p *Point) Move(dx, dy int) {
+	p.X += dx
+	p.Y += dy
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X, p.Y)
+}
+
+// Celsius is a float, its methods are called on the class of the stub:
+// shapes.Celsius.Fahrenheit(100.0).
+type Celsius float64
+
+func (c Celsius) Fahrenheit() float64 { return float64(c)*9/5 + 32 }
+
+type Pair[T any] struct {
+	First, Second T
+}
+
+type Shape interface {
+	Area() float64
+}
+
+// Area returns the area of a rectangle.
+func Area(width, height int) int {
+	count++
+	return width * height
+}
+
+// Sum takes a go.Slice, like the variadic functions do.
+func Sum(xs ...int) (total int) {
+	for _, x := range xs {
+		total += x
+	}
+	return
+}
+
+// Split returns a tuple, the error is Any.
+func Split(s string, lens map[string]int, f func(int) bool) ([]string, error) {
+	if f(lens[s]) {
+		return []string{s}, nil
+	}
+	return nil, fmt.Errorf("no %s", s)
+}
+
+func Max[T int | float64](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func New(x, y int) *Point {
+	return &Point{X: x, Y: y}
+}
+
+func Count() int { return count }
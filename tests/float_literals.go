@@ -0,0 +1,18 @@
+package main
+
+// The sign before a float literal is an operator, not a part of the
+// literal: a+1.5 is a sum and 0.1+0.2 a constant expression
+//
+//   python go_parser.py run tests/float_literals.go
+
+import "fmt"
+
+const sum = 0.1 + 0.2
+
+func main() {
+	a := 2.0
+	fmt.Println(a+1.5, a-1.5, a*-1.5, -a+.5, a-1e3, 1e-3+a)
+	fmt.Println(sum, sum == 0.3, 0.1+0.2 == 0.3, 1.5-+2.5)
+	b := []float64{1.5, -2.5, +3.5}
+	fmt.Println(b[0]+b[1]-b[2], len(b)-1)
+}
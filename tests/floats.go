@@ -0,0 +1,53 @@
+package main
+
+// go_parser.py run tests/floats.go prints what go run does: float32 values
+// are rounded to 32 bits at each conversion, assignment and operation (so
+// 0.1 + 0.2 isn't the float64 sum), and floats are printed with the
+// fewest digits giving them back (of a float32 for the float32 ones)
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+type Meters float32
+
+func main() {
+	var a, b float32 = 0.1, 0.2
+	fmt.Println(a+b, a*b, a/b, a-b, float64(a), float64(a+b))
+	x, y := 0.1, 0.2
+	fmt.Println(x+y, x*y, x/y, float32(x)+float32(y), float32(x+y))
+
+	var f float32 = 16777216
+	f++
+	fmt.Println(f, f+1, f*3, float32(16777217), int(f+1))
+
+	var third float32 = 1.0 / 3
+	sum := float32(0)
+	for i := 0; i < 10; i++ {
+		sum += third
+	}
+	fmt.Println(third, sum, float64(sum), third*3 == 1)
+
+	var m Meters = 1.1
+	fmt.Println(m, m*m, float64(m*m), Meters(2.2)/m)
+
+	// formatting
+	fmt.Println(1e20, 1e21, 1e-4, 1e-5, 100000000.0, 123456789.0, float32(1e21), float32(1e-5))
+	fmt.Println(math.MaxFloat32, float32(math.MaxFloat32), math.SmallestNonzeroFloat64,
+		float32(math.SmallestNonzeroFloat32))
+	fmt.Println(math.Inf(1), -math.Inf(1), math.NaN(), -0.0, 1/math.Inf(-1))
+	fmt.Printf("%v %g %e %f %.3f %8.2f|%-8.2f|\n", a, a, a, a, a, a, a)
+	fmt.Printf("%v %g %e %.2e %G %E\n", 1e100, 2.5e-10, 123456.789, 0.000123, 1e-7, 1e7)
+	fmt.Println(strconv.FormatFloat(float64(a), 'g', -1, 32), strconv.FormatFloat(float64(a), 'g', -1, 64))
+	fmt.Printf("%x %X %.2x %x %x %E\n", 1.5, a, 1.0/3, 5e-324, 0.0, math.Inf(1))
+	fmt.Println(strconv.FormatFloat(0.1, 'x', -1, 64), strconv.FormatFloat(0.1, 'x', 3, 32),
+		strconv.FormatFloat(255.9, 'X', 1, 64))
+
+	// overflow to infinity
+	big := float32(3e38)
+	fmt.Println(big*10, -big*10, big*10-big*10)
+	var c complex64 = complex(a, b)
+	fmt.Println(c*c, real(c*c))
+}
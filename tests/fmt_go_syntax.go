@@ -0,0 +1,61 @@
+package main
+
+// go_parser.py --exec interp tests/fmt_go_syntax.go prints what go run
+// does, so does the VM: the values formatted by %#v and the types by %T
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+type Node struct {
+	Name  string
+	Count uint8
+	Value any
+	Next  *Node
+}
+
+type Celsius float64
+
+func (c Celsius) GoString() string {
+	return fmt.Sprintf("Celsius(%g)", float64(c))
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+func main() {
+	var pair Pair[string, Point]
+	pair.Key, pair.Value = "p", Point{5, 6}
+
+	// the types are the ones of go: byte and rune are uint8 and int32
+	fmt.Printf("%T|%T|%T\n", struct{ X rune }{}, struct{}{}, []byte(nil))
+	fmt.Printf("%T|%T|%T\n", map[string][]rune{}, func(int, ...byte) error { return nil }, &Point{})
+	fmt.Printf("%T|%T|%T\n", pair, [2]interface{}{}, make(chan<- int))
+	fmt.Printf("%v|%T\n", []any{struct {
+		Point
+		n int `json:"n"`
+	}{}}, struct {
+		Point
+		n int `json:"n"`
+	}{})
+
+	// %#v formats the values in Go syntax
+	fmt.Printf("%#v|%#v|%#v|%#v|%#v\n", 42, uint(10), byte(255), 1.5, "q\"s")
+	fmt.Printf("%#v|%#v\n", Point{1, 2}, &Point{3, 4})
+	fmt.Printf("%#v|%#v|%#v\n", []int{1, 2}, []string(nil), [2]bool{true, false})
+	fmt.Printf("%#v|%#v\n", map[string]int{"b": 2, "a": 1}, map[string]bool(nil))
+	fmt.Printf("%#v\n", Node{Name: "n", Count: 7})
+	fmt.Printf("%#v\n", pair)
+
+	// the GoString method formats the values of its type
+	fmt.Printf("%#v|%#v|%v\n", Celsius(21.5), []Celsius{1, 2}, Celsius(3))
+
+	var p *Point
+	var e error
+	fmt.Printf("%#v|%#v|%#v\n", nil, p, e)
+	fmt.Printf("%p|%p\n", nil, p)
+}
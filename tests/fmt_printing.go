@@ -0,0 +1,71 @@
+package main
+
+// go_parser.py --exec interp tests/fmt_printing.go prints what go run does,
+// so do the VM and the python module written by go_parser.py build
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+type Celsius float64
+
+func (c Celsius) String() string {
+	return fmt.Sprintf("%.1f°C", float64(c))
+}
+
+type Pair struct {
+	Name string
+	At   *Point
+}
+
+func main() {
+	// Print adds spaces between operands when neither is a string
+	fmt.Print("a", 1, 2, "b", 3.5, true, "\n")
+	fmt.Println("a", 1, 2, "b", 3.5, true)
+
+	// the verbs of Printf, with their flags, widths and precisions
+	fmt.Printf("%d|%5d|%-5d|%05d|%+d|%x|%X|%#x|%o|%b\n", 42, 42, 42, -42, 42, 255, 255, 255, 8, 5)
+	fmt.Printf("%f|%.2f|%8.3f|%-8.2f|%e|%g|%G\n", 3.14159, 3.14159, -2.5, 1.5, 123456.789, 1e21, 1e-7)
+	fmt.Printf("%s|%10s|%-10s|%.3s|%q|%x\n", "go", "right", "left", "truncated", "tab\there", "hi")
+	fmt.Printf("%t|%v|%c|%q|%U\n", false, true, 'G', 'o', 'λ')
+	fmt.Printf("%v|%+v|%T|%T|%T\n", Point{1, 2}, Point{1, 2}, Point{}, 2.5, "s")
+	fmt.Printf("%v %v %v\n", []int{1, 2, 3}, map[string]int{"b": 2, "a": 1}, [2]bool{true})
+	fmt.Printf("%d %s\n", []int{4, 5}, []string{"x", "y"})
+	fmt.Printf("100%%\n")
+
+	// the width (and the flags) of slices, arrays, maps and structs are the
+	// ones of each element, not of the brackets
+	fmt.Printf("%-8v|%5d|%-6v|\n", []string{"a", "bc"}, []int{1, 22}, [2]bool{true})
+	fmt.Printf("%4v|%6v|%+6v|\n", map[string]int{"b": 2, "a": 1}, Point{1, 2}, Point{3, 4})
+	fmt.Printf("%6.2f|%7v|%5v|\n", []float64{1.5, 2}, [][]int{{1}, {2, 3}}, []error{nil})
+
+	// the String method formats the values of its type
+	var c Celsius = 21.5
+	fmt.Println(c, c+1)
+	fmt.Printf("%v %s %.2f %T\n", c, c, float64(c), c)
+	fmt.Printf("%v %+v %v\n", Pair{Name: "home"}, Pair{Name: "none"}, []Point{{3, 4}})
+
+	// the byte and rune values are uint8 and int32 ones, the flag ' '
+	// spaces the bytes of %x and is the sign of the positive floats
+	var r rune = 'λ'
+	var b byte = 'b'
+	fmt.Printf("%T %T %T %v %c\n", r, b, 'x', r, b)
+	fmt.Printf("% x|% X|%#x|% #x|%x|\n", "hi!", "go", "hi", "ab", "")
+	fmt.Printf("% f|% .2e|% g|%+f\n", 1.5, 2.0, -3.0, 3.0)
+
+	// the mistakes are in the output
+	fmt.Printf("%d %s\n", "str", 5)
+	fmt.Printf("%d\n")
+	fmt.Printf("%d\n", 1, 2)
+	fmt.Printf("%z\n", 3)
+	fmt.Printf("%p %d\n", nil, 4, nil)
+
+	s := fmt.Sprintf("%03d-%s", 7, fmt.Sprint("x", 1, 2))
+	line := fmt.Sprintln("len", len(s))
+	fmt.Print(s, " ", line)
+	var p *Point
+	var values []any
+	fmt.Println(p, values, nil, len(fmt.Sprint()))
+}
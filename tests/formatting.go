@@ -0,0 +1,60 @@
+package main
+// go_parser.py fmt tests/formatting.go prints this file formatted like
+// gofmt does, go_parser.py fmt -l tests lists the files it would change
+
+import (
+   "fmt"
+)
+
+//Shape has an area.
+type Shape   interface {
+Area()   float64
+Name() string // its name
+}
+
+type Rect struct {
+W, H float64 // size
+label string `json:"label"`
+}
+
+const (
+Small = iota
+Medium
+Large  = 10 // large
+)
+
+var (
+count int
+names = []string{"a","bb"}
+)
+
+func (r Rect) Area() float64 {return r.W*r.H}
+
+func (r Rect) Name() string {
+return fmt.Sprint( "[",r.label,"]" )
+}
+
+func Sum[T int|float64](xs ...T) (total T) {
+for i:=range xs { total+=xs[i] }
+return
+}
+
+func main() {
+var s Shape = Rect{W:2,H:3,label:"rect"}
+fmt.Println(s.Name(),s.Area(), Sum(1,2,3))
+ages := map[string]int{
+"ann": 31,
+"bob":27,
+}
+x := 10 // x
+longer := 200 // longer
+if x>5&&longer<300 {
+fmt.Println(ages["ann"]+x*2, -x, names[1:])
+} else { count++ }
+switch {
+case x<0:
+fmt.Println("negative")
+default:
+fmt.Println("positive", Small, Medium, Large)
+}
+}
@@ -0,0 +1,132 @@
+package main
+
+import "fmt"
+
+type Number interface {
+	~int | ~float64
+}
+
+type Stringer interface {
+	String() string
+}
+
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.items) == 0 {
+		return zero, false
+	}
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v, true
+}
+
+// the type parameters of the receiver can have other names
+func (s *Stack[E]) Len() int {
+	return len(s.items)
+}
+
+type Pair[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func Max[T Number](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func Sum[T Number](values []T) T {
+	var total T
+	for i := 0; i < len(values); i++ {
+		total += values[i]
+	}
+	return total
+}
+
+func Index[T comparable](values []T, v T) int {
+	for i := 0; i < len(values); i++ {
+		if values[i] == v {
+			return i
+		}
+	}
+	return -1
+}
+
+func MakePair[K comparable, V any](key K, value V) Pair[K, V] {
+	var p Pair[K, V]
+	p.key = key
+	p.value = value
+	return p
+}
+
+// the type argument of Sum is inferred from the one of SumAll
+func SumAll[T Number](a, b []T) T {
+	return Sum(a) + Sum[T](b)
+}
+
+// E is used before it is declared
+func Length[S ~[]E, E any](s S) int {
+	return len(s)
+}
+
+func Describe[T Stringer](values []T) {
+	for i := 0; i < len(values); i++ {
+		fmt.Println(values[i].String())
+	}
+}
+
+type Celsius float64
+
+type Temps []Celsius
+
+func (c Celsius) String() string {
+	return "celsius"
+}
+
+func main() {
+	fmt.Println(Max(1, 2), Max(2.5, 1.5), Max[int](3, 4))
+	temps := []Celsius{20.5, 25}
+	fmt.Println(Sum(temps), SumAll([]int{1, 2}, []int{3}))
+	fmt.Println(Index([]string{"a", "b"}, "b"))
+	Describe(temps)
+	fmt.Println(Length(Temps{1, 2}))
+
+	var s Stack[int]
+	s.Push(1)
+	s.Push(2)
+	v, ok := s.Pop()
+	fmt.Println(v, ok, s.Len())
+
+	p := MakePair("one", 1)
+	fmt.Println(p.key, p.value+1)
+
+	// should report errors
+	_ = Max("a", "b")
+	_ = Index([][]int{}, nil)
+	_ = Max[int, int](1, 2)
+	_ = Max[string]("a", "b")
+	var n int = Max(1.5, 2.5)
+	var x Stack[int, string]
+	var y Number
+	var z Stack
+	Describe([]int{1})
+	_ = MakePair(nil, 1)
+	_, _, _, _ = n, x, y, z
+}
+
+// should report errors
+func Undeclared[T Undefined](v T) {
+}
+
+func (s Stack[K, V]) Peek() {
+}
@@ -0,0 +1,76 @@
+package main
+
+// python goast.py --gofmt tests/goast.go prints it like gofmt does, from its
+// go/ast tree (python goast.py tests/goast.go | goast fmt), and
+// goast json tests/goast.go | python goast.py -d - prints it back
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pair is a pair of values, with the names of their JSON
+type Pair[K comparable, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"` // the value
+}
+
+type Number interface {
+	~int | ~int64 | float64
+}
+
+// Sum adds the numbers, café is not ASCII
+func Sum[T Number](xs ...T) (total T) {
+	for _, x := range xs {
+		total += x
+	}
+	return
+}
+
+func produce(n int, out chan<- int) {
+	defer close(out)
+	for i := 0; i < n; i++ {
+		out <- i * i
+	}
+}
+
+func kind(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case int, int64:
+		return fmt.Sprint("integer ", v)
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func main() {
+	var p Pair[string, int]
+	p.Key, p.Value = "héllo", 2
+	fmt.Println(p.Key, p.Value, Sum(1, 2, 3), Sum(1.5, 2.5))
+
+	ch := make(chan int)
+	go produce(3, ch)
+	var squares []int
+	for v := range ch {
+		squares = append(squares, v)
+	}
+	fmt.Println(squares[1:], len(squares))
+
+	text := `raw
+	string`
+outer:
+	for _, line := range strings.Split(text, "\n") {
+		select {
+		default:
+			if line == "" {
+				continue outer
+			} else if strings.HasPrefix(line, "\t") {
+				break outer
+			}
+		}
+		fmt.Println(line)
+	}
+	fmt.Println(kind(nil), kind(7), kind(squares), (func() int { return -1 })())
+}
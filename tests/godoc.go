@@ -0,0 +1,82 @@
+// Package main counts the bytes of a few sizes, written with the units
+// of the largest one:
+//
+//	fmt.Println(NewCounter(2048))
+package main
+
+// python go_parser.py doc tests/godoc.go prints its documentation, with
+// the values of its constants (--format=markdown and --format=html too)
+
+import "fmt"
+
+// the sizes of the units
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+
+// Unit is a unit of size
+type Unit int
+
+// the units, from the smallest one
+const (
+	Byte Unit = iota
+	Kilobyte
+	Megabyte
+)
+
+// Names are the symbols of the units
+var Names = [...]string{"B", "KB", "MB"}
+
+var counted = 0
+
+// Counter counts bytes
+type Counter struct {
+	Bytes int
+}
+
+// NewCounter is a counter of n bytes
+func NewCounter(n int) *Counter {
+	counted++
+	return &Counter{n}
+}
+
+// Add adds n bytes to the counter
+func (c *Counter) Add(n int) {
+	c.Bytes += n
+}
+
+// Unit is the largest unit of the bytes counted
+func (c *Counter) Unit() Unit {
+	switch {
+	case c.Bytes >= MB:
+		return Megabyte
+	case c.Bytes >= KB:
+		return Kilobyte
+	}
+	return Byte
+}
+
+// String is the bytes in their unit, rounded down
+func (c *Counter) String() string {
+	u := c.Unit()
+	return fmt.Sprint(c.Bytes/[]int{1, KB, MB}[u], Names[u])
+}
+
+// Max is the largest of the values
+func Max[T int | float64](values ...T) T {
+	m := values[0]
+	for _, v := range values[1:] {
+		m = max(m, v)
+	}
+	return m
+}
+
+func main() {
+	c := NewCounter(2048)
+	fmt.Println(c)
+	c.Add(3 * MB)
+	fmt.Println(c, counted, Max(3, 7, 5), Max(2.5, 1.5), GB)
+}
@@ -0,0 +1,193 @@
+package main
+
+// go_parser.py run tests/goroutines.go prints what go run does, so does
+// --exec=vm (the python backend doesn't have goroutines)
+
+import (
+	"fmt"
+	"sort"
+)
+
+// generate sends the numbers from 1 to n, then closes its channel
+func generate(n int) <-chan int {
+	out := make(chan int)
+	go func() {
+		for i := 1; i <= n; i++ {
+			out <- i
+		}
+		close(out)
+	}()
+	return out
+}
+
+func square(in <-chan int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for v := range in {
+			out <- v * v
+		}
+	}()
+	return out
+}
+
+type result struct {
+	worker, job, value int
+}
+
+func workers(jobs []int, n int) []result {
+	queue := make(chan int, len(jobs))
+	results := make(chan result)
+	for w := 1; w <= n; w++ {
+		go func() {
+			for job := range queue {
+				results <- result{w, job, job * 10}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	var all []result
+	for range jobs {
+		all = append(all, <-results)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].job < all[j].job })
+	return all
+}
+
+func pingPong(rounds int) {
+	ping, pong := make(chan string), make(chan string)
+	go func() {
+		for msg := range ping {
+			pong <- msg + "-pong"
+		}
+		close(pong)
+	}()
+	for i := 0; i < rounds; i++ {
+		ping <- fmt.Sprint("ping", i)
+		fmt.Println(<-pong)
+	}
+	close(ping)
+	_, ok := <-pong
+	fmt.Println("pong closed:", !ok)
+}
+
+func selects() {
+	// a select with a default doesn't block
+	ch := make(chan int, 1)
+	select {
+	case v := <-ch:
+		fmt.Println("received", v)
+	default:
+		fmt.Println("nothing ready")
+	}
+	select {
+	case ch <- 1:
+		fmt.Println("sent")
+	default:
+		fmt.Println("full")
+	}
+	select {
+	case ch <- 2:
+		fmt.Println("sent")
+	default:
+		fmt.Println("full")
+	}
+
+	// the cases of nil channels are never ready
+	var never chan int
+	var v int
+	var ok bool
+	select {
+	case <-never:
+		fmt.Println("never")
+	case v, ok = <-ch:
+		fmt.Println(v, ok)
+	}
+
+	// a select waits for the first case ready, break leaves it
+	done := make(chan struct{})
+	data := make(chan int)
+	go func() {
+		for i := 0; i < 3; i++ {
+			data <- i
+		}
+		close(done)
+	}()
+	sum := 0
+loop:
+	for {
+		select {
+		case d := <-data:
+			if d == 1 {
+				break
+			}
+			sum += d
+		case <-done:
+			break loop
+		}
+	}
+	fmt.Println("sum", sum)
+
+	// a receive from a closed channel is ready
+	close(ch)
+	select {
+	case v, ok := <-ch:
+		fmt.Println(v, ok)
+	}
+}
+
+func panics() {
+	try := func(name string, f func()) {
+		defer func() { fmt.Println(name, recover()) }()
+		f()
+	}
+	closed := make(chan int, 1)
+	close(closed)
+	var nilChan chan int
+	try("send", func() { closed <- 1 })
+	try("close", func() { close(closed) })
+	try("close nil", func() { close(nilChan) })
+	try("make", func() {
+		n := -1
+		_ = make(chan int, n)
+	})
+
+	// a goroutine blocked sending panics once the channel is closed
+	ch := make(chan int)
+	errs := make(chan any)
+	go func() {
+		defer func() { errs <- recover() }()
+		ch <- 1
+	}()
+	go close(ch)
+	fmt.Println(<-errs)
+}
+
+func main() {
+	for v := range square(generate(5)) {
+		fmt.Print(v, " ")
+	}
+	fmt.Println()
+	for _, r := range workers([]int{5, 3, 8, 1}, 3) {
+		fmt.Println(r.job, r.value)
+	}
+	pingPong(3)
+
+	buffered := make(chan string, 3)
+	buffered <- "a"
+	buffered <- "b"
+	fmt.Println(len(buffered), cap(buffered), <-buffered, len(buffered))
+	var nilChan chan int
+	fmt.Println(len(nilChan), cap(nilChan), nilChan == nil)
+
+	selects()
+	panics()
+
+	// the goroutines still blocked when main returns don't keep it running
+	block := make(chan int)
+	go func() { <-block }()
+	fmt.Println("done")
+}
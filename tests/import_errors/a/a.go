@@ -0,0 +1,7 @@
+package a
+
+import "b"
+
+const Name = "a"
+
+var Both = b.Name + Name
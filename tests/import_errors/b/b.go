@@ -0,0 +1,7 @@
+package b
+
+import "a"
+
+const Name = "b"
+
+var Both = a.Name + Name
@@ -0,0 +1,12 @@
+package main
+
+// should report errors
+import (
+	"a"
+	"fmt"
+	"./missing"
+)
+
+func main() {
+	fmt.Println(a.Name)
+}
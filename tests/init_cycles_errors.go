@@ -0,0 +1,40 @@
+package main
+
+// go_parser.py tests/init_cycles_errors.go reports the variables below
+// whose value refers to itself (directly, or through the functions and
+// the methods it refers to) and the init functions, like go build does
+
+var v = w
+var w = v
+
+var x = f()
+
+func f() int { return g() }
+func g() int { return x }
+
+var self = self
+
+type T struct{}
+
+func (T) m() int { return y }
+
+var y = T{}.m()
+
+var p, q = pair()
+
+func pair() (int, int) { return p, 1 }
+
+var fn = func() int { return fn() }
+
+var a = b
+var b = h()
+
+func h() int { return a }
+
+func init() {}
+
+func init(n int) {}
+
+var _ = init
+
+func main() {}
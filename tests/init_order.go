@@ -0,0 +1,63 @@
+package main
+
+// go_parser.py --exec interp tests/init_order.go prints what go run does,
+// so does the VM. The package level variables are initialized after the
+// ones they refer to (through functions and methods too), the others in
+// the order they are declared, then the init functions run in order
+
+import "fmt"
+
+var total = sum(values)
+
+var values = []int{a, b, c}
+
+var a, b = c + 1, trace("b", 2)
+
+var c = next()
+
+var counter = trace("counter", 0)
+
+var scaled = unit.times(3)
+
+var unit = Scale{trace("unit", 10)}
+
+type Scale struct {
+	factor int
+}
+
+func (s Scale) times(n int) int {
+	return s.factor * n * offset
+}
+
+var offset = trace("offset", 2)
+
+func trace(name string, v int) int {
+	fmt.Println("init", name)
+	return v
+}
+
+func next() int {
+	counter++
+	return trace("c", counter+10)
+}
+
+func sum(xs []int) int {
+	s := 0
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
+
+func init() {
+	fmt.Println("first init", total, scaled)
+	counter += 100
+}
+
+func init() {
+	fmt.Println("second init", counter)
+}
+
+func main() {
+	fmt.Println(total, values, a, b, c, counter, scaled)
+}
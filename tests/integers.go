@@ -0,0 +1,58 @@
+package main
+
+// go_parser.py run tests/integers.go prints what go run does: the
+// arithmetic of the sized integers wraps around (two's complement), shifts
+// of unsigned integers fill with zeros and the ones of signed integers
+// with the sign, the shift counts over the size give 0 (or -1), division
+// truncates towards zero and the remainder has the sign of the dividend.
+// The last line is the panic of a division by zero
+
+import "fmt"
+
+type Celsius int8
+
+func main() {
+	var i8 int8 = 127
+	i8++
+	var u8 uint8
+	u8--
+	var i16 int16 = -32768
+	var u16 uint16 = 65535
+	fmt.Println(i8, u8, -i16, i16-1, u16+1, u16*u16)
+
+	var i32 int32 = 1 << 30
+	var u32 uint32 = 1 << 31
+	i32 *= 4
+	fmt.Println(i32, u32*2, u32<<1, i32+1<<30, int32(u32))
+
+	var i64 int64 = 1<<63 - 1
+	var u64 uint64 = 1<<64 - 1
+	fmt.Println(i64+1, u64+1, u64*u64, -i64-2, ^u64)
+
+	// conversions keep the low bits
+	n := 300
+	fmt.Println(int8(n), uint8(n), int16(n*n*n), uint32(-n), uint64(-n))
+	var c Celsius = 100
+	c += 100
+	fmt.Println(c, c*2, -c)
+
+	// shifts
+	x, s := -7, uint(2)
+	fmt.Println(x>>s, x<<s, uint(x)>>60, x>>100, uint8(200)>>s, uint8(200)<<s)
+	var big uint = 70
+	fmt.Println(1<<big, x<<big, x>>big, u64>>big, int8(-128)>>7, int8(s)<<6)
+
+	// division and remainder
+	a, b := -7, 2
+	fmt.Println(a/b, a%b, -a/b, -a%b, a/-b, a%-b, 7/-2, 7%-2)
+	fmt.Println(i16/-1, i16%-1, (i64+1)/-1, (i64+1)%-1)
+	var d8 uint8 = 250
+	fmt.Println(d8/3, d8%7, d8/uint8(n), int8(-128)/int8(b-3))
+
+	// bitwise operators
+	fmt.Println(a&b, a|b, a^b, a&^b, ^a, u8&^15, ^uint16(0))
+
+	var zero int
+	defer func() { fmt.Println("recovered:", recover()) }()
+	fmt.Println(n / zero)
+}
@@ -0,0 +1,17 @@
+package main
+
+// go_parser.py tests/interface_values_errors.go reports the untyped
+// constants below, which don't fit in the default type they get in an
+// interface, like go vet does
+
+import "fmt"
+
+func main() {
+	fmt.Println(1 << 100)
+	fmt.Println(1e400)
+	fmt.Println('a' << 40)
+	var a any = 1 << 100
+	var b interface{} = -1e400
+	a, b = 1<<63, 1<<63-1
+	fmt.Println(a, b)
+}
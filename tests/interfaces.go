@@ -0,0 +1,110 @@
+package main
+
+import "fmt"
+
+type Shape interface {
+	area() int
+}
+
+type Named interface {
+	name() string
+}
+
+// an embedded interface, NamedShape has the methods of both
+type NamedShape interface {
+	Shape
+	Named
+}
+
+type Scaler interface {
+	scale(k int)
+}
+
+type Rect struct {
+	w, h int
+}
+
+type Square struct {
+	side int
+}
+
+func (r Rect) area() int {
+	return r.w * r.h
+}
+
+func (r Rect) name() string {
+	return "rect"
+}
+
+func (r *Rect) scale(k int) {
+	r.w *= k
+	r.h *= k
+}
+
+func (s Square) area() int {
+	return s.side * s.side
+}
+
+func total(shapes [2]Shape) int {
+	sum := 0
+	for i := 0; i < 2; i++ {
+		sum += shapes[i].area()
+	}
+	return sum
+}
+
+func describe(v any) string {
+	if _, ok := v.(Named); ok {
+		return v.(Named).name()
+	}
+	return "unnamed"
+}
+
+func main() {
+	r := Rect{2, 3}
+	var s Shape = r
+	fmt.Println(s.area())
+
+	shapes := [2]Shape{r, Square{4}}
+	fmt.Println(total(shapes))
+
+	var ns NamedShape = r
+	s = ns
+	fmt.Println(describe(ns), describe(Square{1}))
+
+	// type assertions
+	var v any = 5
+	n := v.(int)
+	sq, ok := s.(Square)
+	fmt.Println(n, sq.side, ok, s.(Rect).w)
+
+	// should report errors
+	var sc Scaler = r
+	var named Named = Square{2}
+	_ = n.(int)
+	_ = s.(Scaler)
+	_ = ns.(Square)
+	_, _ = sc, named
+}
+
+type Sizer interface {
+	size() int
+	size() int
+}
+
+// a constraint, it can't be the type of a value
+type Invalid interface {
+	Rect
+}
+
+var _ Invalid
+
+func (s Shape) perimeter() int {
+	return 0
+}
+
+type Areas interface {
+	area() string
+}
+
+var _ Areas = Square{}
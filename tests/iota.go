@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+const (
+	Sunday = iota
+	Monday
+	Tuesday
+	Wednesday
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+
+const (
+	a = iota * 10
+	b
+	c, d = iota, iota + 100
+	e, f
+)
+
+const (
+	bit0, mask0 uint8 = 1 << iota, 1<<iota - 1
+	bit1, mask1
+	_, _
+	bit3, mask3
+)
+
+const zero = iota
+const alsoZero = iota
+
+const (
+	g = "go"
+	h
+)
+
+func main() {
+	var day int = Tuesday
+	fmt.Println(day, GB)
+}
@@ -0,0 +1,284 @@
+package main
+
+// go_parser.py run tests/json_pkg.go prints what go run does, so does
+// --exec=vm (the python backend doesn't have the encoding/json package)
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+type Address struct {
+	Street string `json:"street"`
+	City   string `json:"city,omitempty"`
+}
+
+type Person struct {
+	Name     string            `json:"name"`
+	Age      int               `json:"age,omitempty"`
+	Emails   []string          `json:"emails"`
+	Address  *Address          `json:"address,omitempty"`
+	Tags     map[string]int    `json:"tags,omitempty"`
+	Password string            `json:"-"`
+	Dash     int               `json:"-,"`
+	Score    float64           `json:"score"`
+	Extra    any               `json:"extra"`
+	Labels   map[string]string `json:",omitempty"`
+	private  int
+}
+
+type Base struct {
+	ID      int `json:"id"`
+	Created string
+}
+
+type Meta struct {
+	Created string `json:"created"`
+	Version int
+}
+
+type Doc struct {
+	Base
+	*Meta
+	Title   string
+	Version int `json:"version"`
+}
+
+type Color int
+
+func (c Color) MarshalJSON() ([]byte, error) {
+	names := []string{"red", "green", "blue"}
+	return json.Marshal(names[c])
+}
+
+func (c *Color) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for i, name := range []string{"red", "green", "blue"} {
+		if name == s {
+			*c = Color(i)
+			return nil
+		}
+	}
+	return errors.New("unknown color " + s)
+}
+
+type Bad struct{}
+
+func (Bad) MarshalJSON() ([]byte, error) {
+	return []byte("{oops"), nil
+}
+
+type Node struct {
+	Value int
+	Next  *Node
+}
+
+type Inner struct {
+	N    int      `json:"n"`
+	Vals []string `json:"vals"`
+}
+
+type Outer struct {
+	Inner Inner `json:"inner"`
+	N     string
+}
+
+type Sizes struct {
+	I8  int8
+	U8  uint8
+	F32 float32
+	U   uint
+}
+
+// a reader reads its string in pieces of 4 bytes
+type reader struct {
+	s string
+}
+
+func newReader(s string) *reader {
+	return &reader{s}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.s == "" {
+		return 0, io.EOF
+	}
+	n := copy(p, []byte(r.s[:min(len(r.s), 4)]))
+	r.s = r.s[n:]
+	return n, nil
+}
+
+func marshal(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+func unmarshal(data string, v any) {
+	err := json.Unmarshal([]byte(data), v)
+	fmt.Printf("%v: ", err)
+	if v != nil {
+		if b, err := json.Marshal(v); err == nil {
+			fmt.Print(string(b))
+		}
+	}
+	fmt.Println()
+}
+
+func encoding() {
+	p := Person{Name: "Ann", Emails: []string{"ann@example.com"}, Password: "secret",
+		Dash: 3, Score: 9.5, Address: &Address{Street: "Main St"}, private: 1}
+	marshal(p)
+	marshal(Person{Age: 30, Tags: map[string]int{"b": 2, "a": 1}, Extra: []any{1, "x", nil, true}})
+	marshal([]int(nil))
+	marshal([]int{})
+	marshal(map[string]any(nil))
+	marshal([3]bool{true})
+	marshal(map[int]string{10: "ten", 2: "two", -1: "minus one"})
+	marshal([]byte("hello, world"))
+	marshal("<tag> & \"quote\" \\ \n\t\x01 é \u2028")
+	for _, f := range []float64{0, 1, -2.5, 1e20, 1e21, 1e-6, 1e-7, 123456789, 0.1, math.MaxFloat64} {
+		marshal(f)
+	}
+	marshal(float32(0.1))
+	marshal(math.NaN())
+	marshal(math.Inf(-1))
+	marshal(func() {})
+	marshal(Sizes{-8, 200, 1.5, 7})
+	var d Doc
+	d.ID, d.Base.Created, d.Title, d.Version = 1, "base", "doc", 2
+	marshal(d)
+	d.Meta = &Meta{Created: "meta", Version: 3}
+	marshal(d)
+	marshal([]Color{0, 2})
+	marshal(map[string]Color{"c": 1})
+	marshal(&Bad{})
+	n := &Node{Value: 1}
+	n.Next = &Node{Value: 2}
+	marshal(n)
+	n.Next.Next = n
+	marshal(n)
+	var iface any
+	marshal(iface)
+	marshal(&iface)
+	marshal(json.RawMessage(`{"raw": [1, 2]}`))
+
+	b, _ := json.MarshalIndent(map[string]any{"a": []int{1, 2}, "b": map[string]int{}, "c": []int{}, "d": "x"}, ">", "  ")
+	fmt.Println(string(b))
+	b, _ = json.MarshalIndent(p, "", "\t")
+	fmt.Println(string(b))
+}
+
+func decoding() {
+	var p Person
+	unmarshal(`{"name": "Bob", "AGE": 42, "emails": ["a", "b"], "address": {"street": "x", "city": "y"},
+		"tags": {"k": 1}, "Password": "p", "-": 4, "score": 1e2, "extra": {"n": [1, 2.5, "s", false, null]},
+		"unknown": [1, {"x": 2}]}`, &p)
+	fmt.Println(p.Name, p.Age, p.Address.City, p.Password, p.Dash, p.Extra)
+
+	// the fields are reused, a null zeroes a pointer, a map or a slice
+	unmarshal(`{"name": "Cy", "emails": null, "address": null, "tags": {"j": 2}}`, &p)
+	unmarshal(`{"emails": ["one", "two", "three"]}`, &p)
+	unmarshal(`{"emails": []}`, &p)
+	fmt.Println(p.Emails == nil, len(p.Emails))
+
+	var arr [2]int
+	unmarshal(`[1, 2, 3]`, &arr)
+	unmarshal(`[7]`, &arr)
+	var m map[int]bool
+	unmarshal(`{"1": true, "-2": false}`, &m)
+	var sizes Sizes
+	unmarshal(`{"I8": 300, "U8": 255, "U": -1}`, &sizes)
+	unmarshal(`{"I8": 1.5}`, &sizes)
+	unmarshal(`{"U8": "s", "I8": 5}`, &sizes)
+	var x any
+	unmarshal(`[1, "two", {"three": 3}]`, &x)
+	fmt.Println(x)
+	unmarshal(`"é😀\ud800 \" \\ \/ \b\f\n\r\t"`, &x)
+	fmt.Printf("%q\n", x)
+	var bs []byte
+	unmarshal(`"aGVsbG8="`, &bs)
+	fmt.Println(string(bs))
+	var pi *int
+	unmarshal(`5`, &pi)
+	fmt.Println(*pi)
+	unmarshal(`null`, &pi)
+	fmt.Println(pi == nil)
+
+	var d Doc
+	unmarshal(`{"id": 9, "Created": "c", "Title": "t", "version": 4}`, &d)
+	fmt.Println(d.ID, d.Meta == nil, d.Title, d.Version)
+
+	var colors []Color
+	unmarshal(`["blue", "red"]`, &colors)
+	fmt.Println(colors)
+	var c Color
+	unmarshal(`"purple"`, &c)
+	var raw struct {
+		A json.RawMessage
+		B int
+	}
+	unmarshal(`{"A": {"x": [1,  2]}, "B": 3}`, &raw)
+	fmt.Println(string(raw.A))
+
+	var outer Outer
+	unmarshal(`{"inner": {"n": 1, "vals": ["x"]}, "N": true}`, &outer)
+
+	// the errors
+	unmarshal(`{"name": "x"}`, nil)
+	unmarshal(`{"name": "x"}`, p)
+	var np *Person
+	unmarshal(`{}`, np)
+	for _, bad := range []string{``, `{`, `[1,]`, `{"a" 1}`, `{"a": 1,}`, `{a: 1}`, `01`,
+		`[1] x`, `{"a": [1 2]}`, `'s'`} {
+		err := json.Unmarshal([]byte(bad), &x)
+		if syntax, ok := err.(*json.SyntaxError); ok {
+			fmt.Printf("%q: %v (offset %d)\n", bad, err, syntax.Offset)
+		} else {
+			fmt.Printf("%q: %v\n", bad, err)
+		}
+	}
+	fmt.Println(json.Valid([]byte(`{"a": [true, false, null, 1.5e-3, "s"]}`)), json.Valid([]byte(`{]`)))
+}
+
+func streams() {
+	dec := json.NewDecoder(newReader(`{"name": "a"} {"name": "b", "age": 2}
+		[1, 2]`))
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Println(v, dec.More())
+	}
+	dec = json.NewDecoder(newReader(`{"name": "a", "nope": 1}`))
+	dec.DisallowUnknownFields()
+	var p Person
+	fmt.Println(dec.Decode(&p))
+	dec = json.NewDecoder(newReader(`{"name": `))
+	fmt.Println(dec.Decode(&p))
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.Encode(map[string]any{"html": "<b>", "n": 1})
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	enc.Encode(map[string]any{"html": "<b>", "n": []int{1}})
+}
+
+func main() {
+	encoding()
+	decoding()
+	streams()
+}
@@ -0,0 +1,83 @@
+package main
+
+// go_parser.py --exec interp tests/labels.go prints what go run does,
+// so does the VM
+
+import "fmt"
+
+// find gives the position of want in grid, -1, -1 if it isn't there
+func find(grid [][]int, want int) (int, int) {
+	for i, row := range grid {
+		for j, v := range row {
+			if v == want {
+				goto found
+			}
+			continue
+		found:
+			return i, j
+		}
+	}
+	return -1, -1
+}
+
+func main() {
+	grid := [][]int{{1, 2}, {3, 4}, {5, 6}}
+	fmt.Println(find(grid, 4))
+	fmt.Println(find(grid, 9))
+
+	// break and continue of the loops around, the post statement of a
+	// loop runs on a continue
+rows:
+	for i := 0; i < len(grid); i++ {
+		for _, v := range grid[i] {
+			switch {
+			case v%2 == 0:
+				continue rows
+			case v > 4:
+				break rows
+			}
+			fmt.Print(i, ":", v, " ")
+		}
+	}
+	fmt.Println()
+
+	// a break in a select or a switch leaves it, but a labeled one can
+	// leave the loop it is in
+	n := 0
+loop:
+	for {
+		switch n {
+		case 3:
+			break loop
+		default:
+			n++
+		}
+	}
+	fmt.Println(n)
+
+	// a goto backwards runs the declarations after the label again, each
+	// time they declare new variables
+	var funcs []func() int
+	i := 0
+again:
+	x := i * 10
+	funcs = append(funcs, func() int { return x })
+	i++
+	if i < 3 {
+		goto again
+	}
+	for _, f := range funcs {
+		fmt.Print(f(), " ")
+	}
+	fmt.Println()
+
+	// a goto can leave blocks, but not enter them
+	{
+		if n > 1 {
+			goto done
+		}
+		fmt.Println("skipped")
+	}
+done:
+	fmt.Println("done")
+}
@@ -0,0 +1,49 @@
+package main
+
+// go_parser.py tests/labels_errors.go reports the labels below, like
+// go build does
+
+func main() {
+	// labels have to be used, once in a function
+unused:
+	for i := 0; i < 3; i++ {
+	}
+outer:
+	for {
+		break outer
+	}
+outer:
+	for {
+		break
+	}
+
+	// break and continue have to be in the statement labeled
+	goto missing
+	for {
+		continue nope
+	}
+sw:
+	switch {
+	case true:
+		continue sw
+	}
+L:
+	{
+		break L
+	}
+
+	// a goto can't jump over a variable declaration, nor into a block
+	goto after
+	x := 1
+after:
+	_ = x
+	goto inner
+	{
+	inner:
+	}
+	func() {
+		for {
+			break outer
+		}
+	}()
+}
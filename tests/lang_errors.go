@@ -0,0 +1,33 @@
+package main
+
+// go_parser.py -lang=go1.17 tests/lang_errors.go reports each feature
+// below, marked with the version it requires, like cmd/compile does. With
+// -lang=go1.21 only range over an integer is reported, and with the
+// default version (the latest one) there are no errors
+
+import "fmt"
+
+func Map[T, U any](s []T, f func(T) U) []U { // go1.18: type parameter, predeclared any
+	r := make([]U, 0, len(s))
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+type Pair[K comparable, V any] struct { // go1.18: type parameter, predeclared comparable, any
+	Key   K
+	Value V
+}
+
+func main() {
+	var x any = 1 // go1.18: predeclared any
+	fmt.Println(x)
+	double := Map[int, int]                                   // go1.18: function instantiation
+	fmt.Println(Map([]int{1, 2}, func(i int) int { return i })) // go1.18: implicit function instantiation
+	fmt.Println(double([]int{3}, func(i int) int { return 2 * i }))
+	fmt.Println(min(1, 2), max(3, 4)) // go1.21: built-in min, built-in max
+	for i := range 3 {                // go1.22: range over 3 (untyped int constant)
+		fmt.Println(i)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+// The version of Go of the program is the one of its go.mod, go1.21:
+// range over an integer (go1.22) is reported, like with -lang=go1.21
+//
+//   python go_parser.py tests/lang_module
+
+import "fmt"
+
+func main() {
+	fmt.Println(min(1, 2), max(3, 4))
+	for i := range 3 {
+		fmt.Println(i)
+	}
+}
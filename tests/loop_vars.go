@@ -0,0 +1,28 @@
+package main
+
+// go_parser.py run tests/loop_vars.go prints 0 1 2 twice: each iteration
+// of a loop has its own variables (since go1.22). go_parser.py run
+// -lang=go1.21 tests/loop_vars.go prints 3 3 3 and 2 2 2, like go1.21 does:
+// the iterations share the variables of the loop, the function literals
+// see their last values (so do --exec=vm and the python backend)
+
+import "fmt"
+
+func main() {
+	var counted []func() int
+	for i := 0; i < 3; i++ {
+		counted = append(counted, func() int { return i })
+	}
+	var ranged []func() int
+	for i := range []string{"a", "b", "c"} {
+		ranged = append(ranged, func() int { return i })
+	}
+	for _, f := range counted {
+		fmt.Print(f(), " ")
+	}
+	fmt.Println()
+	for _, f := range ranged {
+		fmt.Print(f(), " ")
+	}
+	fmt.Println()
+}
@@ -0,0 +1,33 @@
+package main
+
+// go_parser.py --diagnostics=json tests/malformed_decls.go reports the
+// errors of the declarations below, python fuzz.py checker found them
+// raising exceptions in the parser and the type checker instead
+
+import "fmt"
+
+const limit = 3
+
+// undefined types in the types of declarations
+type Celsius undefinedType
+
+var readings [limit]undefinedType
+var byName map[string]*undefinedType
+
+func average(values ...undefinedType) (undefinedType, bool) {
+	return values[0], true
+}
+
+// a constant isn't a type, nor is a constant too large for its type valid
+const tooLarge float64 = 1e400000
+
+func scale() limit {
+	return limit
+}
+
+func main() {
+	fmt.Println(readings[:], byName)
+	// a case clause out of a switch statement
+	case limit:
+	fmt.Println(average())
+}
@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	x, y int
+}
+
+func count(words []string) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < len(words); i++ {
+		counts[words[i]] += 1
+	}
+	return counts
+}
+
+func main() {
+	var empty map[string]int
+	ages := map[string]int{"alice": 31, "bob": 27}
+	ages["carol"] = 40
+	fmt.Println(len(empty), len(ages), ages["bob"])
+
+	// the zero value is given for a missing key
+	age, ok := ages["dave"]
+	if _, found := ages["alice"]; found && !ok {
+		fmt.Println(age)
+	}
+	delete(ages, "bob")
+
+	// the type of the elements is elided
+	points := map[string]Point{"origin": {0, 0}, "unit": {1, 1}}
+	fmt.Println(points["unit"].x)
+
+	grid := make(map[Point]bool, 4)
+	grid[Point{1, 2}] = true
+
+	sum := 0
+	for name, n := range ages {
+		fmt.Println(name)
+		sum += n
+	}
+	for name := range count([]string{"a", "b", "a"}) {
+		fmt.Println(name)
+	}
+	var key string
+	var value int
+	for key, value = range ages {
+		if value > 35 {
+			break
+		}
+	}
+	fmt.Println(sum, key)
+
+	// should report errors
+	var bad map[[]int]string
+	_ = map[string]int{"a": 1, "a": 2}
+	_ = map[string]int{3}
+	_ = ages[1]
+	delete(sum, "a")
+	_ = cap(ages)
+	_ = make(map[string]int, 1, 2)
+	points["unit"].x = 2
+	for a, b, c := range ages {
+	}
+	_ = bad
+}
@@ -0,0 +1,47 @@
+package main
+
+// go_parser.py run tests/math_pkg.go prints what go run does, so do
+// --exec=vm and the python backend (build --target=python)
+
+import (
+	"fmt"
+	"math"
+)
+
+// the constants of math are exact, so are the expressions of them
+const (
+	tau     = math.Pi * 2
+	big     = math.MaxInt64 + 1 // an untyped constant larger than any int64
+	half    = big / 2
+	maxInt8 = int8(math.MaxInt8)
+)
+
+type Point struct{ X, Y float64 }
+
+func (p Point) Dist(q Point) float64 {
+	return math.Sqrt(math.Pow(p.X-q.X, 2) + math.Pow(p.Y-q.Y, 2))
+}
+
+func main() {
+	fmt.Println(math.Pi, math.E, tau, math.Sqrt2)
+	fmt.Println(math.MaxInt64, math.MinInt64, half, maxInt8, math.MaxUint32)
+	fmt.Println(math.MaxFloat64, math.SmallestNonzeroFloat64, float32(math.MaxFloat32))
+	var areas [3]float64
+	for r := range 3 {
+		areas[r] = math.Pi * float64(r*r)
+	}
+	fmt.Println(areas)
+
+	fmt.Println(Point{0, 0}.Dist(Point{3, 4}))
+	for _, x := range []float64{2, 1.5, -1.5, -0.5, 0.5, 0, math.Inf(1), math.NaN()} {
+		fmt.Println(x, math.Sqrt(x), math.Floor(x), math.Ceil(x), math.Abs(x))
+	}
+	fmt.Println(math.Pow(2, 10), math.Pow(2, -1), math.Pow(-8, 1.0/3), math.Pow(0, -1), math.Pow(10, 400))
+	fmt.Println(math.Mod(7, 3), math.Mod(-7, 3), math.Mod(7, -3), math.Mod(5.5, 2), math.Mod(1, 0))
+
+	inf, nan := math.Inf(1), math.NaN()
+	fmt.Println(inf, math.Inf(-1), -inf, nan, nan == nan)
+	fmt.Println(math.IsInf(inf, 1), math.IsInf(inf, -1), math.IsInf(-inf, 0), math.IsInf(1e308, 0))
+	fmt.Println(math.IsNaN(nan), math.IsNaN(inf), math.IsNaN(inf-inf))
+	fmt.Printf("%.4f %.3e %v\n", math.Pi, math.Ln2, math.Floor(-2.5))
+}
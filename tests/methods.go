@@ -0,0 +1,64 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	x, y int
+}
+
+type Counter int
+
+func (p Point) sum() int {
+	return p.x + p.y
+}
+
+func (p *Point) scale(k int) {
+	p.x = p.x * k
+	p.y *= k
+}
+
+func (p *Point) moved(dx int) Point {
+	return Point{p.x + dx, p.sum()}
+}
+
+func (c Counter) twice() Counter {
+	return c * 2
+}
+
+func main() {
+	p := Point{1, 2}
+	fmt.Println(p.sum())
+
+	// &p is taken for the pointer receiver
+	p.scale(3)
+	q := p.moved(1)
+	fmt.Println(q.x, q.y)
+
+	var c Counter = 4
+	fmt.Println(c.twice().twice())
+
+	points := [2]Point{{1, 1}, {2, 2}}
+	points[1].scale(2)
+
+	// a method value and a method expression
+	f := p.sum
+	_ = f
+	fmt.Println(Point.sum(q))
+
+	// should report errors
+	p.area()
+	Point{3, 4}.scale(2)
+	_ = Point.scale
+	_ = p.sum(1)
+}
+
+func (p Point) x() int {
+	return 0
+}
+
+func (n int) double() int {
+	return n * 2
+}
+
+func (a, b Point) both() {
+}
@@ -0,0 +1,10 @@
+module example.com/broken
+
+go 1.21
+
+require (
+	example.com/Missing v1.2.3
+	example.com/local v0.0.0
+)
+
+replace example.com/local => ./nowhere
@@ -0,0 +1,20 @@
+package main
+
+// The imports a module can't resolve
+//
+//   python go_parser.py tests/module_errors
+
+// should report errors
+import (
+	"fmt"
+
+	"example.com/Missing/sub"
+	"example.com/broken/nothing"
+	"example.com/broken/util"
+	"example.com/local"
+	"github.com/acme/widgets"
+)
+
+func main() {
+	fmt.Println(util.Name, sub.X, nothing.X, local.X, widgets.X)
+}
@@ -0,0 +1,11 @@
+package geometry
+
+import "example.com/units"
+
+type Rect struct {
+	Width, Height units.Meters
+}
+
+func (r Rect) Perimeter() units.Meters {
+	return 2 * (r.Width + r.Height)
+}
@@ -0,0 +1,7 @@
+module example.com/shapes
+
+go 1.21
+
+require example.com/units v0.1.0
+
+replace example.com/units => ./units
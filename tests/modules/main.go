@@ -0,0 +1,20 @@
+package main
+
+// A program in a module: go.mod gives the module path the packages of its
+// directories are imported by, and the directory of the module it requires
+//
+//   python go_parser.py run tests/modules
+
+import (
+	"fmt"
+
+	"example.com/shapes/geometry"
+	"example.com/units"
+)
+
+func main() {
+	r := geometry.Rect{Width: 2, Height: 3.5}
+	fmt.Println(r.Perimeter())
+	var side units.Meters = 4
+	fmt.Println(side, r.Width+side)
+}
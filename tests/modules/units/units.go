@@ -0,0 +1,10 @@
+package units
+
+import "fmt"
+
+// Meters is a length
+type Meters float64
+
+func (m Meters) String() string {
+	return fmt.Sprintf("%gm", float64(m))
+}
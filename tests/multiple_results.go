@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+// named results are returned by a bare return
+func swap(a, b int, c string) (x, y int) {
+	x, y = b, a
+	return
+}
+
+func main() {
+	q, r := divmod(17, 5)
+	var s, t = swap(q, r, "swap")
+	s, t = t, s
+	fmt.Println(q, r, s, t)
+
+	// declared after it is called
+	show(q)
+
+	// should report errors
+	var k int = divmod(1, 2)
+	a, b, c := divmod(3, 4)
+	fmt.Println(k, a, b, c)
+}
+
+func show(int) {
+}
+
+func mixed(a int, string) {
+}
@@ -0,0 +1,75 @@
+package main
+
+// go_parser.py run -O tests/optimize.go runs it optimized (see optimize.py),
+// it prints the same without -O. go_parser.py -O --ast=text tests/optimize.go
+// prints its AST optimized: seconds returns h * 3600, the branches on debug
+// and verbose are removed, and so is y = x + 1 in stores (not the stores of
+// z, captured, nor the ones of the result n, read after the panic)
+
+import "fmt"
+
+const debug = false
+
+const verbose = !debug
+
+func seconds(h int) int {
+	return h * 60 * 60
+}
+
+func offsets(b int8, u uint8, x int) (int8, uint8, int) {
+	return b + 100 + 100, 2 - u - 3, 10 - (1 + x) - 4 + 1
+}
+
+func label(s string) string {
+	return s + "-" + "ok"
+}
+
+func sum(xs []int) int {
+	total := 0
+	total = 100
+	for _, x := range xs {
+		total += x
+	}
+	if debug {
+		fmt.Println("sum of", xs)
+	} else if n := len(xs); verbose {
+		fmt.Println("sum of", n, "numbers")
+	} else {
+		fmt.Println("never")
+	}
+	for i := 0; debug; i++ {
+		fmt.Println("never", i)
+	}
+	return total
+}
+
+func stores(x int) int {
+	y := x
+	y = x + 1
+	y = 7
+	z := 1
+	f := func() int { return z }
+	z = 2
+	unused := x
+	unused = x * 2
+	_ = unused
+	y = y * 2
+	return y + f() + x
+}
+
+func recovered() (n int) {
+	defer func() { recover() }()
+	n = 1
+	n = 2
+	var m map[string]int
+	m["x"] = n
+	return 3
+}
+
+func main() {
+	fmt.Println(seconds(2))
+	fmt.Println(offsets(100, 1, 5))
+	fmt.Println(label("build"))
+	fmt.Println(sum([]int{1, 2, 3}))
+	fmt.Println(stores(5), recovered())
+}
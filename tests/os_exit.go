@@ -0,0 +1,30 @@
+package main
+
+// go_parser.py run tests/os_exit.go one two prints what go run does with
+// the same arguments, so does the VM (run --exec=vm). The exit status is
+// the one given to os.Exit, and the deferred call is not run
+
+import (
+	"fmt"
+	"os"
+)
+
+func usage() {
+	fmt.Println("usage: os_exit args...")
+	os.Exit(2)
+}
+
+func main() {
+	defer fmt.Println("not printed")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for i, arg := range os.Args[1:] {
+		fmt.Println(i+1, arg, len(arg))
+	}
+	args := os.Args[1:]
+	args[0] = "changed"
+	fmt.Println(os.Args[1])
+	fmt.Print("exiting")
+	os.Exit(len(args) + 1)
+}
@@ -0,0 +1,76 @@
+package main
+
+// go_parser.py run tests/os_io.go < tests/os_io.go prints what go run does,
+// so do --exec=vm and the python backend (build --target=python). It
+// writes os_io.txt in the current directory and removes it.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type counter struct {
+	n int
+}
+
+// Write counts the bytes written, counter is an io.Writer
+func (c *counter) Write(p []byte) (int, error) {
+	c.n += len(p)
+	return len(p), nil
+}
+
+func report(w io.Writer, name string, lines int) {
+	fmt.Fprintf(w, "%s: %d lines\n", name, lines)
+}
+
+func main() {
+	fmt.Fprintln(os.Stdout, "to stdout", 1, 2.5)
+	fmt.Fprint(os.Stderr, "to stderr\n")
+	os.Stdout.WriteString("written ")
+	os.Stdout.Write([]byte("bytes\n"))
+	io.WriteString(os.Stdout, "io.WriteString\n")
+	fmt.Println(os.Stdout.Name(), os.Stdin.Name())
+
+	c := &counter{}
+	fmt.Fprintf(c, "%d-%s", 42, "abc")
+	report(c, "x", 3)
+	fmt.Println(c.n)
+
+	err := os.WriteFile("os_io.txt", []byte("first\nsecond\nthird\n"), 0644)
+	fmt.Println(err)
+	// 0644 is an octal literal, rw-r--r--
+	info, err := os.Stat("os_io.txt")
+	fmt.Println(info.Name(), info.Size(), info.Mode(), info.IsDir(), err)
+	fmt.Println(info.Mode().Perm() == 0644, info.Mode().Perm() == 0o644)
+	fmt.Printf("%o %#o %v\n", info.Mode().Perm(), 0o644, 0x1A4 == 0b110100100)
+	data, err := os.ReadFile("os_io.txt")
+	fmt.Println(len(data), err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	report(os.Stdout, "os_io.txt", len(lines))
+	fmt.Println(os.Remove("os_io.txt"))
+	fmt.Println(os.Remove("os_io.txt"))
+
+	_, err = os.ReadFile("no/such/file.txt")
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission))
+	pathErr, ok := err.(*os.PathError)
+	fmt.Println(ok, pathErr.Op, pathErr.Path)
+
+	_, err = os.ReadFile("tests")
+	fmt.Println(err)
+	info, err = os.Stat("tests/")
+	fmt.Println(info.Name(), info.IsDir(), info.Mode().IsDir(), info.Mode()&os.ModeDir != 0, err)
+	_, err = os.Stat("no/such/file.txt")
+	fmt.Println(err)
+	fmt.Println(os.WriteFile("no/such/dir/x.txt", nil, 0644))
+
+	// the program itself when run with < tests/os_io.go
+	input, err := io.ReadAll(os.Stdin)
+	fmt.Println(len(input) > 0, err, strings.HasPrefix(string(input), "package main"))
+	if len(os.Args) > 1 {
+		fmt.Println(os.Args[1:])
+	}
+}
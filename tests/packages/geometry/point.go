@@ -0,0 +1,17 @@
+package geometry
+
+import "units"
+
+type Point struct {
+	X, Y int
+}
+
+var Origin = Point{0, 0}
+
+func (p Point) Dist() int {
+	return scale(p.X*p.X + p.Y*p.Y)
+}
+
+func scale(x int) int {
+	return x * units.Scale
+}
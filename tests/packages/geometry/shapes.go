@@ -0,0 +1,15 @@
+package geometry
+
+import "units"
+
+const Sides = 4
+
+type Meters int
+
+func (m Meters) Double() Meters {
+	return m * 2
+}
+
+func Area(width, height int) int {
+	return units.Square(width) * height / width
+}
@@ -0,0 +1,7 @@
+package main
+
+var count = 2
+
+func double(x int) int {
+	return 2 * x
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"geometry"
+)
+
+func main() {
+	p := geometry.Point{3, 4}
+	fmt.Println(p.Dist(), geometry.Area(2, 3), double(geometry.Sides))
+
+	// the files of a package share its package scope
+	var q geometry.Point = geometry.Origin
+	q.X = count
+	var side geometry.Meters = 5
+	fmt.Println(q.Dist(), side.Double())
+
+	// should report errors
+	_ = geometry.Missing
+	_ = geometry.scale(1)
+	var n string = geometry.Area(1, 2)
+	_ = units.Scale
+	_ = n
+}
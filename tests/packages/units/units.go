@@ -0,0 +1,7 @@
+package units
+
+const Scale = 10
+
+func Square(x int) int {
+	return x * x
+}
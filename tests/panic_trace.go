@@ -0,0 +1,61 @@
+package main
+
+// go_parser.py run tests/panic_trace.go ends with a panic, printed with the
+// stack trace go run prints (without the +0x offsets of the frames, and
+// with (...) for the arguments): the functions, methods and function
+// literals it went through, with the file and the line each one is at.
+// --exec=vm and the python backend (build --target=python) print it too
+
+import "fmt"
+
+type Stack struct {
+	items []int
+}
+
+func (s *Stack) Push(v int) {
+	s.items = append(s.items, v)
+}
+
+func (s *Stack) Pop() int {
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v
+}
+
+type Point struct{ X, Y int }
+
+func (p Point) Ratio() int {
+	return p.X / p.Y
+}
+
+func apply[T any](f func(T) T, x T) T {
+	return f(x)
+}
+
+func safely(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered: %v", r)
+		}
+	}()
+	f()
+	return nil
+}
+
+func main() {
+	s := &Stack{}
+	s.Push(1)
+	fmt.Println(s.Pop())
+
+	// the panics which are recovered aren't printed
+	fmt.Println(safely(func() { fmt.Println(Point{1, 0}.Ratio()) }))
+	fmt.Println(safely(func() { s.Pop() }))
+
+	defer fmt.Println("deferred calls run before the trace is printed")
+	apply(func(n int) int {
+		pop := func() int {
+			return s.Pop()
+		}
+		return pop() + n
+	}, 1)
+}
@@ -0,0 +1,31 @@
+package main
+
+// go_parser.py run tests/permissive.go reports the constructs below which
+// gopy doesn't support yet as errors (strict mode), go_parser.py run
+// --permissive tests/permissive.go reports them as warnings and runs the
+// program without them, printing start, 3 and end (so does --exec=vm, and
+// the python backend with build --permissive)
+
+import (
+	"fmt"
+	. "strings" // dot import
+)
+
+func count(yield func(int) bool) {
+	for i := 0; i < 3; i++ {
+		if !yield(i) {
+			return
+		}
+	}
+}
+
+func main() {
+	fmt.Println("start")
+	println("debugging") // the builtin println
+	n := 0
+	for i := range count { // range over a function
+		n += i
+	}
+	fmt.Println(n + 3)
+	fmt.Println("end")
+}
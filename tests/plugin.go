@@ -0,0 +1,24 @@
+package main
+
+// go_parser.py -plugin tests/plugins/selfassign.py tests/plugin.go runs the
+// analyzer of tests/plugins/selfassign.py on the program once it is type
+// checked, which reports the self-assignments of lines 15, 19 and 20 (not
+// the swap of line 22) as warnings coded SelfAssign, like go vet does.
+// --suppress SelfAssign suppresses them
+
+import "fmt"
+
+type point struct{ x, y int }
+
+func main() {
+	n := 3
+	n = n
+	p := point{1, 2}
+	q := []int{1, 2}
+	p.x, p.y = p.y, p.x
+	p.x = p.x
+	q[0] = q[0]
+	a, b := 1, 2
+	a, b = b, a
+	fmt.Println(n, p, q, a, b)
+}
@@ -0,0 +1,45 @@
+import analysis
+import checker
+import syntree
+
+from diagnostics import Fix
+
+
+# An analyzer for go_parser.py -plugin, like the assign analyzer of go vet:
+# it reports the assignments of a variable (or a field, an element...) to
+# itself, like x = x, which do nothing. See tests/plugin.go
+
+
+def run(pass_: analysis.Pass) -> int:
+    """Reports the self-assignments of the package, returns their number"""
+    found = 0
+
+    def assignment(node) -> bool:
+        nonlocal found
+        if not isinstance(node, syntree.Assignment) or node.operator != "=":
+            return True
+        lhs, rhs = checker.in_order(node.left), checker.in_order(node.right)
+        if len(lhs) != len(rhs):
+            return False
+        for left, right in zip(lhs, rhs):
+            x = checker.expr_string(left)
+            if x == checker.expr_string(right) and pass_.type_of(left) is not None:
+                lineno, _, _ = checker.position(node)
+                fix = Fix("remove the assignment", "", lineno, None, 0, file=file.filename)
+                pass_.report(f"self-assignment of {x} to {x}", left,
+                             fix=fix if len(lhs) == 1 else None, file=file.filename)
+                found += 1
+        return False
+
+    for file in pass_.files:
+        syntree.inspect(file, lambda node: node is not None and assignment(node))
+    return found
+
+
+selfassign = analysis.Analyzer(
+    name="SelfAssign",
+    doc="reports the assignments of a variable to itself, like x = x",
+    run=run,
+)
+
+analyzers = [selfassign]
@@ -0,0 +1,30 @@
+import os
+import astdump
+import backend
+import checker
+
+
+# A backend for the -plugin flag of go_parser.py build: it writes the AST
+# of each package of the program as an S-expression, in a file named by
+# the package (main.sexp), for the tools reading them. It only compiles
+# the programs, run doesn't list it. See tests/backend.go
+
+
+class Sexp(backend.Backend):
+    name = "sexp"
+    doc = "writes the AST of each package as an S-expression"
+
+    def compile(self, packages: list, info: checker.Info, output: str) -> bool:
+        os.makedirs(output, exist_ok=True)
+        for package in packages:
+            if package.std:
+                continue
+            with open(os.path.join(output, package.name + ".sexp"), "wt") as f:
+                astdump.fprint(package.ast, f, format="sexp")
+        return True
+
+    def output(self, packages: list, output: str) -> str:
+        return os.path.join(output, packages[-1].name + ".sexp")
+
+
+backends = [Sexp()]
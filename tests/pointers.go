@@ -0,0 +1,58 @@
+package main
+
+import "fmt"
+
+type Node struct {
+	value int
+	next  *Node
+}
+
+func (n *Node) push(value int) *Node {
+	return &Node{value, n}
+}
+
+func swap(a, b *int) {
+	*a, *b = *b, *a
+}
+
+func sum(list *Node) int {
+	total := 0
+	for n := list; n != nil; n = n.next {
+		total += n.value
+	}
+	return total
+}
+
+func main() {
+	x, y := 1, 2
+	p := &x
+	*p = 3
+	*p += 1
+	swap(&x, &y)
+	fmt.Println(x, y, *p)
+
+	// fields are reached through the pointer, implicitly or not
+	var list *Node
+	list = list.push(1).push(2)
+	list.value = 5
+	(*list).next.value++
+	fmt.Println(sum(list), list.next != nil)
+
+	counter := new(int)
+	*counter++
+	points := [2]Node{}
+	q := &points[1].value
+	*q = *counter
+	pp := &p
+	**pp = 7
+
+	// should report errors
+	var n int = nil
+	_ = &5
+	_ = *x
+	_ = x == nil
+	_ = nil == nil
+	m := nil
+	_ = new(x)
+	_, _ = n, m
+}
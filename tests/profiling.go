@@ -0,0 +1,43 @@
+package main
+
+// go_parser.py run -cpuprofile cpu.out -memprofile mem.out
+// tests/profiling.go writes the profiles of the Go functions of the program
+// when it ends, which go tool pprof reads: go tool pprof -top cpu.out shows
+// most of the time in fib (and line 25 of fib above the others with
+// -lines), and go tool pprof -top mem.out the bytes allocated by words, the
+// arrays append grows (-sample_index alloc_objects counts them: 11 arrays
+// for the 1000 strings, and the counter of main)
+
+import "fmt"
+
+type counter struct {
+	n int
+}
+
+func (c *counter) add(n int) {
+	c.n += n
+}
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+func words(n int) []string {
+	var s []string
+	for i := 0; i < n; i++ {
+		s = append(s, fmt.Sprint(i))
+	}
+	return s
+}
+
+func main() {
+	c := &counter{}
+	for i := 0; i < 5; i++ {
+		c.add(fib(15))
+	}
+	fmt.Println(c.n)
+	fmt.Println(len(words(1000)))
+}
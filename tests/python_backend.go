@@ -0,0 +1,180 @@
+package main
+
+// go_parser.py build --target=python tests/python_backend.go -o out
+// writes out/main.py, run with python3 out/main.py
+
+import "fmt"
+
+// the valid constants of const_declarations.go
+const Pi float64 = 3.14159265358979323846
+const float_testing float64 = 1E6
+const zero = 1e7
+const (
+	size int = 1024
+	eof      = -1.0
+	eof1     = +1
+)
+const a, b, c = 3, 4, "foo"
+const u, v float64 = 0, 3
+const x, y int = 0.0, 3.0
+const rv int = 5.0
+const h uint8 = 32.0
+const somemore = 5.0 * 5
+const two = "foo" + "foo"
+const brr = 7 + 8 + 3.0
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+	GB
+)
+
+type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X, p.Y)
+}
+
+func (p *Point) Move(dx, dy int) {
+	p.X += dx
+	p.Y += dy
+}
+
+type Shape interface {
+	Area() float64
+}
+
+type Rect struct {
+	W, H float64
+}
+
+func (r Rect) Area() float64 {
+	return r.W * r.H
+}
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func safeDiv(a, b int) (q int, err string) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Sprint(r)
+		}
+	}()
+	q = a / b
+	return q, ""
+}
+
+func trace(name string) {
+	fmt.Println("leaving", name)
+}
+
+func work() {
+	defer trace("work")
+	for i := 0; i < 3; i++ {
+		defer fmt.Println("deferred", i)
+	}
+	fmt.Println("working")
+}
+
+func sum(nums ...int) int {
+	total := 0
+	for i := 0; i < len(nums); i++ {
+		total += nums[i]
+	}
+	return total
+}
+
+func main() {
+	fmt.Println(Pi, float_testing, zero, size, eof, eof1)
+	fmt.Println(a, b, c, u, v, x, y, rv, h, somemore, two, brr)
+	fmt.Println(KB, MB, GB, Monday, Tuesday)
+
+	p := Point{1, 2}
+	q := p
+	q.Move(10, 20)
+	fmt.Println(p, q)
+	fmt.Printf("%v %+v\n", p.String(), q)
+
+	var s Shape = Rect{3, 4}
+	fmt.Println(s.Area())
+
+	quo, rem := divmod(-7, 2)
+	fmt.Println(quo, rem)
+	n, err := safeDiv(7, 2)
+	fmt.Println(n, err)
+	n, err = safeDiv(1, 0)
+	fmt.Println(n, err)
+	work()
+
+	fmt.Println(sum(), sum(1, 2, 3))
+	nums := []int{4, 5, 6}
+	fmt.Println(sum(nums...))
+
+	var i8 int8 = 127
+	i8++
+	var u8 uint8 = 200
+	u8 += 100
+	big := 1 << 62
+	fmt.Println(i8, u8, big*4, -7/2, -7%2)
+
+	counts := map[string]int{}
+	words := []string{"a", "b", "a"}
+	for i := 0; i < len(words); i++ {
+		counts[words[i]]++
+	}
+	fmt.Println(counts, len(counts))
+
+	arr := [5]int{1, 2, 3}
+	sl := arr[1:4]
+	sl[0] = 20
+	sl = append(sl, 40)
+	fmt.Println(arr, sl, len(sl), cap(sl))
+
+	var funcs []func() int
+	for i := 0; i < 3; i++ {
+		funcs = append(funcs, func() int { return i * i })
+	}
+	for i := 0; i < len(funcs); i++ {
+		fmt.Print(funcs[i](), " ")
+	}
+	fmt.Println()
+
+	switch day := Monday; day {
+	case Sunday:
+		fmt.Println("sunday")
+	case Monday:
+		fmt.Println("monday")
+		fallthrough
+	case Tuesday:
+		fmt.Println("tuesday")
+	default:
+		fmt.Println("another day")
+	}
+
+	word := "héllo"
+	for i := 0; i < len(word); i++ {
+		if word[i] == 'l' {
+			break
+		}
+		fmt.Println(i, word[i])
+	}
+	for k, count := range counts {
+		if k == "a" {
+			fmt.Println(k, count)
+		}
+	}
+	fmt.Printf("%5.2f|%-4d|%q\n", Pi, size, c)
+}
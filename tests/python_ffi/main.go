@@ -0,0 +1,40 @@
+package main
+
+// The functions of a Python module, imported as python/NAME (see
+// pyffi.py): the ones of math and json, and of shapes.py, next to the
+// program, whose annotations are the types of the Go functions. The
+// exception of the last call is a panic
+//
+//   python go_parser.py run tests/python_ffi
+//   python go_parser.py run --exec=vm tests/python_ffi
+
+import (
+	"fmt"
+	"python"
+	"python/json"
+	"python/math"
+	"python/shapes"
+)
+
+func main() {
+	fmt.Println(math.Sqrt(2), math.Pi, shapes.SIDES)
+	fmt.Println(shapes.Area(2, 3.5), shapes.Label("go"), shapes.Label("go", 3))
+	fmt.Println(shapes.Total([]int{1, 2, 3}))
+	fmt.Println(shapes.Scale(map[string]float64{"a": 1.5, "b": 2}, 2))
+
+	// any gets the Go type of the value
+	v := json.Loads(`{"name": "gopy", "tags": ["go", "python"], "stars": 3}`)
+	m := v.(map[any]any)
+	fmt.Println(m["name"].(string), m["tags"].([]any), m["stars"].(int)+1)
+	fmt.Println(json.Dumps([]any{1, "two", 3.5, true, nil}))
+
+	// the objects of the other types are python.Objects
+	s := shapes.Square(3).(python.Object)
+	fmt.Println(s, s.Attr("side"), s.Attr("area").(python.Object).Call())
+
+	defer func() {
+		fmt.Println("recovered:", recover())
+		shapes.Check(-1)
+	}()
+	shapes.Check(-2)
+}
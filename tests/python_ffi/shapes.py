@@ -0,0 +1,36 @@
+"""The Python module tests/python_ffi/main.go imports as python/shapes"""
+
+SIDES = 4
+
+
+def area(width: float, height: float) -> float:
+    return width * height
+
+
+def label(name: str, times: int = 1) -> str:
+    return " ".join([name] * times)
+
+
+def total(xs: list[int]) -> int:
+    return sum(xs)
+
+
+def scale(m: dict[str, float], k: float) -> dict[str, float]:
+    return {key: v * k for key, v in m.items()}
+
+
+def check(side):
+    if side < 0:
+        raise ValueError(f"negative side {side}")
+    return side
+
+
+class Square:
+    def __init__(self, side):
+        self.side = side
+
+    def area(self):
+        return self.side * self.side
+
+    def __str__(self):
+        return f"Square({self.side})"
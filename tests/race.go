@@ -0,0 +1,174 @@
+package main
+
+// go_parser.py run -race tests/race.go prints what go run -race does, but
+// for the addresses and the ids of the goroutines, and exits with 66 too
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var hits int
+
+type account struct {
+	balance int
+}
+
+func (a *account) deposit(n int) {
+	a.balance += n
+}
+
+// racy has a race on each kind of variable: the goroutines write them
+// without synchronizing with main, which reads or writes them after them
+func racy() {
+	go func() {
+		hits = 1
+	}()
+	time.Sleep(10 * time.Millisecond)
+	fmt.Println("hits:", hits)
+
+	a := &account{}
+	go func() {
+		a.deposit(10)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	a.deposit(5)
+	fmt.Println("balance:", a.balance)
+
+	s := make([]int, 3)
+	go func() {
+		s[1] = 5
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s[1] = 6
+	fmt.Println("s:", s)
+
+	// the race in the loop is reported once
+	n := 0
+	for i := 0; i < 3; i++ {
+		go func() {
+			n++
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Println("n:", n)
+}
+
+// synchronized has no races: the accesses of the goroutines happen before
+// the ones of main, or are both reads
+func synchronized() {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	total := 0
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			total += i
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	fmt.Println("total:", total)
+
+	x := 0
+	done := make(chan bool)
+	go func() {
+		x = 1
+		done <- true
+	}()
+	<-done
+	fmt.Println("x:", x)
+
+	// a buffered channel as a semaphore
+	sem := make(chan struct{}, 1)
+	y := 0
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			y++
+			<-sem
+		}()
+	}
+	wg.Wait()
+	fmt.Println("y:", y)
+
+	var rw sync.RWMutex
+	config := map[string]string{"mode": "fast"}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rw.RLock()
+			_ = config["mode"]
+			rw.RUnlock()
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rw.Lock()
+		config["mode"] = "slow"
+		rw.Unlock()
+	}()
+	wg.Wait()
+	fmt.Println("mode:", config["mode"])
+
+	var ready atomic.Bool
+	z := 0
+	go func() {
+		z = 42
+		ready.Store(true)
+	}()
+	for !ready.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	fmt.Println("z:", z)
+
+	var once sync.Once
+	w := 0
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			once.Do(func() { w = 7 })
+			_ = w
+		}()
+	}
+	wg.Wait()
+	fmt.Println("w:", w)
+
+	results := make(chan int)
+	quit := make(chan bool)
+	v := 0
+	go func() {
+		v = 3
+		select {
+		case results <- v:
+		case <-quit:
+		}
+	}()
+	fmt.Println("v:", <-results, v)
+
+	// reads don't race with each other
+	shared := 8
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = shared * 2
+		}()
+	}
+	fmt.Println("shared:", shared)
+	wg.Wait()
+}
+
+func main() {
+	racy()
+	synchronized()
+}
@@ -0,0 +1,94 @@
+package main
+
+// go_parser.py --exec interp tests/range.go prints what go run does,
+// so do the VM and the python module written by go_parser.py build
+
+import "fmt"
+
+type Grid [2][3]int
+
+func sum(values ...int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func main() {
+	// the index and a copy of the element of a slice, the range
+	// expression is evaluated once before the loop
+	primes := []int{2, 3, 5, 7}
+	for i, p := range primes {
+		if i == 0 {
+			primes = append(primes, 11)
+		}
+		p *= 10
+		fmt.Print(i, ":", p, " ")
+	}
+	fmt.Println(len(primes), sum(primes...))
+
+	// an array (or a pointer to one), the index only without a variable
+	var grid Grid
+	for i := range grid {
+		for j := range grid[i] {
+			grid[i][j] = i*10 + j
+		}
+	}
+	for _, row := range &grid {
+		fmt.Print(row, " ")
+	}
+	fmt.Println()
+
+	// the index of the first byte of each rune in a string
+	for i, r := range "日本, go" {
+		fmt.Print(i, ":", string(r), " ")
+	}
+	fmt.Println()
+
+	// the entries of a map are visited in no particular order
+	ages := map[string]int{"ana": 31, "bob": 25, "cy": 40}
+	total := 0
+	for name, age := range ages {
+		total += age + len(name)
+	}
+	fmt.Println(total)
+
+	// the integers from 0 to n-1, of the type of n
+	var n int8 = 3
+	for i := range n {
+		fmt.Print(i*50, " ")
+	}
+	count := 0
+	for range 5 {
+		count++
+	}
+	fmt.Println(count)
+
+	// the iteration variables can be assigned instead of declared
+	var last int
+	var r rune
+	for last, r = range "héllo" {
+	}
+	fmt.Println(last, string(r))
+	for i := range 10 {
+		if i%3 != 0 {
+			continue
+		}
+		if i > 7 {
+			break
+		}
+		fmt.Print(i, " ")
+	}
+	fmt.Println()
+
+	// each iteration has its own variables
+	var prints []func()
+	for i, s := range []string{"a", "b"} {
+		prints = append(prints, func() { fmt.Print(i, s, " ") })
+	}
+	for _, f := range prints {
+		f()
+	}
+	fmt.Println()
+}
@@ -0,0 +1,44 @@
+package main
+
+// go_parser.py tests/range_errors.go reports the range clauses below,
+// like go vet does
+
+func main() {
+	var f float64
+	var pp *[]int
+	for range f {
+	}
+	for range pp {
+	}
+	for i := range 3.5 {
+		_ = i
+	}
+
+	// a channel is received from, it gives one value like an integer
+	var send chan<- int
+	for range send {
+	}
+	for i, v := range make(chan int) {
+		_, _ = i, v
+	}
+	for i, v := range 10 {
+		_, _ = i, v
+	}
+
+	// the iteration variables assigned have to be of the types given
+	var s string
+	var b byte
+	var x float64
+	for _, b = range s {
+	}
+	for x = range 3 {
+	}
+	for x = range []int{} {
+	}
+	var n int8
+	for i := range n {
+		var j int = i
+		_ = j
+	}
+	_, _ = b, x
+}
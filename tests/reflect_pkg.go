@@ -0,0 +1,232 @@
+package main
+
+// go_parser.py run tests/reflect_pkg.go prints what go run does, so does
+// --exec=vm (the python backend doesn't have the reflect package)
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Point struct {
+	X, Y int
+}
+
+type User struct {
+	Name    string   `json:"name"`
+	Age     int      `json:"age,omitempty"`
+	Emails  []string `json:"emails"`
+	Admin   bool     `json:"-"`
+	Score   float64  `json:"score" xml:"s"`
+	Home    *Point
+	private int
+}
+
+type Celsius float64
+
+func (c Celsius) String() string {
+	return strconv.FormatFloat(float64(c), 'f', 1, 64) + "C"
+}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+// encode returns v encoded like JSON, with the names of the json tags
+func encode(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return "null"
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.Itoa(int(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return "null"
+		}
+		return encode(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return "null"
+		}
+		var elems []string
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, encode(v.Index(i)))
+		}
+		return "[" + strings.Join(elems, ",") + "]"
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		var entries []string
+		for _, k := range keys {
+			entries = append(entries, strconv.Quote(k.String())+":"+encode(v.MapIndex(k)))
+		}
+		return "{" + strings.Join(entries, ",") + "}"
+	case reflect.Struct:
+		t := v.Type()
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			opts := strings.Split(f.Tag.Get("json"), ",")
+			name := opts[0]
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if len(opts) > 1 && opts[1] == "omitempty" && v.Field(i).IsZero() {
+				continue
+			}
+			fields = append(fields, strconv.Quote(name)+":"+encode(v.Field(i)))
+		}
+		return "{" + strings.Join(fields, ",") + "}"
+	}
+	return strconv.Quote(v.Type().String())
+}
+
+func marshal(x any) string {
+	return encode(reflect.ValueOf(x))
+}
+
+func types() {
+	var pair Pair[string, int]
+	for _, x := range []any{1, "s", 2.5, true, uint8(1), int32('r'), Celsius(20), Point{},
+		&Point{}, []int{}, [2]string{}, map[string]int{}, func() {}} {
+		t := reflect.TypeOf(x)
+		fmt.Printf("%v %v %q %q\n", t, t.Kind(), t.Name(), t.PkgPath())
+	}
+	fmt.Println(reflect.TypeOf(pair).Name(), reflect.TypeOf(pair).Field(1).Type)
+	// the types are the ones of %T: byte and rune are uint8 and int32
+	var r rune
+	var b []byte
+	var rb Pair[rune, byte]
+	for _, x := range []any{r, b, struct {
+		X rune `json:"x"`
+		Point
+	}{}, struct{}{}, map[string][]rune{}, func(byte) error { return nil }, [2]any{}} {
+		t := reflect.TypeOf(x)
+		fmt.Printf("%s %s %q\n", t.String(), t.Kind(), t.Name())
+	}
+	fmt.Println(reflect.TypeOf(r) == reflect.TypeOf(int32(0)), reflect.TypeOf(rb))
+	fmt.Println(reflect.TypeOf(nil) == nil)
+	fmt.Println(reflect.TypeOf(1) == reflect.TypeOf(2), reflect.TypeOf(1) == reflect.TypeOf("1"))
+	fmt.Println(reflect.TypeOf([]Point{}).Elem(), reflect.TypeOf(map[string]bool{}).Key(),
+		reflect.TypeOf([3]int{}).Len(), reflect.PointerTo(reflect.TypeOf(Point{})))
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+	fmt.Println(errType.Kind(), errType.Name())
+
+	t := reflect.TypeOf(User{})
+	fmt.Println(t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fmt.Printf("%s %v %q %v %q\n", f.Name, f.Type, f.Tag, f.IsExported(), f.PkgPath)
+	}
+	f, ok := t.FieldByName("Score")
+	fmt.Println(f.Tag.Get("json"), f.Tag.Get("xml"), f.Tag.Get("yaml"), f.Index, ok)
+	_, ok = t.FieldByName("Missing")
+	fmt.Println(ok)
+	v, ok := reflect.StructTag(`a:"1" b:"x y"`).Lookup("b")
+	fmt.Println(v, ok)
+	fmt.Println(reflect.Struct, reflect.Pointer == reflect.Ptr, reflect.Kind(100))
+}
+
+func values() {
+	v := reflect.ValueOf(42)
+	fmt.Println(v, v.Int(), v.Kind(), v.Type(), v.CanSet(), v.String())
+	fmt.Printf("%v %d %T\n", v, v, v)
+	fmt.Println(reflect.ValueOf("hi").String(), reflect.ValueOf("hi").Len())
+	fmt.Println(reflect.Value{}, reflect.Value{}.IsValid(), reflect.Value{}.Kind())
+
+	p := Point{1, 2}
+	v = reflect.ValueOf(&p).Elem()
+	v.Field(0).SetInt(10)
+	v.FieldByName("Y").Set(reflect.ValueOf(20))
+	fmt.Println(p, v.CanSet(), v.Field(0).CanSet(), v.NumField())
+	fmt.Println(reflect.ValueOf(p).Field(0).CanSet(), reflect.ValueOf(p).Interface().(Point))
+
+	var c Celsius
+	cv := reflect.ValueOf(&c).Elem()
+	cv.SetFloat(36.6)
+	fmt.Println(c, cv, cv.Float())
+
+	var i8 int8
+	reflect.ValueOf(&i8).Elem().SetInt(300)
+	fmt.Println(i8)
+
+	s := []int{1, 2, 3}
+	sv := reflect.ValueOf(s)
+	sv.Index(1).SetInt(20)
+	fmt.Println(s, sv.Len(), sv.Cap(), sv.Index(2))
+	sv = reflect.Append(sv, reflect.ValueOf(4))
+	fmt.Println(sv, sv.Len())
+
+	m := map[string]int{"a": 1}
+	mv := reflect.ValueOf(m)
+	mv.SetMapIndex(reflect.ValueOf("b"), reflect.ValueOf(2))
+	fmt.Println(m, mv.MapIndex(reflect.ValueOf("a")), mv.MapIndex(reflect.ValueOf("z")).IsValid())
+	mv.SetMapIndex(reflect.ValueOf("a"), reflect.Value{})
+	fmt.Println(m, len(mv.MapKeys()))
+
+	n := reflect.New(reflect.TypeOf(Point{}))
+	n.Elem().Field(1).SetInt(7)
+	fmt.Println(n.Type(), n.Elem(), n.Interface().(*Point).Y)
+	z := reflect.Zero(reflect.TypeOf(User{}))
+	fmt.Println(z.IsZero(), z.Field(1).IsZero(), reflect.ValueOf(Point{0, 1}).IsZero())
+	ms := reflect.MakeSlice(reflect.TypeOf([]string{}), 2, 4)
+	ms.Index(0).SetString("x")
+	fmt.Printf("%q %d %d\n", ms.Interface(), ms.Len(), ms.Cap())
+	mm := reflect.MakeMap(reflect.TypeOf(map[int]bool{}))
+	mm.SetMapIndex(reflect.ValueOf(1), reflect.ValueOf(true))
+	fmt.Println(mm.Interface())
+
+	var x any = 3.5
+	iv := reflect.ValueOf(&x).Elem()
+	fmt.Println(iv.Kind(), iv.Elem().Kind(), iv.Elem().Float())
+	iv.Set(reflect.ValueOf("now a string"))
+	fmt.Println(x, reflect.Indirect(reflect.ValueOf(&p)).Field(0))
+	var np *Point
+	fmt.Println(reflect.ValueOf(np).IsNil(), reflect.ValueOf(np).Elem().IsValid())
+}
+
+func panics() {
+	try := func(f func()) {
+		defer func() {
+			fmt.Println("recovered:", recover())
+		}()
+		f()
+	}
+	try(func() { reflect.ValueOf(1).SetInt(2) })
+	try(func() { reflect.ValueOf("s").Int() })
+	try(func() { reflect.ValueOf(User{}).Field(6).Interface() })
+	try(func() { reflect.ValueOf(&Point{}).Elem().Field(0).Set(reflect.ValueOf("s")) })
+	try(func() { reflect.TypeOf(1).Elem() })
+	try(func() { reflect.Value{}.Type() })
+	try(func() { reflect.ValueOf([]int{1}).Index(1) })
+	try(func() { reflect.ValueOf(map[string]int(nil)).SetMapIndex(reflect.ValueOf("a"), reflect.ValueOf(1)) })
+}
+
+func main() {
+	types()
+	values()
+	panics()
+	u := User{Name: "ann", Emails: []string{"a@b.c"}, Admin: true, Score: 9.5,
+		Home: &Point{1, 2}}
+	fmt.Println(marshal(u))
+	fmt.Println(marshal(User{Age: 3}))
+	var pair Pair[string, int]
+	pair.Key, pair.Val = "k", 1
+	fmt.Println(marshal(map[string]any{"b": []any{1, "x", nil}, "a": pair}))
+	fmt.Println(marshal([2]uint8{1, 2}), marshal(nil), marshal(Celsius(1.5)))
+}
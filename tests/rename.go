@@ -0,0 +1,34 @@
+package main
+
+// python go_parser.py rename tests/rename.go:11:2 Size -d prints the diff
+// renaming the field count, and rename tests/rename.go:29:3 total prints
+// why n can't be renamed total (total += n would refer to n)
+
+import "fmt"
+
+// Shelf holds books
+type Shelf struct {
+	count int
+	books []string
+}
+
+func (s *Shelf) Add(book string) {
+	s.books = append(s.books, book)
+	s.count++
+}
+
+func (s *Shelf) Len() int {
+	return s.count
+}
+
+func main() {
+	total := 0
+	shelves := []*Shelf{&Shelf{}, &Shelf{count: 1, books: []string{"Go"}}}
+	for i, s := range shelves {
+		s.Add(fmt.Sprint("book ", i))
+		n := s.Len()
+		total += n
+		fmt.Println(i, n, len(s.books))
+	}
+	fmt.Println(total)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+const letter = 'a'
+const next = letter + 1
+const newline = '\n'
+const e = '\u00e9'
+const smile = '\U0001F600'
+const octal = '\101'
+const hex = '\x41'
+const quote = '\''
+
+const greeting = "héllo" + ", " + "wörld"
+const escaped = "tab\tquote\" backslash\\ \xff"
+const raw = `C:\path\n
+second line`
+const size = len(greeting)
+const accent = string(e)
+const invalid = string(-1)
+
+func main() {
+	var r rune = 'z'
+	var b byte = 'A'
+	var c = letter
+	s := "multi" + `-line`
+	fmt.Println(letter, next, newline, smile, octal, hex, quote, r, b, c, s)
+	fmt.Println(greeting, escaped, raw, size, accent, invalid, e)
+
+	// should report errors
+	var x int8 = smile
+	var y string = letter
+	fmt.Println(x, y, 'ab', '', "\q")
+}
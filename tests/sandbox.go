@@ -0,0 +1,40 @@
+package main
+
+// A program run in a sandbox is aborted where it goes past one of its
+// limits (see sandbox.py): with -sandbox it stops when it writes its file,
+// the sandbox allows no files, with -max-heap=4000000 when it allocates
+// the fourth buffer, with -max-output=100 before the second line, and with
+// -max-goroutines=3 when it starts its third worker (main is the first)
+//
+//   python go_parser.py run tests/sandbox.go
+//   python go_parser.py run -sandbox tests/sandbox.go
+//   python go_parser.py run -max-heap=4000000 tests/sandbox.go
+//   python go_parser.py run --exec=vm -max-output=100 tests/sandbox.go
+//   python go_parser.py run -max-goroutines=3 tests/sandbox.go
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	var buffers [][]byte
+	for i := 0; i < 6; i++ {
+		buffers = append(buffers, make([]byte, 1<<20))
+		fmt.Printf("buffer %d of %d bytes, %d buffers allocated so far\n", i, len(buffers[i]), len(buffers))
+	}
+	sums := make(chan int)
+	for i := 0; i < 3; i++ {
+		go func(n int) {
+			sums <- n * len(buffers[n])
+		}(i)
+	}
+	total := 0
+	for i := 0; i < 3; i++ {
+		total += <-sums
+	}
+	fmt.Println("summed by 3 workers:", total)
+	// a directory which doesn't exist, nothing is written
+	err := os.WriteFile("sandbox/no/such/dir/out.txt", []byte("hello"), 0644)
+	fmt.Println("written:", err == nil)
+}
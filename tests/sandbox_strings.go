@@ -0,0 +1,28 @@
+package main
+
+// The strings the natives of std make are counted as allocated too, like
+// the ones of fmt.Sprintf and strings.ReplaceAll: with -max-heap=1000000
+// the program is aborted where the text grows past the limit, and with
+// -max-heap=5000000 where a number is padded to a width past it, before
+// the padding is made
+//
+//   python go_parser.py run tests/sandbox_strings.go
+//   python go_parser.py run -max-heap=1000000 tests/sandbox_strings.go
+//   python go_parser.py run --exec=vm -max-heap=5000000 tests/sandbox_strings.go
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	text := "x"
+	for i := 0; i < 18; i++ {
+		text = strings.ReplaceAll(text, "x", "xx")
+		text = fmt.Sprintf("%s", text)
+	}
+	fmt.Println("the text has", len(text), "bytes")
+	fmt.Println(strings.Repeat("-", 20), strings.Count(text, "x"))
+	padded := fmt.Sprintf("%*d|%.*f", 10, 42, 2, 3.14159)
+	fmt.Println(padded, len(fmt.Sprintf("%9000000d", 1)))
+}
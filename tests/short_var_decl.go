@@ -0,0 +1,102 @@
+package main
+
+// go_parser.py --exec interp tests/short_var_decl.go prints what go run
+// does, so does the VM. A := assigns the variables of its block it
+// redeclares, and the values are evaluated before the new variables
+// (which shadow the ones of the enclosing blocks) are declared
+
+import "fmt"
+
+var count = 10
+
+func pair(n int) (int, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("negative %d", n)
+	}
+	return n * 2, nil
+}
+
+type problem struct{ code int }
+
+func (p *problem) Error() string {
+	return fmt.Sprint("problem ", p.code)
+}
+
+func check(code int) (int, *problem) {
+	if code != 0 {
+		return code, &problem{code}
+	}
+	return 0, nil
+}
+
+func scale(n int) int {
+	n, factor := n*3, 2
+	return n * factor
+}
+
+func main() {
+	a, err := pair(1)
+	b, err := pair(-2)
+	fmt.Println(a, b, err)
+
+	x := 1
+	{
+		x, y := 2, 3
+		x++
+		fmt.Println(x, y)
+	}
+	fmt.Println(x)
+
+	count, z := 5, 6
+	fmt.Println(count, z)
+
+	if x := 10; x > 5 {
+		x, w := x*2, 1
+		fmt.Println(x, w)
+	} else if v := x + 1; v > 0 {
+		fmt.Println(v)
+	}
+	fmt.Println(x)
+
+	for i := 0; i < 2; i++ {
+		i, j := i*10, i
+		fmt.Println(i, j)
+	}
+
+	switch x := 3; x {
+	case 3:
+		x, t := x+1, x
+		fmt.Println(x, t)
+	}
+	fmt.Println(x)
+
+	p, q := 1, 2
+	q, r := p+q, p
+	fmt.Println(p, q, r)
+
+	_, s := pair(4)
+	_, s2 := pair(5)
+	fmt.Println(s, s2)
+
+	f := func() int {
+		x := 100
+		return x
+	}
+	fmt.Println(f(), x)
+
+	total := 0
+	add := func() { total += 10 }
+	total, steps := 5, 1
+	add()
+	fmt.Println(total, steps)
+
+	var e error
+	code, e := check(7)
+	fmt.Println(e, code)
+
+	fmt.Println(scale(4))
+
+	m, n := 1, 2
+	m, k := n, m
+	fmt.Println(m, n, k)
+}
@@ -0,0 +1,44 @@
+package main
+
+// go_parser.py tests/short_var_decl_errors.go reports the short variable
+// declarations below, like go vet does
+
+func pair() (int, string) {
+	return 1, "one"
+}
+
+// the parameters are in the block of the function body
+func f(a int) {
+	a, b := 2, 3
+	_, _ = a, b
+}
+
+func main() {
+	// a := declares at least one new variable of the block, the
+	// others are assigned
+	x := 1
+	x := 2
+	x, _ := 3, 4
+	_ = x
+
+	y, s := pair()
+	y, s := pair()
+	_, _ = y, s
+
+	// only variables are assigned
+	const c = 1
+	c, d := 2, 3
+	_ = d
+
+	var name string
+	name, count := 5, 6
+	_, _ = name, count
+
+	// a variable is declared once, the blank identifier is not
+	// a new variable
+	z, z := 1, 2
+	_ = z
+
+	_, _ := 1, 2
+	_ := pair
+}
@@ -0,0 +1,58 @@
+package main
+
+import "fmt"
+
+type Ints []int
+
+func sum(s []int) int {
+	total := 0
+	for i := 0; i < len(s); i++ {
+		total += s[i]
+	}
+	return total
+}
+
+func main() {
+	s := []int{1, 2, 3}
+	s[0] = 10
+	fmt.Println(len(s), cap(s), sum(s))
+
+	// slices of an array share its elements
+	arr := [5]int{1, 2, 3, 4, 5}
+	t := arr[1:3]
+	t[0] = 20
+	fmt.Println(arr[1], len(t), cap(t))
+	u := arr[1:2:3]
+	fmt.Println(cap(u), len(arr[:]))
+
+	// append uses the same array while there is room
+	v := t[:1]
+	v = append(v, 30)
+	fmt.Println(t[1], arr[2])
+	v = append(v, 40, 50, 60)
+	v[0] = 0
+	fmt.Println(arr[1], len(v))
+
+	m := make([]int, 2, 10)
+	n := copy(m, s)
+	ints := make(Ints, 3)
+	fmt.Println(n, m[1], len(ints))
+
+	var empty []int
+	empty = append(empty, 1)
+	fmt.Println(len(empty))
+
+	// should report errors
+	x := 5
+	_ = x[1:]
+	_ = append(x, 1)
+	_ = append(s, "one")
+	_ = copy(s, x)
+	_ = make(int)
+	_ = make([]int)
+	_ = make([]int, 10, 5)
+	_ = s[3:1]
+	_ = arr[1:6]
+	_ = "hello"[1:2:3]
+	_ = [3]int{1, 2, 3}[1:]
+}
@@ -0,0 +1,77 @@
+package main
+
+// go_parser.py run tests/sort_pkg.go prints what go run does, so do
+// --exec=vm and the python backend (build --target=python)
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Person struct {
+	Name string
+	Age  int
+}
+
+type Celsius float64
+
+func main() {
+	ints := []int{5, 2, 8, -1, 9, 3}
+	sort.Ints(ints)
+	fmt.Println(ints, sort.IntsAreSorted(ints), sort.SearchInts(ints, 8), sort.SearchInts(ints, 4))
+
+	words := strings.Fields("the quick brown fox jumps over the lazy dog")
+	sort.Strings(words)
+	fmt.Println(words, sort.StringsAreSorted(words))
+
+	floats := []float64{2.5, math.NaN(), -1, math.Inf(1), 0}
+	sort.Float64s(floats)
+	fmt.Println(floats)
+
+	people := []Person{{"Alice", 30}, {"Bob", 25}, {"Carol", 35}, {"Dave", 25}}
+	sort.Slice(people, func(i, j int) bool { return people[i].Age > people[j].Age })
+	fmt.Println(people[0], people[len(people)-1].Age)
+	sort.SliceStable(people, func(i, j int) bool { return people[i].Name < people[j].Name })
+	fmt.Println(people)
+
+	// a part of a slice sorts the elements of its array
+	part := []int{9, 8, 7, 6, 5, 4}
+	sort.Ints(part[1:4])
+	fmt.Println(part)
+
+	temps := []Celsius{21.5, -3, 12}
+	slices.Sort(temps)
+	fmt.Println(temps, slices.IsSorted(temps), slices.Max(temps), slices.Min(temps))
+
+	names := []string{"Go", "Python", "C", "Rust"}
+	slices.Sort(names)
+	fmt.Println(names, slices.Contains(names, "Rust"), slices.Contains(names, "Java"))
+	fmt.Println(slices.Index(names, "Python"), slices.Index(names, "Java"))
+
+	slices.SortFunc(people, func(a, b Person) int {
+		if c := cmp.Compare(a.Age, b.Age); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	fmt.Println(people)
+	slices.SortFunc(names, func(a, b string) int { return cmp.Compare(len(a), len(b)) })
+	fmt.Println(names)
+
+	slices.Reverse(ints)
+	fmt.Println(ints, cmp.Compare(1, 2), cmp.Less("b", "a"))
+
+	var empty []int
+	sort.Ints(empty)
+	slices.Sort(empty)
+	fmt.Println(empty == nil, slices.Contains(empty, 0))
+
+	defer func() {
+		fmt.Println("recovered:", recover())
+	}()
+	sort.Slice(42, func(i, j int) bool { return false })
+}
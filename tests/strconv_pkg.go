@@ -0,0 +1,65 @@
+package main
+
+// go_parser.py run tests/strconv_pkg.go prints what go run does, so do
+// --exec=vm and the python backend (build --target=python)
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+func sum(fields []string) (int, error) {
+	total := 0
+	for _, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func main() {
+	fmt.Println(strconv.Itoa(42), strconv.Itoa(-7), strconv.Itoa(0))
+	fmt.Println(strconv.FormatInt(255, 2), strconv.FormatInt(-255, 16), strconv.FormatInt(35, 36))
+
+	fmt.Println(sum([]string{"1", "2", "39"}))
+	_, err := sum([]string{"1", "two"})
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, strconv.ErrSyntax))
+
+	for _, s := range []string{"0x1F", "0b101", "0o17", "017", "1_000", "-42", "+8", "_1", "0x", ""} {
+		i, err := strconv.ParseInt(s, 0, 64)
+		fmt.Println(i, err)
+	}
+	i, err := strconv.ParseInt("300", 10, 8)
+	fmt.Println(i, err, errors.Is(err, strconv.ErrRange))
+	i, err = strconv.ParseInt("-9223372036854775809", 10, 0)
+	fmt.Println(i, err)
+	i, _ = strconv.ParseInt("zz", 36, 64)
+	fmt.Println(i)
+
+	for _, s := range []string{"3.14", "1e10", ".5", "-0", "1e400", "inf", "-Infinity", "NaN", "0x1p-2", "1.5e", "abc"} {
+		f, err := strconv.ParseFloat(s, 64)
+		fmt.Println(f, err)
+	}
+	f, _ := strconv.ParseFloat("0.1", 32)
+	fmt.Println(f, strconv.FormatFloat(f, 'g', -1, 32), strconv.FormatFloat(f, 'g', -1, 64))
+
+	for _, f := range []float64{0, 1, 0.1, 1.0 / 3, 123456789, 1e21, 1e-7, 2.5e-5, -1234.5678} {
+		fmt.Println(strconv.FormatFloat(f, 'g', -1, 64), strconv.FormatFloat(f, 'e', -1, 64),
+			strconv.FormatFloat(f, 'f', -1, 64), strconv.FormatFloat(f, 'E', 3, 64),
+			strconv.FormatFloat(f, 'f', 2, 64), strconv.FormatFloat(f, 'G', 4, 64))
+	}
+	fmt.Println(strconv.FormatFloat(1.5, 'x', -1, 64), strconv.FormatFloat(3, 'b', -1, 64),
+		strconv.FormatFloat(-1.5, 'b', 2, 32), strconv.FormatFloat(0, 'b', -1, 64))
+
+	b, err := strconv.ParseBool("TRUE")
+	fmt.Println(b, err, strconv.FormatBool(false))
+	_, err = strconv.ParseBool("yes")
+	fmt.Println(err)
+
+	fmt.Println(strconv.Quote("hello, \"world\"\n"), strconv.Quote("tab\there ☺ \x00"))
+}
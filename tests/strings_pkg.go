@@ -0,0 +1,50 @@
+package main
+
+// go_parser.py run tests/strings_pkg.go prints what go run does, so do
+// --exec=vm and the python backend (build --target=python)
+
+import (
+	"fmt"
+	"strings"
+)
+
+func wordCount(text string) map[string]int {
+	counts := map[string]int{}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		counts[word]++
+	}
+	return counts
+}
+
+func main() {
+	s := "  Hello, Wörld! Hello, Go.  "
+	t := strings.TrimSpace(s)
+	fmt.Printf("%q\n", t)
+	fmt.Println(strings.ToUpper(t), strings.ToLower(t))
+	fmt.Println(strings.Contains(t, "Wörld"), strings.Contains(t, "world"))
+	fmt.Println(strings.ContainsRune(t, 'ö'), strings.Index(t, "!"), strings.Index(t, "x"))
+	fmt.Println(strings.LastIndex(t, "Hello"), strings.Count(t, "l"), strings.Count("ö", ""))
+	fmt.Println(strings.HasPrefix(t, "Hello"), strings.HasSuffix(t, "Go."), strings.HasPrefix(t, "Go"))
+	fmt.Println(strings.TrimPrefix(t, "Hello, "), strings.TrimSuffix(t, " Go."))
+
+	parts := strings.Split("a,b,,c", ",")
+	fmt.Println(len(parts), parts)
+	fmt.Printf("%q\n", strings.Split("héllo", ""))
+	fmt.Printf("%q\n", strings.Fields("  one two\tthree\n"))
+	fmt.Println(strings.Join(parts, "-"), strings.Join(nil, "-") == "")
+	fmt.Println(strings.Repeat("ab", 3), strings.Replace("aaaa", "a", "b", 2))
+	fmt.Println(strings.ReplaceAll("oink oink", "k", "ky"), strings.Replace("ab", "", "-", -1))
+
+	var b []string
+	for _, line := range strings.Split("x=1\ny=2", "\n") {
+		kv := strings.Split(line, "=")
+		b = append(b, kv[1]+":"+kv[0])
+	}
+	fmt.Println(strings.Join(b, " "))
+	fmt.Println(wordCount("the cat and THE dog"))
+
+	defer func() {
+		fmt.Println("recovered:", recover())
+	}()
+	strings.Repeat("x", -1)
+}
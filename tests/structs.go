@@ -0,0 +1,63 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	x, y int
+}
+
+type Rect struct {
+	min, max Point
+	name     string "name"
+}
+
+func area(r Rect) int {
+	return (r.max.x - r.min.x) * (r.max.y - r.min.y)
+}
+
+func origin() Point {
+	return Point{}
+}
+
+func main() {
+	p := Point{1, 2}
+	q := Point{y: 5}
+	q.x = p.y + 1
+	q.y += 3
+	p.x++
+
+	r := Rect{min: origin(), max: Point{4, 6}, name: "r"}
+	r.max.x = 10
+	fmt.Println(area(r), r.name)
+
+	var zero Rect
+	fmt.Println(zero.min.x)
+
+	// elided types of the elements
+	points := [3]Point{{1, 2}, {y: 3}}
+	points[1].x = points[0].y
+	for i := 0; i < 3; i++ {
+		fmt.Println(points[i].x)
+	}
+
+	// an anonymous struct
+	pair := struct {
+		key   string
+		value int
+	}{"a", 1}
+	fmt.Println(pair.key, pair.value)
+
+	odd := []int{4: 1, 2: 3}
+	fmt.Println(odd[4])
+
+	// should report errors
+	fmt.Println(p.z)
+	_ = Point{1}
+	_ = Point{1, 2, 3}
+	_ = Point{x: 1, 2}
+	_ = Point{z: 1}
+	_ = Point{x: 1, x: 2}
+	_ = Point{x: "one"}
+	_ = [2]int{0: 1, 0: 2}
+	_ = Rect{min: {1, 2}}
+}
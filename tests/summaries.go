@@ -0,0 +1,33 @@
+package main
+
+// The packages of the standard library std doesn't declare, like bufio and
+// unicode/utf8, are type checked with their summaries, which the go command
+// makes from the export data of its toolchain (see summaries.py). Without
+// the go command they are unknown, and the errors below aren't reported
+//
+//   python go_parser.py tests/summaries.go
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func main() {
+	s := "héllo"
+	fmt.Println(utf8.RuneCountInString(s), utf8.UTFMax, unicode.IsUpper('H'))
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fmt.Println(strings.ToUpper(scanner.Text()))
+	}
+	var r rune = utf8.RuneError
+	size := utf8.RuneLen(r)
+
+	// should report errors
+	var n string = utf8.RuneLen('é')
+	bufio.NewWriter(s)
+	fmt.Println(unicode.IsUpper("A"), size+scanner.Text(), n)
+}
@@ -0,0 +1,73 @@
+package main
+
+import "fmt"
+
+func next(n int) int {
+	return n + 1
+}
+
+func main() {
+	total := 0
+
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			continue
+		}
+		total += i
+	}
+
+	n := 0
+	for n < 5 {
+		n++
+	}
+
+	for {
+		n--
+		if n == 2 {
+			break
+		}
+	}
+
+	if x := next(n); x > 3 {
+		fmt.Println(x)
+	} else if x == 3 {
+		fmt.Println("three")
+	} else {
+		fmt.Println(-x)
+	}
+
+	switch k := next(total); k {
+	case 1, 2:
+		fmt.Println("small")
+		fallthrough
+	case 26:
+		fmt.Println("expected")
+	default:
+		fmt.Println("other")
+	}
+
+	// a tagless switch is like an if-else chain
+	switch {
+	case n > 2:
+		fmt.Println("big")
+	case n == 2:
+		if total > 0 {
+			break
+		}
+		fmt.Println("two")
+	}
+
+	// should report errors
+	switch n {
+	case 1, "one":
+	case 2, 1:
+		fallthrough
+	default:
+	default:
+		fallthrough
+	}
+	switch {
+	case n:
+	}
+	fallthrough
+}
@@ -0,0 +1,130 @@
+package main
+
+// go_parser.py run tests/sync_pkg.go prints what go run does, so does
+// --exec=vm (the python backend doesn't have the sync package)
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type counter struct {
+	mu sync.Mutex
+	n  map[string]int
+}
+
+func (c *counter) inc(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n[key]++
+}
+
+func main() {
+	// the goroutines increment the counts under the lock, with no lost update
+	c := counter{n: map[string]int{}}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.inc(fmt.Sprint("k", j%3))
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Println(c.n)
+
+	// WaitGroup.Go adds the goroutine it starts
+	var total atomic.Int64
+	var hits int32
+	for i := range 10 {
+		wg.Go(func() {
+			total.Add(int64(i))
+			atomic.AddInt32(&hits, 1)
+		})
+	}
+	wg.Wait()
+	fmt.Println(total.Load(), atomic.LoadInt32(&hits))
+
+	var once sync.Once
+	for range 3 {
+		once.Do(func() { fmt.Println("once") })
+	}
+	v := sync.OnceValue(func() int { fmt.Println("computing"); return 42 })
+	fmt.Println(v(), v())
+	f := sync.OnceFunc(func() { panic("oops") })
+	for range 2 {
+		func() {
+			defer func() { fmt.Println("recovered", recover()) }()
+			f()
+		}()
+	}
+	a, b := sync.OnceValues(func() (int, error) { return 1, nil })()
+	fmt.Println(a, b)
+
+	// the readers share the lock, the writers hold it alone
+	var rw sync.RWMutex
+	data := map[int]int{}
+	var readers sync.WaitGroup
+	for i := range 5 {
+		readers.Add(2)
+		go func() {
+			defer readers.Done()
+			rw.Lock()
+			data[i] = i * i
+			rw.Unlock()
+		}()
+		go func() {
+			defer readers.Done()
+			rw.RLock()
+			_ = data[i]
+			rw.RUnlock()
+		}()
+	}
+	readers.Wait()
+	keys := []int{}
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	fmt.Println(keys, rw.TryLock(), rw.TryRLock())
+	rw.Unlock()
+	fmt.Println(rw.TryRLock(), rw.TryLock())
+	rw.RUnlock()
+	var m sync.Mutex
+	fmt.Println(m.TryLock(), m.TryLock())
+	m.Unlock()
+	var l sync.Locker = rw.RLocker()
+	l.Lock()
+	l.Unlock()
+
+	var cas atomic.Uint32
+	fmt.Println(cas.CompareAndSwap(0, 5), cas.CompareAndSwap(0, 6), cas.Load(), cas.Swap(7), cas.Load())
+	var u64 uint64
+	atomic.AddUint64(&u64, ^uint64(0))
+	fmt.Println(u64)
+	var flag atomic.Bool
+	fmt.Println(flag.Load(), flag.Swap(true), flag.Load(), flag.CompareAndSwap(true, false))
+	type config struct{ name string }
+	var p atomic.Pointer[config]
+	fmt.Println(p.Load() == nil)
+	p.Store(&config{"a"})
+	old := p.Swap(&config{"b"})
+	fmt.Println(old.name, p.Load().name)
+	// the values of a Value all have the same type
+	var val atomic.Value
+	fmt.Println(val.Load())
+	val.Store("x")
+	fmt.Println(val.Load(), val.Swap("y"), val.CompareAndSwap("y", "z"), val.Load())
+	func() {
+		defer func() { fmt.Println(recover()) }()
+		val.Store(1)
+	}()
+	func() {
+		defer func() { fmt.Println(recover()) }()
+		wg.Add(-1)
+	}()
+}
@@ -0,0 +1,30 @@
+package main
+
+import "fmt"
+
+// the parser recovers from each error at the end of the statement
+// (or the declaration), and reports the errors after it
+
+func area(width, height int) int {
+	total := width * height +
+	return total
+}
+
+func perimeter(width, height int) int {
+	sum := width + + height
+	if sum > {
+		sum = 0
+	}
+	return 2 * sum
+}
+
+var limit int = ;
+
+func main() {
+	fmt.Println(area(2, 3), perimeter(2, 3) +)
+	count := 3
+	for i := 0; i < ; i++ {
+		count++
+	}
+	fmt.Println(count)
+}
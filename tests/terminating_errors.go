@@ -0,0 +1,125 @@
+package main
+
+// go_parser.py tests/terminating_errors.go reports the functions below
+// missing a return at their closing brace, the ones ending with a
+// terminating statement don't need one. --warnings reports the
+// unreachable statements too, like go vet does
+
+import "fmt"
+
+func sign(x int) int {
+	if x < 0 {
+		return -1
+	} else if x > 0 {
+		return 1
+	} else {
+		return 0
+	}
+}
+
+func noElse(x int) int {
+	if x < 0 {
+		return -1
+	}
+} // missing return
+
+func loop() int {
+	for {
+	}
+}
+
+func loopBreak(x int) int {
+	for {
+		if x > 10 {
+			break
+		}
+		x++
+	}
+} // missing return
+
+func labeledBreak(x int) int {
+outer:
+	for {
+		switch {
+		case x > 10:
+			break outer
+		}
+		x++
+	}
+} // missing return
+
+func nestedBreak(x int) int {
+	for {
+		for x < 10 {
+			break
+		}
+		return x
+	}
+}
+
+func cond(x int) int {
+	for x < 10 {
+		return x
+	}
+} // missing return
+
+func kind(x any) string {
+	switch x.(type) {
+	case int:
+		return "int"
+	default:
+		panic("unknown")
+	}
+}
+
+func noDefault(x int) string {
+	switch x {
+	case 0:
+		return "zero"
+	}
+} // missing return
+
+func fall(x int) string {
+	switch x {
+	case 0:
+		fallthrough
+	default:
+		return "other"
+	}
+}
+
+func wait(c chan int) int {
+	select {
+	case v := <-c:
+		return v
+	}
+}
+
+func jump() int {
+again:
+	goto again
+}
+
+func unreachable() {
+	return
+	fmt.Println("unreachable") // Unreachable
+}
+
+func unreachableEnd() int {
+	panic("not yet")
+	return 0 // Unreachable
+}
+
+func main() {
+	f := func() int {
+		fmt.Println(sign(1))
+	} // missing return
+	for i := 0; i < 3; i++ {
+		continue
+		fmt.Println(i) // Unreachable
+	}
+	fmt.Println(f())
+}
+
+var functions = []any{noElse, loop, loopBreak, labeledBreak, nestedBreak, cond,
+	kind, noDefault, fall, wait, jump, unreachable, unreachableEnd}
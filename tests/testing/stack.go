@@ -0,0 +1,33 @@
+// Package stack is a stack of ints, go_parser.py test tests/testing runs
+// the tests of stack_test.go (see it)
+package stack
+
+import "errors"
+
+// ErrEmpty is the error of Pop on an empty stack.
+var ErrEmpty = errors.New("stack: empty")
+
+// Stack is a last in first out stack of ints, the zero value is empty.
+type Stack struct {
+	items []int
+}
+
+// Push adds x on top of the stack.
+func (s *Stack) Push(x int) {
+	s.items = append(s.items, x)
+}
+
+// Pop removes the int on top of the stack and returns it.
+func (s *Stack) Pop() (int, error) {
+	if len(s.items) == 0 {
+		return 0, ErrEmpty
+	}
+	x := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return x, nil
+}
+
+// Len is the number of ints in the stack.
+func (s *Stack) Len() int {
+	return len(s.items)
+}
@@ -0,0 +1,101 @@
+package stack
+
+// go_parser.py test -v tests/testing runs the tests of the package like
+// go test -v does (go test -v in tests/testing, with a go.mod), printing:
+//
+// === RUN   TestPush
+//     stack_test.go:55: pushed 1 2 3
+// --- PASS: TestPush (0.00s)
+// === RUN   TestPop
+// === RUN   TestPop/empty
+// === RUN   TestPop/one_int
+// === RUN   TestPop/one_int#01
+// --- PASS: TestPop (0.00s)
+//     --- PASS: TestPop/empty (0.00s)
+//     --- PASS: TestPop/one_int (0.00s)
+//     --- PASS: TestPop/one_int#01 (0.00s)
+// === RUN   TestLater
+//     stack_test.go:88: not written yet
+// --- SKIP: TestLater (0.00s)
+// PASS
+// ok  	tests/testing	0.012s
+//
+// (with the times taken), -run Pop/one only runs TestPop/one_int and
+// TestPop/one_int#01. Without -v only the tests failing are printed, with
+// their logs: the line of t.Errorf in wantLen is the one of its caller,
+// wantLen calls t.Helper.
+//
+// -bench . -benchmem runs BenchmarkPushPop too, for about a second, and
+// prints its allocations like gc's (the ones of append growing the slice
+// from 1 to 16 ints):
+//
+// goos: linux
+// goarch: amd64
+// pkg: tests/testing
+// BenchmarkPushPop 	     518	   2392573 ns/op	     248 B/op	       5 allocs/op
+
+import (
+	"errors"
+	"testing"
+)
+
+func wantLen(t *testing.T, s *Stack, n int) {
+	t.Helper()
+	if s.Len() != n {
+		t.Errorf("Len() = %d, want %d", s.Len(), n)
+	}
+}
+
+func TestPush(t *testing.T) {
+	var s Stack
+	for i := 1; i <= 3; i++ {
+		s.Push(i)
+		wantLen(t, &s, i)
+	}
+	t.Log("pushed 1 2 3")
+}
+
+func TestPop(t *testing.T) {
+	tests := []struct {
+		name   string
+		pushed []int
+		want   int
+		err    error
+	}{
+		{"empty", nil, 0, ErrEmpty},
+		{"one int", []int{7}, 7, nil},
+		{"one int", []int{1, 2}, 2, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var s Stack
+			for _, x := range test.pushed {
+				s.Push(x)
+			}
+			got, err := s.Pop()
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Pop() error = %v, want %v", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("Pop() = %d, want %d", got, test.want)
+			}
+			wantLen(t, &s, max(len(test.pushed)-1, 0))
+		})
+	}
+}
+
+func TestLater(t *testing.T) {
+	t.Skip("not written yet")
+}
+
+func BenchmarkPushPop(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var s Stack
+		for x := 0; x < 16; x++ {
+			s.Push(x)
+		}
+		for s.Len() > 0 {
+			s.Pop()
+		}
+	}
+}
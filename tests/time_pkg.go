@@ -0,0 +1,59 @@
+package main
+
+// go_parser.py run --fake-clock tests/time_pkg.go prints what the Go
+// playground does (its clock starts at 2009-11-10 23:00:00 UTC and only
+// moves when the program sleeps), so do --exec=vm and the python backend
+// (build --target=python, run with GOPY_FAKE_CLOCK=1)
+
+import (
+	"fmt"
+	"time"
+)
+
+type Timer struct {
+	name  string
+	start time.Time
+}
+
+func (t *Timer) Stop() time.Duration {
+	elapsed := time.Since(t.start)
+	fmt.Printf("%s took %v\n", t.name, elapsed)
+	return elapsed
+}
+
+func backoff(attempt int) time.Duration {
+	return time.Duration(1<<attempt) * 100 * time.Millisecond
+}
+
+func main() {
+	fmt.Println(time.Nanosecond, time.Microsecond, time.Millisecond, time.Second, time.Minute, time.Hour)
+	d := 90*time.Minute + 30*time.Second + 5*time.Millisecond
+	fmt.Println(d, -d, d.Hours(), d.Minutes(), d.Seconds(), d.Milliseconds())
+	fmt.Println(time.Duration(1500), 1500*time.Microsecond, time.Duration(0), 2*time.Hour+time.Nanosecond)
+	fmt.Println(d/time.Minute, d%time.Minute, d > time.Hour, time.Second.String())
+	fmt.Printf("%v %d %s\n", time.Second/4, time.Second/4, 3*time.Second)
+
+	start := time.Now()
+	fmt.Println(start)
+	fmt.Println(start.Unix(), start.UnixMilli(), start.UnixNano())
+
+	t := &Timer{"sleeping", time.Now()}
+	total := time.Duration(0)
+	for attempt := range 3 {
+		wait := backoff(attempt)
+		time.Sleep(wait)
+		total += wait
+	}
+	elapsed := t.Stop()
+	fmt.Println(elapsed >= total, time.Since(start) >= 700*time.Millisecond)
+	time.Sleep(-time.Second)
+
+	later := start.Add(36 * time.Hour)
+	fmt.Println(later, later.Sub(start), later.After(start), later.Before(start), start.Equal(start))
+	fmt.Println(start.Add(-1500*time.Millisecond), time.Until(later) > 0)
+
+	epoch := time.Unix(0, 0)
+	fmt.Println(epoch, epoch.Unix(), time.Unix(1, -1), time.Unix(1e9, 5e8))
+	var zero time.Time
+	fmt.Println(zero.IsZero(), epoch.IsZero(), zero)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "fmt"
+
+const zero = 0.0
+const zero = 0
+
+var count int = 10
+
+func add(a int, b int) int {
+	return a + b
+}
+
+func main() {
+	var x int = 5
+	var s string = "five"
+	var ok bool = x
+
+	if x {
+		x = x + 1
+	}
+
+	{
+		// shadowing in an inner block is fine
+		var x float64 = 2.5
+		fmt.Println(x)
+	}
+
+	y := x + s
+	z := add(x)
+	w := undefined + 1
+
+	var x int = 6
+	fmt.Println(count, ok, y, z, w)
+
+	// array lengths are non-negative integer constants
+	var invalid [x]int
+	var negative [-1]int
+	var fraction [2.5]int
+	fmt.Println(invalid, negative, fraction)
+}
@@ -0,0 +1,62 @@
+package main
+
+import "fmt"
+
+// a type can be used before its declaration
+var boiling Celsius = 100
+
+type Celsius float64
+type Fahrenheit float64
+type MyInt = int
+type Temps []Celsius
+
+type (
+	Grid  [3]Row
+	Row   [3]int
+	Label = string
+	Node  struct {
+		value int
+		next  *Node
+	}
+	Point struct{ X, Y int }
+	Pair  struct{ X, Y int }
+)
+
+// should report errors
+type Self Self
+type Chain struct{ next Chain }
+type Outer struct{ inner Inner }
+type Inner [2]Outer
+
+func (c Celsius) Fahrenheit() Fahrenheit { return Fahrenheit(c*9/5 + 32) }
+
+func (t Temps) First() Celsius { return t[0] }
+
+func main() {
+	var m MyInt = 3
+	var i int = m
+	temps := Temps{boiling, 20, 37.5}
+	var raw []Celsius = temps
+	var again Temps = raw
+	fmt.Println(m+i, temps.First(), len(again))
+	var name Label = "grid"
+	var b byte = 'a'
+	var u uint8 = b
+	var bytes []byte = []uint8{u}
+	fmt.Println(name, u, bytes)
+	var g Grid
+	g[1][1] = 5
+	n := &Node{1, &Node{2, nil}}
+	p := Point(Pair{1, 2})
+	fmt.Println(g[1][1], n.next.value, p)
+
+	// should report errors
+	var f Fahrenheit = boiling
+	var x float64 = boiling
+	fmt.Println(boiling+f, x, f)
+	var pair Pair = p
+	s := string(boiling)
+	q := Point(n)
+	var k Celsius = Celsius("100")
+	fmt.Println(pair, s, q, k)
+}
@@ -0,0 +1,103 @@
+package main
+
+// go_parser.py --exec interp tests/type_switch.go prints what go run
+// does, so does the VM. The variable of a clause listing one type has
+// that type, the one of the other clauses is x itself
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct{ side float64 }
+
+func (s Square) Area() float64 { return s.side * s.side }
+
+type Circle struct{ r float64 }
+
+func (c *Circle) Area() float64 { return 3 * c.r * c.r }
+
+type Celsius float64
+
+func describe(x any) string {
+	switch v := x.(type) {
+	case nil:
+		return "nil"
+	case int:
+		return fmt.Sprint("int ", v+1)
+	case string, []byte:
+		return fmt.Sprint("text ", v)
+	case Celsius:
+		return fmt.Sprint("celsius ", float64(v)*2)
+	case error:
+		return "error " + v.Error()
+	case Shape:
+		return fmt.Sprint("shape ", v.Area())
+	case func() int:
+		return fmt.Sprint("func ", v())
+	default:
+		return fmt.Sprint("other ", v)
+	}
+}
+
+func kind(s Shape) string {
+	switch s.(type) {
+	case Square:
+		return "square"
+	case *Circle:
+		return "circle"
+	}
+	return "none"
+}
+
+func main() {
+	fmt.Println(describe(nil))
+	fmt.Println(describe(41))
+	fmt.Println(describe("go"))
+	fmt.Println(describe([]byte("py")))
+	fmt.Println(describe(Celsius(1.5)))
+	fmt.Println(describe(errors.New("boom")))
+	fmt.Println(describe(Square{3}))
+	fmt.Println(describe(&Circle{1}))
+	fmt.Println(describe(func() int { return 7 }))
+	fmt.Println(describe(2.5))
+	fmt.Println(describe(Circle{2}))
+
+	var s Shape
+	fmt.Println(kind(s), kind(Square{1}), kind(&Circle{2}))
+
+	values := []any{1, "a", true, 2}
+	total := 0
+	for _, value := range values {
+		switch n := value.(type) {
+		case int:
+			total += n
+			if n > 1 {
+				break
+			}
+			total += 10
+		case bool:
+			continue
+		}
+		total += 100
+	}
+	fmt.Println(total)
+
+	// the variable shadows x, and the statement before the guard
+	x := any(5)
+loop:
+	for i := 0; i < 3; i++ {
+		switch y := 2; x := x.(type) {
+		case int:
+			if i == 1 {
+				break loop
+			}
+			fmt.Println(x*y, i)
+		}
+	}
+	fmt.Println(x)
+}
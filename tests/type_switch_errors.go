@@ -0,0 +1,50 @@
+package main
+
+// go_parser.py tests/type_switch_errors.go reports the type switches
+// below, like go vet does
+
+import "fmt"
+
+type Shape interface {
+	Area() float64
+}
+
+type Square struct{ side float64 }
+
+func (s Square) Area() float64 { return s.side * s.side }
+
+type Named struct{}
+
+func main() {
+	var s Shape = Square{2}
+	n := 3
+	// only interfaces have a dynamic type
+	switch n.(type) {
+	}
+	switch v := s.(type) {
+	case Square, Square:
+		fmt.Println(v)
+	case Named:
+	case nil, nil:
+	case int:
+	default:
+	default:
+	}
+	// the variable is used in no clause (with --warnings)
+	switch w := s.(type) {
+	case Square:
+	case nil:
+	}
+	switch s.(type) {
+	case Square:
+		fallthrough
+	case *Square:
+	}
+	switch u := s.(type) {
+	case Square:
+		fmt.Println(u.side)
+	case undefinedT:
+	}
+	switch _ := s.(type) {
+	}
+}
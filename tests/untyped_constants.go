@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+const Pi float64 = 3.14159265358979323846
+const size int = 1024
+
+// untyped constants of different kinds take the larger kind
+const ratio = 1 + 2.5
+const area = Pi * 10 * 10
+const shifted = 4.0 << 2
+const whole int = 10.0 / 4.0 * 2
+
+// numeric constants can be used with values of any numeric type
+const c complex128 = 2
+const scaled = c * 1.5
+const half float32 = 0.5
+
+func main() {
+	var f float64 = Pi * 2
+	var x = ratio
+	var i uint8 = 255.0
+	fmt.Println(ratio, area, shifted, whole, c == 2+0, scaled, half, x, i, f)
+
+	// should report errors
+	const added = Pi + size
+	const word = "size" + size
+	var y int = c
+	var z float64 = c - 1
+	var b bool = 1
+	var t int8 = ratio
+	fmt.Println(c < 3, added, word, y, z, b, t)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "fmt"
+
+type Celsius float64
+
+var g int
+var a, b = 1, "two"
+var (
+	c        float64
+	d, e     bool
+	f        = 3.5
+	s string = "hi"
+	arr      [3]int
+	t        Celsius
+)
+
+func main() {
+	var x int
+	var y, z = 2, "three"
+	var (
+		p int
+		q = x + 1
+	)
+	x = p + q
+	fmt.Println(g, a, b, c, d, e, f, s, arr, t, x, y, z)
+
+	// mismatched declarations
+	var k, l = 1
+	var u = 1, 2
+	fmt.Println(k, l, u)
+}
@@ -0,0 +1,53 @@
+package main
+
+import "fmt"
+
+func sum(xs ...int) int {
+	total := 0
+	for i := 0; i < len(xs); i++ {
+		total += xs[i]
+	}
+	return total
+}
+
+func join(sep string, parts ...string) string {
+	s := ""
+	for i := 0; i < len(parts); i++ {
+		if i > 0 {
+			s += sep
+		}
+		s += parts[i]
+	}
+	return s
+}
+
+func count(xs ...any) int {
+	return len(xs)
+}
+
+func Max[T int | float64](first T, rest ...T) T {
+	m := first
+	for i := 0; i < len(rest); i++ {
+		if rest[i] > m {
+			m = rest[i]
+		}
+	}
+	return m
+}
+
+func main() {
+	fmt.Println(sum(), sum(1), sum(1, 2, 3))
+	nums := []int{4, 5, 6}
+	fmt.Println(sum(nums...))
+	fmt.Println(join(", ", "a", "b", "c"))
+	fmt.Println(count(1, "two", 3.0), count())
+	fmt.Println(Max(3, 9, 2), Max(1.5))
+
+	more := append(nums, nums...)
+	fmt.Println(len(more), more[5])
+	var b []byte
+	b = append(b, "gopy"...)
+	fmt.Println(len(b))
+	args := []any{1, 2}
+	fmt.Println(args...)
+}
@@ -0,0 +1,33 @@
+package main
+
+// go_parser.py tests/variadic_errors.go reports the misplaced variadic
+// parameter and the spread arguments below which don't fit the parameters
+// of the function called, like go vet does
+
+func sum(a int, b int) int {
+	return a + b
+}
+
+func total(first int, rest ...int) int {
+	return first + len(rest)
+}
+
+// only the last parameter can be variadic
+func misplaced(a ...int, b int) int {
+	return len(a) + b
+}
+
+func main() {
+	numbers := []int{1, 2}
+	words := []string{"a", "b"}
+
+	// no errors
+	total(1, 2, 3)
+	total(1, numbers...)
+
+	total(numbers...)
+	total(1, 2, numbers...)
+	sum(1, numbers...)
+	_ = len(numbers...)
+	total(1, words...)
+}
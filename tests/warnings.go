@@ -0,0 +1,47 @@
+package main
+
+// go_parser.py --warnings --exec=vm tests/warnings.go runs this program
+// and reports a warning for each declaration below marked with one, add
+// --suppress=ShadowedVar,UnusedConst to leave those kinds out
+
+import (
+	"fmt"
+	"os" // UnusedImport
+)
+
+const limit = 3
+
+const unusedLimit = 10 // UnusedConst
+
+// Exported constants are part of the API of the package, they are not reported
+const Version = "1.0"
+
+type user struct {
+	Name  string `json:name`                // StructTag, the value isn't quoted
+	Email string `json:"email" json:"mail"` // StructTag, the key is repeated
+	Age   int    `json:"age,omitempty"`
+}
+
+func count(words []string) int {
+	n := 0
+	for i := 0; i < len(words); i++ {
+		n := n + 1 // ShadowedVar, so count returns 0
+		fmt.Println(words[i], n)
+	}
+	return n
+}
+
+func main() {
+	const unit = "words" // UnusedConst
+	total := 0
+	last := "" // UnusedLocalVar, it is only assigned
+	for i := 0; i < limit; i++ {
+		total = total + count([]string{"a", "b"})
+		last = "b"
+	}
+	if total > 0 {
+		total := total // not reported, like in go vet
+		fmt.Println(total)
+	}
+	fmt.Println(total, user{})
+}
@@ -0,0 +1,58 @@
+package main
+
+// python go_parser.py refs -d tests/xref.go:9:6 prints the references of
+// Stack: its declaration, the types written with its name and its methods
+
+import "fmt"
+
+// Stack is a stack of values
+type Stack[T any] struct {
+	items []T
+	limit int
+}
+
+const Limit = 3
+
+// Entry is a key counted
+type Entry struct {
+	Key   string
+	Count int
+}
+
+func NewStack[T any]() *Stack[T] {
+	var s Stack[T]
+	s.limit = Limit
+	return &s
+}
+
+func (s *Stack[T]) Push(v T) bool {
+	if len(s.items) == s.limit {
+		return false
+	}
+	s.items = append(s.items, v)
+	return true
+}
+
+func (s *Stack[T]) Pop() T {
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v
+}
+
+func main() {
+	s := NewStack[int]()
+	for i := 0; i < Limit+1; i++ {
+		if !s.Push(i) {
+			fmt.Println("full at", i)
+		}
+	}
+	var t Stack[string]
+	t.limit = Limit
+	push := t.Push
+	push("a")
+	{
+		s := Entry{Key: "b", Count: 1}
+		fmt.Println(s.Key, s.Count)
+	}
+	fmt.Println(s.Pop(), t.Pop(), len(t.items))
+}
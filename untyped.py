@@ -0,0 +1,198 @@
+import struct
+
+from fractions import Fraction
+from typing import Any, Optional
+from symbol_table import predefined_identifiers
+
+
+# Untyped constants have a kind instead of a type: bool, rune, int,
+# float, complex or string. They are converted to a type only when
+# they are used with an operand (or assigned to a variable) of that
+# type, or get the default type of their kind otherwise. The value has
+# to be representable by the type, these are the rules for both the
+# constant evaluator (constant.py) and the type checker.
+# Ref: https://golang.org/ref/spec#Constants
+# Ref: https://golang.org/ref/spec#Representability
+
+
+int_typenames = {
+    "int", "int8", "int16", "int32", "int64",
+    "uint", "uint8", "uint16", "uint32", "uint64",
+    "byte", "rune",
+}
+float_typenames = {"float32", "float64"}
+complex_typenames = {"complex64", "complex128"}
+# the type of complex(x, y) for floats x and y of each type,
+# real and imag give the float type of a complex type back
+complex_of_float = {"float32": "complex64", "float64": "complex128"}
+float_of_complex = {"complex64": "float32", "complex128": "float64"}
+
+# numeric kinds, from the smallest to the largest. An operation on two
+# untyped constants of different numeric kinds gives the larger kind,
+# like 1 + 2.5 which is an untyped float
+numeric_kinds = ("int", "rune", "float", "complex")
+kinds = ("bool",) + numeric_kinds + ("string",)
+
+default_typenames = {
+    "bool": "bool",
+    "rune": "rune",
+    "int": "int",
+    "float": "float64",
+    "complex": "complex128",
+    "string": "string",
+}
+
+# values of each kind: bool, int (for int and rune), Fraction,
+# a (real, imaginary) tuple of Fractions and str
+
+
+class ConversionError(Exception):
+    """Raised when a value is not representable by a type
+
+    reason is like truncated to integer or overflows int8,
+    None if constants of the kind can't have the type at all"""
+
+    def __init__(self, reason: Optional[str] = None):
+        super().__init__(reason)
+        self.reason = reason
+
+
+def int_size(typename: str) -> int:
+    """Size of an integer type in bits"""
+    return predefined_identifiers[typename] * 8
+
+
+def is_unsigned(typename: str) -> bool:
+    return typename.startswith("uint") or typename == "byte"
+
+
+def int_range(typename: str):
+    """Smallest and largest values of an integer type"""
+    size = int_size(typename)
+    if is_unsigned(typename):
+        return 0, (1 << size) - 1
+    return -(1 << (size - 1)), (1 << (size - 1)) - 1
+
+
+def kind_of_typename(typename: str) -> Optional[str]:
+    """Kind of the constants representable by a basic type, None if the
+    type can't have constants. Like int for every integer type"""
+    if typename in int_typenames:
+        return "int"
+    elif typename in float_typenames:
+        return "float"
+    elif typename in complex_typenames:
+        return "complex"
+    elif typename in ("bool", "string"):
+        return typename
+    return None
+
+
+def default_typename(kind: str) -> str:
+    """Type of an untyped constant used where a type is needed,
+    like int for x := 1"""
+    return default_typenames[kind]
+
+
+def kind_of_default(typename: Optional[str]) -> Optional[str]:
+    """Kind of the untyped constants whose default type is typename,
+    like float for float64"""
+    for kind, default in default_typenames.items():
+        if default == typename:
+            return kind
+    return None
+
+
+def is_numeric(kind: Optional[str]) -> bool:
+    return kind in numeric_kinds
+
+
+def is_integer(kind: Optional[str]) -> bool:
+    return kind in ("int", "rune")
+
+
+def compatible(kind: str, type_kind: Optional[str]) -> bool:
+    """If an untyped constant of kind can have a type whose constants are
+    of type_kind (if its value is representable by the type)"""
+    if type_kind is None:
+        return False
+    return kind == type_kind or (is_numeric(kind) and is_numeric(type_kind))
+
+
+def match(x: str, y: str) -> Optional[str]:
+    """Kind of an operation on untyped constants of kinds x and y,
+    None if they can't be used together"""
+    if x == y:
+        return x
+    if is_numeric(x) and is_numeric(y):
+        return max(x, y, key=numeric_kinds.index)
+    return None
+
+
+def to_kind(kind: str, value: Any, target: str) -> Any:
+    """Value of a numeric kind as a value of the larger kind target"""
+    if target == "float" and is_integer(kind):
+        return Fraction(value)
+    elif target == "complex" and kind != "complex":
+        return (Fraction(value), Fraction(0))
+    return value
+
+
+def to_integer(kind: str, value: Any) -> Optional[int]:
+    """The exact integer value of a numeric constant, None if it
+    is not a whole number (like 2.5 but not 2.0)"""
+    if kind == "complex":
+        value, imag = value
+        if imag != 0:
+            return None
+        kind = "float"
+    if kind == "float":
+        return value.numerator if value.denominator == 1 else None
+    return value if is_integer(kind) else None
+
+
+def _round_float(value: Fraction, typename: str) -> Fraction:
+    """Round value to the precision of the float type
+
+    Raises ConversionError if the value overflows the type"""
+    try:
+        if typename == "float32":
+            return Fraction(struct.unpack("f", struct.pack("f", float(value)))[0])
+        return Fraction(float(value))
+    except (OverflowError, struct.error):
+        raise ConversionError(f"overflows {typename}")
+
+
+def convert(kind: str, value: Any, typename: str) -> Any:
+    """Value of a constant of kind as a value of the basic type typename
+
+    Raises ConversionError if the value is not representable by the type,
+    because it overflows or it would have to be truncated"""
+    type_kind = kind_of_typename(typename)
+    if not compatible(kind, type_kind):
+        raise ConversionError()
+
+    if type_kind == "int":
+        integer = to_integer(kind, value)
+        if integer is None:
+            raise ConversionError("truncated to integer" if kind != "complex" or value[1] == 0
+                                  else "truncated to real")
+        low, high = int_range(typename)
+        if not low <= integer <= high:
+            raise ConversionError(f"overflows {typename}")
+        return integer
+
+    elif type_kind == "float":
+        if kind == "complex":
+            value, imag = value
+            if imag != 0:
+                raise ConversionError("truncated to real")
+        return _round_float(Fraction(value), typename)
+
+    elif type_kind == "complex":
+        real, imag = to_kind(kind, value, "complex")
+        # each part is a float of half the size
+        part = float_of_complex[typename]
+        return (_round_float(real, part), _round_float(imag, part))
+
+    return value
@@ -1,11 +1,33 @@
+from typing import Tuple
 from colorama import Fore, Style
 
 lines = []
 package_name = None
+# the lines of each file of the program, by name, see set_file.
+# Locations are printed with the name of the file if there are many
+# (not counting the ones of std, see loader.std_root)
+sources = {}
+std_files = set()
+filename = None
+# the text of the files being edited, by name, read instead of the
+# files (which may not be saved), see lsp.py
+overlays = {}
 
 
-def print_lexer_error(err_str=""):
-    print(f"{Fore.RED}ERROR: {err_str}{Style.RESET_ALL}")
+def read_source(name: str) -> str:
+    """The text of the file name. The bytes which aren't UTF-8 are decoded
+    as lone surrogates, so the lexer can report them (see go_lexer.set_input)"""
+    if name in overlays:
+        return overlays[name]
+    with open(name, "rt", encoding="utf-8", errors="surrogateescape") as f:
+        return f.read()
+
+
+def set_file(name):
+    """Prints the locations in the file name from now on"""
+    global lines, filename
+    filename = name
+    lines = sources[name]
 
 
 def print_error(err_str="", kind="SYNTAX ERROR"):
@@ -13,8 +35,11 @@ def print_error(err_str="", kind="SYNTAX ERROR"):
 
 
 def print_line(lineno):
+    location = lineno
+    if len(sources.keys() - std_files) > 1 or filename in std_files:
+        location = f"{filename}:{lineno}"
     print(
-        f"{Fore.GREEN}{lineno:>10}:\t{Style.RESET_ALL}",
+        f"{Fore.GREEN}{location:>10}:\t{Style.RESET_ALL}",
         lines[lineno - 1].expandtabs(1),
         sep="",
     )
@@ -40,3 +65,9 @@ def print_line_marker_nowhitespace(lineno):
 
     print_line(lineno)
     print_marker(leading_spaces, len(line) - leading_spaces - ending_spaces)
+
+
+def line_column(text: str, offset: int) -> Tuple[int, int]:
+    """The line and the column (counting characters from 1) of an offset of text"""
+    lineno = text.count("\n", 0, offset) + 1
+    return lineno, offset - (text.rfind("\n", 0, offset) + 1) + 1
@@ -0,0 +1,2232 @@
+import sys
+import operator
+import cancel
+import checker
+import constant
+import diagnostics
+import fileset
+import interp
+import lang
+import race
+import sandbox
+import syntree
+import untyped
+import utils
+
+from typing import Any, Callable, Dict, List, Optional, Set, Tuple
+from checker import basic_typename, in_order, parameters, results, type_string, underlying
+from interp import (Boxed, Cell, ElementRef, FieldRef, MapValue, Panic, SliceValue, Unsupported,
+                    check_index, copy_value, is_blank, key_of, nil_dereference, runtime_error)
+
+
+# The VM runs a type checked AST like the interpreter does, but each
+# function is compiled to bytecode first: the instructions of a stack
+# machine, with the local variables in the slots of the frame instead of
+# the names of scopes, and jumps for the control flow. A loop doesn't walk
+# the tree (or raise exceptions for break and continue) at each iteration.
+#
+# The values are the ones of the interpreter, and so are the operations
+# which aren't in the loops, like conversions, builtins and formatting:
+# the VM is an Interpreter running the functions it calls as bytecode.
+# A variable is a Cell only if a function literal uses it or its address
+# is taken, the others are values in their slots. The functions declared
+# are compiled the first time they are called.
+# Ref: https://docs.python.org/3/library/dis.html, for the style of the bytecode
+
+
+opnames: List[str] = []
+
+
+def opcode(name: str) -> int:
+    opnames.append(name)
+    return len(opnames) - 1
+
+
+# the argument of the instructions is in the comment of their opcode. x is
+# the value on top of the stack, y the one below it (x[y] pops x then y)
+
+CONST = opcode("CONST")                # the value pushed
+CONST_TYPED = opcode("CONST_TYPED")    # (constant, type) of a constant of a type parameter
+TYPE = opcode("TYPE")                  # the type pushed, for make and new
+ZERO = opcode("ZERO")                  # the type of the zero value pushed
+POP = opcode("POP")
+DUP = opcode("DUP")
+DUP2 = opcode("DUP2")                  # the two values on top
+UNPACK = opcode("UNPACK")              # the number of results of the call on top
+LOAD = opcode("LOAD")                  # slot
+STORE = opcode("STORE")                # slot
+LOAD_CELL = opcode("LOAD_CELL")        # slot of a cell
+STORE_CELL = opcode("STORE_CELL")      # slot of a cell
+NEW_CELL = opcode("NEW_CELL")          # slot of a variable declared, set to a new cell
+RENEW = opcode("RENEW")                # slot of a cell, set to a copy of it
+REF = opcode("REF")                    # slot of a cell, pushed
+LOAD_FREE = opcode("LOAD_FREE")        # index of a cell captured by a function literal
+STORE_FREE = opcode("STORE_FREE")      # index of a cell captured
+REF_FREE = opcode("REF_FREE")          # index of a cell captured, pushed
+LOAD_GLOBAL = opcode("LOAD_GLOBAL")    # the cell of a package variable
+STORE_GLOBAL = opcode("STORE_GLOBAL")  # the cell of a package variable
+DEREF = opcode("DEREF")                # *x
+CHECK_NIL = opcode("CHECK_NIL")        # panics if the pointer x is nil
+STORE_REF = opcode("STORE_REF")        # *y = x
+NEW_REF = opcode("NEW_REF")            # a pointer to x, which isn't a variable (the type of &T{...})
+COPY = opcode("COPY")                  # x copied, if it is a struct or an array
+BOX = opcode("BOX")                    # the type of x, boxed as an interface value
+ASSIGN = opcode("ASSIGN")              # (from type, to type) of x, see Interpreter.assign_value
+CONVERT = opcode("CONVERT")            # (from type, to type) of T(x)
+BINARY = opcode("BINARY")              # the function of y and x
+UNARY = opcode("UNARY")                # the function of x
+NOT = opcode("NOT")
+EQUAL = opcode("EQUAL")                # (type of y, type of x, if it is !=)
+JUMP = opcode("JUMP")                  # target
+JUMP_IF_FALSE = opcode("JUMP_IF_FALSE")
+JUMP_IF_TRUE = opcode("JUMP_IF_TRUE")
+JUMP_IF_FALSE_OR_POP = opcode("JUMP_IF_FALSE_OR_POP")  # target, x is kept if it jumps
+JUMP_IF_TRUE_OR_POP = opcode("JUMP_IF_TRUE_OR_POP")
+MAKE_STRUCT = opcode("MAKE_STRUCT")    # (type, names of the fields given)
+MAKE_ARRAY = opcode("MAKE_ARRAY")      # (type, indices of the elements given), or a slice
+MAKE_MAP = opcode("MAKE_MAP")          # (type, number of entries)
+GET_INDEX = opcode("GET_INDEX")        # y[x]
+GET_MAP = opcode("GET_MAP")            # (type of the elements, comma ok) of y[x]
+GET_FIELD = opcode("GET_FIELD")        # name of the field of x
+SET_INDEX = opcode("SET_INDEX")        # y[x] = z, with z pushed last
+SET_MAP = opcode("SET_MAP")
+SET_FIELD = opcode("SET_FIELD")        # name, y.name = x
+REF_INDEX = opcode("REF_INDEX")        # &y[x]
+REF_FIELD = opcode("REF_FIELD")        # name, &x.name
+SLICE = opcode("SLICE")                # (low, high, max) if they are given, popped in reverse
+ASSERT = opcode("ASSERT")              # (TypeAssertion, the step before it, comma ok) of x
+TYPE_CASE = opcode("TYPE_CASE")        # type of a case of a type switch (None for nil), if x is of it
+METHOD = opcode("METHOD")              # (Selection, name, if x is a pointer to the receiver)
+METHOD_EXPR = opcode("METHOD_EXPR")    # Selection of T.m
+MAKE_CLOSURE = opcode("MAKE_CLOSURE")  # (Code, where the cells captured are)
+CALL = opcode("CALL")                  # CallSite, the function is below the arguments
+BUILTIN = opcode("BUILTIN")            # CallSite of a builtin function
+DEFER = opcode("DEFER")                # CallSite
+DEFER_BUILTIN = opcode("DEFER_BUILTIN")
+GO = opcode("GO")                      # CallSite of the call a goroutine runs
+GO_BUILTIN = opcode("GO_BUILTIN")
+SEND = opcode("SEND")                  # y <- x
+RECV = opcode("RECV")                  # comma ok, <-x
+SELECT = opcode("SELECT")              # (if each case is a send, if there is a default)
+LEN = opcode("LEN")
+RANGE = opcode("RANGE")                # slot the iterator over x is stored in
+RANGE_CHAN = opcode("RANGE_CHAN")      # slot the iterator over the values received from x is stored in
+FOR_ITER = opcode("FOR_ITER")          # (slot of the iterator, target at the end, count)
+RETURN = opcode("RETURN")              # the number of results
+LINE = opcode("LINE")                  # the line of a statement, for the debugger
+COVER = opcode("COVER")                # the cover.Block counted, see cover.py
+RACE = opcode("RACE")                  # (op, arg) of the next instruction, see race.py
+
+# the instructions accessing variables, checked by the race detector, and
+# the ones of them which write
+race_reads = {LOAD_CELL, LOAD_FREE, LOAD_GLOBAL, DEREF, GET_FIELD, GET_INDEX, GET_MAP}
+race_writes = {STORE_CELL, STORE_FREE, STORE_GLOBAL, STORE_REF, SET_FIELD, SET_INDEX, SET_MAP}
+
+
+class Code:
+    """The bytecode of a function, the instructions are the opcodes with
+    their arguments, and the line of the statement they are part of"""
+
+    def __init__(self, name: str, node: Optional[syntree.Function] = None):
+        self.name = name
+        self.node = node
+        self.ops: List[int] = []
+        self.args: List[Any] = []
+        self.lines: List[Optional[int]] = []
+        self.nslots = 0
+        # the names of the slots of the variables, and the instructions
+        # they are in scope in (from start to end, the end of the code if
+        # it is None), for the debugger
+        self.names: Dict[int, str] = {}
+        self.spans: Dict[int, Tuple[int, Optional[int]]] = {}
+        # the names of the cells captured by a function literal
+        self.free_names: List[str] = []
+        # (slot, is a cell) of the receiver and the parameters
+        self.params: List[Tuple[int, bool]] = []
+        # (slot, is a cell, type) of the named results
+        self.results: List[Tuple[int, bool, Any]] = []
+
+
+class CallSite:
+    """The arguments of a call on the stack: how many they are, their types,
+    if the last one is spread and the type arguments of a generic function"""
+
+    def __init__(self, count: int, types: list, ellipsis: bool = False,
+                 type_args: Optional[list] = None, name: Optional[str] = None):
+        self.count = count
+        self.types = types
+        self.ellipsis = ellipsis
+        self.type_args = type_args
+        # the name of a builtin
+        self.name = name
+        self.generic = any(syntree.has_type_params(t) for t in types)
+
+    def __repr__(self):
+        return f"{self.name or ''}({self.count}{'...' if self.ellipsis else ''})"
+
+
+class Function:
+    """A function compiled to bytecode, or a function literal with the
+    cells of the variables it captures and the type arguments of the
+    function it is in"""
+
+    def __init__(self, node: syntree.Function, env: interp.Env, code: Optional[Code] = None,
+                 free: tuple = (), mapping: Optional[dict] = None):
+        self.node = node
+        # the package scope of the function
+        self.env = env
+        self.code = code
+        self.free = free
+        self.mapping = mapping or {}
+
+
+class Name:
+    """What a name refers to when it is compiled: a variable in a slot, a
+    cell captured (free) or the cell of a package variable (global), or
+    a value like a function or a type"""
+
+    def __init__(self, kind: str, index: int = 0, boxed: bool = False, type_: Any = None,
+                 value: Any = None):
+        self.kind = kind
+        self.index = index
+        self.boxed = boxed
+        self.type_ = type_
+        self.value = value
+
+
+class Loop:
+    """The jumps of the break and continue statements of a loop (or a
+    switch), patched once its end is compiled. label is the one of the
+    labeled statement it is, if any"""
+
+    def __init__(self, switch: bool = False, label: Optional[str] = None):
+        self.switch = switch
+        self.label = label
+        self.breaks: List[int] = []
+        self.continues: List[int] = []
+
+
+class VM(interp.Interpreter):
+
+    def __init__(self, info: checker.Info, out=None, argv: Optional[List[str]] = None,
+                 clock: Optional[interp.Clock] = None):
+        super().__init__(info, out, argv, clock)
+        # the code of the functions and methods declared, by id of their node
+        self.codes: Dict[int, Code] = {}
+        # the types of the package variables, by id of their cell
+        self.var_types: Dict[int, Any] = {}
+
+    def function_value(self, node: syntree.Function, env: interp.Env) -> Any:
+        return Function(node, env)
+
+    def declare_package(self, ast: syntree.Node, env: interp.Env):
+        """Declares the functions, types and imports of the package in env,
+        then runs the initialization of its variables (in the order the
+        checker found), compiled as a function of its own"""
+        self.globals = env
+        variables = []
+        for decl in interp.package_decls(ast):
+            if isinstance(decl, syntree.Import):
+                name, path = decl.data
+                path = path[1].strip('"')
+                name = name[1] if isinstance(name, tuple) else path.split("/")[-1]
+                env.declare(name, interp.PackageRef(path, self.packages.get(path)))
+            elif isinstance(decl, syntree.Method):
+                self.method_envs[id(decl)] = env
+            elif isinstance(decl, syntree.Function) and not interp.is_native(decl, env):
+                env.declare(decl.fn_name[1], Function(decl, env))
+            elif isinstance(decl, syntree.TypeDef):
+                env.declare(decl.typename[1], interp.TypeName(decl.type_))
+            elif isinstance(decl, syntree.VarDecl) and not decl.const:
+                cell = Cell()
+                env.declare(decl.ident.ident_name, cell)
+                self.var_types[id(cell)] = self.var_type(decl.ident)
+                variables.append(decl)
+        compiler = Compiler(self, env, Code("init"), package=True)
+        code = compiler.package_vars(self.info.init_order.get(ast, variables))
+        self.execute(None, code, [], {})
+
+    def var_type(self, ident) -> Any:
+        """The type of the variable the identifier declares"""
+        obj = self.info.defs.get(ident)
+        return obj.type_ if obj is not None else None
+
+    def compile(self, node: syntree.Function, env: interp.Env) -> Code:
+        code = self.codes.get(id(node))
+        if code is None:
+            name = node.fn_name[1] if node.fn_name is not None else "func"
+            compiler = Compiler(self, env, Code(name, node), boxed=boxed_names(node, self.info))
+            code = self.codes[id(node)] = compiler.function(node)
+        return code
+
+    # calls
+
+    def call_function(self, fn: Any, args: list, deferred_by: Optional[interp.Frame] = None
+                      ) -> Any:
+        if isinstance(fn, Function):
+            code = fn.code if fn.code is not None else self.compile(fn.node, fn.env)
+            return self.execute(fn.node, code, args, fn.mapping, fn.free, deferred_by)
+        elif isinstance(fn, interp.BoundMethod):
+            code = self.compile(fn.method, self.method_envs.get(id(fn.method), self.globals))
+            return self.execute(fn.method, code, [fn.recv] + args, fn.mapping, (), deferred_by)
+        elif isinstance(fn, interp.MethodExpr):
+            recv = fn.receiver(args[0])
+            code = self.compile(fn.method, self.method_envs.get(id(fn.method), self.globals))
+            return self.execute(fn.method, code, [recv] + args[1:], fn.mapping, (), deferred_by)
+        return super().call_function(fn, args, deferred_by)
+
+    def execute(self, node: Optional[syntree.Function], code: Code, args: list, mapping: dict,
+                free: tuple = (), deferred_by: Optional[interp.Frame] = None) -> Any:
+        self.step()
+        frame = interp.Frame(node, mapping)
+        frame.deferred_by = deferred_by
+        self.frames.append(frame)
+        try:
+            slots: List[Any] = [None] * code.nslots
+            for (slot, boxed), value in zip(code.params, args):
+                slots[slot] = Cell(value) if boxed else value
+            for slot, boxed, type_ in code.results:
+                zero = self.zero(type_)
+                slots[slot] = Cell(zero) if boxed else zero
+
+            returned: list = []
+            try:
+                returned = self.run_code(code, slots, free)
+            except Panic as p:
+                frame.panic = p
+            self.run_defers(frame)
+            if frame.panic is not None:
+                if node is not None:
+                    frame.panic.unwind(node)
+                raise frame.panic
+
+            # deferred functions can change the named results
+            if code.results:
+                returned = [slots[slot].value if boxed else slots[slot]
+                            for slot, boxed, _ in code.results]
+            if len(returned) == 1:
+                return returned[0]
+            return tuple(returned) if returned else None
+        finally:
+            self.frames.pop()
+
+    def trace_line(self, code: Code, pc: int, slots: list, free: tuple, line: int):
+        """Reports the line of the statement run to the debugger, the
+        variables of the frame are the slots in scope at pc"""
+        def variables() -> List[Tuple[str, Any]]:
+            found = []
+            for slot, (start, end) in code.spans.items():
+                if start <= pc and (end is None or pc < end):
+                    value = slots[slot]
+                    found.append((code.names[slot],
+                                  value.value if isinstance(value, Cell) else value))
+            found.extend((name, cell.value) for name, cell in zip(code.free_names, free))
+            return found
+
+        frame = self.frames[-1]
+        frame.line, frame.variables = line, variables
+        if frame.fn is not None:
+            self.debugger.line(fileset.fset.position(frame.fn.pos).filename, line,
+                               len(self.frames), self.debug_frames)
+
+    def prepare(self, fn: Any, values: list, site: CallSite) -> Tuple[Any, list]:
+        """The function called and the values of its arguments converted to
+        the types of the parameters, like Interpreter.prepare_call does"""
+        types = [self.resolve(t) for t in site.types] if site.generic else site.types
+        if isinstance(fn, interp.Native):
+            if site.ellipsis:
+                # the natives (like fmt.Println) take the elements of the slice
+                t = types[-1]
+                eltype = underlying(t).eltype if t is not None else None
+                elements = interp.elements_of(values[-1])
+                values = values[:-1] + elements
+                types = types[:-1] + [eltype] * len(elements)
+            return fn, [self.assign_value(v, t, self.any_type) for v, t in zip(values, types)]
+
+        if isinstance(fn, Function):
+            signature, mapping = fn.node.signature, fn.mapping
+            if signature.type_params and site.type_args:
+                mapping = dict(mapping)
+                mapping.update(zip(signature.type_params,
+                                   (self.resolve(t) for t in site.type_args)))
+                fn = Function(fn.node, fn.env, fn.code, fn.free, mapping)
+            params = parameters(signature.parameters)
+        elif isinstance(fn, interp.BoundMethod):
+            mapping = fn.mapping
+            params = parameters(fn.method.signature.parameters)
+        elif isinstance(fn, interp.MethodExpr):
+            mapping = fn.mapping
+            params = [(None, fn.recv, False)]
+            params += parameters(fn.method.signature.parameters)
+        elif fn is None:
+            raise nil_dereference()
+        else:
+            raise Unsupported("call of a value which is not a function")
+
+        converted = []
+        for i, (_, type_, vararg) in enumerate(params):
+            if mapping:
+                type_ = syntree.substitute(type_, mapping)
+            if vararg and site.ellipsis:
+                # f(s...) passes the slice itself
+                converted.append(values[i])
+                break
+            elif vararg:
+                rest = [self.assign_value(v, t, type_) for v, t in zip(values[i:], types[i:])]
+                converted.append(SliceValue(rest, 0, len(rest), len(rest)) if rest else None)
+                break
+            converted.append(self.assign_value(values[i], types[i], type_))
+        return fn, converted
+
+    def builtin_call(self, values: list, site: CallSite) -> Any:
+        types = [self.resolve(t) for t in site.types] if site.generic else site.types
+        return self.builtin(site.name, list(zip(values, types)), site.ellipsis)
+
+    # values
+
+    def index_value(self, x: Any, i: Any) -> Any:
+        """x[i] of the values the fast path of GET_INDEX doesn't handle"""
+        if isinstance(x, interp.Ref):
+            # a pointer to an array
+            array = x.get()
+            check_index(i, len(array))
+            return array[i]
+        elif isinstance(x, Function):
+            # an instantiation of a generic function, the type arguments
+            # are the ones of the call
+            return x
+        check_index(i, 0)
+
+    def set_index(self, x: Any, i: Any, value: Any):
+        if isinstance(x, interp.Ref):
+            x = x.get()
+        if isinstance(x, SliceValue):
+            check_index(i, x.length)
+            x.array[x.offset + i] = value
+        elif isinstance(x, list):
+            check_index(i, len(x))
+            x[i] = value
+        else:
+            check_index(i, 0)
+
+    def element_ref(self, x: Any, i: Any) -> ElementRef:
+        if isinstance(x, interp.Ref):
+            x = x.get()
+        if isinstance(x, SliceValue):
+            check_index(i, x.length)
+            return ElementRef(x.array, x.offset + i)
+        elif isinstance(x, list):
+            check_index(i, len(x))
+            return ElementRef(x, i)
+        check_index(i, 0)
+
+    def struct_of(self, x: Any) -> interp.StructValue:
+        """The struct x is, or points to"""
+        if x is None:
+            raise nil_dereference()
+        return x.get() if isinstance(x, interp.Ref) else x
+
+    def method_value(self, value: Any, selection: checker.Selection, name: str,
+                     addressed: bool) -> interp.BoundMethod:
+        """x.m for the method m of x, or of the dynamic type of x if it is an
+        interface value. If addressed, x is a pointer to the receiver"""
+        ref = None
+        if addressed:
+            ref, value = value, value.get()
+        # the embedded field of a promoted method is pushed, see Compiler.chain
+        recv = selection.path[-1].type_ if selection.path else selection.recv
+        method, recv_type, value, ref = self.dispatch(
+            selection.obj, name, self.resolve(recv), value, ref, []
+        )
+        return self.bind(method, recv_type, value, ref)
+
+    def make_array(self, t: Any, indices: list, values: list) -> Any:
+        t = self.resolve(t)
+        u = underlying(t)
+        length = u.length if isinstance(u, syntree.Array) else max(indices, default=-1) + 1
+        if len(indices) == length and indices == list(range(length)):
+            array = values
+        else:
+            items = dict(zip(indices, values))
+            array = [items[i] if i in items else self.zero(u.eltype) for i in range(length)]
+        if isinstance(u, syntree.Array):
+            return array
+        self.allocate(u.eltype, length)
+        return SliceValue(array, 0, length, length)
+
+    def range_pairs(self, x: Any):
+        """The pairs of values of a range over x, like Interpreter.range_loop"""
+        if isinstance(x, int) and not isinstance(x, bool):
+            return ((i, None) for i in range(x))
+        elif isinstance(x, bytes):
+            return interp.runes(x)
+        elif isinstance(x, list):
+            return enumerate(x)
+        elif isinstance(x, interp.Ref):
+            array = x.get()
+            return ((i, array[i]) for i in range(len(array)))
+        elif isinstance(x, SliceValue):
+            return ((i, x.array[x.offset + i]) for i in range(x.length))
+        elif isinstance(x, MapValue):
+            return interp.map_entries(x)
+        elif x is None:
+            return iter(())
+        raise Unsupported("range over this type is not supported")
+
+    # the loop running the bytecode, the instructions run the most are first
+
+    def run_code(self, code: Code, slots: list, free: tuple) -> list:
+        """Runs the code of a function with its frame, returns its results"""
+        ops, args = code.ops, code.args
+        stack: List[Any] = []
+        push, pop = stack.append, stack.pop
+        pc = 0
+        try:
+            while True:
+                op = ops[pc]
+                arg = args[pc]
+                pc += 1
+                if op == LOAD:
+                    push(slots[arg])
+                elif op == CONST:
+                    push(arg)
+                elif op == STORE:
+                    slots[arg] = pop()
+                elif op == BINARY:
+                    y = pop()
+                    stack[-1] = arg(stack[-1], y)
+                elif op == JUMP_IF_FALSE:
+                    if not pop():
+                        pc = arg
+                elif op == JUMP:
+                    if arg < pc:
+                        # a loop (or a goto) going back, see Interpreter.step
+                        self.step()
+                    pc = arg
+                elif op == LOAD_CELL:
+                    push(slots[arg].value)
+                elif op == STORE_CELL:
+                    slots[arg].value = pop()
+                elif op == GET_INDEX:
+                    i = pop()
+                    x = stack[-1]
+                    if isinstance(x, SliceValue):
+                        if not 0 <= i < x.length:
+                            check_index(i, x.length)
+                        stack[-1] = x.array[x.offset + i]
+                    elif isinstance(x, (list, bytes)):
+                        if not 0 <= i < len(x):
+                            check_index(i, len(x))
+                        stack[-1] = x[i]
+                    else:
+                        stack[-1] = self.index_value(x, i)
+                elif op == SET_INDEX:
+                    value = pop()
+                    i = pop()
+                    x = pop()
+                    if isinstance(x, SliceValue) and 0 <= i < x.length:
+                        x.array[x.offset + i] = value
+                    else:
+                        self.set_index(x, i, value)
+                elif op == GET_FIELD:
+                    x = stack[-1]
+                    if not isinstance(x, interp.StructValue):
+                        x = self.struct_of(x)
+                    stack[-1] = x.fields[arg]
+                elif op == LOAD_FREE:
+                    push(free[arg].value)
+                elif op == STORE_FREE:
+                    free[arg].value = pop()
+                elif op == LOAD_GLOBAL:
+                    push(arg.value)
+                elif op == STORE_GLOBAL:
+                    arg.value = pop()
+                elif op == CALL:
+                    n = arg.count
+                    if n:
+                        values = stack[-n:]
+                        del stack[-n:]
+                    else:
+                        values = []
+                    fn, values = self.prepare(pop(), values, arg)
+                    self.frames[-1].line = code.lines[pc - 1]
+                    push(self.call_function(fn, values))
+                elif op == FOR_ITER:
+                    slot, end, count = arg
+                    pair = next(slots[slot], None)
+                    if pair is None:
+                        pc = end
+                    elif count == 1:
+                        push(pair[0])
+                    elif count == 2:
+                        push(pair[0])
+                        push(pair[1])
+                elif op == RETURN:
+                    values = stack[len(stack) - arg:] if arg else []
+                    if arg and code.results:
+                        for (slot, boxed, _), value in zip(code.results, values):
+                            if boxed:
+                                slots[slot].value = value
+                            else:
+                                slots[slot] = value
+                    return values
+                elif op == POP:
+                    pop()
+                elif op == DUP:
+                    push(stack[-1])
+                elif op == DUP2:
+                    stack.extend(stack[-2:])
+                elif op == NOT:
+                    stack[-1] = not stack[-1]
+                elif op == UNARY:
+                    stack[-1] = arg(stack[-1])
+                elif op == JUMP_IF_TRUE:
+                    if pop():
+                        pc = arg
+                elif op == JUMP_IF_FALSE_OR_POP:
+                    if not stack[-1]:
+                        pc = arg
+                    else:
+                        pop()
+                elif op == JUMP_IF_TRUE_OR_POP:
+                    if stack[-1]:
+                        pc = arg
+                    else:
+                        pop()
+                elif op == LEN:
+                    stack[-1] = interp.length(stack[-1])
+                elif op == GET_MAP:
+                    eltype, comma_ok = arg
+                    key = pop()
+                    m = stack[-1]
+                    entry = m.entries.get(key_of(key)) if m is not None else None
+                    stack[-1] = self.zero(eltype) if entry is None else entry[1]
+                    if comma_ok:
+                        push(entry is not None)
+                elif op == SET_MAP:
+                    value = pop()
+                    key = pop()
+                    m = pop()
+                    if m is None:
+                        raise runtime_error("assignment to entry in nil map")
+                    m.entries[key_of(key)] = (key, value)
+                elif op == SET_FIELD:
+                    value = pop()
+                    self.struct_of(pop()).fields[arg] = value
+                elif op == COPY:
+                    stack[-1] = copy_value(stack[-1])
+                elif op == BOX:
+                    stack[-1] = Boxed(arg, copy_value(stack[-1]))
+                elif op == ASSIGN:
+                    from_type, to_type = arg
+                    stack[-1] = self.assign_value(stack[-1], self.resolve(from_type), to_type)
+                elif op == EQUAL:
+                    left, right, negate = arg
+                    left, right = self.resolve(left), self.resolve(right)
+                    y = self.assign_value(pop(), right, left)
+                    x = self.assign_value(stack[-1], left, right)
+                    stack[-1] = self.equal(x, y) != negate
+                elif op == CONVERT:
+                    from_type, to_type = arg
+                    stack[-1] = self.convert(stack[-1], self.resolve(from_type), to_type)
+                elif op == NEW_CELL:
+                    slots[arg] = Cell(pop())
+                elif op == RENEW:
+                    slots[arg] = Cell(slots[arg].value)
+                elif op == REF:
+                    push(slots[arg])
+                elif op == REF_FREE:
+                    push(free[arg])
+                elif op == DEREF:
+                    p = stack[-1]
+                    if p is None:
+                        raise nil_dereference()
+                    stack[-1] = p.get()
+                elif op == CHECK_NIL:
+                    if stack[-1] is None:
+                        raise nil_dereference()
+                elif op == STORE_REF:
+                    value = pop()
+                    pop().set(value)
+                elif op == NEW_REF:
+                    stack[-1] = Cell(stack[-1])
+                    if arg is not None:
+                        self.allocate(arg)
+                elif op == REF_INDEX:
+                    i = pop()
+                    stack[-1] = self.element_ref(stack[-1], i)
+                elif op == REF_FIELD:
+                    stack[-1] = FieldRef(self.struct_of(stack[-1]), arg)
+                elif op == UNPACK:
+                    stack.extend(pop())
+                elif op == METHOD:
+                    selection, name, addressed = arg
+                    stack[-1] = self.method_value(stack[-1], selection, name, addressed)
+                elif op == METHOD_EXPR:
+                    push(self.method_expr(arg))
+                elif op == BUILTIN:
+                    n = arg.count
+                    values = stack[len(stack) - n:]
+                    del stack[len(stack) - n:]
+                    self.frames[-1].line = code.lines[pc - 1]
+                    push(self.builtin_call(values, arg))
+                elif op == DEFER or op == DEFER_BUILTIN:
+                    n = arg.count
+                    values = stack[len(stack) - n:]
+                    del stack[len(stack) - n:]
+                    if op == DEFER:
+                        deferred = self.prepare(pop(), values, arg)
+                    else:
+                        # the arguments are evaluated when the call is deferred
+                        deferred = (interp.Native(arg.name, lambda _, __, values=values, site=arg:
+                                                  self.builtin_call(values, site)), [])
+                    self.frames[-1].defers.append(deferred)
+                elif op == GO or op == GO_BUILTIN:
+                    n = arg.count
+                    values = stack[len(stack) - n:]
+                    del stack[len(stack) - n:]
+                    if op == GO:
+                        fn, values = self.prepare(pop(), values, arg)
+                    else:
+                        fn, values = (interp.Native(arg.name, lambda _, __, values=values, site=arg:
+                                                    self.builtin_call(values, site)), [])
+                    self.start(fn, values, code.lines[pc - 1])
+                elif op == SEND:
+                    value = pop()
+                    self.frames[-1].line = code.lines[pc - 1]
+                    self.send(pop(), value)
+                elif op == RECV:
+                    self.frames[-1].line = code.lines[pc - 1]
+                    value, ok = self.receive(stack[-1])
+                    stack[-1] = value
+                    if arg:
+                        push(ok)
+                elif op == SELECT:
+                    sends, default = arg
+                    n = len(sends) + sum(sends)
+                    operands = iter(stack[len(stack) - n:])
+                    del stack[len(stack) - n:]
+                    # the channel of each case, and the value of a send
+                    cases = [(next(operands), next(operands) if send else None, send)
+                             for send in sends]
+                    self.frames[-1].line = code.lines[pc - 1]
+                    stack.extend(self.selectgo(cases, default))
+                elif op == MAKE_CLOSURE:
+                    closure_code, captures = arg
+                    cells = tuple(slots[i] if kind == "slot" else free[i] for kind, i in captures)
+                    push(Function(closure_code.node, self.globals, closure_code, cells,
+                                  self.frames[-1].mapping))
+                elif op == MAKE_STRUCT:
+                    t, names = arg
+                    value = self.zero(t)
+                    if names:
+                        for name, v in zip(names, stack[len(stack) - len(names):]):
+                            value.fields[name] = v
+                        del stack[len(stack) - len(names):]
+                    push(value)
+                elif op == MAKE_ARRAY:
+                    t, indices = arg
+                    values = stack[len(stack) - len(indices):]
+                    del stack[len(stack) - len(indices):]
+                    push(self.make_array(t, indices, values))
+                elif op == MAKE_MAP:
+                    t, n = arg
+                    m = MapValue(self.resolve(t))
+                    self.allocate_map(t, n)
+                    items = stack[len(stack) - 2 * n:]
+                    del stack[len(stack) - 2 * n:]
+                    for key, value in zip(items[::2], items[1::2]):
+                        m.entries[key_of(key)] = (key, value)
+                    push(m)
+                elif op == SLICE:
+                    has_low, has_high, has_max = arg
+                    max_ = pop() if has_max else None
+                    high = pop() if has_high else None
+                    low = pop() if has_low else 0
+                    stack[-1] = self.slice_of(stack[-1], low, high, max_)
+                elif op == ASSERT:
+                    step, prev, comma_ok = arg
+                    value, ok = self.type_assertion(stack[-1], step, prev, comma_ok)
+                    stack[-1] = value
+                    if comma_ok:
+                        push(ok)
+                elif op == TYPE_CASE:
+                    if arg is None:
+                        stack[-1] = not isinstance(stack[-1], Boxed)
+                    else:
+                        stack[-1] = self.asserted(stack[-1], self.resolve(arg))[1]
+                elif op == RANGE:
+                    slots[arg] = self.range_pairs(pop())
+                elif op == RANGE_CHAN:
+                    slots[arg] = self.received(pop(), code.lines[pc - 1])
+                elif op == ZERO:
+                    push(self.zero(arg))
+                elif op == TYPE:
+                    push(self.resolve(arg))
+                elif op == CONST_TYPED:
+                    c, t = arg
+                    push(self.constant_value(c, self.resolve(t)))
+                elif op == LINE:
+                    self.trace_line(code, pc, slots, free, arg)
+                elif op == COVER:
+                    arg.count += 1
+                elif op == RACE:
+                    self.frames[-1].line = code.lines[pc - 1]
+                    self.race_access(arg, stack, slots, free)
+                else:
+                    raise Unsupported(f"opcode {opnames[op]}")
+        except Panic as p:
+            # the line of the instruction run last, the one which panicked
+            if p.line is None:
+                p.line = code.lines[pc - 1]
+            raise
+
+
+    def race_access(self, access: tuple, stack: list, slots: list, free: tuple):
+        """Checks the access of the instruction (op, arg) about to run for
+        races, the variable it accesses is the key of the race detector: the
+        cell, the FieldRef or ElementRef, or the map (its entries are one)"""
+        op, arg = access
+        write = op in race_writes
+        if op in (LOAD_CELL, STORE_CELL):
+            key = slots[arg]
+        elif op in (LOAD_FREE, STORE_FREE):
+            key = free[arg]
+        elif op in (LOAD_GLOBAL, STORE_GLOBAL):
+            key = arg
+        elif op in (DEREF, STORE_REF):
+            key = stack[-2 if write else -1]
+        elif op in (GET_FIELD, SET_FIELD):
+            x = stack[-2 if write else -1]
+            if isinstance(x, interp.Ref):
+                x = x.get()
+            if x is None:
+                return
+            key = FieldRef(x, arg)
+        elif op in (GET_INDEX, SET_INDEX):
+            x, i = stack[-3:-1] if write else stack[-2:]
+            if isinstance(x, SliceValue) and 0 <= i < x.length:
+                key = ElementRef(x.array, x.offset + i)
+            elif isinstance(x, list) and 0 <= i < len(x):
+                key = ElementRef(x, i)
+            else:
+                return
+        else:
+            key = stack[-3 if write else -2]
+        if key is not None:
+            self.race.access(key, write)
+
+
+# the operators on values of basic types, compiled to python functions
+
+
+def arithmetic(operator_: str, typename: Optional[str]) -> Callable:
+    """The function of an arithmetic operator on values of the type,
+    the results are wrapped like Interpreter.arith does"""
+    kind = untyped.kind_of_typename(typename) if typename is not None else None
+    if kind == "string":
+        return operator.add
+    if kind == "int":
+        return int_arithmetic(operator_, typename)
+    if kind not in ("float", "complex"):
+        return lambda x, y: interp.Interpreter.arith(None, operator_, x, y, None)
+
+    if operator_ == "/":
+        def op(x, y):
+            try:
+                return x / y
+            except ZeroDivisionError:
+                return interp.float_division_by_zero(x, y)
+    else:
+        op = {"+": operator.add, "-": operator.sub, "*": operator.mul}[operator_]
+    if typename in ("float32", "complex64"):
+        return lambda x, y: interp.wrap(op(x, y), typename)
+    return op
+
+
+def int_arithmetic(operator_: str, typename: str) -> Callable:
+    size = untyped.int_size(typename)
+    low, high = (0, (1 << size) - 1) if untyped.is_unsigned(typename) else (
+        -(1 << (size - 1)), (1 << (size - 1)) - 1
+    )
+
+    if operator_ in ("/", "%"):
+        def division(x, y):
+            if y == 0:
+                raise runtime_error("integer divide by zero")
+            # the quotient is truncated towards zero
+            q = abs(x) // abs(y)
+            q = q if (x < 0) == (y < 0) else -q
+            r = q if operator_ == "/" else x - q * y
+            return r if low <= r <= high else interp.wrap(r, typename)
+        return division
+
+    if operator_ in ("<<", ">>"):
+        def shift(x, y):
+            if y < 0:
+                raise runtime_error("negative shift amount")
+            if operator_ == ">>":
+                return (-1 if x < 0 else 0) if y >= size else x >> y
+            r = 0 if y >= size else x << y
+            return r if low <= r <= high else interp.wrap(r, typename)
+        return shift
+
+    op = {
+        "+": operator.add, "-": operator.sub, "*": operator.mul, "&": operator.and_,
+        "|": operator.or_, "^": operator.xor, "&^": lambda x, y: x & ~y,
+    }[operator_]
+
+    def wrapped(x, y):
+        r = op(x, y)
+        return r if low <= r <= high else interp.wrap(r, typename)
+    return wrapped
+
+
+comparisons = {
+    "==": operator.eq, "!=": operator.ne, "<": operator.lt, "<=": operator.le,
+    ">": operator.gt, ">=": operator.ge,
+}
+
+
+def basic_kind(t: Any) -> Optional[str]:
+    """The kind of values of the basic type t, None for the other types"""
+    if t is None or syntree.has_type_params(t):
+        return None
+    typename = basic_typename(underlying(t))
+    return untyped.kind_of_typename(typename) if typename is not None else None
+
+
+def may_copy(t: Any) -> bool:
+    """If the values of type t are copied when they are assigned"""
+    if t is None:
+        return False
+    return syntree.has_type_params(t) or isinstance(underlying(t), (syntree.Struct, syntree.Array))
+
+
+def boxed_names(node, info: checker.Info) -> Set[str]:
+    """The names of the variables which are cells in the function (and the
+    function literals in it): the ones the literals use, and the ones whose
+    address is taken, which calling a pointer method does too"""
+    names: Set[str] = set()
+    for n in syntree.walk(node):
+        if isinstance(n, syntree.Function) and n is not node:
+            for p in syntree.walk(n):
+                if isinstance(p, syntree.PrimaryExpr) and isinstance(p.data, tuple):
+                    names.add(p.data[1])
+                elif isinstance(p, syntree.FunctionCall) and isinstance(p.fn_name, str):
+                    names.add(p.fn_name)
+        elif isinstance(n, syntree.UnaryOp) and n.operator == "&":
+            operand = n.operand
+            if isinstance(operand, syntree.List):
+                operand = in_order(operand)[0]
+            if (isinstance(operand, syntree.PrimaryExpr) and isinstance(operand.data, tuple)
+                    and not operand.children):
+                names.add(operand.data[1])
+        elif (isinstance(n, syntree.PrimaryExpr) and isinstance(n.data, tuple) and n.children
+              and isinstance(n.children[0], syntree.Selector)):
+            selection = info.selections.get(n.children[0])
+            if (selection is not None and selection.kind == "method"
+                    and getattr(selection.obj, "pointer_receiver", False)
+                    and not isinstance(underlying(selection.recv), syntree.Pointer)):
+                names.add(n.data[1])
+    return names
+
+
+class Compiler:
+    """Compiles the body of a function to bytecode. The scopes map the names
+    declared to their slots, the names of the enclosing functions used by a
+    function literal are the cells it captures"""
+
+    def __init__(self, vm: VM, env: interp.Env, code: Code, parent: Optional["Compiler"] = None,
+                 boxed: Optional[Set[str]] = None, package: bool = False):
+        self.vm = vm
+        self.info = vm.info
+        # the package scope
+        self.env = env
+        self.code = code
+        self.parent = parent
+        self.boxed = boxed or set()
+        # the variables declared are the package variables
+        self.package = package
+        self.scopes: List[Dict[str, Name]] = [{}]
+        # where the cells captured are in the enclosing function, ("slot", i)
+        # or ("free", i), and their index by name
+        self.captures: List[Tuple[str, int]] = []
+        self.free: Dict[str, Name] = {}
+        self.loops: List[Loop] = []
+        # the positions of the labels compiled, the jumps of the gotos to the
+        # labels after them, and the label of the loop or switch compiled next
+        self.labels: Dict[str, int] = {}
+        self.gotos: Dict[str, List[int]] = {}
+        self.labeling: Optional[str] = None
+        self.unpacked: Set[int] = set()
+        self.signature: Optional[syntree.Signature] = None
+        self.line: Optional[int] = None
+        # if the accesses to the variables are checked for races, the ones
+        # of the functions of std aren't
+        self.race = vm.race is not None and code.node is not None and \
+            fileset.fset.position(code.node.pos).filename not in utils.std_files
+
+    # instructions
+
+    def emit(self, op: int, arg: Any = None) -> int:
+        if self.race and (op in race_reads or op in race_writes):
+            self.code.ops.append(RACE)
+            self.code.args.append((op, arg))
+            self.code.lines.append(self.line)
+        self.code.ops.append(op)
+        self.code.args.append(arg)
+        self.code.lines.append(self.line)
+        return len(self.code.ops) - 1
+
+    def label(self) -> int:
+        return len(self.code.ops)
+
+    def patch(self, at: int, target: Optional[int] = None):
+        """Sets the target of the jump at to the next instruction, or target"""
+        self.code.args[at] = self.label() if target is None else target
+
+    def temp(self) -> int:
+        slot = self.code.nslots
+        self.code.nslots += 1
+        return slot
+
+    # names
+
+    def declare(self, name: str, type_: Any) -> Name:
+        slot = self.temp()
+        variable = Name("slot", slot, name in self.boxed, type_)
+        self.code.names[slot] = name
+        if name != "_":
+            self.scopes[-1][name] = variable
+            self.code.spans[slot] = (self.label(), None)
+        return variable
+
+    def pop_scope(self):
+        """Ends the innermost scope, its variables are out of scope after
+        the instructions compiled so far"""
+        for variable in self.scopes.pop().values():
+            if variable.kind == "slot" and variable.index in self.code.spans:
+                self.code.spans[variable.index] = (self.code.spans[variable.index][0],
+                                                   self.label())
+
+    def resolve(self, name: str) -> Name:
+        for scope in reversed(self.scopes):
+            if name in scope:
+                return scope[name]
+        if name in self.free:
+            return self.free[name]
+        if self.parent is not None:
+            outer = self.parent.resolve(name)
+            if outer.kind not in ("slot", "free"):
+                return outer
+            # a variable of the enclosing function, the literal captures its cell
+            self.captures.append((outer.kind, outer.index))
+            self.code.free_names.append(name)
+            variable = self.free[name] = Name("free", len(self.captures) - 1, True, outer.type_)
+            return variable
+        try:
+            value = self.env.lookup(name)
+        except KeyError:
+            if name in checker.unsupported_builtins:
+                raise Unsupported(f"the builtin {name} is not supported")
+            raise Unsupported(f"undefined: {name}")
+        if isinstance(value, Cell):
+            return Name("global", type_=self.vm.var_types.get(id(value)), value=value)
+        return Name("value", value=value)
+
+    def member(self, package: interp.PackageRef, name: str) -> Name:
+        if package.members is None:
+            raise Unsupported(f"package {package.path} is not supported")
+        if name not in package.members:
+            raise Unsupported(f"{package.path}.{name} is not supported")
+        value = package.members[name]
+        if isinstance(value, Cell):
+            return Name("global", type_=self.vm.var_types.get(id(value)), value=value)
+        return Name("value", value=value)
+
+    def load(self, name: Name):
+        if name.kind == "slot":
+            self.emit(LOAD_CELL if name.boxed else LOAD, name.index)
+        elif name.kind == "free":
+            self.emit(LOAD_FREE, name.index)
+        elif name.kind == "global":
+            self.emit(LOAD_GLOBAL, name.value)
+        else:
+            self.emit(CONST, name.value)
+
+    def store(self, name: Name):
+        if name.kind == "slot":
+            self.emit(STORE_CELL if name.boxed else STORE, name.index)
+        elif name.kind == "free":
+            self.emit(STORE_FREE, name.index)
+        elif name.kind == "global":
+            self.emit(STORE_GLOBAL, name.value)
+        else:
+            raise Unsupported("cannot assign to a value which is not a variable")
+
+    def ref(self, name: Name):
+        """Pushes the cell of the variable"""
+        if name.kind == "slot" and name.boxed:
+            self.emit(REF, name.index)
+        elif name.kind == "free":
+            self.emit(REF_FREE, name.index)
+        elif name.kind == "global":
+            self.emit(CONST, name.value)
+        else:
+            # not a variable, or one whose address isn't taken
+            self.load(name)
+            self.emit(NEW_REF)
+
+    def store_new(self, name: str, type_: Any):
+        """Stores the value on top in the variable declared, or redeclared by :="""
+        if name == "_":
+            self.emit(POP)
+        elif self.package:
+            self.emit(STORE_GLOBAL, self.env.names[name])
+        elif name in self.scopes[-1] and self.scopes[-1][name].kind == "slot":
+            self.store(self.scopes[-1][name])
+        else:
+            variable = self.declare(name, type_)
+            self.emit(NEW_CELL if variable.boxed else STORE, variable.index)
+
+    # types
+
+    def type_of(self, node) -> Any:
+        x = self.info.operands.get(node)
+        return x.type_ if x is not None else None
+
+    def conversion(self, from_type: Any, to_type: Any) -> Optional[Tuple[int, Any]]:
+        """The instruction converting a value of from_type as it is assigned to
+        a variable of to_type (it is copied or boxed), None if it is the same"""
+        if syntree.has_type_params(from_type) or syntree.has_type_params(to_type):
+            return ASSIGN, (from_type, to_type)
+        if (to_type is not None and syntree.is_interface(to_type)
+                and from_type is not None and not syntree.is_interface(from_type)):
+            return BOX, from_type
+        if may_copy(from_type):
+            return COPY, None
+        return None
+
+    def convert_to(self, from_type: Any, to_type: Any):
+        instruction = self.conversion(from_type, to_type)
+        if instruction is not None:
+            self.emit(*instruction)
+
+    def zero(self, t: Any):
+        if t is None:
+            self.emit(CONST, None)
+        elif syntree.has_type_params(t) or basic_kind(t) is None:
+            self.emit(ZERO, t)
+        else:
+            self.emit(CONST, self.vm.zero(t))
+
+    def const(self, c: constant.Constant, t: Any):
+        if syntree.has_type_params(t):
+            self.emit(CONST_TYPED, (c, t))
+        else:
+            self.emit(CONST, self.vm.constant_value(c, t))
+
+    # functions
+
+    def function(self, node: syntree.Function) -> Code:
+        self.signature = node.signature
+        self.line = node.lineno
+        params = parameters(node.receiver) if isinstance(node, syntree.Method) else []
+        for ident, type_, vararg in params + parameters(node.signature.parameters):
+            name = ident.ident_name if ident is not None else "_"
+            variable = self.declare(name, syntree.Slice(type_) if vararg else type_)
+            self.code.params.append((variable.index, variable.boxed))
+        if node.signature.has_named_results:
+            for ident, type_, _ in parameters(node.signature.result):
+                variable = self.declare(ident.ident_name if ident is not None else "_", type_)
+                self.code.results.append((variable.index, variable.boxed, type_))
+        # the parameters and the function body are in the same block
+        self.statements(in_order(node.body))
+        self.emit(RETURN, 0)
+        return self.code
+
+    def package_vars(self, decls: list) -> Code:
+        for decl in decls:
+            if decl.value is not None:
+                self.boxed |= boxed_names(decl.value, self.info)
+        self.statements(decls)
+        self.emit(RETURN, 0)
+        return self.code
+
+    def closure(self, node: syntree.Function):
+        compiler = Compiler(self.vm, self.env, Code("func", node), self, self.boxed)
+        code = compiler.function(node)
+        self.emit(MAKE_CLOSURE, (code, compiler.captures))
+
+    # statements
+
+    def statements(self, stmts: list):
+        for stmt in stmts:
+            if diagnostics.strict:
+                self.statement(stmt)
+                continue
+            # the statements which can't be compiled are skipped in
+            # permissive mode, the code compiled for them is dropped
+            mark = len(self.code.ops), len(self.scopes), len(self.loops)
+            try:
+                self.statement(stmt)
+            except Unsupported as e:
+                self.rewind(*mark)
+                self.vm.skip(e, stmt)
+
+    def rewind(self, ops: int, scopes: int, loops: int):
+        """Drops the instructions from ops on, with the scopes, the loops
+        and the jumps of the statement they are the code of"""
+        del self.code.ops[ops:], self.code.args[ops:], self.code.lines[ops:]
+        del self.scopes[scopes:], self.loops[loops:]
+        self.code.spans = {slot: span for slot, span in self.code.spans.items() if span[0] < ops}
+        for loop in self.loops:
+            loop.breaks = [at for at in loop.breaks if at < ops]
+            loop.continues = [at for at in loop.continues if at < ops]
+        for jumps in self.gotos.values():
+            jumps[:] = [at for at in jumps if at < ops]
+        self.labels = {name: at for name, at in self.labels.items() if at <= ops}
+        self.labeling = None
+
+    def block(self, node):
+        self.scopes.append({})
+        self.statements(in_order(node))
+        self.pop_scope()
+
+    def statement(self, stmt):
+        if isinstance(stmt, syntree.CoverStmt):
+            self.emit(COVER, stmt.block)
+            return
+        self.line = checker.statement_line(stmt) or self.line
+        if self.vm.debugger is not None:
+            self.emit(LINE, self.line)
+        if isinstance(stmt, syntree.Block):
+            self.block(stmt)
+
+        elif isinstance(stmt, syntree.VarDecl):
+            self.var_decl(stmt)
+
+        elif isinstance(stmt, syntree.TypeDef):
+            self.scopes[-1][stmt.typename[1]] = Name("value", value=interp.TypeName(stmt.type_))
+
+        elif isinstance(stmt, syntree.IfStmt):
+            self.if_stmt(stmt)
+
+        elif isinstance(stmt, syntree.TypeSwitchStmt):
+            self.type_switch_stmt(stmt)
+
+        elif isinstance(stmt, syntree.SwitchStmt):
+            self.switch_stmt(stmt)
+
+        elif isinstance(stmt, syntree.ForStmt):
+            self.for_stmt(stmt)
+
+        elif isinstance(stmt, syntree.Keyword):
+            self.keyword(stmt)
+
+        elif isinstance(stmt, syntree.LabeledStmt):
+            self.labeled(stmt)
+
+        elif isinstance(stmt, syntree.Assignment):
+            self.assignment(stmt)
+
+        elif isinstance(stmt, syntree.DeferStmt):
+            call = in_order(stmt.call)[0]
+            if not isinstance(call, syntree.FunctionCall):
+                raise Unsupported("only calls can be deferred")
+            self.call(call, defer=True)
+
+        elif isinstance(stmt, syntree.UnaryOp) and stmt.operator in ("++", "--"):
+            operator_ = "+" if stmt.operator == "++" else "-"
+            self.update(stmt.operand, operator_, lambda: self.emit(CONST, 1))
+
+        elif isinstance(stmt, syntree.GoStmt):
+            call = in_order(stmt.call)[0]
+            if not isinstance(call, syntree.FunctionCall):
+                raise Unsupported("only calls can be run in goroutines")
+            self.call(call, go=True)
+
+        elif isinstance(stmt, syntree.SendStmt):
+            self.send(stmt)
+
+        elif isinstance(stmt, syntree.SelectStmt):
+            self.select_stmt(stmt)
+
+        elif not isinstance(stmt, syntree.BadStmt):
+            self.expr(stmt)
+            self.emit(POP)
+
+    def var_decl(self, decl: syntree.VarDecl):
+        if decl.const:
+            # the uses of constants are constant operands
+            return
+        type_ = None if decl.type_inferred else decl.type_
+        if not isinstance(type_, syntree.Type):
+            type_ = None
+        if decl.unpack is not None:
+            ident_list, expression_list = decl.unpack
+            key = id(expression_list)
+            if key in self.unpacked:
+                return
+            # the variables are declared once all the values are pushed
+            self.unpacked.add(key)
+            idents = in_order(ident_list)
+            types = self.values(in_order(expression_list), len(idents))
+            for ident, from_type in reversed(list(zip(idents, types))):
+                # a variable redeclared by := keeps its type
+                redeclared = self.scopes[-1].get(ident.ident_name)
+                to_type = type_ or (redeclared.type_ if redeclared is not None else None)
+                self.convert_to(from_type, to_type)
+                self.store_new(ident.ident_name, self.vm.var_type(ident) or to_type or from_type)
+            return
+        redeclared = self.info.redeclared.get(decl.ident)
+        if redeclared is not None:
+            type_ = redeclared.type_
+        if decl.value is not None:
+            self.expr(decl.value)
+            self.convert_to(self.type_of(decl.value), type_)
+        else:
+            self.zero(type_)
+        self.store_new(decl.ident.ident_name, self.vm.var_type(decl.ident) or type_)
+
+    def if_stmt(self, stmt: syntree.IfStmt):
+        self.scopes.append({})
+        if stmt.statement is not None:
+            self.statements(in_order(stmt.statement))
+        self.expr(stmt.expr)
+        else_jump = self.emit(JUMP_IF_FALSE)
+        self.block(stmt.body)
+        if stmt.next_ is not None:
+            end_jump = self.emit(JUMP)
+            self.patch(else_jump)
+            if isinstance(stmt.next_, syntree.IfStmt):
+                self.if_stmt(stmt.next_)
+            else:
+                self.block(stmt.next_)
+            self.patch(end_jump)
+        else:
+            self.patch(else_jump)
+        self.pop_scope()
+
+    def loop_body(self, stmt: syntree.ForStmt) -> Loop:
+        loop = Loop(label=self.labeling)
+        self.labeling = None
+        self.loops.append(loop)
+        self.block(stmt.body)
+        self.loops.pop()
+        return loop
+
+    def for_stmt(self, stmt: syntree.ForStmt):
+        clause = stmt.clause
+        self.scopes.append({})
+        if isinstance(clause, syntree.RangeClause):
+            self.range_loop(stmt, clause)
+        elif isinstance(clause, syntree.ForClause):
+            self.statements(in_order(clause.init))
+            cells = [v for v in self.scopes[-1].values() if v.kind == "slot" and v.boxed]
+            start = self.label()
+            self.loop_line(stmt)
+            exit_jump = self.condition(clause.cond)
+            loop = self.loop_body(stmt)
+            post = self.label()
+            # each iteration has its own variables, initialized
+            # with the values of the previous ones (since Go 1.22)
+            for variable in cells if lang.allows(lang.loop_var) else []:
+                self.emit(RENEW, variable.index)
+            self.statements(in_order(clause.post))
+            self.emit(JUMP, start)
+            self.end_loop(loop, exit_jump, post)
+        else:
+            start = self.label()
+            self.loop_line(stmt)
+            exit_jump = self.condition(clause)
+            loop = self.loop_body(stmt)
+            self.emit(JUMP, start)
+            self.end_loop(loop, exit_jump, start)
+        self.pop_scope()
+
+    def loop_line(self, stmt: syntree.ForStmt):
+        """The debugger is at the line of a loop before each iteration,
+        and when it ends, like in Go"""
+        if self.vm.debugger is not None:
+            self.emit(LINE, checker.statement_line(stmt))
+
+    def condition(self, cond) -> Optional[int]:
+        """Compiles the condition of a loop, returns the jump out of it"""
+        if cond is None:
+            return None
+        x = self.info.operands.get(cond)
+        if x is not None and x.mode == "constant" and x.constant is not None and x.constant.value:
+            # for { ... }
+            return None
+        self.expr(cond)
+        return self.emit(JUMP_IF_FALSE)
+
+    def end_loop(self, loop: Loop, exit_jump: Optional[int], continue_target: int):
+        if exit_jump is not None:
+            self.patch(exit_jump)
+        for at in loop.breaks:
+            self.patch(at)
+        for at in loop.continues:
+            self.patch(at, continue_target)
+
+    def range_loop(self, stmt: syntree.ForStmt, clause: syntree.RangeClause):
+        t = self.type_of(clause.expr)
+        u = underlying(t) if t is not None else None
+        int_type = self.vm.universe.lookup("int").type_
+        if isinstance(u, syntree.Pointer):
+            u = underlying(u.base)
+        if isinstance(u, syntree.FunctionType):
+            # raised when it is compiled, not run, so it can be skipped
+            raise Unsupported("range over functions is not supported")
+        if basic_kind(t) == "string":
+            types = [int_type, self.vm.universe.lookup("rune").type_]
+        elif basic_kind(t) == "int":
+            types = [t, None]
+        elif isinstance(u, syntree.Map):
+            types = [u.key, u.eltype]
+        elif isinstance(u, syntree.Chan):
+            types = [u.eltype, None]
+        else:
+            types = [int_type, getattr(u, "eltype", None)]
+
+        self.expr(clause.expr)
+        iterator = self.temp()
+        # a range over a nil channel blocks forever
+        self.emit(RANGE_CHAN if isinstance(u, syntree.Chan) else RANGE, iterator)
+        if clause.ident_list is not None:
+            variables = in_order(clause.ident_list)
+        else:
+            variables = in_order(clause.expr_list)
+        pairs = list(zip(variables, types))
+        # before Go 1.22 the iterations share the variables, declared
+        # before the loop and assigned by each iteration
+        shared = clause.ident_list is not None and not lang.allows(lang.loop_var)
+        for ident, type_ in pairs if shared else []:
+            self.zero(type_)
+            self.store_new(ident.ident_name, type_)
+        start = self.label()
+        self.loop_line(stmt)
+        next_ = self.emit(FOR_ITER)
+
+        # each iteration has its own variables
+        if not shared:
+            self.scopes.append({})
+        if clause.ident_list is not None:
+            for ident, type_ in reversed(pairs):
+                if may_copy(type_):
+                    self.emit(COPY)
+                self.store_new(ident.ident_name, type_)
+        else:
+            values = []
+            for _ in pairs:
+                values.append(self.temp())
+            for slot in reversed(values):
+                self.emit(STORE, slot)
+            for (target, type_), slot in zip(pairs, values):
+                if not is_blank(target):
+                    store = self.target(target)
+                    self.emit(LOAD, slot)
+                    self.convert_to(type_, self.type_of(target))
+                    store()
+        loop = self.loop_body(stmt)
+        self.emit(JUMP, start)
+        if not shared:
+            self.pop_scope()
+        self.code.args[next_] = (iterator, self.label(), len(variables))
+        self.end_loop(loop, None, start)
+
+    def switch_stmt(self, stmt: syntree.SwitchStmt):
+        self.scopes.append({})
+        if stmt.statement is not None:
+            self.statements(in_order(stmt.statement))
+        tag = tag_type = None
+        if stmt.expr is not None:
+            self.expr(stmt.expr)
+            tag, tag_type = self.temp(), self.type_of(stmt.expr)
+            self.emit(STORE, tag)
+
+        clauses = in_order(stmt.clauses)
+        jumps: List[List[int]] = []
+        for clause in clauses:
+            jumps.append([])
+            if clause.is_default:
+                continue
+            for expr in in_order(clause.exprs):
+                if tag is not None:
+                    self.emit(LOAD, tag)
+                    self.expr(expr)
+                    self.convert_to(self.type_of(expr), tag_type)
+                    self.equality(tag_type, tag_type, "==")
+                else:
+                    self.expr(expr)
+                jumps[-1].append(self.emit(JUMP_IF_TRUE))
+        default_jump = self.emit(JUMP)
+
+        loop = Loop(switch=True, label=self.labeling)
+        self.labeling = None
+        self.loops.append(loop)
+        default = None
+        for clause, clause_jumps in zip(clauses, jumps):
+            for at in clause_jumps:
+                self.patch(at)
+            if clause.is_default:
+                default = self.label()
+            body = in_order(clause.body)
+            fallthrough = (bool(body) and isinstance(body[-1], syntree.Keyword)
+                           and body[-1].kw == "FALLTHROUGH")
+            self.scopes.append({})
+            self.statements(body[:-1] if fallthrough else body)
+            self.pop_scope()
+            if not fallthrough:
+                loop.breaks.append(self.emit(JUMP))
+        self.loops.pop()
+        self.patch(default_jump, default)
+        for at in loop.breaks:
+            self.patch(at)
+        self.pop_scope()
+
+    def type_switch_stmt(self, stmt: syntree.TypeSwitchStmt):
+        self.scopes.append({})
+        if stmt.statement is not None:
+            self.statements(in_order(stmt.statement))
+        self.expr(stmt.expr)
+        x = self.temp()
+        self.emit(STORE, x)
+
+        clauses = in_order(stmt.clauses)
+        jumps: List[List[int]] = []
+        for clause in clauses:
+            jumps.append([])
+            if clause.is_default:
+                continue
+            for case in in_order(clause.types):
+                self.emit(LOAD, x)
+                self.emit(TYPE_CASE, None if case.nil else case.type_)
+                jumps[-1].append(self.emit(JUMP_IF_TRUE))
+        default_jump = self.emit(JUMP)
+
+        loop = Loop(switch=True, label=self.labeling)
+        self.labeling = None
+        self.loops.append(loop)
+        default = None
+        for clause, clause_jumps in zip(clauses, jumps):
+            for at in clause_jumps:
+                self.patch(at)
+            if clause.is_default:
+                default = self.label()
+            self.scopes.append({})
+            obj = self.info.defs.get(clause.ident) if clause.ident is not None else None
+            if obj is not None:
+                # x, asserted to the type of the case if it lists only one
+                types = [] if clause.is_default else in_order(clause.types)
+                self.emit(LOAD, x)
+                if len(types) == 1 and not types[0].nil:
+                    assertion = syntree.TypeAssertion(types[0].type_, clause.lineno)
+                    self.emit(ASSERT, (assertion, None, False))
+                self.store_new(obj.name, obj.type_)
+            self.statements(in_order(clause.body))
+            self.pop_scope()
+            loop.breaks.append(self.emit(JUMP))
+        self.loops.pop()
+        self.patch(default_jump, default)
+        for at in loop.breaks:
+            self.patch(at)
+        self.pop_scope()
+
+    def select_stmt(self, stmt: syntree.SelectStmt):
+        # the channels and the values sent are pushed in source order, then
+        # SELECT pushes the index of the case chosen (-1 for the default),
+        # the value received and whether it was sent
+        clauses = in_order(stmt.clauses) if stmt.clauses is not None else []
+        cases = [clause for clause in clauses if not clause.is_default]
+        sends = []
+        for clause in cases:
+            comm = clause.comm
+            if isinstance(comm, syntree.SendStmt):
+                self.expr(comm.chan)
+                self.expr(comm.value)
+                self.convert_to(self.type_of(comm.value), underlying(self.type_of(comm.chan)).eltype)
+            else:
+                self.expr(interp.received_expr(comm).operand)
+            sends.append(isinstance(comm, syntree.SendStmt))
+        has_default = len(cases) < len(clauses)
+        self.emit(SELECT, (sends, has_default))
+        index, value, ok = self.temp(), self.temp(), self.temp()
+        for slot in (ok, value, index):
+            self.emit(STORE, slot)
+        jumps = []
+        for i in range(len(cases)):
+            self.emit(LOAD, index)
+            self.emit(CONST, i)
+            self.emit(BINARY, operator.eq)
+            jumps.append(self.emit(JUMP_IF_TRUE))
+        default_jump = self.emit(JUMP)
+
+        loop = Loop(switch=True, label=self.labeling)
+        self.labeling = None
+        self.loops.append(loop)
+        default = None
+        for clause in clauses:
+            if clause.is_default:
+                default = self.label()
+            else:
+                self.patch(jumps[cases.index(clause)])
+            self.scopes.append({})
+            if not clause.is_default and not isinstance(clause.comm, syntree.SendStmt):
+                self.receive_into(clause.comm, value, ok)
+            self.statements(in_order(clause.body))
+            self.pop_scope()
+            loop.breaks.append(self.emit(JUMP))
+        self.loops.pop()
+        self.patch(default_jump, default)
+        for at in loop.breaks:
+            self.patch(at)
+
+    def receive_into(self, comm, value: int, ok: int):
+        """Assigns the value received by the case of a select and whether it
+        was sent (in the slots value and ok) to its variables, or declares them"""
+        types = [self.type_of(interp.received_expr(comm)), self.vm.bool_type]
+        if isinstance(comm, syntree.Assignment):
+            for target, slot, type_ in zip(in_order(comm.left), (value, ok), types):
+                if not is_blank(target):
+                    store = self.target(target)
+                    self.emit(LOAD, slot)
+                    self.convert_to(type_, self.type_of(target))
+                    store()
+        elif isinstance(in_order(comm)[0], syntree.VarDecl):
+            for decl, slot, type_ in zip(in_order(comm), (value, ok), types):
+                self.emit(LOAD, slot)
+                self.store_new(decl.ident.ident_name, self.vm.var_type(decl.ident) or type_)
+
+    def send(self, stmt: syntree.SendStmt):
+        self.expr(stmt.chan)
+        self.expr(stmt.value)
+        t = self.type_of(stmt.chan)
+        self.convert_to(self.type_of(stmt.value), underlying(t).eltype if t is not None else None)
+        self.emit(SEND)
+
+    def labeled(self, stmt: syntree.LabeledStmt):
+        name = stmt.label.ident_name
+        self.labels[name] = self.label()
+        for at in self.gotos.pop(name, []):
+            self.patch(at)
+        if isinstance(stmt.stmt, (syntree.ForStmt, syntree.SwitchStmt, syntree.SelectStmt)):
+            self.labeling = name
+        self.statements(checker.labeled_statements(stmt))
+
+    def keyword(self, stmt: syntree.Keyword):
+        label = stmt.label.ident_name if stmt.label is not None else None
+        if stmt.kw == "GOTO":
+            # a goto to a label after it is patched when the label is compiled
+            at = self.emit(JUMP, self.labels.get(label))
+            if label not in self.labels:
+                self.gotos.setdefault(label, []).append(at)
+        elif stmt.kw in ("BREAK", "CONTINUE"):
+            loops = [loop for loop in self.loops if (stmt.kw == "BREAK" or not loop.switch)
+                     and (label is None or loop.label == label)]
+            if not loops:
+                raise Unsupported(f"{stmt.kw.lower()} is not in a loop")
+            jumps = loops[-1].breaks if stmt.kw == "BREAK" else loops[-1].continues
+            jumps.append(self.emit(JUMP))
+        elif stmt.kw == "RETURN":
+            exprs = in_order(stmt.children[0]) if stmt.children else []
+            if not exprs:
+                self.emit(RETURN, 0)
+                return
+            want = results(self.signature)
+            self.values_to(exprs, want)
+            self.emit(RETURN, len(want))
+        else:
+            raise Unsupported(f"{stmt.kw.lower()} statements are not supported")
+
+    def assignment(self, stmt: syntree.Assignment):
+        lhs = in_order(stmt.left)
+        rhs = in_order(stmt.right)
+        if stmt.operator != "=":
+            self.update(lhs[0], stmt.operator[:-1], lambda: self.expr(rhs[0]))
+            return
+
+        if len(lhs) == 1 and len(rhs) == 1:
+            if is_blank(lhs[0]):
+                self.expr(rhs[0])
+                self.emit(POP)
+                return
+            store = self.target(lhs[0])
+            self.expr(rhs[0])
+            self.convert_to(self.type_of(rhs[0]), self.type_of(lhs[0]))
+            store()
+            return
+
+        # the operands of the index expressions and pointer indirections on
+        # the left are evaluated first, then the values on the right
+        stores = [None if is_blank(target) else self.target(target, temps=True)
+                  for target in lhs]
+        types = self.values(rhs, len(lhs))
+        for target, store, from_type in reversed(list(zip(lhs, stores, types))):
+            if store is None:
+                self.emit(POP)
+            else:
+                self.convert_to(from_type, self.type_of(target))
+                store()
+
+    def target(self, node, temps: bool = False) -> Callable[[], None]:
+        """Pushes the operands of the variable an expression on the left of an
+        assignment is (like the map and the key of m[k]), returns the function
+        compiling the store of the value pushed after them. With temps, the
+        operands are kept in slots instead, for the values pushed before the store"""
+        count, _, store = self.variable(node)
+        if not temps or count == 0:
+            return store
+        slots = [self.temp() for _ in range(count)]
+        for slot in reversed(slots):
+            self.emit(STORE, slot)
+
+        def store_from_temps():
+            value = self.temp()
+            self.emit(STORE, value)
+            for slot in slots:
+                self.emit(LOAD, slot)
+            self.emit(LOAD, value)
+            store()
+        return store_from_temps
+
+    def variable(self, node) -> Tuple[int, Callable[[], None], Callable[[], None]]:
+        """Pushes the operands of a variable (or map element), returns how
+        many they are and the functions compiling its load and its store"""
+        if isinstance(node, syntree.List):
+            return self.variable(in_order(node)[0])
+        if isinstance(node, syntree.UnaryOp) and node.operator == "*":
+            self.expr(node.operand)
+            self.emit(CHECK_NIL)
+            return 1, lambda: self.emit(DEREF), lambda: self.emit(STORE_REF)
+        if isinstance(node, syntree.PrimaryExpr):
+            name, base, steps = self.parts(node)
+            if not steps and name is not None:
+                return 0, lambda: self.load(name), lambda: self.store(name)
+            step = steps[-1] if steps else None
+            if isinstance(step, syntree.Index):
+                x = self.info.operands.get(step)
+                self.chain(node, len(steps) - 1)
+                if x is not None and x.mode == "mapindex":
+                    self.map_key(node, step)
+                    eltype = x.type_
+                    return (2, lambda: self.emit(GET_MAP, (eltype, False)),
+                            lambda: self.emit(SET_MAP))
+                self.expr(step.expr)
+                return 2, lambda: self.emit(GET_INDEX), lambda: self.emit(SET_INDEX)
+            if isinstance(step, syntree.Selector):
+                selection = self.info.selections.get(step)
+                if selection is not None and selection.kind == "field":
+                    self.chain(node, len(steps) - 1)
+                    self.embedded(selection.path)
+                    name_ = step.field_name
+                    return (1, lambda: self.emit(GET_FIELD, name_),
+                            lambda: self.emit(SET_FIELD, name_))
+        raise Unsupported(f"cannot assign to {checker.expr_string(node)}")
+
+    def update(self, node, operator_: str, operand: Callable[[], None]):
+        """Compiles x op= y, operand compiles y"""
+        count, load, store = self.variable(node)
+        if count == 1:
+            self.emit(DUP)
+        elif count == 2:
+            self.emit(DUP2)
+        load()
+        operand()
+        self.emit(BINARY, self.arith(operator_, self.type_of(node)))
+        store()
+
+    # expressions
+
+    def values(self, exprs: list, count: Optional[int] = None) -> list:
+        """Pushes the values of expressions, the ones of a call with multiple
+        results, or of a comma ok expression if count is 2. Returns their types"""
+        if len(exprs) == 1:
+            x = self.info.operands.get(exprs[0])
+            if x is not None and x.mode == "tuple":
+                self.expr(exprs[0])
+                self.emit(UNPACK, len(x.tuple_types))
+                return list(x.tuple_types)
+            if x is not None and x.comma_ok and count == 2:
+                if isinstance(exprs[0], syntree.UnaryOp):
+                    self.expr(exprs[0].operand)
+                    self.emit(RECV, True)
+                else:
+                    self.primary(exprs[0], comma_ok=True)
+                return [x.type_, self.vm.bool_type]
+        for expr in exprs:
+            self.expr(expr)
+        return [self.type_of(expr) for expr in exprs]
+
+    def values_to(self, exprs: list, types: list):
+        """Pushes the values of expressions converted to the types"""
+        if len(exprs) == len(types):
+            for expr, type_ in zip(exprs, types):
+                self.expr(expr)
+                self.convert_to(self.type_of(expr), type_)
+            return
+        from_types = self.values(exprs, len(types))
+        conversions = [self.conversion(f, t) for f, t in zip(from_types, types)]
+        if any(conversions):
+            slots = [self.temp() for _ in types]
+            for slot in reversed(slots):
+                self.emit(STORE, slot)
+            for slot, instruction in zip(slots, conversions):
+                self.emit(LOAD, slot)
+                if instruction is not None:
+                    self.emit(*instruction)
+
+    def expr(self, node):
+        x = self.info.operands.get(node)
+        if x is not None and x.mode == "constant" and x.constant is not None:
+            self.const(x.constant, x.type_)
+
+        elif isinstance(node, syntree.List):
+            self.expr(in_order(node)[0])
+
+        elif isinstance(node, syntree.Literal):
+            if isinstance(node.type_, syntree.Type):
+                self.composite(node.type_, node.value)
+            else:
+                # a constant converted to a type parameter, which isn't constant
+                self.emit(CONST_TYPED, (constant.from_literal(node), self.type_of(node)))
+
+        elif isinstance(node, syntree.PrimaryExpr):
+            self.primary(node)
+
+        elif isinstance(node, syntree.QualifiedIdent):
+            package = self.resolve(node.data[0][1]).value
+            self.load(self.member(package, node.data[1][1]))
+
+        elif isinstance(node, syntree.FunctionCall):
+            self.call(node)
+
+        elif isinstance(node, syntree.BinOp):
+            self.binary(node)
+
+        elif isinstance(node, syntree.UnaryOp):
+            self.unary(node)
+
+        elif isinstance(node, syntree.Function):
+            self.closure(node)
+
+        elif isinstance(node, syntree.Type) and not syntree.has_type_params(node):
+            self.emit(CONST, interp.TypeName(node))
+
+        else:
+            raise Unsupported(f"{checker.expr_string(node)} can't be evaluated")
+
+    def composite(self, t: syntree.Type, values):
+        elements = [] if values is None else list(reversed(values.children))
+        u = underlying(t)
+        if isinstance(u, syntree.Struct):
+            names = []
+            for element, field in zip(elements, u.fields):
+                if isinstance(element, syntree.KeyedElement):
+                    field = u.field(element.key.data[1])
+                    element = element.value
+                self.element(element, field.type_)
+                names.append(field.f_name)
+            self.emit(MAKE_STRUCT, (t, names))
+
+        elif isinstance(u, (syntree.Array, syntree.Slice)):
+            indices = []
+            index = 0
+            for element in elements:
+                if isinstance(element, syntree.KeyedElement):
+                    key = self.info.operands.get(element.key)
+                    if key is None or key.constant is None:
+                        raise Unsupported("the indices of composite literals must be constant")
+                    index = self.vm.constant_value(key.constant, None)
+                    element = element.value
+                self.element(element, u.eltype)
+                indices.append(index)
+                index += 1
+            self.emit(MAKE_ARRAY, (t, indices))
+
+        elif isinstance(u, syntree.Map):
+            for element in elements:
+                self.element(element.key, u.key)
+                self.element(element.value, u.eltype)
+            self.emit(MAKE_MAP, (t, len(elements)))
+
+        else:
+            raise Unsupported(f"composite literals of type {type_string(t)} are not supported")
+
+    def element(self, node, type_: syntree.Type):
+        if isinstance(node, syntree.LiteralValue):
+            # the type of the elements can be elided, like {1, 2} for &Point{1, 2}
+            if isinstance(underlying(type_), syntree.Pointer):
+                self.composite(underlying(type_).base, node)
+                self.emit(NEW_REF, underlying(type_).base)
+            else:
+                self.composite(type_, node)
+            return
+        self.expr(node)
+        self.convert_to(self.type_of(node), type_)
+
+    def parts(self, node: syntree.PrimaryExpr) -> Tuple[Optional[Name], Any, list]:
+        """The name or the expression a primary expression starts with, and its
+        steps. The member of a package is a name, like fmt.Println"""
+        if isinstance(node.data, tuple):
+            obj = self.info.uses.get(node)
+            if obj is not None and obj.kind == "const":
+                # a constant with steps which aren't constant, like digits[i]
+                value = self.vm.constant_value(obj.constant, self.vm.resolve(obj.type_))
+                return Name("value", type_=obj.type_, value=value), None, node.children
+            name = self.resolve(node.data[1])
+            steps = node.children
+            if (isinstance(name.value, interp.PackageRef) and steps
+                    and isinstance(steps[0], syntree.Selector)):
+                return self.member(name.value, steps[0].field_name), None, steps[1:]
+            return name, None, steps
+        return None, node.children[0], node.children[1:]
+
+    def prefix_type(self, node: syntree.PrimaryExpr, n: int) -> Any:
+        """The type of the primary expression up to its step n"""
+        name, base, steps = self.parts(node)
+        if n > 0:
+            return self.type_of(steps[n - 1])
+        return name.type_ if name is not None else self.type_of(base)
+
+    def primary(self, node: syntree.PrimaryExpr, comma_ok: bool = False):
+        _, _, steps = self.parts(node)
+        self.chain(node, len(steps), comma_ok=comma_ok)
+
+    def chain(self, node: syntree.PrimaryExpr, n: int, ref: bool = False, comma_ok: bool = False):
+        """Pushes the value of the primary expression up to its step n (with
+        comma_ok, and if its last index or type assertion succeeded), or the
+        variable it is if ref"""
+        name, base, steps = self.parts(node)
+        if n == 0:
+            if name is not None:
+                self.ref(name) if ref else self.load(name)
+            elif ref and isinstance(base, syntree.UnaryOp) and base.operator == "*":
+                self.expr(base.operand)
+                self.emit(CHECK_NIL)
+            else:
+                self.expr(base)
+                if ref:
+                    self.emit(NEW_REF)
+            return
+
+        step = steps[n - 1]
+        if isinstance(step, syntree.Index):
+            x = self.info.operands.get(step)
+            if is_type_expr(step.expr, self.info):
+                # an instantiation of a generic function, the type arguments
+                # are the ones of the call
+                self.chain(node, n - 1)
+                return
+            self.chain(node, n - 1)
+            if x is not None and x.mode == "mapindex":
+                self.map_key(node, step)
+                self.emit(GET_MAP, (x.type_, comma_ok))
+                if ref:
+                    self.emit(NEW_REF)
+                return
+            self.expr(step.expr)
+            self.emit(REF_INDEX if ref else GET_INDEX)
+
+        elif isinstance(step, syntree.SliceExpr):
+            self.chain(node, n - 1)
+            bounds = (step.low, step.high, step.max)
+            for bound in bounds:
+                if bound is not None:
+                    self.expr(bound)
+            self.emit(SLICE, tuple(bound is not None for bound in bounds))
+            if ref:
+                self.emit(NEW_REF)
+
+        elif isinstance(step, syntree.Selector):
+            selection = self.info.selections.get(step)
+            if selection is None:
+                raise Unsupported(f"selector .{step.field_name} can't be evaluated")
+            if selection.kind == "field":
+                self.chain(node, n - 1)
+                self.embedded(selection.path)
+                self.emit(REF_FIELD if ref else GET_FIELD, step.field_name)
+                return
+            if selection.kind == "methodexpr":
+                self.emit(METHOD_EXPR, selection)
+            else:
+                path = selection.path
+                # a promoted method is the one of the embedded field
+                recv_type = path[-1].type_ if path else selection.recv
+                addressed = (isinstance(selection.obj, syntree.Method)
+                             and selection.obj.pointer_receiver
+                             and not isinstance(underlying(recv_type), syntree.Pointer)
+                             and not syntree.is_interface(recv_type)
+                             and not isinstance(recv_type, syntree.TypeParam)
+                             and (path or self.addressable(node, n - 1)))
+                if path:
+                    # the checker made sure the embedded field is addressable
+                    self.chain(node, n - 1)
+                    self.embedded(path[:-1])
+                    self.emit(REF_FIELD if addressed else GET_FIELD, path[-1].f_name)
+                else:
+                    self.chain(node, n - 1, ref=addressed)
+                self.emit(METHOD, (selection, step.field_name, addressed))
+            if ref:
+                self.emit(NEW_REF)
+
+        elif isinstance(step, syntree.TypeAssertion):
+            self.chain(node, n - 1)
+            self.emit(ASSERT, (step, steps[n - 2] if n > 1 else None, comma_ok))
+            if ref:
+                self.emit(NEW_REF)
+
+    def embedded(self, path: list):
+        """Pushes the embedded field at the end of the path of the struct (or
+        of the pointer to it) on the stack, for a promoted field or method"""
+        for field in path:
+            self.emit(GET_FIELD, field.f_name)
+
+    def addressable(self, node: syntree.PrimaryExpr, n: int) -> bool:
+        """If the primary expression up to its step n is a variable"""
+        name, base, steps = self.parts(node)
+        if n == 0:
+            if name is not None:
+                return name.kind != "value"
+            return isinstance(base, syntree.UnaryOp) and base.operator == "*"
+        step = steps[n - 1]
+        if isinstance(step, syntree.Index):
+            x = self.info.operands.get(step)
+            return x is None or x.mode != "mapindex"
+        if isinstance(step, syntree.Selector):
+            selection = self.info.selections.get(step)
+            return selection is not None and selection.kind == "field"
+        return False
+
+    def map_key(self, node: syntree.PrimaryExpr, step: syntree.Index):
+        """Pushes the key of an index of a map, converted to the key type"""
+        _, _, steps = self.parts(node)
+        map_type = self.prefix_type(node, steps.index(step))
+        self.expr(step.expr)
+        if map_type is not None and isinstance(underlying(map_type), syntree.Map):
+            self.convert_to(self.type_of(step.expr), underlying(map_type).key)
+
+    def address(self, node):
+        """Pushes a pointer to the operand of &x"""
+        if isinstance(node, syntree.List):
+            node = in_order(node)[0]
+        if isinstance(node, syntree.UnaryOp) and node.operator == "*":
+            self.expr(node.operand)
+            self.emit(CHECK_NIL)
+        elif isinstance(node, syntree.PrimaryExpr):
+            _, _, steps = self.parts(node)
+            self.chain(node, len(steps), ref=True)
+        elif isinstance(node, syntree.Literal):
+            self.expr(node)
+            self.emit(NEW_REF, self.type_of(node))
+        else:
+            raise Unsupported(f"cannot take the address of {checker.expr_string(node)}")
+
+    def arith(self, operator_: str, t: Any) -> Callable:
+        if syntree.has_type_params(t):
+            vm = self.vm
+            return lambda x, y: vm.arith(operator_, x, y, vm.resolve(t))
+        typename = basic_typename(underlying(t)) if t is not None else None
+        if typename is not None and untyped.kind_of_typename(typename) == "string":
+            return self.vm.concat
+        return arithmetic(operator_, typename)
+
+    def binary(self, node: syntree.BinOp):
+        operator_ = node.operator
+        if operator_ in ("&&", "||"):
+            self.expr(node.left)
+            jump = self.emit(JUMP_IF_FALSE_OR_POP if operator_ == "&&" else JUMP_IF_TRUE_OR_POP)
+            self.expr(node.right)
+            self.patch(jump)
+            return
+
+        self.expr(node.left)
+        self.expr(node.right)
+        if operator_ in ("==", "!="):
+            self.equality(self.type_of(node.left), self.type_of(node.right), operator_)
+        elif operator_ in comparisons:
+            self.emit(BINARY, comparisons[operator_])
+        else:
+            self.emit(BINARY, self.arith(operator_, self.type_of(node)))
+
+    def equality(self, left: Any, right: Any, operator_: str):
+        if basic_kind(left) is not None and basic_kind(right) is not None:
+            self.emit(BINARY, comparisons[operator_])
+        else:
+            # a value compared to an interface is boxed
+            self.emit(EQUAL, (left, right, operator_ == "!="))
+
+    def unary(self, node: syntree.UnaryOp):
+        operator_ = node.operator
+        if operator_ == "&":
+            self.address(node.operand)
+            return
+        elif operator_ == "<-":
+            self.expr(node.operand)
+            self.emit(RECV, False)
+            return
+
+        self.expr(node.operand)
+        if operator_ == "*":
+            self.emit(DEREF)
+            return
+        t = self.type_of(node)
+        if syntree.has_type_params(t):
+            vm = self.vm
+            typename_of = lambda: basic_typename(underlying(vm.resolve(t)))  # noqa: E731
+        else:
+            typename = basic_typename(underlying(t)) if t is not None else None
+            typename_of = lambda: typename  # noqa: E731
+        if operator_ == "!":
+            self.emit(NOT)
+        elif operator_ == "-":
+            self.emit(UNARY, lambda x: interp.wrap(-x, typename_of()))
+        elif operator_ == "^":
+            def complement(x):
+                name = typename_of()
+                if name is not None and untyped.is_unsigned(name):
+                    return x ^ ((1 << untyped.int_size(name)) - 1)
+                return interp.wrap(~x, name or "int")
+            self.emit(UNARY, complement)
+        elif operator_ != "+":
+            raise Unsupported(f"operator {operator_}")
+
+    def call(self, node: syntree.FunctionCall, defer: bool = False, go: bool = False):
+        args = in_order(node.arguments.expression_list)
+        if node.arguments.type_ is not None:
+            args = [node.arguments.type_] + args
+        ellipsis = node.arguments.ellipsis
+        fn_name = node.fn_name
+        if isinstance(fn_name, str):
+            callee = self.resolve(fn_name)
+            value = callee.value if callee.kind == "value" else None
+        else:
+            x = self.info.operands.get(fn_name)
+            value = None
+            if x is not None and x.mode == "builtin":
+                value = interp.Builtin(checker.expr_string(fn_name))
+            elif x is not None and x.mode == "type":
+                value = interp.TypeName(x.type_)
+
+        if isinstance(value, interp.Builtin):
+            types = []
+            for arg in args:
+                x = self.info.operands.get(arg)
+                if isinstance(arg, syntree.Type) or (x is not None and x.mode == "type"):
+                    self.emit(TYPE, arg if isinstance(arg, syntree.Type) else x.type_)
+                    types.append(None)
+                else:
+                    self.expr(arg)
+                    types.append(self.type_of(arg))
+            if value.name == "len" and not defer and not go:
+                self.emit(LEN)
+                return
+            site = CallSite(len(args), types, ellipsis, name=value.name)
+            self.emit(DEFER_BUILTIN if defer else GO_BUILTIN if go else BUILTIN, site)
+            return
+
+        if isinstance(value, interp.TypeName):
+            if defer or go:
+                raise Unsupported(f"conversions can't be {'deferred' if defer else 'run in goroutines'}")
+            self.expr(args[0])
+            self.emit(CONVERT, (self.type_of(args[0]), value.type_))
+            return
+
+        if isinstance(fn_name, str):
+            self.load(callee)
+        else:
+            self.expr(fn_name)
+        types = self.values(args) if args else []
+        site = CallSite(len(types), types, ellipsis, getattr(node, "type_args", None))
+        self.emit(DEFER if defer else GO if go else CALL, site)
+
+
+def is_type_expr(node, info: checker.Info) -> bool:
+    """If the index of an expression is a list of types, for an instantiation"""
+    if isinstance(node, syntree.Type):
+        return True
+    if isinstance(node, syntree.List):
+        return all(is_type_expr(item, info) for item in in_order(node))
+    x = info.operands.get(node)
+    return x is not None and x.mode == "type"
+
+
+def disassemble(code: Code) -> str:
+    """The instructions of the code, with the line of the statements
+    they are part of. Jumps are to the number of an instruction"""
+    lines = [f"{code.name}:"]
+    previous = None
+    for pc, (op, arg, line) in enumerate(zip(code.ops, code.args, code.lines)):
+        lineno = str(line) if line != previous else ""
+        previous = line
+        lines.append(f"{lineno:>5} {pc:>5} {opnames[op]:<20} {argument_string(code, op, arg)}")
+    return "\n".join(lines)
+
+
+def argument_string(code: Code, op: int, arg: Any) -> str:
+    if arg is None:
+        return ""
+    if op in (LOAD, STORE, LOAD_CELL, STORE_CELL, NEW_CELL, RENEW, REF):
+        return f"{arg} ({code.names.get(arg, 'temp')})"
+    if op == CONST and isinstance(arg, bytes):
+        return repr(arg.decode("utf-8", "replace"))
+    if op == CONST and isinstance(arg, Function):
+        return f"func {arg.node.fn_name[1] if arg.node.fn_name else ''}"
+    if op in (LOAD_GLOBAL, STORE_GLOBAL):
+        return "package variable"
+    if op in (BINARY, UNARY):
+        return getattr(arg, "__name__", "")
+    if op == MAKE_CLOSURE:
+        return f"{arg[0].name} {arg[1]}"
+    if op == METHOD:
+        return arg[1]
+    if op == RACE:
+        return opnames[arg[0]]
+    if op in (ZERO, TYPE, BOX, TYPE_CASE, NEW_REF):
+        return type_string(arg)
+    if op in (ASSIGN, CONVERT, EQUAL, MAKE_STRUCT, MAKE_ARRAY, MAKE_MAP, GET_MAP):
+        return " ".join(type_string(a) if isinstance(a, syntree.Type) else str(a) for a in arg)
+    if op == COVER:
+        return f"{arg.file}:{arg.start[0]}.{arg.start[1]},{arg.end[0]}.{arg.end[1]}"
+    return str(arg)
+
+
+def run_program(packages: list, info: checker.Info, out=None,
+                argv: Optional[List[str]] = None, clock: Optional[interp.Clock] = None,
+                debugger: Any = None, entry: str = "main", profiler: Any = None,
+                ctx: Optional[cancel.Context] = None, max_steps: Optional[int] = None,
+                limits: Optional[sandbox.Limits] = None, detect_races: bool = False) -> int:
+    """Runs the program of the packages (its own package is the last one)
+    with the VM, see Interpreter.run_program. argv is os.Args, clock the
+    one of the time package, debugger the debug.Debugger of gopy debug,
+    entry the function run instead of main, profiler the pprof.Profiler
+    profiling the run. The run is aborted once ctx is done, or past
+    max_steps steps (its calls and its jumps back, see Interpreter.step), or
+    past the limits of its sandbox (see sandbox.py). The data races of its
+    goroutines are reported if detect_races (see race.py), then it exits
+    with 66 instead of 0, like Go"""
+    sys.setrecursionlimit(max(sys.getrecursionlimit(), 20000))
+    machine = VM(info, out, argv, clock)
+    machine.debugger = debugger
+    machine.ctx = ctx
+    machine.max_steps = max_steps
+    if limits is not None:
+        machine.limits = limits
+    if detect_races:
+        machine.race = race.Detector(machine)
+    if profiler is not None:
+        profiler.start(machine)
+    try:
+        code = machine.run_program(packages, entry)
+    finally:
+        if profiler is not None:
+            profiler.stop()
+    summary = machine.race.summary() if machine.race is not None else None
+    if summary is not None:
+        machine.output().flush()
+        print(summary, file=machine.errors())
+        if code == 0:
+            code = 66
+    return code
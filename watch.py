@@ -0,0 +1,234 @@
+import io
+import os
+import time
+import subprocess
+import contextlib
+
+from collections import Counter
+from datetime import datetime
+from typing import Dict, List, Optional, Tuple
+
+from colorama import Fore, Style
+
+import diagnostics
+import incremental
+import loader
+import lsp
+import utils
+
+from diagnostics import Diagnostic
+from incremental import capturing
+
+
+# Watch mode (gopy check --watch and gopy run --watch): the files of the
+# program are checked again each time they are saved. They are polled every
+# interval seconds, and once they stay the same for debounce seconds (an
+# editor saving several files, or a file in several writes) the changes are
+# edits of the incremental.Tree of its own package, like the ones of the
+# language server (see lsp.Program): only the declarations they change are
+# parsed again, then the package is type checked again. A change of the
+# imports, of a package imported, or a file added or removed loads the
+# whole program again. What changed is printed:
+#
+#   [15:04:05] main.go changed
+#   + the diagnostics found since the last check, in full
+#   - fixed: main.go:12:5: undefined: count
+#   1 new, 1 fixed (1 error)
+#
+# run runs the program again if it has no errors, with the command given
+# (gopy run and its flags) in a process of its own, which is stopped by the
+# next change if it didn't end: the intermediate code is generated from a
+# full parse (see incremental.py).
+
+# the seconds between the polls of the files, and the ones they have to
+# stay the same before they are checked
+interval = 0.1
+debounce = 0.2
+
+
+def stamp(filename: str) -> Optional[Tuple[float, int]]:
+    """What tells that a file changed, None if it doesn't exist"""
+    try:
+        st = os.stat(filename)
+    except OSError:
+        return None
+    return st.st_mtime, st.st_size
+
+
+def edit_of(old: str, new: str) -> Optional[incremental.Edit]:
+    """The edit making new of old (the part between what they start and
+    end with), None if they are the same"""
+    if old == new:
+        return None
+    start = len(os.path.commonprefix([old, new]))
+    end = len(os.path.commonprefix([old[start:][::-1], new[start:][::-1]]))
+    return incremental.Edit(start, len(old) - start - end, new[start:len(new) - end])
+
+
+def key(d: Diagnostic) -> tuple:
+    """What identifies a diagnostic from a check to the next, whatever
+    the lines moved by the edits: its file, its message and its line"""
+    lines = utils.sources.get(d.file, [])
+    line = lines[d.lineno - 1].strip() if d.lineno is not None and 0 < d.lineno <= len(lines) \
+        else ""
+    return d.file, d.kind, d.severity, d.message, line
+
+
+def location(d: Diagnostic) -> str:
+    parts = [str(p) for p in (d.file, d.lineno, d.col_num) if p is not None]
+    return ":".join(parts)
+
+
+def plural(n: int, word: str) -> str:
+    return f"{n} {word}" + ("" if n == 1 else "s")
+
+
+class Watcher:
+    """Checks the program of path (a .go file or a directory) each time its
+    files change, and runs it again with command if it isn't None"""
+
+    def __init__(self, path: str, warnings: bool = False, command: Optional[List[str]] = None):
+        self.path = path
+        self.command = command
+        self.program = lsp.Program(path, warnings)
+        # the stamps of the files of the program, and of the .go files of
+        # the directories of its packages (the files added)
+        self.stamps: Dict[str, Optional[Tuple[float, int]]] = {}
+        # the diagnostics of the last check, with their keys
+        self.found: List[Tuple[tuple, Diagnostic]] = []
+        self.process: Optional[subprocess.Popen] = None
+
+    def dirs(self) -> List[str]:
+        """The directories whose .go files are the ones of a package, the
+        files added to them are watched too"""
+        return sorted({package.dir for package in self.program.packages if not package.std
+                       and (package is not self.program.package or os.path.isdir(self.path))})
+
+    def files(self) -> List[str]:
+        """The files watched"""
+        files = {filename for package in self.program.packages if not package.std
+                 for filename in package.files}
+        for dir in self.dirs():
+            files.update(loader.package_files(dir, False))
+        if not self.program.packages:
+            files.add(self.path)
+        return sorted(files)
+
+    def snapshot(self):
+        self.stamps = {filename: stamp(filename) for filename in self.files()}
+
+    def changed(self) -> List[str]:
+        """The files changed (or added) since the last snapshot"""
+        changed = [filename for filename, was in self.stamps.items() if stamp(filename) != was]
+        return changed + [filename for dir in self.dirs() for filename in loader.package_files(dir)
+                          if filename not in self.stamps]
+
+    def watch(self) -> int:
+        """Checks (and runs) the program until it is interrupted"""
+        self.snapshot()
+        self.report([])
+        try:
+            while True:
+                time.sleep(interval)
+                self.poll()
+                changed = self.changed()
+                if not changed:
+                    continue
+                # until they stay the same
+                while True:
+                    stamps = {filename: stamp(filename) for filename in self.files()}
+                    time.sleep(debounce)
+                    if {filename: stamp(filename) for filename in self.files()} == stamps:
+                        break
+                changed = self.changed()
+                self.stop()
+                self.update(changed)
+                self.snapshot()
+                self.report(changed)
+        except KeyboardInterrupt:
+            self.stop()
+            return 0
+
+    def update(self, changed: List[str]):
+        """Parses the changes of the files again, then checks the program"""
+        program = self.program
+        package = program.package
+        own = set(package.files) if package is not None else set()
+        if not all(filename in own and stamp(filename) is not None for filename in changed):
+            program.load()
+            return
+        for filename in changed:
+            edit = edit_of(program.tree.text(filename), utils.read_source(filename))
+            if edit is not None:
+                program.edit(filename, [edit])
+
+    def report(self, changed: List[str]):
+        """Prints the diagnostics new and fixed since the last check, then
+        runs the program if it has no errors"""
+        found = [(key(d), d) for d in self.program.found]
+        if changed:
+            print(f"{Style.DIM}[{datetime.now():%H:%M:%S}]{Style.RESET_ALL} "
+                  f"{', '.join(changed)} changed")
+        before, after = Counter(k for k, _ in self.found), Counter(k for k, _ in found)
+        new = []
+        for k, d in found:
+            if before[k] > 0:
+                before[k] -= 1
+            else:
+                new.append(d)
+        fixed = []
+        for k, d in self.found:
+            if after[k] > 0:
+                after[k] -= 1
+            else:
+                fixed.append(d)
+        for d in new:
+            print(f"{Fore.RED}+{Style.RESET_ALL} ", end="")
+            diagnostics.print_diagnostic(d)
+        for d in fixed:
+            print(f"{Fore.GREEN}- fixed: {location(d)}: {d.message}{Style.RESET_ALL}")
+        errors = sum(d.severity == "error" for _, d in found)
+        warnings = sum(d.severity == "warning" for _, d in found)
+        totals = [plural(errors, "error")] + ([plural(warnings, "warning")] if warnings else [])
+        color = Fore.RED if errors else Fore.YELLOW if warnings else Fore.GREEN
+        delta = [f"{len(new)} new" if new else "", f"{len(fixed)} fixed" if fixed else ""]
+        delta = ", ".join(part for part in delta if part) or "no change" if changed else ""
+        print(f"{color}{delta + ' (' if delta else ''}{', '.join(totals)}"
+              f"{')' if delta else ''}{Style.RESET_ALL}", flush=True)
+        self.found = found
+        if self.command is not None and not errors:
+            self.process = subprocess.Popen(self.command)
+
+    def poll(self):
+        """Prints the exit status of the run once it ends"""
+        if self.process is None or self.process.poll() is None:
+            return
+        status = self.process.returncode
+        color = Fore.GREEN if status == 0 else Fore.RED
+        print(f"{color}exit status {status}{Style.RESET_ALL}", flush=True)
+        self.process = None
+
+    def stop(self):
+        """Stops the run if it didn't end"""
+        if self.process is None:
+            return
+        if self.process.poll() is None:
+            self.process.terminate()
+            try:
+                self.process.wait(5)
+            except subprocess.TimeoutExpired:
+                self.process.kill()
+                self.process.wait()
+            print(f"{Fore.YELLOW}stopped{Style.RESET_ALL}", flush=True)
+            self.process = None
+        else:
+            self.poll()
+
+
+def watch(path: str, warnings: bool = False, command: Optional[List[str]] = None) -> int:
+    """Checks the program of path each time its files change, and runs it
+    with command (if it isn't None) while it has no errors"""
+    diagnostics.printing = False
+    with capturing([]), contextlib.redirect_stdout(io.StringIO()):
+        watcher = Watcher(path, warnings, command)
+    return watcher.watch()
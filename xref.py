@@ -0,0 +1,163 @@
+import re
+
+import fileset
+import checker
+import syntree
+import utils
+
+from dataclasses import dataclass
+from typing import Dict, List, Optional, Tuple
+
+
+# The cross references of a program type checked: where each of its objects
+# (a constant, a variable, a type, a function, a method, a field or a
+# package imported) is declared and used, for the tools finding all its
+# references (like gopy refs, or a rename). The index is made of what the
+# type checker recorded while checking it, the identifiers in Info.defs and
+# Info.uses, the selectors of Info.selections, the methods of Info.methods
+# and the keys of the struct literals of Info.keys, and of the types written
+# by their name (see syntree.TypeRef), in the files of the packages of the
+# program (not the ones of std):
+#
+#   info = checker.Info()
+#   packages = go_parser.check_program("tests/xref.go", info=info)
+#   index = xref.Index(packages, info)
+#   obj = index.object_at("tests/xref.go", 9, 6)
+#   index.references(obj)
+#
+#   python go_parser.py refs tests/xref.go:#213
+#
+# prints the references of what is at the offset 213 (in characters) of
+# the file, -d with its declaration.
+
+
+@dataclass
+class Ref:
+    """Where the name of obj is written, declaring it if declaration"""
+
+    obj: checker.Object
+    file: str
+    lineno: int
+    col_num: int
+    declaration: bool = False
+
+    @property
+    def width(self) -> int:
+        return len(self.obj.name)
+
+    def __str__(self) -> str:
+        return f"{self.file}:{self.lineno}:{self.col_num}-{self.col_num + self.width}"
+
+
+class Index:
+    """The references of the objects of the packages checked with info"""
+
+    def __init__(self, packages: list, info: checker.Info):
+        self.info = info
+        self.files = {file for package in packages if not package.std
+                      for file in package.files}
+        # the references of each object, by its id
+        self.refs: Dict[int, List[Ref]] = {}
+        # the references in each file
+        self.in_files: Dict[str, List[Ref]] = {}
+        # the objects of the types declared, by the id of their type
+        self.types: Dict[int, checker.Object] = {}
+        # the scope of each file, with its imports
+        self.file_scopes = {node.filename: scope for node, scope in info.scopes.items()
+                            if isinstance(node, syntree.File)}
+        self.index()
+
+    def add(self, obj: Optional[checker.Object], file: Optional[str], lineno: Optional[int],
+            col_num: Optional[int], declaration: bool = False):
+        if obj is None or obj.lineno is None or file not in self.files \
+                or lineno is None or col_num is None:
+            return
+        refs = self.refs.setdefault(id(obj), [])
+        if any(ref.file == file and (ref.lineno, ref.col_num) == (lineno, col_num)
+               for ref in refs):
+            return
+        ref = Ref(obj, file, lineno, col_num, declaration)
+        refs.append(ref)
+        self.in_files.setdefault(file, []).append(ref)
+
+    def index(self):
+        info = self.info
+        for node, obj in info.defs.items():
+            if obj.kind == "type":
+                self.types[id(obj.type_)] = obj
+            lineno, col_num, _ = checker.position(node)
+            self.add(obj, info.files.get(node), lineno, col_num, declaration=True)
+        for obj in info.methods.values():
+            self.add(obj, obj.file, obj.lineno, obj.col_num, declaration=True)
+        for node, obj in info.uses.items():
+            file = info.files.get(node)
+            if isinstance(node, syntree.QualifiedIdent):
+                package, member = node.data
+                self.add(self.package(file, package[1]), file, node.lineno, package[2])
+                self.add(obj, file, node.lineno, member[2])
+            else:
+                lineno, col_num, _ = checker.position(node)
+                self.add(obj, file, lineno, col_num)
+        for node, selection in info.selections.items():
+            if isinstance(selection.obj, syntree.Method):
+                obj = info.methods.get(selection.obj)
+            else:
+                obj = info.defs.get(getattr(selection.obj, "ident", None))
+            lineno, col_num, _ = checker.position(node)
+            self.add(obj, info.files.get(node) or file_of(node.pos), lineno, col_num)
+        for key, field in info.keys.items():
+            lineno, col_num, _ = checker.position(key)
+            self.add(info.defs.get(field.ident), file_of(key.pos), lineno, col_num)
+        for ref in syntree.type_refs.values():
+            self.type_ref(ref)
+
+    def type_ref(self, ref: syntree.TypeRef):
+        """Adds the type (and the package) a TypeRef names"""
+        file = file_of(ref.pos)
+        if file not in self.files or ref.type_ is None:
+            return
+        type_ = getattr(ref.type_, "origin", None) or ref.type_
+        start = fileset.fset.position(ref.pos)
+        name = ref.name
+        if "." in name:
+            package, name = name.split(".", 1)
+            self.add(self.package(file, package), file, start.line, start.column)
+        position = fileset.fset.position(ref.pos + len(ref.name) - len(name))
+        self.add(self.types.get(id(type_)), file, position.line, position.column)
+
+    def package(self, file: Optional[str], name: str) -> Optional[checker.Object]:
+        """The package imported with the name in the file"""
+        scope = self.file_scopes.get(file)
+        obj = scope.objects.get(name) if scope is not None else None
+        return obj if obj is not None and obj.kind == "package" else None
+
+    def references(self, obj: checker.Object, declarations: bool = True) -> List[Ref]:
+        """The references of obj in the order they are in the files, its
+        declaration too if declarations"""
+        refs = [ref for ref in self.refs.get(id(obj), []) if declarations or not ref.declaration]
+        return sorted(refs, key=lambda ref: (ref.file, ref.lineno, ref.col_num))
+
+    def object_at(self, filename: str, lineno: int, col_num: int) -> Optional[checker.Object]:
+        """The object whose name is at the position, None if there is none"""
+        for ref in self.in_files.get(filename, []):
+            if ref.lineno == lineno and ref.col_num <= col_num < ref.col_num + ref.width:
+                return ref.obj
+        return None
+
+
+def file_of(pos: int) -> Optional[str]:
+    file = fileset.fset.file(pos) if pos != fileset.NoPos else None
+    return file.name if file is not None else None
+
+
+def parse_location(arg: str) -> Tuple[str, int, int]:
+    """The (file, lineno, col_num) of a position given as file.go:#offset
+    (in characters) or file.go:line:column, raises ValueError if it isn't"""
+    m = re.fullmatch(r"(.+):#(\d+)", arg)
+    if m is not None:
+        filename = m.group(1)
+        return (filename,) + utils.line_column(utils.read_source(filename), int(m.group(2)))
+    m = re.fullmatch(r"(.+):(\d+):(\d+)", arg)
+    if m is None:
+        raise ValueError(f"invalid position {arg}, it is file.go:#offset or file.go:line:column")
+    return m.group(1), int(m.group(2)), int(m.group(3))